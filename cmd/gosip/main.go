@@ -5,30 +5,97 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
+	"github.com/btafoya/gosip/internal/announcements"
 	"github.com/btafoya/gosip/internal/api"
+	"github.com/btafoya/gosip/internal/blocklist"
+	"github.com/btafoya/gosip/internal/calendar"
+	"github.com/btafoya/gosip/internal/changesets"
+	"github.com/btafoya/gosip/internal/compliance"
 	"github.com/btafoya/gosip/internal/config"
 	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/diagnostics"
+	"github.com/btafoya/gosip/internal/didwebhooks"
+	"github.com/btafoya/gosip/internal/discovery"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/integrity"
+	"github.com/btafoya/gosip/internal/failover"
+	"github.com/btafoya/gosip/internal/logging"
+	"github.com/btafoya/gosip/internal/notifications"
+	"github.com/btafoya/gosip/internal/passwords"
+	"github.com/btafoya/gosip/internal/portmap"
+	"github.com/btafoya/gosip/internal/publicurl"
+	"github.com/btafoya/gosip/internal/reminders"
+	"github.com/btafoya/gosip/internal/replica"
+	"github.com/btafoya/gosip/internal/retry"
+	"github.com/btafoya/gosip/internal/secrets"
+	"github.com/btafoya/gosip/internal/smtpd"
+	"github.com/btafoya/gosip/internal/storage"
+	"github.com/btafoya/gosip/internal/tftp"
 	"github.com/btafoya/gosip/internal/twilio"
+	"github.com/btafoya/gosip/internal/twilioips"
+	"github.com/btafoya/gosip/internal/verify"
+	"github.com/btafoya/gosip/internal/wanip"
 	"github.com/btafoya/gosip/pkg/sip"
 )
 
 func main() {
-	// Initialize structured logging
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
+	// Initialize structured logging. The JSON handler passes every level
+	// and the per-subsystem levels, adjustable at runtime, do the filtering.
+	// Recent lines are also kept for diagnostics bundles.
+	diagnosticsStore := diagnostics.NewStore(config.DiagnosticsMaxCrashes, config.DiagnosticsMaxLogLines)
+	logLevels := logging.NewLevels(slog.LevelInfo)
+	logger := slog.New(logging.NewHandler(diagnostics.TeeHandler{
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		diagnosticsStore.LogHandler(),
+	}, logLevels))
 	slog.SetDefault(logger)
 
 	slog.Info("Starting GoSIP", "version", "1.0.0")
 
-	// Load configuration
-	cfg := config.Load()
+	// Load configuration: environment variables, then the config file, then defaults
+	cfg, err := config.LoadFile(os.Getenv("GOSIP_CONFIG_FILE"))
+	if err != nil {
+		slog.Error("Invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	if cfg.File() != "" {
+		slog.Info("Loaded config file", "path", cfg.File())
+	}
+	retry.Configure(cfg.Retry)
+	// Fetch secrets kept in Vault or AWS Secrets Manager
+	if err := secrets.NewResolver(cfg.Secrets).ResolveConfig(context.Background(), cfg); err != nil {
+		slog.Error("Failed to load secrets", "error", err)
+		os.Exit(1)
+	}
+	if cfg.DebugMode {
+		logLevels.Set(logging.Default, slog.LevelDebug)
+		for _, subsystem := range logging.Subsystems() {
+			logLevels.Set(subsystem, slog.LevelDebug)
+		}
+	}
+	if len(cfg.APIAllowlist.Invalid) > 0 {
+		slog.Error("Invalid GOSIP_API_ALLOWLIST entries", "entries", cfg.APIAllowlist.Invalid)
+		os.Exit(1)
+	}
+	if cfg.APIAllowlist.Enabled() {
+		slog.Info("API allowlist enabled", "networks", len(cfg.APIAllowlist.Networks), "admin_only", cfg.APIAllowlist.AdminOnly)
+	}
+	if len(cfg.SIPAllowlist.Invalid) > 0 {
+		slog.Error("Invalid GOSIP_SIP_ALLOWLIST entries", "entries", cfg.SIPAllowlist.Invalid)
+		os.Exit(1)
+	}
+	if len(cfg.MailGatewayAllowlist.Invalid) > 0 {
+		slog.Error("Invalid GOSIP_MAIL_GATEWAY_ALLOWLIST entries", "entries", cfg.MailGatewayAllowlist.Invalid)
+		os.Exit(1)
+	}
 
 	// Ensure data directories exist
 	if err := cfg.EnsureDirectories(); err != nil {
@@ -36,8 +103,18 @@ func main() {
 		os.Exit(1)
 	}
 
+	// A new container with an empty data volume starts from the latest replica snapshot
+	restored, err := replica.Restore(context.Background(), cfg, cfg.DBPath())
+	if err != nil {
+		slog.Error("Failed to restore database from replica", "error", err)
+		os.Exit(1)
+	}
+	if restored != "" {
+		slog.Info("Restored database from replica", "snapshot", restored)
+	}
+
 	// Initialize database
-	database, err := db.New(cfg.DBPath())
+	database, err := db.Open(cfg.Database, cfg.DBPath())
 	if err != nil {
 		slog.Error("Failed to initialize database", "error", err)
 		os.Exit(1)
@@ -50,20 +127,47 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Settings pinned by the config file or environment replace those changed in the web UI
+	if err := cfg.ApplySettings(context.Background(), database.Config); err != nil {
+		slog.Error("Failed to apply configured settings", "error", err)
+		os.Exit(1)
+	}
+
 	// Create context with cancellation for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Calls whose media GoSIP carries can be recorded
+	recordingsDir := ""
+	if cfg.RecordingEnabled {
+		recordingsDir = cfg.RecordingsPath()
+	}
+
 	// Initialize SIP server
 	sipServer, err := sip.NewServer(sip.Config{
-		Port:      cfg.SIPPort,
-		UserAgent: config.DefaultUserAgent,
+		Port:       cfg.SIPPort,
+		UserAgent:  config.DefaultUserAgent,
+		DataDir:    cfg.DataDir,
+		TLS:        cfg.TLS,
+		CallLimits: cfg.CallLimits,
+		Media:      cfg.Media,
+		WebRTC:     cfg.WebRTC,
+		MediaRelay: cfg.MediaRelay,
+		ExternalIP: cfg.ExternalIP,
+
+		RecordingsDir: recordingsDir,
+		VoicemailsDir: cfg.VoicemailsPath(),
 	}, database)
 	if err != nil {
 		slog.Error("Failed to initialize SIP server", "error", err)
 		os.Exit(1)
 	}
 
+	// Shared event stream for API clients and SIP call limit notifications
+	eventHub := events.NewHub(config.EventHistorySize)
+	sipServer.SetEventHub(eventHub)
+	sipServer.SetDiagnostics(diagnosticsStore)
+
 	// Start SIP server
 	if err := sipServer.Start(ctx); err != nil {
 		slog.Error("Failed to start SIP server", "error", err)
@@ -74,9 +178,12 @@ func main() {
 	// Initialize Twilio client
 	twilioClient := twilio.NewClient(cfg)
 
-	// Load Twilio credentials from database if they exist
-	if accountSID, err := database.Config.Get(ctx, "twilio_account_sid"); err == nil && accountSID != "" {
-		if authToken, err := database.Config.Get(ctx, "twilio_auth_token"); err == nil && authToken != "" {
+	// Load Twilio credentials from database if they exist. An auth token from
+	// the environment, a secret file or a secret store is used instead.
+	if accountSID, err := database.Config.Get(ctx, "twilio_account_sid"); err == nil && accountSID != "" && cfg.TwilioAccountSID == "" {
+		if cfg.TwilioAuthToken != "" {
+			twilioClient.UpdateCredentials(accountSID, cfg.TwilioAuthToken)
+		} else if authToken, err := database.Config.Get(ctx, "twilio_auth_token"); err == nil && authToken != "" {
 			twilioClient.UpdateCredentials(accountSID, authToken)
 			slog.Info("Twilio credentials loaded from database")
 		}
@@ -86,13 +193,134 @@ func main() {
 	defer twilioClient.Stop()
 	slog.Info("Twilio client initialized")
 
+	// Raise system announcements such as an expiring TLS certificate
+	announcements.NewMonitor(database, eventHub, sipServer.GetTLSStatus).Start(ctx)
+
+	// Refresh community blocklist feeds on schedule
+	feedSyncer := blocklist.NewSyncer(database)
+	feedSyncer.Start(ctx)
+
+	// Sync linked user calendars for availability-based routing
+	calendarSyncer := calendar.NewSyncer(database)
+	calendarSyncer.Start(ctx)
+
+	// Apply and revert scheduled change sets
+	changesets.NewScheduler(database).Start(ctx)
+
+	// Follow public IP changes into dynamic DNS and Twilio origination URLs
+	wanIPMonitor := wanip.NewMonitor(cfg, database, eventHub, twilioClient)
+	wanIPMonitor.Start(ctx)
+
+	// Verify Twilio trunk disaster recovery settings are still in place
+	trunkFailover := failover.NewManager(database, eventHub, twilioClient)
+	trunkFailover.Start(ctx)
+
+	// Verify Twilio numbers still send their webhooks to this server
+	didWebhooks := didwebhooks.NewManager(cfg, database, eventHub, twilioClient)
+	didWebhooks.Start(ctx)
+
+	// Check the public base URL links and webhooks are built from
+	publicURL := publicurl.NewMonitor(cfg, database, eventHub)
+	publicURL.Start(ctx)
+
+	// Ask the router to forward the SIP and RTP ports
+	portMapper := portmap.NewMapper(cfg)
+	portMapper.Start(ctx)
+	defer portMapper.Close()
+
+	// Stream database snapshots to the replica for a warm standby
+	replicator, err := replica.NewReplicator(cfg, database, cfg.DBPath())
+	if err != nil {
+		slog.Error("Failed to initialize database replication", "error", err)
+		os.Exit(1)
+	}
+	replicator.SetRestoredFrom(restored)
+	replicator.Start(ctx)
+	defer replicator.Close()
+
+	// Retry queued emails the relay didn't accept
+	notifier := notifications.NewNotifier(cfg, database)
+	notifier.Start(ctx)
+
+	// Send appointment reminders and the daily digest of unconfirmed ones
+	reminders.NewScheduler(cfg, database, twilioClient, notifier).Start(ctx)
+
+	// Write requested compliance exports
+	complianceExporter := compliance.NewExporter(cfg, database)
+	complianceExporter.Start(ctx)
+
+	// Watch disk usage and refuse new recordings before the disk fills up
+	storageMonitor := storage.NewMonitor(cfg, database, eventHub, notifier)
+	storageMonitor.Start(ctx)
+	sipServer.SetStorageCheck(storageMonitor.Low)
+
+	// Check recording and voicemail files against their checksums daily
+	integrityMonitor := integrity.NewMonitor(cfg, database, eventHub)
+	integrityMonitor.Start(ctx)
+
+	// Keep Twilio's address ranges, and optionally accept UDP SIP only from them
+	twilioRanges := twilioips.NewList(cfg, database)
+	twilioRanges.Load(ctx)
+	if twilioRanges.Enforced() {
+		sipServer.SetSourceFilter(twilioRanges.AllowsSIP)
+		slog.Info("UDP SIP restricted to Twilio and private networks", "extra_networks", len(cfg.SIPAllowlist.Networks))
+	}
+
 	// Initialize and start HTTP server
-	router := api.NewRouter(&api.Dependencies{
-		Config: cfg,
-		DB:     database,
-		SIP:    sipServer,
-		Twilio: twilioClient,
-	})
+	deps := &api.Dependencies{
+		Config:            cfg,
+		DB:                database,
+		SIP:               sipServer,
+		Twilio:            twilioClient,
+		Events:            eventHub,
+		Scanner:           discovery.NewScanner(),
+		FeedSyncer:        feedSyncer,
+		Calendars:         calendarSyncer,
+		Breaches:          passwords.NewBreachChecker(),
+		Notifier:          notifier,
+		Logging:           logLevels,
+		Diagnostics:       diagnosticsStore,
+		WANIP:             wanIPMonitor,
+		PortMap:           portMapper,
+		Replica:           replicator,
+		Failover:          trunkFailover,
+		DIDWebhooks:       didWebhooks,
+		PublicURL:         publicURL,
+		ComplianceExports: complianceExporter,
+		Verify:            verify.NewService(database, twilioClient),
+		Storage:           storageMonitor,
+		Integrity:         integrityMonitor,
+		TwilioRanges:      twilioRanges,
+	}
+	router := api.NewRouter(deps)
+
+	// Calls from plain SIP trunks routed to voicemail are recorded locally
+	sipServer.SetVoicemailHooks(api.NewVoicemailHooks(deps))
+
+	// Start the TFTP provisioning responder if configured
+	if cfg.TFTPPort > 0 {
+		tftpServer := tftp.NewServer(api.NewProvisioningHandler(deps).ServeTFTP)
+		defer tftpServer.Close()
+		go func() {
+			slog.Info("TFTP provisioning responder started", "port", cfg.TFTPPort)
+			if err := tftpServer.ListenAndServe(fmt.Sprintf(":%d", cfg.TFTPPort)); err != nil {
+				slog.Error("TFTP server error", "error", err)
+			}
+		}()
+	}
+
+	// Start the email-to-SMS gateway listener if configured
+	if cfg.MailGatewayPort > 0 {
+		mailServer := smtpd.NewServer(api.NewMailGatewayHandler(deps), cfg.SIPDomain, config.MailGatewayMaxMessageSize)
+		defer mailServer.Close()
+		go func() {
+			addr := net.JoinHostPort(cfg.MailGatewayBind, strconv.Itoa(cfg.MailGatewayPort))
+			slog.Info("Email gateway listener started", "addr", addr, "allowed_networks", len(cfg.MailGatewayAllowlist.Networks))
+			if err := mailServer.ListenAndServe(addr); err != nil {
+				slog.Error("Email gateway server error", "error", err)
+			}
+		}()
+	}
 
 	httpServer := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.HTTPPort),
@@ -0,0 +1,195 @@
+// Package announcements raises and clears system announcement banners from health checks
+package announcements
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/pkg/sip"
+)
+
+// Keys of the system announcements raised by health checks
+const (
+	KeyCertExpiring  = "cert_expiring"
+	KeyBackupFailed  = "backup_failed"
+	KeyTrunkFailover = "trunk_failover_broken"
+	KeyDIDWebhooks   = "did_webhooks_drifted"
+	KeyPublicURL     = "public_url_problems"
+	KeyLowDisk       = "low_disk_space"
+	KeyMediaDamaged  = "media_damaged"
+)
+
+// Monitor periodically runs the system health checks that raise announcements
+type Monitor struct {
+	database  *db.DB
+	hub       *events.Hub
+	tlsStatus func() *sip.CertStatus
+}
+
+// NewMonitor creates a Monitor. tlsStatus reports the SIP TLS certificate
+// and may be nil when TLS is not available.
+func NewMonitor(database *db.DB, hub *events.Hub, tlsStatus func() *sip.CertStatus) *Monitor {
+	return &Monitor{
+		database:  database,
+		hub:       hub,
+		tlsStatus: tlsStatus,
+	}
+}
+
+// Start runs the checks now and then every AnnouncementCheckInterval
+func (m *Monitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(config.AnnouncementCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			m.Check(ctx, time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Check runs every health check once
+func (m *Monitor) Check(ctx context.Context, now time.Time) {
+	if m.tlsStatus != nil {
+		CheckCertificate(ctx, m.database, m.hub, m.tlsStatus(), now)
+	}
+}
+
+// CheckCertificate warns when the TLS certificate has expired or expires
+// within CertExpiryWarning, and clears the warning once it is renewed
+func CheckCertificate(ctx context.Context, database *db.DB, hub *events.Hub, status *sip.CertStatus, now time.Time) {
+	if status == nil || !status.Enabled || status.CertExpiry.IsZero() {
+		clearAnnouncement(ctx, database, hub, KeyCertExpiring)
+		return
+	}
+
+	remaining := status.CertExpiry.Sub(now)
+	if remaining > config.CertExpiryWarning {
+		clearAnnouncement(ctx, database, hub, KeyCertExpiring)
+		return
+	}
+
+	expiry := status.CertExpiry.UTC().Format("Jan 2, 2006 15:04 MST")
+	message := fmt.Sprintf("The TLS certificate expires on %s. Secure phone connections will fail unless it is renewed.", expiry)
+	if remaining <= 0 {
+		message = fmt.Sprintf("The TLS certificate expired on %s. Secure phone connections are failing until it is renewed.", expiry)
+	}
+	raiseAnnouncement(ctx, database, hub, KeyCertExpiring, db.AnnouncementLevelWarning, "TLS certificate expiring", message)
+}
+
+// RecordBackup raises an announcement when a backup fails and clears it
+// after the next successful backup
+func RecordBackup(ctx context.Context, database *db.DB, hub *events.Hub, backupErr error) {
+	if backupErr == nil {
+		clearAnnouncement(ctx, database, hub, KeyBackupFailed)
+		return
+	}
+	message := fmt.Sprintf("The last database backup failed at %s. Check the server logs and free disk space, then run a backup again.",
+		time.Now().UTC().Format("Jan 2, 2006 15:04 MST"))
+	raiseAnnouncement(ctx, database, hub, KeyBackupFailed, db.AnnouncementLevelWarning, "Backup failed", message)
+}
+
+// RecordTrunkFailover raises an announcement while the disaster recovery
+// settings of any Twilio trunk no longer match what was configured
+func RecordTrunkFailover(ctx context.Context, database *db.DB, hub *events.Hub, brokenTrunks []string) {
+	if len(brokenTrunks) == 0 {
+		clearAnnouncement(ctx, database, hub, KeyTrunkFailover)
+		return
+	}
+	trunks := "trunk " + brokenTrunks[0]
+	if len(brokenTrunks) > 1 {
+		trunks = "trunks " + strings.Join(brokenTrunks, ", ")
+	}
+	message := fmt.Sprintf("The disaster recovery settings of Twilio %s changed. Calls may not be forwarded while GoSIP is down until they are configured again.", trunks)
+	raiseAnnouncement(ctx, database, hub, KeyTrunkFailover, db.AnnouncementLevelWarning, "Trunk failover broken", message)
+}
+
+// RecordDIDWebhooks raises an announcement while the webhooks of any
+// Twilio number no longer point at this server
+func RecordDIDWebhooks(ctx context.Context, database *db.DB, hub *events.Hub, driftedNumbers []string) {
+	if len(driftedNumbers) == 0 {
+		clearAnnouncement(ctx, database, hub, KeyDIDWebhooks)
+		return
+	}
+	numbers := "number " + driftedNumbers[0]
+	if len(driftedNumbers) > 1 {
+		numbers = "numbers " + strings.Join(driftedNumbers, ", ")
+	}
+	message := fmt.Sprintf("The webhooks of Twilio %s no longer point at this server. Calls and messages may not arrive until they are configured again.", numbers)
+	raiseAnnouncement(ctx, database, hub, KeyDIDWebhooks, db.AnnouncementLevelWarning, "Number webhooks changed", message)
+}
+
+// RecordPublicURL raises an announcement while the public base URL fails a
+// check or something still uses another URL
+func RecordPublicURL(ctx context.Context, database *db.DB, hub *events.Hub, publicURL string, problems []string) {
+	if len(problems) == 0 {
+		clearAnnouncement(ctx, database, hub, KeyPublicURL)
+		return
+	}
+	message := fmt.Sprintf("The public URL %s has problems: %s. Links, QR codes and Twilio webhooks use it.", publicURL, strings.Join(problems, "; "))
+	raiseAnnouncement(ctx, database, hub, KeyPublicURL, db.AnnouncementLevelWarning, "Public URL problems", message)
+}
+
+// RecordLowDisk raises an announcement while free disk space is too low
+// for new recordings, and clears it once problem is empty
+func RecordLowDisk(ctx context.Context, database *db.DB, hub *events.Hub, problem string) {
+	if problem == "" {
+		clearAnnouncement(ctx, database, hub, KeyLowDisk)
+		return
+	}
+	message := fmt.Sprintf("%s. New voicemails and recordings are refused until space is freed; System > Storage suggests what to clean up.", problem)
+	raiseAnnouncement(ctx, database, hub, KeyLowDisk, db.AnnouncementLevelWarning, "Low disk space", message)
+}
+
+// RecordMediaDamaged raises an announcement while recording or voicemail
+// files are missing from disk or no longer match their checksum
+func RecordMediaDamaged(ctx context.Context, database *db.DB, hub *events.Hub, damaged int) {
+	if damaged == 0 {
+		clearAnnouncement(ctx, database, hub, KeyMediaDamaged)
+		return
+	}
+	files := fmt.Sprintf("%d recording or voicemail files are", damaged)
+	if damaged == 1 {
+		files = "A recording or voicemail file is"
+	}
+	message := fmt.Sprintf("%s missing or corrupted. Restore them from a backup of the data directory; System > Media Integrity lists them.", files)
+	raiseAnnouncement(ctx, database, hub, KeyMediaDamaged, db.AnnouncementLevelWarning, "Recordings damaged", message)
+}
+
+// raiseAnnouncement shows or updates a system announcement, publishing an event when it changes
+func raiseAnnouncement(ctx context.Context, database *db.DB, hub *events.Hub, key, level, title, message string) {
+	if existing, err := database.Announcements.GetByKey(ctx, key); err == nil &&
+		existing.Level == level && existing.Title == title && existing.Message == message {
+		return
+	}
+	if err := database.Announcements.Raise(ctx, key, level, title, message); err != nil {
+		slog.Error("Failed to raise system announcement", "error", err, "key", key)
+		return
+	}
+	slog.Warn("System announcement raised", "key", key, "message", message)
+	hub.Publish(events.TypeAnnouncements, map[string]string{"key": key})
+}
+
+// clearAnnouncement removes a system announcement, publishing an event if one was shown
+func clearAnnouncement(ctx context.Context, database *db.DB, hub *events.Hub, key string) {
+	cleared, err := database.Announcements.Clear(ctx, key)
+	if err != nil {
+		slog.Error("Failed to clear system announcement", "error", err, "key", key)
+		return
+	}
+	if cleared {
+		slog.Info("System announcement cleared", "key", key)
+		hub.Publish(events.TypeAnnouncements, map[string]string{"key": key})
+	}
+}
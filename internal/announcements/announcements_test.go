@@ -0,0 +1,83 @@
+package announcements
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/pkg/sip"
+)
+
+// setupTestDB creates an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	database, err := db.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Close()
+	})
+	return database
+}
+
+func TestCheckCertificate(t *testing.T) {
+	database := setupTestDB(t)
+	hub := events.NewHub(10)
+	ctx := context.Background()
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	// Plenty of time left
+	CheckCertificate(ctx, database, hub, &sip.CertStatus{Enabled: true, CertExpiry: now.Add(60 * 24 * time.Hour)}, now)
+	if _, err := database.Announcements.GetByKey(ctx, KeyCertExpiring); err != db.ErrAnnouncementNotFound {
+		t.Fatalf("Expected no announcement, got %v", err)
+	}
+
+	CheckCertificate(ctx, database, hub, &sip.CertStatus{Enabled: true, CertExpiry: now.Add(3 * 24 * time.Hour)}, now)
+	a, err := database.Announcements.GetByKey(ctx, KeyCertExpiring)
+	if err != nil {
+		t.Fatalf("Expected expiring certificate announcement: %v", err)
+	}
+	if a.Level != db.AnnouncementLevelWarning {
+		t.Errorf("Expected warning, got %s", a.Level)
+	}
+
+	// Checking again without change doesn't publish another event
+	CheckCertificate(ctx, database, hub, &sip.CertStatus{Enabled: true, CertExpiry: now.Add(3 * 24 * time.Hour)}, now)
+	if id := hub.LastID(); id != 1 {
+		t.Errorf("Expected 1 event, got %d", id)
+	}
+
+	// Renewed
+	CheckCertificate(ctx, database, hub, &sip.CertStatus{Enabled: true, CertExpiry: now.Add(90 * 24 * time.Hour)}, now)
+	if _, err := database.Announcements.GetByKey(ctx, KeyCertExpiring); err != db.ErrAnnouncementNotFound {
+		t.Errorf("Expected announcement to clear after renewal, got %v", err)
+	}
+}
+
+func TestRecordBackup(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+
+	RecordBackup(ctx, database, nil, errors.New("disk full"))
+	active, err := database.Announcements.ListActive(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to list announcements: %v", err)
+	}
+	if len(active) != 1 || active[0].Title != "Backup failed" {
+		t.Fatalf("Expected backup failure announcement, got %+v", active)
+	}
+
+	RecordBackup(ctx, database, nil, nil)
+	active, _ = database.Announcements.ListActive(ctx, time.Now())
+	if len(active) != 0 {
+		t.Errorf("Expected announcement to clear after a successful backup, got %d", len(active))
+	}
+}
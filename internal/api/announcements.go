@@ -0,0 +1,210 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// AnnouncementHandler serves the banners shown to web UI users
+type AnnouncementHandler struct {
+	deps *Dependencies
+}
+
+// NewAnnouncementHandler creates a new AnnouncementHandler
+func NewAnnouncementHandler(deps *Dependencies) *AnnouncementHandler {
+	return &AnnouncementHandler{deps: deps}
+}
+
+// AnnouncementRequest represents an announcement create or update request
+type AnnouncementRequest struct {
+	Level    string     `json:"level"`
+	Title    string     `json:"title"`
+	Message  string     `json:"message"`
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
+
+// ActiveAnnouncement is the trimmed announcement returned to every UI client
+type ActiveAnnouncement struct {
+	ID      int64      `json:"id"`
+	Level   string     `json:"level"`
+	Title   string     `json:"title,omitempty"`
+	Message string     `json:"message"`
+	EndsAt  *time.Time `json:"ends_at,omitempty"`
+}
+
+// ListActive returns the banners to show right now. UI clients poll it, or
+// reload it on announcements.changed events.
+func (h *AnnouncementHandler) ListActive(w http.ResponseWriter, r *http.Request) {
+	announcements, err := h.deps.DB.Announcements.ListActive(r.Context(), time.Now())
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	active := make([]ActiveAnnouncement, 0, len(announcements))
+	for _, a := range announcements {
+		active = append(active, ActiveAnnouncement{
+			ID:      a.ID,
+			Level:   a.Level,
+			Title:   a.Title,
+			Message: a.Message,
+			EndsAt:  a.EndsAt,
+		})
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	WriteJSON(w, http.StatusOK, active)
+}
+
+// List returns all announcements, including scheduled, expired and system ones
+func (h *AnnouncementHandler) List(w http.ResponseWriter, r *http.Request) {
+	announcements, err := h.deps.DB.Announcements.List(r.Context())
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if announcements == nil {
+		announcements = []*models.Announcement{}
+	}
+
+	WriteJSON(w, http.StatusOK, announcements)
+}
+
+// Create posts a banner, optionally limited to a maintenance window
+func (h *AnnouncementHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req AnnouncementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	if req.Level == "" {
+		req.Level = db.AnnouncementLevelInfo
+	}
+
+	if errs := validateAnnouncement(req); len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	a := &models.Announcement{
+		Level:    req.Level,
+		Title:    strings.TrimSpace(req.Title),
+		Message:  strings.TrimSpace(req.Message),
+		StartsAt: req.StartsAt,
+		EndsAt:   req.EndsAt,
+	}
+	if userID := getUserIDFromContext(r.Context()); userID > 0 {
+		a.CreatedBy = &userID
+	}
+
+	if err := h.deps.DB.Announcements.Create(r.Context(), a); err != nil {
+		WriteInternalError(w)
+		return
+	}
+	h.deps.Events.Publish(events.TypeAnnouncements, map[string]int64{"id": a.ID})
+
+	WriteJSON(w, http.StatusCreated, a)
+}
+
+// Update changes an admin announcement. The request replaces the banner, so
+// omitting starts_at or ends_at removes that limit.
+func (h *AnnouncementHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid announcement ID", nil)
+		return
+	}
+
+	a, err := h.deps.DB.Announcements.GetByID(r.Context(), id)
+	if errors.Is(err, db.ErrAnnouncementNotFound) {
+		WriteNotFoundError(w, "Announcement")
+		return
+	}
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if a.Source != db.AnnouncementSourceAdmin {
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "System announcements are managed automatically and can only be dismissed", nil)
+		return
+	}
+
+	var req AnnouncementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	if req.Level == "" {
+		req.Level = a.Level
+	}
+
+	if errs := validateAnnouncement(req); len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	a.Level = req.Level
+	a.Title = strings.TrimSpace(req.Title)
+	a.Message = strings.TrimSpace(req.Message)
+	a.StartsAt = req.StartsAt
+	a.EndsAt = req.EndsAt
+
+	if err := h.deps.DB.Announcements.Update(r.Context(), a); err != nil {
+		WriteInternalError(w)
+		return
+	}
+	h.deps.Events.Publish(events.TypeAnnouncements, map[string]int64{"id": a.ID})
+
+	WriteJSON(w, http.StatusOK, a)
+}
+
+// Delete removes an announcement. A dismissed system announcement returns
+// if its check still fails.
+func (h *AnnouncementHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid announcement ID", nil)
+		return
+	}
+
+	if err := h.deps.DB.Announcements.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, db.ErrAnnouncementNotFound) {
+			WriteNotFoundError(w, "Announcement")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+	h.deps.Events.Publish(events.TypeAnnouncements, map[string]int64{"id": id})
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Announcement deleted successfully"})
+}
+
+// validateAnnouncement checks an announcement's level, message and window
+func validateAnnouncement(req AnnouncementRequest) []FieldError {
+	var errs []FieldError
+	if req.Level != db.AnnouncementLevelInfo && req.Level != db.AnnouncementLevelWarning {
+		errs = append(errs, FieldError{Field: "level", Message: "Level must be info or warning"})
+	}
+	message := strings.TrimSpace(req.Message)
+	if message == "" {
+		errs = append(errs, FieldError{Field: "message", Message: "Message is required"})
+	} else if len(message) > config.AnnouncementMessageMaxSize {
+		errs = append(errs, FieldError{Field: "message", Message: "Message is too long"})
+	}
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		errs = append(errs, FieldError{Field: "ends_at", Message: "End must be after start"})
+	}
+	return errs
+}
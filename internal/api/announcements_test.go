@@ -0,0 +1,94 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAnnouncementHandler_CreateAndListActive(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB}
+	handler := NewAnnouncementHandler(deps)
+
+	ends := time.Now().Add(2 * time.Hour).UTC()
+	body, _ := json.Marshal(map[string]interface{}{
+		"level":   "warning",
+		"title":   "Maintenance",
+		"message": "Phones will be offline tonight from 11pm to midnight.",
+		"ends_at": ends,
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/system/announcements", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler.Create(rr, req)
+
+	assertStatus(t, rr, http.StatusCreated)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/announcements", nil)
+	rr = httptest.NewRecorder()
+	handler.ListActive(rr, req)
+
+	assertStatus(t, rr, http.StatusOK)
+
+	var active []ActiveAnnouncement
+	decodeResponse(t, rr, &active)
+	if len(active) != 1 || active[0].Level != "warning" || active[0].Title != "Maintenance" {
+		t.Errorf("Unexpected active announcements %+v", active)
+	}
+}
+
+func TestAnnouncementHandler_Create_Validation(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB}
+	handler := NewAnnouncementHandler(deps)
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"level":     "critical",
+		"message":   "",
+		"starts_at": time.Now().Add(time.Hour),
+		"ends_at":   time.Now(),
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/system/announcements", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler.Create(rr, req)
+
+	assertStatus(t, rr, http.StatusBadRequest)
+
+	var resp ErrorResponse
+	decodeResponse(t, rr, &resp)
+	if len(resp.Error.Details) != 3 {
+		t.Errorf("Expected 3 field errors, got %+v", resp.Error.Details)
+	}
+}
+
+func TestAnnouncementHandler_Update_SystemAnnouncement(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB}
+	handler := NewAnnouncementHandler(deps)
+
+	if err := setup.DB.Announcements.Raise(context.Background(), "backup_failed", "warning", "Backup failed", "The last backup failed."); err != nil {
+		t.Fatalf("Failed to raise announcement: %v", err)
+	}
+	a, _ := setup.DB.Announcements.GetByKey(context.Background(), "backup_failed")
+
+	body, _ := json.Marshal(map[string]interface{}{"message": "Never mind"})
+	req := httptest.NewRequest(http.MethodPut, "/api/system/announcements/1", bytes.NewBuffer(body))
+	req = withURLParams(req, map[string]string{"id": fmt.Sprint(a.ID)})
+	rr := httptest.NewRecorder()
+	handler.Update(rr, req)
+
+	assertStatus(t, rr, http.StatusConflict)
+
+	// Dismissing is allowed
+	req = httptest.NewRequest(http.MethodDelete, "/api/system/announcements/1", nil)
+	req = withURLParams(req, map[string]string{"id": fmt.Sprint(a.ID)})
+	rr = httptest.NewRecorder()
+	handler.Delete(rr, req)
+
+	assertStatus(t, rr, http.StatusOK)
+}
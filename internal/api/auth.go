@@ -1,31 +1,35 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"log/slog"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/btafoya/gosip/internal/config"
 	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/i18n"
 	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/notifications"
 	"github.com/go-chi/chi/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // AuthHandler handles authentication-related API endpoints
 type AuthHandler struct {
-	deps           *Dependencies
-	loginAttempts  map[string][]time.Time
-	attemptsMu     sync.RWMutex
+	deps       *Dependencies
+	attemptsMu sync.Mutex
 }
 
 // NewAuthHandler creates a new AuthHandler
 func NewAuthHandler(deps *Dependencies) *AuthHandler {
 	return &AuthHandler{
-		deps:          deps,
-		loginAttempts: make(map[string][]time.Time),
+		deps: deps,
 	}
 }
 
@@ -43,11 +47,14 @@ type LoginResponse struct {
 
 // UserResponse represents a user in API responses (without password hash)
 type UserResponse struct {
-	ID        int64      `json:"id"`
-	Email     string     `json:"email"`
-	Role      string     `json:"role"`
-	CreatedAt time.Time  `json:"created_at"`
-	LastLogin *time.Time `json:"last_login,omitempty"`
+	ID           int64      `json:"id"`
+	Email        string     `json:"email"`
+	Role         string     `json:"role"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastLogin    *time.Time `json:"last_login,omitempty"`
+	Language     string     `json:"language,omitempty"`
+	HideCallerID bool       `json:"hide_caller_id"`
+	TenantID     *int64     `json:"tenant_id,omitempty"`
 }
 
 // Login handles user login
@@ -67,11 +74,13 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check rate limiting
-	clientIP := r.RemoteAddr
-	if allowed, lockoutRemaining := h.checkLoginAttempt(clientIP); !allowed {
+	// Check rate limiting, per client IP and per account
+	clientIP := clientHost(r.RemoteAddr)
+	account := strings.ToLower(strings.TrimSpace(req.Email))
+	if allowed, lockoutRemaining := h.checkLoginAttempt(r.Context(), clientIP, account); !allowed {
+		h.recordLoginAttempt(r, account, false, db.LoginReasonLockedOut)
 		WriteError(w, http.StatusTooManyRequests, ErrCodeRateLimited,
-			"Too many login attempts. Try again in "+lockoutRemaining.String(), nil)
+			"Too many login attempts. Try again in "+lockoutRemaining.Round(time.Second).String(), nil)
 		return
 	}
 
@@ -79,7 +88,8 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	user, err := h.deps.DB.Users.GetByEmail(r.Context(), req.Email)
 	if err != nil {
 		if err == db.ErrUserNotFound {
-			h.recordFailedAttempt(clientIP)
+			h.recordFailedAttempt(r.Context(), clientIP, account)
+			h.recordLoginAttempt(r, account, false, db.LoginReasonInvalidCredentials)
 			WriteError(w, http.StatusUnauthorized, ErrCodeAuthentication, "Invalid email or password", nil)
 			return
 		}
@@ -89,13 +99,15 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		h.recordFailedAttempt(clientIP)
+		h.recordFailedAttempt(r.Context(), clientIP, account)
+		h.recordLoginAttempt(r, account, false, db.LoginReasonInvalidCredentials)
 		WriteError(w, http.StatusUnauthorized, ErrCodeAuthentication, "Invalid email or password", nil)
 		return
 	}
 
 	// Clear failed attempts on successful login
-	h.clearFailedAttempts(clientIP)
+	h.clearFailedAttempts(r.Context(), clientIP, account)
+	h.recordLoginAttempt(r, account, true, "")
 
 	// Update last login
 	h.deps.DB.Users.UpdateLastLogin(r.Context(), user.ID)
@@ -181,11 +193,9 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate new password
-	if len(req.NewPassword) < 8 {
-		WriteValidationError(w, "Password must be at least 8 characters", []FieldError{
-			{Field: "new_password", Message: "Password must be at least 8 characters"},
-		})
+	// Validate new password against the password policy
+	if errors := checkPassword(r.Context(), h.deps, "new_password", req.NewPassword); len(errors) > 0 {
+		WriteValidationError(w, "Validation failed", errors)
 		return
 	}
 
@@ -206,6 +216,189 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, http.StatusOK, map[string]string{"message": "Password updated successfully"})
 }
 
+// SetLanguageRequest represents a language preference change
+type SetLanguageRequest struct {
+	Language string `json:"language"`
+}
+
+// languageFieldError is returned for unsupported language codes
+var languageFieldError = FieldError{Field: "language", Message: "Language must be one of: en, es, fr, de"}
+
+// SetLanguage changes the API message language of the current user
+func (h *AuthHandler) SetLanguage(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		WriteUnauthorizedError(w)
+		return
+	}
+
+	var req SetLanguageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	// An empty language clears the preference
+	if req.Language != "" && !i18n.IsSupported(req.Language) {
+		WriteValidationError(w, "Validation failed", []FieldError{languageFieldError})
+		return
+	}
+
+	user.Language = req.Language
+	if err := h.deps.DB.Users.Update(r.Context(), user); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, toUserResponse(user))
+}
+
+// SetCallerIDRequest represents a change to the current user's caller ID
+type SetCallerIDRequest struct {
+	HideCallerID *bool `json:"hide_caller_id"`
+}
+
+// SetCallerID withholds or shows the caller ID of the current user's
+// outbound calls. Devices an admin has stopped from making anonymous calls
+// keep showing it.
+func (h *AuthHandler) SetCallerID(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		WriteUnauthorizedError(w)
+		return
+	}
+
+	var req SetCallerIDRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	if req.HideCallerID == nil {
+		WriteValidationError(w, "Validation failed", []FieldError{{Field: "hide_caller_id", Message: "hide_caller_id is required"}})
+		return
+	}
+
+	user.HideCallerID = *req.HideCallerID
+	if err := h.deps.DB.Users.Update(r.Context(), user); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, toUserResponse(user))
+}
+
+// NotificationSettingsResponse represents the current user's notification settings
+type NotificationSettingsResponse struct {
+	*models.NotificationSettings
+	PushConfigured bool `json:"push_configured"`
+}
+
+// UpdateNotificationSettingsRequest represents a change to notification
+// settings; omitted fields keep their current value
+type UpdateNotificationSettingsRequest struct {
+	EmailEnabled      *bool   `json:"email_enabled"`
+	PushToken         *string `json:"push_token"` // Empty disables personal push
+	QuietHoursEnabled *bool   `json:"quiet_hours_enabled"`
+	QuietStart        *string `json:"quiet_start"`
+	QuietEnd          *string `json:"quiet_end"`
+	Timezone          *string `json:"timezone"`
+	VIPBreakthrough   *bool   `json:"vip_breakthrough"`
+}
+
+// GetNotificationSettings returns the current user's notification settings
+func (h *AuthHandler) GetNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		WriteUnauthorizedError(w)
+		return
+	}
+
+	settings, err := h.deps.DB.NotificationSettings.Get(r.Context(), user.ID)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, toNotificationSettingsResponse(settings))
+}
+
+// UpdateNotificationSettings changes the current user's personal notification
+// channels and quiet hours
+func (h *AuthHandler) UpdateNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		WriteUnauthorizedError(w)
+		return
+	}
+
+	var req UpdateNotificationSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	var errors []FieldError
+	if req.QuietStart != nil {
+		if _, err := notifications.ParseClock(*req.QuietStart); err != nil {
+			errors = append(errors, FieldError{Field: "quiet_start", Message: "Time must be HH:MM in 24-hour format"})
+		}
+	}
+	if req.QuietEnd != nil {
+		if _, err := notifications.ParseClock(*req.QuietEnd); err != nil {
+			errors = append(errors, FieldError{Field: "quiet_end", Message: "Time must be HH:MM in 24-hour format"})
+		}
+	}
+	if req.Timezone != nil && !validTimezone(*req.Timezone) {
+		errors = append(errors, timezoneFieldError("timezone"))
+	}
+	if len(errors) > 0 {
+		WriteValidationError(w, "Validation failed", errors)
+		return
+	}
+
+	settings, err := h.deps.DB.NotificationSettings.Get(r.Context(), user.ID)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	if req.EmailEnabled != nil {
+		settings.EmailEnabled = *req.EmailEnabled
+	}
+	if req.PushToken != nil {
+		settings.PushToken = *req.PushToken
+	}
+	if req.QuietHoursEnabled != nil {
+		settings.QuietHoursEnabled = *req.QuietHoursEnabled
+	}
+	if req.QuietStart != nil {
+		settings.QuietStart = *req.QuietStart
+	}
+	if req.QuietEnd != nil {
+		settings.QuietEnd = *req.QuietEnd
+	}
+	if req.Timezone != nil {
+		settings.Timezone = *req.Timezone
+	}
+	if req.VIPBreakthrough != nil {
+		settings.VIPBreakthrough = *req.VIPBreakthrough
+	}
+
+	if err := h.deps.DB.NotificationSettings.Save(r.Context(), settings); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, toNotificationSettingsResponse(settings))
+}
+
+func toNotificationSettingsResponse(settings *models.NotificationSettings) *NotificationSettingsResponse {
+	return &NotificationSettingsResponse{
+		NotificationSettings: settings,
+		PushConfigured:       settings.PushToken != "",
+	}
+}
+
 // Admin user management endpoints
 
 // ListUsers returns all users (admin only)
@@ -220,14 +413,21 @@ func (h *AuthHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 		limit = config.MaxPageSize
 	}
 
-	users, err := h.deps.DB.Users.List(r.Context(), limit, offset)
+	var users []*models.User
+	var total int
+	var err error
+	if tenantID := tenantOf(r); tenantID != nil {
+		users, err = h.deps.DB.Users.ListByTenant(r.Context(), *tenantID, limit, offset)
+		total, _ = h.deps.DB.Users.CountByTenant(r.Context(), *tenantID)
+	} else {
+		users, err = h.deps.DB.Users.List(r.Context(), limit, offset)
+		total, _ = h.deps.DB.Users.Count(r.Context())
+	}
 	if err != nil {
 		WriteInternalError(w)
 		return
 	}
 
-	total, _ := h.deps.DB.Users.Count(r.Context())
-
 	// Convert to response format
 	var response []*UserResponse
 	for _, u := range users {
@@ -242,6 +442,8 @@ type CreateUserRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 	Role     string `json:"role"`
+	Language string `json:"language,omitempty"`
+	TenantID *int64 `json:"tenant_id,omitempty"` // Defaults to the admin's own; only instance admins set it
 }
 
 // CreateUser creates a new user (admin only)
@@ -257,12 +459,13 @@ func (h *AuthHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	if req.Email == "" {
 		errors = append(errors, FieldError{Field: "email", Message: "Email is required"})
 	}
-	if len(req.Password) < 8 {
-		errors = append(errors, FieldError{Field: "password", Message: "Password must be at least 8 characters"})
-	}
+	errors = append(errors, checkPassword(r.Context(), h.deps, "password", req.Password)...)
 	if req.Role != "admin" && req.Role != "user" {
 		req.Role = "user"
 	}
+	if req.Language != "" && !i18n.IsSupported(req.Language) {
+		errors = append(errors, languageFieldError)
+	}
 
 	if len(errors) > 0 {
 		WriteValidationError(w, "Validation failed", errors)
@@ -280,8 +483,16 @@ func (h *AuthHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		Email:        req.Email,
 		PasswordHash: string(hash),
 		Role:         req.Role,
+		Language:     req.Language,
+		TenantID:     tenantOf(r),
 		CreatedAt:    time.Now(),
 	}
+	if req.TenantID != nil {
+		var ok bool
+		if user.TenantID, ok = tenantField(w, r, h.deps, *req.TenantID); !ok {
+			return
+		}
+	}
 
 	if err := h.deps.DB.Users.Create(r.Context(), user); err != nil {
 		WriteError(w, http.StatusConflict, ErrCodeConflict, "User with this email already exists", nil)
@@ -308,6 +519,10 @@ func (h *AuthHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 		WriteInternalError(w)
 		return
 	}
+	if !visibleTo(r, user.TenantID) {
+		WriteNotFoundError(w, "User")
+		return
+	}
 
 	WriteJSON(w, http.StatusOK, toUserResponse(user))
 }
@@ -317,6 +532,8 @@ type UpdateUserRequest struct {
 	Email    string `json:"email,omitempty"`
 	Password string `json:"password,omitempty"`
 	Role     string `json:"role,omitempty"`
+	Language string `json:"language,omitempty"`
+	TenantID *int64 `json:"tenant_id,omitempty"` // Only instance admins move a user; 0 moves them to the instance
 }
 
 // UpdateUser updates a user (admin only)
@@ -336,17 +553,32 @@ func (h *AuthHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		WriteInternalError(w)
 		return
 	}
+	if !visibleTo(r, user.TenantID) {
+		WriteNotFoundError(w, "User")
+		return
+	}
 
 	var req UpdateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		WriteValidationError(w, "Invalid request body", nil)
 		return
 	}
+	tenantID := user.TenantID
+	if req.TenantID != nil {
+		var ok bool
+		if tenantID, ok = tenantField(w, r, h.deps, *req.TenantID); !ok {
+			return
+		}
+	}
 
 	if req.Email != "" {
 		user.Email = req.Email
 	}
 	if req.Password != "" {
+		if errors := checkPassword(r.Context(), h.deps, "password", req.Password); len(errors) > 0 {
+			WriteValidationError(w, "Validation failed", errors)
+			return
+		}
 		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
 			WriteInternalError(w)
@@ -357,11 +589,25 @@ func (h *AuthHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	if req.Role == "admin" || req.Role == "user" {
 		user.Role = req.Role
 	}
+	if req.Language != "" {
+		if !i18n.IsSupported(req.Language) {
+			WriteValidationError(w, "Validation failed", []FieldError{languageFieldError})
+			return
+		}
+		user.Language = req.Language
+	}
 
 	if err := h.deps.DB.Users.Update(r.Context(), user); err != nil {
 		WriteInternalError(w)
 		return
 	}
+	if !sameTenant(tenantID, user.TenantID) {
+		if err := h.deps.DB.Users.SetTenant(r.Context(), user.ID, tenantID); err != nil {
+			WriteInternalError(w)
+			return
+		}
+		user.TenantID = tenantID
+	}
 
 	WriteJSON(w, http.StatusOK, toUserResponse(user))
 }
@@ -380,6 +626,12 @@ func (h *AuthHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Cannot delete your own account", nil)
 		return
 	}
+	if currentUser.TenantID != nil {
+		if user, err := h.deps.DB.Users.GetByID(r.Context(), id); err != nil || !visibleTo(r, user.TenantID) {
+			WriteNotFoundError(w, "User")
+			return
+		}
+	}
 
 	if err := h.deps.DB.Users.Delete(r.Context(), id); err != nil {
 		WriteInternalError(w)
@@ -389,55 +641,208 @@ func (h *AuthHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, http.StatusOK, map[string]string{"message": "User deleted successfully"})
 }
 
+// ListLoginAttempts returns the sign-in history, newest first. Pass
+// failures_only=true to list only failed and locked-out attempts (admin only).
+func (h *AuthHandler) ListLoginAttempts(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	failuresOnly, _ := strconv.ParseBool(r.URL.Query().Get("failures_only"))
+
+	if limit == 0 {
+		limit = config.DefaultPageSize
+	}
+	if limit > config.MaxPageSize {
+		limit = config.MaxPageSize
+	}
+
+	attempts, err := h.deps.DB.LoginAttempts.List(r.Context(), failuresOnly, limit, offset)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if attempts == nil {
+		attempts = []*models.LoginAttempt{}
+	}
+
+	total, _ := h.deps.DB.LoginAttempts.Count(r.Context(), failuresOnly)
+
+	WriteList(w, attempts, total, limit, offset)
+}
+
+// ListLockouts returns the IP addresses and accounts currently locked out (admin only)
+func (h *AuthHandler) ListLockouts(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := h.deps.DB.LoginAttempts.ListLocked(r.Context(), time.Now())
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if lockouts == nil {
+		lockouts = []*models.LoginLockout{}
+	}
+
+	WriteJSON(w, http.StatusOK, lockouts)
+}
+
+// ClearLockout unlocks an IP address or account and resets its cooldown (admin only)
+func (h *AuthHandler) ClearLockout(w http.ResponseWriter, r *http.Request) {
+	scope := chi.URLParam(r, "scope")
+	key := chi.URLParam(r, "key")
+	if scope != db.LockoutScopeIP && scope != db.LockoutScopeAccount {
+		WriteValidationError(w, "Scope must be ip or account", nil)
+		return
+	}
+	if scope == db.LockoutScopeAccount {
+		key = strings.ToLower(key)
+	}
+
+	h.attemptsMu.Lock()
+	cleared, err := h.deps.DB.LoginAttempts.ClearLockout(r.Context(), scope, key)
+	h.attemptsMu.Unlock()
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if !cleared {
+		WriteNotFoundError(w, "Lockout")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Lockout cleared successfully"})
+}
+
 // Rate limiting helpers
 
-func (h *AuthHandler) checkLoginAttempt(ip string) (bool, time.Duration) {
+// checkLoginAttempt reports whether a client IP and account may try to sign
+// in, and if not, how long until the lockout ends
+func (h *AuthHandler) checkLoginAttempt(ctx context.Context, ip, account string) (bool, time.Duration) {
+	now := time.Now()
+	var remaining time.Duration
+	for _, k := range []struct{ scope, key string }{
+		{db.LockoutScopeIP, ip},
+		{db.LockoutScopeAccount, account},
+	} {
+		lockout, err := h.deps.DB.LoginAttempts.GetLockout(ctx, k.scope, k.key)
+		if err != nil {
+			slog.Error("Failed to check login lockout", "error", err, "scope", k.scope)
+			continue
+		}
+		if lockout != nil && lockout.LockedUntil != nil && lockout.LockedUntil.After(now) {
+			if d := lockout.LockedUntil.Sub(now); d > remaining {
+				remaining = d
+			}
+		}
+	}
+	return remaining == 0, remaining
+}
+
+// recordFailedAttempt counts a failed sign-in against the client IP and the
+// account. Reaching the limit locks it out, and each lockout within
+// LoginLockoutResetAfter of the last doubles the cooldown.
+func (h *AuthHandler) recordFailedAttempt(ctx context.Context, ip, account string) {
 	h.attemptsMu.Lock()
 	defer h.attemptsMu.Unlock()
 
 	now := time.Now()
-	cutoff := now.Add(-1 * time.Minute)
+	for _, k := range []struct {
+		scope, key string
+		limit      int
+	}{
+		{db.LockoutScopeIP, ip, config.MaxFailedLoginAttempts},
+		{db.LockoutScopeAccount, account, config.MaxFailedAccountAttempts},
+	} {
+		lockout, err := h.deps.DB.LoginAttempts.GetLockout(ctx, k.scope, k.key)
+		if err != nil {
+			slog.Error("Failed to load login lockout", "error", err, "scope", k.scope)
+			continue
+		}
+		if lockout == nil || now.Sub(lockout.LastFailureAt) > config.LoginLockoutResetAfter {
+			lockout = &models.LoginLockout{Scope: k.scope, Key: k.key}
+		} else if now.Sub(lockout.LastFailureAt) > config.LoginFailureWindow {
+			lockout.Failures = 0
+		}
 
-	// Clean old attempts
-	var recent []time.Time
-	for _, attempt := range h.loginAttempts[ip] {
-		if attempt.After(cutoff) {
-			recent = append(recent, attempt)
+		lockout.Failures++
+		lockout.LastFailureAt = now
+		if lockout.Failures >= k.limit {
+			lockout.Lockouts++
+			until := now.Add(lockoutDuration(lockout.Lockouts))
+			lockout.LockedUntil = &until
+			lockout.Failures = 0
+			slog.Warn("Sign-in locked out", "scope", k.scope, "key", k.key, "until", until)
 		}
-	}
-	h.loginAttempts[ip] = recent
 
-	// Check if locked out
-	if len(recent) >= config.MaxFailedLoginAttempts {
-		lockoutEnd := recent[0].Add(config.LoginLockoutDuration)
-		if now.Before(lockoutEnd) {
-			return false, lockoutEnd.Sub(now)
+		if err := h.deps.DB.LoginAttempts.SaveLockout(ctx, lockout); err != nil {
+			slog.Error("Failed to save login lockout", "error", err, "scope", k.scope)
 		}
-		// Lockout expired, reset
-		h.loginAttempts[ip] = nil
 	}
-
-	return true, 0
 }
 
-func (h *AuthHandler) recordFailedAttempt(ip string) {
+// clearFailedAttempts resets the counters of a client IP and account after a
+// successful sign-in
+func (h *AuthHandler) clearFailedAttempts(ctx context.Context, ip, account string) {
 	h.attemptsMu.Lock()
 	defer h.attemptsMu.Unlock()
-	h.loginAttempts[ip] = append(h.loginAttempts[ip], time.Now())
+
+	if _, err := h.deps.DB.LoginAttempts.ClearLockout(ctx, db.LockoutScopeIP, ip); err != nil {
+		slog.Error("Failed to clear login lockout", "error", err, "scope", db.LockoutScopeIP)
+	}
+	if _, err := h.deps.DB.LoginAttempts.ClearLockout(ctx, db.LockoutScopeAccount, account); err != nil {
+		slog.Error("Failed to clear login lockout", "error", err, "scope", db.LockoutScopeAccount)
+	}
 }
 
-func (h *AuthHandler) clearFailedAttempts(ip string) {
-	h.attemptsMu.Lock()
-	defer h.attemptsMu.Unlock()
-	delete(h.loginAttempts, ip)
+// recordLoginAttempt adds a sign-in to the authentication history, pruning
+// entries older than LoginAttemptRetention
+func (h *AuthHandler) recordLoginAttempt(r *http.Request, account string, success bool, reason string) {
+	attempt := &models.LoginAttempt{
+		Email:     account,
+		IPAddress: clientHost(r.RemoteAddr),
+		UserAgent: r.UserAgent(),
+		Success:   success,
+		Reason:    reason,
+	}
+	if err := h.deps.DB.LoginAttempts.Record(r.Context(), attempt); err != nil {
+		slog.Error("Failed to record login attempt", "error", err)
+		return
+	}
+	if success {
+		if _, err := h.deps.DB.LoginAttempts.DeleteOlderThan(r.Context(), time.Now().Add(-config.LoginAttemptRetention)); err != nil {
+			slog.Error("Failed to prune login attempts", "error", err)
+		}
+	}
+}
+
+// lockoutDuration returns the cooldown for the nth consecutive lockout:
+// LoginLockoutDuration, doubled for each repeat, capped at LoginLockoutMaxDuration
+func lockoutDuration(n int) time.Duration {
+	d := config.LoginLockoutDuration
+	for i := 1; i < n && d < config.LoginLockoutMaxDuration; i++ {
+		d *= 2
+	}
+	if d > config.LoginLockoutMaxDuration {
+		d = config.LoginLockoutMaxDuration
+	}
+	return d
+}
+
+// clientHost strips the port from a remote address
+func clientHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
 }
 
 func toUserResponse(user *models.User) *UserResponse {
 	return &UserResponse{
-		ID:        user.ID,
-		Email:     user.Email,
-		Role:      user.Role,
-		CreatedAt: user.CreatedAt,
-		LastLogin: user.LastLogin,
+		ID:           user.ID,
+		Email:        user.Email,
+		Role:         user.Role,
+		CreatedAt:    user.CreatedAt,
+		LastLogin:    user.LastLogin,
+		Language:     user.Language,
+		HideCallerID: user.HideCallerID,
+		TenantID:     user.TenantID,
 	}
 }
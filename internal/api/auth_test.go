@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
 	"github.com/btafoya/gosip/internal/models"
 	"github.com/go-chi/chi/v5"
 	"golang.org/x/crypto/bcrypt"
@@ -323,7 +326,7 @@ func TestAuthHandler_CreateUser(t *testing.T) {
 
 	reqBody := CreateUserRequest{
 		Email:    "newuser@example.com",
-		Password: "password123",
+		Password: "violet-harbor-42",
 		Role:     "user",
 	}
 	body, _ := json.Marshal(reqBody)
@@ -594,3 +597,154 @@ func withURLParamsForAuth(r *http.Request, params map[string]string) *http.Reque
 	}
 	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, ctx))
 }
+
+func TestAuthHandler_UpdateNotificationSettings(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB}
+	handler := NewAuthHandler(deps)
+
+	user := createTestUser(t, setup.DB, "test@example.com", "password", "user")
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"email_enabled":       true,
+		"push_token":          "gotify-app-token",
+		"quiet_hours_enabled": true,
+		"quiet_start":         "23:00",
+		"timezone":            "America/Chicago",
+	})
+	req := httptest.NewRequest(http.MethodPut, "/api/me/notifications", bytes.NewBuffer(body))
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, user))
+	rr := httptest.NewRecorder()
+	handler.UpdateNotificationSettings(rr, req)
+
+	assertStatus(t, rr, http.StatusOK)
+
+	var resp map[string]interface{}
+	decodeResponse(t, rr, &resp)
+	if resp["push_configured"] != true || resp["quiet_start"] != "23:00" || resp["quiet_end"] != "07:00" {
+		t.Errorf("Unexpected response %v", resp)
+	}
+	if _, ok := resp["push_token"]; ok {
+		t.Error("Push token should not be returned")
+	}
+
+	settings, _ := setup.DB.NotificationSettings.Get(context.Background(), user.ID)
+	if !settings.EmailEnabled || !settings.QuietHoursEnabled || settings.Timezone != "America/Chicago" {
+		t.Errorf("Settings not saved, got %+v", settings)
+	}
+
+	body, _ = json.Marshal(map[string]interface{}{"quiet_end": "7am", "timezone": "Mars/Olympus"})
+	req = httptest.NewRequest(http.MethodPut, "/api/me/notifications", bytes.NewBuffer(body))
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, user))
+	rr = httptest.NewRecorder()
+	handler.UpdateNotificationSettings(rr, req)
+
+	assertStatus(t, rr, http.StatusBadRequest)
+}
+
+func TestAuthHandler_SetCallerID(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB}
+	handler := NewAuthHandler(deps)
+
+	user := createTestUser(t, setup.DB, "test@example.com", "password", "user")
+
+	set := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/me/caller-id", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, user))
+		rr := httptest.NewRecorder()
+		handler.SetCallerID(rr, req)
+		return rr
+	}
+
+	rr := set(`{"hide_caller_id": true}`)
+	assertStatus(t, rr, http.StatusOK)
+	var resp UserResponse
+	decodeResponse(t, rr, &resp)
+	if !resp.HideCallerID {
+		t.Error("Expected the caller ID hidden")
+	}
+	if saved, _ := setup.DB.Users.GetByID(context.Background(), user.ID); !saved.HideCallerID {
+		t.Error("Expected the setting saved")
+	}
+
+	assertStatus(t, set(`{}`), http.StatusBadRequest)
+}
+
+func TestLogin_AccountLockoutAcrossIPs(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB}
+	handler := NewAuthHandler(deps)
+
+	createTestUserWithBcrypt(t, setup, "test@example.com", "password123", "user")
+
+	login := func(ip, password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(LoginRequest{Email: "test@example.com", Password: password})
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", bytes.NewBuffer(body))
+		req.RemoteAddr = ip + ":40000"
+		rr := httptest.NewRecorder()
+		handler.Login(rr, req)
+		return rr
+	}
+
+	// Spread failures over IPs so no single IP reaches its limit
+	for i := 0; i < config.MaxFailedAccountAttempts; i++ {
+		rr := login(fmt.Sprintf("10.0.%d.1", i), "wrongpassword")
+		assertStatus(t, rr, http.StatusUnauthorized)
+	}
+
+	// The account is now locked, even with the right password from a new IP
+	rr := login("10.1.0.1", "password123")
+	assertStatus(t, rr, http.StatusTooManyRequests)
+
+	lockout, err := setup.DB.LoginAttempts.GetLockout(context.Background(), db.LockoutScopeAccount, "test@example.com")
+	if err != nil || lockout == nil || lockout.Lockouts != 1 || lockout.LockedUntil == nil {
+		t.Fatalf("Expected persisted account lockout, got %+v (%v)", lockout, err)
+	}
+
+	// The lockout survives a new handler, as after a restart
+	handler = NewAuthHandler(deps)
+	rr = login("10.1.0.1", "password123")
+	assertStatus(t, rr, http.StatusTooManyRequests)
+
+	// An admin unlocks the account
+	req := withURLParamsForAuth(httptest.NewRequest(http.MethodDelete, "/api/system/auth/lockouts/account/test@example.com", nil),
+		map[string]string{"scope": "account", "key": "test@example.com"})
+	rr = httptest.NewRecorder()
+	handler.ClearLockout(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+
+	rr = login("10.1.0.1", "password123")
+	assertStatus(t, rr, http.StatusOK)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/system/auth/attempts?failures_only=true", nil)
+	rr = httptest.NewRecorder()
+	handler.ListLoginAttempts(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+
+	var list struct {
+		Data []models.LoginAttempt `json:"data"`
+		Pagination struct {
+			Total int `json:"total"`
+		} `json:"pagination"`
+	}
+	decodeResponse(t, rr, &list)
+	if list.Pagination.Total != config.MaxFailedAccountAttempts+2 {
+		t.Errorf("Expected %d failures, got %d", config.MaxFailedAccountAttempts+2, list.Pagination.Total)
+	}
+	if len(list.Data) == 0 || list.Data[0].Reason != db.LoginReasonLockedOut || list.Data[0].Email != "test@example.com" {
+		t.Errorf("Expected newest failure to be a lockout, got %+v", list.Data)
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	if d := lockoutDuration(1); d != config.LoginLockoutDuration {
+		t.Errorf("Expected first lockout of %v, got %v", config.LoginLockoutDuration, d)
+	}
+	if d := lockoutDuration(3); d != 4*config.LoginLockoutDuration {
+		t.Errorf("Expected third lockout of %v, got %v", 4*config.LoginLockoutDuration, d)
+	}
+	if d := lockoutDuration(40); d != config.LoginLockoutMaxDuration {
+		t.Errorf("Expected lockout capped at %v, got %v", config.LoginLockoutMaxDuration, d)
+	}
+}
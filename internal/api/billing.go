@@ -0,0 +1,284 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/channels"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/rating"
+)
+
+// BillingHandler manages the rate table and reports estimated and actual
+// costs of outbound calls and messages
+type BillingHandler struct {
+	deps *Dependencies
+}
+
+// NewBillingHandler creates a new BillingHandler
+func NewBillingHandler(deps *Dependencies) *BillingHandler {
+	return &BillingHandler{deps: deps}
+}
+
+// ListRates returns the rate table
+func (h *BillingHandler) ListRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := h.deps.DB.Rates.List(r.Context())
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if rates == nil {
+		rates = []*models.Rate{}
+	}
+	WriteJSON(w, http.StatusOK, rates)
+}
+
+// ImportRates replaces the rate table with a CSV upload. The body is the
+// CSV itself, with kind, prefix, rate and optional description columns.
+func (h *BillingHandler) ImportRates(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, config.RateImportMaxBytes)
+	rates, err := rating.ParseCSV(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			WriteError(w, http.StatusRequestEntityTooLarge, "FILE_TOO_LARGE", "Rate table is too large", nil)
+		case errors.Is(err, rating.ErrInvalidCSV):
+			WriteValidationError(w, err.Error(), nil)
+		default:
+			WriteValidationError(w, "Invalid request body", nil)
+		}
+		return
+	}
+
+	if err := h.deps.DB.Rates.Replace(r.Context(), rates); err != nil {
+		slog.Error("Failed to import rate table", "error", err)
+		WriteInternalError(w)
+		return
+	}
+	slog.Info("Imported rate table", "rates", len(rates))
+
+	h.ListRates(w, r)
+}
+
+// DeleteRates empties the rate table. Costs already estimated are kept.
+func (h *BillingHandler) DeleteRates(w http.ResponseWriter, r *http.Request) {
+	if err := h.deps.DB.Rates.DeleteAll(r.Context()); err != nil {
+		WriteInternalError(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// billingPeriod reads the start_date and end_date query parameters,
+// defaulting to the last 30 days. The end date is inclusive.
+func billingPeriod(r *http.Request) (start, end time.Time, errs []FieldError) {
+	end = time.Now()
+	start = end.Add(-30 * 24 * time.Hour)
+
+	if s := r.URL.Query().Get("start_date"); s != "" {
+		if parsed, err := time.Parse("2006-01-02", s); err == nil {
+			start = parsed
+		} else {
+			errs = append(errs, FieldError{Field: "start_date", Message: "Date must be YYYY-MM-DD"})
+		}
+	}
+	if s := r.URL.Query().Get("end_date"); s != "" {
+		if parsed, err := time.Parse("2006-01-02", s); err == nil {
+			end = parsed.Add(24 * time.Hour)
+		} else {
+			errs = append(errs, FieldError{Field: "end_date", Message: "Date must be YYYY-MM-DD"})
+		}
+	}
+	return start, end, errs
+}
+
+// BillingStatsResponse totals the costs of outbound traffic over a period
+type BillingStatsResponse struct {
+	Start         string            `json:"start"`
+	End           string            `json:"end"`
+	Calls         models.CostTotals `json:"calls"`
+	Messages      models.CostTotals `json:"messages"`
+	EstimatedCost float64           `json:"estimated_cost"`
+	ActualCost    float64           `json:"actual_cost"`
+}
+
+// GetStats totals estimated and actual costs of outbound calls and
+// messages, for checking the rate table against Twilio's bill
+func (h *BillingHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	start, end, errs := billingPeriod(r)
+	if len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	calls, err := h.deps.DB.CDRs.CostTotals(r.Context(), start, end)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	messages, err := h.deps.DB.Messages.CostTotals(r.Context(), start, end)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, BillingStatsResponse{
+		Start:         start.Format("2006-01-02"),
+		End:           end.Add(-time.Nanosecond).Format("2006-01-02"),
+		Calls:         calls,
+		Messages:      messages,
+		EstimatedCost: roundCost(calls.EstimatedCost + messages.EstimatedCost),
+		ActualCost:    roundCost(calls.ActualCost + messages.ActualCost),
+	})
+}
+
+// BillingSyncResponse reports a reconciliation run
+type BillingSyncResponse struct {
+	Calls    int `json:"calls"`    // Calls whose price was recorded
+	Messages int `json:"messages"` // Messages whose price was recorded
+	Pending  int `json:"pending"`  // Not priced by Twilio yet
+	Failed   int `json:"failed"`
+	// More is set when items were left for another run
+	More bool `json:"more"`
+}
+
+// Sync fetches Twilio's prices for outbound calls and messages in the
+// period that don't have one yet, a limited number per run
+func (h *BillingHandler) Sync(w http.ResponseWriter, r *http.Request) {
+	start, end, errs := billingPeriod(r)
+	if len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+	if h.deps.Twilio == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Twilio client not available", nil)
+		return
+	}
+
+	ctx := r.Context()
+	limit := config.BillingSyncMaxItems
+	resp := BillingSyncResponse{}
+
+	cdrs, err := h.deps.DB.CDRs.ListUnreconciled(ctx, start, end, limit+1)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if len(cdrs) > limit {
+		cdrs, resp.More = cdrs[:limit], true
+	}
+	for _, cdr := range cdrs {
+		price, _, err := h.deps.Twilio.GetCallPrice(ctx, cdr.CallSID)
+		cost, ok := twilioPrice(price)
+		switch {
+		case err != nil:
+			slog.Warn("Failed to fetch call price", "error", err, "call_sid", cdr.CallSID)
+			resp.Failed++
+		case !ok:
+			resp.Pending++
+		case h.deps.DB.CDRs.SetActualCost(ctx, cdr.ID, cost) != nil:
+			resp.Failed++
+		default:
+			resp.Calls++
+		}
+	}
+
+	limit -= len(cdrs)
+	if limit == 0 {
+		WriteJSON(w, http.StatusOK, resp)
+		return
+	}
+	messages, err := h.deps.DB.Messages.ListUnreconciled(ctx, start, end, limit+1)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if len(messages) > limit {
+		messages, resp.More = messages[:limit], true
+	}
+	for _, message := range messages {
+		twilioMsg, err := h.deps.Twilio.GetMessage(ctx, message.MessageSID)
+		if err != nil {
+			slog.Warn("Failed to fetch message price", "error", err, "message_sid", message.MessageSID)
+			resp.Failed++
+			continue
+		}
+		cost, ok := twilioPrice(twilioMsg.Price)
+		switch {
+		case !ok:
+			resp.Pending++
+		case h.deps.DB.Messages.SetActualCost(ctx, message.ID, cost) != nil:
+			resp.Failed++
+		default:
+			resp.Messages++
+		}
+	}
+
+	slog.Info("Synced Twilio prices", "calls", resp.Calls, "messages", resp.Messages, "pending", resp.Pending, "failed", resp.Failed)
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// twilioPrice parses a Twilio price, which is negative for charges and
+// empty until Twilio has finalized it
+func twilioPrice(price string) (float64, bool) {
+	if price == "" {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(price), 64)
+	if err != nil {
+		return 0, false
+	}
+	return roundCost(math.Abs(value)), true
+}
+
+func roundCost(cost float64) float64 {
+	return math.Round(cost*1e5) / 1e5
+}
+
+// estimateCallCost prices an outbound call from the rate table once it
+// has ended. Calls between extensions aren't charged.
+func estimateCallCost(ctx context.Context, deps *Dependencies, cdr *models.CDR) {
+	if cdr.Direction != "outbound" || cdr.Internal || cdr.EndedAt == nil {
+		return
+	}
+	table, err := rating.LoadFor(ctx, deps.DB, db.RateKindCall, cdr.ToNumber)
+	if err != nil {
+		slog.Warn("Failed to load call rates", "error", err, "call_sid", cdr.CallSID)
+		return
+	}
+	if cdr.EstimatedCost = table.CallCost(cdr.ToNumber, cdr.Duration); cdr.EstimatedCost == nil {
+		return
+	}
+	if err := deps.DB.CDRs.SetEstimatedCost(ctx, cdr.ID, cdr.EstimatedCost); err != nil {
+		slog.Warn("Failed to record estimated call cost", "error", err, "call_sid", cdr.CallSID)
+	}
+}
+
+// estimateMessageCost prices an outbound SMS or MMS from the rate table
+// once Twilio has accepted it. Other channels aren't rated.
+func estimateMessageCost(ctx context.Context, deps *Dependencies, message *models.Message) {
+	if message.Channel != channels.SMS && message.Channel != channels.MMS {
+		return
+	}
+	hasMedia := message.Channel == channels.MMS || len(message.MediaURLs) > 0
+	table, err := rating.LoadFor(ctx, deps.DB, rating.MessageKind(hasMedia), message.ToNumber)
+	if err != nil {
+		slog.Warn("Failed to load message rates", "error", err, "message_id", message.ID)
+		return
+	}
+	if message.EstimatedCost = table.MessageCost(message.ToNumber, message.Body, hasMedia); message.EstimatedCost == nil {
+		return
+	}
+	if err := deps.DB.Messages.SetEstimatedCost(ctx, message.ID, message.EstimatedCost); err != nil {
+		slog.Warn("Failed to record estimated message cost", "error", err, "message_id", message.ID)
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/twilio"
+)
+
+func TestBillingHandler_ImportRates(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewBillingHandler(&Dependencies{DB: setup.DB})
+
+	importRates := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ImportRates(rr, httptest.NewRequest(http.MethodPost, "/api/billing/rates", strings.NewReader(body)))
+		return rr
+	}
+
+	assertStatus(t, importRates("kind,prefix\ncall,1\n"), http.StatusBadRequest)
+	assertStatus(t, importRates("kind,prefix,rate\nfax,1,0.1\n"), http.StatusBadRequest)
+
+	rr := importRates("kind,prefix,rate,description\ncall,+1,0.014,US and Canada\nsms,1,0.0079,\nmms,1,0.02,\n")
+	assertStatus(t, rr, http.StatusOK)
+	var rates []struct {
+		Kind   string  `json:"kind"`
+		Prefix string  `json:"prefix"`
+		Rate   float64 `json:"rate"`
+	}
+	decodeResponse(t, rr, &rates)
+	if len(rates) != 3 || rates[0].Kind != "call" || rates[0].Prefix != "1" || rates[0].Rate != 0.014 {
+		t.Fatalf("Unexpected rates %+v", rates)
+	}
+
+	// An import replaces the whole table
+	assertStatus(t, importRates("kind,prefix,rate\ncall,44,0.05\n"), http.StatusOK)
+	if rates, _ := setup.DB.Rates.List(context.Background()); len(rates) != 1 || rates[0].Prefix != "44" {
+		t.Errorf("Expected the table replaced, got %+v", rates)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.DeleteRates(rr, httptest.NewRequest(http.MethodDelete, "/api/billing/rates", nil))
+	assertStatus(t, rr, http.StatusNoContent)
+	if rates, _ := setup.DB.Rates.List(context.Background()); len(rates) != 0 {
+		t.Errorf("Expected the table emptied, got %+v", rates)
+	}
+}
+
+func TestBillingHandler_EstimateAndReconcile(t *testing.T) {
+	setup := setupTestAPI(t)
+	ctx := context.Background()
+	deps := &Dependencies{DB: setup.DB, Twilio: setup.Twilio, Events: events.NewHub(10)}
+	handler := NewBillingHandler(deps)
+
+	rr := httptest.NewRecorder()
+	handler.ImportRates(rr, httptest.NewRequest(http.MethodPost, "/api/billing/rates",
+		strings.NewReader("kind,prefix,rate\ncall,1,0.014\nsms,1,0.0079\n")))
+	assertStatus(t, rr, http.StatusOK)
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	cdr := createTestCDR(t, setup.DB, did.ID, "outbound", did.Number, "+15559876543")
+	cdr.StartedAt = time.Now()
+	setup.DB.CDRs.Update(ctx, cdr)
+	unrated := createTestCDR(t, setup.DB, did.ID, "outbound", did.Number, "+442071234567")
+	unrated.StartedAt = time.Now()
+	setup.DB.CDRs.Update(ctx, unrated)
+
+	// Calls are estimated when they end
+	for _, c := range []struct{ sid, duration string }{{cdr.CallSID, "61"}, {unrated.CallSID, "30"}} {
+		form := url.Values{"CallSid": {c.sid}, "CallStatus": {"completed"}, "CallDuration": {c.duration}}
+		req := httptest.NewRequest(http.MethodPost, "/api/webhooks/voice/status", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		NewWebhookHandler(deps).VoiceStatus(httptest.NewRecorder(), req)
+	}
+	if got, _ := setup.DB.CDRs.GetByID(ctx, cdr.ID); got.EstimatedCost == nil || *got.EstimatedCost != 0.028 {
+		t.Fatalf("Expected a two minute call estimated at 0.028, got %v", got.EstimatedCost)
+	}
+
+	message := createTestMessage(t, setup.DB, did.ID, "outbound", "+15559876543", strings.Repeat("a", 161))
+	estimateMessageCost(ctx, deps, message)
+	if message.EstimatedCost == nil || *message.EstimatedCost != 0.0158 {
+		t.Fatalf("Expected a two segment SMS estimated at 0.0158, got %v", message.EstimatedCost)
+	}
+
+	setup.Twilio.GetCallPriceFunc = func(ctx context.Context, callSID string) (string, string, error) {
+		if callSID == cdr.CallSID {
+			return "-0.02800", "USD", nil
+		}
+		return "", "USD", nil
+	}
+	setup.Twilio.GetMessageFunc = func(ctx context.Context, messageSID string) (*twilio.TwilioMessage, error) {
+		return &twilio.TwilioMessage{SID: messageSID, Price: "-0.01580", PriceUnit: "USD"}, nil
+	}
+
+	rr = httptest.NewRecorder()
+	handler.Sync(rr, httptest.NewRequest(http.MethodPost, "/api/billing/sync", nil))
+	assertStatus(t, rr, http.StatusOK)
+	var sync BillingSyncResponse
+	decodeResponse(t, rr, &sync)
+	if sync != (BillingSyncResponse{Calls: 1, Messages: 1, Pending: 1}) {
+		t.Errorf("Unexpected sync result %+v", sync)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.GetStats(rr, httptest.NewRequest(http.MethodGet, "/api/billing/stats", nil))
+	assertStatus(t, rr, http.StatusOK)
+	var stats BillingStatsResponse
+	decodeResponse(t, rr, &stats)
+	if stats.Calls.Count != 2 || stats.Calls.Unrated != 1 || stats.Calls.Reconciled != 1 ||
+		stats.Messages.Count != 1 || stats.EstimatedCost != 0.0438 || stats.ActualCost != 0.0438 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.GetStats(rr, httptest.NewRequest(http.MethodGet, "/api/billing/stats?start_date=soon", nil))
+	assertStatus(t, rr, http.StatusBadRequest)
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// BlocklistFeedsResponse lists subscribed spam feeds with their health
+type BlocklistFeedsResponse struct {
+	Enabled          bool                    `json:"enabled"`
+	Schedule         string                  `json:"schedule"`
+	CommunityEntries int                     `json:"community_entries"`
+	Feeds            []*models.BlocklistFeed `json:"feeds"`
+}
+
+// BlocklistFeedRequest represents a feed subscription create or update request
+type BlocklistFeedRequest struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Enabled *bool  `json:"enabled,omitempty"`
+}
+
+// BlocklistCheckResponse reports which blocklist tiers list a number
+type BlocklistCheckResponse struct {
+	Number    string                 `json:"number"`
+	Blocked   bool                   `json:"blocked"`
+	Entry     *models.BlocklistEntry `json:"entry,omitempty"`
+	Community bool                   `json:"community"`
+	Feed      *models.BlocklistFeed  `json:"feed,omitempty"`
+}
+
+// ListBlocklistFeeds returns the subscribed feeds, their refresh health and the feed settings
+func (h *RouteHandler) ListBlocklistFeeds(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	feeds, err := h.deps.DB.BlocklistFeeds.List(ctx)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if feeds == nil {
+		feeds = []*models.BlocklistFeed{}
+	}
+
+	count, err := h.deps.DB.BlocklistFeeds.CountEntries(ctx)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, BlocklistFeedsResponse{
+		Enabled:          h.deps.DB.Config.GetWithDefault(ctx, "blocklist_feeds_enabled", "false") == "true",
+		Schedule:         h.deps.DB.Config.GetWithDefault(ctx, "blocklist_feed_schedule", config.DefaultBlocklistFeedSchedule),
+		CommunityEntries: count,
+		Feeds:            feeds,
+	})
+}
+
+// CreateBlocklistFeed subscribes to a spam number feed
+func (h *RouteHandler) CreateBlocklistFeed(w http.ResponseWriter, r *http.Request) {
+	var req BlocklistFeedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	if errs := validateBlocklistFeed(req); len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	feed := &models.BlocklistFeed{
+		Name:    req.Name,
+		URL:     req.URL,
+		Enabled: req.Enabled == nil || *req.Enabled,
+	}
+	if err := h.deps.DB.BlocklistFeeds.Create(r.Context(), feed); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "Feed URL is already subscribed", nil)
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, feed)
+}
+
+// UpdateBlocklistFeed updates a feed subscription
+func (h *RouteHandler) UpdateBlocklistFeed(w http.ResponseWriter, r *http.Request) {
+	feed, ok := h.blocklistFeed(w, r)
+	if !ok {
+		return
+	}
+
+	var req BlocklistFeedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	if req.Name != "" {
+		feed.Name = req.Name
+	}
+	if req.URL != "" {
+		feed.URL = req.URL
+	}
+	if req.Enabled != nil {
+		feed.Enabled = *req.Enabled
+	}
+
+	if errs := validateBlocklistFeed(BlocklistFeedRequest{Name: feed.Name, URL: feed.URL}); len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	if err := h.deps.DB.BlocklistFeeds.Update(r.Context(), feed); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "Feed URL is already subscribed", nil)
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	updated, err := h.deps.DB.BlocklistFeeds.GetByID(r.Context(), feed.ID)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	WriteJSON(w, http.StatusOK, updated)
+}
+
+// DeleteBlocklistFeed unsubscribes from a feed and removes its numbers
+func (h *RouteHandler) DeleteBlocklistFeed(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid feed ID", nil)
+		return
+	}
+
+	if err := h.deps.DB.BlocklistFeeds.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, db.ErrBlocklistFeedNotFound) {
+			WriteNotFoundError(w, "Blocklist feed")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Blocklist feed deleted successfully"})
+}
+
+// SyncBlocklistFeed refreshes a feed immediately and returns its updated health
+func (h *RouteHandler) SyncBlocklistFeed(w http.ResponseWriter, r *http.Request) {
+	feed, ok := h.blocklistFeed(w, r)
+	if !ok {
+		return
+	}
+	if h.deps.FeedSyncer == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Blocklist feed sync is unavailable", nil)
+		return
+	}
+
+	// A failed refresh is recorded on the feed and reported through its status
+	h.deps.FeedSyncer.SyncFeed(r.Context(), feed)
+
+	updated, err := h.deps.DB.BlocklistFeeds.GetByID(r.Context(), feed.ID)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	WriteJSON(w, http.StatusOK, updated)
+}
+
+// CheckBlocklist reports whether a number is on the manual or the community blocklist
+func (h *RouteHandler) CheckBlocklist(w http.ResponseWriter, r *http.Request) {
+	number := r.URL.Query().Get("number")
+	if number == "" {
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "number", Message: "Number is required"},
+		})
+		return
+	}
+
+	resp := BlocklistCheckResponse{Number: number}
+
+	var err error
+	resp.Blocked, resp.Entry, err = h.deps.DB.Blocklist.IsBlocked(r.Context(), number)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	resp.Community, resp.Feed, err = h.deps.DB.BlocklistFeeds.IsListed(r.Context(), number)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// blocklistFeed loads the feed named by the id URL parameter, writing an error response if it can't
+func (h *RouteHandler) blocklistFeed(w http.ResponseWriter, r *http.Request) (*models.BlocklistFeed, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid feed ID", nil)
+		return nil, false
+	}
+
+	feed, err := h.deps.DB.BlocklistFeeds.GetByID(r.Context(), id)
+	if errors.Is(err, db.ErrBlocklistFeedNotFound) {
+		WriteNotFoundError(w, "Blocklist feed")
+		return nil, false
+	}
+	if err != nil {
+		WriteInternalError(w)
+		return nil, false
+	}
+	return feed, true
+}
+
+// validateBlocklistFeed checks a feed's name and URL
+func validateBlocklistFeed(req BlocklistFeedRequest) []FieldError {
+	var errs []FieldError
+	if req.Name == "" {
+		errs = append(errs, FieldError{Field: "name", Message: "Name is required"})
+	}
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, FieldError{Field: "url", Message: "Must be an http or https URL"})
+	}
+	return errs
+}
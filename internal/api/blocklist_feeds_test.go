@@ -0,0 +1,152 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/blocklist"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func createBlocklistFeed(t *testing.T, handler *RouteHandler, req BlocklistFeedRequest) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body, _ := json.Marshal(req)
+	r := httptest.NewRequest(http.MethodPost, "/api/blocklist/feeds", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler.CreateBlocklistFeed(rr, r)
+	return rr
+}
+
+func TestRouteHandler_CreateBlocklistFeed(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewRouteHandler(&Dependencies{DB: setup.DB})
+
+	rr := createBlocklistFeed(t, handler, BlocklistFeedRequest{Name: "Spam", URL: "https://feeds.example.com/spam.txt"})
+	assertStatus(t, rr, http.StatusCreated)
+
+	var feed models.BlocklistFeed
+	decodeResponse(t, rr, &feed)
+	if !feed.Enabled || feed.Status != "pending" {
+		t.Errorf("Expected enabled pending feed, got %+v", feed)
+	}
+
+	// The same URL can only be subscribed once
+	rr = createBlocklistFeed(t, handler, BlocklistFeedRequest{Name: "Again", URL: "https://feeds.example.com/spam.txt"})
+	assertStatus(t, rr, http.StatusConflict)
+}
+
+func TestRouteHandler_CreateBlocklistFeed_Validation(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewRouteHandler(&Dependencies{DB: setup.DB})
+
+	for _, req := range []BlocklistFeedRequest{
+		{URL: "https://feeds.example.com/spam.txt"},
+		{Name: "Spam", URL: "file:///etc/passwd"},
+		{Name: "Spam", URL: "not a url"},
+	} {
+		rr := createBlocklistFeed(t, handler, req)
+		assertStatus(t, rr, http.StatusBadRequest)
+	}
+}
+
+func TestRouteHandler_SyncBlocklistFeed(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewRouteHandler(&Dependencies{DB: setup.DB, FeedSyncer: blocklist.NewSyncer(setup.DB)})
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("+15559999999\n+15558888888\n"))
+	}))
+	defer server.Close()
+
+	rr := createBlocklistFeed(t, handler, BlocklistFeedRequest{Name: "Spam", URL: server.URL})
+	var feed models.BlocklistFeed
+	decodeResponse(t, rr, &feed)
+
+	sync := func() models.BlocklistFeed {
+		req := httptest.NewRequest(http.MethodPost, "/api/blocklist/feeds/1/sync", nil)
+		req = withURLParams(req, map[string]string{"id": "1"})
+		rr := httptest.NewRecorder()
+		handler.SyncBlocklistFeed(rr, req)
+		assertStatus(t, rr, http.StatusOK)
+
+		var synced models.BlocklistFeed
+		decodeResponse(t, rr, &synced)
+		return synced
+	}
+
+	if synced := sync(); synced.Status != "ok" || synced.EntryCount != 2 {
+		t.Errorf("Expected ok feed with 2 entries, got %+v", synced)
+	}
+
+	status = http.StatusServiceUnavailable
+	if synced := sync(); synced.Status != "error" || synced.LastError == nil {
+		t.Errorf("Expected feed error to be reported, got %+v", synced)
+	}
+
+	// Feed health is included in the listing
+	req := httptest.NewRequest(http.MethodGet, "/api/blocklist/feeds", nil)
+	rr = httptest.NewRecorder()
+	handler.ListBlocklistFeeds(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+
+	var list BlocklistFeedsResponse
+	decodeResponse(t, rr, &list)
+	if len(list.Feeds) != 1 || list.Feeds[0].Status != "error" || list.CommunityEntries != 2 {
+		t.Errorf("Unexpected feed listing %+v", list)
+	}
+	if list.Enabled || list.Schedule != "0 */6 * * *" {
+		t.Errorf("Expected default feed settings, got enabled=%v schedule=%q", list.Enabled, list.Schedule)
+	}
+}
+
+func TestRouteHandler_CheckBlocklist(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewRouteHandler(&Dependencies{DB: setup.DB})
+	ctx := context.Background()
+
+	feed := &models.BlocklistFeed{Name: "Spam", URL: "https://feeds.example.com/spam.txt", Enabled: true}
+	setup.DB.BlocklistFeeds.Create(ctx, feed)
+	setup.DB.BlocklistFeeds.RecordSuccess(ctx, feed.ID, []string{"+15559999999"})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/blocklist/check?number=%2B15559999999", nil)
+	rr := httptest.NewRecorder()
+	handler.CheckBlocklist(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+
+	var resp BlocklistCheckResponse
+	decodeResponse(t, rr, &resp)
+	if resp.Blocked || !resp.Community || resp.Feed == nil || resp.Feed.Name != "Spam" {
+		t.Errorf("Expected community-only listing, got %+v", resp)
+	}
+}
+
+func TestRouteHandler_DeleteBlocklistFeed(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewRouteHandler(&Dependencies{DB: setup.DB})
+	ctx := context.Background()
+
+	feed := &models.BlocklistFeed{Name: "Spam", URL: "https://feeds.example.com/spam.txt", Enabled: true}
+	setup.DB.BlocklistFeeds.Create(ctx, feed)
+	setup.DB.BlocklistFeeds.RecordSuccess(ctx, feed.ID, []string{"+15559999999"})
+
+	del := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/api/blocklist/feeds/1", nil)
+		req = withURLParams(req, map[string]string{"id": "1"})
+		rr := httptest.NewRecorder()
+		handler.DeleteBlocklistFeed(rr, req)
+		return rr
+	}
+
+	assertStatus(t, del(), http.StatusOK)
+	if listed, _, _ := setup.DB.BlocklistFeeds.IsListed(ctx, "+15559999999"); listed {
+		t.Error("Expected the feed's numbers to be removed")
+	}
+	assertStatus(t, del(), http.StatusNotFound)
+}
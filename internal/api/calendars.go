@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// maxUpcomingBusyBlocks limits the busy blocks listed with a calendar
+const maxUpcomingBusyBlocks = 20
+
+// CalendarHandler lets users link a calendar whose busy blocks drive
+// availability-based routing and SMS auto-replies
+type CalendarHandler struct {
+	deps *Dependencies
+}
+
+// NewCalendarHandler creates a new CalendarHandler
+func NewCalendarHandler(deps *Dependencies) *CalendarHandler {
+	return &CalendarHandler{deps: deps}
+}
+
+// CalendarResponse is a linked calendar with the user's current availability
+type CalendarResponse struct {
+	*models.UserCalendar
+	Busy     bool               `json:"busy"`
+	Upcoming []models.BusyBlock `json:"upcoming"`
+}
+
+// Get returns the current user's linked calendar
+func (h *CalendarHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		WriteUnauthorizedError(w)
+		return
+	}
+
+	cal, err := h.deps.DB.Calendars.GetByUser(r.Context(), user.ID)
+	if err != nil {
+		if err == db.ErrCalendarNotFound {
+			WriteNotFoundError(w, "Calendar")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	h.writeCalendar(w, r, cal)
+}
+
+// writeCalendar responds with a calendar and the user's busy blocks from now on
+func (h *CalendarHandler) writeCalendar(w http.ResponseWriter, r *http.Request, cal *models.UserCalendar) {
+	now := time.Now()
+	blocks, err := h.deps.DB.Calendars.ListBusy(r.Context(), cal.UserID, now)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	resp := &CalendarResponse{UserCalendar: cal, Upcoming: []models.BusyBlock{}}
+	for _, b := range blocks {
+		if !b.Start.After(now) {
+			resp.Busy = true
+		}
+		if len(resp.Upcoming) < maxUpcomingBusyBlocks {
+			resp.Upcoming = append(resp.Upcoming, b)
+		}
+	}
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// LinkCalendarRequest represents a calendar link. A nil password keeps the
+// password of the calendar linked before.
+type LinkCalendarRequest struct {
+	Provider string  `json:"provider"`
+	URL      string  `json:"url"`
+	Username string  `json:"username,omitempty"`
+	Password *string `json:"password,omitempty"`
+	Enabled  *bool   `json:"enabled,omitempty"`
+}
+
+// Update links a calendar to the current user, replacing any linked before,
+// and syncs it right away
+func (h *CalendarHandler) Update(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		WriteUnauthorizedError(w)
+		return
+	}
+
+	var req LinkCalendarRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	var errors []FieldError
+	if req.Provider != db.CalendarProviderCalDAV && req.Provider != db.CalendarProviderGoogle {
+		errors = append(errors, FieldError{Field: "provider", Message: "Provider must be caldav or google"})
+	}
+	if u, err := url.Parse(req.URL); err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		errors = append(errors, FieldError{Field: "url", Message: "URL must be an http or https address"})
+	} else if req.Provider == db.CalendarProviderGoogle && u.Scheme != "https" {
+		errors = append(errors, FieldError{Field: "url", Message: "Google calendar addresses must use https"})
+	}
+	if len(errors) > 0 {
+		WriteValidationError(w, "Validation failed", errors)
+		return
+	}
+
+	cal := &models.UserCalendar{
+		UserID:   user.ID,
+		Provider: req.Provider,
+		URL:      req.URL,
+		Username: req.Username,
+		Enabled:  true,
+	}
+	if req.Enabled != nil {
+		cal.Enabled = *req.Enabled
+	}
+	if req.Password != nil {
+		cal.Password = *req.Password
+	} else if existing, err := h.deps.DB.Calendars.GetByUser(r.Context(), user.ID); err == nil {
+		cal.Password = existing.Password
+	}
+
+	if err := h.deps.DB.Calendars.Save(r.Context(), cal); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	// A failed sync is recorded on the calendar and reported through its status
+	if cal.Enabled && h.deps.Calendars != nil {
+		h.deps.Calendars.SyncCalendar(r.Context(), cal)
+	}
+
+	h.sendCalendar(w, r, user.ID)
+}
+
+// Sync refreshes the current user's calendar now
+func (h *CalendarHandler) Sync(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		WriteUnauthorizedError(w)
+		return
+	}
+
+	cal, err := h.deps.DB.Calendars.GetByUser(r.Context(), user.ID)
+	if err != nil {
+		if err == db.ErrCalendarNotFound {
+			WriteNotFoundError(w, "Calendar")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+	if h.deps.Calendars == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Calendar sync is unavailable", nil)
+		return
+	}
+
+	h.deps.Calendars.SyncCalendar(r.Context(), cal)
+	h.sendCalendar(w, r, user.ID)
+}
+
+// sendCalendar reloads a user's calendar after a change and responds with it
+func (h *CalendarHandler) sendCalendar(w http.ResponseWriter, r *http.Request, userID int64) {
+	cal, err := h.deps.DB.Calendars.GetByUser(r.Context(), userID)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	h.writeCalendar(w, r, cal)
+}
+
+// Delete unlinks the current user's calendar
+func (h *CalendarHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		WriteUnauthorizedError(w)
+		return
+	}
+
+	if err := h.deps.DB.Calendars.DeleteByUser(r.Context(), user.ID); err != nil {
+		if err == db.ErrCalendarNotFound {
+			WriteNotFoundError(w, "Calendar")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Calendar unlinked successfully"})
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// mockCalendarSyncer records synced calendars and stores fixed busy blocks
+type mockCalendarSyncer struct {
+	deps   *Dependencies
+	blocks []models.BusyBlock
+	synced int
+}
+
+func (m *mockCalendarSyncer) SyncCalendar(ctx context.Context, cal *models.UserCalendar) error {
+	m.synced++
+	return m.deps.DB.Calendars.RecordSuccess(ctx, cal.ID, m.blocks)
+}
+
+func calendarRequest(method, body string, user *models.User) *http.Request {
+	req := httptest.NewRequest(method, "/api/me/calendar", bytes.NewBufferString(body))
+	return req.WithContext(context.WithValue(req.Context(), contextKeyUser, user))
+}
+
+func TestCalendarHandler_Update(t *testing.T) {
+	setup := setupTestAPI(t)
+	user := createTestUser(t, setup.DB, "user@example.com", "password123", "user")
+	deps := &Dependencies{DB: setup.DB}
+	now := time.Now()
+	syncer := &mockCalendarSyncer{deps: deps, blocks: []models.BusyBlock{
+		{Start: now.Add(-time.Minute), End: now.Add(time.Hour)},
+		{Start: now.Add(2 * time.Hour), End: now.Add(3 * time.Hour)},
+	}}
+	deps.Calendars = syncer
+	handler := NewCalendarHandler(deps)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"unknown provider", `{"provider": "exchange", "url": "https://example.com/cal"}`, http.StatusBadRequest},
+		{"bad url", `{"provider": "caldav", "url": "ftp://example.com/cal"}`, http.StatusBadRequest},
+		{"google over http", `{"provider": "google", "url": "http://calendar.google.com/basic.ics"}`, http.StatusBadRequest},
+		{"valid", `{"provider": "caldav", "url": "https://dav.example.com/calendars/user/", "username": "user", "password": "secret"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.Update(rr, calendarRequest(http.MethodPut, tt.body, user))
+			assertStatus(t, rr, tt.want)
+		})
+	}
+
+	if syncer.synced != 1 {
+		t.Errorf("Expected 1 sync, got %d", syncer.synced)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.Get(rr, calendarRequest(http.MethodGet, "", user))
+	assertStatus(t, rr, http.StatusOK)
+
+	var resp map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp["busy"] != true || resp["status"] != "ok" {
+		t.Errorf("Expected busy calendar with status ok, got %v", resp)
+	}
+	if _, ok := resp["password"]; ok {
+		t.Error("Expected password to be omitted")
+	}
+	if upcoming, _ := resp["upcoming"].([]interface{}); len(upcoming) != 2 {
+		t.Errorf("Expected 2 upcoming blocks, got %v", resp["upcoming"])
+	}
+
+	// Relinking without a password keeps the stored one
+	rr = httptest.NewRecorder()
+	handler.Update(rr, calendarRequest(http.MethodPut, `{"provider": "caldav", "url": "https://dav.example.com/calendars/user/work/", "username": "user"}`, user))
+	assertStatus(t, rr, http.StatusOK)
+	cal, err := setup.DB.Calendars.GetByUser(context.Background(), user.ID)
+	if err != nil || cal.Password != "secret" {
+		t.Errorf("Expected password to be kept, got %+v (%v)", cal, err)
+	}
+}
+
+func TestCalendarHandler_Delete(t *testing.T) {
+	setup := setupTestAPI(t)
+	user := createTestUser(t, setup.DB, "user@example.com", "password123", "user")
+	handler := NewCalendarHandler(&Dependencies{DB: setup.DB})
+
+	rr := httptest.NewRecorder()
+	handler.Delete(rr, calendarRequest(http.MethodDelete, "", user))
+	assertStatus(t, rr, http.StatusNotFound)
+
+	rr = httptest.NewRecorder()
+	handler.Update(rr, calendarRequest(http.MethodPut, `{"provider": "google", "url": "https://calendar.google.com/calendar/ical/private/basic.ics"}`, user))
+	assertStatus(t, rr, http.StatusOK)
+
+	rr = httptest.NewRecorder()
+	handler.Sync(rr, calendarRequest(http.MethodPost, "", user))
+	assertStatus(t, rr, http.StatusServiceUnavailable)
+
+	rr = httptest.NewRecorder()
+	handler.Delete(rr, calendarRequest(http.MethodDelete, "", user))
+	assertStatus(t, rr, http.StatusOK)
+
+	rr = httptest.NewRecorder()
+	handler.Get(rr, calendarRequest(http.MethodGet, "", user))
+	assertStatus(t, rr, http.StatusNotFound)
+}
+
+func TestWebhookHandler_CheckAutoReply_CalendarBusy(t *testing.T) {
+	setup := setupTestAPI(t)
+	did := createTestDID(t, setup.DB, "+15551234567")
+	user := createTestUser(t, setup.DB, "user@example.com", "password123", "user")
+
+	cal := &models.UserCalendar{UserID: user.ID, Provider: "google", URL: "https://calendar.google.com/basic.ics", Enabled: true}
+	if err := setup.DB.Calendars.Save(context.Background(), cal); err != nil {
+		t.Fatalf("Failed to save calendar: %v", err)
+	}
+	rule := &models.AutoReply{
+		DIDID:       &did.ID,
+		TriggerType: "calendar_busy",
+		TriggerData: json.RawMessage(strconv.FormatInt(user.ID, 10)),
+		ReplyText:   "In a meeting, will reply soon",
+		Enabled:     true,
+	}
+	if err := setup.DB.AutoReplies.Create(context.Background(), rule); err != nil {
+		t.Fatalf("Failed to create auto-reply: %v", err)
+	}
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+
+	if reply := handler.checkAutoReply(context.Background(), did.ID, "Hi"); reply != "" {
+		t.Errorf("Expected no reply while free, got %q", reply)
+	}
+
+	now := time.Now()
+	blocks := []models.BusyBlock{{Start: now.Add(-time.Minute), End: now.Add(time.Hour)}}
+	if err := setup.DB.Calendars.RecordSuccess(context.Background(), cal.ID, blocks); err != nil {
+		t.Fatalf("Failed to record busy blocks: %v", err)
+	}
+	if reply := handler.checkAutoReply(context.Background(), did.ID, "Hi"); reply != rule.ReplyText {
+		t.Errorf("Expected busy reply, got %q", reply)
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/btafoya/gosip/internal/audio"
+	"github.com/btafoya/gosip/pkg/sip"
+	"github.com/go-chi/chi/v5"
+)
+
+// promptNamePattern matches the names of prompt files, which can't leave
+// the prompts directory
+var promptNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// AnnounceRequest represents a request to play a prompt into a call
+type AnnounceRequest struct {
+	Prompt string `json:"prompt"` // Name of a WAV file in the prompts directory, without .wav
+	Leg    string `json:"leg"`    // "caller", "callee" or "both" (default)
+}
+
+// Announce queues a prompt to be played into an active call
+// POST /api/calls/{callID}/announce
+func (h *CallHandler) Announce(w http.ResponseWriter, r *http.Request) {
+	callID := chi.URLParam(r, "callID")
+
+	var req AnnounceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	if req.Leg == "" {
+		req.Leg = sip.AnnounceBoth
+	}
+
+	var fieldErrors []FieldError
+	if !promptNamePattern.MatchString(req.Prompt) {
+		fieldErrors = append(fieldErrors, FieldError{Field: "prompt", Message: "Prompt must be 1-64 letters, digits, '-' or '_'"})
+	}
+	if req.Leg != sip.AnnounceCaller && req.Leg != sip.AnnounceCallee && req.Leg != sip.AnnounceBoth {
+		fieldErrors = append(fieldErrors, FieldError{Field: "leg", Message: "Leg must be caller, callee or both"})
+	}
+	if len(fieldErrors) > 0 {
+		WriteValidationError(w, "Validation failed", fieldErrors)
+		return
+	}
+
+	if h.deps.SIP == nil || h.deps.SIP.GetSessions() == nil {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Call not found", nil)
+		return
+	}
+	session := h.deps.SIP.GetSessions().Get(callID)
+	if session == nil {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Call not found", nil)
+		return
+	}
+	if session.GetState() != sip.CallStateActive {
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "Announcements can only be played into connected calls", nil)
+		return
+	}
+
+	announcer := h.deps.SIP.GetAnnouncer()
+	if announcer == nil || h.deps.Config == nil {
+		WriteError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Announcements not available", nil)
+		return
+	}
+
+	data, errResp := loadPrompt(filepath.Join(h.deps.Config.PromptsPath(), req.Prompt+".wav"))
+	if errResp != nil {
+		WriteValidationError(w, "Validation failed", []FieldError{*errResp})
+		return
+	}
+
+	a, err := announcer.Enqueue(session, req.Prompt, req.Leg, data)
+	if err != nil {
+		if errors.Is(err, sip.ErrAnnouncementQueueFull) {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "The call already has the most announcements queued", nil)
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": a,
+	})
+}
+
+// loadPrompt reads the audio of a prompt file, returning a field error when
+// it is missing or isn't usable WAV audio
+func loadPrompt(path string) ([]byte, *FieldError) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, &FieldError{Field: "prompt", Message: "Prompt not found"}
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, &FieldError{Field: "prompt", Message: "Prompt not found"}
+	}
+	if result := audio.ValidateWAV(file, info.Size()); !result.Valid {
+		return nil, &FieldError{Field: "prompt", Message: "Prompt is not a valid WAV file"}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, &FieldError{Field: "prompt", Message: "Prompt not found"}
+	}
+	data, err := io.ReadAll(file)
+	if err != nil || len(data) <= 44 {
+		return nil, &FieldError{Field: "prompt", Message: "Prompt is not a valid WAV file"}
+	}
+	return data[44:], nil // Skip WAV header
+}
+
+// ListAnnouncements returns the playing and queued announcements of a call
+// GET /api/calls/{callID}/announcements
+func (h *CallHandler) ListAnnouncements(w http.ResponseWriter, r *http.Request) {
+	callID := chi.URLParam(r, "callID")
+
+	if h.deps.SIP == nil || h.deps.SIP.GetSessions() == nil || h.deps.SIP.GetSessions().Get(callID) == nil {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Call not found", nil)
+		return
+	}
+
+	list := []sip.Announcement{}
+	if announcer := h.deps.SIP.GetAnnouncer(); announcer != nil {
+		list = announcer.List(callID)
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  list,
+		"count": len(list),
+	})
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/btafoya/gosip/pkg/sip"
+	"github.com/go-chi/chi/v5"
+)
+
+// ConferenceInviteRequest invites a device into a conference
+type ConferenceInviteRequest struct {
+	Target string `json:"target"` // Extension or username of a registered device
+}
+
+// ConferenceParticipantRequest mutes or unmutes a conference participant
+type ConferenceParticipantRequest struct {
+	Muted *bool `json:"muted"`
+}
+
+// GetCallConference returns a conference and its participants
+// GET /api/calls/{callID}/conference
+func (h *CallHandler) GetCallConference(w http.ResponseWriter, r *http.Request) {
+	conf, ok := h.callConference(w, chi.URLParam(r, "callID"))
+	if !ok {
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"data": conf.Status(),
+	})
+}
+
+// StartCallConference escalates an answered call to a conference of its
+// two parties, which more can be invited into. Only calls whose media
+// passes through GoSIP can be escalated.
+// POST /api/calls/{callID}/conference
+func (h *CallHandler) StartCallConference(w http.ResponseWriter, r *http.Request) {
+	callID := chi.URLParam(r, "callID")
+	if h.deps.SIP == nil {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Call not found", nil)
+		return
+	}
+
+	conf, err := h.deps.SIP.StartConference(callID)
+	switch {
+	case err == nil:
+	case errors.Is(err, sip.ErrConferenceUnavailable):
+		WriteError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Conferences need the media relay", nil)
+		return
+	case errors.Is(err, sip.ErrAlreadyConference):
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "The call is already a conference", nil)
+		return
+	case errors.Is(err, sip.ErrCallNotAnswered):
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "The call has not been answered", nil)
+		return
+	case errors.Is(err, sip.ErrCallNotConferenceable):
+		// Calls GoSIP knows of but doesn't carry the media of can't be mixed
+		if sessions := h.deps.SIP.GetSessions(); sessions != nil && sessions.Get(callID) != nil {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "The call's media doesn't pass through GoSIP, so it can't become a conference", nil)
+			return
+		}
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Call not found", nil)
+		return
+	default:
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"data": conf.Status(),
+	})
+}
+
+// InviteConferenceParticipant calls a registered device into a conference.
+// The device rings in the background: the participant joins when it
+// answers and leaves the list if it declines.
+// POST /api/calls/{callID}/conference/participants
+func (h *CallHandler) InviteConferenceParticipant(w http.ResponseWriter, r *http.Request) {
+	var req ConferenceInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	req.Target = strings.TrimSpace(req.Target)
+	if req.Target == "" {
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "target", Message: "Target must be a device extension or username"},
+		})
+		return
+	}
+
+	conf, ok := h.callConference(w, chi.URLParam(r, "callID"))
+	if !ok {
+		return
+	}
+
+	participant, err := conf.Invite(r.Context(), req.Target)
+	switch {
+	case err == nil:
+	case errors.Is(err, sip.ErrConferenceTarget):
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "target", Message: "No device has this extension or username"},
+		})
+		return
+	case errors.Is(err, sip.ErrDeviceNotRegistered):
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "The device is not registered", nil)
+		return
+	case errors.Is(err, sip.ErrConferenceFull):
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "The conference is full", nil)
+		return
+	case errors.Is(err, sip.ErrNotConference):
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "The conference has ended", nil)
+		return
+	case errors.Is(err, sip.ErrConferenceUnavailable), errors.Is(err, sip.ErrNoMediaPorts):
+		WriteError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Cannot invite participants right now", nil)
+		return
+	default:
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": participant,
+	})
+}
+
+// UpdateConferenceParticipant mutes or unmutes a conference participant.
+// Muted participants still hear the others.
+// PUT /api/calls/{callID}/conference/participants/{participantID}
+func (h *CallHandler) UpdateConferenceParticipant(w http.ResponseWriter, r *http.Request) {
+	var req ConferenceParticipantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	if req.Muted == nil {
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "muted", Message: "Muted is required"},
+		})
+		return
+	}
+
+	conf, ok := h.callConference(w, chi.URLParam(r, "callID"))
+	if !ok {
+		return
+	}
+
+	participant, err := conf.SetMuted(chi.URLParam(r, "participantID"), *req.Muted)
+	if err != nil {
+		WriteNotFoundError(w, "Participant")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"data": participant,
+	})
+}
+
+// KickConferenceParticipant hangs up a conference participant
+// DELETE /api/calls/{callID}/conference/participants/{participantID}
+func (h *CallHandler) KickConferenceParticipant(w http.ResponseWriter, r *http.Request) {
+	conf, ok := h.callConference(w, chi.URLParam(r, "callID"))
+	if !ok {
+		return
+	}
+
+	if err := conf.Kick(r.Context(), chi.URLParam(r, "participantID")); err != nil {
+		WriteNotFoundError(w, "Participant")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Participant removed from the conference",
+	})
+}
+
+// callConference returns the conference a call was escalated to, writing
+// the error response when there is none
+func (h *CallHandler) callConference(w http.ResponseWriter, callID string) (*sip.Conference, bool) {
+	if h.deps.SIP == nil {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Call not found", nil)
+		return nil, false
+	}
+
+	conf, err := h.deps.SIP.Conference(callID)
+	switch {
+	case err == nil:
+		return conf, true
+	case errors.Is(err, sip.ErrConferenceUnavailable):
+		WriteError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Conferences need the media relay", nil)
+		return nil, false
+	}
+	WriteError(w, http.StatusNotFound, "NOT_FOUND", "The call is not a conference", nil)
+	return nil, false
+}
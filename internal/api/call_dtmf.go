@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/pkg/sip"
+	"github.com/go-chi/chi/v5"
+)
+
+// SendDTMFRequest sends digits into a call
+type SendDTMFRequest struct {
+	Digits string `json:"digits"`           // 0-9, *, #, A-D
+	To     string `json:"to,omitempty"`     // "caller" or "callee"; defaults to the party other than the call's device
+	Method string `json:"method,omitempty"` // "rtp" or "info"; defaults to RTP when the call negotiated it
+}
+
+// SendDTMF sends digits to a party of an answered call whose media passes
+// through GoSIP, e.g. to get through an IVR menu. The digits are played in
+// the background; digits pressed on calls are reported as call.dtmf
+// events.
+// POST /api/calls/{callID}/dtmf
+func (h *CallHandler) SendDTMF(w http.ResponseWriter, r *http.Request) {
+	var req SendDTMFRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	req.Digits = strings.TrimSpace(req.Digits)
+
+	var fieldErrors []FieldError
+	if !sip.ValidDTMF(req.Digits) {
+		fieldErrors = append(fieldErrors, FieldError{Field: "digits", Message: "Digits must be 0-9, *, #, or A-D"})
+	} else if len(req.Digits) > config.MaxDTMFDigits {
+		fieldErrors = append(fieldErrors, FieldError{Field: "digits", Message: fmt.Sprintf("At most %d digits may be sent at once", config.MaxDTMFDigits)})
+	}
+	if req.To != "" && req.To != "caller" && req.To != "callee" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "to", Message: "To must be caller or callee"})
+	}
+	if req.Method != "" && req.Method != sip.DTMFMethodRTP && req.Method != sip.DTMFMethodInfo {
+		fieldErrors = append(fieldErrors, FieldError{Field: "method", Message: "Method must be rtp or info"})
+	}
+	if len(fieldErrors) > 0 {
+		WriteValidationError(w, "Validation failed", fieldErrors)
+		return
+	}
+
+	callID := chi.URLParam(r, "callID")
+	if h.deps.SIP == nil {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Call not found", nil)
+		return
+	}
+	session := h.deps.SIP.GetSessions().Get(callID)
+	if session == nil {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Call not found", nil)
+		return
+	}
+
+	// Inbound calls come to the device, which is the callee
+	toCaller := session.Direction == sip.CallDirectionInbound
+	if req.To != "" {
+		toCaller = req.To == "caller"
+	}
+
+	method, err := h.deps.SIP.SendDTMF(callID, req.Digits, toCaller, req.Method)
+	switch {
+	case err == nil:
+	case errors.Is(err, sip.ErrCallNotAnswered):
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "The call has not been answered", nil)
+		return
+	case errors.Is(err, sip.ErrCallNotDTMF):
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "The call's media doesn't pass through GoSIP, so it can't be sent digits", nil)
+		return
+	case errors.Is(err, sip.ErrNoTelephoneEvent):
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "The call didn't negotiate RTP telephone-events; send the digits with info", nil)
+		return
+	default:
+		WriteInternalError(w)
+		return
+	}
+
+	to := "callee"
+	if toCaller {
+		to = "caller"
+	}
+	WriteJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": map[string]interface{}{
+			"call_id": callID,
+			"digits":  strings.ToUpper(req.Digits),
+			"to":      to,
+			"method":  method,
+		},
+	})
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/btafoya/gosip/pkg/sip"
+	"github.com/go-chi/chi/v5"
+)
+
+// Call recording actions
+const (
+	RecordingActionStart  = "start"
+	RecordingActionPause  = "pause"
+	RecordingActionResume = "resume"
+	RecordingActionStop   = "stop"
+)
+
+// CallRecordingRequest starts, pauses, resumes or stops recording a call
+type CallRecordingRequest struct {
+	Action string `json:"action"` // "start", "pause", "resume" or "stop"
+}
+
+// GetCallRecording returns the recording state of an active call
+// GET /api/calls/{callID}/recording
+func (h *CallHandler) GetCallRecording(w http.ResponseWriter, r *http.Request) {
+	recorder, ok := h.callRecorder(w, chi.URLParam(r, "callID"))
+	if !ok {
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"data": recorder.Status(),
+	})
+}
+
+// RecordCall starts, pauses, resumes or stops recording an active call.
+// Only calls whose media passes through GoSIP can be recorded.
+// POST /api/calls/{callID}/recording
+func (h *CallHandler) RecordCall(w http.ResponseWriter, r *http.Request) {
+	var req CallRecordingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	switch req.Action {
+	case RecordingActionStart, RecordingActionPause, RecordingActionResume, RecordingActionStop:
+	default:
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "action", Message: "Action must be start, pause, resume or stop"},
+		})
+		return
+	}
+
+	recorder, ok := h.callRecorder(w, chi.URLParam(r, "callID"))
+	if !ok {
+		return
+	}
+
+	var err error
+	switch req.Action {
+	case RecordingActionStart:
+		err = recorder.Start(r.Context())
+	case RecordingActionPause:
+		err = recorder.Pause()
+	case RecordingActionResume:
+		err = recorder.Resume()
+	case RecordingActionStop:
+		err = recorder.Stop()
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, sip.ErrAlreadyRecording):
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "The call is already being recorded", nil)
+		return
+	case errors.Is(err, sip.ErrNotRecording):
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "The call is not being recorded", nil)
+		return
+	case errors.Is(err, sip.ErrCallNotRecordable):
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "The call has ended", nil)
+		return
+	case errors.Is(err, sip.ErrRecordingDiskLow):
+		WriteError(w, http.StatusInsufficientStorage, "INSUFFICIENT_STORAGE",
+			"The server is low on disk space. Free up space before recording calls.", nil)
+		return
+	default:
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"data": recorder.Status(),
+	})
+}
+
+// callRecorder returns the recorder of an active call, writing the error
+// response when there is none
+func (h *CallHandler) callRecorder(w http.ResponseWriter, callID string) (*sip.CallRecorder, bool) {
+	if h.deps.SIP == nil {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Call not found", nil)
+		return nil, false
+	}
+
+	recorder, err := h.deps.SIP.Recorder(callID)
+	switch {
+	case err == nil:
+		return recorder, true
+	case errors.Is(err, sip.ErrRecordingUnavailable):
+		WriteError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Call recording not available", nil)
+		return nil, false
+	}
+
+	// Calls GoSIP knows of but doesn't carry the media of can't be recorded
+	if sessions := h.deps.SIP.GetSessions(); sessions != nil && sessions.Get(callID) != nil {
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "The call's media doesn't pass through GoSIP, so it can't be recorded", nil)
+		return nil, false
+	}
+	WriteError(w, http.StatusNotFound, "NOT_FOUND", "Call not found", nil)
+	return nil, false
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/pkg/sip"
+	"github.com/go-chi/chi/v5"
+)
+
+// CallerListRequest represents a caller list create or update request
+type CallerListRequest struct {
+	Name      string   `json:"name"`
+	Numbers   []string `json:"numbers"`
+	AlertInfo string   `json:"alert_info"`
+}
+
+// ListCallerLists returns all distinctive ring caller lists
+func (h *RouteHandler) ListCallerLists(w http.ResponseWriter, r *http.Request) {
+	lists, err := h.deps.DB.CallerLists.List(r.Context())
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if lists == nil {
+		lists = []*models.CallerList{}
+	}
+
+	WriteJSON(w, http.StatusOK, lists)
+}
+
+// CreateCallerList creates a caller list that rings with a distinctive tone
+func (h *RouteHandler) CreateCallerList(w http.ResponseWriter, r *http.Request) {
+	var req CallerListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	if errs := validateCallerList(req); len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	list := &models.CallerList{
+		Name:      req.Name,
+		Numbers:   req.Numbers,
+		AlertInfo: req.AlertInfo,
+	}
+	if err := h.deps.DB.CallerLists.Create(r.Context(), list); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "A caller list with this name already exists", nil)
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+	if list.Numbers == nil {
+		list.Numbers = []string{}
+	}
+
+	WriteJSON(w, http.StatusCreated, list)
+}
+
+// UpdateCallerList updates a caller list. Numbers, when given, replace the existing list.
+func (h *RouteHandler) UpdateCallerList(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid caller list ID", nil)
+		return
+	}
+
+	list, err := h.deps.DB.CallerLists.GetByID(r.Context(), id)
+	if errors.Is(err, db.ErrCallerListNotFound) {
+		WriteNotFoundError(w, "Caller list")
+		return
+	}
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	var req CallerListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	if req.Name != "" {
+		list.Name = req.Name
+	}
+	if req.Numbers != nil {
+		list.Numbers = req.Numbers
+	}
+	if req.AlertInfo != "" {
+		list.AlertInfo = req.AlertInfo
+	}
+
+	if errs := validateCallerList(CallerListRequest{Name: list.Name, Numbers: list.Numbers, AlertInfo: list.AlertInfo}); len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	if err := h.deps.DB.CallerLists.Update(r.Context(), list); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "A caller list with this name already exists", nil)
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, list)
+}
+
+// DeleteCallerList removes a caller list
+func (h *RouteHandler) DeleteCallerList(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid caller list ID", nil)
+		return
+	}
+
+	if err := h.deps.DB.CallerLists.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, db.ErrCallerListNotFound) {
+			WriteNotFoundError(w, "Caller list")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Caller list deleted successfully"})
+}
+
+// validateCallerList checks a caller list's name, numbers and ring class
+func validateCallerList(req CallerListRequest) []FieldError {
+	var errs []FieldError
+	if req.Name == "" {
+		errs = append(errs, FieldError{Field: "name", Message: "Name is required"})
+	}
+	if !sip.ValidRingClass(req.AlertInfo) {
+		errs = append(errs, ringClassFieldError("alert_info"))
+	}
+	for _, number := range req.Numbers {
+		if strings.TrimSpace(number) == "" {
+			errs = append(errs, FieldError{Field: "numbers", Message: "Numbers must not be empty"})
+			break
+		}
+	}
+	return errs
+}
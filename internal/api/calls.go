@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/btafoya/gosip/internal/audio"
+	"github.com/btafoya/gosip/internal/jitter"
 	"github.com/btafoya/gosip/pkg/sip"
 	"github.com/go-chi/chi/v5"
 )
@@ -38,6 +39,11 @@ type ActiveCallResponse struct {
 	TransferTarget  string `json:"transfer_target,omitempty"`
 	ConsultCallID   string `json:"consult_call_id,omitempty"`
 	TransferredFrom string `json:"transferred_from,omitempty"`
+	MaxDuration     int    `json:"max_duration,omitempty"` // Seconds the call may last; 0 is unlimited
+	Anonymous       bool   `json:"anonymous,omitempty"`    // The caller ID is withheld
+
+	// JitterBuffer is set on calls whose RTP passes through GoSIP
+	JitterBuffer *jitter.Stats `json:"jitter_buffer,omitempty"`
 }
 
 // ListActiveCalls returns all active calls
@@ -76,6 +82,8 @@ func (h *CallHandler) ListActiveCalls(w http.ResponseWriter, r *http.Request) {
 			TransferTarget:  s.TransferTarget,
 			ConsultCallID:   s.ConsultCallID,
 			TransferredFrom: s.TransferredFrom,
+			MaxDuration:     s.MaxDuration,
+			Anonymous:       s.Anonymous,
 		})
 	}
 
@@ -106,21 +114,52 @@ func (h *CallHandler) GetCall(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	response := ActiveCallResponse{
+		CallID:          session.CallID,
+		Direction:       string(session.Direction),
+		State:           string(session.GetState()),
+		FromNumber:      session.FromNumber,
+		ToNumber:        session.ToNumber,
+		Duration:        session.Duration(),
+		DeviceID:        session.DeviceID,
+		LocalURI:        session.LocalURI,
+		RemoteURI:       session.RemoteURI,
+		TransferTarget:  session.TransferTarget,
+		ConsultCallID:   session.ConsultCallID,
+		TransferredFrom: session.TransferredFrom,
+		MaxDuration:     session.MaxDuration,
+		Anonymous:       session.Anonymous,
+	}
+	if stats, ok := h.deps.SIP.GetJitterStats(callID); ok {
+		response.JitterBuffer = &stats
+	}
+
 	WriteJSON(w, http.StatusOK, map[string]interface{}{
-		"data": ActiveCallResponse{
-			CallID:          session.CallID,
-			Direction:       string(session.Direction),
-			State:           string(session.GetState()),
-			FromNumber:      session.FromNumber,
-			ToNumber:        session.ToNumber,
-			Duration:        session.Duration(),
-			DeviceID:        session.DeviceID,
-			LocalURI:        session.LocalURI,
-			RemoteURI:       session.RemoteURI,
-			TransferTarget:  session.TransferTarget,
-			ConsultCallID:   session.ConsultCallID,
-			TransferredFrom: session.TransferredFrom,
-		},
+		"data": response,
+	})
+}
+
+// GetCallDiagnostics returns a call's signaling and media diagnostics: the
+// negotiated codec, transport, ICE candidates, SRTP/ZRTP status, RTP stats
+// and recent SIP messages. Calls GoSIP has handed off to the phones remain
+// available while their SIP trace is kept.
+// GET /api/calls/{callID}/diagnostics
+func (h *CallHandler) GetCallDiagnostics(w http.ResponseWriter, r *http.Request) {
+	callID := chi.URLParam(r, "callID")
+
+	if h.deps.SIP == nil {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Call not found", nil)
+		return
+	}
+
+	diag, ok := h.deps.SIP.CallDiagnostics(callID)
+	if !ok {
+		WriteError(w, http.StatusNotFound, "NOT_FOUND", "Call not found", nil)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"data": diag,
 	})
 }
 
@@ -331,6 +370,11 @@ func (h *CallHandler) HangupCall(w http.ResponseWriter, r *http.Request) {
 		mohMgr.Stop(callID)
 	}
 
+	// Drop announcements that haven't finished
+	if announcer := h.deps.SIP.GetAnnouncer(); announcer != nil {
+		announcer.Cancel(callID)
+	}
+
 	WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
 	})
@@ -434,6 +478,12 @@ type MOHUploadResponse struct {
 // UploadMOHAudio handles uploading a WAV file for Music on Hold
 // POST /api/calls/moh/upload
 func (h *CallHandler) UploadMOHAudio(w http.ResponseWriter, r *http.Request) {
+	if storageLow(r.Context(), h.deps) {
+		WriteError(w, http.StatusInsufficientStorage, "INSUFFICIENT_STORAGE",
+			"The server is low on disk space. Free up space before uploading audio.", nil)
+		return
+	}
+
 	// Max upload size: 10MB (matching audio.MaxFileSize)
 	const maxUploadSize = 10 * 1024 * 1024
 	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
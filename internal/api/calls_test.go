@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -33,6 +34,21 @@ func TestCallHandler_ListActiveCalls_NoSIP(t *testing.T) {
 	}
 }
 
+func TestCallHandler_GetCallDiagnostics_NoSIP(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB, SIP: nil}
+	handler := NewCallHandler(deps)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/calls/test-call-id/diagnostics", nil)
+	req = withURLParams(req, map[string]string{"callID": "test-call-id"})
+
+	rr := httptest.NewRecorder()
+	handler.GetCallDiagnostics(rr, req)
+
+	assertStatus(t, rr, http.StatusNotFound)
+	assertErrorCode(t, rr, "NOT_FOUND")
+}
+
 func TestCallHandler_GetCall_NoSIP(t *testing.T) {
 	setup := setupTestAPI(t)
 	deps := &Dependencies{DB: setup.DB, SIP: nil}
@@ -251,3 +267,140 @@ func TestCallHandler_UpdateMOH_InvalidBody(t *testing.T) {
 
 	assertStatus(t, rr, http.StatusBadRequest)
 }
+
+func TestCallHandler_Announce_NoSIP(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB, SIP: nil}
+	handler := NewCallHandler(deps)
+
+	body, _ := json.Marshal(AnnounceRequest{Prompt: "recording_notice"})
+	req := httptest.NewRequest(http.MethodPost, "/api/calls/test-call-id/announce", bytes.NewBuffer(body))
+	req = withURLParams(req, map[string]string{"callID": "test-call-id"})
+
+	rr := httptest.NewRecorder()
+	handler.Announce(rr, req)
+
+	assertStatus(t, rr, http.StatusNotFound)
+	assertErrorCode(t, rr, "NOT_FOUND")
+}
+
+func TestCallHandler_Announce_Invalid(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB, SIP: nil}
+	handler := NewCallHandler(deps)
+
+	tests := []struct {
+		name string
+		req  AnnounceRequest
+	}{
+		{"missing prompt", AnnounceRequest{}},
+		{"path in prompt", AnnounceRequest{Prompt: "../secrets"}},
+		{"invalid leg", AnnounceRequest{Prompt: "recording_notice", Leg: "everyone"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.req)
+			req := httptest.NewRequest(http.MethodPost, "/api/calls/test-call-id/announce", bytes.NewBuffer(body))
+			req = withURLParams(req, map[string]string{"callID": "test-call-id"})
+
+			rr := httptest.NewRecorder()
+			handler.Announce(rr, req)
+
+			assertStatus(t, rr, http.StatusBadRequest)
+		})
+	}
+}
+
+func TestCallHandler_ListAnnouncements_NoSIP(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB, SIP: nil}
+	handler := NewCallHandler(deps)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/calls/test-call-id/announcements", nil)
+	req = withURLParams(req, map[string]string{"callID": "test-call-id"})
+
+	rr := httptest.NewRecorder()
+	handler.ListAnnouncements(rr, req)
+
+	assertStatus(t, rr, http.StatusNotFound)
+}
+
+func TestCallHandler_Conference_NoSIP(t *testing.T) {
+	handler := NewCallHandler(&Dependencies{})
+	params := map[string]string{"callID": "test-call-id", "participantID": "p1"}
+
+	tests := []struct {
+		name    string
+		method  string
+		body    string
+		handler http.HandlerFunc
+	}{
+		{"get", http.MethodGet, "", handler.GetCallConference},
+		{"start", http.MethodPost, "", handler.StartCallConference},
+		{"invite", http.MethodPost, `{"target": "101"}`, handler.InviteConferenceParticipant},
+		{"mute", http.MethodPut, `{"muted": true}`, handler.UpdateConferenceParticipant},
+		{"kick", http.MethodDelete, "", handler.KickConferenceParticipant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := withURLParams(httptest.NewRequest(tt.method, "/api/calls/test-call-id/conference", bytes.NewBufferString(tt.body)), params)
+			rr := httptest.NewRecorder()
+			tt.handler(rr, req)
+
+			assertStatus(t, rr, http.StatusNotFound)
+			assertErrorCode(t, rr, "NOT_FOUND")
+		})
+	}
+}
+
+func TestCallHandler_Conference_Invalid(t *testing.T) {
+	handler := NewCallHandler(&Dependencies{})
+	params := map[string]string{"callID": "test-call-id", "participantID": "p1"}
+
+	tests := []struct {
+		name    string
+		body    string
+		handler http.HandlerFunc
+	}{
+		{"invite without target", `{"target": "  "}`, handler.InviteConferenceParticipant},
+		{"invite with invalid body", `{`, handler.InviteConferenceParticipant},
+		{"update without muted", `{}`, handler.UpdateConferenceParticipant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := withURLParams(httptest.NewRequest(http.MethodPost, "/api/calls/test-call-id/conference/participants", bytes.NewBufferString(tt.body)), params)
+			rr := httptest.NewRecorder()
+			tt.handler(rr, req)
+
+			assertStatus(t, rr, http.StatusBadRequest)
+			assertErrorCode(t, rr, ErrCodeValidation)
+		})
+	}
+}
+
+func TestCallHandler_SendDTMF(t *testing.T) {
+	handler := NewCallHandler(&Dependencies{})
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"no SIP server", `{"digits": "1234#"}`, http.StatusNotFound},
+		{"invalid body", `{`, http.StatusBadRequest},
+		{"missing digits", `{"digits": " "}`, http.StatusBadRequest},
+		{"invalid digits", `{"digits": "12x"}`, http.StatusBadRequest},
+		{"too many digits", `{"digits": "` + strings.Repeat("1", 33) + `"}`, http.StatusBadRequest},
+		{"invalid party", `{"digits": "1", "to": "everyone"}`, http.StatusBadRequest},
+		{"invalid method", `{"digits": "1", "method": "inband"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := withURLParams(httptest.NewRequest(http.MethodPost, "/api/calls/test-call-id/dtmf", bytes.NewBufferString(tt.body)), map[string]string{"callID": "test-call-id"})
+			rr := httptest.NewRecorder()
+			handler.SendDTMF(rr, req)
+
+			assertStatus(t, rr, tt.status)
+		})
+	}
+}
@@ -1,12 +1,16 @@
 package api
 
 import (
+	"encoding/json"
+	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/btafoya/gosip/internal/config"
 	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/reprocess"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -43,6 +47,7 @@ func (h *CDRHandler) List(w http.ResponseWriter, r *http.Request) {
 		Disposition: disposition,
 		Limit:       limit,
 		Offset:      offset,
+		TenantID:    tenantOf(r),
 	}
 
 	if didIDStr != "" {
@@ -52,6 +57,13 @@ func (h *CDRHandler) List(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if internalStr := r.URL.Query().Get("internal"); internalStr != "" {
+		internal, err := strconv.ParseBool(internalStr)
+		if err == nil {
+			filter.Internal = &internal
+		}
+	}
+
 	if startDateStr != "" {
 		startDate, err := time.Parse("2006-01-02", startDateStr)
 		if err == nil {
@@ -96,6 +108,10 @@ func (h *CDRHandler) Get(w http.ResponseWriter, r *http.Request) {
 		WriteInternalError(w)
 		return
 	}
+	if !visibleTo(r, cdr.TenantID) {
+		WriteNotFoundError(w, "CDR")
+		return
+	}
 
 	WriteJSON(w, http.StatusOK, cdr)
 }
@@ -143,3 +159,55 @@ func (h *CDRHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 		"by_disposition": stats,
 	})
 }
+
+// ReprocessCDRsRequest selects the CDRs to reprocess
+type ReprocessCDRsRequest struct {
+	StartDate string `json:"start_date,omitempty"` // YYYY-MM-DD
+	EndDate   string `json:"end_date,omitempty"`   // YYYY-MM-DD, inclusive
+	DryRun    *bool  `json:"dry_run,omitempty"`    // Defaults to true
+}
+
+// Reprocess recomputes the direction, internal flag and DID of historical
+// CDRs from the current DIDs and extensions. By default it only reports the
+// changes; dry_run false saves them.
+func (h *CDRHandler) Reprocess(w http.ResponseWriter, r *http.Request) {
+	var req ReprocessCDRsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	opts := reprocess.Options{DryRun: req.DryRun == nil || *req.DryRun}
+	var errs []FieldError
+	if req.StartDate != "" {
+		if start, err := time.Parse("2006-01-02", req.StartDate); err == nil {
+			opts.Since = &start
+		} else {
+			errs = append(errs, FieldError{Field: "start_date", Message: "Date must be YYYY-MM-DD"})
+		}
+	}
+	if req.EndDate != "" {
+		if end, err := time.Parse("2006-01-02", req.EndDate); err == nil {
+			// Include the entire end date
+			end = end.Add(24 * time.Hour)
+			opts.Until = &end
+		} else {
+			errs = append(errs, FieldError{Field: "end_date", Message: "Date must be YYYY-MM-DD"})
+		}
+	}
+	if len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	report, err := reprocess.Run(r.Context(), h.deps.DB, opts)
+	if err != nil {
+		slog.Error("Failed to reprocess CDRs", "error", err)
+		WriteInternalError(w)
+		return
+	}
+	if !report.DryRun {
+		slog.Info("Reprocessed CDRs", "scanned", report.Scanned, "changed", report.Changed)
+	}
+	WriteJSON(w, http.StatusOK, report)
+}
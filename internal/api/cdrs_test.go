@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/btafoya/gosip/internal/models"
@@ -306,3 +307,47 @@ func TestCDRHandler_List_FilterByDisposition(t *testing.T) {
 		t.Errorf("Expected 1 answered CDR, got %d", total)
 	}
 }
+
+func TestCDRHandler_Reprocess(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewCDRHandler(&Dependencies{DB: setup.DB})
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	misfiled := createTestCDR(t, setup.DB, did.ID, "outbound", "+15559876543", "(555) 123-4567")
+	createTestCDR(t, setup.DB, did.ID, "inbound", "+15559876543", did.Number)
+
+	reprocess := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.Reprocess(rr, httptest.NewRequest(http.MethodPost, "/api/cdrs/reprocess", strings.NewReader(body)))
+		return rr
+	}
+
+	assertStatus(t, reprocess(`{"start_date": "yesterday"}`), http.StatusBadRequest)
+
+	rr := reprocess(``)
+	assertStatus(t, rr, http.StatusOK)
+	var report struct {
+		DryRun  bool `json:"dry_run"`
+		Scanned int  `json:"scanned"`
+		Changed int  `json:"changed"`
+		CDRs    []struct {
+			CDRID   int64 `json:"cdr_id"`
+			Changes []struct {
+				Field, Old, New string
+			} `json:"changes"`
+		} `json:"cdrs"`
+	}
+	decodeResponse(t, rr, &report)
+	if !report.DryRun || report.Scanned != 2 || report.Changed != 1 || report.CDRs[0].CDRID != misfiled.ID ||
+		report.CDRs[0].Changes[0].Field != "direction" || report.CDRs[0].Changes[0].New != "inbound" {
+		t.Fatalf("Unexpected dry run report %+v", report)
+	}
+	if cdr, _ := setup.DB.CDRs.GetByID(context.Background(), misfiled.ID); cdr.Direction != "outbound" {
+		t.Error("Expected a dry run to leave the CDR alone")
+	}
+
+	assertStatus(t, reprocess(`{"dry_run": false}`), http.StatusOK)
+	if cdr, _ := setup.DB.CDRs.GetByID(context.Background(), misfiled.ID); cdr.Direction != "inbound" {
+		t.Errorf("Expected the CDR reclassified, got %q", cdr.Direction)
+	}
+}
@@ -0,0 +1,320 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/i18n"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// ChangeSetHandler handles scheduled change set API endpoints
+type ChangeSetHandler struct {
+	deps *Dependencies
+}
+
+// NewChangeSetHandler creates a new ChangeSetHandler
+func NewChangeSetHandler(deps *Dependencies) *ChangeSetHandler {
+	return &ChangeSetHandler{deps: deps}
+}
+
+// stagedSettings are the settings a change set may change, with a check of
+// their values. They take effect without a restart.
+var stagedSettings = map[string]func(string) bool{
+	"timezone":                   func(v string) bool { return v != "" && validTimezone(v) },
+	"default_language":           i18n.IsSupported,
+	"voicemail_greeting":         func(v string) bool { return v != "" },
+	"anonymous_challenge_prompt": func(v string) bool { return v != "" },
+}
+
+// ChangeRequest is one change of a change set request
+type ChangeRequest struct {
+	// Type is "setting", "route_create", "route_update" or "route_delete"
+	Type    string              `json:"type"`
+	Key     string              `json:"key,omitempty"`
+	Value   *string             `json:"value,omitempty"`
+	RouteID int64               `json:"route_id,omitempty"`
+	Route   *CreateRouteRequest `json:"route,omitempty"` // The whole route, for route_create and route_update
+}
+
+// CreateChangeSetRequest represents a change set scheduling request
+type CreateChangeSetRequest struct {
+	Name     string          `json:"name"`
+	ApplyAt  time.Time       `json:"apply_at"`
+	RevertAt *time.Time      `json:"revert_at,omitempty"`
+	Changes  []ChangeRequest `json:"changes"`
+}
+
+// ChangePreview compares a change with the current configuration
+type ChangePreview struct {
+	Type    string             `json:"type"`
+	Key     string             `json:"key,omitempty"`
+	RouteID int64              `json:"route_id,omitempty"`
+	Current interface{}        `json:"current"` // Current value or route; null when there is none
+	New     interface{}        `json:"new"`     // Value or route after the change; null when removed
+	Diff    []RouteFieldChange `json:"diff,omitempty"`
+	Warning string             `json:"warning,omitempty"` // Why the change would fail now
+}
+
+// List returns all change sets
+func (h *ChangeSetHandler) List(w http.ResponseWriter, r *http.Request) {
+	sets, err := h.deps.DB.ChangeSets.List(r.Context())
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if sets == nil {
+		sets = []*models.ChangeSet{}
+	}
+
+	WriteJSON(w, http.StatusOK, sets)
+}
+
+// Create schedules a change set
+func (h *ChangeSetHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req CreateChangeSetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	ctx := r.Context()
+	var fieldErrors []FieldError
+	if req.Name == "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "name", Message: "Name is required"})
+	}
+	if !req.ApplyAt.After(time.Now()) {
+		fieldErrors = append(fieldErrors, FieldError{Field: "apply_at", Message: "Apply time must be in the future"})
+	}
+	if req.RevertAt != nil && !req.RevertAt.After(req.ApplyAt) {
+		fieldErrors = append(fieldErrors, FieldError{Field: "revert_at", Message: "Revert time must be after the apply time"})
+	}
+	if len(req.Changes) == 0 || len(req.Changes) > config.ChangeSetMaxChanges {
+		fieldErrors = append(fieldErrors, FieldError{Field: "changes", Message: fmt.Sprintf("A change set needs 1-%d changes", config.ChangeSetMaxChanges)})
+	}
+
+	changes := make([]models.Change, 0, len(req.Changes))
+	for i, c := range req.Changes {
+		change, errs := h.validateChange(ctx, c, fmt.Sprintf("changes[%d].", i))
+		fieldErrors = append(fieldErrors, errs...)
+		changes = append(changes, change)
+	}
+	if len(fieldErrors) > 0 {
+		WriteValidationError(w, "Validation failed", fieldErrors)
+		return
+	}
+
+	cs := &models.ChangeSet{
+		Name:     req.Name,
+		Changes:  changes,
+		ApplyAt:  req.ApplyAt,
+		RevertAt: req.RevertAt,
+	}
+	if user := GetUserFromContext(ctx); user != nil {
+		cs.UserID = &user.ID
+	}
+	if err := h.deps.DB.ChangeSets.Create(ctx, cs); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, cs)
+}
+
+// validateChange checks one requested change and converts it for storage
+func (h *ChangeSetHandler) validateChange(ctx context.Context, c ChangeRequest, prefix string) (models.Change, []FieldError) {
+	change := models.Change{Type: c.Type, Key: c.Key, Value: c.Value, RouteID: c.RouteID}
+	var errs []FieldError
+
+	switch c.Type {
+	case db.ChangeSetting:
+		valid, ok := stagedSettings[c.Key]
+		if !ok {
+			errs = append(errs, FieldError{Field: prefix + "key", Message: "Setting can't be scheduled"})
+		} else if _, pinned := h.pinnedSettings()[c.Key]; pinned {
+			errs = append(errs, FieldError{Field: prefix + "key", Message: "Setting is set by the config file or environment"})
+		} else if c.Value == nil || !valid(*c.Value) {
+			errs = append(errs, FieldError{Field: prefix + "value", Message: "Invalid value for " + c.Key})
+		}
+
+	case db.ChangeRouteCreate, db.ChangeRouteUpdate:
+		if c.Route == nil {
+			errs = append(errs, FieldError{Field: prefix + "route", Message: "Route is required"})
+			break
+		}
+		errs = append(errs, routeFieldErrors(ctx, h.deps, c.Route, prefix+"route.")...)
+		change.Route = &models.Route{
+			DIDID:         c.Route.DIDID,
+			Priority:      c.Route.Priority,
+			Name:          c.Route.Name,
+			ConditionType: c.Route.ConditionType,
+			ConditionData: c.Route.ConditionData,
+			ActionType:    c.Route.ActionType,
+			ActionData:    c.Route.ActionData,
+			Enabled:       c.Route.Enabled,
+		}
+		if c.Type == db.ChangeRouteCreate {
+			change.RouteID = 0
+			break
+		}
+		change.Route.ID = c.RouteID
+		fallthrough
+
+	case db.ChangeRouteDelete:
+		if _, err := h.deps.DB.Routes.GetByID(ctx, c.RouteID); err != nil {
+			errs = append(errs, FieldError{Field: prefix + "route_id", Message: "Must be the ID of an existing route"})
+		}
+
+	default:
+		errs = append(errs, FieldError{Field: prefix + "type", Message: "Type must be setting, route_create, route_update or route_delete"})
+	}
+	return change, errs
+}
+
+func (h *ChangeSetHandler) pinnedSettings() map[string]config.Setting {
+	if h.deps.Config == nil {
+		return nil
+	}
+	return h.deps.Config.PinnedSettings()
+}
+
+// Get returns a change set
+func (h *ChangeSetHandler) Get(w http.ResponseWriter, r *http.Request) {
+	cs, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	WriteJSON(w, http.StatusOK, cs)
+}
+
+// Preview compares each change of a change set with the current settings
+// and routes
+func (h *ChangeSetHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	cs, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	previews := make([]ChangePreview, len(cs.Changes))
+	for i, c := range cs.Changes {
+		p := ChangePreview{Type: c.Type, Key: c.Key, RouteID: c.RouteID}
+		switch c.Type {
+		case db.ChangeSetting:
+			if value, err := h.deps.DB.Config.Get(ctx, c.Key); err == nil {
+				p.Current = value
+			}
+			if c.Value != nil {
+				p.New = *c.Value
+			}
+
+		case db.ChangeRouteCreate:
+			p.New = toRouteResponse(c.Route)
+
+		case db.ChangeRouteUpdate, db.ChangeRouteDelete:
+			current, err := h.deps.DB.Routes.GetByID(ctx, c.RouteID)
+			if err != nil {
+				p.Warning = "The route no longer exists"
+				if c.Type == db.ChangeRouteUpdate {
+					p.New = toRouteResponse(c.Route)
+				}
+				break
+			}
+			p.Current = toRouteResponse(current)
+			if c.Type == db.ChangeRouteUpdate {
+				p.New = toRouteResponse(c.Route)
+				p.Diff = routeDiff(current, c.Route)
+			}
+		}
+		previews[i] = p
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"data": previews})
+}
+
+// Apply applies a pending change set now instead of at its apply time
+func (h *ChangeSetHandler) Apply(w http.ResponseWriter, r *http.Request) {
+	h.run(w, r, h.deps.DB.ChangeSets.Apply)
+}
+
+// Revert undoes an applied change set now
+func (h *ChangeSetHandler) Revert(w http.ResponseWriter, r *http.Request) {
+	h.run(w, r, h.deps.DB.ChangeSets.Revert)
+}
+
+func (h *ChangeSetHandler) run(w http.ResponseWriter, r *http.Request, fn func(context.Context, int64, time.Time) error) {
+	cs, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	if err := fn(r.Context(), cs.ID, time.Now()); err != nil {
+		if errors.Is(err, db.ErrChangeSetState) {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "Change set is "+cs.Status, nil)
+			return
+		}
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "Change set failed: "+err.Error(), nil)
+		return
+	}
+
+	cs, err := h.deps.DB.ChangeSets.GetByID(r.Context(), cs.ID)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	WriteJSON(w, http.StatusOK, cs)
+}
+
+// Cancel stops a pending change set from being applied, or an applied one
+// from being reverted at its revert time
+func (h *ChangeSetHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	cs, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.deps.DB.ChangeSets.Cancel(r.Context(), cs.ID); err != nil {
+		if errors.Is(err, db.ErrChangeSetState) {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "Change set is "+cs.Status+" and has nothing left to cancel", nil)
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	cs, err := h.deps.DB.ChangeSets.GetByID(r.Context(), cs.ID)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	WriteJSON(w, http.StatusOK, cs)
+}
+
+// load reads the change set named in the URL, writing an error response
+// when there is none
+func (h *ChangeSetHandler) load(w http.ResponseWriter, r *http.Request) (*models.ChangeSet, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid change set ID", nil)
+		return nil, false
+	}
+
+	cs, err := h.deps.DB.ChangeSets.GetByID(r.Context(), id)
+	if err != nil {
+		if err == db.ErrChangeSetNotFound {
+			WriteNotFoundError(w, "Change set")
+			return nil, false
+		}
+		WriteInternalError(w)
+		return nil, false
+	}
+	return cs, true
+}
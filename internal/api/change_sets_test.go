@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestChangeSetHandler(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewChangeSetHandler(&Dependencies{DB: setup.DB})
+	admin := createTestUser(t, setup.DB, "admin@example.com", "password123", "admin")
+	did := createTestDID(t, setup.DB, "+15551234567")
+	route := createTestRoute(t, setup, "Main", &did.ID)
+
+	send := func(method string, body interface{}, params map[string]string, fn http.HandlerFunc) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, "/api/change-sets", bytes.NewReader(data))
+		req = withURLParams(req, params)
+		req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, admin))
+		rr := httptest.NewRecorder()
+		fn(rr, req)
+		return rr
+	}
+
+	tz := "America/New_York"
+	rr := send(http.MethodPost, CreateChangeSetRequest{
+		Name:    "Move to the east coast",
+		ApplyAt: time.Now().Add(time.Hour),
+		Changes: []ChangeRequest{
+			{Type: "setting", Key: "timezone", Value: &tz},
+			{Type: "route_update", RouteID: route.ID, Route: &CreateRouteRequest{
+				DIDID: &did.ID, Priority: 1, Name: "Main", ConditionType: "default", ActionType: "reject", Enabled: true,
+			}},
+		},
+	}, nil, handler.Create)
+	assertStatus(t, rr, http.StatusCreated)
+	var cs models.ChangeSet
+	decodeResponse(t, rr, &cs)
+	if cs.Status != db.ChangeSetPending || cs.UserID == nil || *cs.UserID != admin.ID {
+		t.Errorf("Created change set = %+v", cs)
+	}
+	id := map[string]string{"id": strconv.FormatInt(cs.ID, 10)}
+
+	rr = send(http.MethodGet, nil, id, handler.Preview)
+	assertStatus(t, rr, http.StatusOK)
+	var preview struct {
+		Data []ChangePreview `json:"data"`
+	}
+	decodeResponse(t, rr, &preview)
+	if len(preview.Data) != 2 || preview.Data[0].New != tz {
+		t.Fatalf("Preview = %+v", preview.Data)
+	}
+	if diff := preview.Data[1].Diff; len(diff) != 1 || diff[0].Field != "action_type" {
+		t.Errorf("Route diff = %+v", diff)
+	}
+
+	rr = send(http.MethodPost, nil, id, handler.Apply)
+	assertStatus(t, rr, http.StatusOK)
+	if r, _ := setup.DB.Routes.GetByID(context.Background(), route.ID); r.ActionType != "reject" {
+		t.Errorf("Route action = %q after apply", r.ActionType)
+	}
+	assertStatus(t, send(http.MethodPost, nil, id, handler.Apply), http.StatusConflict)
+
+	rr = send(http.MethodPost, nil, id, handler.Revert)
+	assertStatus(t, rr, http.StatusOK)
+	decodeResponse(t, rr, &cs)
+	if cs.Status != db.ChangeSetReverted {
+		t.Errorf("Status = %q after revert", cs.Status)
+	}
+	if r, _ := setup.DB.Routes.GetByID(context.Background(), route.ID); r.ActionType != route.ActionType {
+		t.Errorf("Route action = %q after revert, want %q", r.ActionType, route.ActionType)
+	}
+	assertStatus(t, send(http.MethodDelete, nil, id, handler.Cancel), http.StatusConflict)
+}
+
+func TestChangeSetHandler_Create_Validation(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewChangeSetHandler(&Dependencies{DB: setup.DB})
+
+	bad := "Mars/Olympus"
+	revertAt := time.Now()
+	data, _ := json.Marshal(CreateChangeSetRequest{
+		Name:     "Bad",
+		ApplyAt:  time.Now().Add(time.Hour),
+		RevertAt: &revertAt,
+		Changes: []ChangeRequest{
+			{Type: "setting", Key: "timezone", Value: &bad},
+			{Type: "setting", Key: "sip_password", Value: &bad},
+			{Type: "route_delete", RouteID: 999},
+			{Type: "route_restore"},
+		},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/change-sets", bytes.NewReader(data))
+	rr := httptest.NewRecorder()
+	handler.Create(rr, req)
+	assertStatus(t, rr, http.StatusBadRequest)
+
+	var resp ErrorResponse
+	decodeResponse(t, rr, &resp)
+	fields := map[string]bool{}
+	for _, f := range resp.Error.Details {
+		fields[f.Field] = true
+	}
+	for _, want := range []string{"revert_at", "changes[0].value", "changes[1].key", "changes[2].route_id", "changes[3].type"} {
+		if !fields[want] {
+			t.Errorf("Missing error for %s in %+v", want, resp.Error.Details)
+		}
+	}
+}
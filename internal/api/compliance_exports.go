@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/btafoya/gosip/internal/compliance"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// ComplianceExportHandler handles signed exports of calls and messages for
+// record keeping
+type ComplianceExportHandler struct {
+	deps *Dependencies
+}
+
+// NewComplianceExportHandler creates a new ComplianceExportHandler
+func NewComplianceExportHandler(deps *Dependencies) *ComplianceExportHandler {
+	return &ComplianceExportHandler{deps: deps}
+}
+
+// CreateComplianceExportRequest selects the date range to export
+type CreateComplianceExportRequest struct {
+	RangeStart string `json:"range_start"` // RFC 3339, inclusive
+	RangeEnd   string `json:"range_end"`   // RFC 3339, exclusive
+}
+
+// ComplianceVerifyResponse reports whether an export is intact
+type ComplianceVerifyResponse struct {
+	Valid        bool                     `json:"valid"`
+	Error        string                   `json:"error,omitempty"`
+	Verification *compliance.Verification `json:"verification,omitempty"`
+}
+
+// available writes an error and returns false when the exporter isn't
+// running
+func (h *ComplianceExportHandler) available(w http.ResponseWriter) bool {
+	if h.deps.ComplianceExports == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Compliance exports are not available", nil)
+		return false
+	}
+	return true
+}
+
+// export loads the export named in the URL, writing an error when it can't
+func (h *ComplianceExportHandler) export(w http.ResponseWriter, r *http.Request) (*models.ComplianceExport, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid export ID", nil)
+		return nil, false
+	}
+	export, err := h.deps.DB.ComplianceExports.GetByID(r.Context(), id)
+	if err != nil {
+		if err == db.ErrComplianceExportNotFound {
+			WriteNotFoundError(w, "Compliance export")
+			return nil, false
+		}
+		WriteInternalError(w)
+		return nil, false
+	}
+	return export, true
+}
+
+// complete writes an error and returns false unless the export was written
+func (h *ComplianceExportHandler) complete(w http.ResponseWriter, export *models.ComplianceExport) bool {
+	if export.Status != db.ComplianceExportComplete {
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "The export is "+export.Status, nil)
+		return false
+	}
+	return true
+}
+
+// Create queues an export of the calls and messages in a date range (admin
+// only)
+func (h *ComplianceExportHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	var req CreateComplianceExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	var errs []FieldError
+	start, err := time.Parse(time.RFC3339, req.RangeStart)
+	if err != nil {
+		errs = append(errs, FieldError{Field: "range_start", Message: "An RFC 3339 time is required"})
+	}
+	end, err := time.Parse(time.RFC3339, req.RangeEnd)
+	if err != nil {
+		errs = append(errs, FieldError{Field: "range_end", Message: "An RFC 3339 time is required"})
+	}
+	if len(errs) == 0 {
+		if !start.Before(end) {
+			errs = append(errs, FieldError{Field: "range_end", Message: "Range end must be after range start"})
+		} else if end.After(time.Now()) {
+			// Records could still be added to a range that hasn't ended
+			errs = append(errs, FieldError{Field: "range_end", Message: "Range end can't be in the future"})
+		}
+	}
+	if len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	var requestedBy *int64
+	if user := GetUserFromContext(r.Context()); user != nil {
+		requestedBy = &user.ID
+	}
+	export, err := h.deps.ComplianceExports.Request(r.Context(), start, end, requestedBy)
+	if err != nil {
+		slog.Error("Failed to queue compliance export", "error", err)
+		WriteInternalError(w)
+		return
+	}
+	slog.Info("Compliance export requested", "export_id", export.ID, "range_start", export.RangeStart, "range_end", export.RangeEnd)
+	WriteJSON(w, http.StatusAccepted, export)
+}
+
+// List returns every export, newest first (admin only)
+func (h *ComplianceExportHandler) List(w http.ResponseWriter, r *http.Request) {
+	exports, err := h.deps.DB.ComplianceExports.List(r.Context())
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if exports == nil {
+		exports = []*models.ComplianceExport{}
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"data": exports})
+}
+
+// Get returns one export (admin only)
+func (h *ComplianceExportHandler) Get(w http.ResponseWriter, r *http.Request) {
+	export, ok := h.export(w, r)
+	if !ok {
+		return
+	}
+	WriteJSON(w, http.StatusOK, export)
+}
+
+// Download streams a written export's JSONL file (admin only)
+func (h *ComplianceExportHandler) Download(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	export, ok := h.export(w, r)
+	if !ok || !h.complete(w, export) {
+		return
+	}
+
+	f, err := os.Open(h.deps.ComplianceExports.Path(export))
+	if err != nil {
+		slog.Error("Failed to open compliance export", "error", err, "export_id", export.ID)
+		WriteInternalError(w)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.FileName))
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, f)
+}
+
+// Verify checks a written export's file against the signing key and the
+// hashes recorded when it was written (admin only)
+func (h *ComplianceExportHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	export, ok := h.export(w, r)
+	if !ok || !h.complete(w, export) {
+		return
+	}
+
+	v, err := h.deps.ComplianceExports.VerifyExport(r.Context(), export)
+	if err != nil {
+		slog.Warn("Compliance export failed verification", "error", err, "export_id", export.ID)
+		WriteJSON(w, http.StatusOK, ComplianceVerifyResponse{Error: err.Error()})
+		return
+	}
+	WriteJSON(w, http.StatusOK, ComplianceVerifyResponse{Valid: true, Verification: v})
+}
+
+// PublicKey returns the key exports are signed with, for checking them
+// away from this server (admin only)
+func (h *ComplianceExportHandler) PublicKey(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	key, err := h.deps.ComplianceExports.PublicKey(r.Context())
+	if err != nil {
+		slog.Error("Failed to load compliance signing key", "error", err)
+		WriteInternalError(w)
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]string{
+		"algorithm":  "ed25519",
+		"public_key": base64.StdEncoding.EncodeToString(key),
+	})
+}
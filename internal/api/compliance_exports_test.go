@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/compliance"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestComplianceExportHandler_Unavailable(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewComplianceExportHandler(&Dependencies{DB: setup.DB})
+
+	rr := httptest.NewRecorder()
+	handler.Create(rr, httptest.NewRequest(http.MethodPost, "/api/system/compliance-exports", nil))
+	assertStatus(t, rr, http.StatusServiceUnavailable)
+}
+
+func TestComplianceExportHandler(t *testing.T) {
+	setup := setupTestAPI(t)
+	ctx := context.Background()
+	exporter := compliance.NewExporter(&config.Config{DataDir: t.TempDir()}, setup.DB)
+	handler := NewComplianceExportHandler(&Dependencies{DB: setup.DB, ComplianceExports: exporter})
+	admin := createTestUser(t, setup.DB, "admin@example.com", "password123", "admin")
+
+	start := time.Now().Add(-2 * time.Hour)
+	setup.DB.CDRs.Create(ctx, &models.CDR{CallSID: "CA1", Direction: "inbound", FromNumber: "+15551234567",
+		ToNumber: "+15559876543", StartedAt: start.Add(time.Minute), Disposition: "answered"})
+
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/system/compliance-exports", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, admin))
+		rr := httptest.NewRecorder()
+		handler.Create(rr, req)
+		return rr
+	}
+
+	assertStatus(t, create(`{"range_start": "yesterday", "range_end": "today"}`), http.StatusBadRequest)
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	assertStatus(t, create(`{"range_start": "`+start.Format(time.RFC3339)+`", "range_end": "`+future+`"}`), http.StatusBadRequest)
+
+	end := time.Now().Add(-time.Minute).Format(time.RFC3339)
+	rr := create(`{"range_start": "` + start.Format(time.RFC3339) + `", "range_end": "` + end + `"}`)
+	assertStatus(t, rr, http.StatusAccepted)
+	var export models.ComplianceExport
+	decodeResponse(t, rr, &export)
+	if export.Status != db.ComplianceExportPending || export.RequestedBy == nil || *export.RequestedBy != admin.ID {
+		t.Fatalf("Unexpected export %+v", export)
+	}
+	id := map[string]string{"id": "1"}
+
+	// Nothing to download until the export is written
+	rr = httptest.NewRecorder()
+	handler.Download(rr, withURLParams(httptest.NewRequest(http.MethodGet, "/api/system/compliance-exports/1/download", nil), id))
+	assertStatus(t, rr, http.StatusConflict)
+
+	exporter.RunPending(ctx)
+
+	rr = httptest.NewRecorder()
+	handler.Download(rr, withURLParams(httptest.NewRequest(http.MethodGet, "/api/system/compliance-exports/1/download", nil), id))
+	assertStatus(t, rr, http.StatusOK)
+	if !strings.HasPrefix(rr.Header().Get("Content-Disposition"), `attachment; filename="compliance-000001-`) {
+		t.Errorf("Expected an attachment, got %q", rr.Header().Get("Content-Disposition"))
+	}
+	file := rr.Body.Bytes()
+
+	// The download verifies with the published key
+	rr = httptest.NewRecorder()
+	handler.PublicKey(rr, httptest.NewRequest(http.MethodGet, "/api/system/compliance-exports/public-key", nil))
+	assertStatus(t, rr, http.StatusOK)
+	var keyResp map[string]string
+	decodeResponse(t, rr, &keyResp)
+	key, err := base64.StdEncoding.DecodeString(keyResp["public_key"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := compliance.Verify(strings.NewReader(string(file)), ed25519.PublicKey(key))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if v.Calls != 1 || v.Messages != 0 {
+		t.Errorf("Unexpected verification %+v", v)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.Verify(rr, withURLParams(httptest.NewRequest(http.MethodPost, "/api/system/compliance-exports/1/verify", nil), id))
+	assertStatus(t, rr, http.StatusOK)
+	var verifyResp ComplianceVerifyResponse
+	decodeResponse(t, rr, &verifyResp)
+	if !verifyResp.Valid {
+		t.Errorf("Expected the export valid, got %+v", verifyResp)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.Get(rr, withURLParams(httptest.NewRequest(http.MethodGet, "/api/system/compliance-exports/2", nil), map[string]string{"id": "2"}))
+	assertStatus(t, rr, http.StatusNotFound)
+}
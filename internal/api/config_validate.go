@@ -0,0 +1,253 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+)
+
+// Severities of configuration problems
+const (
+	ConfigProblemError   = "error"   // Saving the change would be refused or break a service
+	ConfigProblemWarning = "warning" // The change can be saved but may not work yet
+)
+
+// ValidateConfigRequest is a proposed configuration change: the fields of
+// a configuration update and, optionally, of a TLS configuration update
+type ValidateConfigRequest struct {
+	UpdateConfigRequest
+	TLS *TLSConfigRequest `json:"tls,omitempty"`
+}
+
+// ConfigProblem is one problem found with a proposed configuration change
+type ConfigProblem struct {
+	Field    string `json:"field"` // TLS fields are prefixed with "tls."
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// ConfigValidationResponse lists the problems found with a proposed
+// configuration change
+type ConfigValidationResponse struct {
+	Valid    bool            `json:"valid"` // No errors; warnings don't stop the change being saved
+	Problems []ConfigProblem `json:"problems"`
+}
+
+// ValidateConfig checks a proposed configuration change without applying
+// it, so risky changes such as TLS reconfiguration can be pre-flighted.
+// Besides the checks done when saving, it looks for port conflicts,
+// missing certificate files and an unreachable SMTP server.
+// POST /api/system/config/validate
+func (h *SystemHandler) ValidateConfig(w http.ResponseWriter, r *http.Request) {
+	var req ValidateConfigRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	ctx := r.Context()
+	response := ConfigValidationResponse{Problems: []ConfigProblem{}}
+	invalid := make(map[string]bool)
+	for _, e := range req.validate() {
+		response.Problems = append(response.Problems, ConfigProblem{Field: e.Field, Severity: ConfigProblemError, Message: e.Message})
+		invalid[e.Field] = true
+	}
+	if req.TLS != nil {
+		for _, e := range req.TLS.validate() {
+			field := "tls." + e.Field
+			response.Problems = append(response.Problems, ConfigProblem{Field: field, Severity: ConfigProblemError, Message: e.Message})
+			invalid[field] = true
+		}
+		response.Problems = append(response.Problems, h.checkPorts(ctx, req.TLS, invalid)...)
+		response.Problems = append(response.Problems, h.checkCertificates(ctx, req.TLS)...)
+	}
+	if !invalid["smtp_port"] {
+		response.Problems = append(response.Problems, h.checkSMTP(ctx, &req.UpdateConfigRequest)...)
+	}
+
+	response.Valid = true
+	for _, p := range response.Problems {
+		if p.Severity == ConfigProblemError {
+			response.Valid = false
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, response)
+}
+
+// checkPorts reports proposed TLS ports that another GoSIP service already
+// listens on, or that can't be opened
+func (h *SystemHandler) checkPorts(ctx context.Context, req *TLSConfigRequest, invalid map[string]bool) []ConfigProblem {
+	type service struct {
+		name string
+		port int
+	}
+	var services []service
+	tlsPort, wssPort := config.DefaultTLSPort, config.DefaultWSSPort
+	if cfg := h.deps.Config; cfg != nil {
+		services = append(services, service{"SIP", cfg.SIPPort}, service{"the web server", cfg.HTTPPort},
+			service{"the TFTP responder", cfg.TFTPPort}, service{"the email gateway", cfg.MailGatewayPort})
+		if cfg.TLS != nil && cfg.TLS.Port > 0 {
+			tlsPort = cfg.TLS.Port
+		}
+		if cfg.TLS != nil && cfg.TLS.WSSPort > 0 {
+			wssPort = cfg.TLS.WSSPort
+		}
+	}
+	if port, err := strconv.Atoi(h.deps.DB.Config.GetWithDefault(ctx, db.ConfigKeyTLSPort, "")); err == nil {
+		tlsPort = port
+	}
+	if port, err := strconv.Atoi(h.deps.DB.Config.GetWithDefault(ctx, db.ConfigKeyTLSWSSPort, "")); err == nil {
+		wssPort = port
+	}
+
+	proposed := map[string]*int{"tls.port": req.Port, "tls.wss_port": req.WSSPort}
+	current := map[string]int{"tls.port": tlsPort, "tls.wss_port": wssPort}
+	names := map[string]string{"tls.port": "SIPS", "tls.wss_port": "WebSocket Secure"}
+
+	var problems []ConfigProblem
+	for _, field := range []string{"tls.port", "tls.wss_port"} {
+		port := proposed[field]
+		if port == nil || *port <= 0 || invalid[field] {
+			continue
+		}
+		others := services
+		for other, name := range names {
+			if other == field {
+				continue
+			}
+			if p := proposed[other]; p != nil && *p > 0 {
+				others = append(others, service{name, *p})
+			} else {
+				others = append(others, service{name, current[other]})
+			}
+		}
+
+		conflict := ""
+		for _, s := range others {
+			if s.port == *port {
+				conflict = s.name
+				break
+			}
+		}
+		switch {
+		case conflict != "":
+			problems = append(problems, ConfigProblem{Field: field, Severity: ConfigProblemError,
+				Message: fmt.Sprintf("Port %d is already used by %s", *port, conflict)})
+		case *port != current[field]:
+			// A port GoSIP doesn't hold yet may be taken by another program
+			ln, err := net.Listen("tcp", ":"+strconv.Itoa(*port))
+			if err != nil {
+				problems = append(problems, ConfigProblem{Field: field, Severity: ConfigProblemWarning,
+					Message: fmt.Sprintf("Port %d can't be opened: %v", *port, err)})
+				continue
+			}
+			ln.Close()
+		}
+	}
+	return problems
+}
+
+// checkCertificates reports proposed certificate files that are missing,
+// a certificate and key that don't belong together, and manual
+// certificates turned on without them
+func (h *SystemHandler) checkCertificates(ctx context.Context, req *TLSConfigRequest) []ConfigProblem {
+	var fileCert, fileKey, fileMode string
+	fileEnabled := false
+	if cfg := h.deps.Config; cfg != nil && cfg.TLS != nil {
+		fileCert, fileKey, fileMode, fileEnabled = cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.CertMode, cfg.TLS.Enabled
+	}
+
+	var problems []ConfigProblem
+	missing := false
+	for _, f := range []struct{ field, path string }{
+		{"tls.cert_file", req.CertFile},
+		{"tls.key_file", req.KeyFile},
+		{"tls.ca_file", req.CAFile},
+	} {
+		if f.path == "" {
+			continue
+		}
+		info, err := os.Stat(f.path)
+		switch {
+		case os.IsNotExist(err):
+			problems = append(problems, ConfigProblem{Field: f.field, Severity: ConfigProblemError, Message: "File not found: " + f.path})
+		case err != nil:
+			problems = append(problems, ConfigProblem{Field: f.field, Severity: ConfigProblemError, Message: "File can't be read: " + err.Error()})
+		case info.IsDir():
+			problems = append(problems, ConfigProblem{Field: f.field, Severity: ConfigProblemError, Message: "Path is a directory: " + f.path})
+		default:
+			continue
+		}
+		missing = true
+	}
+
+	certFile, keyFile := req.CertFile, req.KeyFile
+	if certFile == "" {
+		certFile = h.deps.DB.Config.GetWithDefault(ctx, db.ConfigKeyTLSCertFile, fileCert)
+	}
+	if keyFile == "" {
+		keyFile = h.deps.DB.Config.GetWithDefault(ctx, db.ConfigKeyTLSKeyFile, fileKey)
+	}
+	if !missing && (req.CertFile != "" || req.KeyFile != "") && certFile != "" && keyFile != "" {
+		if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			problems = append(problems, ConfigProblem{Field: "tls.cert_file", Severity: ConfigProblemError,
+				Message: "Certificate and key can't be loaded: " + err.Error()})
+		}
+	}
+
+	mode := req.CertMode
+	if mode == "" {
+		mode = h.deps.DB.Config.GetWithDefault(ctx, db.ConfigKeyTLSCertMode, fileMode)
+	}
+	enabled := fileEnabled
+	if stored, err := strconv.ParseBool(h.deps.DB.Config.GetWithDefault(ctx, db.ConfigKeyTLSEnabled, "")); err == nil {
+		enabled = stored
+	}
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	if enabled && mode == "manual" && (certFile == "" || keyFile == "") {
+		problems = append(problems, ConfigProblem{Field: "tls.cert_file", Severity: ConfigProblemError,
+			Message: "Manual certificates need a certificate and key file"})
+	}
+	return problems
+}
+
+// checkSMTP reports a proposed SMTP server that can't be connected to
+func (h *SystemHandler) checkSMTP(ctx context.Context, req *UpdateConfigRequest) []ConfigProblem {
+	if req.SMTPHost == "" && req.SMTPPort == 0 {
+		return nil
+	}
+	host := req.SMTPHost
+	if host == "" {
+		host = h.deps.DB.Config.GetWithDefault(ctx, "smtp_host", "")
+	}
+	if host == "" {
+		return nil
+	}
+	port := req.SMTPPort
+	if port == 0 {
+		port = 587
+		if stored, err := strconv.Atoi(h.deps.DB.Config.GetWithDefault(ctx, "smtp_port", "")); err == nil {
+			port = stored
+		}
+	}
+
+	dialer := net.Dialer{Timeout: config.ConfigCheckTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return []ConfigProblem{{Field: "smtp_host", Severity: ConfigProblemWarning,
+			Message: fmt.Sprintf("SMTP server %s:%d can't be reached: %v", host, port, err)}}
+	}
+	conn.Close()
+	return nil
+}
@@ -0,0 +1,283 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/go-chi/cors"
+)
+
+// CORS policy sources
+const (
+	CORSSourceEnvironment = "environment" // GOSIP_CORS_ORIGINS
+	CORSSourceSettings    = "settings"    // Set through the system API
+)
+
+// CORSOverride applies its own origins and credentials mode to the routes
+// under a path prefix, such as a click-to-call endpoint embedded on another
+// site
+type CORSOverride struct {
+	PathPrefix       string   `json:"path_prefix"`
+	Origins          []string `json:"origins"`
+	AllowCredentials bool     `json:"allow_credentials"`
+}
+
+// CORSPolicy is the cross-origin policy for the API. Origins are full
+// origins such as https://pbx.example.com, may use one * wildcard, or are
+// "*" for any origin. An empty list allows no other origins.
+type CORSPolicy struct {
+	Origins          []string       `json:"origins"`
+	AllowCredentials bool           `json:"allow_credentials"`
+	Overrides        []CORSOverride `json:"overrides"`
+	Source           string         `json:"source,omitempty"`
+}
+
+// loadCORSPolicy returns the policy set through the system API, or the one
+// from GOSIP_CORS_ORIGINS, which allows credentials
+func loadCORSPolicy(ctx context.Context, deps *Dependencies) CORSPolicy {
+	return corsPolicyFromSetting(deps, corsPolicySetting(ctx, deps))
+}
+
+// corsPolicySetting returns the stored policy JSON, empty when not set
+func corsPolicySetting(ctx context.Context, deps *Dependencies) string {
+	if deps.DB == nil {
+		return ""
+	}
+	return deps.DB.Config.GetWithDefault(ctx, db.ConfigKeyCORSPolicy, "")
+}
+
+// corsPolicyFromSetting decodes the stored policy, falling back to
+// GOSIP_CORS_ORIGINS when it is empty or invalid
+func corsPolicyFromSetting(deps *Dependencies, raw string) CORSPolicy {
+	if raw != "" {
+		policy, err := parseCORSPolicy(raw)
+		if err == nil {
+			return policy
+		}
+		slog.Warn("Ignoring invalid CORS policy setting", "error", err)
+	}
+
+	policy := CORSPolicy{Origins: []string{}, AllowCredentials: true, Overrides: []CORSOverride{}, Source: CORSSourceEnvironment}
+	if deps.Config != nil {
+		policy.Origins = append(policy.Origins, deps.Config.CORSOrigins...)
+	}
+	return policy
+}
+
+// parseCORSPolicy decodes a stored policy
+func parseCORSPolicy(raw string) (CORSPolicy, error) {
+	var policy CORSPolicy
+	if err := json.Unmarshal([]byte(raw), &policy); err != nil {
+		return policy, err
+	}
+	if errs := validateCORSPolicy(policy); len(errs) > 0 {
+		return policy, fmt.Errorf("%s: %s", errs[0].Field, errs[0].Message)
+	}
+	if policy.Origins == nil {
+		policy.Origins = []string{}
+	}
+	if policy.Overrides == nil {
+		policy.Overrides = []CORSOverride{}
+	}
+	policy.Source = CORSSourceSettings
+	return policy, nil
+}
+
+// validateCORSPolicy checks origins and overrides
+func validateCORSPolicy(policy CORSPolicy) []FieldError {
+	errs := validateCORSOrigins("origins", policy.Origins, policy.AllowCredentials)
+	if len(policy.Overrides) > config.CORSMaxOverrides {
+		errs = append(errs, FieldError{Field: "overrides", Message: fmt.Sprintf("At most %d overrides are allowed", config.CORSMaxOverrides)})
+	}
+	seen := make(map[string]bool)
+	for i, o := range policy.Overrides {
+		field := fmt.Sprintf("overrides[%d].", i)
+		switch {
+		case !strings.HasPrefix(o.PathPrefix, "/"):
+			errs = append(errs, FieldError{Field: field + "path_prefix", Message: "Path prefix must start with /"})
+		case seen[o.PathPrefix]:
+			errs = append(errs, FieldError{Field: field + "path_prefix", Message: "Path prefix is already overridden"})
+		}
+		seen[o.PathPrefix] = true
+		errs = append(errs, validateCORSOrigins(field+"origins", o.Origins, o.AllowCredentials)...)
+	}
+	return errs
+}
+
+// validateCORSOrigins checks a list of allowed origins. Browsers refuse
+// credentials for any origin, so "*" can't be combined with them.
+func validateCORSOrigins(field string, origins []string, credentials bool) []FieldError {
+	var errs []FieldError
+	for _, origin := range origins {
+		if origin == "*" {
+			if credentials {
+				errs = append(errs, FieldError{Field: field, Message: "Credentials can't be allowed for any origin"})
+			}
+			continue
+		}
+		if strings.Count(origin, "*") > 1 {
+			errs = append(errs, FieldError{Field: field, Message: origin + " has more than one wildcard"})
+			continue
+		}
+		u, err := url.Parse(strings.Replace(origin, "*", "wildcard", 1))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			errs = append(errs, FieldError{Field: field, Message: origin + " is not an origin such as https://pbx.example.com"})
+		}
+	}
+	return errs
+}
+
+// corsHandler builds the CORS handler for a set of origins
+func corsHandler(origins []string, credentials bool) *cors.Cors {
+	opts := cors.Options{
+		AllowedOrigins:   origins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"Link"},
+		AllowCredentials: credentials,
+		MaxAge:           config.CORSMaxAge,
+	}
+	// The library allows every origin when given none
+	if len(origins) == 0 {
+		opts.AllowOriginFunc = func(*http.Request, string) bool { return false }
+	}
+	return cors.New(opts)
+}
+
+// corsRoutes is a policy built into handlers, overrides longest prefix first
+type corsRoutes struct {
+	fallback  *cors.Cors
+	prefixes  []string
+	overrides []*cors.Cors
+}
+
+// newCORSRoutes builds the handlers for a policy
+func newCORSRoutes(policy CORSPolicy) *corsRoutes {
+	routes := &corsRoutes{fallback: corsHandler(policy.Origins, policy.AllowCredentials)}
+	overrides := append([]CORSOverride(nil), policy.Overrides...)
+	sort.SliceStable(overrides, func(i, j int) bool {
+		return len(overrides[i].PathPrefix) > len(overrides[j].PathPrefix)
+	})
+	for _, o := range overrides {
+		routes.prefixes = append(routes.prefixes, o.PathPrefix)
+		routes.overrides = append(routes.overrides, corsHandler(o.Origins, o.AllowCredentials))
+	}
+	return routes
+}
+
+// handlerFor returns the CORS handler for a request path
+func (c *corsRoutes) handlerFor(path string) *cors.Cors {
+	for i, prefix := range c.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return c.overrides[i]
+		}
+	}
+	return c.fallback
+}
+
+// CORSMiddleware applies the CORS policy. The handlers are rebuilt when
+// the stored policy changes, so changes made through the system API apply
+// without a restart.
+func CORSMiddleware(deps *Dependencies) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+	var built string
+	var routes *corsRoutes
+
+	routesFor := func(ctx context.Context) *corsRoutes {
+		raw := corsPolicySetting(ctx, deps)
+		mu.Lock()
+		defer mu.Unlock()
+		if routes == nil || raw != built {
+			built = raw
+			routes = newCORSRoutes(corsPolicyFromSetting(deps, raw))
+		}
+		return routes
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			routesFor(r.Context()).handlerFor(r.URL.Path).Handler(next).ServeHTTP(w, r)
+		})
+	}
+}
+
+// CORSHandler reports and changes the CORS policy
+type CORSHandler struct {
+	deps *Dependencies
+}
+
+// NewCORSHandler creates a new CORSHandler
+func NewCORSHandler(deps *Dependencies) *CORSHandler {
+	return &CORSHandler{deps: deps}
+}
+
+// Get returns the CORS policy in effect (admin only)
+func (h *CORSHandler) Get(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, loadCORSPolicy(r.Context(), h.deps))
+}
+
+// UpdateCORSRequest represents a CORS policy change. Omitted fields keep
+// their current value.
+type UpdateCORSRequest struct {
+	Origins          *[]string       `json:"origins,omitempty"`
+	AllowCredentials *bool           `json:"allow_credentials,omitempty"`
+	Overrides        *[]CORSOverride `json:"overrides,omitempty"`
+}
+
+// Update changes the CORS policy (admin only). It takes effect on the next
+// request.
+func (h *CORSHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var req UpdateCORSRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	policy := loadCORSPolicy(r.Context(), h.deps)
+	if req.Origins != nil {
+		policy.Origins = *req.Origins
+	}
+	if req.AllowCredentials != nil {
+		policy.AllowCredentials = *req.AllowCredentials
+	}
+	if req.Overrides != nil {
+		policy.Overrides = *req.Overrides
+	}
+	if errs := validateCORSPolicy(policy); len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	policy.Source = ""
+	raw, err := json.Marshal(policy)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if err := h.deps.DB.Config.Set(r.Context(), db.ConfigKeyCORSPolicy, string(raw)); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	slog.Info("CORS policy changed", "origins", policy.Origins, "credentials", policy.AllowCredentials, "overrides", len(policy.Overrides))
+	WriteJSON(w, http.StatusOK, loadCORSPolicy(r.Context(), h.deps))
+}
+
+// Reset returns to the GOSIP_CORS_ORIGINS policy (admin only)
+func (h *CORSHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	if err := h.deps.DB.Config.Delete(r.Context(), db.ConfigKeyCORSPolicy); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, loadCORSPolicy(r.Context(), h.deps))
+}
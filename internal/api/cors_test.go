@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB, Config: &config.Config{CORSOrigins: []string{"https://pbx.example.com"}}}
+	handler := NewCORSHandler(deps)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mw := CORSMiddleware(deps)(next)
+
+	preflight := func(path, origin string) http.Header {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodOptions, path, nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		rr := httptest.NewRecorder()
+		mw.ServeHTTP(rr, req)
+		return rr.Header()
+	}
+
+	// GOSIP_CORS_ORIGINS applies until a policy is set, with credentials
+	h := preflight("/api/devices", "https://pbx.example.com")
+	if h.Get("Access-Control-Allow-Origin") != "https://pbx.example.com" || h.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("Expected the UI origin allowed with credentials, got %v", h)
+	}
+	if h := preflight("/api/devices", "https://evil.example.com"); h.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected other origins refused, got %v", h)
+	}
+
+	update := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/system/cors", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler.Update(rr, req)
+		return rr
+	}
+	assertStatus(t, update(`{"origins": ["*"]}`), http.StatusBadRequest)
+	assertStatus(t, update(`{"origins": ["https://pbx.example.com/admin"]}`), http.StatusBadRequest)
+	assertStatus(t, update(`{"overrides": [{"path_prefix": "api/calls", "origins": []}]}`), http.StatusBadRequest)
+
+	rr := update(`{
+		"origins": ["https://*.example.com"],
+		"overrides": [{"path_prefix": "/api/calls", "origins": ["*"], "allow_credentials": false}]
+	}`)
+	assertStatus(t, rr, http.StatusOK)
+	var policy CORSPolicy
+	decodeResponse(t, rr, &policy)
+	if policy.Source != CORSSourceSettings || !policy.AllowCredentials || len(policy.Overrides) != 1 {
+		t.Errorf("Unexpected policy %+v", policy)
+	}
+
+	// The change applies without a restart, the override to its routes only
+	if h := preflight("/api/devices", "https://ui.example.com"); h.Get("Access-Control-Allow-Origin") != "https://ui.example.com" {
+		t.Errorf("Expected the wildcard origin allowed, got %v", h)
+	}
+	h = preflight("/api/calls/CA123/hold", "https://crm.example.org")
+	if h.Get("Access-Control-Allow-Origin") != "*" || h.Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("Expected any origin allowed without credentials on the override, got %v", h)
+	}
+	if h := preflight("/api/devices", "https://crm.example.org"); h.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected the override limited to its prefix, got %v", h)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.Reset(rr, httptest.NewRequest(http.MethodDelete, "/api/system/cors", nil))
+	assertStatus(t, rr, http.StatusOK)
+	if h := preflight("/api/devices", "https://ui.example.com"); h.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected GOSIP_CORS_ORIGINS back after a reset, got %v", h)
+	}
+}
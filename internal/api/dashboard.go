@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/rules"
+)
+
+// DashboardHandler serves the aggregated dashboard payload
+type DashboardHandler struct {
+	deps *Dependencies
+	now  func() time.Time
+
+	mu        sync.Mutex
+	cached    *DashboardResponse
+	cachedAt  time.Time
+	balance   *float64
+	balanceAt time.Time
+}
+
+// NewDashboardHandler creates a new DashboardHandler
+func NewDashboardHandler(deps *Dependencies) *DashboardHandler {
+	return &DashboardHandler{
+		deps: deps,
+		now:  time.Now,
+	}
+}
+
+// DashboardResponse is the single payload rendered by the dashboard
+type DashboardResponse struct {
+	ActiveCalls   int                   `json:"active_calls"`
+	Today         DashboardToday        `json:"today"`
+	Unread        DashboardUnread       `json:"unread"`
+	Registrations DashboardRegistration `json:"registrations"`
+	RecentEvents  []*models.DeviceEvent `json:"recent_events"`
+	TwilioBalance *float64              `json:"twilio_balance"`
+	GeneratedAt   time.Time             `json:"generated_at"`
+}
+
+// DashboardToday holds activity counts since the start of the day in the system timezone
+type DashboardToday struct {
+	Calls    int `json:"calls"`
+	Messages int `json:"messages"`
+}
+
+// DashboardUnread holds unread counts across the system
+type DashboardUnread struct {
+	Voicemails int `json:"voicemails"`
+	Messages   int `json:"messages"`
+}
+
+// DashboardRegistration summarizes device registration health
+type DashboardRegistration struct {
+	Registered   int `json:"registered"`
+	TotalDevices int `json:"total_devices"`
+}
+
+// Get returns the dashboard payload, serving a cached copy while it is
+// fresh. The lock is only held to read and swap the cache, so a slow
+// Twilio lookup doesn't hold up other requests.
+func (h *DashboardHandler) Get(w http.ResponseWriter, r *http.Request) {
+	now := h.now()
+	h.mu.Lock()
+	cached, cachedAt := h.cached, h.cachedAt
+	h.mu.Unlock()
+	if cached != nil && now.Sub(cachedAt) < config.DashboardCacheTTL {
+		WriteJSON(w, http.StatusOK, cached)
+		return
+	}
+
+	resp, err := h.build(r.Context(), now)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	h.mu.Lock()
+	if now.After(h.cachedAt) {
+		h.cached = resp
+		h.cachedAt = now
+	}
+	h.mu.Unlock()
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// build calculates the dashboard payload
+func (h *DashboardHandler) build(ctx context.Context, now time.Time) (*DashboardResponse, error) {
+	resp := &DashboardResponse{GeneratedAt: now}
+
+	if h.deps.SIP != nil {
+		resp.ActiveCalls = h.deps.SIP.GetActiveCallCount()
+		resp.Registrations.Registered = h.deps.SIP.GetRegistrar().GetRegistrationCount()
+	}
+
+	// Stored timestamps are server-local, so compare against local time
+	loc := rules.LoadLocation(h.deps.DB.Config.GetWithDefault(ctx, "timezone", ""), time.Local)
+	dayStart := startOfDay(now, loc).In(time.Local)
+
+	var err error
+	if resp.Today.Calls, err = h.deps.DB.CDRs.Count(ctx, db.CDRFilter{StartDate: &dayStart}); err != nil {
+		return nil, err
+	}
+	if resp.Today.Messages, err = h.deps.DB.Messages.CountSince(ctx, dayStart); err != nil {
+		return nil, err
+	}
+	if resp.Unread.Voicemails, err = h.deps.DB.Voicemails.CountUnread(ctx, nil); err != nil {
+		return nil, err
+	}
+	if resp.Unread.Messages, err = h.deps.DB.Messages.CountUnread(ctx); err != nil {
+		return nil, err
+	}
+	if resp.Registrations.TotalDevices, err = h.deps.DB.Devices.Count(ctx); err != nil {
+		return nil, err
+	}
+	if resp.RecentEvents, err = h.deps.DB.DeviceEvents.ListRecent(ctx, config.DashboardRecentEvents); err != nil {
+		return nil, err
+	}
+	if resp.RecentEvents == nil {
+		resp.RecentEvents = []*models.DeviceEvent{}
+	}
+
+	resp.TwilioBalance = h.twilioBalance(ctx, now)
+	return resp, nil
+}
+
+// twilioBalance returns the account balance, refreshing it at most once per
+// DashboardBalanceCacheTTL. A failed lookup keeps the last known balance.
+// The request that refreshes it claims the refresh up front, so concurrent
+// requests are served the last known balance instead of looking it up too.
+func (h *DashboardHandler) twilioBalance(ctx context.Context, now time.Time) *float64 {
+	if h.deps.Twilio == nil {
+		return nil
+	}
+	h.mu.Lock()
+	if !h.balanceAt.IsZero() && now.Sub(h.balanceAt) < config.DashboardBalanceCacheTTL {
+		defer h.mu.Unlock()
+		return h.balance
+	}
+	h.balanceAt = now
+	h.mu.Unlock()
+
+	balance, err := h.deps.Twilio.GetAccountBalance(ctx)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		h.balance = &balance
+	}
+	return h.balance
+}
+
+// startOfDay returns midnight of t's calendar day in loc
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestDashboardHandler_Get(t *testing.T) {
+	setup := setupTestAPI(t)
+	setup.Twilio.GetAccountBalanceFunc = func(ctx context.Context) (float64, error) {
+		return 42.5, nil
+	}
+	deps := &Dependencies{DB: setup.DB, Twilio: setup.Twilio}
+	handler := NewDashboardHandler(deps)
+	ctx := context.Background()
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	createTestDevice(t, setup.DB, "Desk Phone", "desk")
+
+	// One call today, one from two days ago
+	setup.DB.CDRs.Create(ctx, &models.CDR{DIDID: &did.ID, Direction: "inbound", FromNumber: "+15558888888", ToNumber: did.Number, StartedAt: time.Now(), Disposition: "answered"})
+	setup.DB.CDRs.Create(ctx, &models.CDR{DIDID: &did.ID, Direction: "inbound", FromNumber: "+15558888888", ToNumber: did.Number, StartedAt: time.Now().AddDate(0, 0, -2), Disposition: "answered"})
+	setup.DB.Messages.Create(ctx, &models.Message{MessageSID: "SM1", DIDID: &did.ID, Direction: "inbound", FromNumber: "+15558888888", ToNumber: did.Number, Body: "Hi", Status: "received"})
+	setup.DB.Voicemails.Create(ctx, &models.Voicemail{FromNumber: "+15558888888", AudioURL: "https://example.com/vm.mp3"})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/dashboard", nil)
+	rr := httptest.NewRecorder()
+	handler.Get(rr, req)
+
+	assertStatus(t, rr, http.StatusOK)
+
+	var resp DashboardResponse
+	decodeResponse(t, rr, &resp)
+
+	if resp.Today.Calls != 1 {
+		t.Errorf("Expected 1 call today, got %d", resp.Today.Calls)
+	}
+	if resp.Today.Messages != 1 {
+		t.Errorf("Expected 1 message today, got %d", resp.Today.Messages)
+	}
+	if resp.Unread.Messages != 1 || resp.Unread.Voicemails != 1 {
+		t.Errorf("Expected 1 unread message and voicemail, got %+v", resp.Unread)
+	}
+	if resp.Registrations.TotalDevices != 1 {
+		t.Errorf("Expected 1 device, got %d", resp.Registrations.TotalDevices)
+	}
+	if resp.RecentEvents == nil {
+		t.Error("Expected recent events to be an empty list")
+	}
+	if resp.TwilioBalance == nil || *resp.TwilioBalance != 42.5 {
+		t.Errorf("Expected Twilio balance 42.5, got %v", resp.TwilioBalance)
+	}
+}
+
+func TestDashboardHandler_Get_Cached(t *testing.T) {
+	setup := setupTestAPI(t)
+	balanceCalls := 0
+	setup.Twilio.GetAccountBalanceFunc = func(ctx context.Context) (float64, error) {
+		balanceCalls++
+		return 10, nil
+	}
+	deps := &Dependencies{DB: setup.DB, Twilio: setup.Twilio}
+	handler := NewDashboardHandler(deps)
+
+	now := time.Now()
+	handler.now = func() time.Time { return now }
+
+	get := func() DashboardResponse {
+		rr := httptest.NewRecorder()
+		handler.Get(rr, httptest.NewRequest(http.MethodGet, "/api/dashboard", nil))
+		assertStatus(t, rr, http.StatusOK)
+		var resp DashboardResponse
+		decodeResponse(t, rr, &resp)
+		return resp
+	}
+
+	get()
+	createTestDevice(t, setup.DB, "Desk Phone", "desk")
+
+	if resp := get(); resp.Registrations.TotalDevices != 0 {
+		t.Errorf("Expected cached payload, got %d devices", resp.Registrations.TotalDevices)
+	}
+
+	// Past the payload TTL the counts refresh but the balance stays cached
+	now = now.Add(time.Minute)
+	if resp := get(); resp.Registrations.TotalDevices != 1 {
+		t.Errorf("Expected refreshed payload, got %d devices", resp.Registrations.TotalDevices)
+	}
+	if balanceCalls != 1 {
+		t.Errorf("Expected 1 balance lookup, got %d", balanceCalls)
+	}
+}
+
+func TestDashboardHandler_Get_SlowBalance(t *testing.T) {
+	setup := setupTestAPI(t)
+	release := make(chan struct{})
+	blocked := make(chan struct{}, 1)
+	var balanceCalls atomic.Int32
+	setup.Twilio.GetAccountBalanceFunc = func(ctx context.Context) (float64, error) {
+		if balanceCalls.Add(1) > 1 {
+			blocked <- struct{}{}
+			<-release
+		}
+		return 10, nil
+	}
+	handler := NewDashboardHandler(&Dependencies{DB: setup.DB, Twilio: setup.Twilio})
+	var now atomic.Pointer[time.Time]
+	start := time.Now()
+	now.Store(&start)
+	handler.now = func() time.Time { return *now.Load() }
+
+	get := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.Get(rr, httptest.NewRequest(http.MethodGet, "/api/dashboard", nil))
+		return rr
+	}
+	get()
+
+	// Once the balance is stale, one request looks it up while others are
+	// served the last known balance without waiting for it
+	later := start.Add(time.Hour)
+	now.Store(&later)
+	done := make(chan struct{})
+	go func() {
+		get()
+		close(done)
+	}()
+	<-blocked
+
+	rr := get()
+	assertStatus(t, rr, http.StatusOK)
+	var resp DashboardResponse
+	decodeResponse(t, rr, &resp)
+	if resp.TwilioBalance == nil || *resp.TwilioBalance != 10 {
+		t.Errorf("Expected the last known balance, got %v", resp.TwilioBalance)
+	}
+
+	close(release)
+	<-done
+	if n := balanceCalls.Load(); n != 2 {
+		t.Errorf("Expected 2 balance lookups, got %d", n)
+	}
+}
+
+func TestDashboardHandler_Get_BalanceError(t *testing.T) {
+	setup := setupTestAPI(t)
+	setup.Twilio.GetAccountBalanceFunc = func(ctx context.Context) (float64, error) {
+		return 0, errors.New("twilio unavailable")
+	}
+	deps := &Dependencies{DB: setup.DB, Twilio: setup.Twilio}
+	handler := NewDashboardHandler(deps)
+
+	rr := httptest.NewRecorder()
+	handler.Get(rr, httptest.NewRequest(http.MethodGet, "/api/dashboard", nil))
+
+	assertStatus(t, rr, http.StatusOK)
+
+	var resp DashboardResponse
+	decodeResponse(t, rr, &resp)
+	if resp.TwilioBalance != nil {
+		t.Errorf("Expected no balance, got %v", *resp.TwilioBalance)
+	}
+}
@@ -2,21 +2,59 @@ package api
 
 import (
 	"context"
+	"time"
 
+	"github.com/btafoya/gosip/internal/blocklist"
+	"github.com/btafoya/gosip/internal/calendar"
+	"github.com/btafoya/gosip/internal/compliance"
 	"github.com/btafoya/gosip/internal/config"
 	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/diagnostics"
+	"github.com/btafoya/gosip/internal/didwebhooks"
+	"github.com/btafoya/gosip/internal/discovery"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/failover"
+	"github.com/btafoya/gosip/internal/integrity"
+	"github.com/btafoya/gosip/internal/logging"
 	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/notifications"
+	"github.com/btafoya/gosip/internal/passwords"
+	"github.com/btafoya/gosip/internal/portmap"
+	"github.com/btafoya/gosip/internal/publicurl"
+	"github.com/btafoya/gosip/internal/replica"
+	"github.com/btafoya/gosip/internal/storage"
 	"github.com/btafoya/gosip/internal/twilio"
+	"github.com/btafoya/gosip/internal/twilioips"
+	"github.com/btafoya/gosip/internal/verify"
+	"github.com/btafoya/gosip/internal/wanip"
 	"github.com/btafoya/gosip/pkg/sip"
 )
 
 // Dependencies holds all dependencies for API handlers
 type Dependencies struct {
-	DB       *db.DB
-	SIP      *sip.Server
-	Twilio   TwilioClient
-	Notifier Notifier
-	Config   *config.Config
+	DB                *db.DB
+	SIP               *sip.Server
+	Twilio            TwilioClient
+	Notifier          Notifier
+	Config            *config.Config
+	Events            *events.Hub
+	Scanner           DeviceScanner
+	FeedSyncer        FeedSyncer
+	Breaches          BreachChecker
+	Calendars         CalendarSyncer
+	Logging           *logging.Levels
+	Diagnostics       *diagnostics.Store
+	WANIP             *wanip.Monitor
+	PortMap           *portmap.Mapper
+	Replica           *replica.Replicator
+	Failover          *failover.Manager
+	DIDWebhooks       *didwebhooks.Manager
+	PublicURL         *publicurl.Monitor
+	ComplianceExports *compliance.Exporter
+	Verify            *verify.Service
+	Storage           *storage.Monitor
+	Integrity         *integrity.Monitor
+	TwilioRanges      *twilioips.List
 }
 
 // TwilioClient interface for Twilio operations
@@ -33,10 +71,12 @@ type TwilioClient interface {
 
 	// Voice Operations
 	RequestTranscription(recordingSID string, voicemailID int64) error
+	GetCallPrice(ctx context.Context, callSID string) (price, priceUnit string, err error)
 
 	// Account Operations
 	UpdateCredentials(accountSID, authToken string)
 	IsHealthy() bool
+	GetAccountBalance(ctx context.Context) (float64, error)
 	ListIncomingPhoneNumbers(ctx context.Context) ([]twilio.IncomingPhoneNumber, error)
 
 	// SIP Trunk Operations
@@ -49,23 +89,82 @@ type TwilioClient interface {
 	EnsureTrunkFullySecure(ctx context.Context, trunkSID string) error
 	SetOriginationURI(ctx context.Context, trunkSID, sipURI string, priority, weight int) error
 	SetSecureOriginationURI(ctx context.Context, trunkSID, sipURI string, priority, weight int) error
+	GetTrunkEdge(ctx context.Context, trunkSID string) (*twilio.TrunkEdge, error)
+	SetTrunkEdge(ctx context.Context, trunkSID, edge string) error
 }
 
 // Notifier interface for sending notifications
 type Notifier interface {
 	SendVoicemailNotification(voicemail *models.Voicemail) error
 	SendSMSNotification(message *models.Message) error
+	SendVoicemailQuotaWarning(did *models.DID, quota *models.VoicemailQuota, usage models.VoicemailUsage, percent int) error
 	SendEmail(to, subject, body string) error
 	SendPush(title, message string) error
+	TestSMTP(to string) *notifications.SMTPTestResult
+}
+
+// DeviceScanner interface for LAN device discovery
+type DeviceScanner interface {
+	Scan(ctx context.Context, timeout time.Duration) ([]discovery.Device, error)
+}
+
+// FeedSyncer interface for refreshing community blocklist feeds
+type FeedSyncer interface {
+	SyncFeed(ctx context.Context, feed *models.BlocklistFeed) error
+}
+
+// CalendarSyncer interface for syncing linked user calendars
+type CalendarSyncer interface {
+	SyncCalendar(ctx context.Context, cal *models.UserCalendar) error
+}
+
+// BreachChecker interface for looking passwords up in known data breaches
+type BreachChecker interface {
+	Breached(ctx context.Context, password string) (int, error)
 }
 
 // NewDependencies creates a new Dependencies instance
 func NewDependencies(cfg *config.Config, database *db.DB, sipServer *sip.Server, twilio TwilioClient, notifier Notifier) *Dependencies {
 	return &Dependencies{
-		DB:       database,
-		SIP:      sipServer,
-		Twilio:   twilio,
-		Notifier: notifier,
-		Config:   cfg,
+		DB:         database,
+		SIP:        sipServer,
+		Twilio:     twilio,
+		Notifier:   notifier,
+		Config:     cfg,
+		Events:     events.NewHub(config.EventHistorySize),
+		Scanner:    discovery.NewScanner(),
+		FeedSyncer: blocklist.NewSyncer(database),
+		Breaches:   passwords.NewBreachChecker(),
+		Calendars:  calendar.NewSyncer(database),
+	}
+}
+
+// publicBaseURL returns the base URL links and QR codes are built from:
+// the public base URL, falling back to https on the SIP domain
+func publicBaseURL(ctx context.Context, deps *Dependencies) string {
+	if base := publicurl.Get(ctx, deps.Config, deps.DB); base != "" {
+		return base
+	}
+	host := "localhost"
+	if deps.Config != nil && deps.Config.SIPDomain != "" {
+		host = deps.Config.SIPDomain
+	}
+	return "https://" + host
+}
+
+// twilioCredentials returns the Twilio account SID and auth token. Values
+// from the environment, a secret file or a secret store take precedence
+// over those saved in the web UI, so the token needn't be kept in the database.
+func twilioCredentials(ctx context.Context, deps *Dependencies) (string, string) {
+	accountSID := deps.DB.Config.GetWithDefault(ctx, "twilio_account_sid", "")
+	authToken := deps.DB.Config.GetWithDefault(ctx, "twilio_auth_token", "")
+	if deps.Config != nil {
+		if deps.Config.TwilioAccountSID != "" {
+			accountSID = deps.Config.TwilioAccountSID
+		}
+		if deps.Config.TwilioAuthToken != "" {
+			authToken = deps.Config.TwilioAuthToken
+		}
 	}
+	return accountSID, authToken
 }
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/pkg/sip"
+	"github.com/go-chi/chi/v5"
+)
+
+// DeviceActionRequest asks a phone to carry out a remote action
+type DeviceActionRequest struct {
+	Action string `json:"action"` // "check-sync", "resync", "reboot" or "factory_reset"
+}
+
+// Action sends a remote action to a registered phone, so configuration
+// changes can be pushed without walking to it. The outcome is recorded in
+// the device's events.
+func (h *DeviceHandler) Action(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid device ID", nil)
+		return
+	}
+
+	device, err := h.deps.DB.Devices.GetByID(r.Context(), id)
+	if err != nil {
+		if err == db.ErrDeviceNotFound {
+			WriteNotFoundError(w, "Device")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	var req DeviceActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	vendor := ""
+	if device.Vendor != nil {
+		vendor = *device.Vendor
+	}
+	if _, err := sip.DeviceActionEvent(vendor, req.Action); errors.Is(err, sip.ErrDeviceActionUnknown) {
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "action", Message: "Action must be check-sync, resync, reboot or factory_reset"},
+		})
+		return
+	}
+
+	if h.deps.SIP == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "SIP server not available", nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.DeviceActionTimeout)
+	defer cancel()
+	result, err := h.deps.SIP.SendDeviceAction(ctx, device, req.Action)
+	if err != nil {
+		h.deps.DB.DeviceEvents.LogEvent(r.Context(), device.ID, "remote_action_failed", map[string]interface{}{
+			"action": req.Action,
+			"error":  err.Error(),
+		}, r.RemoteAddr, r.UserAgent())
+
+		switch {
+		case errors.Is(err, sip.ErrDeviceActionUnsupported):
+			WriteError(w, http.StatusUnprocessableEntity, ErrCodeBadRequest, "Phones cannot be factory reset over SIP; reset it from its menu or web interface", nil)
+		case errors.Is(err, sip.ErrDeviceNotRegistered):
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "Device is not registered", nil)
+		default:
+			WriteError(w, http.StatusBadGateway, ErrCodeBadGateway, "Device did not answer the request", nil)
+		}
+		return
+	}
+
+	eventType := "remote_action"
+	if !result.Accepted {
+		eventType = "remote_action_failed"
+	}
+	h.deps.DB.DeviceEvents.LogEvent(r.Context(), device.ID, eventType, map[string]interface{}{
+		"action": result.Action,
+		"event":  result.Event,
+		"status": result.Status,
+		"reason": result.Reason,
+	}, r.RemoteAddr, r.UserAgent())
+
+	WriteJSON(w, http.StatusOK, result)
+}
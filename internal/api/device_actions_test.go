@@ -0,0 +1,33 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDeviceHandler_Action(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewDeviceHandler(&Dependencies{DB: setup.DB})
+
+	device := createTestDevice(t, setup.DB, "Phone", "alice")
+	params := map[string]string{"id": fmt.Sprint(device.ID)}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/devices/1/actions", strings.NewReader(`{"action": "explode"}`))
+	rr := httptest.NewRecorder()
+	handler.Action(rr, withURLParams(req, params))
+	assertStatus(t, rr, http.StatusBadRequest)
+
+	// Without a running SIP server nothing can reach the phone
+	req = httptest.NewRequest(http.MethodPost, "/api/devices/1/actions", strings.NewReader(`{"action": "resync"}`))
+	rr = httptest.NewRecorder()
+	handler.Action(rr, withURLParams(req, params))
+	assertStatus(t, rr, http.StatusServiceUnavailable)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/devices/999/actions", strings.NewReader(`{"action": "resync"}`))
+	rr = httptest.NewRecorder()
+	handler.Action(rr, withURLParams(req, map[string]string{"id": "999"}))
+	assertStatus(t, rr, http.StatusNotFound)
+}
@@ -0,0 +1,293 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxFirmwareLength limits the firmware string a beacon can report
+const maxFirmwareLength = 128
+
+// DevicePingStats summarizes the OPTIONS pings sent to a device
+type DevicePingStats struct {
+	Sent        int     `json:"sent"`
+	Lost        int     `json:"lost"`
+	LossPercent float64 `json:"loss_percent"`
+	AvgRTTMs    float64 `json:"avg_rtt_ms"`
+	MaxRTTMs    int     `json:"max_rtt_ms"`
+}
+
+// DeviceRegistrationStats summarizes how regularly a device re-registers
+type DeviceRegistrationStats struct {
+	Count              int     `json:"count"`
+	AvgIntervalSeconds float64 `json:"avg_interval_seconds"`
+	JitterSeconds      float64 `json:"jitter_seconds"` // Mean change between consecutive intervals
+}
+
+// DeviceHealthBucket is one step of a device's health trend
+type DeviceHealthBucket struct {
+	Start         time.Time `json:"start"`
+	Pings         int       `json:"pings"`
+	Lost          int       `json:"lost"`
+	AvgRTTMs      float64   `json:"avg_rtt_ms"`
+	Registrations int       `json:"registrations"`
+}
+
+// DeviceHealthResponse is a device's health over a period
+type DeviceHealthResponse struct {
+	DeviceID        int64                   `json:"device_id"`
+	Hours           int                     `json:"hours"`
+	Status          string                  `json:"status"` // "ok", "warning", "critical", or "unknown" without samples
+	Warnings        []string                `json:"warnings"`
+	Firmware        *string                 `json:"firmware,omitempty"`
+	UptimeSeconds   *int64                  `json:"uptime_seconds,omitempty"`
+	LastReported    *time.Time              `json:"last_reported,omitempty"`
+	Ping            DevicePingStats         `json:"ping"`
+	Registration    DeviceRegistrationStats `json:"registration"`
+	Restarts        int                     `json:"restarts"` // Times the reported uptime went backwards
+	FirmwareChanges int                     `json:"firmware_changes"`
+	Trend           []DeviceHealthBucket    `json:"trend"`
+}
+
+// Health returns a device's telemetry summary and trend, to spot failing
+// handsets early
+func (h *DeviceHandler) Health(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid device ID", nil)
+		return
+	}
+
+	if _, err := h.deps.DB.Devices.GetByID(r.Context(), id); err != nil {
+		if err == db.ErrDeviceNotFound {
+			WriteNotFoundError(w, "Device")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	hours := config.DeviceHealthDefaultHours
+	if v := r.URL.Query().Get("hours"); v != "" {
+		hours, err = strconv.Atoi(v)
+		if err != nil || hours < 1 || hours > config.DeviceHealthMaxHours {
+			WriteValidationError(w, "Validation failed", []FieldError{
+				{Field: "hours", Message: "Hours must be between 1 and " + strconv.Itoa(config.DeviceHealthMaxHours)},
+			})
+			return
+		}
+	}
+
+	now := time.Now()
+	samples, err := h.deps.DB.DeviceTelemetry.ListSince(r.Context(), id, now.Add(-time.Duration(hours)*time.Hour))
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, deviceHealth(id, hours, samples, now))
+}
+
+// Beacon records telemetry a phone reports about itself, such as its
+// firmware and uptime. Phones send it from an action URL with their MAC
+// address, so like the provisioning responder only LAN clients are answered.
+func (h *ProvisioningHandler) Beacon(w http.ResponseWriter, r *http.Request) {
+	if !isLANAddr(peerAddr(r)) {
+		respondError(w, http.StatusForbidden, "BEACON_FORBIDDEN", "Beacons are only accepted from the local network")
+		return
+	}
+
+	mac := r.FormValue("mac")
+	if mac == "" {
+		respondError(w, http.StatusBadRequest, "MISSING_MAC", "MAC address is required")
+		return
+	}
+	device, err := h.deps.DB.Devices.GetByMAC(r.Context(), mac)
+	if err != nil {
+		if err == db.ErrDeviceNotFound {
+			respondError(w, http.StatusNotFound, "DEVICE_NOT_FOUND", "No device matches the MAC address")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to look up device")
+		return
+	}
+
+	sample := &models.DeviceTelemetry{DeviceID: device.ID, Source: db.TelemetrySourceBeacon}
+	if v := strings.TrimSpace(r.FormValue("firmware")); v != "" {
+		if len(v) > maxFirmwareLength {
+			v = v[:maxFirmwareLength]
+		}
+		sample.Firmware = &v
+	}
+	if v := r.FormValue("uptime"); v != "" {
+		uptime, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || uptime < 0 {
+			respondError(w, http.StatusBadRequest, "INVALID_UPTIME", "Uptime must be a number of seconds")
+			return
+		}
+		sample.UptimeSeconds = &uptime
+	}
+	if v := r.FormValue("rtt"); v != "" {
+		rtt, err := strconv.Atoi(v)
+		if err != nil || rtt < 0 {
+			respondError(w, http.StatusBadRequest, "INVALID_RTT", "RTT must be a number of milliseconds")
+			return
+		}
+		sample.RTTMs = &rtt
+	}
+
+	if err := h.deps.DB.DeviceTelemetry.Record(r.Context(), sample); err != nil {
+		respondError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to record telemetry")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Telemetry recorded"})
+}
+
+// deviceHealth summarizes a device's telemetry samples, oldest first, over
+// the hours before now
+func deviceHealth(deviceID int64, hours int, samples []*models.DeviceTelemetry, now time.Time) *DeviceHealthResponse {
+	resp := &DeviceHealthResponse{DeviceID: deviceID, Hours: hours, Warnings: []string{}}
+
+	// Hourly steps, or daily ones for periods over two days
+	step := time.Hour
+	if hours > 48 {
+		step = 24 * time.Hour
+	}
+	start := now.Add(-time.Duration(hours) * time.Hour).Truncate(step)
+	buckets := make([]DeviceHealthBucket, int(now.Sub(start)/step)+1)
+	rttTotals := make([]int, len(buckets))
+	for i := range buckets {
+		buckets[i].Start = start.Add(time.Duration(i) * step)
+	}
+
+	var rttTotal int
+	var intervals []int
+	var lastUptime *int64
+	lastFirmware := make(map[string]string)
+	for _, s := range samples {
+		b := int(s.CreatedAt.Sub(start) / step)
+		if b < 0 || b >= len(buckets) {
+			continue
+		}
+		createdAt := s.CreatedAt
+		resp.LastReported = &createdAt
+
+		if s.Firmware != nil {
+			if prev, ok := lastFirmware[s.Source]; ok && prev != *s.Firmware {
+				resp.FirmwareChanges++
+			}
+			lastFirmware[s.Source] = *s.Firmware
+		}
+		if s.UptimeSeconds != nil {
+			if lastUptime != nil && *s.UptimeSeconds < *lastUptime {
+				resp.Restarts++
+			}
+			lastUptime = s.UptimeSeconds
+			resp.UptimeSeconds = s.UptimeSeconds
+		}
+
+		switch s.Source {
+		case db.TelemetrySourcePing:
+			resp.Ping.Sent++
+			buckets[b].Pings++
+			if s.RTTMs == nil {
+				resp.Ping.Lost++
+				buckets[b].Lost++
+				continue
+			}
+			rttTotal += *s.RTTMs
+			rttTotals[b] += *s.RTTMs
+			if *s.RTTMs > resp.Ping.MaxRTTMs {
+				resp.Ping.MaxRTTMs = *s.RTTMs
+			}
+		case db.TelemetrySourceRegister:
+			resp.Registration.Count++
+			buckets[b].Registrations++
+			if s.RegisterIntervalSeconds != nil {
+				intervals = append(intervals, *s.RegisterIntervalSeconds)
+			}
+		}
+	}
+
+	// Beacons report the firmware more precisely than a User-Agent
+	for _, source := range []string{db.TelemetrySourceBeacon, db.TelemetrySourceRegister} {
+		if firmware, ok := lastFirmware[source]; ok && resp.Firmware == nil {
+			resp.Firmware = &firmware
+		}
+	}
+
+	if answered := resp.Ping.Sent - resp.Ping.Lost; answered > 0 {
+		resp.Ping.AvgRTTMs = round1(float64(rttTotal) / float64(answered))
+	}
+	if resp.Ping.Sent > 0 {
+		resp.Ping.LossPercent = round1(float64(resp.Ping.Lost) * 100 / float64(resp.Ping.Sent))
+	}
+	for i := range buckets {
+		if answered := buckets[i].Pings - buckets[i].Lost; answered > 0 {
+			buckets[i].AvgRTTMs = round1(float64(rttTotals[i]) / float64(answered))
+		}
+	}
+	resp.Trend = buckets
+
+	if len(intervals) > 0 {
+		var total, change int
+		for i, v := range intervals {
+			total += v
+			if i > 0 {
+				change += absInt(v - intervals[i-1])
+			}
+		}
+		resp.Registration.AvgIntervalSeconds = round1(float64(total) / float64(len(intervals)))
+		if len(intervals) > 1 {
+			resp.Registration.JitterSeconds = round1(float64(change) / float64(len(intervals)-1))
+		}
+	}
+
+	switch {
+	case len(samples) == 0:
+		resp.Status = "unknown"
+		return resp
+	case resp.Ping.Sent > 0 && resp.Ping.LossPercent >= config.DeviceHealthLossCriticalPercent:
+		resp.Status = "critical"
+	default:
+		resp.Status = "ok"
+	}
+	if resp.Ping.LossPercent >= config.DeviceHealthLossWarningPercent {
+		resp.Warnings = append(resp.Warnings, "Phone is not answering pings")
+	}
+	if resp.Ping.AvgRTTMs > config.DeviceHealthRTTWarningMs {
+		resp.Warnings = append(resp.Warnings, "Ping time is high")
+	}
+	if resp.Registration.JitterSeconds > config.DeviceHealthJitterWarningSeconds {
+		resp.Warnings = append(resp.Warnings, "Phone re-registers irregularly")
+	}
+	if resp.Restarts > config.DeviceHealthRestartWarningCount {
+		resp.Warnings = append(resp.Warnings, "Phone keeps restarting")
+	}
+	if resp.Status == "ok" && len(resp.Warnings) > 0 {
+		resp.Status = "warning"
+	}
+	return resp
+}
+
+// round1 rounds to one decimal place
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// absInt returns the absolute value of an int
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
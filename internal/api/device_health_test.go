@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func TestDeviceHealth(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	at := func(minutesAgo int) time.Time { return now.Add(-time.Duration(minutesAgo) * time.Minute) }
+	intp := func(v int) *int { return &v }
+	int64p := func(v int64) *int64 { return &v }
+	strp := func(v string) *string { return &v }
+
+	samples := []*models.DeviceTelemetry{
+		{Source: db.TelemetrySourceRegister, Firmware: strp("Yealink T46S 66.86.0.10"), CreatedAt: at(200)},
+		{Source: db.TelemetrySourceRegister, RegisterIntervalSeconds: intp(300), CreatedAt: at(195)},
+		{Source: db.TelemetrySourceRegister, RegisterIntervalSeconds: intp(360), CreatedAt: at(189)},
+		{Source: db.TelemetrySourceBeacon, Firmware: strp("66.86.0.10"), UptimeSeconds: int64p(5000), CreatedAt: at(180)},
+		{Source: db.TelemetrySourceBeacon, Firmware: strp("66.86.0.15"), UptimeSeconds: int64p(60), CreatedAt: at(120)},
+		{Source: db.TelemetrySourcePing, RTTMs: intp(20), CreatedAt: at(90)},
+		{Source: db.TelemetrySourcePing, RTTMs: intp(40), CreatedAt: at(20)},
+		{Source: db.TelemetrySourcePing, CreatedAt: at(10)},
+	}
+
+	resp := deviceHealth(1, 24, samples, now)
+
+	if resp.Firmware == nil || *resp.Firmware != "66.86.0.15" {
+		t.Errorf("Expected the beacon firmware, got %v", resp.Firmware)
+	}
+	if resp.Restarts != 1 || resp.FirmwareChanges != 1 {
+		t.Errorf("Restarts = %d, FirmwareChanges = %d; want 1, 1", resp.Restarts, resp.FirmwareChanges)
+	}
+	if resp.Ping.Sent != 3 || resp.Ping.Lost != 1 || resp.Ping.AvgRTTMs != 30 || resp.Ping.MaxRTTMs != 40 || resp.Ping.LossPercent != 33.3 {
+		t.Errorf("Unexpected ping stats %+v", resp.Ping)
+	}
+	if resp.Registration.Count != 3 || resp.Registration.AvgIntervalSeconds != 330 || resp.Registration.JitterSeconds != 60 {
+		t.Errorf("Unexpected registration stats %+v", resp.Registration)
+	}
+	if resp.Status != "warning" || len(resp.Warnings) != 2 {
+		t.Errorf("Expected a warning for lost pings and jitter, got %q %v", resp.Status, resp.Warnings)
+	}
+
+	// 24 hourly steps plus the current hour
+	if len(resp.Trend) != 25 {
+		t.Fatalf("Expected 25 trend steps, got %d", len(resp.Trend))
+	}
+	last := resp.Trend[len(resp.Trend)-1]
+	if last.Pings != 2 || last.Lost != 1 || last.AvgRTTMs != 40 {
+		t.Errorf("Unexpected current hour %+v", last)
+	}
+
+	if empty := deviceHealth(1, 24, nil, now); empty.Status != "unknown" {
+		t.Errorf("Expected unknown status without samples, got %q", empty.Status)
+	}
+}
+
+func TestDeviceHandler_Health(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewDeviceHandler(&Dependencies{DB: setup.DB})
+
+	device := createTestDevice(t, setup.DB, "Phone", "alice")
+	rtt := 25
+	if err := setup.DB.DeviceTelemetry.Record(context.Background(), &models.DeviceTelemetry{DeviceID: device.ID, Source: db.TelemetrySourcePing, RTTMs: &rtt}); err != nil {
+		t.Fatalf("Failed to record telemetry: %v", err)
+	}
+	params := map[string]string{"id": fmt.Sprint(device.ID)}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/devices/1/health?hours=6", nil)
+	rr := httptest.NewRecorder()
+	handler.Health(rr, withURLParams(req, params))
+	assertStatus(t, rr, http.StatusOK)
+
+	var resp DeviceHealthResponse
+	decodeResponse(t, rr, &resp)
+	if resp.Status != "ok" || resp.Ping.Sent != 1 || resp.Ping.AvgRTTMs != 25 {
+		t.Errorf("Unexpected health %+v", resp)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/devices/1/health?hours=0", nil)
+	rr = httptest.NewRecorder()
+	handler.Health(rr, withURLParams(req, params))
+	assertStatus(t, rr, http.StatusBadRequest)
+}
+
+func TestProvisioningHandler_Beacon(t *testing.T) {
+	setup, handler := setupResponderTest(t)
+
+	beacon := func(query, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/provision/beacon?"+query, nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.Beacon(rr, req)
+		return rr
+	}
+
+	assertStatus(t, beacon("mac=000b82123456&firmware=1.0.11.3&uptime=3600", "192.168.1.50:5000"), http.StatusOK)
+	assertStatus(t, beacon("mac=000b82123456", "203.0.113.7:5000"), http.StatusForbidden)
+	assertStatus(t, beacon("mac=000b82ffffff", "192.168.1.50:5000"), http.StatusNotFound)
+	assertStatus(t, beacon("mac=000b82123456&uptime=soon", "192.168.1.50:5000"), http.StatusBadRequest)
+
+	// A forwarded LAN address from a public peer is not trusted
+	req := httptest.NewRequest(http.MethodGet, "/api/provision/beacon?mac=000b82123456", nil)
+	req.RemoteAddr = "203.0.113.7:5000"
+	req.Header.Set("X-Forwarded-For", "192.168.1.10")
+	rr := httptest.NewRecorder()
+	PeerAddrMiddleware(middleware.RealIP(http.HandlerFunc(handler.Beacon))).ServeHTTP(rr, req)
+	assertStatus(t, rr, http.StatusForbidden)
+
+	device, _ := setup.DB.Devices.GetByMAC(context.Background(), "000b82123456")
+	samples, err := setup.DB.DeviceTelemetry.ListSince(context.Background(), device.ID, time.Now().Add(-time.Hour))
+	if err != nil || len(samples) != 1 {
+		t.Fatalf("Expected one sample, got %d, %v", len(samples), err)
+	}
+	if samples[0].Firmware == nil || *samples[0].Firmware != "1.0.11.3" || *samples[0].UptimeSeconds != 3600 {
+		t.Errorf("Unexpected sample %+v", samples[0])
+	}
+}
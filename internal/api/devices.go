@@ -2,17 +2,22 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/btafoya/gosip/internal/config"
 	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
 	"github.com/btafoya/gosip/internal/models"
 	"github.com/btafoya/gosip/pkg/sip"
 	"github.com/go-chi/chi/v5"
 )
 
+// validDeviceTypes lists the device types accepted by the devices table
+var validDeviceTypes = map[string]bool{"grandstream": true, "softphone": true, "webrtc": true, "linphone": true}
+
 // DeviceHandler handles device-related API endpoints
 type DeviceHandler struct {
 	deps *Dependencies
@@ -37,6 +42,14 @@ type DeviceResponse struct {
 	Model              *string `json:"model,omitempty"`
 	ProvisioningStatus string  `json:"provisioning_status,omitempty"`
 	LastConfigFetch    *string `json:"last_config_fetch,omitempty"`
+	CallWaiting        bool    `json:"call_waiting"`
+	IntercomAllowed    bool    `json:"intercom_allowed"`
+	Extension          *string `json:"extension,omitempty"`
+	SIPMessaging       bool    `json:"sip_messaging"`
+	ComfortNoise       bool    `json:"comfort_noise"`
+	AnonymousCalls     bool    `json:"anonymous_calls"`
+	TenantID           *int64  `json:"tenant_id,omitempty"`
+	GeneratedPassword  string  `json:"generated_password,omitempty"` // Only returned when the password was just generated
 }
 
 // List returns all devices
@@ -51,14 +64,21 @@ func (h *DeviceHandler) List(w http.ResponseWriter, r *http.Request) {
 		limit = config.MaxPageSize
 	}
 
-	devices, err := h.deps.DB.Devices.List(r.Context(), limit, offset)
+	var devices []*models.Device
+	var total int
+	var err error
+	if tenantID := tenantOf(r); tenantID != nil {
+		devices, err = h.deps.DB.Devices.ListByTenant(r.Context(), *tenantID, limit, offset)
+		total, _ = h.deps.DB.Devices.CountByTenant(r.Context(), *tenantID)
+	} else {
+		devices, err = h.deps.DB.Devices.List(r.Context(), limit, offset)
+		total, _ = h.deps.DB.Devices.Count(r.Context())
+	}
 	if err != nil {
 		WriteInternalError(w)
 		return
 	}
 
-	total, _ := h.deps.DB.Devices.Count(r.Context())
-
 	// Get registration status for each device
 	var response []*DeviceResponse
 	for _, d := range devices {
@@ -77,9 +97,17 @@ type CreateDeviceRequest struct {
 	Name             string `json:"name"`
 	Username         string `json:"username"`
 	Password         string `json:"password"`
+	GeneratePassword bool   `json:"generate_password"` // Generate a password that meets the password policy
 	DeviceType       string `json:"device_type"`
 	RecordingEnabled bool   `json:"recording_enabled"`
 	UserID           *int64 `json:"user_id,omitempty"`
+	CallWaiting      *bool  `json:"call_waiting,omitempty"` // Defaults to enabled
+	IntercomAllowed  bool   `json:"intercom_allowed"`
+	Extension        string `json:"extension,omitempty"`
+	SIPMessaging     bool   `json:"sip_messaging"`
+	ComfortNoise     *bool  `json:"comfort_noise,omitempty"`   // Defaults to enabled
+	AnonymousCalls   *bool  `json:"anonymous_calls,omitempty"` // Defaults to allowed; only admins set it
+	TenantID         *int64 `json:"tenant_id,omitempty"`       // Defaults to the user's own; only instance admins set it
 }
 
 // Create creates a new device
@@ -98,22 +126,37 @@ func (h *DeviceHandler) Create(w http.ResponseWriter, r *http.Request) {
 	if req.Username == "" {
 		errors = append(errors, FieldError{Field: "username", Message: "Username is required"})
 	}
-	if req.Password == "" {
+	if req.Password == "" && !req.GeneratePassword {
 		errors = append(errors, FieldError{Field: "password", Message: "Password is required"})
+	} else if req.Password != "" {
+		errors = append(errors, checkPassword(r.Context(), h.deps, "password", req.Password)...)
 	}
 	if req.DeviceType == "" {
 		req.DeviceType = "softphone"
 	}
-	validTypes := map[string]bool{"grandstream": true, "softphone": true, "webrtc": true, "linphone": true}
-	if !validTypes[req.DeviceType] {
+	if !validDeviceTypes[req.DeviceType] {
 		errors = append(errors, FieldError{Field: "device_type", Message: "Invalid device type"})
 	}
+	if req.Extension != "" && !sip.ValidExtension(req.Extension) {
+		errors = append(errors, extensionFieldError())
+	}
 
 	if len(errors) > 0 {
 		WriteValidationError(w, "Validation failed", errors)
 		return
 	}
 
+	var generated string
+	if req.Password == "" {
+		password, err := generateDevicePassword(r.Context(), h.deps)
+		if err != nil {
+			WriteInternalError(w)
+			return
+		}
+		req.Password = password
+		generated = password
+	}
+
 	// Generate HA1 hash for SIP authentication
 	ha1 := sip.GenerateHA1(req.Username, "gosip", req.Password)
 
@@ -124,12 +167,46 @@ func (h *DeviceHandler) Create(w http.ResponseWriter, r *http.Request) {
 		DeviceType:       req.DeviceType,
 		RecordingEnabled: req.RecordingEnabled,
 		UserID:           req.UserID,
+		CallWaiting:      true,
+		IntercomAllowed:  req.IntercomAllowed,
+		SIPMessaging:     req.SIPMessaging,
+		ComfortNoise:     true,
+		AnonymousCalls:   true,
+		TenantID:         tenantOf(r),
+	}
+	if req.TenantID != nil {
+		var ok bool
+		if device.TenantID, ok = tenantField(w, r, h.deps, *req.TenantID); !ok {
+			return
+		}
+	}
+	if !h.userInTenant(r, device.UserID, device.TenantID) {
+		WriteValidationError(w, "Validation failed", []FieldError{deviceUserFieldError})
+		return
+	}
+	if req.CallWaiting != nil {
+		device.CallWaiting = *req.CallWaiting
+	}
+	if req.ComfortNoise != nil {
+		device.ComfortNoise = *req.ComfortNoise
+	}
+	if req.AnonymousCalls != nil {
+		if user := GetUserFromContext(r.Context()); user == nil || user.Role != "admin" {
+			WriteForbiddenError(w)
+			return
+		}
+		device.AnonymousCalls = *req.AnonymousCalls
+	}
+	if req.Extension != "" {
+		device.Extension = &req.Extension
 	}
 
 	if err := h.deps.DB.Devices.Create(r.Context(), device); err != nil {
 		errMsg := err.Error()
 		// Check for specific SQLite constraint errors
-		if strings.Contains(errMsg, "UNIQUE constraint failed") {
+		if strings.Contains(errMsg, "idx_devices_extension") {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "Device with this extension already exists", nil)
+		} else if strings.Contains(errMsg, "UNIQUE constraint failed") {
 			WriteError(w, http.StatusConflict, ErrCodeConflict, "Device with this username already exists", nil)
 		} else if strings.Contains(errMsg, "CHECK constraint failed") {
 			WriteError(w, http.StatusBadRequest, ErrCodeValidation, "Invalid device type", nil)
@@ -139,7 +216,9 @@ func (h *DeviceHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	WriteJSON(w, http.StatusCreated, toDeviceResponse(device, false))
+	resp := toDeviceResponse(device, false)
+	resp.GeneratedPassword = generated
+	WriteJSON(w, http.StatusCreated, resp)
 }
 
 // Get returns a specific device
@@ -151,6 +230,9 @@ func (h *DeviceHandler) Get(w http.ResponseWriter, r *http.Request) {
 	}
 
 	device, err := h.deps.DB.Devices.GetByID(r.Context(), id)
+	if err == nil && !visibleTo(r, device.TenantID) {
+		err = db.ErrDeviceNotFound
+	}
 	if err != nil {
 		if err == db.ErrDeviceNotFound {
 			WriteNotFoundError(w, "Device")
@@ -171,11 +253,19 @@ func (h *DeviceHandler) Get(w http.ResponseWriter, r *http.Request) {
 type UpdateDeviceRequest struct {
 	Name             string  `json:"name,omitempty"`
 	Password         string  `json:"password,omitempty"`
+	GeneratePassword bool    `json:"generate_password,omitempty"` // Replace the password with a generated one
 	DeviceType       string  `json:"device_type,omitempty"`
 	RecordingEnabled *bool   `json:"recording_enabled,omitempty"`
 	UserID           *int64  `json:"user_id,omitempty"`
 	Vendor           *string `json:"vendor,omitempty"`
 	Model            *string `json:"model,omitempty"`
+	CallWaiting      *bool   `json:"call_waiting,omitempty"`
+	IntercomAllowed  *bool   `json:"intercom_allowed,omitempty"`
+	Extension        *string `json:"extension,omitempty"` // Empty string removes the extension
+	SIPMessaging     *bool   `json:"sip_messaging,omitempty"`
+	ComfortNoise     *bool   `json:"comfort_noise,omitempty"`
+	AnonymousCalls   *bool   `json:"anonymous_calls,omitempty"` // Only admins change it
+	TenantID         *int64  `json:"tenant_id,omitempty"`       // Only instance admins move a device; 0 moves it to the instance
 }
 
 // Update updates a device
@@ -187,6 +277,9 @@ func (h *DeviceHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	device, err := h.deps.DB.Devices.GetByID(r.Context(), id)
+	if err == nil && !visibleTo(r, device.TenantID) {
+		err = db.ErrDeviceNotFound
+	}
 	if err != nil {
 		if err == db.ErrDeviceNotFound {
 			WriteNotFoundError(w, "Device")
@@ -205,7 +298,21 @@ func (h *DeviceHandler) Update(w http.ResponseWriter, r *http.Request) {
 	if req.Name != "" {
 		device.Name = req.Name
 	}
+	var generated string
+	if req.Password == "" && req.GeneratePassword {
+		if generated, err = generateDevicePassword(r.Context(), h.deps); err != nil {
+			WriteInternalError(w)
+			return
+		}
+		req.Password = generated
+	}
 	if req.Password != "" {
+		if generated == "" {
+			if errors := checkPassword(r.Context(), h.deps, "password", req.Password); len(errors) > 0 {
+				WriteValidationError(w, "Validation failed", errors)
+				return
+			}
+		}
 		device.PasswordHash = sip.GenerateHA1(device.Username, "gosip", req.Password)
 	}
 	if req.DeviceType != "" {
@@ -223,17 +330,130 @@ func (h *DeviceHandler) Update(w http.ResponseWriter, r *http.Request) {
 	if req.Model != nil {
 		device.Model = req.Model
 	}
+	if req.CallWaiting != nil {
+		device.CallWaiting = *req.CallWaiting
+	}
+	if req.IntercomAllowed != nil {
+		device.IntercomAllowed = *req.IntercomAllowed
+	}
+	if req.SIPMessaging != nil {
+		device.SIPMessaging = *req.SIPMessaging
+	}
+	if req.ComfortNoise != nil {
+		device.ComfortNoise = *req.ComfortNoise
+	}
+	if req.AnonymousCalls != nil {
+		if user := GetUserFromContext(r.Context()); user == nil || user.Role != "admin" {
+			WriteForbiddenError(w)
+			return
+		}
+		device.AnonymousCalls = *req.AnonymousCalls
+	}
+	if req.Extension != nil {
+		switch {
+		case *req.Extension == "":
+			device.Extension = nil
+		case sip.ValidExtension(*req.Extension):
+			device.Extension = req.Extension
+		default:
+			WriteValidationError(w, "Validation failed", []FieldError{extensionFieldError()})
+			return
+		}
+	}
+	tenantID := device.TenantID
+	if req.TenantID != nil {
+		var ok bool
+		if tenantID, ok = tenantField(w, r, h.deps, *req.TenantID); !ok {
+			return
+		}
+	}
+	if !h.userInTenant(r, device.UserID, tenantID) {
+		WriteValidationError(w, "Validation failed", []FieldError{deviceUserFieldError})
+		return
+	}
 
 	if err := h.deps.DB.Devices.Update(r.Context(), device); err != nil {
+		if strings.Contains(err.Error(), "idx_devices_extension") {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "Device with this extension already exists", nil)
+			return
+		}
 		WriteInternalError(w)
 		return
 	}
+	if !sameTenant(tenantID, device.TenantID) {
+		if err := h.deps.DB.Devices.SetTenant(r.Context(), device.ID, tenantID); err != nil {
+			WriteInternalError(w)
+			return
+		}
+		device.TenantID = tenantID
+	}
 
 	online := false
 	if h.deps.SIP != nil && h.deps.SIP.GetRegistrar() != nil {
 		online = h.deps.SIP.GetRegistrar().IsRegistered(r.Context(), device.ID)
 	}
-	WriteJSON(w, http.StatusOK, toDeviceResponse(device, online))
+	resp := toDeviceResponse(device, online)
+	resp.GeneratedPassword = generated
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// RotateCredentialsResponse carries a device's new SIP password. It is only
+// returned once, when the password is rotated.
+type RotateCredentialsResponse struct {
+	DeviceID int64  `json:"device_id"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// RotateCredentials replaces a device's SIP password with a generated one
+// that meets the password policy, and publishes a device.reprovision event
+// so the phone can be set up with it
+func (h *DeviceHandler) RotateCredentials(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid device ID", nil)
+		return
+	}
+
+	device, err := h.deps.DB.Devices.GetByID(r.Context(), id)
+	if err == nil && !visibleTo(r, device.TenantID) {
+		err = db.ErrDeviceNotFound
+	}
+	if err != nil {
+		if err == db.ErrDeviceNotFound {
+			WriteNotFoundError(w, "Device")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	password, err := generateDevicePassword(r.Context(), h.deps)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	device.PasswordHash = sip.GenerateHA1(device.Username, "gosip", password)
+	if err := h.deps.DB.Devices.Update(r.Context(), device); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	h.deps.DB.DeviceEvents.LogEvent(r.Context(), device.ID, "info", map[string]interface{}{
+		"action": "credentials_rotated",
+	}, r.RemoteAddr, r.UserAgent())
+	h.deps.Events.Publish(events.TypeDeviceReprovision, map[string]interface{}{
+		"device_id": device.ID,
+		"username":  device.Username,
+		"reason":    "credentials_rotated",
+	})
+
+	WriteJSON(w, http.StatusOK, RotateCredentialsResponse{
+		DeviceID: device.ID,
+		Username: device.Username,
+		Password: password,
+	})
 }
 
 // Delete removes a device
@@ -244,6 +464,11 @@ func (h *DeviceHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if device, err := h.deps.DB.Devices.GetByID(r.Context(), id); err == nil && !visibleTo(r, device.TenantID) {
+		WriteNotFoundError(w, "Device")
+		return
+	}
+
 	if err := h.deps.DB.Devices.Delete(r.Context(), id); err != nil {
 		WriteInternalError(w)
 		return
@@ -252,6 +477,114 @@ func (h *DeviceHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, http.StatusOK, map[string]string{"message": "Device deleted successfully"})
 }
 
+// DeviceDIDsRequest sets the DIDs a device may present as outbound caller ID
+type DeviceDIDsRequest struct {
+	DIDIDs       []int64 `json:"did_ids"`
+	DefaultDIDID *int64  `json:"default_did_id,omitempty"`
+}
+
+// ListDIDs returns the DIDs a device may present as outbound caller ID
+func (h *DeviceHandler) ListDIDs(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid device ID", nil)
+		return
+	}
+
+	device, err := h.deps.DB.Devices.GetByID(r.Context(), id)
+	if err == nil && !visibleTo(r, device.TenantID) {
+		err = db.ErrDeviceNotFound
+	}
+	if err != nil {
+		if err == db.ErrDeviceNotFound {
+			WriteNotFoundError(w, "Device")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	h.writeDeviceDIDs(w, r, id)
+}
+
+// SetDIDs replaces the DIDs a device may present as outbound caller ID
+func (h *DeviceHandler) SetDIDs(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid device ID", nil)
+		return
+	}
+
+	device, err := h.deps.DB.Devices.GetByID(r.Context(), id)
+	if err == nil && !visibleTo(r, device.TenantID) {
+		err = db.ErrDeviceNotFound
+	}
+	if err != nil {
+		if err == db.ErrDeviceNotFound {
+			WriteNotFoundError(w, "Device")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	var req DeviceDIDsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	var errors []FieldError
+	seen := make(map[int64]bool)
+	for _, didID := range req.DIDIDs {
+		if seen[didID] {
+			errors = append(errors, FieldError{Field: "did_ids", Message: "DIDs must not repeat"})
+			break
+		}
+		seen[didID] = true
+		did, err := h.deps.DB.DIDs.GetByID(r.Context(), didID)
+		if err == nil && !sameTenant(did.TenantID, device.TenantID) {
+			err = db.ErrDIDNotFound
+		}
+		if err != nil {
+			if err == db.ErrDIDNotFound {
+				errors = append(errors, FieldError{Field: "did_ids", Message: fmt.Sprintf("DID %d not found", didID)})
+				continue
+			}
+			WriteInternalError(w)
+			return
+		}
+	}
+	if req.DefaultDIDID != nil && !seen[*req.DefaultDIDID] {
+		errors = append(errors, FieldError{Field: "default_did_id", Message: "Default DID must be one of did_ids"})
+	}
+	if len(errors) > 0 {
+		WriteValidationError(w, "Validation failed", errors)
+		return
+	}
+
+	if err := h.deps.DB.DeviceDIDs.SetForDevice(r.Context(), id, req.DIDIDs, req.DefaultDIDID); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	h.writeDeviceDIDs(w, r, id)
+}
+
+// writeDeviceDIDs responds with a device's DIDs in position order
+func (h *DeviceHandler) writeDeviceDIDs(w http.ResponseWriter, r *http.Request, deviceID int64) {
+	dids, err := h.deps.DB.DeviceDIDs.ListByDevice(r.Context(), deviceID)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if dids == nil {
+		dids = []*models.DeviceDID{}
+	}
+
+	WriteJSON(w, http.StatusOK, dids)
+}
+
 // GetRegistrations returns all active SIP registrations
 func (h *DeviceHandler) GetRegistrations(w http.ResponseWriter, r *http.Request) {
 	if h.deps.SIP == nil {
@@ -267,6 +600,37 @@ func (h *DeviceHandler) GetRegistrations(w http.ResponseWriter, r *http.Request)
 	WriteJSON(w, http.StatusOK, registrations)
 }
 
+// GetSubscriptions returns the active SIP event subscriptions: message
+// waiting (message-summary) and registration state (reg)
+func (h *DeviceHandler) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if h.deps.SIP == nil {
+		WriteJSON(w, http.StatusOK, []interface{}{})
+		return
+	}
+	WriteJSON(w, http.StatusOK, h.deps.SIP.ListSubscriptions())
+}
+
+// deviceUserFieldError is returned when a device's user is of another tenant
+var deviceUserFieldError = FieldError{Field: "user_id", Message: "User must belong to the device's tenant"}
+
+// userInTenant reports whether the user with userID may own a device of a
+// tenant. Unknown users are left for the database to reject.
+func (h *DeviceHandler) userInTenant(r *http.Request, userID, tenantID *int64) bool {
+	if userID == nil {
+		return true
+	}
+	user, err := h.deps.DB.Users.GetByID(r.Context(), *userID)
+	return err != nil || sameTenant(user.TenantID, tenantID)
+}
+
+// extensionFieldError describes the internal numbering plan
+func extensionFieldError() FieldError {
+	return FieldError{
+		Field:   "extension",
+		Message: fmt.Sprintf("Extension must be %d to %d digits", config.MinExtensionLength, config.MaxExtensionLength),
+	}
+}
+
 func toDeviceResponse(device *models.Device, online bool) *DeviceResponse {
 	resp := &DeviceResponse{
 		ID:                 device.ID,
@@ -280,6 +644,13 @@ func toDeviceResponse(device *models.Device, online bool) *DeviceResponse {
 		Vendor:             device.Vendor,
 		Model:              device.Model,
 		ProvisioningStatus: device.ProvisioningStatus,
+		CallWaiting:        device.CallWaiting,
+		IntercomAllowed:    device.IntercomAllowed,
+		Extension:          device.Extension,
+		SIPMessaging:       device.SIPMessaging,
+		ComfortNoise:       device.ComfortNoise,
+		AnonymousCalls:     device.AnonymousCalls,
+		TenantID:           device.TenantID,
 	}
 	if device.LastConfigFetch != nil {
 		formatted := device.LastConfigFetch.Format("2006-01-02T15:04:05Z")
@@ -6,9 +6,14 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/events"
 	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/pkg/sip"
 )
 
 func TestDeviceHandler_List(t *testing.T) {
@@ -145,6 +150,15 @@ func TestDeviceHandler_Create_DefaultDeviceType(t *testing.T) {
 	if resp.DeviceType != "softphone" {
 		t.Errorf("Expected default device type 'softphone', got %s", resp.DeviceType)
 	}
+	if !resp.CallWaiting {
+		t.Error("Expected call waiting to be enabled by default")
+	}
+	if !resp.ComfortNoise {
+		t.Error("Expected comfort noise to be enabled by default")
+	}
+	if !resp.AnonymousCalls {
+		t.Error("Expected anonymous calls to be allowed by default")
+	}
 }
 
 func TestDeviceHandler_Create_ValidationError(t *testing.T) {
@@ -307,6 +321,38 @@ func TestDeviceHandler_Update(t *testing.T) {
 	}
 }
 
+func TestDeviceHandler_Update_AnonymousCalls(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB, SIP: nil}
+	handler := NewDeviceHandler(deps)
+
+	device := createTestDevice(t, setup.DB, "Desk", "desk")
+	user := createTestUser(t, setup.DB, "user@example.com", "password123", "user")
+	admin := createTestUser(t, setup.DB, "admin@example.com", "password123", "admin")
+
+	update := func(as *models.User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/devices/1", bytes.NewBufferString(`{"anonymous_calls": true}`))
+		req = withURLParams(req, map[string]string{"id": "1"})
+		req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, as))
+		rr := httptest.NewRecorder()
+		handler.Update(rr, req)
+		return rr
+	}
+
+	// Only admins decide whether a device may hide its caller ID
+	assertStatus(t, update(user), http.StatusForbidden)
+	rr := update(admin)
+	assertStatus(t, rr, http.StatusOK)
+	var resp DeviceResponse
+	decodeResponse(t, rr, &resp)
+	if !resp.AnonymousCalls {
+		t.Error("Expected anonymous calls allowed")
+	}
+	if saved, _ := setup.DB.Devices.GetByID(context.Background(), device.ID); !saved.AnonymousCalls {
+		t.Error("Expected the policy saved")
+	}
+}
+
 func TestDeviceHandler_Update_NotFound(t *testing.T) {
 	setup := setupTestAPI(t)
 	deps := &Dependencies{DB: setup.DB, SIP: nil}
@@ -375,6 +421,21 @@ func TestDeviceHandler_GetRegistrations(t *testing.T) {
 	assertStatus(t, rr, http.StatusOK)
 }
 
+func TestDeviceHandler_GetSubscriptions(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB, SIP: nil}
+	handler := NewDeviceHandler(deps)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/devices/subscriptions", nil)
+	rr := httptest.NewRecorder()
+	handler.GetSubscriptions(rr, req)
+
+	assertStatus(t, rr, http.StatusOK)
+	if body := strings.TrimSpace(rr.Body.String()); body != "[]" {
+		t.Errorf("Expected an empty list without SIP, got %s", body)
+	}
+}
+
 func TestDeviceResponse_Format(t *testing.T) {
 	device := &models.Device{
 		ID:               1,
@@ -415,7 +476,7 @@ func TestDeviceHandler_Create_ValidDeviceTypes(t *testing.T) {
 			reqBody := CreateDeviceRequest{
 				Name:       "Test Device",
 				Username:   "user_" + deviceType,
-				Password:   "password123",
+				Password:   "violet-harbor-42",
 				DeviceType: deviceType,
 			}
 			body, _ := json.Marshal(reqBody)
@@ -437,3 +498,155 @@ func TestDeviceHandler_Create_ValidDeviceTypes(t *testing.T) {
 		})
 	}
 }
+
+func TestDeviceHandler_Extension(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB, SIP: nil}
+	handler := NewDeviceHandler(deps)
+
+	create := func(username, extension string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(CreateDeviceRequest{
+			Name:      username,
+			Username:  username,
+			Password:  "secretpassword",
+			Extension: extension,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/devices", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		handler.Create(rr, req)
+		return rr
+	}
+
+	rr := create("desk1", "201")
+	assertStatus(t, rr, http.StatusCreated)
+	var resp DeviceResponse
+	decodeResponse(t, rr, &resp)
+	if resp.Extension == nil || *resp.Extension != "201" {
+		t.Errorf("Expected extension 201, got %v", resp.Extension)
+	}
+
+	assertStatus(t, create("desk2", "201"), http.StatusConflict)
+	assertStatus(t, create("desk3", "20"), http.StatusBadRequest)
+	assertStatus(t, create("desk4", "2a1"), http.StatusBadRequest)
+
+	// An empty extension removes it
+	empty := ""
+	body, _ := json.Marshal(UpdateDeviceRequest{Extension: &empty})
+	req := httptest.NewRequest(http.MethodPut, "/api/devices/1", bytes.NewBuffer(body))
+	req = withURLParams(req, map[string]string{"id": "1"})
+	rr = httptest.NewRecorder()
+	handler.Update(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+
+	device, err := setup.DB.Devices.GetByID(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if device.Extension != nil {
+		t.Errorf("Expected extension to be removed, got %s", *device.Extension)
+	}
+}
+
+func TestDeviceHandler_SetDIDs(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB, SIP: nil}
+	handler := NewDeviceHandler(deps)
+
+	device := createTestDevice(t, setup.DB, "Shared Phone", "shared")
+	sales := createTestDID(t, setup.DB, "+15551110000")
+	support := createTestDID(t, setup.DB, "+15552220000")
+
+	put := func(reqBody DeviceDIDsRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(reqBody)
+		req := httptest.NewRequest(http.MethodPut, "/api/devices/1/dids", bytes.NewBuffer(body))
+		req = withURLParams(req, map[string]string{"id": "1"})
+		rr := httptest.NewRecorder()
+		handler.SetDIDs(rr, req)
+		return rr
+	}
+
+	rr := put(DeviceDIDsRequest{DIDIDs: []int64{sales.ID, support.ID}, DefaultDIDID: &support.ID})
+	assertStatus(t, rr, http.StatusOK)
+
+	var dids []models.DeviceDID
+	decodeResponse(t, rr, &dids)
+	if len(dids) != 2 {
+		t.Fatalf("Expected 2 DIDs, got %d", len(dids))
+	}
+	if dids[0].Number != "+15551110000" || dids[0].Position != 1 || dids[0].IsDefault {
+		t.Errorf("Unexpected first DID: %+v", dids[0])
+	}
+	if dids[1].DeviceID != device.ID || !dids[1].IsDefault {
+		t.Errorf("Expected second DID to be the default: %+v", dids[1])
+	}
+
+	missing := int64(99)
+	assertStatus(t, put(DeviceDIDsRequest{DIDIDs: []int64{sales.ID, missing}}), http.StatusBadRequest)
+	assertStatus(t, put(DeviceDIDsRequest{DIDIDs: []int64{sales.ID, sales.ID}}), http.StatusBadRequest)
+	assertStatus(t, put(DeviceDIDsRequest{DIDIDs: []int64{sales.ID}, DefaultDIDID: &support.ID}), http.StatusBadRequest)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/devices/2/dids", nil)
+	req = withURLParams(req, map[string]string{"id": "2"})
+	rr = httptest.NewRecorder()
+	handler.ListDIDs(rr, req)
+	assertStatus(t, rr, http.StatusNotFound)
+}
+
+func TestDeviceHandler_Create_WeakPassword(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB}
+	handler := NewDeviceHandler(deps)
+
+	body, _ := json.Marshal(CreateDeviceRequest{Name: "Desk Phone", Username: "desk", Password: "1234"})
+	req := httptest.NewRequest(http.MethodPost, "/api/devices", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler.Create(rr, req)
+
+	assertStatus(t, rr, http.StatusBadRequest)
+	assertErrorCode(t, rr, ErrCodeValidation)
+}
+
+func TestDeviceHandler_RotateCredentials(t *testing.T) {
+	setup := setupTestAPI(t)
+	hub := events.NewHub(10)
+	deps := &Dependencies{DB: setup.DB, Events: hub}
+	handler := NewDeviceHandler(deps)
+
+	device := createTestDevice(t, setup.DB, "Desk Phone", "desk")
+	_, stream, cancel := hub.Subscribe(0)
+	defer cancel()
+
+	id := strconv.FormatInt(device.ID, 10)
+	req := withURLParams(httptest.NewRequest(http.MethodPost, "/api/devices/"+id+"/credentials/rotate", nil), map[string]string{"id": id})
+	rr := httptest.NewRecorder()
+	handler.RotateCredentials(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+
+	var resp RotateCredentialsResponse
+	decodeResponse(t, rr, &resp)
+	if resp.Username != "desk" || len(resp.Password) < config.GeneratedPasswordLength {
+		t.Fatalf("Unexpected rotation response %+v", resp)
+	}
+
+	updated, err := setup.DB.Devices.GetByID(context.Background(), device.ID)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if updated.PasswordHash != sip.GenerateHA1("desk", "gosip", resp.Password) {
+		t.Error("Expected the device hash to match the rotated password")
+	}
+
+	select {
+	case e := <-stream:
+		if e.Type != events.TypeDeviceReprovision {
+			t.Errorf("Expected %s event, got %s", events.TypeDeviceReprovision, e.Type)
+		}
+	default:
+		t.Error("Expected a reprovision event")
+	}
+
+	req = withURLParams(httptest.NewRequest(http.MethodPost, "/api/devices/999/credentials/rotate", nil), map[string]string{"id": "999"})
+	rr = httptest.NewRecorder()
+	handler.RotateCredentials(rr, req)
+	assertStatus(t, rr, http.StatusNotFound)
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/diagnostics"
+	"github.com/btafoya/gosip/internal/logging"
+	"github.com/go-chi/chi/v5"
+)
+
+// RecoverMiddleware answers a panicking request with a 500 and records the
+// panic with its stack trace for the diagnostics bundle
+func RecoverMiddleware(deps *Dependencies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				// Aborted responses are how handlers drop a connection on purpose
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				deps.Diagnostics.RecordPanic("http "+r.Method+" "+routeOf(r), v, debug.Stack())
+				if r.Header.Get("Connection") != "Upgrade" {
+					WriteInternalError(w)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// routeOf returns the matched route pattern, which unlike the path doesn't
+// include tokens and IDs
+func routeOf(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return r.URL.Path
+}
+
+// DiagnosticsHandler builds support bundles for issue reports
+type DiagnosticsHandler struct {
+	deps      *Dependencies
+	startTime time.Time
+}
+
+// NewDiagnosticsHandler creates a new DiagnosticsHandler
+func NewDiagnosticsHandler(deps *Dependencies) *DiagnosticsHandler {
+	return &DiagnosticsHandler{deps: deps, startTime: time.Now()}
+}
+
+// DiagnosticsBundle is everything a support request needs, with
+// credentials redacted
+type DiagnosticsBundle struct {
+	GeneratedAt time.Time           `json:"generated_at"`
+	Version     string              `json:"version"`
+	Runtime     DiagnosticsRuntime  `json:"runtime"`
+	Config      interface{}         `json:"config"`
+	Settings    interface{}         `json:"settings"`
+	SIP         DiagnosticsSIP      `json:"sip"`
+	Trunk       string              `json:"trunk"`
+	Database    *db.Stats           `json:"database,omitempty"`
+	LogLevels   []logging.Level     `json:"log_levels,omitempty"`
+	Crashes     []diagnostics.Crash `json:"crashes"`
+	Logs        []json.RawMessage   `json:"logs"`
+}
+
+// DiagnosticsRuntime describes the process
+type DiagnosticsRuntime struct {
+	GoVersion     string `json:"go_version"`
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+	CPUs          int    `json:"cpus"`
+	Goroutines    int    `json:"goroutines"`
+	HeapBytes     uint64 `json:"heap_bytes"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+}
+
+// DiagnosticsSIP describes the SIP server
+type DiagnosticsSIP struct {
+	Running       bool `json:"running"`
+	Registrations int  `json:"registrations"`
+	ActiveCalls   int  `json:"active_calls"`
+}
+
+// Bundle returns the support bundle (admin only). With ?download=true it is
+// sent as a file attachment.
+func (h *DiagnosticsHandler) Bundle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	bundle := DiagnosticsBundle{
+		GeneratedAt: time.Now().UTC(),
+		Version:     "1.0.0",
+		Runtime: DiagnosticsRuntime{
+			GoVersion:     runtime.Version(),
+			OS:            runtime.GOOS,
+			Arch:          runtime.GOARCH,
+			CPUs:          runtime.NumCPU(),
+			Goroutines:    runtime.NumGoroutine(),
+			HeapBytes:     mem.HeapAlloc,
+			UptimeSeconds: int64(time.Since(h.startTime).Seconds()),
+		},
+		Trunk:   "not_configured",
+		Crashes: h.deps.Diagnostics.Crashes(),
+		Logs:    h.deps.Diagnostics.Logs(),
+	}
+
+	config, err := diagnostics.Redact(h.deps.Config)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	bundle.Config = config
+
+	settings := make(map[string]string)
+	if all, err := h.deps.DB.Config.GetAll(ctx); err == nil {
+		for _, setting := range all {
+			settings[setting.Key] = setting.Value
+		}
+	}
+	if bundle.Settings, err = diagnostics.Redact(settings); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	if h.deps.SIP != nil && h.deps.SIP.IsRunning() {
+		bundle.SIP = DiagnosticsSIP{
+			Running:       true,
+			Registrations: h.deps.SIP.GetRegistrar().GetRegistrationCount(),
+			ActiveCalls:   h.deps.SIP.GetActiveCallCount(),
+		}
+	}
+	if h.deps.Twilio != nil {
+		bundle.Trunk = "healthy"
+		if !h.deps.Twilio.IsHealthy() {
+			bundle.Trunk = "degraded"
+		}
+	}
+	if stats, err := h.deps.DB.Stats(ctx); err == nil {
+		bundle.Database = stats
+	}
+	if h.deps.Logging != nil {
+		bundle.LogLevels = h.deps.Logging.Snapshot()
+	}
+	if bundle.Crashes == nil {
+		bundle.Crashes = []diagnostics.Crash{}
+	}
+	if bundle.Logs == nil {
+		bundle.Logs = []json.RawMessage{}
+	}
+
+	if r.URL.Query().Get("download") == "true" {
+		w.Header().Set("Content-Disposition",
+			`attachment; filename="gosip-diagnostics-`+bundle.GeneratedAt.Format("20060102-150405")+`.json"`)
+	}
+	WriteJSON(w, http.StatusOK, bundle)
+}
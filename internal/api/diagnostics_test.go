@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/diagnostics"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	store := diagnostics.NewStore(10, 10)
+	r := chi.NewRouter()
+	r.Use(RecoverMiddleware(&Dependencies{Diagnostics: store}))
+	r.Get("/api/provisioning/{token}", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/provisioning/abc123", nil))
+
+	assertStatus(t, rr, http.StatusInternalServerError)
+	assertErrorCode(t, rr, ErrCodeInternal)
+	crashes := store.Crashes()
+	if len(crashes) != 1 || crashes[0].Source != "http GET /api/provisioning/{token}" || crashes[0].Panic != "boom" {
+		t.Errorf("Expected the panic recorded under its route, got %+v", crashes)
+	}
+}
+
+func TestDiagnosticsHandler_Bundle(t *testing.T) {
+	setup := setupTestAPI(t)
+	store := diagnostics.NewStore(10, 10)
+	slog.New(store.LogHandler()).Info("Call answered", "call_sid", "CA123")
+	func() {
+		defer store.Recover("sip INVITE")
+		panic("nil session")
+	}()
+	setup.DB.Config.Set(context.Background(), "twilio_auth_token", "s3cret")
+
+	handler := NewDiagnosticsHandler(&Dependencies{
+		DB:          setup.DB,
+		Twilio:      setup.Twilio,
+		Diagnostics: store,
+		Config:      &config.Config{SIPPort: 5060, TwilioAuthToken: "s3cret", SMTPPassword: "hunter2"},
+	})
+
+	rr := httptest.NewRecorder()
+	handler.Bundle(rr, httptest.NewRequest(http.MethodGet, "/api/system/diagnostics?download=true", nil))
+	assertStatus(t, rr, http.StatusOK)
+
+	if !strings.HasPrefix(rr.Header().Get("Content-Disposition"), `attachment; filename="gosip-diagnostics-`) {
+		t.Errorf("Expected an attachment, got %q", rr.Header().Get("Content-Disposition"))
+	}
+	body := rr.Body.String()
+	for _, secret := range []string{"s3cret", "hunter2"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("Expected %q to be redacted from the bundle", secret)
+		}
+	}
+
+	var bundle struct {
+		Config   map[string]any   `json:"config"`
+		Database map[string]any   `json:"database"`
+		Crashes  []map[string]any `json:"crashes"`
+		Logs     []map[string]any `json:"logs"`
+		Trunk    string           `json:"trunk"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &bundle); err != nil {
+		t.Fatalf("Failed to decode bundle: %v", err)
+	}
+	if bundle.Config["SIPPort"] != float64(5060) || bundle.Config["TwilioAuthToken"] != diagnostics.Redacted {
+		t.Errorf("Expected redacted config, got %v", bundle.Config)
+	}
+	if bundle.Database["schema_version"] == nil {
+		t.Errorf("Expected database stats, got %v", bundle.Database)
+	}
+	if len(bundle.Crashes) != 1 || bundle.Crashes[0]["panic"] != "nil session" {
+		t.Errorf("Expected the recorded crash, got %v", bundle.Crashes)
+	}
+	if len(bundle.Logs) == 0 || bundle.Logs[0]["msg"] != "Call answered" {
+		t.Errorf("Expected recent logs, got %v", bundle.Logs)
+	}
+	if bundle.Trunk != "healthy" {
+		t.Errorf("Expected healthy trunk, got %q", bundle.Trunk)
+	}
+}
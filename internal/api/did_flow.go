@@ -0,0 +1,398 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/rules"
+	"github.com/go-chi/chi/v5"
+)
+
+// Flow node types
+const (
+	FlowNodeStart     = "start"
+	FlowNodeCheck     = "check"     // Blocklist and anonymous caller checks
+	FlowNodeCondition = "condition" // A route's condition
+	FlowNodeAction    = "action"    // What happens to the call
+)
+
+// FlowNode is a step an incoming call passes through
+type FlowNode struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Kind is the check, condition or action type, such as "blocklist",
+	// "time" or "ring"
+	Kind    string          `json:"kind,omitempty"`
+	Label   string          `json:"label"`
+	RouteID *int64          `json:"route_id,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"` // The route's condition or action data
+	// Disabled routes are listed without edges, since calls never reach them
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// FlowEdge leads from one node to the next when its outcome happens
+type FlowEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Outcome is "next", "blocked", "allowed", "anonymous", "recorded",
+	// "match", "no_match", "busy" or "no_answer"
+	Outcome string `json:"outcome"`
+}
+
+// DIDFlowResponse is the routing graph of a DID
+type DIDFlowResponse struct {
+	DIDID  int64  `json:"did_id"`
+	Number string `json:"number"`
+	// Timezone time conditions are evaluated in, unless they name their own
+	Timezone string     `json:"timezone"`
+	Nodes    []FlowNode `json:"nodes"`
+	Edges    []FlowEdge `json:"edges"`
+	// Warnings point out routes calls never reach and missing references
+	Warnings []string `json:"warnings"`
+}
+
+// flowVoicemail is the voicemail calls reach when nothing else answers
+const flowVoicemail = "voicemail"
+
+// Flow returns the routing logic of a DID as a graph of nodes and edges,
+// following the same order the voice webhook evaluates a call in
+func (h *DIDHandler) Flow(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid DID ID", nil)
+		return
+	}
+
+	ctx := r.Context()
+	did, err := h.deps.DB.DIDs.GetByID(ctx, id)
+	if err != nil {
+		if err == db.ErrDIDNotFound {
+			WriteNotFoundError(w, "DID")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	routes, err := h.deps.DB.Routes.GetByDID(ctx, did.ID)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, h.buildFlow(ctx, did, routes))
+}
+
+// flowBuilder collects the nodes and edges of a DID's flow
+type flowBuilder struct {
+	resp *DIDFlowResponse
+}
+
+func (b *flowBuilder) node(n FlowNode) string {
+	b.resp.Nodes = append(b.resp.Nodes, n)
+	return n.ID
+}
+
+func (b *flowBuilder) edge(from, to, outcome string) {
+	b.resp.Edges = append(b.resp.Edges, FlowEdge{From: from, To: to, Outcome: outcome})
+}
+
+func (b *flowBuilder) warn(format string, args ...interface{}) {
+	b.resp.Warnings = append(b.resp.Warnings, fmt.Sprintf(format, args...))
+}
+
+func (h *DIDHandler) buildFlow(ctx context.Context, did *models.DID, routes []*models.Route) *DIDFlowResponse {
+	system := h.deps.DB.Config.GetForTenant(ctx, did.TenantID, "timezone", "")
+	tz := did.Timezone
+	if tz == "" {
+		tz = system
+	}
+	if tz == "" {
+		tz = time.Local.String()
+	}
+
+	b := &flowBuilder{resp: &DIDFlowResponse{
+		DIDID:    did.ID,
+		Number:   did.Number,
+		Timezone: tz,
+		Nodes:    []FlowNode{},
+		Edges:    []FlowEdge{},
+		Warnings: []string{},
+	}}
+
+	start := b.node(FlowNode{ID: "start", Type: FlowNodeStart, Label: "Call to " + did.Number})
+	blocklist := b.node(FlowNode{ID: "blocklist", Type: FlowNodeCheck, Kind: "blocklist", Label: "Caller on blocklist?"})
+	b.edge(start, blocklist, "next")
+	b.edge(blocklist, b.node(FlowNode{ID: "blocked", Type: FlowNodeAction, Kind: "reject", Label: "Reject"}), "blocked")
+
+	// Routes are linked once their node IDs are known
+	var enabled []*models.Route
+	for _, route := range routes {
+		if route.Enabled {
+			enabled = append(enabled, route)
+		}
+	}
+	first := flowVoicemail
+	if len(enabled) > 0 {
+		first = routeNodeID(enabled[0])
+	}
+
+	// Anonymous callers are checked only when the DID has a policy for them
+	prev, outcome := blocklist, "allowed"
+	switch did.AnonymousAction {
+	case db.AnonymousActionReject, db.AnonymousActionChallenge:
+		anonymous := b.node(FlowNode{ID: "anonymous", Type: FlowNodeCheck, Kind: "anonymous", Label: "Caller ID withheld?"})
+		b.edge(prev, anonymous, outcome)
+		if did.AnonymousAction == db.AnonymousActionReject {
+			b.edge(anonymous, b.node(FlowNode{ID: "anonymous-action", Type: FlowNodeAction, Kind: "reject", Label: "Reject"}), "anonymous")
+		} else {
+			challenge := b.node(FlowNode{ID: "anonymous-action", Type: FlowNodeAction, Kind: "challenge", Label: "Ask caller to record their name"})
+			b.edge(anonymous, challenge, "anonymous")
+			b.edge(challenge, first, "recorded")
+		}
+		prev, outcome = anonymous, "next"
+	}
+	b.edge(prev, first, outcome)
+
+	var catchAll *models.Route
+	for i, route := range enabled {
+		next := flowVoicemail
+		if i+1 < len(enabled) {
+			next = routeNodeID(enabled[i+1])
+		}
+		if catchAll != nil {
+			b.warn("Route %q is never reached because route %q above it matches every call", route.Name, catchAll.Name)
+		}
+
+		cond := b.node(h.conditionNode(ctx, b, route))
+		action := b.node(h.actionNode(ctx, b, route))
+		b.edge(cond, action, "match")
+		if route.ConditionType != "default" {
+			b.edge(cond, next, "no_match")
+		} else if catchAll == nil && route.ActionType != "ring" && route.ActionType != "split" {
+			catchAll = route
+		}
+
+		switch route.ActionType {
+		case "ring", "split":
+			// Ring routes whose devices are all busy fall through to the next
+			// route, as do split routes that pick one
+			b.edge(cond, next, "busy")
+			b.edge(action, flowVoicemail, "no_answer")
+		case "oncall", "escalate":
+			b.edge(action, flowVoicemail, "no_answer")
+		}
+	}
+
+	b.node(FlowNode{ID: flowVoicemail, Type: FlowNodeAction, Kind: "voicemail", Label: "Voicemail"})
+
+	for _, route := range routes {
+		if !route.Enabled {
+			n := h.conditionNode(ctx, b, route)
+			n.Disabled = true
+			b.node(n)
+		}
+	}
+	return b.resp
+}
+
+func routeNodeID(route *models.Route) string {
+	return "route-" + strconv.FormatInt(route.ID, 10)
+}
+
+// conditionNode describes the condition a route's calls must meet
+func (h *DIDHandler) conditionNode(ctx context.Context, b *flowBuilder, route *models.Route) FlowNode {
+	id := route.ID
+	n := FlowNode{
+		ID:      routeNodeID(route),
+		Type:    FlowNodeCondition,
+		Kind:    route.ConditionType,
+		RouteID: &id,
+		Data:    route.ConditionData,
+	}
+
+	switch route.ConditionType {
+	case "default":
+		n.Label = "Every call"
+
+	case "callerid":
+		var c rules.CallerIDCondition
+		json.Unmarshal(route.ConditionData, &c)
+		switch {
+		case c.Anonymous:
+			n.Label = "Caller ID withheld"
+		case c.Community:
+			n.Label = "Caller on community blocklist"
+		default:
+			n.Label = "Caller ID contains " + c.Pattern
+		}
+
+	case "time":
+		var c rules.TimeCondition
+		json.Unmarshal(route.ConditionData, &c)
+		switch {
+		case c.BusinessHours:
+			n.Label = "Business hours (Mon-Fri 9:00-17:00)"
+		case c.AfterHours:
+			n.Label = "Outside business hours (Mon-Fri 9:00-17:00)"
+		default:
+			days := "Every day"
+			if len(c.Days) > 0 {
+				names := make([]string, 0, len(c.Days))
+				for _, d := range c.Days {
+					if d >= 0 && d <= 6 {
+						names = append(names, time.Weekday(d).String()[:3])
+					}
+				}
+				days = strings.Join(names, ", ")
+			}
+			n.Label = fmt.Sprintf("%s %d:00-%d:00", days, c.StartHour, c.EndHour)
+		}
+		if c.Timezone != "" {
+			n.Label += " " + c.Timezone
+		}
+
+	case "calendar":
+		var c rules.CalendarCondition
+		json.Unmarshal(route.ConditionData, &c)
+		state := "busy"
+		if c.Free {
+			state = "free"
+		}
+		user, err := h.deps.DB.Users.GetByID(ctx, c.UserID)
+		if err != nil {
+			b.warn("Route %q checks the calendar of user %d, who doesn't exist", route.Name, c.UserID)
+			n.Label = fmt.Sprintf("User %d is %s", c.UserID, state)
+		} else {
+			n.Label = user.Email + " is " + state
+		}
+
+	case "webhook":
+		condition, err := rules.ParseWebhookCondition(route.ConditionData)
+		if err != nil {
+			b.warn("Route %q has an invalid webhook condition: %v", route.Name, err)
+			n.Label = "Webhook"
+			break
+		}
+		host := condition.URL
+		if u, err := url.Parse(condition.URL); err == nil {
+			host = u.Host
+		}
+		fallback := condition.Fallback
+		if fallback == "" {
+			fallback = rules.VerdictSkip
+		}
+		n.Label = fmt.Sprintf("%s allows the call (fallback: %s)", host, fallback)
+
+	default:
+		n.Label = "Never matches"
+		b.warn("Route %q has an unknown condition type %q", route.Name, route.ConditionType)
+	}
+
+	if route.Name != "" {
+		n.Label = route.Name + ": " + n.Label
+	}
+	return n
+}
+
+// actionNode describes what a route does with the calls it matches
+func (h *DIDHandler) actionNode(ctx context.Context, b *flowBuilder, route *models.Route) FlowNode {
+	id := route.ID
+	n := FlowNode{
+		ID:      "action-" + strconv.FormatInt(route.ID, 10),
+		Type:    FlowNodeAction,
+		Kind:    route.ActionType,
+		RouteID: &id,
+		Data:    route.ActionData,
+	}
+
+	switch route.ActionType {
+	case "ring":
+		var a rules.RingAction
+		json.Unmarshal(route.ActionData, &a)
+		var names []string
+		for _, deviceID := range a.Devices {
+			device, err := h.deps.DB.Devices.GetByID(ctx, deviceID)
+			if err != nil {
+				b.warn("Route %q rings device %d, which doesn't exist", route.Name, deviceID)
+				continue
+			}
+			names = append(names, device.Name)
+		}
+		timeout := a.Timeout
+		if timeout == 0 {
+			timeout = 30
+		}
+		n.Label = fmt.Sprintf("Ring %s for %ds", strings.Join(names, ", "), timeout)
+		if len(names) == 0 {
+			n.Label = "Ring no devices"
+		}
+
+	case "forward":
+		var a rules.ForwardAction
+		json.Unmarshal(route.ActionData, &a)
+		n.Label = "Forward to " + a.Number
+		if a.DetectVoicemail {
+			n.Label += ", voicemail detected"
+		}
+
+	case "oncall":
+		var a rules.OnCallAction
+		json.Unmarshal(route.ActionData, &a)
+		schedule, err := h.deps.DB.OnCall.GetByID(ctx, a.ScheduleID)
+		if err != nil {
+			b.warn("Route %q uses on-call schedule %d, which doesn't exist", route.Name, a.ScheduleID)
+			n.Label = "Ring on-call responder"
+		} else {
+			n.Label = fmt.Sprintf("Ring on-call responder of %s (%d levels)", schedule.Name, len(schedule.Levels))
+		}
+
+	case "escalate":
+		var a rules.EscalateAction
+		json.Unmarshal(route.ActionData, &a)
+		policy, err := h.deps.DB.EscalationPolicies.GetByID(ctx, a.PolicyID)
+		if err != nil {
+			b.warn("Route %q uses escalation policy %d, which doesn't exist", route.Name, a.PolicyID)
+			n.Label = "Escalate"
+		} else {
+			n.Label = fmt.Sprintf("Escalate through %s (%d levels)", policy.Name, len(policy.Levels))
+		}
+
+	case "voicemail":
+		n.Label = "Voicemail"
+
+	case "reject":
+		a := rules.ParseRejectAction(route.ActionData)
+		n.Label = fmt.Sprintf("Reject (%d %s)", a.SIPCode, rules.RejectCodes[a.SIPCode])
+
+	case "split":
+		var a rules.SplitAction
+		json.Unmarshal(route.ActionData, &a)
+		parts := make([]string, len(a.Targets))
+		for i, t := range a.Targets {
+			label := h.actionNode(ctx, b, t.Route(route)).Label
+			if a.Mode == rules.SplitRoundRobin {
+				parts[i] = label
+			} else {
+				parts[i] = fmt.Sprintf("%d%% %s", t.Percent, label)
+			}
+		}
+		n.Label = "Split: " + strings.Join(parts, " / ")
+		if a.Mode == rules.SplitRoundRobin {
+			n.Label = "Take turns: " + strings.Join(parts, " / ")
+		}
+
+	default:
+		n.Label = "Voicemail"
+		b.warn("Route %q has an unknown action type %q and sends calls to voicemail", route.Name, route.ActionType)
+	}
+	return n
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestDIDHandler_Flow(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewDIDHandler(&Dependencies{DB: setup.DB})
+	ctx := context.Background()
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	did.AnonymousAction = db.AnonymousActionChallenge
+	did.Timezone = "America/Chicago"
+	if err := setup.DB.DIDs.Update(ctx, did); err != nil {
+		t.Fatal(err)
+	}
+	desk := createTestDevice(t, setup.DB, "Desk", "desk")
+
+	routes := []*models.Route{
+		{Name: "Office", ConditionType: "time", ConditionData: json.RawMessage(`{"business_hours":true}`),
+			ActionType: "ring", ActionData: json.RawMessage(`{"devices":[` + strconv.FormatInt(desk.ID, 10) + `,999]}`)},
+		{Name: "Everything else", ConditionType: "default", ActionType: "forward", ActionData: json.RawMessage(`{"number":"+15559876543"}`)},
+		{Name: "Too late", ConditionType: "default", ActionType: "reject"},
+		{Name: "Old", ConditionType: "default", ActionType: "voicemail"},
+	}
+	for i, route := range routes {
+		route.DIDID = &did.ID
+		route.Priority = i + 1
+		route.Enabled = route.Name != "Old"
+		if err := setup.DB.Routes.Create(ctx, route); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/dids/1/flow", nil)
+	req = withURLParams(req, map[string]string{"id": strconv.FormatInt(did.ID, 10)})
+	rr := httptest.NewRecorder()
+	handler.Flow(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+
+	var resp DIDFlowResponse
+	decodeResponse(t, rr, &resp)
+
+	if resp.Timezone != "America/Chicago" {
+		t.Errorf("Timezone = %q, want the DID's", resp.Timezone)
+	}
+
+	nodes := map[string]FlowNode{}
+	for _, n := range resp.Nodes {
+		nodes[n.ID] = n
+	}
+	office, forward := "route-"+strconv.FormatInt(routes[0].ID, 10), "route-"+strconv.FormatInt(routes[1].ID, 10)
+	if n := nodes["action-"+strconv.FormatInt(routes[0].ID, 10)]; n.Label != "Ring Desk for 30s" {
+		t.Errorf("Ring label = %q", n.Label)
+	}
+	if n := nodes["route-"+strconv.FormatInt(routes[3].ID, 10)]; !n.Disabled {
+		t.Errorf("Expected the disabled route to be marked, got %+v", n)
+	}
+
+	edges := map[string]bool{}
+	for _, e := range resp.Edges {
+		edges[e.From+" "+e.Outcome+" "+e.To] = true
+	}
+	for _, want := range []string{
+		"start next blocklist",
+		"blocklist blocked blocked",
+		"blocklist allowed anonymous",
+		"anonymous anonymous anonymous-action",
+		"anonymous-action recorded " + office,
+		"anonymous next " + office,
+		office + " no_match " + forward,
+		office + " busy " + forward,
+		"action-" + strconv.FormatInt(routes[0].ID, 10) + " no_answer voicemail",
+		forward + " match action-" + strconv.FormatInt(routes[1].ID, 10),
+	} {
+		if !edges[want] {
+			t.Errorf("Missing edge %q in %v", want, resp.Edges)
+		}
+	}
+	if edges[forward+" no_match route-"+strconv.FormatInt(routes[2].ID, 10)] {
+		t.Error("A catch-all route shouldn't have a no_match edge")
+	}
+
+	warnings := strings.Join(resp.Warnings, "\n")
+	if !strings.Contains(warnings, "device 999") || !strings.Contains(warnings, `"Too late" is never reached`) {
+		t.Errorf("Warnings = %v", resp.Warnings)
+	}
+}
+
+func TestDIDHandler_Flow_NoRoutes(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewDIDHandler(&Dependencies{DB: setup.DB})
+	did := createTestDID(t, setup.DB, "+15551234567")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/dids/1/flow", nil)
+	req = withURLParams(req, map[string]string{"id": strconv.FormatInt(did.ID, 10)})
+	rr := httptest.NewRecorder()
+	handler.Flow(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+
+	var resp DIDFlowResponse
+	decodeResponse(t, rr, &resp)
+	if len(resp.Edges) != 3 || resp.Edges[2] != (FlowEdge{From: "blocklist", To: "voicemail", Outcome: "allowed"}) {
+		t.Errorf("Edges = %v, want calls to go straight to voicemail", resp.Edges)
+	}
+
+	req = withURLParams(httptest.NewRequest(http.MethodGet, "/api/dids/9999/flow", nil), map[string]string{"id": "9999"})
+	rr = httptest.NewRecorder()
+	handler.Flow(rr, req)
+	assertStatus(t, rr, http.StatusNotFound)
+}
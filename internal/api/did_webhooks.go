@@ -0,0 +1,244 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/didwebhooks"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// DIDWebhookHandler handles pointing the Twilio numbers behind DIDs at this
+// server's webhooks
+type DIDWebhookHandler struct {
+	deps *Dependencies
+}
+
+// NewDIDWebhookHandler creates a new DIDWebhookHandler
+func NewDIDWebhookHandler(deps *Dependencies) *DIDWebhookHandler {
+	return &DIDWebhookHandler{deps: deps}
+}
+
+// ConfigureWebhooksRequest selects the DIDs to configure in bulk
+type ConfigureWebhooksRequest struct {
+	DIDIDs []int64 `json:"did_ids"` // All DIDs when empty
+}
+
+// ConfigureWebhooksResult is the outcome for one DID of a bulk configure
+type ConfigureWebhooksResult struct {
+	DIDID    int64               `json:"did_id"`
+	Number   string              `json:"number"`
+	Webhooks *models.DIDWebhooks `json:"webhooks,omitempty"`
+	Error    string              `json:"error,omitempty"`
+}
+
+// ConfigureWebhooksResponse reports a bulk configure
+type ConfigureWebhooksResponse struct {
+	BaseURL    string                     `json:"base_url"`
+	Configured int                        `json:"configured"`
+	Failed     int                        `json:"failed"`
+	Results    []*ConfigureWebhooksResult `json:"results"`
+}
+
+// available writes an error and returns false when the webhook manager
+// isn't running
+func (h *DIDWebhookHandler) available(w http.ResponseWriter) bool {
+	if h.deps.DIDWebhooks == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Number webhook configuration is not available", nil)
+		return false
+	}
+	return true
+}
+
+// baseURL validates the public URL, writing an error when it can't be used
+func (h *DIDWebhookHandler) baseURL(w http.ResponseWriter, r *http.Request) (string, bool) {
+	base, err := h.deps.DIDWebhooks.ValidateBaseURL(r.Context())
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "The public URL can't be used for webhooks: "+err.Error(), nil)
+		return "", false
+	}
+	return base, true
+}
+
+// Configure points one DID's Twilio number at this server's voice, status
+// and SMS webhooks (admin only)
+func (h *DIDWebhookHandler) Configure(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid DID ID", nil)
+		return
+	}
+	did, err := h.deps.DB.DIDs.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, db.ErrDIDNotFound) {
+			WriteNotFoundError(w, "DID")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	base, ok := h.baseURL(w, r)
+	if !ok {
+		return
+	}
+	hooks, err := h.deps.DIDWebhooks.Configure(r.Context(), did, base)
+	if err != nil {
+		if errors.Is(err, didwebhooks.ErrNumberNotFound) {
+			WriteNotFoundError(w, "Twilio number")
+			return
+		}
+		WriteTwilioError(w, "Failed to configure webhooks", err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, hooks)
+}
+
+// ConfigureAll points the Twilio numbers of several DIDs, or all of them,
+// at this server. A DID that fails doesn't stop the others (admin only).
+func (h *DIDWebhookHandler) ConfigureAll(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	var req ConfigureWebhooksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	var dids []*models.DID
+	if len(req.DIDIDs) == 0 {
+		all, err := h.deps.DB.DIDs.List(r.Context())
+		if err != nil {
+			WriteInternalError(w)
+			return
+		}
+		dids = all
+	} else {
+		var fieldErrors []FieldError
+		for _, id := range req.DIDIDs {
+			did, err := h.deps.DB.DIDs.GetByID(r.Context(), id)
+			if errors.Is(err, db.ErrDIDNotFound) {
+				fieldErrors = append(fieldErrors, FieldError{Field: "did_ids", Message: "DID " + strconv.FormatInt(id, 10) + " not found"})
+				continue
+			}
+			if err != nil {
+				WriteInternalError(w)
+				return
+			}
+			dids = append(dids, did)
+		}
+		if len(fieldErrors) > 0 {
+			WriteValidationError(w, "Validation failed", fieldErrors)
+			return
+		}
+	}
+
+	base, ok := h.baseURL(w, r)
+	if !ok {
+		return
+	}
+	resp := ConfigureWebhooksResponse{BaseURL: base, Results: []*ConfigureWebhooksResult{}}
+	for _, did := range dids {
+		result := &ConfigureWebhooksResult{DIDID: did.ID, Number: did.Number}
+		hooks, err := h.deps.DIDWebhooks.Configure(r.Context(), did, base)
+		if err != nil {
+			result.Error = err.Error()
+			resp.Failed++
+		} else {
+			result.Webhooks = hooks
+			resp.Configured++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	slog.Info("Configured DID webhooks", "base_url", base, "configured", resp.Configured, "failed", resp.Failed)
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// List returns every configured DID's webhooks with its last verification
+// (admin only)
+func (h *DIDWebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	hooks, err := h.deps.DB.DIDWebhooks.List(r.Context())
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if hooks == nil {
+		hooks = []*models.DIDWebhooks{}
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"data": hooks})
+}
+
+// Get returns a DID's webhooks with its last verification (admin only)
+func (h *DIDWebhookHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid DID ID", nil)
+		return
+	}
+	hooks, err := h.deps.DB.DIDWebhooks.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, db.ErrDIDWebhooksNotFound) {
+			WriteNotFoundError(w, "DID webhooks")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+	WriteJSON(w, http.StatusOK, hooks)
+}
+
+// Verify checks a DID's webhooks against Twilio now (admin only)
+func (h *DIDWebhookHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid DID ID", nil)
+		return
+	}
+
+	hooks, err := h.deps.DIDWebhooks.Verify(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, db.ErrDIDWebhooksNotFound) {
+			WriteNotFoundError(w, "DID webhooks")
+			return
+		}
+		WriteTwilioError(w, "Failed to verify webhooks", err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, hooks)
+}
+
+// Delete stops verifying a DID's webhooks. Twilio keeps them (admin only).
+func (h *DIDWebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid DID ID", nil)
+		return
+	}
+
+	if err := h.deps.DIDWebhooks.Remove(r.Context(), id); err != nil {
+		if errors.Is(err, db.ErrDIDWebhooksNotFound) {
+			WriteNotFoundError(w, "DID webhooks")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "DID webhooks no longer verified"})
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/didwebhooks"
+	"github.com/btafoya/gosip/internal/twilio"
+)
+
+// fakeTwilioNumbers holds the account's numbers and their webhooks
+type fakeTwilioNumbers struct {
+	numbers []twilio.IncomingPhoneNumber
+	hooks   map[string]twilio.NumberWebhooks
+}
+
+func (f *fakeTwilioNumbers) ListIncomingPhoneNumbers(ctx context.Context) ([]twilio.IncomingPhoneNumber, error) {
+	return f.numbers, nil
+}
+
+func (f *fakeTwilioNumbers) GetNumberWebhooks(ctx context.Context, phoneNumberSID string) (*twilio.NumberWebhooks, error) {
+	h := f.hooks[phoneNumberSID]
+	return &h, nil
+}
+
+func (f *fakeTwilioNumbers) SetNumberWebhooks(ctx context.Context, phoneNumberSID string, hooks twilio.NumberWebhooks) error {
+	f.hooks[phoneNumberSID] = hooks
+	return nil
+}
+
+func TestDIDWebhookHandler_Unavailable(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewDIDWebhookHandler(&Dependencies{DB: setup.DB})
+
+	rr := httptest.NewRecorder()
+	handler.ConfigureAll(rr, httptest.NewRequest(http.MethodPost, "/api/dids/configure-webhooks", nil))
+	assertStatus(t, rr, http.StatusServiceUnavailable)
+}
+
+func TestDIDWebhookHandler_Configure(t *testing.T) {
+	setup := setupTestAPI(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	first := createTestDID(t, setup.DB, "+15551234567")
+	createTestDID(t, setup.DB, "+15557654321") // Not on the Twilio account
+	numbers := &fakeTwilioNumbers{
+		numbers: []twilio.IncomingPhoneNumber{{SID: "PN1", PhoneNumber: "+15551234567"}},
+		hooks:   map[string]twilio.NumberWebhooks{},
+	}
+	manager := didwebhooks.NewManager(&config.Config{PublicURL: server.URL}, setup.DB, nil, numbers)
+	handler := NewDIDWebhookHandler(&Dependencies{DB: setup.DB, DIDWebhooks: manager})
+
+	// Bulk configure covers every DID and reports each outcome
+	rr := httptest.NewRecorder()
+	handler.ConfigureAll(rr, httptest.NewRequest(http.MethodPost, "/api/dids/configure-webhooks", nil))
+	assertStatus(t, rr, http.StatusOK)
+	var resp ConfigureWebhooksResponse
+	decodeResponse(t, rr, &resp)
+	if resp.BaseURL != server.URL || resp.Configured != 1 || resp.Failed != 1 || len(resp.Results) != 2 {
+		t.Fatalf("Unexpected bulk result %+v", resp)
+	}
+	if numbers.hooks["PN1"].VoiceURL != server.URL+didwebhooks.VoicePath {
+		t.Errorf("Expected the number pointed at this server, got %+v", numbers.hooks["PN1"])
+	}
+
+	// Unknown DIDs are rejected before anything changes
+	rr = httptest.NewRecorder()
+	handler.ConfigureAll(rr, httptest.NewRequest(http.MethodPost, "/api/dids/configure-webhooks", strings.NewReader(`{"did_ids": [1, 99]}`)))
+	assertStatus(t, rr, http.StatusBadRequest)
+
+	rr = httptest.NewRecorder()
+	handler.Configure(rr, withURLParams(httptest.NewRequest(http.MethodPost, "/api/dids/2/configure-webhooks", nil), map[string]string{"id": "2"}))
+	assertStatus(t, rr, http.StatusNotFound)
+
+	rr = httptest.NewRecorder()
+	handler.Verify(rr, withURLParams(httptest.NewRequest(http.MethodPost, "/api/dids/1/webhooks/verify", nil), map[string]string{"id": "1"}))
+	assertStatus(t, rr, http.StatusOK)
+
+	rr = httptest.NewRecorder()
+	handler.List(rr, httptest.NewRequest(http.MethodGet, "/api/dids/webhooks", nil))
+	assertStatus(t, rr, http.StatusOK)
+	var list struct {
+		Data []struct {
+			DIDID  int64 `json:"did_id"`
+			Intact bool  `json:"intact"`
+		} `json:"data"`
+	}
+	decodeResponse(t, rr, &list)
+	if len(list.Data) != 1 || list.Data[0].DIDID != first.ID || !list.Data[0].Intact {
+		t.Errorf("Unexpected webhooks %+v", list.Data)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.Delete(rr, withURLParams(httptest.NewRequest(http.MethodDelete, "/api/dids/1/webhooks", nil), map[string]string{"id": "1"}))
+	assertStatus(t, rr, http.StatusOK)
+	rr = httptest.NewRecorder()
+	handler.Get(rr, withURLParams(httptest.NewRequest(http.MethodGet, "/api/dids/1/webhooks", nil), map[string]string{"id": "1"}))
+	assertStatus(t, rr, http.StatusNotFound)
+}
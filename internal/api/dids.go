@@ -6,7 +6,9 @@ import (
 	"strconv"
 
 	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/i18n"
 	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/twilio"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -34,11 +36,29 @@ type DIDResponse struct {
 	FriendlyName string          `json:"friendly_name,omitempty"`
 	TwilioSID    string          `json:"twilio_sid,omitempty"`
 	Capabilities DIDCapabilities `json:"capabilities"`
+	// AnonymousAction is the policy for callers without caller ID
+	AnonymousAction string `json:"anonymous_action"`
+	// Language selects the caller prompt set; empty uses default_language
+	Language string `json:"language,omitempty"`
+	// Timezone is the IANA timezone time-based routes are evaluated in
+	Timezone string `json:"timezone,omitempty"`
+	// MessagingServiceSID is the Twilio Messaging Service outbound SMS is sent through
+	MessagingServiceSID string `json:"messaging_service_sid,omitempty"`
+	// RecordingEnabled records calls to the DID whose media passes through GoSIP
+	RecordingEnabled bool `json:"recording_enabled"`
+	// TenantID is the tenant the DID is assigned to
+	TenantID *int64 `json:"tenant_id,omitempty"`
 }
 
-// List returns all DIDs
+// List returns all DIDs, or a tenant user's tenant's
 func (h *DIDHandler) List(w http.ResponseWriter, r *http.Request) {
-	dids, err := h.deps.DB.DIDs.List(r.Context())
+	var dids []*models.DID
+	var err error
+	if tenantID := tenantOf(r); tenantID != nil {
+		dids, err = h.deps.DB.DIDs.ListByTenant(r.Context(), *tenantID)
+	} else {
+		dids, err = h.deps.DB.DIDs.List(r.Context())
+	}
 	if err != nil {
 		WriteInternalError(w)
 		return
@@ -59,6 +79,32 @@ type CreateDIDRequest struct {
 	Name         string `json:"name,omitempty"`
 	SMSEnabled   bool   `json:"sms_enabled"`
 	VoiceEnabled bool   `json:"voice_enabled"`
+	// AnonymousAction is "allow" (default), "reject" or "challenge"
+	AnonymousAction string `json:"anonymous_action,omitempty"`
+	// Language is "en", "es", "fr" or "de"
+	Language string `json:"language,omitempty"`
+	// Timezone is an IANA name such as "America/Chicago"
+	Timezone string `json:"timezone,omitempty"`
+	// MessagingServiceSID is a Twilio Messaging Service SID ("MG...")
+	MessagingServiceSID string `json:"messaging_service_sid,omitempty"`
+	// RecordingEnabled records the DID's calls
+	RecordingEnabled bool `json:"recording_enabled"`
+	// TenantID assigns the DID to a tenant; only instance admins set it
+	TenantID *int64 `json:"tenant_id,omitempty"`
+}
+
+// messagingServiceFieldError is returned for malformed Messaging Service SIDs
+func messagingServiceFieldError(field string) FieldError {
+	return FieldError{Field: field, Message: "Messaging Service SID must be MG followed by 32 hex characters"}
+}
+
+// validAnonymousAction reports whether an anonymous caller policy is recognised
+func validAnonymousAction(action string) bool {
+	switch action {
+	case db.AnonymousActionAllow, db.AnonymousActionReject, db.AnonymousActionChallenge:
+		return true
+	}
+	return false
 }
 
 // Create creates a new DID
@@ -77,12 +123,45 @@ func (h *DIDHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.AnonymousAction != "" && !validAnonymousAction(req.AnonymousAction) {
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "anonymous_action", Message: "Anonymous action must be allow, reject or challenge"},
+		})
+		return
+	}
+
+	if req.Language != "" && !i18n.IsSupported(req.Language) {
+		WriteValidationError(w, "Validation failed", []FieldError{languageFieldError})
+		return
+	}
+
+	if !validTimezone(req.Timezone) {
+		WriteValidationError(w, "Validation failed", []FieldError{timezoneFieldError("timezone")})
+		return
+	}
+
+	if req.MessagingServiceSID != "" && !twilio.IsMessagingServiceSID(req.MessagingServiceSID) {
+		WriteValidationError(w, "Validation failed", []FieldError{messagingServiceFieldError("messaging_service_sid")})
+		return
+	}
+
 	did := &models.DID{
-		Number:       req.Number,
-		TwilioSID:    req.TwilioSID,
-		Name:         req.Name,
-		SMSEnabled:   req.SMSEnabled,
-		VoiceEnabled: req.VoiceEnabled,
+		Number:              req.Number,
+		TwilioSID:           req.TwilioSID,
+		Name:                req.Name,
+		SMSEnabled:          req.SMSEnabled,
+		VoiceEnabled:        req.VoiceEnabled,
+		AnonymousAction:     req.AnonymousAction,
+		Language:            req.Language,
+		Timezone:            req.Timezone,
+		MessagingServiceSID: req.MessagingServiceSID,
+		RecordingEnabled:    req.RecordingEnabled,
+	}
+	if req.TenantID != nil {
+		var ok bool
+		if did.TenantID, ok = tenantField(w, r, h.deps, *req.TenantID); !ok {
+			return
+		}
 	}
 
 	if err := h.deps.DB.DIDs.Create(r.Context(), did); err != nil {
@@ -102,6 +181,9 @@ func (h *DIDHandler) Get(w http.ResponseWriter, r *http.Request) {
 	}
 
 	did, err := h.deps.DB.DIDs.GetByID(r.Context(), id)
+	if err == nil && !visibleTo(r, did.TenantID) {
+		err = db.ErrDIDNotFound
+	}
 	if err != nil {
 		if err == db.ErrDIDNotFound {
 			WriteNotFoundError(w, "DID")
@@ -121,6 +203,19 @@ type UpdateDIDRequest struct {
 	FriendlyName string `json:"friendly_name,omitempty"`
 	SMSEnabled   *bool  `json:"sms_enabled,omitempty"`
 	VoiceEnabled *bool  `json:"voice_enabled,omitempty"`
+	// AnonymousAction is "allow", "reject" or "challenge"
+	AnonymousAction string `json:"anonymous_action,omitempty"`
+	// Language is "en", "es", "fr" or "de"; "" uses default_language again
+	Language *string `json:"language,omitempty"`
+	// Timezone is an IANA name such as "America/Chicago"; "" uses the system timezone again
+	Timezone *string `json:"timezone,omitempty"`
+	// MessagingServiceSID is a Twilio Messaging Service SID; "" sends from the DID's number again
+	MessagingServiceSID *string `json:"messaging_service_sid,omitempty"`
+	// RecordingEnabled records the DID's calls
+	RecordingEnabled *bool `json:"recording_enabled,omitempty"`
+	// TenantID moves the DID and its routes to a tenant, 0 back to the
+	// instance; only instance admins set it
+	TenantID *int64 `json:"tenant_id,omitempty"`
 }
 
 // Update updates a DID
@@ -132,6 +227,9 @@ func (h *DIDHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	did, err := h.deps.DB.DIDs.GetByID(r.Context(), id)
+	if err == nil && !visibleTo(r, did.TenantID) {
+		err = db.ErrDIDNotFound
+	}
 	if err != nil {
 		if err == db.ErrDIDNotFound {
 			WriteNotFoundError(w, "DID")
@@ -147,6 +245,19 @@ func (h *DIDHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The number and how it is reached through Twilio belong to the instance
+	if tenantOf(r) != nil && (req.PhoneNumber != "" || req.TwilioSID != "" || req.MessagingServiceSID != nil) {
+		WriteForbiddenError(w)
+		return
+	}
+	tenantID := did.TenantID
+	if req.TenantID != nil {
+		var ok bool
+		if tenantID, ok = tenantField(w, r, h.deps, *req.TenantID); !ok {
+			return
+		}
+	}
+
 	if req.PhoneNumber != "" {
 		did.Number = req.PhoneNumber
 	}
@@ -162,11 +273,51 @@ func (h *DIDHandler) Update(w http.ResponseWriter, r *http.Request) {
 	if req.VoiceEnabled != nil {
 		did.VoiceEnabled = *req.VoiceEnabled
 	}
+	if req.AnonymousAction != "" {
+		if !validAnonymousAction(req.AnonymousAction) {
+			WriteValidationError(w, "Validation failed", []FieldError{
+				{Field: "anonymous_action", Message: "Anonymous action must be allow, reject or challenge"},
+			})
+			return
+		}
+		did.AnonymousAction = req.AnonymousAction
+	}
+	if req.Language != nil {
+		if *req.Language != "" && !i18n.IsSupported(*req.Language) {
+			WriteValidationError(w, "Validation failed", []FieldError{languageFieldError})
+			return
+		}
+		did.Language = *req.Language
+	}
+	if req.Timezone != nil {
+		if !validTimezone(*req.Timezone) {
+			WriteValidationError(w, "Validation failed", []FieldError{timezoneFieldError("timezone")})
+			return
+		}
+		did.Timezone = *req.Timezone
+	}
+	if req.MessagingServiceSID != nil {
+		if *req.MessagingServiceSID != "" && !twilio.IsMessagingServiceSID(*req.MessagingServiceSID) {
+			WriteValidationError(w, "Validation failed", []FieldError{messagingServiceFieldError("messaging_service_sid")})
+			return
+		}
+		did.MessagingServiceSID = *req.MessagingServiceSID
+	}
+	if req.RecordingEnabled != nil {
+		did.RecordingEnabled = *req.RecordingEnabled
+	}
 
 	if err := h.deps.DB.DIDs.Update(r.Context(), did); err != nil {
 		WriteInternalError(w)
 		return
 	}
+	if !sameTenant(tenantID, did.TenantID) {
+		if err := h.deps.DB.DIDs.SetTenant(r.Context(), did.ID, tenantID); err != nil {
+			WriteInternalError(w)
+			return
+		}
+		did.TenantID = tenantID
+	}
 
 	WriteJSON(w, http.StatusOK, toDIDResponse(did))
 }
@@ -198,6 +349,12 @@ func toDIDResponse(did *models.DID) *DIDResponse {
 			SMS:   did.SMSEnabled,
 			MMS:   did.SMSEnabled, // MMS typically follows SMS capability
 		},
+		AnonymousAction:     did.AnonymousAction,
+		Language:            did.Language,
+		Timezone:            did.Timezone,
+		MessagingServiceSID: did.MessagingServiceSID,
+		RecordingEnabled:    did.RecordingEnabled,
+		TenantID:            did.TenantID,
 	}
 }
 
@@ -212,7 +369,7 @@ func (h *DIDHandler) SyncFromTwilio(w http.ResponseWriter, r *http.Request) {
 	// Get phone numbers from Twilio
 	twilioNumbers, err := h.deps.Twilio.ListIncomingPhoneNumbers(r.Context())
 	if err != nil {
-		WriteError(w, http.StatusBadGateway, "TWILIO_ERROR", "Failed to fetch phone numbers from Twilio: "+err.Error(), nil)
+		WriteTwilioError(w, "Failed to fetch phone numbers from Twilio", err)
 		return
 	}
 
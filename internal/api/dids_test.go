@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 
 	"github.com/btafoya/gosip/internal/models"
@@ -96,6 +97,23 @@ func TestDIDHandler_Create_MissingNumber(t *testing.T) {
 	assertErrorCode(t, rr, ErrCodeValidation)
 }
 
+func TestDIDHandler_Create_InvalidMessagingService(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB}
+	handler := NewDIDHandler(deps)
+
+	body, _ := json.Marshal(CreateDIDRequest{
+		Number:              "+15551234567",
+		MessagingServiceSID: "PN123456789",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/dids", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler.Create(rr, req)
+
+	assertStatus(t, rr, http.StatusBadRequest)
+	assertErrorCode(t, rr, ErrCodeValidation)
+}
+
 func TestDIDHandler_Create_InvalidJSON(t *testing.T) {
 	setup := setupTestAPI(t)
 	deps := &Dependencies{DB: setup.DB}
@@ -169,10 +187,11 @@ func TestDIDHandler_Update(t *testing.T) {
 
 	createTestDID(t, setup.DB, "+15551234567")
 
-	smsEnabled := false
+	smsEnabled, recordingEnabled := false, true
 	reqBody := UpdateDIDRequest{
-		FriendlyName: "Updated Name",
-		SMSEnabled:   &smsEnabled,
+		FriendlyName:     "Updated Name",
+		SMSEnabled:       &smsEnabled,
+		RecordingEnabled: &recordingEnabled,
 	}
 	body, _ := json.Marshal(reqBody)
 
@@ -194,6 +213,48 @@ func TestDIDHandler_Update(t *testing.T) {
 	if resp.Capabilities.SMS {
 		t.Error("Expected SMS capability to be false")
 	}
+	if !resp.RecordingEnabled {
+		t.Error("Expected recording to be enabled")
+	}
+}
+
+func TestDIDHandler_Update_ClearOverrides(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewDIDHandler(&Dependencies{DB: setup.DB})
+	did := createTestDID(t, setup.DB, "+15551234567")
+	id := strconv.FormatInt(did.ID, 10)
+
+	update := func(body string) DIDResponse {
+		req := httptest.NewRequest(http.MethodPut, "/api/dids/"+id, bytes.NewBufferString(body))
+		req = withURLParams(req, map[string]string{"id": id})
+		rr := httptest.NewRecorder()
+		handler.Update(rr, req)
+		assertStatus(t, rr, http.StatusOK)
+		var resp DIDResponse
+		decodeResponse(t, rr, &resp)
+		return resp
+	}
+
+	if resp := update(`{"language": "de"}`); resp.Language != "de" {
+		t.Errorf("Expected language de, got %q", resp.Language)
+	}
+	// Omitted keeps the override, empty clears it
+	if resp := update(`{"friendly_name": "Main"}`); resp.Language != "de" {
+		t.Errorf("Expected language kept, got %q", resp.Language)
+	}
+	if resp := update(`{"language": ""}`); resp.Language != "" {
+		t.Errorf("Expected language cleared, got %q", resp.Language)
+	}
+
+	if resp := update(`{"timezone": "Europe/Berlin"}`); resp.Timezone != "Europe/Berlin" {
+		t.Errorf("Expected timezone Europe/Berlin, got %q", resp.Timezone)
+	}
+	if resp := update(`{"friendly_name": "Main"}`); resp.Timezone != "Europe/Berlin" {
+		t.Errorf("Expected timezone kept, got %q", resp.Timezone)
+	}
+	if resp := update(`{"timezone": ""}`); resp.Timezone != "" {
+		t.Errorf("Expected timezone cleared, got %q", resp.Timezone)
+	}
 }
 
 func TestDIDHandler_Update_NotFound(t *testing.T) {
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// ScanResponse reports the outcome of a LAN discovery scan
+type ScanResponse struct {
+	Devices []*models.DiscoveredDevice `json:"devices"`
+	New     int                        `json:"new"`
+}
+
+// AdoptRequest represents a request to provision a discovered device.
+// Name, device type, vendor, model and MAC address default to the discovered values.
+type AdoptRequest struct {
+	DeviceName       string `json:"device_name"`
+	Username         string `json:"username"`
+	Password         string `json:"password"`
+	GeneratePassword bool   `json:"generate_password"`
+	DeviceType       string `json:"device_type"`
+	UserID           *int64 `json:"user_id,omitempty"`
+	URLExpiresIn     int    `json:"url_expires_in"` // seconds
+}
+
+// ListDiscovered lists devices found by LAN discovery that have not been adopted
+func (h *ProvisioningHandler) ListDiscovered(w http.ResponseWriter, r *http.Request) {
+	includeAdopted := r.URL.Query().Get("include_adopted") == "true"
+
+	devices, err := h.deps.DB.DiscoveredDevices.List(r.Context(), includeAdopted)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if devices == nil {
+		devices = []*models.DiscoveredDevice{}
+	}
+
+	WriteJSON(w, http.StatusOK, devices)
+}
+
+// ScanNetwork scans the LAN for IP phones with SSDP and mDNS.
+// Scanning is opt-in through the discovery_enabled setting.
+func (h *ProvisioningHandler) ScanNetwork(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if h.deps.DB.Config.GetWithDefault(ctx, "discovery_enabled", "false") != "true" {
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "Device discovery is disabled", nil)
+		return
+	}
+	if h.deps.Scanner == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Device discovery is unavailable", nil)
+		return
+	}
+
+	found, err := h.deps.Scanner.Scan(ctx, config.DiscoveryScanTimeout)
+	if err != nil {
+		slog.Error("Device discovery scan failed", "error", err)
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Device discovery is unavailable", nil)
+		return
+	}
+
+	resp := ScanResponse{Devices: []*models.DiscoveredDevice{}}
+	for _, f := range found {
+		d := &models.DiscoveredDevice{
+			MACAddress:      nilIfEmpty(f.MACAddress),
+			IPAddress:       f.IPAddress,
+			Vendor:          nilIfEmpty(f.Vendor),
+			Model:           nilIfEmpty(f.Model),
+			FirmwareVersion: nilIfEmpty(f.Firmware),
+			Source:          f.Source,
+			Banner:          nilIfEmpty(f.Banner),
+		}
+
+		created, err := h.deps.DB.DiscoveredDevices.Upsert(ctx, d)
+		if err != nil {
+			WriteInternalError(w)
+			return
+		}
+
+		if created {
+			resp.New++
+			h.deps.DB.DeviceEvents.LogDiscovery(ctx, map[string]interface{}{
+				"discovered_id": d.ID,
+				"vendor":        f.Vendor,
+				"model":         f.Model,
+				"mac_address":   f.MACAddress,
+				"source":        f.Source,
+			}, f.IPAddress)
+			h.deps.Events.Publish(events.TypeDeviceDiscovered, d)
+		}
+		resp.Devices = append(resp.Devices, d)
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// AdoptDiscovered provisions a discovered device, prefilling the vendor,
+// model and MAC address found by the scan and generating a provisioning URL
+func (h *ProvisioningHandler) AdoptDiscovered(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid discovered device ID", nil)
+		return
+	}
+
+	var req AdoptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	discovered, err := h.deps.DB.DiscoveredDevices.GetByID(r.Context(), id)
+	if errors.Is(err, db.ErrDiscoveredDeviceNotFound) {
+		WriteNotFoundError(w, "Discovered device")
+		return
+	}
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if discovered.DeviceID != nil {
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "Device has already been adopted", nil)
+		return
+	}
+
+	vendor := derefString(discovered.Vendor)
+	model := derefString(discovered.Model)
+
+	if req.DeviceName == "" {
+		req.DeviceName = strings.TrimSpace(fmt.Sprintf("%s %s", displayVendor(vendor), model))
+	}
+	if req.DeviceType == "" {
+		req.DeviceType = "softphone"
+		if validDeviceTypes[vendor] {
+			req.DeviceType = vendor
+		}
+	}
+	if !validDeviceTypes[req.DeviceType] {
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "device_type", Message: "Invalid device type"},
+		})
+		return
+	}
+
+	device := h.provision(w, r, models.ProvisioningRequest{
+		DeviceName:       req.DeviceName,
+		Username:         req.Username,
+		Password:         req.Password,
+		GeneratePassword: req.GeneratePassword,
+		DeviceType:       req.DeviceType,
+		Vendor:           vendor,
+		Model:            model,
+		MACAddress:       derefString(discovered.MACAddress),
+		UserID:           req.UserID,
+		GenerateURL:      true,
+		URLExpiresIn:     req.URLExpiresIn,
+	})
+	if device == nil {
+		return
+	}
+
+	h.deps.DB.DiscoveredDevices.MarkAdopted(r.Context(), discovered.ID, device.ID)
+	h.deps.DB.DeviceEvents.LogEvent(r.Context(), device.ID, "info", map[string]interface{}{
+		"adopted_from": discovered.ID,
+		"ip_address":   discovered.IPAddress,
+		"source":       discovered.Source,
+	}, r.RemoteAddr, r.UserAgent())
+}
+
+// DismissDiscovered removes a discovered device from the list
+func (h *ProvisioningHandler) DismissDiscovered(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid discovered device ID", nil)
+		return
+	}
+
+	if err := h.deps.DB.DiscoveredDevices.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, db.ErrDiscoveredDeviceNotFound) {
+			WriteNotFoundError(w, "Discovered device")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Discovered device dismissed"})
+}
+
+// displayVendor capitalizes a vendor name for use in a default device name
+func displayVendor(vendor string) string {
+	if vendor == "" {
+		return ""
+	}
+	return strings.ToUpper(vendor[:1]) + vendor[1:]
+}
+
+// derefString returns the value of a string pointer, or an empty string when nil
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
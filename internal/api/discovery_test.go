@@ -0,0 +1,192 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/discovery"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func setupDiscoveryTest(t *testing.T, scanner *MockDeviceScanner) (*testSetup, *ProvisioningHandler, *Dependencies) {
+	t.Helper()
+
+	setup := setupTestAPI(t)
+	setup.DB.Config.Set(context.Background(), "discovery_enabled", "true")
+	deps := &Dependencies{
+		DB:      setup.DB,
+		Config:  &config.Config{SIPDomain: "pbx.example.com", SIPPort: 5060},
+		Events:  events.NewHub(10),
+		Scanner: scanner,
+	}
+	return setup, NewProvisioningHandler(deps), deps
+}
+
+func scanDiscovery(t *testing.T, handler *ProvisioningHandler) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/provisioning/discovery/scan", nil)
+	rr := httptest.NewRecorder()
+	handler.ScanNetwork(rr, req)
+	return rr
+}
+
+func TestProvisioningHandler_ScanNetwork(t *testing.T) {
+	scanner := &MockDeviceScanner{Devices: []discovery.Device{
+		{IPAddress: "192.168.1.50", MACAddress: "00:0b:82:12:34:56", Vendor: "grandstream", Model: "GXP2170", Firmware: "1.0.9.135", Source: discovery.SourceSSDP, Banner: "Grandstream GXP2170/1.0.9.135"},
+		{IPAddress: "192.168.1.60", Vendor: "yealink", Source: discovery.SourceMDNS},
+	}}
+	setup, handler, deps := setupDiscoveryTest(t, scanner)
+
+	rr := scanDiscovery(t, handler)
+	assertStatus(t, rr, http.StatusOK)
+
+	var resp ScanResponse
+	decodeResponse(t, rr, &resp)
+	if len(resp.Devices) != 2 || resp.New != 2 {
+		t.Fatalf("Expected 2 new devices, got %d of %d", resp.New, len(resp.Devices))
+	}
+
+	// Discoveries are logged as device events and published to the event stream
+	recent, _ := setup.DB.DeviceEvents.ListRecent(context.Background(), 10)
+	if len(recent) != 2 || recent[0].EventType != "discovered" {
+		t.Errorf("Expected 2 discovered events, got %+v", recent)
+	}
+	if deps.Events.LastID() != 2 {
+		t.Errorf("Expected 2 published events, got %d", deps.Events.LastID())
+	}
+
+	// Rescanning updates the existing entries without logging them again
+	rr = scanDiscovery(t, handler)
+	decodeResponse(t, rr, &resp)
+	if resp.New != 0 {
+		t.Errorf("Expected no new devices on rescan, got %d", resp.New)
+	}
+	if recent, _ := setup.DB.DeviceEvents.ListRecent(context.Background(), 10); len(recent) != 2 {
+		t.Errorf("Expected rescan not to log events, got %d", len(recent))
+	}
+}
+
+func TestProvisioningHandler_ScanNetwork_Disabled(t *testing.T) {
+	scanner := &MockDeviceScanner{}
+	setup, handler, _ := setupDiscoveryTest(t, scanner)
+	setup.DB.Config.Set(context.Background(), "discovery_enabled", "false")
+
+	rr := scanDiscovery(t, handler)
+	assertStatus(t, rr, http.StatusConflict)
+	if scanner.Scans != 0 {
+		t.Error("Expected no scan while discovery is disabled")
+	}
+}
+
+func TestProvisioningHandler_ScanNetwork_Error(t *testing.T) {
+	_, handler, _ := setupDiscoveryTest(t, &MockDeviceScanner{Err: errors.New("no multicast")})
+
+	rr := scanDiscovery(t, handler)
+	assertStatus(t, rr, http.StatusServiceUnavailable)
+}
+
+func TestProvisioningHandler_AdoptDiscovered(t *testing.T) {
+	scanner := &MockDeviceScanner{Devices: []discovery.Device{
+		{IPAddress: "192.168.1.50", MACAddress: "00:0b:82:12:34:56", Vendor: "grandstream", Model: "GXP2170", Source: discovery.SourceSSDP},
+	}}
+	setup, handler, _ := setupDiscoveryTest(t, scanner)
+	scanDiscovery(t, handler)
+
+	pending, _ := setup.DB.DiscoveredDevices.List(context.Background(), false)
+	if len(pending) != 1 {
+		t.Fatalf("Expected 1 discovered device, got %d", len(pending))
+	}
+	id := pending[0].ID
+
+	adopt := func() *httptest.ResponseRecorder {
+		body, _ := json.Marshal(AdoptRequest{Username: "lobby", Password: "secret123"})
+		req := httptest.NewRequest(http.MethodPost, "/api/provisioning/discovery/1/adopt", bytes.NewReader(body))
+		req = withURLParams(req, map[string]string{"id": "1"})
+		rr := httptest.NewRecorder()
+		handler.AdoptDiscovered(rr, req)
+		return rr
+	}
+
+	rr := adopt()
+	assertStatus(t, rr, http.StatusCreated)
+
+	var resp models.ProvisioningResponse
+	decodeResponse(t, rr, &resp)
+	device := resp.Device
+	if device.Name != "Grandstream GXP2170" || device.DeviceType != "grandstream" {
+		t.Errorf("Expected prefilled Grandstream device, got %q (%s)", device.Name, device.DeviceType)
+	}
+	if device.MACAddress == nil || *device.MACAddress != "00:0b:82:12:34:56" {
+		t.Errorf("Expected MAC address from discovery, got %v", device.MACAddress)
+	}
+	if resp.ProvisioningURL == "" {
+		t.Error("Expected a provisioning URL")
+	}
+
+	adopted, _ := setup.DB.DiscoveredDevices.GetByID(context.Background(), id)
+	if adopted.DeviceID == nil || *adopted.DeviceID != device.ID {
+		t.Errorf("Expected discovered device to link to %d, got %v", device.ID, adopted.DeviceID)
+	}
+
+	// A discovered device can only be adopted once
+	assertStatus(t, adopt(), http.StatusConflict)
+}
+
+func TestProvisioningHandler_AdoptDiscovered_DefaultsToSoftphoneType(t *testing.T) {
+	scanner := &MockDeviceScanner{Devices: []discovery.Device{
+		{IPAddress: "192.168.1.60", Vendor: "yealink", Model: "T54W", Source: discovery.SourceMDNS},
+	}}
+	_, handler, _ := setupDiscoveryTest(t, scanner)
+	scanDiscovery(t, handler)
+
+	body, _ := json.Marshal(AdoptRequest{Username: "kitchen", Password: "secret123"})
+	req := httptest.NewRequest(http.MethodPost, "/api/provisioning/discovery/1/adopt", bytes.NewReader(body))
+	req = withURLParams(req, map[string]string{"id": "1"})
+	rr := httptest.NewRecorder()
+	handler.AdoptDiscovered(rr, req)
+
+	assertStatus(t, rr, http.StatusCreated)
+
+	var resp models.ProvisioningResponse
+	decodeResponse(t, rr, &resp)
+	if resp.Device.DeviceType != "softphone" {
+		t.Errorf("Expected softphone device type, got %s", resp.Device.DeviceType)
+	}
+}
+
+func TestProvisioningHandler_AdoptDiscovered_NotFound(t *testing.T) {
+	_, handler, _ := setupDiscoveryTest(t, &MockDeviceScanner{})
+
+	body, _ := json.Marshal(AdoptRequest{Username: "lobby", Password: "secret123"})
+	req := httptest.NewRequest(http.MethodPost, "/api/provisioning/discovery/99/adopt", bytes.NewReader(body))
+	req = withURLParams(req, map[string]string{"id": "99"})
+	rr := httptest.NewRecorder()
+	handler.AdoptDiscovered(rr, req)
+
+	assertStatus(t, rr, http.StatusNotFound)
+}
+
+func TestProvisioningHandler_DismissDiscovered(t *testing.T) {
+	scanner := &MockDeviceScanner{Devices: []discovery.Device{
+		{IPAddress: "192.168.1.50", Vendor: "grandstream", Source: discovery.SourceSSDP},
+	}}
+	setup, handler, _ := setupDiscoveryTest(t, scanner)
+	scanDiscovery(t, handler)
+
+	req := withURLParams(httptest.NewRequest(http.MethodDelete, "/api/provisioning/discovery/1", nil), map[string]string{"id": "1"})
+	rr := httptest.NewRecorder()
+	handler.DismissDiscovered(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+
+	if pending, _ := setup.DB.DiscoveredDevices.List(context.Background(), true); len(pending) != 0 {
+		t.Errorf("Expected dismissed device to be removed, got %d", len(pending))
+	}
+}
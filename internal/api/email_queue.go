@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// EmailHandler handles testing the SMTP relay and the outbound email queue
+type EmailHandler struct {
+	deps *Dependencies
+}
+
+// NewEmailHandler creates a new EmailHandler
+func NewEmailHandler(deps *Dependencies) *EmailHandler {
+	return &EmailHandler{deps: deps}
+}
+
+// SMTPTestRequest represents a request to send a test email
+type SMTPTestRequest struct {
+	To string `json:"to"` // Defaults to the signed-in admin's address
+}
+
+// TestSMTP sends a test email straight to the relay and reports each step
+// of the SMTP conversation, so a failure shows where it went wrong (admin
+// only)
+func (h *EmailHandler) TestSMTP(w http.ResponseWriter, r *http.Request) {
+	var req SMTPTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	if req.To == "" {
+		if user := GetUserFromContext(r.Context()); user != nil {
+			req.To = user.Email
+		}
+	}
+	if _, err := mail.ParseAddress(req.To); err != nil {
+		WriteValidationError(w, "Validation failed", []FieldError{{Field: "to", Message: "A valid email address is required"}})
+		return
+	}
+
+	result := h.deps.Notifier.TestSMTP(req.To)
+	if result.OK {
+		slog.Info("SMTP test email sent", "to", req.To)
+	} else {
+		slog.Warn("SMTP test failed", "to", req.To, "error", result.Error)
+	}
+	WriteJSON(w, http.StatusOK, result)
+}
+
+// ListQueue lists queued emails by status, dead letters by default (admin
+// only)
+func (h *EmailHandler) ListQueue(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = db.EmailDead
+	}
+	if status != db.EmailPending && status != db.EmailSent && status != db.EmailDead {
+		WriteValidationError(w, "Validation failed", []FieldError{{Field: "status", Message: "Status must be pending, sent or dead"}})
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if limit <= 0 {
+		limit = config.DefaultPageSize
+	}
+	if limit > config.MaxPageSize {
+		limit = config.MaxPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	emails, err := h.deps.DB.EmailQueue.ListByStatus(r.Context(), status, limit, offset)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if emails == nil {
+		emails = []*models.QueuedEmail{}
+	}
+	total, err := h.deps.DB.EmailQueue.CountByStatus(r.Context(), status)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteList(w, emails, total, limit, offset)
+}
+
+// Retry puts a dead letter back in the queue to be sent right away (admin
+// only)
+func (h *EmailHandler) Retry(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid email ID", nil)
+		return
+	}
+
+	if err := h.deps.DB.EmailQueue.Retry(r.Context(), id, time.Now()); err != nil {
+		if err == db.ErrQueuedEmailNotFound {
+			WriteNotFoundError(w, "Dead letter")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	email, err := h.deps.DB.EmailQueue.GetByID(r.Context(), id)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	WriteJSON(w, http.StatusOK, email)
+}
+
+// Delete removes a queued email (admin only)
+func (h *EmailHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid email ID", nil)
+		return
+	}
+
+	if err := h.deps.DB.EmailQueue.Delete(r.Context(), id); err != nil {
+		if err == db.ErrQueuedEmailNotFound {
+			WriteNotFoundError(w, "Queued email")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Queued email deleted successfully"})
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/notifications"
+)
+
+func TestEmailHandler_TestSMTP(t *testing.T) {
+	setup := setupTestAPI(t)
+	var tested string
+	setup.Notifier.TestSMTPFunc = func(to string) *notifications.SMTPTestResult {
+		tested = to
+		return &notifications.SMTPTestResult{
+			Recipient: to,
+			Steps:     []notifications.SMTPStep{{Step: "connect", OK: true}, {Step: "auth", Detail: "Relay replied 535 5.7.8 Bad credentials"}},
+			Error:     "auth: Relay replied 535 5.7.8 Bad credentials",
+		}
+	}
+	deps := &Dependencies{DB: setup.DB, Notifier: setup.Notifier}
+	handler := NewEmailHandler(deps)
+	admin := createTestUser(t, setup.DB, "admin@example.com", "password123", "admin")
+
+	// Without a recipient the test goes to the signed-in admin
+	req := httptest.NewRequest(http.MethodPost, "/api/system/smtp/test", nil)
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, admin))
+	rr := httptest.NewRecorder()
+	handler.TestSMTP(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+
+	var result notifications.SMTPTestResult
+	decodeResponse(t, rr, &result)
+	if tested != "admin@example.com" || result.OK || len(result.Steps) != 2 || !strings.Contains(result.Error, "535") {
+		t.Errorf("Expected the failed auth step for the admin's address, got %q %+v", tested, result)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/system/smtp/test", strings.NewReader(`{"to": "not an address"}`))
+	rr = httptest.NewRecorder()
+	handler.TestSMTP(rr, req)
+	assertStatus(t, rr, http.StatusBadRequest)
+}
+
+func TestEmailHandler_DeadLetters(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewEmailHandler(&Dependencies{DB: setup.DB})
+	ctx := context.Background()
+
+	now := time.Now()
+	email := &models.QueuedEmail{Recipient: "admin@example.com", Subject: "New Voicemail", Body: "Hello", NextAttemptAt: &now}
+	if err := setup.DB.EmailQueue.Enqueue(ctx, email); err != nil {
+		t.Fatal(err)
+	}
+	if err := setup.DB.EmailQueue.MarkFailed(ctx, email.ID, "connect: refused", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/system/email-queue", nil)
+	rr := httptest.NewRecorder()
+	handler.ListQueue(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+	var list struct {
+		Data []models.QueuedEmail `json:"data"`
+	}
+	decodeResponse(t, rr, &list)
+	if len(list.Data) != 1 || list.Data[0].LastError == nil || *list.Data[0].LastError != "connect: refused" {
+		t.Fatalf("Expected the dead letter with its error, got %+v", list)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/system/email-queue?status=bogus", nil)
+	rr = httptest.NewRecorder()
+	handler.ListQueue(rr, req)
+	assertStatus(t, rr, http.StatusBadRequest)
+
+	retry := func(id string) *httptest.ResponseRecorder {
+		req := withURLParams(httptest.NewRequest(http.MethodPost, "/api/system/email-queue/"+id+"/retry", nil), map[string]string{"id": id})
+		rr := httptest.NewRecorder()
+		handler.Retry(rr, req)
+		return rr
+	}
+	rr = retry("1")
+	assertStatus(t, rr, http.StatusOK)
+	var retried models.QueuedEmail
+	decodeResponse(t, rr, &retried)
+	if retried.Status != db.EmailPending || retried.Attempts != 0 {
+		t.Errorf("Expected the email back in the queue, got %+v", retried)
+	}
+	assertStatus(t, retry("1"), http.StatusNotFound)
+
+	req = withURLParams(httptest.NewRequest(http.MethodDelete, "/api/system/email-queue/1", nil), map[string]string{"id": "1"})
+	rr = httptest.NewRecorder()
+	handler.Delete(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+	if count, _ := setup.DB.EmailQueue.CountByStatus(ctx, db.EmailPending); count != 0 {
+		t.Errorf("Expected the email deleted, got %d pending", count)
+	}
+}
@@ -3,6 +3,9 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/btafoya/gosip/internal/i18n"
+	"github.com/btafoya/gosip/internal/twilio"
 )
 
 // ErrorResponse follows the standard API error format from REQUIREMENTS.md
@@ -15,6 +18,8 @@ type ErrorDetail struct {
 	Code    string       `json:"code"`
 	Message string       `json:"message"`
 	Details []FieldError `json:"details,omitempty"`
+	// Twilio explains errors the Twilio API returned
+	Twilio *twilio.ErrorInfo `json:"twilio,omitempty"`
 }
 
 // FieldError represents a validation error for a specific field
@@ -35,19 +40,28 @@ const (
 	ErrCodeBadRequest         = "BAD_REQUEST"
 	ErrCodeServiceUnavailable = "SERVICE_UNAVAILABLE"
 	ErrCodeBadGateway         = "BAD_GATEWAY"
+	ErrCodeReadOnly           = "READ_ONLY"
+	ErrCodeMediaCorrupted     = "MEDIA_CORRUPTED"
 )
 
-// WriteError writes a standardized error response
+// WriteError writes a standardized error response.
+// Messages are translated when the writer carries a language from LocaleMiddleware.
 func WriteError(w http.ResponseWriter, statusCode int, code, message string, details []FieldError) {
+	writeErrorDetail(w, statusCode, ErrorDetail{Code: code, Message: message, Details: details})
+}
+
+// writeErrorDetail writes an error response, translating its messages
+func writeErrorDetail(w http.ResponseWriter, statusCode int, detail ErrorDetail) {
+	if lang := languageOf(w); lang != "" {
+		detail.Message = i18n.Translate(lang, detail.Message)
+		for i := range detail.Details {
+			detail.Details[i].Message = i18n.Translate(lang, detail.Details[i].Message)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(ErrorResponse{
-		Error: ErrorDetail{
-			Code:    code,
-			Message: message,
-			Details: details,
-		},
-	})
+	json.NewEncoder(w).Encode(ErrorResponse{Error: detail})
 }
 
 // WriteValidationError is a helper for validation errors
@@ -75,6 +89,22 @@ func WriteForbiddenError(w http.ResponseWriter) {
 	WriteError(w, http.StatusForbidden, ErrCodeAuthorization, "Access denied", nil)
 }
 
+// WriteTwilioError is a helper for failed Twilio API requests. Errors
+// Twilio returned are explained, with what to do about them, instead of
+// passing on Twilio's raw error.
+func WriteTwilioError(w http.ResponseWriter, message string, err error) {
+	info := twilio.ExplainError(err)
+	if info == nil {
+		WriteError(w, http.StatusBadGateway, ErrCodeBadGateway, message+": "+err.Error(), nil)
+		return
+	}
+	writeErrorDetail(w, http.StatusBadGateway, ErrorDetail{
+		Code:    ErrCodeBadGateway,
+		Message: message + ": " + info.Title,
+		Twilio:  info,
+	})
+}
+
 // WriteJSON writes a JSON response
 func WriteJSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
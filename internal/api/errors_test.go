@@ -2,9 +2,13 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/twilio/twilio-go/client"
 )
 
 func TestWriteError(t *testing.T) {
@@ -171,6 +175,35 @@ func TestWriteUnauthorizedError(t *testing.T) {
 	}
 }
 
+func TestWriteTwilioError(t *testing.T) {
+	restErr := &client.TwilioRestError{Code: 21610, Message: "Attempt to send to unsubscribed recipient", Status: 400}
+	rr := httptest.NewRecorder()
+	WriteTwilioError(rr, "Failed to resend message", fmt.Errorf("twilio API error: %w", restErr))
+
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("WriteTwilioError() status = %v, want %v", rr.Code, http.StatusBadGateway)
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Error.Message != "Failed to resend message: Recipient unsubscribed" {
+		t.Errorf("WriteTwilioError() message = %v", resp.Error.Message)
+	}
+	if tw := resp.Error.Twilio; tw == nil || tw.Code != 21610 || tw.Remediation == "" || tw.Message != restErr.Message {
+		t.Errorf("Expected the Twilio error explained, got %+v", tw)
+	}
+
+	// Other errors are passed on as before
+	rr = httptest.NewRecorder()
+	WriteTwilioError(rr, "Failed to resend message", errors.New("twilio client not initialized"))
+	resp = ErrorResponse{}
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.Error.Message != "Failed to resend message: twilio client not initialized" || resp.Error.Twilio != nil {
+		t.Errorf("Unexpected error %+v", resp.Error)
+	}
+}
+
 func TestWriteJSON(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -0,0 +1,289 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/channels"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/i18n"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// escalationTwiML calls a level of an escalation policy. Every answering
+// party must press a digit to accept the call; unacknowledged calls move on
+// to the next level through VoiceEscalation, and start over at level 1
+// until the policy's passes are used up. Callers then reach voicemail.
+func (h *WebhookHandler) escalationTwiML(ctx context.Context, did *models.DID, from, callSID string, policyID int64, round, level int, whisperURL string, maxDuration int) string {
+	policy, err := h.deps.DB.EscalationPolicies.GetByID(ctx, policyID)
+	if err != nil {
+		return h.voicemailTwiML(did, from)
+	}
+	repeat := policy.Repeat
+	if repeat < 1 {
+		repeat = 1
+	}
+
+	for ; round <= repeat; round, level = round+1, 1 {
+		for ; level <= len(policy.Levels); level++ {
+			l := policy.Levels[level-1]
+			acceptURL := func(target string) string {
+				u := "/api/webhooks/voice/escalation/prompt?DidId=" + strconv.FormatInt(did.ID, 10) +
+					"&ParentCallSid=" + url.QueryEscape(callSID) +
+					"&PolicyId=" + strconv.FormatInt(policy.ID, 10) +
+					"&Round=" + strconv.Itoa(round) +
+					"&Level=" + strconv.Itoa(level) +
+					"&Target=" + url.QueryEscape(target)
+				if whisperURL != "" {
+					u += "&WhisperUrl=" + url.QueryEscape(whisperURL)
+				}
+				return ` url="` + escapeXML(u) + `"`
+			}
+
+			var dialTargets, targets []string
+			for _, userID := range l.UserIDs {
+				devices, err := h.deps.DB.Devices.ListByUser(ctx, userID)
+				if err != nil {
+					continue
+				}
+				for _, device := range devices {
+					if !h.deviceBusy(ctx, device.ID) {
+						dialTargets = append(dialTargets, sipDialTarget(device, acceptURL(device.Username), trunkHeaders("", maxDuration, recordedCallSID(did, callSID), "", did.RecordingEnabled)))
+						targets = append(targets, device.Username)
+					}
+				}
+			}
+			for _, number := range l.Numbers {
+				dialTargets = append(dialTargets, `<Number`+acceptURL(number)+`>`+escapeXML(number)+`</Number>`)
+				targets = append(targets, number)
+			}
+			if len(dialTargets) == 0 {
+				continue
+			}
+			if len(dialTargets) > config.EscalationMaxTargets {
+				dialTargets = dialTargets[:config.EscalationMaxTargets]
+				targets = targets[:config.EscalationMaxTargets]
+			}
+
+			if l.SMS && len(l.Numbers) > 0 {
+				go h.textEscalation(did, from, callSID, policy.ID, round, level, l.Numbers)
+			}
+			h.recordEscalationStep(ctx, callSID, policy.ID, models.EscalationStep{Action: "called", Round: round, Level: level, Targets: targets})
+
+			timeout := l.Timeout
+			if timeout <= 0 {
+				timeout = config.EscalationDefaultTimeout
+			}
+			actionURL := "/api/webhooks/voice/escalation?DidId=" + strconv.FormatInt(did.ID, 10) +
+				"&PolicyId=" + strconv.FormatInt(policy.ID, 10) +
+				"&Round=" + strconv.Itoa(round) +
+				"&Level=" + strconv.Itoa(level)
+			if whisperURL != "" {
+				actionURL += "&WhisperUrl=" + url.QueryEscape(whisperURL)
+			}
+			if maxDuration > 0 {
+				actionURL += "&MaxDuration=" + strconv.Itoa(maxDuration)
+			}
+
+			// External numbers must be called from one of our Twilio numbers
+			callerID := ""
+			if len(l.Numbers) > 0 {
+				callerID = ` callerId="` + escapeXML(did.Number) + `"`
+			}
+
+			return `<Response>
+				<Dial timeout="` + strconv.Itoa(timeout) + `"` + callerID + timeLimitAttr(maxDuration) + ` action="` + escapeXML(actionURL) + `">
+					` + strings.Join(dialTargets, "\n") + `
+				</Dial>
+			</Response>`
+		}
+	}
+
+	h.recordEscalationStep(ctx, callSID, policy.ID, models.EscalationStep{Action: "exhausted"})
+	return h.voicemailTwiML(did, from)
+}
+
+// textEscalation texts the numbers of a level that they are about to be
+// called. Texts are recorded as outbound messages of the DID.
+func (h *WebhookHandler) textEscalation(did *models.DID, from, callSID string, policyID int64, round, level int, numbers []string) {
+	if h.deps.Twilio == nil {
+		return
+	}
+	ctx := context.Background()
+	lang := h.callLanguage(ctx, did)
+	body := i18n.Prompt(lang, i18n.PromptEscalationCall) + " " + from + ". " + i18n.Prompt(lang, i18n.PromptEscalationText)
+
+	var texted []string
+	for _, number := range numbers {
+		didID := did.ID
+		message := &models.Message{
+			DIDID:      &didID,
+			Direction:  "outbound",
+			FromNumber: did.Number,
+			ToNumber:   number,
+			Body:       body,
+			Status:     "queued",
+			CreatedAt:  time.Now(),
+			Channel:    channels.SMS,
+		}
+		if err := h.deps.DB.Messages.Create(ctx, message); err != nil {
+			continue
+		}
+
+		twilioSID, err := h.deps.Twilio.SendSMS(smsSender(ctx, h.deps, did), number, body, nil)
+		if err != nil {
+			recordSendFailure(ctx, h.deps, message.ID, err)
+			continue
+		}
+		message.MessageSID = twilioSID
+		message.Status = "sent"
+		h.deps.DB.Messages.Update(ctx, message)
+		estimateMessageCost(ctx, h.deps, message)
+		texted = append(texted, number)
+	}
+
+	if len(texted) > 0 {
+		h.recordEscalationStep(ctx, callSID, policyID, models.EscalationStep{Action: "texted", Round: round, Level: level, Targets: texted})
+	}
+}
+
+// recordEscalationStep adds a step to the call's escalation timeline and
+// publishes it to the event stream
+func (h *WebhookHandler) recordEscalationStep(ctx context.Context, callSID string, policyID int64, step models.EscalationStep) {
+	step.At = time.Now()
+	if callSID != "" {
+		h.deps.DB.CDRs.AppendEscalationStep(ctx, callSID, step)
+	}
+
+	h.deps.Events.Publish(events.TypeCallEscalation, map[string]interface{}{
+		"call_sid":  callSID,
+		"policy_id": policyID,
+		"action":    step.Action,
+		"round":     step.Round,
+		"level":     step.Level,
+		"targets":   step.Targets,
+	})
+}
+
+// escalationAcknowledged reports whether someone accepted an escalated call.
+// Calls without a CDR fall back to the dial status.
+func (h *WebhookHandler) escalationAcknowledged(ctx context.Context, callSID, dialStatus string) bool {
+	cdr, err := h.deps.DB.CDRs.GetByCallSID(ctx, callSID)
+	if err != nil {
+		return dialStatus == "completed"
+	}
+
+	var timeline []models.EscalationStep
+	json.Unmarshal(cdr.EscalationTimeline, &timeline)
+	for _, step := range timeline {
+		if step.Action == "acknowledged" {
+			return true
+		}
+	}
+	return false
+}
+
+// VoiceEscalation handles the end of a dial to a level of an escalation
+// policy. Acknowledged calls are done; otherwise the next level is called.
+func (h *WebhookHandler) VoiceEscalation(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.respondTwiML(w, h.errorTwiML("Invalid request"))
+		return
+	}
+
+	if !h.validateSignature(r) {
+		h.respondTwiML(w, h.errorTwiML("Invalid signature"))
+		return
+	}
+
+	callSID := r.FormValue("CallSid")
+	if h.escalationAcknowledged(r.Context(), callSID, r.FormValue("DialCallStatus")) {
+		h.respondTwiML(w, `<Response><Hangup/></Response>`)
+		return
+	}
+
+	query := r.URL.Query()
+	didID, _ := strconv.ParseInt(query.Get("DidId"), 10, 64)
+	did, err := h.deps.DB.DIDs.GetByID(r.Context(), didID)
+	if err != nil {
+		h.respondTwiML(w, h.errorTwiML("Number not found"))
+		return
+	}
+	policyID, _ := strconv.ParseInt(query.Get("PolicyId"), 10, 64)
+	round, _ := strconv.Atoi(query.Get("Round"))
+	level, _ := strconv.Atoi(query.Get("Level"))
+	maxDuration, _ := strconv.Atoi(query.Get("MaxDuration"))
+
+	h.recordEscalationStep(r.Context(), callSID, policyID, models.EscalationStep{Action: "unanswered", Round: round, Level: level})
+	h.respondTwiML(w, h.escalationTwiML(r.Context(), did, r.FormValue("From"), callSID, policyID, round, level+1, query.Get("WhisperUrl"), maxDuration))
+}
+
+// VoiceEscalationPrompt asks the answering party of an escalated call to
+// press a digit to accept it. Parties who don't are hung up on, which
+// leaves the call ringing the rest of the level.
+func (h *WebhookHandler) VoiceEscalationPrompt(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || !h.validateSignature(r) {
+		h.respondTwiML(w, `<Response><Hangup/></Response>`)
+		return
+	}
+
+	query := r.URL.Query()
+	lang := i18n.DefaultLanguage
+	didID, _ := strconv.ParseInt(query.Get("DidId"), 10, 64)
+	if did, err := h.deps.DB.DIDs.GetByID(r.Context(), didID); err == nil {
+		lang = h.callLanguage(r.Context(), did)
+	}
+
+	// The answering leg's From is the DID, so the caller comes from the CDR
+	announcement := i18n.Prompt(lang, i18n.PromptEscalationCall)
+	if cdr, err := h.deps.DB.CDRs.GetByCallSID(r.Context(), query.Get("ParentCallSid")); err == nil {
+		announcement += " " + cdr.FromNumber
+	}
+
+	actionURL := "/api/webhooks/voice/escalation/accept?" + query.Encode()
+
+	h.respondTwiML(w, `<Response>
+		<Gather numDigits="1" timeout="`+strconv.Itoa(config.EscalationAcceptTimeout)+`" action="`+escapeXML(actionURL)+`">
+			`+sayTwiML(lang, announcement)+`
+			`+sayTwiML(lang, i18n.Prompt(lang, i18n.PromptEscalationAccept))+`
+		</Gather>
+		<Hangup/>
+	</Response>`)
+}
+
+// VoiceEscalationAccept records the acknowledgment of an escalated call and
+// bridges it, playing an anonymous caller's recorded name first
+func (h *WebhookHandler) VoiceEscalationAccept(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || !h.validateSignature(r) {
+		h.respondTwiML(w, `<Response><Hangup/></Response>`)
+		return
+	}
+
+	if r.FormValue("Digits") == "" {
+		h.respondTwiML(w, `<Response><Hangup/></Response>`)
+		return
+	}
+
+	query := r.URL.Query()
+	policyID, _ := strconv.ParseInt(query.Get("PolicyId"), 10, 64)
+	round, _ := strconv.Atoi(query.Get("Round"))
+	level, _ := strconv.Atoi(query.Get("Level"))
+	h.recordEscalationStep(r.Context(), query.Get("ParentCallSid"), policyID, models.EscalationStep{
+		Action:  "acknowledged",
+		Round:   round,
+		Level:   level,
+		Targets: []string{query.Get("Target")},
+	})
+
+	if whisperURL := query.Get("WhisperUrl"); whisperURL != "" {
+		h.respondTwiML(w, `<Response><Redirect>`+escapeXML(whisperURL)+`</Redirect></Response>`)
+		return
+	}
+	h.respondTwiML(w, `<Response/>`)
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// EscalationPolicyHandler handles escalation policy API endpoints
+type EscalationPolicyHandler struct {
+	deps *Dependencies
+}
+
+// NewEscalationPolicyHandler creates a new EscalationPolicyHandler
+func NewEscalationPolicyHandler(deps *Dependencies) *EscalationPolicyHandler {
+	return &EscalationPolicyHandler{deps: deps}
+}
+
+// EscalationPolicyRequest represents an escalation policy create or update request
+type EscalationPolicyRequest struct {
+	Name   string                   `json:"name"`
+	Levels []models.EscalationLevel `json:"levels"`
+	Repeat int                      `json:"repeat"`
+}
+
+// escalationNumber matches the E.164 numbers an escalation level may call
+var escalationNumber = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// List returns all escalation policies
+func (h *EscalationPolicyHandler) List(w http.ResponseWriter, r *http.Request) {
+	policies, err := h.deps.DB.EscalationPolicies.List(r.Context())
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if policies == nil {
+		policies = []*models.EscalationPolicy{}
+	}
+
+	WriteJSON(w, http.StatusOK, policies)
+}
+
+// Create creates an escalation policy
+func (h *EscalationPolicyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req EscalationPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	policy := &models.EscalationPolicy{Name: req.Name, Levels: req.Levels, Repeat: req.Repeat}
+	if errs := h.validatePolicy(r.Context(), policy); len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	if err := h.deps.DB.EscalationPolicies.Create(r.Context(), policy); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "An escalation policy with this name already exists", nil)
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, policy)
+}
+
+// Get returns an escalation policy
+func (h *EscalationPolicyHandler) Get(w http.ResponseWriter, r *http.Request) {
+	policy, ok := h.loadPolicy(w, r)
+	if !ok {
+		return
+	}
+	WriteJSON(w, http.StatusOK, policy)
+}
+
+// Update updates an escalation policy. Levels, when given, replace the existing ones.
+func (h *EscalationPolicyHandler) Update(w http.ResponseWriter, r *http.Request) {
+	policy, ok := h.loadPolicy(w, r)
+	if !ok {
+		return
+	}
+
+	var req EscalationPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	if req.Name != "" {
+		policy.Name = req.Name
+	}
+	if req.Levels != nil {
+		policy.Levels = req.Levels
+	}
+	if req.Repeat != 0 {
+		policy.Repeat = req.Repeat
+	}
+	if errs := h.validatePolicy(r.Context(), policy); len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	if err := h.deps.DB.EscalationPolicies.Update(r.Context(), policy); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "An escalation policy with this name already exists", nil)
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, policy)
+}
+
+// Delete removes an escalation policy. Routes using it fall back to voicemail.
+func (h *EscalationPolicyHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid policy ID", nil)
+		return
+	}
+
+	if err := h.deps.DB.EscalationPolicies.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, db.ErrEscalationPolicyNotFound) {
+			WriteNotFoundError(w, "Escalation policy")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Escalation policy deleted successfully"})
+}
+
+// loadPolicy fetches the policy named by the id URL parameter, writing an
+// error response when it can't
+func (h *EscalationPolicyHandler) loadPolicy(w http.ResponseWriter, r *http.Request) (*models.EscalationPolicy, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid policy ID", nil)
+		return nil, false
+	}
+
+	policy, err := h.deps.DB.EscalationPolicies.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, db.ErrEscalationPolicyNotFound) {
+			WriteNotFoundError(w, "Escalation policy")
+			return nil, false
+		}
+		WriteInternalError(w)
+		return nil, false
+	}
+	return policy, true
+}
+
+// validatePolicy checks a policy and fills in default timeouts and repeat count
+func (h *EscalationPolicyHandler) validatePolicy(ctx context.Context, policy *models.EscalationPolicy) []FieldError {
+	var errs []FieldError
+	if policy.Name == "" {
+		errs = append(errs, FieldError{Field: "name", Message: "Name is required"})
+	}
+	if len(policy.Levels) == 0 || len(policy.Levels) > config.EscalationMaxLevels {
+		errs = append(errs, FieldError{Field: "levels", Message: fmt.Sprintf("Must have 1 to %d levels", config.EscalationMaxLevels)})
+	}
+	if policy.Repeat == 0 {
+		policy.Repeat = 1
+	}
+	if policy.Repeat < 1 || policy.Repeat > config.EscalationMaxRepeat {
+		errs = append(errs, FieldError{Field: "repeat", Message: fmt.Sprintf("Must be between 1 and %d", config.EscalationMaxRepeat)})
+	}
+
+	for i := range policy.Levels {
+		level := &policy.Levels[i]
+		field := fmt.Sprintf("levels[%d].", i)
+
+		if len(level.UserIDs) == 0 && len(level.Numbers) == 0 {
+			errs = append(errs, FieldError{Field: field + "user_ids", Message: "At least one user or number is required"})
+		}
+		for _, userID := range level.UserIDs {
+			if !userExists(ctx, h.deps, userID) {
+				errs = append(errs, userIDFieldError(field+"user_ids"))
+				break
+			}
+		}
+		for _, number := range level.Numbers {
+			if !escalationNumber.MatchString(number) {
+				errs = append(errs, FieldError{Field: field + "numbers", Message: "Must be E.164 phone numbers"})
+				break
+			}
+		}
+		if level.SMS && len(level.Numbers) == 0 {
+			errs = append(errs, FieldError{Field: field + "sms", Message: "Texting requires at least one number"})
+		}
+
+		if level.Timeout == 0 {
+			level.Timeout = config.EscalationDefaultTimeout
+		}
+		if level.Timeout < 5 || level.Timeout > config.EscalationMaxTimeout {
+			errs = append(errs, FieldError{Field: field + "timeout", Message: fmt.Sprintf("Must be between 5 and %d seconds", config.EscalationMaxTimeout)})
+		}
+	}
+	return errs
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestEscalationPolicyHandler_Create(t *testing.T) {
+	setup := setupTestAPI(t)
+	user := createTestUser(t, setup.DB, "escalation@example.com", "password123", "user")
+	handler := NewEscalationPolicyHandler(&Dependencies{DB: setup.DB})
+
+	userIDs := `[` + strconv.FormatInt(user.ID, 10) + `]`
+	tests := []struct {
+		name string
+		body string
+		want int
+		code string
+	}{
+		{"missing name", `{"levels": [{"user_ids": ` + userIDs + `}]}`, http.StatusBadRequest, ErrCodeValidation},
+		{"empty level", `{"name": "Critical", "levels": [{}]}`, http.StatusBadRequest, ErrCodeValidation},
+		{"unknown user", `{"name": "Critical", "levels": [{"user_ids": [999]}]}`, http.StatusBadRequest, ErrCodeValidation},
+		{"bad number", `{"name": "Critical", "levels": [{"numbers": ["555-1234"]}]}`, http.StatusBadRequest, ErrCodeValidation},
+		{"sms without numbers", `{"name": "Critical", "levels": [{"user_ids": ` + userIDs + `, "sms": true}]}`, http.StatusBadRequest, ErrCodeValidation},
+		{"too many repeats", `{"name": "Critical", "repeat": 10, "levels": [{"user_ids": ` + userIDs + `}]}`, http.StatusBadRequest, ErrCodeValidation},
+		{"valid", `{"name": "Critical", "levels": [{"user_ids": ` + userIDs + `}, {"numbers": ["+15551230000"], "sms": true}]}`, http.StatusCreated, ""},
+		{"duplicate name", `{"name": "Critical", "levels": [{"user_ids": ` + userIDs + `}]}`, http.StatusConflict, ErrCodeConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.Create(rr, httptest.NewRequest(http.MethodPost, "/api/escalation-policies", bytes.NewBufferString(tt.body)))
+			assertStatus(t, rr, tt.want)
+			if tt.code != "" {
+				assertErrorCode(t, rr, tt.code)
+			}
+		})
+	}
+
+	policies, err := setup.DB.EscalationPolicies.List(context.Background())
+	if err != nil || len(policies) != 1 {
+		t.Fatalf("Expected 1 policy, got %d (%v)", len(policies), err)
+	}
+	if policies[0].Repeat != 1 || policies[0].Levels[0].Timeout != 30 {
+		t.Errorf("Expected defaults to be filled in, got %+v", policies[0])
+	}
+}
+
+func TestWebhookHandler_EscalationAcknowledged(t *testing.T) {
+	setup := setupTestAPI(t)
+	did := createTestDID(t, setup.DB, "+15550001111")
+	alice := createOnCallResponder(t, setup.DB, "alice@example.com", "alice-phone")
+
+	policy := &models.EscalationPolicy{
+		Name:   "Critical",
+		Repeat: 2,
+		Levels: []models.EscalationLevel{
+			{UserIDs: []int64{alice.ID}, Timeout: 20},
+			{Numbers: []string{"+15551230000"}, SMS: true, Timeout: 40},
+		},
+	}
+	if err := setup.DB.EscalationPolicies.Create(context.Background(), policy); err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+
+	texted := make(chan string, 1)
+	setup.Twilio.SendSMSFunc = func(from, to, body string, mediaURLs []string) (string, error) {
+		texted <- to + ": " + body
+		return "SM123", nil
+	}
+	hub := events.NewHub(32)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB, Twilio: setup.Twilio, Events: hub})
+	handler.recordInboundCall(context.Background(), did, "+15559876543", "CA123", "")
+
+	route := &models.Route{ActionType: "escalate", ActionData: []byte(`{"policy_id": ` + strconv.FormatInt(policy.ID, 10) + `}`)}
+	twiml := handler.executeAction(route, did, "+15559876543", "CA123", "")
+	if !strings.Contains(twiml, "alice-phone@") || !strings.Contains(twiml, `timeout="20"`) || !strings.Contains(twiml, "escalation/prompt") {
+		t.Errorf("Expected level 1 to ring alice with an accept prompt, got %s", twiml)
+	}
+
+	query := "DidId=" + strconv.FormatInt(did.ID, 10) + "&PolicyId=" + strconv.FormatInt(policy.ID, 10)
+	dialEnded := func(level int) string {
+		req := newSignedWebhookRequest(t, setup.DB, "/api/webhooks/voice/escalation?"+query+"&Round=1&Level="+strconv.Itoa(level),
+			url.Values{"CallSid": {"CA123"}, "From": {"+15559876543"}, "DialCallStatus": {"completed"}})
+		rr := httptest.NewRecorder()
+		handler.VoiceEscalation(rr, req)
+		return rr.Body.String()
+	}
+
+	// Someone answered without pressing a digit, so the call escalates
+	body := dialEnded(1)
+	if !strings.Contains(body, "<Number") || !strings.Contains(body, "+15551230000") || !strings.Contains(body, `callerId="+15550001111"`) {
+		t.Errorf("Expected level 2 to call the number, got %s", body)
+	}
+	select {
+	case sms := <-texted:
+		if !strings.HasPrefix(sms, "+15551230000: Urgent call from +15559876543") {
+			t.Errorf("Unexpected escalation text %q", sms)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Expected level 2 to be texted")
+	}
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cdr, err := setup.DB.CDRs.GetByCallSID(context.Background(), "CA123"); err == nil && strings.Contains(string(cdr.EscalationTimeline), `"texted"`) {
+			break
+		}
+	}
+
+	prompt := "/api/webhooks/voice/escalation/prompt?" + query + "&ParentCallSid=CA123&Round=1&Level=2&Target=%2B15551230000"
+	rr := httptest.NewRecorder()
+	handler.VoiceEscalationPrompt(rr, newSignedWebhookRequest(t, setup.DB, prompt, url.Values{"CallSid": {"CA456"}}))
+	if !strings.Contains(rr.Body.String(), "<Gather") || !strings.Contains(rr.Body.String(), "+15559876543") {
+		t.Errorf("Expected accept prompt naming the caller, got %s", rr.Body.String())
+	}
+
+	accept := strings.Replace(prompt, "/prompt?", "/accept?", 1)
+	rr = httptest.NewRecorder()
+	handler.VoiceEscalationAccept(rr, newSignedWebhookRequest(t, setup.DB, accept, url.Values{"CallSid": {"CA456"}, "Digits": {"1"}}))
+	if strings.Contains(rr.Body.String(), "Hangup") {
+		t.Errorf("Expected acknowledged call to be bridged, got %s", rr.Body.String())
+	}
+
+	if body := dialEnded(2); !strings.Contains(body, "<Response><Hangup/></Response>") {
+		t.Errorf("Expected acknowledged call to end, got %s", body)
+	}
+
+	cdr, err := setup.DB.CDRs.GetByCallSID(context.Background(), "CA123")
+	if err != nil {
+		t.Fatalf("Failed to get CDR: %v", err)
+	}
+	var timeline []models.EscalationStep
+	json.Unmarshal(cdr.EscalationTimeline, &timeline)
+	var actions []string
+	for _, step := range timeline {
+		actions = append(actions, step.Action)
+	}
+	// The text is sent in the background, so it may be recorded before or after the call
+	got := strings.Join(actions, ",")
+	if got != "called,unanswered,called,texted,acknowledged" && got != "called,unanswered,texted,called,acknowledged" {
+		t.Errorf("Unexpected escalation timeline %s", got)
+	}
+	if last := timeline[len(timeline)-1]; last.Level != 2 || len(last.Targets) != 1 || last.Targets[0] != "+15551230000" {
+		t.Errorf("Expected acknowledgment by the level 2 number, got %+v", last)
+	}
+
+	backlog, _, cancel := hub.Subscribe(0)
+	defer cancel()
+	if len(backlog) != len(timeline) || backlog[0].Type != events.TypeCallEscalation {
+		t.Errorf("Expected an event per escalation step, got %+v", backlog)
+	}
+}
+
+func TestWebhookHandler_EscalationExhausted(t *testing.T) {
+	setup := setupTestAPI(t)
+	did := createTestDID(t, setup.DB, "+15550001111")
+	alice := createOnCallResponder(t, setup.DB, "alice@example.com", "alice-phone")
+
+	policy := &models.EscalationPolicy{Name: "Critical", Repeat: 2, Levels: []models.EscalationLevel{{UserIDs: []int64{alice.ID}, Timeout: 20}}}
+	if err := setup.DB.EscalationPolicies.Create(context.Background(), policy); err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+	handler.recordInboundCall(context.Background(), did, "+15559876543", "CA123", "")
+
+	unanswered := func(round int) string {
+		target := "/api/webhooks/voice/escalation?DidId=" + strconv.FormatInt(did.ID, 10) + "&PolicyId=" + strconv.FormatInt(policy.ID, 10) + "&Round=" + strconv.Itoa(round) + "&Level=1"
+		rr := httptest.NewRecorder()
+		handler.VoiceEscalation(rr, newSignedWebhookRequest(t, setup.DB, target, url.Values{"CallSid": {"CA123"}, "From": {"+15559876543"}, "DialCallStatus": {"no-answer"}}))
+		return rr.Body.String()
+	}
+
+	if body := unanswered(1); !strings.Contains(body, "alice-phone@") || !strings.Contains(body, "Round=2") {
+		t.Errorf("Expected the second pass to ring alice again, got %s", body)
+	}
+	if body := unanswered(2); !strings.Contains(body, "<Record") {
+		t.Errorf("Expected voicemail once every pass is used up, got %s", body)
+	}
+
+	cdr, _ := setup.DB.CDRs.GetByCallSID(context.Background(), "CA123")
+	if !strings.Contains(string(cdr.EscalationTimeline), `"action":"exhausted"`) {
+		t.Errorf("Expected exhausted step in timeline %s", cdr.EscalationTimeline)
+	}
+}
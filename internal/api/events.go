@@ -0,0 +1,284 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/gobwas/ws"
+)
+
+// EventHandler streams system events to API clients
+type EventHandler struct {
+	deps *Dependencies
+}
+
+// NewEventHandler creates a new EventHandler
+func NewEventHandler(deps *Dependencies) *EventHandler {
+	return &EventHandler{deps: deps}
+}
+
+// StreamSSE streams events as Server-Sent Events.
+// Clients resume with the Last-Event-ID header, or the last_event_id query
+// parameter for clients that cannot set headers.
+func (h *EventHandler) StreamSSE(w http.ResponseWriter, r *http.Request) {
+	if h.deps.Events == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Event stream unavailable", nil)
+		return
+	}
+
+	lastID, ok := parseLastEventID(w, r)
+	if !ok {
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		WriteInternalError(w)
+		return
+	}
+
+	backlog, stream, cancel := h.deps.Events.Subscribe(lastID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", config.EventRetryInterval.Milliseconds())
+	for _, event := range backlog {
+		if err := writeSSEEvent(w, event); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(config.EventKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-stream:
+			if !ok {
+				// Subscriber fell behind; the client reconnects with Last-Event-ID
+				return
+			}
+			if err := writeSSEEvent(w, event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// parseLastEventID returns the ID of the last event the client saw, from the
+// Last-Event-ID header or the last_event_id query parameter. It writes the
+// error response and returns false when the ID is invalid.
+func parseLastEventID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	if lastEventID == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseInt(lastEventID, 10, 64)
+	if err != nil || id < 0 {
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "Last-Event-ID", Message: "Invalid event ID"},
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// StreamWebSocket streams events over a WebSocket, one JSON text message per
+// event. Clients resume with the last_event_id query parameter. When a client
+// falls behind the connection is closed with status 1001 (going away) and it
+// should reconnect from the last event it received.
+func (h *EventHandler) StreamWebSocket(w http.ResponseWriter, r *http.Request) {
+	if h.deps.Events == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Event stream unavailable", nil)
+		return
+	}
+
+	lastID, ok := parseLastEventID(w, r)
+	if !ok {
+		return
+	}
+	if !webSocketOriginAllowed(w, r) {
+		WriteError(w, http.StatusForbidden, ErrCodeAuthorization, "Origin not allowed", nil)
+		return
+	}
+
+	conn, rw, _, err := ws.UpgradeHTTP(r, w)
+	if err != nil {
+		// The upgrader has already answered the client
+		slog.Debug("WebSocket upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	// The connection outlives the server's read and write timeouts
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return
+	}
+
+	backlog, stream, cancel := h.deps.Events.Subscribe(lastID)
+	defer cancel()
+
+	client := &wsClient{conn: conn}
+	closed := make(chan struct{})
+	go client.readFrames(rw.Reader, closed)
+
+	for _, event := range backlog {
+		if err := client.writeEvent(event); err != nil {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(config.EventKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			client.close(ws.StatusGoingAway, "server shutting down")
+			return
+		case <-closed:
+			return
+		case event, ok := <-stream:
+			if !ok {
+				// Subscriber fell behind; the client reconnects with last_event_id
+				client.close(ws.StatusGoingAway, "client fell behind")
+				return
+			}
+			if err := client.writeEvent(event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if err := client.writeFrame(ws.NewPingFrame(nil)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// webSocketOriginAllowed reports whether a browser on the request's Origin
+// may open a WebSocket. Browsers send the session cookie along but do not
+// apply CORS to WebSockets, so only the API's own origin and origins the CORS
+// policy allows are accepted. Clients that send no Origin are not browsers.
+func webSocketOriginAllowed(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	// CORSMiddleware has answered with the origin when the policy allows it
+	return w.Header().Get("Access-Control-Allow-Origin") != ""
+}
+
+// wsClient serializes the frames written to a WebSocket
+type wsClient struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// writeEvent sends an event as a JSON text message
+func (c *wsClient) writeEvent(event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(ws.NewTextFrame(data))
+}
+
+// writeFrame sends a frame, giving up on clients that do not read it in time
+func (c *wsClient) writeFrame(frame ws.Frame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.conn.SetWriteDeadline(time.Now().Add(config.EventWriteTimeout)); err != nil {
+		return err
+	}
+	return ws.WriteFrame(c.conn, frame)
+}
+
+// close sends a close frame with a status code and reason
+func (c *wsClient) close(code ws.StatusCode, reason string) {
+	_ = c.writeFrame(ws.NewCloseFrame(ws.NewCloseFrameBody(code, reason)))
+}
+
+// readFrames answers the client's pings and close, discarding anything else
+// it sends, and closes done when the client goes away
+func (c *wsClient) readFrames(r io.Reader, done chan<- struct{}) {
+	defer close(done)
+	for {
+		header, err := ws.ReadHeader(r)
+		if err != nil {
+			return
+		}
+		if !header.OpCode.IsControl() {
+			if _, err := io.CopyN(io.Discard, r, header.Length); err != nil {
+				return
+			}
+			continue
+		}
+
+		payload := make([]byte, header.Length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return
+		}
+		if header.Masked {
+			ws.Cipher(payload, header.Mask, 0)
+		}
+		switch header.OpCode {
+		case ws.OpPing:
+			if err := c.writeFrame(ws.NewPongFrame(payload)); err != nil {
+				return
+			}
+		case ws.OpClose:
+			code, _ := ws.ParseCloseFrameData(payload)
+			if code.Empty() {
+				code = ws.StatusNormalClosure
+			}
+			c.close(code, "")
+			return
+		}
+	}
+}
+
+// writeSSEEvent writes a single event in text/event-stream format
+func writeSSEEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
@@ -0,0 +1,335 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+// sseEvent is a parsed text/event-stream frame
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// readSSEEvent reads frames until one carrying an event arrives
+func readSSEEvent(t *testing.T, reader *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var ev sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if ev.Event != "" {
+				return ev
+			}
+		case strings.HasPrefix(line, "id: "):
+			ev.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			ev.Event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.Data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestEventHandler_StreamSSE(t *testing.T) {
+	hub := events.NewHub(10)
+	handler := NewEventHandler(&Dependencies{Events: hub})
+
+	server := httptest.NewServer(http.HandlerFunc(handler.StreamSSE))
+	defer server.Close()
+
+	hub.Publish(events.TypeCallStatus, map[string]string{"call_sid": "CA1"})
+	hub.Publish(events.TypeCallStatus, map[string]string{"call_sid": "CA2"})
+	hub.Publish(events.TypeMessageReceived, map[string]string{"message_sid": "SM1"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %s", ct)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+
+	// Events after Last-Event-ID are replayed
+	if ev := readSSEEvent(t, reader); ev.ID != "2" || ev.Event != events.TypeCallStatus {
+		t.Errorf("Expected replayed event 2, got %+v", ev)
+	}
+	ev := readSSEEvent(t, reader)
+	if ev.ID != "3" || ev.Event != events.TypeMessageReceived {
+		t.Errorf("Expected replayed event 3, got %+v", ev)
+	}
+	var payload events.Event
+	if err := json.Unmarshal([]byte(ev.Data), &payload); err != nil {
+		t.Fatalf("Failed to decode event data: %v", err)
+	}
+	if payload.ID != 3 {
+		t.Errorf("Expected payload ID 3, got %d", payload.ID)
+	}
+
+	// Live events follow the replay
+	hub.Publish(events.TypeVoicemailReceived, nil)
+	if ev := readSSEEvent(t, reader); ev.ID != "4" || ev.Event != events.TypeVoicemailReceived {
+		t.Errorf("Expected live event 4, got %+v", ev)
+	}
+}
+
+func TestEventHandler_StreamSSE_QueryLastEventID(t *testing.T) {
+	hub := events.NewHub(10)
+	handler := NewEventHandler(&Dependencies{Events: hub})
+
+	server := httptest.NewServer(http.HandlerFunc(handler.StreamSSE))
+	defer server.Close()
+
+	hub.Publish(events.TypeCallStatus, nil)
+	hub.Publish(events.TypeMessageStatus, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?last_event_id=1", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ev := readSSEEvent(t, bufio.NewReader(resp.Body)); ev.ID != "2" {
+		t.Errorf("Expected event 2, got %+v", ev)
+	}
+}
+
+func TestEventHandler_StreamSSE_InvalidLastEventID(t *testing.T) {
+	handler := NewEventHandler(&Dependencies{Events: events.NewHub(10)})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/events/sse", nil)
+	req.Header.Set("Last-Event-ID", "abc")
+	rr := httptest.NewRecorder()
+	handler.StreamSSE(rr, req)
+
+	assertStatus(t, rr, http.StatusBadRequest)
+}
+
+func TestEventHandler_StreamSSE_Unavailable(t *testing.T) {
+	handler := NewEventHandler(&Dependencies{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/events/sse", nil)
+	rr := httptest.NewRecorder()
+	handler.StreamSSE(rr, req)
+
+	assertStatus(t, rr, http.StatusServiceUnavailable)
+}
+
+// dialEvents opens a WebSocket to an event stream server, returning the
+// reader frames arrive on
+func dialEvents(t *testing.T, rawURL string) (net.Conn, io.Reader) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, br, _, err := ws.Dial(ctx, "ws"+strings.TrimPrefix(rawURL, "http"))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("Failed to set deadline: %v", err)
+	}
+	// Frames sent right after the handshake may already be buffered
+	if br != nil {
+		return conn, br
+	}
+	return conn, conn
+}
+
+// readWSEvent reads the next event message from the stream
+func readWSEvent(t *testing.T, r io.Reader) events.Event {
+	t.Helper()
+
+	frame, err := ws.ReadFrame(r)
+	if err != nil {
+		t.Fatalf("Failed to read event: %v", err)
+	}
+	if frame.Header.OpCode != ws.OpText {
+		t.Fatalf("Expected a text message, got opcode %v", frame.Header.OpCode)
+	}
+	var event events.Event
+	if err := json.Unmarshal(frame.Payload, &event); err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	return event
+}
+
+func TestEventHandler_StreamWebSocket(t *testing.T) {
+	setup := setupTestAPI(t)
+	hub := events.NewHub(10)
+	handler := NewEventHandler(&Dependencies{DB: setup.DB, Events: hub})
+
+	// Served through LocaleMiddleware, which must let the handler hijack
+	server := httptest.NewServer(LocaleMiddleware(setup.DB)(http.HandlerFunc(handler.StreamWebSocket)))
+	defer server.Close()
+
+	hub.Publish(events.TypeCallStarted, map[string]string{"call_id": "c1"})
+	hub.Publish(events.TypeCallAnswered, map[string]string{"call_id": "c1"})
+
+	conn, r := dialEvents(t, server.URL+"?last_event_id=1")
+
+	// Events after last_event_id are replayed
+	if ev := readWSEvent(t, r); ev.ID != 2 || ev.Type != events.TypeCallAnswered {
+		t.Errorf("Expected replayed event 2, got %+v", ev)
+	}
+
+	// Live events follow the replay
+	hub.Publish(events.TypeRegistrationUp, map[string]int64{"device_id": 1})
+	if ev := readWSEvent(t, r); ev.ID != 3 || ev.Type != events.TypeRegistrationUp {
+		t.Errorf("Expected live event 3, got %+v", ev)
+	}
+
+	// Pings are answered
+	if err := wsutil.WriteClientMessage(conn, ws.OpPing, []byte("hi")); err != nil {
+		t.Fatalf("Failed to ping: %v", err)
+	}
+	frame, err := ws.ReadFrame(r)
+	if err != nil || frame.Header.OpCode != ws.OpPong || string(frame.Payload) != "hi" {
+		t.Fatalf("Expected a pong, got %+v, %v", frame.Header, err)
+	}
+
+	// Closing is acknowledged
+	body := ws.NewCloseFrameBody(ws.StatusNormalClosure, "")
+	if err := wsutil.WriteClientMessage(conn, ws.OpClose, body); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	frame, err = ws.ReadFrame(r)
+	if err != nil || frame.Header.OpCode != ws.OpClose {
+		t.Fatalf("Expected a close frame, got %+v, %v", frame.Header, err)
+	}
+}
+
+func TestEventHandler_StreamWebSocket_ClosesSlowClients(t *testing.T) {
+	hub := events.NewHub(10)
+	handler := NewEventHandler(&Dependencies{Events: hub})
+
+	server := httptest.NewServer(http.HandlerFunc(handler.StreamWebSocket))
+	defer server.Close()
+
+	_, r := dialEvents(t, server.URL)
+	hub.Publish(events.TypeCallStarted, nil)
+	if ev := readWSEvent(t, r); ev.Type != events.TypeCallStarted {
+		t.Fatalf("Expected call.started, got %+v", ev)
+	}
+
+	// The hub drops subscribers that fall behind; the client is told to
+	// reconnect rather than silently missing events
+	for i := 0; i < 1000; i++ {
+		hub.Publish(events.TypeCallStatus, nil)
+	}
+	for {
+		frame, err := ws.ReadFrame(r)
+		if err != nil {
+			t.Fatalf("Expected a close frame, got %v", err)
+		}
+		if frame.Header.OpCode == ws.OpClose {
+			code, _ := ws.ParseCloseFrameData(frame.Payload)
+			if code != ws.StatusGoingAway {
+				t.Errorf("Expected status 1001, got %d", code)
+			}
+			return
+		}
+	}
+}
+
+func TestEventHandler_StreamWebSocket_Origin(t *testing.T) {
+	handler := NewEventHandler(&Dependencies{Events: events.NewHub(10)})
+
+	tests := []struct {
+		name          string
+		origin        string
+		allowed       string // Access-Control-Allow-Origin set by CORSMiddleware
+		wantForbidden bool
+	}{
+		{"other site", "https://evil.example", "", true},
+		{"allowed by CORS policy", "https://app.example", "https://app.example", false},
+		{"same origin", "https://pbx.example", "", false},
+		{"no origin", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Requests past the origin check fail the upgrade instead, as
+			// the recorder cannot be hijacked
+			req := httptest.NewRequest(http.MethodGet, "https://pbx.example/api/events/ws", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rr := httptest.NewRecorder()
+			if tt.allowed != "" {
+				rr.Header().Set("Access-Control-Allow-Origin", tt.allowed)
+			}
+			handler.StreamWebSocket(rr, req)
+
+			if forbidden := rr.Code == http.StatusForbidden; forbidden != tt.wantForbidden {
+				t.Errorf("Expected forbidden %v, got status %d", tt.wantForbidden, rr.Code)
+			}
+		})
+	}
+}
+
+func TestEventHandler_StreamWebSocket_Unavailable(t *testing.T) {
+	handler := NewEventHandler(&Dependencies{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/events/ws", nil)
+	rr := httptest.NewRecorder()
+	handler.StreamWebSocket(rr, req)
+
+	assertStatus(t, rr, http.StatusServiceUnavailable)
+}
+
+func TestWebhookHandler_SMSStatus_PublishesEvent(t *testing.T) {
+	setup := setupTestAPI(t)
+	hub := events.NewHub(10)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB, Events: hub})
+
+	form := url.Values{"MessageSid": {"SM123"}, "MessageStatus": {"delivered"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/sms/status", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler.SMSStatus(rr, req)
+
+	assertStatus(t, rr, http.StatusOK)
+
+	backlog, _, cancel := hub.Subscribe(0)
+	defer cancel()
+	if len(backlog) != 1 || backlog[0].Type != events.TypeMessageStatus {
+		t.Fatalf("Expected one message.status event, got %+v", backlog)
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// forwardDetectTwiML forwards a call to an external number with answering
+// machine detection. When a machine answers, VoiceForwardAnswered hangs up
+// on it before the call is bridged, and VoiceForward sends the caller to
+// GoSIP's voicemail instead, as it does when nobody answers. That keeps
+// messages in one mailbox instead of the forward target's.
+func (h *WebhookHandler) forwardDetectTwiML(did *models.DID, number, callSID, whisperURL string, limit int) string {
+	didID := strconv.FormatInt(did.ID, 10)
+	answeredURL := "/api/webhooks/voice/forward/answered?DidId=" + didID + "&ParentCallSid=" + url.QueryEscape(callSID)
+	if whisperURL != "" {
+		answeredURL += "&WhisperUrl=" + url.QueryEscape(whisperURL)
+	}
+
+	return `<Response>
+		<Dial callerId="` + did.Number + `"` + timeLimitAttr(limit) + ` action="/api/webhooks/voice/forward?DidId=` + didID + `">
+			<Number machineDetection="Enable" url="` + escapeXML(answeredURL) + `">` + escapeXML(number) + `</Number>
+		</Dial>
+	</Response>`
+}
+
+// answeredByMachine reports whether an answering machine detection result
+// is a voicemail greeting or a fax rather than a person
+func answeredByMachine(answeredBy string) bool {
+	return strings.HasPrefix(answeredBy, "machine_") || answeredBy == "fax"
+}
+
+// VoiceForwardAnswered runs on the forwarded leg once answering machine
+// detection has decided who answered. Machines are hung up on; people are
+// bridged, hearing an anonymous caller's recorded name first.
+func (h *WebhookHandler) VoiceForwardAnswered(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || !h.validateSignature(r) {
+		h.respondTwiML(w, `<Response><Hangup/></Response>`)
+		return
+	}
+
+	query := r.URL.Query()
+	answeredBy := r.FormValue("AnsweredBy")
+	if answeredBy != "" {
+		if err := h.deps.DB.CDRs.SetAnsweredBy(r.Context(), query.Get("ParentCallSid"), answeredBy); err != nil {
+			slog.Warn("Failed to record who answered a forwarded call", "error", err, "call_sid", query.Get("ParentCallSid"))
+		}
+	}
+
+	if answeredByMachine(answeredBy) {
+		slog.Info("Forwarded call answered by a machine, returning it to voicemail", "call_sid", query.Get("ParentCallSid"), "answered_by", answeredBy)
+		h.respondTwiML(w, `<Response><Hangup/></Response>`)
+		return
+	}
+
+	if whisperURL := query.Get("WhisperUrl"); whisperURL != "" {
+		h.respondTwiML(w, `<Response><Redirect>`+escapeXML(whisperURL)+`</Redirect></Response>`)
+		return
+	}
+	h.respondTwiML(w, `<Response/>`)
+}
+
+// VoiceForward handles the end of a forward with answering machine
+// detection. Calls a person answered are done; calls a machine answered or
+// nobody answered go to voicemail.
+func (h *WebhookHandler) VoiceForward(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.respondTwiML(w, h.errorTwiML("Invalid request"))
+		return
+	}
+
+	if !h.validateSignature(r) {
+		h.respondTwiML(w, h.errorTwiML("Invalid signature"))
+		return
+	}
+
+	answered := r.FormValue("DialCallStatus") == "completed"
+	if cdr, err := h.deps.DB.CDRs.GetByCallSID(r.Context(), r.FormValue("CallSid")); err == nil && answeredByMachine(cdr.AnsweredBy) {
+		answered = false
+	}
+	if answered {
+		h.respondTwiML(w, `<Response><Hangup/></Response>`)
+		return
+	}
+
+	didID, _ := strconv.ParseInt(r.URL.Query().Get("DidId"), 10, 64)
+	did, err := h.deps.DB.DIDs.GetByID(r.Context(), didID)
+	if err != nil {
+		h.respondTwiML(w, h.errorTwiML("Number not found"))
+		return
+	}
+	h.respondTwiML(w, h.voicemailTwiML(did, r.FormValue("From")))
+}
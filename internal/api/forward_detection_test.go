@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWebhookHandler_ForwardVoicemailDetection(t *testing.T) {
+	setup := setupTestAPI(t)
+	did := createTestDID(t, setup.DB, "+15551234567")
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+	handler.recordInboundCall(context.Background(), did, "+15559876543", "CA123", "")
+	didID := strconv.FormatInt(did.ID, 10)
+
+	twiml := handler.forwardDetectTwiML(did, "+15550001111", "CA123", "", 0)
+	if !strings.Contains(twiml, `machineDetection="Enable"`) || !strings.Contains(twiml, "ParentCallSid=CA123") {
+		t.Errorf("Expected answering machine detection on the forward, got %s", twiml)
+	}
+
+	forwardEnded := func(status string) string {
+		rr := httptest.NewRecorder()
+		handler.VoiceForward(rr, newSignedWebhookRequest(t, setup.DB, "/api/webhooks/voice/forward?DidId="+didID,
+			url.Values{"CallSid": {"CA123"}, "From": {"+15559876543"}, "DialCallStatus": {status}}))
+		return rr.Body.String()
+	}
+	if body := forwardEnded("no-answer"); !strings.Contains(body, "<Record") {
+		t.Errorf("Expected voicemail for an unanswered forward, got %s", body)
+	}
+
+	answered := func(answeredBy string) string {
+		rr := httptest.NewRecorder()
+		handler.VoiceForwardAnswered(rr, newSignedWebhookRequest(t, setup.DB, "/api/webhooks/voice/forward/answered?DidId="+didID+"&ParentCallSid=CA123",
+			url.Values{"CallSid": {"CA456"}, "AnsweredBy": {answeredBy}}))
+		return rr.Body.String()
+	}
+
+	if body := answered("human"); strings.Contains(body, "<Hangup") {
+		t.Errorf("Expected a person bridged, got %s", body)
+	}
+	if body := forwardEnded("completed"); strings.Contains(body, "<Record") {
+		t.Errorf("Expected no voicemail after a person answered, got %s", body)
+	}
+
+	if body := answered("machine_end_beep"); !strings.Contains(body, "<Hangup") {
+		t.Errorf("Expected the machine hung up on, got %s", body)
+	}
+	cdr, err := setup.DB.CDRs.GetByCallSID(context.Background(), "CA123")
+	if err != nil || cdr.AnsweredBy != "machine_end_beep" {
+		t.Fatalf("Expected answered_by recorded, got %+v (%v)", cdr, err)
+	}
+	if body := forwardEnded("completed"); !strings.Contains(body, "<Record") {
+		t.Errorf("Expected voicemail after a machine answered, got %s", body)
+	}
+}
@@ -0,0 +1,574 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/audio"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/i18n"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/pkg/sip"
+	"github.com/go-chi/chi/v5"
+)
+
+// GreetingHandler manages voicemail greetings through the API and the phone feature code
+type GreetingHandler struct {
+	deps     *Dependencies
+	webhooks *WebhookHandler
+}
+
+// NewGreetingHandler creates a new GreetingHandler
+func NewGreetingHandler(deps *Dependencies) *GreetingHandler {
+	return &GreetingHandler{
+		deps:     deps,
+		webhooks: NewWebhookHandler(deps),
+	}
+}
+
+// List returns the greetings of a voicemail box
+func (h *GreetingHandler) List(w http.ResponseWriter, r *http.Request) {
+	didID, err := strconv.ParseInt(chi.URLParam(r, "didID"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid DID ID", nil)
+		return
+	}
+
+	greetings, err := h.deps.DB.Greetings.ListByDID(r.Context(), didID)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if greetings == nil {
+		greetings = []*models.VoicemailGreeting{}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"data": greetings})
+}
+
+// SaveGreetingRequest represents a greeting create/replace request
+type SaveGreetingRequest struct {
+	AudioURL  string     `json:"audio_url"`
+	Duration  int        `json:"duration"`
+	Active    bool       `json:"active"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Save creates or replaces a standard or temporary greeting
+func (h *GreetingHandler) Save(w http.ResponseWriter, r *http.Request) {
+	didID, greetingType, ok := h.parseGreetingParams(w, r)
+	if !ok {
+		return
+	}
+
+	var req SaveGreetingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	var errors []FieldError
+	if req.AudioURL == "" {
+		errors = append(errors, FieldError{Field: "audio_url", Message: "Audio URL is required"})
+	}
+	if req.ExpiresAt != nil && greetingType != db.GreetingTypeTemporary {
+		errors = append(errors, FieldError{Field: "expires_at", Message: "Only temporary greetings can expire"})
+	}
+	if len(errors) > 0 {
+		WriteValidationError(w, "Validation failed", errors)
+		return
+	}
+
+	if _, err := h.deps.DB.DIDs.GetByID(r.Context(), didID); err != nil {
+		if err == db.ErrDIDNotFound {
+			WriteNotFoundError(w, "DID")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	greeting := &models.VoicemailGreeting{
+		DIDID:        didID,
+		GreetingType: greetingType,
+		AudioURL:     req.AudioURL,
+		Duration:     req.Duration,
+		IsActive:     req.Active,
+		ExpiresAt:    req.ExpiresAt,
+	}
+	if err := h.deps.DB.Greetings.Save(r.Context(), greeting); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, greeting)
+}
+
+// Activate selects which greeting is played for a voicemail box
+func (h *GreetingHandler) Activate(w http.ResponseWriter, r *http.Request) {
+	didID, greetingType, ok := h.parseGreetingParams(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.deps.DB.Greetings.SetActive(r.Context(), didID, greetingType); err != nil {
+		if err == db.ErrGreetingNotFound {
+			WriteNotFoundError(w, "Greeting")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Greeting activated"})
+}
+
+// Delete removes a greeting from a voicemail box
+func (h *GreetingHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	didID, greetingType, ok := h.parseGreetingParams(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.deps.DB.Greetings.Delete(r.Context(), didID, greetingType); err != nil {
+		if err == db.ErrGreetingNotFound {
+			WriteNotFoundError(w, "Greeting")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+	if h.deps.Config != nil {
+		if err := os.Remove(filepath.Join(h.deps.Config.PromptsPath(), sip.GreetingFile(didID, greetingType))); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to delete greeting audio", "error", err, "did_id", didID, "type", greetingType)
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Greeting deleted successfully"})
+}
+
+// UploadAudio stores a WAV file as a standard or temporary greeting. Uploaded
+// greetings are played to callers GoSIP answers itself; calls answered by
+// Twilio hear the system greeting instead.
+// PUT /api/voicemail-boxes/{didID}/greetings/{type}/audio
+func (h *GreetingHandler) UploadAudio(w http.ResponseWriter, r *http.Request) {
+	didID, greetingType, ok := h.parseGreetingParams(w, r)
+	if !ok {
+		return
+	}
+	if h.deps.Config == nil {
+		WriteError(w, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Greetings can't be stored", nil)
+		return
+	}
+	if storageLow(r.Context(), h.deps) {
+		WriteError(w, http.StatusInsufficientStorage, "INSUFFICIENT_STORAGE",
+			"The server is low on disk space. Free up space before uploading audio.", nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, audio.MaxFileSize)
+	if err := r.ParseMultipartForm(audio.MaxFileSize); err != nil {
+		WriteValidationError(w, "Failed to parse form data", nil)
+		return
+	}
+	file, _, err := r.FormFile("audio")
+	if err != nil {
+		WriteValidationError(w, "No audio file provided. Use form field 'audio'.", nil)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		WriteValidationError(w, "Failed to read audio file", nil)
+		return
+	}
+
+	result := audio.ValidateWAV(bytes.NewReader(data), int64(len(data)))
+	if !result.Valid {
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "audio", Message: result.Error.Message},
+		})
+		return
+	}
+	if _, _, err := audio.DecodeWAV(data); err != nil {
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "audio", Message: "Audio must be 8 or 16-bit PCM"},
+		})
+		return
+	}
+	active, _ := strconv.ParseBool(r.FormValue("active"))
+
+	if _, err := h.deps.DB.DIDs.GetByID(r.Context(), didID); err != nil {
+		if err == db.ErrDIDNotFound {
+			WriteNotFoundError(w, "DID")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	path := filepath.Join(h.deps.Config.PromptsPath(), sip.GreetingFile(didID, greetingType))
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		slog.Error("Failed to save greeting audio", "error", err, "did_id", didID)
+		WriteInternalError(w)
+		return
+	}
+
+	greeting := &models.VoicemailGreeting{
+		DIDID:        didID,
+		GreetingType: greetingType,
+		AudioURL:     sip.GreetingURL(didID, greetingType),
+		Duration:     int(result.Duration + 0.5),
+		IsActive:     active,
+	}
+	if err := h.deps.DB.Greetings.Save(r.Context(), greeting); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, greeting)
+}
+
+// Audio serves a greeting uploaded to GoSIP
+// GET /api/voicemail-boxes/{didID}/greetings/{type}/audio
+func (h *GreetingHandler) Audio(w http.ResponseWriter, r *http.Request) {
+	didID, greetingType, ok := h.parseGreetingParams(w, r)
+	if !ok {
+		return
+	}
+
+	greeting, err := h.deps.DB.Greetings.GetByType(r.Context(), didID, greetingType)
+	if err != nil {
+		if err == db.ErrGreetingNotFound {
+			WriteNotFoundError(w, "Greeting")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+	if h.deps.Config == nil || greeting.AudioURL != sip.GreetingURL(didID, greetingType) {
+		WriteNotFoundError(w, "Greeting audio")
+		return
+	}
+
+	serveAudioFile(w, r, filepath.Join(h.deps.Config.PromptsPath(), sip.GreetingFile(didID, greetingType)),
+		fmt.Sprintf("greeting-%d-%s.wav", didID, greetingType), "")
+}
+
+func (h *GreetingHandler) parseGreetingParams(w http.ResponseWriter, r *http.Request) (int64, string, bool) {
+	didID, err := strconv.ParseInt(chi.URLParam(r, "didID"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid DID ID", nil)
+		return 0, "", false
+	}
+
+	greetingType := chi.URLParam(r, "type")
+	if greetingType != db.GreetingTypeStandard && greetingType != db.GreetingTypeTemporary {
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "type", Message: "Greeting type must be standard or temporary"},
+		})
+		return 0, "", false
+	}
+
+	return didID, greetingType, true
+}
+
+// Phone feature code flow
+//
+// A registered device dials the greeting feature code (default *97), picks a
+// mailbox when more than one voice DID is assigned to it, and then uses the
+// menu to record, review, re-record and activate greetings. Prompts use the
+// mailbox DID's language.
+
+// FeatureCode is the voice URL for calls placed by registered devices
+func (h *GreetingHandler) FeatureCode(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || !h.webhooks.validateSignature(r) {
+		h.webhooks.respondTwiML(w, h.webhooks.errorTwiML("Invalid request"))
+		return
+	}
+
+	// Only registered devices may manage greetings
+	device, err := h.deps.DB.Devices.GetByUsername(r.Context(), sipUser(r.FormValue("From")))
+	if err != nil {
+		h.webhooks.respondTwiML(w, h.webhooks.errorTwiML("This phone is not allowed to use feature codes."))
+		return
+	}
+
+	lang := i18n.Resolve(h.deps.DB.Config.GetForTenant(r.Context(), device.TenantID, "default_language", i18n.DefaultLanguage))
+
+	featureCode := h.deps.DB.Config.GetWithDefault(r.Context(), "voicemail_greeting_feature_code", config.DefaultGreetingFeatureCode)
+	if sipUser(r.FormValue("To")) != featureCode {
+		h.webhooks.respondTwiML(w, `<Response>`+sayTwiML(lang, i18n.Prompt(lang, i18n.PromptNumberNotFound))+`<Hangup/></Response>`)
+		return
+	}
+
+	dids, err := h.mailboxes(r.Context(), device)
+	if err != nil || len(dids) == 0 {
+		h.webhooks.respondTwiML(w, h.webhooks.errorTwiML("No voicemail boxes are assigned to this phone."))
+		return
+	}
+	if len(dids) == 1 {
+		h.webhooks.respondTwiML(w, h.menuTwiML(r.Context(), dids[0].ID, ""))
+		return
+	}
+
+	h.webhooks.respondTwiML(w, mailboxGatherTwiML(lang, i18n.PromptGreetingMailbox))
+}
+
+// SelectMailbox resolves the entered digits to one of the calling device's
+// voice DIDs: the one with that number, else the only one ending in them.
+// The caller is asked for the full number when several end in them.
+func (h *GreetingHandler) SelectMailbox(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || !h.webhooks.validateSignature(r) {
+		h.webhooks.respondTwiML(w, h.webhooks.errorTwiML("Invalid request"))
+		return
+	}
+
+	device, err := h.deps.DB.Devices.GetByUsername(r.Context(), sipUser(r.FormValue("From")))
+	if err != nil {
+		h.webhooks.respondTwiML(w, h.webhooks.errorTwiML("This phone is not allowed to use feature codes."))
+		return
+	}
+
+	digits := r.FormValue("Digits")
+	dids, err := h.mailboxes(r.Context(), device)
+	if err == nil && digits != "" {
+		did, ambiguous := matchMailbox(dids, digits)
+		if did != nil {
+			h.webhooks.respondTwiML(w, h.menuTwiML(r.Context(), did.ID, ""))
+			return
+		}
+		if ambiguous {
+			lang := i18n.Resolve(h.deps.DB.Config.GetForTenant(r.Context(), device.TenantID, "default_language", i18n.DefaultLanguage))
+			h.webhooks.respondTwiML(w, mailboxGatherTwiML(lang, i18n.PromptGreetingMailboxTie))
+			return
+		}
+	}
+
+	h.webhooks.respondTwiML(w, h.webhooks.errorTwiML("Mailbox not found."))
+}
+
+// mailboxes returns the voice DIDs a device may manage greetings of: the
+// ones assigned to it, within its tenant
+func (h *GreetingHandler) mailboxes(ctx context.Context, device *models.Device) ([]*models.DID, error) {
+	assigned, err := h.deps.DB.DeviceDIDs.ListByDevice(ctx, device.ID)
+	if err != nil {
+		return nil, err
+	}
+	var dids []*models.DID
+	for _, dd := range assigned {
+		if did, err := h.deps.DB.DIDs.GetByID(ctx, dd.DIDID); err == nil && did.VoiceEnabled && sameTenant(did.TenantID, device.TenantID) {
+			dids = append(dids, did)
+		}
+	}
+	return dids, nil
+}
+
+// matchMailbox finds the DID whose number is digits, else the only one
+// ending in them. ambiguous reports that several end in them.
+func matchMailbox(dids []*models.DID, digits string) (did *models.DID, ambiguous bool) {
+	var suffixed []*models.DID
+	for _, d := range dids {
+		number := strings.TrimPrefix(d.Number, "+")
+		if number == digits {
+			return d, false
+		}
+		if strings.HasSuffix(number, digits) {
+			suffixed = append(suffixed, d)
+		}
+	}
+	if len(suffixed) == 1 {
+		return suffixed[0], false
+	}
+	return nil, len(suffixed) > 1
+}
+
+// mailboxGatherTwiML asks for a mailbox number, ended with pound
+func mailboxGatherTwiML(lang, prompt string) string {
+	return `<Response>
+		<Gather finishOnKey="#" action="/api/webhooks/greetings/mailbox">
+			` + sayTwiML(lang, i18n.Prompt(lang, prompt)) + `
+		</Gather>
+		` + sayTwiML(lang, i18n.Prompt(lang, i18n.PromptGoodbye)) + `
+	</Response>`
+}
+
+// Menu handles the main greeting menu selection
+func (h *GreetingHandler) Menu(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || !h.webhooks.validateSignature(r) {
+		h.webhooks.respondTwiML(w, h.webhooks.errorTwiML("Invalid request"))
+		return
+	}
+
+	ctx := r.Context()
+	didID, _ := strconv.ParseInt(r.URL.Query().Get("DidId"), 10, 64)
+
+	switch r.FormValue("Digits") {
+	case "1":
+		h.webhooks.respondTwiML(w, h.recordTwiML(ctx, didID, db.GreetingTypeStandard))
+	case "2":
+		h.webhooks.respondTwiML(w, h.recordTwiML(ctx, didID, db.GreetingTypeTemporary))
+	case "3", "4":
+		greetingType := db.GreetingTypeStandard
+		if r.FormValue("Digits") == "4" {
+			greetingType = db.GreetingTypeTemporary
+		}
+		if err := h.deps.DB.Greetings.SetActive(ctx, didID, greetingType); err != nil {
+			h.webhooks.respondTwiML(w, h.menuTwiML(ctx, didID, i18n.PromptGreetingNotRecorded))
+			return
+		}
+		h.webhooks.respondTwiML(w, h.menuTwiML(ctx, didID, i18n.PromptGreetingActivated))
+	case "5":
+		greeting, err := h.deps.DB.Greetings.GetActive(ctx, didID)
+		if err != nil {
+			h.webhooks.respondTwiML(w, h.menuTwiML(ctx, didID, i18n.PromptGreetingSystem))
+			return
+		}
+		lang := h.language(ctx, didID)
+		h.webhooks.respondTwiML(w, `<Response>
+			`+sayTwiML(lang, i18n.Prompt(lang, i18n.PromptGreetingCurrent))+`
+			<Play>`+escapeXML(greeting.AudioURL)+`</Play>
+			<Redirect>`+h.menuURL(didID)+`</Redirect>
+		</Response>`)
+	default:
+		h.webhooks.respondTwiML(w, h.menuTwiML(ctx, didID, ""))
+	}
+}
+
+// Recorded plays back a new recording and asks the caller to save or re-record it
+func (h *GreetingHandler) Recorded(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || !h.webhooks.validateSignature(r) {
+		h.webhooks.respondTwiML(w, h.webhooks.errorTwiML("Invalid request"))
+		return
+	}
+
+	didID, _ := strconv.ParseInt(r.URL.Query().Get("DidId"), 10, 64)
+	greetingType := r.URL.Query().Get("Type")
+	recordingURL := r.FormValue("RecordingUrl")
+	if recordingURL == "" {
+		h.webhooks.respondTwiML(w, h.menuTwiML(r.Context(), didID, i18n.PromptGreetingNoRecording))
+		return
+	}
+
+	reviewURL := "/api/webhooks/greetings/review?" + url.Values{
+		"DidId":        {strconv.FormatInt(didID, 10)},
+		"Type":         {greetingType},
+		"RecordingUrl": {recordingURL},
+		"Duration":     {r.FormValue("RecordingDuration")},
+	}.Encode()
+
+	lang := h.language(r.Context(), didID)
+	h.webhooks.respondTwiML(w, `<Response>
+		`+sayTwiML(lang, i18n.Prompt(lang, i18n.PromptGreetingPlayback))+`
+		<Play>`+escapeXML(recordingURL)+`</Play>
+		<Gather numDigits="1" action="`+escapeXML(reviewURL)+`">
+			`+sayTwiML(lang, i18n.Prompt(lang, i18n.PromptGreetingReview))+`
+		</Gather>
+		<Redirect>`+h.menuURL(didID)+`</Redirect>
+	</Response>`)
+}
+
+// Review saves, re-records or discards a new recording
+func (h *GreetingHandler) Review(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || !h.webhooks.validateSignature(r) {
+		h.webhooks.respondTwiML(w, h.webhooks.errorTwiML("Invalid request"))
+		return
+	}
+
+	ctx := r.Context()
+	query := r.URL.Query()
+	didID, _ := strconv.ParseInt(query.Get("DidId"), 10, 64)
+	greetingType := query.Get("Type")
+	duration, _ := strconv.Atoi(query.Get("Duration"))
+
+	switch r.FormValue("Digits") {
+	case "1":
+		greeting := &models.VoicemailGreeting{
+			DIDID:        didID,
+			GreetingType: greetingType,
+			AudioURL:     query.Get("RecordingUrl"),
+			Duration:     duration,
+			IsActive:     true,
+		}
+		if err := h.deps.DB.Greetings.Save(ctx, greeting); err != nil {
+			h.webhooks.respondTwiML(w, h.menuTwiML(ctx, didID, i18n.PromptGreetingNotSaved))
+			return
+		}
+		h.webhooks.respondTwiML(w, h.menuTwiML(ctx, didID, i18n.PromptGreetingSaved))
+	case "2":
+		h.webhooks.respondTwiML(w, h.recordTwiML(ctx, didID, greetingType))
+	default:
+		h.webhooks.respondTwiML(w, h.menuTwiML(ctx, didID, i18n.PromptGreetingDiscarded))
+	}
+}
+
+// language returns the prompt language of a mailbox
+func (h *GreetingHandler) language(ctx context.Context, didID int64) string {
+	did, err := h.deps.DB.DIDs.GetByID(ctx, didID)
+	if err != nil {
+		return i18n.Resolve(h.deps.DB.Config.GetWithDefault(ctx, "default_language", i18n.DefaultLanguage))
+	}
+	return h.webhooks.callLanguage(ctx, did)
+}
+
+func (h *GreetingHandler) menuURL(didID int64) string {
+	return "/api/webhooks/greetings/menu?DidId=" + strconv.FormatInt(didID, 10)
+}
+
+// menuTwiML renders the greeting menu, preceded by an optional notice prompt key
+func (h *GreetingHandler) menuTwiML(ctx context.Context, didID int64, notice string) string {
+	lang := h.language(ctx, didID)
+
+	say := ""
+	if notice != "" {
+		say = sayTwiML(lang, i18n.Prompt(lang, notice))
+	}
+
+	return `<Response>
+		` + say + `
+		<Gather numDigits="1" action="` + h.menuURL(didID) + `">
+			` + sayTwiML(lang, i18n.Prompt(lang, i18n.PromptGreetingMenu)) + `
+		</Gather>
+		` + sayTwiML(lang, i18n.Prompt(lang, i18n.PromptGoodbye)) + `
+	</Response>`
+}
+
+func (h *GreetingHandler) recordTwiML(ctx context.Context, didID int64, greetingType string) string {
+	if storageLow(ctx, h.deps) {
+		return h.menuTwiML(ctx, didID, i18n.PromptGreetingNotSaved)
+	}
+
+	lang := h.language(ctx, didID)
+	actionURL := "/api/webhooks/greetings/recorded?DidId=" + strconv.FormatInt(didID, 10) + "&amp;Type=" + greetingType
+
+	return `<Response>
+		` + sayTwiML(lang, i18n.Prompt(lang, i18n.PromptGreetingRecord)) + `
+		<Record maxLength="60" finishOnKey="#" playBeep="true" action="` + actionURL + `"/>
+		<Redirect>` + h.menuURL(didID) + `</Redirect>
+	</Response>`
+}
+
+// sipUser extracts the user part of a SIP URI such as sip:alice@example.com
+func sipUser(uri string) string {
+	uri = strings.TrimPrefix(strings.TrimPrefix(uri, "sips:"), "sip:")
+	if at := strings.Index(uri, "@"); at >= 0 {
+		uri = uri[:at]
+	}
+	return uri
+}
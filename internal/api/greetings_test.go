@@ -0,0 +1,276 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/audio"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/pkg/sip"
+)
+
+func TestGreetingHandler_Save(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewGreetingHandler(&Dependencies{DB: setup.DB})
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	didID := strconv.FormatInt(did.ID, 10)
+
+	tests := []struct {
+		name         string
+		greetingType string
+		body         string
+		expected     int
+	}{
+		{"standard greeting", "standard", `{"audio_url": "https://example.com/a.wav", "duration": 4, "active": true}`, http.StatusOK},
+		{"invalid type", "busy", `{"audio_url": "https://example.com/a.wav"}`, http.StatusBadRequest},
+		{"missing audio", "standard", `{}`, http.StatusBadRequest},
+		{"standard cannot expire", "standard", `{"audio_url": "https://example.com/a.wav", "expires_at": "2030-01-01T00:00:00Z"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/api/voicemail-boxes/"+didID+"/greetings/"+tt.greetingType, bytes.NewBufferString(tt.body))
+			req = withURLParams(req, map[string]string{"didID": didID, "type": tt.greetingType})
+			rr := httptest.NewRecorder()
+			handler.Save(rr, req)
+
+			assertStatus(t, rr, tt.expected)
+		})
+	}
+
+	active, err := setup.DB.Greetings.GetActive(context.Background(), did.ID)
+	if err != nil {
+		t.Fatalf("Expected saved greeting to be active: %v", err)
+	}
+	if active.AudioURL != "https://example.com/a.wav" {
+		t.Errorf("Expected saved audio URL, got %s", active.AudioURL)
+	}
+}
+
+func TestGreetingHandler_FeatureCode(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewGreetingHandler(&Dependencies{DB: setup.DB})
+
+	device := createTestDevice(t, setup.DB, "Desk Phone", "alice")
+	did := createTestDID(t, setup.DB, "+15551234567")
+	// Not assigned to the phone, so not its mailbox
+	createTestDID(t, setup.DB, "+15559994567")
+	setup.DB.DeviceDIDs.SetForDevice(context.Background(), device.ID, []int64{did.ID}, nil)
+
+	t.Run("unregistered caller is refused", func(t *testing.T) {
+		req := newSignedWebhookRequest(t, setup.DB, "/api/webhooks/greetings/feature", url.Values{
+			"From": {"sip:mallory@example.com"},
+			"To":   {"sip:*97@example.com"},
+		})
+		rr := httptest.NewRecorder()
+		handler.FeatureCode(rr, req)
+
+		if !strings.Contains(rr.Body.String(), "<Hangup/>") {
+			t.Errorf("Expected hangup TwiML, got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("single mailbox goes straight to the menu", func(t *testing.T) {
+		req := newSignedWebhookRequest(t, setup.DB, "/api/webhooks/greetings/feature", url.Values{
+			"From": {"sip:alice@example.com"},
+			"To":   {"sip:*97@example.com"},
+		})
+		rr := httptest.NewRecorder()
+		handler.FeatureCode(rr, req)
+
+		if !strings.Contains(rr.Body.String(), "/api/webhooks/greetings/menu?DidId="+strconv.FormatInt(did.ID, 10)) {
+			t.Errorf("Expected greeting menu, got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("phone without mailboxes is refused", func(t *testing.T) {
+		createTestDevice(t, setup.DB, "Lobby Phone", "lobby")
+		req := newSignedWebhookRequest(t, setup.DB, "/api/webhooks/greetings/feature", url.Values{
+			"From": {"sip:lobby@example.com"},
+			"To":   {"sip:*97@example.com"},
+		})
+		rr := httptest.NewRecorder()
+		handler.FeatureCode(rr, req)
+
+		if !strings.Contains(rr.Body.String(), "<Hangup/>") {
+			t.Errorf("Expected hangup TwiML, got %s", rr.Body.String())
+		}
+	})
+}
+
+func TestGreetingHandler_SelectMailbox(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewGreetingHandler(&Dependencies{DB: setup.DB})
+
+	device := createTestDevice(t, setup.DB, "Desk Phone", "alice")
+	home := createTestDID(t, setup.DB, "+15551234567")
+	office := createTestDID(t, setup.DB, "+15557654567")
+	shop := createTestDID(t, setup.DB, "+15550001111")
+	createTestDID(t, setup.DB, "+15552223333")
+	setup.DB.DeviceDIDs.SetForDevice(context.Background(), device.ID, []int64{home.ID, office.ID, shop.ID}, nil)
+
+	menu := func(did int64) string {
+		return "/api/webhooks/greetings/menu?DidId=" + strconv.FormatInt(did, 10)
+	}
+	tests := []struct {
+		name   string
+		from   string
+		digits string
+		want   string
+	}{
+		{"unique suffix", "alice", "1111", menu(shop.ID)},
+		{"full number", "alice", "15557654567", menu(office.ID)},
+		{"shared suffix asks again", "alice", "4567", `finishOnKey="#"`},
+		{"other phone's mailbox", "alice", "3333", "<Hangup/>"},
+		{"unknown phone", "mallory", "1111", "<Hangup/>"},
+	}
+	for _, tt := range tests {
+		req := newSignedWebhookRequest(t, setup.DB, "/api/webhooks/greetings/mailbox", url.Values{
+			"From":   {"sip:" + tt.from + "@example.com"},
+			"Digits": {tt.digits},
+		})
+		rr := httptest.NewRecorder()
+		handler.SelectMailbox(rr, req)
+		if !strings.Contains(rr.Body.String(), tt.want) {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, rr.Body.String())
+		}
+	}
+
+	// A DID moved to a tenant is no longer the instance phone's mailbox
+	acme := &models.Tenant{Name: "Acme"}
+	setup.DB.Tenants.Create(context.Background(), acme)
+	setup.DB.DIDs.SetTenant(context.Background(), shop.ID, &acme.ID)
+	req := newSignedWebhookRequest(t, setup.DB, "/api/webhooks/greetings/mailbox", url.Values{
+		"From":   {"sip:alice@example.com"},
+		"Digits": {"1111"},
+	})
+	rr := httptest.NewRecorder()
+	handler.SelectMailbox(rr, req)
+	if !strings.Contains(rr.Body.String(), "<Hangup/>") {
+		t.Errorf("Expected another tenant's mailbox refused, got %s", rr.Body.String())
+	}
+}
+
+func TestGreetingHandler_RecordAndReview(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewGreetingHandler(&Dependencies{DB: setup.DB})
+	webhooks := NewWebhookHandler(&Dependencies{DB: setup.DB})
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	didID := strconv.FormatInt(did.ID, 10)
+
+	// Menu option 2 records a temporary greeting
+	req := newSignedWebhookRequest(t, setup.DB, "/api/webhooks/greetings/menu?DidId="+didID, url.Values{"Digits": {"2"}})
+	rr := httptest.NewRecorder()
+	handler.Menu(rr, req)
+	if !strings.Contains(rr.Body.String(), "Type=temporary") {
+		t.Fatalf("Expected temporary greeting recording, got %s", rr.Body.String())
+	}
+
+	// Pressing 2 at review records again without saving
+	review := "/api/webhooks/greetings/review?" + url.Values{
+		"DidId":        {didID},
+		"Type":         {db.GreetingTypeTemporary},
+		"RecordingUrl": {"https://api.twilio.com/rec/RE1"},
+		"Duration":     {"3"},
+	}.Encode()
+	req = newSignedWebhookRequest(t, setup.DB, review, url.Values{"Digits": {"2"}})
+	rr = httptest.NewRecorder()
+	handler.Review(rr, req)
+	if !strings.Contains(rr.Body.String(), "<Record") {
+		t.Errorf("Expected re-record TwiML, got %s", rr.Body.String())
+	}
+	if _, err := setup.DB.Greetings.GetActive(context.Background(), did.ID); err != db.ErrGreetingNotFound {
+		t.Errorf("Expected no greeting before saving, got %v", err)
+	}
+
+	// Pressing 1 saves and activates the recording
+	req = newSignedWebhookRequest(t, setup.DB, review, url.Values{"Digits": {"1"}})
+	rr = httptest.NewRecorder()
+	handler.Review(rr, req)
+
+	active, err := setup.DB.Greetings.GetActive(context.Background(), did.ID)
+	if err != nil {
+		t.Fatalf("Expected saved greeting: %v", err)
+	}
+	if active.GreetingType != db.GreetingTypeTemporary || active.Duration != 3 {
+		t.Errorf("Unexpected saved greeting: %+v", active)
+	}
+
+	// Callers reaching voicemail now hear the recorded greeting
+	twiml := webhooks.voicemailTwiML(did, "+15559876543")
+	if !strings.Contains(twiml, "<Play>https://api.twilio.com/rec/RE1</Play>") {
+		t.Errorf("Expected recorded greeting in voicemail TwiML, got %s", twiml)
+	}
+}
+
+// greetingUpload is a multipart form uploading data as a greeting
+func greetingUpload(t *testing.T, didID, greetingType string, data []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("audio", "greeting.wav")
+	part.Write(data)
+	form.WriteField("active", "true")
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPut, "/api/voicemail-boxes/"+didID+"/greetings/"+greetingType+"/audio", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return withURLParams(req, map[string]string{"didID": didID, "type": greetingType})
+}
+
+func TestGreetingHandler_UploadAudio(t *testing.T) {
+	setup := setupTestAPI(t)
+	cfg := &config.Config{DataDir: t.TempDir()}
+	handler := NewGreetingHandler(&Dependencies{DB: setup.DB, Config: cfg})
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	didID := strconv.FormatInt(did.ID, 10)
+
+	// Two seconds of 8 kHz silence
+	var wav bytes.Buffer
+	audio.WriteWAVHeader(&wav, audio.ChannelsMono, 8000, 32000)
+	wav.Write(make([]byte, 32000))
+
+	rr := httptest.NewRecorder()
+	handler.UploadAudio(rr, greetingUpload(t, didID, "standard", []byte("not audio")))
+	assertStatus(t, rr, http.StatusBadRequest)
+
+	rr = httptest.NewRecorder()
+	handler.UploadAudio(rr, greetingUpload(t, didID, "standard", wav.Bytes()))
+	assertStatus(t, rr, http.StatusOK)
+
+	greeting, err := setup.DB.Greetings.GetActive(context.Background(), did.ID)
+	if err != nil || greeting.AudioURL != sip.GreetingURL(did.ID, "standard") || greeting.Duration != 2 {
+		t.Fatalf("Expected the uploaded greeting active, got %+v, %v", greeting, err)
+	}
+
+	req := withURLParams(httptest.NewRequest(http.MethodGet, greeting.AudioURL, nil), map[string]string{"didID": didID, "type": "standard"})
+	rr = httptest.NewRecorder()
+	handler.Audio(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+	if !bytes.Equal(rr.Body.Bytes(), wav.Bytes()) {
+		t.Error("Expected the uploaded WAV file served")
+	}
+
+	// Deleting the greeting deletes its audio
+	req = withURLParams(httptest.NewRequest(http.MethodDelete, "/", nil), map[string]string{"didID": didID, "type": "standard"})
+	rr = httptest.NewRecorder()
+	handler.Delete(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+	if _, err := os.Stat(filepath.Join(cfg.PromptsPath(), sip.GreetingFile(did.ID, "standard"))); !os.IsNotExist(err) {
+		t.Errorf("Expected the greeting audio deleted, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/integrity"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/pkg/sip"
+	"github.com/go-chi/chi/v5"
+)
+
+// NewVoicemailHooks connects the SIP server's local voicemail to the DID
+// routes, mailbox quotas and the notifications of new voicemail
+func NewVoicemailHooks(deps *Dependencies) sip.VoicemailHooks {
+	webhooks := NewWebhookHandler(deps)
+	return sip.VoicemailHooks{
+		Routed: func(ctx context.Context, did *models.DID, callerID string) bool {
+			route := webhooks.matchRoute(ctx, did, callerID)
+			return route == nil || route.ActionType == "voicemail"
+		},
+		BoxFull: func(ctx context.Context, did *models.DID) bool {
+			return voicemailBoxFull(ctx, deps, did.ID) || storageLow(ctx, deps)
+		},
+		Saved: func(vm *models.Voicemail) {
+			ctx := context.Background()
+			enforceVoicemailQuota(ctx, deps, *vm.UserID, vm.ID)
+			checkVoicemailQuotaWarning(ctx, deps, *vm.UserID)
+			webhooks.voicemailReceived(vm)
+		},
+	}
+}
+
+// localVoicemailPath returns the audio file of a voicemail GoSIP recorded
+// itself, or "" for voicemail recorded by Twilio
+func localVoicemailPath(deps *Dependencies, vm *models.Voicemail) string {
+	if deps.Config == nil || vm.AudioURL != sip.VoicemailURL(vm.ID) {
+		return ""
+	}
+	return filepath.Join(deps.Config.VoicemailsPath(), sip.VoicemailFile(vm.ID))
+}
+
+// removeVoicemailAudio deletes the audio file of a voicemail GoSIP
+// recorded itself
+func removeVoicemailAudio(deps *Dependencies, vm *models.Voicemail) error {
+	path := localVoicemailPath(deps, vm)
+	if path == "" {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// serveAudioFile serves a WAV file, answering range requests. A file with
+// a checksum is refused once it no longer matches it.
+func serveAudioFile(w http.ResponseWriter, r *http.Request, path, name, checksum string) {
+	if checksum != "" {
+		if err := integrity.Verify(path, checksum); errors.Is(err, integrity.ErrCorrupted) {
+			slog.Error("Refusing to serve a corrupted audio file", "file", path)
+			WriteError(w, http.StatusInternalServerError, ErrCodeMediaCorrupted,
+				"The audio file is corrupted. Restore it from a backup.", nil)
+			return
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		WriteNotFoundError(w, "Audio")
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "audio/wav")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+// Audio serves the WAV file of a voicemail GoSIP recorded itself. Voicemail
+// recorded by Twilio is played from its audio_url instead.
+// GET /api/voicemails/{id}/audio
+func (h *VoicemailHandler) Audio(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid voicemail ID", nil)
+		return
+	}
+
+	vm, err := h.deps.DB.Voicemails.GetByID(r.Context(), id)
+	if err != nil {
+		if err == db.ErrVoicemailNotFound {
+			WriteNotFoundError(w, "Voicemail")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	path := localVoicemailPath(h.deps, vm)
+	if path == "" {
+		WriteNotFoundError(w, "Voicemail audio")
+		return
+	}
+	checksum, err := h.deps.DB.Voicemails.Checksum(r.Context(), vm.ID)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	serveAudioFile(w, r, path, "voicemail-"+strconv.FormatInt(vm.ID, 10)+".wav", checksum)
+}
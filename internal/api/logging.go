@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/logging"
+)
+
+// LoggingHandler reports and changes log levels while the server runs.
+// Changes last until the next restart.
+type LoggingHandler struct {
+	deps *Dependencies
+}
+
+// NewLoggingHandler creates a new LoggingHandler
+func NewLoggingHandler(deps *Dependencies) *LoggingHandler {
+	return &LoggingHandler{deps: deps}
+}
+
+// LoggingResponse lists the level of every subsystem
+type LoggingResponse struct {
+	Levels []logging.Level `json:"levels"`
+}
+
+// available writes an error and returns false when runtime log levels
+// aren't set up
+func (h *LoggingHandler) available(w http.ResponseWriter) bool {
+	if h.deps.Logging == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Runtime log levels are not available", nil)
+		return false
+	}
+	return true
+}
+
+// Get returns the level of every subsystem (admin only)
+func (h *LoggingHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	WriteJSON(w, http.StatusOK, LoggingResponse{Levels: h.deps.Logging.Snapshot()})
+}
+
+// UpdateLoggingRequest maps subsystems, or "default", to a level name
+type UpdateLoggingRequest struct {
+	Levels map[string]string `json:"levels"`
+}
+
+// Update sets the level of one or more subsystems (admin only). Setting a
+// level ends any temporary debug logging for that subsystem.
+func (h *LoggingHandler) Update(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+
+	var req UpdateLoggingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	var errors []FieldError
+	if len(req.Levels) == 0 {
+		errors = append(errors, FieldError{Field: "levels", Message: "At least one level is required"})
+	}
+	names := make([]string, 0, len(req.Levels))
+	for name := range req.Levels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	levels := make(map[string]slog.Level, len(names))
+	for _, name := range names {
+		field := "levels." + name
+		if !validLogSubsystem(name, false) {
+			errors = append(errors, FieldError{Field: field, Message: "Unknown subsystem"})
+			continue
+		}
+		level, err := logging.ParseLevel(req.Levels[name])
+		if err != nil {
+			errors = append(errors, FieldError{Field: field, Message: "Level must be debug, info, warn or error"})
+			continue
+		}
+		levels[name] = level
+	}
+	if len(errors) > 0 {
+		WriteValidationError(w, "Validation failed", errors)
+		return
+	}
+
+	for _, name := range names {
+		h.deps.Logging.Set(name, levels[name])
+	}
+
+	WriteJSON(w, http.StatusOK, LoggingResponse{Levels: h.deps.Logging.Snapshot()})
+}
+
+// LoggingDebugRequest turns on temporary debug logging
+type LoggingDebugRequest struct {
+	Subsystem string `json:"subsystem"` // A subsystem, "default" or "all"
+	Minutes   int    `json:"minutes"`
+}
+
+// Debug turns on debug logging for a subsystem, or every subsystem, for a
+// number of minutes, after which the previous level comes back (admin only)
+func (h *LoggingHandler) Debug(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+
+	var req LoggingDebugRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	if req.Minutes == 0 {
+		req.Minutes = config.LogDebugDefaultMinutes
+	}
+
+	var errors []FieldError
+	if !validLogSubsystem(req.Subsystem, true) {
+		errors = append(errors, FieldError{Field: "subsystem", Message: "Subsystem must be one of the logged subsystems, default or all"})
+	}
+	if req.Minutes < 1 || req.Minutes > config.LogDebugMaxMinutes {
+		errors = append(errors, FieldError{Field: "minutes", Message: fmt.Sprintf("Minutes must be between 1 and %d", config.LogDebugMaxMinutes)})
+	}
+	if len(errors) > 0 {
+		WriteValidationError(w, "Validation failed", errors)
+		return
+	}
+
+	names := []string{req.Subsystem}
+	if req.Subsystem == "all" {
+		names = append([]string{logging.Default}, logging.Subsystems()...)
+	}
+	d := time.Duration(req.Minutes) * time.Minute
+	for _, name := range names {
+		h.deps.Logging.Debug(name, d)
+	}
+
+	WriteJSON(w, http.StatusOK, LoggingResponse{Levels: h.deps.Logging.Snapshot()})
+}
+
+// validLogSubsystem reports whether name is a subsystem or "default", and
+// "all" when allowed
+func validLogSubsystem(name string, all bool) bool {
+	if name == logging.Default || (all && name == "all") {
+		return true
+	}
+	for _, subsystem := range logging.Subsystems() {
+		if name == subsystem {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/logging"
+)
+
+func TestLoggingHandler_Update(t *testing.T) {
+	levels := logging.NewLevels(slog.LevelInfo)
+	handler := NewLoggingHandler(&Dependencies{Logging: levels})
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"empty", `{"levels": {}}`, http.StatusBadRequest},
+		{"unknown subsystem", `{"levels": {"voip": "debug"}}`, http.StatusBadRequest},
+		{"unknown level", `{"levels": {"sip": "verbose"}}`, http.StatusBadRequest},
+		{"valid", `{"levels": {"sip": "warn", "default": "error"}}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.Update(rr, httptest.NewRequest(http.MethodPut, "/api/system/logging", bytes.NewBufferString(tt.body)))
+			assertStatus(t, rr, tt.want)
+			if tt.want == http.StatusBadRequest {
+				assertErrorCode(t, rr, ErrCodeValidation)
+			}
+		})
+	}
+
+	if levels.Level(logging.SubsystemSIP) != slog.LevelWarn || levels.Level(logging.Default) != slog.LevelError {
+		t.Errorf("Expected sip at warn and default at error, got %+v", levels.Snapshot())
+	}
+	if levels.Level(logging.SubsystemAPI) != slog.LevelInfo {
+		t.Errorf("Expected api to keep info, got %v", levels.Level(logging.SubsystemAPI))
+	}
+}
+
+func TestLoggingHandler_Debug(t *testing.T) {
+	levels := logging.NewLevels(slog.LevelInfo)
+	handler := NewLoggingHandler(&Dependencies{Logging: levels})
+
+	debug := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.Debug(rr, httptest.NewRequest(http.MethodPost, "/api/system/logging/debug", bytes.NewBufferString(body)))
+		return rr
+	}
+
+	assertStatus(t, debug(`{"subsystem": "voip"}`), http.StatusBadRequest)
+	assertStatus(t, debug(`{"subsystem": "sip", "minutes": 1000}`), http.StatusBadRequest)
+
+	rr := debug(`{"subsystem": "twilio"}`)
+	assertStatus(t, rr, http.StatusOK)
+	var resp LoggingResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	for _, level := range resp.Levels {
+		debugging := level.Subsystem == logging.SubsystemTwilio
+		if (level.Level == "debug") != debugging || (level.DebugUntil != nil) != debugging {
+			t.Errorf("Expected only twilio in temporary debug mode, got %+v", level)
+		}
+	}
+
+	assertStatus(t, debug(`{"subsystem": "all", "minutes": 5}`), http.StatusOK)
+	for _, level := range levels.Snapshot() {
+		if level.Level != "debug" || level.DebugUntil == nil {
+			t.Errorf("Expected %s in temporary debug mode, got %+v", level.Subsystem, level)
+		}
+	}
+}
+
+func TestLoggingHandler_Unavailable(t *testing.T) {
+	handler := NewLoggingHandler(&Dependencies{})
+	rr := httptest.NewRecorder()
+	handler.Get(rr, httptest.NewRequest(http.MethodGet, "/api/system/logging", nil))
+	assertStatus(t, rr, http.StatusServiceUnavailable)
+}
@@ -0,0 +1,439 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/btafoya/gosip/internal/channels"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/smtpd"
+)
+
+// MailGatewayHandler converts emails sent to number@domain into SMS and
+// manages the gateway settings
+type MailGatewayHandler struct {
+	deps *Dependencies
+
+	// sent counts texts sent per envelope sender
+	sentMu sync.Mutex
+	sent   map[string]*gatewaySent
+}
+
+// NewMailGatewayHandler creates a new MailGatewayHandler
+func NewMailGatewayHandler(deps *Dependencies) *MailGatewayHandler {
+	return &MailGatewayHandler{deps: deps, sent: make(map[string]*gatewaySent)}
+}
+
+// MailGatewaySettings configures the email-to-SMS gateway and the mirroring
+// of inbound SMS to a mailbox
+type MailGatewaySettings struct {
+	DIDID          int64    `json:"did_id"` // DID texts are sent from (0 disables the gateway)
+	Domain         string   `json:"domain"` // Only number@domain is accepted when set
+	AllowedSenders []string `json:"allowed_senders"`
+	MirrorEnabled  bool     `json:"mirror_enabled"`
+	MirrorEmail    string   `json:"mirror_email"`
+	ListenerPort   int      `json:"listener_port"`
+}
+
+// loadMailGatewaySettings reads the gateway settings from the system config
+func loadMailGatewaySettings(ctx context.Context, deps *Dependencies) MailGatewaySettings {
+	settings := MailGatewaySettings{
+		Domain:         deps.DB.Config.GetWithDefault(ctx, db.ConfigKeyMailGatewayDomain, ""),
+		AllowedSenders: []string{},
+		MirrorEnabled:  deps.DB.Config.GetWithDefault(ctx, db.ConfigKeyMailGatewayMirrorEnabled, "false") == "true",
+		MirrorEmail:    deps.DB.Config.GetWithDefault(ctx, db.ConfigKeyMailGatewayMirrorEmail, ""),
+	}
+	settings.DIDID, _ = strconv.ParseInt(deps.DB.Config.GetWithDefault(ctx, db.ConfigKeyMailGatewayDIDID, "0"), 10, 64)
+	for _, sender := range strings.Split(deps.DB.Config.GetWithDefault(ctx, db.ConfigKeyMailGatewayAllowedSenders, ""), ",") {
+		if sender = strings.TrimSpace(sender); sender != "" {
+			settings.AllowedSenders = append(settings.AllowedSenders, sender)
+		}
+	}
+	if deps.Config != nil {
+		settings.ListenerPort = deps.Config.MailGatewayPort
+	}
+	return settings
+}
+
+// Get returns the gateway settings (admin only)
+func (h *MailGatewayHandler) Get(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, loadMailGatewaySettings(r.Context(), h.deps))
+}
+
+// UpdateMailGatewayRequest represents a gateway settings change. Omitted
+// fields keep their current value.
+type UpdateMailGatewayRequest struct {
+	DIDID          *int64    `json:"did_id,omitempty"`
+	Domain         *string   `json:"domain,omitempty"`
+	AllowedSenders *[]string `json:"allowed_senders,omitempty"`
+	MirrorEnabled  *bool     `json:"mirror_enabled,omitempty"`
+	MirrorEmail    *string   `json:"mirror_email,omitempty"`
+}
+
+// Update changes the gateway settings (admin only)
+func (h *MailGatewayHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var req UpdateMailGatewayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	settings := loadMailGatewaySettings(r.Context(), h.deps)
+	if req.DIDID != nil {
+		settings.DIDID = *req.DIDID
+	}
+	if req.Domain != nil {
+		settings.Domain = strings.ToLower(strings.TrimSpace(*req.Domain))
+	}
+	if req.AllowedSenders != nil {
+		settings.AllowedSenders = []string{}
+		for _, sender := range *req.AllowedSenders {
+			if sender = strings.ToLower(strings.TrimSpace(sender)); sender != "" {
+				settings.AllowedSenders = append(settings.AllowedSenders, sender)
+			}
+		}
+	}
+	if req.MirrorEnabled != nil {
+		settings.MirrorEnabled = *req.MirrorEnabled
+	}
+	if req.MirrorEmail != nil {
+		settings.MirrorEmail = strings.TrimSpace(*req.MirrorEmail)
+	}
+
+	var errors []FieldError
+	if settings.DIDID != 0 {
+		did, err := h.deps.DB.DIDs.GetByID(r.Context(), settings.DIDID)
+		if err != nil && err != db.ErrDIDNotFound {
+			WriteInternalError(w)
+			return
+		}
+		if err == db.ErrDIDNotFound {
+			errors = append(errors, FieldError{Field: "did_id", Message: "DID not found"})
+		} else if !did.SMSEnabled {
+			errors = append(errors, FieldError{Field: "did_id", Message: "DID is not SMS-enabled"})
+		}
+	}
+	if settings.Domain != "" && (strings.ContainsAny(settings.Domain, "@ ,") || !strings.Contains(settings.Domain, ".")) {
+		errors = append(errors, FieldError{Field: "domain", Message: "Invalid domain"})
+	}
+	for _, sender := range settings.AllowedSenders {
+		if !validSenderPattern(sender) {
+			errors = append(errors, FieldError{Field: "allowed_senders", Message: "Allowed senders must be email addresses or @domain"})
+			break
+		}
+	}
+	if settings.MirrorEmail != "" {
+		if _, err := mail.ParseAddress(settings.MirrorEmail); err != nil {
+			errors = append(errors, FieldError{Field: "mirror_email", Message: "Invalid email address"})
+		}
+	} else if settings.MirrorEnabled {
+		errors = append(errors, FieldError{Field: "mirror_email", Message: "Mirror email is required when mirroring is enabled"})
+	}
+
+	if len(errors) > 0 {
+		WriteValidationError(w, "Validation failed", errors)
+		return
+	}
+
+	values := map[string]string{
+		db.ConfigKeyMailGatewayDIDID:          strconv.FormatInt(settings.DIDID, 10),
+		db.ConfigKeyMailGatewayDomain:         settings.Domain,
+		db.ConfigKeyMailGatewayAllowedSenders: strings.Join(settings.AllowedSenders, ","),
+		db.ConfigKeyMailGatewayMirrorEnabled:  strconv.FormatBool(settings.MirrorEnabled),
+		db.ConfigKeyMailGatewayMirrorEmail:    settings.MirrorEmail,
+	}
+	for key, value := range values {
+		if err := h.deps.DB.Config.Set(r.Context(), key, value); err != nil {
+			WriteInternalError(w)
+			return
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, settings)
+}
+
+// validSenderPattern reports whether an allowlist entry is an email address
+// or a whole domain written as @domain
+func validSenderPattern(pattern string) bool {
+	if domain, ok := strings.CutPrefix(pattern, "@"); ok {
+		return domain != "" && !strings.ContainsAny(domain, "@ ,")
+	}
+	addr, err := mail.ParseAddress(pattern)
+	return err == nil && addr.Address == pattern
+}
+
+// senderAllowed reports whether an email address matches the allowlist.
+// An empty allowlist refuses everyone.
+func senderAllowed(allowed []string, address string) bool {
+	address = strings.ToLower(address)
+	_, domain, ok := strings.Cut(address, "@")
+	if !ok {
+		return false
+	}
+	for _, pattern := range allowed {
+		if pattern == address || pattern == "@"+domain {
+			return true
+		}
+	}
+	return false
+}
+
+// gatewayRecipient matches the local part of number@domain addresses
+var gatewayRecipient = regexp.MustCompile(`^\+?[0-9]{8,15}$`)
+
+// recipientNumber returns the E.164 number an email is addressed to
+func recipientNumber(address, domain string) (string, error) {
+	local, host, ok := strings.Cut(address, "@")
+	if !ok {
+		return "", fmt.Errorf("%w: invalid recipient", smtpd.ErrRejected)
+	}
+	if domain != "" && !strings.EqualFold(host, domain) {
+		return "", fmt.Errorf("%w: relay not permitted", smtpd.ErrRejected)
+	}
+	if !gatewayRecipient.MatchString(local) {
+		return "", fmt.Errorf("%w: recipient must be a phone number", smtpd.ErrRejected)
+	}
+	return "+" + strings.TrimPrefix(local, "+"), nil
+}
+
+// remoteAllowed reports whether a client may use the gateway: loopback
+// always may, other addresses only from GOSIP_MAIL_GATEWAY_ALLOWLIST. The
+// sender addresses checked afterwards are easily forged, so this is what
+// keeps strangers from texting through the gateway.
+func (h *MailGatewayHandler) remoteAllowed(remote net.Addr) bool {
+	ip := net.ParseIP(clientHost(remote.String()))
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	return h.deps.Config != nil && h.deps.Config.MailGatewayAllowlist.Enabled() &&
+		h.deps.Config.MailGatewayAllowlist.Allows(ip)
+}
+
+// Sender accepts envelope senders on the allowlist from allowed networks
+func (h *MailGatewayHandler) Sender(from string, remote net.Addr) error {
+	if !h.remoteAllowed(remote) {
+		slog.Warn("Email gateway client refused", "from", from, "remote", remote.String())
+		return fmt.Errorf("%w: client not allowed", smtpd.ErrRejected)
+	}
+	settings := loadMailGatewaySettings(context.Background(), h.deps)
+	if settings.DIDID == 0 {
+		return fmt.Errorf("%w: gateway disabled", smtpd.ErrRejected)
+	}
+	if !senderAllowed(settings.AllowedSenders, from) {
+		slog.Warn("Email gateway sender refused", "from", from, "remote", remote.String())
+		return fmt.Errorf("%w: sender not allowed", smtpd.ErrRejected)
+	}
+	return nil
+}
+
+// Recipient accepts number@domain recipients
+func (h *MailGatewayHandler) Recipient(to string) error {
+	settings := loadMailGatewaySettings(context.Background(), h.deps)
+	_, err := recipientNumber(to, settings.Domain)
+	return err
+}
+
+// Deliver sends the sanitized text of an email as SMS to each recipient
+func (h *MailGatewayHandler) Deliver(env *smtpd.Envelope) error {
+	ctx := context.Background()
+	settings := loadMailGatewaySettings(ctx, h.deps)
+
+	msg, err := smtpd.ParseMessage(env.Data)
+	if err != nil {
+		return fmt.Errorf("%w: unreadable message", smtpd.ErrRejected)
+	}
+	// The header sender is what the recipient's mail client shows, so it
+	// must be allowed as well as the envelope sender
+	if !senderAllowed(settings.AllowedSenders, msg.From) {
+		return fmt.Errorf("%w: sender not allowed", smtpd.ErrRejected)
+	}
+
+	sms, _ := channels.Lookup(channels.SMS)
+	body := sanitizeEmailText(msg.Text, sms.MaxBodyLength)
+	if body == "" {
+		body = sanitizeEmailText(msg.Subject, sms.MaxBodyLength)
+	}
+	if body == "" {
+		return fmt.Errorf("%w: message is empty", smtpd.ErrRejected)
+	}
+
+	did, err := h.deps.DB.DIDs.GetByID(ctx, settings.DIDID)
+	if err == db.ErrDIDNotFound || (err == nil && !did.SMSEnabled) {
+		return fmt.Errorf("%w: gateway DID unavailable", smtpd.ErrRejected)
+	}
+	if err != nil {
+		return err
+	}
+
+	numbers := make([]string, 0, len(env.To))
+	for _, to := range env.To {
+		number, err := recipientNumber(to, settings.Domain)
+		if err != nil {
+			return err
+		}
+		numbers = append(numbers, number)
+	}
+	if len(numbers) > config.MailGatewaySenderMaxSMS {
+		return fmt.Errorf("%w: too many recipients", smtpd.ErrRejected)
+	}
+	// A temporary refusal makes the sending server retry later, so mail
+	// held back by the limit still goes out once the window passes
+	if !h.reserveSends(env.From, len(numbers)) {
+		slog.Warn("Email gateway sender over limit", "from", env.From)
+		return fmt.Errorf("too many messages from %s", env.From)
+	}
+
+	for _, number := range numbers {
+		if err := h.send(ctx, did, number, body); err != nil {
+			return err
+		}
+		slog.Info("Email gateway message sent", "from", msg.From, "to", number)
+	}
+	return nil
+}
+
+// gatewaySent counts the texts one sender sent in the current window
+type gatewaySent struct {
+	count int
+	since time.Time
+}
+
+// reserveSends counts n texts against a sender, reporting false without
+// counting them when they would go over the sender's limit for the window
+func (h *MailGatewayHandler) reserveSends(from string, n int) bool {
+	h.sentMu.Lock()
+	defer h.sentMu.Unlock()
+
+	from = strings.ToLower(from)
+	now := time.Now()
+	s := h.sent[from]
+	if s == nil || now.Sub(s.since) >= config.MailGatewaySenderWindow {
+		// Drop expired windows so senders that went quiet don't pile up
+		for key, other := range h.sent {
+			if now.Sub(other.since) >= config.MailGatewaySenderWindow {
+				delete(h.sent, key)
+			}
+		}
+		s = &gatewaySent{since: now}
+		h.sent[from] = s
+	}
+	if s.count+n > config.MailGatewaySenderMaxSMS {
+		return false
+	}
+	s.count += n
+	return true
+}
+
+// send records an outbound SMS and hands it to Twilio
+func (h *MailGatewayHandler) send(ctx context.Context, did *models.DID, to, body string) error {
+	didID := did.ID
+	message := &models.Message{
+		DIDID:      &didID,
+		Direction:  "outbound",
+		FromNumber: did.Number,
+		ToNumber:   to,
+		Body:       body,
+		Status:     "queued",
+		CreatedAt:  time.Now(),
+		Channel:    channels.SMS,
+	}
+	if err := h.deps.DB.Messages.Create(ctx, message); err != nil {
+		return err
+	}
+	shortenMessageLinks(ctx, h.deps, message)
+	if h.deps.Twilio == nil {
+		return nil
+	}
+
+	twilioSID, err := h.deps.Twilio.SendSMS(smsSender(ctx, h.deps, did), to, message.Body, nil)
+	if err != nil {
+		recordSendFailure(ctx, h.deps, message.ID, err)
+		return err
+	}
+	message.MessageSID = twilioSID
+	message.Status = "sent"
+	if err := h.deps.DB.Messages.Update(ctx, message); err != nil {
+		return err
+	}
+	estimateMessageCost(ctx, h.deps, message)
+	return nil
+}
+
+// replyHeader matches the line mail clients put above a quoted reply
+var replyHeader = regexp.MustCompile(`^On .+ wrote:$`)
+
+// sanitizeEmailText reduces an email body to what goes out as SMS: quoted
+// replies and signatures are dropped, control characters removed, blank
+// runs collapsed and the result cut to maxLength characters
+func sanitizeEmailText(text string, maxLength int) string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "--" || line == "-----Original Message-----" || replyHeader.MatchString(line) {
+			break
+		}
+		if strings.HasPrefix(line, ">") {
+			continue
+		}
+		line = strings.Join(strings.FieldsFunc(line, func(r rune) bool {
+			return unicode.IsSpace(r) || unicode.IsControl(r)
+		}), " ")
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	result := []rune(strings.TrimSpace(strings.Join(lines, "\n")))
+	if len(result) > maxLength {
+		result = []rune(strings.TrimSpace(string(result[:maxLength])))
+	}
+	return string(result)
+}
+
+// mirrorSMSToEmail forwards an inbound SMS to the mirror mailbox, saying
+// where to reply when the email-to-SMS gateway is set up
+func mirrorSMSToEmail(deps *Dependencies, message *models.Message) {
+	if deps.Notifier == nil {
+		return
+	}
+	settings := loadMailGatewaySettings(context.Background(), deps)
+	if !settings.MirrorEnabled || settings.MirrorEmail == "" {
+		return
+	}
+
+	subject := fmt.Sprintf("SMS from %s", message.FromNumber)
+	body := fmt.Sprintf("From: %s\nTo: %s\nReceived: %s\n\n%s\n",
+		message.FromNumber, message.ToNumber, message.CreatedAt.Format(time.RFC1123), message.Body)
+
+	var mediaURLs []string
+	if len(message.MediaURLs) > 0 {
+		json.Unmarshal(message.MediaURLs, &mediaURLs)
+	}
+	if len(mediaURLs) > 0 {
+		body += "\nAttachments:\n" + strings.Join(mediaURLs, "\n") + "\n"
+	}
+	if settings.DIDID != 0 && settings.Domain != "" && deps.Config != nil && deps.Config.MailGatewayPort > 0 {
+		body += fmt.Sprintf("\nReply by email to %s@%s\n", strings.TrimPrefix(message.FromNumber, "+"), settings.Domain)
+	}
+
+	if err := deps.Notifier.SendEmail(settings.MirrorEmail, subject, body); err != nil {
+		slog.Warn("Failed to mirror SMS to email", "message_id", message.ID, "error", err)
+	}
+}
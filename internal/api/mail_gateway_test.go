@@ -0,0 +1,274 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/smtpd"
+)
+
+func configureMailGateway(t *testing.T, database *db.DB, settings map[string]string) {
+	t.Helper()
+	for key, value := range settings {
+		if err := database.Config.Set(context.Background(), key, value); err != nil {
+			t.Fatalf("Failed to set %s: %v", key, err)
+		}
+	}
+}
+
+func TestMailGatewayHandler_Deliver(t *testing.T) {
+	setup := setupTestAPI(t)
+	did := createTestDID(t, setup.DB, "+15550001111")
+	configureMailGateway(t, setup.DB, map[string]string{
+		db.ConfigKeyMailGatewayDIDID:          "1",
+		db.ConfigKeyMailGatewayDomain:         "sms.example.com",
+		db.ConfigKeyMailGatewayAllowedSenders: "alice@example.com,@corp.example.com",
+	})
+
+	var sentFrom, sentTo, sentBody string
+	setup.Twilio.SendSMSFunc = func(from, to, body string, mediaURLs []string) (string, error) {
+		sentFrom, sentTo, sentBody = from, to, body
+		return "SMgateway", nil
+	}
+	handler := NewMailGatewayHandler(&Dependencies{DB: setup.DB, Twilio: setup.Twilio})
+	remote := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+	if err := handler.Sender("alice@example.com", remote); err != nil {
+		t.Errorf("Expected allowed sender, got %v", err)
+	}
+	if err := handler.Sender("bob@corp.example.com", remote); err != nil {
+		t.Errorf("Expected sender from allowed domain, got %v", err)
+	}
+	if err := handler.Sender("mallory@example.com", remote); !errors.Is(err, smtpd.ErrRejected) {
+		t.Errorf("Expected sender to be rejected, got %v", err)
+	}
+	if err := handler.Recipient("15551234567@other.example.com"); !errors.Is(err, smtpd.ErrRejected) {
+		t.Errorf("Expected other domain to be rejected, got %v", err)
+	}
+	if err := handler.Recipient("alice@sms.example.com"); !errors.Is(err, smtpd.ErrRejected) {
+		t.Errorf("Expected non-number recipient to be rejected, got %v", err)
+	}
+
+	data := "From: Alice <alice@example.com>\r\nSubject: ignored\r\n\r\nRunning late\r\n\r\n-- \r\nAlice\r\n"
+	err := handler.Deliver(&smtpd.Envelope{
+		From: "alice@example.com",
+		To:   []string{"15551234567@sms.example.com"},
+		Data: []byte(data),
+	})
+	if err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+
+	if sentFrom != did.Number || sentTo != "+15551234567" || sentBody != "Running late" {
+		t.Errorf("Unexpected SMS from %q to %q: %q", sentFrom, sentTo, sentBody)
+	}
+	messages, err := setup.DB.Messages.ListByDID(context.Background(), did.ID, 10, 0)
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("Expected 1 stored message, got %d (%v)", len(messages), err)
+	}
+	if messages[0].Direction != "outbound" || messages[0].MessageSID != "SMgateway" {
+		t.Errorf("Unexpected stored message: %+v", messages[0])
+	}
+}
+
+func TestMailGatewayHandler_DeliverRejectsSpoofedHeader(t *testing.T) {
+	setup := setupTestAPI(t)
+	createTestDID(t, setup.DB, "+15550001111")
+	configureMailGateway(t, setup.DB, map[string]string{
+		db.ConfigKeyMailGatewayDIDID:          "1",
+		db.ConfigKeyMailGatewayAllowedSenders: "alice@example.com",
+	})
+	handler := NewMailGatewayHandler(&Dependencies{DB: setup.DB, Twilio: setup.Twilio})
+
+	err := handler.Deliver(&smtpd.Envelope{
+		From: "alice@example.com",
+		To:   []string{"15551234567@sms.example.com"},
+		Data: []byte("From: mallory@example.com\r\n\r\nHi\r\n"),
+	})
+	if !errors.Is(err, smtpd.ErrRejected) {
+		t.Errorf("Expected header sender to be rejected, got %v", err)
+	}
+}
+
+func TestMailGatewayHandler_SenderRemote(t *testing.T) {
+	setup := setupTestAPI(t)
+	createTestDID(t, setup.DB, "+15550001111")
+	configureMailGateway(t, setup.DB, map[string]string{
+		db.ConfigKeyMailGatewayDIDID:          "1",
+		db.ConfigKeyMailGatewayAllowedSenders: "alice@example.com",
+	})
+	_, relay, _ := net.ParseCIDR("192.0.2.0/24")
+	cfg := &config.Config{MailGatewayAllowlist: &config.APIAllowlistConfig{}}
+	handler := NewMailGatewayHandler(&Dependencies{DB: setup.DB, Config: cfg})
+
+	tests := []struct {
+		name     string
+		networks []*net.IPNet
+		ip       net.IP
+		allowed  bool
+	}{
+		{"loopback", nil, net.IPv4(127, 0, 0, 1), true},
+		{"no allowlist", nil, net.IPv4(192, 0, 2, 25), false},
+		{"allowed network", []*net.IPNet{relay}, net.IPv4(192, 0, 2, 25), true},
+		{"other network", []*net.IPNet{relay}, net.IPv4(198, 51, 100, 25), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.MailGatewayAllowlist.Networks = tt.networks
+			err := handler.Sender("alice@example.com", &net.TCPAddr{IP: tt.ip, Port: 40000})
+			if tt.allowed && err != nil {
+				t.Errorf("Expected client to be allowed, got %v", err)
+			}
+			if !tt.allowed && !errors.Is(err, smtpd.ErrRejected) {
+				t.Errorf("Expected client to be rejected, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMailGatewayHandler_DeliverSenderLimit(t *testing.T) {
+	setup := setupTestAPI(t)
+	createTestDID(t, setup.DB, "+15550001111")
+	configureMailGateway(t, setup.DB, map[string]string{
+		db.ConfigKeyMailGatewayDIDID:          "1",
+		db.ConfigKeyMailGatewayAllowedSenders: "alice@example.com,bob@example.com",
+	})
+	sent := 0
+	setup.Twilio.SendSMSFunc = func(from, to, body string, mediaURLs []string) (string, error) {
+		sent++
+		return fmt.Sprintf("SMgateway%d", sent), nil
+	}
+	handler := NewMailGatewayHandler(&Dependencies{DB: setup.DB, Twilio: setup.Twilio})
+	deliver := func(from string) error {
+		return handler.Deliver(&smtpd.Envelope{
+			From: from,
+			To:   []string{"15551234567@sms.example.com"},
+			Data: []byte("From: " + from + "\r\n\r\nHi\r\n"),
+		})
+	}
+
+	for i := 0; i < config.MailGatewaySenderMaxSMS; i++ {
+		if err := deliver("alice@example.com"); err != nil {
+			t.Fatalf("Deliver %d failed: %v", i+1, err)
+		}
+	}
+	err := deliver("Alice@Example.com")
+	if err == nil || errors.Is(err, smtpd.ErrRejected) {
+		t.Errorf("Expected a temporary refusal over the limit, got %v", err)
+	}
+	if err := deliver("bob@example.com"); err != nil {
+		t.Errorf("Expected other senders to be unaffected, got %v", err)
+	}
+	if sent != config.MailGatewaySenderMaxSMS+1 {
+		t.Errorf("Expected %d texts sent, got %d", config.MailGatewaySenderMaxSMS+1, sent)
+	}
+
+	to := make([]string, config.MailGatewaySenderMaxSMS+1)
+	for i := range to {
+		to[i] = fmt.Sprintf("155512345%02d@sms.example.com", i)
+	}
+	err = handler.Deliver(&smtpd.Envelope{
+		From: "bob@example.com",
+		To:   to,
+		Data: []byte("From: bob@example.com\r\n\r\nHi\r\n"),
+	})
+	if !errors.Is(err, smtpd.ErrRejected) {
+		t.Errorf("Expected too many recipients to be rejected, got %v", err)
+	}
+}
+
+func TestMailGatewayHandler_Update(t *testing.T) {
+	setup := setupTestAPI(t)
+	createTestDID(t, setup.DB, "+15550001111")
+	handler := NewMailGatewayHandler(&Dependencies{DB: setup.DB, Config: &config.Config{MailGatewayPort: 2525}})
+
+	update := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.Update(rr, httptest.NewRequest(http.MethodPut, "/api/system/mail-gateway", bytes.NewBufferString(body)))
+		return rr
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"unknown DID", `{"did_id": 99}`, http.StatusBadRequest},
+		{"bad sender", `{"allowed_senders": ["not an address"]}`, http.StatusBadRequest},
+		{"mirror without email", `{"mirror_enabled": true}`, http.StatusBadRequest},
+		{"bad domain", `{"domain": "sms@example.com"}`, http.StatusBadRequest},
+		{"valid", `{"did_id": 1, "domain": "SMS.example.com", "allowed_senders": ["Alice@example.com", "@corp.example.com"], "mirror_enabled": true, "mirror_email": "inbox@example.com"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertStatus(t, update(tt.body), tt.want)
+		})
+	}
+
+	settings := loadMailGatewaySettings(context.Background(), handler.deps)
+	if settings.DIDID != 1 || settings.Domain != "sms.example.com" || !settings.MirrorEnabled || settings.ListenerPort != 2525 {
+		t.Errorf("Unexpected settings: %+v", settings)
+	}
+	if len(settings.AllowedSenders) != 2 || settings.AllowedSenders[0] != "alice@example.com" {
+		t.Errorf("Expected lowercased allowlist, got %v", settings.AllowedSenders)
+	}
+}
+
+func TestMirrorSMSToEmail(t *testing.T) {
+	setup := setupTestAPI(t)
+	configureMailGateway(t, setup.DB, map[string]string{
+		db.ConfigKeyMailGatewayDIDID:         "1",
+		db.ConfigKeyMailGatewayDomain:        "sms.example.com",
+		db.ConfigKeyMailGatewayMirrorEnabled: "true",
+		db.ConfigKeyMailGatewayMirrorEmail:   "inbox@example.com",
+	})
+
+	var to, body string
+	setup.Notifier.SendEmailFunc = func(recipient, subject, b string) error {
+		to, body = recipient, b
+		return nil
+	}
+	deps := &Dependencies{DB: setup.DB, Notifier: setup.Notifier, Config: &config.Config{MailGatewayPort: 2525}}
+
+	mirrorSMSToEmail(deps, &models.Message{FromNumber: "+15551234567", ToNumber: "+15550001111", Body: "Hello"})
+
+	if to != "inbox@example.com" {
+		t.Errorf("Expected mirror to inbox@example.com, got %q", to)
+	}
+	if !strings.Contains(body, "Hello") || !strings.Contains(body, "15551234567@sms.example.com") {
+		t.Errorf("Expected body with message and reply address, got %q", body)
+	}
+}
+
+func TestSanitizeEmailText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		max  int
+		want string
+	}{
+		{"plain", "Running late", 160, "Running late"},
+		{"signature dropped", "See you soon\n-- \nAlice\nACME Corp", 160, "See you soon"},
+		{"quoted reply dropped", "Sounds good\n\nOn Mon, Jan 1, 2024 at 9:00 AM Bob <bob@example.com> wrote:\n> Lunch?", 160, "Sounds good"},
+		{"quote lines skipped", "> earlier\nYes", 160, "Yes"},
+		{"control characters and blank runs", "Line\tone\x07\r\n\r\n\r\n\r\nLine  two", 160, "Line one\n\nLine two"},
+		{"truncated", "abcdefghij", 5, "abcde"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeEmailText(tt.text, tt.max); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
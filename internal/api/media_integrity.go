@@ -0,0 +1,28 @@
+package api
+
+import "net/http"
+
+// MediaIntegrityHandler reports recording and voicemail files that are
+// missing or no longer match their checksums
+type MediaIntegrityHandler struct {
+	deps *Dependencies
+}
+
+// NewMediaIntegrityHandler creates a new MediaIntegrityHandler
+func NewMediaIntegrityHandler(deps *Dependencies) *MediaIntegrityHandler {
+	return &MediaIntegrityHandler{deps: deps}
+}
+
+// Get returns the damaged media files found (admin only). The last
+// scheduled check is returned unless refresh=true.
+func (h *MediaIntegrityHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if h.deps.Integrity == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Media integrity checks are not available", nil)
+		return
+	}
+	report := h.deps.Integrity.Report()
+	if report == nil || r.URL.Query().Get("refresh") == "true" {
+		report = h.deps.Integrity.Check(r.Context())
+	}
+	WriteJSON(w, http.StatusOK, report)
+}
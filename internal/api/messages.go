@@ -1,14 +1,22 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/btafoya/gosip/internal/channels"
 	"github.com/btafoya/gosip/internal/config"
 	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/export"
 	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/twilio"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -33,6 +41,13 @@ type MessageResponse struct {
 	Status       string   `json:"status"`
 	TwilioSID    string   `json:"twilio_sid,omitempty"`
 	CreatedAt    string   `json:"created_at"`
+	Channel      string   `json:"channel"`
+	// Costs of outbound messages, by the rate table and as billed by Twilio
+	EstimatedCost *float64 `json:"estimated_cost,omitempty"`
+	ActualCost    *float64 `json:"actual_cost,omitempty"`
+	// Error explains why a message failed to send or be delivered
+	Error    *twilio.ErrorInfo `json:"error,omitempty"`
+	TenantID *int64            `json:"tenant_id,omitempty"`
 }
 
 // List returns messages with filtering and pagination
@@ -42,6 +57,14 @@ func (h *MessageHandler) List(w http.ResponseWriter, r *http.Request) {
 	didIDStr := r.URL.Query().Get("did_id")
 	direction := r.URL.Query().Get("direction")
 	remoteNumber := r.URL.Query().Get("remote_number")
+	channel := r.URL.Query().Get("channel")
+
+	if channel != "" {
+		if _, ok := channels.Lookup(channel); !ok {
+			WriteValidationError(w, "Validation failed", []FieldError{channelFieldError})
+			return
+		}
+	}
 
 	if limit == 0 {
 		limit = config.DefaultPageSize
@@ -54,8 +77,22 @@ func (h *MessageHandler) List(w http.ResponseWriter, r *http.Request) {
 	var total int
 	var err error
 
-	// Apply filters in order of specificity
-	switch {
+	// Apply filters in order of specificity; a tenant's list takes them all
+	switch tenantID := tenantOf(r); {
+	case tenantID != nil:
+		filter := db.MessageFilter{Direction: direction, RemoteNumber: remoteNumber, Channel: channel}
+		if didIDStr != "" {
+			didID, parseErr := strconv.ParseInt(didIDStr, 10, 64)
+			if parseErr != nil {
+				WriteValidationError(w, "Invalid DID ID", nil)
+				return
+			}
+			filter.DIDID = &didID
+		}
+		messages, err = h.deps.DB.Messages.ListByTenant(r.Context(), *tenantID, filter, limit, offset)
+		if err == nil {
+			total, _ = h.deps.DB.Messages.CountByTenant(r.Context(), *tenantID, filter)
+		}
 	case didIDStr != "":
 		didID, parseErr := strconv.ParseInt(didIDStr, 10, 64)
 		if parseErr == nil {
@@ -79,6 +116,11 @@ func (h *MessageHandler) List(w http.ResponseWriter, r *http.Request) {
 		if err == nil {
 			total, _ = h.deps.DB.Messages.CountByRemoteNumber(r.Context(), remoteNumber)
 		}
+	case channel != "":
+		messages, err = h.deps.DB.Messages.ListByChannel(r.Context(), channel, limit, offset)
+		if err == nil {
+			total, _ = h.deps.DB.Messages.CountByChannel(r.Context(), channel)
+		}
 	default:
 		messages, err = h.deps.DB.Messages.List(r.Context(), limit, offset)
 		if err == nil {
@@ -105,6 +147,62 @@ type SendMessageRequest struct {
 	ToNumber     string   `json:"to_number"`
 	Body         string   `json:"body"`
 	MediaURLs    []string `json:"media_urls,omitempty"`
+	// Channel is "sms", "mms" or "whatsapp"; defaults to "mms" with media and "sms" without
+	Channel string `json:"channel,omitempty"`
+}
+
+// channelFieldError is returned for unknown message channels
+var channelFieldError = FieldError{Field: "channel", Message: "Channel must be sms, mms, whatsapp, sip-message or internal"}
+
+// Channels returns the messaging channels and their limits
+func (h *MessageHandler) Channels(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"data": channels.All()})
+}
+
+// checkChannel validates an outbound message against its channel's limits.
+// Attachments whose size can't be looked up are left for Twilio to reject.
+func (h *MessageHandler) checkChannel(ctx context.Context, channel, body string, mediaURLs []string) []FieldError {
+	caps, ok := channels.Lookup(channel)
+	if !ok {
+		return []FieldError{channelFieldError}
+	}
+	if !caps.Sendable {
+		return []FieldError{{Field: "channel", Message: fmt.Sprintf("The %s channel can't be used to send messages", channel)}}
+	}
+
+	var errors []FieldError
+	for _, msg := range caps.Check(body, len(mediaURLs)) {
+		errors = append(errors, FieldError{Field: "body", Message: msg})
+	}
+	if len(errors) > 0 || len(mediaURLs) == 0 {
+		return errors
+	}
+
+	for _, u := range mediaURLs {
+		if !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+			return []FieldError{{Field: "media_urls", Message: "Media URLs must be http or https"}}
+		}
+	}
+
+	client := &http.Client{Timeout: config.MediaProbeTimeout}
+	var total int64
+	for _, u := range mediaURLs {
+		size, err := channels.MediaSize(ctx, client, u)
+		if err != nil {
+			slog.Debug("Media size lookup failed", "error", err, "url", u)
+			continue
+		}
+		if size > 0 {
+			total += size
+		}
+	}
+	if total > caps.MaxMediaBytes {
+		errors = append(errors, FieldError{
+			Field:   "media_urls",
+			Message: fmt.Sprintf("Media must be at most %d MB in total", caps.MaxMediaBytes>>20),
+		})
+	}
+	return errors
 }
 
 // Send sends a new SMS/MMS message
@@ -127,6 +225,13 @@ func (h *MessageHandler) Send(w http.ResponseWriter, r *http.Request) {
 		errors = append(errors, FieldError{Field: "body", Message: "Message body or media is required"})
 	}
 
+	if req.Channel == "" {
+		req.Channel = channels.Default(len(req.MediaURLs) > 0)
+	}
+	if len(errors) == 0 {
+		errors = h.checkChannel(r.Context(), req.Channel, req.Body, req.MediaURLs)
+	}
+
 	if len(errors) > 0 {
 		WriteValidationError(w, "Validation failed", errors)
 		return
@@ -142,6 +247,10 @@ func (h *MessageHandler) Send(w http.ResponseWriter, r *http.Request) {
 		WriteInternalError(w)
 		return
 	}
+	if !visibleTo(r, did.TenantID) {
+		WriteNotFoundError(w, "DID")
+		return
+	}
 
 	if !did.SMSEnabled {
 		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "DID is not SMS-enabled", nil)
@@ -165,23 +274,29 @@ func (h *MessageHandler) Send(w http.ResponseWriter, r *http.Request) {
 		MediaURLs:  mediaURLsJSON,
 		Status:     "queued",
 		CreatedAt:  time.Now(),
+		Channel:    req.Channel,
 	}
 
 	if err := h.deps.DB.Messages.Create(r.Context(), message); err != nil {
 		WriteInternalError(w)
 		return
 	}
+	shortenMessageLinks(r.Context(), h.deps, message)
 
 	// Send via Twilio (async - queue for sending)
+	sender := channels.Address(req.Channel, smsSender(r.Context(), h.deps, did))
+	// The send outlives the request, so it mustn't use its context
+	ctx := context.WithoutCancel(r.Context())
 	go func() {
 		if h.deps.Twilio != nil {
-			twilioSID, sendErr := h.deps.Twilio.SendSMS(did.Number, req.ToNumber, req.Body, req.MediaURLs)
+			twilioSID, sendErr := h.deps.Twilio.SendSMS(sender, channels.Address(req.Channel, req.ToNumber), message.Body, req.MediaURLs)
 			if sendErr != nil {
-				h.deps.DB.Messages.UpdateStatus(r.Context(), message.ID, "failed")
+				recordSendFailure(ctx, h.deps, message.ID, sendErr)
 			} else {
 				message.MessageSID = twilioSID
 				message.Status = "sent"
-				h.deps.DB.Messages.Update(r.Context(), message)
+				h.deps.DB.Messages.Update(ctx, message)
+				estimateMessageCost(ctx, h.deps, message)
 			}
 		}
 	}()
@@ -189,6 +304,19 @@ func (h *MessageHandler) Send(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, http.StatusAccepted, toMessageResponse(message))
 }
 
+// smsSender returns what outbound SMS from a DID is sent from: the DID's
+// Messaging Service, else the global one, else the DID's own number. With
+// a Messaging Service, Twilio picks the number from the service's pool.
+func smsSender(ctx context.Context, deps *Dependencies, did *models.DID) string {
+	if did.MessagingServiceSID != "" {
+		return did.MessagingServiceSID
+	}
+	if sid := deps.DB.Config.GetWithDefault(ctx, "twilio_messaging_service_sid", ""); sid != "" {
+		return sid
+	}
+	return did.Number
+}
+
 // Get returns a specific message
 func (h *MessageHandler) Get(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
@@ -206,6 +334,10 @@ func (h *MessageHandler) Get(w http.ResponseWriter, r *http.Request) {
 		WriteInternalError(w)
 		return
 	}
+	if !visibleTo(r, message.TenantID) {
+		WriteNotFoundError(w, "Message")
+		return
+	}
 
 	WriteJSON(w, http.StatusOK, toMessageResponse(message))
 }
@@ -217,6 +349,12 @@ func (h *MessageHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		WriteValidationError(w, "Invalid message ID", nil)
 		return
 	}
+	if tenantOf(r) != nil {
+		if msg, err := h.deps.DB.Messages.GetByID(r.Context(), id); err != nil || !visibleTo(r, msg.TenantID) {
+			WriteNotFoundError(w, "Message")
+			return
+		}
+	}
 
 	if err := h.deps.DB.Messages.Delete(r.Context(), id); err != nil {
 		WriteInternalError(w)
@@ -270,6 +408,89 @@ func (h *MessageHandler) GetConversation(w http.ResponseWriter, r *http.Request)
 	WriteJSON(w, http.StatusOK, map[string]interface{}{"data": response})
 }
 
+// ExportConversation downloads a conversation as a PDF transcript or an
+// mbox archive, with MMS media inline, for record keeping
+func (h *MessageHandler) ExportConversation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	remoteNumber := chi.URLParam(r, "number")
+	if remoteNumber == "" {
+		WriteValidationError(w, "Remote number is required", nil)
+		return
+	}
+
+	didID, err := strconv.ParseInt(r.URL.Query().Get("did_id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "did_id query parameter is required", nil)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "pdf"
+	}
+	if format != "pdf" && format != "mbox" {
+		WriteValidationError(w, "Invalid export format", []FieldError{
+			{Field: "format", Message: "Must be pdf or mbox"},
+		})
+		return
+	}
+
+	did, err := h.deps.DB.DIDs.GetByID(ctx, didID)
+	if err != nil {
+		WriteNotFoundError(w, "DID")
+		return
+	}
+
+	messages, err := h.deps.DB.Messages.ListConversation(ctx, didID, remoteNumber)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if len(messages) == 0 {
+		WriteNotFoundError(w, "Conversation")
+		return
+	}
+
+	conv := &export.Conversation{
+		DIDNumber:    did.Number,
+		RemoteNumber: remoteNumber,
+		ExportedAt:   time.Now(),
+		Messages:     messages,
+		Media:        make(map[int64][]export.Media),
+	}
+	if loc, err := time.LoadLocation(h.deps.DB.Config.GetWithDefault(ctx, "timezone", "America/New_York")); err == nil {
+		conv.Location = loc
+	}
+
+	fetcher := export.NewFetcher(twilioCredentials(ctx, h.deps))
+	for _, m := range messages {
+		for _, mediaURL := range export.MediaURLs(m) {
+			conv.Media[m.ID] = append(conv.Media[m.ID], fetcher.Fetch(ctx, mediaURL))
+		}
+	}
+
+	var buf bytes.Buffer
+	contentType := "application/pdf"
+	if format == "mbox" {
+		contentType = "application/mbox"
+		err = export.WriteMbox(&buf, conv)
+	} else {
+		err = export.WritePDF(&buf, conv)
+	}
+	if err != nil {
+		slog.Error("Failed to export conversation", "error", err, "did_id", didID, "number", remoteNumber)
+		WriteInternalError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", conv.Filename(format)))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
 // GetConversations returns a list of conversation summaries
 func (h *MessageHandler) GetConversations(w http.ResponseWriter, r *http.Request) {
 	var didID *int64
@@ -301,11 +522,21 @@ func (h *MessageHandler) MarkAsRead(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	msg, err := h.deps.DB.Messages.GetByID(r.Context(), id)
+	if err != nil || !visibleTo(r, msg.TenantID) {
+		WriteNotFoundError(w, "Message")
+		return
+	}
+
 	if err := h.deps.DB.Messages.MarkAsRead(r.Context(), id); err != nil {
 		WriteInternalError(w)
 		return
 	}
 
+	if !msg.IsRead {
+		go h.notifyDevicesRead([]*models.Message{msg})
+	}
+
 	WriteJSON(w, http.StatusOK, map[string]string{"message": "Message marked as read"})
 }
 
@@ -359,9 +590,12 @@ func (h *MessageHandler) CreateAutoReply(w http.ResponseWriter, r *http.Request)
 	if req.TriggerType == "" {
 		errors = append(errors, FieldError{Field: "trigger_type", Message: "Trigger type is required"})
 	}
-	if req.TriggerType != "keyword" && req.TriggerType != "after_hours" && req.TriggerType != "always" {
+	if req.TriggerType != "keyword" && req.TriggerType != "after_hours" && req.TriggerType != "always" && req.TriggerType != "calendar_busy" {
 		errors = append(errors, FieldError{Field: "trigger_type", Message: "Invalid trigger type"})
 	}
+	if req.TriggerType == "calendar_busy" && !validCalendarUser(r.Context(), h.deps, req.TriggerData) {
+		errors = append(errors, userIDFieldError("trigger_data"))
+	}
 	if req.ReplyText == "" {
 		errors = append(errors, FieldError{Field: "reply_text", Message: "Reply text is required"})
 	}
@@ -417,6 +651,10 @@ func (h *MessageHandler) UpdateAutoReply(w http.ResponseWriter, r *http.Request)
 	if req.TriggerData != "" {
 		rule.TriggerData = json.RawMessage(req.TriggerData)
 	}
+	if rule.TriggerType == "calendar_busy" && !validCalendarUser(r.Context(), h.deps, string(rule.TriggerData)) {
+		WriteValidationError(w, "Validation failed", []FieldError{userIDFieldError("trigger_data")})
+		return
+	}
 	if req.ReplyText != "" {
 		rule.ReplyText = req.ReplyText
 	}
@@ -431,6 +669,16 @@ func (h *MessageHandler) UpdateAutoReply(w http.ResponseWriter, r *http.Request)
 	WriteJSON(w, http.StatusOK, toAutoReplyResponse(rule))
 }
 
+// validCalendarUser reports whether a calendar_busy trigger names an existing user by ID
+func validCalendarUser(ctx context.Context, deps *Dependencies, triggerData string) bool {
+	userID, err := strconv.ParseInt(strings.TrimSpace(triggerData), 10, 64)
+	if err != nil || userID <= 0 {
+		return false
+	}
+	_, err = deps.DB.Users.GetByID(ctx, userID)
+	return err == nil
+}
+
 // DeleteAutoReply removes an auto-reply rule
 func (h *MessageHandler) DeleteAutoReply(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
@@ -473,8 +721,38 @@ func toMessageResponse(m *models.Message) *MessageResponse {
 		MediaURLs:    mediaURLs,
 		Status:       m.Status,
 		TwilioSID:    m.MessageSID,
+		Channel:      m.Channel,
 		CreatedAt:    m.CreatedAt.Format("2006-01-02T15:04:05Z"),
+
+		EstimatedCost: m.EstimatedCost,
+		ActualCost:    m.ActualCost,
+		Error:         messageError(m),
+		TenantID:      m.TenantID,
+	}
+}
+
+// messageError explains why a message failed, or returns nil when it didn't
+func messageError(m *models.Message) *twilio.ErrorInfo {
+	if m.ErrorCode == nil {
+		if m.ErrorMessage == "" {
+			return nil
+		}
+		return &twilio.ErrorInfo{Title: "Message not sent", Message: m.ErrorMessage}
+	}
+	info, _ := twilio.LookupError(*m.ErrorCode)
+	info.Message = m.ErrorMessage
+	return &info
+}
+
+// recordSendFailure marks a message as failed with the error that failed
+// it: the Twilio error code when Twilio returned one
+func recordSendFailure(ctx context.Context, deps *Dependencies, messageID int64, err error) {
+	var code *int
+	message := err.Error()
+	if info := twilio.ExplainError(err); info != nil {
+		code, message = &info.Code, info.Message
 	}
+	deps.DB.Messages.UpdateStatusWithError(ctx, messageID, "failed", code, message)
 }
 
 func toAutoReplyResponse(rule *models.AutoReply) *AutoReplyResponse {
@@ -533,18 +811,29 @@ func (h *MessageHandler) Resend(w http.ResponseWriter, r *http.Request) {
 		json.Unmarshal(message.MediaURLs, &mediaURLs)
 	}
 
+	// Resend through the DID's current sender
+	sender := message.FromNumber
+	if message.DIDID != nil {
+		if did, err := h.deps.DB.DIDs.GetByID(r.Context(), *message.DIDID); err == nil {
+			sender = smsSender(r.Context(), h.deps, did)
+		}
+	}
+
 	// Resend the message
-	twilioSID, sendErr := h.deps.Twilio.SendSMS(message.FromNumber, message.ToNumber, message.Body, mediaURLs)
+	twilioSID, sendErr := h.deps.Twilio.SendSMS(channels.Address(message.Channel, sender),
+		channels.Address(message.Channel, message.ToNumber), message.Body, mediaURLs)
 	if sendErr != nil {
-		h.deps.DB.Messages.UpdateStatus(r.Context(), message.ID, "failed")
-		WriteError(w, http.StatusBadGateway, ErrCodeBadGateway, "Failed to resend message: "+sendErr.Error(), nil)
+		recordSendFailure(r.Context(), h.deps, message.ID, sendErr)
+		WriteTwilioError(w, "Failed to resend message", sendErr)
 		return
 	}
 
 	// Update the message record
 	message.MessageSID = twilioSID
 	message.Status = "sent"
+	message.ErrorCode, message.ErrorMessage = nil, ""
 	h.deps.DB.Messages.Update(r.Context(), message)
+	estimateMessageCost(r.Context(), h.deps, message)
 
 	WriteJSON(w, http.StatusOK, toMessageResponse(message))
 }
@@ -581,12 +870,13 @@ func (h *MessageHandler) SyncFromTwilio(w http.ResponseWriter, r *http.Request)
 	// Fetch status from Twilio
 	twilioMsg, err := h.deps.Twilio.GetMessage(r.Context(), message.MessageSID)
 	if err != nil {
-		WriteError(w, http.StatusBadGateway, ErrCodeBadGateway, "Failed to fetch from Twilio: "+err.Error(), nil)
+		WriteTwilioError(w, "Failed to fetch from Twilio", err)
 		return
 	}
 
 	// Update local status
 	message.Status = twilioMsg.Status
+	message.ErrorCode, message.ErrorMessage = twilioMsg.ErrorCode, twilioMsg.ErrorMessage
 	h.deps.DB.Messages.Update(r.Context(), message)
 
 	WriteJSON(w, http.StatusOK, toMessageResponse(message))
@@ -629,7 +919,7 @@ func (h *MessageHandler) Cancel(w http.ResponseWriter, r *http.Request) {
 
 	// Try to cancel in Twilio
 	if err := h.deps.Twilio.CancelMessage(r.Context(), message.MessageSID); err != nil {
-		WriteError(w, http.StatusBadGateway, ErrCodeBadGateway, "Failed to cancel in Twilio: "+err.Error(), nil)
+		WriteTwilioError(w, "Failed to cancel in Twilio", err)
 		return
 	}
 
@@ -668,15 +958,36 @@ func (h *MessageHandler) MarkConversationAsRead(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	unread, err := h.deps.DB.Messages.ListUnreadInConversation(r.Context(), didID, remoteNumber)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
 	// Mark all messages in the conversation as read
 	if err := h.deps.DB.Messages.MarkConversationAsRead(r.Context(), didID, remoteNumber); err != nil {
 		WriteInternalError(w)
 		return
 	}
 
+	if len(unread) > 0 {
+		go h.notifyDevicesRead(unread)
+	}
+
 	WriteJSON(w, http.StatusOK, map[string]string{"message": "Conversation marked as read"})
 }
 
+// notifyDevicesRead sends read receipts for messages read in the inbox to
+// the SIP MESSAGE clients of their DIDs
+func (h *MessageHandler) notifyDevicesRead(msgs []*models.Message) {
+	if h.deps.SIP == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), config.SIPMessageTimeout)
+	defer cancel()
+	h.deps.SIP.NotifyMessagesRead(ctx, msgs, 0)
+}
+
 // GetStats returns message statistics
 func (h *MessageHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/btafoya/gosip/internal/models"
@@ -158,6 +159,121 @@ func TestMessageHandler_Send(t *testing.T) {
 	}
 }
 
+func TestMessageHandler_Send_WhatsApp(t *testing.T) {
+	setup := setupTestAPI(t)
+	sent := make(chan [2]string, 1)
+	setup.Twilio.SendSMSFunc = func(from, to, body string, mediaURLs []string) (string, error) {
+		sent <- [2]string{from, to}
+		return "SM123", nil
+	}
+	deps := &Dependencies{DB: setup.DB, Twilio: setup.Twilio}
+	handler := NewMessageHandler(deps)
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+
+	body, _ := json.Marshal(SendMessageRequest{
+		DIDID:    did.ID,
+		ToNumber: "+15559876543",
+		Body:     "Hello",
+		Channel:  "whatsapp",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/messages", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler.Send(rr, req)
+
+	assertStatus(t, rr, http.StatusAccepted)
+
+	var resp MessageResponse
+	decodeResponse(t, rr, &resp)
+	if resp.Channel != "whatsapp" {
+		t.Errorf("Expected channel whatsapp, got %s", resp.Channel)
+	}
+
+	addrs := <-sent
+	if addrs[0] != "whatsapp:+15551234567" || addrs[1] != "whatsapp:+15559876543" {
+		t.Errorf("Expected WhatsApp addresses, got %v", addrs)
+	}
+}
+
+func TestMessageHandler_Send_ChannelLimits(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB, Twilio: setup.Twilio}
+	handler := NewMessageHandler(deps)
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+
+	media := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "6000000")
+	}))
+	defer media.Close()
+
+	tests := []struct {
+		name  string
+		req   SendMessageRequest
+		field string
+	}{
+		{"sms with media", SendMessageRequest{Channel: "sms", Body: "Hi", MediaURLs: []string{media.URL}}, "body"},
+		{"unknown channel", SendMessageRequest{Channel: "fax", Body: "Hi"}, "channel"},
+		{"receive-only channel", SendMessageRequest{Channel: "internal", Body: "Hi"}, "channel"},
+		{"media too large", SendMessageRequest{Body: "Hi", MediaURLs: []string{media.URL + "/big.jpg"}}, "media_urls"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.DIDID = did.ID
+			tt.req.ToNumber = "+15559876543"
+			body, _ := json.Marshal(tt.req)
+			req := httptest.NewRequest(http.MethodPost, "/api/messages", bytes.NewBuffer(body))
+			rr := httptest.NewRecorder()
+			handler.Send(rr, req)
+
+			assertStatus(t, rr, http.StatusBadRequest)
+
+			var resp ErrorResponse
+			decodeResponse(t, rr, &resp)
+			if len(resp.Error.Details) != 1 || resp.Error.Details[0].Field != tt.field {
+				t.Errorf("Expected one %s error, got %+v", tt.field, resp.Error.Details)
+			}
+		})
+	}
+}
+
+func TestMessageHandler_List_FilterByChannel(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB}
+	handler := NewMessageHandler(deps)
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	createTestMessage(t, setup.DB, did.ID, "inbound", "+15559876543", "Plain text")
+	setup.DB.Messages.Create(context.Background(), &models.Message{
+		DIDID:      &did.ID,
+		Direction:  "inbound",
+		FromNumber: "+15559876543",
+		ToNumber:   did.Number,
+		Body:       "Hola",
+		Channel:    "whatsapp",
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/messages?channel=whatsapp", nil)
+	rr := httptest.NewRecorder()
+	handler.List(rr, req)
+
+	assertStatus(t, rr, http.StatusOK)
+
+	var resp struct {
+		Data []MessageResponse `json:"data"`
+	}
+	decodeResponse(t, rr, &resp)
+	if len(resp.Data) != 1 || resp.Data[0].Body != "Hola" {
+		t.Errorf("Expected only the WhatsApp message, got %+v", resp.Data)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/messages?channel=fax", nil)
+	rr = httptest.NewRecorder()
+	handler.List(rr, req)
+
+	assertStatus(t, rr, http.StatusBadRequest)
+}
+
 func TestMessageHandler_Send_ValidationError(t *testing.T) {
 	setup := setupTestAPI(t)
 	deps := &Dependencies{DB: setup.DB}
@@ -361,6 +477,52 @@ func TestMessageHandler_GetConversation_MissingNumber(t *testing.T) {
 	assertStatus(t, rr, http.StatusBadRequest)
 }
 
+func TestMessageHandler_ExportConversation(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB}
+	handler := NewMessageHandler(deps)
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	createTestMessage(t, setup.DB, did.ID, "inbound", "+15559876543", "Hello")
+	createTestMessage(t, setup.DB, did.ID, "outbound", "+15559876543", "Hi there")
+
+	export := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/messages/conversation/+15559876543/export?"+query, nil)
+		req = withURLParams(req, map[string]string{"number": "+15559876543"})
+		rr := httptest.NewRecorder()
+		handler.ExportConversation(rr, req)
+		return rr
+	}
+
+	rr := export("did_id=1")
+	assertStatus(t, rr, http.StatusOK)
+	if ct := rr.Header().Get("Content-Type"); ct != "application/pdf" {
+		t.Errorf("Expected application/pdf, got %s", ct)
+	}
+	if !strings.HasPrefix(rr.Body.String(), "%PDF-") {
+		t.Error("Expected a PDF body")
+	}
+	if cd := rr.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, `attachment; filename="conversation-15559876543-`) {
+		t.Errorf("Unexpected Content-Disposition %q", cd)
+	}
+
+	rr = export("did_id=1&format=mbox")
+	assertStatus(t, rr, http.StatusOK)
+	if n := strings.Count(rr.Body.String(), "Message-ID: "); n != 2 {
+		t.Errorf("Expected 2 messages in mbox, got %d", n)
+	}
+
+	assertStatus(t, export("did_id=1&format=docx"), http.StatusBadRequest)
+	assertStatus(t, export("format=pdf"), http.StatusBadRequest)
+	assertStatus(t, export("did_id=99"), http.StatusNotFound)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/messages/conversation/+15550000000/export?did_id=1", nil)
+	req = withURLParams(req, map[string]string{"number": "+15550000000"})
+	rr = httptest.NewRecorder()
+	handler.ExportConversation(rr, req)
+	assertStatus(t, rr, http.StatusNotFound)
+}
+
 func TestMessageHandler_ListAutoReplies(t *testing.T) {
 	setup := setupTestAPI(t)
 	deps := &Dependencies{DB: setup.DB}
@@ -754,6 +916,64 @@ func TestMessageHandler_Resend(t *testing.T) {
 	}
 }
 
+func TestMessageHandler_Resend_MessagingService(t *testing.T) {
+	setup := setupTestAPI(t)
+	var sentFrom string
+	setup.Twilio.SendSMSFunc = func(from, to, body string, mediaURLs []string) (string, error) {
+		sentFrom = from
+		return "SM987654321", nil
+	}
+	deps := &Dependencies{DB: setup.DB, Twilio: setup.Twilio}
+	handler := NewMessageHandler(deps)
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	did.MessagingServiceSID = "MG0123456789abcdef0123456789abcdef"
+	setup.DB.DIDs.Update(context.Background(), did)
+
+	msg := &models.Message{
+		MessageSID: "SM123456789",
+		DIDID:      &did.ID,
+		Direction:  "outbound",
+		FromNumber: "+15551234567",
+		ToNumber:   "+15559876543",
+		Body:       "Failed message",
+		Status:     "failed",
+	}
+	setup.DB.Messages.Create(context.Background(), msg)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/messages/1/resend", nil)
+	req = withURLParams(req, map[string]string{"id": "1"})
+	rr := httptest.NewRecorder()
+	handler.Resend(rr, req)
+
+	assertStatus(t, rr, http.StatusOK)
+	if sentFrom != did.MessagingServiceSID {
+		t.Errorf("Expected message sent through %s, got %s", did.MessagingServiceSID, sentFrom)
+	}
+}
+
+func TestSMSSender(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB}
+	ctx := context.Background()
+	did := &models.DID{Number: "+15551234567"}
+
+	if got := smsSender(ctx, deps, did); got != did.Number {
+		t.Errorf("Expected the DID number without a Messaging Service, got %s", got)
+	}
+
+	global := "MGffffffffffffffffffffffffffffffff"
+	setup.DB.Config.Set(ctx, "twilio_messaging_service_sid", global)
+	if got := smsSender(ctx, deps, did); got != global {
+		t.Errorf("Expected the global Messaging Service, got %s", got)
+	}
+
+	did.MessagingServiceSID = "MG0123456789abcdef0123456789abcdef"
+	if got := smsSender(ctx, deps, did); got != did.MessagingServiceSID {
+		t.Errorf("Expected the DID's Messaging Service, got %s", got)
+	}
+}
+
 func TestMessageHandler_Resend_NotOutbound(t *testing.T) {
 	setup := setupTestAPI(t)
 	deps := &Dependencies{DB: setup.DB, Twilio: setup.Twilio}
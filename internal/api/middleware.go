@@ -1,16 +1,21 @@
 package api
 
 import (
+	"bufio"
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/btafoya/gosip/internal/config"
 	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/i18n"
 	"github.com/btafoya/gosip/internal/models"
 )
 
@@ -18,7 +23,8 @@ import (
 type contextKey string
 
 const (
-	contextKeyUser contextKey = "user"
+	contextKeyUser     contextKey = "user"
+	contextKeyPeerAddr contextKey = "peer_addr"
 )
 
 // AuthMiddleware validates session tokens
@@ -53,6 +59,17 @@ func AuthMiddleware(deps *Dependencies) func(http.Handler) http.Handler {
 				return
 			}
 
+			// Fall back to the user's language, then their tenant's, when the
+			// client did not request one
+			if lw, ok := w.(*localeWriter); ok && !lw.requested {
+				switch {
+				case user.Language != "":
+					lw.lang = user.Language
+				case user.TenantID != nil:
+					lw.lang = i18n.Resolve(deps.DB.Config.GetForTenant(r.Context(), user.TenantID, "default_language", i18n.DefaultLanguage))
+				}
+			}
+
 			// Add user to context
 			ctx := context.WithValue(r.Context(), contextKeyUser, user)
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -60,6 +77,60 @@ func AuthMiddleware(deps *Dependencies) func(http.Handler) http.Handler {
 	}
 }
 
+// localeWriter carries the language used to translate API error messages
+type localeWriter struct {
+	http.ResponseWriter
+	lang      string
+	requested bool // set from Accept-Language rather than a default
+}
+
+// Flush lets streaming handlers flush through the wrapper
+func (lw *localeWriter) Flush() {
+	if f, ok := lw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSocket handlers take over the connection through the wrapper
+func (lw *localeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := lw.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("http.Hijacker is unavailable on the writer")
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (lw *localeWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
+// LocaleMiddleware selects the API message language from the Accept-Language header,
+// falling back to the default_language setting
+func LocaleMiddleware(database *db.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lw := &localeWriter{ResponseWriter: w}
+			if lang := i18n.ParseAcceptLanguage(r.Header.Get("Accept-Language")); lang != "" {
+				lw.lang = lang
+				lw.requested = true
+			} else {
+				lw.lang = i18n.Resolve(database.Config.GetWithDefault(r.Context(), "default_language", i18n.DefaultLanguage))
+			}
+
+			w.Header().Add("Vary", "Accept-Language")
+			next.ServeHTTP(lw, r)
+		})
+	}
+}
+
+// languageOf returns the API message language attached by LocaleMiddleware
+func languageOf(w http.ResponseWriter) string {
+	if lw, ok := w.(*localeWriter); ok {
+		return lw.lang
+	}
+	return ""
+}
+
 // AdminOnlyMiddleware restricts access to admin users
 func AdminOnlyMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -72,6 +143,73 @@ func AdminOnlyMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// PeerAddrMiddleware remembers the address of the TCP peer before
+// middleware.RealIP replaces it with a forwarded client address
+func PeerAddrMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), contextKeyPeerAddr, r.RemoteAddr)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// peerAddr returns the address of the TCP peer, which unlike r.RemoteAddr
+// can't be set by the client through forwarding headers
+func peerAddr(r *http.Request) string {
+	if peer, _ := r.Context().Value(contextKeyPeerAddr).(string); peer != "" {
+		return peer
+	}
+	return r.RemoteAddr
+}
+
+// allowlistExemptPrefixes are API paths reached by Twilio, phones and podcast
+// apps from outside the management network. They are secured by signatures
+// and tokens instead.
+var allowlistExemptPrefixes = []string{"/api/webhooks/", "/api/provision/", "/api/feeds/"}
+
+// APIAllowlistMiddleware rejects requests from clients outside the
+// GOSIP_API_ALLOWLIST networks. Mount it once for all of /api and once on
+// the admin routes with adminRoutes set: each applies only when the
+// allowlist scope matches. Loopback clients are always allowed.
+func APIAllowlistMiddleware(allowlist *config.APIAllowlistConfig, adminRoutes bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !allowlist.Enabled() || allowlist.AdminOnly != adminRoutes {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range allowlistExemptPrefixes {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			ip := allowlistClientIP(r)
+			if ip != nil && (ip.IsLoopback() || allowlist.Allows(ip)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			client := "this address"
+			if ip != nil {
+				client = ip.String()
+			}
+			WriteError(w, http.StatusForbidden, ErrCodeAuthorization,
+				fmt.Sprintf("API access from %s is not allowed. Connect from an allowed network or ask an administrator to add it to GOSIP_API_ALLOWLIST.", client), nil)
+		})
+	}
+}
+
+// allowlistClientIP returns the client address to check against the
+// allowlist. Forwarded addresses are only trusted from a reverse proxy on
+// the same host, so remote clients can't spoof their way in.
+func allowlistClientIP(r *http.Request) net.IP {
+	ip := net.ParseIP(clientHost(peerAddr(r)))
+	if ip != nil && ip.IsLoopback() {
+		return net.ParseIP(clientHost(r.RemoteAddr))
+	}
+	return ip
+}
+
 // SetupOnlyMiddleware allows access only when setup is not complete
 func SetupOnlyMiddleware(database *db.DB) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
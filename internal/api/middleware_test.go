@@ -2,12 +2,16 @@ package api
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/btafoya/gosip/internal/config"
 	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5/middleware"
 )
 
 func TestGetUserFromContext(t *testing.T) {
@@ -253,3 +257,114 @@ func TestSessionDuration(t *testing.T) {
 		t.Errorf("SessionDuration = %v, want %v", SessionDuration, expected)
 	}
 }
+
+func TestLocaleMiddleware(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := LocaleMiddleware(setup.DB)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "email", Message: "Email is required"},
+		})
+	}))
+
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		expected       string
+		expectedDetail string
+	}{
+		{"no header uses default language", "", "Validation failed", "Email is required"},
+		{"spanish", "es-MX,es;q=0.9", "Error de validación", "El correo electrónico es obligatorio"},
+		{"unsupported falls back", "it-IT", "Validation failed", "Email is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/users", nil)
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			var resp ErrorResponse
+			decodeResponse(t, rr, &resp)
+			if resp.Error.Message != tt.expected {
+				t.Errorf("Expected message %q, got %q", tt.expected, resp.Error.Message)
+			}
+			if len(resp.Error.Details) != 1 || resp.Error.Details[0].Message != tt.expectedDetail {
+				t.Errorf("Expected detail %q, got %+v", tt.expectedDetail, resp.Error.Details)
+			}
+		})
+	}
+
+	t.Run("default_language setting", func(t *testing.T) {
+		if err := setup.DB.Config.Set(context.Background(), "default_language", "de"); err != nil {
+			t.Fatalf("Failed to set default language: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/users", nil))
+
+		var resp ErrorResponse
+		decodeResponse(t, rr, &resp)
+		if resp.Error.Message != "Validierung fehlgeschlagen" {
+			t.Errorf("Expected German message, got %q", resp.Error.Message)
+		}
+	})
+}
+
+func TestAPIAllowlistMiddleware(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("192.168.1.0/24")
+	allowlist := &config.APIAllowlistConfig{Networks: []*net.IPNet{lan}}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := PeerAddrMiddleware(middleware.RealIP(APIAllowlistMiddleware(allowlist, false)(ok)))
+
+	tests := []struct {
+		name      string
+		path      string
+		peer      string
+		forwarded string
+		want      int
+	}{
+		{"allowed network", "/api/dids", "192.168.1.10:5000", "", http.StatusOK},
+		{"outside network", "/api/dids", "203.0.113.5:5000", "", http.StatusForbidden},
+		{"localhost bypass", "/api/dids", "127.0.0.1:5000", "", http.StatusOK},
+		{"spoofed forwarded address", "/api/dids", "203.0.113.5:5000", "192.168.1.10", http.StatusForbidden},
+		{"local proxy for allowed client", "/api/dids", "127.0.0.1:5000", "192.168.1.10", http.StatusOK},
+		{"local proxy for outside client", "/api/dids", "127.0.0.1:5000", "203.0.113.5", http.StatusForbidden},
+		{"webhooks exempt", "/api/webhooks/sms/incoming", "203.0.113.5:5000", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = tt.peer
+			if tt.forwarded != "" {
+				req.Header.Set("X-Real-IP", tt.forwarded)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.want {
+				t.Fatalf("Expected %d, got %d", tt.want, rr.Code)
+			}
+			if rr.Code == http.StatusForbidden && !strings.Contains(rr.Body.String(), "203.0.113.5") {
+				t.Errorf("Expected the rejected address in the message, got %s", rr.Body.String())
+			}
+		})
+	}
+
+	// With the admin scope, only the admin routes are restricted
+	allowlist.AdminOnly = true
+	req := httptest.NewRequest(http.MethodGet, "/api/dids", nil)
+	req.RemoteAddr = "203.0.113.5:5000"
+	rr := httptest.NewRecorder()
+	APIAllowlistMiddleware(allowlist, false)(ok).ServeHTTP(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+
+	rr = httptest.NewRecorder()
+	APIAllowlistMiddleware(allowlist, true)(ok).ServeHTTP(rr, req)
+	assertStatus(t, rr, http.StatusForbidden)
+}
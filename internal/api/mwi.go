@@ -30,6 +30,23 @@ func (n *MWINotifier) UpdateMWIForDID(ctx context.Context, didID int64) error {
 		return nil
 	}
 
+	// Members of a shared box each see their own unread count
+	members, err := n.deps.DB.VoicemailBoxes.ListMembers(ctx, didID)
+	if err != nil {
+		return fmt.Errorf("failed to list voicemail box members: %w", err)
+	}
+	if len(members) > 0 {
+		for _, member := range members {
+			if err := n.UpdateMWIForUser(ctx, member.UserID); err != nil {
+				slog.Error("Failed to update MWI for voicemail box member",
+					slog.Int64("user_id", member.UserID),
+					slog.String("error", err.Error()),
+				)
+			}
+		}
+		return nil
+	}
+
 	// Get voicemail counts for this DID
 	newCount, err := n.deps.DB.Voicemails.CountUnread(ctx, &didID)
 	if err != nil {
@@ -104,3 +121,48 @@ func (n *MWINotifier) UpdateMWIForVoicemail(ctx context.Context, voicemailID int
 
 	return n.UpdateMWIForDID(ctx, *voicemail.UserID)
 }
+
+// UpdateMWIForUser updates MWI state for a user's devices from the shared
+// voicemail boxes the user is a member of, counting the user's own unread
+// voicemails
+func (n *MWINotifier) UpdateMWIForUser(ctx context.Context, userID int64) error {
+	if n.deps.SIP == nil || n.deps.SIP.GetMWIManager() == nil {
+		return nil
+	}
+	mwiMgr := n.deps.SIP.GetMWIManager()
+
+	boxes, err := n.deps.DB.VoicemailBoxes.ListBoxesForUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list voicemail boxes: %w", err)
+	}
+
+	newCount, totalCount := 0, 0
+	for _, didID := range boxes {
+		unread, err := n.deps.DB.VoicemailBoxes.CountUnread(ctx, didID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to count unread voicemails: %w", err)
+		}
+		total, err := n.deps.DB.Voicemails.CountByUser(ctx, didID)
+		if err != nil {
+			return fmt.Errorf("failed to count total voicemails: %w", err)
+		}
+		newCount += unread
+		totalCount += total
+	}
+
+	devices, err := n.deps.DB.Devices.ListByUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list devices for user: %w", err)
+	}
+	for _, device := range devices {
+		aor := fmt.Sprintf("sip:%s@%s", device.Username, "gosip")
+		if err := mwiMgr.UpdateState(ctx, aor, newCount, totalCount-newCount); err != nil {
+			slog.Error("Failed to update MWI state",
+				slog.String("aor", aor),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+
+	return nil
+}
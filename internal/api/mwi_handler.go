@@ -77,19 +77,14 @@ func (h *MWIHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	// Get subscriptions by iterating through known AORs
-	// Note: This is a simplified approach - in production you'd have a GetAllSubscriptions method
-	for aor := range states {
-		subs := mwiMgr.GetSubscriptionsForAOR(aor)
-		for _, sub := range subs {
-			response.Subscriptions = append(response.Subscriptions, MWISubscriptionResponse{
-				ID:         sub.ID,
-				AOR:        sub.AOR,
-				ContactURI: sub.ContactURI,
-				Expires:    sub.Expires,
-				ExpiresAt:  sub.ExpiresAt.Format("2006-01-02T15:04:05Z"),
-			})
-		}
+	for _, sub := range mwiMgr.ListSubscriptions() {
+		response.Subscriptions = append(response.Subscriptions, MWISubscriptionResponse{
+			ID:         sub.ID,
+			AOR:        sub.AOR,
+			ContactURI: sub.ContactURI,
+			Expires:    sub.Expires,
+			ExpiresAt:  sub.ExpiresAt.Format("2006-01-02T15:04:05Z"),
+		})
 	}
 
 	WriteJSON(w, http.StatusOK, map[string]interface{}{"data": response})
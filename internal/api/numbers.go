@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// NumberHandler handles finding and merging external numbers recorded under
+// several spellings, such as +15559876543 and (555) 987-6543
+type NumberHandler struct {
+	deps *Dependencies
+}
+
+// NewNumberHandler creates a new NumberHandler
+func NewNumberHandler(deps *Dependencies) *NumberHandler {
+	return &NumberHandler{deps: deps}
+}
+
+// MergeNumbersRequest represents a request to merge spellings of a number
+type MergeNumbersRequest struct {
+	Numbers []string `json:"numbers"` // Spellings to merge, all detected ones when empty
+}
+
+// Duplicates lists the numbers recorded under more than one spelling
+func (h *NumberHandler) Duplicates(w http.ResponseWriter, r *http.Request) {
+	duplicates, err := h.deps.DB.Numbers.Duplicates(r.Context())
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"data": duplicates})
+}
+
+// Merge re-links the calls, messages, voicemails and notes recorded under
+// other spellings of a number to the one in the URL
+func (h *NumberHandler) Merge(w http.ResponseWriter, r *http.Request) {
+	into := chi.URLParam(r, "number")
+	e164 := db.NormalizeE164(into)
+	if e164 == "" {
+		WriteValidationError(w, "Not a phone number", nil)
+		return
+	}
+
+	var req MergeNumbersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	if len(req.Numbers) == 0 {
+		duplicates, err := h.deps.DB.Numbers.Duplicates(r.Context())
+		if err != nil {
+			WriteInternalError(w)
+			return
+		}
+		for _, d := range duplicates {
+			if d.Number != e164 {
+				continue
+			}
+			for _, v := range d.Variants {
+				if v.Number != into {
+					req.Numbers = append(req.Numbers, v.Number)
+				}
+			}
+		}
+		if len(req.Numbers) == 0 {
+			WriteNotFoundError(w, "Duplicate number")
+			return
+		}
+	}
+
+	var fieldErrors []FieldError
+	for _, number := range req.Numbers {
+		if db.NormalizeE164(number) != e164 {
+			fieldErrors = append(fieldErrors, FieldError{Field: "numbers", Message: number + " is not the same number as " + into})
+		}
+	}
+	if len(fieldErrors) > 0 {
+		WriteValidationError(w, "Validation failed", fieldErrors)
+		return
+	}
+
+	merge, err := h.deps.DB.Numbers.Merge(r.Context(), into, req.Numbers)
+	if err != nil {
+		slog.Error("Failed to merge numbers", "error", err, "number", into)
+		WriteInternalError(w)
+		return
+	}
+
+	slog.Info("Merged numbers", "number", into, "merged", merge.Merged,
+		"calls", merge.Calls, "messages", merge.Messages, "voicemails", merge.Voicemails, "notes", merge.Notes)
+	WriteJSON(w, http.StatusOK, merge)
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestNumberHandler_Merge(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewNumberHandler(&Dependencies{DB: setup.DB})
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	createTestCDR(t, setup.DB, did.ID, "inbound", "+15559876543", did.Number)
+	createTestCDR(t, setup.DB, did.ID, "inbound", "(555) 987-6543", did.Number)
+	createTestMessage(t, setup.DB, did.ID, "inbound", "555.987.6543", "Hello")
+
+	merge := func(number, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/numbers/x/merge", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler.Merge(rr, withURLParams(req, map[string]string{"number": number}))
+		return rr
+	}
+
+	assertStatus(t, merge("201", ""), http.StatusBadRequest)
+	assertStatus(t, merge("+15559876543", `{"numbers": ["+15550001111"]}`), http.StatusBadRequest)
+
+	// With no numbers given every detected spelling is merged
+	rr := merge("+15559876543", "")
+	assertStatus(t, rr, http.StatusOK)
+	var result models.NumberMerge
+	decodeResponse(t, rr, &result)
+	if len(result.Merged) != 2 || result.Calls != 1 || result.Messages != 1 {
+		t.Errorf("Unexpected merge %+v", result)
+	}
+
+	assertStatus(t, merge("+15559876543", ""), http.StatusNotFound)
+}
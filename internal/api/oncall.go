@@ -0,0 +1,467 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/oncall"
+	"github.com/btafoya/gosip/internal/rules"
+	"github.com/go-chi/chi/v5"
+)
+
+// OnCallHandler handles on-call schedule API endpoints
+type OnCallHandler struct {
+	deps *Dependencies
+}
+
+// NewOnCallHandler creates a new OnCallHandler
+func NewOnCallHandler(deps *Dependencies) *OnCallHandler {
+	return &OnCallHandler{deps: deps}
+}
+
+// OnCallScheduleResponse is an on-call schedule with who is on call now
+type OnCallScheduleResponse struct {
+	*models.OnCallSchedule
+	ICalURL   string                   `json:"ical_url"`
+	Current   []oncall.Shift           `json:"current"`
+	Overrides []*models.OnCallOverride `json:"overrides,omitempty"`
+}
+
+// OnCallScheduleRequest represents an on-call schedule create or update request
+type OnCallScheduleRequest struct {
+	Name     string               `json:"name"`
+	Timezone *string              `json:"timezone,omitempty"`
+	Levels   []models.OnCallLevel `json:"levels"`
+}
+
+// OnCallOverrideRequest represents an on-call override creation request
+type OnCallOverrideRequest struct {
+	Level    int       `json:"level"`
+	UserID   int64     `json:"user_id"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+// List returns all on-call schedules
+func (h *OnCallHandler) List(w http.ResponseWriter, r *http.Request) {
+	schedules, err := h.deps.DB.OnCall.List(r.Context())
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	response := []*OnCallScheduleResponse{}
+	for _, s := range schedules {
+		resp, err := h.toResponse(r.Context(), s, false)
+		if err != nil {
+			WriteInternalError(w)
+			return
+		}
+		response = append(response, resp)
+	}
+
+	WriteJSON(w, http.StatusOK, response)
+}
+
+// Create creates an on-call schedule
+func (h *OnCallHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req OnCallScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	schedule := &models.OnCallSchedule{Name: req.Name, Levels: req.Levels}
+	if req.Timezone != nil {
+		schedule.Timezone = *req.Timezone
+	}
+	if errs := h.validateSchedule(r.Context(), schedule); len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	if err := h.deps.DB.OnCall.Create(r.Context(), schedule); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "An on-call schedule with this name already exists", nil)
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	h.writeSchedule(w, r, schedule, http.StatusCreated)
+}
+
+// Get returns an on-call schedule with its upcoming overrides
+func (h *OnCallHandler) Get(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := h.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+	h.writeSchedule(w, r, schedule, http.StatusOK)
+}
+
+// Update updates an on-call schedule. Levels, when given, replace the existing ones.
+func (h *OnCallHandler) Update(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := h.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	var req OnCallScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	if req.Name != "" {
+		schedule.Name = req.Name
+	}
+	if req.Timezone != nil {
+		schedule.Timezone = *req.Timezone
+	}
+	if req.Levels != nil {
+		schedule.Levels = req.Levels
+	}
+	if errs := h.validateSchedule(r.Context(), schedule); len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	if err := h.deps.DB.OnCall.Update(r.Context(), schedule); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "An on-call schedule with this name already exists", nil)
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	h.writeSchedule(w, r, schedule, http.StatusOK)
+}
+
+// Delete removes an on-call schedule. Routes paging it fall back to voicemail.
+func (h *OnCallHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid schedule ID", nil)
+		return
+	}
+
+	if err := h.deps.DB.OnCall.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, db.ErrOnCallScheduleNotFound) {
+			WriteNotFoundError(w, "On-call schedule")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "On-call schedule deleted successfully"})
+}
+
+// Shifts returns who is on call at every level between from and to, which
+// default to the next two weeks
+func (h *OnCallHandler) Shifts(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := h.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	from, to := time.Now(), time.Now().Add(14*24*time.Hour)
+	var errs []FieldError
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			errs = append(errs, FieldError{Field: "from", Message: "Must be an RFC 3339 time"})
+		}
+		from = t
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			errs = append(errs, FieldError{Field: "to", Message: "Must be an RFC 3339 time"})
+		}
+		to = t
+	}
+	if len(errs) == 0 && (!to.After(from) || to.Sub(from) > config.OnCallMaxShiftRange) {
+		errs = append(errs, FieldError{Field: "to", Message: "Must be after from and at most 92 days later"})
+	}
+	if len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	overrides, err := h.deps.DB.OnCall.ListOverrides(r.Context(), schedule.ID, from)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	shifts := oncall.Shifts(schedule, overrides, from, to, onCallLocation(r.Context(), h.deps, schedule))
+	if shifts == nil {
+		shifts = []oncall.Shift{}
+	}
+	WriteJSON(w, http.StatusOK, shifts)
+}
+
+// CreateOverride puts a user on call at one level of a schedule for a period
+func (h *OnCallHandler) CreateOverride(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := h.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	var req OnCallOverrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	var errors []FieldError
+	if req.Level < 1 || req.Level > len(schedule.Levels) {
+		errors = append(errors, FieldError{Field: "level", Message: "Must be one of the schedule's levels"})
+	}
+	if !userExists(r.Context(), h.deps, req.UserID) {
+		errors = append(errors, userIDFieldError("user_id"))
+	}
+	if req.StartsAt.IsZero() {
+		errors = append(errors, FieldError{Field: "starts_at", Message: "Start time is required"})
+	}
+	if !req.EndsAt.After(req.StartsAt) {
+		errors = append(errors, FieldError{Field: "ends_at", Message: "Must be after the start time"})
+	}
+	if len(errors) > 0 {
+		WriteValidationError(w, "Validation failed", errors)
+		return
+	}
+
+	override := &models.OnCallOverride{
+		ScheduleID: schedule.ID,
+		Level:      req.Level,
+		UserID:     req.UserID,
+		StartsAt:   req.StartsAt,
+		EndsAt:     req.EndsAt,
+	}
+	if err := h.deps.DB.OnCall.CreateOverride(r.Context(), override); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, override)
+}
+
+// DeleteOverride removes an override from a schedule
+func (h *OnCallHandler) DeleteOverride(w http.ResponseWriter, r *http.Request) {
+	scheduleID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid schedule ID", nil)
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "overrideID"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid override ID", nil)
+		return
+	}
+
+	if err := h.deps.DB.OnCall.DeleteOverride(r.Context(), scheduleID, id); err != nil {
+		if errors.Is(err, db.ErrOnCallOverrideNotFound) {
+			WriteNotFoundError(w, "On-call override")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "On-call override deleted successfully"})
+}
+
+// RotateICalToken replaces a schedule's secret iCal feed URL so calendars
+// subscribed to the old one lose access
+func (h *OnCallHandler) RotateICalToken(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := h.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.deps.DB.OnCall.RotateToken(r.Context(), schedule); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	h.writeSchedule(w, r, schedule, http.StatusOK)
+}
+
+// ICalFeed serves a schedule's rotation as an iCalendar feed. The secret
+// token in the URL is the only credential, since calendar apps can't log in.
+func (h *OnCallHandler) ICalFeed(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	token := strings.TrimSuffix(chi.URLParam(r, "token"), ".ics")
+	schedule, err := h.deps.DB.OnCall.GetByToken(ctx, token)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	now := time.Now()
+	from, to := now.Add(-config.OnCallFeedPast), now.Add(config.OnCallFeedAhead)
+	overrides, err := h.deps.DB.OnCall.ListOverrides(ctx, schedule.ID, from)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	shifts := oncall.Shifts(schedule, overrides, from, to, onCallLocation(ctx, h.deps, schedule))
+
+	names := make(map[int64]string)
+	for _, s := range shifts {
+		if _, ok := names[s.UserID]; ok {
+			continue
+		}
+		if user, err := h.deps.DB.Users.GetByID(ctx, s.UserID); err == nil {
+			names[s.UserID] = user.Email
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := oncall.WriteICal(&buf, schedule, shifts, names, now); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// loadSchedule looks up the schedule named in the URL, writing an error
+// response when it can't
+func (h *OnCallHandler) loadSchedule(w http.ResponseWriter, r *http.Request) (*models.OnCallSchedule, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid schedule ID", nil)
+		return nil, false
+	}
+
+	schedule, err := h.deps.DB.OnCall.GetByID(r.Context(), id)
+	if errors.Is(err, db.ErrOnCallScheduleNotFound) {
+		WriteNotFoundError(w, "On-call schedule")
+		return nil, false
+	}
+	if err != nil {
+		WriteInternalError(w)
+		return nil, false
+	}
+	return schedule, true
+}
+
+// writeSchedule responds with a schedule, who is on call now and its upcoming overrides
+func (h *OnCallHandler) writeSchedule(w http.ResponseWriter, r *http.Request, schedule *models.OnCallSchedule, status int) {
+	resp, err := h.toResponse(r.Context(), schedule, true)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	WriteJSON(w, status, resp)
+}
+
+func (h *OnCallHandler) toResponse(ctx context.Context, schedule *models.OnCallSchedule, withOverrides bool) (*OnCallScheduleResponse, error) {
+	now := time.Now()
+	overrides, err := h.deps.DB.OnCall.ListOverrides(ctx, schedule.ID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &OnCallScheduleResponse{
+		OnCallSchedule: schedule,
+		ICalURL:        h.icalURL(ctx, schedule.ICalToken),
+		Current:        oncall.Shifts(schedule, overrides, now, now.Add(time.Nanosecond), onCallLocation(ctx, h.deps, schedule)),
+	}
+	if resp.Current == nil {
+		resp.Current = []oncall.Shift{}
+	}
+	if withOverrides {
+		resp.Overrides = overrides
+	}
+	return resp, nil
+}
+
+// icalURL returns the public URL of a schedule's iCal feed
+func (h *OnCallHandler) icalURL(ctx context.Context, token string) string {
+	return fmt.Sprintf("%s/api/feeds/oncall/%s.ics", publicBaseURL(ctx, h.deps), token)
+}
+
+// onCallLocation returns the timezone whole-day shifts of a schedule hand
+// off in: the schedule's own timezone, then the system timezone
+func onCallLocation(ctx context.Context, deps *Dependencies, schedule *models.OnCallSchedule) *time.Location {
+	system := rules.LoadLocation(deps.DB.Config.GetWithDefault(ctx, "timezone", ""), time.Local)
+	return rules.LoadLocation(schedule.Timezone, system)
+}
+
+// validateSchedule checks a schedule's name, timezone and levels, filling in
+// default shift lengths, timeouts and rotation starts
+func (h *OnCallHandler) validateSchedule(ctx context.Context, schedule *models.OnCallSchedule) []FieldError {
+	var errs []FieldError
+	if schedule.Name == "" {
+		errs = append(errs, FieldError{Field: "name", Message: "Name is required"})
+	}
+	if !validTimezone(schedule.Timezone) {
+		errs = append(errs, timezoneFieldError("timezone"))
+	}
+	if len(schedule.Levels) == 0 || len(schedule.Levels) > config.OnCallMaxLevels {
+		errs = append(errs, FieldError{Field: "levels", Message: fmt.Sprintf("Must have 1 to %d levels", config.OnCallMaxLevels)})
+	}
+
+	now := time.Now()
+	for i := range schedule.Levels {
+		level := &schedule.Levels[i]
+		field := fmt.Sprintf("levels[%d].", i)
+
+		if len(level.UserIDs) == 0 {
+			errs = append(errs, FieldError{Field: field + "user_ids", Message: "At least one user is required"})
+		}
+		for _, userID := range level.UserIDs {
+			if !userExists(ctx, h.deps, userID) {
+				errs = append(errs, userIDFieldError(field+"user_ids"))
+				break
+			}
+		}
+
+		if level.ShiftHours == 0 {
+			level.ShiftHours = config.OnCallDefaultShift
+		}
+		if level.ShiftHours < 1 || level.ShiftHours > 366*24 {
+			errs = append(errs, FieldError{Field: field + "shift_hours", Message: "Must be between 1 and 8784 hours"})
+		}
+		if level.Timeout == 0 {
+			level.Timeout = config.OnCallDefaultTimeout
+		}
+		if level.Timeout < 5 || level.Timeout > config.OnCallMaxTimeout {
+			errs = append(errs, FieldError{Field: field + "timeout", Message: fmt.Sprintf("Must be between 5 and %d seconds", config.OnCallMaxTimeout)})
+		}
+		if level.RotationStart.IsZero() {
+			level.RotationStart = now.Truncate(time.Hour)
+		}
+	}
+	return errs
+}
+
+// userExists reports whether userID names an existing user
+func userExists(ctx context.Context, deps *Dependencies, userID int64) bool {
+	if userID <= 0 {
+		return false
+	}
+	_, err := deps.DB.Users.GetByID(ctx, userID)
+	return err == nil
+}
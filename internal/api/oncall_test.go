@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// createOnCallResponder creates a user with one device
+func createOnCallResponder(t *testing.T, database *db.DB, email, deviceUsername string) *models.User {
+	t.Helper()
+
+	user := createTestUser(t, database, email, "password123", "user")
+	device := createTestDevice(t, database, email, deviceUsername)
+	device.UserID = &user.ID
+	if err := database.Devices.Update(context.Background(), device); err != nil {
+		t.Fatalf("Failed to assign device: %v", err)
+	}
+	return user
+}
+
+func TestOnCallHandler_Create(t *testing.T) {
+	setup := setupTestAPI(t)
+	user := createTestUser(t, setup.DB, "oncall@example.com", "password123", "user")
+	handler := NewOnCallHandler(&Dependencies{DB: setup.DB})
+
+	create := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.Create(rr, httptest.NewRequest(http.MethodPost, "/api/oncall", bytes.NewBufferString(body)))
+		return rr
+	}
+
+	userIDs := `[` + strconv.FormatInt(user.ID, 10) + `]`
+	tests := []struct {
+		name string
+		body string
+		want int
+		code string
+	}{
+		{"missing name", `{"levels": [{"user_ids": ` + userIDs + `}]}`, http.StatusBadRequest, ErrCodeValidation},
+		{"no levels", `{"name": "Ops", "levels": []}`, http.StatusBadRequest, ErrCodeValidation},
+		{"unknown user", `{"name": "Ops", "levels": [{"user_ids": [999]}]}`, http.StatusBadRequest, ErrCodeValidation},
+		{"bad timeout", `{"name": "Ops", "levels": [{"user_ids": ` + userIDs + `, "timeout": 1000}]}`, http.StatusBadRequest, ErrCodeValidation},
+		{"bad timezone", `{"name": "Ops", "timezone": "Mars/Base", "levels": [{"user_ids": ` + userIDs + `}]}`, http.StatusBadRequest, ErrCodeValidation},
+		{"valid", `{"name": "Ops", "levels": [{"user_ids": ` + userIDs + `}]}`, http.StatusCreated, ""},
+		{"duplicate name", `{"name": "Ops", "levels": [{"user_ids": ` + userIDs + `}]}`, http.StatusConflict, ErrCodeConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := create(tt.body)
+			assertStatus(t, rr, tt.want)
+			if tt.code != "" {
+				assertErrorCode(t, rr, tt.code)
+			}
+		})
+	}
+
+	schedules, err := setup.DB.OnCall.List(context.Background())
+	if err != nil || len(schedules) != 1 {
+		t.Fatalf("Expected 1 schedule, got %d (%v)", len(schedules), err)
+	}
+	level := schedules[0].Levels[0]
+	if level.ShiftHours != 168 || level.Timeout != 30 || level.RotationStart.IsZero() {
+		t.Errorf("Expected defaults to be filled in, got %+v", level)
+	}
+}
+
+func TestOnCallHandler_OverrideAndFeed(t *testing.T) {
+	setup := setupTestAPI(t)
+	alice := createTestUser(t, setup.DB, "alice@example.com", "password123", "user")
+	bob := createTestUser(t, setup.DB, "bob@example.com", "password123", "user")
+	handler := NewOnCallHandler(&Dependencies{DB: setup.DB})
+
+	schedule := &models.OnCallSchedule{
+		Name:   "Ops",
+		Levels: []models.OnCallLevel{{UserIDs: []int64{alice.ID}, RotationStart: time.Now().Add(-time.Hour), ShiftHours: 168, Timeout: 30}},
+	}
+	if err := setup.DB.OnCall.Create(context.Background(), schedule); err != nil {
+		t.Fatalf("Failed to create schedule: %v", err)
+	}
+	id := strconv.FormatInt(schedule.ID, 10)
+
+	now := time.Now().UTC()
+	body := `{"level": 1, "user_id": ` + strconv.FormatInt(bob.ID, 10) + `, "starts_at": "` + now.Add(-time.Minute).Format(time.RFC3339) + `", "ends_at": "` + now.Add(time.Hour).Format(time.RFC3339) + `"}`
+	rr := httptest.NewRecorder()
+	handler.CreateOverride(rr, withURLParams(httptest.NewRequest(http.MethodPost, "/api/oncall/"+id+"/overrides", bytes.NewBufferString(body)), map[string]string{"id": id}))
+	assertStatus(t, rr, http.StatusCreated)
+
+	rr = httptest.NewRecorder()
+	handler.CreateOverride(rr, withURLParams(httptest.NewRequest(http.MethodPost, "/api/oncall/"+id+"/overrides", bytes.NewBufferString(`{"level": 2, "user_id": 1}`)), map[string]string{"id": id}))
+	assertStatus(t, rr, http.StatusBadRequest)
+
+	rr = httptest.NewRecorder()
+	handler.Get(rr, withURLParams(httptest.NewRequest(http.MethodGet, "/api/oncall/"+id, nil), map[string]string{"id": id}))
+	assertStatus(t, rr, http.StatusOK)
+	var resp OnCallScheduleResponse
+	decodeResponse(t, rr, &resp)
+	if len(resp.Current) != 1 || resp.Current[0].UserID != bob.ID || !resp.Current[0].Override {
+		t.Errorf("Expected bob on call through the override, got %+v", resp.Current)
+	}
+	if !strings.HasSuffix(resp.ICalURL, "/api/feeds/oncall/"+schedule.ICalToken+".ics") {
+		t.Errorf("Unexpected iCal URL %q", resp.ICalURL)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ICalFeed(rr, withURLParams(httptest.NewRequest(http.MethodGet, "/api/feeds/oncall/x", nil), map[string]string{"token": schedule.ICalToken + ".ics"}))
+	assertStatus(t, rr, http.StatusOK)
+	feed := rr.Body.String()
+	if !strings.Contains(feed, "On call: alice@example.com (level 1)") || !strings.Contains(feed, "On call: bob@example.com (level 1) - override") {
+		t.Errorf("Expected alice and bob's shifts in the feed, got:\n%s", feed)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ICalFeed(rr, withURLParams(httptest.NewRequest(http.MethodGet, "/api/feeds/oncall/x", nil), map[string]string{"token": "wrong"}))
+	assertStatus(t, rr, http.StatusNotFound)
+}
+
+func TestWebhookHandler_OnCallEscalation(t *testing.T) {
+	setup := setupTestAPI(t)
+	did := createTestDID(t, setup.DB, "+15550001111")
+	alice := createOnCallResponder(t, setup.DB, "alice@example.com", "alice-phone")
+	bob := createOnCallResponder(t, setup.DB, "bob@example.com", "bob-phone")
+
+	start := time.Now().Add(-time.Hour)
+	schedule := &models.OnCallSchedule{
+		Name: "Ops",
+		Levels: []models.OnCallLevel{
+			{UserIDs: []int64{alice.ID}, RotationStart: start, ShiftHours: 168, Timeout: 20},
+			{UserIDs: []int64{bob.ID}, RotationStart: start, ShiftHours: 168, Timeout: 45},
+		},
+	}
+	if err := setup.DB.OnCall.Create(context.Background(), schedule); err != nil {
+		t.Fatalf("Failed to create schedule: %v", err)
+	}
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+
+	route := &models.Route{ActionType: "oncall", ActionData: []byte(`{"schedule_id": ` + strconv.FormatInt(schedule.ID, 10) + `}`)}
+	twiml := handler.executeAction(route, did, "+15559876543", "CA123", "")
+	if !strings.Contains(twiml, "alice-phone@") || !strings.Contains(twiml, `timeout="20"`) || !strings.Contains(twiml, "Level=2") {
+		t.Errorf("Expected level 1 to ring alice, got %s", twiml)
+	}
+
+	escalate := func(status string, level int) string {
+		target := "/api/webhooks/voice/oncall?DidId=" + strconv.FormatInt(did.ID, 10) + "&ScheduleId=" + strconv.FormatInt(schedule.ID, 10) + "&Level=" + strconv.Itoa(level)
+		req := newSignedWebhookRequest(t, setup.DB, target, url.Values{"From": {"+15559876543"}, "DialCallStatus": {status}})
+		rr := httptest.NewRecorder()
+		handler.VoiceOnCall(rr, req)
+		return rr.Body.String()
+	}
+
+	if body := escalate("completed", 2); !strings.Contains(body, "<Response><Hangup/></Response>") {
+		t.Errorf("Expected answered call to end, got %s", body)
+	}
+	if body := escalate("no-answer", 2); !strings.Contains(body, "bob-phone@") || !strings.Contains(body, `timeout="45"`) {
+		t.Errorf("Expected level 2 to ring bob, got %s", body)
+	}
+	if body := escalate("no-answer", 3); !strings.Contains(body, "<Record") {
+		t.Errorf("Expected voicemail after the last level, got %s", body)
+	}
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/passwords"
+)
+
+// PasswordPolicyHandler serves the password policy to UIs and admins
+type PasswordPolicyHandler struct {
+	deps *Dependencies
+}
+
+// NewPasswordPolicyHandler creates a new PasswordPolicyHandler
+func NewPasswordPolicyHandler(deps *Dependencies) *PasswordPolicyHandler {
+	return &PasswordPolicyHandler{deps: deps}
+}
+
+// Get returns the password policy, so forms can show the rules before submitting
+func (h *PasswordPolicyHandler) Get(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, passwords.LoadPolicy(r.Context(), h.deps.DB))
+}
+
+// UpdatePasswordPolicyRequest represents a password policy change. Omitted
+// fields keep their current value.
+type UpdatePasswordPolicyRequest struct {
+	MinLength        *int  `json:"min_length,omitempty"`
+	RequireUppercase *bool `json:"require_uppercase,omitempty"`
+	RequireLowercase *bool `json:"require_lowercase,omitempty"`
+	RequireDigit     *bool `json:"require_digit,omitempty"`
+	RequireSymbol    *bool `json:"require_symbol,omitempty"`
+	BlockCommon      *bool `json:"block_common,omitempty"`
+	BreachCheck      *bool `json:"breach_check,omitempty"`
+}
+
+// Update changes the password policy (admin only). Existing passwords are
+// not affected until they are next changed.
+func (h *PasswordPolicyHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var req UpdatePasswordPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	if req.MinLength != nil && (*req.MinLength < config.PasswordMinLengthFloor || *req.MinLength > config.PasswordMaxLength) {
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "min_length", Message: "Minimum length must be between 8 and 72"},
+		})
+		return
+	}
+
+	policy := passwords.LoadPolicy(r.Context(), h.deps.DB)
+	if req.MinLength != nil {
+		policy.MinLength = *req.MinLength
+	}
+	for _, f := range []struct {
+		value  *bool
+		target *bool
+	}{
+		{req.RequireUppercase, &policy.RequireUppercase},
+		{req.RequireLowercase, &policy.RequireLowercase},
+		{req.RequireDigit, &policy.RequireDigit},
+		{req.RequireSymbol, &policy.RequireSymbol},
+		{req.BlockCommon, &policy.BlockCommon},
+		{req.BreachCheck, &policy.BreachCheck},
+	} {
+		if f.value != nil {
+			*f.target = *f.value
+		}
+	}
+
+	if err := passwords.SavePolicy(r.Context(), h.deps.DB, policy); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, policy)
+}
+
+// checkPassword validates a new account password against the password
+// policy, returning one field error per broken rule. When the breach check
+// is on but the lookup fails, the password is accepted and the failure logged.
+func checkPassword(ctx context.Context, deps *Dependencies, field, password string) []FieldError {
+	policy := passwords.LoadPolicy(ctx, deps.DB)
+
+	var errors []FieldError
+	for _, msg := range policy.Check(password) {
+		errors = append(errors, FieldError{Field: field, Message: msg})
+	}
+
+	if len(errors) == 0 && policy.BreachCheck && deps.Breaches != nil {
+		count, err := deps.Breaches.Breached(ctx, password)
+		if err != nil {
+			slog.Warn("Password breach check failed", "error", err)
+		} else if count > 0 {
+			errors = append(errors, FieldError{Field: field, Message: passwords.MsgBreached})
+		}
+	}
+	return errors
+}
+
+// generateDevicePassword returns a random SIP device password that
+// satisfies the password policy
+func generateDevicePassword(ctx context.Context, deps *Dependencies) (string, error) {
+	return passwords.LoadPolicy(ctx, deps.DB).Generate(config.GeneratedPasswordLength)
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/passwords"
+	"github.com/btafoya/gosip/pkg/sip"
+)
+
+// fakeBreaches reports every password in its set as breached
+type fakeBreaches map[string]int
+
+func (f fakeBreaches) Breached(ctx context.Context, password string) (int, error) {
+	return f[password], nil
+}
+
+func TestPasswordPolicyHandler_Update(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB}
+	handler := NewPasswordPolicyHandler(deps)
+
+	body, _ := json.Marshal(map[string]interface{}{"min_length": 12, "require_symbol": true})
+	req := httptest.NewRequest(http.MethodPut, "/api/system/password-policy", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler.Update(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/password-policy", nil)
+	rr = httptest.NewRecorder()
+	handler.Get(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+
+	var policy passwords.Policy
+	decodeResponse(t, rr, &policy)
+	if policy.MinLength != 12 || !policy.RequireSymbol || !policy.BlockCommon || policy.RequireDigit {
+		t.Errorf("Unexpected policy %+v", policy)
+	}
+
+	body, _ = json.Marshal(map[string]interface{}{"min_length": 4})
+	req = httptest.NewRequest(http.MethodPut, "/api/system/password-policy", bytes.NewBuffer(body))
+	rr = httptest.NewRecorder()
+	handler.Update(rr, req)
+	assertStatus(t, rr, http.StatusBadRequest)
+}
+
+func TestAuthHandler_CreateUser_PasswordPolicy(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB, Breaches: fakeBreaches{"violet-harbor-42": 7}}
+	handler := NewAuthHandler(deps)
+
+	if err := passwords.SavePolicy(context.Background(), setup.DB, passwords.Policy{MinLength: 8, BlockCommon: true, BreachCheck: true}); err != nil {
+		t.Fatalf("Failed to save policy: %v", err)
+	}
+
+	tests := []struct {
+		password string
+		status   int
+		message  string
+	}{
+		{"password123", http.StatusBadRequest, passwords.MsgCommon},
+		{"violet-harbor-42", http.StatusBadRequest, passwords.MsgBreached},
+		{"amber-canyon-17", http.StatusCreated, ""},
+	}
+	for _, tt := range tests {
+		body, _ := json.Marshal(CreateUserRequest{Email: tt.password + "@example.com", Password: tt.password})
+		req := httptest.NewRequest(http.MethodPost, "/api/users", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		handler.CreateUser(rr, req)
+
+		assertStatus(t, rr, tt.status)
+		if tt.message != "" && !bytes.Contains(rr.Body.Bytes(), []byte(tt.message)) {
+			t.Errorf("Expected %q for %s, got %s", tt.message, tt.password, rr.Body.String())
+		}
+	}
+}
+
+func TestDeviceHandler_Create_GeneratePassword(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB}
+	handler := NewDeviceHandler(deps)
+
+	body, _ := json.Marshal(CreateDeviceRequest{Name: "Desk Phone", Username: "desk", GeneratePassword: true})
+	req := httptest.NewRequest(http.MethodPost, "/api/devices", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler.Create(rr, req)
+	assertStatus(t, rr, http.StatusCreated)
+
+	var resp DeviceResponse
+	decodeResponse(t, rr, &resp)
+	if violations := passwords.DefaultPolicy().Check(resp.GeneratedPassword); resp.GeneratedPassword == "" || len(violations) > 0 {
+		t.Fatalf("Expected a generated password meeting the policy, got %q %v", resp.GeneratedPassword, violations)
+	}
+
+	device, err := setup.DB.Devices.GetByID(context.Background(), resp.ID)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if device.PasswordHash != sip.GenerateHA1("desk", "gosip", resp.GeneratedPassword) {
+		t.Error("Expected the device to authenticate with the generated password")
+	}
+
+	// The password is only shown once
+	id := strconv.FormatInt(resp.ID, 10)
+	req = withURLParams(httptest.NewRequest(http.MethodGet, "/api/devices/"+id, nil), map[string]string{"id": id})
+	rr = httptest.NewRecorder()
+	handler.Get(rr, req)
+	if bytes.Contains(rr.Body.Bytes(), []byte("generated_password")) {
+		t.Error("Expected no generated password when fetching the device")
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+)
+
+// PortMapHandler reports and renews router port forwards
+type PortMapHandler struct {
+	deps *Dependencies
+}
+
+// NewPortMapHandler creates a new PortMapHandler
+func NewPortMapHandler(deps *Dependencies) *PortMapHandler {
+	return &PortMapHandler{deps: deps}
+}
+
+// Get returns the forwards and the router holding them (admin only)
+func (h *PortMapHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if h.deps.PortMap == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Port mapping is not available", nil)
+		return
+	}
+	WriteJSON(w, http.StatusOK, h.deps.PortMap.Status())
+}
+
+// Refresh requests the forwards from the router now (admin only)
+func (h *PortMapHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	if h.deps.PortMap == nil || !h.deps.PortMap.Enabled() {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Port mapping is off. Set GOSIP_PORTMAP to enable it.", nil)
+		return
+	}
+	status, err := h.deps.PortMap.Refresh(r.Context())
+	if err != nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Port mapping failed: "+err.Error(), nil)
+		return
+	}
+	WriteJSON(w, http.StatusOK, status)
+}
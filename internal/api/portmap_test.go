@@ -0,0 +1,33 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/portmap"
+)
+
+func TestPortMapHandler(t *testing.T) {
+	mapper := portmap.NewMapper(&config.Config{SIPPort: 5060, PortMap: &config.PortMapConfig{Mode: config.PortMapOff}})
+	handler := NewPortMapHandler(&Dependencies{PortMap: mapper})
+
+	rr := httptest.NewRecorder()
+	handler.Get(rr, httptest.NewRequest(http.MethodGet, "/api/system/portmap", nil))
+	assertStatus(t, rr, http.StatusOK)
+
+	var status portmap.Status
+	if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if status.Mode != config.PortMapOff || status.Mappings == nil {
+		t.Errorf("Expected port mapping off with no forwards, got %+v", status)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.Refresh(rr, httptest.NewRequest(http.MethodPost, "/api/system/portmap/refresh", nil))
+	assertStatus(t, rr, http.StatusServiceUnavailable)
+	assertErrorCode(t, rr, ErrCodeServiceUnavailable)
+}
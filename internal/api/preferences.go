@@ -0,0 +1,252 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// Preference keys
+const (
+	PrefTimezone             = "timezone"
+	PrefNotificationChannels = "notification_channels"
+	PrefDefaultDID           = "default_did"
+	PrefTableColumns         = "table_columns"
+)
+
+// preferenceChannels are the notification channels a user can prefer
+var preferenceChannels = map[string]bool{"email": true, "push": true, "browser": true}
+
+// preferenceName matches table and column names in saved layouts
+var preferenceName = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,63}$`)
+
+// preferenceValidator checks a preference value, returning a message
+// describing what is wrong or "" when it is valid
+type preferenceValidator func(ctx context.Context, deps *Dependencies, value json.RawMessage) string
+
+// preferenceSchema lists the known preferences and how each is checked
+var preferenceSchema = map[string]preferenceValidator{
+	PrefTimezone:             validateTimezonePreference,
+	PrefNotificationChannels: validateChannelsPreference,
+	PrefDefaultDID:           validateDefaultDIDPreference,
+	PrefTableColumns:         validateTableColumnsPreference,
+}
+
+// validateTimezonePreference takes an IANA timezone name
+func validateTimezonePreference(_ context.Context, _ *Dependencies, value json.RawMessage) string {
+	var tz string
+	if err := json.Unmarshal(value, &tz); err != nil || tz == "" || !validTimezone(tz) {
+		return timezoneFieldError(PrefTimezone).Message
+	}
+	return ""
+}
+
+// validateChannelsPreference takes a list of distinct channels
+func validateChannelsPreference(_ context.Context, _ *Dependencies, value json.RawMessage) string {
+	var channels []string
+	if err := json.Unmarshal(value, &channels); err != nil || channels == nil {
+		return "Must be a list of channels"
+	}
+	seen := make(map[string]bool)
+	for _, ch := range channels {
+		if !preferenceChannels[ch] {
+			return "Channels must be email, push or browser"
+		}
+		if seen[ch] {
+			return ch + " is listed more than once"
+		}
+		seen[ch] = true
+	}
+	return ""
+}
+
+// validateDefaultDIDPreference takes the ID of an existing DID
+func validateDefaultDIDPreference(ctx context.Context, deps *Dependencies, value json.RawMessage) string {
+	var id int64
+	if err := json.Unmarshal(value, &id); err != nil || id <= 0 {
+		return "Must be a DID ID"
+	}
+	if _, err := deps.DB.DIDs.GetByID(ctx, id); err != nil {
+		if err == db.ErrDIDNotFound {
+			return "DID not found"
+		}
+		return "DID could not be checked"
+	}
+	return ""
+}
+
+// validateTableColumnsPreference takes the visible columns of each table, in
+// display order, such as {"calls": ["started_at", "from", "duration"]}
+func validateTableColumnsPreference(_ context.Context, _ *Dependencies, value json.RawMessage) string {
+	var tables map[string][]string
+	if err := json.Unmarshal(value, &tables); err != nil || tables == nil {
+		return "Must map table names to lists of columns"
+	}
+	if len(tables) > config.PreferenceMaxTables {
+		return fmt.Sprintf("At most %d tables are allowed", config.PreferenceMaxTables)
+	}
+	for table, columns := range tables {
+		if !preferenceName.MatchString(table) {
+			return table + " is not a valid table name"
+		}
+		if len(columns) > config.PreferenceMaxColumns {
+			return fmt.Sprintf("%s has more than %d columns", table, config.PreferenceMaxColumns)
+		}
+		seen := make(map[string]bool)
+		for _, column := range columns {
+			if !preferenceName.MatchString(column) || seen[column] {
+				return table + " has an invalid or repeated column " + strconv.Quote(column)
+			}
+			seen[column] = true
+		}
+	}
+	return ""
+}
+
+// PreferenceHandler handles per-user UI and API preferences, so settings
+// follow a user across browsers
+type PreferenceHandler struct {
+	deps *Dependencies
+}
+
+// NewPreferenceHandler creates a new PreferenceHandler
+func NewPreferenceHandler(deps *Dependencies) *PreferenceHandler {
+	return &PreferenceHandler{deps: deps}
+}
+
+// preferenceUser returns the user in the URL if the current user may see
+// their preferences: users their own, admins anyone's. It writes the error
+// response and returns nil otherwise.
+func (h *PreferenceHandler) preferenceUser(w http.ResponseWriter, r *http.Request) *models.User {
+	current := GetUserFromContext(r.Context())
+	if current == nil {
+		WriteUnauthorizedError(w)
+		return nil
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid user ID", nil)
+		return nil
+	}
+	if id != current.ID && current.Role != "admin" {
+		WriteForbiddenError(w)
+		return nil
+	}
+
+	user, err := h.deps.DB.Users.GetByID(r.Context(), id)
+	if err != nil {
+		if err == db.ErrUserNotFound {
+			WriteNotFoundError(w, "User")
+			return nil
+		}
+		WriteInternalError(w)
+		return nil
+	}
+	return user
+}
+
+// writePreferences responds with a user's saved preferences
+func (h *PreferenceHandler) writePreferences(w http.ResponseWriter, r *http.Request, userID int64) {
+	prefs, err := h.deps.DB.UserPreferences.Get(r.Context(), userID)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, prefs)
+}
+
+// Get returns a user's saved preferences
+func (h *PreferenceHandler) Get(w http.ResponseWriter, r *http.Request) {
+	user := h.preferenceUser(w, r)
+	if user == nil {
+		return
+	}
+
+	h.writePreferences(w, r, user.ID)
+}
+
+// Update saves the preferences in the request body. Keys not in the body
+// keep their value, and a null value removes the preference.
+func (h *PreferenceHandler) Update(w http.ResponseWriter, r *http.Request) {
+	user := h.preferenceUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var req map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req == nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	set := make(map[string]json.RawMessage)
+	var remove []string
+	var fieldErrors []FieldError
+	for key, value := range req {
+		validate, ok := preferenceSchema[key]
+		if !ok {
+			fieldErrors = append(fieldErrors, FieldError{Field: key, Message: "Unknown preference"})
+			continue
+		}
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			remove = append(remove, key)
+			continue
+		}
+		if len(value) > config.PreferenceMaxBytes {
+			fieldErrors = append(fieldErrors, FieldError{Field: key, Message: fmt.Sprintf("Must be at most %d bytes", config.PreferenceMaxBytes)})
+			continue
+		}
+		if msg := validate(r.Context(), h.deps, value); msg != "" {
+			fieldErrors = append(fieldErrors, FieldError{Field: key, Message: msg})
+			continue
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, value); err != nil {
+			fieldErrors = append(fieldErrors, FieldError{Field: key, Message: "Invalid JSON"})
+			continue
+		}
+		set[key] = compact.Bytes()
+	}
+	if len(fieldErrors) > 0 {
+		WriteValidationError(w, "Validation failed", fieldErrors)
+		return
+	}
+
+	if err := h.deps.DB.UserPreferences.Update(r.Context(), user.ID, set, remove); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	h.writePreferences(w, r, user.ID)
+}
+
+// Delete removes one preference, going back to the UI's default
+func (h *PreferenceHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	user := h.preferenceUser(w, r)
+	if user == nil {
+		return
+	}
+
+	key := chi.URLParam(r, "key")
+	if _, ok := preferenceSchema[key]; !ok {
+		WriteNotFoundError(w, "Preference")
+		return
+	}
+	if err := h.deps.DB.UserPreferences.Update(r.Context(), user.ID, nil, []string{key}); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	h.writePreferences(w, r, user.ID)
+}
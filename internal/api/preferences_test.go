@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestPreferenceHandler(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewPreferenceHandler(&Dependencies{DB: setup.DB})
+	user := createTestUser(t, setup.DB, "user@example.com", "password123", "user")
+	other := createTestUser(t, setup.DB, "other@example.com", "password123", "user")
+	admin := createTestUser(t, setup.DB, "admin@example.com", "password123", "admin")
+	did := createTestDID(t, setup.DB, "+15551234567")
+
+	call := func(method, path string, as *models.User, params map[string]string, body string, fn http.HandlerFunc) *httptest.ResponseRecorder {
+		t.Helper()
+		req := withURLParams(httptest.NewRequest(method, path, strings.NewReader(body)), params)
+		req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, as))
+		rr := httptest.NewRecorder()
+		fn(rr, req)
+		return rr
+	}
+	own := map[string]string{"id": "1"}
+
+	rr := call(http.MethodPut, "/api/users/1/preferences", user, own, `{
+		"timezone": "America/Denver",
+		"notification_channels": ["email", "browser"],
+		"default_did": 1,
+		"table_columns": {"calls": ["started_at", "from", "duration"]}
+	}`, handler.Update)
+	assertStatus(t, rr, http.StatusOK)
+	var prefs map[string]interface{}
+	decodeResponse(t, rr, &prefs)
+	if prefs["timezone"] != "America/Denver" || prefs["default_did"] != float64(did.ID) || len(prefs) != 4 {
+		t.Errorf("Unexpected preferences %v", prefs)
+	}
+
+	// Invalid values are all reported and nothing is saved
+	rr = call(http.MethodPut, "/api/users/1/preferences", user, own, `{
+		"timezone": "Mars/Olympus",
+		"notification_channels": ["email", "email"],
+		"default_did": 99,
+		"table_columns": {"Calls": []},
+		"theme": "dark"
+	}`, handler.Update)
+	assertStatus(t, rr, http.StatusBadRequest)
+	var errResp ErrorResponse
+	decodeResponse(t, rr, &errResp)
+	if len(errResp.Error.Details) != 5 {
+		t.Errorf("Expected an error for each preference, got %+v", errResp.Error.Details)
+	}
+
+	// Null removes a preference and leaves the rest
+	rr = call(http.MethodPut, "/api/users/1/preferences", user, own, `{"timezone": null}`, handler.Update)
+	assertStatus(t, rr, http.StatusOK)
+	prefs = nil
+	decodeResponse(t, rr, &prefs)
+	if _, ok := prefs["timezone"]; ok || len(prefs) != 3 {
+		t.Errorf("Expected the timezone removed, got %v", prefs)
+	}
+
+	rr = call(http.MethodDelete, "/api/users/1/preferences/table_columns", user, map[string]string{"id": "1", "key": "table_columns"}, "", handler.Delete)
+	assertStatus(t, rr, http.StatusOK)
+	assertStatus(t, call(http.MethodDelete, "/api/users/1/preferences/theme", user, map[string]string{"id": "1", "key": "theme"}, "", handler.Delete), http.StatusNotFound)
+
+	// Users only see their own preferences, admins see anyone's
+	assertStatus(t, call(http.MethodGet, "/api/users/1/preferences", other, own, "", handler.Get), http.StatusForbidden)
+	rr = call(http.MethodGet, "/api/users/1/preferences", admin, own, "", handler.Get)
+	assertStatus(t, rr, http.StatusOK)
+	prefs = nil
+	decodeResponse(t, rr, &prefs)
+	if len(prefs) != 2 {
+		t.Errorf("Expected two preferences left, got %v", prefs)
+	}
+	assertStatus(t, call(http.MethodGet, "/api/users/99/preferences", admin, map[string]string{"id": "99"}, "", handler.Get), http.StatusNotFound)
+
+	rr = call(http.MethodGet, "/api/users/2/preferences", other, map[string]string{"id": "2"}, "", handler.Get)
+	assertStatus(t, rr, http.StatusOK)
+	if body := strings.TrimSpace(rr.Body.String()); body != "{}" {
+		t.Errorf("Expected no preferences for a new user, got %s", body)
+	}
+}
@@ -2,17 +2,23 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
+	"github.com/btafoya/gosip/internal/config"
 	"github.com/btafoya/gosip/internal/db"
 	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/pkg/sip"
 	"github.com/go-chi/chi/v5"
 	qrcode "github.com/yeqown/go-qrcode/v2"
 	"github.com/yeqown/go-qrcode/writer/standard"
@@ -31,11 +37,15 @@ func respondError(w http.ResponseWriter, statusCode int, code, message string) {
 // ProvisioningHandler handles provisioning-related endpoints
 type ProvisioningHandler struct {
 	deps *Dependencies
+
+	// misses counts responder requests for unknown files per client
+	missMu sync.Mutex
+	misses map[string]*responderMisses
 }
 
 // NewProvisioningHandler creates a new ProvisioningHandler
 func NewProvisioningHandler(deps *Dependencies) *ProvisioningHandler {
-	return &ProvisioningHandler{deps: deps}
+	return &ProvisioningHandler{deps: deps, misses: make(map[string]*responderMisses)}
 }
 
 // ProvisionDevice handles device provisioning request
@@ -46,30 +56,50 @@ func (h *ProvisioningHandler) ProvisionDevice(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	h.provision(w, r, req)
+}
+
+// provision creates a device from a provisioning request and writes the
+// provisioning response, returning the device or nil when the request failed
+func (h *ProvisioningHandler) provision(w http.ResponseWriter, r *http.Request, req models.ProvisioningRequest) *models.Device {
 	// Validate required fields
-	if req.DeviceName == "" || req.Username == "" || req.Password == "" {
+	if req.DeviceName == "" || req.Username == "" || (req.Password == "" && !req.GeneratePassword) {
 		respondError(w, http.StatusBadRequest, "MISSING_FIELDS", "Device name, username, and password are required")
-		return
+		return nil
 	}
 
 	// Check if username already exists
 	existing, _ := h.deps.DB.Devices.GetByUsername(r.Context(), req.Username)
 	if existing != nil {
 		respondError(w, http.StatusConflict, "USERNAME_EXISTS", "A device with this username already exists")
-		return
+		return nil
+	}
+
+	var generated string
+	if req.Password == "" {
+		password, err := generateDevicePassword(r.Context(), h.deps)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "PASSWORD_ERROR", "Failed to generate password")
+			return nil
+		}
+		req.Password = password
+		generated = password
 	}
 
 	// Hash the password
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "PASSWORD_ERROR", "Failed to process password")
-		return
+		return nil
 	}
 
 	// Create the device
 	device := &models.Device{
 		Name:               req.DeviceName,
 		Username:           req.Username,
+		CallWaiting:        true,
+		ComfortNoise:       true,
+		AnonymousCalls:     true,
 		PasswordHash:       string(passwordHash),
 		DeviceType:         req.DeviceType,
 		UserID:             req.UserID,
@@ -81,7 +111,7 @@ func (h *ProvisioningHandler) ProvisionDevice(w http.ResponseWriter, r *http.Req
 
 	if err := h.deps.DB.Devices.Create(r.Context(), device); err != nil {
 		respondError(w, http.StatusInternalServerError, "DB_ERROR", "Failed to create device")
-		return
+		return nil
 	}
 
 	// Log the provisioning event
@@ -92,9 +122,10 @@ func (h *ProvisioningHandler) ProvisionDevice(w http.ResponseWriter, r *http.Req
 
 	// Build response
 	response := models.ProvisioningResponse{
-		Device:    device,
-		SIPServer: h.deps.Config.SIPDomain,
-		SIPPort:   h.deps.Config.SIPPort,
+		Device:            device,
+		SIPServer:         h.deps.Config.SIPDomain,
+		SIPPort:           h.deps.Config.SIPPort,
+		GeneratedPassword: generated,
 	}
 
 	// Generate provisioning URL if requested
@@ -121,7 +152,7 @@ func (h *ProvisioningHandler) ProvisionDevice(w http.ResponseWriter, r *http.Req
 		} else {
 			response.Token = token.Token
 			response.TokenExpiresAt = token.ExpiresAt.Format(time.RFC3339)
-			response.ProvisioningURL = fmt.Sprintf("https://%s/provision/%s", h.deps.Config.SIPDomain, token.Token)
+			response.ProvisioningURL = publicBaseURL(r.Context(), h.deps) + "/provision/" + token.Token
 		}
 	}
 
@@ -129,6 +160,7 @@ func (h *ProvisioningHandler) ProvisionDevice(w http.ResponseWriter, r *http.Req
 	response.ConfigInstructions = h.generateConfigInstructions(req.Vendor, device, response.SIPServer, response.SIPPort)
 
 	respondJSON(w, http.StatusCreated, response)
+	return device
 }
 
 // GetDeviceConfig serves the provisioning configuration for a device via token
@@ -164,43 +196,62 @@ func (h *ProvisioningHandler) GetDeviceConfig(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	// Log the config fetch event
-	h.deps.DB.DeviceEvents.LogEvent(r.Context(), device.ID, "config_fetch", map[string]interface{}{
+	config, contentType, err := h.renderDeviceConfig(r.Context(), device, map[string]interface{}{
 		"token_id": token.ID,
 	}, r.RemoteAddr, r.UserAgent())
+	if errors.Is(err, errNoProfile) {
+		respondError(w, http.StatusNotFound, "NO_PROFILE", "No provisioning profile found for this device")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "CONFIG_ERROR", "Failed to generate configuration")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(config))
+}
+
+// errNoProfile is returned when no provisioning profile matches a device
+var errNoProfile = errors.New("no provisioning profile found for this device")
+
+// renderDeviceConfig generates the configuration a device fetches, logging the
+// fetch with the given event data and marking the device provisioned
+func (h *ProvisioningHandler) renderDeviceConfig(ctx context.Context, device *models.Device, fetch map[string]interface{}, remoteAddr, userAgent string) (string, string, error) {
+	// Log the config fetch event
+	h.deps.DB.DeviceEvents.LogEvent(ctx, device.ID, "config_fetch", fetch, remoteAddr, userAgent)
 
 	// Update device's last config fetch time
-	h.deps.DB.Devices.UpdateLastConfigFetch(r.Context(), device.ID)
+	h.deps.DB.Devices.UpdateLastConfigFetch(ctx, device.ID)
 
 	// Get the provisioning profile
 	var profile *models.ProvisioningProfile
 	if device.Vendor != nil {
 		if device.Model != nil {
-			profile, _ = h.deps.DB.ProvisioningProfiles.GetByVendorModel(r.Context(), *device.Vendor, *device.Model)
+			profile, _ = h.deps.DB.ProvisioningProfiles.GetByVendorModel(ctx, *device.Vendor, *device.Model)
 		}
 		if profile == nil {
-			profile, _ = h.deps.DB.ProvisioningProfiles.GetDefaultForVendor(r.Context(), *device.Vendor)
+			profile, _ = h.deps.DB.ProvisioningProfiles.GetDefaultForVendor(ctx, *device.Vendor)
 		}
 	}
 
 	if profile == nil {
-		respondError(w, http.StatusNotFound, "NO_PROFILE", "No provisioning profile found for this device")
-		return
+		return "", "", errNoProfile
 	}
 
 	// Generate the config from template
-	config, err := h.generateConfig(profile, device)
+	config, err := h.generateConfig(ctx, profile, device)
 	if err != nil {
-		h.deps.DB.DeviceEvents.LogEvent(r.Context(), device.ID, "config_fetch_failed", map[string]interface{}{
+		h.deps.DB.DeviceEvents.LogEvent(ctx, device.ID, "config_fetch_failed", map[string]interface{}{
 			"error": err.Error(),
-		}, r.RemoteAddr, r.UserAgent())
-		respondError(w, http.StatusInternalServerError, "CONFIG_ERROR", "Failed to generate configuration")
-		return
+		}, remoteAddr, userAgent)
+		return "", "", err
 	}
 
 	// Update provisioning status
-	h.deps.DB.Devices.UpdateProvisioningStatus(r.Context(), device.ID, "provisioned")
-	h.deps.DB.DeviceEvents.LogEvent(r.Context(), device.ID, "provision_complete", nil, r.RemoteAddr, r.UserAgent())
+	h.deps.DB.Devices.UpdateProvisioningStatus(ctx, device.ID, "provisioned")
+	h.deps.DB.DeviceEvents.LogEvent(ctx, device.ID, "provision_complete", nil, remoteAddr, userAgent)
 
 	// Determine content type based on profile vendor
 	contentType := "application/xml"
@@ -214,13 +265,11 @@ func (h *ProvisioningHandler) GetDeviceConfig(w http.ResponseWriter, r *http.Req
 		}
 	}
 
-	w.Header().Set("Content-Type", contentType)
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(config))
+	return config, contentType, nil
 }
 
 // generateConfig generates a device configuration from a template
-func (h *ProvisioningHandler) generateConfig(profile *models.ProvisioningProfile, device *models.Device) (string, error) {
+func (h *ProvisioningHandler) generateConfig(ctx context.Context, profile *models.ProvisioningProfile, device *models.Device) (string, error) {
 	// Parse the template
 	tmpl, err := template.New("config").Parse(profile.ConfigTemplate)
 	if err != nil {
@@ -228,8 +277,9 @@ func (h *ProvisioningHandler) generateConfig(profile *models.ProvisioningProfile
 	}
 
 	// Prepare template variables
+	plan := h.dialPlan(ctx, device.TenantID)
 	vars := map[string]interface{}{
-		"SIPServer":     h.deps.Config.SIPDomain,
+		"SIPServer":     h.sipDomain(ctx, device),
 		"SIPPort":       strconv.Itoa(h.deps.Config.SIPPort),
 		"AuthID":        device.Username,
 		"AuthPassword":  "", // We don't store plaintext passwords, device needs to be configured manually for password
@@ -239,6 +289,17 @@ func (h *ProvisioningHandler) generateConfig(profile *models.ProvisioningProfile
 		"NTPServer":     "pool.ntp.org",
 		"Timezone":      "America/New_York",
 		"AdminPassword": "", // Should be set by user
+
+		// Distinctive ring: map Alert-Info classes to ring tones
+		"AlertInfoInternal": sip.RingClassInternal,
+		"AlertInfoExternal": sip.RingClassExternal,
+		"AlertInfoVIP":      sip.RingClassVIP,
+		"DistinctiveRings":  h.distinctiveRings(ctx, profile.Vendor),
+
+		// Dial plan: internal numbers dial at once, others after a pause
+		"DigitMap":        plan.DigitMap(profile.Vendor),
+		"DialNow":         plan.DialNow(),
+		"DigitMapTimeout": int(config.DigitMapTimeout.Seconds()),
 	}
 
 	// Merge with profile variables if any
@@ -262,6 +323,83 @@ func (h *ProvisioningHandler) generateConfig(profile *models.ProvisioningProfile
 	return buf.String(), nil
 }
 
+// sipDomain returns the SIP domain a device signs in to: its tenant's
+// when the tenant has one
+func (h *ProvisioningHandler) sipDomain(ctx context.Context, device *models.Device) string {
+	if device.TenantID != nil {
+		if tenant, err := h.deps.DB.Tenants.GetByID(ctx, *device.TenantID); err == nil && tenant.SIPDomain != "" {
+			return tenant.SIPDomain
+		}
+	}
+	return h.deps.Config.SIPDomain
+}
+
+// dialPlan returns the numbering plan the SIP server interprets dialed
+// digits with for a tenant's devices
+func (h *ProvisioningHandler) dialPlan(ctx context.Context, tenantID *int64) sip.DialPlan {
+	extensions, _ := h.deps.DB.Devices.ListExtensions(ctx, tenantID)
+	settings := h.deps.DB.Config
+	return sip.DialPlan{
+		Extensions:      extensions,
+		FeatureCodes:    []string{settings.GetWithDefault(ctx, "voicemail_greeting_feature_code", config.DefaultGreetingFeatureCode)},
+		IntercomPrefix:  settings.GetWithDefault(ctx, "intercom_prefix", config.DefaultIntercomPrefix),
+		DIDSelectPrefix: settings.GetWithDefault(ctx, "did_select_prefix", config.DefaultDIDSelectPrefix),
+	}
+}
+
+// DistinctiveRing maps an Alert-Info ring class to a ring tone in provisioning templates
+type DistinctiveRing struct {
+	Index     int    // 1-based position, for numbered config keys
+	Class     string // Text phones match against the Alert-Info info parameter
+	AlertInfo string // Full Alert-Info header value GoSIP sends
+	Ringtone  string // Vendor-specific ring tone identifier
+}
+
+// distinctiveRings lists the built-in ring classes followed by those used by
+// caller lists. Ring tone 1 is left as the phone's normal ring.
+func (h *ProvisioningHandler) distinctiveRings(ctx context.Context, vendor string) []DistinctiveRing {
+	classes := []string{sip.RingClassInternal, sip.RingClassExternal, sip.RingClassVIP}
+	if lists, err := h.deps.DB.CallerLists.List(ctx); err == nil {
+		for _, list := range lists {
+			classes = append(classes, list.AlertInfo)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var rings []DistinctiveRing
+	for _, class := range classes {
+		if seen[class] {
+			continue
+		}
+		seen[class] = true
+		index := len(rings) + 1
+		rings = append(rings, DistinctiveRing{
+			Index:     index,
+			Class:     class,
+			AlertInfo: sip.AlertInfoValue(class),
+			Ringtone:  vendorRingtone(vendor, index+1),
+		})
+	}
+	return rings
+}
+
+// vendorRingtone returns how a vendor's config names its nth ring tone
+func vendorRingtone(vendor string, n int) string {
+	switch strings.ToLower(vendor) {
+	case "yealink":
+		// Ring1.wav through Ring8.wav ship with the phone
+		return fmt.Sprintf("Ring%d.wav", (n-1)%8+1)
+	case "polycom":
+		// Ringer classes ringer1 through ringer24
+		return fmt.Sprintf("ringer%d", (n-1)%24+1)
+	case "grandstream":
+		// Custom ring tones 1 through 3
+		return strconv.Itoa((n-1)%3 + 1)
+	default:
+		return strconv.Itoa(n)
+	}
+}
+
 // generateConfigInstructions generates setup instructions for a device
 func (h *ProvisioningHandler) generateConfigInstructions(vendor string, device *models.Device, sipServer string, sipPort int) string {
 	switch strings.ToLower(vendor) {
@@ -520,7 +658,7 @@ func (h *ProvisioningHandler) CreateToken(w http.ResponseWriter, r *http.Request
 
 	response := map[string]interface{}{
 		"token":            token,
-		"provisioning_url": fmt.Sprintf("https://%s/provision/%s", h.deps.Config.SIPDomain, token.Token),
+		"provisioning_url": publicBaseURL(r.Context(), h.deps) + "/provision/" + token.Token,
 	}
 
 	respondJSON(w, http.StatusCreated, response)
@@ -552,7 +690,16 @@ func (h *ProvisioningHandler) GetTokenQRCode(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Build the provisioning URL
-	provisioningURL := fmt.Sprintf("https://%s/provision/%s", h.deps.Config.SIPDomain, tokenStr)
+	provisioningURL := publicBaseURL(r.Context(), h.deps) + "/provision/" + tokenStr
+
+	// Softphone apps get a deep link that opens the app and fetches the
+	// configuration straight away
+	app := r.URL.Query().Get("app")
+	qrContent, err := softphoneDeepLink(app, provisioningURL)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "INVALID_APP", err.Error())
+		return
+	}
 
 	// Check format param - can be "png" (image) or "base64" (data URL)
 	format := r.URL.Query().Get("format")
@@ -561,7 +708,7 @@ func (h *ProvisioningHandler) GetTokenQRCode(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Generate QR code
-	qrData, contentType, err := generateQRCode(provisioningURL, format)
+	qrData, contentType, err := generateQRCode(qrContent, format)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "QR_ERROR", "Failed to generate QR code")
 		return
@@ -573,15 +720,43 @@ func (h *ProvisioningHandler) GetTokenQRCode(w http.ResponseWriter, r *http.Requ
 		w.WriteHeader(http.StatusOK)
 		w.Write(qrData)
 	} else {
-		respondJSON(w, http.StatusOK, map[string]interface{}{
+		response := map[string]interface{}{
 			"qr_code":          string(qrData),
 			"provisioning_url": provisioningURL,
 			"token":            tokenStr,
 			"expires_at":       token.ExpiresAt.Format(time.RFC3339),
-		})
+			"remaining_uses":   token.MaxUses - token.UsedCount,
+		}
+		if qrContent != provisioningURL {
+			response["app"] = app
+			response["deep_link"] = qrContent
+		}
+		respondJSON(w, http.StatusOK, response)
 	}
 }
 
+// Softphone apps with provisioning deep links
+const (
+	SoftphoneAppLinphone = "linphone"
+	SoftphoneAppZoiper   = "zoiper"
+)
+
+// softphoneDeepLink returns what a provisioning QR code encodes for an app:
+// a link that opens it and loads the configuration at provisioningURL, or
+// the URL itself when no app is given
+func softphoneDeepLink(app, provisioningURL string) (string, error) {
+	switch app {
+	case "", "https":
+		return provisioningURL, nil
+	case SoftphoneAppLinphone:
+		// Linphone fetches linphone-config://host/path over HTTPS
+		return "linphone-config://" + strings.TrimPrefix(provisioningURL, "https://"), nil
+	case SoftphoneAppZoiper:
+		return "zoiper://provision?url=" + url.QueryEscape(provisioningURL), nil
+	}
+	return "", fmt.Errorf("unsupported app %q, must be %s or %s", app, SoftphoneAppLinphone, SoftphoneAppZoiper)
+}
+
 // nopCloser wraps an io.Writer with a no-op Close method
 type nopCloser struct {
 	*bytes.Buffer
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestSoftphoneDeepLink(t *testing.T) {
+	const provisioningURL = "https://sip.example.com/provision/abc123"
+
+	tests := []struct {
+		app  string
+		want string
+	}{
+		{"", provisioningURL},
+		{"https", provisioningURL},
+		{"linphone", "linphone-config://sip.example.com/provision/abc123"},
+		{"zoiper", "zoiper://provision?url=https%3A%2F%2Fsip.example.com%2Fprovision%2Fabc123"},
+	}
+	for _, tt := range tests {
+		got, err := softphoneDeepLink(tt.app, provisioningURL)
+		if err != nil || got != tt.want {
+			t.Errorf("softphoneDeepLink(%q) = %q, %v; want %q", tt.app, got, err, tt.want)
+		}
+	}
+
+	if _, err := softphoneDeepLink("skype", provisioningURL); err == nil {
+		t.Error("Expected an unknown app to be rejected")
+	}
+}
+
+func TestProvisioningHandler_GetTokenQRCode_App(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewProvisioningHandler(&Dependencies{DB: setup.DB, Config: &config.Config{SIPDomain: "sip.example.com"}})
+
+	device := createTestDevice(t, setup.DB, "Phone", "alice")
+	token := &models.ProvisioningToken{DeviceID: device.ID, ExpiresAt: time.Now().Add(time.Hour), MaxUses: 1}
+	if err := setup.DB.ProvisioningTokens.Create(context.Background(), token); err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	params := map[string]string{"token": token.Token}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/provisioning/tokens/x/qrcode?app=linphone", nil)
+	rr := httptest.NewRecorder()
+	handler.GetTokenQRCode(rr, withURLParams(req, params))
+	assertStatus(t, rr, http.StatusOK)
+
+	var resp struct {
+		DeepLink      string `json:"deep_link"`
+		RemainingUses int    `json:"remaining_uses"`
+	}
+	decodeResponse(t, rr, &resp)
+	if resp.DeepLink != "linphone-config://sip.example.com/provision/"+token.Token || resp.RemainingUses != 1 {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/provisioning/tokens/x/qrcode?app=skype", nil)
+	rr = httptest.NewRecorder()
+	handler.GetTokenQRCode(rr, withURLParams(req, params))
+	assertStatus(t, rr, http.StatusBadRequest)
+}
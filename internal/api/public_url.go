@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/publicurl"
+)
+
+// PublicURLHandler manages the public base URL links, QR codes and Twilio
+// webhooks are built from
+type PublicURLHandler struct {
+	deps *Dependencies
+}
+
+// NewPublicURLHandler creates a new PublicURLHandler
+func NewPublicURLHandler(deps *Dependencies) *PublicURLHandler {
+	return &PublicURLHandler{deps: deps}
+}
+
+// PublicURLResponse reports the public base URL, where it is set and its
+// last check
+type PublicURLResponse struct {
+	URL    string            `json:"url"`
+	Source string            `json:"source"` // env, file, database or default
+	Pinned bool              `json:"pinned"` // Set by the config file or environment
+	Report *publicurl.Report `json:"report,omitempty"`
+}
+
+// UpdatePublicURLRequest sets the public base URL
+type UpdatePublicURLRequest struct {
+	URL   string `json:"url"`   // Empty clears it
+	Force bool   `json:"force"` // Save even when the DNS, TLS or reachability check fails
+}
+
+// available writes an error and returns false when the public URL monitor
+// isn't running
+func (h *PublicURLHandler) available(w http.ResponseWriter) bool {
+	if h.deps.PublicURL == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Public URL checks are not available", nil)
+		return false
+	}
+	return true
+}
+
+// response describes the current public base URL with a report
+func (h *PublicURLHandler) response(r *http.Request, report *publicurl.Report) PublicURLResponse {
+	resp := PublicURLResponse{
+		URL:    publicurl.Get(r.Context(), h.deps.Config, h.deps.DB),
+		Source: config.SourceDefault,
+		Report: report,
+	}
+	if h.deps.Config != nil {
+		if s, ok := h.deps.Config.PinnedSettings()[publicurl.SettingKey]; ok {
+			resp.Source = s.Source
+			resp.Pinned = true
+			return resp
+		}
+	}
+	if value, err := h.deps.DB.Config.Get(r.Context(), publicurl.SettingKey); err == nil && value != "" {
+		resp.Source = config.SourceDatabase
+	}
+	return resp
+}
+
+// Get returns the public base URL and its last check (admin only)
+func (h *PublicURLHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	report := h.deps.PublicURL.Report()
+	if report == nil {
+		report = h.deps.PublicURL.Check(r.Context())
+	}
+	WriteJSON(w, http.StatusOK, h.response(r, report))
+}
+
+// Update validates and saves the public base URL. A URL that fails a check
+// is only saved with force (admin only).
+func (h *PublicURLHandler) Update(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	var req UpdatePublicURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	if h.deps.Config != nil {
+		if _, pinned := h.deps.Config.PinnedSettings()[publicurl.SettingKey]; pinned {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "The public base URL is set by the config file or environment", nil)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	base := strings.TrimRight(strings.TrimSpace(req.URL), "/")
+	if base == "" {
+		if err := h.deps.DB.Config.Delete(ctx, publicurl.SettingKey); err != nil {
+			WriteInternalError(w)
+			return
+		}
+	} else {
+		if _, err := publicurl.Parse(base); err != nil {
+			WriteValidationError(w, "Validation failed", []FieldError{{Field: "url", Message: err.Error()}})
+			return
+		}
+		var failed []FieldError
+		for _, check := range h.deps.PublicURL.Validate(ctx, base) {
+			if check.Status == publicurl.CheckFail {
+				failed = append(failed, FieldError{Field: "url", Message: check.Detail})
+			}
+		}
+		if len(failed) > 0 && !req.Force {
+			WriteValidationError(w, "The public base URL failed its checks. Fix them or save with force.", failed)
+			return
+		}
+		if err := h.deps.DB.Config.Set(ctx, publicurl.SettingKey, base); err != nil {
+			WriteInternalError(w)
+			return
+		}
+	}
+
+	slog.Info("Public base URL changed", "url", base, "forced", req.Force)
+	h.deps.PublicURL.ForgetWebhooks()
+	WriteJSON(w, http.StatusOK, h.response(r, h.deps.PublicURL.Check(ctx)))
+}
+
+// Check checks the public base URL now (admin only)
+func (h *PublicURLHandler) Check(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	WriteJSON(w, http.StatusOK, h.response(r, h.deps.PublicURL.Check(r.Context())))
+}
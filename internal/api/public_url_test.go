@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/publicurl"
+)
+
+func TestPublicURLHandler(t *testing.T) {
+	setup := setupTestAPI(t)
+	ctx := context.Background()
+
+	rr := httptest.NewRecorder()
+	NewPublicURLHandler(&Dependencies{DB: setup.DB}).Get(rr, httptest.NewRequest(http.MethodGet, "/api/system/public-url", nil))
+	assertStatus(t, rr, http.StatusServiceUnavailable)
+
+	cfg := &config.Config{SIPDomain: "sip.example.com"}
+	deps := &Dependencies{DB: setup.DB, Config: cfg, PublicURL: publicurl.NewMonitor(cfg, setup.DB, nil)}
+	handler := NewPublicURLHandler(deps)
+	update := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.Update(rr, httptest.NewRequest(http.MethodPut, "/api/system/public-url", strings.NewReader(body)))
+		return rr
+	}
+
+	// Links fall back to the SIP domain until a public base URL is set
+	if got := publicBaseURL(ctx, deps); got != "https://sip.example.com" {
+		t.Errorf("publicBaseURL = %q, want the SIP domain", got)
+	}
+
+	assertStatus(t, update(`{"url": "pbx.example.com"}`), http.StatusBadRequest)
+
+	// A loopback address fails the DNS check and is only saved with force
+	rr = update(`{"url": "http://127.0.0.1:1/"}`)
+	assertStatus(t, rr, http.StatusBadRequest)
+	var errResp ErrorResponse
+	decodeResponse(t, rr, &errResp)
+	if len(errResp.Error.Details) != 1 || !strings.Contains(errResp.Error.Details[0].Message, "can't reach") {
+		t.Errorf("Expected the DNS failure reported, got %+v", errResp.Error.Details)
+	}
+	if _, err := setup.DB.Config.Get(ctx, publicurl.SettingKey); err == nil {
+		t.Error("Expected nothing saved")
+	}
+
+	rr = update(`{"url": "http://127.0.0.1:1/", "force": true}`)
+	assertStatus(t, rr, http.StatusOK)
+	var resp PublicURLResponse
+	decodeResponse(t, rr, &resp)
+	if resp.URL != "http://127.0.0.1:1" || resp.Source != config.SourceDatabase || resp.Report == nil || resp.Report.OK {
+		t.Errorf("Expected the URL saved with a failing report, got %+v", resp)
+	}
+	if got := publicBaseURL(ctx, deps); got != "http://127.0.0.1:1" {
+		t.Errorf("publicBaseURL = %q, want the saved URL", got)
+	}
+
+	assertStatus(t, update(`{"url": ""}`), http.StatusOK)
+	if got := publicBaseURL(ctx, deps); got != "https://sip.example.com" {
+		t.Errorf("publicBaseURL = %q, want the SIP domain again", got)
+	}
+
+	// GOSIP_PUBLIC_URL pins the setting
+	t.Setenv("GOSIP_PUBLIC_URL", "https://env.example.com")
+	pinned, err := config.LoadFile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deps.Config = pinned
+	assertStatus(t, update(`{"url": "https://pbx.example.com"}`), http.StatusConflict)
+	rr = httptest.NewRecorder()
+	handler.Get(rr, httptest.NewRequest(http.MethodGet, "/api/system/public-url", nil))
+	assertStatus(t, rr, http.StatusOK)
+	resp = PublicURLResponse{}
+	decodeResponse(t, rr, &resp)
+	if resp.URL != "https://env.example.com" || !resp.Pinned || resp.Source != config.SourceEnv {
+		t.Errorf("Expected the pinned URL, got %+v", resp)
+	}
+}
+
+func TestWebhookHandler_ValidateSignature_PublicURL(t *testing.T) {
+	setup := setupTestAPI(t)
+	ctx := context.Background()
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+	form := url.Values{"CallSid": {"CA123"}}
+
+	sign := func(target string) string {
+		signed := target + "CallSid" + "CA123"
+		mac := hmac.New(sha1.New, []byte("test-auth-token"))
+		mac.Write([]byte(signed))
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	// Behind a TLS-terminating proxy the request arrives over http on an
+	// internal address, but Twilio signed the public URL
+	req := newSignedWebhookRequest(t, setup.DB, "/api/webhooks/voice/status", form)
+	req.Header.Set("X-Twilio-Signature", sign("https://pbx.example.com/api/webhooks/voice/status"))
+	if handler.validateSignature(req) {
+		t.Error("Expected the signature rejected without a public base URL")
+	}
+
+	setup.DB.Config.Set(ctx, publicurl.SettingKey, "https://pbx.example.com")
+	req = newSignedWebhookRequest(t, setup.DB, "/api/webhooks/voice/status", form)
+	req.Header.Set("X-Twilio-Signature", sign("https://pbx.example.com/api/webhooks/voice/status"))
+	if !handler.validateSignature(req) {
+		t.Error("Expected a signature for the public base URL accepted")
+	}
+
+	// Requests signed for the address they arrived on still pass
+	req = newSignedWebhookRequest(t, setup.DB, "/api/webhooks/voice/status", form)
+	if !handler.validateSignature(req) {
+		t.Error("Expected a signature for the request URL accepted")
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// readOnlyExemptPrefixes are API paths that keep accepting changes in
+// read-only mode: signing in and out, Twilio webhooks (calls and messages
+// still have to be handled), the switch that turns the mode off, and log
+// levels and the self-test, which change nothing stored and may be needed to
+// debug an outage.
+var readOnlyExemptPrefixes = []string{"/api/auth/", "/api/webhooks/", "/api/system/read-only", "/api/system/logging", "/api/system/selftest"}
+
+// ReadOnlyMiddleware rejects requests that change data while the server is
+// in read-only mode, either forced by GOSIP_READ_ONLY or turned on by an
+// admin. Reads are always allowed.
+func ReadOnlyMiddleware(deps *Dependencies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+			for _, prefix := range readOnlyExemptPrefixes {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			if isReadOnlyForced(deps) || deps.DB.Config.IsReadOnly(r.Context()) {
+				WriteError(w, http.StatusForbidden, ErrCodeReadOnly,
+					"The server is in read-only mode. Changes are disabled until an administrator turns read-only mode off.", nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isReadOnlyForced reports whether GOSIP_READ_ONLY locks the server in
+// read-only mode
+func isReadOnlyForced(deps *Dependencies) bool {
+	return deps.Config != nil && deps.Config.ReadOnly
+}
+
+// ReadOnlyHandler reports and toggles read-only mode
+type ReadOnlyHandler struct {
+	deps *Dependencies
+}
+
+// NewReadOnlyHandler creates a new ReadOnlyHandler
+func NewReadOnlyHandler(deps *Dependencies) *ReadOnlyHandler {
+	return &ReadOnlyHandler{deps: deps}
+}
+
+// ReadOnlyResponse represents the read-only mode state
+type ReadOnlyResponse struct {
+	Enabled bool `json:"enabled"`
+	Forced  bool `json:"forced"`
+}
+
+func (h *ReadOnlyHandler) status(r *http.Request) ReadOnlyResponse {
+	forced := isReadOnlyForced(h.deps)
+	return ReadOnlyResponse{
+		Enabled: forced || h.deps.DB.Config.IsReadOnly(r.Context()),
+		Forced:  forced,
+	}
+}
+
+// Get returns whether the server is in read-only mode, so UIs can hide
+// editing controls
+func (h *ReadOnlyHandler) Get(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, h.status(r))
+}
+
+// UpdateReadOnlyRequest represents a read-only mode change
+type UpdateReadOnlyRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// Update turns read-only mode on or off (admin only). It can't be turned off
+// while GOSIP_READ_ONLY is set.
+func (h *ReadOnlyHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var req UpdateReadOnlyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	if req.Enabled == nil {
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "enabled", Message: "Enabled is required"},
+		})
+		return
+	}
+
+	if !*req.Enabled && isReadOnlyForced(h.deps) {
+		WriteError(w, http.StatusConflict, ErrCodeConflict,
+			"Read-only mode is set by GOSIP_READ_ONLY and can only be turned off in the server configuration", nil)
+		return
+	}
+
+	if err := h.deps.DB.Config.SetReadOnly(r.Context(), *req.Enabled); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, h.status(r))
+}
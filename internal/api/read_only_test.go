@@ -0,0 +1,124 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+)
+
+func TestReadOnlyMiddleware(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB, Config: &config.Config{}}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := ReadOnlyMiddleware(deps)(ok)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+
+	// Off by default
+	assertStatus(t, serve(http.MethodPost, "/api/dids"), http.StatusOK)
+
+	if err := setup.DB.Config.SetReadOnly(context.Background(), true); err != nil {
+		t.Fatalf("Failed to enable read-only mode: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{"reads allowed", http.MethodGet, "/api/dids", http.StatusOK},
+		{"create rejected", http.MethodPost, "/api/dids", http.StatusForbidden},
+		{"update rejected", http.MethodPut, "/api/system/config", http.StatusForbidden},
+		{"delete rejected", http.MethodDelete, "/api/devices/1", http.StatusForbidden},
+		{"login allowed", http.MethodPost, "/api/auth/login", http.StatusOK},
+		{"webhooks allowed", http.MethodPost, "/api/webhooks/sms/incoming", http.StatusOK},
+		{"toggle allowed", http.MethodPut, "/api/system/read-only", http.StatusOK},
+		{"log levels allowed", http.MethodPut, "/api/system/logging", http.StatusOK},
+		{"self-test allowed", http.MethodPost, "/api/system/selftest", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(tt.method, tt.path)
+			assertStatus(t, rr, tt.want)
+			if tt.want == http.StatusForbidden {
+				assertErrorCode(t, rr, ErrCodeReadOnly)
+			}
+		})
+	}
+}
+
+func TestReadOnlyMiddleware_Forced(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB, Config: &config.Config{ReadOnly: true}}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	rr := httptest.NewRecorder()
+	ReadOnlyMiddleware(deps)(ok).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/dids", nil))
+
+	assertStatus(t, rr, http.StatusForbidden)
+	assertErrorCode(t, rr, ErrCodeReadOnly)
+}
+
+func TestReadOnlyHandler_Update(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB, Config: &config.Config{}}
+	handler := NewReadOnlyHandler(deps)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/system/read-only", bytes.NewBufferString(`{"enabled":true}`))
+	rr := httptest.NewRecorder()
+	handler.Update(rr, req)
+
+	assertStatus(t, rr, http.StatusOK)
+
+	var resp ReadOnlyResponse
+	decodeResponse(t, rr, &resp)
+	if !resp.Enabled || resp.Forced {
+		t.Errorf("Expected enabled and not forced, got %+v", resp)
+	}
+	if !setup.DB.Config.IsReadOnly(context.Background()) {
+		t.Error("Expected read-only mode to be stored")
+	}
+
+	// Missing field
+	req = httptest.NewRequest(http.MethodPut, "/api/system/read-only", bytes.NewBufferString(`{}`))
+	rr = httptest.NewRecorder()
+	handler.Update(rr, req)
+
+	assertStatus(t, rr, http.StatusBadRequest)
+}
+
+func TestReadOnlyHandler_Update_Forced(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB, Config: &config.Config{ReadOnly: true}}
+	handler := NewReadOnlyHandler(deps)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/system/read-only", bytes.NewBufferString(`{"enabled":false}`))
+	rr := httptest.NewRecorder()
+	handler.Update(rr, req)
+
+	assertStatus(t, rr, http.StatusConflict)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/read-only", nil)
+	rr = httptest.NewRecorder()
+	handler.Get(rr, req)
+
+	var resp ReadOnlyResponse
+	decodeResponse(t, rr, &resp)
+	if !resp.Enabled || !resp.Forced {
+		t.Errorf("Expected forced read-only mode, got %+v", resp)
+	}
+}
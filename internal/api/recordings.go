@@ -0,0 +1,153 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/pkg/sip"
+	"github.com/go-chi/chi/v5"
+)
+
+// RecordingHandler handles the API endpoints of server-side call recordings
+type RecordingHandler struct {
+	deps *Dependencies
+}
+
+// NewRecordingHandler creates a new RecordingHandler
+func NewRecordingHandler(deps *Dependencies) *RecordingHandler {
+	return &RecordingHandler{deps: deps}
+}
+
+// List returns recordings, newest first, optionally of one call or CDR
+// GET /api/recordings
+func (h *RecordingHandler) List(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if limit == 0 {
+		limit = config.DefaultPageSize
+	}
+	if limit > config.MaxPageSize {
+		limit = config.MaxPageSize
+	}
+
+	filter := db.RecordingFilter{
+		CallID: r.URL.Query().Get("call_id"),
+		Limit:  limit,
+		Offset: offset,
+	}
+	if cdrIDStr := r.URL.Query().Get("cdr_id"); cdrIDStr != "" {
+		cdrID, err := strconv.ParseInt(cdrIDStr, 10, 64)
+		if err == nil {
+			filter.CDRID = &cdrID
+		}
+	}
+
+	recordings, err := h.deps.DB.Recordings.List(r.Context(), filter)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	total, _ := h.deps.DB.Recordings.Count(r.Context(), filter)
+
+	WriteList(w, recordings, total, limit, offset)
+}
+
+// Get returns a recording
+// GET /api/recordings/{id}
+func (h *RecordingHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid recording ID", nil)
+		return
+	}
+
+	rec, err := h.deps.DB.Recordings.GetByID(r.Context(), id)
+	if err != nil {
+		if err == db.ErrRecordingNotFound {
+			WriteNotFoundError(w, "Recording")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, rec)
+}
+
+// Audio serves the WAV file of a completed recording: the caller on the
+// left channel, the callee on the right
+// GET /api/recordings/{id}/audio
+func (h *RecordingHandler) Audio(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid recording ID", nil)
+		return
+	}
+
+	rec, err := h.deps.DB.Recordings.GetByID(r.Context(), id)
+	if err != nil {
+		if err == db.ErrRecordingNotFound {
+			WriteNotFoundError(w, "Recording")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+	if rec.Status != db.RecordingCompleted {
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "The recording has no audio", nil)
+		return
+	}
+
+	serveAudioFile(w, r, filepath.Join(h.deps.Config.RecordingsPath(), filepath.Base(rec.FileName)), rec.FileName, rec.Checksum)
+}
+
+// Delete removes a recording and its audio
+// DELETE /api/recordings/{id}
+func (h *RecordingHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid recording ID", nil)
+		return
+	}
+
+	rec, err := h.deps.DB.Recordings.GetByID(r.Context(), id)
+	if err != nil {
+		if err == db.ErrRecordingNotFound {
+			WriteNotFoundError(w, "Recording")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+	if rec.Status == db.RecordingInProgress {
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "Stop the recording before deleting it", nil)
+		return
+	}
+
+	if err := h.deps.DB.Recordings.Delete(r.Context(), id); err != nil {
+		if err == db.ErrRecordingNotFound {
+			WriteNotFoundError(w, "Recording")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+	if err := os.Remove(filepath.Join(h.deps.Config.RecordingsPath(), filepath.Base(rec.FileName))); err != nil && !os.IsNotExist(err) {
+		WriteInternalError(w)
+		return
+	}
+
+	// The call's CDR no longer has the recording to link to
+	if rec.CDRID != nil {
+		if cdr, err := h.deps.DB.CDRs.GetByID(r.Context(), *rec.CDRID); err == nil && cdr.RecordingURL.String == sip.RecordingURL(rec.ID) {
+			h.deps.DB.CDRs.SetRecordingURL(r.Context(), cdr.ID, "")
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Recording deleted successfully"})
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/pkg/sip"
+)
+
+// createTestRecording adds a completed recording of a CDR with its audio
+func createTestRecording(t *testing.T, cfg *config.Config, database *db.DB, cdr *models.CDR, audio []byte) *models.Recording {
+	t.Helper()
+	ctx := context.Background()
+
+	rec := &models.Recording{CallID: cdr.CallSID, FileName: "20260101-120000-ab12cd34.wav"}
+	if err := database.Recordings.Create(ctx, rec); err != nil {
+		t.Fatalf("Failed to create recording: %v", err)
+	}
+	rec.Status, rec.Duration, rec.SizeBytes = db.RecordingCompleted, 1, int64(len(audio))
+	if err := database.Recordings.Finish(ctx, rec); err != nil {
+		t.Fatalf("Failed to finish recording: %v", err)
+	}
+	if err := database.Recordings.SetCDR(ctx, rec.ID, cdr.ID); err != nil {
+		t.Fatalf("Failed to link recording: %v", err)
+	}
+	if err := database.CDRs.SetRecordingURL(ctx, cdr.ID, sip.RecordingURL(rec.ID)); err != nil {
+		t.Fatalf("Failed to link CDR: %v", err)
+	}
+
+	if err := os.MkdirAll(cfg.RecordingsPath(), 0o750); err != nil {
+		t.Fatalf("Failed to create recordings directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(cfg.RecordingsPath(), rec.FileName), audio, 0o600); err != nil {
+		t.Fatalf("Failed to write recording: %v", err)
+	}
+	return rec
+}
+
+func TestRecordingHandler(t *testing.T) {
+	setup := setupTestAPI(t)
+	cfg := &config.Config{DataDir: t.TempDir()}
+	handler := NewRecordingHandler(&Dependencies{DB: setup.DB, Config: cfg})
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	cdr := createTestCDR(t, setup.DB, did.ID, "inbound", "+15559876543", did.Number)
+	audio := append(bytes.Repeat([]byte{'R'}, 44), 1, 2, 3, 4)
+	rec := createTestRecording(t, cfg, setup.DB, cdr, audio)
+
+	// Recordings are browsable by CDR
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/recordings?cdr_id=%d", cdr.ID), nil)
+	rr := httptest.NewRecorder()
+	handler.List(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+	var list ListResponse
+	decodeResponse(t, rr, &list)
+	if list.Pagination == nil || list.Pagination.Total != 1 {
+		t.Errorf("Expected the CDR's recording listed, got %+v", list.Pagination)
+	}
+
+	req = withURLParams(httptest.NewRequest(http.MethodGet, "/api/recordings/1/audio", nil), map[string]string{"id": fmt.Sprint(rec.ID)})
+	rr = httptest.NewRecorder()
+	handler.Audio(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+	if rr.Header().Get("Content-Type") != "audio/wav" || !bytes.Equal(rr.Body.Bytes(), audio) {
+		t.Errorf("Expected the recording's WAV, got %q (%d bytes)", rr.Header().Get("Content-Type"), rr.Body.Len())
+	}
+
+	// Deleting removes the file and the CDR's link to it
+	req = withURLParams(httptest.NewRequest(http.MethodDelete, "/api/recordings/1", nil), map[string]string{"id": fmt.Sprint(rec.ID)})
+	rr = httptest.NewRecorder()
+	handler.Delete(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+	if _, err := os.Stat(filepath.Join(cfg.RecordingsPath(), rec.FileName)); !os.IsNotExist(err) {
+		t.Errorf("Expected the recording's file removed, got %v", err)
+	}
+	if got, _ := setup.DB.CDRs.GetByID(context.Background(), cdr.ID); got.RecordingURL.Valid {
+		t.Errorf("Expected the CDR's recording URL cleared, got %q", got.RecordingURL.String)
+	}
+
+	req = withURLParams(httptest.NewRequest(http.MethodGet, "/api/recordings/1", nil), map[string]string{"id": fmt.Sprint(rec.ID)})
+	rr = httptest.NewRecorder()
+	handler.Get(rr, req)
+	assertStatus(t, rr, http.StatusNotFound)
+}
+
+func TestRecordingHandler_Audio_InProgress(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewRecordingHandler(&Dependencies{DB: setup.DB, Config: &config.Config{DataDir: t.TempDir()}})
+
+	rec := &models.Recording{CallID: "call-1@pbx", FileName: "a.wav"}
+	if err := setup.DB.Recordings.Create(context.Background(), rec); err != nil {
+		t.Fatalf("Failed to create recording: %v", err)
+	}
+
+	req := withURLParams(httptest.NewRequest(http.MethodGet, "/api/recordings/1/audio", nil), map[string]string{"id": fmt.Sprint(rec.ID)})
+	rr := httptest.NewRecorder()
+	handler.Audio(rr, req)
+	assertStatus(t, rr, http.StatusConflict)
+
+	req = withURLParams(httptest.NewRequest(http.MethodDelete, "/api/recordings/1", nil), map[string]string{"id": fmt.Sprint(rec.ID)})
+	rr = httptest.NewRecorder()
+	handler.Delete(rr, req)
+	assertStatus(t, rr, http.StatusConflict)
+}
+
+func TestRecordingHandler_Audio_Corrupted(t *testing.T) {
+	setup := setupTestAPI(t)
+	cfg := &config.Config{DataDir: t.TempDir()}
+	handler := NewRecordingHandler(&Dependencies{DB: setup.DB, Config: cfg})
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	cdr := createTestCDR(t, setup.DB, did.ID, "inbound", "+15559876543", did.Number)
+	audio := append(bytes.Repeat([]byte{'R'}, 44), 1, 2, 3, 4)
+	rec := createTestRecording(t, cfg, setup.DB, cdr, audio)
+	sum := sha256.Sum256(audio)
+	if err := setup.DB.Recordings.SetChecksum(context.Background(), rec.ID, hex.EncodeToString(sum[:])); err != nil {
+		t.Fatalf("Failed to set checksum: %v", err)
+	}
+	get := func() *httptest.ResponseRecorder {
+		req := withURLParams(httptest.NewRequest(http.MethodGet, "/api/recordings/1/audio", nil), map[string]string{"id": fmt.Sprint(rec.ID)})
+		rr := httptest.NewRecorder()
+		handler.Audio(rr, req)
+		return rr
+	}
+	assertStatus(t, get(), http.StatusOK)
+
+	// A file changed since it was written is refused
+	audio[len(audio)-1] = 5
+	if err := os.WriteFile(filepath.Join(cfg.RecordingsPath(), rec.FileName), audio, 0o600); err != nil {
+		t.Fatalf("Failed to change recording: %v", err)
+	}
+	rr := get()
+	assertStatus(t, rr, http.StatusInternalServerError)
+	assertErrorCode(t, rr, ErrCodeMediaCorrupted)
+}
+
+func TestCallHandler_RecordCall(t *testing.T) {
+	handler := NewCallHandler(&Dependencies{})
+
+	req := withURLParams(httptest.NewRequest(http.MethodPost, "/api/calls/call-1/recording", bytes.NewBufferString(`{"action": "rewind"}`)), map[string]string{"callID": "call-1"})
+	rr := httptest.NewRecorder()
+	handler.RecordCall(rr, req)
+	assertStatus(t, rr, http.StatusBadRequest)
+	assertErrorCode(t, rr, ErrCodeValidation)
+
+	// Without the SIP server there are no calls to record
+	req = withURLParams(httptest.NewRequest(http.MethodPost, "/api/calls/call-1/recording", bytes.NewBufferString(`{"action": "start"}`)), map[string]string{"callID": "call-1"})
+	rr = httptest.NewRecorder()
+	handler.RecordCall(rr, req)
+	assertStatus(t, rr, http.StatusNotFound)
+}
@@ -0,0 +1,341 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/i18n"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/reminders"
+	"github.com/go-chi/chi/v5"
+)
+
+// ReminderHandler handles appointment reminders
+type ReminderHandler struct {
+	deps *Dependencies
+}
+
+// NewReminderHandler creates a new ReminderHandler
+func NewReminderHandler(deps *Dependencies) *ReminderHandler {
+	return &ReminderHandler{deps: deps}
+}
+
+// ReminderRequest creates or changes an appointment reminder
+type ReminderRequest struct {
+	DIDID         int64      `json:"did_id"` // DID the reminder is sent from
+	ContactName   string     `json:"contact_name"`
+	ToNumber      string     `json:"to_number"`
+	AppointmentAt time.Time  `json:"appointment_at"`
+	RemindAt      *time.Time `json:"remind_at,omitempty"` // Defaults to a day before the appointment
+	Template      string     `json:"template"`            // Message text with {name}, {date} and {time}; defaults to a standard reminder
+	Channels      []string   `json:"channels"`            // "sms" (default) and "voice"
+}
+
+// ReminderAnsweredEvent is published when a contact confirms or cancels
+// an appointment
+type ReminderAnsweredEvent struct {
+	ReminderID int64  `json:"reminder_id"`
+	ToNumber   string `json:"to_number"`
+	Status     string `json:"status"`
+	Channel    string `json:"channel"` // How the contact answered: "sms" or "voice"
+}
+
+// List returns reminders, the soonest appointment first, optionally with
+// a status and appointments from and to RFC 3339 times
+// GET /api/reminders
+func (h *ReminderHandler) List(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	if limit == 0 {
+		limit = config.DefaultPageSize
+	}
+	if limit > config.MaxPageSize {
+		limit = config.MaxPageSize
+	}
+
+	filter := db.ReminderFilter{Status: query.Get("status"), Limit: limit, Offset: offset}
+	var errs []FieldError
+	for _, param := range []struct {
+		name string
+		dest **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if value := query.Get(param.name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				errs = append(errs, FieldError{Field: param.name, Message: "Must be an RFC 3339 time"})
+				continue
+			}
+			*param.dest = &t
+		}
+	}
+	if len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	list, err := h.deps.DB.Reminders.List(r.Context(), filter)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if list == nil {
+		list = []*models.Reminder{}
+	}
+	total, _ := h.deps.DB.Reminders.Count(r.Context(), filter)
+
+	WriteList(w, list, total, limit, offset)
+}
+
+// Create schedules a reminder
+// POST /api/reminders
+func (h *ReminderHandler) Create(w http.ResponseWriter, r *http.Request) {
+	rem, ok := h.decode(w, r)
+	if !ok {
+		return
+	}
+	if user := GetUserFromContext(r.Context()); user != nil {
+		rem.UserID = &user.ID
+	}
+	if err := h.deps.DB.Reminders.Create(r.Context(), rem); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, rem)
+}
+
+// Get returns a reminder
+// GET /api/reminders/{id}
+func (h *ReminderHandler) Get(w http.ResponseWriter, r *http.Request) {
+	rem, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	WriteJSON(w, http.StatusOK, rem)
+}
+
+// Update changes a reminder that hasn't been sent yet
+// PUT /api/reminders/{id}
+func (h *ReminderHandler) Update(w http.ResponseWriter, r *http.Request) {
+	current, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	rem, ok := h.decode(w, r)
+	if !ok {
+		return
+	}
+	rem.ID = current.ID
+
+	if err := h.deps.DB.Reminders.Update(r.Context(), rem); err != nil {
+		if errors.Is(err, db.ErrReminderState) {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "Reminder is "+current.Status+" and can't be changed", nil)
+			return
+		}
+		if err == db.ErrReminderNotFound {
+			WriteNotFoundError(w, "Reminder")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	rem, err := h.deps.DB.Reminders.GetByID(r.Context(), rem.ID)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	WriteJSON(w, http.StatusOK, rem)
+}
+
+// Delete removes a reminder. A reminder deleted before it is due is never
+// sent.
+// DELETE /api/reminders/{id}
+func (h *ReminderHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid reminder ID", nil)
+		return
+	}
+
+	if err := h.deps.DB.Reminders.Delete(r.Context(), id); err != nil {
+		if err == db.ErrReminderNotFound {
+			WriteNotFoundError(w, "Reminder")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Reminder deleted successfully"})
+}
+
+// decode reads and checks a reminder request, writing an error response
+// when it is invalid
+func (h *ReminderHandler) decode(w http.ResponseWriter, r *http.Request) (*models.Reminder, bool) {
+	var req ReminderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return nil, false
+	}
+	if len(req.Channels) == 0 {
+		req.Channels = []string{reminders.ChannelSMS}
+	}
+
+	now := time.Now()
+	var errs []FieldError
+	to := db.NormalizeE164(req.ToNumber)
+	if to == "" {
+		errs = append(errs, FieldError{Field: "to_number", Message: "An E.164 phone number is required"})
+	}
+	if !req.AppointmentAt.After(now) {
+		errs = append(errs, FieldError{Field: "appointment_at", Message: "Appointment time must be in the future"})
+	}
+	remindAt := req.AppointmentAt.Add(-config.ReminderDefaultLead)
+	if req.RemindAt != nil {
+		remindAt = *req.RemindAt
+		if !remindAt.Before(req.AppointmentAt) {
+			errs = append(errs, FieldError{Field: "remind_at", Message: "Reminder time must be before the appointment"})
+		}
+	}
+	// Appointments sooner than the lead time are reminded of right away
+	if remindAt.Before(now) {
+		remindAt = now
+	}
+	if len(req.Template) > config.MaxReminderTemplateLength {
+		errs = append(errs, FieldError{Field: "template", Message: fmt.Sprintf("Template must be at most %d characters", config.MaxReminderTemplateLength)})
+	}
+
+	did, err := h.deps.DB.DIDs.GetByID(r.Context(), req.DIDID)
+	switch {
+	case err == db.ErrDIDNotFound:
+		errs = append(errs, FieldError{Field: "did_id", Message: "DID not found"})
+	case err != nil:
+		WriteInternalError(w)
+		return nil, false
+	}
+
+	seen := make(map[string]bool)
+	var channels []string
+	for _, channel := range req.Channels {
+		switch {
+		case seen[channel]:
+			continue
+		case channel != reminders.ChannelSMS && channel != reminders.ChannelVoice:
+			errs = append(errs, FieldError{Field: "channels", Message: "Channels must be sms or voice"})
+		case did == nil:
+		case channel == reminders.ChannelSMS && !did.SMSEnabled:
+			errs = append(errs, FieldError{Field: "channels", Message: "DID is not SMS-enabled"})
+		case channel == reminders.ChannelVoice && !did.VoiceEnabled:
+			errs = append(errs, FieldError{Field: "channels", Message: "DID is not voice-enabled"})
+		}
+		seen[channel] = true
+		channels = append(channels, channel)
+	}
+	if len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return nil, false
+	}
+
+	return &models.Reminder{
+		DIDID:         req.DIDID,
+		ContactName:   req.ContactName,
+		ToNumber:      to,
+		AppointmentAt: req.AppointmentAt,
+		RemindAt:      remindAt,
+		Template:      req.Template,
+		Channels:      channels,
+	}, true
+}
+
+// load reads the reminder named in the URL, writing an error response when
+// there is none
+func (h *ReminderHandler) load(w http.ResponseWriter, r *http.Request) (*models.Reminder, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid reminder ID", nil)
+		return nil, false
+	}
+
+	rem, err := h.deps.DB.Reminders.GetByID(r.Context(), id)
+	if err != nil {
+		if err == db.ErrReminderNotFound {
+			WriteNotFoundError(w, "Reminder")
+			return nil, false
+		}
+		WriteInternalError(w)
+		return nil, false
+	}
+	return rem, true
+}
+
+// reminderReply records a text confirming or cancelling an appointment a
+// reminder was sent for, returning the acknowledgment to reply with, or ""
+// when the text doesn't answer a reminder
+func (h *WebhookHandler) reminderReply(ctx context.Context, did *models.DID, from, body string) string {
+	status := reminders.ParseReply(body)
+	if status == "" {
+		return ""
+	}
+	rem, err := h.deps.DB.Reminders.GetAwaitingReply(ctx, did.ID, from, time.Now())
+	if err != nil {
+		return ""
+	}
+	if !h.answerReminder(ctx, rem, status, reminders.ChannelSMS) {
+		return ""
+	}
+	return reminders.Acknowledgment(h.callLanguage(ctx, did), status)
+}
+
+// answerReminder records a contact's answer to a reminder and publishes it
+func (h *WebhookHandler) answerReminder(ctx context.Context, rem *models.Reminder, status, channel string) bool {
+	if err := h.deps.DB.Reminders.Respond(ctx, rem.ID, status, time.Now()); err != nil {
+		if err != db.ErrReminderState {
+			slog.Error("Failed to record reminder answer", "id", rem.ID, "error", err)
+		}
+		return false
+	}
+	slog.Info("Reminder answered", "id", rem.ID, "status", status, "channel", channel)
+	if h.deps.Events != nil {
+		h.deps.Events.Publish(events.TypeReminderAnswered, ReminderAnsweredEvent{ReminderID: rem.ID, ToNumber: rem.ToNumber, Status: status, Channel: channel})
+	}
+	return true
+}
+
+// VoiceReminder records the digit a contact pressed during a reminder call
+// to confirm or cancel the appointment
+func (h *WebhookHandler) VoiceReminder(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || !h.validateSignature(r) {
+		h.respondTwiML(w, `<Response><Hangup/></Response>`)
+		return
+	}
+
+	id, _ := strconv.ParseInt(r.URL.Query().Get("ReminderId"), 10, 64)
+	rem, err := h.deps.DB.Reminders.GetByID(r.Context(), id)
+	// Only the reminder's own call can answer it
+	if err != nil || rem.CallSID == "" || rem.CallSID != r.FormValue("CallSid") {
+		h.respondTwiML(w, `<Response><Hangup/></Response>`)
+		return
+	}
+
+	lang := i18n.DefaultLanguage
+	if did, err := h.deps.DB.DIDs.GetByID(r.Context(), rem.DIDID); err == nil {
+		lang = h.callLanguage(r.Context(), did)
+	}
+	status := reminders.ParseDigit(r.FormValue("Digits"))
+	if status == "" || !h.answerReminder(r.Context(), rem, status, reminders.ChannelVoice) {
+		h.respondTwiML(w, `<Response>`+sayTwiML(lang, i18n.Prompt(lang, i18n.PromptGoodbye))+`</Response>`)
+		return
+	}
+	h.respondTwiML(w, `<Response>`+sayTwiML(lang, reminders.Acknowledgment(lang, status))+`</Response>`)
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestReminderHandler(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewReminderHandler(&Dependencies{DB: setup.DB})
+	ctx := context.Background()
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	textOnly := &models.DID{Number: "+15551234568", SMSEnabled: true}
+	setup.DB.DIDs.Create(ctx, textOnly)
+
+	call := func(fn http.HandlerFunc, method, id string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, "/api/reminders", bytes.NewBuffer(data))
+		if id != "" {
+			req = withURLParams(req, map[string]string{"id": id})
+		}
+		rr := httptest.NewRecorder()
+		fn(rr, req)
+		return rr
+	}
+
+	appointment := time.Now().Add(48 * time.Hour).Truncate(time.Second).UTC()
+	rr := call(handler.Create, http.MethodPost, "", ReminderRequest{DIDID: did.ID, ContactName: "Ann", ToNumber: "(555) 987-6543", AppointmentAt: appointment})
+	assertStatus(t, rr, http.StatusCreated)
+	var rem models.Reminder
+	decodeResponse(t, rr, &rem)
+	if rem.ToNumber != "+15559876543" || rem.Status != db.ReminderScheduled || !rem.RemindAt.Equal(appointment.Add(-24*time.Hour)) ||
+		len(rem.Channels) != 1 || rem.Channels[0] != "sms" {
+		t.Errorf("Unexpected reminder: %+v", rem)
+	}
+
+	// Appointments sooner than the lead time are reminded of right away
+	soon := time.Now().Add(time.Hour)
+	rr = call(handler.Create, http.MethodPost, "", ReminderRequest{DIDID: did.ID, ToNumber: "+15559876543", AppointmentAt: soon, Channels: []string{"voice", "voice"}})
+	assertStatus(t, rr, http.StatusCreated)
+	var soonRem models.Reminder
+	decodeResponse(t, rr, &soonRem)
+	if soonRem.RemindAt.After(time.Now()) || len(soonRem.Channels) != 1 {
+		t.Errorf("Expected a reminder due now on one channel, got %+v", soonRem)
+	}
+
+	for name, req := range map[string]ReminderRequest{
+		"past appointment": {DIDID: did.ID, ToNumber: "+15559876543", AppointmentAt: time.Now().Add(-time.Hour)},
+		"missing number":   {DIDID: did.ID, AppointmentAt: appointment},
+		"remind after":     {DIDID: did.ID, ToNumber: "+15559876543", AppointmentAt: appointment, RemindAt: &[]time.Time{appointment.Add(time.Minute)}[0]},
+		"unknown channel":  {DIDID: did.ID, ToNumber: "+15559876543", AppointmentAt: appointment, Channels: []string{"fax"}},
+		"no voice":         {DIDID: textOnly.ID, ToNumber: "+15559876543", AppointmentAt: appointment, Channels: []string{"voice"}},
+		"unknown DID":      {DIDID: 999, ToNumber: "+15559876543", AppointmentAt: appointment},
+		"long template":    {DIDID: did.ID, ToNumber: "+15559876543", AppointmentAt: appointment, Template: strings.Repeat("x", 641)},
+	} {
+		rr := call(handler.Create, http.MethodPost, "", req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, rr.Code)
+		}
+	}
+
+	id := strconv.FormatInt(rem.ID, 10)
+	rr = call(handler.Update, http.MethodPut, id, ReminderRequest{DIDID: did.ID, ContactName: "Anne", ToNumber: "+15559876543", AppointmentAt: appointment, Channels: []string{"sms", "voice"}})
+	assertStatus(t, rr, http.StatusOK)
+	decodeResponse(t, rr, &rem)
+	if rem.ContactName != "Anne" || len(rem.Channels) != 2 {
+		t.Errorf("Unexpected updated reminder: %+v", rem)
+	}
+
+	from := time.Now().Add(24 * time.Hour).Format(time.RFC3339)
+	req := httptest.NewRequest(http.MethodGet, "/api/reminders?from="+url.QueryEscape(from), nil)
+	rr = httptest.NewRecorder()
+	handler.List(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+	var list struct {
+		Data       []models.Reminder `json:"data"`
+		Pagination Pagination        `json:"pagination"`
+	}
+	decodeResponse(t, rr, &list)
+	if list.Pagination.Total != 1 || len(list.Data) != 1 || list.Data[0].ID != rem.ID {
+		t.Errorf("Expected only the later appointment, got %+v", list)
+	}
+	rr = httptest.NewRecorder()
+	handler.List(rr, httptest.NewRequest(http.MethodGet, "/api/reminders?to=tomorrow", nil))
+	assertStatus(t, rr, http.StatusBadRequest)
+
+	// A sent reminder can't be changed
+	setup.DB.Reminders.RecordSend(ctx, soonRem.ID, db.ReminderSent, "", nil, time.Now())
+	soonID := strconv.FormatInt(soonRem.ID, 10)
+	rr = call(handler.Update, http.MethodPut, soonID, ReminderRequest{DIDID: did.ID, ToNumber: "+15559876543", AppointmentAt: soon})
+	assertStatus(t, rr, http.StatusConflict)
+
+	rr = call(handler.Delete, http.MethodDelete, id, nil)
+	assertStatus(t, rr, http.StatusOK)
+	rr = call(handler.Get, http.MethodGet, id, nil)
+	assertStatus(t, rr, http.StatusNotFound)
+}
+
+func TestWebhookHandler_ReminderReplies(t *testing.T) {
+	setup := setupTestAPI(t)
+	hub := events.NewHub(10)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB, Events: hub})
+	ctx := context.Background()
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	now := time.Now()
+	rem := &models.Reminder{DIDID: did.ID, ToNumber: "+15559876543", AppointmentAt: now.Add(time.Hour), RemindAt: now, Channels: []string{"sms", "voice"}}
+	if err := setup.DB.Reminders.Create(ctx, rem); err != nil {
+		t.Fatalf("Failed to create reminder: %v", err)
+	}
+	setup.DB.Reminders.RecordSend(ctx, rem.ID, db.ReminderSent, "CA123", nil, now)
+	_, stream, cancel := hub.Subscribe(0)
+	defer cancel()
+
+	form := url.Values{"MessageSid": {"SM901"}, "From": {rem.ToNumber}, "To": {did.Number}, "Body": {"Yes!"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/sms/incoming", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler.SMSIncoming(rr, req)
+	if !strings.Contains(rr.Body.String(), "your appointment is confirmed") {
+		t.Errorf("Expected the confirmation acknowledged, got %s", rr.Body.String())
+	}
+	if updated, _ := setup.DB.Reminders.GetByID(ctx, rem.ID); updated.Status != db.ReminderConfirmed {
+		t.Errorf("Expected the reminder confirmed, got %s", updated.Status)
+	}
+	// The text itself is published too
+	for answered := false; !answered; {
+		select {
+		case event := <-stream:
+			if event.Type != events.TypeReminderAnswered {
+				continue
+			}
+			answered = true
+			if data, ok := event.Data.(ReminderAnsweredEvent); !ok || data.ReminderID != rem.ID || data.Channel != "sms" {
+				t.Errorf("Unexpected event %+v", event)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected a reminder.answered event")
+		}
+	}
+
+	// Only the reminder's own call can answer it
+	target := "/api/webhooks/voice/reminder?ReminderId=" + strconv.FormatInt(rem.ID, 10)
+	rr = httptest.NewRecorder()
+	handler.VoiceReminder(rr, newSignedWebhookRequest(t, setup.DB, target, url.Values{"CallSid": {"CA999"}, "Digits": {"2"}}))
+	if updated, _ := setup.DB.Reminders.GetByID(ctx, rem.ID); updated.Status != db.ReminderConfirmed {
+		t.Errorf("Expected another call ignored, got %s", updated.Status)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.VoiceReminder(rr, newSignedWebhookRequest(t, setup.DB, target, url.Values{"CallSid": {"CA123"}, "Digits": {"2"}}))
+	if !strings.Contains(rr.Body.String(), "<Say") {
+		t.Errorf("Expected the cancellation acknowledged, got %s", rr.Body.String())
+	}
+	if updated, _ := setup.DB.Reminders.GetByID(ctx, rem.ID); updated.Status != db.ReminderCancelled {
+		t.Errorf("Expected the reminder cancelled, got %s", updated.Status)
+	}
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+)
+
+// ReplicaHandler reports and triggers database replication
+type ReplicaHandler struct {
+	deps *Dependencies
+}
+
+// NewReplicaHandler creates a new ReplicaHandler
+func NewReplicaHandler(deps *Dependencies) *ReplicaHandler {
+	return &ReplicaHandler{deps: deps}
+}
+
+// Get returns the latest snapshot and any replication error (admin only)
+func (h *ReplicaHandler) Get(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, h.deps.Replica.Status())
+}
+
+// Sync uploads a snapshot now, even if nothing changed (admin only)
+func (h *ReplicaHandler) Sync(w http.ResponseWriter, r *http.Request) {
+	if !h.deps.Replica.Enabled() {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Database replication is off. Set GOSIP_REPLICA_URL to enable it.", nil)
+		return
+	}
+	status, err := h.deps.Replica.Sync(r.Context(), true)
+	if err != nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Database replication failed: "+err.Error(), nil)
+		return
+	}
+	WriteJSON(w, http.StatusOK, status)
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/replica"
+)
+
+func TestReplicaHandler(t *testing.T) {
+	// Off without a replica URL
+	handler := NewReplicaHandler(&Dependencies{})
+	rr := httptest.NewRecorder()
+	handler.Sync(rr, httptest.NewRequest(http.MethodPost, "/api/system/replica/sync", nil))
+	assertStatus(t, rr, http.StatusServiceUnavailable)
+	assertErrorCode(t, rr, ErrCodeServiceUnavailable)
+
+	dbPath := filepath.Join(t.TempDir(), "gosip.db")
+	database, err := db.New(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	cfg := &config.Config{Replica: &config.ReplicaConfig{URL: "file://" + t.TempDir(), Interval: time.Minute, Retention: 3}}
+	replicator, err := replica.NewReplicator(cfg, database, dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler = NewReplicaHandler(&Dependencies{Replica: replicator})
+
+	rr = httptest.NewRecorder()
+	handler.Sync(rr, httptest.NewRequest(http.MethodPost, "/api/system/replica/sync", nil))
+	assertStatus(t, rr, http.StatusOK)
+
+	rr = httptest.NewRecorder()
+	handler.Get(rr, httptest.NewRequest(http.MethodGet, "/api/system/replica", nil))
+	assertStatus(t, rr, http.StatusOK)
+	var status replica.Status
+	if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !status.Enabled || status.LastSnapshot == "" || status.Snapshots != 1 {
+		t.Errorf("Expected one snapshot, got %+v", status)
+	}
+}
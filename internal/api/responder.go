@@ -0,0 +1,396 @@
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/tftp"
+	"github.com/go-chi/chi/v5"
+)
+
+// Errors returned when a phone requests a config file by name
+var (
+	errResponderDisabled = errors.New("provisioning responder is disabled")
+	errNotOnLAN          = errors.New("requester is not on the local network")
+	errUnknownFile       = errors.New("no device matches the requested file")
+	errTooManyMisses     = errors.New("too many requests for unknown files")
+)
+
+// selfTestBody is served for the self-test probe file so a fetch can be verified end to end
+const selfTestBody = "gosip provisioning responder ok\n"
+
+// macInFilename matches a bare 12-digit MAC address in a vendor config file name,
+// e.g. "cfg000b82123456.xml" (Grandstream) or "805ec0aabbcc.cfg" (Yealink/Polycom)
+var macInFilename = regexp.MustCompile(`(?i)(?:^|[^0-9a-f])([0-9a-f]{12})(?:[^0-9a-f]|$)`)
+
+// VendorConfigFile describes the config file name a vendor requests from the provisioning URL
+type VendorConfigFile struct {
+	Vendor  string `json:"vendor"`
+	Pattern string `json:"pattern"`
+}
+
+// DHCPOption is a DHCP option value advertising the provisioning URL
+type DHCPOption struct {
+	Code    int      `json:"code"`
+	Value   string   `json:"value"`
+	Hex     string   `json:"hex"`
+	Vendors []string `json:"vendors"`
+}
+
+// DHCPConfigResponse contains everything needed to point phones at GoSIP through DHCP
+type DHCPConfigResponse struct {
+	Host             string             `json:"host"`
+	ProvisioningURL  string             `json:"provisioning_url"`
+	TFTPServer       string             `json:"tftp_server,omitempty"`
+	ResponderEnabled bool               `json:"responder_enabled"`
+	Options          []DHCPOption       `json:"options"`
+	ConfigFiles      []VendorConfigFile `json:"config_files"`
+	Snippets         map[string]string  `json:"snippets"`
+}
+
+// SelfTestRequest optionally overrides the URL probed by the self-test
+type SelfTestRequest struct {
+	URL string `json:"url"`
+}
+
+// SelfTestCheck is the outcome of one self-test step
+type SelfTestCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// SelfTestResponse reports whether phones can reach the provisioning URL
+type SelfTestResponse struct {
+	URL    string          `json:"url"`
+	OK     bool            `json:"ok"`
+	Checks []SelfTestCheck `json:"checks"`
+}
+
+// vendorConfigFiles lists the file each vendor appends to the option 66/160 URL
+var vendorConfigFiles = []VendorConfigFile{
+	{Vendor: "grandstream", Pattern: "cfg{mac}.xml"},
+	{Vendor: "yealink", Pattern: "{mac}.cfg"},
+	{Vendor: "polycom", Pattern: "{mac}.cfg"},
+}
+
+// GetConfigByMAC serves a device config requested by file name from a phone
+// that was pointed at GoSIP through DHCP option 66/160
+func (h *ProvisioningHandler) GetConfigByMAC(w http.ResponseWriter, r *http.Request) {
+	config, contentType, err := h.configForFile(r.Context(), chi.URLParam(r, "filename"), peerAddr(r), r.UserAgent())
+	switch {
+	case errors.Is(err, errResponderDisabled), errors.Is(err, errNotOnLAN):
+		respondError(w, http.StatusForbidden, "RESPONDER_FORBIDDEN", "Provisioning responder is not available")
+		return
+	case errors.Is(err, errTooManyMisses):
+		respondError(w, http.StatusTooManyRequests, "RATE_LIMITED", "Too many requests for unknown files")
+		return
+	case errors.Is(err, errUnknownFile):
+		respondError(w, http.StatusNotFound, "DEVICE_NOT_FOUND", "No device matches the requested file")
+		return
+	case errors.Is(err, errNoProfile):
+		respondError(w, http.StatusNotFound, "NO_PROFILE", "No provisioning profile found for this device")
+		return
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "CONFIG_ERROR", "Failed to generate configuration")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(config))
+}
+
+// ServeTFTP serves device configs to phones that fetch over TFTP
+func (h *ProvisioningHandler) ServeTFTP(filename string, remote net.Addr) ([]byte, error) {
+	config, _, err := h.configForFile(context.Background(), filename, remote.String(), "tftp")
+	switch {
+	case errors.Is(err, errResponderDisabled), errors.Is(err, errNotOnLAN), errors.Is(err, errTooManyMisses):
+		return nil, tftp.ErrAccessViolation
+	case errors.Is(err, errUnknownFile), errors.Is(err, errNoProfile):
+		return nil, tftp.ErrFileNotFound
+	case err != nil:
+		return nil, err
+	}
+	return []byte(config), nil
+}
+
+// configForFile resolves a requested file name to a device config. Only LAN
+// clients are answered since the file name is the only credential, and
+// clients that keep asking for unknown files are turned away for a while.
+func (h *ProvisioningHandler) configForFile(ctx context.Context, filename, remoteAddr, userAgent string) (string, string, error) {
+	if h.deps.DB.Config.GetWithDefault(ctx, "provisioning_responder_enabled", "false") != "true" {
+		return "", "", errResponderDisabled
+	}
+	if !isLANAddr(remoteAddr) {
+		return "", "", errNotOnLAN
+	}
+	client := clientHost(remoteAddr)
+	if h.tooManyMisses(client) {
+		return "", "", errTooManyMisses
+	}
+
+	if filename == config.ProvisioningSelfTestFile {
+		return selfTestBody, "text/plain", nil
+	}
+
+	m := macInFilename.FindStringSubmatch(filename)
+	if m == nil {
+		h.recordMiss(client)
+		return "", "", errUnknownFile
+	}
+
+	device, err := h.deps.DB.Devices.GetByMAC(ctx, m[1])
+	if errors.Is(err, db.ErrDeviceNotFound) {
+		h.recordMiss(client)
+		return "", "", errUnknownFile
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	return h.renderDeviceConfig(ctx, device, map[string]interface{}{
+		"filename": filename,
+	}, remoteAddr, userAgent)
+}
+
+// GetDHCPConfig returns the provisioning URL and the DHCP option 66/160
+// values to advertise it, with ready-to-paste DHCP server snippets
+func (h *ProvisioningHandler) GetDHCPConfig(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("host")
+	if host == "" {
+		host = h.defaultHost()
+	}
+	if strings.ContainsAny(host, "/?#@ ") {
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "host", Message: "Invalid host"},
+		})
+		return
+	}
+
+	provisioningURL := h.responderURL(host)
+
+	vendors := make([]string, 0, len(vendorConfigFiles))
+	for _, f := range vendorConfigFiles {
+		vendors = append(vendors, f.Vendor)
+	}
+
+	resp := DHCPConfigResponse{
+		Host:             host,
+		ProvisioningURL:  provisioningURL,
+		ResponderEnabled: h.deps.DB.Config.GetWithDefault(r.Context(), "provisioning_responder_enabled", "false") == "true",
+		Options: []DHCPOption{
+			{Code: 66, Value: provisioningURL, Hex: hex.EncodeToString([]byte(provisioningURL)), Vendors: vendors},
+			{Code: 160, Value: provisioningURL, Hex: hex.EncodeToString([]byte(provisioningURL)), Vendors: []string{"polycom", "yealink"}},
+		},
+		ConfigFiles: vendorConfigFiles,
+		Snippets: map[string]string{
+			"isc-dhcpd": fmt.Sprintf("option tftp-server-name \"%s\";\noption option-160 code 160 = string;\noption option-160 \"%s\";", provisioningURL, provisioningURL),
+			"dnsmasq":   fmt.Sprintf("dhcp-option=66,\"%s\"\ndhcp-option=160,\"%s\"", provisioningURL, provisioningURL),
+			"mikrotik":  fmt.Sprintf("/ip dhcp-server option add name=gosip-66 code=66 value=\"'%s'\"\n/ip dhcp-server option add name=gosip-160 code=160 value=\"'%s'\"", provisioningURL, provisioningURL),
+		},
+	}
+	if h.deps.Config.TFTPPort > 0 {
+		resp.TFTPServer = net.JoinHostPort(host, fmt.Sprint(h.deps.Config.TFTPPort))
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// SelfTest verifies that phones can fetch from the provisioning URL by
+// requesting the self-test probe file over HTTP and, when enabled, TFTP
+func (h *ProvisioningHandler) SelfTest(w http.ResponseWriter, r *http.Request) {
+	var req SelfTestRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteValidationError(w, "Invalid request body", nil)
+			return
+		}
+	}
+	if req.URL == "" {
+		req.URL = h.responderURL(h.defaultHost())
+	}
+
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "url", Message: "Must be an http or https URL"},
+		})
+		return
+	}
+
+	ctx := r.Context()
+	resp := SelfTestResponse{URL: req.URL, OK: true}
+	add := func(check SelfTestCheck) {
+		resp.Checks = append(resp.Checks, check)
+		resp.OK = resp.OK && check.OK
+	}
+
+	enabled := SelfTestCheck{Name: "responder_enabled", Detail: "Enable provisioning_responder_enabled in the system settings"}
+	if h.deps.DB.Config.GetWithDefault(ctx, "provisioning_responder_enabled", "false") == "true" {
+		enabled.OK = true
+		enabled.Detail = "Provisioning responder is enabled"
+	}
+	add(enabled)
+
+	add(checkHost(ctx, target.Hostname()))
+	add(h.checkHTTP(ctx, target))
+	if h.deps.Config.TFTPPort > 0 {
+		add(checkTFTP(ctx, target.Hostname(), h.deps.Config.TFTPPort))
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// checkHost verifies that the URL host is resolvable and reachable from other devices
+func checkHost(ctx context.Context, host string) SelfTestCheck {
+	check := SelfTestCheck{Name: "host"}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(ips) == 0 {
+		check.Detail = fmt.Sprintf("%s does not resolve", host)
+		return check
+	}
+	for _, ip := range ips {
+		if ip.IP.IsLoopback() {
+			check.Detail = fmt.Sprintf("%s is a loopback address that phones cannot reach", host)
+			return check
+		}
+	}
+
+	check.OK = true
+	check.Detail = fmt.Sprintf("%s resolves to %s", host, ips[0].IP)
+	return check
+}
+
+// checkHTTP fetches the self-test probe file from the provisioning URL
+func (h *ProvisioningHandler) checkHTTP(ctx context.Context, target *url.URL) SelfTestCheck {
+	check := SelfTestCheck{Name: "http_fetch"}
+
+	ctx, cancel := context.WithTimeout(ctx, config.ProvisioningSelfTestTimeout)
+	defer cancel()
+
+	probe := target.JoinPath(config.ProvisioningSelfTestFile).String()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probe, nil)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		check.Detail = fmt.Sprintf("GET %s failed: %v", probe, err)
+		return check
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode != http.StatusOK || string(body) != selfTestBody {
+		check.Detail = fmt.Sprintf("GET %s returned %d", probe, resp.StatusCode)
+		return check
+	}
+
+	check.OK = true
+	check.Detail = fmt.Sprintf("GET %s succeeded", probe)
+	return check
+}
+
+// checkTFTP fetches the self-test probe file from the TFTP responder
+func checkTFTP(ctx context.Context, host string, port int) SelfTestCheck {
+	check := SelfTestCheck{Name: "tftp_fetch"}
+
+	ctx, cancel := context.WithTimeout(ctx, config.ProvisioningSelfTestTimeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(host, fmt.Sprint(port))
+	data, err := tftp.Fetch(ctx, addr, config.ProvisioningSelfTestFile)
+	if err != nil || string(data) != selfTestBody {
+		check.Detail = fmt.Sprintf("TFTP fetch from %s failed: %v", addr, err)
+		return check
+	}
+
+	check.OK = true
+	check.Detail = fmt.Sprintf("TFTP fetch from %s succeeded", addr)
+	return check
+}
+
+// responderURL builds the URL phones prepend to their config file name
+func (h *ProvisioningHandler) responderURL(host string) string {
+	hostPort := net.JoinHostPort(host, fmt.Sprint(h.deps.Config.HTTPPort))
+	return fmt.Sprintf("http://%s/api/provision/mac/", hostPort)
+}
+
+// defaultHost picks the address phones should use: the first private IPv4
+// address of this machine, falling back to the SIP domain
+func (h *ProvisioningHandler) defaultHost() string {
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if ok && ipNet.IP.To4() != nil && ipNet.IP.IsPrivate() {
+				return ipNet.IP.String()
+			}
+		}
+	}
+	return h.deps.Config.SIPDomain
+}
+
+// responderMisses counts one client's requests for unknown files
+type responderMisses struct {
+	count int
+	since time.Time
+}
+
+// tooManyMisses reports whether a client used up its misses for the current window
+func (h *ProvisioningHandler) tooManyMisses(client string) bool {
+	h.missMu.Lock()
+	defer h.missMu.Unlock()
+
+	m := h.misses[client]
+	return m != nil && time.Since(m.since) < config.ProvisioningResponderMissWindow &&
+		m.count >= config.ProvisioningResponderMaxMisses
+}
+
+// recordMiss counts a request for an unknown file against a client
+func (h *ProvisioningHandler) recordMiss(client string) {
+	h.missMu.Lock()
+	defer h.missMu.Unlock()
+
+	now := time.Now()
+	m := h.misses[client]
+	if m == nil || now.Sub(m.since) >= config.ProvisioningResponderMissWindow {
+		// Drop expired windows so clients that went away don't pile up
+		for key, other := range h.misses {
+			if now.Sub(other.since) >= config.ProvisioningResponderMissWindow {
+				delete(h.misses, key)
+			}
+		}
+		m = &responderMisses{since: now}
+		h.misses[client] = m
+	}
+	m.count++
+}
+
+// isLANAddr reports whether a remote address is on a private, loopback or link-local network
+func isLANAddr(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast()
+}
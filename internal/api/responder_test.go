@@ -0,0 +1,265 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/tftp"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func setupResponderTest(t *testing.T) (*testSetup, *ProvisioningHandler) {
+	t.Helper()
+
+	setup := setupTestAPI(t)
+	setup.DB.Config.Set(context.Background(), "provisioning_responder_enabled", "true")
+
+	vendor, mac := "grandstream", "00:0B:82:12:34:56"
+	device := &models.Device{
+		Name:       "Lobby",
+		Username:   "lobby",
+		DeviceType: "grandstream",
+		Vendor:     &vendor,
+		MACAddress: &mac,
+	}
+	if err := setup.DB.Devices.Create(context.Background(), device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+
+	handler := NewProvisioningHandler(&Dependencies{
+		DB:     setup.DB,
+		Config: &config.Config{SIPDomain: "pbx.example.com", SIPPort: 5060, HTTPPort: 8080},
+	})
+	return setup, handler
+}
+
+func fetchByMAC(handler *ProvisioningHandler, filename, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/provision/mac/"+filename, nil)
+	req.RemoteAddr = remoteAddr
+	req = withURLParams(req, map[string]string{"filename": filename})
+	rr := httptest.NewRecorder()
+	handler.GetConfigByMAC(rr, req)
+	return rr
+}
+
+func TestProvisioningHandler_GetConfigByMAC(t *testing.T) {
+	setup, handler := setupResponderTest(t)
+
+	tests := []struct {
+		name       string
+		filename   string
+		remoteAddr string
+		wantStatus int
+	}{
+		{"grandstream file name", "cfg000b82123456.xml", "192.168.1.50:5000", http.StatusOK},
+		{"uppercase MAC", "000B82123456.cfg", "10.0.0.8:5000", http.StatusOK},
+		{"unknown MAC", "cfg000b82ffffff.xml", "192.168.1.50:5000", http.StatusNotFound},
+		{"no MAC in name", "y000000000044.boot", "192.168.1.50:5000", http.StatusNotFound},
+		{"public client", "cfg000b82123456.xml", "203.0.113.7:5000", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := fetchByMAC(handler, tt.filename, tt.remoteAddr)
+			assertStatus(t, rr, tt.wantStatus)
+		})
+	}
+
+	device, _ := setup.DB.Devices.GetByMAC(context.Background(), "000b82123456")
+	if device.ProvisioningStatus != "provisioned" {
+		t.Errorf("Expected device to be provisioned, got %q", device.ProvisioningStatus)
+	}
+}
+
+func TestProvisioningHandler_GetConfigByMAC_DialPlan(t *testing.T) {
+	setup, handler := setupResponderTest(t)
+	ctx := context.Background()
+
+	device, _ := setup.DB.Devices.GetByMAC(ctx, "000b82123456")
+	ext := "101"
+	device.Extension = &ext
+	if err := setup.DB.Devices.Update(ctx, device); err != nil {
+		t.Fatalf("Failed to set extension: %v", err)
+	}
+
+	rr := fetchByMAC(handler, "cfg000b82123456.xml", "192.168.1.50:5000")
+	assertStatus(t, rr, http.StatusOK)
+	for _, want := range []string{
+		`<config name="P290" value="{ *80101 | *97 | 101 | *5x+ | *x+ | \+x+ | x+ }"/>`,
+		`<config name="P85" value="4"/>`,
+	} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("Expected %s in config, got %s", want, rr.Body.String())
+		}
+	}
+}
+
+func TestProvisioningHandler_GetConfigByMAC_Disabled(t *testing.T) {
+	setup, handler := setupResponderTest(t)
+	setup.DB.Config.Set(context.Background(), "provisioning_responder_enabled", "false")
+
+	rr := fetchByMAC(handler, "cfg000b82123456.xml", "192.168.1.50:5000")
+	assertStatus(t, rr, http.StatusForbidden)
+}
+
+func TestProvisioningHandler_GetConfigByMAC_ForwardedHeader(t *testing.T) {
+	_, handler := setupResponderTest(t)
+	// Serve the responder behind the middleware the router uses
+	chain := PeerAddrMiddleware(middleware.RealIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.GetConfigByMAC(w, withURLParams(r, map[string]string{"filename": "cfg000b82123456.xml"}))
+	})))
+
+	for _, header := range []string{"X-Real-IP", "X-Forwarded-For"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/provision/mac/cfg000b82123456.xml", nil)
+		req.RemoteAddr = "203.0.113.7:5000"
+		req.Header.Set(header, "192.168.1.10")
+		rr := httptest.NewRecorder()
+		chain.ServeHTTP(rr, req)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403 for a public peer, got %d", header, rr.Code)
+		}
+	}
+}
+
+func TestProvisioningHandler_GetConfigByMAC_RateLimited(t *testing.T) {
+	_, handler := setupResponderTest(t)
+
+	for i := 0; i < config.ProvisioningResponderMaxMisses; i++ {
+		rr := fetchByMAC(handler, fmt.Sprintf("cfg000b82%06x.xml", i), "192.168.1.50:5000")
+		assertStatus(t, rr, http.StatusNotFound)
+	}
+
+	// Further requests from the client are refused, even for a known device
+	rr := fetchByMAC(handler, "cfg000b82123456.xml", "192.168.1.50:5000")
+	assertStatus(t, rr, http.StatusTooManyRequests)
+
+	// Other clients are not affected
+	rr = fetchByMAC(handler, "cfg000b82123456.xml", "192.168.1.51:5000")
+	assertStatus(t, rr, http.StatusOK)
+}
+
+func TestProvisioningHandler_ServeTFTP(t *testing.T) {
+	_, handler := setupResponderTest(t)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := tftp.NewServer(handler.ServeTFTP)
+	go server.Serve(conn)
+	defer server.Close()
+
+	data, err := tftp.Fetch(context.Background(), conn.LocalAddr().String(), "cfg000b82123456.xml")
+	if err != nil {
+		t.Fatalf("TFTP fetch failed: %v", err)
+	}
+	if !strings.Contains(string(data), "lobby") {
+		t.Errorf("Expected config for the device, got %q", data)
+	}
+
+	if _, err := tftp.Fetch(context.Background(), conn.LocalAddr().String(), "cfg000b82ffffff.xml"); err == nil {
+		t.Error("Expected an error for an unknown device")
+	}
+}
+
+func TestProvisioningHandler_GetDHCPConfig(t *testing.T) {
+	_, handler := setupResponderTest(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/provisioning/dhcp?host=192.168.1.10", nil)
+	rr := httptest.NewRecorder()
+	handler.GetDHCPConfig(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+
+	var resp DHCPConfigResponse
+	decodeResponse(t, rr, &resp)
+
+	wantURL := "http://192.168.1.10:8080/api/provision/mac/"
+	if resp.ProvisioningURL != wantURL {
+		t.Errorf("Expected %q, got %q", wantURL, resp.ProvisioningURL)
+	}
+	if len(resp.Options) != 2 || resp.Options[0].Code != 66 || resp.Options[1].Code != 160 {
+		t.Fatalf("Expected options 66 and 160, got %+v", resp.Options)
+	}
+	if resp.Options[0].Hex != "687474703a2f2f3139322e3136382e312e31303a383038302f6170692f70726f766973696f6e2f6d61632f" {
+		t.Errorf("Unexpected option 66 hex value %q", resp.Options[0].Hex)
+	}
+	if !strings.Contains(resp.Snippets["dnsmasq"], "dhcp-option=66,\""+wantURL+"\"") {
+		t.Errorf("Unexpected dnsmasq snippet %q", resp.Snippets["dnsmasq"])
+	}
+	if !resp.ResponderEnabled {
+		t.Error("Expected responder to be reported as enabled")
+	}
+}
+
+func TestProvisioningHandler_GetDHCPConfig_InvalidHost(t *testing.T) {
+	_, handler := setupResponderTest(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/provisioning/dhcp?host=evil.com/x", nil)
+	rr := httptest.NewRecorder()
+	handler.GetDHCPConfig(rr, req)
+	assertStatus(t, rr, http.StatusBadRequest)
+}
+
+func TestProvisioningHandler_SelfTest(t *testing.T) {
+	_, handler := setupResponderTest(t)
+
+	// Serve the responder the way the router does
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filename := strings.TrimPrefix(r.URL.Path, "/api/provision/mac/")
+		handler.GetConfigByMAC(w, withURLParams(r, map[string]string{"filename": filename}))
+	}))
+	defer server.Close()
+
+	selfTest := func(url string) SelfTestResponse {
+		body, _ := json.Marshal(SelfTestRequest{URL: url})
+		req := httptest.NewRequest(http.MethodPost, "/api/provisioning/dhcp/self-test", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler.SelfTest(rr, req)
+		assertStatus(t, rr, http.StatusOK)
+
+		var resp SelfTestResponse
+		decodeResponse(t, rr, &resp)
+		return resp
+	}
+
+	checks := func(resp SelfTestResponse) map[string]bool {
+		result := make(map[string]bool)
+		for _, c := range resp.Checks {
+			result[c.Name] = c.OK
+		}
+		return result
+	}
+
+	// The test server listens on loopback, which phones cannot reach,
+	// but the probe file itself is fetched successfully
+	resp := selfTest(server.URL + "/api/provision/mac/")
+	got := checks(resp)
+	if resp.OK || got["host"] || !got["responder_enabled"] || !got["http_fetch"] {
+		t.Errorf("Unexpected self-test result %+v", resp)
+	}
+
+	// A URL that does not serve the responder fails the fetch check
+	resp = selfTest(server.URL + "/other/")
+	if checks(resp)["http_fetch"] {
+		t.Errorf("Expected fetch check to fail, got %+v", resp)
+	}
+}
+
+func TestProvisioningHandler_SelfTest_InvalidURL(t *testing.T) {
+	_, handler := setupResponderTest(t)
+
+	body, _ := json.Marshal(SelfTestRequest{URL: "ftp://192.168.1.10/"})
+	req := httptest.NewRequest(http.MethodPost, "/api/provisioning/dhcp/self-test", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler.SelfTest(rr, req)
+	assertStatus(t, rr, http.StatusBadRequest)
+}
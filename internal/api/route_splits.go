@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/rules"
+	"github.com/go-chi/chi/v5"
+)
+
+// SplitTargetStats is how many calls one target of a split route received
+type SplitTargetStats struct {
+	Target     int        `json:"target"` // Index into the split action's targets
+	Label      string     `json:"label,omitempty"`
+	ActionType string     `json:"action_type"`
+	Percent    int        `json:"percent,omitempty"` // Configured share in percent mode
+	Calls      int64      `json:"calls"`
+	Share      float64    `json:"share"` // Actual share of calls, in percent
+	LastCallAt *time.Time `json:"last_call_at,omitempty"`
+}
+
+// SplitStatsResponse is the distribution of calls across a split route's targets
+type SplitStatsResponse struct {
+	RouteID    int64              `json:"route_id"`
+	Mode       string             `json:"mode"`
+	TotalCalls int64              `json:"total_calls"`
+	Targets    []SplitTargetStats `json:"targets"`
+}
+
+// SplitStats returns how calls to a split route were distributed since its
+// targets last changed
+func (h *RouteHandler) SplitStats(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid route ID", nil)
+		return
+	}
+
+	route, err := h.deps.DB.Routes.GetByID(r.Context(), id)
+	if err != nil {
+		if err == db.ErrRouteNotFound {
+			WriteNotFoundError(w, "Route")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	var action rules.SplitAction
+	if route.ActionType != "split" || json.Unmarshal(route.ActionData, &action) != nil {
+		WriteValidationError(w, "Route doesn't split calls", nil)
+		return
+	}
+
+	counts, err := h.deps.DB.RouteSplits.Counts(r.Context(), id)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	resp := &SplitStatsResponse{RouteID: id, Mode: action.Mode, Targets: make([]SplitTargetStats, len(action.Targets))}
+	if resp.Mode == "" {
+		resp.Mode = rules.SplitPercent
+	}
+	for i, t := range action.Targets {
+		resp.Targets[i] = SplitTargetStats{Target: i, Label: t.Label, ActionType: t.ActionType, Percent: t.Percent}
+	}
+	for _, c := range counts {
+		if c.Target < len(resp.Targets) {
+			resp.Targets[c.Target].Calls = c.Calls
+			resp.Targets[c.Target].LastCallAt = c.LastCallAt
+			resp.TotalCalls += c.Calls
+		}
+	}
+	if resp.TotalCalls > 0 {
+		for i := range resp.Targets {
+			share := float64(resp.Targets[i].Calls) * 100 / float64(resp.TotalCalls)
+			resp.Targets[i].Share = math.Round(share*10) / 10
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
+}
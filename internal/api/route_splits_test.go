@@ -0,0 +1,99 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRouteHandler_Split(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewRouteHandler(&Dependencies{DB: setup.DB})
+	did := createTestDID(t, setup.DB, "+15551234567")
+	ctx := context.Background()
+
+	send := func(method string, body interface{}, params map[string]string, fn http.HandlerFunc) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := withURLParams(httptest.NewRequest(method, "/api/routes", bytes.NewReader(data)), params)
+		rr := httptest.NewRecorder()
+		fn(rr, req)
+		return rr
+	}
+
+	// Targets must name existing schedules like route actions do
+	rr := send(http.MethodPost, CreateRouteRequest{
+		DIDID: &did.ID, Name: "Split", ConditionType: "default", ActionType: "split", Enabled: true,
+		ActionData: json.RawMessage(`{"targets":[{"percent":50,"action_type":"oncall","action_data":{"schedule_id":99}},{"percent":50,"action_type":"voicemail"}]}`),
+	}, nil, handler.Create)
+	assertStatus(t, rr, http.StatusBadRequest)
+	var errResp ErrorResponse
+	decodeResponse(t, rr, &errResp)
+	if len(errResp.Error.Details) != 1 || errResp.Error.Details[0].Field != "action_data.targets[0].action_data.schedule_id" {
+		t.Errorf("Unexpected errors: %+v", errResp.Error.Details)
+	}
+
+	split := json.RawMessage(`{"targets":[{"label":"Service","percent":50,"action_type":"forward","action_data":{"number":"+15550000001"}},{"label":"Cell","percent":50,"action_type":"forward","action_data":{"number":"+15550000002"}}]}`)
+	rr = send(http.MethodPost, CreateRouteRequest{
+		DIDID: &did.ID, Name: "Split", ConditionType: "default", ActionType: "split", ActionData: split, Enabled: true,
+	}, nil, handler.Create)
+	assertStatus(t, rr, http.StatusCreated)
+	var route RouteResponse
+	decodeResponse(t, rr, &route)
+	id := map[string]string{"id": strconv.FormatInt(route.ID, 10)}
+
+	for _, target := range []int{0, 0, 0, 1} {
+		if err := setup.DB.RouteSplits.Increment(ctx, route.ID, target, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rr = send(http.MethodGet, nil, id, handler.SplitStats)
+	assertStatus(t, rr, http.StatusOK)
+	var stats SplitStatsResponse
+	decodeResponse(t, rr, &stats)
+	if stats.Mode != "percent" || stats.TotalCalls != 4 || len(stats.Targets) != 2 {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+	if s := stats.Targets[0]; s.Label != "Service" || s.Calls != 3 || s.Share != 75 || s.Percent != 50 {
+		t.Errorf("Unexpected first target: %+v", s)
+	}
+
+	// Changing the targets starts counting again
+	rr = send(http.MethodPut, CreateRouteRequest{
+		DIDID: &did.ID, ActionData: json.RawMessage(`{"mode":"round_robin","targets":[{"action_type":"voicemail"},{"action_type":"reject"}]}`), Enabled: true,
+	}, id, handler.Update)
+	assertStatus(t, rr, http.StatusOK)
+	if counts, _ := setup.DB.RouteSplits.Counts(ctx, route.ID); len(counts) != 0 {
+		t.Errorf("Expected the counters to reset, got %+v", counts)
+	}
+
+	other := createTestRoute(t, setup, "Ring", &did.ID)
+	rr = send(http.MethodGet, nil, map[string]string{"id": strconv.FormatInt(other.ID, 10)}, handler.SplitStats)
+	assertStatus(t, rr, http.StatusBadRequest)
+}
+
+func TestWebhookHandler_RouteCall_Split(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+	did := createTestDID(t, setup.DB, "+15551234567")
+	ctx := context.Background()
+
+	route := createTestRoute(t, setup, "Split", &did.ID)
+	route.ActionType = "split"
+	route.ActionData = json.RawMessage(`{"mode":"round_robin","targets":[{"action_type":"forward","action_data":{"number":"+15550000001"}},{"action_type":"reject"}]}`)
+	if err := setup.DB.Routes.Update(ctx, route); err != nil {
+		t.Fatal(err)
+	}
+
+	first := handler.routeCall(ctx, did, "+15559876543", "CA1", "")
+	second := handler.routeCall(ctx, did, "+15559876543", "CA2", "")
+	if !strings.Contains(first, "+15550000001") || !strings.Contains(second, "Reject") {
+		t.Errorf("Expected the calls to take turns, got %s then %s", first, second)
+	}
+}
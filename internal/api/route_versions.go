@@ -0,0 +1,221 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// RouteFieldChange is one field a route version changed
+type RouteFieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// RouteVersionResponse is a route version with the fields it changed
+type RouteVersionResponse struct {
+	ID        int64          `json:"id"`
+	RouteID   int64          `json:"route_id"`
+	Version   int            `json:"version"`
+	Change    string         `json:"change"`
+	Route     *RouteResponse `json:"route"`
+	UserID    *int64         `json:"user_id,omitempty"`
+	UserEmail string         `json:"user_email,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	// Diff compares the route with its previous version. It's empty for
+	// created and deleted routes and when older versions were pruned.
+	Diff []RouteFieldChange `json:"diff"`
+}
+
+// RollbackRouteRequest names the version to roll a route back to
+type RollbackRouteRequest struct {
+	Version int `json:"version"`
+}
+
+// recordVersion saves the route's new state in its history. A failure
+// doesn't undo the change, so it is only logged.
+func (h *RouteHandler) recordVersion(ctx context.Context, change string, route *models.Route) {
+	if _, err := h.deps.DB.RouteVersions.Record(ctx, change, route, GetUserFromContext(ctx)); err != nil {
+		slog.Warn("Failed to record route version", "route_id", route.ID, "change", change, "error", err)
+	}
+}
+
+// Versions returns the history of a route, newest first. Deleted routes
+// keep their history.
+func (h *RouteHandler) Versions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid route ID", nil)
+		return
+	}
+
+	versions, err := h.deps.DB.RouteVersions.ListByRoute(r.Context(), id)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if len(versions) == 0 {
+		WriteNotFoundError(w, "Route history")
+		return
+	}
+
+	response := make([]*RouteVersionResponse, len(versions))
+	for i, v := range versions {
+		var prev *models.RouteVersion
+		if i+1 < len(versions) {
+			prev = versions[i+1]
+		}
+		response[i] = toRouteVersionResponse(v, prev)
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"data": response})
+}
+
+// History returns the latest changes to all routes, newest first
+func (h *RouteHandler) History(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 500 {
+			WriteValidationError(w, "Validation failed", []FieldError{
+				{Field: "limit", Message: "Limit must be between 1 and 500"},
+			})
+			return
+		}
+		limit = n
+	}
+
+	versions, err := h.deps.DB.RouteVersions.ListRecent(r.Context(), limit)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	response := make([]*RouteVersionResponse, len(versions))
+	for i, v := range versions {
+		var prev *models.RouteVersion
+		if v.Version > 1 {
+			prev, _ = h.deps.DB.RouteVersions.Get(r.Context(), v.RouteID, v.Version-1)
+		}
+		response[i] = toRouteVersionResponse(v, prev)
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"data": response})
+}
+
+// Rollback restores a route to one of its versions, recreating it if it was
+// deleted. The rollback is recorded as a new version.
+func (h *RouteHandler) Rollback(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid route ID", nil)
+		return
+	}
+
+	var req RollbackRouteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	version, err := h.deps.DB.RouteVersions.Get(r.Context(), id, req.Version)
+	if err != nil {
+		if err == db.ErrRouteVersionNotFound {
+			WriteNotFoundError(w, "Route version")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	route := version.Route
+	if route.DIDID != nil {
+		if _, err := h.deps.DB.DIDs.GetByID(r.Context(), *route.DIDID); err == db.ErrDIDNotFound {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "The route's DID no longer exists", nil)
+			return
+		}
+	}
+
+	if err := h.deps.DB.Routes.Restore(r.Context(), &route); err != nil {
+		WriteInternalError(w)
+		return
+	}
+	h.recordVersion(r.Context(), "rolled_back", &route)
+
+	WriteJSON(w, http.StatusOK, toRouteResponse(&route))
+}
+
+func toRouteVersionResponse(v, prev *models.RouteVersion) *RouteVersionResponse {
+	resp := &RouteVersionResponse{
+		ID:        v.ID,
+		RouteID:   v.RouteID,
+		Version:   v.Version,
+		Change:    v.Change,
+		Route:     toRouteResponse(&v.Route),
+		UserID:    v.UserID,
+		UserEmail: v.UserEmail,
+		CreatedAt: v.CreatedAt,
+		Diff:      []RouteFieldChange{},
+	}
+	if prev != nil && v.Change != "deleted" {
+		resp.Diff = routeDiff(&prev.Route, &v.Route)
+	}
+	return resp
+}
+
+// routeDiff lists the fields that differ between two states of a route
+func routeDiff(old, cur *models.Route) []RouteFieldChange {
+	changes := []RouteFieldChange{}
+	add := func(field string, o, n interface{}) {
+		changes = append(changes, RouteFieldChange{Field: field, Old: o, New: n})
+	}
+
+	if !sameDID(old.DIDID, cur.DIDID) {
+		add("did_id", old.DIDID, cur.DIDID)
+	}
+	if old.Priority != cur.Priority {
+		add("priority", old.Priority, cur.Priority)
+	}
+	if old.Name != cur.Name {
+		add("name", old.Name, cur.Name)
+	}
+	if old.ConditionType != cur.ConditionType {
+		add("condition_type", old.ConditionType, cur.ConditionType)
+	}
+	if !sameJSON(old.ConditionData, cur.ConditionData) {
+		add("condition_data", old.ConditionData, cur.ConditionData)
+	}
+	if old.ActionType != cur.ActionType {
+		add("action_type", old.ActionType, cur.ActionType)
+	}
+	if !sameJSON(old.ActionData, cur.ActionData) {
+		add("action_data", old.ActionData, cur.ActionData)
+	}
+	if old.Enabled != cur.Enabled {
+		add("enabled", old.Enabled, cur.Enabled)
+	}
+	return changes
+}
+
+func sameDID(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// sameJSON compares JSON values ignoring whitespace
+func sameJSON(a, b json.RawMessage) bool {
+	var ca, cb bytes.Buffer
+	if json.Compact(&ca, a) != nil || json.Compact(&cb, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(ca.Bytes(), cb.Bytes())
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/db"
+)
+
+func TestRouteHandler_VersionsAndRollback(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewRouteHandler(&Dependencies{DB: setup.DB})
+	admin := createTestUser(t, setup.DB, "admin@example.com", "password123", "admin")
+	did := createTestDID(t, setup.DB, "+15551234567")
+
+	send := func(method, path string, body interface{}, params map[string]string, fn http.HandlerFunc) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(data))
+		req = withURLParams(req, params)
+		req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, admin))
+		rr := httptest.NewRecorder()
+		fn(rr, req)
+		return rr
+	}
+
+	rr := send(http.MethodPost, "/api/routes", CreateRouteRequest{
+		DIDID: &did.ID, Priority: 1, Name: "Main", ConditionType: "default",
+		ActionType: "forward", ActionData: json.RawMessage(`{"number":"+15550000001"}`), Enabled: true,
+	}, nil, handler.Create)
+	assertStatus(t, rr, http.StatusCreated)
+	var route RouteResponse
+	decodeResponse(t, rr, &route)
+	id := map[string]string{"id": strconv.FormatInt(route.ID, 10)}
+
+	// A bad edit, then the route is deleted
+	rr = send(http.MethodPut, "/api/routes/1", CreateRouteRequest{
+		DIDID: &did.ID, Priority: 1, ActionData: json.RawMessage(`{"number": "+15559999999"}`), Enabled: true,
+	}, id, handler.Update)
+	assertStatus(t, rr, http.StatusOK)
+	assertStatus(t, send(http.MethodDelete, "/api/routes/1", nil, id, handler.Delete), http.StatusOK)
+
+	rr = send(http.MethodGet, "/api/routes/1/versions", nil, id, handler.Versions)
+	assertStatus(t, rr, http.StatusOK)
+	var versions struct {
+		Data []*RouteVersionResponse `json:"data"`
+	}
+	decodeResponse(t, rr, &versions)
+	if len(versions.Data) != 3 || versions.Data[0].Change != "deleted" || versions.Data[2].Change != "created" {
+		t.Fatalf("Versions = %+v", versions.Data)
+	}
+	updated := versions.Data[1]
+	if updated.UserEmail != "admin@example.com" || len(updated.Diff) != 1 || updated.Diff[0].Field != "action_data" {
+		t.Errorf("Update version = %+v", updated)
+	}
+
+	rr = send(http.MethodPost, "/api/routes/1/rollback", RollbackRouteRequest{Version: 1}, id, handler.Rollback)
+	assertStatus(t, rr, http.StatusOK)
+	restored, err := setup.DB.Routes.GetByID(context.Background(), route.ID)
+	if err != nil || string(restored.ActionData) != `{"number":"+15550000001"}` {
+		t.Fatalf("Restored route = %+v, %v", restored, err)
+	}
+
+	rr = send(http.MethodGet, "/api/routes/history", nil, nil, handler.History)
+	assertStatus(t, rr, http.StatusOK)
+	decodeResponse(t, rr, &versions)
+	if len(versions.Data) != 4 || versions.Data[0].Change != "rolled_back" || versions.Data[0].Version != 4 {
+		t.Errorf("History = %+v", versions.Data)
+	}
+
+	rr = send(http.MethodPost, "/api/routes/1/rollback", RollbackRouteRequest{Version: 9}, id, handler.Rollback)
+	assertStatus(t, rr, http.StatusNotFound)
+
+	// Rolling back to a DID that was deleted since fails
+	setup.DB.DIDs.Delete(context.Background(), did.ID)
+	rr = send(http.MethodPost, "/api/routes/1/rollback", RollbackRouteRequest{Version: 2}, id, handler.Rollback)
+	assertStatus(t, rr, http.StatusConflict)
+	assertErrorCode(t, rr, ErrCodeConflict)
+}
+
+func TestRouteHandler_ReorderRecordsVersions(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewRouteHandler(&Dependencies{DB: setup.DB})
+	a := createTestRoute(t, setup, "A", nil)
+	b := createTestRoute(t, setup, "B", nil)
+
+	body, _ := json.Marshal(ReorderRequest{Priorities: map[int64]int{a.ID: 1, b.ID: 0}})
+	rr := httptest.NewRecorder()
+	handler.Reorder(rr, httptest.NewRequest(http.MethodPut, "/api/routes/reorder", bytes.NewReader(body)))
+	assertStatus(t, rr, http.StatusOK)
+
+	if _, err := setup.DB.RouteVersions.Get(context.Background(), a.ID, 1); err != db.ErrRouteVersionNotFound {
+		t.Errorf("Expected no version for an unmoved route, got %v", err)
+	}
+	v, err := setup.DB.RouteVersions.Get(context.Background(), b.ID, 1)
+	if err != nil || v.Change != "reordered" || v.Route.Priority != 0 || v.UserID != nil {
+		t.Errorf("Version = %+v, %v", v, err)
+	}
+}
@@ -4,31 +4,27 @@ package api
 import (
 	"net/http"
 
+	"github.com/btafoya/gosip/internal/config"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/cors"
 )
 
 // NewRouter creates and configures the API router
 func NewRouter(deps *Dependencies) chi.Router {
 	r := chi.NewRouter()
+	root := r // Requests of tenant users are matched against the whole router
 
 	// Middleware stack
 	r.Use(middleware.RequestID)
+	r.Use(PeerAddrMiddleware)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
+	r.Use(RecoverMiddleware(deps))
 	r.Use(middleware.Compress(5))
+	r.Use(LocaleMiddleware(deps.DB))
 
-	// CORS configuration with secure origin restrictions
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   deps.Config.CORSOrigins,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	}))
+	// CORS, from GOSIP_CORS_ORIGINS or the policy set by an admin
+	r.Use(CORSMiddleware(deps))
 
 	// Initialize handlers
 	authHandler := NewAuthHandler(deps)
@@ -36,6 +32,7 @@ func NewRouter(deps *Dependencies) chi.Router {
 	didHandler := NewDIDHandler(deps)
 	routeHandler := NewRouteHandler(deps)
 	cdrHandler := NewCDRHandler(deps)
+	recordingHandler := NewRecordingHandler(deps)
 	voicemailHandler := NewVoicemailHandler(deps)
 	messageHandler := NewMessageHandler(deps)
 	systemHandler := NewSystemHandler(deps)
@@ -44,6 +41,43 @@ func NewRouter(deps *Dependencies) chi.Router {
 	callHandler := NewCallHandler(deps)
 	mwiHandler := NewMWIHandler(deps)
 	tlsHandler := NewTLSHandler(deps)
+	greetingHandler := NewGreetingHandler(deps)
+	dashboardHandler := NewDashboardHandler(deps)
+	eventHandler := NewEventHandler(deps)
+	announcementHandler := NewAnnouncementHandler(deps)
+	passwordPolicyHandler := NewPasswordPolicyHandler(deps)
+	readOnlyHandler := NewReadOnlyHandler(deps)
+	loggingHandler := NewLoggingHandler(deps)
+	diagnosticsHandler := NewDiagnosticsHandler(deps)
+	selfTestHandler := NewSelfTestHandler(deps)
+	sipDNSHandler := NewSIPDNSHandler(deps)
+	wanIPHandler := NewWANIPHandler(deps)
+	trunkFailoverHandler := NewTrunkFailoverHandler(deps)
+	trunkEdgeHandler := NewTrunkEdgeHandler(deps)
+	providerTrunkHandler := NewProviderTrunkHandler(deps)
+	portMapHandler := NewPortMapHandler(deps)
+	replicaHandler := NewReplicaHandler(deps)
+	mailGatewayHandler := NewMailGatewayHandler(deps)
+	calendarHandler := NewCalendarHandler(deps)
+	onCallHandler := NewOnCallHandler(deps)
+	escalationPolicyHandler := NewEscalationPolicyHandler(deps)
+	changeSetHandler := NewChangeSetHandler(deps)
+	timelineHandler := NewTimelineHandler(deps)
+	numberHandler := NewNumberHandler(deps)
+	corsHandler := NewCORSHandler(deps)
+	emailHandler := NewEmailHandler(deps)
+	preferenceHandler := NewPreferenceHandler(deps)
+	didWebhookHandler := NewDIDWebhookHandler(deps)
+	publicURLHandler := NewPublicURLHandler(deps)
+	complianceExportHandler := NewComplianceExportHandler(deps)
+	verifyHandler := NewVerifyHandler(deps)
+	billingHandler := NewBillingHandler(deps)
+	storageHandler := NewStorageHandler(deps)
+	mediaIntegrityHandler := NewMediaIntegrityHandler(deps)
+	twilioRangesHandler := NewTwilioRangesHandler(deps)
+	webPhoneHandler := NewWebPhoneHandler(deps)
+	reminderHandler := NewReminderHandler(deps)
+	tenantHandler := NewTenantHandler(deps)
 
 	// Health endpoints
 	healthHandler := NewHealthHandler("0.1.0")
@@ -52,14 +86,31 @@ func NewRouter(deps *Dependencies) chi.Router {
 	r.Get("/api/ready", healthHandler.Ready)
 	r.Get("/api/live", healthHandler.Live)
 
+	// Plaintext status for legacy monitoring (opt-in, GOSIP_STATUS_PAGE)
+	if deps.Config.StatusPage {
+		r.Get("/status.txt", NewStatusPageHandler(deps).Status)
+	}
+
+	// Short links in outbound messages (public, counted per click)
+	r.Get(config.ShortLinkPath+"{code}", messageHandler.FollowShortLink)
+
 	// Public routes
 	r.Route("/api", func(r chi.Router) {
+		// Management network allowlist (GOSIP_API_ALLOWLIST)
+		r.Use(APIAllowlistMiddleware(deps.Config.APIAllowlist, false))
+
+		// Read-only mode (GOSIP_READ_ONLY or toggled by an admin)
+		r.Use(ReadOnlyMiddleware(deps))
+
 		// Auth routes (public)
 		r.Route("/auth", func(r chi.Router) {
 			r.Post("/login", authHandler.Login)
 			r.Post("/logout", authHandler.Logout)
 		})
 
+		// Password policy (public, so signup and setup forms can show the rules)
+		r.Get("/password-policy", passwordPolicyHandler.Get)
+
 		// Setup route (only accessible if setup not complete)
 		r.Route("/setup", func(r chi.Router) {
 			r.Use(SetupOnlyMiddleware(deps.DB))
@@ -71,32 +122,97 @@ func NewRouter(deps *Dependencies) chi.Router {
 		r.Route("/webhooks", func(r chi.Router) {
 			r.Post("/voice/incoming", webhookHandler.VoiceIncoming)
 			r.Post("/voice/status", webhookHandler.VoiceStatus)
+			r.Post("/voice/screen", webhookHandler.VoiceScreen)
+			r.Post("/voice/whisper", webhookHandler.VoiceWhisper)
+			r.Post("/voice/forward", webhookHandler.VoiceForward)
+			r.Post("/voice/forward/answered", webhookHandler.VoiceForwardAnswered)
+			r.Post("/voice/oncall", webhookHandler.VoiceOnCall)
+			r.Post("/voice/escalation", webhookHandler.VoiceEscalation)
+			r.Post("/voice/escalation/prompt", webhookHandler.VoiceEscalationPrompt)
+			r.Post("/voice/escalation/accept", webhookHandler.VoiceEscalationAccept)
+			r.Post("/voice/reminder", webhookHandler.VoiceReminder)
 			r.Post("/sms/incoming", webhookHandler.SMSIncoming)
 			r.Post("/sms/status", webhookHandler.SMSStatus)
 			r.Post("/recording", webhookHandler.Recording)
 			r.Post("/transcription", webhookHandler.Transcription)
+
+			// Voicemail greeting feature code
+			r.Post("/greetings/feature", greetingHandler.FeatureCode)
+			r.Post("/greetings/mailbox", greetingHandler.SelectMailbox)
+			r.Post("/greetings/menu", greetingHandler.Menu)
+			r.Post("/greetings/recorded", greetingHandler.Recorded)
+			r.Post("/greetings/review", greetingHandler.Review)
 		})
 
 		// Device provisioning endpoint (public, secured by token)
 		r.Get("/provision/{token}", provisioningHandler.GetDeviceConfig)
 
+		// DHCP option 66/160 responder (public, LAN clients only, opt-in)
+		r.Get("/provision/mac/{filename}", provisioningHandler.GetConfigByMAC)
+
+		// Device telemetry beacons (public, LAN clients only)
+		r.Get("/provision/beacon", provisioningHandler.Beacon)
+		r.Post("/provision/beacon", provisioningHandler.Beacon)
+
+		// Voicemail podcast feeds (public, secured by token)
+		r.Get("/feeds/voicemail/{token}", voicemailHandler.Feed)
+		r.Get("/feeds/voicemail/{token}/{file}", voicemailHandler.FeedAudio)
+
+		// On-call rotation calendar feeds (public, secured by token)
+		r.Get("/feeds/oncall/{token}", onCallHandler.ICalFeed)
+
 		// Protected routes
 		r.Group(func(r chi.Router) {
 			r.Use(AuthMiddleware(deps))
+			r.Use(TenantRoutesMiddleware(root))
 
 			// Current user
 			r.Get("/me", authHandler.GetCurrentUser)
 			r.Put("/me/password", authHandler.ChangePassword)
+			r.Put("/me/language", authHandler.SetLanguage)
+			r.Put("/me/caller-id", authHandler.SetCallerID)
+			r.Get("/me/notifications", authHandler.GetNotificationSettings)
+			r.Put("/me/notifications", authHandler.UpdateNotificationSettings)
+			r.Get("/me/calendar", calendarHandler.Get)
+			r.Put("/me/calendar", calendarHandler.Update)
+			r.Delete("/me/calendar", calendarHandler.Delete)
+			r.Post("/me/calendar/sync", calendarHandler.Sync)
+			r.Get("/me/phone", webPhoneHandler.GetStatus)
+			r.Post("/me/phone/credentials", webPhoneHandler.IssueCredentials)
+			r.Delete("/me/phone/credentials", webPhoneHandler.SignOut)
+
+			// Per-user preferences, a user's own or any user's for admins
+			r.Get("/users/{id}/preferences", preferenceHandler.Get)
+			r.Put("/users/{id}/preferences", preferenceHandler.Update)
+			r.Delete("/users/{id}/preferences/{key}", preferenceHandler.Delete)
+
+			// Announcement banners
+			r.Get("/announcements", announcementHandler.ListActive)
+
+			// Read-only mode state
+			r.Get("/read-only", readOnlyHandler.Get)
 
 			// Devices
 			r.Route("/devices", func(r chi.Router) {
 				r.Get("/", deviceHandler.List)
 				r.Post("/", deviceHandler.Create)
 				r.Get("/registrations", deviceHandler.GetRegistrations)
+				r.Get("/subscriptions", deviceHandler.GetSubscriptions)
 				r.Get("/{id}", deviceHandler.Get)
 				r.Put("/{id}", deviceHandler.Update)
 				r.Delete("/{id}", deviceHandler.Delete)
 				r.Get("/{id}/events", provisioningHandler.GetDeviceEvents)
+				r.Get("/{id}/health", deviceHandler.Health)
+				r.Get("/{id}/dids", deviceHandler.ListDIDs)
+				r.Put("/{id}/dids", deviceHandler.SetDIDs)
+				r.Post("/{id}/credentials/rotate", deviceHandler.RotateCredentials)
+
+				// Remote reboot and resync (admin only)
+				r.Group(func(r chi.Router) {
+					r.Use(AdminOnlyMiddleware)
+					r.Use(APIAllowlistMiddleware(deps.Config.APIAllowlist, true))
+					r.Post("/{id}/actions", deviceHandler.Action)
+				})
 			})
 
 			// Provisioning
@@ -116,16 +232,52 @@ func NewRouter(deps *Dependencies) chi.Router {
 				})
 			})
 
+			// Dashboard (aggregated, cached server-side)
+			r.Get("/dashboard", dashboardHandler.Get)
+
+			// Event stream (Server-Sent Events or WebSocket)
+			r.Get("/events/sse", eventHandler.StreamSSE)
+			r.Get("/events/ws", eventHandler.StreamWebSocket)
+
 			// DIDs
 			r.Route("/dids", func(r chi.Router) {
 				r.Get("/", didHandler.List)
 				r.Post("/", didHandler.Create)
 				r.Post("/sync", didHandler.SyncFromTwilio)
 				r.Get("/{id}", didHandler.Get)
+				r.Get("/{id}/flow", didHandler.Flow)
 				r.Put("/{id}", didHandler.Update)
 				r.Delete("/{id}", didHandler.Delete)
 			})
 
+			// Voicemail greetings (voicemail boxes are keyed by DID)
+			r.Route("/voicemail-boxes/{didID}/greetings", func(r chi.Router) {
+				r.Get("/", greetingHandler.List)
+				r.Put("/{type}", greetingHandler.Save)
+				r.Put("/{type}/active", greetingHandler.Activate)
+				r.Get("/{type}/audio", greetingHandler.Audio)
+				r.Put("/{type}/audio", greetingHandler.UploadAudio)
+				r.Delete("/{type}", greetingHandler.Delete)
+			})
+
+			// Voicemail podcast feeds
+			r.Route("/voicemail-boxes/{didID}/feed", func(r chi.Router) {
+				r.Get("/", voicemailHandler.GetFeed)
+				r.Post("/", voicemailHandler.CreateFeed)
+				r.Delete("/", voicemailHandler.DeleteFeed)
+			})
+
+			// Shared voicemail boxes
+			r.Get("/voicemail-boxes/{didID}/members", voicemailHandler.ListMembers)
+			r.Put("/voicemail-boxes/{didID}/members", voicemailHandler.SetMembers)
+
+			// Voicemail storage quotas
+			r.Route("/voicemail-boxes/{didID}/quota", func(r chi.Router) {
+				r.Get("/", voicemailHandler.GetQuota)
+				r.Put("/", voicemailHandler.UpdateQuota)
+				r.Delete("/", voicemailHandler.DeleteQuota)
+			})
+
 			// Routes
 			r.Route("/routes", func(r chi.Router) {
 				r.Get("/", routeHandler.List)
@@ -134,6 +286,10 @@ func NewRouter(deps *Dependencies) chi.Router {
 				r.Put("/{id}", routeHandler.Update)
 				r.Delete("/{id}", routeHandler.Delete)
 				r.Put("/reorder", routeHandler.Reorder)
+				r.Get("/history", routeHandler.History)
+				r.Get("/{id}/versions", routeHandler.Versions)
+				r.Post("/{id}/rollback", routeHandler.Rollback)
+				r.Get("/{id}/stats", routeHandler.SplitStats)
 			})
 
 			// CDRs (Call Detail Records)
@@ -141,6 +297,38 @@ func NewRouter(deps *Dependencies) chi.Router {
 				r.Get("/", cdrHandler.List)
 				r.Get("/stats", cdrHandler.GetStats)
 				r.Get("/{id}", cdrHandler.Get)
+
+				// Reclassify call history (admin only)
+				r.Group(func(r chi.Router) {
+					r.Use(AdminOnlyMiddleware)
+					r.Use(APIAllowlistMiddleware(deps.Config.APIAllowlist, true))
+					r.Post("/reprocess", cdrHandler.Reprocess)
+				})
+			})
+
+			// Server-side call recordings
+			r.Route("/recordings", func(r chi.Router) {
+				r.Get("/", recordingHandler.List)
+				r.Get("/{id}", recordingHandler.Get)
+				r.Get("/{id}/audio", recordingHandler.Audio)
+
+				// Delete recordings (admin only)
+				r.Group(func(r chi.Router) {
+					r.Use(AdminOnlyMiddleware)
+					r.Use(APIAllowlistMiddleware(deps.Config.APIAllowlist, true))
+					r.Delete("/{id}", recordingHandler.Delete)
+				})
+			})
+
+			// Cost estimation and reconciliation (admin only)
+			r.Route("/billing", func(r chi.Router) {
+				r.Use(AdminOnlyMiddleware)
+				r.Use(APIAllowlistMiddleware(deps.Config.APIAllowlist, true))
+				r.Get("/rates", billingHandler.ListRates)
+				r.Post("/rates", billingHandler.ImportRates)
+				r.Delete("/rates", billingHandler.DeleteRates)
+				r.Get("/stats", billingHandler.GetStats)
+				r.Post("/sync", billingHandler.Sync)
 			})
 
 			// Active Calls (Call Control)
@@ -151,7 +339,18 @@ func NewRouter(deps *Dependencies) chi.Router {
 				r.Post("/moh/upload", callHandler.UploadMOHAudio)
 				r.Post("/moh/validate", callHandler.ValidateMOHAudio)
 				r.Get("/{callID}", callHandler.GetCall)
+				r.Get("/{callID}/diagnostics", callHandler.GetCallDiagnostics)
 				r.Post("/{callID}/hold", callHandler.HoldCall)
+				r.Post("/{callID}/announce", callHandler.Announce)
+				r.Get("/{callID}/recording", callHandler.GetCallRecording)
+				r.Post("/{callID}/recording", callHandler.RecordCall)
+				r.Get("/{callID}/conference", callHandler.GetCallConference)
+				r.Post("/{callID}/conference", callHandler.StartCallConference)
+				r.Post("/{callID}/conference/participants", callHandler.InviteConferenceParticipant)
+				r.Put("/{callID}/conference/participants/{participantID}", callHandler.UpdateConferenceParticipant)
+				r.Delete("/{callID}/conference/participants/{participantID}", callHandler.KickConferenceParticipant)
+				r.Post("/{callID}/dtmf", callHandler.SendDTMF)
+				r.Get("/{callID}/announcements", callHandler.ListAnnouncements)
 				r.Post("/{callID}/transfer", callHandler.TransferCall)
 				r.Delete("/{callID}/transfer", callHandler.CancelTransferCall)
 				r.Delete("/{callID}", callHandler.HangupCall)
@@ -162,7 +361,11 @@ func NewRouter(deps *Dependencies) chi.Router {
 				r.Get("/", voicemailHandler.List)
 				r.Get("/unread", voicemailHandler.ListUnread)
 				r.Get("/{id}", voicemailHandler.Get)
+				r.Get("/{id}/audio", voicemailHandler.Audio)
 				r.Put("/{id}/read", voicemailHandler.MarkAsRead)
+				r.Put("/{id}/unread", voicemailHandler.MarkUnread)
+				r.Put("/{id}/assignment", voicemailHandler.Assign)
+				r.Delete("/{id}/assignment", voicemailHandler.Unassign)
 				r.Delete("/{id}", voicemailHandler.Delete)
 			})
 
@@ -176,29 +379,113 @@ func NewRouter(deps *Dependencies) chi.Router {
 			r.Route("/messages", func(r chi.Router) {
 				r.Get("/", messageHandler.List)
 				r.Post("/", messageHandler.Send)
+				r.Get("/channels", messageHandler.Channels)
 				r.Get("/stats", messageHandler.GetStats)
 				r.Get("/unread/count", messageHandler.GetUnreadCount)
 				r.Get("/conversations", messageHandler.GetConversations)
 				r.Get("/conversation/{number}", messageHandler.GetConversation)
 				r.Put("/conversation/{number}/read", messageHandler.MarkConversationAsRead)
+				r.Get("/conversation/{number}/export", messageHandler.ExportConversation)
 				r.Get("/{id}", messageHandler.Get)
 				r.Put("/{id}/read", messageHandler.MarkAsRead)
 				r.Post("/{id}/resend", messageHandler.Resend)
 				r.Post("/{id}/sync", messageHandler.SyncFromTwilio)
 				r.Post("/{id}/cancel", messageHandler.Cancel)
+				r.Get("/{id}/links", messageHandler.GetLinks)
 				r.Delete("/{id}", messageHandler.Delete)
 			})
 
+			// Appointment reminders
+			r.Route("/reminders", func(r chi.Router) {
+				r.Get("/", reminderHandler.List)
+				r.Post("/", reminderHandler.Create)
+				r.Get("/{id}", reminderHandler.Get)
+				r.Put("/{id}", reminderHandler.Update)
+				r.Delete("/{id}", reminderHandler.Delete)
+			})
+
+			// Phone number verification codes for apps
+			r.Route("/verify", func(r chi.Router) {
+				r.Post("/start", verifyHandler.Start)
+				r.Post("/check", verifyHandler.Check)
+			})
+
+			// Caller journey: everything with an external number
+			r.Route("/numbers", func(r chi.Router) {
+				r.Get("/{number}/timeline", timelineHandler.Get)
+				r.Post("/{number}/notes", timelineHandler.CreateNote)
+				r.Delete("/{number}/notes/{id}", timelineHandler.DeleteNote)
+
+				// Duplicate spellings of a number (admin only)
+				r.Group(func(r chi.Router) {
+					r.Use(AdminOnlyMiddleware)
+					r.Use(APIAllowlistMiddleware(deps.Config.APIAllowlist, true))
+					r.Get("/duplicates", numberHandler.Duplicates)
+					r.Post("/{number}/merge", numberHandler.Merge)
+				})
+			})
+
 			// Blocklist
 			r.Route("/blocklist", func(r chi.Router) {
 				r.Get("/", routeHandler.ListBlocklist)
 				r.Post("/", routeHandler.AddToBlocklist)
 				r.Delete("/{id}", routeHandler.RemoveFromBlocklist)
+				r.Get("/check", routeHandler.CheckBlocklist)
+
+				// Community spam feeds (admin only)
+				r.Group(func(r chi.Router) {
+					r.Use(AdminOnlyMiddleware)
+					r.Use(APIAllowlistMiddleware(deps.Config.APIAllowlist, true))
+					r.Get("/feeds", routeHandler.ListBlocklistFeeds)
+					r.Post("/feeds", routeHandler.CreateBlocklistFeed)
+					r.Put("/feeds/{id}", routeHandler.UpdateBlocklistFeed)
+					r.Delete("/feeds/{id}", routeHandler.DeleteBlocklistFeed)
+					r.Post("/feeds/{id}/sync", routeHandler.SyncBlocklistFeed)
+				})
+			})
+
+			// On-call schedules
+			r.Route("/oncall", func(r chi.Router) {
+				r.Get("/", onCallHandler.List)
+				r.Post("/", onCallHandler.Create)
+				r.Get("/{id}", onCallHandler.Get)
+				r.Put("/{id}", onCallHandler.Update)
+				r.Delete("/{id}", onCallHandler.Delete)
+				r.Get("/{id}/shifts", onCallHandler.Shifts)
+				r.Post("/{id}/overrides", onCallHandler.CreateOverride)
+				r.Delete("/{id}/overrides/{overrideID}", onCallHandler.DeleteOverride)
+				r.Post("/{id}/ical-token", onCallHandler.RotateICalToken)
+			})
+
+			// Escalation policies
+			r.Route("/escalation-policies", func(r chi.Router) {
+				r.Get("/", escalationPolicyHandler.List)
+				r.Post("/", escalationPolicyHandler.Create)
+				r.Get("/{id}", escalationPolicyHandler.Get)
+				r.Put("/{id}", escalationPolicyHandler.Update)
+				r.Delete("/{id}", escalationPolicyHandler.Delete)
+			})
+
+			// Caller lists for distinctive ring
+			r.Route("/caller-lists", func(r chi.Router) {
+				r.Get("/", routeHandler.ListCallerLists)
+				r.Post("/", routeHandler.CreateCallerList)
+				r.Put("/{id}", routeHandler.UpdateCallerList)
+				r.Delete("/{id}", routeHandler.DeleteCallerList)
 			})
 
 			// Admin-only routes
 			r.Group(func(r chi.Router) {
 				r.Use(AdminOnlyMiddleware)
+				r.Use(APIAllowlistMiddleware(deps.Config.APIAllowlist, true))
+
+				// Point Twilio numbers at this server's webhooks
+				r.Post("/dids/configure-webhooks", didWebhookHandler.ConfigureAll)
+				r.Get("/dids/webhooks", didWebhookHandler.List)
+				r.Post("/dids/{id}/configure-webhooks", didWebhookHandler.Configure)
+				r.Get("/dids/{id}/webhooks", didWebhookHandler.Get)
+				r.Post("/dids/{id}/webhooks/verify", didWebhookHandler.Verify)
+				r.Delete("/dids/{id}/webhooks", didWebhookHandler.Delete)
 
 				// Users management
 				r.Route("/users", func(r chi.Router) {
@@ -209,16 +496,61 @@ func NewRouter(deps *Dependencies) chi.Router {
 					r.Delete("/{id}", authHandler.DeleteUser)
 				})
 
+				// Tenants sharing the instance
+				r.Route("/tenants", func(r chi.Router) {
+					r.Get("/", tenantHandler.List)
+					r.Post("/", tenantHandler.Create)
+					r.Get("/{id}", tenantHandler.Get)
+					r.Put("/{id}", tenantHandler.Update)
+					r.Delete("/{id}", tenantHandler.Delete)
+					r.Get("/{id}/config", tenantHandler.GetConfig)
+					r.Put("/{id}/config", tenantHandler.UpdateConfig)
+				})
+
+				// Scheduled setting and route changes
+				r.Route("/change-sets", func(r chi.Router) {
+					r.Get("/", changeSetHandler.List)
+					r.Post("/", changeSetHandler.Create)
+					r.Get("/{id}", changeSetHandler.Get)
+					r.Get("/{id}/preview", changeSetHandler.Preview)
+					r.Post("/{id}/apply", changeSetHandler.Apply)
+					r.Post("/{id}/revert", changeSetHandler.Revert)
+					r.Delete("/{id}", changeSetHandler.Cancel)
+				})
+
+				// SIP trunks to providers other than Twilio
+				r.Route("/trunks", func(r chi.Router) {
+					r.Get("/", providerTrunkHandler.List)
+					r.Post("/", providerTrunkHandler.Create)
+					r.Get("/{id}", providerTrunkHandler.Get)
+					r.Put("/{id}", providerTrunkHandler.Update)
+					r.Delete("/{id}", providerTrunkHandler.Delete)
+					r.Post("/{id}/register", providerTrunkHandler.Register)
+				})
+
 				// Provisioning profile management (admin only)
 				r.Post("/provisioning/profiles", provisioningHandler.CreateProfile)
 				r.Put("/provisioning/profiles/{id}", provisioningHandler.UpdateProfile)
 				r.Delete("/provisioning/profiles/{id}", provisioningHandler.DeleteProfile)
 
+				// LAN device discovery (admin only, opt-in via discovery_enabled)
+				r.Get("/provisioning/discovery", provisioningHandler.ListDiscovered)
+				r.Post("/provisioning/discovery/scan", provisioningHandler.ScanNetwork)
+				r.Post("/provisioning/discovery/{id}/adopt", provisioningHandler.AdoptDiscovered)
+				r.Delete("/provisioning/discovery/{id}", provisioningHandler.DismissDiscovered)
+
+				// DHCP provisioning URL advertisement
+				r.Get("/provisioning/dhcp", provisioningHandler.GetDHCPConfig)
+				r.Post("/provisioning/dhcp/self-test", provisioningHandler.SelfTest)
+
 				// System configuration
 				r.Route("/system", func(r chi.Router) {
 					r.Get("/config", systemHandler.GetConfig)
 					r.Put("/config", systemHandler.UpdateConfig)
+					r.Post("/config/validate", systemHandler.ValidateConfig)
+					r.Get("/config/effective", systemHandler.GetEffectiveConfig)
 					r.Get("/status", systemHandler.GetStatus)
+					r.Get("/workers", systemHandler.ListWorkers)
 
 					// Backup management
 					r.Route("/backups", func(r chi.Router) {
@@ -231,6 +563,103 @@ func NewRouter(deps *Dependencies) chi.Router {
 						r.Post("/cleanup", systemHandler.CleanOldBackups)
 					})
 
+					// Announcement banners
+					r.Route("/announcements", func(r chi.Router) {
+						r.Get("/", announcementHandler.List)
+						r.Post("/", announcementHandler.Create)
+						r.Put("/{id}", announcementHandler.Update)
+						r.Delete("/{id}", announcementHandler.Delete)
+					})
+
+					// Password policy
+					r.Put("/password-policy", passwordPolicyHandler.Update)
+
+					// Read-only mode
+					r.Put("/read-only", readOnlyHandler.Update)
+
+					// Cross-origin access for UIs on other origins
+					r.Get("/cors", corsHandler.Get)
+					r.Put("/cors", corsHandler.Update)
+					r.Delete("/cors", corsHandler.Reset)
+
+					// Outbound email relay and queue
+					r.Post("/smtp/test", emailHandler.TestSMTP)
+					r.Get("/email-queue", emailHandler.ListQueue)
+					r.Post("/email-queue/{id}/retry", emailHandler.Retry)
+					r.Delete("/email-queue/{id}", emailHandler.Delete)
+
+					// Runtime log levels
+					r.Get("/logging", loggingHandler.Get)
+					r.Put("/logging", loggingHandler.Update)
+					r.Post("/logging/debug", loggingHandler.Debug)
+
+					// Support bundle
+					r.Get("/diagnostics", diagnosticsHandler.Bundle)
+
+					// Connectivity self-test
+					r.Post("/selftest", selfTestHandler.Run)
+
+					// Disk usage and cleanup suggestions
+					r.Get("/storage", storageHandler.Get)
+					r.Get("/media-integrity", mediaIntegrityHandler.Get)
+
+					// SIP domain DNS records
+					r.Get("/dns", sipDNSHandler.Check)
+
+					// Twilio address ranges and firewall rules for the SIP and media ports
+					r.Get("/twilio-ranges", twilioRangesHandler.Get)
+					r.Put("/twilio-ranges", twilioRangesHandler.Update)
+					r.Delete("/twilio-ranges", twilioRangesHandler.Reset)
+					r.Post("/twilio-ranges/refresh", twilioRangesHandler.Refresh)
+					r.Get("/twilio-ranges/rules", twilioRangesHandler.Rules)
+
+					// Public IP and dynamic DNS
+					r.Get("/wan-ip", wanIPHandler.Get)
+					r.Post("/wan-ip/check", wanIPHandler.Check)
+
+					// Public base URL for links, QR codes and webhooks
+					r.Get("/public-url", publicURLHandler.Get)
+					r.Put("/public-url", publicURLHandler.Update)
+					r.Post("/public-url/check", publicURLHandler.Check)
+
+					// Signed, hash-chained exports of calls and messages
+					r.Route("/compliance-exports", func(r chi.Router) {
+						r.Get("/", complianceExportHandler.List)
+						r.Post("/", complianceExportHandler.Create)
+						r.Get("/public-key", complianceExportHandler.PublicKey)
+						r.Get("/{id}", complianceExportHandler.Get)
+						r.Get("/{id}/download", complianceExportHandler.Download)
+						r.Post("/{id}/verify", complianceExportHandler.Verify)
+					})
+
+					// Twilio trunk disaster recovery
+					r.Get("/trunks/failover", trunkFailoverHandler.List)
+					r.Get("/trunks/{sid}/failover", trunkFailoverHandler.Get)
+					r.Put("/trunks/{sid}/failover", trunkFailoverHandler.Update)
+					r.Delete("/trunks/{sid}/failover", trunkFailoverHandler.Delete)
+					r.Post("/trunks/{sid}/failover/verify", trunkFailoverHandler.Verify)
+
+					// Twilio edge location of trunk calls
+					r.Get("/trunks/{sid}/edge", trunkEdgeHandler.Get)
+					r.Put("/trunks/{sid}/edge", trunkEdgeHandler.Update)
+
+					// Router port forwarding
+					r.Get("/portmap", portMapHandler.Get)
+					r.Post("/portmap/refresh", portMapHandler.Refresh)
+					r.Get("/replica", replicaHandler.Get)
+					r.Post("/replica/sync", replicaHandler.Sync)
+
+					// Email-to-SMS gateway
+					r.Get("/mail-gateway", mailGatewayHandler.Get)
+					r.Put("/mail-gateway", mailGatewayHandler.Update)
+
+					// Sign-in history and lockouts
+					r.Route("/auth", func(r chi.Router) {
+						r.Get("/attempts", authHandler.ListLoginAttempts)
+						r.Get("/lockouts", authHandler.ListLockouts)
+						r.Delete("/lockouts/{scope}/{key}", authHandler.ClearLockout)
+					})
+
 					// Legacy backup endpoints for backwards compatibility
 					r.Post("/backup", systemHandler.CreateBackup)
 					r.Post("/restore", systemHandler.RestoreBackup)
@@ -1,12 +1,17 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/btafoya/gosip/internal/db"
 	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/rules"
+	"github.com/btafoya/gosip/pkg/sip"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -31,6 +36,7 @@ type RouteResponse struct {
 	ActionType    string          `json:"action_type"`
 	ActionData    json.RawMessage `json:"action_data,omitempty"`
 	Enabled       bool            `json:"enabled"`
+	TenantID      *int64          `json:"tenant_id,omitempty"`
 }
 
 // List returns all routes
@@ -46,7 +52,14 @@ func (h *RouteHandler) List(w http.ResponseWriter, r *http.Request) {
 			WriteValidationError(w, "Invalid DID ID", nil)
 			return
 		}
+		did, didErr := h.deps.DB.DIDs.GetByID(r.Context(), didID)
+		if didErr == nil && !visibleTo(r, did.TenantID) {
+			WriteNotFoundError(w, "DID")
+			return
+		}
 		routes, err = h.deps.DB.Routes.GetByDID(r.Context(), didID)
+	} else if tenantID := tenantOf(r); tenantID != nil {
+		routes, err = h.deps.DB.Routes.ListByTenant(r.Context(), *tenantID)
 	} else {
 		routes, err = h.deps.DB.Routes.List(r.Context())
 	}
@@ -84,22 +97,16 @@ func (h *RouteHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate
-	var errors []FieldError
-	if req.Name == "" {
-		errors = append(errors, FieldError{Field: "name", Message: "Name is required"})
-	}
-	if req.ConditionType != "time" && req.ConditionType != "callerid" && req.ConditionType != "default" {
-		errors = append(errors, FieldError{Field: "condition_type", Message: "Invalid condition type"})
-	}
-	if req.ActionType != "ring" && req.ActionType != "forward" && req.ActionType != "voicemail" && req.ActionType != "reject" {
-		errors = append(errors, FieldError{Field: "action_type", Message: "Invalid action type"})
-	}
-
-	if len(errors) > 0 {
+	if errors := routeFieldErrors(r.Context(), h.deps, &req, ""); len(errors) > 0 {
 		WriteValidationError(w, "Validation failed", errors)
 		return
 	}
+	if tenantID := tenantOf(r); tenantID != nil {
+		if errors := tenantRouteErrors(r.Context(), h.deps, *tenantID, &req); len(errors) > 0 {
+			WriteValidationError(w, "Validation failed", errors)
+			return
+		}
+	}
 
 	route := &models.Route{
 		DIDID:         req.DIDID,
@@ -116,10 +123,51 @@ func (h *RouteHandler) Create(w http.ResponseWriter, r *http.Request) {
 		WriteInternalError(w)
 		return
 	}
+	h.recordVersion(r.Context(), "created", route)
 
 	WriteJSON(w, http.StatusCreated, toRouteResponse(route))
 }
 
+// routeFieldErrors validates a new route. prefix is put before the field
+// names, for routes nested in other requests.
+func routeFieldErrors(ctx context.Context, deps *Dependencies, req *CreateRouteRequest, prefix string) []FieldError {
+	var errors []FieldError
+	if req.Name == "" {
+		errors = append(errors, FieldError{Field: prefix + "name", Message: "Name is required"})
+	}
+	if req.ConditionType != "time" && req.ConditionType != "callerid" && req.ConditionType != "default" && req.ConditionType != "calendar" && req.ConditionType != "webhook" {
+		errors = append(errors, FieldError{Field: prefix + "condition_type", Message: "Invalid condition type"})
+	}
+	if req.ConditionType == "calendar" && !validCalendarCondition(ctx, deps, req.ConditionData) {
+		errors = append(errors, userIDFieldError(prefix+"condition_data.user_id"))
+	}
+	if req.ConditionType == "webhook" {
+		if _, err := rules.ParseWebhookCondition(req.ConditionData); err != nil {
+			errors = append(errors, FieldError{Field: prefix + "condition_data", Message: err.Error()})
+		}
+	}
+	if req.ActionType != "ring" && req.ActionType != "forward" && req.ActionType != "voicemail" && req.ActionType != "reject" && req.ActionType != "oncall" && req.ActionType != "escalate" && req.ActionType != "split" {
+		errors = append(errors, FieldError{Field: prefix + "action_type", Message: "Invalid action type"})
+	}
+	if req.ActionType == "oncall" && !validOnCallAction(ctx, deps, req.ActionData) {
+		errors = append(errors, onCallScheduleFieldError(prefix+"action_data.schedule_id"))
+	}
+	if req.ActionType == "escalate" && !validEscalateAction(ctx, deps, req.ActionData) {
+		errors = append(errors, escalationPolicyFieldError(prefix+"action_data.policy_id"))
+	}
+	if req.ConditionType == "time" && !validScheduleTimezone(req.ConditionData) {
+		errors = append(errors, timezoneFieldError(prefix+"condition_data.timezone"))
+	}
+	if req.ActionType == "ring" && !validRingAlertInfo(req.ActionData) {
+		errors = append(errors, ringClassFieldError(prefix+"action_data.alert_info"))
+	}
+	if req.ActionType == "split" {
+		errors = append(errors, splitFieldErrors(ctx, deps, req.ActionData, prefix+"action_data")...)
+	}
+
+	return errors
+}
+
 // Get returns a specific route
 func (h *RouteHandler) Get(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
@@ -137,6 +185,10 @@ func (h *RouteHandler) Get(w http.ResponseWriter, r *http.Request) {
 		WriteInternalError(w)
 		return
 	}
+	if !visibleTo(r, route.TenantID) {
+		WriteNotFoundError(w, "Route")
+		return
+	}
 
 	WriteJSON(w, http.StatusOK, toRouteResponse(route))
 }
@@ -158,6 +210,10 @@ func (h *RouteHandler) Update(w http.ResponseWriter, r *http.Request) {
 		WriteInternalError(w)
 		return
 	}
+	if !visibleTo(r, route.TenantID) {
+		WriteNotFoundError(w, "Route")
+		return
+	}
 
 	var req CreateRouteRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -165,6 +221,7 @@ func (h *RouteHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := *route
 	if req.Name != "" {
 		route.Name = req.Name
 	}
@@ -174,20 +231,73 @@ func (h *RouteHandler) Update(w http.ResponseWriter, r *http.Request) {
 	if req.ConditionData != nil {
 		route.ConditionData = req.ConditionData
 	}
+	if route.ConditionType == "time" && !validScheduleTimezone(route.ConditionData) {
+		WriteValidationError(w, "Validation failed", []FieldError{timezoneFieldError("condition_data.timezone")})
+		return
+	}
+	if route.ConditionType == "calendar" && !validCalendarCondition(r.Context(), h.deps, route.ConditionData) {
+		WriteValidationError(w, "Validation failed", []FieldError{userIDFieldError("condition_data.user_id")})
+		return
+	}
+	if route.ConditionType == "webhook" {
+		if _, err := rules.ParseWebhookCondition(route.ConditionData); err != nil {
+			WriteValidationError(w, "Validation failed", []FieldError{{Field: "condition_data", Message: err.Error()}})
+			return
+		}
+	}
 	if req.ActionType != "" {
 		route.ActionType = req.ActionType
 	}
 	if req.ActionData != nil {
 		route.ActionData = req.ActionData
 	}
+	if route.ActionType == "ring" && !validRingAlertInfo(route.ActionData) {
+		WriteValidationError(w, "Validation failed", []FieldError{ringClassFieldError("action_data.alert_info")})
+		return
+	}
+	if route.ActionType == "oncall" && !validOnCallAction(r.Context(), h.deps, route.ActionData) {
+		WriteValidationError(w, "Validation failed", []FieldError{onCallScheduleFieldError("action_data.schedule_id")})
+		return
+	}
+	if route.ActionType == "escalate" && !validEscalateAction(r.Context(), h.deps, route.ActionData) {
+		WriteValidationError(w, "Validation failed", []FieldError{escalationPolicyFieldError("action_data.policy_id")})
+		return
+	}
+	if route.ActionType == "split" {
+		if errs := splitFieldErrors(r.Context(), h.deps, route.ActionData, "action_data"); len(errs) > 0 {
+			WriteValidationError(w, "Validation failed", errs)
+			return
+		}
+	}
 	route.Priority = req.Priority
 	route.Enabled = req.Enabled
 	route.DIDID = req.DIDID
+	if tenantID := tenantOf(r); tenantID != nil {
+		if errs := tenantRouteErrors(r.Context(), h.deps, *tenantID, &CreateRouteRequest{
+			DIDID:         route.DIDID,
+			ConditionType: route.ConditionType,
+			ConditionData: route.ConditionData,
+			ActionType:    route.ActionType,
+			ActionData:    route.ActionData,
+		}); len(errs) > 0 {
+			WriteValidationError(w, "Validation failed", errs)
+			return
+		}
+	}
 
 	if err := h.deps.DB.Routes.Update(r.Context(), route); err != nil {
 		WriteInternalError(w)
 		return
 	}
+	if len(routeDiff(&before, route)) > 0 {
+		h.recordVersion(r.Context(), "updated", route)
+	}
+	// Distribution counters only make sense for the targets they counted
+	if before.ActionType == "split" && (route.ActionType != "split" || !sameJSON(before.ActionData, route.ActionData)) {
+		if err := h.deps.DB.RouteSplits.Reset(r.Context(), route.ID); err != nil {
+			slog.Warn("Failed to reset split counters", "route_id", route.ID, "error", err)
+		}
+	}
 
 	WriteJSON(w, http.StatusOK, toRouteResponse(route))
 }
@@ -200,10 +310,24 @@ func (h *RouteHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The last version keeps the deleted route so it can be rolled back
+	route, err := h.deps.DB.Routes.GetByID(r.Context(), id)
+	if err != nil && err != db.ErrRouteNotFound {
+		WriteInternalError(w)
+		return
+	}
+	if tenantOf(r) != nil && (route == nil || !visibleTo(r, route.TenantID)) {
+		WriteNotFoundError(w, "Route")
+		return
+	}
+
 	if err := h.deps.DB.Routes.Delete(r.Context(), id); err != nil {
 		WriteInternalError(w)
 		return
 	}
+	if route != nil {
+		h.recordVersion(r.Context(), "deleted", route)
+	}
 
 	WriteJSON(w, http.StatusOK, map[string]string{"message": "Route deleted successfully"})
 }
@@ -221,10 +345,22 @@ func (h *RouteHandler) Reorder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var moved []*models.Route
+	for id, priority := range req.Priorities {
+		route, err := h.deps.DB.Routes.GetByID(r.Context(), id)
+		if err == nil && route.Priority != priority {
+			route.Priority = priority
+			moved = append(moved, route)
+		}
+	}
+
 	if err := h.deps.DB.Routes.UpdatePriorities(r.Context(), req.Priorities); err != nil {
 		WriteInternalError(w)
 		return
 	}
+	for _, route := range moved {
+		h.recordVersion(r.Context(), "reordered", route)
+	}
 
 	WriteJSON(w, http.StatusOK, map[string]string{"message": "Routes reordered successfully"})
 }
@@ -315,5 +451,167 @@ func toRouteResponse(route *models.Route) *RouteResponse {
 		ActionType:    route.ActionType,
 		ActionData:    route.ActionData,
 		Enabled:       route.Enabled,
+		TenantID:      route.TenantID,
+	}
+}
+
+// validScheduleTimezone reports whether a time condition's optional timezone is a known IANA zone
+func validScheduleTimezone(data json.RawMessage) bool {
+	var condition rules.TimeCondition
+	if len(data) == 0 || json.Unmarshal(data, &condition) != nil {
+		return true
+	}
+	return validTimezone(condition.Timezone)
+}
+
+// validCalendarCondition reports whether a calendar condition names an existing user
+func validCalendarCondition(ctx context.Context, deps *Dependencies, data json.RawMessage) bool {
+	var condition rules.CalendarCondition
+	if json.Unmarshal(data, &condition) != nil || condition.UserID <= 0 {
+		return false
+	}
+	_, err := deps.DB.Users.GetByID(ctx, condition.UserID)
+	return err == nil
+}
+
+// userIDFieldError is returned for fields that must name an existing user
+func userIDFieldError(field string) FieldError {
+	return FieldError{Field: field, Message: "Must be the ID of an existing user"}
+}
+
+// validOnCallAction reports whether an oncall action names an existing schedule
+func validOnCallAction(ctx context.Context, deps *Dependencies, data json.RawMessage) bool {
+	var action rules.OnCallAction
+	if json.Unmarshal(data, &action) != nil || action.ScheduleID <= 0 {
+		return false
+	}
+	_, err := deps.DB.OnCall.GetByID(ctx, action.ScheduleID)
+	return err == nil
+}
+
+// onCallScheduleFieldError is returned when an oncall action doesn't name a schedule
+func onCallScheduleFieldError(field string) FieldError {
+	return FieldError{Field: field, Message: "Must be the ID of an existing on-call schedule"}
+}
+
+// validEscalateAction reports whether an escalate action names an existing policy
+func validEscalateAction(ctx context.Context, deps *Dependencies, data json.RawMessage) bool {
+	var action rules.EscalateAction
+	if json.Unmarshal(data, &action) != nil || action.PolicyID <= 0 {
+		return false
 	}
+	_, err := deps.DB.EscalationPolicies.GetByID(ctx, action.PolicyID)
+	return err == nil
+}
+
+// escalationPolicyFieldError is returned when an escalate action doesn't name a policy
+func escalationPolicyFieldError(field string) FieldError {
+	return FieldError{Field: field, Message: "Must be the ID of an existing escalation policy"}
+}
+
+// validRingAlertInfo reports whether a ring action's optional alert_info is a valid ring class
+func validRingAlertInfo(data json.RawMessage) bool {
+	var action rules.RingAction
+	if len(data) == 0 || json.Unmarshal(data, &action) != nil || action.AlertInfo == "" {
+		return true
+	}
+	return sip.ValidRingClass(action.AlertInfo)
+}
+
+// ringClassFieldError is returned for Alert-Info ring classes that can't be sent to phones
+func ringClassFieldError(field string) FieldError {
+	return FieldError{Field: field, Message: "Ring class must be 1-32 letters, digits, '-' or '_'"}
+}
+
+// splitFieldErrors validates a split action. Its targets must name existing
+// schedules and policies like route actions do.
+func splitFieldErrors(ctx context.Context, deps *Dependencies, data json.RawMessage, field string) []FieldError {
+	var errors []FieldError
+	for _, msg := range rules.ValidateSplitAction(data) {
+		errors = append(errors, FieldError{Field: field, Message: msg})
+	}
+	if len(errors) > 0 {
+		return errors
+	}
+
+	var action rules.SplitAction
+	json.Unmarshal(data, &action)
+	for i, t := range action.Targets {
+		targetField := field + ".targets[" + strconv.Itoa(i) + "].action_data"
+		if t.ActionType == "oncall" && !validOnCallAction(ctx, deps, t.ActionData) {
+			errors = append(errors, onCallScheduleFieldError(targetField+".schedule_id"))
+		}
+		if t.ActionType == "escalate" && !validEscalateAction(ctx, deps, t.ActionData) {
+			errors = append(errors, escalationPolicyFieldError(targetField+".policy_id"))
+		}
+	}
+	return errors
+}
+
+// tenantRouteErrors checks a tenant user's route: it must be for one of the
+// tenant's DIDs, and only reach the tenant's devices and users. On-call
+// schedules and escalation policies are the instance's, so their actions
+// aren't available.
+func tenantRouteErrors(ctx context.Context, deps *Dependencies, tenantID int64, req *CreateRouteRequest) []FieldError {
+	var errors []FieldError
+	if req.DIDID == nil {
+		errors = append(errors, tenantDIDFieldError("did_id"))
+	} else if did, err := deps.DB.DIDs.GetByID(ctx, *req.DIDID); err != nil || !sameTenant(did.TenantID, &tenantID) {
+		errors = append(errors, tenantDIDFieldError("did_id"))
+	}
+	if req.ConditionType == "calendar" {
+		var condition rules.CalendarCondition
+		json.Unmarshal(req.ConditionData, &condition)
+		if user, err := deps.DB.Users.GetByID(ctx, condition.UserID); err != nil || !sameTenant(user.TenantID, &tenantID) {
+			errors = append(errors, userIDFieldError("condition_data.user_id"))
+		}
+	}
+	errors = append(errors, tenantActionErrors(ctx, deps, tenantID, req.ActionType, req.ActionData, "action")...)
+
+	if req.ActionType == "split" {
+		var action rules.SplitAction
+		json.Unmarshal(req.ActionData, &action)
+		for i, t := range action.Targets {
+			errors = append(errors, tenantActionErrors(ctx, deps, tenantID, t.ActionType, t.ActionData, "action_data.targets["+strconv.Itoa(i)+"].action")...)
+		}
+	}
+	return errors
+}
+
+// tenantActionErrors checks one action of a tenant user's route. field is
+// the action's field name without its _type or _data suffix.
+func tenantActionErrors(ctx context.Context, deps *Dependencies, tenantID int64, actionType string, data json.RawMessage, field string) []FieldError {
+	switch actionType {
+	case "oncall", "escalate":
+		return []FieldError{{Field: field + "_type", Message: "Not available to tenant users"}}
+	case "ring":
+		var action rules.RingAction
+		json.Unmarshal(data, &action)
+		for _, id := range action.Devices {
+			if device, err := deps.DB.Devices.GetByID(ctx, id); err != nil || !sameTenant(device.TenantID, &tenantID) {
+				return []FieldError{{Field: field + "_data.devices", Message: "Must be IDs of your own devices"}}
+			}
+		}
+	}
+	return nil
+}
+
+// tenantDIDFieldError is returned when a tenant user names a DID that isn't
+// the tenant's
+func tenantDIDFieldError(field string) FieldError {
+	return FieldError{Field: field, Message: "Must be the ID of one of your DIDs"}
+}
+
+// validTimezone reports whether an optional IANA timezone name can be loaded
+func validTimezone(name string) bool {
+	if name == "" {
+		return true
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// timezoneFieldError is returned for unknown timezone names
+func timezoneFieldError(field string) FieldError {
+	return FieldError{Field: field, Message: "Timezone must be an IANA name such as America/New_York"}
 }
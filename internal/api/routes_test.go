@@ -148,6 +148,24 @@ func TestRouteHandler_Create_ValidationError(t *testing.T) {
 				ActionType:    "invalid",
 			},
 		},
+		{
+			name: "Unknown schedule timezone",
+			reqBody: CreateRouteRequest{
+				Name:          "Test",
+				ConditionType: "time",
+				ConditionData: json.RawMessage(`{"business_hours": true, "timezone": "Nowhere/Invalid"}`),
+				ActionType:    "voicemail",
+			},
+		},
+		{
+			name: "Webhook without an http URL",
+			reqBody: CreateRouteRequest{
+				Name:          "Test",
+				ConditionType: "webhook",
+				ConditionData: json.RawMessage(`{"url": "ftp://screen.example.com/"}`),
+				ActionType:    "ring",
+			},
+		},
 	}
 
 	for _, tt := range tests {
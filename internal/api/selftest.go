@@ -0,0 +1,475 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/publicurl"
+	"github.com/btafoya/gosip/internal/storage"
+	"github.com/btafoya/gosip/internal/twilio"
+)
+
+// Self-test check outcomes
+const (
+	CheckPass = "pass"
+	CheckFail = "fail"
+	CheckSkip = "skip" // Not applicable to this setup
+)
+
+// SystemCheck is the outcome of one connectivity check
+type SystemCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"` // How to fix a failure
+}
+
+// SystemSelfTestResponse reports every check. OK is false when any check failed.
+type SystemSelfTestResponse struct {
+	OK     bool          `json:"ok"`
+	Checks []SystemCheck `json:"checks"`
+}
+
+// SelfTestHandler checks that GoSIP can reach Twilio and be reached by
+// Twilio and phones
+type SelfTestHandler struct {
+	deps   *Dependencies
+	client *http.Client
+	// edgeAddr returns the address timed for a Twilio edge
+	edgeAddr func(edge string) string
+}
+
+// NewSelfTestHandler creates a new SelfTestHandler
+func NewSelfTestHandler(deps *Dependencies) *SelfTestHandler {
+	return &SelfTestHandler{deps: deps, client: &http.Client{Timeout: config.SelfTestCheckTimeout}, edgeAddr: twilioEdgeAddr}
+}
+
+// twilioEdgeAddr returns the HTTPS address of the Twilio API at an edge
+func twilioEdgeAddr(edge string) string {
+	return net.JoinHostPort(strings.TrimPrefix(twilio.APIBaseURL(edge), "https://"), "443")
+}
+
+// Run runs every check at once and reports them in a fixed order (admin only)
+func (h *SelfTestHandler) Run(w http.ResponseWriter, r *http.Request) {
+	checks := []func(context.Context) SystemCheck{
+		h.checkTwilioCredentials,
+		h.checkTwilioLatency,
+		h.checkWebhookReachability,
+		h.checkSIPPort,
+		h.checkCertificate,
+		h.checkDNS,
+		h.checkDiskSpace,
+	}
+
+	resp := SystemSelfTestResponse{OK: true, Checks: make([]SystemCheck, len(checks))}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check func(context.Context) SystemCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), config.SelfTestCheckTimeout)
+			defer cancel()
+			resp.Checks[i] = check(ctx)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, check := range resp.Checks {
+		if check.Status == CheckFail {
+			resp.OK = false
+		}
+	}
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// checkTwilioCredentials makes an authenticated Twilio request
+func (h *SelfTestHandler) checkTwilioCredentials(ctx context.Context) SystemCheck {
+	check := SystemCheck{Name: "twilio_credentials"}
+
+	sid, token := twilioCredentials(ctx, h.deps)
+	if sid == "" || token == "" || h.deps.Twilio == nil {
+		check.Status = CheckFail
+		check.Detail = "Twilio credentials are not configured"
+		check.Hint = "Enter the Account SID and Auth Token from the Twilio console under System > Twilio"
+		return check
+	}
+
+	if _, err := h.deps.Twilio.GetAccountBalance(ctx); err != nil {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("Twilio rejected the request: %v", err)
+		check.Hint = "Check that the Account SID and Auth Token match the Twilio console. Auth Tokens change when they are rotated."
+		return check
+	}
+
+	check.Status = CheckPass
+	check.Detail = "Twilio accepted the credentials"
+	return check
+}
+
+// edgeRTT is the measured round trip to a Twilio edge
+type edgeRTT struct {
+	Edge string
+	RTT  time.Duration // 0 when the edge couldn't be reached
+}
+
+// checkTwilioLatency times a connection to the Twilio API at every edge,
+// so non-US deployments can pick the edge nearest to them
+func (h *SelfTestHandler) checkTwilioLatency(ctx context.Context) SystemCheck {
+	if sid, token := twilioCredentials(ctx, h.deps); sid == "" || token == "" {
+		return SystemCheck{
+			Name:   "twilio_latency",
+			Status: CheckSkip,
+			Detail: "Twilio credentials are not configured",
+		}
+	}
+
+	rtts := make([]edgeRTT, len(config.TwilioEdges))
+	var wg sync.WaitGroup
+	for i, edge := range config.TwilioEdges {
+		wg.Add(1)
+		go func(i int, edge string) {
+			defer wg.Done()
+			rtts[i] = edgeRTT{Edge: edge, RTT: h.timeEdge(ctx, edge)}
+		}(i, edge)
+	}
+	wg.Wait()
+
+	return twilioLatencyCheck(rtts, h.deps.Config.TwilioEdge)
+}
+
+// timeEdge returns the fastest of a few TCP connections to an edge. The
+// host is looked up first so DNS isn't counted.
+func (h *SelfTestHandler) timeEdge(ctx context.Context, edge string) time.Duration {
+	host, port, err := net.SplitHostPort(h.edgeAddr(edge))
+	if err != nil {
+		return 0
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(ips) == 0 {
+		return 0
+	}
+	addr := net.JoinHostPort(ips[0].IP.String(), port)
+
+	var best time.Duration
+	var dialer net.Dialer
+	for i := 0; i < config.SelfTestEdgeSamples; i++ {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			continue
+		}
+		rtt := time.Since(start)
+		conn.Close()
+		if best == 0 || rtt < best {
+			best = rtt
+		}
+	}
+	return best
+}
+
+// twilioLatencyCheck judges the round trips to the Twilio edges: the edge
+// in use must be reachable, and a clearly faster one is suggested
+func twilioLatencyCheck(rtts []edgeRTT, apiEdge string) SystemCheck {
+	check := SystemCheck{Name: "twilio_latency"}
+
+	inUse := apiEdge
+	if inUse == "" {
+		inUse = "ashburn" // Twilio's default
+	}
+	var current, fastest edgeRTT
+	parts := make([]string, 0, len(rtts))
+	for _, r := range rtts {
+		label := r.Edge
+		if r.Edge == inUse {
+			label += " (in use)"
+			current = r
+		}
+		if r.RTT == 0 {
+			parts = append(parts, label+" unreachable")
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s %d ms", label, r.RTT.Milliseconds()))
+		if fastest.RTT == 0 || r.RTT < fastest.RTT {
+			fastest = r
+		}
+	}
+	check.Detail = strings.Join(parts, ", ")
+
+	if current.RTT == 0 {
+		check.Status = CheckFail
+		check.Hint = "Check that this server can make outbound HTTPS connections to " + strings.TrimSuffix(twilioEdgeAddr(inUse), ":443")
+		if fastest.RTT != 0 {
+			check.Hint += fmt.Sprintf(", or set GOSIP_TWILIO_EDGE=%s", fastest.Edge)
+		}
+		return check
+	}
+
+	check.Status = CheckPass
+	if fastest.Edge != inUse && current.RTT-fastest.RTT >= config.SelfTestEdgeMargin {
+		check.Hint = fmt.Sprintf("%s is closest to this server. Set GOSIP_TWILIO_EDGE=%s and set the same edge on your trunks to lower audio latency.", fastest.Edge, fastest.Edge)
+	}
+	return check
+}
+
+// checkWebhookReachability fetches the health endpoint through the public
+// URL Twilio sends webhooks to, and makes sure it isn't a private address
+func (h *SelfTestHandler) checkWebhookReachability(ctx context.Context) SystemCheck {
+	check := SystemCheck{Name: "webhook_reachability"}
+
+	publicURL := publicurl.Get(ctx, h.deps.Config, h.deps.DB)
+	if publicURL == "" {
+		check.Status = CheckSkip
+		check.Detail = "The public base URL is not set"
+		check.Hint = "Set the public base URL Twilio webhooks use, e.g. https://pbx.example.com, under System > Public URL or with GOSIP_PUBLIC_URL"
+		return check
+	}
+	target, err := publicurl.Parse(publicURL)
+	if err != nil {
+		check.Status = CheckFail
+		check.Detail = "The public base URL " + err.Error()
+		check.Hint = "Set the public base URL to a full URL such as https://pbx.example.com"
+		return check
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, target.Hostname())
+	if err != nil || len(ips) == 0 {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("%s does not resolve", target.Hostname())
+		check.Hint = "Create a DNS record for the public host pointing at this server or its reverse proxy"
+		return check
+	}
+	public := false
+	for _, ip := range ips {
+		if !ip.IP.IsLoopback() && !ip.IP.IsPrivate() && !ip.IP.IsLinkLocalUnicast() {
+			public = true
+		}
+	}
+	if !public {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("%s resolves to %s, which Twilio can't reach", target.Hostname(), ips[0].IP)
+		check.Hint = "Use a public host name, or expose GoSIP through a reverse proxy or tunnel and make that the public base URL"
+		return check
+	}
+
+	health := target.JoinPath("/api/health").String()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, health, nil)
+	if err != nil {
+		check.Status = CheckFail
+		check.Detail = err.Error()
+		return check
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("GET %s failed: %v", health, err)
+		check.Hint = "Check the firewall, port forwarding and reverse proxy for the public URL"
+		return check
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("GET %s returned %d", health, resp.StatusCode)
+		check.Hint = "Make sure the reverse proxy forwards /api/ to GoSIP"
+		return check
+	}
+
+	check.Status = CheckPass
+	check.Detail = fmt.Sprintf("GET %s succeeded", health)
+	if target.Scheme != "https" {
+		check.Hint = "Twilio recommends https webhook URLs"
+	}
+	return check
+}
+
+// probeResult is what the probe service returns
+type probeResult struct {
+	Reachable bool   `json:"reachable"`
+	Detail    string `json:"detail"`
+}
+
+// checkSIPPort asks the external probe service whether the SIP port of
+// the SIP domain answers from the internet
+func (h *SelfTestHandler) checkSIPPort(ctx context.Context) SystemCheck {
+	check := SystemCheck{Name: "sip_port"}
+
+	if h.deps.Config.ProbeURL == "" {
+		check.Status = CheckSkip
+		check.Detail = "GOSIP_PROBE_URL is not set"
+		check.Hint = "Set GOSIP_PROBE_URL to a probe service to test the SIP port from outside your network"
+		return check
+	}
+
+	transport, port := "udp", h.deps.Config.SIPPort
+	if h.deps.Config.TLS != nil && h.deps.Config.TLS.Enabled && h.deps.Config.TLS.DisableUnencrypted {
+		transport, port = "tls", h.deps.Config.TLS.Port
+	}
+	host := h.deps.Config.SIPDomain
+
+	probe, err := url.Parse(h.deps.Config.ProbeURL)
+	if err != nil {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("GOSIP_PROBE_URL is invalid: %v", err)
+		return check
+	}
+	q := probe.Query()
+	q.Set("host", host)
+	q.Set("port", fmt.Sprint(port))
+	q.Set("transport", transport)
+	probe.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probe.String(), nil)
+	if err != nil {
+		check.Status = CheckFail
+		check.Detail = err.Error()
+		return check
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("Probe service failed: %v", err)
+		check.Hint = "Check that GOSIP_PROBE_URL is correct and the probe service is up"
+		return check
+	}
+	defer resp.Body.Close()
+
+	var result probeResult
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&result) != nil {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("Probe service returned %d", resp.StatusCode)
+		check.Hint = "Check that GOSIP_PROBE_URL is correct and the probe service is up"
+		return check
+	}
+
+	addr := fmt.Sprintf("%s %s", transport, net.JoinHostPort(host, fmt.Sprint(port)))
+	if !result.Reachable {
+		check.Status = CheckFail
+		check.Detail = strings.TrimSpace(addr + " is not reachable from the internet. " + result.Detail)
+		check.Hint = fmt.Sprintf("Forward %s port %d on your router and firewall to this server", strings.ToUpper(transport), port)
+		return check
+	}
+
+	check.Status = CheckPass
+	check.Detail = addr + " is reachable from the internet"
+	return check
+}
+
+// checkCertificate reports whether the TLS certificate is valid and not
+// about to expire
+func (h *SelfTestHandler) checkCertificate(ctx context.Context) SystemCheck {
+	check := SystemCheck{Name: "certificate"}
+
+	if h.deps.SIP == nil || !h.deps.SIP.IsTLSEnabled() {
+		check.Status = CheckSkip
+		check.Detail = "TLS is not enabled"
+		check.Hint = "Set GOSIP_TLS_ENABLED=true to encrypt SIP signaling"
+		return check
+	}
+
+	status := h.deps.SIP.GetTLSStatus()
+	return certificateCheck(status.Valid, status.Error, status.CertExpiry, status.CertMode, time.Now())
+}
+
+// certificateCheck judges a certificate by its validity and expiry
+func certificateCheck(valid bool, certErr string, expiry time.Time, mode string, now time.Time) SystemCheck {
+	check := SystemCheck{Name: "certificate", Status: CheckFail}
+
+	renew := "Replace the certificate files and reload them from System > TLS"
+	if mode == "acme" {
+		renew = "Renew the certificate from System > TLS, and check that the ACME challenge can reach this server"
+	}
+
+	switch {
+	case !valid:
+		check.Detail = "The TLS certificate is not valid"
+		if certErr != "" {
+			check.Detail += ": " + certErr
+		}
+		check.Hint = renew
+	case expiry.IsZero():
+		check.Detail = "The TLS certificate has no expiry date"
+		check.Hint = renew
+	case !expiry.After(now):
+		check.Detail = fmt.Sprintf("The TLS certificate expired on %s", expiry.UTC().Format("Jan 2, 2006"))
+		check.Hint = renew
+	case expiry.Sub(now) <= config.CertExpiryWarning:
+		check.Detail = fmt.Sprintf("The TLS certificate expires on %s", expiry.UTC().Format("Jan 2, 2006"))
+		check.Hint = renew
+	default:
+		check.Status = CheckPass
+		check.Detail = fmt.Sprintf("The TLS certificate is valid until %s", expiry.UTC().Format("Jan 2, 2006"))
+	}
+	return check
+}
+
+// checkDNS looks up the SIP domain and the SRV records phones and
+// carriers use to find the server
+func (h *SelfTestHandler) checkDNS(ctx context.Context) SystemCheck {
+	check := SystemCheck{Name: "dns"}
+
+	domain := h.deps.Config.SIPDomain
+	if domain == "" || domain == "localhost" || net.ParseIP(domain) != nil {
+		check.Status = CheckSkip
+		check.Detail = fmt.Sprintf("The SIP domain %q is not a DNS name", domain)
+		check.Hint = "Set GOSIP_SIP_DOMAIN to a domain name so phones outside your network can find the server"
+		return check
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, domain)
+	if err != nil || len(ips) == 0 {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("%s does not resolve", domain)
+		check.Hint = fmt.Sprintf("Create an A record for %s pointing at this server's public IP", domain)
+		return check
+	}
+
+	service, proto := "sip", "udp"
+	if h.deps.Config.TLS != nil && h.deps.Config.TLS.Enabled {
+		service, proto = "sips", "tcp"
+	}
+	_, srvs, err := net.DefaultResolver.LookupSRV(ctx, service, proto, domain)
+	if err != nil || len(srvs) == 0 {
+		check.Status = CheckPass
+		check.Detail = fmt.Sprintf("%s resolves to %s", domain, ips[0].IP)
+		check.Hint = fmt.Sprintf("Optionally add a _%s._%s.%s SRV record so clients find the SIP port automatically", service, proto, domain)
+		return check
+	}
+
+	check.Status = CheckPass
+	check.Detail = fmt.Sprintf("%s resolves to %s and _%s._%s points to %s:%d",
+		domain, ips[0].IP, service, proto, strings.TrimSuffix(srvs[0].Target, "."), srvs[0].Port)
+	return check
+}
+
+// checkDiskSpace makes sure the data directory has room for recordings,
+// voicemails and backups
+func (h *SelfTestHandler) checkDiskSpace(ctx context.Context) SystemCheck {
+	check := SystemCheck{Name: "disk_space"}
+
+	free, total, err := storage.DiskUsage(h.deps.Config.DataDir)
+	if err != nil {
+		check.Status = CheckSkip
+		check.Detail = fmt.Sprintf("Free space of %s is unknown: %v", h.deps.Config.DataDir, err)
+		return check
+	}
+
+	detail := fmt.Sprintf("%s free of %s in %s", storage.FormatBytes(free), storage.FormatBytes(total), h.deps.Config.DataDir)
+	if free < config.SelfTestMinFreeDisk {
+		check.Status = CheckFail
+		check.Detail = detail
+		check.Hint = "Free up space by deleting old recordings and backups under System > Backups, or move GOSIP_DATA_DIR to a larger disk"
+		return check
+	}
+
+	check.Status = CheckPass
+	check.Detail = detail
+	return check
+}
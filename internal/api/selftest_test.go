@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+)
+
+func TestSelfTestHandler_Run(t *testing.T) {
+	setup := setupTestAPI(t)
+	ctx := context.Background()
+	setup.DB.Config.Set(ctx, "twilio_account_sid", "AC123")
+	setup.DB.Config.Set(ctx, "twilio_auth_token", "token")
+	setup.Twilio.GetAccountBalanceFunc = func(ctx context.Context) (float64, error) {
+		return 0, errors.New("authentication failed")
+	}
+
+	var probed string
+	probe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probed = r.URL.RawQuery
+		w.Write([]byte(`{"reachable": true}`))
+	}))
+	defer probe.Close()
+
+	handler := NewSelfTestHandler(&Dependencies{DB: setup.DB, Twilio: setup.Twilio, Config: &config.Config{
+		SIPPort:   5060,
+		SIPDomain: "localhost",
+		DataDir:   t.TempDir(),
+		PublicURL: probe.URL,
+		ProbeURL:  probe.URL + "/check",
+	}})
+	// Every edge is timed against a local listener
+	edge, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer edge.Close()
+	handler.edgeAddr = func(string) string { return edge.Addr().String() }
+
+	rr := httptest.NewRecorder()
+	handler.Run(rr, httptest.NewRequest(http.MethodPost, "/api/system/selftest", nil))
+	assertStatus(t, rr, http.StatusOK)
+
+	var resp SystemSelfTestResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.OK {
+		t.Error("Expected the self-test to fail")
+	}
+
+	got := make(map[string]SystemCheck)
+	var names []string
+	for _, check := range resp.Checks {
+		got[check.Name] = check
+		names = append(names, check.Name)
+	}
+	if strings.Join(names, ",") != "twilio_credentials,twilio_latency,webhook_reachability,sip_port,certificate,dns,disk_space" {
+		t.Errorf("Unexpected check order %v", names)
+	}
+
+	if c := got["twilio_credentials"]; c.Status != CheckFail || !strings.Contains(c.Detail, "authentication failed") || c.Hint == "" {
+		t.Errorf("Expected rejected credentials to fail with a hint, got %+v", c)
+	}
+	if c := got["twilio_latency"]; c.Status != CheckPass || !strings.Contains(c.Detail, "ashburn (in use)") || strings.Contains(c.Detail, "unreachable") {
+		t.Errorf("Expected every edge timed, got %+v", c)
+	}
+	// Twilio can't call back to a loopback address
+	if c := got["webhook_reachability"]; c.Status != CheckFail || !strings.Contains(c.Detail, "can't reach") {
+		t.Errorf("Expected a loopback public URL to fail, got %+v", c)
+	}
+	if c := got["sip_port"]; c.Status != CheckPass || probed != "host=localhost&port=5060&transport=udp" {
+		t.Errorf("Expected the probe to be asked about udp 5060, got %+v (%s)", c, probed)
+	}
+	if c := got["certificate"]; c.Status != CheckSkip {
+		t.Errorf("Expected certificate check skipped without TLS, got %+v", c)
+	}
+	if c := got["dns"]; c.Status != CheckSkip {
+		t.Errorf("Expected DNS check skipped for localhost, got %+v", c)
+	}
+	if c := got["disk_space"]; c.Status == "" || c.Detail == "" {
+		t.Errorf("Expected a disk space result, got %+v", c)
+	}
+}
+
+func TestSelfTestHandler_NotConfigured(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewSelfTestHandler(&Dependencies{DB: setup.DB, Twilio: setup.Twilio, Config: &config.Config{DataDir: t.TempDir()}})
+
+	ctx := context.Background()
+	if c := handler.checkTwilioCredentials(ctx); c.Status != CheckFail || c.Hint == "" {
+		t.Errorf("Expected missing credentials to fail with a hint, got %+v", c)
+	}
+	if c := handler.checkTwilioLatency(ctx); c.Status != CheckSkip {
+		t.Errorf("Expected latency check skipped without credentials, got %+v", c)
+	}
+	if c := handler.checkWebhookReachability(ctx); c.Status != CheckSkip {
+		t.Errorf("Expected webhook check skipped without GOSIP_PUBLIC_URL, got %+v", c)
+	}
+	if c := handler.checkSIPPort(ctx); c.Status != CheckSkip {
+		t.Errorf("Expected SIP port check skipped without GOSIP_PROBE_URL, got %+v", c)
+	}
+}
+
+func TestCertificateCheck(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		valid  bool
+		expiry time.Time
+		want   string
+	}{
+		{"invalid", false, now.Add(90 * 24 * time.Hour), CheckFail},
+		{"expired", true, now.Add(-time.Hour), CheckFail},
+		{"expiring soon", true, now.Add(3 * 24 * time.Hour), CheckFail},
+		{"valid", true, now.Add(60 * 24 * time.Hour), CheckPass},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := certificateCheck(tt.valid, "", tt.expiry, "acme", now)
+			if check.Status != tt.want {
+				t.Errorf("Expected %s, got %+v", tt.want, check)
+			}
+			if tt.want == CheckFail && !strings.Contains(check.Hint, "ACME") {
+				t.Errorf("Expected an ACME renewal hint, got %q", check.Hint)
+			}
+		})
+	}
+}
+
+func TestTwilioLatencyCheck(t *testing.T) {
+	rtts := []edgeRTT{
+		{Edge: "ashburn", RTT: 95 * time.Millisecond},
+		{Edge: "dublin", RTT: 12 * time.Millisecond},
+		{Edge: "sydney"},
+	}
+
+	c := twilioLatencyCheck(rtts, "")
+	if c.Status != CheckPass || c.Detail != "ashburn (in use) 95 ms, dublin 12 ms, sydney unreachable" {
+		t.Errorf("Unexpected check %+v", c)
+	}
+	if !strings.Contains(c.Hint, "GOSIP_TWILIO_EDGE=dublin") {
+		t.Errorf("Expected the faster edge suggested, got %q", c.Hint)
+	}
+
+	if c := twilioLatencyCheck(rtts, "dublin"); c.Status != CheckPass || c.Hint != "" {
+		t.Errorf("Expected no hint using the fastest edge, got %+v", c)
+	}
+	if c := twilioLatencyCheck(rtts, "sydney"); c.Status != CheckFail || !strings.Contains(c.Hint, "api.sydney.us1.twilio.com") {
+		t.Errorf("Expected an unreachable edge in use to fail, got %+v", c)
+	}
+}
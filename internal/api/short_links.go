@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/publicurl"
+	"github.com/btafoya/gosip/internal/shortlinks"
+	"github.com/go-chi/chi/v5"
+)
+
+// ShortLinkResponse is a link in a message and how often it was clicked
+type ShortLinkResponse struct {
+	URL           string  `json:"url"`
+	ShortURL      string  `json:"short_url"`
+	Clicks        int     `json:"clicks"`
+	LastClickedAt *string `json:"last_clicked_at,omitempty"`
+}
+
+// shortenMessageLinks shortens the links of a message about to be sent,
+// sending the links as they are when they can't be shortened
+func shortenMessageLinks(ctx context.Context, deps *Dependencies, message *models.Message) {
+	if err := shortlinks.Shorten(ctx, deps.Config, deps.DB, message); err != nil {
+		slog.Warn("Failed to shorten message links", "message_id", message.ID, "error", err)
+	}
+}
+
+// GetLinks returns the short links in a message and their clicks
+// GET /api/messages/{id}/links
+func (h *MessageHandler) GetLinks(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid message ID", nil)
+		return
+	}
+
+	if _, err := h.deps.DB.Messages.GetByID(r.Context(), id); err != nil {
+		if err == db.ErrMessageNotFound {
+			WriteNotFoundError(w, "Message")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	links, err := h.deps.DB.ShortLinks.ListByMessage(r.Context(), id)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	prefix := publicurl.Get(r.Context(), h.deps.Config, h.deps.DB) + config.ShortLinkPath
+	resp := make([]ShortLinkResponse, len(links))
+	for i, link := range links {
+		resp[i] = ShortLinkResponse{URL: link.URL, ShortURL: prefix + link.Code, Clicks: link.Clicks}
+		if link.LastClickedAt != nil {
+			clickedAt := link.LastClickedAt.Format(time.RFC3339)
+			resp[i].LastClickedAt = &clickedAt
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// FollowShortLink counts a click of a short link and redirects to the
+// original link. Links keep working after link shortening is turned off.
+// GET /l/{code}
+func (h *MessageHandler) FollowShortLink(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+	link, err := h.deps.DB.ShortLinks.RecordClick(r.Context(), code)
+	if err != nil && err != db.ErrShortLinkNotFound {
+		// A click that can't be counted still gets the recipient there
+		slog.Error("Failed to record short link click", "code", code, "error", err)
+		link, err = h.deps.DB.ShortLinks.GetByCode(r.Context(), code)
+	}
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Not a permanent redirect, so browsers come back and every click counts
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, link.URL, http.StatusFound)
+}
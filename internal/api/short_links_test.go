@@ -0,0 +1,109 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/publicurl"
+	"github.com/btafoya/gosip/internal/shortlinks"
+)
+
+func TestMessageHandler_ShortLinks(t *testing.T) {
+	setup := setupTestAPI(t)
+	sent := make(chan string, 1)
+	var sids atomic.Int64
+	setup.Twilio.SendSMSFunc = func(from, to, body string, mediaURLs []string) (string, error) {
+		sent <- body
+		return fmt.Sprintf("SM%d", sids.Add(1)), nil
+	}
+	deps := &Dependencies{DB: setup.DB, Twilio: setup.Twilio}
+	handler := NewMessageHandler(deps)
+	did := createTestDID(t, setup.DB, "+15551234567")
+	ctx := context.Background()
+
+	// send sends a message and waits for it to be sent, returning the
+	// message and the text Twilio was given
+	send := func(text string) (MessageResponse, string) {
+		t.Helper()
+		body, _ := json.Marshal(SendMessageRequest{DIDID: did.ID, ToNumber: "+15559876543", Body: text})
+		rr := httptest.NewRecorder()
+		handler.Send(rr, httptest.NewRequest(http.MethodPost, "/api/messages", bytes.NewBuffer(body)))
+		assertStatus(t, rr, http.StatusAccepted)
+		var resp MessageResponse
+		decodeResponse(t, rr, &resp)
+		sentBody := <-sent
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if m, err := setup.DB.Messages.GetByID(ctx, resp.ID); err == nil && m.Status == "sent" {
+				break
+			}
+		}
+		return resp, sentBody
+	}
+
+	// Off by default
+	text := "Your appointment is tomorrow: https://clinic.example.com/appt?id=42. Reschedule at https://clinic.example.com/r"
+	if resp, sentBody := send(text); resp.Body != text || sentBody != text {
+		t.Errorf("Expected links left alone with shortening off, got %q", resp.Body)
+	}
+
+	// On, but without a public base URL there's nowhere to serve them
+	setup.DB.Config.Set(ctx, shortlinks.SettingEnabled, "true")
+	if resp, sentBody := send(text); resp.Body != text || sentBody != text {
+		t.Errorf("Expected links left alone without a public base URL, got %q", resp.Body)
+	}
+
+	setup.DB.Config.Set(ctx, publicurl.SettingKey, "https://pbx.example.com/")
+	resp, got := send(text)
+	if got != resp.Body {
+		t.Errorf("Expected the shortened body sent, got %q", got)
+	}
+	if !strings.HasPrefix(resp.Body, "Your appointment is tomorrow: https://pbx.example.com/l/") ||
+		!strings.Contains(resp.Body, ". Reschedule at https://pbx.example.com/l/") || strings.Contains(resp.Body, "clinic") {
+		t.Fatalf("Expected both links shortened, got %q", resp.Body)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.GetLinks(rr, withURLParams(httptest.NewRequest(http.MethodGet, "/api/messages/3/links", nil), map[string]string{"id": strconv.FormatInt(resp.ID, 10)}))
+	assertStatus(t, rr, http.StatusOK)
+	var links []ShortLinkResponse
+	decodeResponse(t, rr, &links)
+	if len(links) != 2 || links[0].URL != "https://clinic.example.com/appt?id=42" || links[1].URL != "https://clinic.example.com/r" ||
+		!strings.Contains(resp.Body, links[0].ShortURL) {
+		t.Fatalf("Unexpected links: %+v", links)
+	}
+
+	// Following a link redirects to the original and counts the click
+	code := strings.TrimPrefix(links[0].ShortURL, "https://pbx.example.com/l/")
+	rr = httptest.NewRecorder()
+	handler.FollowShortLink(rr, withURLParams(httptest.NewRequest(http.MethodGet, "/l/"+code, nil), map[string]string{"code": code}))
+	assertStatus(t, rr, http.StatusFound)
+	if location := rr.Header().Get("Location"); location != "https://clinic.example.com/appt?id=42" {
+		t.Errorf("Expected a redirect to the original link, got %q", location)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.GetLinks(rr, withURLParams(httptest.NewRequest(http.MethodGet, "/api/messages/3/links", nil), map[string]string{"id": strconv.FormatInt(resp.ID, 10)}))
+	decodeResponse(t, rr, &links)
+	if links[0].Clicks != 1 || links[0].LastClickedAt == nil || links[1].Clicks != 0 {
+		t.Errorf("Expected one click on the first link, got %+v", links)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.FollowShortLink(rr, withURLParams(httptest.NewRequest(http.MethodGet, "/l/nope", nil), map[string]string{"code": "nope"}))
+	assertStatus(t, rr, http.StatusNotFound)
+
+	// Short links already in a message aren't shortened again
+	again, _ := send("Forwarded: " + links[0].ShortURL)
+	if again.Body != "Forwarded: "+links[0].ShortURL {
+		t.Errorf("Expected a short link left alone, got %q", again.Body)
+	}
+}
@@ -0,0 +1,289 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/pkg/sip"
+	"github.com/go-chi/chi/v5"
+)
+
+// ProviderTrunkHandler handles the SIP trunks of providers other than Twilio
+type ProviderTrunkHandler struct {
+	deps *Dependencies
+}
+
+// NewProviderTrunkHandler creates a new ProviderTrunkHandler
+func NewProviderTrunkHandler(deps *Dependencies) *ProviderTrunkHandler {
+	return &ProviderTrunkHandler{deps: deps}
+}
+
+// SIPTrunkRequest represents a SIP trunk create or update request. On
+// update, omitted fields keep their value.
+type SIPTrunkRequest struct {
+	Name         *string `json:"name"`
+	Host         *string `json:"host"`
+	Port         *int    `json:"port"`
+	Transport    *string `json:"transport"`
+	Domain       *string `json:"domain"`
+	Username     *string `json:"username"`
+	AuthUsername *string `json:"auth_username"`
+	Password     *string `json:"password"`
+	Expires      *int    `json:"expires"`
+	Register     *bool   `json:"register"`
+	Enabled      *bool   `json:"enabled"`
+}
+
+// SIPTrunkResponse is a SIP trunk with where its registration stands. The
+// password is never returned.
+type SIPTrunkResponse struct {
+	*models.SIPTrunk
+	HasPassword  bool             `json:"has_password"`
+	Registration *sip.TrunkStatus `json:"registration,omitempty"` // Absent without a running SIP server
+}
+
+// sipTrunkTransports are the transports a trunk registers over
+var sipTrunkTransports = map[string]bool{"udp": true, "tcp": true, "tls": true}
+
+// List returns every SIP trunk
+func (h *ProviderTrunkHandler) List(w http.ResponseWriter, r *http.Request) {
+	trunks, err := h.deps.DB.SIPTrunks.List(r.Context())
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	resp := make([]SIPTrunkResponse, 0, len(trunks))
+	for _, trunk := range trunks {
+		resp = append(resp, h.toResponse(trunk))
+	}
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// Create adds a SIP trunk and registers with it
+func (h *ProviderTrunkHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req SIPTrunkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	trunk := &models.SIPTrunk{
+		Port:      5060,
+		Transport: "udp",
+		Expires:   config.SIPTrunkDefaultExpires,
+		Register:  true,
+		Enabled:   true,
+	}
+	req.apply(trunk)
+	if errs := validateSIPTrunk(trunk); len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	if err := h.deps.DB.SIPTrunks.Create(r.Context(), trunk); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "A SIP trunk with this name already exists", nil)
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+	h.reload(r.Context(), trunk.ID)
+
+	WriteJSON(w, http.StatusCreated, h.toResponse(trunk))
+}
+
+// Get returns a SIP trunk
+func (h *ProviderTrunkHandler) Get(w http.ResponseWriter, r *http.Request) {
+	trunk, ok := h.loadTrunk(w, r)
+	if !ok {
+		return
+	}
+	WriteJSON(w, http.StatusOK, h.toResponse(trunk))
+}
+
+// Update changes a SIP trunk and registers with it again
+func (h *ProviderTrunkHandler) Update(w http.ResponseWriter, r *http.Request) {
+	trunk, ok := h.loadTrunk(w, r)
+	if !ok {
+		return
+	}
+
+	var req SIPTrunkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	req.apply(trunk)
+	if errs := validateSIPTrunk(trunk); len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	if err := h.deps.DB.SIPTrunks.Update(r.Context(), trunk); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "A SIP trunk with this name already exists", nil)
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+	h.reload(r.Context(), trunk.ID)
+
+	WriteJSON(w, http.StatusOK, h.toResponse(trunk))
+}
+
+// Delete removes a SIP trunk, unregistering from it first
+func (h *ProviderTrunkHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid trunk ID", nil)
+		return
+	}
+
+	if err := h.deps.DB.SIPTrunks.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, db.ErrSIPTrunkNotFound) {
+			WriteNotFoundError(w, "SIP trunk")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+	h.reload(r.Context(), id)
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "SIP trunk deleted successfully"})
+}
+
+// Register registers with a SIP trunk now instead of waiting for the next
+// refresh or retry
+func (h *ProviderTrunkHandler) Register(w http.ResponseWriter, r *http.Request) {
+	trunk, ok := h.loadTrunk(w, r)
+	if !ok {
+		return
+	}
+	if h.deps.SIP == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "SIP server is not running", nil)
+		return
+	}
+	if !trunk.Enabled || !trunk.Register {
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "SIP trunk is disabled or doesn't register", nil)
+		return
+	}
+	h.reload(r.Context(), trunk.ID)
+
+	WriteJSON(w, http.StatusAccepted, h.toResponse(trunk))
+}
+
+// loadTrunk fetches the trunk named by the id URL parameter, writing an
+// error response when it can't
+func (h *ProviderTrunkHandler) loadTrunk(w http.ResponseWriter, r *http.Request) (*models.SIPTrunk, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid trunk ID", nil)
+		return nil, false
+	}
+
+	trunk, err := h.deps.DB.SIPTrunks.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, db.ErrSIPTrunkNotFound) {
+			WriteNotFoundError(w, "SIP trunk")
+			return nil, false
+		}
+		WriteInternalError(w)
+		return nil, false
+	}
+	return trunk, true
+}
+
+// reload restarts the trunk's registration with its stored settings
+func (h *ProviderTrunkHandler) reload(ctx context.Context, id int64) {
+	if h.deps.SIP == nil {
+		return
+	}
+	if err := h.deps.SIP.Trunks().Reload(ctx, id); err != nil {
+		slog.Error("Failed to reload SIP trunk registration", "trunk_id", id, "error", err)
+	}
+}
+
+func (h *ProviderTrunkHandler) toResponse(trunk *models.SIPTrunk) SIPTrunkResponse {
+	resp := SIPTrunkResponse{SIPTrunk: trunk, HasPassword: trunk.Password != ""}
+	if h.deps.SIP != nil {
+		status := h.deps.SIP.Trunks().Status(trunk.ID)
+		resp.Registration = &status
+	}
+	return resp
+}
+
+// apply copies the fields given in the request onto trunk
+func (req *SIPTrunkRequest) apply(trunk *models.SIPTrunk) {
+	if req.Name != nil {
+		trunk.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Host != nil {
+		trunk.Host = strings.TrimSpace(*req.Host)
+	}
+	if req.Port != nil {
+		trunk.Port = *req.Port
+	}
+	if req.Transport != nil {
+		trunk.Transport = strings.ToLower(*req.Transport)
+	}
+	if req.Domain != nil {
+		trunk.Domain = strings.TrimSpace(*req.Domain)
+	}
+	if req.Username != nil {
+		trunk.Username = strings.TrimSpace(*req.Username)
+	}
+	if req.AuthUsername != nil {
+		trunk.AuthUsername = strings.TrimSpace(*req.AuthUsername)
+	}
+	if req.Password != nil {
+		trunk.Password = *req.Password
+	}
+	if req.Expires != nil {
+		trunk.Expires = *req.Expires
+	}
+	if req.Register != nil {
+		trunk.Register = *req.Register
+	}
+	if req.Enabled != nil {
+		trunk.Enabled = *req.Enabled
+	}
+}
+
+// validateSIPTrunk checks a trunk's settings
+func validateSIPTrunk(trunk *models.SIPTrunk) []FieldError {
+	var errs []FieldError
+	if trunk.Name == "" {
+		errs = append(errs, FieldError{Field: "name", Message: "Name is required"})
+	}
+	if trunk.Host == "" || strings.ContainsAny(trunk.Host, " :;@<>/") {
+		errs = append(errs, FieldError{Field: "host", Message: "Must be a host name or IPv4 address"})
+	}
+	if trunk.Port < 1 || trunk.Port > 65535 {
+		errs = append(errs, FieldError{Field: "port", Message: "Must be between 1 and 65535"})
+	}
+	if !sipTrunkTransports[trunk.Transport] {
+		errs = append(errs, FieldError{Field: "transport", Message: "Must be udp, tcp or tls"})
+	}
+	if strings.ContainsAny(trunk.Domain, " :;@<>/") {
+		errs = append(errs, FieldError{Field: "domain", Message: "Must be a domain name"})
+	}
+	if trunk.Username == "" || strings.ContainsAny(trunk.Username, " :;@<>") {
+		errs = append(errs, FieldError{Field: "username", Message: "Username is required and may not contain spaces or : ; @ < >"})
+	}
+	if trunk.Expires < config.SIPTrunkMinExpires || trunk.Expires > config.SIPTrunkMaxExpires {
+		errs = append(errs, FieldError{Field: "expires", Message: fmt.Sprintf("Must be between %d and %d seconds", config.SIPTrunkMinExpires, config.SIPTrunkMaxExpires)})
+	}
+	return errs
+}
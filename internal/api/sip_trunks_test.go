@@ -0,0 +1,97 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestProviderTrunkHandler_Create(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewProviderTrunkHandler(&Dependencies{DB: setup.DB})
+
+	tests := []struct {
+		name string
+		body string
+		want int
+		code string
+	}{
+		{"missing host", `{"name": "Carrier", "username": "pbx"}`, http.StatusBadRequest, ErrCodeValidation},
+		{"host with port", `{"name": "Carrier", "host": "sip.carrier.example:5060", "username": "pbx"}`, http.StatusBadRequest, ErrCodeValidation},
+		{"bad transport", `{"name": "Carrier", "host": "sip.carrier.example", "username": "pbx", "transport": "sctp"}`, http.StatusBadRequest, ErrCodeValidation},
+		{"short expiry", `{"name": "Carrier", "host": "sip.carrier.example", "username": "pbx", "expires": 10}`, http.StatusBadRequest, ErrCodeValidation},
+		{"missing username", `{"name": "Carrier", "host": "sip.carrier.example"}`, http.StatusBadRequest, ErrCodeValidation},
+		{"valid", `{"name": "Carrier", "host": "sip.carrier.example", "username": "pbx", "password": "s3cret"}`, http.StatusCreated, ""},
+		{"duplicate name", `{"name": "Carrier", "host": "sip.other.example", "username": "pbx"}`, http.StatusConflict, ErrCodeConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.Create(rr, httptest.NewRequest(http.MethodPost, "/api/trunks", bytes.NewBufferString(tt.body)))
+			assertStatus(t, rr, tt.want)
+			if tt.code != "" {
+				assertErrorCode(t, rr, tt.code)
+			}
+		})
+	}
+
+	trunks, err := setup.DB.SIPTrunks.List(context.Background())
+	if err != nil || len(trunks) != 1 {
+		t.Fatalf("Expected 1 trunk, got %d (%v)", len(trunks), err)
+	}
+	trunk := trunks[0]
+	if trunk.Port != 5060 || trunk.Transport != "udp" || trunk.Expires != 3600 || !trunk.Register || !trunk.Enabled {
+		t.Errorf("Expected defaults to be filled in, got %+v", trunk)
+	}
+}
+
+func TestProviderTrunkHandler_UpdateKeepsPassword(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewProviderTrunkHandler(&Dependencies{DB: setup.DB})
+
+	rr := httptest.NewRecorder()
+	handler.Create(rr, httptest.NewRequest(http.MethodPost, "/api/trunks", bytes.NewBufferString(
+		`{"name": "Carrier", "host": "sip.carrier.example", "username": "pbx", "password": "s3cret"}`)))
+	assertStatus(t, rr, http.StatusCreated)
+	if strings.Contains(rr.Body.String(), "s3cret") {
+		t.Error("Expected the password not to be returned")
+	}
+	var created SIPTrunkResponse
+	decodeResponse(t, rr, &created)
+	if !created.HasPassword {
+		t.Error("Expected has_password to be true")
+	}
+	id := strconv.FormatInt(created.ID, 10)
+
+	req := withURLParams(httptest.NewRequest(http.MethodPut, "/api/trunks/"+id, bytes.NewBufferString(`{"transport": "TLS", "port": 5061}`)), map[string]string{"id": id})
+	rr = httptest.NewRecorder()
+	handler.Update(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+
+	trunk, err := setup.DB.SIPTrunks.GetByID(context.Background(), created.ID)
+	if err != nil {
+		t.Fatalf("Failed to get trunk: %v", err)
+	}
+	if trunk.Transport != "tls" || trunk.Port != 5061 || trunk.Password != "s3cret" || trunk.Username != "pbx" {
+		t.Errorf("Expected only transport and port to change, got %+v", trunk)
+	}
+
+	req = withURLParams(httptest.NewRequest(http.MethodPost, "/api/trunks/"+id+"/register", nil), map[string]string{"id": id})
+	rr = httptest.NewRecorder()
+	handler.Register(rr, req)
+	assertStatus(t, rr, http.StatusServiceUnavailable)
+
+	req = withURLParams(httptest.NewRequest(http.MethodDelete, "/api/trunks/"+id, nil), map[string]string{"id": id})
+	rr = httptest.NewRecorder()
+	handler.Delete(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+
+	req = withURLParams(httptest.NewRequest(http.MethodGet, "/api/trunks/"+id, nil), map[string]string{"id": id})
+	rr = httptest.NewRecorder()
+	handler.Get(rr, req)
+	assertStatus(t, rr, http.StatusNotFound)
+}
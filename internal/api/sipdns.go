@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/sipdns"
+	"github.com/miekg/dns"
+)
+
+// SIPDNSHandler checks and generates the DNS records that point phones and
+// carriers at the server
+type SIPDNSHandler struct {
+	deps *Dependencies
+
+	// newChecker is replaced in tests to query a local nameserver
+	newChecker func() (*sipdns.Checker, error)
+}
+
+// NewSIPDNSHandler creates a new SIPDNSHandler
+func NewSIPDNSHandler(deps *Dependencies) *SIPDNSHandler {
+	return &SIPDNSHandler{deps: deps, newChecker: sipdns.NewChecker}
+}
+
+// Check compares the NAPTR, SRV and address records of the SIP domain with
+// the ones this server needs (admin only). The domain, target host and IP
+// default to GOSIP_SIP_DOMAIN and GOSIP_EXTERNAL_IP and can be overridden
+// with ?domain=, ?target= and ?ip=.
+func (h *SIPDNSHandler) Check(w http.ResponseWriter, r *http.Request) {
+	params := h.params()
+	q := r.URL.Query()
+	if v := q.Get("domain"); v != "" {
+		params.Domain = v
+	}
+	if v := q.Get("target"); v != "" {
+		params.Target = v
+	}
+	if v := q.Get("ip"); v != "" {
+		params.IP = v
+	}
+
+	var errors []FieldError
+	if !isDNSName(params.Domain) {
+		errors = append(errors, FieldError{Field: "domain", Message: fmt.Sprintf("%q is not a domain name; set GOSIP_SIP_DOMAIN or pass ?domain=", params.Domain)})
+	}
+	if params.Target != "" && !isDNSName(params.Target) {
+		errors = append(errors, FieldError{Field: "target", Message: "Must be a host name"})
+	}
+	if params.IP != "" && net.ParseIP(params.IP) == nil {
+		errors = append(errors, FieldError{Field: "ip", Message: "Must be an IPv4 or IPv6 address"})
+	}
+	if len(errors) > 0 {
+		WriteValidationError(w, "Invalid DNS check parameters", errors)
+		return
+	}
+
+	checker, err := h.newChecker()
+	if err != nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "No nameserver available: "+err.Error(), nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.SelfTestCheckTimeout)
+	defer cancel()
+	report, err := checker.Check(ctx, params)
+	if err != nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "DNS lookup failed: "+err.Error(), nil)
+		return
+	}
+	WriteJSON(w, http.StatusOK, report)
+}
+
+// params describes this server from its configuration, preferring the
+// detected public address over GOSIP_EXTERNAL_IP
+func (h *SIPDNSHandler) params() sipdns.Params {
+	cfg := h.deps.Config
+	params := sipdns.Params{
+		Domain:      cfg.SIPDomain,
+		IP:          cfg.ExternalIP,
+		Port:        cfg.SIPPort,
+		Unencrypted: true,
+	}
+	if ip := h.deps.WANIP.IP(); ip != "" {
+		params.IP = ip
+	}
+	if cfg.TLS != nil && cfg.TLS.Enabled {
+		params.TLSPort = cfg.TLS.Port
+		params.Unencrypted = !cfg.TLS.DisableUnencrypted
+	}
+	return params
+}
+
+// isDNSName reports whether name is a public host name rather than an
+// address or localhost
+func isDNSName(name string) bool {
+	if name == "" || net.ParseIP(name) != nil || strings.EqualFold(strings.TrimSuffix(name, "."), "localhost") {
+		return false
+	}
+	_, ok := dns.IsDomainName(name)
+	return ok && strings.Contains(strings.TrimSuffix(name, "."), ".")
+}
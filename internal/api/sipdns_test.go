@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/sipdns"
+	"github.com/miekg/dns"
+)
+
+func TestSIPDNSHandler_Check(t *testing.T) {
+	handler := NewSIPDNSHandler(&Dependencies{Config: &config.Config{
+		SIPPort:    5060,
+		SIPDomain:  "example.com",
+		ExternalIP: "203.0.113.10",
+		TLS:        &config.TLSConfig{Enabled: true, Port: 5061, DisableUnencrypted: true},
+	}})
+
+	var queried []string
+	handler.newChecker = func() (*sipdns.Checker, error) {
+		return &sipdns.Checker{Query: func(ctx context.Context, name string, qtype uint16) ([]dns.RR, error) {
+			queried = append(queried, dns.TypeToString[qtype]+" "+name)
+			if qtype == dns.TypeA {
+				rr, _ := dns.NewRR(name + " 300 IN A 203.0.113.10")
+				return []dns.RR{rr}, nil
+			}
+			return nil, nil
+		}}, nil
+	}
+
+	rr := httptest.NewRecorder()
+	handler.Check(rr, httptest.NewRequest(http.MethodGet, "/api/system/dns?target=sip.example.com", nil))
+	assertStatus(t, rr, http.StatusOK)
+
+	var report sipdns.Report
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if report.OK {
+		t.Error("Expected a missing SRV record to fail the check")
+	}
+	if report.Target != "sip.example.com." || !strings.Contains(report.Zone, "_sips._tcp.example.com.\t3600\tIN\tSRV\t10 10 5061 sip.example.com.") {
+		t.Errorf("Expected a SIPS SRV record for the target, got:\n%s", report.Zone)
+	}
+	if strings.Contains(report.Zone, "_sip._udp") {
+		t.Errorf("Expected no UDP records with unencrypted SIP disabled, got:\n%s", report.Zone)
+	}
+	if !strings.Contains(strings.Join(queried, ","), "A sip.example.com.") {
+		t.Errorf("Expected the target's address looked up, got %v", queried)
+	}
+}
+
+func TestSIPDNSHandler_Validation(t *testing.T) {
+	handler := NewSIPDNSHandler(&Dependencies{Config: &config.Config{SIPPort: 5060, SIPDomain: "localhost"}})
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"localhost default", ""},
+		{"ip domain", "?domain=203.0.113.10"},
+		{"bad ip", "?domain=example.com&ip=not-an-ip"},
+		{"bad target", "?domain=example.com&target=bad..name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.Check(rr, httptest.NewRequest(http.MethodGet, "/api/system/dns"+tt.query, nil))
+			assertStatus(t, rr, http.StatusBadRequest)
+			assertErrorCode(t, rr, ErrCodeValidation)
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StatusPageHandler serves a plaintext status summary for monitoring
+// systems that can't read the JSON API, such as Nagios or MRTG
+type StatusPageHandler struct {
+	deps      *Dependencies
+	startTime time.Time
+}
+
+// NewStatusPageHandler creates a new StatusPageHandler
+func NewStatusPageHandler(deps *Dependencies) *StatusPageHandler {
+	return &StatusPageHandler{deps: deps, startTime: time.Now()}
+}
+
+// Status writes one key=value pair per line. status is "ok", "degraded"
+// when the Twilio trunk is unhealthy, or "down" when the SIP server isn't
+// running, in which case the response is 503 so checks that only look at
+// the status code still alert.
+func (h *StatusPageHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sipServer := "offline"
+	registrations, activeCalls := 0, 0
+	if h.deps.SIP != nil && h.deps.SIP.IsRunning() {
+		sipServer = "online"
+		registrations = h.deps.SIP.GetRegistrar().GetRegistrationCount()
+		activeCalls = h.deps.SIP.GetActiveCallCount()
+	}
+
+	trunk := "not_configured"
+	if h.deps.Twilio != nil {
+		trunk = "healthy"
+		if !h.deps.Twilio.IsHealthy() {
+			trunk = "degraded"
+		}
+	}
+
+	devices, _ := h.deps.DB.Devices.Count(r.Context())
+
+	status, code := "ok", http.StatusOK
+	switch {
+	case sipServer != "online":
+		status, code = "down", http.StatusServiceUnavailable
+	case trunk == "degraded":
+		status = "degraded"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "status=%s\n", status)
+	fmt.Fprintf(&b, "uptime_seconds=%d\n", int64(time.Since(h.startTime).Seconds()))
+	fmt.Fprintf(&b, "sip_server=%s\n", sipServer)
+	fmt.Fprintf(&b, "registrations=%d\n", registrations)
+	fmt.Fprintf(&b, "devices=%d\n", devices)
+	fmt.Fprintf(&b, "active_calls=%d\n", activeCalls)
+	fmt.Fprintf(&b, "trunk=%s\n", trunk)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	w.Write([]byte(b.String()))
+}
+
+// authorized reports whether the request carries the configured status
+// token, as a token query parameter or a Bearer token. Without a
+// configured token every request is allowed.
+func (h *StatusPageHandler) authorized(r *http.Request) bool {
+	want := h.deps.Config.StatusPageToken
+	if want == "" {
+		return true
+	}
+
+	got := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		got = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
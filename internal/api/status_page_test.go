@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+)
+
+func TestStatusPageHandler_Status(t *testing.T) {
+	setup := setupTestAPI(t)
+	createTestDevice(t, setup.DB, "Desk", "desk")
+	handler := NewStatusPageHandler(&Dependencies{DB: setup.DB, Twilio: setup.Twilio, Config: &config.Config{}})
+
+	rr := httptest.NewRecorder()
+	handler.Status(rr, httptest.NewRequest(http.MethodGet, "/status.txt", nil))
+
+	// Without a running SIP server the system is down
+	assertStatus(t, rr, http.StatusServiceUnavailable)
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected text/plain, got %q", ct)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{"status=down\n", "sip_server=offline\n", "registrations=0\n", "devices=1\n", "active_calls=0\n", "trunk=healthy\n"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in status page:\n%s", want, body)
+		}
+	}
+}
+
+func TestStatusPageHandler_Token(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewStatusPageHandler(&Dependencies{DB: setup.DB, Config: &config.Config{StatusPageToken: "s3cret"}})
+
+	tests := []struct {
+		name   string
+		target string
+		auth   string
+		want   int
+	}{
+		{"missing token", "/status.txt", "", http.StatusUnauthorized},
+		{"wrong token", "/status.txt?token=nope", "", http.StatusUnauthorized},
+		{"query token", "/status.txt?token=s3cret", "", http.StatusServiceUnavailable},
+		{"bearer token", "/status.txt", "Bearer s3cret", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rr := httptest.NewRecorder()
+			handler.Status(rr, req)
+			assertStatus(t, rr, tt.want)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// StorageHandler reports what the data directory holds and how much space is left
+type StorageHandler struct {
+	deps *Dependencies
+}
+
+// NewStorageHandler creates a new StorageHandler
+func NewStorageHandler(deps *Dependencies) *StorageHandler {
+	return &StorageHandler{deps: deps}
+}
+
+// Get returns disk usage by category with cleanup suggestions (admin
+// only). The last scheduled check is returned unless refresh=true.
+func (h *StorageHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if h.deps.Storage == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Storage monitoring is not available", nil)
+		return
+	}
+	report := h.deps.Storage.Report()
+	if report == nil || r.URL.Query().Get("refresh") == "true" {
+		report = h.deps.Storage.Check(r.Context())
+	}
+	WriteJSON(w, http.StatusOK, report)
+}
+
+// storageLow reports whether new recordings should be refused because the
+// data directory is low on free space
+func storageLow(ctx context.Context, deps *Dependencies) bool {
+	if deps.Storage == nil || !deps.Storage.Low(ctx) {
+		return false
+	}
+	slog.Warn("Refusing a new recording, the disk is low on free space")
+	return true
+}
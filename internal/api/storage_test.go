@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/storage"
+)
+
+func TestStorageGuardrails(t *testing.T) {
+	setup := setupTestAPI(t)
+	ctx := context.Background()
+	monitor := storage.NewMonitor(&config.Config{DataDir: t.TempDir()}, setup.DB, nil, nil)
+	deps := &Dependencies{DB: setup.DB, Storage: monitor}
+	did := createTestDID(t, setup.DB, "+15551234567")
+
+	if twiml := NewWebhookHandler(deps).voicemailTwiML(did, "+15559876543"); !strings.Contains(twiml, "<Record") {
+		t.Fatalf("Expected the message to be recorded, got %s", twiml)
+	}
+
+	// No disk has a terabyte free beyond what it reports
+	setup.DB.Config.Set(ctx, storage.SettingMinFreeMB, "1048576")
+
+	if twiml := NewWebhookHandler(deps).voicemailTwiML(did, "+15559876543"); strings.Contains(twiml, "<Record") {
+		t.Errorf("Expected voicemail refused while the disk is low, got %s", twiml)
+	}
+	greetings := NewGreetingHandler(deps)
+	if twiml := greetings.recordTwiML(ctx, did.ID, "standard"); strings.Contains(twiml, "<Record") || !strings.Contains(twiml, "could not be saved") {
+		t.Errorf("Expected greeting recording refused while the disk is low, got %s", twiml)
+	}
+
+	rr := httptest.NewRecorder()
+	NewCallHandler(deps).UploadMOHAudio(rr, httptest.NewRequest(http.MethodPost, "/api/calls/moh/upload", nil))
+	assertStatus(t, rr, http.StatusInsufficientStorage)
+
+	rr = httptest.NewRecorder()
+	NewStorageHandler(deps).Get(rr, httptest.NewRequest(http.MethodGet, "/api/system/storage", nil))
+	assertStatus(t, rr, http.StatusOK)
+	var report storage.Report
+	decodeResponse(t, rr, &report)
+	if !report.Low || len(report.Categories) == 0 {
+		t.Errorf("Expected a low disk report with categories, got %+v", report)
+	}
+}
+
+func TestStorageHandler_Unavailable(t *testing.T) {
+	setup := setupTestAPI(t)
+	rr := httptest.NewRecorder()
+	NewStorageHandler(&Dependencies{DB: setup.DB}).Get(rr, httptest.NewRequest(http.MethodGet, "/api/system/storage", nil))
+	assertStatus(t, rr, http.StatusServiceUnavailable)
+}
@@ -3,12 +3,26 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"runtime"
+	"strconv"
 	"time"
 
+	"github.com/btafoya/gosip/internal/announcements"
+	"github.com/btafoya/gosip/internal/blocklist"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/diagnostics"
+	"github.com/btafoya/gosip/internal/i18n"
 	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/reminders"
+	"github.com/btafoya/gosip/internal/retry"
+	"github.com/btafoya/gosip/internal/rules"
+	"github.com/btafoya/gosip/internal/shortlinks"
+	"github.com/btafoya/gosip/internal/storage"
+	"github.com/btafoya/gosip/internal/twilio"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -30,6 +44,7 @@ func NewSystemHandler(deps *Dependencies) *SystemHandler {
 type ConfigResponse struct {
 	TwilioAccountSID     string `json:"twilio_account_sid,omitempty"`
 	TwilioConfigured     bool   `json:"twilio_configured"`
+	TwilioMessagingSID   string `json:"twilio_messaging_service_sid,omitempty"`
 	SMTPHost             string `json:"smtp_host,omitempty"`
 	SMTPPort             int    `json:"smtp_port,omitempty"`
 	SMTPUser             string `json:"smtp_user,omitempty"`
@@ -42,6 +57,18 @@ type ConfigResponse struct {
 	RecordingEnabled     bool   `json:"recording_enabled"`
 	TranscriptionEnabled bool   `json:"transcription_enabled"`
 	Timezone             string `json:"timezone,omitempty"`
+	DefaultLanguage      string `json:"default_language"`
+	DiscoveryEnabled     bool   `json:"discovery_enabled"`
+	ResponderEnabled     bool   `json:"provisioning_responder_enabled"`
+	BlocklistFeeds       bool   `json:"blocklist_feeds_enabled"`
+	BlocklistSchedule    string `json:"blocklist_feed_schedule"`
+	BlocklistRejectCode  int    `json:"blocklist_reject_code"`
+	IntercomPrefix       string `json:"intercom_prefix"`
+	DIDSelectPrefix      string `json:"did_select_prefix"`
+	AnonymousPrefix      string `json:"anonymous_prefix"`
+	StorageMinFreeMB     int    `json:"storage_min_free_mb"`
+	LinkShortening       bool   `json:"link_shortening_enabled"`
+	ReminderDigestHour   int    `json:"reminder_digest_hour"`
 }
 
 // GetConfig returns current system configuration
@@ -68,6 +95,7 @@ func (h *SystemHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
 	response := ConfigResponse{
 		TwilioAccountSID:     cfg["twilio_account_sid"],
 		TwilioConfigured:     cfg["twilio_account_sid"] != "",
+		TwilioMessagingSID:   cfg["twilio_messaging_service_sid"],
 		SMTPHost:             cfg["smtp_host"],
 		SMTPPort:             smtpPort,
 		SMTPUser:             cfg["smtp_user"],
@@ -80,12 +108,42 @@ func (h *SystemHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
 		RecordingEnabled:     cfg["recording_enabled"] == "true",
 		TranscriptionEnabled: cfg["transcription_enabled"] == "true",
 		Timezone:             cfg["timezone"],
+		DefaultLanguage:      i18n.Resolve(cfg["default_language"]),
+		DiscoveryEnabled:     cfg["discovery_enabled"] == "true",
+		ResponderEnabled:     cfg["provisioning_responder_enabled"] == "true",
+		BlocklistFeeds:       cfg["blocklist_feeds_enabled"] == "true",
+		BlocklistSchedule:    cfg["blocklist_feed_schedule"],
+		BlocklistRejectCode:  rules.DefaultRejectCode,
+		IntercomPrefix:       cfg["intercom_prefix"],
+		DIDSelectPrefix:      cfg["did_select_prefix"],
+		AnonymousPrefix:      cfg["anonymous_prefix"],
+		StorageMinFreeMB:     config.DefaultStorageMinFreeMB,
+		LinkShortening:       cfg[shortlinks.SettingEnabled] == "true",
+		ReminderDigestHour:   config.DefaultReminderDigestHour,
 	}
 
 	// Default timezone if not set
 	if response.Timezone == "" {
 		response.Timezone = "America/New_York"
 	}
+	if code, err := strconv.Atoi(cfg["blocklist_reject_code"]); err == nil {
+		response.BlocklistRejectCode = code
+	}
+	if mb, err := strconv.Atoi(cfg[storage.SettingMinFreeMB]); err == nil {
+		response.StorageMinFreeMB = mb
+	}
+	if hour, err := strconv.Atoi(cfg[reminders.SettingDigestHour]); err == nil {
+		response.ReminderDigestHour = hour
+	}
+	if response.IntercomPrefix == "" {
+		response.IntercomPrefix = config.DefaultIntercomPrefix
+	}
+	if response.DIDSelectPrefix == "" {
+		response.DIDSelectPrefix = config.DefaultDIDSelectPrefix
+	}
+	if response.AnonymousPrefix == "" {
+		response.AnonymousPrefix = config.DefaultAnonymousPrefix
+	}
 
 	WriteJSON(w, http.StatusOK, response)
 }
@@ -102,6 +160,72 @@ type UpdateConfigRequest struct {
 	GotifyToken       string `json:"gotify_token,omitempty"`
 	VoicemailGreeting string `json:"voicemail_greeting,omitempty"`
 	Timezone          string `json:"timezone,omitempty"`
+	DefaultLanguage   string `json:"default_language,omitempty"`
+	DiscoveryEnabled  *bool  `json:"discovery_enabled,omitempty"`
+	ResponderEnabled  *bool  `json:"provisioning_responder_enabled,omitempty"`
+	BlocklistFeeds    *bool  `json:"blocklist_feeds_enabled,omitempty"`
+	BlocklistSchedule string `json:"blocklist_feed_schedule,omitempty"`
+	IntercomPrefix    string `json:"intercom_prefix,omitempty"`
+	DIDSelectPrefix   string `json:"did_select_prefix,omitempty"`
+	AnonymousPrefix   string `json:"anonymous_prefix,omitempty"`
+	// TwilioMessagingSID sends SMS from DIDs without their own Messaging Service through this one; "" turns it off
+	TwilioMessagingSID *string `json:"twilio_messaging_service_sid,omitempty"`
+	// BlocklistRejectCode is how blocklisted callers are turned away: 603 (default), 486, 480 or 404
+	BlocklistRejectCode int `json:"blocklist_reject_code,omitempty"`
+	// StorageMinFreeMB is the free space below which new recordings are refused; 0 turns the guardrail off
+	StorageMinFreeMB *int `json:"storage_min_free_mb,omitempty"`
+	// LinkShortening replaces links in outbound messages with short links GoSIP serves, counting clicks
+	LinkShortening *bool `json:"link_shortening_enabled,omitempty"`
+	// ReminderDigestHour is the hour the digest of unconfirmed appointments is sent; -1 turns it off
+	ReminderDigestHour *int `json:"reminder_digest_hour,omitempty"`
+}
+
+// EffectiveConfigResponse lists every setting with the value in use and
+// where it came from
+type EffectiveConfigResponse struct {
+	File     string           `json:"file,omitempty"`
+	Settings []config.Setting `json:"settings"`
+}
+
+// GetEffectiveConfig returns the resolved server settings and database
+// settings, with secrets redacted
+func (h *SystemHandler) GetEffectiveConfig(w http.ResponseWriter, r *http.Request) {
+	response := EffectiveConfigResponse{Settings: []config.Setting{}}
+	pinned := map[string]config.Setting{}
+	if h.deps.Config != nil {
+		response.File = h.deps.Config.File()
+		response.Settings = append(response.Settings, h.deps.Config.Settings()...)
+		pinned = h.deps.Config.PinnedSettings()
+	}
+
+	configs, err := h.deps.DB.Config.GetAll(r.Context())
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	stored := make(map[string]string)
+	for _, c := range configs {
+		stored[c.Key] = c.Value
+	}
+
+	for _, key := range config.DatabaseSettings {
+		setting, ok := pinned[key]
+		if !ok {
+			setting = config.Setting{Key: key, Value: stored[key], Source: config.SourceDatabase}
+			if setting.Value == "" {
+				setting.Source = config.SourceDefault
+			}
+		}
+		response.Settings = append(response.Settings, setting)
+	}
+
+	for i, setting := range response.Settings {
+		if setting.Value != "" && diagnostics.IsSecret(setting.Key) {
+			response.Settings[i].Value = diagnostics.Redacted
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, response)
 }
 
 // UpdateConfig updates system configuration values
@@ -112,6 +236,11 @@ func (h *SystemHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if errs := req.validate(); len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
 	ctx := r.Context()
 
 	// Update Twilio settings (only if provided)
@@ -125,6 +254,9 @@ func (h *SystemHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 			h.deps.Twilio.UpdateCredentials(req.TwilioAccountSID, req.TwilioAuthToken)
 		}
 	}
+	if req.TwilioMessagingSID != nil {
+		h.deps.DB.Config.Set(ctx, "twilio_messaging_service_sid", *req.TwilioMessagingSID)
+	}
 
 	// Update SMTP settings
 	if req.SMTPHost != "" {
@@ -155,10 +287,88 @@ func (h *SystemHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 	if req.Timezone != "" {
 		h.deps.DB.Config.Set(ctx, "timezone", req.Timezone)
 	}
+	if req.DefaultLanguage != "" {
+		h.deps.DB.Config.Set(ctx, "default_language", req.DefaultLanguage)
+	}
+	if req.DiscoveryEnabled != nil {
+		h.deps.DB.Config.Set(ctx, "discovery_enabled", strconv.FormatBool(*req.DiscoveryEnabled))
+	}
+	if req.ResponderEnabled != nil {
+		h.deps.DB.Config.Set(ctx, "provisioning_responder_enabled", strconv.FormatBool(*req.ResponderEnabled))
+	}
+	if req.BlocklistFeeds != nil {
+		h.deps.DB.Config.Set(ctx, "blocklist_feeds_enabled", strconv.FormatBool(*req.BlocklistFeeds))
+	}
+	if req.BlocklistSchedule != "" {
+		h.deps.DB.Config.Set(ctx, "blocklist_feed_schedule", req.BlocklistSchedule)
+	}
+	if req.BlocklistRejectCode != 0 {
+		h.deps.DB.Config.Set(ctx, "blocklist_reject_code", strconv.Itoa(req.BlocklistRejectCode))
+	}
+	if req.StorageMinFreeMB != nil {
+		h.deps.DB.Config.Set(ctx, storage.SettingMinFreeMB, strconv.Itoa(*req.StorageMinFreeMB))
+	}
+	if req.IntercomPrefix != "" {
+		h.deps.DB.Config.Set(ctx, "intercom_prefix", req.IntercomPrefix)
+	}
+	if req.DIDSelectPrefix != "" {
+		h.deps.DB.Config.Set(ctx, "did_select_prefix", req.DIDSelectPrefix)
+	}
+	if req.AnonymousPrefix != "" {
+		h.deps.DB.Config.Set(ctx, "anonymous_prefix", req.AnonymousPrefix)
+	}
+	if req.LinkShortening != nil {
+		h.deps.DB.Config.Set(ctx, shortlinks.SettingEnabled, strconv.FormatBool(*req.LinkShortening))
+	}
+	if req.ReminderDigestHour != nil {
+		h.deps.DB.Config.Set(ctx, reminders.SettingDigestHour, strconv.Itoa(*req.ReminderDigestHour))
+	}
 
 	WriteJSON(w, http.StatusOK, map[string]string{"message": "Configuration updated"})
 }
 
+// validate checks the values of a configuration update without applying
+// anything
+func (req *UpdateConfigRequest) validate() []FieldError {
+	var errs []FieldError
+	if req.SMTPPort != 0 && (req.SMTPPort < 1 || req.SMTPPort > 65535) {
+		errs = append(errs, FieldError{Field: "smtp_port", Message: "Port must be 1 to 65535"})
+	}
+	if req.Timezone != "" && !validTimezone(req.Timezone) {
+		errs = append(errs, FieldError{Field: "timezone", Message: "Unknown timezone"})
+	}
+	if req.DefaultLanguage != "" && !i18n.IsSupported(req.DefaultLanguage) {
+		errs = append(errs, FieldError{Field: "default_language", Message: languageFieldError.Message})
+	}
+	if req.BlocklistSchedule != "" {
+		if _, err := blocklist.ParseSchedule(req.BlocklistSchedule); err != nil {
+			errs = append(errs, FieldError{Field: "blocklist_feed_schedule", Message: "Invalid cron expression: " + err.Error()})
+		}
+	}
+	if req.TwilioMessagingSID != nil && *req.TwilioMessagingSID != "" && !twilio.IsMessagingServiceSID(*req.TwilioMessagingSID) {
+		errs = append(errs, messagingServiceFieldError("twilio_messaging_service_sid"))
+	}
+	if _, ok := rules.RejectCodes[req.BlocklistRejectCode]; req.BlocklistRejectCode != 0 && !ok {
+		errs = append(errs, FieldError{Field: "blocklist_reject_code", Message: "SIP code must be 603, 486, 480 or 404"})
+	}
+	if req.StorageMinFreeMB != nil && (*req.StorageMinFreeMB < 0 || *req.StorageMinFreeMB > 1<<20) {
+		errs = append(errs, FieldError{Field: "storage_min_free_mb", Message: "Minimum free space must be 0 to 1048576 MB"})
+	}
+	if req.ReminderDigestHour != nil && (*req.ReminderDigestHour < -1 || *req.ReminderDigestHour > 23) {
+		errs = append(errs, FieldError{Field: "reminder_digest_hour", Message: "Digest hour must be 0 to 23, or -1 to turn the digest off"})
+	}
+	if req.IntercomPrefix != "" && !validDialPrefix(req.IntercomPrefix) {
+		errs = append(errs, FieldError{Field: "intercom_prefix", Message: "Prefix must be 1-8 digits, '*' or '#'"})
+	}
+	if req.DIDSelectPrefix != "" && !validDialPrefix(req.DIDSelectPrefix) {
+		errs = append(errs, FieldError{Field: "did_select_prefix", Message: "Prefix must be 1-8 digits, '*' or '#'"})
+	}
+	if req.AnonymousPrefix != "" && !validDialPrefix(req.AnonymousPrefix) {
+		errs = append(errs, FieldError{Field: "anonymous_prefix", Message: "Prefix must be 1-8 digits, '*' or '#'"})
+	}
+	return errs
+}
+
 // SetupWizardRequest represents setup wizard data
 type SetupWizardRequest struct {
 	TwilioAccountSID  string `json:"twilio_account_sid"`
@@ -199,9 +409,7 @@ func (h *SystemHandler) SetupWizard(w http.ResponseWriter, r *http.Request) {
 	if req.AdminEmail == "" {
 		errors = append(errors, FieldError{Field: "admin_email", Message: "Admin email is required"})
 	}
-	if len(req.AdminPassword) < 8 {
-		errors = append(errors, FieldError{Field: "admin_password", Message: "Admin password must be at least 8 characters"})
-	}
+	errors = append(errors, checkPassword(r.Context(), h.deps, "admin_password", req.AdminPassword)...)
 
 	if len(errors) > 0 {
 		WriteValidationError(w, "Validation failed", errors)
@@ -324,6 +532,12 @@ func (h *SystemHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, http.StatusOK, response)
 }
 
+// ListWorkers returns the retry policy of each background worker and how it
+// has fared since the server started
+func (h *SystemHandler) ListWorkers(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, retry.All())
+}
+
 // BackupResponse represents a backup creation response
 type BackupResponse struct {
 	Filename  string `json:"filename"`
@@ -334,6 +548,11 @@ type BackupResponse struct {
 // CreateBackup creates a database backup
 func (h *SystemHandler) CreateBackup(w http.ResponseWriter, r *http.Request) {
 	filename, size, err := h.deps.DB.CreateBackup(r.Context())
+	if errors.Is(err, db.ErrUnsupported) {
+		WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Back up the Postgres database with pg_dump", nil)
+		return
+	}
+	announcements.RecordBackup(r.Context(), h.deps.DB, h.deps.Events, err)
 	if err != nil {
 		WriteInternalError(w)
 		return
@@ -481,6 +700,10 @@ func (h *SystemHandler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.deps.DB.RestoreBackup(r.Context(), req.Filename); err != nil {
+		if errors.Is(err, db.ErrUnsupported) {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "Restore the Postgres database with pg_restore", nil)
+			return
+		}
 		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to restore backup", nil)
 		return
 	}
@@ -532,3 +755,16 @@ func createAdminUser(ctx context.Context, h *AuthHandler, email, password string
 
 	return user.ID, nil
 }
+
+// validDialPrefix reports whether a dialing prefix can be entered on a phone keypad
+func validDialPrefix(prefix string) bool {
+	if len(prefix) == 0 || len(prefix) > 8 {
+		return false
+	}
+	for _, r := range prefix {
+		if (r < '0' || r > '9') && r != '*' && r != '#' {
+			return false
+		}
+	}
+	return true
+}
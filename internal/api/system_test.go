@@ -4,9 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
 )
 
 func TestSystemHandler_GetConfig(t *testing.T) {
@@ -508,3 +513,114 @@ func TestSystemHandler_GetConfig_FullSID(t *testing.T) {
 		})
 	}
 }
+
+func TestSystemHandler_GetEffectiveConfig(t *testing.T) {
+	setup := setupTestAPI(t)
+	os.Setenv("GOSIP_SETTING_TIMEZONE", "Europe/Berlin")
+	defer os.Unsetenv("GOSIP_SETTING_TIMEZONE")
+	cfg, err := config.LoadFile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewSystemHandler(&Dependencies{DB: setup.DB, Config: cfg})
+
+	setup.DB.Config.Set(context.Background(), "smtp_host", "smtp.example.com")
+	setup.DB.Config.Set(context.Background(), "twilio_auth_token", "secret-token")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/system/config/effective", nil)
+	rr := httptest.NewRecorder()
+	handler.GetEffectiveConfig(rr, req)
+
+	assertStatus(t, rr, http.StatusOK)
+
+	var resp EffectiveConfigResponse
+	decodeResponse(t, rr, &resp)
+
+	settings := make(map[string]config.Setting)
+	for _, s := range resp.Settings {
+		settings[s.Key] = s
+	}
+	tests := []struct {
+		key, value, source string
+	}{
+		{"GOSIP_SIP_PORT", "5060", config.SourceDefault},
+		{"smtp_host", "smtp.example.com", config.SourceDatabase},
+		{"twilio_auth_token", "[redacted]", config.SourceDatabase},
+		{"timezone", "Europe/Berlin", config.SourceEnv},
+		{"gotify_url", "", config.SourceDefault},
+	}
+	for _, tt := range tests {
+		if got := settings[tt.key]; got.Value != tt.value || got.Source != tt.source {
+			t.Errorf("%s = %+v, want value %q from %s", tt.key, got, tt.value, tt.source)
+		}
+	}
+}
+
+func TestSystemHandler_ValidateConfig(t *testing.T) {
+	setup := setupTestAPI(t)
+	cfg := &config.Config{SIPPort: 5060, HTTPPort: 8080, TLS: &config.TLSConfig{Port: 5061, WSSPort: 5081}}
+	handler := NewSystemHandler(&Dependencies{DB: setup.DB, Config: cfg})
+
+	smtp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer smtp.Close()
+	taken, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	validate := func(body string) ConfigValidationResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/system/config/validate", bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		handler.ValidateConfig(rr, req)
+		assertStatus(t, rr, http.StatusOK)
+		var resp ConfigValidationResponse
+		decodeResponse(t, rr, &resp)
+		return resp
+	}
+
+	resp := validate(fmt.Sprintf(`{"timezone": "Mars/Olympus", "smtp_host": "127.0.0.1", "smtp_port": %d,
+		"tls": {"enabled": true, "cert_mode": "manual", "port": 8080, "wss_port": %d, "cert_file": "/nonexistent/cert.pem"}}`,
+		closedPort, taken.Addr().(*net.TCPAddr).Port))
+	if resp.Valid {
+		t.Error("Expected the change to be invalid")
+	}
+	problems := make(map[string]string)
+	for _, p := range resp.Problems {
+		problems[p.Field] = p.Severity
+	}
+	expected := map[string]string{
+		"timezone":      ConfigProblemError,
+		"tls.port":      ConfigProblemError,   // Used by the web server
+		"tls.wss_port":  ConfigProblemWarning, // Held by another program
+		"tls.cert_file": ConfigProblemError,
+		"smtp_host":     ConfigProblemWarning,
+	}
+	for field, severity := range expected {
+		if problems[field] != severity {
+			t.Errorf("Expected a %s for %s, got %+v", severity, field, resp.Problems)
+		}
+	}
+
+	resp = validate(fmt.Sprintf(`{"timezone": "Europe/London", "smtp_host": "127.0.0.1", "smtp_port": %d,
+		"tls": {"port": 5061, "min_version": "1.3"}}`, smtp.Addr().(*net.TCPAddr).Port))
+	if !resp.Valid || len(resp.Problems) != 0 {
+		t.Errorf("Expected a valid change, got %+v", resp.Problems)
+	}
+	if _, err := setup.DB.Config.Get(context.Background(), "timezone"); err == nil {
+		t.Error("Expected nothing saved")
+	}
+
+	// Saving refuses the invalid timezone too
+	req := httptest.NewRequest(http.MethodPut, "/api/system/config", bytes.NewBufferString(`{"timezone": "Mars/Olympus"}`))
+	rr := httptest.NewRecorder()
+	handler.UpdateConfig(rr, req)
+	assertStatus(t, rr, http.StatusBadRequest)
+}
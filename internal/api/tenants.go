@@ -0,0 +1,377 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/i18n"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// TenantHandler manages tenants: separate customers sharing the instance,
+// each seeing only its own users, devices, DIDs, routes and history
+type TenantHandler struct {
+	deps *Dependencies
+}
+
+// NewTenantHandler creates a new TenantHandler
+func NewTenantHandler(deps *Dependencies) *TenantHandler {
+	return &TenantHandler{deps: deps}
+}
+
+// TenantRequest creates or changes a tenant
+type TenantRequest struct {
+	Name      string `json:"name"`
+	SIPDomain string `json:"sip_domain"` // Domain the tenant's devices register to; empty for none
+}
+
+// tenantSettings are the settings a tenant may override, with their checks
+var tenantSettings = map[string]struct {
+	valid func(string) bool
+	err   FieldError
+}{
+	"timezone":         {validTimezone, timezoneFieldError("timezone")},
+	"default_language": {i18n.IsSupported, FieldError{Field: "default_language", Message: languageFieldError.Message}},
+}
+
+// tenantRoutes are the endpoints open to tenant users, by method and route
+// pattern. Everything else manages the instance as a whole.
+var tenantRoutes = map[string]bool{
+	"GET /api/me":                               true,
+	"PUT /api/me/password":                      true,
+	"PUT /api/me/language":                      true,
+	"PUT /api/me/caller-id":                     true,
+	"GET /api/me/notifications":                 true,
+	"PUT /api/me/notifications":                 true,
+	"GET /api/me/phone":                         true,
+	"POST /api/me/phone/credentials":            true,
+	"DELETE /api/me/phone/credentials":          true,
+	"GET /api/announcements":                    true,
+	"GET /api/read-only":                        true,
+	"GET /api/devices":                          true,
+	"POST /api/devices":                         true,
+	"GET /api/devices/{id}":                     true,
+	"PUT /api/devices/{id}":                     true,
+	"DELETE /api/devices/{id}":                  true,
+	"GET /api/devices/{id}/dids":                true,
+	"PUT /api/devices/{id}/dids":                true,
+	"POST /api/devices/{id}/credentials/rotate": true,
+	"GET /api/dids":                             true,
+	"GET /api/dids/{id}":                        true,
+	"PUT /api/dids/{id}":                        true,
+	"GET /api/routes":                           true,
+	"POST /api/routes":                          true,
+	"GET /api/routes/{id}":                      true,
+	"PUT /api/routes/{id}":                      true,
+	"DELETE /api/routes/{id}":                   true,
+	"GET /api/messages":                         true,
+	"POST /api/messages":                        true,
+	"GET /api/messages/channels":                true,
+	"GET /api/messages/{id}":                    true,
+	"PUT /api/messages/{id}/read":               true,
+	"DELETE /api/messages/{id}":                 true,
+	"GET /api/cdrs":                             true,
+	"GET /api/cdrs/{id}":                        true,
+	"GET /api/users":                            true,
+	"POST /api/users":                           true,
+	"GET /api/users/{id}":                       true,
+	"PUT /api/users/{id}":                       true,
+	"DELETE /api/users/{id}":                    true,
+	"GET /api/tenants/{id}":                     true,
+	"GET /api/tenants/{id}/config":              true,
+	"PUT /api/tenants/{id}/config":              true,
+}
+
+// TenantRoutesMiddleware keeps tenant users to the endpoints in
+// tenantRoutes. root is the router the request is matched against.
+// Mount it after AuthMiddleware.
+func TenantRoutesMiddleware(root chi.Routes) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tenantOf(r) != nil {
+				rctx := chi.NewRouteContext()
+				if !root.Match(rctx, r.Method, r.URL.Path) || !tenantRoutes[r.Method+" "+rctx.RoutePattern()] {
+					WriteError(w, http.StatusForbidden, ErrCodeAuthorization, "Not available to tenant users", nil)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tenantOf returns the tenant of the signed-in user; nil for the
+// instance's own users
+func tenantOf(r *http.Request) *int64 {
+	if user := GetUserFromContext(r.Context()); user != nil {
+		return user.TenantID
+	}
+	return nil
+}
+
+// visibleTo reports whether a record of a tenant is visible to the
+// signed-in user: instance users see every tenant's, tenant users only
+// their own
+func visibleTo(r *http.Request, tenantID *int64) bool {
+	own := tenantOf(r)
+	return own == nil || sameTenant(own, tenantID)
+}
+
+// sameTenant reports whether two tenant IDs are the same tenant, nil being
+// the instance's own
+func sameTenant(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// tenantField checks a tenant_id given in a request. Only instance admins
+// place records under a tenant, and 0 is the instance itself. The error
+// response is written and ok is false when the field can't be used.
+func tenantField(w http.ResponseWriter, r *http.Request, deps *Dependencies, requested int64) (tenantID *int64, ok bool) {
+	if user := GetUserFromContext(r.Context()); user == nil || user.Role != "admin" || user.TenantID != nil {
+		WriteForbiddenError(w)
+		return nil, false
+	}
+	if requested == 0 {
+		return nil, true
+	}
+	if _, err := deps.DB.Tenants.GetByID(r.Context(), requested); err != nil {
+		if errors.Is(err, db.ErrTenantNotFound) {
+			WriteValidationError(w, "Validation failed", []FieldError{{Field: "tenant_id", Message: "Tenant not found"}})
+			return nil, false
+		}
+		WriteInternalError(w)
+		return nil, false
+	}
+	return &requested, true
+}
+
+// List returns all tenants
+// GET /api/tenants
+func (h *TenantHandler) List(w http.ResponseWriter, r *http.Request) {
+	tenants, err := h.deps.DB.Tenants.List(r.Context())
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if tenants == nil {
+		tenants = []*models.Tenant{}
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"data": tenants})
+}
+
+// Create adds a tenant
+// POST /api/tenants
+func (h *TenantHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req TenantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	tenant := &models.Tenant{Name: strings.TrimSpace(req.Name), SIPDomain: strings.ToLower(strings.TrimSpace(req.SIPDomain))}
+	if !h.validate(w, r, tenant) {
+		return
+	}
+	if err := h.deps.DB.Tenants.Create(r.Context(), tenant); err != nil {
+		WriteInternalError(w)
+		return
+	}
+	WriteJSON(w, http.StatusCreated, tenant)
+}
+
+// Get returns a tenant; tenant users only their own
+// GET /api/tenants/{id}
+func (h *TenantHandler) Get(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	WriteJSON(w, http.StatusOK, tenant)
+}
+
+// Update renames a tenant or changes its SIP domain
+// PUT /api/tenants/{id}
+func (h *TenantHandler) Update(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	var req TenantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	tenant.Name = strings.TrimSpace(req.Name)
+	tenant.SIPDomain = strings.ToLower(strings.TrimSpace(req.SIPDomain))
+	if !h.validate(w, r, tenant) {
+		return
+	}
+	if err := h.deps.DB.Tenants.Update(r.Context(), tenant); err != nil {
+		WriteInternalError(w)
+		return
+	}
+	WriteJSON(w, http.StatusOK, tenant)
+}
+
+// Delete removes a tenant without users, devices, DIDs or routes
+// DELETE /api/tenants/{id}
+func (h *TenantHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	if err := h.deps.DB.Tenants.Delete(r.Context(), tenant.ID); err != nil {
+		if errors.Is(err, db.ErrTenantInUse) {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "Tenant still has users, devices, DIDs or routes", nil)
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Tenant deleted successfully"})
+}
+
+// GetConfig returns the settings a tenant overrides, by key
+// GET /api/tenants/{id}/config
+func (h *TenantHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	h.writeConfig(w, r, tenant.ID)
+}
+
+// UpdateConfig overrides settings for a tenant. An empty value makes the
+// tenant use the instance's setting again.
+// PUT /api/tenants/{id}/config
+func (h *TenantHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	if user := GetUserFromContext(r.Context()); user == nil || user.Role != "admin" {
+		WriteForbiddenError(w)
+		return
+	}
+
+	var req map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	keys := make([]string, 0, len(req))
+	for key := range req {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var fieldErrors []FieldError
+	for _, key := range keys {
+		setting, known := tenantSettings[key]
+		switch {
+		case !known:
+			fieldErrors = append(fieldErrors, FieldError{Field: key, Message: "Tenants can only set timezone and default_language"})
+		case req[key] != "" && !setting.valid(req[key]):
+			fieldErrors = append(fieldErrors, setting.err)
+		}
+	}
+	if len(fieldErrors) > 0 {
+		WriteValidationError(w, "Validation failed", fieldErrors)
+		return
+	}
+
+	for _, key := range keys {
+		value := req[key]
+		var err error
+		if value == "" {
+			err = h.deps.DB.Tenants.DeleteConfig(r.Context(), tenant.ID, key)
+		} else {
+			err = h.deps.DB.Tenants.SetConfig(r.Context(), tenant.ID, key, value)
+		}
+		if err != nil {
+			WriteInternalError(w)
+			return
+		}
+	}
+	h.writeConfig(w, r, tenant.ID)
+}
+
+// load fetches the tenant in the URL, writing a 404 when it doesn't exist
+// or belongs to another tenant than the signed-in tenant user's
+func (h *TenantHandler) load(w http.ResponseWriter, r *http.Request) (*models.Tenant, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid tenant ID", nil)
+		return nil, false
+	}
+	tenant, err := h.deps.DB.Tenants.GetByID(r.Context(), id)
+	if err == nil && !visibleTo(r, &tenant.ID) {
+		err = db.ErrTenantNotFound
+	}
+	if err != nil {
+		if errors.Is(err, db.ErrTenantNotFound) {
+			WriteNotFoundError(w, "Tenant")
+			return nil, false
+		}
+		WriteInternalError(w)
+		return nil, false
+	}
+	return tenant, true
+}
+
+// validate checks a tenant's name and SIP domain, which must not be the
+// instance's own or another tenant's
+func (h *TenantHandler) validate(w http.ResponseWriter, r *http.Request, tenant *models.Tenant) bool {
+	var fieldErrors []FieldError
+	if tenant.Name == "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "name", Message: "Name is required"})
+	}
+	if strings.ContainsAny(tenant.SIPDomain, " :;@<>/") {
+		fieldErrors = append(fieldErrors, FieldError{Field: "sip_domain", Message: "Must be a domain name"})
+	}
+	if len(fieldErrors) > 0 {
+		WriteValidationError(w, "Validation failed", fieldErrors)
+		return false
+	}
+	if tenant.SIPDomain == "" {
+		return true
+	}
+
+	if h.deps.Config != nil && strings.EqualFold(tenant.SIPDomain, h.deps.Config.SIPDomain) {
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "SIP domain is the instance's own", nil)
+		return false
+	}
+	existing, err := h.deps.DB.Tenants.GetBySIPDomain(r.Context(), tenant.SIPDomain)
+	switch {
+	case err == nil && existing.ID != tenant.ID:
+		WriteError(w, http.StatusConflict, ErrCodeConflict, "SIP domain belongs to another tenant", nil)
+		return false
+	case err != nil && !errors.Is(err, db.ErrTenantNotFound):
+		WriteInternalError(w)
+		return false
+	}
+	return true
+}
+
+// writeConfig responds with a tenant's settings
+func (h *TenantHandler) writeConfig(w http.ResponseWriter, r *http.Request, tenantID int64) {
+	configs, err := h.deps.DB.Tenants.GetConfig(r.Context(), tenantID)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	settings := make(map[string]string, len(configs))
+	for _, cfg := range configs {
+		settings[cfg.Key] = cfg.Value
+	}
+	WriteJSON(w, http.StatusOK, settings)
+}
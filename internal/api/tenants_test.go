@@ -0,0 +1,290 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// asUser calls a handler as the given user, with optional chi URL params
+func asUser(user *models.User, fn http.HandlerFunc, method, target string, params map[string]string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, target, bytes.NewBuffer(data))
+	if params != nil {
+		req = withURLParams(req, params)
+	}
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, user))
+	rr := httptest.NewRecorder()
+	fn(rr, req)
+	return rr
+}
+
+func TestTenantHandler(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewTenantHandler(&Dependencies{DB: setup.DB, Config: &config.Config{SIPDomain: "pbx.example.com"}})
+	admin := createTestUser(t, setup.DB, "admin@example.com", "password123", "admin")
+
+	rr := asUser(admin, handler.Create, http.MethodPost, "/api/tenants", nil, TenantRequest{Name: " Acme ", SIPDomain: "SIP.Acme.example"})
+	assertStatus(t, rr, http.StatusCreated)
+	var acme models.Tenant
+	decodeResponse(t, rr, &acme)
+	if acme.Name != "Acme" || acme.SIPDomain != "sip.acme.example" {
+		t.Errorf("Unexpected tenant: %+v", acme)
+	}
+	id := strconv.FormatInt(acme.ID, 10)
+
+	for name, tc := range map[string]struct {
+		req    TenantRequest
+		status int
+	}{
+		"no name":         {TenantRequest{SIPDomain: "sip.globex.example"}, http.StatusBadRequest},
+		"not a domain":    {TenantRequest{Name: "Globex", SIPDomain: "sip:globex"}, http.StatusBadRequest},
+		"instance domain": {TenantRequest{Name: "Globex", SIPDomain: "PBX.example.com"}, http.StatusConflict},
+		"taken domain":    {TenantRequest{Name: "Globex", SIPDomain: "sip.acme.example"}, http.StatusConflict},
+	} {
+		if rr := asUser(admin, handler.Create, http.MethodPost, "/api/tenants", nil, tc.req); rr.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d", name, tc.status, rr.Code)
+		}
+	}
+
+	// Keeping its own domain isn't a conflict
+	rr = asUser(admin, handler.Update, http.MethodPut, "/api/tenants/"+id, map[string]string{"id": id}, TenantRequest{Name: "Acme Inc", SIPDomain: "sip.acme.example"})
+	assertStatus(t, rr, http.StatusOK)
+
+	rr = asUser(admin, handler.UpdateConfig, http.MethodPut, "/api/tenants/"+id+"/config", map[string]string{"id": id}, map[string]string{"timezone": "Mars/Olympus", "sip_domain": "x"})
+	assertStatus(t, rr, http.StatusBadRequest)
+	if !strings.Contains(rr.Body.String(), "sip_domain") || !strings.Contains(rr.Body.String(), "timezone") {
+		t.Errorf("Expected both fields rejected, got %s", rr.Body.String())
+	}
+	rr = asUser(admin, handler.UpdateConfig, http.MethodPut, "/api/tenants/"+id+"/config", map[string]string{"id": id}, map[string]string{"timezone": "Europe/Berlin", "default_language": "de"})
+	assertStatus(t, rr, http.StatusOK)
+	var settings map[string]string
+	decodeResponse(t, rr, &settings)
+	if settings["timezone"] != "Europe/Berlin" || settings["default_language"] != "de" {
+		t.Errorf("Unexpected settings: %v", settings)
+	}
+	asUser(admin, handler.UpdateConfig, http.MethodPut, "/api/tenants/"+id+"/config", map[string]string{"id": id}, map[string]string{"default_language": ""})
+	if lang := setup.DB.Config.GetForTenant(context.Background(), &acme.ID, "default_language", "en"); lang != "en" {
+		t.Errorf("Expected the instance's language again, got %s", lang)
+	}
+
+	// Tenant users see only their own tenant, and don't change its settings
+	member := createTestUser(t, setup.DB, "member@acme.example", "password123", "admin")
+	setup.DB.Users.SetTenant(context.Background(), member.ID, &acme.ID)
+	member.TenantID = &acme.ID
+	assertStatus(t, asUser(member, handler.Get, http.MethodGet, "/api/tenants/"+id, map[string]string{"id": id}, nil), http.StatusOK)
+	member.Role = "user"
+	assertStatus(t, asUser(member, handler.UpdateConfig, http.MethodPut, "/api/tenants/"+id+"/config", map[string]string{"id": id}, map[string]string{"timezone": "UTC"}), http.StatusForbidden)
+	other := &models.Tenant{Name: "Globex"}
+	setup.DB.Tenants.Create(context.Background(), other)
+	otherID := strconv.FormatInt(other.ID, 10)
+	assertStatus(t, asUser(member, handler.Get, http.MethodGet, "/api/tenants/"+otherID, map[string]string{"id": otherID}, nil), http.StatusNotFound)
+
+	assertStatus(t, asUser(admin, handler.Delete, http.MethodDelete, "/api/tenants/"+id, map[string]string{"id": id}, nil), http.StatusConflict)
+	setup.DB.Users.SetTenant(context.Background(), member.ID, nil)
+	assertStatus(t, asUser(admin, handler.Delete, http.MethodDelete, "/api/tenants/"+id, map[string]string{"id": id}, nil), http.StatusOK)
+	assertStatus(t, asUser(admin, handler.Get, http.MethodGet, "/api/tenants/"+id, map[string]string{"id": id}, nil), http.StatusNotFound)
+}
+
+func TestTenantRoutesMiddleware(t *testing.T) {
+	r := chi.NewRouter()
+	var user *models.User
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), contextKeyUser, user)))
+		})
+	})
+	r.Use(TenantRoutesMiddleware(r))
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	r.Route("/api", func(r chi.Router) {
+		r.Get("/devices/{id}", ok)
+		r.Delete("/dids/{id}", ok)
+		r.Get("/system/config", ok)
+	})
+
+	tenantID := int64(1)
+	for _, tc := range []struct {
+		user   *models.User
+		method string
+		path   string
+		status int
+	}{
+		{&models.User{Role: "admin"}, http.MethodGet, "/api/system/config", http.StatusOK},
+		{&models.User{Role: "admin", TenantID: &tenantID}, http.MethodGet, "/api/devices/7", http.StatusOK},
+		{&models.User{Role: "admin", TenantID: &tenantID}, http.MethodDelete, "/api/dids/7", http.StatusForbidden},
+		{&models.User{Role: "admin", TenantID: &tenantID}, http.MethodGet, "/api/system/config", http.StatusForbidden},
+		{&models.User{Role: "admin", TenantID: &tenantID}, http.MethodGet, "/api/unknown", http.StatusForbidden},
+	} {
+		user = tc.user
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, nil))
+		if rr.Code != tc.status {
+			t.Errorf("%s %s (tenant %v): expected %d, got %d", tc.method, tc.path, tc.user.TenantID, tc.status, rr.Code)
+		}
+	}
+}
+
+func TestTenantScoping(t *testing.T) {
+	setup := setupTestAPI(t)
+	ctx := context.Background()
+	deps := &Dependencies{DB: setup.DB}
+
+	admin := createTestUser(t, setup.DB, "admin@example.com", "password123", "admin")
+	acme := &models.Tenant{Name: "Acme"}
+	globex := &models.Tenant{Name: "Globex"}
+	setup.DB.Tenants.Create(ctx, acme)
+	setup.DB.Tenants.Create(ctx, globex)
+	member := createTestUser(t, setup.DB, "admin@acme.example", "password123", "admin")
+	setup.DB.Users.SetTenant(ctx, member.ID, &acme.ID)
+	member.TenantID = &acme.ID
+	outsider := createTestUser(t, setup.DB, "admin@globex.example", "password123", "admin")
+	setup.DB.Users.SetTenant(ctx, outsider.ID, &globex.ID)
+
+	ownDID := createTestDID(t, setup.DB, "+15551230001")
+	otherDID := createTestDID(t, setup.DB, "+15551230002")
+	setup.DB.DIDs.SetTenant(ctx, ownDID.ID, &acme.ID)
+	setup.DB.DIDs.SetTenant(ctx, otherDID.ID, &globex.ID)
+	ownMsg := createTestMessage(t, setup.DB, ownDID.ID, "inbound", "+15559870001", "hello")
+	otherMsg := createTestMessage(t, setup.DB, otherDID.ID, "inbound", "+15559870002", "hi")
+	createTestMessage(t, setup.DB, ownDID.ID, "outbound", "+15559870001", "reply")
+
+	// Devices
+	devices := NewDeviceHandler(deps)
+	rr := asUser(member, devices.Create, http.MethodPost, "/api/devices", nil, CreateDeviceRequest{Name: "Desk", Username: "acme-desk", Password: "secretpassword", Extension: "201"})
+	assertStatus(t, rr, http.StatusCreated)
+	var device DeviceResponse
+	decodeResponse(t, rr, &device)
+	if device.TenantID == nil || *device.TenantID != acme.ID {
+		t.Errorf("Expected the device under Acme, got %v", device.TenantID)
+	}
+	// Extensions are per tenant
+	rr = asUser(admin, devices.Create, http.MethodPost, "/api/devices", nil, CreateDeviceRequest{Name: "Desk", Username: "desk", Password: "secretpassword", Extension: "201"})
+	assertStatus(t, rr, http.StatusCreated)
+	rr = asUser(member, devices.Create, http.MethodPost, "/api/devices", nil, CreateDeviceRequest{Name: "Copy", Username: "acme-copy", Password: "secretpassword", Extension: "201"})
+	assertStatus(t, rr, http.StatusConflict)
+	if !strings.Contains(rr.Body.String(), "extension") {
+		t.Errorf("Expected an extension conflict, got %s", rr.Body.String())
+	}
+	// Only instance admins place records under a tenant
+	globexID := globex.ID
+	rr = asUser(member, devices.Create, http.MethodPost, "/api/devices", nil, CreateDeviceRequest{Name: "Sneaky", Username: "sneaky", Password: "secretpassword", TenantID: &globexID})
+	assertStatus(t, rr, http.StatusForbidden)
+
+	rr = asUser(member, devices.List, http.MethodGet, "/api/devices", nil, nil)
+	var deviceList struct {
+		Data       []DeviceResponse `json:"data"`
+		Pagination Pagination       `json:"pagination"`
+	}
+	decodeResponse(t, rr, &deviceList)
+	if deviceList.Pagination.Total != 1 || len(deviceList.Data) != 1 || deviceList.Data[0].ID != device.ID {
+		t.Errorf("Expected only Acme's device, got %+v", deviceList)
+	}
+	rr = asUser(admin, devices.List, http.MethodGet, "/api/devices", nil, nil)
+	decodeResponse(t, rr, &deviceList)
+	if deviceList.Pagination.Total != 2 {
+		t.Errorf("Expected the instance to see all devices, got %d", deviceList.Pagination.Total)
+	}
+	deviceID := strconv.FormatInt(device.ID, 10)
+	assertStatus(t, asUser(member, devices.Get, http.MethodGet, "/api/devices/"+deviceID, map[string]string{"id": deviceID}, nil), http.StatusOK)
+	outsider.TenantID = &globex.ID
+	assertStatus(t, asUser(outsider, devices.Get, http.MethodGet, "/api/devices/"+deviceID, map[string]string{"id": deviceID}, nil), http.StatusNotFound)
+	assertStatus(t, asUser(outsider, devices.Delete, http.MethodDelete, "/api/devices/"+deviceID, map[string]string{"id": deviceID}, nil), http.StatusNotFound)
+
+	// DIDs
+	dids := NewDIDHandler(deps)
+	rr = asUser(member, dids.List, http.MethodGet, "/api/dids", nil, nil)
+	var didList struct {
+		Data []DIDResponse `json:"data"`
+	}
+	decodeResponse(t, rr, &didList)
+	if len(didList.Data) != 1 || didList.Data[0].ID != ownDID.ID {
+		t.Errorf("Expected only Acme's DID, got %+v", didList.Data)
+	}
+	otherDIDID := strconv.FormatInt(otherDID.ID, 10)
+	assertStatus(t, asUser(member, dids.Get, http.MethodGet, "/api/dids/"+otherDIDID, map[string]string{"id": otherDIDID}, nil), http.StatusNotFound)
+
+	// Routes
+	routes := NewRouteHandler(deps)
+	ring, _ := json.Marshal(map[string]interface{}{"devices": []int64{device.ID}})
+	rr = asUser(member, routes.Create, http.MethodPost, "/api/routes", nil, CreateRouteRequest{DIDID: &ownDID.ID, Name: "Ring", ConditionType: "default", ActionType: "ring", ActionData: ring})
+	assertStatus(t, rr, http.StatusCreated)
+	var route RouteResponse
+	decodeResponse(t, rr, &route)
+	if route.TenantID == nil || *route.TenantID != acme.ID {
+		t.Errorf("Expected the route under Acme, got %v", route.TenantID)
+	}
+	instanceRing, _ := json.Marshal(map[string]interface{}{"devices": []int64{deviceList.Data[1].ID}})
+	for name, req := range map[string]CreateRouteRequest{
+		"no DID":          {Name: "All", ConditionType: "default", ActionType: "voicemail"},
+		"other DID":       {DIDID: &otherDID.ID, Name: "All", ConditionType: "default", ActionType: "voicemail"},
+		"on-call":         {DIDID: &ownDID.ID, Name: "All", ConditionType: "default", ActionType: "oncall", ActionData: json.RawMessage(`{"schedule_id":1}`)},
+		"instance device": {DIDID: &ownDID.ID, Name: "All", ConditionType: "default", ActionType: "ring", ActionData: instanceRing},
+	} {
+		if rr := asUser(member, routes.Create, http.MethodPost, "/api/routes", nil, req); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, rr.Code)
+		}
+	}
+	routeID := strconv.FormatInt(route.ID, 10)
+	assertStatus(t, asUser(outsider, routes.Get, http.MethodGet, "/api/routes/"+routeID, map[string]string{"id": routeID}, nil), http.StatusNotFound)
+
+	// Messages
+	messages := NewMessageHandler(deps)
+	rr = asUser(member, messages.List, http.MethodGet, "/api/messages?direction=inbound", nil, nil)
+	var msgList struct {
+		Data       []MessageResponse `json:"data"`
+		Pagination Pagination        `json:"pagination"`
+	}
+	decodeResponse(t, rr, &msgList)
+	if msgList.Pagination.Total != 1 || len(msgList.Data) != 1 || msgList.Data[0].ID != ownMsg.ID {
+		t.Errorf("Expected only Acme's inbound message, got %+v", msgList)
+	}
+	assertStatus(t, asUser(member, messages.List, http.MethodGet, "/api/messages?did_id=x", nil, nil), http.StatusBadRequest)
+	otherMsgID := strconv.FormatInt(otherMsg.ID, 10)
+	for _, fn := range []http.HandlerFunc{messages.Get, messages.MarkAsRead, messages.Delete} {
+		assertStatus(t, asUser(member, fn, http.MethodGet, "/api/messages/"+otherMsgID, map[string]string{"id": otherMsgID}, nil), http.StatusNotFound)
+	}
+	if _, err := setup.DB.Messages.GetByID(ctx, otherMsg.ID); err != nil {
+		t.Errorf("Expected Globex's message kept, got %v", err)
+	}
+	rr = asUser(member, messages.Send, http.MethodPost, "/api/messages", nil, SendMessageRequest{DIDID: otherDID.ID, ToNumber: "+15559870003", Body: "hi"})
+	assertStatus(t, rr, http.StatusNotFound)
+
+	// Users
+	auth := NewAuthHandler(deps)
+	rr = asUser(member, auth.CreateUser, http.MethodPost, "/api/users", nil, CreateUserRequest{Email: "agent@acme.example", Password: "Acme-agent-2026!", Role: "user"})
+	assertStatus(t, rr, http.StatusCreated)
+	var created UserResponse
+	decodeResponse(t, rr, &created)
+	if created.TenantID == nil || *created.TenantID != acme.ID {
+		t.Errorf("Expected the user under Acme, got %v", created.TenantID)
+	}
+	rr = asUser(member, auth.ListUsers, http.MethodGet, "/api/users", nil, nil)
+	var userList struct {
+		Pagination Pagination `json:"pagination"`
+	}
+	decodeResponse(t, rr, &userList)
+	if userList.Pagination.Total != 2 {
+		t.Errorf("Expected Acme's two users, got %d", userList.Pagination.Total)
+	}
+	adminID := strconv.FormatInt(admin.ID, 10)
+	assertStatus(t, asUser(member, auth.GetUser, http.MethodGet, "/api/users/"+adminID, map[string]string{"id": adminID}, nil), http.StatusNotFound)
+	assertStatus(t, asUser(member, auth.DeleteUser, http.MethodDelete, "/api/users/"+adminID, map[string]string{"id": adminID}, nil), http.StatusNotFound)
+
+	// Instance admins move users between tenants
+	createdID := strconv.FormatInt(created.ID, 10)
+	noTenant := int64(0)
+	rr = asUser(admin, auth.UpdateUser, http.MethodPut, "/api/users/"+createdID, map[string]string{"id": createdID}, UpdateUserRequest{TenantID: &noTenant})
+	assertStatus(t, rr, http.StatusOK)
+	if moved, _ := setup.DB.Users.GetByID(ctx, created.ID); moved.TenantID != nil {
+		t.Errorf("Expected the user moved to the instance, got %v", *moved.TenantID)
+	}
+}
@@ -11,7 +11,9 @@ import (
 	"time"
 
 	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/discovery"
 	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/notifications"
 	"github.com/btafoya/gosip/internal/twilio"
 	"github.com/go-chi/chi/v5"
 	_ "github.com/mattn/go-sqlite3"
@@ -30,7 +32,12 @@ type MockTwilioClient struct {
 	UpdateCredentialsFunc         func(accountSID, authToken string)
 	IsHealthyFunc                 func() bool
 	RequestTranscriptionFunc      func(recordingSID string, voicemailID int64) error
+	GetCallPriceFunc              func(ctx context.Context, callSID string) (string, string, error)
 	ListIncomingPhoneNumbersFunc  func(ctx context.Context) ([]twilio.IncomingPhoneNumber, error)
+	GetAccountBalanceFunc         func(ctx context.Context) (float64, error)
+
+	// TrunkEdges holds the edge set on each trunk's origination URI
+	TrunkEdges map[string]string
 }
 
 func (m *MockTwilioClient) SendSMS(from, to, body string, mediaURLs []string) (string, error) {
@@ -109,6 +116,13 @@ func (m *MockTwilioClient) RequestTranscription(recordingSID string, voicemailID
 	return nil
 }
 
+func (m *MockTwilioClient) GetCallPrice(ctx context.Context, callSID string) (string, string, error) {
+	if m.GetCallPriceFunc != nil {
+		return m.GetCallPriceFunc(ctx, callSID)
+	}
+	return "", "", nil
+}
+
 func (m *MockTwilioClient) ListIncomingPhoneNumbers(ctx context.Context) ([]twilio.IncomingPhoneNumber, error) {
 	if m.ListIncomingPhoneNumbersFunc != nil {
 		return m.ListIncomingPhoneNumbersFunc(ctx)
@@ -116,6 +130,13 @@ func (m *MockTwilioClient) ListIncomingPhoneNumbers(ctx context.Context) ([]twil
 	return []twilio.IncomingPhoneNumber{}, nil
 }
 
+func (m *MockTwilioClient) GetAccountBalance(ctx context.Context) (float64, error) {
+	if m.GetAccountBalanceFunc != nil {
+		return m.GetAccountBalanceFunc(ctx)
+	}
+	return 0, nil
+}
+
 // SIP Trunk Operations (stubs for interface compliance)
 
 func (m *MockTwilioClient) ListSIPTrunks(ctx context.Context) ([]*twilio.SIPTrunk, error) {
@@ -154,12 +175,27 @@ func (m *MockTwilioClient) SetSecureOriginationURI(ctx context.Context, trunkSID
 	return nil
 }
 
+func (m *MockTwilioClient) GetTrunkEdge(ctx context.Context, trunkSID string) (*twilio.TrunkEdge, error) {
+	edge := m.TrunkEdges[trunkSID]
+	return &twilio.TrunkEdge{TrunkSID: trunkSID, Edge: edge, URIs: []string{twilio.WithOriginationEdge("sip:pbx.example.com", edge)}}, nil
+}
+
+func (m *MockTwilioClient) SetTrunkEdge(ctx context.Context, trunkSID, edge string) error {
+	if m.TrunkEdges == nil {
+		m.TrunkEdges = map[string]string{}
+	}
+	m.TrunkEdges[trunkSID] = edge
+	return nil
+}
+
 // MockNotifier is a mock implementation of Notifier for testing
 type MockNotifier struct {
 	SendVoicemailNotificationFunc func(voicemail *models.Voicemail) error
 	SendSMSNotificationFunc       func(message *models.Message) error
+	SendQuotaWarningFunc          func(did *models.DID, quota *models.VoicemailQuota, usage models.VoicemailUsage, percent int) error
 	SendEmailFunc                 func(to, subject, body string) error
 	SendPushFunc                  func(title, message string) error
+	TestSMTPFunc                  func(to string) *notifications.SMTPTestResult
 }
 
 func (m *MockNotifier) SendVoicemailNotification(voicemail *models.Voicemail) error {
@@ -176,6 +212,13 @@ func (m *MockNotifier) SendSMSNotification(message *models.Message) error {
 	return nil
 }
 
+func (m *MockNotifier) SendVoicemailQuotaWarning(did *models.DID, quota *models.VoicemailQuota, usage models.VoicemailUsage, percent int) error {
+	if m.SendQuotaWarningFunc != nil {
+		return m.SendQuotaWarningFunc(did, quota, usage, percent)
+	}
+	return nil
+}
+
 func (m *MockNotifier) SendEmail(to, subject, body string) error {
 	if m.SendEmailFunc != nil {
 		return m.SendEmailFunc(to, subject, body)
@@ -190,6 +233,13 @@ func (m *MockNotifier) SendPush(title, message string) error {
 	return nil
 }
 
+func (m *MockNotifier) TestSMTP(to string) *notifications.SMTPTestResult {
+	if m.TestSMTPFunc != nil {
+		return m.TestSMTPFunc(to)
+	}
+	return &notifications.SMTPTestResult{OK: true, Recipient: to, Steps: []notifications.SMTPStep{}}
+}
+
 // MockRegistrar is a mock SIP registrar for testing
 type MockRegistrar struct {
 	registrations map[int64]bool
@@ -258,6 +308,18 @@ func (m *MockSIPServer) SetActiveCallCount(count int) {
 	m.activeCalls = count
 }
 
+// MockDeviceScanner is a mock implementation of DeviceScanner for testing
+type MockDeviceScanner struct {
+	Devices []discovery.Device
+	Err     error
+	Scans   int
+}
+
+func (m *MockDeviceScanner) Scan(ctx context.Context, timeout time.Duration) ([]discovery.Device, error) {
+	m.Scans++
+	return m.Devices, m.Err
+}
+
 // testSetup contains all the test dependencies
 type testSetup struct {
 	DB       *db.DB
@@ -289,6 +351,10 @@ func setupTestAPI(t *testing.T) *testSetup {
 	if err := database.Migrate(); err != nil {
 		t.Fatalf("Failed to run migrations: %v", err)
 	}
+	// Keep backups tests create out of the source tree
+	if err := database.SetBackupsDir(t.TempDir()); err != nil {
+		t.Fatalf("Failed to set backups directory: %v", err)
+	}
 
 	t.Cleanup(func() {
 		database.Close()
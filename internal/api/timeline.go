@@ -0,0 +1,203 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// Timeline entry types
+const (
+	TimelineCall      = "call"
+	TimelineMessage   = "message"
+	TimelineVoicemail = "voicemail"
+	TimelineNote      = "note"
+)
+
+// TimelineHandler handles the caller journey timeline: everything that
+// happened with an external number, and notes kept about it
+type TimelineHandler struct {
+	deps *Dependencies
+}
+
+// NewTimelineHandler creates a new TimelineHandler
+func NewTimelineHandler(deps *Dependencies) *TimelineHandler {
+	return &TimelineHandler{deps: deps}
+}
+
+// TimelineEntry is one event with a number. Only the field matching Type
+// is set.
+type TimelineEntry struct {
+	Type      string             `json:"type"`
+	At        time.Time          `json:"at"`
+	Call      *models.CDR        `json:"call,omitempty"`
+	Message   *models.Message    `json:"message,omitempty"`
+	Voicemail *VoicemailResponse `json:"voicemail,omitempty"`
+	Note      *models.NumberNote `json:"note,omitempty"`
+}
+
+// NoteRequest represents a request to add a note about a number
+type NoteRequest struct {
+	Body string `json:"body"`
+}
+
+// Get returns the calls, messages, voicemails and notes for a number,
+// newest first, with pagination
+func (h *TimelineHandler) Get(w http.ResponseWriter, r *http.Request) {
+	number := chi.URLParam(r, "number")
+	if number == "" {
+		WriteValidationError(w, "Number is required", nil)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if limit <= 0 {
+		limit = config.DefaultPageSize
+	}
+	if limit > config.MaxPageSize {
+		limit = config.MaxPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	entries, total, err := h.timeline(r, number, limit, offset)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteList(w, entries, total, limit, offset)
+}
+
+// timeline merges the newest limit+offset entries of each source, which
+// is enough to fill the requested page of the combined timeline
+func (h *TimelineHandler) timeline(r *http.Request, number string, limit, offset int) ([]*TimelineEntry, int, error) {
+	ctx := r.Context()
+	window := limit + offset
+	var entries []*TimelineEntry
+
+	filter := db.CDRFilter{Number: number, Limit: window}
+	cdrs, err := h.deps.DB.CDRs.List(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, cdr := range cdrs {
+		entries = append(entries, &TimelineEntry{Type: TimelineCall, At: cdr.StartedAt, Call: cdr})
+	}
+
+	msgs, err := h.deps.DB.Messages.ListByRemoteNumber(ctx, number, window, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, msg := range msgs {
+		entries = append(entries, &TimelineEntry{Type: TimelineMessage, At: msg.CreatedAt, Message: msg})
+	}
+
+	vms, err := h.deps.DB.Voicemails.ListByFromNumber(ctx, number, window, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, vm := range vms {
+		entries = append(entries, &TimelineEntry{Type: TimelineVoicemail, At: vm.CreatedAt, Voicemail: toVoicemailResponse(vm)})
+	}
+
+	notes, err := h.deps.DB.NumberNotes.ListByNumber(ctx, number, window, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, note := range notes {
+		entries = append(entries, &TimelineEntry{Type: TimelineNote, At: note.CreatedAt, Note: note})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].At.After(entries[j].At)
+	})
+	if offset >= len(entries) {
+		entries = []*TimelineEntry{}
+	} else {
+		entries = entries[offset:]
+		if len(entries) > limit {
+			entries = entries[:limit]
+		}
+	}
+
+	callCount, err := h.deps.DB.CDRs.Count(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	msgCount, err := h.deps.DB.Messages.CountByRemoteNumber(ctx, number)
+	if err != nil {
+		return nil, 0, err
+	}
+	vmCount, err := h.deps.DB.Voicemails.CountByFromNumber(ctx, number)
+	if err != nil {
+		return nil, 0, err
+	}
+	noteCount, err := h.deps.DB.NumberNotes.CountByNumber(ctx, number)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return entries, callCount + msgCount + vmCount + noteCount, nil
+}
+
+// CreateNote adds a note about a number, authored by the current user
+func (h *TimelineHandler) CreateNote(w http.ResponseWriter, r *http.Request) {
+	number := chi.URLParam(r, "number")
+	if number == "" {
+		WriteValidationError(w, "Number is required", nil)
+		return
+	}
+
+	var req NoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		WriteValidationError(w, "Validation failed", []FieldError{{Field: "body", Message: "Note text is required"}})
+		return
+	}
+
+	note := &models.NumberNote{Number: number, Body: body}
+	if userID := getUserIDFromContext(r.Context()); userID != 0 {
+		note.UserID = &userID
+	}
+	if err := h.deps.DB.NumberNotes.Create(r.Context(), note); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, note)
+}
+
+// DeleteNote removes a note about a number
+func (h *TimelineHandler) DeleteNote(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid note ID", nil)
+		return
+	}
+
+	if err := h.deps.DB.NumberNotes.Delete(r.Context(), chi.URLParam(r, "number"), id); err != nil {
+		if err == db.ErrNumberNoteNotFound {
+			WriteNotFoundError(w, "Note")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Note deleted successfully"})
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestTimelineHandler_Get(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewTimelineHandler(&Dependencies{DB: setup.DB})
+	ctx := context.Background()
+
+	// Voicemail boxes are keyed by DID, stored in the voicemail's user_id,
+	// so the first user and DID share an ID
+	const caller = "+15559876543"
+	createTestUser(t, setup.DB, "alice@example.com", "password", "user")
+	did := createTestDID(t, setup.DB, "+15551234567")
+	call := &models.CDR{CallSID: "CA-timeline", Direction: "inbound", FromNumber: caller, ToNumber: did.Number, DIDID: &did.ID, StartedAt: time.Now().Add(-2 * time.Hour), Disposition: "answered"}
+	if err := setup.DB.CDRs.Create(ctx, call); err != nil {
+		t.Fatalf("Failed to create CDR: %v", err)
+	}
+	note := &models.NumberNote{Number: caller, Body: "Prefers email", CreatedAt: time.Now().Add(-time.Hour)}
+	if err := setup.DB.NumberNotes.Create(ctx, note); err != nil {
+		t.Fatalf("Failed to create note: %v", err)
+	}
+	createTestMessage(t, setup.DB, did.ID, "inbound", caller, "Call me back")
+	createTestVoicemail(t, setup.DB, did.ID, caller)
+
+	// Someone else's history stays out of the timeline
+	createTestCDR(t, setup.DB, did.ID, "inbound", "+15550001111", did.Number)
+	createTestMessage(t, setup.DB, did.ID, "inbound", "+15550001111", "Hello")
+
+	get := func(query string) ([]*TimelineEntry, *Pagination) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/numbers/x/timeline"+query, nil)
+		rr := httptest.NewRecorder()
+		handler.Get(rr, withURLParams(req, map[string]string{"number": caller}))
+		assertStatus(t, rr, http.StatusOK)
+		var resp struct {
+			Data       []*TimelineEntry `json:"data"`
+			Pagination *Pagination      `json:"pagination"`
+		}
+		decodeResponse(t, rr, &resp)
+		return resp.Data, resp.Pagination
+	}
+
+	entries, page := get("")
+	if page.Total != 4 || len(entries) != 4 {
+		t.Fatalf("Expected 4 entries, got %d of %d", len(entries), page.Total)
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].At.After(entries[i-1].At) {
+			t.Errorf("Entries not newest first: %v after %v", entries[i].At, entries[i-1].At)
+		}
+	}
+
+	// The oldest two are the note, then the call
+	entries, page = get("?limit=2&offset=2")
+	if len(entries) != 2 || page.Total != 4 {
+		t.Fatalf("Expected the second page of 2, got %d of %d", len(entries), page.Total)
+	}
+	if entries[0].Type != TimelineNote || entries[0].Note.Body != "Prefers email" {
+		t.Errorf("Expected the note, got %+v", entries[0])
+	}
+	if entries[1].Type != TimelineCall || entries[1].Call.CallSID != "CA-timeline" {
+		t.Errorf("Expected the call, got %+v", entries[1])
+	}
+
+	if entries, _ := get("?offset=10"); len(entries) != 0 {
+		t.Errorf("Expected an empty page past the end, got %d entries", len(entries))
+	}
+}
+
+func TestTimelineHandler_Notes(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewTimelineHandler(&Dependencies{DB: setup.DB})
+	user := createTestUser(t, setup.DB, "alice@example.com", "password", "user")
+	params := map[string]string{"number": "+15559876543"}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/numbers/x/notes", strings.NewReader(`{"body": "  "}`))
+	rr := httptest.NewRecorder()
+	handler.CreateNote(rr, withURLParams(req, params))
+	assertStatus(t, rr, http.StatusBadRequest)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/numbers/x/notes", strings.NewReader(`{"body": "VIP customer"}`))
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, user))
+	rr = httptest.NewRecorder()
+	handler.CreateNote(rr, withURLParams(req, params))
+	assertStatus(t, rr, http.StatusCreated)
+
+	var note models.NumberNote
+	decodeResponse(t, rr, &note)
+	if note.Body != "VIP customer" || note.UserID == nil || *note.UserID != user.ID {
+		t.Errorf("Unexpected note %+v", note)
+	}
+
+	// A note is deleted only through the number it is about
+	req = httptest.NewRequest(http.MethodDelete, "/api/numbers/x/notes/1", nil)
+	rr = httptest.NewRecorder()
+	handler.DeleteNote(rr, withURLParams(req, map[string]string{"number": "+15550001111", "id": fmt.Sprint(note.ID)}))
+	assertStatus(t, rr, http.StatusNotFound)
+
+	rr = httptest.NewRecorder()
+	handler.DeleteNote(rr, withURLParams(req, map[string]string{"number": params["number"], "id": fmt.Sprint(note.ID)}))
+	assertStatus(t, rr, http.StatusOK)
+}
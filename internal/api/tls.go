@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/btafoya/gosip/internal/announcements"
 	"github.com/btafoya/gosip/internal/db"
 	"github.com/btafoya/gosip/pkg/sip"
 )
@@ -110,6 +111,10 @@ func (h *TLSHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 		WriteValidationError(w, "Invalid request body", nil)
 		return
 	}
+	if errs := req.validate(); len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
 
 	ctx := r.Context()
 
@@ -124,12 +129,6 @@ func (h *TLSHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 
 	// Update certificate mode
 	if req.CertMode != "" {
-		if req.CertMode != "manual" && req.CertMode != "acme" {
-			WriteValidationError(w, "Invalid cert_mode. Must be 'manual' or 'acme'", []FieldError{
-				{Field: "cert_mode", Message: "Must be 'manual' or 'acme'"},
-			})
-			return
-		}
 		h.deps.DB.Config.Set(ctx, db.ConfigKeyTLSCertMode, req.CertMode)
 	}
 
@@ -163,12 +162,6 @@ func (h *TLSHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 		h.deps.DB.Config.Set(ctx, db.ConfigKeyACMEDomains, strings.Join(req.ACMEDomains, ","))
 	}
 	if req.ACMECA != "" {
-		if req.ACMECA != "staging" && req.ACMECA != "production" {
-			WriteValidationError(w, "Invalid acme_ca. Must be 'staging' or 'production'", []FieldError{
-				{Field: "acme_ca", Message: "Must be 'staging' or 'production'"},
-			})
-			return
-		}
 		h.deps.DB.Config.Set(ctx, db.ConfigKeyACMECA, req.ACMECA)
 	}
 
@@ -179,23 +172,11 @@ func (h *TLSHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 
 	// Update TLS version
 	if req.MinVersion != "" {
-		if req.MinVersion != "1.2" && req.MinVersion != "1.3" {
-			WriteValidationError(w, "Invalid min_version. Must be '1.2' or '1.3'", []FieldError{
-				{Field: "min_version", Message: "Must be '1.2' or '1.3'"},
-			})
-			return
-		}
 		h.deps.DB.Config.Set(ctx, db.ConfigKeyTLSMinVersion, req.MinVersion)
 	}
 
 	// Update client authentication
 	if req.ClientAuth != "" {
-		if req.ClientAuth != "none" && req.ClientAuth != "request" && req.ClientAuth != "require" {
-			WriteValidationError(w, "Invalid client_auth. Must be 'none', 'request', or 'require'", []FieldError{
-				{Field: "client_auth", Message: "Must be 'none', 'request', or 'require'"},
-			})
-			return
-		}
 		h.deps.DB.Config.Set(ctx, db.ConfigKeyTLSClientAuth, req.ClientAuth)
 	}
 
@@ -204,6 +185,31 @@ func (h *TLSHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// validate checks the values of a TLS configuration update without
+// applying anything
+func (req *TLSConfigRequest) validate() []FieldError {
+	var errs []FieldError
+	if req.CertMode != "" && req.CertMode != "manual" && req.CertMode != "acme" {
+		errs = append(errs, FieldError{Field: "cert_mode", Message: "Must be 'manual' or 'acme'"})
+	}
+	if req.Port != nil && (*req.Port < 0 || *req.Port > 65535) {
+		errs = append(errs, FieldError{Field: "port", Message: "Port must be 1 to 65535"})
+	}
+	if req.WSSPort != nil && (*req.WSSPort < 0 || *req.WSSPort > 65535) {
+		errs = append(errs, FieldError{Field: "wss_port", Message: "Port must be 1 to 65535"})
+	}
+	if req.ACMECA != "" && req.ACMECA != "staging" && req.ACMECA != "production" {
+		errs = append(errs, FieldError{Field: "acme_ca", Message: "Must be 'staging' or 'production'"})
+	}
+	if req.MinVersion != "" && req.MinVersion != "1.2" && req.MinVersion != "1.3" {
+		errs = append(errs, FieldError{Field: "min_version", Message: "Must be '1.2' or '1.3'"})
+	}
+	if req.ClientAuth != "" && req.ClientAuth != "none" && req.ClientAuth != "request" && req.ClientAuth != "require" {
+		errs = append(errs, FieldError{Field: "client_auth", Message: "Must be 'none', 'request', or 'require'"})
+	}
+	return errs
+}
+
 // ForceRenewal triggers immediate certificate renewal (ACME mode only)
 func (h *TLSHandler) ForceRenewal(w http.ResponseWriter, r *http.Request) {
 	if h.deps.SIP == nil {
@@ -220,6 +226,7 @@ func (h *TLSHandler) ForceRenewal(w http.ResponseWriter, r *http.Request) {
 		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Certificate renewal failed: %v", err), nil)
 		return
 	}
+	announcements.CheckCertificate(r.Context(), h.deps.DB, h.deps.Events, h.deps.SIP.GetTLSStatus(), time.Now())
 
 	WriteJSON(w, http.StatusOK, map[string]string{
 		"message": "Certificate renewal initiated successfully",
@@ -242,6 +249,7 @@ func (h *TLSHandler) ReloadCertificates(w http.ResponseWriter, r *http.Request)
 		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, fmt.Sprintf("Certificate reload failed: %v", err), nil)
 		return
 	}
+	announcements.CheckCertificate(r.Context(), h.deps.DB, h.deps.Events, h.deps.SIP.GetTLSStatus(), time.Now())
 
 	WriteJSON(w, http.StatusOK, map[string]string{
 		"message": "Certificates reloaded successfully",
@@ -684,7 +692,7 @@ func (h *TLSHandler) GetTrunkTLSStatus(w http.ResponseWriter, r *http.Request) {
 
 	trunks, err := h.deps.Twilio.ListSIPTrunks(ctx)
 	if err != nil {
-		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to list SIP trunks: "+err.Error(), nil)
+		WriteTwilioError(w, "Failed to list SIP trunks", err)
 		return
 	}
 
@@ -753,13 +761,13 @@ func (h *TLSHandler) EnableTrunkTLS(w http.ResponseWriter, r *http.Request) {
 	if req.MigrateOrigination {
 		// Full migration: enable TLS and update all origination URLs
 		if err := h.deps.Twilio.EnsureTrunkFullySecure(ctx, req.TrunkSID); err != nil {
-			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to enable TLS: "+err.Error(), nil)
+			WriteTwilioError(w, "Failed to enable TLS", err)
 			return
 		}
 	} else {
 		// Just enable secure mode on trunk
 		if err := h.deps.Twilio.EnableTLSForTrunk(ctx, req.TrunkSID); err != nil {
-			WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to enable TLS: "+err.Error(), nil)
+			WriteTwilioError(w, "Failed to enable TLS", err)
 			return
 		}
 	}
@@ -807,7 +815,7 @@ func (h *TLSHandler) MigrateTrunkOrigination(w http.ResponseWriter, r *http.Requ
 	}
 
 	if err := h.deps.Twilio.MigrateToSecureOrigination(ctx, req.TrunkSID); err != nil {
-		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to migrate origination URLs: "+err.Error(), nil)
+		WriteTwilioError(w, "Failed to migrate origination URLs", err)
 		return
 	}
 
@@ -858,7 +866,7 @@ func (h *TLSHandler) CreateSecureTrunk(w http.ResponseWriter, r *http.Request) {
 	// Create trunk with secure mode enabled
 	trunk, err := h.deps.Twilio.CreateSIPTrunk(ctx, req.FriendlyName, true)
 	if err != nil {
-		WriteError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create trunk: "+err.Error(), nil)
+		WriteTwilioError(w, "Failed to create trunk", err)
 		return
 	}
 
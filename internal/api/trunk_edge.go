@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/twilio"
+	"github.com/go-chi/chi/v5"
+)
+
+// TrunkEdgeHandler handles the Twilio edge location of trunks
+type TrunkEdgeHandler struct {
+	deps *Dependencies
+}
+
+// NewTrunkEdgeHandler creates a new TrunkEdgeHandler
+func NewTrunkEdgeHandler(deps *Dependencies) *TrunkEdgeHandler {
+	return &TrunkEdgeHandler{deps: deps}
+}
+
+// TrunkEdgeRequest picks the edge a trunk's calls reach GoSIP from
+type TrunkEdgeRequest struct {
+	Edge string `json:"edge"` // One of the Twilio edges, "" lets Twilio pick
+}
+
+// TrunkEdgeResponse is a trunk's edge location
+type TrunkEdgeResponse struct {
+	TrunkSID        string   `json:"trunk_sid"`
+	Edge            string   `json:"edge"`  // "" when Twilio picks
+	Mixed           bool     `json:"mixed"` // The origination URIs have different edges
+	OriginationURIs []string `json:"origination_uris"`
+	APIEdge         string   `json:"api_edge"` // GOSIP_TWILIO_EDGE, the edge the API is reached through
+	Edges           []string `json:"edges"`    // Every edge that can be picked
+}
+
+// Get returns the edge location a trunk's calls leave Twilio from (admin only)
+// GET /api/system/trunks/{sid}/edge
+func (h *TrunkEdgeHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if h.deps.Twilio == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Twilio is not configured", nil)
+		return
+	}
+
+	te, err := h.deps.Twilio.GetTrunkEdge(r.Context(), chi.URLParam(r, "sid"))
+	if err != nil {
+		WriteTwilioError(w, "Failed to get trunk edge", err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, h.response(te))
+}
+
+// Update sets the edge location on every origination URI of a trunk, so
+// calls reach GoSIP from the Twilio edge nearest to it (admin only)
+// PUT /api/system/trunks/{sid}/edge
+func (h *TrunkEdgeHandler) Update(w http.ResponseWriter, r *http.Request) {
+	if h.deps.Twilio == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Twilio is not configured", nil)
+		return
+	}
+
+	var req TrunkEdgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	req.Edge = strings.ToLower(strings.TrimSpace(req.Edge))
+	if req.Edge != "" && !config.ValidTwilioEdge(req.Edge) {
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "edge", Message: "Edge must be one of " + strings.Join(config.TwilioEdges, ", ")},
+		})
+		return
+	}
+
+	sid := chi.URLParam(r, "sid")
+	if err := h.deps.Twilio.SetTrunkEdge(r.Context(), sid, req.Edge); err != nil {
+		WriteTwilioError(w, "Failed to set trunk edge", err)
+		return
+	}
+	te, err := h.deps.Twilio.GetTrunkEdge(r.Context(), sid)
+	if err != nil {
+		WriteTwilioError(w, "Failed to get trunk edge", err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, h.response(te))
+}
+
+// response adds the API edge and the edges to pick from to a trunk's edge
+func (h *TrunkEdgeHandler) response(te *twilio.TrunkEdge) TrunkEdgeResponse {
+	resp := TrunkEdgeResponse{
+		TrunkSID:        te.TrunkSID,
+		Edge:            te.Edge,
+		Mixed:           te.Mixed,
+		OriginationURIs: te.URIs,
+		Edges:           config.TwilioEdges,
+	}
+	if h.deps.Config != nil {
+		resp.APIEdge = h.deps.Config.TwilioEdge
+	}
+	return resp
+}
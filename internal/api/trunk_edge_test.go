@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+)
+
+func TestTrunkEdgeHandler_Update(t *testing.T) {
+	setup := setupTestAPI(t)
+	params := map[string]string{"sid": "TK1"}
+	update := func(handler *TrunkEdgeHandler, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/system/trunks/TK1/edge", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler.Update(rr, withURLParams(req, params))
+		return rr
+	}
+
+	// Without Twilio there are no trunks
+	assertStatus(t, update(NewTrunkEdgeHandler(&Dependencies{DB: setup.DB}), `{"edge": "dublin"}`), http.StatusServiceUnavailable)
+
+	handler := NewTrunkEdgeHandler(&Dependencies{DB: setup.DB, Twilio: setup.Twilio, Config: &config.Config{TwilioEdge: "dublin"}})
+	assertStatus(t, update(handler, `{"edge": "london"}`), http.StatusBadRequest)
+
+	rr := update(handler, `{"edge": " Dublin "}`)
+	assertStatus(t, rr, http.StatusOK)
+	var resp TrunkEdgeResponse
+	decodeResponse(t, rr, &resp)
+	if resp.Edge != "dublin" || resp.APIEdge != "dublin" || len(resp.OriginationURIs) != 1 || resp.OriginationURIs[0] != "sip:pbx.example.com;edge=dublin" {
+		t.Errorf("Unexpected trunk edge %+v", resp)
+	}
+
+	// An empty edge lets Twilio pick again
+	assertStatus(t, update(handler, `{"edge": ""}`), http.StatusOK)
+	req := httptest.NewRequest(http.MethodGet, "/api/system/trunks/TK1/edge", nil)
+	rr = httptest.NewRecorder()
+	handler.Get(rr, withURLParams(req, params))
+	assertStatus(t, rr, http.StatusOK)
+	decodeResponse(t, rr, &resp)
+	if resp.Edge != "" || resp.OriginationURIs[0] != "sip:pbx.example.com" || len(resp.Edges) != len(config.TwilioEdges) {
+		t.Errorf("Expected the edge removed, got %+v", resp)
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/failover"
+	"github.com/go-chi/chi/v5"
+)
+
+// TrunkFailoverHandler handles Twilio trunk disaster recovery endpoints
+type TrunkFailoverHandler struct {
+	deps *Dependencies
+}
+
+// NewTrunkFailoverHandler creates a new TrunkFailoverHandler
+func NewTrunkFailoverHandler(deps *Dependencies) *TrunkFailoverHandler {
+	return &TrunkFailoverHandler{deps: deps}
+}
+
+// List returns every configured trunk failover with its last verification (admin only)
+func (h *TrunkFailoverHandler) List(w http.ResponseWriter, r *http.Request) {
+	failovers, err := h.deps.DB.TrunkFailovers.List(r.Context())
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if failovers == nil {
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"data": []interface{}{}})
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"data": failovers})
+}
+
+// Get returns a trunk's failover with its last verification (admin only)
+func (h *TrunkFailoverHandler) Get(w http.ResponseWriter, r *http.Request) {
+	f, err := h.deps.DB.TrunkFailovers.Get(r.Context(), chi.URLParam(r, "sid"))
+	if err != nil {
+		if errors.Is(err, db.ErrTrunkFailoverNotFound) {
+			WriteNotFoundError(w, "Trunk failover")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+	WriteJSON(w, http.StatusOK, f)
+}
+
+// Update configures where a trunk's calls go when GoSIP is down: a
+// secondary server, a number to forward to, or both (admin only)
+func (h *TrunkFailoverHandler) Update(w http.ResponseWriter, r *http.Request) {
+	if h.deps.Failover == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Trunk failover is not available", nil)
+		return
+	}
+
+	var req failover.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	req.ForwardTo = strings.TrimSpace(req.ForwardTo)
+	req.DisasterRecoveryURL = strings.TrimSpace(req.DisasterRecoveryURL)
+	req.SecondaryURI = strings.TrimSpace(req.SecondaryURI)
+
+	var fieldErrors []FieldError
+	if req.ForwardTo == "" && req.DisasterRecoveryURL == "" && req.SecondaryURI == "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "forward_to", Message: "A number to forward to, a disaster recovery URL or a secondary URI is required"})
+	}
+	if req.ForwardTo != "" && req.DisasterRecoveryURL != "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "disaster_recovery_url", Message: "Give either a number to forward to or a disaster recovery URL"})
+	}
+	if req.ForwardTo != "" && !escalationNumber.MatchString(req.ForwardTo) {
+		fieldErrors = append(fieldErrors, FieldError{Field: "forward_to", Message: "Number must be in E.164 format"})
+	}
+	if req.DisasterRecoveryURL != "" {
+		if u, err := url.Parse(req.DisasterRecoveryURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			fieldErrors = append(fieldErrors, FieldError{Field: "disaster_recovery_url", Message: "URL must be an https URL"})
+		}
+	}
+	if req.SecondaryURI != "" && !strings.HasPrefix(req.SecondaryURI, "sip:") && !strings.HasPrefix(req.SecondaryURI, "sips:") {
+		fieldErrors = append(fieldErrors, FieldError{Field: "secondary_uri", Message: "URI must start with sip: or sips:"})
+	}
+	if len(fieldErrors) > 0 {
+		WriteValidationError(w, "Validation failed", fieldErrors)
+		return
+	}
+
+	f, err := h.deps.Failover.Configure(r.Context(), chi.URLParam(r, "sid"), req)
+	if err != nil {
+		WriteTwilioError(w, "Failed to configure trunk failover", err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, f)
+}
+
+// Delete removes a trunk's disaster recovery URL and secondary origination
+// URL (admin only)
+func (h *TrunkFailoverHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if h.deps.Failover == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Trunk failover is not available", nil)
+		return
+	}
+
+	if err := h.deps.Failover.Remove(r.Context(), chi.URLParam(r, "sid")); err != nil {
+		if errors.Is(err, db.ErrTrunkFailoverNotFound) {
+			WriteNotFoundError(w, "Trunk failover")
+			return
+		}
+		WriteTwilioError(w, "Failed to remove trunk failover", err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Trunk failover removed"})
+}
+
+// Verify checks a trunk's failover against Twilio now (admin only)
+func (h *TrunkFailoverHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	if h.deps.Failover == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Trunk failover is not available", nil)
+		return
+	}
+
+	f, err := h.deps.Failover.Verify(r.Context(), chi.URLParam(r, "sid"))
+	if err != nil {
+		if errors.Is(err, db.ErrTrunkFailoverNotFound) {
+			WriteNotFoundError(w, "Trunk failover")
+			return
+		}
+		WriteTwilioError(w, "Failed to verify trunk failover", err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, f)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/failover"
+	"github.com/btafoya/gosip/internal/twilio"
+)
+
+// fakeFailoverTrunks keeps a trunk's failover settings in memory
+type fakeFailoverTrunks struct {
+	settings twilio.TrunkFailoverSettings
+}
+
+func (f *fakeFailoverTrunks) GetTrunkFailover(ctx context.Context, trunkSID string) (*twilio.TrunkFailoverSettings, error) {
+	s := f.settings
+	return &s, nil
+}
+
+func (f *fakeFailoverTrunks) SetTrunkDisasterRecovery(ctx context.Context, trunkSID, disasterRecoveryURL string) error {
+	f.settings.DisasterRecoveryURL = disasterRecoveryURL
+	return nil
+}
+
+func (f *fakeFailoverTrunks) SetSecondaryOrigination(ctx context.Context, trunkSID, sipURI string) error {
+	f.settings.SecondaryURI, f.settings.SecondaryEnabled = sipURI, sipURI != ""
+	return nil
+}
+
+func TestTrunkFailoverHandler_Update(t *testing.T) {
+	setup := setupTestAPI(t)
+	params := map[string]string{"sid": "TK1"}
+	update := func(handler *TrunkFailoverHandler, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/system/trunks/TK1/failover", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler.Update(rr, withURLParams(req, params))
+		return rr
+	}
+
+	// Without a failover manager nothing can be configured
+	assertStatus(t, update(NewTrunkFailoverHandler(&Dependencies{DB: setup.DB}), `{"forward_to": "+15551234567"}`), http.StatusServiceUnavailable)
+
+	handler := NewTrunkFailoverHandler(&Dependencies{
+		DB:       setup.DB,
+		Failover: failover.NewManager(setup.DB, nil, &fakeFailoverTrunks{}),
+	})
+	for _, body := range []string{
+		`{}`,
+		`{"forward_to": "5551234567"}`,
+		`{"forward_to": "+15551234567", "disaster_recovery_url": "https://example.com/twiml"}`,
+		`{"disaster_recovery_url": "http://example.com/twiml"}`,
+		`{"secondary_uri": "backup.example.com"}`,
+	} {
+		assertStatus(t, update(handler, body), http.StatusBadRequest)
+	}
+
+	rr := update(handler, `{"forward_to": "+15551234567", "secondary_uri": "sip:backup.example.com"}`)
+	assertStatus(t, rr, http.StatusOK)
+	var resp struct {
+		ForwardTo string `json:"forward_to"`
+		Intact    bool   `json:"intact"`
+	}
+	decodeResponse(t, rr, &resp)
+	if resp.ForwardTo != "+15551234567" || !resp.Intact {
+		t.Errorf("Unexpected failover %+v", resp)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/system/trunks/TK2/failover", nil)
+	rr = httptest.NewRecorder()
+	handler.Get(rr, withURLParams(req, map[string]string{"sid": "TK2"}))
+	assertStatus(t, rr, http.StatusNotFound)
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/twilioips"
+)
+
+// TwilioRangesHandler handles the Twilio address ranges the firewall rules
+// and the UDP SIP allowlist are built from
+type TwilioRangesHandler struct {
+	deps *Dependencies
+}
+
+// NewTwilioRangesHandler creates a new TwilioRangesHandler
+func NewTwilioRangesHandler(deps *Dependencies) *TwilioRangesHandler {
+	return &TwilioRangesHandler{deps: deps}
+}
+
+// TwilioRangesResponse is the Twilio ranges in use and how they're applied
+type TwilioRangesResponse struct {
+	twilioips.Ranges
+	Enforced        bool             `json:"enforced"`         // UDP SIP is restricted with GOSIP_SIP_TWILIO_ONLY
+	AllowedNetworks []string         `json:"allowed_networks"` // GOSIP_SIP_ALLOWLIST
+	DroppedRequests uint64           `json:"dropped_requests"` // UDP requests dropped since startup
+	Ports           []twilioips.Port `json:"ports"`            // Ports the firewall rules filter
+	Formats         []string         `json:"formats"`
+}
+
+// TwilioRangesRequest replaces the ranges in use
+type TwilioRangesRequest struct {
+	Signaling []string `json:"signaling"`
+	Media     []string `json:"media"`
+}
+
+// available writes an error and returns false without the ranges
+func (h *TwilioRangesHandler) available(w http.ResponseWriter) bool {
+	if h.deps.TwilioRanges == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Twilio address ranges are not available", nil)
+		return false
+	}
+	return true
+}
+
+// response describes ranges and how they're applied
+func (h *TwilioRangesHandler) response(r twilioips.Ranges) TwilioRangesResponse {
+	resp := TwilioRangesResponse{
+		Ranges:          r,
+		Enforced:        h.deps.TwilioRanges.Enforced(),
+		AllowedNetworks: []string{},
+		Ports:           twilioips.Ports(h.deps.Config),
+		Formats:         twilioips.Formats,
+	}
+	for _, n := range h.deps.TwilioRanges.AllowedNetworks() {
+		resp.AllowedNetworks = append(resp.AllowedNetworks, n.String())
+	}
+	if resp.Ports == nil {
+		resp.Ports = []twilioips.Port{}
+	}
+	if h.deps.SIP != nil {
+		resp.DroppedRequests = h.deps.SIP.DroppedRequests()
+	}
+	return resp
+}
+
+// Get returns the Twilio address ranges in use (admin only)
+// GET /api/system/twilio-ranges
+func (h *TwilioRangesHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	WriteJSON(w, http.StatusOK, h.response(h.deps.TwilioRanges.Ranges()))
+}
+
+// Update replaces the Twilio address ranges, e.g. after Twilio announces
+// new ones (admin only)
+// PUT /api/system/twilio-ranges
+func (h *TwilioRangesHandler) Update(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+
+	var req TwilioRangesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	ranges := twilioips.Ranges{Signaling: trimAll(req.Signaling), Media: trimAll(req.Media)}
+	if err := ranges.Validate(); err != nil {
+		field := "signaling"
+		if strings.HasPrefix(err.Error(), "media") {
+			field = "media"
+		}
+		WriteValidationError(w, "Validation failed", []FieldError{{Field: field, Message: err.Error()}})
+		return
+	}
+
+	ranges, err := h.deps.TwilioRanges.Set(r.Context(), ranges)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	WriteJSON(w, http.StatusOK, h.response(ranges))
+}
+
+// Reset goes back to the ranges bundled with GoSIP (admin only)
+// DELETE /api/system/twilio-ranges
+func (h *TwilioRangesHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	ranges, err := h.deps.TwilioRanges.Reset(r.Context())
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	WriteJSON(w, http.StatusOK, h.response(ranges))
+}
+
+// Refresh fetches the ranges from GOSIP_TWILIO_RANGES_URL (admin only)
+// POST /api/system/twilio-ranges/refresh
+func (h *TwilioRangesHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	ranges, err := h.deps.TwilioRanges.Refresh(r.Context())
+	if err != nil {
+		if errors.Is(err, twilioips.ErrNoRangesURL) {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "Set GOSIP_TWILIO_RANGES_URL to refresh the ranges", nil)
+			return
+		}
+		WriteError(w, http.StatusBadGateway, ErrCodeBadGateway, "Failed to refresh Twilio address ranges: "+err.Error(), nil)
+		return
+	}
+	WriteJSON(w, http.StatusOK, h.response(ranges))
+}
+
+// Rules returns firewall rules that let only Twilio and private networks
+// reach the SIP and media ports, as nftables, iptables or ufw commands
+// (admin only)
+// GET /api/system/twilio-ranges/rules?format=nftables
+func (h *TwilioRangesHandler) Rules(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = twilioips.FormatNFTables
+	}
+
+	rules, err := twilioips.Rules(format, h.deps.TwilioRanges.Ranges(), twilioips.Ports(h.deps.Config), h.deps.TwilioRanges.AllowedNetworks())
+	if err != nil {
+		WriteValidationError(w, "Validation failed", []FieldError{
+			{Field: "format", Message: "Format must be one of " + strings.Join(twilioips.Formats, ", ")},
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(rules))
+}
+
+// trimAll trims every entry and drops empty ones
+func trimAll(values []string) []string {
+	var out []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/twilioips"
+)
+
+func TestTwilioRangesHandler(t *testing.T) {
+	setup := setupTestAPI(t)
+	cfg := &config.Config{SIPPort: 5060, SIPAllowlist: &config.SIPAllowlistConfig{TwilioOnly: true}}
+	handler := NewTwilioRangesHandler(&Dependencies{DB: setup.DB, Config: cfg, TwilioRanges: twilioips.NewList(cfg, setup.DB)})
+
+	rr := httptest.NewRecorder()
+	handler.Get(rr, httptest.NewRequest(http.MethodGet, "/api/system/twilio-ranges", nil))
+	assertStatus(t, rr, http.StatusOK)
+	var resp TwilioRangesResponse
+	decodeResponse(t, rr, &resp)
+	if resp.Source != twilioips.SourceBundled || !resp.Enforced || len(resp.Ports) != 2 {
+		t.Errorf("Unexpected ranges %+v", resp)
+	}
+
+	update := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.Update(rr, httptest.NewRequest(http.MethodPut, "/api/system/twilio-ranges", strings.NewReader(body)))
+		return rr
+	}
+	assertStatus(t, update(`{"signaling": ["198.51.100.0/24"], "media": ["bogus"]}`), http.StatusBadRequest)
+	rr = update(`{"signaling": [" 198.51.100.0/24 "], "media": ["198.51.100.0/23"]}`)
+	assertStatus(t, rr, http.StatusOK)
+	decodeResponse(t, rr, &resp)
+	if resp.Source != twilioips.SourceCustom || resp.Signaling[0] != "198.51.100.0/24" {
+		t.Errorf("Expected the custom ranges in use, got %+v", resp)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.Rules(rr, httptest.NewRequest(http.MethodGet, "/api/system/twilio-ranges/rules?format=ufw", nil))
+	assertStatus(t, rr, http.StatusOK)
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain") || !strings.Contains(rr.Body.String(), "ufw allow proto udp from 198.51.100.0/24 to any port 5060") {
+		t.Errorf("Unexpected rules %q", rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	handler.Rules(rr, httptest.NewRequest(http.MethodGet, "/api/system/twilio-ranges/rules?format=pf", nil))
+	assertStatus(t, rr, http.StatusBadRequest)
+
+	// Refreshing needs a URL to fetch from
+	rr = httptest.NewRecorder()
+	handler.Refresh(rr, httptest.NewRequest(http.MethodPost, "/api/system/twilio-ranges/refresh", nil))
+	assertStatus(t, rr, http.StatusConflict)
+
+	rr = httptest.NewRecorder()
+	handler.Reset(rr, httptest.NewRequest(http.MethodDelete, "/api/system/twilio-ranges", nil))
+	assertStatus(t, rr, http.StatusOK)
+	decodeResponse(t, rr, &resp)
+	if resp.Source != twilioips.SourceBundled {
+		t.Errorf("Expected the bundled ranges back, got %+v", resp)
+	}
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/verify"
+)
+
+// VerifyHandler handles sending and checking one-time codes for apps that
+// verify phone numbers
+type VerifyHandler struct {
+	deps *Dependencies
+}
+
+// NewVerifyHandler creates a new VerifyHandler
+func NewVerifyHandler(deps *Dependencies) *VerifyHandler {
+	return &VerifyHandler{deps: deps}
+}
+
+// StartVerificationRequest represents a request to send a code
+type StartVerificationRequest struct {
+	To      string `json:"to"`
+	Channel string `json:"channel"` // "sms" (default) or "call"
+	DIDID   int64  `json:"did_id"`  // DID the code is sent from
+}
+
+// CheckVerificationRequest represents a code to check
+type CheckVerificationRequest struct {
+	To   string `json:"to"`
+	Code string `json:"code"`
+}
+
+// available writes an error and returns false when codes can't be sent
+func (h *VerifyHandler) available(w http.ResponseWriter) bool {
+	if h.deps.Verify == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Phone number verification is not available", nil)
+		return false
+	}
+	return true
+}
+
+// Start sends a one-time code to a number by SMS or voice call
+func (h *VerifyHandler) Start(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	var req StartVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	if req.Channel == "" {
+		req.Channel = verify.ChannelSMS
+	}
+
+	var errs []FieldError
+	to := db.NormalizeE164(req.To)
+	if to == "" {
+		errs = append(errs, FieldError{Field: "to", Message: "An E.164 phone number is required"})
+	}
+	if req.Channel != verify.ChannelSMS && req.Channel != verify.ChannelCall {
+		errs = append(errs, FieldError{Field: "channel", Message: "Channel must be sms or call"})
+	}
+	if req.DIDID == 0 {
+		errs = append(errs, FieldError{Field: "did_id", Message: "DID ID is required"})
+	}
+	if len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	did, err := h.deps.DB.DIDs.GetByID(r.Context(), req.DIDID)
+	if err != nil {
+		if err == db.ErrDIDNotFound {
+			WriteNotFoundError(w, "DID")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	user := GetUserFromContext(r.Context())
+	v, err := h.deps.Verify.Start(r.Context(), verify.Request{
+		UserID:  user.ID,
+		DID:     did,
+		SMSFrom: smsSender(r.Context(), h.deps, did),
+		To:      to,
+		Channel: req.Channel,
+	})
+	var limited *verify.RateLimitError
+	switch {
+	case err == nil:
+	case errors.As(err, &limited):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+		WriteError(w, http.StatusTooManyRequests, ErrCodeRateLimited,
+			limited.Reason+". Try again in "+limited.RetryAfter.Round(time.Second).String(), nil)
+		return
+	case errors.Is(err, verify.ErrChannelUnavailable):
+		if req.Channel == verify.ChannelSMS {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "DID is not SMS-enabled", nil)
+		} else {
+			WriteError(w, http.StatusBadRequest, ErrCodeBadRequest, "DID is not voice-enabled", nil)
+		}
+		return
+	case errors.Is(err, verify.ErrSendFailed):
+		slog.Warn("Failed to send verification code", "error", err, "did_id", did.ID, "channel", req.Channel)
+		WriteError(w, http.StatusBadGateway, ErrCodeBadGateway, "The verification code couldn't be sent", nil)
+		return
+	default:
+		slog.Error("Failed to start verification", "error", err)
+		WriteInternalError(w)
+		return
+	}
+
+	slog.Info("Verification code sent", "verification_id", v.ID, "user_id", user.ID, "channel", v.Channel)
+	WriteJSON(w, http.StatusCreated, v)
+}
+
+// Check validates a code against the one sent to a number. A wrong code
+// returns valid false and counts against the verification's attempts.
+func (h *VerifyHandler) Check(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	var req CheckVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	var errs []FieldError
+	to := db.NormalizeE164(req.To)
+	if to == "" {
+		errs = append(errs, FieldError{Field: "to", Message: "An E.164 phone number is required"})
+	}
+	if req.Code == "" {
+		errs = append(errs, FieldError{Field: "code", Message: "Code is required"})
+	}
+	if len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	result, err := h.deps.Verify.Check(r.Context(), GetUserFromContext(r.Context()).ID, to, req.Code)
+	switch {
+	case err == nil:
+	case err == db.ErrVerificationNotFound:
+		WriteNotFoundError(w, "Pending verification")
+		return
+	case errors.Is(err, verify.ErrExpired):
+		WriteError(w, http.StatusGone, ErrCodeBadRequest, "The verification code has expired", nil)
+		return
+	default:
+		slog.Error("Failed to check verification", "error", err)
+		WriteInternalError(w)
+		return
+	}
+	WriteJSON(w, http.StatusOK, result)
+}
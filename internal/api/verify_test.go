@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/verify"
+)
+
+// fakeVerifySender records the last SMS sent
+type fakeVerifySender struct {
+	body string
+}
+
+func (f *fakeVerifySender) SendSMS(from, to, body string, mediaURLs []string) (string, error) {
+	f.body = body
+	return "SM123", nil
+}
+
+func (f *fakeVerifySender) MakeCallTwiML(from, to, twiml string) (string, error) {
+	return "CA123", nil
+}
+
+func TestVerifyHandler(t *testing.T) {
+	setup := setupTestAPI(t)
+	user := createTestUser(t, setup.DB, "app@example.com", "password123", "user")
+
+	rr := httptest.NewRecorder()
+	NewVerifyHandler(&Dependencies{DB: setup.DB}).Start(rr, httptest.NewRequest(http.MethodPost, "/api/verify/start", nil))
+	assertStatus(t, rr, http.StatusServiceUnavailable)
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	sender := &fakeVerifySender{}
+	handler := NewVerifyHandler(&Dependencies{DB: setup.DB, Verify: verify.NewService(setup.DB, sender)})
+	call := func(fn http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/verify", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, user))
+		rr := httptest.NewRecorder()
+		fn(rr, req)
+		return rr
+	}
+
+	assertStatus(t, call(handler.Start, `{"to": "ext 100", "did_id": 1}`), http.StatusBadRequest)
+	assertStatus(t, call(handler.Start, `{"to": "+15559876543", "did_id": 99}`), http.StatusNotFound)
+
+	rr = call(handler.Start, `{"to": "(555) 987-6543", "did_id": 1}`)
+	assertStatus(t, rr, http.StatusCreated)
+	var started struct {
+		ToNumber string `json:"to_number"`
+		Channel  string `json:"channel"`
+		Status   string `json:"status"`
+		DIDID    int64  `json:"did_id"`
+	}
+	decodeResponse(t, rr, &started)
+	if started.ToNumber != "+15559876543" || started.Channel != verify.ChannelSMS || started.Status != "pending" || started.DIDID != did.ID {
+		t.Errorf("Unexpected verification %+v", started)
+	}
+	if strings.Contains(rr.Body.String(), "code_hash") {
+		t.Error("Expected the code hash left out of the response")
+	}
+
+	// A second code right away is rate limited
+	rr = call(handler.Start, `{"to": "+15559876543", "did_id": 1, "channel": "call"}`)
+	assertStatus(t, rr, http.StatusTooManyRequests)
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+
+	rr = call(handler.Check, `{"to": "+15559876543", "code": "wrong"}`)
+	assertStatus(t, rr, http.StatusOK)
+	var result verify.CheckResult
+	decodeResponse(t, rr, &result)
+	if result.Valid {
+		t.Error("Expected a wrong code rejected")
+	}
+
+	code := regexp.MustCompile(`\d{6}`).FindString(sender.body)
+	rr = call(handler.Check, `{"to": "+15559876543", "code": "`+code+`"}`)
+	assertStatus(t, rr, http.StatusOK)
+	result = verify.CheckResult{}
+	decodeResponse(t, rr, &result)
+	if !result.Valid || result.Status != "approved" {
+		t.Errorf("Expected the code approved, got %+v", result)
+	}
+
+	assertStatus(t, call(handler.Check, `{"to": "+15559876543", "code": "`+code+`"}`), http.StatusNotFound)
+}
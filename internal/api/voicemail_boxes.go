@@ -0,0 +1,331 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// VoicemailBoxMembersRequest replaces the users sharing a voicemail box
+type VoicemailBoxMembersRequest struct {
+	UserIDs []int64 `json:"user_ids"` // Empty makes the box private again
+}
+
+// VoicemailAssignRequest assigns a voicemail to a user for follow-up
+type VoicemailAssignRequest struct {
+	UserID int64 `json:"user_id"`
+}
+
+// ListMembers returns the users sharing a voicemail box
+func (h *VoicemailHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	didID, err := strconv.ParseInt(chi.URLParam(r, "didID"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid DID ID", nil)
+		return
+	}
+
+	members, err := h.deps.DB.VoicemailBoxes.ListMembers(r.Context(), didID)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if members == nil {
+		members = []*models.VoicemailBoxMember{}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"data": members})
+}
+
+// SetMembers replaces the users sharing a voicemail box. Members each keep
+// their own read state and message waiting indicator.
+func (h *VoicemailHandler) SetMembers(w http.ResponseWriter, r *http.Request) {
+	didID, err := strconv.ParseInt(chi.URLParam(r, "didID"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid DID ID", nil)
+		return
+	}
+
+	if _, err := h.deps.DB.DIDs.GetByID(r.Context(), didID); err != nil {
+		if err == db.ErrDIDNotFound {
+			WriteNotFoundError(w, "DID")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	var req VoicemailBoxMembersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	for _, userID := range req.UserIDs {
+		if _, err := h.deps.DB.Users.GetByID(r.Context(), userID); err != nil {
+			if err == db.ErrUserNotFound {
+				WriteValidationError(w, "Validation failed", []FieldError{
+					{Field: "user_ids", Message: fmt.Sprintf("User %d does not exist", userID)},
+				})
+				return
+			}
+			WriteInternalError(w)
+			return
+		}
+	}
+
+	previous, err := h.deps.DB.VoicemailBoxes.ListMembers(r.Context(), didID)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if err := h.deps.DB.VoicemailBoxes.SetMembers(r.Context(), didID, req.UserIDs); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	// Former members stop counting this box's voicemails
+	mwiNotifier := NewMWINotifier(h.deps)
+	for _, member := range previous {
+		go mwiNotifier.UpdateMWIForUser(context.Background(), member.UserID)
+	}
+	go mwiNotifier.UpdateMWIForDID(context.Background(), didID)
+
+	h.ListMembers(w, r)
+}
+
+// MarkUnread marks a voicemail as unread again. In a shared box this only
+// affects the current user.
+func (h *VoicemailHandler) MarkUnread(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid voicemail ID", nil)
+		return
+	}
+
+	voicemail, err := h.deps.DB.Voicemails.GetByID(r.Context(), id)
+	if err != nil {
+		if err == db.ErrVoicemailNotFound {
+			WriteNotFoundError(w, "Voicemail")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	// Unread for one member means not yet read by all of them
+	if userID := getUserIDFromContext(r.Context()); h.isBoxMember(r.Context(), voicemail, userID) {
+		err = h.deps.DB.VoicemailBoxes.MarkUnread(r.Context(), id, userID)
+	}
+	if err == nil {
+		err = h.deps.DB.Voicemails.MarkAsUnread(r.Context(), id)
+	}
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	if voicemail.UserID != nil {
+		mwiNotifier := NewMWINotifier(h.deps)
+		go mwiNotifier.UpdateMWIForDID(context.Background(), *voicemail.UserID)
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Voicemail marked as unread"})
+}
+
+// Assign hands a voicemail to a user for follow-up. Voicemails in a shared
+// box can only be assigned to its members.
+func (h *VoicemailHandler) Assign(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid voicemail ID", nil)
+		return
+	}
+
+	voicemail, err := h.deps.DB.Voicemails.GetByID(r.Context(), id)
+	if err != nil {
+		if err == db.ErrVoicemailNotFound {
+			WriteNotFoundError(w, "Voicemail")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	var req VoicemailAssignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+
+	assignee, err := h.deps.DB.Users.GetByID(r.Context(), req.UserID)
+	if err != nil {
+		if err == db.ErrUserNotFound {
+			WriteValidationError(w, "Validation failed", []FieldError{{Field: "user_id", Message: "User does not exist"}})
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+	if voicemail.UserID != nil {
+		shared, err := h.deps.DB.VoicemailBoxes.IsShared(r.Context(), *voicemail.UserID)
+		if err != nil {
+			WriteInternalError(w)
+			return
+		}
+		if shared && !h.isBoxMember(r.Context(), voicemail, assignee.ID) {
+			WriteValidationError(w, "Validation failed", []FieldError{{Field: "user_id", Message: "User is not a member of this voicemail box"}})
+			return
+		}
+	}
+
+	var assignedBy *int64
+	if userID := getUserIDFromContext(r.Context()); userID > 0 {
+		assignedBy = &userID
+	}
+	if err := h.deps.DB.VoicemailBoxes.Assign(r.Context(), id, assignee.ID, assignedBy); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	assignment, err := h.deps.DB.VoicemailBoxes.GetAssignment(r.Context(), id)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	h.deps.Events.Publish(events.TypeVoicemailAssigned, assignment)
+	if assignedBy == nil || *assignedBy != assignee.ID {
+		go h.notifyAssignee(assignee, voicemail)
+	}
+
+	WriteJSON(w, http.StatusOK, assignment)
+}
+
+// Unassign removes the assignment of a voicemail
+func (h *VoicemailHandler) Unassign(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid voicemail ID", nil)
+		return
+	}
+
+	if err := h.deps.DB.VoicemailBoxes.Unassign(r.Context(), id); err != nil {
+		if errors.Is(err, db.ErrVoicemailAssignmentNotFound) {
+			WriteNotFoundError(w, "Voicemail assignment")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Voicemail unassigned"})
+}
+
+// notifyAssignee emails a user that a voicemail was assigned to them
+func (h *VoicemailHandler) notifyAssignee(assignee *models.User, voicemail *models.Voicemail) {
+	if h.deps.Notifier == nil || h.deps.Config == nil || h.deps.Config.SMTPHost == "" {
+		return
+	}
+	subject := fmt.Sprintf("Voicemail from %s assigned to you", voicemail.FromNumber)
+	body := fmt.Sprintf(`
+A voicemail was assigned to you for follow-up:
+
+From: %s
+Duration: %d seconds
+Time: %s
+
+%s
+`, voicemail.FromNumber, voicemail.Duration, voicemail.CreatedAt.Format("Jan 2, 2006 3:04 PM"), voicemail.Transcript)
+	if err := h.deps.Notifier.SendEmail(assignee.Email, subject, body); err != nil {
+		slog.Warn("Failed to send voicemail assignment email", "error", err, "user_id", assignee.ID)
+	}
+}
+
+// isBoxMember reports whether a user is a member of the shared box a
+// voicemail belongs to
+func (h *VoicemailHandler) isBoxMember(ctx context.Context, voicemail *models.Voicemail, userID int64) bool {
+	if voicemail.UserID == nil || userID == 0 {
+		return false
+	}
+	member, err := h.deps.DB.VoicemailBoxes.IsMember(ctx, *voicemail.UserID, userID)
+	if err != nil {
+		slog.Warn("Failed to check voicemail box membership", "error", err, "did_id", *voicemail.UserID)
+		return false
+	}
+	return member
+}
+
+// markReadByMember records that a member of a shared box read a voicemail,
+// and marks it read once every member has
+func (h *VoicemailHandler) markReadByMember(ctx context.Context, voicemail *models.Voicemail, userID int64) error {
+	if err := h.deps.DB.VoicemailBoxes.MarkRead(ctx, voicemail.ID, userID); err != nil {
+		return err
+	}
+	all, err := h.deps.DB.VoicemailBoxes.ReadByAll(ctx, voicemail.ID, *voicemail.UserID)
+	if err != nil || !all {
+		return err
+	}
+	return h.deps.DB.Voicemails.MarkAsRead(ctx, voicemail.ID)
+}
+
+// dropReadByUser leaves out the voicemails a user has read in the shared
+// boxes they are a member of
+func (h *VoicemailHandler) dropReadByUser(ctx context.Context, userID int64, voicemails []*models.Voicemail) []*models.Voicemail {
+	var unread []*models.Voicemail
+	for i, resp := range h.toVoicemailResponses(ctx, userID, voicemails) {
+		if !resp.IsRead {
+			unread = append(unread, voicemails[i])
+		}
+	}
+	return unread
+}
+
+// toVoicemailResponses converts voicemails for a user, with the user's own
+// read state for voicemails in boxes they share and who each is assigned to
+func (h *VoicemailHandler) toVoicemailResponses(ctx context.Context, userID int64, voicemails []*models.Voicemail) []*VoicemailResponse {
+	type boxState struct {
+		member    bool
+		read      map[int64]bool
+		assignees map[int64]int64
+	}
+	boxes := make(map[int64]*boxState)
+
+	var response []*VoicemailResponse
+	for _, v := range voicemails {
+		resp := toVoicemailResponse(v)
+		box, ok := boxes[resp.DIDID]
+		if !ok {
+			box = &boxState{}
+			box.member = h.isBoxMember(ctx, v, userID)
+			if box.member {
+				read, err := h.deps.DB.VoicemailBoxes.ReadSet(ctx, resp.DIDID, userID)
+				if err != nil {
+					slog.Warn("Failed to load voicemail read state", "error", err, "did_id", resp.DIDID)
+				}
+				box.read = read
+			}
+			assignees, err := h.deps.DB.VoicemailBoxes.AssigneesForBox(ctx, resp.DIDID)
+			if err != nil {
+				slog.Warn("Failed to load voicemail assignments", "error", err, "did_id", resp.DIDID)
+			}
+			box.assignees = assignees
+			boxes[resp.DIDID] = box
+		}
+
+		if box.member {
+			resp.IsRead = box.read[v.ID]
+		}
+		if assignee, ok := box.assignees[v.ID]; ok {
+			resp.AssignedTo = &assignee
+		}
+		response = append(response, resp)
+	}
+	return response
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestVoicemailHandler_SharedBoxReadState(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewVoicemailHandler(&Dependencies{DB: setup.DB})
+	ctx := context.Background()
+
+	// Voicemail boxes are keyed by DID, stored in the voicemail's user_id,
+	// so the first user and DID share an ID
+	alice := createTestUser(t, setup.DB, "alice@example.com", "password", "user")
+	bob := createTestUser(t, setup.DB, "bob@example.com", "password", "user")
+	did := createTestDID(t, setup.DB, "+15551234567")
+	vm := createTestVoicemail(t, setup.DB, did.ID, "+15559876543")
+
+	body := fmt.Sprintf(`{"user_ids": [%d, %d]}`, alice.ID, bob.ID)
+	req := httptest.NewRequest(http.MethodPut, "/api/voicemail-boxes/1/members", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler.SetMembers(rr, withURLParams(req, map[string]string{"didID": fmt.Sprint(did.ID)}))
+	assertStatus(t, rr, http.StatusOK)
+
+	as := func(user *models.User, req *http.Request) *http.Request {
+		return req.WithContext(context.WithValue(req.Context(), contextKeyUser, user))
+	}
+	unread := func(user *models.User) []*VoicemailResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/voicemails?unread=true&did_id="+fmt.Sprint(did.ID), nil)
+		rr := httptest.NewRecorder()
+		handler.List(rr, as(user, req))
+		assertStatus(t, rr, http.StatusOK)
+		var resp struct {
+			Data []*VoicemailResponse `json:"data"`
+		}
+		decodeResponse(t, rr, &resp)
+		return resp.Data
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/api/voicemails/1/read", nil)
+	rr = httptest.NewRecorder()
+	handler.MarkRead(rr, as(alice, withURLParams(req, map[string]string{"id": fmt.Sprint(vm.ID)})))
+	assertStatus(t, rr, http.StatusOK)
+
+	if got := unread(alice); len(got) != 0 {
+		t.Errorf("Expected nothing unread for Alice, got %d", len(got))
+	}
+	if got := unread(bob); len(got) != 1 || got[0].IsRead {
+		t.Errorf("Expected the voicemail unread for Bob, got %+v", got)
+	}
+	if stored, _ := setup.DB.Voicemails.GetByID(ctx, vm.ID); stored.IsRead {
+		t.Error("Expected the voicemail to stay unread until every member reads it")
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/api/voicemails/1/read", nil)
+	rr = httptest.NewRecorder()
+	handler.MarkRead(rr, as(bob, withURLParams(req, map[string]string{"id": fmt.Sprint(vm.ID)})))
+	assertStatus(t, rr, http.StatusOK)
+	if stored, _ := setup.DB.Voicemails.GetByID(ctx, vm.ID); !stored.IsRead {
+		t.Error("Expected the voicemail read once both members read it")
+	}
+}
+
+func TestVoicemailHandler_Assign(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewVoicemailHandler(&Dependencies{DB: setup.DB})
+
+	alice := createTestUser(t, setup.DB, "alice@example.com", "password", "user")
+	outsider := createTestUser(t, setup.DB, "carol@example.com", "password", "user")
+	did := createTestDID(t, setup.DB, "+15551234567")
+	vm := createTestVoicemail(t, setup.DB, did.ID, "+15559876543")
+	if err := setup.DB.VoicemailBoxes.SetMembers(context.Background(), did.ID, []int64{alice.ID}); err != nil {
+		t.Fatalf("Failed to set members: %v", err)
+	}
+	params := map[string]string{"id": fmt.Sprint(vm.ID)}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/voicemails/1/assignment", strings.NewReader(fmt.Sprintf(`{"user_id": %d}`, outsider.ID)))
+	rr := httptest.NewRecorder()
+	handler.Assign(rr, withURLParams(req, params))
+	assertStatus(t, rr, http.StatusBadRequest)
+
+	req = httptest.NewRequest(http.MethodPut, "/api/voicemails/1/assignment", strings.NewReader(fmt.Sprintf(`{"user_id": %d}`, alice.ID)))
+	rr = httptest.NewRecorder()
+	handler.Assign(rr, withURLParams(req, params))
+	assertStatus(t, rr, http.StatusOK)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/voicemails?assigned=me", nil)
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, alice))
+	rr = httptest.NewRecorder()
+	handler.List(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+	var resp struct {
+		Data []*VoicemailResponse `json:"data"`
+	}
+	decodeResponse(t, rr, &resp)
+	if len(resp.Data) != 1 || resp.Data[0].AssignedTo == nil || *resp.Data[0].AssignedTo != alice.ID {
+		t.Errorf("Expected the voicemail assigned to Alice, got %+v", resp.Data)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/voicemails/1/assignment", nil)
+	rr = httptest.NewRecorder()
+	handler.Unassign(rr, withURLParams(req, params))
+	assertStatus(t, rr, http.StatusOK)
+
+	rr = httptest.NewRecorder()
+	handler.Unassign(rr, withURLParams(req, params))
+	assertStatus(t, rr, http.StatusNotFound)
+}
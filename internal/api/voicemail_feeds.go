@@ -0,0 +1,323 @@
+package api
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// VoicemailFeedResponse describes a voicemail box's private podcast feed
+type VoicemailFeedResponse struct {
+	DIDID         int64   `json:"did_id"`
+	FeedURL       string  `json:"feed_url"`
+	CreatedAt     string  `json:"created_at"`
+	LastFetchedAt *string `json:"last_fetched_at,omitempty"`
+}
+
+// GetFeed returns the podcast feed of a voicemail box
+func (h *VoicemailHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	didID, err := strconv.ParseInt(chi.URLParam(r, "didID"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid DID ID", nil)
+		return
+	}
+
+	feed, err := h.deps.DB.VoicemailFeeds.GetByDID(r.Context(), didID)
+	if err != nil {
+		if err == db.ErrVoicemailFeedNotFound {
+			WriteNotFoundError(w, "Voicemail feed")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, h.toFeedResponse(r.Context(), feed))
+}
+
+// CreateFeed enables a voicemail box's podcast feed, or replaces its secret
+// URL so apps subscribed to the old one lose access
+func (h *VoicemailHandler) CreateFeed(w http.ResponseWriter, r *http.Request) {
+	didID, err := strconv.ParseInt(chi.URLParam(r, "didID"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid DID ID", nil)
+		return
+	}
+
+	if _, err := h.deps.DB.DIDs.GetByID(r.Context(), didID); err != nil {
+		if err == db.ErrDIDNotFound {
+			WriteNotFoundError(w, "DID")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	var createdBy *int64
+	if userID := getUserIDFromContext(r.Context()); userID > 0 {
+		createdBy = &userID
+	}
+
+	feed, err := h.deps.DB.VoicemailFeeds.Rotate(r.Context(), didID, createdBy)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, h.toFeedResponse(r.Context(), feed))
+}
+
+// DeleteFeed disables a voicemail box's podcast feed
+func (h *VoicemailHandler) DeleteFeed(w http.ResponseWriter, r *http.Request) {
+	didID, err := strconv.ParseInt(chi.URLParam(r, "didID"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid DID ID", nil)
+		return
+	}
+
+	if err := h.deps.DB.VoicemailFeeds.Delete(r.Context(), didID); err != nil {
+		if err == db.ErrVoicemailFeedNotFound {
+			WriteNotFoundError(w, "Voicemail feed")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Voicemail feed disabled"})
+}
+
+// feedURL returns the public URL of a feed, or of a path below it
+func (h *VoicemailHandler) feedURL(ctx context.Context, token, path string) string {
+	return fmt.Sprintf("%s/api/feeds/voicemail/%s%s", publicBaseURL(ctx, h.deps), token, path)
+}
+
+func (h *VoicemailHandler) toFeedResponse(ctx context.Context, feed *models.VoicemailFeed) *VoicemailFeedResponse {
+	resp := &VoicemailFeedResponse{
+		DIDID:     feed.DIDID,
+		FeedURL:   h.feedURL(ctx, feed.Token, ""),
+		CreatedAt: feed.CreatedAt.Format(time.RFC3339),
+	}
+	if feed.LastFetchedAt != nil {
+		fetched := feed.LastFetchedAt.Format(time.RFC3339)
+		resp.LastFetchedAt = &fetched
+	}
+	return resp
+}
+
+// RSS 2.0 document with the iTunes podcast extensions podcast apps expect
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	ITunes  string     `xml:"xmlns:itunes,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Language    string    `xml:"language"`
+	Block       string    `xml:"itunes:block"`
+	Explicit    string    `xml:"itunes:explicit"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string       `xml:"title"`
+	Description string       `xml:"description"`
+	PubDate     string       `xml:"pubDate"`
+	GUID        rssGUID      `xml:"guid"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+	Duration    int          `xml:"itunes:duration"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int    `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// feedEnclosure is a voicemail's audio: a WAV file for voicemail GoSIP
+// recorded itself, otherwise the MP3 Twilio makes of its recordings
+func feedEnclosure(url string, local bool) rssEnclosure {
+	if local {
+		return rssEnclosure{URL: url + ".wav", Type: "audio/wav"}
+	}
+	return rssEnclosure{URL: url + ".mp3", Type: "audio/mpeg"}
+}
+
+// Feed serves a voicemail box's recent voicemails as a podcast RSS feed. The
+// secret token in the URL is the only credential, since podcast apps can't
+// log in; recordings are served through the same token.
+func (h *VoicemailHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	feed, err := h.deps.DB.VoicemailFeeds.GetByToken(ctx, chi.URLParam(r, "token"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	did, err := h.deps.DB.DIDs.GetByID(ctx, feed.DIDID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	voicemails, err := h.deps.DB.Voicemails.ListByUser(ctx, feed.DIDID, config.VoicemailFeedSize, 0)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	if err := h.deps.DB.VoicemailFeeds.RecordFetch(ctx, feed.DIDID); err != nil {
+		slog.Warn("Failed to record voicemail feed fetch", "error", err, "did_id", feed.DIDID)
+	}
+
+	mailbox := did.Number
+	if did.Name != "" {
+		mailbox = did.Name + " (" + did.Number + ")"
+	}
+	doc := rssFeed{
+		Version: "2.0",
+		ITunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		Channel: rssChannel{
+			Title:       "Voicemail - " + mailbox,
+			Link:        h.feedURL(r.Context(), feed.Token, ""),
+			Description: "Voicemails left for " + mailbox,
+			Language:    "en-us",
+			Block:       "yes",
+			Explicit:    "false",
+		},
+	}
+	for _, vm := range voicemails {
+		description := vm.Transcript
+		if description == "" {
+			description = "No transcription available."
+		}
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       fmt.Sprintf("Voicemail from %s (%d:%02d)", vm.FromNumber, vm.Duration/60, vm.Duration%60),
+			Description: description,
+			PubDate:     vm.CreatedAt.Format(time.RFC1123Z),
+			GUID:        rssGUID{IsPermaLink: "false", Value: fmt.Sprintf("gosip-voicemail-%d", vm.ID)},
+			Enclosure:   feedEnclosure(h.feedURL(r.Context(), feed.Token, fmt.Sprintf("/%d", vm.ID)), localVoicemailPath(h.deps, vm) != ""),
+			Duration:    vm.Duration,
+		})
+	}
+
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(body)
+}
+
+// FeedAudio relays a voicemail recording to a podcast app. Range requests are
+// passed through so apps can seek and resume downloads.
+func (h *VoicemailHandler) FeedAudio(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	feed, err := h.deps.DB.VoicemailFeeds.GetByToken(ctx, chi.URLParam(r, "token"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	file := chi.URLParam(r, "file")
+	id, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSuffix(file, ".mp3"), ".wav"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	vm, err := h.deps.DB.Voicemails.GetByID(ctx, id)
+	if err != nil || vm.UserID == nil || *vm.UserID != feed.DIDID {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Voicemail GoSIP recorded itself is served from disk
+	if path := localVoicemailPath(h.deps, vm); path != "" {
+		checksum, err := h.deps.DB.Voicemails.Checksum(ctx, vm.ID)
+		if err != nil {
+			WriteInternalError(w)
+			return
+		}
+		serveAudioFile(w, r, path, file, checksum)
+		return
+	}
+
+	u, err := url.Parse(vm.AudioURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		http.NotFound(w, r)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.Method, vm.AudioURL, nil)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	req.Header.Set("User-Agent", config.DefaultUserAgent)
+	if rng := r.Header.Get("Range"); rng != "" {
+		req.Header.Set("Range", rng)
+	}
+	if isTwilioHost(u.Hostname()) {
+		if accountSID, authToken := twilioCredentials(ctx, h.deps); accountSID != "" {
+			req.SetBasicAuth(accountSID, authToken)
+		}
+	}
+
+	client := &http.Client{Timeout: config.VoicemailFeedAudioTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.Warn("Failed to fetch voicemail recording for feed", "error", err, "voicemail_id", vm.ID)
+		WriteError(w, http.StatusBadGateway, ErrCodeBadGateway, "Recording unavailable", nil)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		slog.Warn("Voicemail recording fetch failed", "status", resp.StatusCode, "voicemail_id", vm.ID)
+		WriteError(w, http.StatusBadGateway, ErrCodeBadGateway, "Recording unavailable", nil)
+		return
+	}
+
+	for _, name := range []string{"Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified", "ETag"} {
+		if v := resp.Header.Get(name); v != "" {
+			w.Header().Set(name, v)
+		}
+	}
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("Cache-Control", "private")
+	w.WriteHeader(resp.StatusCode)
+	if r.Method != http.MethodHead {
+		io.Copy(w, resp.Body)
+	}
+}
+
+// isTwilioHost reports whether Twilio account credentials may be sent to host
+func isTwilioHost(host string) bool {
+	return host == "twilio.com" || strings.HasSuffix(host, ".twilio.com")
+}
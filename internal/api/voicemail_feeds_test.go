@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestVoicemailHandler_CreateFeed(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB}
+	handler := NewVoicemailHandler(deps)
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/voicemail-boxes/1/feed", nil)
+	req = withURLParams(req, map[string]string{"didID": fmt.Sprint(did.ID)})
+	rr := httptest.NewRecorder()
+	handler.CreateFeed(rr, req)
+
+	assertStatus(t, rr, http.StatusCreated)
+
+	var resp VoicemailFeedResponse
+	decodeResponse(t, rr, &resp)
+
+	feed, err := setup.DB.VoicemailFeeds.GetByDID(context.Background(), did.ID)
+	if err != nil {
+		t.Fatalf("Expected feed to be stored: %v", err)
+	}
+	if resp.FeedURL != "https://localhost/api/feeds/voicemail/"+feed.Token {
+		t.Errorf("Unexpected feed URL %s", resp.FeedURL)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/voicemail-boxes/999/feed", nil)
+	req = withURLParams(req, map[string]string{"didID": "999"})
+	rr = httptest.NewRecorder()
+	handler.CreateFeed(rr, req)
+
+	assertStatus(t, rr, http.StatusNotFound)
+}
+
+func TestVoicemailHandler_Feed(t *testing.T) {
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB}
+	handler := NewVoicemailHandler(deps)
+
+	// Voicemail boxes are keyed by DID, stored in the voicemail's user_id
+	user := createTestUser(t, setup.DB, "test@example.com", "password", "user")
+	did := createTestDID(t, setup.DB, "+15551234567")
+	if user.ID != did.ID {
+		t.Fatalf("Expected matching user and DID IDs, got %d and %d", user.ID, did.ID)
+	}
+	vm := createTestVoicemail(t, setup.DB, did.ID, "+15559876543")
+
+	feed, err := setup.DB.VoicemailFeeds.Rotate(context.Background(), did.ID, nil)
+	if err != nil {
+		t.Fatalf("Failed to create feed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/feeds/voicemail/"+feed.Token, nil)
+	req = withURLParams(req, map[string]string{"token": feed.Token})
+	rr := httptest.NewRecorder()
+	handler.Feed(rr, req)
+
+	assertStatus(t, rr, http.StatusOK)
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/rss+xml") {
+		t.Errorf("Expected RSS content type, got %s", ct)
+	}
+
+	var doc struct {
+		Items []struct {
+			Title       string `xml:"title"`
+			Description string `xml:"description"`
+			Enclosure   struct {
+				URL string `xml:"url,attr"`
+			} `xml:"enclosure"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Failed to parse feed: %v", err)
+	}
+	if len(doc.Items) != 1 {
+		t.Fatalf("Expected 1 item, got %d", len(doc.Items))
+	}
+	item := doc.Items[0]
+	if item.Title != "Voicemail from +15559876543 (0:30)" {
+		t.Errorf("Unexpected item title %q", item.Title)
+	}
+	if item.Description != vm.Transcript {
+		t.Errorf("Expected transcript as description, got %q", item.Description)
+	}
+	if want := fmt.Sprintf("https://localhost/api/feeds/voicemail/%s/%d.mp3", feed.Token, vm.ID); item.Enclosure.URL != want {
+		t.Errorf("Expected enclosure %s, got %s", want, item.Enclosure.URL)
+	}
+
+	fetched, _ := setup.DB.VoicemailFeeds.GetByDID(context.Background(), did.ID)
+	if fetched.LastFetchedAt == nil {
+		t.Error("Expected feed fetch to be recorded")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/feeds/voicemail/bogus", nil)
+	req = withURLParams(req, map[string]string{"token": "bogus"})
+	rr = httptest.NewRecorder()
+	handler.Feed(rr, req)
+
+	assertStatus(t, rr, http.StatusNotFound)
+}
+
+func TestVoicemailHandler_FeedAudio(t *testing.T) {
+	recording := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); ok {
+			t.Error("Expected credentials not to be sent to non-Twilio host")
+		}
+		if r.Header.Get("Range") != "bytes=0-3" {
+			t.Errorf("Expected Range header to be forwarded, got %q", r.Header.Get("Range"))
+		}
+		w.Header().Set("Content-Range", "bytes 0-3/10")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte("ID3\x03"))
+	}))
+	defer recording.Close()
+
+	setup := setupTestAPI(t)
+	deps := &Dependencies{DB: setup.DB}
+	handler := NewVoicemailHandler(deps)
+	ctx := context.Background()
+
+	createTestUser(t, setup.DB, "test@example.com", "password", "user")
+	did := createTestDID(t, setup.DB, "+15551234567")
+	setup.DB.Config.Set(ctx, "twilio_account_sid", "AC123")
+	setup.DB.Config.Set(ctx, "twilio_auth_token", "secret")
+
+	vm := &models.Voicemail{UserID: &did.ID, FromNumber: "+15559876543", AudioURL: recording.URL + "/RE123.mp3", Duration: 10}
+	if err := setup.DB.Voicemails.Create(ctx, vm); err != nil {
+		t.Fatalf("Failed to create voicemail: %v", err)
+	}
+	feed, err := setup.DB.VoicemailFeeds.Rotate(ctx, did.ID, nil)
+	if err != nil {
+		t.Fatalf("Failed to create feed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/feeds/voicemail/x/1.mp3", nil)
+	req.Header.Set("Range", "bytes=0-3")
+	req = withURLParams(req, map[string]string{"token": feed.Token, "file": fmt.Sprintf("%d.mp3", vm.ID)})
+	rr := httptest.NewRecorder()
+	handler.FeedAudio(rr, req)
+
+	assertStatus(t, rr, http.StatusPartialContent)
+	if rr.Header().Get("Content-Type") != "audio/mpeg" {
+		t.Errorf("Expected audio/mpeg, got %s", rr.Header().Get("Content-Type"))
+	}
+	if rr.Header().Get("Content-Range") != "bytes 0-3/10" {
+		t.Errorf("Expected Content-Range to be relayed, got %q", rr.Header().Get("Content-Range"))
+	}
+	if rr.Body.String() != "ID3\x03" {
+		t.Errorf("Unexpected body %q", rr.Body.String())
+	}
+
+	// A recording from another mailbox is not reachable through this feed
+	other := createTestDID(t, setup.DB, "+15557654321")
+	otherFeed, _ := setup.DB.VoicemailFeeds.Rotate(ctx, other.ID, nil)
+	req = httptest.NewRequest(http.MethodGet, "/api/feeds/voicemail/x/1.mp3", nil)
+	req = withURLParams(req, map[string]string{"token": otherFeed.Token, "file": fmt.Sprintf("%d.mp3", vm.ID)})
+	rr = httptest.NewRecorder()
+	handler.FeedAudio(rr, req)
+
+	assertStatus(t, rr, http.StatusNotFound)
+}
@@ -0,0 +1,288 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// VoicemailQuotaRequest sets the storage limits of a voicemail box
+type VoicemailQuotaRequest struct {
+	MaxMessages int    `json:"max_messages"` // 0 is unlimited
+	MaxMB       int    `json:"max_mb"`       // 0 is unlimited
+	WarnPercent int    `json:"warn_percent"` // Defaults to 80
+	Action      string `json:"action"`       // "reject" (default) or "delete_oldest"
+}
+
+// VoicemailQuotaResponse describes a voicemail box's quota and usage
+type VoicemailQuotaResponse struct {
+	DIDID       int64   `json:"did_id"`
+	MaxMessages int     `json:"max_messages"`
+	MaxMB       int     `json:"max_mb"`
+	WarnPercent int     `json:"warn_percent"`
+	Action      string  `json:"action"`
+	Messages    int     `json:"messages"`
+	UsedMB      float64 `json:"used_mb"`
+	PercentUsed int     `json:"percent_used"`
+	Full        bool    `json:"full"`
+	WarnedAt    *string `json:"warned_at,omitempty"`
+	UpdatedAt   string  `json:"updated_at"`
+}
+
+// GetQuota returns the quota and usage of a voicemail box
+func (h *VoicemailHandler) GetQuota(w http.ResponseWriter, r *http.Request) {
+	didID, err := strconv.ParseInt(chi.URLParam(r, "didID"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid DID ID", nil)
+		return
+	}
+
+	quota, err := h.deps.DB.VoicemailQuotas.Get(r.Context(), didID)
+	if err != nil {
+		if errors.Is(err, db.ErrVoicemailQuotaNotFound) {
+			WriteNotFoundError(w, "Voicemail quota")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	usage, err := h.deps.DB.Voicemails.Usage(r.Context(), didID)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, toQuotaResponse(quota, usage))
+}
+
+// UpdateQuota sets the quota of a voicemail box. A box already past a
+// delete-oldest quota is trimmed straight away.
+func (h *VoicemailHandler) UpdateQuota(w http.ResponseWriter, r *http.Request) {
+	didID, err := strconv.ParseInt(chi.URLParam(r, "didID"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid DID ID", nil)
+		return
+	}
+
+	if _, err := h.deps.DB.DIDs.GetByID(r.Context(), didID); err != nil {
+		if err == db.ErrDIDNotFound {
+			WriteNotFoundError(w, "DID")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	var req VoicemailQuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteValidationError(w, "Invalid request body", nil)
+		return
+	}
+	if req.WarnPercent == 0 {
+		req.WarnPercent = config.VoicemailQuotaWarnPercent
+	}
+	if req.Action == "" {
+		req.Action = db.QuotaActionReject
+	}
+	if errs := validateVoicemailQuota(req); len(errs) > 0 {
+		WriteValidationError(w, "Validation failed", errs)
+		return
+	}
+
+	quota := &models.VoicemailQuota{
+		DIDID:       didID,
+		MaxMessages: req.MaxMessages,
+		MaxMB:       req.MaxMB,
+		WarnPercent: req.WarnPercent,
+		Action:      req.Action,
+	}
+	if err := h.deps.DB.VoicemailQuotas.Save(r.Context(), quota); err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	enforceVoicemailQuota(r.Context(), h.deps, didID, 0)
+	checkVoicemailQuotaWarning(r.Context(), h.deps, didID)
+
+	h.GetQuota(w, r)
+}
+
+// DeleteQuota removes the quota of a voicemail box, leaving it unlimited
+func (h *VoicemailHandler) DeleteQuota(w http.ResponseWriter, r *http.Request) {
+	didID, err := strconv.ParseInt(chi.URLParam(r, "didID"), 10, 64)
+	if err != nil {
+		WriteValidationError(w, "Invalid DID ID", nil)
+		return
+	}
+
+	if err := h.deps.DB.VoicemailQuotas.Delete(r.Context(), didID); err != nil {
+		if errors.Is(err, db.ErrVoicemailQuotaNotFound) {
+			WriteNotFoundError(w, "Voicemail quota")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Voicemail quota removed"})
+}
+
+// validateVoicemailQuota checks a quota's limits, warning level and action
+func validateVoicemailQuota(req VoicemailQuotaRequest) []FieldError {
+	var errs []FieldError
+	if req.MaxMessages < 0 {
+		errs = append(errs, FieldError{Field: "max_messages", Message: "Message limit cannot be negative"})
+	}
+	if req.MaxMB < 0 {
+		errs = append(errs, FieldError{Field: "max_mb", Message: "Storage limit cannot be negative"})
+	}
+	if req.WarnPercent < 1 || req.WarnPercent > 100 {
+		errs = append(errs, FieldError{Field: "warn_percent", Message: "Warning level must be between 1 and 100"})
+	}
+	if req.Action != db.QuotaActionReject && req.Action != db.QuotaActionDeleteOldest {
+		errs = append(errs, FieldError{Field: "action", Message: "Action must be reject or delete_oldest"})
+	}
+	return errs
+}
+
+func toQuotaResponse(quota *models.VoicemailQuota, usage models.VoicemailUsage) *VoicemailQuotaResponse {
+	resp := &VoicemailQuotaResponse{
+		DIDID:       quota.DIDID,
+		MaxMessages: quota.MaxMessages,
+		MaxMB:       quota.MaxMB,
+		WarnPercent: quota.WarnPercent,
+		Action:      quota.Action,
+		Messages:    usage.Messages,
+		UsedMB:      float64(usage.Bytes*100/(1<<20)) / 100,
+		PercentUsed: quotaPercent(quota, usage),
+		Full:        quotaFull(quota, usage),
+		UpdatedAt:   quota.UpdatedAt.Format(time.RFC3339),
+	}
+	if quota.WarnedAt != nil {
+		warned := quota.WarnedAt.Format(time.RFC3339)
+		resp.WarnedAt = &warned
+	}
+	return resp
+}
+
+// quotaFull reports whether a mailbox has no room for another message
+func quotaFull(quota *models.VoicemailQuota, usage models.VoicemailUsage) bool {
+	return (quota.MaxMessages > 0 && usage.Messages >= quota.MaxMessages) ||
+		(quota.MaxMB > 0 && usage.Bytes >= int64(quota.MaxMB)<<20)
+}
+
+// quotaExceeded reports whether a mailbox holds more than its quota allows
+func quotaExceeded(quota *models.VoicemailQuota, usage models.VoicemailUsage) bool {
+	return (quota.MaxMessages > 0 && usage.Messages > quota.MaxMessages) ||
+		(quota.MaxMB > 0 && usage.Bytes > int64(quota.MaxMB)<<20)
+}
+
+// quotaPercent returns how full a mailbox is, by whichever limit is closer
+func quotaPercent(quota *models.VoicemailQuota, usage models.VoicemailUsage) int {
+	percent := 0
+	if quota.MaxMessages > 0 {
+		percent = usage.Messages * 100 / quota.MaxMessages
+	}
+	if quota.MaxMB > 0 {
+		if p := int(usage.Bytes * 100 / (int64(quota.MaxMB) << 20)); p > percent {
+			percent = p
+		}
+	}
+	return percent
+}
+
+// voicemailBoxFull reports whether callers to a mailbox should be told it is
+// full instead of leaving a message. Only reject quotas turn callers away.
+func voicemailBoxFull(ctx context.Context, deps *Dependencies, didID int64) bool {
+	quota, err := deps.DB.VoicemailQuotas.Get(ctx, didID)
+	if err != nil || quota.Action != db.QuotaActionReject {
+		return false
+	}
+	usage, err := deps.DB.Voicemails.Usage(ctx, didID)
+	if err != nil {
+		slog.Warn("Failed to check voicemail usage", "error", err, "did_id", didID)
+		return false
+	}
+	return quotaFull(quota, usage)
+}
+
+// enforceVoicemailQuota deletes the oldest messages of a mailbox over a
+// delete-oldest quota until it fits again, sparing the message keepID
+func enforceVoicemailQuota(ctx context.Context, deps *Dependencies, didID, keepID int64) {
+	quota, err := deps.DB.VoicemailQuotas.Get(ctx, didID)
+	if err != nil || quota.Action != db.QuotaActionDeleteOldest {
+		return
+	}
+	usage, err := deps.DB.Voicemails.Usage(ctx, didID)
+	if err != nil || !quotaExceeded(quota, usage) {
+		return
+	}
+
+	oldest, err := deps.DB.Voicemails.ListOldest(ctx, didID, usage.Messages)
+	if err != nil {
+		slog.Error("Failed to list voicemails over quota", "error", err, "did_id", didID)
+		return
+	}
+	for _, vm := range oldest {
+		if !quotaExceeded(quota, usage) {
+			break
+		}
+		if vm.ID == keepID {
+			continue
+		}
+		if err := deps.DB.Voicemails.Delete(ctx, vm.ID); err != nil {
+			slog.Error("Failed to delete voicemail over quota", "error", err, "id", vm.ID)
+			return
+		}
+		if err := removeVoicemailAudio(deps, vm); err != nil {
+			slog.Warn("Failed to delete voicemail audio", "error", err, "id", vm.ID)
+		}
+		usage.Messages--
+		usage.Bytes -= vm.SizeBytes
+		slog.Info("Deleted oldest voicemail to stay within quota", "id", vm.ID, "did_id", didID)
+	}
+}
+
+// checkVoicemailQuotaWarning warns once when a mailbox reaches its warning
+// level, and re-arms the warning once usage drops back below it
+func checkVoicemailQuotaWarning(ctx context.Context, deps *Dependencies, didID int64) {
+	quota, err := deps.DB.VoicemailQuotas.Get(ctx, didID)
+	if err != nil {
+		return
+	}
+	usage, err := deps.DB.Voicemails.Usage(ctx, didID)
+	if err != nil {
+		return
+	}
+
+	percent := quotaPercent(quota, usage)
+	switch {
+	case percent >= quota.WarnPercent && quota.WarnedAt == nil:
+		now := time.Now()
+		if err := deps.DB.VoicemailQuotas.SetWarned(ctx, didID, &now); err != nil {
+			slog.Error("Failed to record voicemail quota warning", "error", err, "did_id", didID)
+			return
+		}
+		did, err := deps.DB.DIDs.GetByID(ctx, didID)
+		if err != nil || deps.Notifier == nil {
+			return
+		}
+		if err := deps.Notifier.SendVoicemailQuotaWarning(did, quota, usage, percent); err != nil {
+			slog.Warn("Failed to send voicemail quota warning", "error", err, "did_id", didID)
+		}
+	case percent < quota.WarnPercent && quota.WarnedAt != nil:
+		if err := deps.DB.VoicemailQuotas.SetWarned(ctx, didID, nil); err != nil {
+			slog.Error("Failed to clear voicemail quota warning", "error", err, "did_id", didID)
+		}
+	}
+}
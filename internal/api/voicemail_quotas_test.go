@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestVoicemailHandler_UpdateQuota(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewVoicemailHandler(&Dependencies{DB: setup.DB})
+
+	// Voicemail boxes are keyed by DID, stored in the voicemail's user_id
+	createTestUser(t, setup.DB, "test@example.com", "password", "user")
+	did := createTestDID(t, setup.DB, "+15551234567")
+	createTestVoicemail(t, setup.DB, did.ID, "+15559876543")
+	params := map[string]string{"didID": fmt.Sprint(did.ID)}
+
+	tests := []struct {
+		name  string
+		body  string
+		field string
+	}{
+		{"negative limit", `{"max_messages": -1}`, "max_messages"},
+		{"warning level", `{"max_mb": 10, "warn_percent": 150}`, "warn_percent"},
+		{"action", `{"max_messages": 5, "action": "archive"}`, "action"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/api/voicemail-boxes/1/quota", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			handler.UpdateQuota(rr, withURLParams(req, params))
+
+			assertStatus(t, rr, http.StatusBadRequest)
+			if !strings.Contains(rr.Body.String(), tt.field) {
+				t.Errorf("Expected an error on %s, got %s", tt.field, rr.Body.String())
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/voicemail-boxes/1/quota", strings.NewReader(`{"max_messages": 4}`))
+	rr := httptest.NewRecorder()
+	handler.UpdateQuota(rr, withURLParams(req, params))
+	assertStatus(t, rr, http.StatusOK)
+
+	var resp VoicemailQuotaResponse
+	decodeResponse(t, rr, &resp)
+	if resp.Action != db.QuotaActionReject || resp.WarnPercent != 80 {
+		t.Errorf("Expected reject at 80%% by default, got %s at %d%%", resp.Action, resp.WarnPercent)
+	}
+	if resp.Messages != 1 || resp.PercentUsed != 25 || resp.Full {
+		t.Errorf("Unexpected usage %+v", resp)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/voicemail-boxes/1/quota", nil)
+	rr = httptest.NewRecorder()
+	handler.DeleteQuota(rr, withURLParams(req, params))
+	assertStatus(t, rr, http.StatusOK)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/voicemail-boxes/1/quota", nil)
+	rr = httptest.NewRecorder()
+	handler.GetQuota(rr, withURLParams(req, params))
+	assertStatus(t, rr, http.StatusNotFound)
+}
+
+func TestWebhookHandler_VoicemailTwiML_BoxFull(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+	ctx := context.Background()
+
+	createTestUser(t, setup.DB, "test@example.com", "password", "user")
+	did := createTestDID(t, setup.DB, "+15551234567")
+	createTestVoicemail(t, setup.DB, did.ID, "+15559876543")
+
+	quota := &models.VoicemailQuota{DIDID: did.ID, MaxMessages: 1, WarnPercent: 80, Action: db.QuotaActionReject}
+	if err := setup.DB.VoicemailQuotas.Save(ctx, quota); err != nil {
+		t.Fatalf("Failed to save quota: %v", err)
+	}
+
+	twiml := handler.voicemailTwiML(did, "+15559876543")
+	if strings.Contains(twiml, "<Record") || !strings.Contains(twiml, "The mailbox is full") {
+		t.Errorf("Expected the caller to be told the mailbox is full, got %s", twiml)
+	}
+
+	// A delete-oldest box always takes the message
+	quota.Action = db.QuotaActionDeleteOldest
+	if err := setup.DB.VoicemailQuotas.Save(ctx, quota); err != nil {
+		t.Fatalf("Failed to save quota: %v", err)
+	}
+	if twiml := handler.voicemailTwiML(did, "+15559876543"); !strings.Contains(twiml, "<Record") {
+		t.Errorf("Expected the message to be recorded, got %s", twiml)
+	}
+}
+
+func TestWebhookHandler_VoicemailRecording_Quota(t *testing.T) {
+	setup := setupTestAPI(t)
+	var warnings []int
+	notifier := &MockNotifier{
+		SendQuotaWarningFunc: func(did *models.DID, quota *models.VoicemailQuota, usage models.VoicemailUsage, percent int) error {
+			warnings = append(warnings, percent)
+			return nil
+		},
+	}
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB, Notifier: notifier})
+	ctx := context.Background()
+
+	createTestUser(t, setup.DB, "test@example.com", "password", "user")
+	did := createTestDID(t, setup.DB, "+15551234567")
+	oldest := createTestVoicemail(t, setup.DB, did.ID, "+15550000001")
+	createTestVoicemail(t, setup.DB, did.ID, "+15550000002")
+
+	quota := &models.VoicemailQuota{DIDID: did.ID, MaxMessages: 2, WarnPercent: 80, Action: db.QuotaActionDeleteOldest}
+	if err := setup.DB.VoicemailQuotas.Save(ctx, quota); err != nil {
+		t.Fatalf("Failed to save quota: %v", err)
+	}
+
+	record := func(from string) {
+		form := url.Values{
+			"RecordingUrl":      {"https://api.twilio.com/recording"},
+			"RecordingDuration": {"10"},
+			"From":              {from},
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/webhooks/voicemail/recording?DidId="+fmt.Sprint(did.ID), strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		handler.VoicemailRecording(rr, req)
+		assertStatus(t, rr, http.StatusOK)
+	}
+
+	record("+15550000003")
+	usage, err := setup.DB.Voicemails.Usage(ctx, did.ID)
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+	if usage.Messages != 2 || usage.Bytes != 10*4000 {
+		t.Errorf("Expected the box trimmed to 2 messages with the new one sized, got %+v", usage)
+	}
+	if _, err := setup.DB.Voicemails.GetByID(ctx, oldest.ID); err != db.ErrVoicemailNotFound {
+		t.Errorf("Expected the oldest voicemail to be deleted, got %v", err)
+	}
+
+	// The full box is warned about once
+	record("+15550000004")
+	if len(warnings) != 1 || warnings[0] != 100 {
+		t.Errorf("Expected one warning at 100%%, got %v", warnings)
+	}
+	quota, _ = setup.DB.VoicemailQuotas.Get(ctx, did.ID)
+	if quota.WarnedAt == nil {
+		t.Error("Expected the warning to be recorded")
+	}
+}
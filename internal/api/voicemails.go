@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+	"log/slog"
 	"net/http"
 	"strconv"
 
@@ -31,6 +33,7 @@ type VoicemailResponse struct {
 	IsRead          bool    `json:"is_read"`
 	CreatedAt       string  `json:"created_at"`
 	TwilioRecordingSID string `json:"twilio_recording_sid,omitempty"`
+	AssignedTo      *int64  `json:"assigned_to,omitempty"` // User following up on the voicemail
 }
 
 // List returns voicemails with filtering and pagination
@@ -39,6 +42,8 @@ func (h *VoicemailHandler) List(w http.ResponseWriter, r *http.Request) {
 	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
 	didIDStr := r.URL.Query().Get("did_id")
 	unreadOnly := r.URL.Query().Get("unread") == "true"
+	assignedToMe := r.URL.Query().Get("assigned") == "me"
+	userID := getUserIDFromContext(r.Context())
 
 	if limit == 0 {
 		limit = config.DefaultPageSize
@@ -52,30 +57,36 @@ func (h *VoicemailHandler) List(w http.ResponseWriter, r *http.Request) {
 	var total int
 
 	// Handle filtering
-	if unreadOnly {
-		var userID *int64
+	if assignedToMe {
+		voicemails, err = h.deps.DB.VoicemailBoxes.ListAssigned(r.Context(), userID)
+		total = len(voicemails)
+		voicemails = paginateVoicemails(voicemails, limit, offset)
+	} else if unreadOnly {
+		var boxID *int64
 		if didIDStr != "" {
 			uid, parseErr := strconv.ParseInt(didIDStr, 10, 64)
 			if parseErr == nil {
-				userID = &uid
+				boxID = &uid
 			}
 		}
-		voicemails, err = h.deps.DB.Voicemails.ListUnread(r.Context(), userID)
+		// Members of a shared box see what they haven't read themselves
+		member := false
+		if boxID != nil && userID > 0 {
+			member, _ = h.deps.DB.VoicemailBoxes.IsMember(r.Context(), *boxID, userID)
+		}
+		if member {
+			voicemails, err = h.deps.DB.VoicemailBoxes.ListUnread(r.Context(), *boxID, userID)
+		} else {
+			voicemails, err = h.deps.DB.Voicemails.ListUnread(r.Context(), boxID)
+			voicemails = h.dropReadByUser(r.Context(), userID, voicemails)
+		}
 		if err != nil {
 			WriteInternalError(w)
 			return
 		}
 		total = len(voicemails)
 		// Apply manual pagination to unread list
-		end := offset + limit
-		if end > len(voicemails) {
-			end = len(voicemails)
-		}
-		if offset < len(voicemails) {
-			voicemails = voicemails[offset:end]
-		} else {
-			voicemails = nil
-		}
+		voicemails = paginateVoicemails(voicemails, limit, offset)
 	} else if didIDStr != "" {
 		userID, parseErr := strconv.ParseInt(didIDStr, 10, 64)
 		if parseErr == nil {
@@ -101,10 +112,7 @@ func (h *VoicemailHandler) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var response []*VoicemailResponse
-	for _, v := range voicemails {
-		response = append(response, toVoicemailResponse(v))
-	}
+	response := h.toVoicemailResponses(r.Context(), userID, voicemails)
 
 	WriteList(w, response, total, limit, offset)
 }
@@ -127,7 +135,8 @@ func (h *VoicemailHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, toVoicemailResponse(voicemail))
+	userID := getUserIDFromContext(r.Context())
+	WriteJSON(w, http.StatusOK, h.toVoicemailResponses(r.Context(), userID, []*models.Voicemail{voicemail})[0])
 }
 
 // MarkRead marks a voicemail as read
@@ -149,7 +158,14 @@ func (h *VoicemailHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.deps.DB.Voicemails.MarkAsRead(r.Context(), id); err != nil {
+	// Members of a shared box each read it themselves. It counts as read
+	// once all of them have.
+	if userID := getUserIDFromContext(r.Context()); h.isBoxMember(r.Context(), voicemail, userID) {
+		err = h.markReadByMember(r.Context(), voicemail, userID)
+	} else {
+		err = h.deps.DB.Voicemails.MarkAsRead(r.Context(), id)
+	}
+	if err != nil {
 		if err == db.ErrVoicemailNotFound {
 			WriteNotFoundError(w, "Voicemail")
 			return
@@ -161,7 +177,7 @@ func (h *VoicemailHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
 	// Trigger MWI notification
 	if voicemail.UserID != nil {
 		mwiNotifier := NewMWINotifier(h.deps)
-		go mwiNotifier.UpdateMWIForDID(r.Context(), *voicemail.UserID)
+		go mwiNotifier.UpdateMWIForDID(context.Background(), *voicemail.UserID)
 	}
 
 	WriteJSON(w, http.StatusOK, map[string]string{"message": "Voicemail marked as read"})
@@ -190,11 +206,15 @@ func (h *VoicemailHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		WriteInternalError(w)
 		return
 	}
+	if err := removeVoicemailAudio(h.deps, voicemail); err != nil {
+		slog.Warn("Failed to delete voicemail audio", "error", err, "id", id)
+	}
 
 	// Trigger MWI notification
 	if voicemail.UserID != nil {
+		checkVoicemailQuotaWarning(r.Context(), h.deps, *voicemail.UserID)
 		mwiNotifier := NewMWINotifier(h.deps)
-		go mwiNotifier.UpdateMWIForDID(r.Context(), *voicemail.UserID)
+		go mwiNotifier.UpdateMWIForDID(context.Background(), *voicemail.UserID)
 	}
 
 	WriteJSON(w, http.StatusOK, map[string]string{"message": "Voicemail deleted successfully"})
@@ -219,10 +239,8 @@ func (h *VoicemailHandler) ListUnread(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var response []*VoicemailResponse
-	for _, v := range voicemails {
-		response = append(response, toVoicemailResponse(v))
-	}
+	userID := getUserIDFromContext(r.Context())
+	response := h.toVoicemailResponses(r.Context(), userID, h.dropReadByUser(r.Context(), userID, voicemails))
 
 	WriteJSON(w, http.StatusOK, map[string]interface{}{"data": response})
 }
@@ -232,6 +250,18 @@ func (h *VoicemailHandler) MarkAsRead(w http.ResponseWriter, r *http.Request) {
 	h.MarkRead(w, r)
 }
 
+// paginateVoicemails returns one page of voicemails
+func paginateVoicemails(voicemails []*models.Voicemail, limit, offset int) []*models.Voicemail {
+	end := offset + limit
+	if end > len(voicemails) {
+		end = len(voicemails)
+	}
+	if offset < len(voicemails) {
+		return voicemails[offset:end]
+	}
+	return nil
+}
+
 func toVoicemailResponse(v *models.Voicemail) *VoicemailResponse {
 	var didID int64
 	if v.UserID != nil {
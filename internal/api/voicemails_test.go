@@ -4,7 +4,13 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/pkg/sip"
 )
 
 func TestVoicemailHandler_List(t *testing.T) {
@@ -336,3 +342,49 @@ func TestVoicemailResponse_Format(t *testing.T) {
 		t.Errorf("Expected is_read %v, got %v", vm.IsRead, resp.IsRead)
 	}
 }
+
+func TestVoicemailHandler_Audio(t *testing.T) {
+	setup := setupTestAPI(t)
+	cfg := &config.Config{DataDir: t.TempDir()}
+	handler := NewVoicemailHandler(&Dependencies{DB: setup.DB, Config: cfg})
+	ctx := context.Background()
+
+	user := createTestUser(t, setup.DB, "test@example.com", "password", "user")
+	twilio := createTestVoicemail(t, setup.DB, user.ID, "+15559876543")
+	local := createTestVoicemail(t, setup.DB, user.ID, "+15559876543")
+	local.AudioURL = sip.VoicemailURL(local.ID)
+	if err := setup.DB.Voicemails.Update(ctx, local); err != nil {
+		t.Fatalf("Failed to update voicemail: %v", err)
+	}
+	os.MkdirAll(cfg.VoicemailsPath(), 0o750)
+	path := filepath.Join(cfg.VoicemailsPath(), sip.VoicemailFile(local.ID))
+	if err := os.WriteFile(path, []byte("RIFF-audio"), 0o600); err != nil {
+		t.Fatalf("Failed to write audio: %v", err)
+	}
+
+	get := func(id int64) *httptest.ResponseRecorder {
+		idStr := strconv.FormatInt(id, 10)
+		req := withURLParams(httptest.NewRequest(http.MethodGet, "/api/voicemails/"+idStr+"/audio", nil), map[string]string{"id": idStr})
+		rr := httptest.NewRecorder()
+		handler.Audio(rr, req)
+		return rr
+	}
+
+	rr := get(local.ID)
+	assertStatus(t, rr, http.StatusOK)
+	if rr.Body.String() != "RIFF-audio" || rr.Header().Get("Content-Type") != "audio/wav" {
+		t.Errorf("Expected the stored WAV file, got %q (%s)", rr.Body.String(), rr.Header().Get("Content-Type"))
+	}
+	// Voicemail recorded by Twilio is played from Twilio
+	assertStatus(t, get(twilio.ID), http.StatusNotFound)
+
+	// Deleting a voicemail deletes its audio
+	idStr := strconv.FormatInt(local.ID, 10)
+	req := withURLParams(httptest.NewRequest(http.MethodDelete, "/api/voicemails/"+idStr, nil), map[string]string{"id": idStr})
+	rr = httptest.NewRecorder()
+	handler.Delete(rr, req)
+	assertStatus(t, rr, http.StatusOK)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the audio deleted, got %v", err)
+	}
+}
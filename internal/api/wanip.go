@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+)
+
+// WANIPHandler reports and checks the public IP address
+type WANIPHandler struct {
+	deps *Dependencies
+}
+
+// NewWANIPHandler creates a new WANIPHandler
+func NewWANIPHandler(deps *Dependencies) *WANIPHandler {
+	return &WANIPHandler{deps: deps}
+}
+
+// Get returns the public address and the outcome of the last check (admin only)
+func (h *WANIPHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if h.deps.WANIP == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Public IP monitoring is not available", nil)
+		return
+	}
+	WriteJSON(w, http.StatusOK, h.deps.WANIP.Status())
+}
+
+// Check looks the public address up now, updating dynamic DNS and Twilio
+// if it changed (admin only)
+func (h *WANIPHandler) Check(w http.ResponseWriter, r *http.Request) {
+	if h.deps.WANIP == nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Public IP monitoring is not available", nil)
+		return
+	}
+	status, err := h.deps.WANIP.Check(r.Context())
+	if err != nil {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, "Public IP lookup failed: "+err.Error(), nil)
+		return
+	}
+	WriteJSON(w, http.StatusOK, status)
+}
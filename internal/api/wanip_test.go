@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/wanip"
+)
+
+func TestWANIPHandler_Get(t *testing.T) {
+	setup := setupTestAPI(t)
+	cfg := &config.Config{ExternalIP: "203.0.113.10", WANIP: &config.WANIPConfig{Detect: true}}
+	handler := NewWANIPHandler(&Dependencies{WANIP: wanip.NewMonitor(cfg, setup.DB, nil, nil)})
+
+	rr := httptest.NewRecorder()
+	handler.Get(rr, httptest.NewRequest(http.MethodGet, "/api/system/wan-ip", nil))
+	assertStatus(t, rr, http.StatusOK)
+
+	var status wanip.Status
+	if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if status.IP != "203.0.113.10" || !status.Detect || status.CheckedAt != nil {
+		t.Errorf("Expected the configured address before any check, got %+v", status)
+	}
+}
+
+func TestWANIPHandler_NotAvailable(t *testing.T) {
+	handler := NewWANIPHandler(&Dependencies{})
+
+	rr := httptest.NewRecorder()
+	handler.Check(rr, httptest.NewRequest(http.MethodPost, "/api/system/wan-ip/check", nil))
+	assertStatus(t, rr, http.StatusServiceUnavailable)
+	assertErrorCode(t, rr, ErrCodeServiceUnavailable)
+}
@@ -7,6 +7,8 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"io"
+	"log/slog"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"sort"
@@ -14,7 +16,17 @@ import (
 	"strings"
 	"time"
 
+	"github.com/btafoya/gosip/internal/channels"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/i18n"
 	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/oncall"
+	"github.com/btafoya/gosip/internal/publicurl"
+	"github.com/btafoya/gosip/internal/rules"
+	"github.com/btafoya/gosip/internal/twilio"
+	"github.com/btafoya/gosip/pkg/sip"
 )
 
 // WebhookHandler handles Twilio webhook callbacks
@@ -47,7 +59,7 @@ func (h *WebhookHandler) VoiceIncoming(w http.ResponseWriter, r *http.Request) {
 	// Check blocklist
 	isBlocked, _, err := h.deps.DB.Blocklist.IsBlocked(r.Context(), from)
 	if err == nil && isBlocked {
-		h.respondTwiML(w, h.rejectTwiML("blocked"))
+		h.respondTwiML(w, h.rejectTwiML(callSID, h.blocklistReject(r.Context())))
 		return
 	}
 
@@ -58,25 +70,215 @@ func (h *WebhookHandler) VoiceIncoming(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Apply the DID's anonymous caller policy
+	if rules.IsAnonymousCaller(from) {
+		switch did.AnonymousAction {
+		case db.AnonymousActionReject:
+			h.respondTwiML(w, h.rejectTwiML(callSID, rules.ParseRejectAction(nil)))
+			return
+		case db.AnonymousActionChallenge:
+			h.respondTwiML(w, h.challengeTwiML(r.Context(), did))
+			return
+		}
+	}
+
+	h.recordInboundCall(r.Context(), did, from, callSID, r.FormValue("ForwardedFrom"))
+
+	h.respondTwiML(w, h.routeCall(r.Context(), did, from, callSID, ""))
+}
+
+// recordInboundCall creates the CDR for a new inbound call. Twilio passes
+// ForwardedFrom when the carrier diverted the call to the DID, which starts
+// the diversion chain. Retried webhooks for the same CallSid are ignored.
+func (h *WebhookHandler) recordInboundCall(ctx context.Context, did *models.DID, from, callSID, forwardedFrom string) {
+	if callSID == "" {
+		return
+	}
+	if _, err := h.deps.DB.CDRs.GetByCallSID(ctx, callSID); err == nil {
+		return
+	}
+
+	didID := did.ID
+	cdr := &models.CDR{
+		CallSID:     callSID,
+		Direction:   "inbound",
+		FromNumber:  from,
+		ToNumber:    did.Number,
+		DIDID:       &didID,
+		StartedAt:   time.Now(),
+		Disposition: "missed",
+	}
+	if forwardedFrom != "" && forwardedFrom != did.Number {
+		cdr.DiversionChain, _ = json.Marshal([]string{forwardedFrom, did.Number})
+	}
+	h.deps.DB.CDRs.Create(ctx, cdr)
+}
+
+// recordDiversion appends a forwarding target to the call's diversion chain
+func (h *WebhookHandler) recordDiversion(ctx context.Context, callSID string, did *models.DID, target string) {
+	cdr, err := h.deps.DB.CDRs.GetByCallSID(ctx, callSID)
+	if err != nil {
+		return
+	}
+
+	var chain []string
+	if len(cdr.DiversionChain) > 0 {
+		json.Unmarshal(cdr.DiversionChain, &chain)
+	}
+	if len(chain) == 0 {
+		chain = []string{did.Number}
+	}
+	chain = append(chain, target)
+
+	cdr.DiversionChain, _ = json.Marshal(chain)
+	h.deps.DB.CDRs.Update(ctx, cdr)
+}
+
+// VoiceScreen handles the recorded name from an anonymous caller challenge
+// and rings the DID's route with the recording played to the callee as a whisper
+func (h *WebhookHandler) VoiceScreen(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.respondTwiML(w, h.errorTwiML("Invalid request"))
+		return
+	}
+
+	if !h.validateSignature(r) {
+		h.respondTwiML(w, h.errorTwiML("Invalid signature"))
+		return
+	}
+
+	from := r.FormValue("From")
+	callSID := r.FormValue("CallSid")
+	recordingURL := r.FormValue("RecordingUrl")
+	duration, _ := strconv.Atoi(r.FormValue("RecordingDuration"))
+
+	didID, _ := strconv.ParseInt(r.URL.Query().Get("DidId"), 10, 64)
+	did, err := h.deps.DB.DIDs.GetByID(r.Context(), didID)
+	if err != nil {
+		h.respondTwiML(w, h.errorTwiML("Number not found"))
+		return
+	}
+	lang := h.callLanguage(r.Context(), did)
+
+	// Callers who stay silent are not put through
+	if recordingURL == "" || duration == 0 {
+		h.respondTwiML(w, `<Response>`+sayTwiML(lang, i18n.Prompt(lang, i18n.PromptNoResponse))+`<Hangup/></Response>`)
+		return
+	}
+
+	whisperURL := "/api/webhooks/voice/whisper?RecordingUrl=" + url.QueryEscape(recordingURL) + "&DidId=" + strconv.FormatInt(did.ID, 10)
+	h.respondTwiML(w, h.routeCall(r.Context(), did, from, callSID, whisperURL))
+}
+
+// VoiceWhisper plays an anonymous caller's recorded name to the callee before the call is bridged
+func (h *WebhookHandler) VoiceWhisper(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || !h.validateSignature(r) {
+		h.respondTwiML(w, `<Response/>`)
+		return
+	}
+
+	recordingURL := r.URL.Query().Get("RecordingUrl")
+	if recordingURL == "" {
+		h.respondTwiML(w, `<Response/>`)
+		return
+	}
+
+	lang := i18n.DefaultLanguage
+	didID, _ := strconv.ParseInt(r.URL.Query().Get("DidId"), 10, 64)
+	if did, err := h.deps.DB.DIDs.GetByID(r.Context(), didID); err == nil {
+		lang = h.callLanguage(r.Context(), did)
+	}
+
+	h.respondTwiML(w, `<Response>`+sayTwiML(lang, i18n.Prompt(lang, i18n.PromptAnonymousCallFrom))+`<Play>`+escapeXML(recordingURL)+`</Play></Response>`)
+}
+
+// routeCall evaluates the DID's routes and returns the TwiML for the first match.
+// A non-empty whisperURL is attached to every dialed leg.
+func (h *WebhookHandler) routeCall(ctx context.Context, did *models.DID, from, callSID, whisperURL string) string {
+	route := h.matchRoute(ctx, did, from)
+	if route == nil {
+		// No matching rule, go to voicemail
+		return h.voicemailTwiML(did, from)
+	}
+	return h.executeAction(route, did, from, callSID, whisperURL)
+}
+
+// matchRoute returns the first of the DID's routes matching a call, or nil
+// when the call goes to voicemail
+func (h *WebhookHandler) matchRoute(ctx context.Context, did *models.DID, from string) *models.Route {
 	// Get routing rules for this DID
-	routes, err := h.deps.DB.Routes.GetEnabledByDID(r.Context(), did.ID)
+	routes, err := h.deps.DB.Routes.GetEnabledByDID(ctx, did.ID)
 	if err != nil || len(routes) == 0 {
-		// Default: send to voicemail
-		h.respondTwiML(w, h.voicemailTwiML(did.ID, from))
-		return
+		return nil
 	}
 
 	// Evaluate rules in priority order
+	now := time.Now()
+	loc := h.scheduleLocation(ctx, did)
 	for _, route := range routes {
-		if h.evaluateCondition(route, from) {
-			twiml := h.executeAction(route, did, from, callSID)
-			h.respondTwiML(w, twiml)
-			return
+		if route.ConditionType == "webhook" {
+			// The webhook may reject the call or send it to another route
+			route = rules.MatchWebhookCondition(ctx, h.deps.DB.Routes, route, rules.WebhookRequest{
+				CallerID:     from,
+				CalledNumber: did.Number,
+				DIDID:        did.ID,
+				Time:         now,
+			})
+			if route == nil {
+				continue
+			}
+		} else if !h.evaluateCondition(ctx, route, from, now, loc) {
+			continue
 		}
+
+		// Split routes hand the call to one of their targets
+		if route.ActionType == "split" {
+			target, _, err := rules.ResolveSplit(ctx, h.deps.DB.RouteSplits, route, rand.Intn(100))
+			if err != nil {
+				slog.Warn("Failed to split call", "route_id", route.ID, "error", err)
+				continue
+			}
+			route = target
+		}
+		// Busy devices without call waiting fall through to later routes
+		if rules.AllDevicesBusy(route, func(deviceID int64) bool { return h.deviceBusy(ctx, deviceID) }) {
+			continue
+		}
+		return route
+	}
+	return nil
+}
+
+// VoiceOnCall handles the end of a dial to an on-call responder. Answered
+// calls are done; otherwise the call escalates to the next level.
+func (h *WebhookHandler) VoiceOnCall(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.respondTwiML(w, h.errorTwiML("Invalid request"))
+		return
+	}
+
+	if !h.validateSignature(r) {
+		h.respondTwiML(w, h.errorTwiML("Invalid signature"))
+		return
 	}
 
-	// No matching rule, go to voicemail
-	h.respondTwiML(w, h.voicemailTwiML(did.ID, from))
+	if r.FormValue("DialCallStatus") == "completed" {
+		h.respondTwiML(w, `<Response><Hangup/></Response>`)
+		return
+	}
+
+	query := r.URL.Query()
+	didID, _ := strconv.ParseInt(query.Get("DidId"), 10, 64)
+	did, err := h.deps.DB.DIDs.GetByID(r.Context(), didID)
+	if err != nil {
+		h.respondTwiML(w, h.errorTwiML("Number not found"))
+		return
+	}
+	scheduleID, _ := strconv.ParseInt(query.Get("ScheduleId"), 10, 64)
+	level, _ := strconv.Atoi(query.Get("Level"))
+	maxDuration, _ := strconv.Atoi(query.Get("MaxDuration"))
+
+	h.respondTwiML(w, h.onCallTwiML(r.Context(), did, r.FormValue("From"), r.FormValue("CallSid"), scheduleID, level, query.Get("WhisperUrl"), maxDuration))
 }
 
 // VoiceStatus handles voice call status callbacks
@@ -93,18 +295,51 @@ func (h *WebhookHandler) VoiceStatus(w http.ResponseWriter, r *http.Request) {
 	// Update CDR
 	cdr, err := h.deps.DB.CDRs.GetByCallSID(r.Context(), callSID)
 	if err == nil {
-		cdr.Disposition = status
+		if disposition := cdrDisposition(status); disposition != "" {
+			cdr.Disposition = disposition
+		}
 		cdr.Duration = duration
 		if status == "completed" || status == "busy" || status == "no-answer" || status == "failed" {
 			now := time.Now()
 			cdr.EndedAt = &now
 		}
 		h.deps.DB.CDRs.Update(r.Context(), cdr)
+		estimateCallCost(r.Context(), h.deps, cdr)
+	}
+
+	h.deps.Events.Publish(events.TypeCallStatus, map[string]interface{}{
+		"call_sid": callSID,
+		"status":   status,
+		"duration": duration,
+	})
+
+	// Callers left on hold too long go to voicemail once the phone hangs up
+	if r.FormValue("DialCallStatus") != "" && h.deps.SIP != nil && h.deps.SIP.TakeHoldDiversion(callSID) {
+		if did, err := h.deps.DB.DIDs.GetByNumber(r.Context(), r.FormValue("To")); err == nil {
+			h.respondTwiML(w, h.voicemailTwiML(did, r.FormValue("From")))
+			return
+		}
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// cdrDisposition maps a Twilio call status to a CDR disposition.
+// In-progress statuses return an empty string and leave the CDR unchanged.
+func cdrDisposition(status string) string {
+	switch status {
+	case "completed":
+		return "answered"
+	case "busy":
+		return "busy"
+	case "no-answer", "canceled":
+		return "missed"
+	case "failed":
+		return "failed"
+	}
+	return ""
+}
+
 // VoicemailRecording handles voicemail recording completion
 func (h *WebhookHandler) VoicemailRecording(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
@@ -127,11 +362,15 @@ func (h *WebhookHandler) VoicemailRecording(w http.ResponseWriter, r *http.Reque
 		Duration:   duration,
 		AudioURL:   recordingURL + ".mp3",
 		IsRead:     false,
+		SizeBytes:  int64(duration) * config.VoicemailBytesPerSecond,
 		CreatedAt:  time.Now(),
 	}
 	_ = recordingSID // Used by Twilio for transcription requests
 
-	h.deps.DB.Voicemails.Create(r.Context(), voicemail)
+	if err := h.deps.DB.Voicemails.Create(r.Context(), voicemail); err == nil {
+		enforceVoicemailQuota(r.Context(), h.deps, didID, voicemail.ID)
+		checkVoicemailQuotaWarning(r.Context(), h.deps, didID)
+	}
 
 	// Request transcription if enabled
 	if h.deps.Twilio != nil {
@@ -141,16 +380,24 @@ func (h *WebhookHandler) VoicemailRecording(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
+	h.voicemailReceived(voicemail)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// voicemailReceived announces a new voicemail, whether Twilio or GoSIP
+// recorded it
+func (h *WebhookHandler) voicemailReceived(voicemail *models.Voicemail) {
+	h.deps.Events.Publish(events.TypeVoicemailReceived, voicemail)
+
 	// Send notifications
 	go h.sendVoicemailNotification(voicemail)
 
 	// Trigger MWI notification for new voicemail
 	if voicemail.UserID != nil {
 		mwiNotifier := NewMWINotifier(h.deps)
-		go mwiNotifier.UpdateMWIForDID(r.Context(), *voicemail.UserID)
+		go mwiNotifier.UpdateMWIForDID(context.Background(), *voicemail.UserID)
 	}
-
-	w.WriteHeader(http.StatusOK)
 }
 
 // VoicemailTranscription handles transcription completion
@@ -188,14 +435,21 @@ func (h *WebhookHandler) SMSIncoming(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	from := r.FormValue("From")
-	to := r.FormValue("To")
+	channel, from := channels.ParseAddress(r.FormValue("From"))
+	_, to := channels.ParseAddress(r.FormValue("To"))
 	body := r.FormValue("Body")
 	messageSID := r.FormValue("MessageSid")
 	numMedia, _ := strconv.Atoi(r.FormValue("NumMedia"))
+	if channel == "" {
+		channel = channels.Default(numMedia > 0)
+	}
 
-	// Find DID
+	// Find DID. Messages to a Messaging Service pool number that isn't a DID
+	// belong to the DID sending through that service.
 	did, err := h.deps.DB.DIDs.GetByNumber(r.Context(), to)
+	if err == db.ErrDIDNotFound && r.FormValue("MessagingServiceSid") != "" {
+		did, err = h.deps.DB.DIDs.GetByMessagingServiceSID(r.Context(), r.FormValue("MessagingServiceSid"))
+	}
 	if err != nil {
 		h.respondTwiML(w, "")
 		return
@@ -224,9 +478,19 @@ func (h *WebhookHandler) SMSIncoming(w http.ResponseWriter, r *http.Request) {
 		Status:     "received",
 		MessageSID: messageSID,
 		CreatedAt:  time.Now(),
+		Channel:    channel,
 	}
 
 	h.deps.DB.Messages.Create(r.Context(), message)
+	h.deps.Events.Publish(events.TypeMessageReceived, message)
+	go h.deliverSMSToDevices(message)
+	go mirrorSMSToEmail(h.deps, message)
+
+	// Answers to appointment reminders are acknowledged instead of auto-replied to
+	if reply := h.reminderReply(r.Context(), did, from, body); reply != "" {
+		h.respondTwiML(w, h.smsTwiML(reply))
+		return
+	}
 
 	// Check for auto-reply
 	autoReply := h.checkAutoReply(r.Context(), did.ID, body)
@@ -251,10 +515,35 @@ func (h *WebhookHandler) SMSStatus(w http.ResponseWriter, r *http.Request) {
 	messageSID := r.FormValue("MessageSid")
 	status := r.FormValue("MessageStatus")
 
+	// Failed and undelivered messages come with the Twilio error code
+	var errorCode *int
+	if code, err := strconv.Atoi(r.FormValue("ErrorCode")); err == nil && code != 0 {
+		errorCode = &code
+	}
+
 	// Update message status by finding the message first
 	if msg, err := h.deps.DB.Messages.GetByMessageSID(r.Context(), messageSID); err == nil {
-		h.deps.DB.Messages.UpdateStatus(r.Context(), msg.ID, status)
+		// Messages sent through a Messaging Service report the pool number
+		// Twilio picked, which may differ from the DID's number
+		if _, from := channels.ParseAddress(r.FormValue("From")); from != "" && msg.Direction == "outbound" && from != msg.FromNumber {
+			msg.FromNumber = from
+			msg.Status = status
+			msg.ErrorCode, msg.ErrorMessage = errorCode, ""
+			h.deps.DB.Messages.Update(r.Context(), msg)
+		} else {
+			h.deps.DB.Messages.UpdateStatusWithError(r.Context(), msg.ID, status, errorCode, "")
+		}
+	}
+
+	event := map[string]interface{}{
+		"message_sid": messageSID,
+		"status":      status,
+	}
+	if errorCode != nil {
+		info, _ := twilio.LookupError(*errorCode)
+		event["error"] = info
 	}
+	h.deps.Events.Publish(events.TypeMessageStatus, event)
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -262,9 +551,8 @@ func (h *WebhookHandler) SMSStatus(w http.ResponseWriter, r *http.Request) {
 // Helper methods
 
 func (h *WebhookHandler) validateSignature(r *http.Request) bool {
-	// Get auth token from config
-	authToken, err := h.deps.DB.Config.Get(r.Context(), "twilio_auth_token")
-	if err != nil || authToken == "" {
+	_, authToken := twilioCredentials(r.Context(), h.deps)
+	if authToken == "" {
 		return false
 	}
 
@@ -273,13 +561,30 @@ func (h *WebhookHandler) validateSignature(r *http.Request) bool {
 		return false
 	}
 
-	// Build validation URL
+	// Twilio signs the URL it was configured with. Behind a reverse proxy
+	// that is the public base URL rather than the address the request
+	// arrived on, so try that first.
 	scheme := "https"
 	if r.TLS == nil {
 		scheme = "http"
 	}
-	validationURL := scheme + "://" + r.Host + r.URL.Path
+	requestURL := scheme + "://" + r.Host + r.URL.RequestURI()
+	if base := publicurl.Get(r.Context(), h.deps.Config, h.deps.DB); base != "" {
+		if twilioSignatureMatches(r, authToken, base+r.URL.RequestURI(), signature) {
+			return true
+		}
+		if !twilioSignatureMatches(r, authToken, requestURL, signature) {
+			return false
+		}
+		h.deps.PublicURL.ObserveWebhook(r.Context(), requestURL)
+		return true
+	}
+	return twilioSignatureMatches(r, authToken, requestURL, signature)
+}
 
+// twilioSignatureMatches reports whether a signature is Twilio's for a
+// request to validationURL
+func twilioSignatureMatches(r *http.Request, authToken, validationURL, signature string) bool {
 	// Sort form values and append to URL
 	r.ParseForm()
 	keys := make([]string, 0, len(r.PostForm))
@@ -311,35 +616,102 @@ func (h *WebhookHandler) errorTwiML(message string) string {
 	return `<Response><Say>` + message + `</Say><Hangup/></Response>`
 }
 
-func (h *WebhookHandler) rejectTwiML(reason string) string {
-	return `<Response><Reject reason="` + reason + `"/></Response>`
+// rejectTwiML turns a call away the way a reject action asks. Twilio only
+// passes on busy or rejected, so the SIP code and reason are logged.
+func (h *WebhookHandler) rejectTwiML(callSID string, action rules.RejectAction) string {
+	slog.Info("Rejecting call", "call_sid", callSID, "sip_code", action.SIPCode, "reason", action.ReasonHeader())
+	return `<Response><Reject reason="` + action.TwiMLReason() + `"/></Response>`
+}
+
+// blocklistReject returns how blocklisted callers are turned away
+func (h *WebhookHandler) blocklistReject(ctx context.Context) rules.RejectAction {
+	code, _ := strconv.Atoi(h.deps.DB.Config.GetWithDefault(ctx, "blocklist_reject_code", ""))
+	action := rules.ParseRejectAction(nil)
+	if _, ok := rules.RejectCodes[code]; ok {
+		action.SIPCode = code
+	}
+	action.Reason = "Blocked caller"
+	return action
+}
+
+// challengeTwiML asks an anonymous caller to record their name before the call is routed
+func (h *WebhookHandler) challengeTwiML(ctx context.Context, did *models.DID) string {
+	lang := h.callLanguage(ctx, did)
+
+	// A customised prompt replaces the shipped prompt set
+	prompt := h.deps.DB.Config.GetWithDefault(ctx, "anonymous_challenge_prompt", "")
+	if prompt == "" || prompt == i18n.Prompt(i18n.English, i18n.PromptAnonymousChallenge) {
+		prompt = i18n.Prompt(lang, i18n.PromptAnonymousChallenge)
+	}
+
+	actionURL := "/api/webhooks/voice/screen?DidId=" + strconv.FormatInt(did.ID, 10)
+
+	return `<Response>
+		` + sayTwiML(lang, prompt) + `
+		<Record maxLength="5" timeout="3" trim="trim-silence" playBeep="true" action="` + actionURL + `"/>
+		` + sayTwiML(lang, i18n.Prompt(lang, i18n.PromptNoResponse)) + `
+		<Hangup/>
+	</Response>`
 }
 
-func (h *WebhookHandler) voicemailTwiML(didID int64, from string) string {
-	greeting, _ := h.deps.DB.Config.Get(nil, "voicemail_greeting")
-	if greeting == "" {
-		greeting = "Please leave a message after the beep."
+func (h *WebhookHandler) voicemailTwiML(did *models.DID, from string) string {
+	ctx := context.Background()
+	lang := h.callLanguage(ctx, did)
+
+	if voicemailBoxFull(ctx, h.deps, did.ID) || storageLow(ctx, h.deps) {
+		return `<Response>
+		` + sayTwiML(lang, i18n.Prompt(lang, i18n.PromptVoicemailFull)) + `
+		<Hangup/>
+	</Response>`
+	}
+
+	// A recorded mailbox greeting takes precedence over the system greeting
+	prompt := ""
+	// Twilio can't fetch greetings uploaded to GoSIP: those play only when
+	// GoSIP answers the call itself
+	if recorded, err := h.deps.DB.Greetings.GetActive(ctx, did.ID); err == nil && recorded.AudioURL != sip.GreetingURL(did.ID, recorded.GreetingType) {
+		prompt = `<Play>` + escapeXML(recorded.AudioURL) + `</Play>`
+	} else {
+		greeting, _ := h.deps.DB.Config.Get(ctx, "voicemail_greeting")
+		if greeting == "" {
+			greeting = i18n.Prompt(lang, i18n.PromptVoicemailGreeting)
+		}
+		prompt = sayTwiML(lang, greeting)
 	}
 
 	// Build action URL with DID ID
-	actionURL := "/api/webhooks/voicemail/recording?DidId=" + strconv.FormatInt(didID, 10)
+	actionURL := "/api/webhooks/voicemail/recording?DidId=" + strconv.FormatInt(did.ID, 10)
 
 	return `<Response>
-		<Say>` + greeting + `</Say>
+		` + prompt + `
 		<Record maxLength="180" action="` + actionURL + `" transcribe="false" playBeep="true"/>
-		<Say>Goodbye.</Say>
+		` + sayTwiML(lang, i18n.Prompt(lang, i18n.PromptGoodbye)) + `
 	</Response>`
 }
 
+// callLanguage returns the prompt language for calls to a DID
+func (h *WebhookHandler) callLanguage(ctx context.Context, did *models.DID) string {
+	return i18n.Resolve(did.Language, h.deps.DB.Config.GetForTenant(ctx, did.TenantID, "default_language", i18n.DefaultLanguage))
+}
+
+// sayTwiML renders text as a <Say> in the voice of the given language
+func sayTwiML(lang, text string) string {
+	return `<Say language="` + i18n.VoiceLocale(lang) + `">` + escapeXML(text) + `</Say>`
+}
+
 func (h *WebhookHandler) smsTwiML(message string) string {
 	return `<Response><Message>` + escapeXML(message) + `</Message></Response>`
 }
 
-func (h *WebhookHandler) evaluateCondition(route *models.Route, callerID string) bool {
+func (h *WebhookHandler) evaluateCondition(ctx context.Context, route *models.Route, callerID string, now time.Time, loc *time.Location) bool {
 	switch route.ConditionType {
 	case "default":
 		return true
 	case "callerid":
+		if rules.IsCommunityCondition(route.ConditionData) {
+			listed, _, err := h.deps.DB.BlocklistFeeds.IsListed(ctx, callerID)
+			return err == nil && listed
+		}
 		var data struct {
 			Pattern string `json:"pattern"`
 		}
@@ -347,35 +719,38 @@ func (h *WebhookHandler) evaluateCondition(route *models.Route, callerID string)
 			return strings.Contains(callerID, data.Pattern)
 		}
 	case "time":
-		var data struct {
-			StartHour int `json:"start_hour"`
-			EndHour   int `json:"end_hour"`
-			Days      []int `json:"days"`
-		}
-		if err := json.Unmarshal(route.ConditionData, &data); err == nil {
-			now := time.Now()
-			hour := now.Hour()
-			weekday := int(now.Weekday())
-
-			// Check day
-			dayMatch := len(data.Days) == 0
-			for _, d := range data.Days {
-				if d == weekday {
-					dayMatch = true
-					break
-				}
-			}
-
-			// Check time
-			timeMatch := hour >= data.StartHour && hour < data.EndHour
-
-			return dayMatch && timeMatch
-		}
+		return rules.MatchTimeCondition(route.ConditionData, now, loc)
+	case "calendar":
+		return rules.MatchCalendarCondition(ctx, h.deps.DB.Calendars, route.ConditionData, now)
 	}
 	return false
 }
 
-func (h *WebhookHandler) executeAction(route *models.Route, did *models.DID, from, callSID string) string {
+// deviceBusy reports whether a device is on a call and has call waiting disabled
+func (h *WebhookHandler) deviceBusy(ctx context.Context, deviceID int64) bool {
+	if h.deps.SIP == nil || !h.deps.SIP.IsDeviceBusy(deviceID) {
+		return false
+	}
+	device, err := h.deps.DB.Devices.GetByID(ctx, deviceID)
+	return err == nil && !device.CallWaiting
+}
+
+// scheduleLocation returns the timezone time-based routes of a DID are evaluated in:
+// the DID's own timezone, then its tenant's or the system timezone, then the server's local time
+func (h *WebhookHandler) scheduleLocation(ctx context.Context, did *models.DID) *time.Location {
+	system := rules.LoadLocation(h.deps.DB.Config.GetForTenant(ctx, did.TenantID, "timezone", ""), time.Local)
+	return rules.LoadLocation(did.Timezone, system)
+}
+
+func (h *WebhookHandler) executeAction(route *models.Route, did *models.DID, from, callSID, whisperURL string) string {
+	// Optional TwiML played to the answering party before bridging
+	urlAttr := ""
+	if whisperURL != "" {
+		urlAttr = ` url="` + escapeXML(whisperURL) + `"`
+	}
+
+	limit := h.callTimeLimit(route)
+
 	switch route.ActionType {
 	case "ring":
 		var data struct {
@@ -389,46 +764,212 @@ func (h *WebhookHandler) executeAction(route *models.Route, did *models.DID, fro
 				timeout = 30
 			}
 
+			// Twilio passes the ring class on as an X- header; the SIP
+			// server turns it into Alert-Info for the phone
+			alert := rules.AlertInfo(context.Background(), h.deps.DB.CallerLists, route, from)
+			// Recordings are linked to the call's CDR through its SID
+			record := rules.Record(route) || did.RecordingEnabled
+			sid := h.holdDiversionSID(callSID)
+			if record {
+				sid = callSID
+			}
+			headers := trunkHeaders(alert, limit, sid, rules.MediaRelay(route), record)
+
 			var dialTargets []string
+			rung := make(map[int64]bool)
 			for _, deviceID := range data.Devices {
-				device, err := h.deps.DB.Devices.GetByID(nil, deviceID)
-				if err == nil {
-					dialTargets = append(dialTargets, `<Sip>`+device.Username+`@sip.gosip.local</Sip>`)
+				device, err := h.deps.DB.Devices.GetByID(context.Background(), deviceID)
+				if err == nil && !h.deviceBusy(context.Background(), device.ID) {
+					dialTargets = append(dialTargets, sipDialTarget(device, urlAttr, headers))
+					rung[device.ID] = true
 				}
 			}
+			for _, device := range h.webPhonesToRing(context.Background(), data.Devices, rung) {
+				dialTargets = append(dialTargets, sipDialTarget(device, urlAttr, headers))
+			}
 
 			if len(dialTargets) == 0 {
-				return h.voicemailTwiML(did.ID, from)
+				return h.voicemailTwiML(did, from)
 			}
 
 			return `<Response>
-				<Dial timeout="` + strconv.Itoa(timeout) + `" action="/api/webhooks/voice/status">
+				<Dial timeout="` + strconv.Itoa(timeout) + `"` + timeLimitAttr(limit) + ` action="/api/webhooks/voice/status">
 					` + strings.Join(dialTargets, "\n") + `
 				</Dial>
-				` + h.voicemailTwiML(did.ID, from) + `
+				` + h.voicemailTwiML(did, from) + `
 			</Response>`
 		}
 
 	case "forward":
-		var data struct {
-			Number string `json:"number"`
-		}
+		var data rules.ForwardAction
 		if err := json.Unmarshal(route.ActionData, &data); err == nil {
+			h.recordDiversion(context.Background(), callSID, did, data.Number)
+			if data.DetectVoicemail {
+				return h.forwardDetectTwiML(did, data.Number, callSID, whisperURL, limit)
+			}
 			return `<Response>
-				<Dial callerId="` + did.Number + `">
-					<Number>` + data.Number + `</Number>
+				<Dial callerId="` + did.Number + `"` + timeLimitAttr(limit) + `>
+					<Number` + urlAttr + `>` + data.Number + `</Number>
 				</Dial>
 			</Response>`
 		}
 
+	case "oncall":
+		var data rules.OnCallAction
+		if err := json.Unmarshal(route.ActionData, &data); err == nil {
+			return h.onCallTwiML(context.Background(), did, from, callSID, data.ScheduleID, 1, whisperURL, limit)
+		}
+
+	case "escalate":
+		var data rules.EscalateAction
+		if err := json.Unmarshal(route.ActionData, &data); err == nil {
+			return h.escalationTwiML(context.Background(), did, from, callSID, data.PolicyID, 1, 1, whisperURL, limit)
+		}
+
 	case "voicemail":
-		return h.voicemailTwiML(did.ID, from)
+		return h.voicemailTwiML(did, from)
 
 	case "reject":
-		return h.rejectTwiML("rejected")
+		return h.rejectTwiML(callSID, rules.ParseRejectAction(route.ActionData))
+	}
+
+	return h.voicemailTwiML(did, from)
+}
+
+// callTimeLimit returns the seconds a call answered through route may last,
+// or 0 when it is unlimited
+func (h *WebhookHandler) callTimeLimit(route *models.Route) int {
+	fallback := 0
+	if h.deps.Config != nil && h.deps.Config.CallLimits != nil {
+		fallback = h.deps.Config.CallLimits.MaxCallDuration
+	}
+	return rules.MaxDuration(route, fallback)
+}
+
+// holdDiversionSID returns the call SID to pass to the SIP server when calls
+// held too long go to voicemail, or an empty string
+func (h *WebhookHandler) holdDiversionSID(callSID string) string {
+	if h.deps.Config == nil || h.deps.Config.CallLimits == nil {
+		return ""
+	}
+	limits := h.deps.Config.CallLimits
+	if limits.MaxHoldTime <= 0 || limits.HoldTimeoutAction != config.HoldTimeoutVoicemail {
+		return ""
+	}
+	return callSID
+}
+
+// timeLimitAttr returns the <Dial> attribute that makes Twilio hang up the
+// call after seconds
+func timeLimitAttr(seconds int) string {
+	if seconds <= 0 {
+		return ""
 	}
+	return ` timeLimit="` + strconv.Itoa(seconds) + `"`
+}
 
-	return h.voicemailTwiML(did.ID, from)
+// trunkHeaders returns the X- headers appended to a <Sip> URI, which Twilio
+// copies into the INVITE sent to the SIP server. A callSID lets the SIP
+// server send a call held too long back to voicemail through the Dial
+// action, relay is the route's media relay mode, and record asks for the
+// call to be recorded.
+func trunkHeaders(alert string, maxDuration int, callSID, relay string, record bool) string {
+	var params []string
+	if alert != "" {
+		params = append(params, sip.TrunkAlertInfoHeader+"="+url.QueryEscape(alert))
+	}
+	if maxDuration > 0 {
+		params = append(params, sip.TrunkMaxDurationHeader+"="+strconv.Itoa(maxDuration))
+	}
+	if callSID != "" {
+		params = append(params, sip.TrunkCallSIDHeader+"="+url.QueryEscape(callSID))
+	}
+	if relay != "" {
+		params = append(params, sip.TrunkMediaRelayHeader+"="+relay)
+	}
+	if record {
+		params = append(params, sip.TrunkRecordHeader+"=1")
+	}
+	if len(params) == 0 {
+		return ""
+	}
+	return "?" + strings.Join(params, "&")
+}
+
+// recordedCallSID returns the call SID passed to the SIP server for DIDs
+// that record their calls, which links the recordings to the call's CDR
+func recordedCallSID(did *models.DID, callSID string) string {
+	if !did.RecordingEnabled {
+		return ""
+	}
+	return callSID
+}
+
+// sipDialTarget returns the <Sip> noun that rings a device
+func sipDialTarget(device *models.Device, urlAttr, headers string) string {
+	return `<Sip` + urlAttr + `>` + device.Username + `@sip.gosip.local` + escapeXML(headers) + `</Sip>`
+}
+
+// onCallTwiML rings the devices of whoever is on call at a level of a
+// schedule. Unanswered calls escalate to the next level through VoiceOnCall.
+// Levels whose responder has no free device are skipped, and callers reach
+// voicemail once every level has been tried.
+func (h *WebhookHandler) onCallTwiML(ctx context.Context, did *models.DID, from, callSID string, scheduleID int64, level int, whisperURL string, maxDuration int) string {
+	schedule, err := h.deps.DB.OnCall.GetByID(ctx, scheduleID)
+	if err != nil {
+		return h.voicemailTwiML(did, from)
+	}
+	now := time.Now()
+	overrides, _ := h.deps.DB.OnCall.ListOverrides(ctx, schedule.ID, now)
+	loc := onCallLocation(ctx, h.deps, schedule)
+
+	urlAttr := ""
+	if whisperURL != "" {
+		urlAttr = ` url="` + escapeXML(whisperURL) + `"`
+	}
+
+	for ; level <= len(schedule.Levels); level++ {
+		userID, ok := oncall.Responder(schedule, overrides, level, now, loc)
+		if !ok {
+			continue
+		}
+		devices, err := h.deps.DB.Devices.ListByUser(ctx, userID)
+		if err != nil {
+			continue
+		}
+
+		var dialTargets []string
+		for _, device := range devices {
+			if !h.deviceBusy(ctx, device.ID) {
+				dialTargets = append(dialTargets, sipDialTarget(device, urlAttr, trunkHeaders("", maxDuration, recordedCallSID(did, callSID), "", did.RecordingEnabled)))
+			}
+		}
+		if len(dialTargets) == 0 {
+			continue
+		}
+
+		timeout := schedule.Levels[level-1].Timeout
+		if timeout <= 0 {
+			timeout = config.OnCallDefaultTimeout
+		}
+		actionURL := "/api/webhooks/voice/oncall?DidId=" + strconv.FormatInt(did.ID, 10) +
+			"&ScheduleId=" + strconv.FormatInt(schedule.ID, 10) +
+			"&Level=" + strconv.Itoa(level+1)
+		if whisperURL != "" {
+			actionURL += "&WhisperUrl=" + url.QueryEscape(whisperURL)
+		}
+		if maxDuration > 0 {
+			actionURL += "&MaxDuration=" + strconv.Itoa(maxDuration)
+		}
+
+		return `<Response>
+			<Dial timeout="` + strconv.Itoa(timeout) + `"` + timeLimitAttr(maxDuration) + ` action="` + escapeXML(actionURL) + `">
+				` + strings.Join(dialTargets, "\n") + `
+			</Dial>
+		</Response>`
+	}
+
+	return h.voicemailTwiML(did, from)
 }
 
 func (h *WebhookHandler) checkAutoReply(ctx context.Context, didID int64, body string) string {
@@ -464,6 +1005,15 @@ func (h *WebhookHandler) checkAutoReply(ctx context.Context, didID int64, body s
 			if now < start || now >= end {
 				return rule.ReplyText
 			}
+		case "calendar_busy":
+			// TriggerData holds the ID of the user whose calendar is checked
+			userID, err := strconv.ParseInt(strings.TrimSpace(string(rule.TriggerData)), 10, 64)
+			if err != nil {
+				continue
+			}
+			if busy, err := h.deps.DB.Calendars.IsUserBusy(ctx, userID, time.Now()); err == nil && busy {
+				return rule.ReplyText
+			}
 		}
 	}
 
@@ -484,6 +1034,16 @@ func (h *WebhookHandler) sendSMSNotification(message *models.Message) {
 	}
 }
 
+// deliverSMSToDevices sends an inbound text to the DID's SIP MESSAGE clients
+func (h *WebhookHandler) deliverSMSToDevices(message *models.Message) {
+	if h.deps.SIP == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), config.SIPMessageTimeout)
+	defer cancel()
+	h.deps.SIP.DeliverMessage(ctx, message)
+}
+
 func escapeXML(s string) string {
 	s = strings.ReplaceAll(s, "&", "&amp;")
 	s = strings.ReplaceAll(s, "<", "&lt;")
@@ -515,23 +1075,31 @@ func (h *SIPTrunkHandler) HandleSIPInvite(w http.ResponseWriter, r *http.Request
 	toURI, _ := url.Parse("sip:" + to)
 	extension := strings.Split(toURI.User.Username(), "@")[0]
 
+	lang := i18n.Resolve(h.deps.DB.Config.GetWithDefault(r.Context(), "default_language", i18n.DefaultLanguage))
+
 	// Look up device by extension/username
 	device, err := h.deps.DB.Devices.GetByUsername(r.Context(), extension)
 	if err != nil {
-		h.respondTwiML(w, `<Response><Say>Extension not found</Say><Hangup/></Response>`)
+		h.respondTwiML(w, `<Response>`+sayTwiML(lang, i18n.Prompt(lang, i18n.PromptExtensionNotFound))+`<Hangup/></Response>`)
 		return
 	}
 
 	// Check if device is registered
 	if h.deps.SIP != nil && !h.deps.SIP.GetRegistrar().IsRegistered(r.Context(), device.ID) {
-		h.respondTwiML(w, `<Response><Say>Extension is not available</Say><Hangup/></Response>`)
+		h.respondTwiML(w, `<Response>`+sayTwiML(lang, i18n.Prompt(lang, i18n.PromptExtensionUnavailable))+`<Hangup/></Response>`)
 		return
 	}
 
+	// Calls that don't go through a route only have the global duration limit
+	limit := 0
+	if h.deps.Config.CallLimits != nil {
+		limit = h.deps.Config.CallLimits.MaxCallDuration
+	}
+
 	// Bridge call to internal SIP device
 	h.respondTwiML(w, `<Response>
-		<Dial callerId="`+from+`">
-			<Sip>`+device.Username+`@`+h.deps.Config.SIPDomain+`</Sip>
+		<Dial callerId="`+from+`"`+timeLimitAttr(limit)+`>
+			<Sip>`+device.Username+`@`+h.deps.Config.SIPDomain+escapeXML(trunkHeaders("", limit, "", "", false))+`</Sip>
 		</Dial>
 	</Response>`)
 }
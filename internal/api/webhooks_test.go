@@ -1,9 +1,438 @@
 package api
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
 )
 
+// newSignedWebhookRequest builds a form POST carrying a valid X-Twilio-Signature
+func newSignedWebhookRequest(t *testing.T, database *db.DB, target string, form url.Values) *http.Request {
+	t.Helper()
+
+	authToken := "test-auth-token"
+	if err := database.Config.Set(context.Background(), "twilio_auth_token", authToken); err != nil {
+		t.Fatalf("Failed to set auth token: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	signed := "http://" + req.Host + req.URL.RequestURI()
+	for _, k := range keys {
+		signed += k + form.Get(k)
+	}
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(signed))
+	req.Header.Set("X-Twilio-Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	return req
+}
+
+func TestWebhookHandler_VoiceIncoming_AnonymousPolicy(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+	ctx := context.Background()
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+
+	tests := []struct {
+		policy   string
+		from     string
+		contains string
+	}{
+		{db.AnonymousActionAllow, "anonymous", "<Record maxLength=\"180\""},
+		{db.AnonymousActionReject, "anonymous", "<Reject"},
+		{db.AnonymousActionReject, "+15559876543", "<Record maxLength=\"180\""},
+		{db.AnonymousActionChallenge, "anonymous", "/api/webhooks/voice/screen?DidId="},
+	}
+
+	for _, tt := range tests {
+		did.AnonymousAction = tt.policy
+		if err := setup.DB.DIDs.Update(ctx, did); err != nil {
+			t.Fatalf("Failed to update DID: %v", err)
+		}
+
+		req := newSignedWebhookRequest(t, setup.DB, "/api/webhooks/voice/incoming", url.Values{
+			"From":    {tt.from},
+			"To":      {did.Number},
+			"CallSid": {"CA123"},
+		})
+		rr := httptest.NewRecorder()
+		handler.VoiceIncoming(rr, req)
+
+		if !strings.Contains(rr.Body.String(), tt.contains) {
+			t.Errorf("policy %s, from %q: expected TwiML containing %q, got %s", tt.policy, tt.from, tt.contains, rr.Body.String())
+		}
+	}
+}
+
+func TestWebhookHandler_VoiceIncoming_CommunityBlocklist(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+	ctx := context.Background()
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+
+	feed := &models.BlocklistFeed{Name: "Spam", URL: "https://feeds.example.com/spam.txt", Enabled: true}
+	setup.DB.BlocklistFeeds.Create(ctx, feed)
+	setup.DB.BlocklistFeeds.RecordSuccess(ctx, feed.ID, []string{"+15559999999"})
+
+	if err := setup.DB.Routes.Create(ctx, &models.Route{
+		DIDID:         &did.ID,
+		Name:          "Community Spam",
+		Priority:      1,
+		ConditionType: "callerid",
+		ConditionData: []byte(`{"community": true}`),
+		ActionType:    "reject",
+		Enabled:       true,
+	}); err != nil {
+		t.Fatalf("Failed to create route: %v", err)
+	}
+
+	tests := []struct {
+		from     string
+		contains string
+	}{
+		{"+15559999999", "<Reject"},
+		{"+15559876543", "<Record maxLength=\"180\""},
+	}
+
+	for _, tt := range tests {
+		req := newSignedWebhookRequest(t, setup.DB, "/api/webhooks/voice/incoming", url.Values{
+			"From":    {tt.from},
+			"To":      {did.Number},
+			"CallSid": {"CA123"},
+		})
+		rr := httptest.NewRecorder()
+		handler.VoiceIncoming(rr, req)
+
+		if !strings.Contains(rr.Body.String(), tt.contains) {
+			t.Errorf("from %q: expected TwiML containing %q, got %s", tt.from, tt.contains, rr.Body.String())
+		}
+	}
+}
+
+func TestWebhookHandler_VoiceIncoming_RejectCodes(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+	ctx := context.Background()
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	setup.DB.Blocklist.Create(ctx, &models.BlocklistEntry{Pattern: "+15559999999", PatternType: "exact"})
+	if err := setup.DB.Routes.Create(ctx, &models.Route{
+		DIDID:         &did.ID,
+		Name:          "Closed",
+		Priority:      1,
+		ConditionType: "default",
+		ActionType:    "reject",
+		ActionData:    []byte(`{"sip_code": 480, "reason": "Closed for the holidays"}`),
+		Enabled:       true,
+	}); err != nil {
+		t.Fatalf("Failed to create route: %v", err)
+	}
+
+	call := func(from string) string {
+		rr := httptest.NewRecorder()
+		handler.VoiceIncoming(rr, newSignedWebhookRequest(t, setup.DB, "/api/webhooks/voice/incoming", url.Values{
+			"From":    {from},
+			"To":      {did.Number},
+			"CallSid": {"CA" + from[1:]},
+		}))
+		return rr.Body.String()
+	}
+
+	if body := call("+15559999999"); !strings.Contains(body, `<Reject reason="rejected"/>`) {
+		t.Errorf("Expected blocklisted callers declined by default, got %s", body)
+	}
+	setup.DB.Config.Set(ctx, "blocklist_reject_code", "486")
+	if body := call("+15559999999"); !strings.Contains(body, `<Reject reason="busy"/>`) {
+		t.Errorf("Expected blocklisted callers to hear busy, got %s", body)
+	}
+	if body := call("+15559876543"); !strings.Contains(body, `<Reject reason="busy"/>`) {
+		t.Errorf("Expected the route's 480 signalled as busy, got %s", body)
+	}
+}
+
+func TestWebhookHandler_VoiceScreen(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	target := "/api/webhooks/voice/screen?DidId=" + strconv.FormatInt(did.ID, 10)
+
+	t.Run("silent caller is dropped", func(t *testing.T) {
+		req := newSignedWebhookRequest(t, setup.DB, target, url.Values{
+			"From":              {"anonymous"},
+			"RecordingDuration": {"0"},
+		})
+		rr := httptest.NewRecorder()
+		handler.VoiceScreen(rr, req)
+
+		if !strings.Contains(rr.Body.String(), "<Hangup/>") {
+			t.Errorf("Expected hangup TwiML, got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("recorded name is whispered to callee", func(t *testing.T) {
+		forward := `{"number": "+15550001111"}`
+		if err := setup.DB.Routes.Create(context.Background(), &models.Route{
+			DIDID:         &did.ID,
+			Name:          "Forward",
+			ConditionType: "default",
+			ActionType:    "forward",
+			ActionData:    []byte(forward),
+			Enabled:       true,
+		}); err != nil {
+			t.Fatalf("Failed to create route: %v", err)
+		}
+
+		req := newSignedWebhookRequest(t, setup.DB, target, url.Values{
+			"From":              {"anonymous"},
+			"RecordingUrl":      {"https://api.twilio.com/rec/RE123"},
+			"RecordingDuration": {"2"},
+		})
+		rr := httptest.NewRecorder()
+		handler.VoiceScreen(rr, req)
+
+		body := rr.Body.String()
+		if !strings.Contains(body, `url="/api/webhooks/voice/whisper?RecordingUrl=`) {
+			t.Errorf("Expected whisper URL on dialed number, got %s", body)
+		}
+	})
+}
+
+func TestWebhookHandler_VoiceIncoming_DiversionChain(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+	ctx := context.Background()
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	if err := setup.DB.Routes.Create(ctx, &models.Route{
+		DIDID:         &did.ID,
+		Name:          "Forward",
+		ConditionType: "default",
+		ActionType:    "forward",
+		ActionData:    []byte(`{"number": "+15550001111"}`),
+		Enabled:       true,
+	}); err != nil {
+		t.Fatalf("Failed to create route: %v", err)
+	}
+
+	req := newSignedWebhookRequest(t, setup.DB, "/api/webhooks/voice/incoming", url.Values{
+		"From":          {"+15559876543"},
+		"To":            {did.Number},
+		"CallSid":       {"CA_FWD"},
+		"ForwardedFrom": {"+15552223333"},
+	})
+	rr := httptest.NewRecorder()
+	handler.VoiceIncoming(rr, req)
+
+	cdr, err := setup.DB.CDRs.GetByCallSID(ctx, "CA_FWD")
+	if err != nil {
+		t.Fatalf("Expected CDR for incoming call: %v", err)
+	}
+	want := `["+15552223333","+15551234567","+15550001111"]`
+	if string(cdr.DiversionChain) != want {
+		t.Errorf("DiversionChain = %s, want %s", cdr.DiversionChain, want)
+	}
+	if cdr.Disposition != "missed" {
+		t.Errorf("Disposition = %s, want missed", cdr.Disposition)
+	}
+}
+
+func TestWebhookHandler_VoiceIncoming_AlertInfo(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+	ctx := context.Background()
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	device := createTestDevice(t, setup.DB, "Kitchen", "kitchen")
+	route := &models.Route{
+		DIDID:         &did.ID,
+		Name:          "Ring kitchen",
+		ConditionType: "default",
+		ActionType:    "ring",
+		ActionData:    []byte(`{"devices": [` + strconv.FormatInt(device.ID, 10) + `]}`),
+		Enabled:       true,
+	}
+	if err := setup.DB.Routes.Create(ctx, route); err != nil {
+		t.Fatalf("Failed to create route: %v", err)
+	}
+	if err := setup.DB.CallerLists.Create(ctx, &models.CallerList{
+		Name:      "Family",
+		Numbers:   []string{"+15559876543"},
+		AlertInfo: "vip",
+	}); err != nil {
+		t.Fatalf("Failed to create caller list: %v", err)
+	}
+
+	incoming := func(from string) string {
+		req := newSignedWebhookRequest(t, setup.DB, "/api/webhooks/voice/incoming", url.Values{
+			"From":    {from},
+			"To":      {did.Number},
+			"CallSid": {"CA_" + from},
+		})
+		rr := httptest.NewRecorder()
+		handler.VoiceIncoming(rr, req)
+		return rr.Body.String()
+	}
+
+	if body := incoming("+15559876543"); !strings.Contains(body, "kitchen@sip.gosip.local?X-Alert-Info=vip</Sip>") {
+		t.Errorf("Expected caller list ring class on SIP URI, got %s", body)
+	}
+	if body := incoming("+15550002222"); strings.Contains(body, "X-Alert-Info") {
+		t.Errorf("Expected no ring class for unlisted caller, got %s", body)
+	}
+
+	// A ring class on the route overrides caller lists
+	route.ActionData = []byte(`{"devices": [` + strconv.FormatInt(device.ID, 10) + `], "alert_info": "internal"}`)
+	if err := setup.DB.Routes.Update(ctx, route); err != nil {
+		t.Fatalf("Failed to update route: %v", err)
+	}
+	if body := incoming("+15559876543"); !strings.Contains(body, "?X-Alert-Info=internal</Sip>") {
+		t.Errorf("Expected route ring class on SIP URI, got %s", body)
+	}
+}
+
+func TestWebhookHandler_ExecuteAction_MediaRelay(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB, Config: &config.Config{}})
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	device := createTestDevice(t, setup.DB, "Kitchen", "kitchen")
+
+	// The route's relay mode reaches the SIP server with the call
+	ring := &models.Route{
+		ActionType: "ring",
+		ActionData: []byte(`{"devices": [` + strconv.FormatInt(device.ID, 10) + `], "media_relay": "always"}`),
+	}
+	twiml := handler.executeAction(ring, did, "+15559876543", "CA123", "")
+	if !strings.Contains(twiml, "?X-Media-Relay=always</Sip>") {
+		t.Errorf("Expected the route's relay mode on the SIP URI, got %s", twiml)
+	}
+
+	ring.ActionData = []byte(`{"devices": [` + strconv.FormatInt(device.ID, 10) + `]}`)
+	if twiml := handler.executeAction(ring, did, "+15559876543", "CA123", ""); strings.Contains(twiml, "X-Media-Relay") {
+		t.Errorf("Expected no relay mode without one on the route, got %s", twiml)
+	}
+}
+
+func TestWebhookHandler_ExecuteAction_Record(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB, Config: &config.Config{}})
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	device := createTestDevice(t, setup.DB, "Kitchen", "kitchen")
+
+	// Recorded calls carry their call SID, which links the recording to the CDR
+	ring := &models.Route{
+		ActionType: "ring",
+		ActionData: []byte(`{"devices": [` + strconv.FormatInt(device.ID, 10) + `], "record": true}`),
+	}
+	if twiml := handler.executeAction(ring, did, "+15559876543", "CA123", ""); !strings.Contains(twiml, "?X-Call-Sid=CA123&amp;X-Record=1</Sip>") {
+		t.Errorf("Expected the route's recording on the SIP URI, got %s", twiml)
+	}
+
+	ring.ActionData = []byte(`{"devices": [` + strconv.FormatInt(device.ID, 10) + `]}`)
+	if twiml := handler.executeAction(ring, did, "+15559876543", "CA123", ""); strings.Contains(twiml, "X-Record") {
+		t.Errorf("Expected no recording without one on the route or DID, got %s", twiml)
+	}
+
+	did.RecordingEnabled = true
+	if twiml := handler.executeAction(ring, did, "+15559876543", "CA123", ""); !strings.Contains(twiml, "X-Record=1") {
+		t.Errorf("Expected the DID's recording on the SIP URI, got %s", twiml)
+	}
+}
+
+func TestWebhookHandler_ExecuteAction_MaxDuration(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewWebhookHandler(&Dependencies{
+		DB:     setup.DB,
+		Config: &config.Config{CallLimits: &config.CallLimitsConfig{MaxCallDuration: 14400}},
+	})
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	device := createTestDevice(t, setup.DB, "Kitchen", "kitchen")
+
+	// The route's limit replaces the global one, for Twilio and the SIP server
+	ring := &models.Route{
+		ActionType: "ring",
+		ActionData: []byte(`{"devices": [` + strconv.FormatInt(device.ID, 10) + `], "alert_info": "vip", "max_duration": 600}`),
+	}
+	twiml := handler.executeAction(ring, did, "+15559876543", "CA123", "")
+	if !strings.Contains(twiml, `timeLimit="600"`) || !strings.Contains(twiml, "?X-Alert-Info=vip&amp;X-Max-Duration=600</Sip>") {
+		t.Errorf("Expected the route limit, got %s", twiml)
+	}
+
+	forward := &models.Route{ActionType: "forward", ActionData: []byte(`{"number": "+15550001111"}`)}
+	twiml = handler.executeAction(forward, did, "+15559876543", "CA123", "")
+	if !strings.Contains(twiml, `timeLimit="14400"`) {
+		t.Errorf("Expected the global limit, got %s", twiml)
+	}
+
+	// Without any limit Twilio's own default applies
+	handler.deps.Config.CallLimits.MaxCallDuration = 0
+	twiml = handler.executeAction(forward, did, "+15559876543", "CA123", "")
+	if strings.Contains(twiml, "timeLimit") {
+		t.Errorf("Expected no time limit, got %s", twiml)
+	}
+}
+
+func TestWebhookHandler_ExecuteAction_HoldDiversion(t *testing.T) {
+	setup := setupTestAPI(t)
+	limits := &config.CallLimitsConfig{MaxHoldTime: 300, HoldTimeoutAction: config.HoldTimeoutVoicemail}
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB, Config: &config.Config{CallLimits: limits}})
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	device := createTestDevice(t, setup.DB, "Kitchen", "kitchen")
+	ring := &models.Route{ActionType: "ring", ActionData: []byte(`{"devices": [` + strconv.FormatInt(device.ID, 10) + `]}`)}
+
+	// The SIP server needs the caller's call SID to send it to voicemail
+	if twiml := handler.executeAction(ring, did, "+15559876543", "CA123", ""); !strings.Contains(twiml, "?X-Call-Sid=CA123</Sip>") {
+		t.Errorf("Expected the call SID on the SIP URI, got %s", twiml)
+	}
+
+	limits.HoldTimeoutAction = config.HoldTimeoutRetrieve
+	if twiml := handler.executeAction(ring, did, "+15559876543", "CA123", ""); strings.Contains(twiml, "X-Call-Sid") {
+		t.Errorf("Expected no call SID when held calls are retrieved, got %s", twiml)
+	}
+}
+
+func TestCDRDisposition(t *testing.T) {
+	tests := map[string]string{
+		"completed":   "answered",
+		"busy":        "busy",
+		"no-answer":   "missed",
+		"canceled":    "missed",
+		"failed":      "failed",
+		"in-progress": "",
+	}
+	for status, want := range tests {
+		if got := cdrDisposition(status); got != want {
+			t.Errorf("cdrDisposition(%q) = %q, want %q", status, got, want)
+		}
+	}
+}
+
 func TestEscapeXML(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -115,3 +544,140 @@ func TestEscapeXML_UnicodeContent(t *testing.T) {
 		})
 	}
 }
+
+func TestWebhookHandler_VoicemailTwiML_Language(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	did.Language = "fr"
+	if err := setup.DB.DIDs.Update(context.Background(), did); err != nil {
+		t.Fatalf("Failed to update DID: %v", err)
+	}
+
+	twiml := handler.voicemailTwiML(did, "+15559876543")
+	if !strings.Contains(twiml, `<Say language="fr-FR">Veuillez laisser un message après le bip.</Say>`) {
+		t.Errorf("Expected French voicemail prompt, got %s", twiml)
+	}
+}
+
+func TestWebhookHandler_SMSIncoming_MessagingServicePool(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	did.MessagingServiceSID = "MG0123456789abcdef0123456789abcdef"
+	setup.DB.DIDs.Update(context.Background(), did)
+
+	// Sent to a pool number that isn't a DID
+	form := url.Values{
+		"MessageSid":          {"SM555"},
+		"From":                {"+15559876543"},
+		"To":                  {"+15550001111"},
+		"Body":                {"Hello"},
+		"MessagingServiceSid": {did.MessagingServiceSID},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/sms/incoming", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler.SMSIncoming(rr, req)
+
+	msg, err := setup.DB.Messages.GetByMessageSID(context.Background(), "SM555")
+	if err != nil {
+		t.Fatalf("Expected the message to be stored: %v", err)
+	}
+	if msg.DIDID == nil || *msg.DIDID != did.ID {
+		t.Errorf("Expected the message on DID %d, got %v", did.ID, msg.DIDID)
+	}
+}
+
+func TestWebhookHandler_SMSStatus_MessagingServiceSender(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+	msg := &models.Message{
+		MessageSID: "SM777",
+		DIDID:      &did.ID,
+		Direction:  "outbound",
+		FromNumber: did.Number,
+		ToNumber:   "+15559876543",
+		Body:       "Hi",
+		Status:     "sent",
+	}
+	setup.DB.Messages.Create(context.Background(), msg)
+
+	form := url.Values{
+		"MessageSid":          {"SM777"},
+		"MessageStatus":       {"delivered"},
+		"From":                {"+15550001111"},
+		"MessagingServiceSid": {"MG0123456789abcdef0123456789abcdef"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/sms/status", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler.SMSStatus(rr, req)
+
+	assertStatus(t, rr, http.StatusOK)
+
+	updated, _ := setup.DB.Messages.GetByID(context.Background(), msg.ID)
+	if updated.FromNumber != "+15550001111" || updated.Status != "delivered" {
+		t.Errorf("Expected sender +15550001111 and status delivered, got %s and %s", updated.FromNumber, updated.Status)
+	}
+}
+
+func TestWebhookHandler_SMSStatus_ErrorCode(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+	ctx := context.Background()
+
+	msg := &models.Message{MessageSID: "SM999", Direction: "outbound", FromNumber: "+15551234567", ToNumber: "+15559876543", Body: "Hi", Status: "sent"}
+	setup.DB.Messages.Create(ctx, msg)
+
+	status := func(form url.Values) *MessageResponse {
+		req := httptest.NewRequest(http.MethodPost, "/api/webhooks/sms/status", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		handler.SMSStatus(rr, req)
+		assertStatus(t, rr, http.StatusOK)
+		updated, _ := setup.DB.Messages.GetByID(ctx, msg.ID)
+		return toMessageResponse(updated)
+	}
+
+	resp := status(url.Values{"MessageSid": {"SM999"}, "MessageStatus": {"undelivered"}, "ErrorCode": {"30007"}})
+	if resp.Status != "undelivered" || resp.Error == nil || resp.Error.Code != 30007 || resp.Error.Title != "Message filtered" || resp.Error.Remediation == "" {
+		t.Errorf("Expected the filtered message explained, got %s %+v", resp.Status, resp.Error)
+	}
+
+	// A later delivery clears the error
+	resp = status(url.Values{"MessageSid": {"SM999"}, "MessageStatus": {"delivered"}})
+	if resp.Status != "delivered" || resp.Error != nil {
+		t.Errorf("Expected the error cleared, got %s %+v", resp.Status, resp.Error)
+	}
+}
+
+func TestWebhookHandler_SMSIncoming_WhatsApp(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewWebhookHandler(&Dependencies{DB: setup.DB})
+
+	did := createTestDID(t, setup.DB, "+15551234567")
+
+	form := url.Values{
+		"MessageSid": {"SM888"},
+		"From":       {"whatsapp:+15559876543"},
+		"To":         {"whatsapp:+15551234567"},
+		"Body":       {"Hola"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/sms/incoming", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler.SMSIncoming(rr, req)
+
+	msg, err := setup.DB.Messages.GetByMessageSID(context.Background(), "SM888")
+	if err != nil {
+		t.Fatalf("Expected the message to be stored: %v", err)
+	}
+	if msg.Channel != "whatsapp" || msg.FromNumber != "+15559876543" || msg.DIDID == nil || *msg.DIDID != did.ID {
+		t.Errorf("Unexpected message %+v", msg)
+	}
+}
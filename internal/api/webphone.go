@@ -0,0 +1,309 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/pkg/sip"
+)
+
+// errWebPhoneUsername is returned when another device already has the
+// username of a user's browser phone
+var errWebPhoneUsername = errors.New("web phone username taken")
+
+// WebPhoneHandler sets up the phone built into the web UI. Each user gets
+// a webrtc device of their own, created the first time they sign in to
+// it, which registers over WebSocket Secure with short-lived passwords.
+type WebPhoneHandler struct {
+	deps *Dependencies
+}
+
+// NewWebPhoneHandler creates a new WebPhoneHandler
+func NewWebPhoneHandler(deps *Dependencies) *WebPhoneHandler {
+	return &WebPhoneHandler{deps: deps}
+}
+
+// WebPhoneStatus describes the current user's browser phone
+type WebPhoneStatus struct {
+	Available  bool                 `json:"available"`
+	Reason     string               `json:"reason,omitempty"` // Why the phone can't be used
+	Device     *DeviceResponse      `json:"device,omitempty"` // Nil until first signed in
+	Registered bool                 `json:"registered"`
+	Calls      []ActiveCallResponse `json:"calls"`
+}
+
+// WebPhoneCredentials are what the browser phone registers with
+type WebPhoneCredentials struct {
+	DeviceID     int64     `json:"device_id"`
+	Username     string    `json:"username"`
+	Password     string    `json:"password"`
+	Realm        string    `json:"realm"`
+	URI          string    `json:"uri"`           // Address of record, e.g. sip:web-3@sip.example.com
+	WebSocketURL string    `json:"websocket_url"` // e.g. wss://sip.example.com:5081
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// GetStatus returns the current user's browser phone, whether it is
+// registered and the calls it is on. Calls are controlled with the
+// /api/calls endpoints.
+// GET /api/me/phone
+func (h *WebPhoneHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		WriteUnauthorizedError(w)
+		return
+	}
+
+	status := WebPhoneStatus{Calls: []ActiveCallResponse{}}
+	status.Reason = h.unavailable()
+	status.Available = status.Reason == ""
+
+	device, err := webPhoneOf(r.Context(), h.deps, user.ID)
+	switch {
+	case errors.Is(err, db.ErrDeviceNotFound):
+	case errors.Is(err, errWebPhoneUsername):
+		status.Available = false
+		status.Reason = "Another device already has the username " + webPhoneUsername(user.ID)
+	case err != nil:
+		WriteInternalError(w)
+		return
+	default:
+		online := h.deps.SIP != nil && h.deps.SIP.GetRegistrar().IsRegistered(r.Context(), device.ID)
+		status.Device = toDeviceResponse(device, online)
+		status.Registered = online
+		if h.deps.SIP != nil {
+			for _, s := range h.deps.SIP.GetSessions().GetByDevice(device.ID) {
+				status.Calls = append(status.Calls, ActiveCallResponse{
+					CallID:     s.CallID,
+					Direction:  string(s.Direction),
+					State:      string(s.GetState()),
+					FromNumber: s.FromNumber,
+					ToNumber:   s.ToNumber,
+					Duration:   s.Duration(),
+					DeviceID:   s.DeviceID,
+					LocalURI:   s.LocalURI,
+					RemoteURI:  s.RemoteURI,
+				})
+			}
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, status)
+}
+
+// IssueCredentials signs the current user in to their browser phone,
+// creating its device the first time. The password works for
+// config.WebCredentialTTL; the page asks for a new one before then. Each
+// call returns a new password, and earlier ones keep working until they
+// expire, so several tabs can be open at once.
+// POST /api/me/phone/credentials
+func (h *WebPhoneHandler) IssueCredentials(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := GetUserFromContext(ctx)
+	if user == nil {
+		WriteUnauthorizedError(w)
+		return
+	}
+	if reason := h.unavailable(); reason != "" {
+		WriteError(w, http.StatusServiceUnavailable, ErrCodeServiceUnavailable, reason, nil)
+		return
+	}
+
+	device, err := h.provision(ctx, user)
+	if err != nil {
+		if errors.Is(err, errWebPhoneUsername) {
+			WriteError(w, http.StatusConflict, ErrCodeConflict, "Another device already has the username "+webPhoneUsername(user.ID), nil)
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+
+	password, err := generateDevicePassword(ctx, h.deps)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	expires := time.Now().Add(config.WebCredentialTTL).UTC().Truncate(time.Second)
+	h.deps.SIP.AddWebCredential(device.Username, sip.GenerateHA1(device.Username, "gosip", password), expires)
+
+	h.deps.DB.DeviceEvents.LogEvent(ctx, device.ID, "info", map[string]interface{}{
+		"action":  "web_credentials_issued",
+		"user_id": user.ID,
+	}, r.RemoteAddr, r.UserAgent())
+
+	// Browsers reach the WebSocket on the host they loaded the web UI from
+	host := r.Host
+	if name, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = name
+	}
+	domain, err := h.sipDomain(ctx, user, host)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, WebPhoneCredentials{
+		DeviceID:     device.ID,
+		Username:     device.Username,
+		Password:     password,
+		Realm:        "gosip",
+		URI:          "sip:" + device.Username + "@" + domain,
+		WebSocketURL: "wss://" + net.JoinHostPort(host, strconv.Itoa(h.deps.SIP.WebPhonePort())),
+		ExpiresAt:    expires,
+	})
+}
+
+// SignOut signs the current user's browser phone out everywhere: its
+// passwords stop working and it stops ringing. The device is kept.
+// DELETE /api/me/phone/credentials
+func (h *WebPhoneHandler) SignOut(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := GetUserFromContext(ctx)
+	if user == nil {
+		WriteUnauthorizedError(w)
+		return
+	}
+
+	device, err := webPhoneOf(ctx, h.deps, user.ID)
+	if err != nil {
+		if errors.Is(err, db.ErrDeviceNotFound) {
+			WriteNotFoundError(w, "Web phone")
+			return
+		}
+		WriteInternalError(w)
+		return
+	}
+	if h.deps.SIP != nil {
+		if err := h.deps.SIP.SignOutWebPhone(ctx, device); err != nil {
+			WriteInternalError(w)
+			return
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"message": "Web phone signed out"})
+}
+
+// sipDomain returns the domain a user's browser phone registers to: their
+// tenant's when it has one, else the instance's, else the web UI's host
+func (h *WebPhoneHandler) sipDomain(ctx context.Context, user *models.User, host string) (string, error) {
+	if user.TenantID != nil {
+		tenant, err := h.deps.DB.Tenants.GetByID(ctx, *user.TenantID)
+		if err != nil {
+			return "", err
+		}
+		if tenant.SIPDomain != "" {
+			return tenant.SIPDomain, nil
+		}
+	}
+	if h.deps.Config != nil && h.deps.Config.SIPDomain != "" && h.deps.Config.SIPDomain != "localhost" {
+		return h.deps.Config.SIPDomain, nil
+	}
+	return host, nil
+}
+
+// unavailable returns why browser phones can't be used, or "" when they can
+func (h *WebPhoneHandler) unavailable() string {
+	switch {
+	case h.deps.SIP == nil:
+		return "The SIP server is not running"
+	case h.deps.SIP.WebPhonePort() == 0:
+		return "The web phone needs TLS with a WebSocket Secure port"
+	case !h.deps.SIP.WebRTCEnabled():
+		return "The web phone needs the WebRTC gateway (GOSIP_WEBRTC_ENABLED)"
+	}
+	return ""
+}
+
+// provision returns a user's browser phone, creating it the first time in
+// the user's tenant. Its own password is random and never shown: it only
+// registers with the short-lived passwords it is given.
+func (h *WebPhoneHandler) provision(ctx context.Context, user *models.User) (*models.Device, error) {
+	device, err := webPhoneOf(ctx, h.deps, user.ID)
+	if err == nil && !sameTenant(device.TenantID, user.TenantID) {
+		// Follow the user to their tenant
+		if err := h.deps.DB.Devices.SetTenant(ctx, device.ID, user.TenantID); err != nil {
+			return nil, err
+		}
+		device.TenantID = user.TenantID
+	}
+	if !errors.Is(err, db.ErrDeviceNotFound) {
+		return device, err
+	}
+
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	username := webPhoneUsername(user.ID)
+	userID := user.ID
+	device = &models.Device{
+		Name:           "Web phone (" + user.Email + ")",
+		Username:       username,
+		PasswordHash:   sip.GenerateHA1(username, "gosip", hex.EncodeToString(secret)),
+		DeviceType:     "webrtc",
+		UserID:         &userID,
+		TenantID:       user.TenantID,
+		CallWaiting:    true,
+		ComfortNoise:   true,
+		AnonymousCalls: true,
+	}
+	if err := h.deps.DB.Devices.Create(ctx, device); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// webPhoneUsername is the device username of a user's browser phone
+func webPhoneUsername(userID int64) string {
+	return config.WebPhoneUsernamePrefix + strconv.FormatInt(userID, 10)
+}
+
+// webPhoneOf returns a user's browser phone. It returns
+// db.ErrDeviceNotFound when the user has none yet, and errWebPhoneUsername
+// when another device has its username.
+func webPhoneOf(ctx context.Context, deps *Dependencies, userID int64) (*models.Device, error) {
+	device, err := deps.DB.Devices.GetByUsername(ctx, webPhoneUsername(userID))
+	if err != nil {
+		return nil, err
+	}
+	if device.UserID == nil || *device.UserID != userID || device.DeviceType != "webrtc" {
+		return nil, errWebPhoneUsername
+	}
+	return device, nil
+}
+
+// webPhonesToRing returns the browser phones that ring along with the
+// devices of a ring route: those of the devices' users that are signed in
+// and free. Devices already rung are skipped.
+func (h *WebhookHandler) webPhonesToRing(ctx context.Context, deviceIDs []int64, rung map[int64]bool) []*models.Device {
+	if h.deps.SIP == nil {
+		return nil
+	}
+	var phones []*models.Device
+	users := make(map[int64]bool)
+	for _, deviceID := range deviceIDs {
+		device, err := h.deps.DB.Devices.GetByID(ctx, deviceID)
+		if err != nil || device.UserID == nil || users[*device.UserID] {
+			continue
+		}
+		users[*device.UserID] = true
+		phone, err := webPhoneOf(ctx, h.deps, *device.UserID)
+		if err != nil || rung[phone.ID] || h.deviceBusy(ctx, phone.ID) ||
+			!h.deps.SIP.GetRegistrar().IsRegistered(ctx, phone.ID) {
+			continue
+		}
+		rung[phone.ID] = true
+		phones = append(phones, phone)
+	}
+	return phones
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/pkg/sip"
+	"github.com/pion/dtls/v2/pkg/crypto/selfsign"
+)
+
+func TestWebPhoneHandler(t *testing.T) {
+	setup := setupTestAPI(t)
+	handler := NewWebPhoneHandler(&Dependencies{DB: setup.DB})
+	user := createTestUser(t, setup.DB, "user@example.com", "password123", "user")
+	other := createTestUser(t, setup.DB, "other@example.com", "password123", "user")
+
+	call := func(method, path string, as *models.User, fn http.HandlerFunc) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, as))
+		rr := httptest.NewRecorder()
+		fn(rr, req)
+		return rr
+	}
+
+	// Without a SIP server nothing can register
+	rr := call(http.MethodGet, "/api/me/phone", user, handler.GetStatus)
+	assertStatus(t, rr, http.StatusOK)
+	var status WebPhoneStatus
+	decodeResponse(t, rr, &status)
+	if status.Available || status.Reason == "" || status.Device != nil || status.Calls == nil {
+		t.Errorf("Expected an unavailable phone with no device, got %+v", status)
+	}
+	rr = call(http.MethodPost, "/api/me/phone/credentials", user, handler.IssueCredentials)
+	assertStatus(t, rr, http.StatusServiceUnavailable)
+	rr = call(http.MethodDelete, "/api/me/phone/credentials", user, handler.SignOut)
+	assertStatus(t, rr, http.StatusNotFound)
+
+	// The device is created once and belongs to its user
+	device, err := handler.provision(context.Background(), user)
+	if err != nil {
+		t.Fatalf("provision failed: %v", err)
+	}
+	if device.Username != webPhoneUsername(user.ID) || device.DeviceType != "webrtc" || device.UserID == nil || *device.UserID != user.ID {
+		t.Errorf("Unexpected web phone %+v", device)
+	}
+	again, err := handler.provision(context.Background(), user)
+	if err != nil || again.ID != device.ID {
+		t.Errorf("Expected the same device back, got %+v: %v", again, err)
+	}
+
+	rr = call(http.MethodGet, "/api/me/phone", user, handler.GetStatus)
+	status = WebPhoneStatus{}
+	decodeResponse(t, rr, &status)
+	if status.Device == nil || status.Device.ID != device.ID || status.Registered {
+		t.Errorf("Expected the unregistered web phone, got %+v", status)
+	}
+	rr = call(http.MethodDelete, "/api/me/phone/credentials", user, handler.SignOut)
+	assertStatus(t, rr, http.StatusOK)
+
+	// A device someone else owns keeps its username
+	createTestDevice(t, setup.DB, "Desk phone", webPhoneUsername(other.ID))
+	rr = call(http.MethodGet, "/api/me/phone", other, handler.GetStatus)
+	status = WebPhoneStatus{}
+	decodeResponse(t, rr, &status)
+	if status.Available || status.Device != nil {
+		t.Errorf("Expected the taken username reported, got %+v", status)
+	}
+	if _, err := handler.provision(context.Background(), other); err != errWebPhoneUsername {
+		t.Errorf("Expected errWebPhoneUsername, got %v", err)
+	}
+
+	rr = call(http.MethodGet, "/api/me/phone", nil, handler.GetStatus)
+	assertStatus(t, rr, http.StatusUnauthorized)
+}
+
+// newWebPhoneSIPServer creates a SIP server browser phones can use: TLS
+// with a WebSocket Secure port and the WebRTC gateway. It isn't started.
+func newWebPhoneSIPServer(t *testing.T, setup *testSetup) *sip.Server {
+	t.Helper()
+
+	dir := t.TempDir()
+	cert, err := selfsign.GenerateSelfSigned()
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to encode key: %v", err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0600)
+
+	server, err := sip.NewServer(sip.Config{
+		DataDir: dir,
+		TLS:     &config.TLSConfig{Enabled: true, CertMode: "manual", CertFile: certFile, KeyFile: keyFile, WSSPort: 5081},
+		WebRTC:  &config.WebRTCConfig{Enabled: true},
+	}, setup.DB)
+	if err != nil {
+		t.Fatalf("Failed to create SIP server: %v", err)
+	}
+	return server
+}
+
+func TestWebPhoneHandler_IssueCredentials_Tenant(t *testing.T) {
+	setup := setupTestAPI(t)
+	ctx := context.Background()
+	handler := NewWebPhoneHandler(&Dependencies{
+		DB:     setup.DB,
+		SIP:    newWebPhoneSIPServer(t, setup),
+		Config: &config.Config{SIPDomain: "pbx.example.com"},
+	})
+
+	acme := &models.Tenant{Name: "Acme", SIPDomain: "sip.acme.example"}
+	globex := &models.Tenant{Name: "Globex"}
+	for _, tenant := range []*models.Tenant{acme, globex} {
+		if err := setup.DB.Tenants.Create(ctx, tenant); err != nil {
+			t.Fatalf("Failed to create tenant: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		tenantID *int64
+		wantURI  string
+	}{
+		{"instance user", nil, "@pbx.example.com"},
+		{"tenant with a domain", &acme.ID, "@sip.acme.example"},
+		{"tenant without a domain", &globex.ID, "@pbx.example.com"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestUser(t, setup.DB, "user"+string(rune('a'+i))+"@example.com", "password123", "user")
+			user.TenantID = tt.tenantID
+
+			rr := asUser(user, handler.IssueCredentials, http.MethodPost, "/api/me/phone/credentials", nil, nil)
+			assertStatus(t, rr, http.StatusOK)
+			var creds WebPhoneCredentials
+			decodeResponse(t, rr, &creds)
+			if creds.URI != "sip:"+webPhoneUsername(user.ID)+tt.wantURI {
+				t.Errorf("Unexpected URI %q", creds.URI)
+			}
+
+			// The device is created in the user's tenant
+			device, err := setup.DB.Devices.GetByID(ctx, creds.DeviceID)
+			if err != nil {
+				t.Fatalf("Failed to load device: %v", err)
+			}
+			if !sameTenant(device.TenantID, tt.tenantID) {
+				t.Errorf("Expected the web phone in tenant %v, got %v", tt.tenantID, device.TenantID)
+			}
+		})
+	}
+}
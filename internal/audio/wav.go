@@ -2,6 +2,7 @@
 package audio
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -335,3 +336,62 @@ func ValidateWAVFile(path string) (*WAVValidationResult, error) {
 	// For the API endpoint, we use ValidateWAV with the uploaded file reader
 	return nil, errors.New("use ValidateWAV with a reader instead")
 }
+
+// WAVHeaderSize is the size of the header WriteWAVHeader writes
+const WAVHeaderSize = 44
+
+// WriteWAVHeader writes the header of a 16-bit PCM WAV file holding
+// dataSize bytes of samples
+func WriteWAVHeader(w io.Writer, channels, sampleRate int, dataSize uint32) error {
+	blockAlign := channels * BitsPerSample16 / 8
+	header := make([]byte, WAVHeaderSize)
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], 36+dataSize)
+	copy(header[8:12], "WAVE")
+	copy(header[12:16], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:20], 16)
+	binary.LittleEndian.PutUint16(header[20:22], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:24], uint16(channels))
+	binary.LittleEndian.PutUint32(header[24:28], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(header[28:32], uint32(sampleRate*blockAlign))
+	binary.LittleEndian.PutUint16(header[32:34], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(header[34:36], BitsPerSample16)
+	copy(header[36:40], "data")
+	binary.LittleEndian.PutUint32(header[40:44], dataSize)
+	_, err := w.Write(header)
+	return err
+}
+
+// DecodeWAV validates a WAV file and returns its audio as mono 16-bit
+// samples, with the file's sample rate. Stereo is mixed down.
+func DecodeWAV(data []byte) ([]int16, int, error) {
+	r := bytes.NewReader(data)
+	result := ValidateWAV(r, int64(len(data)))
+	if !result.Valid {
+		return nil, 0, result.Error
+	}
+
+	// ValidateWAV stops at the start of the samples
+	header := result.Header
+	size := int(header.DataSize)
+	if size > r.Len() {
+		size = r.Len()
+	}
+	raw := data[len(data)-r.Len():][:size]
+
+	width := int(header.BitsPerSample/8) * int(header.NumChannels)
+	samples := make([]int16, size/width)
+	for i := range samples {
+		frame := raw[i*width : (i+1)*width]
+		total := 0
+		for c := 0; c < int(header.NumChannels); c++ {
+			if header.BitsPerSample == BitsPerSample8 {
+				total += (int(frame[c]) - 128) << 8 // 8-bit WAV is unsigned
+			} else {
+				total += int(int16(binary.LittleEndian.Uint16(frame[c*2:])))
+			}
+		}
+		samples[i] = int16(total / int(header.NumChannels))
+	}
+	return samples, int(header.SampleRate), nil
+}
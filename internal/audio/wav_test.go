@@ -378,3 +378,62 @@ func TestWAVValidationError_Error(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteWAVHeader(t *testing.T) {
+	// 2 seconds of 16 kHz stereo
+	dataSize := uint32(16000 * 2 * 2 * 2)
+	var buf bytes.Buffer
+	if err := WriteWAVHeader(&buf, ChannelsStereo, SampleRate16kHz, dataSize); err != nil {
+		t.Fatalf("WriteWAVHeader failed: %v", err)
+	}
+	if buf.Len() != WAVHeaderSize {
+		t.Fatalf("Expected a %d byte header, got %d", WAVHeaderSize, buf.Len())
+	}
+	if !bytes.Equal(buf.Bytes(), createValidWAVHeader(16000, 16, 2, dataSize)[:WAVHeaderSize]) {
+		t.Error("Header differs from a reference 16 kHz stereo header")
+	}
+
+	buf.Write(make([]byte, dataSize))
+	result := ValidateWAV(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if !result.Valid {
+		t.Fatalf("Expected the written header to validate, got %v", result.Error)
+	}
+	if result.Duration != 2 {
+		t.Errorf("Expected 2 seconds, got %f", result.Duration)
+	}
+}
+
+func TestDecodeWAV(t *testing.T) {
+	// 1 second of 8 kHz stereo: left at 1000, right at 3000
+	var buf bytes.Buffer
+	WriteWAVHeader(&buf, ChannelsStereo, SampleRate8kHz, 8000*4)
+	for i := 0; i < 8000; i++ {
+		binary.Write(&buf, binary.LittleEndian, int16(1000))
+		binary.Write(&buf, binary.LittleEndian, int16(3000))
+	}
+
+	samples, rate, err := DecodeWAV(buf.Bytes())
+	if err != nil {
+		t.Fatalf("DecodeWAV failed: %v", err)
+	}
+	if rate != SampleRate8kHz || len(samples) != 8000 {
+		t.Fatalf("Expected 8000 samples at 8 kHz, got %d at %d", len(samples), rate)
+	}
+	if samples[0] != 2000 || samples[7999] != 2000 {
+		t.Errorf("Expected the channels mixed to 2000, got %d", samples[0])
+	}
+
+	// 8-bit files are unsigned around 128
+	eightBit := createValidWAVHeader(8000, 8, 1, 8000)
+	for i := WAVHeaderSize; i < len(eightBit); i++ {
+		eightBit[i] = 128
+	}
+	samples, _, err = DecodeWAV(eightBit)
+	if err != nil || len(samples) != 8000 || samples[0] != 0 {
+		t.Errorf("Expected 8000 silent samples, got %d (%v)", len(samples), err)
+	}
+
+	if _, _, err := DecodeWAV([]byte("not a wav file")); err == nil {
+		t.Error("Expected an error for a file that isn't WAV")
+	}
+}
@@ -0,0 +1,186 @@
+// Package awssign signs requests to AWS APIs with Signature Version 4 and
+// finds the credentials to sign them with
+package awssign
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+)
+
+// ECSCredentialsHost serves task role credentials inside ECS containers
+const ECSCredentialsHost = "http://169.254.170.2"
+
+// Credentials sign requests
+type Credentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"Token"`
+}
+
+// Provider returns access keys when they are configured, or the ECS task
+// role's credentials
+type Provider struct {
+	Static Credentials
+	// TaskRoleURL serves task role credentials, empty outside ECS
+	TaskRoleURL string
+	Client      *http.Client
+}
+
+// NewProvider creates a Provider from the AWS environment variables
+func NewProvider(cfg *config.SecretsConfig, client *http.Client) *Provider {
+	p := &Provider{Client: client}
+	if cfg == nil {
+		return p
+	}
+	p.Static = Credentials{cfg.AWSAccessKeyID, cfg.AWSSecretAccessKey, cfg.AWSSessionToken}
+	if cfg.AWSContainerCredsPath != "" {
+		p.TaskRoleURL = ECSCredentialsHost + cfg.AWSContainerCredsPath
+	}
+	return p
+}
+
+// Credentials returns the credentials to sign a request with
+func (p *Provider) Credentials(ctx context.Context) (Credentials, error) {
+	if p.Static.AccessKeyID != "" && p.Static.SecretAccessKey != "" {
+		return p.Static, nil
+	}
+	if p.TaskRoleURL == "" {
+		return Credentials{}, errors.New("set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.TaskRoleURL, nil)
+	if err != nil {
+		return Credentials{}, err
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("aws task role credentials: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Credentials{}, fmt.Errorf("aws task role credentials: %s", resp.Status)
+	}
+
+	var creds Credentials
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&creds); err != nil {
+		return Credentials{}, fmt.Errorf("aws task role credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// Sign adds a Signature Version 4 Authorization header, signing the host,
+// Content-Type and X-Amz-* headers. The query string must already be in
+// canonical form, as CanonicalQuery produces.
+func Sign(req *http.Request, body []byte, creds Credentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := req.Header.Get("X-Amz-Content-Sha256")
+	if bodyHash == "" {
+		bodyHash = PayloadHash(body)
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		bodyHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// PayloadHash returns the hex SHA-256 of a request body
+func PayloadHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// CanonicalQuery encodes query parameters sorted by name with spaces as
+// %20, the form signatures are computed over
+func CanonicalQuery(values map[string]string) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = escape(name) + "=" + escape(values[name])
+	}
+	return strings.Join(parts, "&")
+}
+
+// escape percent-encodes everything but unreserved characters (RFC 3986)
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,62 @@
+package blocklist
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"* * 0 * *",
+	} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("ParseSchedule(%q) expected error", expr)
+		}
+	}
+}
+
+func TestSchedule_Matches(t *testing.T) {
+	// 2026-01-05 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.January, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		t    time.Time
+		want bool
+	}{
+		{"every minute", "* * * * *", at(5, 13, 7), true},
+		{"every 6 hours on the hour", "0 */6 * * *", at(5, 12, 0), true},
+		{"every 6 hours off hour", "0 */6 * * *", at(5, 13, 0), false},
+		{"every 6 hours wrong minute", "0 */6 * * *", at(5, 12, 1), false},
+		{"list", "15,45 * * * *", at(5, 3, 45), true},
+		{"range with step", "0-30/10 * * * *", at(5, 3, 20), true},
+		{"range with step outside", "0-30/10 * * * *", at(5, 3, 40), false},
+		{"weekdays", "0 3 * * 1-5", at(5, 3, 0), true},
+		{"weekdays on sunday", "0 3 * * 1-5", at(4, 3, 0), false},
+		{"day of month or weekday", "0 3 1 * 1", at(5, 3, 0), true},
+		{"day of month or weekday neither", "0 3 1 * 1", at(6, 3, 0), false},
+		{"month", "0 0 1 2 *", at(1, 0, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q) failed: %v", tt.expr, err)
+			}
+			if got := schedule.Matches(tt.t); got != tt.want {
+				t.Errorf("Matches(%s) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
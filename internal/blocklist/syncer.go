@@ -0,0 +1,177 @@
+// Package blocklist refreshes the community blocklist from external spam number feeds
+package blocklist
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// Syncer downloads subscribed feeds into the community blocklist
+type Syncer struct {
+	database *db.DB
+	client   *http.Client
+
+	// mu serializes refreshes so scheduled and manual syncs don't interleave
+	mu sync.Mutex
+}
+
+// NewSyncer creates a new Syncer
+func NewSyncer(database *db.DB) *Syncer {
+	return &Syncer{
+		database: database,
+		client:   &http.Client{Timeout: config.BlocklistFeedTimeout},
+	}
+}
+
+// Start refreshes all enabled feeds whenever the blocklist_feed_schedule cron
+// expression matches, while blocklist_feeds_enabled is set
+func (s *Syncer) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if s.due(ctx, now) {
+					s.SyncAll(ctx)
+				}
+			}
+		}
+	}()
+}
+
+// due reports whether a scheduled refresh should run at now
+func (s *Syncer) due(ctx context.Context, now time.Time) bool {
+	if s.database.Config.GetWithDefault(ctx, "blocklist_feeds_enabled", "false") != "true" {
+		return false
+	}
+
+	expr := s.database.Config.GetWithDefault(ctx, "blocklist_feed_schedule", config.DefaultBlocklistFeedSchedule)
+	schedule, err := ParseSchedule(expr)
+	if err != nil {
+		slog.Warn("Invalid blocklist feed schedule", "schedule", expr, "error", err)
+		return false
+	}
+	return schedule.Matches(now)
+}
+
+// SyncAll refreshes every enabled feed. Failures are recorded on the feed.
+func (s *Syncer) SyncAll(ctx context.Context) {
+	feeds, err := s.database.BlocklistFeeds.ListEnabled(ctx)
+	if err != nil {
+		slog.Error("Failed to list blocklist feeds", "error", err)
+		return
+	}
+
+	for _, feed := range feeds {
+		if err := s.SyncFeed(ctx, feed); err != nil {
+			slog.Warn("Blocklist feed refresh failed", "feed", feed.Name, "error", err)
+		}
+	}
+}
+
+// SyncFeed downloads a feed and replaces its numbers. On failure the numbers
+// from the last successful refresh are kept and the error is recorded.
+func (s *Syncer) SyncFeed(ctx context.Context, feed *models.BlocklistFeed) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	numbers, err := s.fetch(ctx, feed.URL)
+	if err != nil {
+		if recErr := s.database.BlocklistFeeds.RecordFailure(ctx, feed.ID, err.Error()); recErr != nil {
+			return recErr
+		}
+		return err
+	}
+
+	if err := s.database.BlocklistFeeds.RecordSuccess(ctx, feed.ID, numbers); err != nil {
+		return err
+	}
+	slog.Info("Blocklist feed refreshed", "feed", feed.Name, "numbers", len(numbers))
+	return nil
+}
+
+// fetch downloads and parses a feed
+func (s *Syncer) fetch(ctx context.Context, url string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", config.DefaultUserAgent)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return ParseFeed(io.LimitReader(resp.Body, config.BlocklistFeedMaxBytes))
+}
+
+// ParseFeed reads one number per line from a plain text or CSV feed, taking
+// the first column. Blank lines, "#" comments and headers are skipped.
+// A feed without any numbers is rejected so an error page can't empty the list.
+func ParseFeed(r io.Reader) ([]string, error) {
+	var numbers []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		field := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ';' || r == '\t'
+		})[0]
+		field = strings.Trim(strings.TrimSpace(field), `"`)
+
+		if isPhoneNumber(field) {
+			numbers = append(numbers, field)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(numbers) == 0 {
+		return nil, errors.New("feed contains no numbers")
+	}
+	return numbers, nil
+}
+
+// isPhoneNumber reports whether a field looks like a phone number: an optional
+// leading +, digits and common separators, with 7 to 15 digits as in E.164
+func isPhoneNumber(field string) bool {
+	digits := 0
+	for i, ch := range field {
+		switch {
+		case ch >= '0' && ch <= '9':
+			digits++
+		case ch == '+' && i == 0:
+		case ch == ' ' || ch == '-' || ch == '.' || ch == '(' || ch == ')':
+		default:
+			return false
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
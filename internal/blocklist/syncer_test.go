@@ -0,0 +1,138 @@
+package blocklist
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func setupTestDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	database, err := db.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	t.Cleanup(func() {
+		database.Close()
+	})
+
+	return database
+}
+
+func TestParseFeed(t *testing.T) {
+	feed := `# Community spam list
+number,reports,last_seen
++15551234567,42,2026-01-01
+"15557654321",3,2026-01-02
+(555) 010-9999;1
+
+not-a-number
+12345
+`
+	numbers, err := ParseFeed(strings.NewReader(feed))
+	if err != nil {
+		t.Fatalf("ParseFeed failed: %v", err)
+	}
+
+	want := []string{"+15551234567", "15557654321", "(555) 010-9999"}
+	if len(numbers) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, numbers)
+	}
+	for i := range want {
+		if numbers[i] != want[i] {
+			t.Errorf("Expected %q at %d, got %q", want[i], i, numbers[i])
+		}
+	}
+}
+
+func TestParseFeed_Empty(t *testing.T) {
+	if _, err := ParseFeed(strings.NewReader("<html>Service Unavailable</html>")); err == nil {
+		t.Error("Expected an error for a feed without numbers")
+	}
+}
+
+func TestSyncer_SyncFeed(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+
+	body := "+15551234567\n+15557654321\n"
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	feed := &models.BlocklistFeed{Name: "Spam", URL: server.URL, Enabled: true}
+	if err := database.BlocklistFeeds.Create(ctx, feed); err != nil {
+		t.Fatalf("Failed to create feed: %v", err)
+	}
+
+	syncer := NewSyncer(database)
+	if err := syncer.SyncFeed(ctx, feed); err != nil {
+		t.Fatalf("SyncFeed failed: %v", err)
+	}
+
+	synced, _ := database.BlocklistFeeds.GetByID(ctx, feed.ID)
+	if synced.Status != "ok" || synced.EntryCount != 2 {
+		t.Errorf("Expected ok with 2 entries, got %s with %d", synced.Status, synced.EntryCount)
+	}
+	if listed, _, _ := database.BlocklistFeeds.IsListed(ctx, "15551234567"); !listed {
+		t.Error("Expected number to be on the community blocklist")
+	}
+
+	// A failed refresh keeps the previous numbers and reports the error
+	status = http.StatusInternalServerError
+	if err := syncer.SyncFeed(ctx, feed); err == nil {
+		t.Fatal("Expected SyncFeed to fail")
+	}
+
+	failed, _ := database.BlocklistFeeds.GetByID(ctx, feed.ID)
+	if failed.Status != "error" || failed.LastError == nil || failed.EntryCount != 2 {
+		t.Errorf("Expected error status with 2 entries kept, got %+v", failed)
+	}
+	if listed, _, _ := database.BlocklistFeeds.IsListed(ctx, "+15551234567"); !listed {
+		t.Error("Expected numbers to be kept after a failed refresh")
+	}
+
+	// The next successful refresh replaces the numbers
+	status = http.StatusOK
+	body = "+15550000000\n"
+	if err := syncer.SyncFeed(ctx, feed); err != nil {
+		t.Fatalf("SyncFeed failed: %v", err)
+	}
+	if listed, _, _ := database.BlocklistFeeds.IsListed(ctx, "+15551234567"); listed {
+		t.Error("Expected stale number to be removed")
+	}
+}
+
+func TestSyncer_Due(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+	syncer := NewSyncer(database)
+
+	onHour := time.Date(2026, time.January, 5, 12, 0, 0, 0, time.UTC)
+	if syncer.due(ctx, onHour) {
+		t.Error("Expected no refresh while feeds are disabled")
+	}
+
+	database.Config.Set(ctx, "blocklist_feeds_enabled", "true")
+	if !syncer.due(ctx, onHour) {
+		t.Error("Expected refresh on the default schedule")
+	}
+	if syncer.due(ctx, onHour.Add(time.Hour)) {
+		t.Error("Expected no refresh outside the default schedule")
+	}
+}
@@ -0,0 +1,394 @@
+package calendar
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// maxRecurrencePeriods bounds the expansion of a recurring event, so a
+// daily event started years ago still reaches the sync window
+const maxRecurrencePeriods = 20000
+
+// property is a content line of an iCalendar object (RFC 5545)
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// event is the part of a VEVENT that decides when its owner is busy
+type event struct {
+	uid          string
+	start        time.Time
+	end          time.Time
+	duration     time.Duration
+	allDay       bool
+	rrule        string
+	exdates      []time.Time
+	recurrenceID *time.Time
+	free         bool // Transparent, cancelled or marked free
+}
+
+// ParseBusy returns the busy blocks of the events in an iCalendar object
+// that overlap [from, to). Recurring events are expanded. Events marked
+// transparent or free and cancelled events are left out.
+func ParseBusy(r io.Reader, from, to time.Time) ([]models.BusyBlock, error) {
+	events, err := parseEvents(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Modified instances of a recurring event replace the original occurrence
+	for _, e := range events {
+		if e.recurrenceID == nil {
+			continue
+		}
+		for _, master := range events {
+			if master.uid == e.uid && master.rrule != "" {
+				master.exdates = append(master.exdates, *e.recurrenceID)
+			}
+		}
+	}
+
+	var blocks []models.BusyBlock
+	for _, e := range events {
+		if e.free || e.start.IsZero() {
+			continue
+		}
+
+		end := e.end
+		switch {
+		case !end.IsZero():
+		case e.duration > 0:
+			end = e.start.Add(e.duration)
+		case e.allDay:
+			end = e.start.AddDate(0, 0, 1)
+		default:
+			continue
+		}
+		length := end.Sub(e.start)
+		if length <= 0 {
+			continue
+		}
+
+		occurrences := []time.Time{e.start}
+		if e.rrule != "" && e.recurrenceID == nil {
+			occurrences = expandRule(e.start, e.rrule, e.exdates, to)
+		}
+		for _, start := range occurrences {
+			block := models.BusyBlock{Start: start, End: start.Add(length)}
+			if block.Start.Before(to) && block.End.After(from) {
+				blocks = append(blocks, block)
+			}
+		}
+	}
+
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Start.Before(blocks[j].Start) })
+	return blocks, nil
+}
+
+// parseEvents reads the VEVENT components of an iCalendar object
+func parseEvents(r io.Reader) ([]*event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		events   []*event
+		current  *event
+		depth    int // Components nested inside the current VEVENT, such as VALARM
+		calendar bool
+	)
+	for _, line := range lines {
+		p, ok := parseProperty(line)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VCALENDAR"):
+			calendar = true
+		case p.name == "BEGIN" && current != nil:
+			depth++
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VEVENT"):
+			current = &event{}
+		case p.name == "END" && current != nil && depth > 0:
+			depth--
+		case p.name == "END" && current != nil && strings.EqualFold(p.value, "VEVENT"):
+			events = append(events, current)
+			current = nil
+		case current != nil && depth == 0:
+			current.apply(p)
+		}
+	}
+
+	// An HTML sign-in page must not be mistaken for an empty calendar
+	if !calendar {
+		return nil, errors.New("response is not an iCalendar object")
+	}
+	return events, nil
+}
+
+// apply sets the event field a property describes
+func (e *event) apply(p property) {
+	switch p.name {
+	case "UID":
+		e.uid = p.value
+	case "DTSTART":
+		e.start, e.allDay, _ = parseTime(p.value, p.params)
+	case "DTEND":
+		e.end, _, _ = parseTime(p.value, p.params)
+	case "DURATION":
+		e.duration, _ = parseDuration(p.value)
+	case "RRULE":
+		e.rrule = p.value
+	case "EXDATE":
+		for _, value := range strings.Split(p.value, ",") {
+			if t, _, err := parseTime(value, p.params); err == nil {
+				e.exdates = append(e.exdates, t)
+			}
+		}
+	case "RECURRENCE-ID":
+		if t, _, err := parseTime(p.value, p.params); err == nil {
+			e.recurrenceID = &t
+		}
+	case "TRANSP":
+		if strings.EqualFold(p.value, "TRANSPARENT") {
+			e.free = true
+		}
+	case "STATUS":
+		if strings.EqualFold(p.value, "CANCELLED") {
+			e.free = true
+		}
+	case "X-MICROSOFT-CDO-BUSYSTATUS":
+		if strings.EqualFold(p.value, "FREE") {
+			e.free = true
+		}
+	}
+}
+
+// unfold joins folded content lines, which continue with a space or tab
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseProperty splits a content line such as
+// DTSTART;TZID="America/New_York":20240101T090000 into its parts
+func parseProperty(line string) (property, bool) {
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return property{}, false
+	}
+
+	fields := strings.Split(line[:colon], ";")
+	p := property{
+		name:   strings.ToUpper(fields[0]),
+		params: make(map[string]string),
+		value:  line[colon+1:],
+	}
+	for _, param := range fields[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		p.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return p, true
+}
+
+// parseTime parses a DATE or DATE-TIME value. Floating times and unknown
+// TZIDs, such as Windows zone names, are read in the server's timezone.
+func parseTime(value string, params map[string]string) (time.Time, bool, error) {
+	loc := time.Local
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+
+	value = strings.TrimSpace(value)
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// parseDuration parses an RFC 5545 duration such as PT1H30M or P1D
+func parseDuration(value string) (time.Duration, error) {
+	value = strings.TrimPrefix(strings.TrimPrefix(value, "+"), "P")
+	var (
+		d      time.Duration
+		number string
+	)
+	for _, c := range value {
+		if c >= '0' && c <= '9' {
+			number += string(c)
+			continue
+		}
+		if c == 'T' {
+			continue
+		}
+
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return 0, errors.New("invalid duration")
+		}
+		number = ""
+		switch c {
+		case 'W':
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case 'D':
+			d += time.Duration(n) * 24 * time.Hour
+		case 'H':
+			d += time.Duration(n) * time.Hour
+		case 'M':
+			d += time.Duration(n) * time.Minute
+		case 'S':
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, errors.New("invalid duration")
+		}
+	}
+	return d, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// expandRule returns the occurrences of a recurring event that start
+// before until. DAILY, WEEKLY, MONTHLY and YEARLY rules with INTERVAL,
+// COUNT, UNTIL and plain BYDAY are supported; other rules only yield the
+// first occurrence.
+func expandRule(start time.Time, rule string, exdates []time.Time, until time.Time) []time.Time {
+	parts := make(map[string]string)
+	for _, part := range strings.Split(rule, ";") {
+		key, value, _ := strings.Cut(part, "=")
+		parts[strings.ToUpper(key)] = strings.ToUpper(value)
+	}
+
+	interval, err := strconv.Atoi(parts["INTERVAL"])
+	if err != nil || interval < 1 {
+		interval = 1
+	}
+	count, _ := strconv.Atoi(parts["COUNT"])
+	var ruleEnd time.Time
+	if parts["UNTIL"] != "" {
+		ruleEnd, _, _ = parseTime(parts["UNTIL"], map[string]string{})
+	}
+
+	var byDay []time.Weekday
+	for _, day := range strings.Split(parts["BYDAY"], ",") {
+		// Ordinal days such as 1MO or -1FR are treated as every such weekday
+		day = strings.TrimLeft(day, "+-0123456789")
+		if wd, ok := weekdays[day]; ok {
+			byDay = append(byDay, wd)
+		}
+	}
+	sort.Slice(byDay, func(i, j int) bool {
+		return (byDay[i]+6)%7 < (byDay[j]+6)%7
+	})
+
+	var occurrences []time.Time
+	seen := 0
+	for period := 0; period < maxRecurrencePeriods; period++ {
+		n := period * interval
+		var candidates []time.Time
+		switch parts["FREQ"] {
+		case "DAILY":
+			day := start.AddDate(0, 0, n)
+			if len(byDay) == 0 || containsWeekday(byDay, day.Weekday()) {
+				candidates = append(candidates, day)
+			}
+		case "WEEKLY":
+			week := start.AddDate(0, 0, 7*n)
+			if len(byDay) == 0 {
+				candidates = append(candidates, week)
+				break
+			}
+			// Weeks start on Monday, the RFC 5545 default
+			monday := week.AddDate(0, 0, -int((week.Weekday()+6)%7))
+			for _, wd := range byDay {
+				candidates = append(candidates, monday.AddDate(0, 0, int((wd+6)%7)))
+			}
+		case "MONTHLY":
+			// Months without the start day, such as the 31st, are skipped
+			if month := start.AddDate(0, n, 0); month.Day() == start.Day() {
+				candidates = append(candidates, month)
+			}
+		case "YEARLY":
+			if year := start.AddDate(n, 0, 0); year.Day() == start.Day() {
+				candidates = append(candidates, year)
+			}
+		default:
+			return []time.Time{start}
+		}
+
+		for _, c := range candidates {
+			if c.Before(start) {
+				continue
+			}
+			if !c.Before(until) || (!ruleEnd.IsZero() && c.After(ruleEnd)) {
+				return occurrences
+			}
+			seen++
+			if count > 0 && seen > count {
+				return occurrences
+			}
+			if !containsTime(exdates, c) {
+				occurrences = append(occurrences, c)
+			}
+		}
+	}
+	return occurrences
+}
+
+func containsWeekday(days []time.Weekday, wd time.Weekday) bool {
+	for _, d := range days {
+		if d == wd {
+			return true
+		}
+	}
+	return false
+}
+
+func containsTime(times []time.Time, t time.Time) bool {
+	for _, x := range times {
+		if x.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
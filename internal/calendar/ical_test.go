@@ -0,0 +1,151 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustParseBusy(t *testing.T, ics string, from, to time.Time) []string {
+	t.Helper()
+	blocks, err := ParseBusy(strings.NewReader(ics), from, to)
+	if err != nil {
+		t.Fatalf("ParseBusy failed: %v", err)
+	}
+	var got []string
+	for _, b := range blocks {
+		got = append(got, b.Start.UTC().Format(time.RFC3339)+"/"+b.End.UTC().Format(time.RFC3339))
+	}
+	return got
+}
+
+func assertBlocks(t *testing.T, got, want []string) {
+	t.Helper()
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected blocks %v, got %v", want, got)
+	}
+}
+
+func TestParseBusy_Events(t *testing.T) {
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:meeting",
+		`DTSTART;TZID="America/New_York":20240102T090000`,
+		"DTEND;TZID=America/New_York:20240102T100000",
+		"BEGIN:VALARM",
+		"TRIGGER:-PT15M",
+		"END:VALARM",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:lunch",
+		"DTSTART:20240102T170000Z",
+		"DURATION:PT1H30M",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:holiday",
+		"DTSTART;VALUE=DATE:20240103",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:reminder",
+		"DTSTART:20240102T120000Z",
+		"DTEND:20240102T130000Z",
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:cancelled",
+		"DTSTART:20240102T140000Z",
+		"DTEND:20240102T150000Z",
+		"STATUS:CANCELLED",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:outside",
+		"DTSTART:20240201T140000Z",
+		"DTEND:20240201T150000Z",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	got := mustParseBusy(t, ics, from, to)
+
+	holiday := time.Date(2024, 1, 3, 0, 0, 0, 0, time.Local)
+	assertBlocks(t, got, []string{
+		"2024-01-02T14:00:00Z/2024-01-02T15:00:00Z",
+		"2024-01-02T17:00:00Z/2024-01-02T18:30:00Z",
+		holiday.UTC().Format(time.RFC3339) + "/" + holiday.AddDate(0, 0, 1).UTC().Format(time.RFC3339),
+	})
+}
+
+func TestParseBusy_Recurring(t *testing.T) {
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"DTSTART:20240101T150000Z",
+		"DTEND:20240101T151500Z",
+		"RRULE:FREQ=WEEKLY;BYDAY=MO,WE",
+		"EXDATE:20240103T150000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"RECURRENCE-ID:20240108T150000Z",
+		"DTSTART:20240108T160000Z",
+		"DTEND:20240108T161500Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:review",
+		"DTSTART:20240101T200000Z",
+		"DTEND:20240101T210000Z",
+		"RRULE:FREQ=DAILY;INTERVAL=2;COUNT=3",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)
+	got := mustParseBusy(t, ics, from, to)
+
+	assertBlocks(t, got, []string{
+		"2024-01-01T15:00:00Z/2024-01-01T15:15:00Z",
+		"2024-01-01T20:00:00Z/2024-01-01T21:00:00Z",
+		"2024-01-03T20:00:00Z/2024-01-03T21:00:00Z",
+		"2024-01-05T20:00:00Z/2024-01-05T21:00:00Z",
+		"2024-01-08T16:00:00Z/2024-01-08T16:15:00Z",
+		"2024-01-10T15:00:00Z/2024-01-10T15:15:00Z",
+	})
+}
+
+func TestParseBusy_FoldedLines(t *testing.T) {
+	ics := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:20240102T\r\n 090000Z\r\nDTEND:20240102T100000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	got := mustParseBusy(t, ics, from, from.AddDate(0, 0, 7))
+	assertBlocks(t, got, []string{"2024-01-02T09:00:00Z/2024-01-02T10:00:00Z"})
+}
+
+func TestParseBusy_NotCalendar(t *testing.T) {
+	_, err := ParseBusy(strings.NewReader("<html><body>Sign in</body></html>"), time.Now(), time.Now().Add(time.Hour))
+	if err == nil {
+		t.Error("Expected error for non-calendar response")
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"PT1H30M", 90 * time.Minute},
+		{"P1D", 24 * time.Hour},
+		{"P1W", 7 * 24 * time.Hour},
+		{"P1DT2H", 26 * time.Hour},
+		{"PT45S", 45 * time.Second},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
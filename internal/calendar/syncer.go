@@ -0,0 +1,201 @@
+// Package calendar syncs users' linked CalDAV and Google calendars into
+// busy blocks for availability-based routing
+package calendar
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// Syncer downloads linked calendars into busy blocks
+type Syncer struct {
+	database *db.DB
+	client   *http.Client
+
+	// mu serializes syncs so scheduled and manual syncs don't interleave
+	mu sync.Mutex
+}
+
+// NewSyncer creates a new Syncer
+func NewSyncer(database *db.DB) *Syncer {
+	return &Syncer{
+		database: database,
+		client:   &http.Client{Timeout: config.CalendarSyncTimeout},
+	}
+}
+
+// Start syncs all enabled calendars every CalendarSyncInterval
+func (s *Syncer) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(config.CalendarSyncInterval)
+		defer ticker.Stop()
+
+		s.SyncAll(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.SyncAll(ctx)
+			}
+		}
+	}()
+}
+
+// SyncAll syncs every enabled calendar. Failures are recorded on the calendar.
+func (s *Syncer) SyncAll(ctx context.Context) {
+	calendars, err := s.database.Calendars.ListEnabled(ctx)
+	if err != nil {
+		slog.Error("Failed to list calendars", "error", err)
+		return
+	}
+
+	for _, cal := range calendars {
+		if err := s.SyncCalendar(ctx, cal); err != nil {
+			slog.Warn("Calendar sync failed", "user_id", cal.UserID, "provider", cal.Provider, "error", err)
+		}
+	}
+}
+
+// SyncCalendar downloads the busy blocks of a calendar from shortly before
+// now until CalendarSyncWindow ahead. On failure the blocks from the last
+// successful sync are kept and the error is recorded.
+func (s *Syncer) SyncCalendar(ctx context.Context, cal *models.UserCalendar) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	from, to := now.Add(-time.Hour), now.Add(config.CalendarSyncWindow)
+
+	var (
+		blocks []models.BusyBlock
+		err    error
+	)
+	switch cal.Provider {
+	case db.CalendarProviderCalDAV:
+		blocks, err = s.fetchCalDAV(ctx, cal, from, to)
+	case db.CalendarProviderGoogle:
+		blocks, err = s.fetchICS(ctx, cal, from, to)
+	default:
+		err = fmt.Errorf("unknown calendar provider %q", cal.Provider)
+	}
+	if err != nil {
+		if recErr := s.database.Calendars.RecordFailure(ctx, cal.ID, err.Error()); recErr != nil {
+			return recErr
+		}
+		return err
+	}
+
+	return s.database.Calendars.RecordSuccess(ctx, cal.ID, blocks)
+}
+
+// fetchICS downloads an iCalendar feed, such as the secret iCal address of
+// a Google calendar
+func (s *Syncer) fetchICS(ctx context.Context, cal *models.UserCalendar, from, to time.Time) ([]models.BusyBlock, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cal.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := s.do(req, cal, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return ParseBusy(bytes.NewReader(body), from, to)
+}
+
+// calendarQuery asks a CalDAV server for the events in a time range, with
+// recurring events expanded by the server (RFC 4791 section 7.8)
+const calendarQuery = `<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <C:calendar-data>
+      <C:expand start="%[1]s" end="%[2]s"/>
+    </C:calendar-data>
+  </D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VEVENT">
+        <C:time-range start="%[1]s" end="%[2]s"/>
+      </C:comp-filter>
+    </C:comp-filter>
+  </C:filter>
+</C:calendar-query>`
+
+// multistatus is the part of a WebDAV Multi-Status response that carries calendar data
+type multistatus struct {
+	Responses []struct {
+		Propstats []struct {
+			CalendarData string `xml:"prop>calendar-data"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// fetchCalDAV runs a calendar-query REPORT against a CalDAV calendar collection
+func (s *Syncer) fetchCalDAV(ctx context.Context, cal *models.UserCalendar, from, to time.Time) ([]models.BusyBlock, error) {
+	const layout = "20060102T150405Z"
+	query := fmt.Sprintf(calendarQuery, from.UTC().Format(layout), to.UTC().Format(layout))
+
+	req, err := http.NewRequestWithContext(ctx, "REPORT", cal.URL, strings.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", "1")
+
+	body, err := s.do(req, cal, http.StatusMultiStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	var ms multistatus
+	if err := xml.Unmarshal(body, &ms); err != nil {
+		return nil, fmt.Errorf("invalid CalDAV response: %w", err)
+	}
+
+	var blocks []models.BusyBlock
+	for _, resp := range ms.Responses {
+		for _, ps := range resp.Propstats {
+			if strings.TrimSpace(ps.CalendarData) == "" {
+				continue
+			}
+			found, err := ParseBusy(strings.NewReader(ps.CalendarData), from, to)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, found...)
+		}
+	}
+	return blocks, nil
+}
+
+// do sends a request with the calendar's credentials and reads the body,
+// failing unless the server answers with the expected status
+func (s *Syncer) do(req *http.Request, cal *models.UserCalendar, expected int) ([]byte, error) {
+	req.Header.Set("User-Agent", config.DefaultUserAgent)
+	if cal.Username != "" || cal.Password != "" {
+		req.SetBasicAuth(cal.Username, cal.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != expected {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, config.CalendarMaxBytes))
+}
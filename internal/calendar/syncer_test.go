@@ -0,0 +1,150 @@
+package calendar
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func setupTestDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	database, err := db.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	t.Cleanup(func() {
+		database.Close()
+	})
+
+	return database
+}
+
+func linkCalendar(t *testing.T, database *db.DB, cal *models.UserCalendar) *models.UserCalendar {
+	t.Helper()
+
+	user := &models.User{Email: "user@example.com", PasswordHash: "hash", Role: "user"}
+	if err := database.Users.Create(context.Background(), user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	cal.UserID = user.ID
+	cal.Enabled = true
+	if err := database.Calendars.Save(context.Background(), cal); err != nil {
+		t.Fatalf("Failed to save calendar: %v", err)
+	}
+	return cal
+}
+
+// eventNow is an iCalendar object with one event in progress
+func eventNow() string {
+	const layout = "20060102T150405Z"
+	now := time.Now().UTC()
+	return fmt.Sprintf("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:now\r\nDTSTART:%s\r\nDTEND:%s\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+		now.Add(-10*time.Minute).Format(layout), now.Add(50*time.Minute).Format(layout))
+}
+
+func TestSyncer_SyncCalendar_Google(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/calendar")
+		io.WriteString(w, eventNow())
+	}))
+	defer server.Close()
+
+	database := setupTestDB(t)
+	cal := linkCalendar(t, database, &models.UserCalendar{Provider: db.CalendarProviderGoogle, URL: server.URL + "/basic.ics"})
+
+	if err := NewSyncer(database).SyncCalendar(context.Background(), cal); err != nil {
+		t.Fatalf("SyncCalendar failed: %v", err)
+	}
+
+	busy, err := database.Calendars.IsUserBusy(context.Background(), cal.UserID, time.Now())
+	if err != nil || !busy {
+		t.Errorf("Expected user to be busy, got %v (%v)", busy, err)
+	}
+	if busy, _ := database.Calendars.IsUserBusy(context.Background(), cal.UserID, time.Now().Add(2*time.Hour)); busy {
+		t.Error("Expected user to be free after the event")
+	}
+
+	saved, _ := database.Calendars.GetByUser(context.Background(), cal.UserID)
+	if saved.Status != "ok" {
+		t.Errorf("Expected status ok, got %q", saved.Status)
+	}
+}
+
+func TestSyncer_SyncCalendar_CalDAV(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if r.Method != "REPORT" || r.Header.Get("Depth") != "1" || !ok || user != "alice" || pass != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), "calendar-query") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>
+<D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:response>
+    <D:href>/calendars/alice/default/now.ics</D:href>
+    <D:propstat>
+      <D:prop><C:calendar-data>%s</C:calendar-data></D:prop>
+      <D:status>HTTP/1.1 200 OK</D:status>
+    </D:propstat>
+  </D:response>
+</D:multistatus>`, eventNow())
+	}))
+	defer server.Close()
+
+	database := setupTestDB(t)
+	cal := linkCalendar(t, database, &models.UserCalendar{
+		Provider: db.CalendarProviderCalDAV,
+		URL:      server.URL + "/calendars/alice/default/",
+		Username: "alice",
+		Password: "secret",
+	})
+
+	if err := NewSyncer(database).SyncCalendar(context.Background(), cal); err != nil {
+		t.Fatalf("SyncCalendar failed: %v", err)
+	}
+
+	busy, err := database.Calendars.IsUserBusy(context.Background(), cal.UserID, time.Now())
+	if err != nil || !busy {
+		t.Errorf("Expected user to be busy, got %v (%v)", busy, err)
+	}
+}
+
+func TestSyncer_SyncCalendar_Failure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	database := setupTestDB(t)
+	cal := linkCalendar(t, database, &models.UserCalendar{Provider: db.CalendarProviderCalDAV, URL: server.URL})
+
+	if err := NewSyncer(database).SyncCalendar(context.Background(), cal); err == nil {
+		t.Fatal("Expected sync to fail")
+	}
+
+	saved, _ := database.Calendars.GetByUser(context.Background(), cal.UserID)
+	if saved.Status != "error" || saved.LastError == nil {
+		t.Errorf("Expected recorded error, got status %q", saved.Status)
+	}
+}
@@ -0,0 +1,69 @@
+// Package changesets applies scheduled change sets when they are due and
+// reverts them at their revert time
+package changesets
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+)
+
+// Scheduler periodically applies and reverts due change sets
+type Scheduler struct {
+	database *db.DB
+}
+
+// NewScheduler creates a Scheduler
+func NewScheduler(database *db.DB) *Scheduler {
+	return &Scheduler{database: database}
+}
+
+// Start runs due change sets now and then every ChangeSetCheckInterval
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(config.ChangeSetCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			s.Run(ctx, time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Run applies the pending change sets due at now and reverts the applied
+// ones whose revert time has passed
+func (s *Scheduler) Run(ctx context.Context, now time.Time) {
+	due, err := s.database.ChangeSets.ListDue(ctx, now)
+	if err != nil {
+		slog.Warn("Failed to list due change sets", "error", err)
+		return
+	}
+
+	for _, cs := range due {
+		if cs.Status == db.ChangeSetPending {
+			if err := s.database.ChangeSets.Apply(ctx, cs.ID, now); err != nil {
+				slog.Error("Failed to apply change set", "id", cs.ID, "name", cs.Name, "error", err)
+				continue
+			}
+			slog.Info("Change set applied", "id", cs.ID, "name", cs.Name, "changes", len(cs.Changes))
+			// A change set whose revert time has already passed is reverted right away
+			if cs.RevertAt == nil || cs.RevertAt.After(now) {
+				continue
+			}
+		}
+
+		if err := s.database.ChangeSets.Revert(ctx, cs.ID, now); err != nil {
+			slog.Error("Failed to revert change set", "id", cs.ID, "name", cs.Name, "error", err)
+			continue
+		}
+		slog.Info("Change set reverted", "id", cs.ID, "name", cs.Name)
+	}
+}
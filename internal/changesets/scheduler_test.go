@@ -0,0 +1,101 @@
+package changesets
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// setupTestDB creates an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	database, err := db.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Close()
+	})
+	return database
+}
+
+func TestScheduler_Run(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+	now := time.Date(2026, 12, 24, 17, 0, 0, 0, time.UTC)
+
+	greeting := "We're closed for the holidays"
+	revertAt := now.Add(48 * time.Hour)
+	holiday := &models.ChangeSet{
+		Name:     "Holiday greeting",
+		ApplyAt:  now,
+		RevertAt: &revertAt,
+		Changes:  []models.Change{{Type: db.ChangeSetting, Key: "voicemail_greeting", Value: &greeting}},
+	}
+	later := &models.ChangeSet{
+		Name:    "Later",
+		ApplyAt: now.Add(time.Hour),
+		Changes: []models.Change{{Type: db.ChangeSetting, Key: "timezone", Value: &greeting}},
+	}
+	for _, cs := range []*models.ChangeSet{holiday, later} {
+		if err := database.ChangeSets.Create(ctx, cs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewScheduler(database)
+	s.Run(ctx, now)
+	if v, _ := database.Config.Get(ctx, "voicemail_greeting"); v != greeting {
+		t.Errorf("Expected the greeting to be applied, got %q", v)
+	}
+	if cs, _ := database.ChangeSets.GetByID(ctx, later.ID); cs.Status != db.ChangeSetPending {
+		t.Errorf("Expected the later change set to wait, got %s", cs.Status)
+	}
+
+	s.Run(ctx, revertAt)
+	if _, err := database.Config.Get(ctx, "voicemail_greeting"); err == nil {
+		t.Error("Expected the greeting to be removed again at the revert time")
+	}
+	if cs, _ := database.ChangeSets.GetByID(ctx, holiday.ID); cs.Status != db.ChangeSetReverted {
+		t.Errorf("Expected reverted, got %s", cs.Status)
+	}
+	if cs, _ := database.ChangeSets.GetByID(ctx, later.ID); cs.Status != db.ChangeSetApplied {
+		t.Errorf("Expected the later change set to be applied, got %s", cs.Status)
+	}
+}
+
+func TestScheduler_Run_RevertTimePassed(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+	now := time.Date(2026, 12, 24, 17, 0, 0, 0, time.UTC)
+
+	// The server was down for the whole window
+	value := "fr"
+	revertAt := now.Add(-time.Hour)
+	cs := &models.ChangeSet{
+		Name:     "Missed",
+		ApplyAt:  now.Add(-2 * time.Hour),
+		RevertAt: &revertAt,
+		Changes:  []models.Change{{Type: db.ChangeSetting, Key: "default_language", Value: &value}},
+	}
+	if err := database.ChangeSets.Create(ctx, cs); err != nil {
+		t.Fatal(err)
+	}
+
+	before, _ := database.Config.Get(ctx, "default_language")
+	NewScheduler(database).Run(ctx, now)
+	got, _ := database.ChangeSets.GetByID(ctx, cs.ID)
+	if got.Status != db.ChangeSetReverted {
+		t.Errorf("Expected reverted, got %s", got.Status)
+	}
+	if v, _ := database.Config.Get(ctx, "default_language"); v != before {
+		t.Errorf("Expected the setting to be left as %q, got %q", before, v)
+	}
+}
@@ -0,0 +1,123 @@
+// Package channels describes the messaging channels GoSIP stores messages
+// for and the limits each one places on outbound messages
+package channels
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Channel names
+const (
+	SMS        = "sms"
+	MMS        = "mms"
+	WhatsApp   = "whatsapp"
+	SIPMessage = "sip-message"
+	Internal   = "internal"
+)
+
+// Capabilities describes what a channel supports
+type Capabilities struct {
+	Name string `json:"name"`
+	// Sendable channels can be used for outbound messages from the API
+	Sendable bool `json:"sendable"`
+	// MaxBodyLength is the longest body in characters; 0 means no limit
+	MaxBodyLength int `json:"max_body_length,omitempty"`
+	// MaxMediaCount is the most attachments per message; 0 means text only
+	MaxMediaCount int `json:"max_media_count"`
+	// MaxMediaBytes is the largest total attachment size
+	MaxMediaBytes int64 `json:"max_media_bytes,omitempty"`
+	// ReadReceipts channels report when the recipient reads a message
+	ReadReceipts bool `json:"read_receipts"`
+}
+
+// registry holds the known channels. Limits follow Twilio's for the channels
+// it carries.
+var registry = map[string]Capabilities{
+	SMS:        {Name: SMS, Sendable: true, MaxBodyLength: 1600},
+	MMS:        {Name: MMS, Sendable: true, MaxBodyLength: 1600, MaxMediaCount: 10, MaxMediaBytes: 5 << 20},
+	WhatsApp:   {Name: WhatsApp, Sendable: true, MaxBodyLength: 4096, MaxMediaCount: 1, MaxMediaBytes: 16 << 20, ReadReceipts: true},
+	SIPMessage: {Name: SIPMessage, MaxBodyLength: 1300, ReadReceipts: true},
+	Internal:   {Name: Internal, ReadReceipts: true},
+}
+
+// Lookup returns the capabilities of a channel
+func Lookup(name string) (Capabilities, bool) {
+	c, ok := registry[name]
+	return c, ok
+}
+
+// All returns every channel, sorted by name
+func All() []Capabilities {
+	all := make([]Capabilities, 0, len(registry))
+	for _, c := range registry {
+		all = append(all, c)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// Default returns the channel Twilio messages use when none is given
+func Default(hasMedia bool) string {
+	if hasMedia {
+		return MMS
+	}
+	return SMS
+}
+
+// whatsAppPrefix marks WhatsApp addresses in Twilio requests and webhooks
+const whatsAppPrefix = "whatsapp:"
+
+// Address returns the Twilio address of a number on a channel
+func Address(channel, number string) string {
+	if channel == WhatsApp && strings.HasPrefix(number, "+") {
+		return whatsAppPrefix + number
+	}
+	return number
+}
+
+// ParseAddress splits a Twilio webhook address into its channel and number.
+// Plain numbers report an empty channel.
+func ParseAddress(address string) (channel, number string) {
+	if rest, ok := strings.CutPrefix(address, whatsAppPrefix); ok {
+		return WhatsApp, rest
+	}
+	return "", address
+}
+
+// Check returns the limits an outbound message breaks, without the media
+// size limit
+func (c Capabilities) Check(body string, mediaCount int) []string {
+	var violations []string
+	if c.MaxBodyLength > 0 && len([]rune(body)) > c.MaxBodyLength {
+		violations = append(violations, fmt.Sprintf("Message body must be at most %d characters", c.MaxBodyLength))
+	}
+	switch {
+	case mediaCount > 0 && c.MaxMediaCount == 0:
+		violations = append(violations, fmt.Sprintf("The %s channel doesn't support media", c.Name))
+	case mediaCount > c.MaxMediaCount:
+		violations = append(violations, fmt.Sprintf("At most %d media attachments are allowed", c.MaxMediaCount))
+	}
+	return violations
+}
+
+// MediaSize returns the size an attachment URL reports, or -1 when it
+// doesn't say
+func MediaSize(ctx context.Context, client *http.Client, url string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("media returned HTTP %d", resp.StatusCode)
+	}
+	return resp.ContentLength, nil
+}
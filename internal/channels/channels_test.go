@@ -0,0 +1,76 @@
+package channels
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCapabilities_Check(t *testing.T) {
+	sms, _ := Lookup(SMS)
+	mms, _ := Lookup(MMS)
+	whatsapp, _ := Lookup(WhatsApp)
+
+	tests := []struct {
+		name       string
+		caps       Capabilities
+		body       string
+		mediaCount int
+		want       int
+	}{
+		{"sms text", sms, "Hello", 0, 0},
+		{"sms with media", sms, "Hello", 1, 1},
+		{"sms too long", sms, strings.Repeat("a", 1601), 0, 1},
+		{"mms with media", mms, "", 3, 0},
+		{"mms too many attachments", mms, "", 11, 1},
+		{"whatsapp two attachments", whatsapp, "", 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.caps.Check(tt.body, tt.mediaCount); len(got) != tt.want {
+				t.Errorf("Expected %d violations, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAddress(t *testing.T) {
+	if got := Address(WhatsApp, "+15551234567"); got != "whatsapp:+15551234567" {
+		t.Errorf("Unexpected WhatsApp address %q", got)
+	}
+	if got := Address(WhatsApp, "MG0123456789abcdef0123456789abcdef"); got != "MG0123456789abcdef0123456789abcdef" {
+		t.Errorf("Messaging Service SIDs should not be prefixed, got %q", got)
+	}
+	if got := Address(SMS, "+15551234567"); got != "+15551234567" {
+		t.Errorf("Unexpected SMS address %q", got)
+	}
+
+	channel, number := ParseAddress("whatsapp:+15551234567")
+	if channel != WhatsApp || number != "+15551234567" {
+		t.Errorf("Unexpected parse result %q %q", channel, number)
+	}
+	channel, number = ParseAddress("+15551234567")
+	if channel != "" || number != "+15551234567" {
+		t.Errorf("Unexpected parse result %q %q", channel, number)
+	}
+}
+
+func TestMediaSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("Expected HEAD request, got %s", r.Method)
+		}
+		w.Header().Set("Content-Length", "2048")
+	}))
+	defer server.Close()
+
+	size, err := MediaSize(context.Background(), server.Client(), server.URL+"/photo.jpg")
+	if err != nil {
+		t.Fatalf("MediaSize failed: %v", err)
+	}
+	if size != 2048 {
+		t.Errorf("Expected 2048 bytes, got %d", size)
+	}
+}
@@ -0,0 +1,87 @@
+package codec
+
+import (
+	"errors"
+	"math"
+)
+
+// CN is the comfort noise payload format (RFC 3389). It carries the level
+// of the background noise during silence rather than audio.
+var CN = Codec{Name: "CN", PayloadType: 13, ClockRate: 8000, SampleRate: 8000}
+
+// MaxNoiseLevel is the quietest comfort noise level, in -dBov
+const MaxNoiseLevel = 127
+
+// errEmptyCN is returned for CN payloads without a noise level
+var errEmptyCN = errors.New("empty comfort noise payload")
+
+// NoiseLevel returns the level of pcm in -dBov (0 is a full scale signal,
+// MaxNoiseLevel digital silence), as carried in CN payloads
+func NoiseLevel(pcm []int16) int {
+	if len(pcm) == 0 {
+		return MaxNoiseLevel
+	}
+	var sum float64
+	for _, sample := range pcm {
+		sum += float64(sample) * float64(sample)
+	}
+	rms := math.Sqrt(sum / float64(len(pcm)))
+	if rms < 1 {
+		return MaxNoiseLevel
+	}
+	level := int(math.Round(-20 * math.Log10(rms/32768)))
+	if level < 0 {
+		return 0
+	}
+	if level > MaxNoiseLevel {
+		return MaxNoiseLevel
+	}
+	return level
+}
+
+// ComfortNoisePayload returns a CN payload for noise at level -dBov. GoSIP
+// sends no spectral information, so receivers generate white noise.
+func ComfortNoisePayload(level int) []byte {
+	if level < 0 {
+		level = 0
+	} else if level > MaxNoiseLevel {
+		level = MaxNoiseLevel
+	}
+	return []byte{byte(level)}
+}
+
+// ParseComfortNoise returns the noise level of a CN payload
+func ParseComfortNoise(payload []byte) (int, error) {
+	if len(payload) == 0 {
+		return 0, errEmptyCN
+	}
+	return int(payload[0] & 0x7F), nil
+}
+
+// NoiseGenerator produces white noise at a comfort noise level, for
+// endpoints that don't understand CN payloads. Its output is deterministic.
+type NoiseGenerator struct {
+	amplitude float64
+	seed      uint32
+}
+
+// NewNoiseGenerator creates a NoiseGenerator for noise at level -dBov
+func NewNoiseGenerator(level int) *NoiseGenerator {
+	rms := 32768 * math.Pow(10, -float64(level)/20)
+	// Uniform noise in [-a, a] has an RMS of a/√3
+	return &NoiseGenerator{amplitude: rms * math.Sqrt(3), seed: 0x2545F491}
+}
+
+// Generate returns n samples of noise
+func (g *NoiseGenerator) Generate(n int) []int16 {
+	pcm := make([]int16, n)
+	for i := range pcm {
+		// xorshift32
+		g.seed ^= g.seed << 13
+		g.seed ^= g.seed >> 17
+		g.seed ^= g.seed << 5
+		uniform := float64(g.seed)/float64(math.MaxUint32)*2 - 1
+		pcm[i] = int16(saturate(int(uniform * g.amplitude)))
+	}
+	return pcm
+}
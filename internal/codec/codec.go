@@ -0,0 +1,103 @@
+// Package codec provides the audio codecs of the GoSIP media stack and
+// transcoding between them
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupported is returned for codecs GoSIP can't encode or decode
+var ErrUnsupported = errors.New("unsupported codec")
+
+// Codec describes an RTP audio codec
+type Codec struct {
+	Name        string // SDP encoding name
+	PayloadType uint8  // Static payload type, or the dynamic type GoSIP offers
+	ClockRate   int    // RTP clock rate advertised in SDP
+	Channels    int    // Channels advertised in SDP (0 leaves them out)
+	SampleRate  int    // Rate of the PCM the encoder takes and the decoder returns
+	Wideband    bool   // Carries 50-7000 Hz audio rather than telephone band
+}
+
+// Codecs GoSIP can negotiate
+var (
+	PCMU = Codec{Name: "PCMU", PayloadType: 0, ClockRate: 8000, SampleRate: 8000}
+	PCMA = Codec{Name: "PCMA", PayloadType: 8, ClockRate: 8000, SampleRate: 8000}
+	// G.722 samples at 16 kHz but keeps an 8000 RTP clock for historical
+	// reasons (RFC 3551)
+	G722 = Codec{Name: "G722", PayloadType: 9, ClockRate: 8000, SampleRate: 16000, Wideband: true}
+	// Opus always advertises 48000/2 (RFC 7587); GoSIP runs it at 16 kHz mono
+	Opus = Codec{Name: "opus", PayloadType: 111, ClockRate: 48000, Channels: 2, SampleRate: 16000, Wideband: true}
+)
+
+var all = []Codec{Opus, G722, PCMU, PCMA}
+
+// Lookup returns the codec with an SDP encoding name, ignoring case
+func Lookup(name string) (Codec, bool) {
+	for _, c := range all {
+		if strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+	return Codec{}, false
+}
+
+// Available reports whether GoSIP can encode and decode a codec. Opus needs
+// a build with the opus tag and libopus.
+func Available(c Codec) bool {
+	if c.Name == Opus.Name {
+		return opusAvailable
+	}
+	_, ok := Lookup(c.Name)
+	return ok
+}
+
+// Rtpmap returns the a=rtpmap value of a codec, e.g. "PCMU/8000"
+func (c Codec) Rtpmap() string {
+	if c.Channels > 0 {
+		return fmt.Sprintf("%s/%d/%d", c.Name, c.ClockRate, c.Channels)
+	}
+	return fmt.Sprintf("%s/%d", c.Name, c.ClockRate)
+}
+
+// Encoder turns 16-bit PCM at the codec's SampleRate into RTP payloads
+type Encoder interface {
+	Encode(pcm []int16) ([]byte, error)
+}
+
+// Decoder turns RTP payloads into 16-bit PCM at the codec's SampleRate
+type Decoder interface {
+	Decode(payload []byte) ([]int16, error)
+}
+
+// NewEncoder creates an encoder for a codec
+func NewEncoder(c Codec) (Encoder, error) {
+	switch c.Name {
+	case PCMU.Name:
+		return ulawCodec{}, nil
+	case PCMA.Name:
+		return alawCodec{}, nil
+	case G722.Name:
+		return NewG722Encoder(), nil
+	case Opus.Name:
+		return newOpusEncoder()
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupported, c.Name)
+}
+
+// NewDecoder creates a decoder for a codec
+func NewDecoder(c Codec) (Decoder, error) {
+	switch c.Name {
+	case PCMU.Name:
+		return ulawCodec{}, nil
+	case PCMA.Name:
+		return alawCodec{}, nil
+	case G722.Name:
+		return NewG722Decoder(), nil
+	case Opus.Name:
+		return newOpusDecoder()
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupported, c.Name)
+}
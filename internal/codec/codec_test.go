@@ -0,0 +1,168 @@
+package codec
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// sine returns n samples of a tone at freq Hz sampled at rate
+func sine(freq, rate float64, n int) []int16 {
+	pcm := make([]int16, n)
+	for i := range pcm {
+		pcm[i] = int16(8000 * math.Sin(2*math.Pi*freq*float64(i)/rate))
+	}
+	return pcm
+}
+
+// snr returns the signal to noise ratio in dB of got against want, after
+// shifting got by the delay that matches them best
+func snr(want, got []int16, maxDelay int) float64 {
+	best := math.Inf(-1)
+	for delay := 0; delay <= maxDelay; delay++ {
+		var signal, noise float64
+		for i := maxDelay; i+delay < len(got) && i < len(want); i++ {
+			s := float64(want[i])
+			e := s - float64(got[i+delay])
+			signal += s * s
+			noise += e * e
+		}
+		if noise == 0 {
+			return math.Inf(1)
+		}
+		if r := 10 * math.Log10(signal/noise); r > best {
+			best = r
+		}
+	}
+	return best
+}
+
+func TestG711_RoundTrip(t *testing.T) {
+	pcm := sine(1000, 8000, 800)
+	for _, c := range []Codec{PCMU, PCMA} {
+		enc, _ := NewEncoder(c)
+		dec, _ := NewDecoder(c)
+		payload, _ := enc.Encode(pcm)
+		if len(payload) != len(pcm) {
+			t.Fatalf("%s: payload is %d bytes, want %d", c.Name, len(payload), len(pcm))
+		}
+		out, _ := dec.Decode(payload)
+		if r := snr(pcm, out, 0); r < 30 {
+			t.Errorf("%s: SNR %.1f dB, want at least 30", c.Name, r)
+		}
+	}
+
+	// Silence has well known encodings
+	if b := LinearToUlaw(0); b != 0xFF {
+		t.Errorf("LinearToUlaw(0) = %#x, want 0xff", b)
+	}
+	if b := LinearToAlaw(0); b != 0xD5 {
+		t.Errorf("LinearToAlaw(0) = %#x, want 0xd5", b)
+	}
+}
+
+func TestG722_RoundTrip(t *testing.T) {
+	for _, freq := range []float64{400, 1000, 5000} {
+		pcm := sine(freq, 16000, 3200)
+		payload, _ := NewG722Encoder().Encode(pcm)
+		if len(payload) != len(pcm)/2 {
+			t.Fatalf("payload is %d bytes, want %d", len(payload), len(pcm)/2)
+		}
+		out, _ := NewG722Decoder().Decode(payload)
+		if len(out) != len(pcm) {
+			t.Fatalf("decoded %d samples, want %d", len(out), len(pcm))
+		}
+		if r := snr(pcm, out, 64); r < 20 {
+			t.Errorf("%v Hz: SNR %.1f dB, want at least 20", freq, r)
+		}
+	}
+}
+
+func TestTranscoder(t *testing.T) {
+	narrow := sine(1000, 8000, 1600)
+	toWide, err := NewTranscoder(PCMU, G722)
+	if err != nil {
+		t.Fatalf("NewTranscoder failed: %v", err)
+	}
+	toNarrow, err := NewTranscoder(G722, PCMA)
+	if err != nil {
+		t.Fatalf("NewTranscoder failed: %v", err)
+	}
+
+	var out []int16
+	// 20 ms frames, as they arrive in RTP
+	for i := 0; i < len(narrow); i += 160 {
+		ulaw, _ := ulawCodec{}.Encode(narrow[i : i+160])
+		wide, err := toWide.Transcode(ulaw)
+		if err != nil || len(wide) != 160 {
+			t.Fatalf("PCMU to G722 gave %d bytes, %v", len(wide), err)
+		}
+		alaw, err := toNarrow.Transcode(wide)
+		if err != nil || len(alaw) != 160 {
+			t.Fatalf("G722 to PCMA gave %d bytes, %v", len(alaw), err)
+		}
+		pcm, _ := alawCodec{}.Decode(alaw)
+		out = append(out, pcm...)
+	}
+	if r := snr(narrow, out, 48); r < 10 {
+		t.Errorf("SNR after transcoding %.1f dB, want at least 10", r)
+	}
+
+	same, _ := NewTranscoder(PCMU, PCMU)
+	if got, _ := same.Transcode([]byte{1, 2, 3}); len(got) != 3 {
+		t.Errorf("Expected the payload to pass through, got %v", got)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if c, ok := Lookup("g722"); !ok || c.PayloadType != 9 || c.Rtpmap() != "G722/8000" {
+		t.Errorf("Lookup(g722) = %+v, %v", c, ok)
+	}
+	if c, _ := Lookup("OPUS"); c.Rtpmap() != "opus/48000/2" {
+		t.Errorf("Opus rtpmap = %q", c.Rtpmap())
+	}
+	if _, ok := Lookup("G729"); ok {
+		t.Error("Expected G729 to be unknown")
+	}
+
+	if Available(Opus) != opusAvailable || !Available(G722) {
+		t.Error("Unexpected codec availability")
+	}
+	if !opusAvailable {
+		if _, err := NewEncoder(Opus); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Expected ErrUnsupported without libopus, got %v", err)
+		}
+	}
+}
+
+func TestComfortNoise(t *testing.T) {
+	if level := NoiseLevel(make([]int16, 160)); level != MaxNoiseLevel {
+		t.Errorf("NoiseLevel(silence) = %d, want %d", level, MaxNoiseLevel)
+	}
+	// A full scale square wave is 0 dBov
+	square := make([]int16, 160)
+	for i := range square {
+		square[i] = 32767
+		if i%2 == 1 {
+			square[i] = -32767
+		}
+	}
+	if level := NoiseLevel(square); level != 0 {
+		t.Errorf("NoiseLevel(full scale) = %d, want 0", level)
+	}
+
+	// Generated noise comes out at the level asked for
+	for _, want := range []int{30, 70} {
+		if got := NoiseLevel(NewNoiseGenerator(want).Generate(1600)); got < want-1 || got > want+1 {
+			t.Errorf("Noise generated at %d -dBov measures %d", want, got)
+		}
+	}
+
+	payload := ComfortNoisePayload(200)
+	if level, err := ParseComfortNoise(payload); err != nil || level != MaxNoiseLevel {
+		t.Errorf("ParseComfortNoise = %d, %v; want %d", level, err, MaxNoiseLevel)
+	}
+	if _, err := ParseComfortNoise(nil); err == nil {
+		t.Error("Expected an error for an empty CN payload")
+	}
+}
@@ -0,0 +1,126 @@
+package codec
+
+// G.711 companding, after the ITU-T reference and Sun's public domain g711.c
+
+const (
+	ulawBias = 0x84
+	ulawClip = 32635
+)
+
+// LinearToUlaw compresses a 16-bit sample to μ-law
+func LinearToUlaw(sample int16) byte {
+	pcm := int(sample)
+	sign := 0
+	if pcm < 0 {
+		pcm = -pcm
+		sign = 0x80
+	}
+	if pcm > ulawClip {
+		pcm = ulawClip
+	}
+	pcm += ulawBias
+
+	exponent := 7
+	for mask := 0x4000; pcm&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (pcm >> (exponent + 3)) & 0x0F
+	return ^byte(sign | exponent<<4 | mantissa)
+}
+
+// UlawToLinear expands a μ-law sample to 16 bits
+func UlawToLinear(u byte) int16 {
+	u = ^u
+	t := (int(u&0x0F) << 3) + ulawBias
+	t <<= (u & 0x70) >> 4
+	if u&0x80 != 0 {
+		return int16(ulawBias - t)
+	}
+	return int16(t - ulawBias)
+}
+
+// alawSegmentEnds are the upper bounds of the A-law segments of a 13-bit sample
+var alawSegmentEnds = [8]int{0x1F, 0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF}
+
+// LinearToAlaw compresses a 16-bit sample to A-law
+func LinearToAlaw(sample int16) byte {
+	pcm := int(sample) >> 3
+	mask := 0xD5
+	if pcm < 0 {
+		mask = 0x55
+		pcm = -pcm - 1
+	}
+
+	segment := 0
+	for segment < len(alawSegmentEnds) && pcm > alawSegmentEnds[segment] {
+		segment++
+	}
+	if segment >= len(alawSegmentEnds) {
+		return byte(0x7F ^ mask)
+	}
+
+	aval := segment << 4
+	if segment < 2 {
+		aval |= (pcm >> 1) & 0x0F
+	} else {
+		aval |= (pcm >> segment) & 0x0F
+	}
+	return byte(aval ^ mask)
+}
+
+// AlawToLinear expands an A-law sample to 16 bits
+func AlawToLinear(a byte) int16 {
+	a ^= 0x55
+	t := int(a&0x0F) << 4
+	switch segment := int(a&0x70) >> 4; segment {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= segment - 1
+	}
+	if a&0x80 != 0 {
+		return int16(t)
+	}
+	return int16(-t)
+}
+
+// ulawCodec encodes and decodes G.711 μ-law, one byte per sample
+type ulawCodec struct{}
+
+func (ulawCodec) Encode(pcm []int16) ([]byte, error) {
+	out := make([]byte, len(pcm))
+	for i, sample := range pcm {
+		out[i] = LinearToUlaw(sample)
+	}
+	return out, nil
+}
+
+func (ulawCodec) Decode(payload []byte) ([]int16, error) {
+	out := make([]int16, len(payload))
+	for i, b := range payload {
+		out[i] = UlawToLinear(b)
+	}
+	return out, nil
+}
+
+// alawCodec encodes and decodes G.711 A-law, one byte per sample
+type alawCodec struct{}
+
+func (alawCodec) Encode(pcm []int16) ([]byte, error) {
+	out := make([]byte, len(pcm))
+	for i, sample := range pcm {
+		out[i] = LinearToAlaw(sample)
+	}
+	return out, nil
+}
+
+func (alawCodec) Decode(payload []byte) ([]int16, error) {
+	out := make([]int16, len(payload))
+	for i, b := range payload {
+		out[i] = AlawToLinear(b)
+	}
+	return out, nil
+}
@@ -0,0 +1,339 @@
+package codec
+
+// G.722 64 kbit/s sub-band ADPCM, after the ITU-T reference and the public
+// domain implementation by Steve Underwood (itself based on CMU's)
+
+var (
+	g722Q6 = [32]int{
+		0, 35, 72, 110, 150, 190, 233, 276, 323, 370, 422, 473, 530, 587, 650, 714,
+		786, 858, 940, 1023, 1121, 1219, 1339, 1458, 1612, 1765, 1980, 2195, 2557, 2919, 0, 0,
+	}
+	g722ILN = [32]int{
+		0, 63, 62, 31, 30, 29, 28, 27, 26, 25, 24, 23, 22, 21, 20, 19,
+		18, 17, 16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 0,
+	}
+	g722ILP = [32]int{
+		0, 61, 60, 59, 58, 57, 56, 55, 54, 53, 52, 51, 50, 49, 48, 47,
+		46, 45, 44, 43, 42, 41, 40, 39, 38, 37, 36, 35, 34, 33, 32, 0,
+	}
+	g722WL   = [8]int{-60, -30, 58, 172, 334, 538, 1198, 3042}
+	g722RL42 = [16]int{0, 7, 6, 5, 4, 3, 2, 1, 7, 6, 5, 4, 3, 2, 1, 0}
+	g722ILB  = [32]int{
+		2048, 2093, 2139, 2186, 2233, 2282, 2332, 2383, 2435, 2489, 2543, 2599, 2656, 2714, 2774, 2834,
+		2896, 2960, 3025, 3091, 3158, 3228, 3298, 3371, 3444, 3520, 3597, 3676, 3756, 3838, 3922, 4008,
+	}
+	g722QM4 = [16]int{
+		0, -20456, -12896, -8968, -6288, -4240, -2584, -1200,
+		20456, 12896, 8968, 6288, 4240, 2584, 1200, 0,
+	}
+	g722QM6 = [64]int{
+		-136, -136, -136, -136, -24808, -21904, -19008, -16704,
+		-14984, -13512, -12280, -11192, -10232, -9360, -8576, -7856,
+		-7192, -6576, -6000, -5456, -4944, -4464, -4008, -3576,
+		-3168, -2776, -2400, -2032, -1688, -1360, -1040, -728,
+		24808, 21904, 19008, 16704, 14984, 13512, 12280, 11192,
+		10232, 9360, 8576, 7856, 7192, 6576, 6000, 5456,
+		4944, 4464, 4008, 3576, 3168, 2776, 2400, 2032,
+		1688, 1360, 1040, 728, 432, 136, -432, -136,
+	}
+	g722QM2 = [4]int{-7408, -1616, 7408, 1616}
+	g722IHN = [3]int{0, 1, 0}
+	g722IHP = [3]int{0, 3, 2}
+	g722WH  = [3]int{0, -214, 798}
+	g722RH2 = [4]int{2, 1, 2, 1}
+	g722QMF = [12]int{3, -11, 12, 32, -210, 951, 3876, -805, 362, -156, 53, -11}
+)
+
+func saturate(amp int) int {
+	if amp > 32767 {
+		return 32767
+	}
+	if amp < -32768 {
+		return -32768
+	}
+	return amp
+}
+
+// g722Band is the adaptive predictor state of one sub-band
+type g722Band struct {
+	s, sp, sz int
+	r, a, ap  [3]int
+	p         [3]int
+	d, b, bp  [7]int
+	sg        [7]int
+	nb, det   int
+}
+
+// update runs the reconstruction and predictor adaptation (block 4) with
+// the quantized difference signal d
+func (band *g722Band) update(d int) {
+	band.d[0] = d
+	band.r[0] = saturate(band.s + d)
+	band.p[0] = saturate(band.sz + d)
+
+	// UPPOL2
+	for i := 0; i < 3; i++ {
+		band.sg[i] = band.p[i] >> 15
+	}
+	wd1 := saturate(band.a[1] << 2)
+	wd2 := wd1
+	if band.sg[0] == band.sg[1] {
+		wd2 = -wd1
+	}
+	if wd2 > 32767 {
+		wd2 = 32767
+	}
+	wd3 := -128
+	if band.sg[0] == band.sg[2] {
+		wd3 = 128
+	}
+	wd3 += wd2 >> 7
+	wd3 += (band.a[2] * 32512) >> 15
+	if wd3 > 12288 {
+		wd3 = 12288
+	} else if wd3 < -12288 {
+		wd3 = -12288
+	}
+	band.ap[2] = wd3
+
+	// UPPOL1
+	band.sg[0] = band.p[0] >> 15
+	band.sg[1] = band.p[1] >> 15
+	wd1 = -192
+	if band.sg[0] == band.sg[1] {
+		wd1 = 192
+	}
+	wd2 = (band.a[1] * 32640) >> 15
+	band.ap[1] = saturate(wd1 + wd2)
+	wd3 = saturate(15360 - band.ap[2])
+	if band.ap[1] > wd3 {
+		band.ap[1] = wd3
+	} else if band.ap[1] < -wd3 {
+		band.ap[1] = -wd3
+	}
+
+	// UPZERO
+	wd1 = 128
+	if d == 0 {
+		wd1 = 0
+	}
+	band.sg[0] = d >> 15
+	for i := 1; i < 7; i++ {
+		band.sg[i] = band.d[i] >> 15
+		wd2 = -wd1
+		if band.sg[i] == band.sg[0] {
+			wd2 = wd1
+		}
+		wd3 = (band.b[i] * 32640) >> 15
+		band.bp[i] = saturate(wd2 + wd3)
+	}
+
+	// DELAYA
+	for i := 6; i > 0; i-- {
+		band.d[i] = band.d[i-1]
+		band.b[i] = band.bp[i]
+	}
+	for i := 2; i > 0; i-- {
+		band.r[i] = band.r[i-1]
+		band.p[i] = band.p[i-1]
+		band.a[i] = band.ap[i]
+	}
+
+	// FILTEP
+	wd1 = saturate(band.r[1] + band.r[1])
+	wd1 = (band.a[1] * wd1) >> 15
+	wd2 = saturate(band.r[2] + band.r[2])
+	wd2 = (band.a[2] * wd2) >> 15
+	band.sp = saturate(wd1 + wd2)
+
+	// FILTEZ
+	band.sz = 0
+	for i := 6; i > 0; i-- {
+		wd1 = saturate(band.d[i] + band.d[i])
+		band.sz += (band.b[i] * wd1) >> 15
+	}
+	band.sz = saturate(band.sz)
+
+	// PREDIC
+	band.s = saturate(band.sp + band.sz)
+}
+
+// scaleLow adapts the low band quantizer scale (blocks 3L LOGSCL and SCALEL)
+func (band *g722Band) scaleLow(il4 int) {
+	nb := (band.nb*127)>>7 + g722WL[il4]
+	if nb < 0 {
+		nb = 0
+	} else if nb > 18432 {
+		nb = 18432
+	}
+	band.nb = nb
+	band.det = g722Scale(nb, 8)
+}
+
+// scaleHigh adapts the high band quantizer scale (blocks 3H LOGSCH and SCALEH)
+func (band *g722Band) scaleHigh(ih2 int) {
+	nb := (band.nb*127)>>7 + g722WH[ih2]
+	if nb < 0 {
+		nb = 0
+	} else if nb > 22528 {
+		nb = 22528
+	}
+	band.nb = nb
+	band.det = g722Scale(nb, 10)
+}
+
+func g722Scale(nb, shift int) int {
+	wd1 := (nb >> 6) & 31
+	wd2 := shift - (nb >> 11)
+	var wd3 int
+	if wd2 < 0 {
+		wd3 = g722ILB[wd1] << -wd2
+	} else {
+		wd3 = g722ILB[wd1] >> wd2
+	}
+	return wd3 << 2
+}
+
+// G722Encoder encodes 16 kHz PCM to G.722 at 64 kbit/s, one byte per two
+// samples. It keeps state between calls, so use one per RTP stream.
+type G722Encoder struct {
+	band [2]g722Band
+	x    [24]int // Transmit QMF delay line
+}
+
+// NewG722Encoder creates a G.722 encoder
+func NewG722Encoder() *G722Encoder {
+	e := &G722Encoder{}
+	e.band[0].det = 32
+	e.band[1].det = 8
+	return e
+}
+
+// Encode encodes pcm. An odd trailing sample is dropped.
+func (e *G722Encoder) Encode(pcm []int16) ([]byte, error) {
+	out := make([]byte, 0, len(pcm)/2)
+	for j := 0; j+1 < len(pcm); j += 2 {
+		// Transmit QMF
+		copy(e.x[:22], e.x[2:])
+		e.x[22] = int(pcm[j])
+		e.x[23] = int(pcm[j+1])
+		sumEven, sumOdd := 0, 0
+		for i := 0; i < 12; i++ {
+			sumOdd += e.x[2*i] * g722QMF[i]
+			sumEven += e.x[2*i+1] * g722QMF[11-i]
+		}
+		xlow := (sumEven + sumOdd) >> 14
+		xhigh := (sumEven - sumOdd) >> 14
+
+		// Low band: SUBTRA, QUANTL
+		low := &e.band[0]
+		el := saturate(xlow - low.s)
+		wd := el
+		if el < 0 {
+			wd = -(el + 1)
+		}
+		i := 1
+		for ; i < 30; i++ {
+			if wd < (g722Q6[i]*low.det)>>12 {
+				break
+			}
+		}
+		ilow := g722ILP[i]
+		if el < 0 {
+			ilow = g722ILN[i]
+		}
+
+		// INVQAL
+		ril := ilow >> 2
+		dlow := (low.det * g722QM4[ril]) >> 15
+		low.scaleLow(g722RL42[ril])
+		low.update(dlow)
+
+		// High band: SUBTRA, QUANTH
+		high := &e.band[1]
+		eh := saturate(xhigh - high.s)
+		wd = eh
+		if eh < 0 {
+			wd = -(eh + 1)
+		}
+		mih := 1
+		if wd >= (564*high.det)>>12 {
+			mih = 2
+		}
+		ihigh := g722IHP[mih]
+		if eh < 0 {
+			ihigh = g722IHN[mih]
+		}
+
+		// INVQAH
+		dhigh := (high.det * g722QM2[ihigh]) >> 15
+		high.scaleHigh(g722RH2[ihigh])
+		high.update(dhigh)
+
+		out = append(out, byte(ihigh<<6|ilow))
+	}
+	return out, nil
+}
+
+// G722Decoder decodes G.722 at 64 kbit/s to 16 kHz PCM. It keeps state
+// between calls, so use one per RTP stream.
+type G722Decoder struct {
+	band [2]g722Band
+	x    [24]int // Receive QMF delay line
+}
+
+// NewG722Decoder creates a G.722 decoder
+func NewG722Decoder() *G722Decoder {
+	d := &G722Decoder{}
+	d.band[0].det = 32
+	d.band[1].det = 8
+	return d
+}
+
+// Decode decodes payload, two samples per byte
+func (d *G722Decoder) Decode(payload []byte) ([]int16, error) {
+	out := make([]int16, 0, len(payload)*2)
+	for _, code := range payload {
+		wd1 := int(code) & 0x3F
+		ihigh := (int(code) >> 6) & 0x03
+
+		// Low band: INVQBL, RECONS, LIMIT
+		low := &d.band[0]
+		rlow := low.s + (low.det*g722QM6[wd1])>>15
+		if rlow > 16383 {
+			rlow = 16383
+		} else if rlow < -16384 {
+			rlow = -16384
+		}
+
+		// INVQAL
+		ril := wd1 >> 2
+		dlow := (low.det * g722QM4[ril]) >> 15
+		low.scaleLow(g722RL42[ril])
+		low.update(dlow)
+
+		// High band: INVQAH, RECONS, LIMIT
+		high := &d.band[1]
+		dhigh := (high.det * g722QM2[ihigh]) >> 15
+		rhigh := dhigh + high.s
+		if rhigh > 16383 {
+			rhigh = 16383
+		} else if rhigh < -16384 {
+			rhigh = -16384
+		}
+		high.scaleHigh(g722RH2[ihigh])
+		high.update(dhigh)
+
+		// Receive QMF
+		copy(d.x[:22], d.x[2:])
+		d.x[22] = rlow + rhigh
+		d.x[23] = rlow - rhigh
+		xout1, xout2 := 0, 0
+		for i := 0; i < 12; i++ {
+			xout2 += d.x[2*i] * g722QMF[i]
+			xout1 += d.x[2*i+1] * g722QMF[11-i]
+		}
+		out = append(out, int16(saturate(xout1>>11)), int16(saturate(xout2>>11)))
+	}
+	return out, nil
+}
@@ -0,0 +1,95 @@
+//go:build opus
+
+package codec
+
+/*
+#cgo pkg-config: opus
+#include <opus.h>
+
+static int gosip_opus_set_bitrate(OpusEncoder *enc, opus_int32 bitrate) {
+	return opus_encoder_ctl(enc, OPUS_SET_BITRATE(bitrate));
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+// opusAvailable is true in builds with the opus tag, which link libopus
+const opusAvailable = true
+
+const (
+	opusBitrate = 32000 // Wideband speech
+	// opusMaxFrame is the longest frame a packet may hold: 120 ms at 16 kHz
+	opusMaxFrame = 1920
+	// opusMaxPacket is the largest payload the encoder may produce
+	opusMaxPacket = 1500
+)
+
+// opusEncoder encodes 16 kHz mono PCM with libopus. Frames must be 2.5,
+// 5, 10, 20, 40 or 60 ms long.
+type opusEncoder struct {
+	enc *C.OpusEncoder
+}
+
+func newOpusEncoder() (Encoder, error) {
+	var errCode C.int
+	enc := C.opus_encoder_create(C.opus_int32(Opus.SampleRate), 1, C.OPUS_APPLICATION_VOIP, &errCode)
+	if errCode != C.OPUS_OK {
+		return nil, fmt.Errorf("opus encoder: %s", C.GoString(C.opus_strerror(errCode)))
+	}
+	if errCode = C.gosip_opus_set_bitrate(enc, opusBitrate); errCode != C.OPUS_OK {
+		C.opus_encoder_destroy(enc)
+		return nil, fmt.Errorf("opus bitrate: %s", C.GoString(C.opus_strerror(errCode)))
+	}
+	e := &opusEncoder{enc: enc}
+	runtime.SetFinalizer(e, func(e *opusEncoder) { C.opus_encoder_destroy(e.enc) })
+	return e, nil
+}
+
+func (e *opusEncoder) Encode(pcm []int16) ([]byte, error) {
+	if len(pcm) == 0 {
+		return nil, nil
+	}
+	out := make([]byte, opusMaxPacket)
+	n := C.opus_encode(e.enc,
+		(*C.opus_int16)(unsafe.Pointer(&pcm[0])), C.int(len(pcm)),
+		(*C.uchar)(unsafe.Pointer(&out[0])), C.opus_int32(len(out)))
+	if n < 0 {
+		return nil, fmt.Errorf("opus encode: %s", C.GoString(C.opus_strerror(C.int(n))))
+	}
+	return out[:n], nil
+}
+
+// opusDecoder decodes Opus to 16 kHz mono PCM with libopus
+type opusDecoder struct {
+	dec *C.OpusDecoder
+}
+
+func newOpusDecoder() (Decoder, error) {
+	var errCode C.int
+	dec := C.opus_decoder_create(C.opus_int32(Opus.SampleRate), 1, &errCode)
+	if errCode != C.OPUS_OK {
+		return nil, fmt.Errorf("opus decoder: %s", C.GoString(C.opus_strerror(errCode)))
+	}
+	d := &opusDecoder{dec: dec}
+	runtime.SetFinalizer(d, func(d *opusDecoder) { C.opus_decoder_destroy(d.dec) })
+	return d, nil
+}
+
+func (d *opusDecoder) Decode(payload []byte) ([]int16, error) {
+	if len(payload) == 0 {
+		return nil, nil
+	}
+	out := make([]int16, opusMaxFrame)
+	n := C.opus_decode(d.dec,
+		(*C.uchar)(unsafe.Pointer(&payload[0])), C.opus_int32(len(payload)),
+		(*C.opus_int16)(unsafe.Pointer(&out[0])), C.int(len(out)), 0)
+	if n < 0 {
+		return nil, fmt.Errorf("opus decode: %s", C.GoString(C.opus_strerror(n)))
+	}
+	return out[:n], nil
+}
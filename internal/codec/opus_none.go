@@ -0,0 +1,16 @@
+//go:build !opus
+
+package codec
+
+import "fmt"
+
+// opusAvailable is false in builds without the opus tag
+const opusAvailable = false
+
+func newOpusEncoder() (Encoder, error) {
+	return nil, fmt.Errorf("%w: opus (build with -tags opus)", ErrUnsupported)
+}
+
+func newOpusDecoder() (Decoder, error) {
+	return nil, fmt.Errorf("%w: opus (build with -tags opus)", ErrUnsupported)
+}
@@ -0,0 +1,59 @@
+package codec
+
+// Resampler converts 16-bit PCM between 8 and 16 kHz. Narrowband audio is
+// upsampled by interpolation and wideband audio is low-pass filtered before
+// every other sample is dropped. It keeps state between calls, so use one
+// per stream.
+type Resampler struct {
+	from, to int
+	last     int   // Last input sample, for interpolation across frames
+	taps     []int // Low-pass filter history when downsampling
+}
+
+// downsampleFilter is a half-band low-pass FIR (sum 32) that keeps 16 kHz
+// audio from aliasing when it is taken down to 8 kHz
+var downsampleFilter = []int{-1, 0, 9, 16, 9, 0, -1}
+
+// NewResampler creates a Resampler from one sample rate to another. Rates
+// other than 8000 and 16000 are passed through unchanged.
+func NewResampler(from, to int) *Resampler {
+	return &Resampler{from: from, to: to, taps: make([]int, len(downsampleFilter))}
+}
+
+// Resample converts pcm to the target rate
+func (r *Resampler) Resample(pcm []int16) []int16 {
+	switch {
+	case r.from == 8000 && r.to == 16000:
+		return r.upsample(pcm)
+	case r.from == 16000 && r.to == 8000:
+		return r.downsample(pcm)
+	}
+	return pcm
+}
+
+func (r *Resampler) upsample(pcm []int16) []int16 {
+	out := make([]int16, 0, len(pcm)*2)
+	for _, sample := range pcm {
+		s := int(sample)
+		out = append(out, int16((r.last+s)/2), sample)
+		r.last = s
+	}
+	return out
+}
+
+func (r *Resampler) downsample(pcm []int16) []int16 {
+	out := make([]int16, 0, len(pcm)/2)
+	for i, sample := range pcm {
+		copy(r.taps[1:], r.taps[:len(r.taps)-1])
+		r.taps[0] = int(sample)
+		if i%2 == 1 {
+			continue
+		}
+		sum := 0
+		for j, coeff := range downsampleFilter {
+			sum += r.taps[j] * coeff
+		}
+		out = append(out, int16(saturate(sum>>5)))
+	}
+	return out
+}
@@ -0,0 +1,42 @@
+package codec
+
+// Transcoder converts RTP payloads of one codec to another through 16-bit
+// PCM, resampling between narrowband and wideband as needed. It keeps codec
+// state between calls, so use one per direction of a call.
+type Transcoder struct {
+	From, To  Codec
+	decoder   Decoder
+	encoder   Encoder
+	resampler *Resampler
+}
+
+// NewTranscoder creates a Transcoder from one codec to another
+func NewTranscoder(from, to Codec) (*Transcoder, error) {
+	decoder, err := NewDecoder(from)
+	if err != nil {
+		return nil, err
+	}
+	encoder, err := NewEncoder(to)
+	if err != nil {
+		return nil, err
+	}
+	return &Transcoder{
+		From:      from,
+		To:        to,
+		decoder:   decoder,
+		encoder:   encoder,
+		resampler: NewResampler(from.SampleRate, to.SampleRate),
+	}, nil
+}
+
+// Transcode converts one RTP payload
+func (t *Transcoder) Transcode(payload []byte) ([]byte, error) {
+	if t.From.Name == t.To.Name {
+		return payload, nil
+	}
+	pcm, err := t.decoder.Decode(payload)
+	if err != nil {
+		return nil, err
+	}
+	return t.encoder.Encode(t.resampler.Resample(pcm))
+}
@@ -0,0 +1,300 @@
+// Package compliance writes and verifies signed, hash-chained JSONL exports
+// of calls and messages for users with record-keeping requirements.
+//
+// An export is one JSON object per line: a header, one line per call or
+// message in time order, and a trailer. Every line carries the hash of the
+// line before it and its own hash, the SHA-256 of the line encoded without
+// its hash and signature. The header's previous hash is the last hash of the
+// export before it, or GenesisHash for the first, so exports form one
+// append-only chain. The trailer is signed with the server's Ed25519 key.
+package compliance
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// Line types
+const (
+	LineHeader  = "header"
+	LineCall    = "call"
+	LineMessage = "message"
+	LineTrailer = "trailer"
+)
+
+// FormatVersion is written in every header
+const FormatVersion = 1
+
+// GenesisHash is the previous hash of the first export
+var GenesisHash = hex.EncodeToString(make([]byte, sha256.Size))
+
+// Line is one line of an export. Only the fields of its type are set.
+type Line struct {
+	Type string `json:"type"`
+	Seq  int    `json:"seq"`
+
+	// Header
+	Version    int        `json:"version,omitempty"`
+	ExportID   int64      `json:"export_id,omitempty"`
+	RangeStart *time.Time `json:"range_start,omitempty"`
+	RangeEnd   *time.Time `json:"range_end,omitempty"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	PublicKey  string     `json:"public_key,omitempty"` // Base64 Ed25519 key the trailer is signed with
+
+	// Call or message
+	Record json.RawMessage `json:"record,omitempty"`
+
+	// Trailer
+	Calls    *int `json:"calls,omitempty"`
+	Messages *int `json:"messages,omitempty"`
+
+	PrevHash  string `json:"prev_hash"`
+	Hash      string `json:"hash,omitempty"`
+	Signature string `json:"signature,omitempty"` // Trailer only: base64 Ed25519 signature of Hash
+}
+
+// CallRecord is the exported form of a call
+type CallRecord struct {
+	ID           int64      `json:"id"`
+	CallSID      string     `json:"call_sid,omitempty"`
+	Direction    string     `json:"direction"`
+	From         string     `json:"from"`
+	To           string     `json:"to"`
+	DIDID        *int64     `json:"did_id,omitempty"`
+	DeviceID     *int64     `json:"device_id,omitempty"`
+	StartedAt    time.Time  `json:"started_at"`
+	AnsweredAt   *time.Time `json:"answered_at,omitempty"`
+	EndedAt      *time.Time `json:"ended_at,omitempty"`
+	Duration     int        `json:"duration"`
+	Disposition  string     `json:"disposition"`
+	RecordingURL string     `json:"recording_url,omitempty"`
+	Internal     bool       `json:"internal"`
+}
+
+// MessageRecord is the exported form of a message
+type MessageRecord struct {
+	ID         int64           `json:"id"`
+	MessageSID string          `json:"message_sid,omitempty"`
+	Direction  string          `json:"direction"`
+	From       string          `json:"from"`
+	To         string          `json:"to"`
+	DIDID      *int64          `json:"did_id,omitempty"`
+	Channel    string          `json:"channel"`
+	Body       string          `json:"body"`
+	MediaURLs  json.RawMessage `json:"media_urls,omitempty"`
+	Status     string          `json:"status,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// NewCallRecord converts a CDR for export
+func NewCallRecord(cdr *models.CDR) CallRecord {
+	return CallRecord{
+		ID:           cdr.ID,
+		CallSID:      cdr.CallSID,
+		Direction:    cdr.Direction,
+		From:         cdr.FromNumber,
+		To:           cdr.ToNumber,
+		DIDID:        cdr.DIDID,
+		DeviceID:     cdr.DeviceID,
+		StartedAt:    cdr.StartedAt.UTC(),
+		AnsweredAt:   utc(cdr.AnsweredAt),
+		EndedAt:      utc(cdr.EndedAt),
+		Duration:     cdr.Duration,
+		Disposition:  cdr.Disposition,
+		RecordingURL: cdr.RecordingURL.String,
+		Internal:     cdr.Internal,
+	}
+}
+
+// NewMessageRecord converts a message for export
+func NewMessageRecord(msg *models.Message) MessageRecord {
+	return MessageRecord{
+		ID:         msg.ID,
+		MessageSID: msg.MessageSID,
+		Direction:  msg.Direction,
+		From:       msg.FromNumber,
+		To:         msg.ToNumber,
+		DIDID:      msg.DIDID,
+		Channel:    msg.Channel,
+		Body:       msg.Body,
+		MediaURLs:  msg.MediaURLs,
+		Status:     msg.Status,
+		CreatedAt:  msg.CreatedAt.UTC(),
+	}
+}
+
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// hashLine returns the hash of a line: the SHA-256 of its JSON without the
+// hash and signature
+func hashLine(line Line) (string, error) {
+	line.Hash = ""
+	line.Signature = ""
+	data, err := json.Marshal(line)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Writer writes the lines of an export, chaining their hashes
+type Writer struct {
+	w        io.Writer
+	enc      *json.Encoder
+	seq      int
+	prevHash string
+}
+
+// NewWriter starts an export chained to previousHash
+func NewWriter(w io.Writer, previousHash string) *Writer {
+	if previousHash == "" {
+		previousHash = GenesisHash
+	}
+	return &Writer{w: w, enc: json.NewEncoder(w), prevHash: previousHash}
+}
+
+// Write hashes a line, chains it to the one before and writes it
+func (w *Writer) Write(line Line) error {
+	line.Seq = w.seq
+	line.PrevHash = w.prevHash
+	hash, err := hashLine(line)
+	if err != nil {
+		return err
+	}
+	line.Hash = hash
+	if err := w.enc.Encode(line); err != nil {
+		return err
+	}
+	w.seq++
+	w.prevHash = hash
+	return nil
+}
+
+// WriteRecord writes a call or message line
+func (w *Writer) WriteRecord(lineType string, record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return w.Write(Line{Type: lineType, Record: data})
+}
+
+// Close writes the trailer with the record counts, signed with key, and
+// returns its hash
+func (w *Writer) Close(calls, messages int, key ed25519.PrivateKey) (string, error) {
+	line := Line{Type: LineTrailer, Seq: w.seq, PrevHash: w.prevHash, Calls: &calls, Messages: &messages}
+	hash, err := hashLine(line)
+	if err != nil {
+		return "", err
+	}
+	line.Hash = hash
+	line.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(hash)))
+	if err := w.enc.Encode(line); err != nil {
+		return "", err
+	}
+	w.seq++
+	w.prevHash = hash
+	return hash, nil
+}
+
+// Verification is what Verify found in an intact export
+type Verification struct {
+	ExportID     int64  `json:"export_id"`
+	PreviousHash string `json:"previous_hash"`
+	HeadHash     string `json:"head_hash"`
+	Calls        int    `json:"calls"`
+	Messages     int    `json:"messages"`
+}
+
+// Verify reads an export and checks the hash of every line, the chain
+// between them, the record counts and the trailer's signature against key.
+// The key should come from the server, not from the export's header.
+func Verify(r io.Reader, key ed25519.PublicKey) (*Verification, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+
+	v := &Verification{}
+	var prevHash string
+	calls, messages, seq := 0, 0, 0
+	trailer := false
+	for scanner.Scan() {
+		if trailer {
+			return nil, fmt.Errorf("line %d: data after the trailer", seq+1)
+		}
+		var line Line
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", seq+1, err)
+		}
+		if line.Seq != seq {
+			return nil, fmt.Errorf("line %d: sequence number %d, expected %d", seq+1, line.Seq, seq)
+		}
+		if seq == 0 {
+			if line.Type != LineHeader {
+				return nil, errors.New("line 1: expected a header")
+			}
+			v.ExportID = line.ExportID
+			v.PreviousHash = line.PrevHash
+		} else if line.PrevHash != prevHash {
+			return nil, fmt.Errorf("line %d: chain broken, previous hash %s, expected %s", seq+1, line.PrevHash, prevHash)
+		}
+		hash, err := hashLine(line)
+		if err != nil {
+			return nil, err
+		}
+		if hash != line.Hash {
+			return nil, fmt.Errorf("line %d: content doesn't match its hash", seq+1)
+		}
+
+		switch line.Type {
+		case LineHeader:
+			if seq != 0 {
+				return nil, fmt.Errorf("line %d: unexpected header", seq+1)
+			}
+		case LineCall:
+			calls++
+		case LineMessage:
+			messages++
+		case LineTrailer:
+			if line.Calls == nil || line.Messages == nil || *line.Calls != calls || *line.Messages != messages {
+				return nil, fmt.Errorf("line %d: trailer counts don't match the %d calls and %d messages", seq+1, calls, messages)
+			}
+			sig, err := base64.StdEncoding.DecodeString(line.Signature)
+			if err != nil || !ed25519.Verify(key, []byte(line.Hash), sig) {
+				return nil, fmt.Errorf("line %d: invalid signature", seq+1)
+			}
+			trailer = true
+		default:
+			return nil, fmt.Errorf("line %d: unknown type %q", seq+1, line.Type)
+		}
+		prevHash = line.Hash
+		seq++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !trailer {
+		return nil, errors.New("export is truncated: no trailer")
+	}
+
+	v.HeadHash = prevHash
+	v.Calls = calls
+	v.Messages = messages
+	return v, nil
+}
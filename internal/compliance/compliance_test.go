@@ -0,0 +1,152 @@
+package compliance
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// setupTestDB creates an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	database, err := db.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Close()
+	})
+	return database
+}
+
+func TestWriterVerify(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func() []byte {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, "")
+		w.Write(Line{Type: LineHeader, Version: FormatVersion, ExportID: 7})
+		w.WriteRecord(LineCall, CallRecord{ID: 1, From: "+15551234567", To: "+15559876543"})
+		w.WriteRecord(LineMessage, MessageRecord{ID: 2, Body: "hello"})
+		if _, err := w.Close(1, 1, key); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	v, err := Verify(bytes.NewReader(write()), pub)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if v.ExportID != 7 || v.PreviousHash != GenesisHash || v.Calls != 1 || v.Messages != 1 || v.HeadHash == "" {
+		t.Errorf("Unexpected verification %+v", v)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(data []byte) []byte
+		want   string
+	}{
+		{"edited record", func(d []byte) []byte { return bytes.Replace(d, []byte("hello"), []byte("hullo"), 1) }, "doesn't match its hash"},
+		{"removed line", func(d []byte) []byte {
+			lines := bytes.SplitAfter(d, []byte("\n"))
+			return bytes.Join(append(lines[:1:1], lines[2:]...), nil)
+		}, "sequence number"},
+		{"truncated", func(d []byte) []byte {
+			lines := bytes.SplitAfter(d, []byte("\n"))
+			return bytes.Join(lines[:3], nil)
+		}, "no trailer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Verify(bytes.NewReader(tt.tamper(write())), pub)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Verify error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	other, _, _ := ed25519.GenerateKey(nil)
+	if _, err := Verify(bytes.NewReader(write()), other); err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Errorf("Expected the wrong key rejected, got %v", err)
+	}
+}
+
+func TestExporter(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+	exporter := NewExporter(&config.Config{DataDir: t.TempDir()}, database)
+
+	now := time.Now()
+	for _, cdr := range []*models.CDR{
+		{CallSID: "CA1", Direction: "inbound", FromNumber: "+15551234567", ToNumber: "+15559876543", StartedAt: now.Add(-30 * time.Minute), Disposition: "answered"},
+		{CallSID: "CA2", Direction: "outbound", FromNumber: "+15559876543", ToNumber: "+15551234567", StartedAt: now.Add(-3 * time.Hour), Disposition: "answered"},
+	} {
+		if err := database.CDRs.Create(ctx, cdr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.Messages.Create(ctx, &models.Message{MessageSID: "SM1", Direction: "inbound", FromNumber: "+15551234567", ToNumber: "+15559876543", Body: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := exporter.Request(ctx, now.Add(-time.Hour), now.Add(time.Minute), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := exporter.Request(ctx, now.Add(-4*time.Hour), now.Add(-2*time.Hour), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter.RunPending(ctx)
+
+	first, _ = database.ComplianceExports.GetByID(ctx, first.ID)
+	second, _ = database.ComplianceExports.GetByID(ctx, second.ID)
+	if first.Status != db.ComplianceExportComplete || first.Calls != 1 || first.Messages != 1 {
+		t.Fatalf("Unexpected first export %+v", first)
+	}
+	if second.Status != db.ComplianceExportComplete || second.Calls != 1 || second.Messages != 0 {
+		t.Fatalf("Unexpected second export %+v", second)
+	}
+
+	// Each export chains to the one before
+	if first.PreviousHash != GenesisHash || second.PreviousHash != first.HeadHash {
+		t.Errorf("Expected the exports chained, got %s -> %s and %s -> %s",
+			first.PreviousHash, first.HeadHash, second.PreviousHash, second.HeadHash)
+	}
+	for _, export := range []*models.ComplianceExport{first, second} {
+		if _, err := exporter.VerifyExport(ctx, export); err != nil {
+			t.Errorf("VerifyExport(%d): %v", export.ID, err)
+		}
+	}
+
+	// A changed file fails verification
+	path := exporter.Path(second)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exporter.VerifyExport(ctx, second); err == nil {
+		t.Error("Expected a changed file to fail verification")
+	}
+}
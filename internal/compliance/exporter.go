@@ -0,0 +1,278 @@
+package compliance
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// signingKeyConfig stores the seed of the Ed25519 key exports are signed
+// with. It is created with the first export.
+const signingKeyConfig = "compliance_signing_key"
+
+// Exporter writes requested compliance exports one at a time, in the
+// order they were requested, so each one chains to the one before
+type Exporter struct {
+	database *db.DB
+	dir      string
+	wake     chan struct{}
+
+	// mu serializes exports and creating the signing key
+	mu sync.Mutex
+}
+
+// NewExporter creates an Exporter writing to the compliance directory
+func NewExporter(cfg *config.Config, database *db.DB) *Exporter {
+	return &Exporter{
+		database: database,
+		dir:      cfg.CompliancePath(),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Start writes exports left pending by a restart, then each export as it
+// is requested
+func (e *Exporter) Start(ctx context.Context) {
+	go func() {
+		for {
+			e.RunPending(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-e.wake:
+			}
+		}
+	}()
+}
+
+// Request queues an export of the calls and messages in [start, end)
+func (e *Exporter) Request(ctx context.Context, start, end time.Time, requestedBy *int64) (*models.ComplianceExport, error) {
+	export := &models.ComplianceExport{RangeStart: start.UTC(), RangeEnd: end.UTC(), RequestedBy: requestedBy}
+	if err := e.database.ComplianceExports.Create(ctx, export); err != nil {
+		return nil, err
+	}
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+	return export, nil
+}
+
+// RunPending writes every pending export
+func (e *Exporter) RunPending(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	pending, err := e.database.ComplianceExports.ListPending(ctx)
+	if err != nil {
+		slog.Error("Failed to list pending compliance exports", "error", err)
+		return
+	}
+	for _, export := range pending {
+		if err := e.run(ctx, export); err != nil {
+			slog.Error("Compliance export failed", "error", err, "export_id", export.ID)
+			if err := e.database.ComplianceExports.Fail(ctx, export.ID, err.Error()); err != nil {
+				slog.Error("Failed to record compliance export failure", "error", err, "export_id", export.ID)
+			}
+			continue
+		}
+		slog.Info("Compliance export written", "export_id", export.ID, "calls", export.Calls, "messages", export.Messages)
+	}
+}
+
+// PublicKey returns the key exports are verified with
+func (e *Exporter) PublicKey(ctx context.Context) (ed25519.PublicKey, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key, err := e.signingKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return key.Public().(ed25519.PublicKey), nil
+}
+
+// signingKey loads the signing key, creating it the first time. mu must be
+// held.
+func (e *Exporter) signingKey(ctx context.Context) (ed25519.PrivateKey, error) {
+	if stored, err := e.database.Config.Get(ctx, signingKeyConfig); err == nil {
+		seed, err := base64.StdEncoding.DecodeString(stored)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("stored compliance signing key is invalid")
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	if err := e.database.Config.Set(ctx, signingKeyConfig, base64.StdEncoding.EncodeToString(seed)); err != nil {
+		return nil, err
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// Path returns where an export's file is kept
+func (e *Exporter) Path(export *models.ComplianceExport) string {
+	return filepath.Join(e.dir, export.FileName)
+}
+
+// record is a call or message line waiting to be written in time order
+type record struct {
+	at       time.Time
+	lineType string
+	value    interface{}
+}
+
+// run writes one export and records it as complete. mu must be held.
+func (e *Exporter) run(ctx context.Context, export *models.ComplianceExport) error {
+	key, err := e.signingKey(ctx)
+	if err != nil {
+		return err
+	}
+	previous, err := e.database.ComplianceExports.LastHeadHash(ctx)
+	if err != nil {
+		return err
+	}
+	if previous == "" {
+		previous = GenesisHash
+	}
+
+	cdrs, err := e.database.CDRs.ListBetween(ctx, export.RangeStart, export.RangeEnd)
+	if err != nil {
+		return err
+	}
+	msgs, err := e.database.Messages.ListBetween(ctx, export.RangeStart, export.RangeEnd)
+	if err != nil {
+		return err
+	}
+	records := make([]record, 0, len(cdrs)+len(msgs))
+	for _, cdr := range cdrs {
+		records = append(records, record{cdr.StartedAt, LineCall, NewCallRecord(cdr)})
+	}
+	for _, msg := range msgs {
+		records = append(records, record{msg.CreatedAt, LineMessage, NewMessageRecord(msg)})
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].at.Before(records[j].at) })
+
+	if err := os.MkdirAll(e.dir, 0o755); err != nil {
+		return err
+	}
+	export.FileName = fmt.Sprintf("compliance-%06d-%s-%s.jsonl", export.ID,
+		export.RangeStart.Format("20060102T150405Z"), export.RangeEnd.Format("20060102T150405Z"))
+	path := e.Path(export)
+	// O_EXCL: an export file is written once and never replaced
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	written := false
+	defer func() {
+		f.Close()
+		if !written {
+			os.Remove(path)
+		}
+	}()
+
+	sum := sha256.New()
+	w := NewWriter(io.MultiWriter(f, sum), previous)
+	now := time.Now().UTC()
+	if err := w.Write(Line{
+		Type:       LineHeader,
+		Version:    FormatVersion,
+		ExportID:   export.ID,
+		RangeStart: &export.RangeStart,
+		RangeEnd:   &export.RangeEnd,
+		CreatedAt:  &now,
+		PublicKey:  base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+	}); err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := w.WriteRecord(r.lineType, r.value); err != nil {
+			return err
+		}
+	}
+	head, err := w.Close(len(cdrs), len(msgs), key)
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	// Read-only, as a reminder that the file must not change
+	if err := f.Chmod(0o400); err != nil {
+		return err
+	}
+
+	export.Calls = len(cdrs)
+	export.Messages = len(msgs)
+	export.PreviousHash = previous
+	export.HeadHash = head
+	export.FileSHA256 = hex.EncodeToString(sum.Sum(nil))
+	export.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(head)))
+	if err := e.database.ComplianceExports.Complete(ctx, export); err != nil {
+		return err
+	}
+	written = true
+	return nil
+}
+
+// VerifyExport checks an export's file against the server's key and the
+// hashes recorded when it was written
+func (e *Exporter) VerifyExport(ctx context.Context, export *models.ComplianceExport) (*Verification, error) {
+	key, err := e.PublicKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(e.Path(export))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sum := sha256.New()
+	v, err := Verify(io.TeeReader(f, sum), key)
+	if err != nil {
+		return nil, err
+	}
+	if hex.EncodeToString(sum.Sum(nil)) != export.FileSHA256 {
+		return nil, fmt.Errorf("file SHA-256 doesn't match the one recorded when it was written")
+	}
+	if v.HeadHash != export.HeadHash || v.PreviousHash != export.PreviousHash || v.ExportID != export.ID {
+		return nil, fmt.Errorf("file doesn't match the chain recorded when it was written")
+	}
+
+	// The export before this one must still be there to chain to
+	exports, err := e.database.ComplianceExports.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	expected := GenesisHash
+	for _, other := range exports {
+		if other.ID < export.ID && other.Status == db.ComplianceExportComplete {
+			expected = other.HeadHash
+			break
+		}
+	}
+	if v.PreviousHash != expected {
+		return nil, fmt.Errorf("chain broken: the previous export's last hash is %s, this export follows %s", expected, v.PreviousHash)
+	}
+	return v, nil
+}
@@ -2,9 +2,15 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // TLSConfig holds TLS-specific configuration
@@ -62,17 +68,464 @@ type ZRTPConfig struct {
 	CacheExpiryDays int
 }
 
+// CallLimitsConfig holds concurrent call caps enforced at INVITE time.
+// A limit of 0 disables that cap.
+type CallLimitsConfig struct {
+	// MaxCalls caps concurrent calls across the whole server
+	MaxCalls int
+	// MaxCallsPerDID caps concurrent calls to or from a single DID
+	MaxCallsPerDID int
+	// MaxCallsPerDevice caps concurrent calls on a single registered device
+	MaxCallsPerDevice int
+	// MaxCallDuration ends connected calls after this many seconds. Routes
+	// can set their own limit.
+	MaxCallDuration int
+	// CallDurationWarning is how many seconds before MaxCallDuration the
+	// warning plays
+	CallDurationWarning int
+	// MaxHoldTime is how many seconds a call may stay on hold before
+	// HoldTimeoutAction is taken
+	MaxHoldTime int
+	// HoldTimeoutAction is "retrieve" (resume the call and ring the holder)
+	// or "voicemail" (send the caller to voicemail)
+	HoldTimeoutAction string
+	// TransferRecallTimeout is how many seconds the target of a blind
+	// transfer has to answer before the call goes back to the transferor
+	TransferRecallTimeout int
+}
+
+// MediaConfig holds the audio codecs GoSIP offers, most preferred first,
+// and jitter buffer bounds. Names are SDP encoding names: opus, G722, PCMU
+// or PCMA.
+type MediaConfig struct {
+	// DeviceCodecs are preferred on calls between registered devices
+	DeviceCodecs []string
+	// TrunkCodecs are preferred on Twilio trunk (PSTN) legs
+	TrunkCodecs []string
+
+	// JitterMinDelay and JitterMaxDelay bound the adaptive playout delay
+	// of the jitter buffer, in milliseconds
+	JitterMinDelay int
+	JitterMaxDelay int
+}
+
+// WANIPConfig holds public IP detection and dynamic DNS settings
+type WANIPConfig struct {
+	// Detect polls IP echo services for the public IPv4 address
+	Detect bool
+	// URLs are the plain-text IP echo services, tried in order
+	URLs []string
+
+	// Cloudflare A record kept pointing at the public address
+	CloudflareToken  string // API token with DNS edit permission on the zone
+	CloudflareZoneID string
+	CloudflareRecord string // e.g. sip.example.com
+
+	// DuckDNS subdomains kept pointing at the public address
+	DuckDNSToken   string
+	DuckDNSDomains []string // e.g. mypbx for mypbx.duckdns.org
+}
+
+// SecretsConfig holds the external secret stores that secret settings can
+// reference, e.g. TWILIO_AUTH_TOKEN=vault:secret/data/gosip#twilio_auth_token
+type SecretsConfig struct {
+	// HashiCorp Vault KV secrets engine (version 1 or 2)
+	VaultAddr      string
+	VaultToken     string
+	VaultNamespace string
+
+	// AWS Secrets Manager. Without keys, ECS task role credentials are used.
+	AWSRegion             string
+	AWSAccessKeyID        string
+	AWSSecretAccessKey    string
+	AWSSessionToken       string
+	AWSContainerCredsPath string // Set by ECS for the task role
+}
+
+// Port mapping modes
+const (
+	PortMapOff    = "off"
+	PortMapAuto   = "auto" // NAT-PMP, then UPnP
+	PortMapUPnP   = "upnp"
+	PortMapNATPMP = "natpmp"
+)
+
+// PortMapConfig holds router port forwarding settings
+type PortMapConfig struct {
+	// Mode is PortMapOff, PortMapAuto, PortMapUPnP or PortMapNATPMP
+	Mode string
+	// Gateway is the NAT-PMP router address, read from the default route when empty
+	Gateway string
+	// RTPPorts is a range of RTP ports to forward, e.g. "10000-10099". Empty forwards none.
+	RTPPorts string
+}
+
+// RTPRange parses RTPPorts, returning zeros when it is empty
+func (c *PortMapConfig) RTPRange() (int, int, error) {
+	low, high, err := parsePortRange(c.RTPPorts)
+	if err != nil {
+		return 0, 0, err
+	}
+	if high-low+1 > PortMapMaxRTPPorts {
+		return 0, 0, fmt.Errorf("RTP port range %q has more than %d ports", c.RTPPorts, PortMapMaxRTPPorts)
+	}
+	return low, high, nil
+}
+
+// parsePortRange parses a port range such as "10000-10099" or a single
+// port, returning zeros when it is empty
+func parsePortRange(ports string) (int, int, error) {
+	if ports == "" {
+		return 0, 0, nil
+	}
+	first, last, found := strings.Cut(ports, "-")
+	if !found {
+		last = first
+	}
+	low, err1 := strconv.Atoi(strings.TrimSpace(first))
+	high, err2 := strconv.Atoi(strings.TrimSpace(last))
+	if err1 != nil || err2 != nil || low < 1 || high > 65535 || low > high {
+		return 0, 0, fmt.Errorf("invalid RTP port range %q", ports)
+	}
+	return low, high, nil
+}
+
+// Validate checks the mode and RTP port range
+func (c *PortMapConfig) Validate() error {
+	switch c.Mode {
+	case PortMapOff, PortMapAuto, PortMapUPnP, PortMapNATPMP:
+	default:
+		return fmt.Errorf("invalid port mapping mode %q", c.Mode)
+	}
+	_, _, err := c.RTPRange()
+	return err
+}
+
+// WebRTCConfig holds the gateway that lets browsers registered over
+// WebSocket call phones
+type WebRTCConfig struct {
+	// Enabled relays the media of calls between browsers and phones,
+	// translating between DTLS-SRTP with ICE and plain RTP
+	Enabled bool
+	// Ports is the UDP range media is relayed on, e.g. "20000-20199".
+	// Empty lets the system pick free ports.
+	Ports string
+}
+
+// PortRange parses Ports, returning zeros when it is empty
+func (c *WebRTCConfig) PortRange() (int, int, error) {
+	low, high, err := parsePortRange(c.Ports)
+	if err != nil {
+		return 0, 0, fmt.Errorf("webrtc: %w", err)
+	}
+	// Each call takes one port for the browser and one for the phone
+	if low != 0 && high == low {
+		return 0, 0, fmt.Errorf("webrtc: port range %q needs at least two ports", c.Ports)
+	}
+	return low, high, nil
+}
+
+// Validate checks the port range
+func (c *WebRTCConfig) Validate() error {
+	_, _, err := c.PortRange()
+	return err
+}
+
+// Media relay modes
+const (
+	MediaRelayOff    = "off"
+	MediaRelayNAT    = "nat" // Only calls with a party behind NAT
+	MediaRelayAlways = "always"
+)
+
+// MediaRelayConfig holds the RTP relay that anchors call media at GoSIP
+type MediaRelayConfig struct {
+	// Mode is MediaRelayOff, MediaRelayNAT or MediaRelayAlways. Routes can
+	// choose their own mode.
+	Mode string
+	// Ports is the UDP range media is relayed on, e.g. "30000-30999". Each
+	// call takes an RTP and RTCP pair per party. Empty lets the system
+	// pick free ports.
+	Ports string
+}
+
+// ValidMediaRelayMode reports whether mode is a media relay mode
+func ValidMediaRelayMode(mode string) bool {
+	switch mode {
+	case MediaRelayOff, MediaRelayNAT, MediaRelayAlways:
+		return true
+	}
+	return false
+}
+
+// PortRange parses Ports, returning zeros when it is empty
+func (c *MediaRelayConfig) PortRange() (int, int, error) {
+	low, high, err := parsePortRange(c.Ports)
+	if err != nil {
+		return 0, 0, fmt.Errorf("media relay: %w", err)
+	}
+	// A call takes two pairs of ports
+	if low != 0 && high-low+1 < 4 {
+		return 0, 0, fmt.Errorf("media relay: port range %q needs at least four ports", c.Ports)
+	}
+	return low, high, nil
+}
+
+// Validate checks the mode and port range
+func (c *MediaRelayConfig) Validate() error {
+	if !ValidMediaRelayMode(c.Mode) {
+		return fmt.Errorf("invalid media relay mode %q", c.Mode)
+	}
+	_, _, err := c.PortRange()
+	return err
+}
+
+// TwilioEdges are the Twilio edge locations, where Twilio's network is
+// entered for both the API and SIP
+var TwilioEdges = []string{"ashburn", "dublin", "frankfurt", "sao-paulo", "singapore", "sydney", "tokyo", "umatilla"}
+
+// ValidTwilioEdge reports whether edge is a Twilio edge location
+func ValidTwilioEdge(edge string) bool {
+	for _, e := range TwilioEdges {
+		if edge == e {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryPolicy is how a background worker retries a failed operation. The
+// wait after the first failure is Initial, multiplied by Multiplier after
+// each further failure up to Max. Jitter shortens each wait by a random
+// fraction of up to Jitter, so workers that failed together don't retry
+// together.
+type RetryPolicy struct {
+	MaxAttempts int // Attempts before giving up, 0 for no limit
+	Initial     time.Duration
+	Max         time.Duration
+	Multiplier  float64
+	Jitter      float64 // 0 to 1
+}
+
+// DefaultRetryPolicies are the policies of the workers with a retry policy
+var DefaultRetryPolicies = map[string]RetryPolicy{
+	RetryWorkerTwilio:   {MaxAttempts: TwilioMaxRetries, Initial: time.Second, Max: 4 * time.Second, Multiplier: 2},
+	RetryWorkerGotify:   {MaxAttempts: GotifyMaxRetries, Initial: time.Second, Max: 4 * time.Second, Multiplier: 2},
+	RetryWorkerEmail:    {MaxAttempts: EmailMaxAttempts, Initial: EmailRetryBackoff, Max: time.Hour, Multiplier: 2},
+	RetryWorkerSIPTrunk: {Initial: SIPTrunkRetryMin, Max: SIPTrunkRetryMax, Multiplier: 2},
+}
+
+// boundedRetryWorkers retry while the caller waits, so they need an
+// attempt limit
+var boundedRetryWorkers = map[string]bool{RetryWorkerTwilio: true, RetryWorkerGotify: true}
+
+// String formats the policy the way ParseRetryPolicy reads it
+func (p RetryPolicy) String() string {
+	return fmt.Sprintf("attempts=%d,initial=%s,max=%s,multiplier=%s,jitter=%s", p.MaxAttempts, p.Initial, p.Max,
+		strconv.FormatFloat(p.Multiplier, 'f', -1, 64), strconv.FormatFloat(p.Jitter, 'f', -1, 64))
+}
+
+// ParseRetryPolicy reads comma-separated key=value pairs over base, e.g.
+// "attempts=5,initial=2s,max=1m,multiplier=3,jitter=0.2". Keys left out
+// keep base's value.
+func ParseRetryPolicy(base RetryPolicy, s string) (RetryPolicy, error) {
+	p := base
+	for _, pair := range splitAndTrim(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return p, fmt.Errorf("%q is not key=value", pair)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		var err error
+		switch key {
+		case "attempts":
+			p.MaxAttempts, err = strconv.Atoi(value)
+		case "initial":
+			p.Initial, err = time.ParseDuration(value)
+		case "max":
+			p.Max, err = time.ParseDuration(value)
+		case "multiplier":
+			p.Multiplier, err = strconv.ParseFloat(value, 64)
+		case "jitter":
+			p.Jitter, err = strconv.ParseFloat(value, 64)
+		default:
+			return p, fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return p, fmt.Errorf("%s: %q is not valid", key, value)
+		}
+	}
+
+	switch {
+	case p.MaxAttempts < 0:
+		return p, errors.New("attempts must not be negative")
+	case p.Initial <= 0:
+		return p, errors.New("initial must be positive")
+	case p.Max < p.Initial:
+		return p, errors.New("max must be at least initial")
+	case p.Multiplier < 1:
+		return p, errors.New("multiplier must be at least 1")
+	case p.Jitter < 0 || p.Jitter > 1:
+		return p, errors.New("jitter must be between 0 and 1")
+	}
+	return p, nil
+}
+
+// DatabaseConfig selects the database backend
+type DatabaseConfig struct {
+	// Driver is "sqlite", a file in the data directory, or "postgres"
+	Driver string
+	// DSN is the Postgres connection string, e.g.
+	// postgres://gosip:secret@db:5432/gosip?sslmode=disable
+	DSN string
+	// Connection pool limits, used with Postgres. SQLite keeps a single
+	// connection since it has one writer at a time.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// Postgres reports whether the Postgres backend is selected
+func (c *DatabaseConfig) Postgres() bool {
+	return c != nil && c.Driver == DBDriverPostgres
+}
+
+// Validate checks the driver, connection string and pool limits
+func (c *DatabaseConfig) Validate() error {
+	switch c.Driver {
+	case DBDriverSQLite:
+		return nil
+	case DBDriverPostgres:
+	default:
+		return fmt.Errorf("GOSIP_DB_DRIVER must be %s or %s, got %q", DBDriverSQLite, DBDriverPostgres, c.Driver)
+	}
+	if c.DSN == "" {
+		return errors.New("GOSIP_DB_DSN is required with the postgres driver")
+	}
+	if c.MaxOpenConns < 1 {
+		return errors.New("GOSIP_DB_MAX_OPEN_CONNS must be at least 1")
+	}
+	if c.MaxIdleConns < 0 || c.MaxIdleConns > c.MaxOpenConns {
+		return errors.New("GOSIP_DB_MAX_IDLE_CONNS must be between 0 and GOSIP_DB_MAX_OPEN_CONNS")
+	}
+	if c.ConnMaxLifetime < 0 {
+		return errors.New("GOSIP_DB_CONN_MAX_LIFETIME must not be negative")
+	}
+	return nil
+}
+
+// ReplicaConfig holds database replication settings
+type ReplicaConfig struct {
+	// URL is where snapshots are kept: s3://bucket/prefix (with optional
+	// ?region= and ?endpoint= for S3-compatible stores) or a directory such
+	// as file:///mnt/replica. Empty turns replication off.
+	URL string
+	// Interval is how often the database is checked for changes
+	Interval time.Duration
+	// Retention is the number of snapshots kept
+	Retention int
+	// Restore fetches the latest snapshot at startup when there is no database
+	Restore bool
+}
+
+// Enabled reports whether replication is configured
+func (c *ReplicaConfig) Enabled() bool {
+	return c != nil && c.URL != ""
+}
+
+// Validate checks the replica URL and limits
+func (c *ReplicaConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid GOSIP_REPLICA_URL: %w", err)
+	}
+	switch u.Scheme {
+	case "s3":
+		if u.Host == "" {
+			return errors.New("GOSIP_REPLICA_URL has no S3 bucket")
+		}
+	case "file":
+		if u.Path == "" {
+			return errors.New("GOSIP_REPLICA_URL has no directory")
+		}
+	default:
+		return fmt.Errorf("GOSIP_REPLICA_URL must start with s3:// or file://, got %q", u.Scheme)
+	}
+	if c.Interval < time.Second {
+		return errors.New("GOSIP_REPLICA_INTERVAL must be at least 1 second")
+	}
+	if c.Retention < 1 || c.Retention > ReplicaMaxRetention {
+		return fmt.Errorf("GOSIP_REPLICA_RETENTION must be between 1 and %d", ReplicaMaxRetention)
+	}
+	return nil
+}
+
+// APIAllowlistConfig restricts which client addresses may use the web API.
+// SIP, webhooks, provisioning and feed URLs are not affected.
+type APIAllowlistConfig struct {
+	// Networks lists the allowed networks. Empty disables the allowlist.
+	Networks []*net.IPNet
+	// AdminOnly applies the allowlist to admin endpoints only
+	AdminOnly bool
+	// Invalid lists entries that could not be parsed and were ignored
+	Invalid []string
+}
+
+// Enabled reports whether any allowed networks are configured
+func (c *APIAllowlistConfig) Enabled() bool {
+	return c != nil && len(c.Networks) > 0
+}
+
+// Allows reports whether an address is in an allowed network
+func (c *APIAllowlistConfig) Allows(ip net.IP) bool {
+	for _, n := range c.Networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SIPAllowlistConfig restricts which addresses may send SIP over UDP, the
+// transport that can't be protected with TLS
+type SIPAllowlistConfig struct {
+	// TwilioOnly drops UDP SIP requests from outside Twilio's signaling
+	// ranges, private networks and Networks
+	TwilioOnly bool
+	// Networks are also allowed, e.g. the networks of remote phones
+	Networks []*net.IPNet
+	// Invalid lists entries that could not be parsed and were ignored
+	Invalid []string
+	// RangesURL is where fresh Twilio address ranges are fetched from
+	RangesURL string
+}
+
 // Config holds the runtime configuration for GoSIP
 type Config struct {
 	// Server settings
-	SIPPort   int
-	HTTPPort  int
-	DataDir   string
-	SIPDomain string // SIP domain for registrations (e.g., "sip.example.com")
+	SIPPort    int
+	HTTPPort   int
+	DataDir    string
+	SIPDomain  string // SIP domain for registrations (e.g., "sip.example.com")
+	ExternalIP string // Public address phones and carriers reach the server on
+	TFTPPort   int    // TFTP provisioning responder port (0 disables it)
+
+	// Email-to-SMS gateway SMTP listener port (0 disables it), the address
+	// it binds to and the networks other than loopback allowed to send
+	MailGatewayPort      int
+	MailGatewayBind      string
+	MailGatewayAllowlist *APIAllowlistConfig
 
 	// Twilio credentials (loaded from database after setup)
 	TwilioAccountSID string
 	TwilioAuthToken  string
+	// TwilioEdge is the Twilio edge location the API is reached through,
+	// e.g. "dublin". Empty uses Twilio's default, ashburn.
+	TwilioEdge string
 
 	// Email settings
 	SMTPHost     string
@@ -92,10 +545,40 @@ type Config struct {
 	// Feature flags
 	RecordingEnabled bool
 	DebugMode        bool
+	ReadOnly         bool // Reject API changes and keep read-only mode from being turned off (demo instances)
+
+	// Plaintext /status.txt for monitoring that can't use the JSON API
+	StatusPage      bool
+	StatusPageToken string // Required as ?token= or a Bearer token when set
+
+	// Connectivity self-test
+	PublicURL string // Base URL Twilio sends webhooks to, e.g. https://pbx.example.com
+	ProbeURL  string // External service that checks whether the SIP port is reachable
 
 	// CORS configuration
 	CORSOrigins []string // Allowed CORS origins
 
+	// Client networks allowed to use the web API
+	APIAllowlist *APIAllowlistConfig
+
+	// Twilio address ranges UDP SIP is restricted to
+	SIPAllowlist *SIPAllowlistConfig
+
+	// Public IP detection and dynamic DNS
+	WANIP *WANIPConfig
+
+	// Router port forwarding with UPnP or NAT-PMP
+	PortMap *PortMapConfig
+
+	// External secret stores
+	Secrets *SecretsConfig
+
+	// Database backend
+	Database *DatabaseConfig
+
+	// Database replication for warm standby
+	Replica *ReplicaConfig
+
 	// TLS configuration
 	TLS *TLSConfig
 
@@ -104,19 +587,45 @@ type Config struct {
 
 	// ZRTP configuration (optional, for end-to-end encryption)
 	ZRTP *ZRTPConfig
+
+	// Browser calling over WebSocket (optional)
+	WebRTC *WebRTCConfig
+
+	// RTP relay for calls between phones
+	MediaRelay *MediaRelayConfig
+
+	// Concurrent call limits
+	CallLimits *CallLimitsConfig
+
+	// Audio codec preferences
+	Media *MediaConfig
+
+	// Retry policies of background workers by worker name
+	Retry map[string]RetryPolicy
+
+	// Set by LoadFile
+	file     string
+	settings []Setting
+	pinned   map[string]Setting
 }
 
 // Load creates a Config from environment variables with defaults
 func Load() *Config {
 	cfg := &Config{
-		SIPPort:   getEnvInt("GOSIP_SIP_PORT", DefaultSIPPort),
-		HTTPPort:  getEnvInt("GOSIP_HTTP_PORT", DefaultHTTPPort),
-		DataDir:   getEnv("GOSIP_DATA_DIR", DefaultDataDir),
-		SIPDomain: getEnv("GOSIP_SIP_DOMAIN", "localhost"),
+		SIPPort:    getEnvInt("GOSIP_SIP_PORT", DefaultSIPPort),
+		HTTPPort:   getEnvInt("GOSIP_HTTP_PORT", DefaultHTTPPort),
+		DataDir:    getEnv("GOSIP_DATA_DIR", DefaultDataDir),
+		SIPDomain:  getEnv("GOSIP_SIP_DOMAIN", "localhost"),
+		ExternalIP: getEnv("GOSIP_EXTERNAL_IP", ""),
+		TFTPPort:   getEnvInt("GOSIP_TFTP_PORT", 0),
+
+		MailGatewayPort: getEnvInt("GOSIP_MAIL_GATEWAY_PORT", 0),
+		MailGatewayBind: getEnv("GOSIP_MAIL_GATEWAY_BIND", DefaultMailGatewayBind),
 
 		// These are typically loaded from database after initial setup
 		TwilioAccountSID: getEnv("TWILIO_ACCOUNT_SID", ""),
 		TwilioAuthToken:  getEnv("TWILIO_AUTH_TOKEN", ""),
+		TwilioEdge:       strings.ToLower(getEnv("GOSIP_TWILIO_EDGE", "")),
 
 		SMTPHost:     getEnv("SMTP_HOST", ""),
 		SMTPPort:     getEnvInt("SMTP_PORT", 587),
@@ -132,6 +641,13 @@ func Load() *Config {
 
 		RecordingEnabled: getEnvBool("GOSIP_RECORDING_ENABLED", true),
 		DebugMode:        getEnvBool("GOSIP_DEBUG", false),
+		ReadOnly:         getEnvBool("GOSIP_READ_ONLY", false),
+
+		StatusPage:      getEnvBool("GOSIP_STATUS_PAGE", false),
+		StatusPageToken: getEnv("GOSIP_STATUS_TOKEN", ""),
+
+		PublicURL: strings.TrimRight(getEnv("GOSIP_PUBLIC_URL", ""), "/"),
+		ProbeURL:  getEnv("GOSIP_PROBE_URL", ""),
 
 		// CORS configuration with secure defaults for development
 		CORSOrigins: getEnvStringSlice("GOSIP_CORS_ORIGINS", []string{
@@ -151,6 +667,33 @@ func Load() *Config {
 	// Load ZRTP configuration
 	cfg.ZRTP = loadZRTPConfig()
 
+	// Load WebRTC gateway configuration
+	cfg.WebRTC = loadWebRTCConfig()
+
+	// Load media relay configuration
+	cfg.MediaRelay = loadMediaRelayConfig()
+
+	// Load call limit configuration
+	cfg.CallLimits = loadCallLimitsConfig()
+
+	// Load codec preferences
+	cfg.Media = loadMediaConfig()
+
+	// Load API allowlist configuration
+	cfg.APIAllowlist = loadAPIAllowlistConfig()
+	cfg.SIPAllowlist = loadSIPAllowlistConfig()
+	cfg.MailGatewayAllowlist = loadMailGatewayAllowlistConfig()
+
+	// Load public IP detection configuration
+	cfg.WANIP = loadWANIPConfig()
+
+	// Load port mapping configuration
+	cfg.PortMap = loadPortMapConfig()
+	cfg.Secrets = loadSecretsConfig()
+	cfg.Database = loadDatabaseConfig()
+	cfg.Replica = loadReplicaConfig()
+	cfg.Retry = loadRetryConfig()
+
 	return cfg
 }
 
@@ -191,7 +734,208 @@ func loadZRTPConfig() *ZRTPConfig {
 	}
 }
 
-// DBPath returns the full path to the SQLite database file
+// loadWebRTCConfig loads the browser calling gateway settings from
+// environment variables
+func loadWebRTCConfig() *WebRTCConfig {
+	return &WebRTCConfig{
+		Enabled: getEnvBool("GOSIP_WEBRTC_ENABLED", false),
+		Ports:   getEnv("GOSIP_WEBRTC_PORTS", ""),
+	}
+}
+
+// loadCallLimitsConfig loads concurrent call, call duration, hold time and
+// transfer recall limits from environment variables
+func loadCallLimitsConfig() *CallLimitsConfig {
+	holdTimeoutAction := HoldTimeoutRetrieve
+	if getEnv("GOSIP_HOLD_TIMEOUT_ACTION", HoldTimeoutRetrieve) == HoldTimeoutVoicemail {
+		holdTimeoutAction = HoldTimeoutVoicemail
+	}
+	return &CallLimitsConfig{
+		MaxCalls:              getEnvInt("GOSIP_MAX_CALLS", MaxConcurrentCalls),
+		MaxCallsPerDID:        getEnvInt("GOSIP_MAX_CALLS_PER_DID", DefaultMaxCallsPerDID),
+		MaxCallsPerDevice:     getEnvInt("GOSIP_MAX_CALLS_PER_DEVICE", DefaultMaxCallsPerDevice),
+		MaxCallDuration:       getEnvInt("GOSIP_MAX_CALL_DURATION", 0),
+		CallDurationWarning:   getEnvInt("GOSIP_CALL_DURATION_WARNING", DefaultCallDurationWarning),
+		MaxHoldTime:           getEnvInt("GOSIP_MAX_HOLD_TIME", 0),
+		HoldTimeoutAction:     holdTimeoutAction,
+		TransferRecallTimeout: getEnvInt("GOSIP_TRANSFER_RECALL_TIMEOUT", 0),
+	}
+}
+
+// loadMediaRelayConfig loads the RTP relay settings from environment
+// variables
+func loadMediaRelayConfig() *MediaRelayConfig {
+	return &MediaRelayConfig{
+		Mode:  strings.ToLower(getEnv("GOSIP_MEDIA_RELAY", MediaRelayOff)),
+		Ports: getEnv("GOSIP_MEDIA_RELAY_PORTS", ""),
+	}
+}
+
+// loadMediaConfig loads codec preferences and jitter buffer settings from
+// environment variables
+func loadMediaConfig() *MediaConfig {
+	return &MediaConfig{
+		DeviceCodecs:   getEnvStringSlice("GOSIP_DEVICE_CODECS", strings.Split(DefaultDeviceCodecs, ",")),
+		TrunkCodecs:    getEnvStringSlice("GOSIP_TRUNK_CODECS", strings.Split(DefaultTrunkCodecs, ",")),
+		JitterMinDelay: getEnvInt("GOSIP_JITTER_MIN_DELAY", DefaultJitterMinDelay),
+		JitterMaxDelay: getEnvInt("GOSIP_JITTER_MAX_DELAY", DefaultJitterMaxDelay),
+	}
+}
+
+// loadAPIAllowlistConfig loads the API allowlist from environment variables.
+// GOSIP_API_ALLOWLIST is a comma-separated list of CIDRs or single addresses,
+// and GOSIP_API_ALLOWLIST_SCOPE is "all" (default) or "admin".
+func loadAPIAllowlistConfig() *APIAllowlistConfig {
+	cfg := &APIAllowlistConfig{
+		AdminOnly: getEnv("GOSIP_API_ALLOWLIST_SCOPE", "all") == "admin",
+	}
+	for _, entry := range getEnvStringSlice("GOSIP_API_ALLOWLIST", nil) {
+		if network, err := ParseNetwork(entry); err == nil {
+			cfg.Networks = append(cfg.Networks, network)
+		} else {
+			cfg.Invalid = append(cfg.Invalid, entry)
+		}
+	}
+	return cfg
+}
+
+// loadMailGatewayAllowlistConfig loads the networks allowed to send to the
+// email gateway from GOSIP_MAIL_GATEWAY_ALLOWLIST, a comma-separated list of
+// CIDRs or single addresses
+func loadMailGatewayAllowlistConfig() *APIAllowlistConfig {
+	cfg := &APIAllowlistConfig{}
+	for _, entry := range getEnvStringSlice("GOSIP_MAIL_GATEWAY_ALLOWLIST", nil) {
+		if network, err := ParseNetwork(entry); err == nil {
+			cfg.Networks = append(cfg.Networks, network)
+		} else {
+			cfg.Invalid = append(cfg.Invalid, entry)
+		}
+	}
+	return cfg
+}
+
+// loadSIPAllowlistConfig loads the UDP SIP allowlist from environment variables
+func loadSIPAllowlistConfig() *SIPAllowlistConfig {
+	cfg := &SIPAllowlistConfig{
+		TwilioOnly: getEnvBool("GOSIP_SIP_TWILIO_ONLY", false),
+		RangesURL:  getEnv("GOSIP_TWILIO_RANGES_URL", ""),
+	}
+	for _, entry := range getEnvStringSlice("GOSIP_SIP_ALLOWLIST", nil) {
+		if network, err := ParseNetwork(entry); err == nil {
+			cfg.Networks = append(cfg.Networks, network)
+		} else {
+			cfg.Invalid = append(cfg.Invalid, entry)
+		}
+	}
+	return cfg
+}
+
+// loadWANIPConfig loads public IP detection and dynamic DNS settings from
+// environment variables
+func loadWANIPConfig() *WANIPConfig {
+	return &WANIPConfig{
+		Detect:           getEnvBool("GOSIP_WAN_IP_DETECT", false),
+		URLs:             getEnvStringSlice("GOSIP_WAN_IP_URLS", DefaultWANIPURLs),
+		CloudflareToken:  getEnv("GOSIP_DDNS_CLOUDFLARE_TOKEN", ""),
+		CloudflareZoneID: getEnv("GOSIP_DDNS_CLOUDFLARE_ZONE_ID", ""),
+		CloudflareRecord: getEnv("GOSIP_DDNS_CLOUDFLARE_RECORD", ""),
+		DuckDNSToken:     getEnv("GOSIP_DDNS_DUCKDNS_TOKEN", ""),
+		DuckDNSDomains:   getEnvStringSlice("GOSIP_DDNS_DUCKDNS_DOMAINS", nil),
+	}
+}
+
+// loadSecretsConfig loads external secret store settings from the standard
+// Vault and AWS environment variables
+func loadSecretsConfig() *SecretsConfig {
+	return &SecretsConfig{
+		VaultAddr:          getEnv("VAULT_ADDR", ""),
+		VaultToken:         getEnv("VAULT_TOKEN", ""),
+		VaultNamespace:     getEnv("VAULT_NAMESPACE", ""),
+		AWSRegion:          getEnv("AWS_REGION", ""),
+		AWSAccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
+		AWSSecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		AWSSessionToken:    getEnv("AWS_SESSION_TOKEN", ""),
+
+		AWSContainerCredsPath: getEnv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", ""),
+	}
+}
+
+// loadDatabaseConfig loads the database backend from environment variables
+func loadDatabaseConfig() *DatabaseConfig {
+	return &DatabaseConfig{
+		Driver:          strings.ToLower(getEnv("GOSIP_DB_DRIVER", DBDriverSQLite)),
+		DSN:             getEnv("GOSIP_DB_DSN", ""),
+		MaxOpenConns:    getEnvInt("GOSIP_DB_MAX_OPEN_CONNS", DefaultDBMaxOpenConns),
+		MaxIdleConns:    getEnvInt("GOSIP_DB_MAX_IDLE_CONNS", DefaultDBMaxIdleConns),
+		ConnMaxLifetime: time.Duration(getEnvInt("GOSIP_DB_CONN_MAX_LIFETIME", int(DefaultDBConnMaxLifetime/time.Second))) * time.Second,
+	}
+}
+
+// loadReplicaConfig loads database replication settings from environment variables
+func loadReplicaConfig() *ReplicaConfig {
+	return &ReplicaConfig{
+		URL:       getEnv("GOSIP_REPLICA_URL", ""),
+		Interval:  time.Duration(getEnvInt("GOSIP_REPLICA_INTERVAL", int(DefaultReplicaInterval/time.Second))) * time.Second,
+		Retention: getEnvInt("GOSIP_REPLICA_RETENTION", DefaultReplicaRetention),
+		Restore:   getEnvBool("GOSIP_REPLICA_RESTORE", true),
+	}
+}
+
+// loadRetryConfig loads the retry policies of background workers. Each
+// GOSIP_RETRY_<WORKER> variable changes some or all of a worker's policy,
+// e.g. GOSIP_RETRY_TWILIO=attempts=5,jitter=0.2.
+func loadRetryConfig() map[string]RetryPolicy {
+	policies := make(map[string]RetryPolicy, len(DefaultRetryPolicies))
+	for name, def := range DefaultRetryPolicies {
+		policies[name] = def
+		key := "GOSIP_RETRY_" + strings.ToUpper(name)
+		value, source := lookup(key)
+		if value == "" {
+			record(key, def.String(), SourceDefault)
+			continue
+		}
+		p, err := ParseRetryPolicy(def, value)
+		if err == nil && boundedRetryWorkers[name] && p.MaxAttempts == 0 {
+			err = errors.New("attempts must be at least 1")
+		}
+		if err != nil {
+			invalid(key, value, source, "retry policy ("+err.Error()+")")
+			record(key, def.String(), SourceDefault)
+			continue
+		}
+		policies[name] = p
+		record(key, value, source)
+	}
+	return policies
+}
+
+// loadPortMapConfig loads router port forwarding settings from environment variables
+func loadPortMapConfig() *PortMapConfig {
+	return &PortMapConfig{
+		Mode:     strings.ToLower(getEnv("GOSIP_PORTMAP", PortMapOff)),
+		Gateway:  getEnv("GOSIP_PORTMAP_GATEWAY", ""),
+		RTPPorts: getEnv("GOSIP_PORTMAP_RTP_PORTS", ""),
+	}
+}
+
+// ParseNetwork parses a CIDR, or a single IPv4 or IPv6 address as a /32 or /128 network
+func ParseNetwork(s string) (*net.IPNet, error) {
+	if _, network, err := net.ParseCIDR(s); err == nil {
+		return network, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, &net.ParseError{Type: "CIDR address", Text: s}
+	}
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// DBPath returns the full path to the SQLite database file, which is
+// unused with the Postgres backend
 func (c *Config) DBPath() string {
 	return filepath.Join(c.DataDir, DefaultDBFile)
 }
@@ -216,6 +960,16 @@ func (c *Config) CertsPath() string {
 	return filepath.Join(c.DataDir, CertsDir)
 }
 
+// PromptsPath returns the path to the directory of in-call announcement prompts
+func (c *Config) PromptsPath() string {
+	return filepath.Join(c.DataDir, PromptsDir)
+}
+
+// CompliancePath returns the directory compliance exports are written to
+func (c *Config) CompliancePath() string {
+	return filepath.Join(c.DataDir, ComplianceDir)
+}
+
 // EnsureDirectories creates all required data directories
 func (c *Config) EnsureDirectories() error {
 	dirs := []string{
@@ -224,6 +978,8 @@ func (c *Config) EnsureDirectories() error {
 		c.VoicemailsPath(),
 		c.BackupsPath(),
 		c.CertsPath(),
+		c.PromptsPath(),
+		c.CompliancePath(),
 	}
 
 	for _, dir := range dirs {
@@ -237,33 +993,44 @@ func (c *Config) EnsureDirectories() error {
 
 // Helper functions for environment variable parsing
 func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+	value, source := lookup(key)
+	if value == "" {
+		value = defaultValue
 	}
-	return defaultValue
+	record(key, value, source)
+	return value
 }
 
 func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
+	value, source := lookup(key)
+	if value != "" {
 		if intVal, err := strconv.Atoi(value); err == nil {
+			record(key, value, source)
 			return intVal
 		}
+		invalid(key, value, source, "integer")
 	}
+	record(key, strconv.Itoa(defaultValue), SourceDefault)
 	return defaultValue
 }
 
 func getEnvBool(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
+	value, source := lookup(key)
+	if value != "" {
 		if boolVal, err := strconv.ParseBool(value); err == nil {
+			record(key, strconv.FormatBool(boolVal), source)
 			return boolVal
 		}
+		invalid(key, value, source, "boolean")
 	}
+	record(key, strconv.FormatBool(defaultValue), SourceDefault)
 	return defaultValue
 }
 
 // getEnvStringSlice parses a comma-separated environment variable into a string slice
 func getEnvStringSlice(key string, defaultValue []string) []string {
-	if value := os.Getenv(key); value != "" {
+	value, source := lookup(key)
+	if value != "" {
 		// Split on comma and trim whitespace from each element
 		parts := make([]string, 0)
 		for _, part := range splitAndTrim(value, ",") {
@@ -272,9 +1039,11 @@ func getEnvStringSlice(key string, defaultValue []string) []string {
 			}
 		}
 		if len(parts) > 0 {
+			record(key, strings.Join(parts, ","), source)
 			return parts
 		}
 	}
+	record(key, strings.Join(defaultValue, ","), SourceDefault)
 	return defaultValue
 }
 
@@ -1,8 +1,13 @@
 package config
 
 import (
+	"context"
+	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetEnvStringSlice(t *testing.T) {
@@ -187,3 +192,433 @@ func TestSplitString(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadCallLimitsConfig(t *testing.T) {
+	cfg := loadCallLimitsConfig()
+	if cfg.MaxCalls != MaxConcurrentCalls {
+		t.Errorf("MaxCalls default = %d, want %d", cfg.MaxCalls, MaxConcurrentCalls)
+	}
+	if cfg.MaxCallsPerDID != DefaultMaxCallsPerDID {
+		t.Errorf("MaxCallsPerDID default = %d, want %d", cfg.MaxCallsPerDID, DefaultMaxCallsPerDID)
+	}
+	if cfg.MaxCallDuration != 0 || cfg.CallDurationWarning != DefaultCallDurationWarning {
+		t.Errorf("Unexpected call duration defaults %d/%d", cfg.MaxCallDuration, cfg.CallDurationWarning)
+	}
+	if cfg.MaxHoldTime != 0 || cfg.HoldTimeoutAction != HoldTimeoutRetrieve {
+		t.Errorf("Unexpected hold time defaults %d/%s", cfg.MaxHoldTime, cfg.HoldTimeoutAction)
+	}
+	if cfg.TransferRecallTimeout != 0 {
+		t.Errorf("TransferRecallTimeout default = %d, want 0", cfg.TransferRecallTimeout)
+	}
+
+	os.Setenv("GOSIP_MAX_CALLS", "10")
+	os.Setenv("GOSIP_MAX_CALLS_PER_DEVICE", "0")
+	os.Setenv("GOSIP_MAX_CALL_DURATION", "7200")
+	os.Setenv("GOSIP_HOLD_TIMEOUT_ACTION", "voicemail")
+	os.Setenv("GOSIP_TRANSFER_RECALL_TIMEOUT", "25")
+	defer os.Unsetenv("GOSIP_HOLD_TIMEOUT_ACTION")
+	defer os.Unsetenv("GOSIP_TRANSFER_RECALL_TIMEOUT")
+	defer os.Unsetenv("GOSIP_MAX_CALLS")
+	defer os.Unsetenv("GOSIP_MAX_CALLS_PER_DEVICE")
+	defer os.Unsetenv("GOSIP_MAX_CALL_DURATION")
+
+	cfg = loadCallLimitsConfig()
+	if cfg.MaxCalls != 10 {
+		t.Errorf("MaxCalls = %d, want 10", cfg.MaxCalls)
+	}
+	if cfg.MaxCallsPerDevice != 0 {
+		t.Errorf("MaxCallsPerDevice = %d, want 0", cfg.MaxCallsPerDevice)
+	}
+	if cfg.MaxCallDuration != 7200 {
+		t.Errorf("MaxCallDuration = %d, want 7200", cfg.MaxCallDuration)
+	}
+	if cfg.HoldTimeoutAction != HoldTimeoutVoicemail {
+		t.Errorf("HoldTimeoutAction = %s, want voicemail", cfg.HoldTimeoutAction)
+	}
+	if cfg.TransferRecallTimeout != 25 {
+		t.Errorf("TransferRecallTimeout = %d, want 25", cfg.TransferRecallTimeout)
+	}
+}
+
+func TestLoadAPIAllowlistConfig(t *testing.T) {
+	if cfg := loadAPIAllowlistConfig(); cfg.Enabled() {
+		t.Error("Expected the allowlist to be disabled by default")
+	}
+
+	os.Setenv("GOSIP_API_ALLOWLIST", "192.168.1.0/24, 10.8.0.5, fd00::/8, not-a-network")
+	os.Setenv("GOSIP_API_ALLOWLIST_SCOPE", "admin")
+	defer os.Unsetenv("GOSIP_API_ALLOWLIST")
+	defer os.Unsetenv("GOSIP_API_ALLOWLIST_SCOPE")
+
+	cfg := loadAPIAllowlistConfig()
+	if len(cfg.Networks) != 3 || !cfg.AdminOnly {
+		t.Fatalf("Unexpected allowlist %+v", cfg)
+	}
+	if len(cfg.Invalid) != 1 || cfg.Invalid[0] != "not-a-network" {
+		t.Errorf("Invalid = %v, want [not-a-network]", cfg.Invalid)
+	}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"192.168.1.40", true},
+		{"192.168.2.40", false},
+		{"10.8.0.5", true},
+		{"10.8.0.6", false},
+		{"fd12::1", true},
+		{"2001:db8::1", false},
+	}
+	for _, tt := range tests {
+		if got := cfg.Allows(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("Allows(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestLoadSIPAllowlistConfig(t *testing.T) {
+	if cfg := loadSIPAllowlistConfig(); cfg.TwilioOnly || len(cfg.Networks) != 0 {
+		t.Errorf("Expected UDP SIP open by default, got %+v", cfg)
+	}
+
+	os.Setenv("GOSIP_SIP_TWILIO_ONLY", "true")
+	os.Setenv("GOSIP_SIP_ALLOWLIST", "203.0.113.0/24, bogus")
+	defer os.Unsetenv("GOSIP_SIP_TWILIO_ONLY")
+	defer os.Unsetenv("GOSIP_SIP_ALLOWLIST")
+
+	cfg := loadSIPAllowlistConfig()
+	if !cfg.TwilioOnly || len(cfg.Networks) != 1 || len(cfg.Invalid) != 1 || cfg.Invalid[0] != "bogus" {
+		t.Errorf("Unexpected allowlist %+v", cfg)
+	}
+}
+
+func TestPortMapConfig(t *testing.T) {
+	if cfg := loadPortMapConfig(); cfg.Mode != PortMapOff || cfg.Validate() != nil {
+		t.Errorf("Expected port mapping off by default, got %+v", cfg)
+	}
+
+	tests := []struct {
+		mode    string
+		rtp     string
+		low     int
+		high    int
+		wantErr bool
+	}{
+		{PortMapAuto, "", 0, 0, false},
+		{PortMapUPnP, "10000-10099", 10000, 10099, false},
+		{PortMapNATPMP, "16384", 16384, 16384, false},
+		{PortMapAuto, "10000-20000", 0, 0, true},
+		{PortMapAuto, "20000-10000", 0, 0, true},
+		{PortMapAuto, "abc", 0, 0, true},
+		{"pcp", "", 0, 0, true},
+	}
+	for _, tt := range tests {
+		cfg := &PortMapConfig{Mode: tt.mode, RTPPorts: tt.rtp}
+		if err := cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%q, %q) error = %v, want error %v", tt.mode, tt.rtp, err, tt.wantErr)
+		}
+		if low, high, _ := cfg.RTPRange(); low != tt.low || high != tt.high {
+			t.Errorf("RTPRange(%q) = %d-%d, want %d-%d", tt.rtp, low, high, tt.low, tt.high)
+		}
+	}
+}
+
+func TestWebRTCConfig(t *testing.T) {
+	if cfg := loadWebRTCConfig(); cfg.Enabled || cfg.Validate() != nil {
+		t.Errorf("Expected the WebRTC gateway off by default, got %+v", cfg)
+	}
+
+	tests := []struct {
+		ports   string
+		low     int
+		high    int
+		wantErr bool
+	}{
+		{"", 0, 0, false},
+		{"20000-20199", 20000, 20199, false},
+		{"20000", 0, 0, true},
+		{"20000-19000", 0, 0, true},
+		{"rtp", 0, 0, true},
+	}
+	for _, tt := range tests {
+		cfg := &WebRTCConfig{Enabled: true, Ports: tt.ports}
+		if err := cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%q) error = %v, want error %v", tt.ports, err, tt.wantErr)
+		}
+		if low, high, _ := cfg.PortRange(); low != tt.low || high != tt.high {
+			t.Errorf("PortRange(%q) = %d-%d, want %d-%d", tt.ports, low, high, tt.low, tt.high)
+		}
+	}
+}
+
+func TestMediaRelayConfig(t *testing.T) {
+	if cfg := loadMediaRelayConfig(); cfg.Mode != MediaRelayOff || cfg.Validate() != nil {
+		t.Errorf("Expected the media relay off by default, got %+v", cfg)
+	}
+
+	os.Setenv("GOSIP_MEDIA_RELAY", "NAT")
+	defer os.Unsetenv("GOSIP_MEDIA_RELAY")
+	if cfg := loadMediaRelayConfig(); cfg.Mode != MediaRelayNAT {
+		t.Errorf("Expected mode nat, got %q", cfg.Mode)
+	}
+
+	tests := []struct {
+		mode    string
+		ports   string
+		wantErr bool
+	}{
+		{MediaRelayAlways, "", false},
+		{MediaRelayAlways, "30000-30999", false},
+		{MediaRelayNAT, "30000-30002", true},
+		{MediaRelayAlways, "30000", true},
+		{"sometimes", "", true},
+	}
+	for _, tt := range tests {
+		cfg := &MediaRelayConfig{Mode: tt.mode, Ports: tt.ports}
+		if err := cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%q, %q) error = %v, want error %v", tt.mode, tt.ports, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDatabaseConfig(t *testing.T) {
+	if cfg := loadDatabaseConfig(); cfg.Driver != DBDriverSQLite || cfg.Postgres() || cfg.Validate() != nil {
+		t.Errorf("Expected SQLite by default, got %+v", cfg)
+	}
+
+	os.Setenv("GOSIP_DB_DRIVER", "Postgres")
+	defer os.Unsetenv("GOSIP_DB_DRIVER")
+	if cfg := loadDatabaseConfig(); !cfg.Postgres() || cfg.Validate() == nil {
+		t.Errorf("Expected postgres without a DSN to be invalid, got %+v", cfg)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     DatabaseConfig
+		wantErr bool
+	}{
+		{"postgres", DatabaseConfig{Driver: DBDriverPostgres, DSN: "postgres://db/gosip", MaxOpenConns: 10, MaxIdleConns: 2}, false},
+		{"no open connections", DatabaseConfig{Driver: DBDriverPostgres, DSN: "postgres://db/gosip", MaxOpenConns: 0}, true},
+		{"more idle than open", DatabaseConfig{Driver: DBDriverPostgres, DSN: "postgres://db/gosip", MaxOpenConns: 2, MaxIdleConns: 3}, true},
+		{"negative lifetime", DatabaseConfig{Driver: DBDriverPostgres, DSN: "postgres://db/gosip", MaxOpenConns: 2, ConnMaxLifetime: -time.Second}, true},
+		{"unknown driver", DatabaseConfig{Driver: "mysql", DSN: "gosip@/gosip"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gosip.yaml")
+	os.WriteFile(path, []byte(`
+gosip:
+  sip_port: 5070
+  http_port: 8081
+  tls:
+    enabled: true
+  public_url: https://pbx.example.com/
+  cors_origins:
+    - https://a.example.com
+    - https://b.example.com
+smtp_host: smtp.file.example.com
+settings:
+  timezone: Europe/Berlin
+  discovery_enabled: 1
+`), 0o600)
+
+	os.Setenv("GOSIP_HTTP_PORT", "9090")
+	os.Setenv("GOSIP_SETTING_INTERCOM_PREFIX", "**")
+	defer os.Unsetenv("GOSIP_HTTP_PORT")
+	defer os.Unsetenv("GOSIP_SETTING_INTERCOM_PREFIX")
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.SIPPort != 5070 || !cfg.TLS.Enabled || cfg.SMTPHost != "smtp.file.example.com" {
+		t.Errorf("File values not applied: sip_port=%d tls=%v smtp_host=%q", cfg.SIPPort, cfg.TLS.Enabled, cfg.SMTPHost)
+	}
+	if cfg.HTTPPort != 9090 {
+		t.Errorf("HTTPPort = %d, want the environment's 9090", cfg.HTTPPort)
+	}
+	if len(cfg.CORSOrigins) != 2 || cfg.CORSOrigins[1] != "https://b.example.com" {
+		t.Errorf("CORSOrigins = %v", cfg.CORSOrigins)
+	}
+
+	sources := make(map[string]string)
+	for _, s := range cfg.Settings() {
+		sources[s.Key] = s.Source
+	}
+	for key, want := range map[string]string{
+		"GOSIP_SIP_PORT":    SourceFile,
+		"GOSIP_HTTP_PORT":   SourceEnv,
+		"GOSIP_TFTP_PORT":   SourceDefault,
+		"GOSIP_TLS_ENABLED": SourceFile,
+	} {
+		if sources[key] != want {
+			t.Errorf("%s source = %q, want %q", key, sources[key], want)
+		}
+	}
+
+	pinned := cfg.PinnedSettings()
+	if got := pinned["timezone"]; got.Value != "Europe/Berlin" || got.Source != SourceFile {
+		t.Errorf("timezone = %+v", got)
+	}
+	if got := pinned["discovery_enabled"]; got.Value != "true" {
+		t.Errorf("discovery_enabled = %q, want true", got.Value)
+	}
+	if got := pinned["intercom_prefix"]; got.Value != "**" || got.Source != SourceEnv {
+		t.Errorf("intercom_prefix = %+v", got)
+	}
+	if got := pinned["public_base_url"]; got.Value != "https://pbx.example.com" || got.Source != SourceFile {
+		t.Errorf("public_base_url = %+v, want pinned by GOSIP_PUBLIC_URL", got)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"unknown setting", "gosip:\n  sip_prot: 5060\n", "unknown setting GOSIP_SIP_PROT"},
+		{"bad integer", "gosip:\n  sip_port: five\n", "GOSIP_SIP_PORT (from file)"},
+		{"bad port", "gosip:\n  http_port: 70000\n", "GOSIP_HTTP_PORT: 70000 is not a valid port"},
+		{"unknown database setting", "settings:\n  colour: blue\n", "unknown database setting colour"},
+		{"bad database boolean", "settings:\n  discovery_enabled: maybe\n", "discovery_enabled (from file)"},
+		{"bad port mapping", "gosip:\n  portmap: pcp\n", "invalid port mapping mode"},
+		{"bad twilio edge", "gosip:\n  twilio_edge: london\n", "\"london\" is not a Twilio edge location"},
+		{"bad retry policy", "gosip:\n  retry:\n    email: jitter=2\n", "GOSIP_RETRY_EMAIL (from file)"},
+		{"unbounded retries", "gosip:\n  retry:\n    twilio: attempts=0\n", "attempts must be at least 1"},
+		{"invalid yaml", "gosip: [\n", "invalid config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "gosip.yaml")
+			os.WriteFile(path, []byte(tt.yaml), 0o600)
+			_, err := LoadFile(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadFile() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+	if _, err := LoadFile(""); err != nil {
+		t.Errorf("LoadFile(\"\") error = %v", err)
+	}
+}
+
+type memorySettings map[string]string
+
+func (m memorySettings) Get(ctx context.Context, key string) (string, error) {
+	return m[key], nil
+}
+
+func (m memorySettings) Set(ctx context.Context, key, value string) error {
+	m[key] = value
+	return nil
+}
+
+func TestApplySettings(t *testing.T) {
+	cfg := &Config{pinned: map[string]Setting{"timezone": {Key: "timezone", Value: "Europe/Berlin", Source: SourceFile}}}
+	store := memorySettings{"timezone": "America/New_York", "smtp_host": "smtp.example.com"}
+	if err := cfg.ApplySettings(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+	if store["timezone"] != "Europe/Berlin" || store["smtp_host"] != "smtp.example.com" {
+		t.Errorf("Stored settings = %v", store)
+	}
+}
+
+func TestLoadFileSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "twilio_auth_token"), []byte("tw-secret\n"), 0o600)
+	os.WriteFile(filepath.Join(dir, "smtp_password"), []byte("smtp-secret"), 0o600)
+	path := filepath.Join(dir, "gosip.yaml")
+	os.WriteFile(path, []byte("smtp:\n  password_file: "+filepath.Join(dir, "smtp_password")+"\n"), 0o600)
+
+	os.Setenv("TWILIO_AUTH_TOKEN_FILE", filepath.Join(dir, "twilio_auth_token"))
+	defer os.Unsetenv("TWILIO_AUTH_TOKEN_FILE")
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.TwilioAuthToken != "tw-secret" || cfg.SMTPPassword != "smtp-secret" {
+		t.Errorf("Secrets = %q, %q", cfg.TwilioAuthToken, cfg.SMTPPassword)
+	}
+	for _, s := range cfg.Settings() {
+		if (s.Key == "TWILIO_AUTH_TOKEN" || s.Key == "SMTP_PASSWORD") && s.Source != SourceSecretFile {
+			t.Errorf("%s source = %q, want %q", s.Key, s.Source, SourceSecretFile)
+		}
+	}
+
+	os.Setenv("TWILIO_AUTH_TOKEN_FILE", filepath.Join(dir, "missing"))
+	if _, err := LoadFile(path); err == nil || !strings.Contains(err.Error(), "TWILIO_AUTH_TOKEN_FILE") {
+		t.Errorf("LoadFile() error = %v, want one naming TWILIO_AUTH_TOKEN_FILE", err)
+	}
+}
+
+func TestLoadMediaConfig(t *testing.T) {
+	cfg := loadMediaConfig()
+	if strings.Join(cfg.DeviceCodecs, ",") != DefaultDeviceCodecs || strings.Join(cfg.TrunkCodecs, ",") != DefaultTrunkCodecs {
+		t.Errorf("Unexpected codec defaults %v/%v", cfg.DeviceCodecs, cfg.TrunkCodecs)
+	}
+	if cfg.JitterMinDelay != DefaultJitterMinDelay || cfg.JitterMaxDelay != DefaultJitterMaxDelay {
+		t.Errorf("Unexpected jitter buffer defaults %d/%d", cfg.JitterMinDelay, cfg.JitterMaxDelay)
+	}
+
+	os.Setenv("GOSIP_DEVICE_CODECS", "G722, PCMU")
+	defer os.Unsetenv("GOSIP_DEVICE_CODECS")
+	if cfg = loadMediaConfig(); strings.Join(cfg.DeviceCodecs, ",") != "G722,PCMU" {
+		t.Errorf("DeviceCodecs = %v, want [G722 PCMU]", cfg.DeviceCodecs)
+	}
+
+	os.Setenv("GOSIP_JITTER_MAX_DELAY", "300")
+	defer os.Unsetenv("GOSIP_JITTER_MAX_DELAY")
+	if cfg = loadMediaConfig(); cfg.JitterMaxDelay != 300 {
+		t.Errorf("JitterMaxDelay = %d, want 300", cfg.JitterMaxDelay)
+	}
+}
+
+func TestParseRetryPolicy(t *testing.T) {
+	base := DefaultRetryPolicies[RetryWorkerTwilio]
+
+	p, err := ParseRetryPolicy(base, "attempts=5, max=10s,jitter=0.25")
+	if err != nil {
+		t.Fatalf("ParseRetryPolicy() error = %v", err)
+	}
+	if p.MaxAttempts != 5 || p.Max != 10*time.Second || p.Jitter != 0.25 || p.Initial != base.Initial || p.Multiplier != base.Multiplier {
+		t.Errorf("Unexpected policy %+v", p)
+	}
+	if back, err := ParseRetryPolicy(RetryPolicy{}, p.String()); err != nil || back != p {
+		t.Errorf("String() doesn't parse back: %+v, %v", back, err)
+	}
+
+	for _, spec := range []string{"attempts", "attempts=-1", "initial=0s", "max=500ms", "multiplier=0.5", "jitter=1.5", "backoff=2", "initial=soon"} {
+		if _, err := ParseRetryPolicy(base, spec); err == nil {
+			t.Errorf("ParseRetryPolicy(%q) should fail", spec)
+		}
+	}
+}
+
+func TestLoadRetryConfig(t *testing.T) {
+	cfg := loadRetryConfig()
+	for name, def := range DefaultRetryPolicies {
+		if cfg[name] != def {
+			t.Errorf("%s policy = %+v, want the default %+v", name, cfg[name], def)
+		}
+	}
+
+	os.Setenv("GOSIP_RETRY_SIP_TRUNK", "attempts=10,jitter=0.1")
+	defer os.Unsetenv("GOSIP_RETRY_SIP_TRUNK")
+	cfg = loadRetryConfig()
+	if p := cfg[RetryWorkerSIPTrunk]; p.MaxAttempts != 10 || p.Jitter != 0.1 || p.Initial != SIPTrunkRetryMin {
+		t.Errorf("Unexpected sip_trunk policy %+v", p)
+	}
+}
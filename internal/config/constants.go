@@ -17,17 +17,137 @@ const (
 const (
 	MaxFailedLoginAttempts   = 5
 	LoginLockoutDuration     = 15 * time.Minute
+	MaxFailedAccountAttempts = 10               // Per-account limit across all IP addresses
+	LoginFailureWindow       = 15 * time.Minute // Failures further apart start a new count
+	LoginLockoutMaxDuration  = 24 * time.Hour   // Cap for the doubling cooldown of repeat lockouts
+	LoginLockoutResetAfter   = 24 * time.Hour   // Quiet period after which cooldowns start over
+	LoginAttemptRetention    = 90 * 24 * time.Hour
 	SessionDuration          = 24 * time.Hour
 	SessionRefreshOnActivity = true
 	SpamScoreThreshold       = 0.7 // Calls > 0.7 blocked
 )
 
+// Password policy settings
+const (
+	DefaultPasswordMinLength = 8
+	PasswordMinLengthFloor   = 8                                       // Admins can't set a lower minimum
+	PasswordMaxLength        = 72                                      // bcrypt ignores bytes past 72
+	GeneratedPasswordLength  = 20                                      // SIP device passwords generated when none is given
+	BreachCheckURL           = "https://api.pwnedpasswords.com/range/" // Pwned Passwords k-anonymity range API
+	BreachCheckTimeout       = 5 * time.Second
+)
+
 // Voicemail settings - P0 requirements
 const (
 	VoicemailRingTimeout    = 30 * time.Second
 	VoicemailMaxLength      = 180 * time.Second // 3 minutes
 	VoicemailMinLength      = 3 * time.Second   // Shorter discarded
 	VoicemailSilenceTimeout = 10 * time.Second
+	// DefaultGreetingFeatureCode is dialed to record greetings by phone
+	DefaultGreetingFeatureCode = "*97"
+)
+
+// Local voicemail settings, for calls GoSIP answers itself rather than Twilio
+const (
+	VoicemailGreetingPrompt = "voicemail_greeting" // Prompt played to callers of mailboxes without an uploaded greeting, when present
+	VoicemailFullPrompt     = "voicemail_full"     // Prompt played before hanging up on callers to a full mailbox, when present
+	VoicemailBeepLength     = 500 * time.Millisecond
+	VoicemailSilenceLevel   = 45 // Audio quieter than this many -dBov counts as the caller not speaking
+	GreetingsDir            = "greetings" // Uploaded greetings, below the prompts directory
+)
+
+// Voicemail podcast feed settings
+const (
+	VoicemailFeedSize         = 100              // Most recent voicemails listed in a feed
+	VoicemailFeedAudioTimeout = 60 * time.Second // Limit for relaying one recording to a podcast app
+)
+
+// Voicemail quota settings
+const (
+	VoicemailBytesPerSecond   = 4000 // Size of a recording estimated from its length, as 32 kbit/s MP3
+	VoicemailQuotaWarnPercent = 80   // Usage at which a mailbox is warned it is nearly full
+)
+
+// Concurrent call limit defaults (0 disables the cap)
+const (
+	DefaultMaxCallsPerDID    = 2
+	DefaultMaxCallsPerDevice = 2
+)
+
+// Call duration limit settings
+const (
+	DefaultCallDurationWarning = 60                 // Seconds before a call duration limit the warning plays
+	MaxRouteCallDuration       = 24 * 60 * 60       // Longest call duration limit a route can set, in seconds
+	CallDurationWarningPrompt  = "duration_warning" // Prompt played as the warning, when present
+	CallDurationCheckInterval  = time.Second        // How often connected calls are checked against their limit
+)
+
+// Codec preference defaults, most preferred first. Phones on the LAN get
+// wideband audio; Twilio trunk legs are G.711 only.
+const (
+	DefaultDeviceCodecs = "opus,G722,PCMU,PCMA"
+	DefaultTrunkCodecs  = "PCMU,PCMA"
+)
+
+// Comfort noise settings (RFC 3389)
+const (
+	ComfortNoiseLevel        = 70 // Level of the comfort noise GoSIP generates, in -dBov
+	ComfortNoiseSilenceLevel = 60 // Audio quieter than this many -dBov counts as silence
+	ComfortNoiseUpdateFrames = 10 // 20 ms frames between CN updates during silence
+)
+
+// Jitter buffer playout delay bounds, in milliseconds. The delay adapts to
+// the measured jitter between them.
+const (
+	DefaultJitterMinDelay = 40
+	DefaultJitterMaxDelay = 200
+)
+
+// SIP trace settings for call diagnostics
+const (
+	SIPTraceMessages  = 50               // Messages kept for each call
+	SIPTraceCalls     = 100              // Most recent calls kept
+	SIPTraceRetention = 30 * time.Minute // How long a call's messages are kept after its last one
+)
+
+// Hold time limit settings
+const (
+	HoldTimeoutRetrieve  = "retrieve"       // Resume a call held too long and ring the holder
+	HoldTimeoutVoicemail = "voicemail"      // Send the caller of a call held too long to voicemail
+	HoldRecallPrompt     = "hold_recall"    // Prompt played to the holder of a retrieved call, when present
+	HoldRetrieveTimeout  = 10 * time.Second // Limit for the re-INVITE that takes a call off hold
+	HoldDiversionTimeout = time.Minute      // Limit for Twilio to ask for the voicemail of a call held too long
+)
+
+// TransferRecallPrompt is played to the transferor of a blind transfer the
+// target didn't answer, when present
+const TransferRecallPrompt = "transfer_recall"
+
+// Device call settings
+const (
+	DefaultIntercomPrefix  = "*80"            // Dialed before an extension to place an intercom call
+	DeviceRingTimeout      = 60 * time.Second // Limit for a device to answer a call relayed to it
+	MinExtensionLength     = 3                // Shortest internal extension number
+	MaxExtensionLength     = 6                // Longest internal extension number
+	DefaultDIDSelectPrefix = "*5"             // Dialed with a DID position to pick the outbound caller ID
+	DefaultAnonymousPrefix = "*67"            // Dialed before a number to withhold the caller ID
+	SIPMessageTimeout      = 10 * time.Second // Limit for delivering texts and read receipts to a device
+	DeviceActionTimeout    = 10 * time.Second // Limit for a phone to accept a remote reboot or resync
+	DigitMapTimeout        = 4 * time.Second  // Wait after the last digit before phones dial a number that isn't an extension
+)
+
+// Device health telemetry settings
+const (
+	DeviceTelemetryInterval          = 5 * time.Minute     // How often registered phones are pinged with OPTIONS
+	DevicePingTimeout                = 5 * time.Second     // Limit for a phone to answer a ping
+	DeviceTelemetryRetention         = 30 * 24 * time.Hour // How long telemetry samples are kept
+	DeviceHealthDefaultHours         = 24                  // Health period when none is given
+	DeviceHealthMaxHours             = 720                 // Longest health period
+	DeviceHealthRTTWarningMs         = 150                 // Average ping time above which a phone is flagged
+	DeviceHealthLossWarningPercent   = 10                  // Share of unanswered pings above which a phone is flagged
+	DeviceHealthLossCriticalPercent  = 50                  // Share of unanswered pings above which a phone is failing
+	DeviceHealthJitterWarningSeconds = 30                  // Registration interval jitter above which a phone is flagged
+	DeviceHealthRestartWarningCount  = 2                   // Restarts in the period above which a phone is flagged
 )
 
 // API pagination defaults
@@ -36,15 +156,247 @@ const (
 	MaxPageSize     = 100
 )
 
+// CDR reprocessing settings
+const (
+	CDRReprocessBatchSize = 500 // CDRs read at a time
+	CDRReprocessMaxListed = 500 // Changed CDRs listed in a report
+)
+
+// Cost estimation settings
+const (
+	RateImportMaxBytes  = 5 << 20 // Largest rate table CSV upload
+	RateImportMaxRows   = 50000   // Entries in one rate table
+	BillingSyncMaxItems = 200     // Calls and messages priced per Twilio sync
+)
+
+// User preference limits
+const (
+	PreferenceMaxBytes   = 16 << 10 // Largest JSON value for one preference
+	PreferenceMaxTables  = 50       // Tables with a saved column layout
+	PreferenceMaxColumns = 100      // Columns in one table layout
+)
+
+// Dashboard aggregation settings
+const (
+	DashboardCacheTTL        = 5 * time.Second // Shared by all dashboard clients
+	DashboardBalanceCacheTTL = 5 * time.Minute // Twilio balance is a remote API call
+	DashboardRecentEvents    = 10
+)
+
+// LAN device discovery settings
+const (
+	DiscoveryScanTimeout = 3 * time.Second // How long a scan listens for SSDP/mDNS responses
+)
+
+// Provisioning responder settings
+const (
+	ProvisioningSelfTestTimeout     = 5 * time.Second // Per-check limit when probing the provisioning URL
+	ProvisioningSelfTestFile        = "gosip-selftest.txt"
+	ProvisioningResponderMaxMisses  = 20          // Unknown file names one client may request per window
+	ProvisioningResponderMissWindow = time.Minute // Window the miss limit applies to
+)
+
+// Community blocklist feed settings
+const (
+	DefaultBlocklistFeedSchedule = "0 */6 * * *"    // Cron expression for feed refreshes
+	BlocklistFeedTimeout         = 30 * time.Second // Per-feed download limit
+	BlocklistFeedMaxBytes        = 10 << 20         // Larger feeds are truncated
+)
+
+// Calendar sync settings
+const (
+	CalendarSyncInterval = 5 * time.Minute    // How often linked calendars are refreshed
+	CalendarSyncTimeout  = 30 * time.Second   // Per-calendar download limit
+	CalendarSyncWindow   = 7 * 24 * time.Hour // How far ahead busy blocks are synced
+	CalendarMaxBytes     = 10 << 20           // Larger calendars are truncated
+)
+
+// On-call schedule settings
+const (
+	OnCallMaxLevels      = 5                   // Escalation levels per schedule
+	OnCallDefaultTimeout = 30                  // Seconds a level rings before escalating
+	OnCallMaxTimeout     = 300                 // Longest a level may ring
+	OnCallDefaultShift   = 7 * 24              // Hours per shift when none is given
+	OnCallFeedPast       = 7 * 24 * time.Hour  // Past shifts included in the iCal feed
+	OnCallFeedAhead      = 90 * 24 * time.Hour // Upcoming shifts included in the iCal feed
+	OnCallMaxShiftRange  = 92 * 24 * time.Hour // Longest range the shifts endpoint returns
+)
+
+// Escalation policy settings
+const (
+	EscalationMaxLevels      = 5   // Levels per policy
+	EscalationMaxRepeat      = 5   // Passes through the levels
+	EscalationMaxTargets     = 10  // Devices and numbers rung at once, Twilio's <Dial> limit
+	EscalationDefaultTimeout = 30  // Seconds a level rings before escalating
+	EscalationMaxTimeout     = 300 // Longest a level may ring
+	EscalationAcceptTimeout  = 10  // Seconds an answering party has to press a digit
+)
+
+// Runtime log level settings
+const (
+	LogDebugDefaultMinutes = 15  // Temporary debug logging length when none is given
+	LogDebugMaxMinutes     = 240 // Longest temporary debug logging period
+)
+
+// Connectivity self-test settings
+const (
+	SelfTestCheckTimeout = 10 * time.Second      // Per-check limit
+	SelfTestMinFreeDisk  = 1 << 30               // Free bytes below which the data directory fails
+	SelfTestEdgeSamples  = 3                     // Connections timed per Twilio edge, the fastest counts
+	SelfTestEdgeMargin   = 20 * time.Millisecond // How much faster another edge must be to suggest it
+)
+
+// Storage guardrail settings
+const (
+	StorageCheckInterval    = 5 * time.Minute     // How often disk usage is measured
+	DefaultStorageMinFreeMB = 1024                // Free space below which new recordings are refused
+	StorageBackupMaxAge     = 30 * 24 * time.Hour // Older backups are suggested for cleanup
+	StorageFileMaxAge       = 90 * 24 * time.Hour // Older recordings and exports are suggested for cleanup
+	MediaVerifyInterval     = 24 * time.Hour      // How often recording and voicemail files are checked against their checksums
+)
+
+// Public IP monitoring settings
+const (
+	WANIPCheckInterval = 5 * time.Minute  // How often the public address is looked up
+	WANIPCheckTimeout  = 10 * time.Second // Per-request limit for IP services and DNS providers
+)
+
+// TwilioRangesFetchTimeout limits fetching Twilio's address ranges from
+// GOSIP_TWILIO_RANGES_URL
+const TwilioRangesFetchTimeout = 10 * time.Second
+
+// TrunkFailoverCheckInterval is how often Twilio trunk disaster recovery
+// settings are checked against what was configured
+const TrunkFailoverCheckInterval = time.Hour
+
+// DIDWebhookCheckInterval is how often the webhooks of configured Twilio
+// numbers are checked against this server's public URL
+const DIDWebhookCheckInterval = time.Hour
+
+// DIDWebhookCheckTimeout limits the check that the public URL reaches this
+// server before numbers are pointed at it
+const DIDWebhookCheckTimeout = 10 * time.Second
+
+// PublicURLCheckInterval is how often the public base URL is checked for
+// DNS, TLS and reachability problems
+const PublicURLCheckInterval = time.Hour
+
+// PublicURLCheckTimeout limits each public base URL check
+const PublicURLCheckTimeout = 10 * time.Second
+
+// PublicURLCertWarning is how long before its certificate expires the
+// public base URL's TLS check starts failing
+const PublicURLCertWarning = 14 * 24 * time.Hour
+
+// ConfigCheckTimeout limits each reachability check of a proposed
+// configuration change
+const ConfigCheckTimeout = 5 * time.Second
+
+// DefaultWANIPURLs are plain-text IP echo services, tried in order
+var DefaultWANIPURLs = []string{
+	"https://api.ipify.org",
+	"https://ipv4.icanhazip.com",
+	"https://checkip.amazonaws.com",
+}
+
+// Router port mapping settings
+const (
+	PortMapLease         = time.Hour       // Lease requested for each forward
+	PortMapRetryInterval = 5 * time.Minute // Delay before retrying after a failure
+	PortMapTimeout       = 5 * time.Second // Limit for finding the router and each request
+	PortMapMaxRTPPorts   = 200             // Routers hold a limited number of forwards
+)
+
+// SecretsTimeout limits each request to an external secret store
+const SecretsTimeout = 10 * time.Second
+
+// Database backends
+const (
+	DBDriverSQLite   = "sqlite"
+	DBDriverPostgres = "postgres"
+
+	DefaultDBMaxOpenConns    = 20        // Postgres connections kept open at most
+	DefaultDBMaxIdleConns    = 5         // Idle Postgres connections kept for reuse
+	DefaultDBConnMaxLifetime = time.Hour // Connections are replaced after this long
+)
+
+// Database replication settings
+const (
+	DefaultReplicaInterval  = 10 * time.Second // How often the database is checked for changes
+	DefaultReplicaRetention = 24               // Snapshots kept in the replica
+	ReplicaMaxRetention     = 1000             // One S3 listing page
+	ReplicaTimeout          = 2 * time.Minute  // Limit for each upload or download
+)
+
+// Scheduled change set settings
+const (
+	ChangeSetCheckInterval = 15 * time.Second // How often due change sets are applied or reverted
+	ChangeSetMaxChanges    = 100              // Changes in one change set
+)
+
+// Diagnostics bundle settings
+const (
+	DiagnosticsMaxCrashes  = 50  // Recovered panics kept in memory
+	DiagnosticsMaxLogLines = 500 // Recent log lines kept in memory
+)
+
+// Conversation export settings
+const (
+	ExportMediaTimeout  = 15 * time.Second // Per-attachment download limit
+	ExportMediaMaxBytes = 5 << 20          // Larger attachments are listed by URL instead of embedded
+)
+
+// Message channel settings
+const (
+	MediaProbeTimeout = 5 * time.Second // Per-attachment size lookup before sending
+)
+
+// Link shortening settings, for links in outbound messages
+const (
+	ShortLinkCodeLength = 7     // Characters in a short link's code
+	ShortLinkPath       = "/l/" // Where short links are served, under the public base URL
+)
+
+// Email gateway settings
+const (
+	MailGatewayMaxMessageSize = 1 << 20     // Larger emails are refused before SMS conversion
+	DefaultMailGatewayBind    = "127.0.0.1" // Only local mail servers reach the listener unless set otherwise
+	MailGatewaySenderMaxSMS   = 30          // Texts one sender may send per window
+	MailGatewaySenderWindow   = time.Hour   // Window the per-sender limit applies to
+)
+
+// Announcement settings
+const (
+	AnnouncementCheckInterval  = time.Hour           // How often system health checks run
+	CertExpiryWarning          = 14 * 24 * time.Hour // Warn when the TLS certificate expires within this window
+	AnnouncementMessageMaxSize = 1000
+)
+
+// Event stream settings
+const (
+	EventHistorySize       = 500              // Events retained for Last-Event-ID resume
+	EventKeepAliveInterval = 15 * time.Second // Comment lines keep idle proxies from closing the stream
+	EventRetryInterval     = 3 * time.Second  // Reconnect delay suggested to SSE clients
+	EventWriteTimeout      = 10 * time.Second // WebSocket clients that take longer to read an event are dropped
+)
+
 // Retry/Recovery settings - P0 requirements
 const (
 	TwilioMaxRetries   = 3
 	TwilioRetryBackoff = true // Exponential backoff
-	EmailMaxRetries    = 3
-	EmailRetryWindow   = 1 * time.Hour
 	GotifyMaxRetries   = 3
 )
 
+// Background workers with a retry policy, overridable with
+// GOSIP_RETRY_<WORKER>
+const (
+	RetryWorkerTwilio   = "twilio"    // Twilio API sends
+	RetryWorkerGotify   = "gotify"    // Push notifications
+	RetryWorkerEmail    = "email"     // Queued emails
+	RetryWorkerSIPTrunk = "sip_trunk" // Registrations with other SIP providers
+	RetryWorkerACME     = "acme"      // Certificate orders, retried by certmagic on its own schedule
+)
+
 // SIP Server defaults
 const (
 	DefaultSIPPort      = 5060
@@ -53,6 +405,16 @@ const (
 	RegistrationExpires = 3600 // seconds
 )
 
+// SIP event subscription settings
+const (
+	SubscriptionExpires       = 3600        // Seconds, when a SUBSCRIBE has no Expires; also the longest allowed
+	MinSubscriptionExpires    = 60          // Shortest subscription accepted, in seconds
+	MaxSubscriptionsPerAOR    = 10          // Most subscriptions to one address per event package
+	SubscribeRateLimit        = 30          // SUBSCRIBE requests accepted from one address per SubscribeRateWindow
+	SubscribeRateWindow       = time.Minute // Window for SubscribeRateLimit
+	SubscriptionNotifyTimeout = 5 * time.Second
+)
+
 // Database paths
 const (
 	DefaultDataDir    = "./data"
@@ -61,6 +423,8 @@ const (
 	VoicemailsDir     = "voicemails"
 	BackupsDir        = "backups"
 	CertsDir          = "certs"
+	PromptsDir        = "prompts"
+	ComplianceDir     = "compliance"
 )
 
 // TLS defaults
@@ -77,3 +441,88 @@ const (
 const (
 	DefaultSRTPProfile = "AES_CM_128_HMAC_SHA1_80"
 )
+
+// WebRTC gateway settings
+const (
+	WebRTCHandshakeTimeout = 30 * time.Second // Limit for ICE and DTLS once the call is answered
+	WebRTCMediaTimeout     = 60 * time.Second // Browsers send ICE consent checks every 5 seconds, so silence this long means the tab is gone
+)
+
+// Browser phone settings
+const (
+	WebCredentialTTL        = 12 * time.Hour // How long a browser phone's password works; the page fetches a new one before then
+	WebCredentialsPerDevice = 8              // Passwords a device keeps at once, one per open browser tab
+	WebPhoneUsernamePrefix  = "web-"         // Browser phone devices are named after their user's ID
+)
+
+// Media relay settings
+const (
+	MediaRelayTimeout = 5 * time.Minute // Calls are ended when neither phone sends RTP or RTCP this long; held phones still send RTCP
+)
+
+// Conference settings
+const (
+	ConferenceMaxParticipants = 10 // Parties a conference can have, the original two included
+)
+
+// Email queue settings
+const (
+	EmailQueueInterval  = 30 * time.Second   // How often due emails are retried
+	EmailQueueBatchSize = 50                 // Emails tried per run
+	EmailMaxAttempts    = 8                  // Attempts before an email becomes a dead letter
+	EmailRetryBackoff   = 30 * time.Second   // Delay after the first failure, doubling each time: about an hour in all
+	EmailSentRetention  = 7 * 24 * time.Hour // Delivered emails are kept this long
+	SMTPDialTimeout     = 10 * time.Second   // Connecting to the relay
+	SMTPSessionTimeout  = 60 * time.Second   // The whole SMTP dialog
+)
+
+// CORS defaults
+const (
+	CORSMaxAge       = 300 // Seconds browsers may cache a preflight response
+	CORSMaxOverrides = 20  // Per-route CORS overrides an admin may configure
+)
+
+// Phone number verification settings
+const (
+	VerificationCodeLength     = 6                // Digits in a one-time code
+	VerificationTTL            = 10 * time.Minute // How long a code can be checked
+	VerificationMaxAttempts    = 5                // Wrong codes before a verification fails
+	VerificationResendCooldown = 30 * time.Second // Minimum time between codes to one number
+	VerificationSendWindow     = time.Hour        // Window the send limits below apply to
+	VerificationMaxPerNumber   = 5                // Codes sent to one number per window
+	VerificationMaxPerUser     = 50               // Codes one user may send per window
+	VerificationRetention      = 30 * 24 * time.Hour
+)
+
+// Webhook route condition settings
+const (
+	RuleWebhookDefaultTimeout = 2 * time.Second // Wait for a verdict when the condition sets none
+	RuleWebhookMaxTimeout     = 5 * time.Second // Longest a condition may wait, well inside Twilio's webhook limit
+	RuleWebhookMaxBytes       = 64 << 10        // Larger verdicts are rejected
+)
+
+// Outbound SIP trunk registration settings
+const (
+	SIPTrunkDefaultExpires = 3600             // Registration lifetime asked for when a trunk sets none
+	SIPTrunkMinExpires     = 60               // Shortest lifetime a trunk may ask for
+	SIPTrunkMaxExpires     = 86400            // Longest lifetime a trunk may ask for
+	SIPTrunkRequestTimeout = 10 * time.Second // Limit for a provider to answer a REGISTER
+	SIPTrunkRetryMin       = 30 * time.Second // Wait after the first failed registration, doubling with each failure
+	SIPTrunkRetryMax       = 30 * time.Minute // Longest wait between failed registrations
+)
+
+// DTMF settings, for digits GoSIP sends into calls
+const (
+	DTMFDigitDuration = 100 * time.Millisecond // How long each digit is held
+	DTMFDigitGap      = 100 * time.Millisecond // Silence between digits
+	MaxDTMFDigits     = 32                     // Digits one request may send
+)
+
+// Appointment reminder settings
+const (
+	ReminderCheckInterval     = time.Minute    // How often due reminders are sent
+	ReminderDefaultLead       = 24 * time.Hour // How long before the appointment a reminder is sent when no time is given
+	ReminderDigestWindow      = 24 * time.Hour // Appointments the daily digest lists, from when it is sent
+	DefaultReminderDigestHour = 7              // Hour the daily digest is sent in the system timezone
+	MaxReminderTemplateLength = 640            // Characters in a reminder's message text
+)
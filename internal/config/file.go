@@ -0,0 +1,373 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Where a setting's value came from, in order of precedence
+const (
+	SourceEnv        = "env"
+	SourceSecretFile = "secret_file" // Read from the file named by <KEY>_FILE
+	SourceFile       = "file"
+	SourceDatabase   = "database" // Changed in the web UI
+	SourceDefault    = "default"
+)
+
+// secretFileSuffix names a variable holding the path of a file to read a
+// setting from, e.g. TWILIO_AUTH_TOKEN_FILE=/run/secrets/twilio_auth_token
+const secretFileSuffix = "_FILE"
+
+// settingEnvPrefix marks environment variables that set a database setting,
+// e.g. GOSIP_SETTING_TIMEZONE
+const settingEnvPrefix = "GOSIP_SETTING_"
+
+// DatabaseSettings are the settings stored in the database and changed in
+// the web UI. The config file and environment can pin them.
+var DatabaseSettings = []string{
+	"anonymous_prefix",
+	"blocklist_feed_schedule",
+	"blocklist_feeds_enabled",
+	"blocklist_reject_code",
+	"default_language",
+	"did_select_prefix",
+	"discovery_enabled",
+	"gotify_token",
+	"gotify_url",
+	"intercom_prefix",
+	"link_shortening_enabled",
+	"notification_email",
+	"provisioning_responder_enabled",
+	"public_base_url",
+	"reminder_digest_hour",
+	"smtp_host",
+	"smtp_password",
+	"smtp_port",
+	"smtp_user",
+	"storage_min_free_mb",
+	"timezone",
+	"twilio_account_sid",
+	"twilio_auth_token",
+	"twilio_messaging_service_sid",
+	"voicemail_greeting",
+}
+
+// boolDatabaseSettings and intDatabaseSettings are checked when pinned
+var (
+	boolDatabaseSettings = map[string]bool{"blocklist_feeds_enabled": true, "discovery_enabled": true, "link_shortening_enabled": true, "provisioning_responder_enabled": true}
+	intDatabaseSettings  = map[string]bool{"blocklist_reject_code": true, "reminder_digest_hour": true, "smtp_port": true, "storage_min_free_mb": true}
+)
+
+// Setting is a resolved configuration value and where it came from
+type Setting struct {
+	Key    string `json:"key"` // Environment variable, or database key for database settings
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// SettingsStore holds the database settings
+type SettingsStore interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key, value string) error
+}
+
+// resolver looks settings up in the environment, then the config file, and
+// records where each value came from
+type resolver struct {
+	file     map[string]string // Environment variable name to value
+	settings map[string]Setting
+	errs     []error
+}
+
+var (
+	// loadMu serializes loads, since the getEnv helpers share active
+	loadMu sync.Mutex
+	active *resolver
+)
+
+// lookup returns the value of an environment variable, falling back to the
+// config file while a file is being loaded. Either can instead name a file
+// to read the value from with a _FILE suffix, as Docker secrets do.
+func lookup(key string) (string, string) {
+	if value := os.Getenv(key); value != "" {
+		return value, SourceEnv
+	}
+	if path := os.Getenv(key + secretFileSuffix); path != "" {
+		return readSecretFile(key, path), SourceSecretFile
+	}
+	if active != nil {
+		if value, ok := active.file[key]; ok && value != "" {
+			return value, SourceFile
+		}
+		if path, ok := active.file[key+secretFileSuffix]; ok && path != "" {
+			return readSecretFile(key, path), SourceSecretFile
+		}
+	}
+	return "", SourceDefault
+}
+
+// readSecretFile reads a setting from a file, dropping the trailing newline
+// most editors and secret managers add
+func readSecretFile(key, path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if active != nil {
+			active.errs = append(active.errs, fmt.Errorf("%s%s: %w", key, secretFileSuffix, err))
+		}
+		return ""
+	}
+	return strings.TrimRight(string(data), "\r\n")
+}
+
+// record notes the value a setting resolved to
+func record(key, value, source string) {
+	if active != nil {
+		active.settings[key] = Setting{Key: key, Value: value, Source: source}
+	}
+}
+
+// invalid notes a value that couldn't be parsed. Outside LoadFile the
+// default is used silently, as it always has been.
+func invalid(key, value, source, kind string) {
+	if active != nil {
+		active.errs = append(active.errs, fmt.Errorf("%s (from %s): %q is not a valid %s", key, source, value, kind))
+	}
+}
+
+// LoadFile creates a Config from environment variables, then the YAML file
+// at path, then defaults. An empty path reads no file. Unknown settings and
+// values that can't be parsed are reported as one error.
+func LoadFile(path string) (*Config, error) {
+	r := &resolver{file: map[string]string{}, settings: map[string]Setting{}}
+	var pinned map[string]string
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		var dbSettings map[string]string
+		if r.file, dbSettings, err = parseFile(data); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		pinned = dbSettings
+	}
+
+	loadMu.Lock()
+	active = r
+	cfg := Load()
+	active = nil
+	loadMu.Unlock()
+
+	errs := r.errs
+	for key := range r.file {
+		_, ok := r.settings[key]
+		if !ok && strings.HasSuffix(key, secretFileSuffix) {
+			_, ok = r.settings[strings.TrimSuffix(key, secretFileSuffix)]
+		}
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown setting %s in %s", key, path))
+		}
+	}
+
+	cfg.file = path
+	cfg.pinned = map[string]Setting{}
+	for key, value := range pinned {
+		cfg.pinned[key] = Setting{Key: key, Value: value, Source: SourceFile}
+	}
+	for _, key := range DatabaseSettings {
+		if value := os.Getenv(settingEnvPrefix + strings.ToUpper(key)); value != "" {
+			cfg.pinned[key] = Setting{Key: key, Value: value, Source: SourceEnv}
+		}
+	}
+	// GOSIP_PUBLIC_URL predates the public_base_url setting and still pins it
+	if _, ok := cfg.pinned["public_base_url"]; !ok && cfg.PublicURL != "" {
+		cfg.pinned["public_base_url"] = Setting{Key: "public_base_url", Value: cfg.PublicURL, Source: r.settings["GOSIP_PUBLIC_URL"].Source}
+	}
+	known := make(map[string]bool, len(DatabaseSettings))
+	for _, key := range DatabaseSettings {
+		known[key] = true
+	}
+	for key, s := range cfg.pinned {
+		switch {
+		case !known[key]:
+			errs = append(errs, fmt.Errorf("unknown database setting %s in %s", key, path))
+		case boolDatabaseSettings[key]:
+			b, err := strconv.ParseBool(s.Value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s (from %s): %q is not a valid boolean", key, s.Source, s.Value))
+				continue
+			}
+			// The web UI stores and compares "true" and "false"
+			s.Value = strconv.FormatBool(b)
+			cfg.pinned[key] = s
+		case intDatabaseSettings[key]:
+			if _, err := strconv.Atoi(s.Value); err != nil {
+				errs = append(errs, fmt.Errorf("%s (from %s): %q is not a valid integer", key, s.Source, s.Value))
+			}
+		}
+	}
+
+	for _, port := range []struct {
+		key   string
+		value int
+	}{{"GOSIP_SIP_PORT", cfg.SIPPort}, {"GOSIP_HTTP_PORT", cfg.HTTPPort}, {"GOSIP_TLS_PORT", cfg.TLS.Port}} {
+		if port.value < 1 || port.value > 65535 {
+			errs = append(errs, fmt.Errorf("%s: %d is not a valid port", port.key, port.value))
+		}
+	}
+	if err := cfg.PortMap.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := cfg.Database.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := cfg.Replica.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Replica.Enabled() && cfg.Database.Postgres() {
+		errs = append(errs, errors.New("GOSIP_REPLICA_URL can't be used with the postgres driver, which has its own replication"))
+	}
+	if err := cfg.WebRTC.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := cfg.MediaRelay.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.TwilioEdge != "" && !ValidTwilioEdge(cfg.TwilioEdge) {
+		errs = append(errs, fmt.Errorf("GOSIP_TWILIO_EDGE: %q is not a Twilio edge location", cfg.TwilioEdge))
+	}
+
+	cfg.settings = make([]Setting, 0, len(r.settings))
+	for _, s := range r.settings {
+		cfg.settings = append(cfg.settings, s)
+	}
+	sort.Slice(cfg.settings, func(i, j int) bool { return cfg.settings[i].Key < cfg.settings[j].Key })
+
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+		return nil, errors.Join(errs...)
+	}
+	return cfg, nil
+}
+
+// parseFile flattens a YAML config file into environment variable names:
+// nested keys are joined with underscores and upper-cased, so
+// gosip: {tls: {enabled: true}} sets GOSIP_TLS_ENABLED. Lists become
+// comma-separated values. The settings section holds database settings.
+func parseFile(data []byte) (map[string]string, map[string]string, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+
+	values := map[string]string{}
+	dbSettings := map[string]string{}
+	for key, v := range doc {
+		if key == "settings" {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, nil, errors.New("settings must be a mapping of database settings")
+			}
+			for k, sv := range m {
+				s, err := scalar(sv)
+				if err != nil {
+					return nil, nil, fmt.Errorf("settings.%s: %w", k, err)
+				}
+				dbSettings[k] = s
+			}
+			continue
+		}
+		if err := flatten(strings.ToUpper(key), v, values); err != nil {
+			return nil, nil, err
+		}
+	}
+	return values, dbSettings, nil
+}
+
+func flatten(prefix string, v interface{}, out map[string]string) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if err := flatten(prefix+"_"+strings.ToUpper(key), child, out); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			s, err := scalar(item)
+			if err != nil {
+				return fmt.Errorf("%s: %w", prefix, err)
+			}
+			parts[i] = s
+		}
+		out[prefix] = strings.Join(parts, ",")
+	default:
+		s, err := scalar(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", prefix, err)
+		}
+		out[prefix] = s
+	}
+	return nil
+}
+
+func scalar(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("expected a single value, got %T", v)
+}
+
+// File returns the config file path, empty when none was read
+func (c *Config) File() string {
+	return c.file
+}
+
+// Settings returns every server setting with its value and source, sorted by key
+func (c *Config) Settings() []Setting {
+	return append([]Setting(nil), c.settings...)
+}
+
+// PinnedSettings returns the database settings set by the config file or
+// environment, which ApplySettings writes over the stored values
+func (c *Config) PinnedSettings() map[string]Setting {
+	pinned := make(map[string]Setting, len(c.pinned))
+	for key, s := range c.pinned {
+		pinned[key] = s
+	}
+	return pinned
+}
+
+// ApplySettings stores the pinned database settings, replacing values
+// changed in the web UI
+func (c *Config) ApplySettings(ctx context.Context, store SettingsStore) error {
+	keys := make([]string, 0, len(c.pinned))
+	for key := range c.pinned {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if current, err := store.Get(ctx, key); err == nil && current == c.pinned[key].Value {
+			continue
+		}
+		if err := store.Set(ctx, key, c.pinned[key].Value); err != nil {
+			return fmt.Errorf("failed to store %s: %w", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrAnnouncementNotFound = errors.New("announcement not found")
+
+// Announcement levels
+const (
+	AnnouncementLevelInfo    = "info"
+	AnnouncementLevelWarning = "warning"
+)
+
+// Announcement sources
+const (
+	AnnouncementSourceAdmin  = "admin"
+	AnnouncementSourceSystem = "system"
+)
+
+// announcementColumns is the column list shared by all announcement queries
+const announcementColumns = `id, level, title, message, source, system_key, starts_at, ends_at, created_by, created_at, updated_at`
+
+// AnnouncementRepository handles database operations for announcement banners
+type AnnouncementRepository struct {
+	db *sql.DB
+}
+
+// NewAnnouncementRepository creates a new AnnouncementRepository
+func NewAnnouncementRepository(db *sql.DB) *AnnouncementRepository {
+	return &AnnouncementRepository{db: db}
+}
+
+func scanAnnouncement(row rowScanner) (*models.Announcement, error) {
+	a := &models.Announcement{}
+	err := row.Scan(&a.ID, &a.Level, &a.Title, &a.Message, &a.Source, &a.Key,
+		&a.StartsAt, &a.EndsAt, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrAnnouncementNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (r *AnnouncementRepository) query(ctx context.Context, query string, args ...interface{}) ([]*models.Announcement, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var announcements []*models.Announcement
+	for rows.Next() {
+		a, err := scanAnnouncement(rows)
+		if err != nil {
+			return nil, err
+		}
+		announcements = append(announcements, a)
+	}
+	return announcements, rows.Err()
+}
+
+// Create inserts an admin announcement
+func (r *AnnouncementRepository) Create(ctx context.Context, a *models.Announcement) error {
+	now := time.Now()
+	a.Source = AnnouncementSourceAdmin
+	a.Key = nil
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO announcements (level, title, message, source, starts_at, ends_at, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, a.Level, a.Title, a.Message, a.Source, a.StartsAt, a.EndsAt, a.CreatedBy, now, now).Scan(&a.ID); err != nil {
+		return err
+	}
+	a.CreatedAt = now
+	a.UpdatedAt = now
+	return nil
+}
+
+// GetByID retrieves an announcement by ID
+func (r *AnnouncementRepository) GetByID(ctx context.Context, id int64) (*models.Announcement, error) {
+	return scanAnnouncement(r.db.QueryRowContext(ctx, `
+		SELECT `+announcementColumns+` FROM announcements WHERE id = ?
+	`, id))
+}
+
+// GetByKey retrieves the system announcement raised by a check
+func (r *AnnouncementRepository) GetByKey(ctx context.Context, key string) (*models.Announcement, error) {
+	return scanAnnouncement(r.db.QueryRowContext(ctx, `
+		SELECT `+announcementColumns+` FROM announcements WHERE system_key = ?
+	`, key))
+}
+
+// List returns all announcements, including scheduled and expired ones, newest first
+func (r *AnnouncementRepository) List(ctx context.Context) ([]*models.Announcement, error) {
+	return r.query(ctx, `SELECT `+announcementColumns+` FROM announcements ORDER BY created_at DESC, id DESC`)
+}
+
+// ListActive returns the announcements shown at now: warnings first, then newest first
+func (r *AnnouncementRepository) ListActive(ctx context.Context, now time.Time) ([]*models.Announcement, error) {
+	return r.query(ctx, `
+		SELECT `+announcementColumns+` FROM announcements
+		WHERE (starts_at IS NULL OR starts_at <= ?) AND (ends_at IS NULL OR ends_at > ?)
+		ORDER BY CASE level WHEN 'warning' THEN 0 ELSE 1 END, created_at DESC, id DESC
+	`, now, now)
+}
+
+// Update saves changes to an admin announcement
+func (r *AnnouncementRepository) Update(ctx context.Context, a *models.Announcement) error {
+	a.UpdatedAt = time.Now()
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE announcements SET level = ?, title = ?, message = ?, starts_at = ?, ends_at = ?, updated_at = ?
+		WHERE id = ? AND source = ?
+	`, a.Level, a.Title, a.Message, a.StartsAt, a.EndsAt, a.UpdatedAt, a.ID, AnnouncementSourceAdmin)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrAnnouncementNotFound
+	}
+	return nil
+}
+
+// Delete removes an announcement. Dismissed system announcements are raised
+// again if their check still fails.
+func (r *AnnouncementRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM announcements WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrAnnouncementNotFound
+	}
+	return nil
+}
+
+// Raise creates or updates the system announcement for a check
+func (r *AnnouncementRepository) Raise(ctx context.Context, key, level, title, message string) error {
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO announcements (level, title, message, source, system_key, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(system_key) DO UPDATE SET level = excluded.level, title = excluded.title,
+			message = excluded.message, updated_at = excluded.updated_at
+	`, level, title, message, AnnouncementSourceSystem, key, now, now)
+	return err
+}
+
+// Clear removes the system announcement for a check, reporting whether one was shown
+func (r *AnnouncementRepository) Clear(ctx context.Context, key string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM announcements WHERE system_key = ?`, key)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestAnnouncementRepository_ListActive(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	for _, a := range []*models.Announcement{
+		{Level: AnnouncementLevelInfo, Message: "always"},
+		{Level: AnnouncementLevelWarning, Message: "maintenance", StartsAt: &past, EndsAt: &future},
+		{Level: AnnouncementLevelInfo, Message: "scheduled", StartsAt: &future},
+		{Level: AnnouncementLevelInfo, Message: "over", EndsAt: &past},
+	} {
+		if err := db.Announcements.Create(ctx, a); err != nil {
+			t.Fatalf("Failed to create announcement: %v", err)
+		}
+	}
+
+	active, err := db.Announcements.ListActive(ctx, now)
+	if err != nil {
+		t.Fatalf("Failed to list active announcements: %v", err)
+	}
+	if len(active) != 2 {
+		t.Fatalf("Expected 2 active announcements, got %d", len(active))
+	}
+	if active[0].Message != "maintenance" || active[1].Message != "always" {
+		t.Errorf("Expected warning first, got %q then %q", active[0].Message, active[1].Message)
+	}
+
+	all, err := db.Announcements.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list announcements: %v", err)
+	}
+	if len(all) != 4 {
+		t.Errorf("Expected 4 announcements, got %d", len(all))
+	}
+}
+
+func TestAnnouncementRepository_RaiseAndClear(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	if err := db.Announcements.Raise(ctx, "backup_failed", AnnouncementLevelWarning, "Backup failed", "first"); err != nil {
+		t.Fatalf("Failed to raise announcement: %v", err)
+	}
+	if err := db.Announcements.Raise(ctx, "backup_failed", AnnouncementLevelWarning, "Backup failed", "second"); err != nil {
+		t.Fatalf("Failed to raise announcement again: %v", err)
+	}
+
+	all, _ := db.Announcements.List(ctx)
+	if len(all) != 1 {
+		t.Fatalf("Expected raising twice to keep one announcement, got %d", len(all))
+	}
+	a := all[0]
+	if a.Source != AnnouncementSourceSystem || a.Key == nil || *a.Key != "backup_failed" || a.Message != "second" {
+		t.Errorf("Unexpected system announcement %+v", a)
+	}
+
+	a.Message = "edited"
+	if err := db.Announcements.Update(ctx, a); err != ErrAnnouncementNotFound {
+		t.Errorf("Expected system announcements to be read-only, got %v", err)
+	}
+
+	cleared, err := db.Announcements.Clear(ctx, "backup_failed")
+	if err != nil || !cleared {
+		t.Fatalf("Expected announcement to be cleared, got %v, %v", cleared, err)
+	}
+	cleared, err = db.Announcements.Clear(ctx, "backup_failed")
+	if err != nil || cleared {
+		t.Errorf("Expected nothing left to clear, got %v, %v", cleared, err)
+	}
+}
@@ -22,19 +22,13 @@ func NewAutoReplyRepository(db *sql.DB) *AutoReplyRepository {
 
 // Create inserts a new auto-reply rule
 func (r *AutoReplyRepository) Create(ctx context.Context, ar *models.AutoReply) error {
-	result, err := r.db.ExecContext(ctx, `
+	if err := r.db.QueryRowContext(ctx, `
 		INSERT INTO auto_replies (did_id, trigger_type, trigger_data, reply_text, enabled)
 		VALUES (?, ?, ?, ?, ?)
-	`, ar.DIDID, ar.TriggerType, ar.TriggerData, ar.ReplyText, ar.Enabled)
-	if err != nil {
-		return err
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
+		RETURNING id
+	`, ar.DIDID, ar.TriggerType, ar.TriggerData, ar.ReplyText, ar.Enabled).Scan(&ar.ID); err != nil {
 		return err
 	}
-	ar.ID = id
 	return nil
 }
 
@@ -136,7 +130,7 @@ func (r *AutoReplyRepository) ListByDID(ctx context.Context, didID int64) ([]*mo
 func (r *AutoReplyRepository) ListEnabled(ctx context.Context) ([]*models.AutoReply, error) {
 	rows, err := r.db.QueryContext(ctx, `
 		SELECT id, did_id, trigger_type, trigger_data, reply_text, enabled
-		FROM auto_replies WHERE enabled = 1 ORDER BY did_id, trigger_type
+		FROM auto_replies WHERE enabled = TRUE ORDER BY did_id, trigger_type
 	`)
 	if err != nil {
 		return nil, err
@@ -164,7 +158,7 @@ func (r *AutoReplyRepository) ListEnabled(ctx context.Context) ([]*models.AutoRe
 func (r *AutoReplyRepository) ListEnabledByDID(ctx context.Context, didID int64) ([]*models.AutoReply, error) {
 	rows, err := r.db.QueryContext(ctx, `
 		SELECT id, did_id, trigger_type, trigger_data, reply_text, enabled
-		FROM auto_replies WHERE did_id = ? AND enabled = 1 ORDER BY trigger_type
+		FROM auto_replies WHERE did_id = ? AND enabled = TRUE ORDER BY trigger_type
 	`, didID)
 	if err != nil {
 		return nil, err
@@ -195,7 +189,7 @@ func (r *AutoReplyRepository) GetByTriggerType(ctx context.Context, didID int64,
 	var triggerData []byte
 	err := r.db.QueryRowContext(ctx, `
 		SELECT id, did_id, trigger_type, trigger_data, reply_text, enabled
-		FROM auto_replies WHERE did_id = ? AND trigger_type = ? AND enabled = 1
+		FROM auto_replies WHERE did_id = ? AND trigger_type = ? AND enabled = TRUE
 	`, didID, triggerType).Scan(&ar.ID, &nullDIDID, &ar.TriggerType, &triggerData, &ar.ReplyText, &ar.Enabled)
 	if err == sql.ErrNoRows {
 		return nil, ErrAutoReplyNotFound
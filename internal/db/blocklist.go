@@ -25,19 +25,13 @@ func NewBlocklistRepository(db *sql.DB) *BlocklistRepository {
 
 // Create inserts a new blocklist entry
 func (r *BlocklistRepository) Create(ctx context.Context, entry *models.BlocklistEntry) error {
-	result, err := r.db.ExecContext(ctx, `
+	if err := r.db.QueryRowContext(ctx, `
 		INSERT INTO blocklist (pattern, pattern_type, reason, created_at)
 		VALUES (?, ?, ?, ?)
-	`, entry.Pattern, entry.PatternType, entry.Reason, time.Now())
-	if err != nil {
-		return err
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
+		RETURNING id
+	`, entry.Pattern, entry.PatternType, entry.Reason, time.Now()).Scan(&entry.ID); err != nil {
 		return err
 	}
-	entry.ID = id
 	return nil
 }
 
@@ -0,0 +1,205 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrBlocklistFeedNotFound = errors.New("blocklist feed not found")
+
+// BlocklistFeedRepository handles database operations for spam number feeds
+// and the community blocklist they populate
+type BlocklistFeedRepository struct {
+	db *sql.DB
+}
+
+// NewBlocklistFeedRepository creates a new BlocklistFeedRepository
+func NewBlocklistFeedRepository(db *sql.DB) *BlocklistFeedRepository {
+	return &BlocklistFeedRepository{db: db}
+}
+
+const blocklistFeedColumns = `id, name, url, enabled, entry_count, last_fetched_at, last_success_at, last_error, created_at`
+
+func scanBlocklistFeed(row interface{ Scan(...interface{}) error }) (*models.BlocklistFeed, error) {
+	f := &models.BlocklistFeed{}
+	if err := row.Scan(&f.ID, &f.Name, &f.URL, &f.Enabled, &f.EntryCount, &f.LastFetchedAt, &f.LastSuccessAt, &f.LastError, &f.CreatedAt); err != nil {
+		return nil, err
+	}
+	f.Status = feedStatus(f)
+	return f, nil
+}
+
+// feedStatus summarizes the health of a feed from its last refresh
+func feedStatus(f *models.BlocklistFeed) string {
+	switch {
+	case !f.Enabled:
+		return "disabled"
+	case f.LastFetchedAt == nil:
+		return "pending"
+	case f.LastError != nil:
+		return "error"
+	default:
+		return "ok"
+	}
+}
+
+// Create inserts a new feed
+func (r *BlocklistFeedRepository) Create(ctx context.Context, feed *models.BlocklistFeed) error {
+	now := time.Now()
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO blocklist_feeds (name, url, enabled, created_at)
+		VALUES (?, ?, ?, ?)
+		RETURNING id
+	`, feed.Name, feed.URL, feed.Enabled, now).Scan(&feed.ID); err != nil {
+		return err
+	}
+	feed.CreatedAt = now
+	feed.Status = feedStatus(feed)
+	return nil
+}
+
+// GetByID retrieves a feed by ID
+func (r *BlocklistFeedRepository) GetByID(ctx context.Context, id int64) (*models.BlocklistFeed, error) {
+	f, err := scanBlocklistFeed(r.db.QueryRowContext(ctx, `
+		SELECT `+blocklistFeedColumns+` FROM blocklist_feeds WHERE id = ?
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrBlocklistFeedNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// List returns all feeds
+func (r *BlocklistFeedRepository) List(ctx context.Context) ([]*models.BlocklistFeed, error) {
+	return r.list(ctx, `SELECT `+blocklistFeedColumns+` FROM blocklist_feeds ORDER BY name`)
+}
+
+// ListEnabled returns the feeds that are refreshed on schedule
+func (r *BlocklistFeedRepository) ListEnabled(ctx context.Context) ([]*models.BlocklistFeed, error) {
+	return r.list(ctx, `SELECT `+blocklistFeedColumns+` FROM blocklist_feeds WHERE enabled = TRUE ORDER BY name`)
+}
+
+func (r *BlocklistFeedRepository) list(ctx context.Context, query string) ([]*models.BlocklistFeed, error) {
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feeds []*models.BlocklistFeed
+	for rows.Next() {
+		f, err := scanBlocklistFeed(rows)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, f)
+	}
+	return feeds, rows.Err()
+}
+
+// Update updates a feed's name, URL and enabled flag
+func (r *BlocklistFeedRepository) Update(ctx context.Context, feed *models.BlocklistFeed) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE blocklist_feeds SET name = ?, url = ?, enabled = ?
+		WHERE id = ?
+	`, feed.Name, feed.URL, feed.Enabled, feed.ID)
+	return err
+}
+
+// Delete removes a feed along with the numbers it published
+func (r *BlocklistFeedRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM blocklist_feeds WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrBlocklistFeedNotFound
+	}
+	return nil
+}
+
+// RecordSuccess replaces a feed's numbers with the latest download and clears its error
+func (r *BlocklistFeedRepository) RecordSuccess(ctx context.Context, id int64, numbers []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM community_blocklist WHERE feed_id = ?`, id); err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO community_blocklist (feed_id, number) VALUES (?, ?) ON CONFLICT DO NOTHING`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, number := range numbers {
+		if _, err := stmt.ExecContext(ctx, id, communityNumber(number)); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE blocklist_feeds SET
+			entry_count = (SELECT COUNT(*) FROM community_blocklist WHERE feed_id = ?),
+			last_fetched_at = ?, last_success_at = ?, last_error = NULL
+		WHERE id = ?
+	`, id, now, now, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RecordFailure stores a refresh error, keeping the numbers from the last successful refresh
+func (r *BlocklistFeedRepository) RecordFailure(ctx context.Context, id int64, message string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE blocklist_feeds SET last_fetched_at = ?, last_error = ?
+		WHERE id = ?
+	`, time.Now(), message, id)
+	return err
+}
+
+// IsListed checks whether a number is published by any enabled feed and
+// returns the first such feed
+func (r *BlocklistFeedRepository) IsListed(ctx context.Context, number string) (bool, *models.BlocklistFeed, error) {
+	f, err := scanBlocklistFeed(r.db.QueryRowContext(ctx, `
+		SELECT `+blocklistFeedColumns+`
+		FROM community_blocklist
+		JOIN blocklist_feeds ON blocklist_feeds.id = community_blocklist.feed_id
+		WHERE number = ? AND enabled = TRUE
+		ORDER BY blocklist_feeds.id LIMIT 1
+	`, communityNumber(number)))
+	if err == sql.ErrNoRows {
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	return true, f, nil
+}
+
+// CountEntries returns the number of distinct numbers on the community blocklist
+func (r *BlocklistFeedRepository) CountEntries(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(DISTINCT number) FROM community_blocklist`).Scan(&count)
+	return count, err
+}
+
+// communityNumber reduces a number to its digits, since feeds disagree on
+// whether to include the leading +
+func communityNumber(number string) string {
+	return strings.TrimPrefix(normalizeNumber(number), "+")
+}
@@ -0,0 +1,212 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrCalendarNotFound = errors.New("calendar not found")
+
+// Calendar providers
+const (
+	CalendarProviderCalDAV = "caldav"
+	CalendarProviderGoogle = "google"
+)
+
+// CalendarRepository handles database operations for linked user calendars
+// and the busy blocks synced from them
+type CalendarRepository struct {
+	db *sql.DB
+}
+
+// NewCalendarRepository creates a new CalendarRepository
+func NewCalendarRepository(db *sql.DB) *CalendarRepository {
+	return &CalendarRepository{db: db}
+}
+
+const calendarColumns = `id, user_id, provider, url, username, password, enabled, last_synced_at, last_error, created_at`
+
+func scanCalendar(row rowScanner) (*models.UserCalendar, error) {
+	c := &models.UserCalendar{}
+	if err := row.Scan(&c.ID, &c.UserID, &c.Provider, &c.URL, &c.Username, &c.Password, &c.Enabled, &c.LastSyncedAt, &c.LastError, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+	c.Status = calendarStatus(c)
+	return c, nil
+}
+
+// calendarStatus summarizes the health of a calendar from its last sync
+func calendarStatus(c *models.UserCalendar) string {
+	switch {
+	case !c.Enabled:
+		return "disabled"
+	case c.LastSyncedAt == nil:
+		return "pending"
+	case c.LastError != nil:
+		return "error"
+	default:
+		return "ok"
+	}
+}
+
+// GetByUser retrieves the calendar linked to a user
+func (r *CalendarRepository) GetByUser(ctx context.Context, userID int64) (*models.UserCalendar, error) {
+	c, err := scanCalendar(r.db.QueryRowContext(ctx, `
+		SELECT `+calendarColumns+` FROM user_calendars WHERE user_id = ?
+	`, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrCalendarNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ListEnabled returns the calendars that are synced on schedule
+func (r *CalendarRepository) ListEnabled(ctx context.Context) ([]*models.UserCalendar, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+calendarColumns+` FROM user_calendars WHERE enabled = TRUE ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var calendars []*models.UserCalendar
+	for rows.Next() {
+		c, err := scanCalendar(rows)
+		if err != nil {
+			return nil, err
+		}
+		calendars = append(calendars, c)
+	}
+	return calendars, rows.Err()
+}
+
+// Save links a calendar to its user, replacing any calendar linked before
+// along with its busy blocks
+func (r *CalendarRepository) Save(ctx context.Context, c *models.UserCalendar) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_calendars WHERE user_id = ?`, c.UserID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var id int64
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO user_calendars (user_id, provider, url, username, password, enabled, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, c.UserID, c.Provider, c.URL, c.Username, c.Password, c.Enabled, now).Scan(&id); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	c.ID = id
+	c.CreatedAt = now
+	c.LastSyncedAt = nil
+	c.LastError = nil
+	c.Status = calendarStatus(c)
+	return nil
+}
+
+// DeleteByUser unlinks a user's calendar
+func (r *CalendarRepository) DeleteByUser(ctx context.Context, userID int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM user_calendars WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrCalendarNotFound
+	}
+	return nil
+}
+
+// RecordSuccess replaces a calendar's busy blocks with the latest sync and clears its error
+func (r *CalendarRepository) RecordSuccess(ctx context.Context, id int64, blocks []models.BusyBlock) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM calendar_busy_blocks WHERE calendar_id = ?`, id); err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO calendar_busy_blocks (calendar_id, starts_at, ends_at) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	// Times are stored in UTC so they compare correctly as text
+	for _, b := range blocks {
+		if _, err := stmt.ExecContext(ctx, id, b.Start.UTC(), b.End.UTC()); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE user_calendars SET last_synced_at = ?, last_error = NULL WHERE id = ?
+	`, time.Now(), id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RecordFailure stores a sync error, keeping the busy blocks from the last successful sync
+func (r *CalendarRepository) RecordFailure(ctx context.Context, id int64, message string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE user_calendars SET last_synced_at = ?, last_error = ? WHERE id = ?
+	`, time.Now(), message, id)
+	return err
+}
+
+// ListBusy returns the busy blocks of a user's enabled calendar that end after from
+func (r *CalendarRepository) ListBusy(ctx context.Context, userID int64, from time.Time) ([]models.BusyBlock, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT starts_at, ends_at FROM calendar_busy_blocks
+		JOIN user_calendars ON user_calendars.id = calendar_busy_blocks.calendar_id
+		WHERE user_id = ? AND enabled = TRUE AND ends_at > ?
+		ORDER BY starts_at
+	`, userID, from.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []models.BusyBlock
+	for rows.Next() {
+		var b models.BusyBlock
+		if err := rows.Scan(&b.Start, &b.End); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, rows.Err()
+}
+
+// IsUserBusy reports whether a user's enabled calendar shows them as busy at t
+func (r *CalendarRepository) IsUserBusy(ctx context.Context, userID int64, t time.Time) (bool, error) {
+	var busy bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM calendar_busy_blocks
+			JOIN user_calendars ON user_calendars.id = calendar_busy_blocks.calendar_id
+			WHERE user_id = ? AND enabled = TRUE AND starts_at <= ? AND ends_at > ?
+		)
+	`, userID, t.UTC(), t.UTC()).Scan(&busy)
+	return busy, err
+}
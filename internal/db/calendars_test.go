@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestCalendarRepository_Busy(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	user := &models.User{Email: "alice@example.com", PasswordHash: "hash", Role: "user"}
+	if err := db.Users.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	cal := &models.UserCalendar{UserID: user.ID, Provider: CalendarProviderCalDAV, URL: "https://dav.example.com/alice/", Password: "secret", Enabled: true}
+	if err := db.Calendars.Save(ctx, cal); err != nil {
+		t.Fatalf("Failed to save calendar: %v", err)
+	}
+	if cal.Status != "pending" {
+		t.Errorf("Expected pending status, got %s", cal.Status)
+	}
+
+	// Blocks in a non-UTC zone must still compare correctly
+	ny, _ := time.LoadLocation("America/New_York")
+	start := time.Date(2024, 3, 4, 9, 0, 0, 0, ny)
+	if err := db.Calendars.RecordSuccess(ctx, cal.ID, []models.BusyBlock{{Start: start, End: start.Add(time.Hour)}}); err != nil {
+		t.Fatalf("Failed to record busy blocks: %v", err)
+	}
+
+	tests := []struct {
+		at   time.Time
+		busy bool
+	}{
+		{start.Add(-time.Minute), false},
+		{start, true},
+		{start.Add(30 * time.Minute).UTC(), true},
+		{start.Add(time.Hour), false},
+	}
+	for _, tt := range tests {
+		busy, err := db.Calendars.IsUserBusy(ctx, user.ID, tt.at)
+		if err != nil || busy != tt.busy {
+			t.Errorf("At %s: expected busy=%v, got %v (%v)", tt.at, tt.busy, busy, err)
+		}
+	}
+
+	got, err := db.Calendars.GetByUser(ctx, user.ID)
+	if err != nil || got.Status != "ok" || got.Password != "secret" {
+		t.Errorf("Expected synced calendar, got %+v (%v)", got, err)
+	}
+
+	// Relinking replaces the calendar and its blocks
+	if err := db.Calendars.Save(ctx, &models.UserCalendar{UserID: user.ID, Provider: CalendarProviderGoogle, URL: "https://calendar.google.com/basic.ics", Enabled: true}); err != nil {
+		t.Fatalf("Failed to relink calendar: %v", err)
+	}
+	if busy, _ := db.Calendars.IsUserBusy(ctx, user.ID, start); busy {
+		t.Error("Expected busy blocks of the replaced calendar to be removed")
+	}
+
+	if err := db.Calendars.DeleteByUser(ctx, user.ID); err != nil {
+		t.Fatalf("Failed to delete calendar: %v", err)
+	}
+	if _, err := db.Calendars.GetByUser(ctx, user.ID); err != ErrCalendarNotFound {
+		t.Errorf("Expected ErrCalendarNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrCallerListNotFound = errors.New("caller list not found")
+
+// CallerListRepository handles database operations for distinctive ring caller lists
+type CallerListRepository struct {
+	db *sql.DB
+}
+
+// NewCallerListRepository creates a new CallerListRepository
+func NewCallerListRepository(db *sql.DB) *CallerListRepository {
+	return &CallerListRepository{db: db}
+}
+
+const callerListColumns = `id, name, numbers, alert_info, created_at, updated_at`
+
+func scanCallerList(row rowScanner) (*models.CallerList, error) {
+	l := &models.CallerList{}
+	var numbers []byte
+	if err := row.Scan(&l.ID, &l.Name, &numbers, &l.AlertInfo, &l.CreatedAt, &l.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(numbers, &l.Numbers); err != nil {
+		return nil, err
+	}
+	if l.Numbers == nil {
+		l.Numbers = []string{}
+	}
+	return l, nil
+}
+
+// Create inserts a new caller list
+func (r *CallerListRepository) Create(ctx context.Context, list *models.CallerList) error {
+	numbers, err := marshalNumbers(list.Numbers)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO caller_lists (name, numbers, alert_info, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
+	`, list.Name, numbers, list.AlertInfo, now, now).Scan(&list.ID); err != nil {
+		return err
+	}
+	list.CreatedAt = now
+	list.UpdatedAt = now
+	return nil
+}
+
+// GetByID retrieves a caller list by ID
+func (r *CallerListRepository) GetByID(ctx context.Context, id int64) (*models.CallerList, error) {
+	l, err := scanCallerList(r.db.QueryRowContext(ctx, `
+		SELECT `+callerListColumns+` FROM caller_lists WHERE id = ?
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrCallerListNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// List returns all caller lists in creation order
+func (r *CallerListRepository) List(ctx context.Context) ([]*models.CallerList, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+callerListColumns+` FROM caller_lists ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lists []*models.CallerList
+	for rows.Next() {
+		l, err := scanCallerList(rows)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+	return lists, rows.Err()
+}
+
+// Update updates a caller list's name, numbers and ring class
+func (r *CallerListRepository) Update(ctx context.Context, list *models.CallerList) error {
+	numbers, err := marshalNumbers(list.Numbers)
+	if err != nil {
+		return err
+	}
+
+	list.UpdatedAt = time.Now()
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE caller_lists SET name = ?, numbers = ?, alert_info = ?, updated_at = ?
+		WHERE id = ?
+	`, list.Name, numbers, list.AlertInfo, list.UpdatedAt, list.ID)
+	return err
+}
+
+// Delete removes a caller list
+func (r *CallerListRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM caller_lists WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrCallerListNotFound
+	}
+	return nil
+}
+
+// Match returns the first caller list, in creation order, containing number.
+// Numbers are compared after normalization so formatting differences don't
+// matter. It returns nil when no list contains the number.
+func (r *CallerListRepository) Match(ctx context.Context, number string) (*models.CallerList, error) {
+	normalized := normalizeNumber(number)
+	if normalized == "" {
+		return nil, nil
+	}
+
+	lists, err := r.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lists {
+		for _, n := range l.Numbers {
+			if normalizeNumber(n) == normalized {
+				return l, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// MatchesClass reports whether any caller list with the given ring class
+// contains number
+func (r *CallerListRepository) MatchesClass(ctx context.Context, number, alertInfo string) (bool, error) {
+	normalized := normalizeNumber(number)
+	if normalized == "" {
+		return false, nil
+	}
+
+	lists, err := r.List(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, l := range lists {
+		if l.AlertInfo != alertInfo {
+			continue
+		}
+		for _, n := range l.Numbers {
+			if normalizeNumber(n) == normalized {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// marshalNumbers encodes a number list, storing nil as an empty array
+func marshalNumbers(numbers []string) ([]byte, error) {
+	if numbers == nil {
+		numbers = []string{}
+	}
+	return json.Marshal(numbers)
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestCallerListRepository_CRUD(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	list := &models.CallerList{
+		Name:      "Family",
+		Numbers:   []string{"+1 (555) 123-4567"},
+		AlertInfo: "vip",
+	}
+	if err := db.CallerLists.Create(ctx, list); err != nil {
+		t.Fatalf("Failed to create caller list: %v", err)
+	}
+	if list.ID == 0 {
+		t.Fatal("Expected caller list ID to be set after creation")
+	}
+
+	got, err := db.CallerLists.GetByID(ctx, list.ID)
+	if err != nil {
+		t.Fatalf("Failed to get caller list: %v", err)
+	}
+	if got.Name != "Family" || got.AlertInfo != "vip" || len(got.Numbers) != 1 {
+		t.Errorf("Unexpected caller list: %+v", got)
+	}
+
+	got.Numbers = append(got.Numbers, "+15550001111")
+	got.AlertInfo = "family"
+	if err := db.CallerLists.Update(ctx, got); err != nil {
+		t.Fatalf("Failed to update caller list: %v", err)
+	}
+
+	lists, err := db.CallerLists.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list caller lists: %v", err)
+	}
+	if len(lists) != 1 || len(lists[0].Numbers) != 2 || lists[0].AlertInfo != "family" {
+		t.Errorf("Unexpected caller lists after update: %+v", lists)
+	}
+
+	if err := db.CallerLists.Delete(ctx, list.ID); err != nil {
+		t.Fatalf("Failed to delete caller list: %v", err)
+	}
+	if _, err := db.CallerLists.GetByID(ctx, list.ID); !errors.Is(err, ErrCallerListNotFound) {
+		t.Errorf("Expected ErrCallerListNotFound after delete, got %v", err)
+	}
+	if err := db.CallerLists.Delete(ctx, list.ID); !errors.Is(err, ErrCallerListNotFound) {
+		t.Errorf("Expected ErrCallerListNotFound deleting a missing list, got %v", err)
+	}
+}
+
+func TestCallerListRepository_Match(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	for _, list := range []*models.CallerList{
+		{Name: "Family", Numbers: []string{"+1 555-123-4567"}, AlertInfo: "vip"},
+		{Name: "Everyone", Numbers: []string{"+15551234567", "+15550001111"}, AlertInfo: "friends"},
+	} {
+		if err := db.CallerLists.Create(ctx, list); err != nil {
+			t.Fatalf("Failed to create caller list: %v", err)
+		}
+	}
+
+	tests := []struct {
+		number string
+		want   string
+	}{
+		{"+15551234567", "Family"}, // first list wins
+		{"+15550001111", "Everyone"},
+		{"+15559999999", ""},
+		{"anonymous", ""},
+	}
+
+	for _, tt := range tests {
+		list, err := db.CallerLists.Match(ctx, tt.number)
+		if err != nil {
+			t.Fatalf("Match(%q) failed: %v", tt.number, err)
+		}
+		got := ""
+		if list != nil {
+			got = list.Name
+		}
+		if got != tt.want {
+			t.Errorf("Match(%q) = %q, want %q", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestCallerListRepository_MatchesClass(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	for _, list := range []*models.CallerList{
+		{Name: "Everyone", Numbers: []string{"+15551234567", "+15550001111"}, AlertInfo: "friends"},
+		{Name: "Family", Numbers: []string{"+1 555-123-4567"}, AlertInfo: "vip"},
+	} {
+		if err := db.CallerLists.Create(ctx, list); err != nil {
+			t.Fatalf("Failed to create caller list: %v", err)
+		}
+	}
+
+	tests := []struct {
+		number string
+		want   bool
+	}{
+		{"+15551234567", true}, // on a later VIP list too
+		{"+15550001111", false},
+		{"anonymous", false},
+	}
+
+	for _, tt := range tests {
+		got, err := db.CallerLists.MatchesClass(ctx, tt.number, "vip")
+		if err != nil {
+			t.Fatalf("MatchesClass(%q) failed: %v", tt.number, err)
+		}
+		if got != tt.want {
+			t.Errorf("MatchesClass(%q) = %v, want %v", tt.number, got, tt.want)
+		}
+	}
+}
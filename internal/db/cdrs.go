@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"time"
 
@@ -11,6 +12,9 @@ import (
 
 var ErrCDRNotFound = errors.New("CDR not found")
 
+// cdrColumns is the column list shared by all CDR queries
+const cdrColumns = `id, call_sid, direction, from_number, to_number, did_id, device_id, started_at, answered_at, ended_at, duration, disposition, recording_url, spam_score, diversion_chain, escalation_timeline, internal, codec, answered_by, estimated_cost, actual_cost, tenant_id`
+
 // CDRRepository handles database operations for Call Detail Records
 type CDRRepository struct {
 	db *sql.DB
@@ -21,31 +25,41 @@ func NewCDRRepository(db *sql.DB) *CDRRepository {
 	return &CDRRepository{db: db}
 }
 
-// Create inserts a new CDR
-func (r *CDRRepository) Create(ctx context.Context, cdr *models.CDR) error {
-	result, err := r.db.ExecContext(ctx, `
-		INSERT INTO cdrs (call_sid, direction, from_number, to_number, did_id, device_id, started_at, answered_at, ended_at, duration, disposition, recording_url, spam_score)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, cdr.CallSID, cdr.Direction, cdr.FromNumber, cdr.ToNumber, cdr.DIDID, cdr.DeviceID, cdr.StartedAt, cdr.AnsweredAt, cdr.EndedAt, cdr.Duration, cdr.Disposition, cdr.RecordingURL, cdr.SpamScore)
-	if err != nil {
-		return err
+// scanCDR scans a single CDR row selected with cdrColumns
+func scanCDR(row rowScanner) (*models.CDR, error) {
+	cdr := &models.CDR{}
+	var diversionChain, escalationTimeline []byte
+	if err := row.Scan(&cdr.ID, &cdr.CallSID, &cdr.Direction, &cdr.FromNumber, &cdr.ToNumber, &cdr.DIDID, &cdr.DeviceID, &cdr.StartedAt, &cdr.AnsweredAt, &cdr.EndedAt, &cdr.Duration, &cdr.Disposition, &cdr.RecordingURL, &cdr.SpamScore, &diversionChain, &escalationTimeline, &cdr.Internal, &cdr.Codec, &cdr.AnsweredBy, &cdr.EstimatedCost, &cdr.ActualCost, &cdr.TenantID); err != nil {
+		return nil, err
 	}
+	cdr.DiversionChain = diversionChain
+	cdr.EscalationTimeline = escalationTimeline
+	return cdr, nil
+}
 
-	id, err := result.LastInsertId()
-	if err != nil {
+// cdrTenant is the tenant a call belongs to: its DID's, or for calls
+// without one its device's
+const cdrTenant = `COALESCE((SELECT tenant_id FROM dids WHERE id = ?), (SELECT tenant_id FROM devices WHERE id = ?))`
+
+// Create inserts a new CDR
+func (r *CDRRepository) Create(ctx context.Context, cdr *models.CDR) error {
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO cdrs (call_sid, direction, from_number, to_number, did_id, device_id, started_at, answered_at, ended_at, duration, disposition, recording_url, spam_score, diversion_chain, escalation_timeline, internal, codec, answered_by, tenant_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, `+cdrTenant+`)
+		RETURNING id, tenant_id
+	`, cdr.CallSID, cdr.Direction, cdr.FromNumber, cdr.ToNumber, cdr.DIDID, cdr.DeviceID, cdr.StartedAt, cdr.AnsweredAt, cdr.EndedAt, cdr.Duration, cdr.Disposition, cdr.RecordingURL, cdr.SpamScore, nullableJSON(cdr.DiversionChain), nullableJSON(cdr.EscalationTimeline), cdr.Internal, cdr.Codec, cdr.AnsweredBy,
+		cdr.DIDID, cdr.DeviceID).Scan(&cdr.ID, &cdr.TenantID); err != nil {
 		return err
 	}
-	cdr.ID = id
 	return nil
 }
 
 // GetByID retrieves a CDR by ID
 func (r *CDRRepository) GetByID(ctx context.Context, id int64) (*models.CDR, error) {
-	cdr := &models.CDR{}
-	err := r.db.QueryRowContext(ctx, `
-		SELECT id, call_sid, direction, from_number, to_number, did_id, device_id, started_at, answered_at, ended_at, duration, disposition, recording_url, spam_score
+	cdr, err := scanCDR(r.db.QueryRowContext(ctx, `
+		SELECT `+cdrColumns+`
 		FROM cdrs WHERE id = ?
-	`, id).Scan(&cdr.ID, &cdr.CallSID, &cdr.Direction, &cdr.FromNumber, &cdr.ToNumber, &cdr.DIDID, &cdr.DeviceID, &cdr.StartedAt, &cdr.AnsweredAt, &cdr.EndedAt, &cdr.Duration, &cdr.Disposition, &cdr.RecordingURL, &cdr.SpamScore)
+	`, id))
 	if err == sql.ErrNoRows {
 		return nil, ErrCDRNotFound
 	}
@@ -57,11 +71,10 @@ func (r *CDRRepository) GetByID(ctx context.Context, id int64) (*models.CDR, err
 
 // GetByCallSID retrieves a CDR by Twilio Call SID
 func (r *CDRRepository) GetByCallSID(ctx context.Context, callSID string) (*models.CDR, error) {
-	cdr := &models.CDR{}
-	err := r.db.QueryRowContext(ctx, `
-		SELECT id, call_sid, direction, from_number, to_number, did_id, device_id, started_at, answered_at, ended_at, duration, disposition, recording_url, spam_score
+	cdr, err := scanCDR(r.db.QueryRowContext(ctx, `
+		SELECT `+cdrColumns+`
 		FROM cdrs WHERE call_sid = ?
-	`, callSID).Scan(&cdr.ID, &cdr.CallSID, &cdr.Direction, &cdr.FromNumber, &cdr.ToNumber, &cdr.DIDID, &cdr.DeviceID, &cdr.StartedAt, &cdr.AnsweredAt, &cdr.EndedAt, &cdr.Duration, &cdr.Disposition, &cdr.RecordingURL, &cdr.SpamScore)
+	`, callSID))
 	if err == sql.ErrNoRows {
 		return nil, ErrCDRNotFound
 	}
@@ -71,17 +84,115 @@ func (r *CDRRepository) GetByCallSID(ctx context.Context, callSID string) (*mode
 	return cdr, nil
 }
 
-// Update updates an existing CDR
+// Update updates an existing CDR. A call keeps the tenant it was first
+// recorded under.
 func (r *CDRRepository) Update(ctx context.Context, cdr *models.CDR) error {
 	_, err := r.db.ExecContext(ctx, `
 		UPDATE cdrs SET call_sid = ?, direction = ?, from_number = ?, to_number = ?,
 		did_id = ?, device_id = ?, started_at = ?, answered_at = ?, ended_at = ?,
-		duration = ?, disposition = ?, recording_url = ?, spam_score = ?
+		duration = ?, disposition = ?, recording_url = ?, spam_score = ?, diversion_chain = ?, escalation_timeline = ?, internal = ?, codec = ?, answered_by = ?,
+		tenant_id = COALESCE(tenant_id, `+cdrTenant+`)
 		WHERE id = ?
-	`, cdr.CallSID, cdr.Direction, cdr.FromNumber, cdr.ToNumber, cdr.DIDID, cdr.DeviceID, cdr.StartedAt, cdr.AnsweredAt, cdr.EndedAt, cdr.Duration, cdr.Disposition, cdr.RecordingURL, cdr.SpamScore, cdr.ID)
+	`, cdr.CallSID, cdr.Direction, cdr.FromNumber, cdr.ToNumber, cdr.DIDID, cdr.DeviceID, cdr.StartedAt, cdr.AnsweredAt, cdr.EndedAt, cdr.Duration, cdr.Disposition, cdr.RecordingURL, cdr.SpamScore, nullableJSON(cdr.DiversionChain), nullableJSON(cdr.EscalationTimeline), cdr.Internal, cdr.Codec, cdr.AnsweredBy,
+		cdr.DIDID, cdr.DeviceID, cdr.ID)
+	return err
+}
+
+// AppendEscalationStep adds a step to the escalation timeline of the CDR
+// with the given Call SID. Steps are appended in the database so webhooks
+// handled concurrently don't overwrite each other's steps.
+func (r *CDRRepository) AppendEscalationStep(ctx context.Context, callSID string, step models.EscalationStep) error {
+	data, err := json.Marshal(step)
+	if err != nil {
+		return err
+	}
+	appended := `json_insert(COALESCE(escalation_timeline, '[]'), '$[#]', json(?))`
+	if isPostgres(r.db) {
+		appended = `(COALESCE(escalation_timeline, '[]')::jsonb || jsonb_build_array(CAST(? AS jsonb)))::text`
+	}
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE cdrs SET escalation_timeline = `+appended+`
+		WHERE call_sid = ?
+	`, string(data), callSID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrCDRNotFound
+	}
+	return nil
+}
+
+// SetAnsweredBy records who answered the forwarded leg of the CDR with the
+// given Call SID, without touching the columns other webhooks update
+func (r *CDRRepository) SetAnsweredBy(ctx context.Context, callSID, answeredBy string) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE cdrs SET answered_by = ? WHERE call_sid = ?`, answeredBy, callSID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrCDRNotFound
+	}
+	return nil
+}
+
+// SetRecordingURL points a CDR at its call recording; "" clears it
+func (r *CDRRepository) SetRecordingURL(ctx context.Context, id int64, url string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE cdrs SET recording_url = NULLIF(?, '') WHERE id = ?`, url, id)
+	return err
+}
+
+// SetEstimatedCost records the rate table cost of a call; nil clears it
+func (r *CDRRepository) SetEstimatedCost(ctx context.Context, id int64, cost *float64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE cdrs SET estimated_cost = ? WHERE id = ?`, cost, id)
+	return err
+}
+
+// SetActualCost records what Twilio charged for a call
+func (r *CDRRepository) SetActualCost(ctx context.Context, id int64, cost float64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE cdrs SET actual_cost = ? WHERE id = ?`, cost, id)
 	return err
 }
 
+// ListUnreconciled returns outbound Twilio calls started in [start, end)
+// without Twilio's price, oldest first
+func (r *CDRRepository) ListUnreconciled(ctx context.Context, start, end time.Time, limit int) ([]*models.CDR, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+cdrColumns+`
+		FROM cdrs
+		WHERE direction = 'outbound' AND internal = FALSE AND call_sid != '' AND actual_cost IS NULL
+		AND ended_at IS NOT NULL AND started_at >= ? AND started_at < ?
+		ORDER BY started_at ASC, id ASC
+		LIMIT ?
+	`, start, end, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cdrs []*models.CDR
+	for rows.Next() {
+		cdr, err := scanCDR(rows)
+		if err != nil {
+			return nil, err
+		}
+		cdrs = append(cdrs, cdr)
+	}
+	return cdrs, rows.Err()
+}
+
+// CostTotals sums the costs of outbound Twilio calls started in [start, end)
+func (r *CDRRepository) CostTotals(ctx context.Context, start, end time.Time) (models.CostTotals, error) {
+	var totals models.CostTotals
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(estimated_cost), 0), COALESCE(SUM(actual_cost), 0),
+		COUNT(*) - COUNT(estimated_cost), COUNT(actual_cost)
+		FROM cdrs
+		WHERE direction = 'outbound' AND internal = FALSE AND started_at >= ? AND started_at < ?
+	`, start, end).Scan(&totals.Count, &totals.EstimatedCost, &totals.ActualCost, &totals.Unrated, &totals.Reconciled)
+	return totals, err
+}
+
 // Delete removes a CDR
 func (r *CDRRepository) Delete(ctx context.Context, id int64) error {
 	_, err := r.db.ExecContext(ctx, `DELETE FROM cdrs WHERE id = ?`, id)
@@ -94,8 +205,11 @@ type CDRFilter struct {
 	Disposition string
 	DIDID       *int64
 	DeviceID    *int64
+	Number      string // Calls from or to this number
+	Internal    *bool
 	StartDate   *time.Time
 	EndDate     *time.Time
+	TenantID    *int64 // Only this tenant's calls
 	Limit       int
 	Offset      int
 }
@@ -103,7 +217,7 @@ type CDRFilter struct {
 // List returns CDRs with optional filtering and pagination
 func (r *CDRRepository) List(ctx context.Context, filter CDRFilter) ([]*models.CDR, error) {
 	query := `
-		SELECT id, call_sid, direction, from_number, to_number, did_id, device_id, started_at, answered_at, ended_at, duration, disposition, recording_url, spam_score
+		SELECT `+cdrColumns+`
 		FROM cdrs WHERE 1=1
 	`
 	args := []interface{}{}
@@ -124,6 +238,14 @@ func (r *CDRRepository) List(ctx context.Context, filter CDRFilter) ([]*models.C
 		query += " AND device_id = ?"
 		args = append(args, *filter.DeviceID)
 	}
+	if filter.Number != "" {
+		query += " AND (from_number = ? OR to_number = ?)"
+		args = append(args, filter.Number, filter.Number)
+	}
+	if filter.Internal != nil {
+		query += " AND internal = ?"
+		args = append(args, *filter.Internal)
+	}
 	if filter.StartDate != nil {
 		query += " AND started_at >= ?"
 		args = append(args, *filter.StartDate)
@@ -132,6 +254,10 @@ func (r *CDRRepository) List(ctx context.Context, filter CDRFilter) ([]*models.C
 		query += " AND started_at <= ?"
 		args = append(args, *filter.EndDate)
 	}
+	if filter.TenantID != nil {
+		query += " AND tenant_id = ?"
+		args = append(args, *filter.TenantID)
+	}
 
 	query += " ORDER BY started_at DESC"
 
@@ -152,8 +278,8 @@ func (r *CDRRepository) List(ctx context.Context, filter CDRFilter) ([]*models.C
 
 	var cdrs []*models.CDR
 	for rows.Next() {
-		cdr := &models.CDR{}
-		if err := rows.Scan(&cdr.ID, &cdr.CallSID, &cdr.Direction, &cdr.FromNumber, &cdr.ToNumber, &cdr.DIDID, &cdr.DeviceID, &cdr.StartedAt, &cdr.AnsweredAt, &cdr.EndedAt, &cdr.Duration, &cdr.Disposition, &cdr.RecordingURL, &cdr.SpamScore); err != nil {
+		cdr, err := scanCDR(rows)
+		if err != nil {
 			return nil, err
 		}
 		cdrs = append(cdrs, cdr)
@@ -182,6 +308,14 @@ func (r *CDRRepository) Count(ctx context.Context, filter CDRFilter) (int, error
 		query += " AND device_id = ?"
 		args = append(args, *filter.DeviceID)
 	}
+	if filter.Number != "" {
+		query += " AND (from_number = ? OR to_number = ?)"
+		args = append(args, filter.Number, filter.Number)
+	}
+	if filter.Internal != nil {
+		query += " AND internal = ?"
+		args = append(args, *filter.Internal)
+	}
 	if filter.StartDate != nil {
 		query += " AND started_at >= ?"
 		args = append(args, *filter.StartDate)
@@ -190,22 +324,52 @@ func (r *CDRRepository) Count(ctx context.Context, filter CDRFilter) (int, error
 		query += " AND started_at <= ?"
 		args = append(args, *filter.EndDate)
 	}
+	if filter.TenantID != nil {
+		query += " AND tenant_id = ?"
+		args = append(args, *filter.TenantID)
+	}
 
 	var count int
 	err := r.db.QueryRowContext(ctx, query, args...).Scan(&count)
 	return count, err
 }
 
+// ListBetween returns the CDRs of calls started in [start, end), oldest
+// first
+func (r *CDRRepository) ListBetween(ctx context.Context, start, end time.Time) ([]*models.CDR, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+cdrColumns+`
+		FROM cdrs
+		WHERE started_at >= ? AND started_at < ?
+		ORDER BY started_at ASC, id ASC
+	`, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cdrs []*models.CDR
+	for rows.Next() {
+		cdr, err := scanCDR(rows)
+		if err != nil {
+			return nil, err
+		}
+		cdrs = append(cdrs, cdr)
+	}
+	return cdrs, rows.Err()
+}
+
 // GetRecent returns the most recent CDRs
 func (r *CDRRepository) GetRecent(ctx context.Context, limit int) ([]*models.CDR, error) {
 	return r.List(ctx, CDRFilter{Limit: limit})
 }
 
-// GetStatsByDisposition returns counts grouped by disposition
+// GetStatsByDisposition returns counts grouped by disposition. Internal
+// device-to-device calls are left out since they are not billed.
 func (r *CDRRepository) GetStatsByDisposition(ctx context.Context, startDate, endDate time.Time) (map[string]int, error) {
 	rows, err := r.db.QueryContext(ctx, `
 		SELECT disposition, COUNT(*) as count
-		FROM cdrs WHERE started_at >= ? AND started_at <= ?
+		FROM cdrs WHERE started_at >= ? AND started_at <= ? AND internal = FALSE
 		GROUP BY disposition
 	`, startDate, endDate)
 	if err != nil {
@@ -224,3 +388,11 @@ func (r *CDRRepository) GetStatsByDisposition(ctx context.Context, startDate, en
 	}
 	return stats, rows.Err()
 }
+
+// nullableJSON stores empty JSON as NULL
+func nullableJSON(data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
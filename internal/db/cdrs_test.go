@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -136,6 +137,119 @@ func TestCDRRepository_Update(t *testing.T) {
 	}
 }
 
+func TestCDRRepository_DiversionChain(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	cdr := &models.CDR{
+		CallSID:     "CA_DIVERTED",
+		Direction:   "inbound",
+		FromNumber:  "+15551234567",
+		ToNumber:    "+15559876543",
+		StartedAt:   time.Now(),
+		Disposition: "missed",
+	}
+	if err := db.CDRs.Create(ctx, cdr); err != nil {
+		t.Fatalf("Failed to create CDR: %v", err)
+	}
+
+	retrieved, err := db.CDRs.GetByCallSID(ctx, "CA_DIVERTED")
+	if err != nil {
+		t.Fatalf("Failed to get CDR: %v", err)
+	}
+	if len(retrieved.DiversionChain) != 0 {
+		t.Errorf("Expected empty diversion chain, got %s", retrieved.DiversionChain)
+	}
+
+	retrieved.DiversionChain = []byte(`["+15559876543","+15550001111"]`)
+	if err := db.CDRs.Update(ctx, retrieved); err != nil {
+		t.Fatalf("Failed to update CDR: %v", err)
+	}
+
+	cdrs, err := db.CDRs.List(ctx, CDRFilter{})
+	if err != nil {
+		t.Fatalf("Failed to list CDRs: %v", err)
+	}
+	if len(cdrs) != 1 || string(cdrs[0].DiversionChain) != `["+15559876543","+15550001111"]` {
+		t.Errorf("Unexpected diversion chain: %s", cdrs[0].DiversionChain)
+	}
+}
+
+func TestCDRRepository_Codec(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	cdr := &models.CDR{
+		CallSID:     "internal-call",
+		Direction:   "outbound",
+		FromNumber:  "100",
+		ToNumber:    "200",
+		StartedAt:   time.Now(),
+		Disposition: "answered",
+		Codec:       "G722",
+		Internal:    true,
+	}
+	if err := db.CDRs.Create(ctx, cdr); err != nil {
+		t.Fatalf("Failed to create CDR: %v", err)
+	}
+
+	got, err := db.CDRs.GetByID(ctx, cdr.ID)
+	if err != nil {
+		t.Fatalf("Failed to get CDR: %v", err)
+	}
+	if got.Codec != "G722" {
+		t.Errorf("Codec = %q, want G722", got.Codec)
+	}
+
+	got.Codec = "PCMU"
+	if err := db.CDRs.Update(ctx, got); err != nil {
+		t.Fatalf("Failed to update CDR: %v", err)
+	}
+	if got, _ = db.CDRs.GetByID(ctx, cdr.ID); got.Codec != "PCMU" {
+		t.Errorf("Codec after update = %q, want PCMU", got.Codec)
+	}
+}
+
+func TestCDRRepository_AppendEscalationStep(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	cdr := &models.CDR{
+		CallSID:     "CA_ESCALATED",
+		Direction:   "inbound",
+		FromNumber:  "+15551234567",
+		ToNumber:    "+15559876543",
+		StartedAt:   time.Now(),
+		Disposition: "missed",
+	}
+	if err := db.CDRs.Create(ctx, cdr); err != nil {
+		t.Fatalf("Failed to create CDR: %v", err)
+	}
+
+	for _, action := range []string{"called", "unanswered", "acknowledged"} {
+		step := models.EscalationStep{Action: action, Round: 1, Level: 1, At: time.Now()}
+		if err := db.CDRs.AppendEscalationStep(ctx, "CA_ESCALATED", step); err != nil {
+			t.Fatalf("Failed to append step: %v", err)
+		}
+	}
+
+	retrieved, err := db.CDRs.GetByCallSID(ctx, "CA_ESCALATED")
+	if err != nil {
+		t.Fatalf("Failed to get CDR: %v", err)
+	}
+	var timeline []models.EscalationStep
+	if err := json.Unmarshal(retrieved.EscalationTimeline, &timeline); err != nil {
+		t.Fatalf("Failed to decode timeline %s: %v", retrieved.EscalationTimeline, err)
+	}
+	if len(timeline) != 3 || timeline[0].Action != "called" || timeline[2].Action != "acknowledged" {
+		t.Errorf("Unexpected timeline: %+v", timeline)
+	}
+
+	if err := db.CDRs.AppendEscalationStep(ctx, "CA_UNKNOWN", models.EscalationStep{Action: "called"}); err != ErrCDRNotFound {
+		t.Errorf("Expected ErrCDRNotFound, got %v", err)
+	}
+}
+
 func TestCDRRepository_Delete(t *testing.T) {
 	db := setupTestDB(t)
 	ctx := context.Background()
@@ -377,6 +491,20 @@ func TestCDRRepository_GetStatsByDisposition(t *testing.T) {
 		}
 	}
 
+	// Internal device-to-device calls are not billed
+	internal := &models.CDR{
+		CallSID:     "internal-call@10.0.0.5",
+		Direction:   "outbound",
+		FromNumber:  "201",
+		ToNumber:    "202",
+		StartedAt:   now,
+		Disposition: "answered",
+		Internal:    true,
+	}
+	if err := db.CDRs.Create(ctx, internal); err != nil {
+		t.Fatalf("Failed to create internal CDR: %v", err)
+	}
+
 	stats, err := db.CDRs.GetStatsByDisposition(ctx, startDate, endDate)
 	if err != nil {
 		t.Fatalf("Failed to get stats: %v", err)
@@ -395,3 +523,46 @@ func TestCDRRepository_GetStatsByDisposition(t *testing.T) {
 		t.Errorf("Expected 1 blocked, got %d", stats["blocked"])
 	}
 }
+
+func TestCDRRepository_List_Internal(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	for i, internal := range []bool{false, true, true} {
+		cdr := &models.CDR{
+			CallSID:     "CA_INTERNAL_" + string(rune('0'+i)),
+			Direction:   "outbound",
+			FromNumber:  "201",
+			ToNumber:    "202",
+			StartedAt:   time.Now(),
+			Disposition: "answered",
+			Internal:    internal,
+		}
+		if err := db.CDRs.Create(ctx, cdr); err != nil {
+			t.Fatalf("Failed to create CDR: %v", err)
+		}
+	}
+
+	internal := true
+	cdrs, err := db.CDRs.List(ctx, CDRFilter{Internal: &internal})
+	if err != nil {
+		t.Fatalf("Failed to list CDRs: %v", err)
+	}
+	if len(cdrs) != 2 {
+		t.Fatalf("Expected 2 internal CDRs, got %d", len(cdrs))
+	}
+	for _, cdr := range cdrs {
+		if !cdr.Internal {
+			t.Errorf("Expected CDR %d to be internal", cdr.ID)
+		}
+	}
+
+	external := false
+	count, err := db.CDRs.Count(ctx, CDRFilter{Internal: &external})
+	if err != nil {
+		t.Fatalf("Failed to count CDRs: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 external CDR, got %d", count)
+	}
+}
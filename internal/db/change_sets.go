@@ -0,0 +1,375 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var (
+	ErrChangeSetNotFound = errors.New("change set not found")
+	// ErrChangeSetState is returned for change sets that can't be applied,
+	// reverted or cancelled in their current status
+	ErrChangeSetState = errors.New("change set can't be changed in its current status")
+)
+
+// Change set statuses
+const (
+	ChangeSetPending   = "pending"
+	ChangeSetApplied   = "applied"
+	ChangeSetReverted  = "reverted"
+	ChangeSetCancelled = "cancelled"
+	ChangeSetFailed    = "failed"
+)
+
+// Change types
+const (
+	ChangeSetting      = "setting"
+	ChangeRouteCreate  = "route_create"
+	ChangeRouteUpdate  = "route_update"
+	ChangeRouteDelete  = "route_delete"
+	ChangeRouteRestore = "route_restore"
+)
+
+// ChangeSetRepository handles database operations for scheduled change sets
+type ChangeSetRepository struct {
+	db *sql.DB
+}
+
+// NewChangeSetRepository creates a new ChangeSetRepository
+func NewChangeSetRepository(db *sql.DB) *ChangeSetRepository {
+	return &ChangeSetRepository{db: db}
+}
+
+const changeSetColumns = `id, name, changes, undo, apply_at, revert_at, status, error, applied_at, reverted_at, user_id, created_at`
+
+func scanChangeSet(row rowScanner) (*models.ChangeSet, error) {
+	cs := &models.ChangeSet{}
+	var changes, undo []byte
+	var revertAt, appliedAt, revertedAt sql.NullTime
+	var userID sql.NullInt64
+	if err := row.Scan(&cs.ID, &cs.Name, &changes, &undo, &cs.ApplyAt, &revertAt, &cs.Status, &cs.Error, &appliedAt, &revertedAt, &userID, &cs.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(changes, &cs.Changes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(undo, &cs.Undo); err != nil {
+		return nil, err
+	}
+	if revertAt.Valid {
+		cs.RevertAt = &revertAt.Time
+	}
+	if appliedAt.Valid {
+		cs.AppliedAt = &appliedAt.Time
+	}
+	if revertedAt.Valid {
+		cs.RevertedAt = &revertedAt.Time
+	}
+	if userID.Valid {
+		cs.UserID = &userID.Int64
+	}
+	return cs, nil
+}
+
+// Create schedules a new change set
+func (r *ChangeSetRepository) Create(ctx context.Context, cs *models.ChangeSet) error {
+	changes, err := json.Marshal(cs.Changes)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO change_sets (name, changes, apply_at, revert_at, status, user_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, cs.Name, changes, cs.ApplyAt, cs.RevertAt, ChangeSetPending, cs.UserID, now).Scan(&cs.ID); err != nil {
+		return err
+	}
+	cs.Status = ChangeSetPending
+	cs.CreatedAt = now
+	return nil
+}
+
+// GetByID retrieves a change set by ID
+func (r *ChangeSetRepository) GetByID(ctx context.Context, id int64) (*models.ChangeSet, error) {
+	return getChangeSet(r.db.QueryRowContext(ctx, `SELECT `+changeSetColumns+` FROM change_sets WHERE id = ?`, id))
+}
+
+func getChangeSet(row *sql.Row) (*models.ChangeSet, error) {
+	cs, err := scanChangeSet(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrChangeSetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// List returns all change sets, the most recently scheduled first
+func (r *ChangeSetRepository) List(ctx context.Context) ([]*models.ChangeSet, error) {
+	return r.list(ctx, `SELECT `+changeSetColumns+` FROM change_sets ORDER BY apply_at DESC, id DESC`)
+}
+
+// ListDue returns the pending change sets due to be applied and the applied
+// ones due to be reverted at now, oldest first
+func (r *ChangeSetRepository) ListDue(ctx context.Context, now time.Time) ([]*models.ChangeSet, error) {
+	return r.list(ctx, `
+		SELECT `+changeSetColumns+` FROM change_sets
+		WHERE (status = ? AND apply_at <= ?) OR (status = ? AND revert_at <= ?)
+		ORDER BY apply_at ASC, id ASC
+	`, ChangeSetPending, now, ChangeSetApplied, now)
+}
+
+func (r *ChangeSetRepository) list(ctx context.Context, query string, args ...interface{}) ([]*models.ChangeSet, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sets []*models.ChangeSet
+	for rows.Next() {
+		cs, err := scanChangeSet(rows)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, cs)
+	}
+	return sets, rows.Err()
+}
+
+// Cancel stops a pending change set from being applied, or an applied one
+// from being reverted automatically
+func (r *ChangeSetRepository) Cancel(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE change_sets SET status = ? WHERE id = ? AND status = ?
+	`, ChangeSetCancelled, id, ChangeSetPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	result, err = r.db.ExecContext(ctx, `
+		UPDATE change_sets SET revert_at = NULL WHERE id = ? AND status = ? AND revert_at IS NOT NULL
+	`, id, ChangeSetApplied)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	if _, err := r.GetByID(ctx, id); err != nil {
+		return err
+	}
+	return ErrChangeSetState
+}
+
+// Apply makes every change of a pending change set in one transaction and
+// saves the changes that undo them. When a change fails, none are made and
+// the change set is marked failed.
+func (r *ChangeSetRepository) Apply(ctx context.Context, id int64, now time.Time) error {
+	return r.run(ctx, id, ChangeSetPending, ChangeSetApplied, now)
+}
+
+// Revert undoes an applied change set in one transaction
+func (r *ChangeSetRepository) Revert(ctx context.Context, id int64, now time.Time) error {
+	return r.run(ctx, id, ChangeSetApplied, ChangeSetReverted, now)
+}
+
+func (r *ChangeSetRepository) run(ctx context.Context, id int64, from, to string, now time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	cs, err := getChangeSet(tx.QueryRowContext(ctx, `SELECT `+changeSetColumns+` FROM change_sets WHERE id = ?`, id))
+	if err != nil {
+		return err
+	}
+	if cs.Status != from {
+		return ErrChangeSetState
+	}
+
+	var email string
+	if cs.UserID != nil {
+		tx.QueryRowContext(ctx, `SELECT email FROM users WHERE id = ?`, *cs.UserID).Scan(&email)
+	}
+
+	changes := cs.Changes
+	if to == ChangeSetReverted {
+		changes = make([]models.Change, len(cs.Undo))
+		for i, c := range cs.Undo {
+			changes[len(cs.Undo)-1-i] = c
+		}
+	}
+
+	undo := []models.Change{}
+	for i, c := range changes {
+		u, err := applyChange(ctx, tx, c, cs.UserID, email)
+		if err != nil {
+			tx.Rollback()
+			err = fmt.Errorf("change %d: %w", i+1, err)
+			if to == ChangeSetApplied {
+				r.db.ExecContext(ctx, `UPDATE change_sets SET status = ?, error = ? WHERE id = ?`, ChangeSetFailed, err.Error(), id)
+			} else {
+				// Failed reverts aren't retried automatically; they can be retried by hand
+				r.db.ExecContext(ctx, `UPDATE change_sets SET revert_at = NULL, error = ? WHERE id = ?`, "revert failed: "+err.Error(), id)
+			}
+			return err
+		}
+		undo = append(undo, u)
+	}
+
+	if to == ChangeSetApplied {
+		data, err := json.Marshal(undo)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE change_sets SET status = ?, undo = ?, applied_at = ?, error = '' WHERE id = ?
+		`, to, data, now, id)
+		if err != nil {
+			return err
+		}
+	} else {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE change_sets SET status = ?, reverted_at = ?, error = '' WHERE id = ?
+		`, to, now, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// applyChange makes one change within a transaction and returns the change
+// that undoes it. Route changes are recorded in the route history.
+func applyChange(ctx context.Context, tx *sql.Tx, c models.Change, userID *int64, email string) (models.Change, error) {
+	switch c.Type {
+	case ChangeSetting:
+		undo := models.Change{Type: ChangeSetting, Key: c.Key}
+		var prev string
+		err := tx.QueryRowContext(ctx, `SELECT value FROM config WHERE key = ?`, c.Key).Scan(&prev)
+		if err == nil {
+			undo.Value = &prev
+		} else if err != sql.ErrNoRows {
+			return undo, err
+		}
+
+		if c.Value == nil {
+			_, err = tx.ExecContext(ctx, `DELETE FROM config WHERE key = ?`, c.Key)
+		} else {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO config (key, value, updated_at) VALUES (?, ?, ?)
+				ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+			`, c.Key, *c.Value, time.Now())
+		}
+		return undo, err
+
+	case ChangeRouteCreate:
+		if c.Route == nil {
+			return models.Change{}, errors.New("no route to create")
+		}
+		route := *c.Route
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO routes (did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`, route.DIDID, route.Priority, route.Name, route.ConditionType, route.ConditionData, route.ActionType, route.ActionData, route.Enabled).Scan(&route.ID); err != nil {
+			return models.Change{}, err
+		}
+		if _, err := recordRouteVersion(ctx, tx, "created", &route, userID, email); err != nil {
+			return models.Change{}, err
+		}
+		return models.Change{Type: ChangeRouteDelete, RouteID: route.ID}, nil
+
+	case ChangeRouteUpdate:
+		if c.Route == nil {
+			return models.Change{}, errors.New("no route state to update to")
+		}
+		prev, err := getRouteTx(ctx, tx, c.RouteID)
+		if err != nil {
+			return models.Change{}, err
+		}
+		route := *c.Route
+		route.ID = c.RouteID
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE routes SET did_id = ?, priority = ?, name = ?, condition_type = ?,
+			condition_data = ?, action_type = ?, action_data = ?, enabled = ?
+			WHERE id = ?
+		`, route.DIDID, route.Priority, route.Name, route.ConditionType, route.ConditionData, route.ActionType, route.ActionData, route.Enabled, route.ID); err != nil {
+			return models.Change{}, err
+		}
+		if _, err := recordRouteVersion(ctx, tx, "updated", &route, userID, email); err != nil {
+			return models.Change{}, err
+		}
+		return models.Change{Type: ChangeRouteRestore, RouteID: prev.ID, Route: prev}, nil
+
+	case ChangeRouteDelete:
+		prev, err := getRouteTx(ctx, tx, c.RouteID)
+		if err != nil {
+			return models.Change{}, err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM routes WHERE id = ?`, prev.ID); err != nil {
+			return models.Change{}, err
+		}
+		if _, err := recordRouteVersion(ctx, tx, "deleted", prev, userID, email); err != nil {
+			return models.Change{}, err
+		}
+		return models.Change{Type: ChangeRouteRestore, RouteID: prev.ID, Route: prev}, nil
+
+	case ChangeRouteRestore:
+		if c.Route == nil {
+			return models.Change{}, errors.New("no route to restore")
+		}
+		route := c.Route
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO routes (id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET did_id = excluded.did_id, priority = excluded.priority,
+			name = excluded.name, condition_type = excluded.condition_type, condition_data = excluded.condition_data,
+			action_type = excluded.action_type, action_data = excluded.action_data, enabled = excluded.enabled
+		`, route.ID, route.DIDID, route.Priority, route.Name, route.ConditionType, route.ConditionData, route.ActionType, route.ActionData, route.Enabled); err != nil {
+			return models.Change{}, err
+		}
+		if _, err := recordRouteVersion(ctx, tx, "rolled_back", route, userID, email); err != nil {
+			return models.Change{}, err
+		}
+		return models.Change{Type: ChangeRouteDelete, RouteID: route.ID}, nil
+	}
+	return models.Change{}, fmt.Errorf("unknown change type %q", c.Type)
+}
+
+// getRouteTx retrieves a route within a transaction
+func getRouteTx(ctx context.Context, tx *sql.Tx, id int64) (*models.Route, error) {
+	route := &models.Route{}
+	var didID sql.NullInt64
+	var conditionData, actionData []byte
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled
+		FROM routes WHERE id = ?
+	`, id).Scan(&route.ID, &didID, &route.Priority, &route.Name, &route.ConditionType, &conditionData, &route.ActionType, &actionData, &route.Enabled)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("route %d: %w", id, ErrRouteNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if didID.Valid {
+		route.DIDID = &didID.Int64
+	}
+	route.ConditionData = conditionData
+	route.ActionData = actionData
+	return route, nil
+}
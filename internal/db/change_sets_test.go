@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestChangeSetRepository_ApplyRevert(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	if err := database.Config.Set(ctx, "timezone", "UTC"); err != nil {
+		t.Fatal(err)
+	}
+	route := &models.Route{Name: "Office", Priority: 1, ConditionType: "default", ActionType: "voicemail", Enabled: true}
+	if err := database.Routes.Create(ctx, route); err != nil {
+		t.Fatal(err)
+	}
+
+	tz := "America/Denver"
+	updated := *route
+	updated.ActionType = "reject"
+	cs := &models.ChangeSet{
+		Name:    "Holiday",
+		ApplyAt: now.Add(time.Hour),
+		Changes: []models.Change{
+			{Type: ChangeSetting, Key: "timezone", Value: &tz},
+			{Type: ChangeRouteUpdate, RouteID: route.ID, Route: &updated},
+			{Type: ChangeRouteCreate, Route: &models.Route{Name: "Closed", Priority: 2, ConditionType: "default", ActionType: "reject", ActionData: json.RawMessage(`{}`)}},
+		},
+	}
+	if err := database.ChangeSets.Create(ctx, cs); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if due, _ := database.ChangeSets.ListDue(ctx, now); len(due) != 0 {
+		t.Errorf("Expected nothing due yet, got %d", len(due))
+	}
+	if err := database.ChangeSets.Revert(ctx, cs.ID, now); err != ErrChangeSetState {
+		t.Errorf("Revert of a pending change set = %v, want ErrChangeSetState", err)
+	}
+
+	if err := database.ChangeSets.Apply(ctx, cs.ID, now); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if v, _ := database.Config.Get(ctx, "timezone"); v != tz {
+		t.Errorf("timezone = %q after apply", v)
+	}
+	if r, _ := database.Routes.GetByID(ctx, route.ID); r.ActionType != "reject" {
+		t.Errorf("Route action = %q after apply", r.ActionType)
+	}
+	if routes, _ := database.Routes.List(ctx); len(routes) != 2 {
+		t.Errorf("Expected the new route, got %d routes", len(routes))
+	}
+	if versions, _ := database.RouteVersions.ListByRoute(ctx, route.ID); len(versions) != 1 || versions[0].Change != "updated" {
+		t.Errorf("Expected the update in the route history, got %+v", versions)
+	}
+
+	if err := database.ChangeSets.Revert(ctx, cs.ID, now); err != nil {
+		t.Fatalf("Revert failed: %v", err)
+	}
+	if v, _ := database.Config.Get(ctx, "timezone"); v != "UTC" {
+		t.Errorf("timezone = %q after revert", v)
+	}
+	if r, _ := database.Routes.GetByID(ctx, route.ID); r.ActionType != "voicemail" {
+		t.Errorf("Route action = %q after revert", r.ActionType)
+	}
+	if routes, _ := database.Routes.List(ctx); len(routes) != 1 {
+		t.Errorf("Expected the new route to be removed, got %d routes", len(routes))
+	}
+
+	got, err := database.ChangeSets.GetByID(ctx, cs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != ChangeSetReverted || got.AppliedAt == nil || got.RevertedAt == nil {
+		t.Errorf("Unexpected change set after revert: %+v", got)
+	}
+}
+
+func TestChangeSetRepository_ApplyFailure(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+
+	tz := "America/Denver"
+	cs := &models.ChangeSet{
+		Name:    "Broken",
+		ApplyAt: time.Now(),
+		Changes: []models.Change{
+			{Type: ChangeSetting, Key: "timezone", Value: &tz},
+			{Type: ChangeRouteDelete, RouteID: 999},
+		},
+	}
+	if err := database.ChangeSets.Create(ctx, cs); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := database.ChangeSets.Apply(ctx, cs.ID, time.Now()); err == nil {
+		t.Fatal("Expected the missing route to fail the change set")
+	}
+	if _, err := database.Config.Get(ctx, "timezone"); err == nil {
+		t.Error("Expected no change to be made when one fails")
+	}
+
+	got, _ := database.ChangeSets.GetByID(ctx, cs.ID)
+	if got.Status != ChangeSetFailed || !strings.Contains(got.Error, "change 2") {
+		t.Errorf("Expected a failed change set naming the change, got %q %q", got.Status, got.Error)
+	}
+}
+
+func TestChangeSetRepository_Cancel(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+
+	tz := "UTC"
+	revertAt := time.Now().Add(2 * time.Hour)
+	cs := &models.ChangeSet{
+		Name:     "Temporary",
+		ApplyAt:  time.Now().Add(time.Hour),
+		RevertAt: &revertAt,
+		Changes:  []models.Change{{Type: ChangeSetting, Key: "timezone", Value: &tz}},
+	}
+	if err := database.ChangeSets.Create(ctx, cs); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.ChangeSets.Apply(ctx, cs.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancelling an applied change set only stops the automatic revert
+	if err := database.ChangeSets.Cancel(ctx, cs.ID); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	got, _ := database.ChangeSets.GetByID(ctx, cs.ID)
+	if got.Status != ChangeSetApplied || got.RevertAt != nil {
+		t.Errorf("Expected applied without a revert time, got %q %v", got.Status, got.RevertAt)
+	}
+	if err := database.ChangeSets.Cancel(ctx, cs.ID); err != ErrChangeSetState {
+		t.Errorf("Second cancel = %v, want ErrChangeSetState", err)
+	}
+	if err := database.ChangeSets.Cancel(ctx, 999); err != ErrChangeSetNotFound {
+		t.Errorf("Cancel of a missing change set = %v, want ErrChangeSetNotFound", err)
+	}
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrComplianceExportNotFound = errors.New("compliance export not found")
+
+// Compliance export statuses
+const (
+	ComplianceExportPending  = "pending"
+	ComplianceExportComplete = "complete"
+	ComplianceExportFailed   = "failed"
+)
+
+// ComplianceExportRepository handles database operations for compliance
+// exports. There is no Delete: completed exports are kept for good.
+type ComplianceExportRepository struct {
+	db *sql.DB
+}
+
+// NewComplianceExportRepository creates a new ComplianceExportRepository
+func NewComplianceExportRepository(db *sql.DB) *ComplianceExportRepository {
+	return &ComplianceExportRepository{db: db}
+}
+
+const complianceExportColumns = `id, status, range_start, range_end, requested_by, file_name, calls, messages, previous_hash, head_hash, file_sha256, signature, error, created_at, completed_at`
+
+func scanComplianceExport(row rowScanner) (*models.ComplianceExport, error) {
+	e := &models.ComplianceExport{}
+	var requestedBy sql.NullInt64
+	var fileName, previousHash, headHash, fileSHA256, signature, exportErr sql.NullString
+	var completedAt sql.NullTime
+	if err := row.Scan(&e.ID, &e.Status, &e.RangeStart, &e.RangeEnd, &requestedBy, &fileName, &e.Calls, &e.Messages,
+		&previousHash, &headHash, &fileSHA256, &signature, &exportErr, &e.CreatedAt, &completedAt); err != nil {
+		return nil, err
+	}
+	if requestedBy.Valid {
+		e.RequestedBy = &requestedBy.Int64
+	}
+	e.FileName = fileName.String
+	e.PreviousHash = previousHash.String
+	e.HeadHash = headHash.String
+	e.FileSHA256 = fileSHA256.String
+	e.Signature = signature.String
+	if exportErr.Valid {
+		e.Error = &exportErr.String
+	}
+	if completedAt.Valid {
+		e.CompletedAt = &completedAt.Time
+	}
+	return e, nil
+}
+
+func (r *ComplianceExportRepository) list(ctx context.Context, query string, args ...interface{}) ([]*models.ComplianceExport, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exports []*models.ComplianceExport
+	for rows.Next() {
+		e, err := scanComplianceExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, e)
+	}
+	return exports, rows.Err()
+}
+
+// Create adds a pending export
+func (r *ComplianceExportRepository) Create(ctx context.Context, e *models.ComplianceExport) error {
+	e.Status = ComplianceExportPending
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO compliance_exports (status, range_start, range_end, requested_by, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
+	`, e.Status, e.RangeStart, e.RangeEnd, e.RequestedBy, e.CreatedAt).Scan(&e.ID)
+}
+
+// GetByID retrieves an export
+func (r *ComplianceExportRepository) GetByID(ctx context.Context, id int64) (*models.ComplianceExport, error) {
+	e, err := scanComplianceExport(r.db.QueryRowContext(ctx, `SELECT `+complianceExportColumns+` FROM compliance_exports WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrComplianceExportNotFound
+	}
+	return e, err
+}
+
+// List returns every export, newest first
+func (r *ComplianceExportRepository) List(ctx context.Context) ([]*models.ComplianceExport, error) {
+	return r.list(ctx, `SELECT `+complianceExportColumns+` FROM compliance_exports ORDER BY id DESC`)
+}
+
+// ListPending returns the exports waiting to be written, oldest first so
+// the hash chain follows the order they were requested in
+func (r *ComplianceExportRepository) ListPending(ctx context.Context) ([]*models.ComplianceExport, error) {
+	return r.list(ctx, `SELECT `+complianceExportColumns+` FROM compliance_exports WHERE status = ? ORDER BY id`, ComplianceExportPending)
+}
+
+// LastHeadHash returns the head hash of the newest completed export, empty
+// when there is none
+func (r *ComplianceExportRepository) LastHeadHash(ctx context.Context) (string, error) {
+	var hash string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT head_hash FROM compliance_exports WHERE status = ? ORDER BY id DESC LIMIT 1
+	`, ComplianceExportComplete).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return hash, err
+}
+
+// Complete records a written export. Only pending exports can be completed,
+// so a finished export is never rewritten.
+func (r *ComplianceExportRepository) Complete(ctx context.Context, e *models.ComplianceExport) error {
+	now := time.Now()
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE compliance_exports
+		SET status = ?, file_name = ?, calls = ?, messages = ?, previous_hash = ?, head_hash = ?,
+			file_sha256 = ?, signature = ?, completed_at = ?
+		WHERE id = ? AND status = ?
+	`, ComplianceExportComplete, e.FileName, e.Calls, e.Messages, e.PreviousHash, e.HeadHash,
+		e.FileSHA256, e.Signature, now, e.ID, ComplianceExportPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrComplianceExportNotFound
+	}
+	e.Status = ComplianceExportComplete
+	e.CompletedAt = &now
+	return nil
+}
+
+// Fail records why a pending export couldn't be written
+func (r *ComplianceExportRepository) Fail(ctx context.Context, id int64, exportErr string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE compliance_exports SET status = ?, error = ?, completed_at = ? WHERE id = ? AND status = ?
+	`, ComplianceExportFailed, exportErr, time.Now(), id, ComplianceExportPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrComplianceExportNotFound
+	}
+	return nil
+}
@@ -43,6 +43,20 @@ func (r *ConfigRepository) GetWithDefault(ctx context.Context, key, defaultValue
 	return value
 }
 
+// GetForTenant retrieves a config value as a tenant sees it: the tenant's
+// own setting if it has one, otherwise the instance's. A nil tenant is the
+// instance itself.
+func (r *ConfigRepository) GetForTenant(ctx context.Context, tenantID *int64, key, defaultValue string) string {
+	if tenantID != nil {
+		var value string
+		err := r.db.QueryRowContext(ctx, `SELECT value FROM tenant_config WHERE tenant_id = ? AND key = ?`, *tenantID, key).Scan(&value)
+		if err == nil {
+			return value
+		}
+	}
+	return r.GetWithDefault(ctx, key, defaultValue)
+}
+
 // Set creates or updates a config value
 func (r *ConfigRepository) Set(ctx context.Context, key, value string) error {
 	_, err := r.db.ExecContext(ctx, `
@@ -142,6 +156,7 @@ const (
 	ConfigKeyDNDEnd             = "dnd.end_time"
 	ConfigKeySpamFilterEnabled  = "spam_filter.enabled"
 	ConfigKeySpamScoreThreshold = "spam_filter.threshold"
+	ConfigKeyReadOnly           = "read_only.enabled"
 
 	// TLS configuration keys
 	ConfigKeyTLSEnabled    = "tls.enabled"
@@ -167,9 +182,19 @@ const (
 	// Cloudflare configuration keys
 	ConfigKeyCloudflareAPIToken = "cloudflare.api_token"
 
+	// Email gateway keys
+	ConfigKeyMailGatewayDIDID          = "mail_gateway.did_id"
+	ConfigKeyMailGatewayDomain         = "mail_gateway.domain"
+	ConfigKeyMailGatewayAllowedSenders = "mail_gateway.allowed_senders"
+	ConfigKeyMailGatewayMirrorEnabled  = "mail_gateway.mirror_enabled"
+	ConfigKeyMailGatewayMirrorEmail    = "mail_gateway.mirror_email"
+
 	// SRTP configuration keys
 	ConfigKeySRTPEnabled = "srtp.enabled"
 	ConfigKeySRTPProfile = "srtp.profile"
+
+	// CORS policy, stored as JSON. GOSIP_CORS_ORIGINS applies until set.
+	ConfigKeyCORSPolicy = "cors.policy"
 )
 
 // IsSetupComplete checks if the initial setup has been completed
@@ -195,3 +220,17 @@ func (r *ConfigRepository) SetDNDEnabled(ctx context.Context, enabled bool) erro
 	}
 	return r.Set(ctx, ConfigKeyDNDEnabled, value)
 }
+
+// IsReadOnly checks if an admin has put the API in read-only mode
+func (r *ConfigRepository) IsReadOnly(ctx context.Context) bool {
+	return r.GetWithDefault(ctx, ConfigKeyReadOnly, "false") == "true"
+}
+
+// SetReadOnly turns the API's read-only mode on or off
+func (r *ConfigRepository) SetReadOnly(ctx context.Context, enabled bool) error {
+	value := "false"
+	if enabled {
+		value = "true"
+	}
+	return r.Set(ctx, ConfigKeyReadOnly, value)
+}
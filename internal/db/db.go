@@ -5,6 +5,7 @@ import (
 	"context"
 	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -15,16 +16,22 @@ import (
 	"strings"
 	"time"
 
+	"github.com/btafoya/gosip/internal/config"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-//go:embed migrations/*.sql
+//go:embed migrations/*.sql migrations/postgres/*.sql
 var migrationsFS embed.FS
 
+// ErrUnsupported is returned for file backups and snapshots on Postgres,
+// which is backed up with its own tools such as pg_dump
+var ErrUnsupported = errors.New("not supported with the postgres database driver")
+
 // DB wraps the SQL database connection and provides repositories
 type DB struct {
-	conn   *sql.DB
-	dbPath string // Path to the database file
+	conn     *sql.DB
+	dbPath   string // Path to the database file
+	postgres bool   // Postgres instead of SQLite
 
 	// Backup configuration
 	backupsDir string
@@ -35,9 +42,12 @@ type DB struct {
 	Registrations *RegistrationRepository
 	DIDs          *DIDRepository
 	Routes        *RouteRepository
+	RouteVersions *RouteVersionRepository
+	RouteSplits   *RouteSplitRepository
 	Blocklist     *BlocklistRepository
 	CDRs          *CDRRepository
 	Voicemails    *VoicemailRepository
+	Greetings     *VoicemailGreetingRepository
 	Messages      *MessageRepository
 	AutoReplies   *AutoReplyRepository
 	Config        *ConfigRepository
@@ -47,9 +57,38 @@ type DB struct {
 	ProvisioningTokens   *ProvisioningTokenRepository
 	ProvisioningProfiles *ProvisioningProfileRepository
 	DeviceEvents         *DeviceEventRepository
+	DeviceTelemetry      *DeviceTelemetryRepository
+	DiscoveredDevices    *DiscoveredDeviceRepository
+	BlocklistFeeds       *BlocklistFeedRepository
+	CallerLists          *CallerListRepository
+	DeviceDIDs           *DeviceDIDRepository
+	VoicemailFeeds       *VoicemailFeedRepository
+	VoicemailQuotas      *VoicemailQuotaRepository
+	VoicemailBoxes       *VoicemailBoxRepository
+	TrunkFailovers       *TrunkFailoverRepository
+	NumberNotes          *NumberNoteRepository
+	Numbers              *NumberRepository
+	EmailQueue           *EmailQueueRepository
+	UserPreferences      *UserPreferenceRepository
+	DIDWebhooks          *DIDWebhookRepository
+	ComplianceExports    *ComplianceExportRepository
+	Verifications        *VerificationRepository
+	NotificationSettings *NotificationSettingsRepository
+	Announcements        *AnnouncementRepository
+	LoginAttempts        *LoginAttemptRepository
+	Calendars            *CalendarRepository
+	OnCall               *OnCallRepository
+	EscalationPolicies   *EscalationPolicyRepository
+	ChangeSets           *ChangeSetRepository
+	Rates                *RateRepository
+	Recordings           *RecordingRepository
+	SIPTrunks            *SIPTrunkRepository
+	ShortLinks           *ShortLinkRepository
+	Reminders            *ReminderRepository
+	Tenants              *TenantRepository
 }
 
-// New creates a new database connection and initializes repositories
+// New opens the SQLite database at dbPath and initializes repositories
 func New(dbPath string) (*DB, error) {
 	// Enable WAL mode and foreign keys via connection string
 	dsn := fmt.Sprintf("%s?_journal_mode=WAL&_foreign_keys=on&_busy_timeout=5000", dbPath)
@@ -83,21 +122,69 @@ func New(dbPath string) (*DB, error) {
 		backupsDir: backupsDir,
 	}
 
-	// Ensure backups directory exists
-	if err := os.MkdirAll(backupsDir, 0755); err != nil {
+	// Ensure backups directory exists. An in-memory database has no file to
+	// keep backups next to; its backups go where SetBackupsDir points.
+	if dbPath != ":memory:" {
+		if err := os.MkdirAll(backupsDir, 0755); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to create backups directory: %w", err)
+		}
+	}
+
+	db.setConn(conn)
+
+	return db, nil
+}
+
+// Open opens the database cfg selects: the SQLite database at dbPath, or a
+// Postgres server. Backups are kept next to dbPath either way.
+func Open(cfg *config.DatabaseConfig, dbPath string) (*DB, error) {
+	if !cfg.Postgres() {
+		return New(dbPath)
+	}
+
+	connector, err := newPostgresConnector(cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database DSN: %w", err)
+	}
+	conn := sql.OpenDB(connector)
+	conn.SetMaxOpenConns(cfg.MaxOpenConns)
+	conn.SetMaxIdleConns(cfg.MaxIdleConns)
+	conn.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := conn.PingContext(ctx); err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("failed to create backups directory: %w", err)
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	db := &DB{
+		dbPath:     dbPath,
+		postgres:   true,
+		backupsDir: filepath.Join(filepath.Dir(dbPath), "backups"),
 	}
+	db.setConn(conn)
+
+	return db, nil
+}
+
+// setConn switches to conn and creates the repositories that use it
+func (db *DB) setConn(conn *sql.DB) {
+	db.conn = conn
 
-	// Initialize repositories
 	db.Users = NewUserRepository(conn)
 	db.Devices = NewDeviceRepository(conn)
 	db.Registrations = NewRegistrationRepository(conn)
 	db.DIDs = NewDIDRepository(conn)
 	db.Routes = NewRouteRepository(conn)
+	db.RouteVersions = NewRouteVersionRepository(conn)
+	db.RouteSplits = NewRouteSplitRepository(conn)
 	db.Blocklist = NewBlocklistRepository(conn)
 	db.CDRs = NewCDRRepository(conn)
 	db.Voicemails = NewVoicemailRepository(conn)
+	db.Greetings = NewVoicemailGreetingRepository(conn)
 	db.Messages = NewMessageRepository(conn)
 	db.AutoReplies = NewAutoReplyRepository(conn)
 	db.Config = NewConfigRepository(conn)
@@ -107,8 +194,35 @@ func New(dbPath string) (*DB, error) {
 	db.ProvisioningTokens = NewProvisioningTokenRepository(conn)
 	db.ProvisioningProfiles = NewProvisioningProfileRepository(conn)
 	db.DeviceEvents = NewDeviceEventRepository(conn)
-
-	return db, nil
+	db.DeviceTelemetry = NewDeviceTelemetryRepository(conn)
+	db.DiscoveredDevices = NewDiscoveredDeviceRepository(conn)
+	db.BlocklistFeeds = NewBlocklistFeedRepository(conn)
+	db.CallerLists = NewCallerListRepository(conn)
+	db.DeviceDIDs = NewDeviceDIDRepository(conn)
+	db.VoicemailFeeds = NewVoicemailFeedRepository(conn)
+	db.VoicemailQuotas = NewVoicemailQuotaRepository(conn)
+	db.VoicemailBoxes = NewVoicemailBoxRepository(conn)
+	db.TrunkFailovers = NewTrunkFailoverRepository(conn)
+	db.NumberNotes = NewNumberNoteRepository(conn)
+	db.Numbers = NewNumberRepository(conn)
+	db.EmailQueue = NewEmailQueueRepository(conn)
+	db.UserPreferences = NewUserPreferenceRepository(conn)
+	db.DIDWebhooks = NewDIDWebhookRepository(conn)
+	db.ComplianceExports = NewComplianceExportRepository(conn)
+	db.Verifications = NewVerificationRepository(conn)
+	db.NotificationSettings = NewNotificationSettingsRepository(conn)
+	db.Announcements = NewAnnouncementRepository(conn)
+	db.LoginAttempts = NewLoginAttemptRepository(conn)
+	db.Calendars = NewCalendarRepository(conn)
+	db.OnCall = NewOnCallRepository(conn)
+	db.EscalationPolicies = NewEscalationPolicyRepository(conn)
+	db.ChangeSets = NewChangeSetRepository(conn)
+	db.Rates = NewRateRepository(conn)
+	db.Recordings = NewRecordingRepository(conn)
+	db.SIPTrunks = NewSIPTrunkRepository(conn)
+	db.ShortLinks = NewShortLinkRepository(conn)
+	db.Reminders = NewReminderRepository(conn)
+	db.Tenants = NewTenantRepository(conn)
 }
 
 // Close closes the database connection
@@ -118,11 +232,18 @@ func (db *DB) Close() error {
 
 // Migrate runs all database migrations
 func (db *DB) Migrate() error {
+	// Postgres starts from a baseline of the SQLite schema at the version
+	// it was added in, and has its own copy of each later migration
+	dir, appliedAt := "migrations", "DATETIME"
+	if db.postgres {
+		dir, appliedAt = "migrations/postgres", "TIMESTAMPTZ"
+	}
+
 	// Create migrations table if not exists
 	_, err := db.conn.Exec(`
 		CREATE TABLE IF NOT EXISTS schema_migrations (
 			version INTEGER PRIMARY KEY,
-			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			applied_at ` + appliedAt + ` DEFAULT CURRENT_TIMESTAMP
 		)
 	`)
 	if err != nil {
@@ -130,7 +251,7 @@ func (db *DB) Migrate() error {
 	}
 
 	// Get list of migration files
-	entries, err := migrationsFS.ReadDir("migrations")
+	entries, err := migrationsFS.ReadDir(dir)
 	if err != nil {
 		return fmt.Errorf("failed to read migrations directory: %w", err)
 	}
@@ -161,7 +282,7 @@ func (db *DB) Migrate() error {
 		}
 
 		// Read migration file
-		content, err := migrationsFS.ReadFile("migrations/" + filename)
+		content, err := migrationsFS.ReadFile(dir + "/" + filename)
 		if err != nil {
 			return fmt.Errorf("failed to read migration %s: %w", filename, err)
 		}
@@ -292,6 +413,10 @@ func (db *DB) GetBackupsDir() string {
 // CreateBackup creates a backup of the database using SQLite VACUUM INTO
 // Returns the filename, size in bytes, and any error
 func (db *DB) CreateBackup(ctx context.Context) (string, int64, error) {
+	if db.postgres {
+		return "", 0, ErrUnsupported
+	}
+
 	// Generate backup filename with timestamp
 	filename := fmt.Sprintf("backup_%s.db", time.Now().Format("20060102_150405"))
 
@@ -335,6 +460,26 @@ func (db *DB) CreateBackup(ctx context.Context) (string, int64, error) {
 	return filename, fileInfo.Size(), nil
 }
 
+// Snapshot writes a consistent copy of the database to path, which must not
+// exist yet. Unlike CreateBackup it doesn't add to the backups list.
+func (db *DB) Snapshot(ctx context.Context, path string) error {
+	if db.postgres {
+		return ErrUnsupported
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if err := validateBackupPath(absPath); err != nil {
+		return fmt.Errorf("invalid snapshot path: %w", err)
+	}
+	if _, err := db.conn.ExecContext(ctx, "VACUUM INTO ?", absPath); err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	return nil
+}
+
 // ListBackups returns available backup files sorted by creation time (newest first)
 func (db *DB) ListBackups(ctx context.Context) ([]BackupInfo, error) {
 	entries, err := os.ReadDir(db.backupsDir)
@@ -426,6 +571,10 @@ func (db *DB) DeleteBackup(ctx context.Context, filename string) error {
 
 // VerifyBackup checks the integrity of a backup file
 func (db *DB) VerifyBackup(ctx context.Context, filename string) error {
+	if db.postgres {
+		return ErrUnsupported
+	}
+
 	if err := validateFilename(filename); err != nil {
 		return err
 	}
@@ -458,6 +607,10 @@ func (db *DB) VerifyBackup(ctx context.Context, filename string) error {
 // WARNING: This operation is destructive - the current database will be replaced
 // The application should be restarted after restoration
 func (db *DB) RestoreBackup(ctx context.Context, filename string) error {
+	if db.postgres {
+		return ErrUnsupported
+	}
+
 	if err := validateFilename(filename); err != nil {
 		return err
 	}
@@ -517,25 +670,8 @@ func (db *DB) RestoreBackup(ctx context.Context, filename string) error {
 		return fmt.Errorf("failed to verify restored database: %w", err)
 	}
 
-	// Update the connection
-	db.conn = conn
-
-	// Reinitialize all repositories with new connection
-	db.Users = NewUserRepository(conn)
-	db.Devices = NewDeviceRepository(conn)
-	db.Registrations = NewRegistrationRepository(conn)
-	db.DIDs = NewDIDRepository(conn)
-	db.Routes = NewRouteRepository(conn)
-	db.Blocklist = NewBlocklistRepository(conn)
-	db.CDRs = NewCDRRepository(conn)
-	db.Voicemails = NewVoicemailRepository(conn)
-	db.Messages = NewMessageRepository(conn)
-	db.AutoReplies = NewAutoReplyRepository(conn)
-	db.Config = NewConfigRepository(conn)
-	db.Sessions = NewSessionRepository(conn)
-	db.ProvisioningTokens = NewProvisioningTokenRepository(conn)
-	db.ProvisioningProfiles = NewProvisioningProfileRepository(conn)
-	db.DeviceEvents = NewDeviceEventRepository(conn)
+	// Reinitialize all repositories with the new connection
+	db.setConn(conn)
 
 	slog.Info("Database restored successfully", "filename", filename)
 	return nil
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// DeviceDIDRepository handles the DIDs devices may present as outbound caller ID
+type DeviceDIDRepository struct {
+	db *sql.DB
+}
+
+// NewDeviceDIDRepository creates a new DeviceDIDRepository
+func NewDeviceDIDRepository(db *sql.DB) *DeviceDIDRepository {
+	return &DeviceDIDRepository{db: db}
+}
+
+// ListByDevice returns a device's DIDs ordered by DID ID, numbering their
+// positions from 1
+func (r *DeviceDIDRepository) ListByDevice(ctx context.Context, deviceID int64) ([]*models.DeviceDID, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT dd.device_id, dd.did_id, d.number, COALESCE(d.name, ''), dd.is_default
+		FROM device_dids dd
+		JOIN dids d ON d.id = dd.did_id
+		WHERE dd.device_id = ?
+		ORDER BY dd.did_id
+	`, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dids []*models.DeviceDID
+	for rows.Next() {
+		dd := &models.DeviceDID{}
+		if err := rows.Scan(&dd.DeviceID, &dd.DIDID, &dd.Number, &dd.Name, &dd.IsDefault); err != nil {
+			return nil, err
+		}
+		dd.Position = len(dids) + 1
+		dids = append(dids, dd)
+	}
+	return dids, rows.Err()
+}
+
+// SetForDevice replaces a device's DIDs. defaultDIDID, when set, must be one
+// of didIDs. Remembered selections for removed DIDs are dropped.
+func (r *DeviceDIDRepository) SetForDevice(ctx context.Context, deviceID int64, didIDs []int64, defaultDIDID *int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM device_dids WHERE device_id = ?`, deviceID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO device_dids (device_id, did_id, is_default) VALUES (?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, didID := range didIDs {
+		isDefault := defaultDIDID != nil && *defaultDIDID == didID
+		if _, err := stmt.ExecContext(ctx, deviceID, didID, isDefault); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM device_did_memory
+		WHERE device_id = ? AND did_id NOT IN (SELECT did_id FROM device_dids WHERE device_id = ?)
+	`, deviceID, deviceID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetLastUsed returns the DID a device last called destination from, or nil
+func (r *DeviceDIDRepository) GetLastUsed(ctx context.Context, deviceID int64, destination string) (*int64, error) {
+	var didID int64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT did_id FROM device_did_memory WHERE device_id = ? AND destination = ?
+	`, deviceID, normalizeNumber(destination)).Scan(&didID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &didID, nil
+}
+
+// RememberLastUsed records the DID a device called destination from
+func (r *DeviceDIDRepository) RememberLastUsed(ctx context.Context, deviceID int64, destination string, didID int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO device_did_memory (device_id, destination, did_id, used_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(device_id, destination) DO UPDATE SET did_id = excluded.did_id, used_at = excluded.used_at
+	`, deviceID, normalizeNumber(destination), didID, time.Now())
+	return err
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestDeviceDIDRepository_SetForDevice(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	device := &models.Device{Name: "Shared Phone", Username: "shared", DeviceType: "grandstream"}
+	if err := db.Devices.Create(ctx, device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	var didIDs []int64
+	for _, number := range []string{"+15551110000", "+15552220000", "+15553330000"} {
+		did := &models.DID{Number: number, VoiceEnabled: true}
+		if err := db.DIDs.Create(ctx, did); err != nil {
+			t.Fatalf("Failed to create DID: %v", err)
+		}
+		didIDs = append(didIDs, did.ID)
+	}
+
+	if err := db.DeviceDIDs.SetForDevice(ctx, device.ID, didIDs, &didIDs[1]); err != nil {
+		t.Fatalf("Failed to set device DIDs: %v", err)
+	}
+
+	dids, err := db.DeviceDIDs.ListByDevice(ctx, device.ID)
+	if err != nil {
+		t.Fatalf("Failed to list device DIDs: %v", err)
+	}
+	if len(dids) != 3 {
+		t.Fatalf("Expected 3 DIDs, got %d", len(dids))
+	}
+	for i, dd := range dids {
+		if dd.Position != i+1 {
+			t.Errorf("Expected position %d, got %d", i+1, dd.Position)
+		}
+		if dd.IsDefault != (dd.DIDID == didIDs[1]) {
+			t.Errorf("Unexpected default flag on DID %s", dd.Number)
+		}
+	}
+
+	// Removing a DID forgets destinations last called from it
+	if err := db.DeviceDIDs.RememberLastUsed(ctx, device.ID, "+1 (555) 999-0000", didIDs[2]); err != nil {
+		t.Fatalf("Failed to remember DID: %v", err)
+	}
+	if err := db.DeviceDIDs.SetForDevice(ctx, device.ID, didIDs[:2], nil); err != nil {
+		t.Fatalf("Failed to set device DIDs: %v", err)
+	}
+	last, err := db.DeviceDIDs.GetLastUsed(ctx, device.ID, "+15559990000")
+	if err != nil {
+		t.Fatalf("Failed to get last used DID: %v", err)
+	}
+	if last != nil {
+		t.Errorf("Expected memory for removed DID to be dropped, got %d", *last)
+	}
+}
+
+func TestDeviceDIDRepository_RememberLastUsed(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	device := &models.Device{Name: "Shared Phone", Username: "shared", DeviceType: "grandstream"}
+	if err := db.Devices.Create(ctx, device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	first := &models.DID{Number: "+15551110000"}
+	second := &models.DID{Number: "+15552220000"}
+	for _, did := range []*models.DID{first, second} {
+		if err := db.DIDs.Create(ctx, did); err != nil {
+			t.Fatalf("Failed to create DID: %v", err)
+		}
+	}
+	if err := db.DeviceDIDs.SetForDevice(ctx, device.ID, []int64{first.ID, second.ID}, nil); err != nil {
+		t.Fatalf("Failed to set device DIDs: %v", err)
+	}
+
+	last, err := db.DeviceDIDs.GetLastUsed(ctx, device.ID, "+15559990000")
+	if err != nil || last != nil {
+		t.Fatalf("Expected no remembered DID, got %v, %v", last, err)
+	}
+
+	for _, didID := range []int64{first.ID, second.ID} {
+		if err := db.DeviceDIDs.RememberLastUsed(ctx, device.ID, "555-999-0000", didID); err != nil {
+			t.Fatalf("Failed to remember DID: %v", err)
+		}
+	}
+
+	last, err = db.DeviceDIDs.GetLastUsed(ctx, device.ID, "5559990000")
+	if err != nil {
+		t.Fatalf("Failed to get last used DID: %v", err)
+	}
+	if last == nil || *last != second.ID {
+		t.Errorf("Expected last used DID %d, got %v", second.ID, last)
+	}
+}
@@ -24,19 +24,13 @@ func (r *DeviceEventRepository) Create(ctx context.Context, event *models.Device
 	now := time.Now()
 	event.CreatedAt = now
 
-	result, err := r.db.ExecContext(ctx, `
+	if err := r.db.QueryRowContext(ctx, `
 		INSERT INTO device_events (device_id, event_type, event_data, ip_address, user_agent, created_at)
 		VALUES (?, ?, ?, ?, ?, ?)
-	`, event.DeviceID, event.EventType, event.EventData, event.IPAddress, event.UserAgent, now)
-	if err != nil {
-		return err
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
+		RETURNING id
+	`, event.DeviceID, event.EventType, event.EventData, event.IPAddress, event.UserAgent, now).Scan(&event.ID); err != nil {
 		return err
 	}
-	event.ID = id
 	return nil
 }
 
@@ -52,7 +46,7 @@ func (r *DeviceEventRepository) LogEvent(ctx context.Context, deviceID int64, ev
 	}
 
 	event := &models.DeviceEvent{
-		DeviceID:  deviceID,
+		DeviceID:  &deviceID,
 		EventType: eventType,
 		EventData: eventData,
 		IPAddress: &ipAddress,
@@ -61,6 +55,21 @@ func (r *DeviceEventRepository) LogEvent(ctx context.Context, deviceID int64, ev
 	return r.Create(ctx, event)
 }
 
+// LogDiscovery logs a device found by LAN discovery that is not yet linked to a device
+func (r *DeviceEventRepository) LogDiscovery(ctx context.Context, data map[string]interface{}, ipAddress string) error {
+	eventData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	event := &models.DeviceEvent{
+		EventType: "discovered",
+		EventData: eventData,
+		IPAddress: &ipAddress,
+	}
+	return r.Create(ctx, event)
+}
+
 // GetByID retrieves an event by ID
 func (r *DeviceEventRepository) GetByID(ctx context.Context, id int64) (*models.DeviceEvent, error) {
 	event := &models.DeviceEvent{}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// Telemetry sample sources
+const (
+	TelemetrySourceRegister = "register"
+	TelemetrySourcePing     = "ping"
+	TelemetrySourceBeacon   = "beacon"
+)
+
+// DeviceTelemetryRepository handles database operations for device health
+// telemetry
+type DeviceTelemetryRepository struct {
+	db *sql.DB
+}
+
+// NewDeviceTelemetryRepository creates a new DeviceTelemetryRepository
+func NewDeviceTelemetryRepository(db *sql.DB) *DeviceTelemetryRepository {
+	return &DeviceTelemetryRepository{db: db}
+}
+
+// Record stores a telemetry sample
+func (r *DeviceTelemetryRepository) Record(ctx context.Context, sample *models.DeviceTelemetry) error {
+	if sample.CreatedAt.IsZero() {
+		sample.CreatedAt = time.Now()
+	}
+
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO device_telemetry (device_id, source, rtt_ms, register_interval_seconds, firmware, uptime_seconds, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, sample.DeviceID, sample.Source, sample.RTTMs, sample.RegisterIntervalSeconds, sample.Firmware, sample.UptimeSeconds, sample.CreatedAt).Scan(&sample.ID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ListSince returns a device's samples taken after a time, oldest first
+func (r *DeviceTelemetryRepository) ListSince(ctx context.Context, deviceID int64, since time.Time) ([]*models.DeviceTelemetry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, device_id, source, rtt_ms, register_interval_seconds, firmware, uptime_seconds, created_at
+		FROM device_telemetry
+		WHERE device_id = ? AND created_at > ?
+		ORDER BY created_at, id
+	`, deviceID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []*models.DeviceTelemetry
+	for rows.Next() {
+		s := &models.DeviceTelemetry{}
+		if err := rows.Scan(&s.ID, &s.DeviceID, &s.Source, &s.RTTMs, &s.RegisterIntervalSeconds, &s.Firmware, &s.UptimeSeconds, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+	return samples, rows.Err()
+}
+
+// DeleteBefore removes samples older than a time and returns how many
+func (r *DeviceTelemetryRepository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM device_telemetry WHERE created_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
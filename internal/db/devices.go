@@ -14,6 +14,11 @@ var (
 	ErrDeviceAlreadyExists = errors.New("device already exists")
 )
 
+// deviceColumns is the column list shared by all device queries
+const deviceColumns = `id, user_id, name, username, password_hash, device_type, recording_enabled, created_at,
+	mac_address, vendor, model, firmware_version, provisioning_status, last_config_fetch, last_registration, config_template,
+	call_waiting, intercom_allowed, extension, sip_messaging, comfort_noise, anonymous_calls, tenant_id`
+
 // DeviceRepository handles database operations for SIP devices
 type DeviceRepository struct {
 	db *sql.DB
@@ -24,6 +29,17 @@ func NewDeviceRepository(db *sql.DB) *DeviceRepository {
 	return &DeviceRepository{db: db}
 }
 
+// scanDevice scans a single device row selected with deviceColumns
+func scanDevice(row rowScanner) (*models.Device, error) {
+	device := &models.Device{}
+	if err := row.Scan(&device.ID, &device.UserID, &device.Name, &device.Username, &device.PasswordHash, &device.DeviceType, &device.RecordingEnabled, &device.CreatedAt,
+		&device.MACAddress, &device.Vendor, &device.Model, &device.FirmwareVersion, &device.ProvisioningStatus, &device.LastConfigFetch, &device.LastRegistration, &device.ConfigTemplate,
+		&device.CallWaiting, &device.IntercomAllowed, &device.Extension, &device.SIPMessaging, &device.ComfortNoise, &device.AnonymousCalls, &device.TenantID); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
 // Create inserts a new device
 func (r *DeviceRepository) Create(ctx context.Context, device *models.Device) error {
 	now := time.Now()
@@ -32,33 +48,21 @@ func (r *DeviceRepository) Create(ctx context.Context, device *models.Device) er
 		device.ProvisioningStatus = "unknown"
 	}
 
-	result, err := r.db.ExecContext(ctx, `
+	return r.db.QueryRowContext(ctx, `
 		INSERT INTO devices (user_id, name, username, password_hash, device_type, recording_enabled, created_at,
-			mac_address, vendor, model, firmware_version, provisioning_status, config_template)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			mac_address, vendor, model, firmware_version, provisioning_status, config_template, call_waiting, intercom_allowed, extension, sip_messaging, comfort_noise, anonymous_calls, tenant_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
 	`, device.UserID, device.Name, device.Username, device.PasswordHash, device.DeviceType, device.RecordingEnabled, now,
-		device.MACAddress, device.Vendor, device.Model, device.FirmwareVersion, device.ProvisioningStatus, device.ConfigTemplate)
-	if err != nil {
-		return err
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return err
-	}
-	device.ID = id
-	return nil
+		device.MACAddress, device.Vendor, device.Model, device.FirmwareVersion, device.ProvisioningStatus, device.ConfigTemplate, device.CallWaiting, device.IntercomAllowed, device.Extension, device.SIPMessaging, device.ComfortNoise, device.AnonymousCalls, device.TenantID).Scan(&device.ID)
 }
 
 // GetByID retrieves a device by ID
 func (r *DeviceRepository) GetByID(ctx context.Context, id int64) (*models.Device, error) {
-	device := &models.Device{}
-	err := r.db.QueryRowContext(ctx, `
-		SELECT id, user_id, name, username, password_hash, device_type, recording_enabled, created_at,
-			mac_address, vendor, model, firmware_version, provisioning_status, last_config_fetch, last_registration, config_template
+	device, err := scanDevice(r.db.QueryRowContext(ctx, `
+		SELECT `+deviceColumns+`
 		FROM devices WHERE id = ?
-	`, id).Scan(&device.ID, &device.UserID, &device.Name, &device.Username, &device.PasswordHash, &device.DeviceType, &device.RecordingEnabled, &device.CreatedAt,
-		&device.MACAddress, &device.Vendor, &device.Model, &device.FirmwareVersion, &device.ProvisioningStatus, &device.LastConfigFetch, &device.LastRegistration, &device.ConfigTemplate)
+	`, id))
 	if err == sql.ErrNoRows {
 		return nil, ErrDeviceNotFound
 	}
@@ -70,13 +74,35 @@ func (r *DeviceRepository) GetByID(ctx context.Context, id int64) (*models.Devic
 
 // GetByUsername retrieves a device by SIP username
 func (r *DeviceRepository) GetByUsername(ctx context.Context, username string) (*models.Device, error) {
-	device := &models.Device{}
-	err := r.db.QueryRowContext(ctx, `
-		SELECT id, user_id, name, username, password_hash, device_type, recording_enabled, created_at,
-			mac_address, vendor, model, firmware_version, provisioning_status, last_config_fetch, last_registration, config_template
+	device, err := scanDevice(r.db.QueryRowContext(ctx, `
+		SELECT `+deviceColumns+`
 		FROM devices WHERE username = ?
-	`, username).Scan(&device.ID, &device.UserID, &device.Name, &device.Username, &device.PasswordHash, &device.DeviceType, &device.RecordingEnabled, &device.CreatedAt,
-		&device.MACAddress, &device.Vendor, &device.Model, &device.FirmwareVersion, &device.ProvisioningStatus, &device.LastConfigFetch, &device.LastRegistration, &device.ConfigTemplate)
+	`, username))
+	if err == sql.ErrNoRows {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// tenantKey is the value COALESCE(tenant_id, 0) takes for a tenant, so one
+// query matches both a tenant's rows and the instance's own (nil) rows
+func tenantKey(tenantID *int64) int64 {
+	if tenantID == nil {
+		return 0
+	}
+	return *tenantID
+}
+
+// GetByExtension retrieves a device by its internal extension number.
+// Extensions are numbered per tenant; a nil tenant is the instance's own.
+func (r *DeviceRepository) GetByExtension(ctx context.Context, tenantID *int64, extension string) (*models.Device, error) {
+	device, err := scanDevice(r.db.QueryRowContext(ctx, `
+		SELECT `+deviceColumns+`
+		FROM devices WHERE COALESCE(tenant_id, 0) = ? AND extension = ?
+	`, tenantKey(tenantID), extension))
 	if err == sql.ErrNoRows {
 		return nil, ErrDeviceNotFound
 	}
@@ -86,15 +112,37 @@ func (r *DeviceRepository) GetByUsername(ctx context.Context, username string) (
 	return device, nil
 }
 
-// GetByMAC retrieves a device by MAC address
+// ListExtensions returns a tenant's assigned internal extension numbers in order
+func (r *DeviceRepository) ListExtensions(ctx context.Context, tenantID *int64) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT extension FROM devices
+		WHERE COALESCE(tenant_id, 0) = ? AND extension IS NOT NULL AND extension != ''
+		ORDER BY extension
+	`, tenantKey(tenantID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var extensions []string
+	for rows.Next() {
+		var ext string
+		if err := rows.Scan(&ext); err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, ext)
+	}
+	return extensions, rows.Err()
+}
+
+// GetByMAC retrieves a device by MAC address, ignoring case and separators
 func (r *DeviceRepository) GetByMAC(ctx context.Context, mac string) (*models.Device, error) {
-	device := &models.Device{}
-	err := r.db.QueryRowContext(ctx, `
-		SELECT id, user_id, name, username, password_hash, device_type, recording_enabled, created_at,
-			mac_address, vendor, model, firmware_version, provisioning_status, last_config_fetch, last_registration, config_template
-		FROM devices WHERE mac_address = ?
-	`, mac).Scan(&device.ID, &device.UserID, &device.Name, &device.Username, &device.PasswordHash, &device.DeviceType, &device.RecordingEnabled, &device.CreatedAt,
-		&device.MACAddress, &device.Vendor, &device.Model, &device.FirmwareVersion, &device.ProvisioningStatus, &device.LastConfigFetch, &device.LastRegistration, &device.ConfigTemplate)
+	device, err := scanDevice(r.db.QueryRowContext(ctx, `
+		SELECT `+deviceColumns+`
+		FROM devices
+		WHERE lower(replace(replace(replace(mac_address, ':', ''), '-', ''), '.', ''))
+			= lower(replace(replace(replace(?, ':', ''), '-', ''), '.', ''))
+	`, mac))
 	if err == sql.ErrNoRows {
 		return nil, ErrDeviceNotFound
 	}
@@ -109,11 +157,18 @@ func (r *DeviceRepository) Update(ctx context.Context, device *models.Device) er
 	_, err := r.db.ExecContext(ctx, `
 		UPDATE devices SET user_id = ?, name = ?, username = ?, password_hash = ?,
 		device_type = ?, recording_enabled = ?, mac_address = ?, vendor = ?, model = ?,
-		firmware_version = ?, provisioning_status = ?, last_config_fetch = ?, last_registration = ?, config_template = ?
+		firmware_version = ?, provisioning_status = ?, last_config_fetch = ?, last_registration = ?, config_template = ?,
+		call_waiting = ?, intercom_allowed = ?, extension = ?, sip_messaging = ?, comfort_noise = ?, anonymous_calls = ?
 		WHERE id = ?
 	`, device.UserID, device.Name, device.Username, device.PasswordHash, device.DeviceType, device.RecordingEnabled,
 		device.MACAddress, device.Vendor, device.Model, device.FirmwareVersion, device.ProvisioningStatus,
-		device.LastConfigFetch, device.LastRegistration, device.ConfigTemplate, device.ID)
+		device.LastConfigFetch, device.LastRegistration, device.ConfigTemplate, device.CallWaiting, device.IntercomAllowed, device.Extension, device.SIPMessaging, device.ComfortNoise, device.AnonymousCalls, device.ID)
+	return err
+}
+
+// SetTenant moves a device to a tenant, or to the instance when tenantID is nil
+func (r *DeviceRepository) SetTenant(ctx context.Context, id int64, tenantID *int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE devices SET tenant_id = ? WHERE id = ?`, tenantID, id)
 	return err
 }
 
@@ -144,8 +199,7 @@ func (r *DeviceRepository) Delete(ctx context.Context, id int64) error {
 // List returns all devices with pagination
 func (r *DeviceRepository) List(ctx context.Context, limit, offset int) ([]*models.Device, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, user_id, name, username, password_hash, device_type, recording_enabled, created_at,
-			mac_address, vendor, model, firmware_version, provisioning_status, last_config_fetch, last_registration, config_template
+		SELECT `+deviceColumns+`
 		FROM devices ORDER BY name ASC LIMIT ? OFFSET ?
 	`, limit, offset)
 	if err != nil {
@@ -155,9 +209,30 @@ func (r *DeviceRepository) List(ctx context.Context, limit, offset int) ([]*mode
 
 	var devices []*models.Device
 	for rows.Next() {
-		device := &models.Device{}
-		if err := rows.Scan(&device.ID, &device.UserID, &device.Name, &device.Username, &device.PasswordHash, &device.DeviceType, &device.RecordingEnabled, &device.CreatedAt,
-			&device.MACAddress, &device.Vendor, &device.Model, &device.FirmwareVersion, &device.ProvisioningStatus, &device.LastConfigFetch, &device.LastRegistration, &device.ConfigTemplate); err != nil {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
+
+// ListByTenant returns a tenant's devices with pagination
+func (r *DeviceRepository) ListByTenant(ctx context.Context, tenantID int64, limit, offset int) ([]*models.Device, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+deviceColumns+`
+		FROM devices WHERE tenant_id = ? ORDER BY name ASC LIMIT ? OFFSET ?
+	`, tenantID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []*models.Device
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
 			return nil, err
 		}
 		devices = append(devices, device)
@@ -168,8 +243,7 @@ func (r *DeviceRepository) List(ctx context.Context, limit, offset int) ([]*mode
 // ListByUser returns all devices for a specific user
 func (r *DeviceRepository) ListByUser(ctx context.Context, userID int64) ([]*models.Device, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, user_id, name, username, password_hash, device_type, recording_enabled, created_at,
-			mac_address, vendor, model, firmware_version, provisioning_status, last_config_fetch, last_registration, config_template
+		SELECT `+deviceColumns+`
 		FROM devices WHERE user_id = ? ORDER BY name ASC
 	`, userID)
 	if err != nil {
@@ -179,9 +253,32 @@ func (r *DeviceRepository) ListByUser(ctx context.Context, userID int64) ([]*mod
 
 	var devices []*models.Device
 	for rows.Next() {
-		device := &models.Device{}
-		if err := rows.Scan(&device.ID, &device.UserID, &device.Name, &device.Username, &device.PasswordHash, &device.DeviceType, &device.RecordingEnabled, &device.CreatedAt,
-			&device.MACAddress, &device.Vendor, &device.Model, &device.FirmwareVersion, &device.ProvisioningStatus, &device.LastConfigFetch, &device.LastRegistration, &device.ConfigTemplate); err != nil {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
+
+// ListMessagingByDID returns the devices that receive a DID's texts over SIP MESSAGE
+func (r *DeviceRepository) ListMessagingByDID(ctx context.Context, didID int64) ([]*models.Device, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+deviceColumns+`
+		FROM devices
+		WHERE sip_messaging = TRUE AND id IN (SELECT device_id FROM device_dids WHERE did_id = ?)
+		ORDER BY name ASC
+	`, didID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []*models.Device
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
 			return nil, err
 		}
 		devices = append(devices, device)
@@ -192,8 +289,7 @@ func (r *DeviceRepository) ListByUser(ctx context.Context, userID int64) ([]*mod
 // ListByProvisioningStatus returns devices with a specific provisioning status
 func (r *DeviceRepository) ListByProvisioningStatus(ctx context.Context, status string) ([]*models.Device, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, user_id, name, username, password_hash, device_type, recording_enabled, created_at,
-			mac_address, vendor, model, firmware_version, provisioning_status, last_config_fetch, last_registration, config_template
+		SELECT `+deviceColumns+`
 		FROM devices WHERE provisioning_status = ? ORDER BY name ASC
 	`, status)
 	if err != nil {
@@ -203,9 +299,8 @@ func (r *DeviceRepository) ListByProvisioningStatus(ctx context.Context, status
 
 	var devices []*models.Device
 	for rows.Next() {
-		device := &models.Device{}
-		if err := rows.Scan(&device.ID, &device.UserID, &device.Name, &device.Username, &device.PasswordHash, &device.DeviceType, &device.RecordingEnabled, &device.CreatedAt,
-			&device.MACAddress, &device.Vendor, &device.Model, &device.FirmwareVersion, &device.ProvisioningStatus, &device.LastConfigFetch, &device.LastRegistration, &device.ConfigTemplate); err != nil {
+		device, err := scanDevice(rows)
+		if err != nil {
 			return nil, err
 		}
 		devices = append(devices, device)
@@ -219,3 +314,10 @@ func (r *DeviceRepository) Count(ctx context.Context) (int, error) {
 	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM devices`).Scan(&count)
 	return count, err
 }
+
+// CountByTenant returns the number of a tenant's devices
+func (r *DeviceRepository) CountByTenant(ctx context.Context, tenantID int64) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM devices WHERE tenant_id = ?`, tenantID).Scan(&count)
+	return count, err
+}
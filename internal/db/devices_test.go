@@ -103,6 +103,36 @@ func TestDeviceRepository_GetByUsername_NotFound(t *testing.T) {
 	}
 }
 
+func TestDeviceRepository_GetByMAC(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	device := &models.Device{
+		Name:       "Test Phone",
+		Username:   "testphone",
+		DeviceType: "softphone",
+		MACAddress: strPtr("80:5E:C0:AA:BB:CC"),
+	}
+	if err := db.Devices.Create(ctx, device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+
+	// MAC addresses match regardless of case and separators
+	for _, mac := range []string{"80:5E:C0:AA:BB:CC", "805ec0aabbcc", "80-5e-c0-aa-bb-cc", "805e.c0aa.bbcc"} {
+		found, err := db.Devices.GetByMAC(ctx, mac)
+		if err != nil {
+			t.Fatalf("GetByMAC(%q) failed: %v", mac, err)
+		}
+		if found.ID != device.ID {
+			t.Errorf("GetByMAC(%q) returned device %d, want %d", mac, found.ID, device.ID)
+		}
+	}
+
+	if _, err := db.Devices.GetByMAC(ctx, "805ec0aabbcd"); err != ErrDeviceNotFound {
+		t.Errorf("Expected ErrDeviceNotFound, got %v", err)
+	}
+}
+
 func TestDeviceRepository_Update(t *testing.T) {
 	db := setupTestDB(t)
 	ctx := context.Background()
@@ -275,3 +305,178 @@ func TestDeviceRepository_Count(t *testing.T) {
 		t.Errorf("Expected 4 devices, got %d", count)
 	}
 }
+
+func TestDeviceRepository_CallWaiting(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	device := &models.Device{
+		Name:        "Kitchen Phone",
+		Username:    "kitchen",
+		DeviceType:  "grandstream",
+		CallWaiting: true,
+	}
+	if err := db.Devices.Create(ctx, device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+
+	retrieved, err := db.Devices.GetByUsername(ctx, "kitchen")
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if !retrieved.CallWaiting {
+		t.Error("Expected call waiting to be enabled")
+	}
+
+	retrieved.CallWaiting = false
+	if err := db.Devices.Update(ctx, retrieved); err != nil {
+		t.Fatalf("Failed to update device: %v", err)
+	}
+
+	retrieved, err = db.Devices.GetByID(ctx, device.ID)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if retrieved.CallWaiting {
+		t.Error("Expected call waiting to be disabled")
+	}
+}
+
+func TestDeviceRepository_IntercomAllowed(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	device := &models.Device{
+		Name:       "Kitchen Phone",
+		Username:   "kitchen",
+		DeviceType: "grandstream",
+	}
+	if err := db.Devices.Create(ctx, device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+
+	retrieved, err := db.Devices.GetByID(ctx, device.ID)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if retrieved.IntercomAllowed {
+		t.Error("Expected intercom to be denied by default")
+	}
+
+	retrieved.IntercomAllowed = true
+	if err := db.Devices.Update(ctx, retrieved); err != nil {
+		t.Fatalf("Failed to update device: %v", err)
+	}
+
+	retrieved, err = db.Devices.GetByUsername(ctx, "kitchen")
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if !retrieved.IntercomAllowed {
+		t.Error("Expected intercom to be allowed after update")
+	}
+}
+
+func TestDeviceRepository_ComfortNoise(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	device := &models.Device{
+		Name:         "Lobby Phone",
+		Username:     "lobby",
+		DeviceType:   "grandstream",
+		ComfortNoise: true,
+	}
+	if err := db.Devices.Create(ctx, device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+
+	retrieved, err := db.Devices.GetByID(ctx, device.ID)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if !retrieved.ComfortNoise {
+		t.Error("Expected comfort noise to be enabled")
+	}
+
+	retrieved.ComfortNoise = false
+	if err := db.Devices.Update(ctx, retrieved); err != nil {
+		t.Fatalf("Failed to update device: %v", err)
+	}
+	if retrieved, _ = db.Devices.GetByID(ctx, device.ID); retrieved.ComfortNoise {
+		t.Error("Expected comfort noise to be disabled after update")
+	}
+}
+
+func TestDeviceRepository_GetByExtension(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	ext := "201"
+	device := &models.Device{
+		Name:       "Front Desk",
+		Username:   "frontdesk",
+		DeviceType: "grandstream",
+		Extension:  &ext,
+	}
+	if err := db.Devices.Create(ctx, device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+
+	retrieved, err := db.Devices.GetByExtension(ctx, nil, "201")
+	if err != nil {
+		t.Fatalf("Failed to get device by extension: %v", err)
+	}
+	if retrieved.ID != device.ID {
+		t.Errorf("Expected device %d, got %d", device.ID, retrieved.ID)
+	}
+
+	if _, err := db.Devices.GetByExtension(ctx, nil, "202"); err != ErrDeviceNotFound {
+		t.Errorf("Expected ErrDeviceNotFound, got %v", err)
+	}
+
+	// Extensions are unique, but any number of devices may have none
+	duplicate := &models.Device{Name: "Back Office", Username: "backoffice", DeviceType: "grandstream", Extension: &ext}
+	if err := db.Devices.Create(ctx, duplicate); err == nil {
+		t.Error("Expected duplicate extension to be rejected")
+	}
+	for _, username := range []string{"noext1", "noext2"} {
+		if err := db.Devices.Create(ctx, &models.Device{Name: username, Username: username, DeviceType: "softphone"}); err != nil {
+			t.Fatalf("Failed to create device without extension: %v", err)
+		}
+	}
+}
+
+func TestDeviceRepository_ListMessagingByDID(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	did := &models.DID{Number: "+15559876543", SMSEnabled: true}
+	if err := db.DIDs.Create(ctx, did); err != nil {
+		t.Fatalf("Failed to create DID: %v", err)
+	}
+	softphone := &models.Device{Name: "Softphone", Username: "softphone", DeviceType: "softphone", SIPMessaging: true}
+	deskPhone := &models.Device{Name: "Desk Phone", Username: "desk", DeviceType: "grandstream"}
+	other := &models.Device{Name: "Other", Username: "other", DeviceType: "softphone", SIPMessaging: true}
+	for _, device := range []*models.Device{softphone, deskPhone, other} {
+		if err := db.Devices.Create(ctx, device); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+	for _, device := range []*models.Device{softphone, deskPhone} {
+		if err := db.DeviceDIDs.SetForDevice(ctx, device.ID, []int64{did.ID}, nil); err != nil {
+			t.Fatalf("Failed to set device DIDs: %v", err)
+		}
+	}
+
+	devices, err := db.Devices.ListMessagingByDID(ctx, did.ID)
+	if err != nil {
+		t.Fatalf("ListMessagingByDID failed: %v", err)
+	}
+	if len(devices) != 1 || devices[0].ID != softphone.ID {
+		t.Errorf("Expected only the softphone, got %d devices", len(devices))
+	}
+	if !devices[0].SIPMessaging {
+		t.Error("Expected SIPMessaging to be loaded")
+	}
+}
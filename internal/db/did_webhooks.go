@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrDIDWebhooksNotFound = errors.New("DID webhooks not found")
+
+// DIDWebhookRepository handles database operations for the webhook
+// configuration of DIDs' Twilio numbers
+type DIDWebhookRepository struct {
+	db *sql.DB
+}
+
+// NewDIDWebhookRepository creates a new DIDWebhookRepository
+func NewDIDWebhookRepository(db *sql.DB) *DIDWebhookRepository {
+	return &DIDWebhookRepository{db: db}
+}
+
+const didWebhookColumns = `w.did_id, d.number, w.phone_number_sid, w.base_url, w.intact, w.problems, w.verified_at, w.created_at, w.updated_at`
+
+// scanDIDWebhooks reads a DID's webhook configuration from a row
+func scanDIDWebhooks(row interface{ Scan(...interface{}) error }) (*models.DIDWebhooks, error) {
+	h := &models.DIDWebhooks{}
+	var problems sql.NullString
+	if err := row.Scan(&h.DIDID, &h.Number, &h.PhoneNumberSID, &h.BaseURL, &h.Intact, &problems, &h.VerifiedAt, &h.CreatedAt, &h.UpdatedAt); err != nil {
+		return nil, err
+	}
+	h.Problems = []string{}
+	if problems.Valid && problems.String != "" {
+		if err := json.Unmarshal([]byte(problems.String), &h.Problems); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// Get retrieves the webhook configuration of a DID
+func (r *DIDWebhookRepository) Get(ctx context.Context, didID int64) (*models.DIDWebhooks, error) {
+	h, err := scanDIDWebhooks(r.db.QueryRowContext(ctx, `
+		SELECT `+didWebhookColumns+` FROM did_webhooks w JOIN dids d ON d.id = w.did_id
+		WHERE w.did_id = ?
+	`, didID))
+	if err == sql.ErrNoRows {
+		return nil, ErrDIDWebhooksNotFound
+	}
+	return h, err
+}
+
+// List returns the webhook configuration of every configured DID
+func (r *DIDWebhookRepository) List(ctx context.Context) ([]*models.DIDWebhooks, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+didWebhookColumns+` FROM did_webhooks w JOIN dids d ON d.id = w.did_id
+		ORDER BY d.number
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []*models.DIDWebhooks
+	for rows.Next() {
+		h, err := scanDIDWebhooks(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, rows.Err()
+}
+
+// Upsert stores the Twilio number and public URL a DID's webhooks were set
+// to
+func (r *DIDWebhookRepository) Upsert(ctx context.Context, didID int64, phoneNumberSID, baseURL string) error {
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO did_webhooks (did_id, phone_number_sid, base_url, intact, created_at, updated_at)
+		VALUES (?, ?, ?, 1, ?, ?)
+		ON CONFLICT(did_id) DO UPDATE SET
+			phone_number_sid = excluded.phone_number_sid,
+			base_url = excluded.base_url,
+			updated_at = excluded.updated_at
+	`, didID, phoneNumberSID, baseURL, now, now)
+	return err
+}
+
+// RecordVerification stores the outcome of checking a DID's webhooks
+// against Twilio
+func (r *DIDWebhookRepository) RecordVerification(ctx context.Context, didID int64, problems []string, verifiedAt time.Time) error {
+	if problems == nil {
+		problems = []string{}
+	}
+	data, err := json.Marshal(problems)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE did_webhooks SET intact = ?, problems = ?, verified_at = ? WHERE did_id = ?
+	`, len(problems) == 0, string(data), verifiedAt, didID)
+	return err
+}
+
+// Delete stops tracking a DID's webhooks
+func (r *DIDWebhookRepository) Delete(ctx context.Context, didID int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM did_webhooks WHERE did_id = ?`, didID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrDIDWebhooksNotFound
+	}
+	return nil
+}
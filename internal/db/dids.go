@@ -13,6 +13,16 @@ var (
 	ErrDIDAlreadyExists = errors.New("DID already exists")
 )
 
+// Anonymous caller policies for a DID
+const (
+	AnonymousActionAllow     = "allow"
+	AnonymousActionReject    = "reject"
+	AnonymousActionChallenge = "challenge"
+)
+
+// didColumns is the column list shared by all DID queries
+const didColumns = `id, number, twilio_sid, name, sms_enabled, voice_enabled, anonymous_action, language, timezone, messaging_service_sid, recording_enabled, tenant_id`
+
 // DIDRepository handles database operations for phone numbers (DIDs)
 type DIDRepository struct {
 	db *sql.DB
@@ -23,31 +33,41 @@ func NewDIDRepository(db *sql.DB) *DIDRepository {
 	return &DIDRepository{db: db}
 }
 
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanDID scans a single DID row selected with didColumns
+func scanDID(row rowScanner) (*models.DID, error) {
+	did := &models.DID{}
+	if err := row.Scan(&did.ID, &did.Number, &did.TwilioSID, &did.Name, &did.SMSEnabled, &did.VoiceEnabled, &did.AnonymousAction, &did.Language, &did.Timezone, &did.MessagingServiceSID, &did.RecordingEnabled, &did.TenantID); err != nil {
+		return nil, err
+	}
+	return did, nil
+}
+
 // Create inserts a new DID
 func (r *DIDRepository) Create(ctx context.Context, did *models.DID) error {
-	result, err := r.db.ExecContext(ctx, `
-		INSERT INTO dids (number, twilio_sid, name, sms_enabled, voice_enabled)
-		VALUES (?, ?, ?, ?, ?)
-	`, did.Number, did.TwilioSID, did.Name, did.SMSEnabled, did.VoiceEnabled)
-	if err != nil {
-		return err
+	if did.AnonymousAction == "" {
+		did.AnonymousAction = AnonymousActionAllow
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return err
-	}
-	did.ID = id
-	return nil
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO dids (number, twilio_sid, name, sms_enabled, voice_enabled, anonymous_action, language, timezone,
+		messaging_service_sid, recording_enabled, tenant_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, did.Number, did.TwilioSID, did.Name, did.SMSEnabled, did.VoiceEnabled, did.AnonymousAction, did.Language, did.Timezone,
+		did.MessagingServiceSID, did.RecordingEnabled, did.TenantID).Scan(&did.ID)
 }
 
 // GetByID retrieves a DID by ID
 func (r *DIDRepository) GetByID(ctx context.Context, id int64) (*models.DID, error) {
-	did := &models.DID{}
-	err := r.db.QueryRowContext(ctx, `
-		SELECT id, number, twilio_sid, name, sms_enabled, voice_enabled
+	did, err := scanDID(r.db.QueryRowContext(ctx, `
+		SELECT `+didColumns+`
 		FROM dids WHERE id = ?
-	`, id).Scan(&did.ID, &did.Number, &did.TwilioSID, &did.Name, &did.SMSEnabled, &did.VoiceEnabled)
+	`, id))
 	if err == sql.ErrNoRows {
 		return nil, ErrDIDNotFound
 	}
@@ -59,11 +79,26 @@ func (r *DIDRepository) GetByID(ctx context.Context, id int64) (*models.DID, err
 
 // GetByNumber retrieves a DID by phone number
 func (r *DIDRepository) GetByNumber(ctx context.Context, number string) (*models.DID, error) {
-	did := &models.DID{}
-	err := r.db.QueryRowContext(ctx, `
-		SELECT id, number, twilio_sid, name, sms_enabled, voice_enabled
+	did, err := scanDID(r.db.QueryRowContext(ctx, `
+		SELECT `+didColumns+`
 		FROM dids WHERE number = ?
-	`, number).Scan(&did.ID, &did.Number, &did.TwilioSID, &did.Name, &did.SMSEnabled, &did.VoiceEnabled)
+	`, number))
+	if err == sql.ErrNoRows {
+		return nil, ErrDIDNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return did, nil
+}
+
+// GetByMessagingServiceSID retrieves the first DID that sends through a
+// Twilio Messaging Service
+func (r *DIDRepository) GetByMessagingServiceSID(ctx context.Context, sid string) (*models.DID, error) {
+	did, err := scanDID(r.db.QueryRowContext(ctx, `
+		SELECT `+didColumns+`
+		FROM dids WHERE messaging_service_sid = ? ORDER BY id ASC LIMIT 1
+	`, sid))
 	if err == sql.ErrNoRows {
 		return nil, ErrDIDNotFound
 	}
@@ -75,13 +110,39 @@ func (r *DIDRepository) GetByNumber(ctx context.Context, number string) (*models
 
 // Update updates an existing DID
 func (r *DIDRepository) Update(ctx context.Context, did *models.DID) error {
+	if did.AnonymousAction == "" {
+		did.AnonymousAction = AnonymousActionAllow
+	}
+
 	_, err := r.db.ExecContext(ctx, `
-		UPDATE dids SET number = ?, twilio_sid = ?, name = ?, sms_enabled = ?, voice_enabled = ?
+		UPDATE dids SET number = ?, twilio_sid = ?, name = ?, sms_enabled = ?, voice_enabled = ?,
+		anonymous_action = ?, language = ?, timezone = ?, messaging_service_sid = ?,
+		recording_enabled = ?
 		WHERE id = ?
-	`, did.Number, did.TwilioSID, did.Name, did.SMSEnabled, did.VoiceEnabled, did.ID)
+	`, did.Number, did.TwilioSID, did.Name, did.SMSEnabled, did.VoiceEnabled, did.AnonymousAction, did.Language, did.Timezone,
+		did.MessagingServiceSID, did.RecordingEnabled, did.ID)
 	return err
 }
 
+// SetTenant assigns a DID, and the routes on it, to a tenant or back to the
+// instance when tenantID is nil. Its past messages and calls stay with the
+// tenant they were made under.
+func (r *DIDRepository) SetTenant(ctx context.Context, id int64, tenantID *int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE dids SET tenant_id = ? WHERE id = ?`, tenantID, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE routes SET tenant_id = ? WHERE did_id = ?`, tenantID, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 // Delete removes a DID
 func (r *DIDRepository) Delete(ctx context.Context, id int64) error {
 	_, err := r.db.ExecContext(ctx, `DELETE FROM dids WHERE id = ?`, id)
@@ -90,54 +151,27 @@ func (r *DIDRepository) Delete(ctx context.Context, id int64) error {
 
 // List returns all DIDs
 func (r *DIDRepository) List(ctx context.Context) ([]*models.DID, error) {
-	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, number, twilio_sid, name, sms_enabled, voice_enabled
-		FROM dids ORDER BY number ASC
-	`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	return r.list(ctx, `SELECT `+didColumns+` FROM dids ORDER BY number ASC`)
+}
 
-	var dids []*models.DID
-	for rows.Next() {
-		did := &models.DID{}
-		if err := rows.Scan(&did.ID, &did.Number, &did.TwilioSID, &did.Name, &did.SMSEnabled, &did.VoiceEnabled); err != nil {
-			return nil, err
-		}
-		dids = append(dids, did)
-	}
-	return dids, rows.Err()
+// ListByTenant returns a tenant's DIDs
+func (r *DIDRepository) ListByTenant(ctx context.Context, tenantID int64) ([]*models.DID, error) {
+	return r.list(ctx, `SELECT `+didColumns+` FROM dids WHERE tenant_id = ? ORDER BY number ASC`, tenantID)
 }
 
 // ListVoiceEnabled returns all DIDs with voice enabled
 func (r *DIDRepository) ListVoiceEnabled(ctx context.Context) ([]*models.DID, error) {
-	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, number, twilio_sid, name, sms_enabled, voice_enabled
-		FROM dids WHERE voice_enabled = 1 ORDER BY number ASC
-	`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var dids []*models.DID
-	for rows.Next() {
-		did := &models.DID{}
-		if err := rows.Scan(&did.ID, &did.Number, &did.TwilioSID, &did.Name, &did.SMSEnabled, &did.VoiceEnabled); err != nil {
-			return nil, err
-		}
-		dids = append(dids, did)
-	}
-	return dids, rows.Err()
+	return r.list(ctx, `SELECT `+didColumns+` FROM dids WHERE voice_enabled = TRUE ORDER BY number ASC`)
 }
 
 // ListSMSEnabled returns all DIDs with SMS enabled
 func (r *DIDRepository) ListSMSEnabled(ctx context.Context) ([]*models.DID, error) {
-	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, number, twilio_sid, name, sms_enabled, voice_enabled
-		FROM dids WHERE sms_enabled = 1 ORDER BY number ASC
-	`)
+	return r.list(ctx, `SELECT `+didColumns+` FROM dids WHERE sms_enabled = TRUE ORDER BY number ASC`)
+}
+
+// list runs a DID query and scans every returned row
+func (r *DIDRepository) list(ctx context.Context, query string, args ...interface{}) ([]*models.DID, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -145,8 +179,8 @@ func (r *DIDRepository) ListSMSEnabled(ctx context.Context) ([]*models.DID, erro
 
 	var dids []*models.DID
 	for rows.Next() {
-		did := &models.DID{}
-		if err := rows.Scan(&did.ID, &did.Number, &did.TwilioSID, &did.Name, &did.SMSEnabled, &did.VoiceEnabled); err != nil {
+		did, err := scanDID(rows)
+		if err != nil {
 			return nil, err
 		}
 		dids = append(dids, did)
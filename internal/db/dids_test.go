@@ -300,3 +300,57 @@ func TestDIDRepository_Count(t *testing.T) {
 		t.Errorf("Expected 5 DIDs, got %d", count)
 	}
 }
+
+func TestDIDRepository_AnonymousAction(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	did := &models.DID{Number: "+15551112222", VoiceEnabled: true}
+	if err := db.DIDs.Create(ctx, did); err != nil {
+		t.Fatalf("Failed to create DID: %v", err)
+	}
+
+	retrieved, err := db.DIDs.GetByID(ctx, did.ID)
+	if err != nil {
+		t.Fatalf("Failed to get DID: %v", err)
+	}
+	if retrieved.AnonymousAction != AnonymousActionAllow {
+		t.Errorf("Expected default anonymous action %q, got %q", AnonymousActionAllow, retrieved.AnonymousAction)
+	}
+
+	retrieved.AnonymousAction = AnonymousActionChallenge
+	if err := db.DIDs.Update(ctx, retrieved); err != nil {
+		t.Fatalf("Failed to update DID: %v", err)
+	}
+
+	updated, err := db.DIDs.GetByNumber(ctx, did.Number)
+	if err != nil {
+		t.Fatalf("Failed to get DID by number: %v", err)
+	}
+	if updated.AnonymousAction != AnonymousActionChallenge {
+		t.Errorf("Expected anonymous action %q, got %q", AnonymousActionChallenge, updated.AnonymousAction)
+	}
+}
+
+func TestDIDRepository_Language(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	did := &models.DID{Number: "+15551234567", VoiceEnabled: true, Language: "es"}
+	if err := db.DIDs.Create(ctx, did); err != nil {
+		t.Fatalf("Failed to create DID: %v", err)
+	}
+
+	retrieved, err := db.DIDs.GetByID(ctx, did.ID)
+	if err != nil {
+		t.Fatalf("Failed to get DID: %v", err)
+	}
+	if retrieved.Language != "es" {
+		t.Errorf("Expected language es, got %q", retrieved.Language)
+	}
+
+	retrieved.Language = "it"
+	if err := db.DIDs.Update(ctx, retrieved); err == nil {
+		t.Error("Expected unsupported language to be rejected")
+	}
+}
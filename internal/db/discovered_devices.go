@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrDiscoveredDeviceNotFound = errors.New("discovered device not found")
+
+// DiscoveredDeviceRepository handles database operations for devices found by LAN discovery
+type DiscoveredDeviceRepository struct {
+	db *sql.DB
+}
+
+// NewDiscoveredDeviceRepository creates a new DiscoveredDeviceRepository
+func NewDiscoveredDeviceRepository(db *sql.DB) *DiscoveredDeviceRepository {
+	return &DiscoveredDeviceRepository{db: db}
+}
+
+const discoveredDeviceColumns = `id, mac_address, ip_address, vendor, model, firmware_version, source, banner, device_id, first_seen, last_seen`
+
+func scanDiscoveredDevice(row interface{ Scan(...interface{}) error }) (*models.DiscoveredDevice, error) {
+	d := &models.DiscoveredDevice{}
+	err := row.Scan(&d.ID, &d.MACAddress, &d.IPAddress, &d.Vendor, &d.Model, &d.FirmwareVersion, &d.Source, &d.Banner, &d.DeviceID, &d.FirstSeen, &d.LastSeen)
+	return d, err
+}
+
+// Upsert records a sighting, matching an existing entry by MAC address when
+// known and by IP address otherwise. Identification details already on file
+// are kept when the new sighting lacks them. It reports whether the device is new.
+func (r *DiscoveredDeviceRepository) Upsert(ctx context.Context, d *models.DiscoveredDevice) (bool, error) {
+	existing, err := r.find(ctx, d.MACAddress, d.IPAddress)
+	if err != nil && !errors.Is(err, ErrDiscoveredDeviceNotFound) {
+		return false, err
+	}
+
+	now := time.Now()
+	if existing == nil {
+		if err := r.db.QueryRowContext(ctx, `
+			INSERT INTO discovered_devices (mac_address, ip_address, vendor, model, firmware_version, source, banner, first_seen, last_seen)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`, d.MACAddress, d.IPAddress, d.Vendor, d.Model, d.FirmwareVersion, d.Source, d.Banner, now, now).Scan(&d.ID); err != nil {
+			return false, err
+		}
+		d.FirstSeen = now
+		d.LastSeen = now
+		return true, nil
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE discovered_devices SET
+			mac_address = COALESCE(?, mac_address),
+			ip_address = ?,
+			vendor = COALESCE(?, vendor),
+			model = COALESCE(?, model),
+			firmware_version = COALESCE(?, firmware_version),
+			source = ?,
+			banner = COALESCE(?, banner),
+			last_seen = ?
+		WHERE id = ?
+	`, d.MACAddress, d.IPAddress, d.Vendor, d.Model, d.FirmwareVersion, d.Source, d.Banner, now, existing.ID)
+	if err != nil {
+		return false, err
+	}
+
+	updated, err := r.GetByID(ctx, existing.ID)
+	if err != nil {
+		return false, err
+	}
+	*d = *updated
+	return false, nil
+}
+
+// find locates a discovered device by MAC address, falling back to IP address
+func (r *DiscoveredDeviceRepository) find(ctx context.Context, mac *string, ip string) (*models.DiscoveredDevice, error) {
+	if mac != nil && *mac != "" {
+		d, err := scanDiscoveredDevice(r.db.QueryRowContext(ctx, `
+			SELECT `+discoveredDeviceColumns+` FROM discovered_devices WHERE mac_address = ?
+		`, *mac))
+		if err == nil {
+			return d, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	// An IP match only counts when the entry has no conflicting MAC address
+	d, err := scanDiscoveredDevice(r.db.QueryRowContext(ctx, `
+		SELECT `+discoveredDeviceColumns+` FROM discovered_devices
+		WHERE ip_address = ? AND (mac_address IS NULL OR CAST(? AS TEXT) IS NULL)
+		ORDER BY last_seen DESC LIMIT 1
+	`, ip, mac))
+	if err == sql.ErrNoRows {
+		return nil, ErrDiscoveredDeviceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// GetByID retrieves a discovered device by ID
+func (r *DiscoveredDeviceRepository) GetByID(ctx context.Context, id int64) (*models.DiscoveredDevice, error) {
+	d, err := scanDiscoveredDevice(r.db.QueryRowContext(ctx, `
+		SELECT `+discoveredDeviceColumns+` FROM discovered_devices WHERE id = ?
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrDiscoveredDeviceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// List returns discovered devices, most recently seen first.
+// Adopted devices are only included when includeAdopted is set.
+func (r *DiscoveredDeviceRepository) List(ctx context.Context, includeAdopted bool) ([]*models.DiscoveredDevice, error) {
+	query := `SELECT ` + discoveredDeviceColumns + ` FROM discovered_devices`
+	if !includeAdopted {
+		query += ` WHERE device_id IS NULL`
+	}
+	query += ` ORDER BY last_seen DESC`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []*models.DiscoveredDevice
+	for rows.Next() {
+		d, err := scanDiscoveredDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// MarkAdopted links a discovered device to the device it was provisioned as
+func (r *DiscoveredDeviceRepository) MarkAdopted(ctx context.Context, id, deviceID int64) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE discovered_devices SET device_id = ? WHERE id = ?`, deviceID, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrDiscoveredDeviceNotFound
+	}
+	return nil
+}
+
+// Delete removes a discovered device
+func (r *DiscoveredDeviceRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM discovered_devices WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrDiscoveredDeviceNotFound
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestDiscoveredDeviceRepository_UpsertByMAC(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	first := &models.DiscoveredDevice{MACAddress: strPtr("00:0b:82:12:34:56"), IPAddress: "192.168.1.50", Vendor: strPtr("grandstream"), Model: strPtr("GXP1760W"), Source: "ssdp"}
+	created, err := db.DiscoveredDevices.Upsert(ctx, first)
+	if err != nil {
+		t.Fatalf("Failed to record discovery: %v", err)
+	}
+	if !created {
+		t.Error("Expected first sighting to be new")
+	}
+
+	// Same phone on a new address, seen over mDNS without a model
+	second := &models.DiscoveredDevice{MACAddress: strPtr("00:0b:82:12:34:56"), IPAddress: "192.168.1.77", Source: "mdns"}
+	created, err = db.DiscoveredDevices.Upsert(ctx, second)
+	if err != nil {
+		t.Fatalf("Failed to record discovery: %v", err)
+	}
+	if created {
+		t.Error("Expected repeat sighting to update the existing entry")
+	}
+	if second.ID != first.ID {
+		t.Errorf("Expected ID %d, got %d", first.ID, second.ID)
+	}
+	if second.IPAddress != "192.168.1.77" {
+		t.Errorf("Expected IP to be updated, got %s", second.IPAddress)
+	}
+	if second.Model == nil || *second.Model != "GXP1760W" {
+		t.Errorf("Expected model to be kept, got %v", second.Model)
+	}
+}
+
+func TestDiscoveredDeviceRepository_UpsertByIP(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	first := &models.DiscoveredDevice{IPAddress: "192.168.1.60", Source: "mdns"}
+	if _, err := db.DiscoveredDevices.Upsert(ctx, first); err != nil {
+		t.Fatalf("Failed to record discovery: %v", err)
+	}
+
+	// A later sighting that learns the MAC address fills in the same entry
+	second := &models.DiscoveredDevice{MACAddress: strPtr("80:5e:c0:aa:bb:cc"), IPAddress: "192.168.1.60", Source: "ssdp"}
+	created, err := db.DiscoveredDevices.Upsert(ctx, second)
+	if err != nil {
+		t.Fatalf("Failed to record discovery: %v", err)
+	}
+	if created || second.ID != first.ID {
+		t.Errorf("Expected entry %d to be updated, got created=%v id=%d", first.ID, created, second.ID)
+	}
+
+	// A different MAC on the same IP is a different phone
+	third := &models.DiscoveredDevice{MACAddress: strPtr("80:5e:c0:dd:ee:ff"), IPAddress: "192.168.1.60", Source: "ssdp"}
+	created, err = db.DiscoveredDevices.Upsert(ctx, third)
+	if err != nil {
+		t.Fatalf("Failed to record discovery: %v", err)
+	}
+	if !created {
+		t.Error("Expected a conflicting MAC address to create a new entry")
+	}
+}
+
+func TestDiscoveredDeviceRepository_MarkAdopted(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	discovered := &models.DiscoveredDevice{IPAddress: "192.168.1.50", Source: "ssdp"}
+	if _, err := db.DiscoveredDevices.Upsert(ctx, discovered); err != nil {
+		t.Fatalf("Failed to record discovery: %v", err)
+	}
+
+	device := &models.Device{Name: "Desk", Username: "desk", PasswordHash: "hash", DeviceType: "grandstream"}
+	if err := db.Devices.Create(ctx, device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+
+	if err := db.DiscoveredDevices.MarkAdopted(ctx, discovered.ID, device.ID); err != nil {
+		t.Fatalf("Failed to mark adopted: %v", err)
+	}
+
+	pending, err := db.DiscoveredDevices.List(ctx, false)
+	if err != nil {
+		t.Fatalf("Failed to list: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("Expected adopted device to be hidden, got %d", len(pending))
+	}
+
+	all, err := db.DiscoveredDevices.List(ctx, true)
+	if err != nil {
+		t.Fatalf("Failed to list: %v", err)
+	}
+	if len(all) != 1 || all[0].DeviceID == nil || *all[0].DeviceID != device.ID {
+		t.Errorf("Expected adopted device linked to %d, got %+v", device.ID, all)
+	}
+
+	if err := db.DiscoveredDevices.MarkAdopted(ctx, 999, device.ID); err != ErrDiscoveredDeviceNotFound {
+		t.Errorf("Expected ErrDiscoveredDeviceNotFound, got %v", err)
+	}
+}
+
+func TestDeviceEventRepository_LogDiscovery(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	if err := db.DeviceEvents.LogDiscovery(ctx, map[string]interface{}{"vendor": "yealink"}, "192.168.1.80"); err != nil {
+		t.Fatalf("Failed to log discovery: %v", err)
+	}
+
+	events, err := db.DeviceEvents.ListRecent(ctx, 10)
+	if err != nil {
+		t.Fatalf("Failed to list events: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != "discovered" || events[0].DeviceID != nil {
+		t.Errorf("Expected one unlinked discovered event, got %+v", events)
+	}
+}
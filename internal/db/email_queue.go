@@ -0,0 +1,189 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrQueuedEmailNotFound = errors.New("queued email not found")
+
+// Email queue statuses
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	EmailDead    = "dead" // Out of attempts, kept for an admin to retry
+)
+
+// EmailQueueRepository handles database operations for the outbound email
+// queue
+type EmailQueueRepository struct {
+	db *sql.DB
+}
+
+// NewEmailQueueRepository creates a new EmailQueueRepository
+func NewEmailQueueRepository(db *sql.DB) *EmailQueueRepository {
+	return &EmailQueueRepository{db: db}
+}
+
+const queuedEmailColumns = `id, recipient, subject, body, html, status, attempts, last_error, next_attempt_at, created_at, sent_at`
+
+func scanQueuedEmail(row rowScanner) (*models.QueuedEmail, error) {
+	e := &models.QueuedEmail{}
+	var lastError sql.NullString
+	var nextAttemptAt, sentAt sql.NullTime
+	if err := row.Scan(&e.ID, &e.Recipient, &e.Subject, &e.Body, &e.HTML, &e.Status, &e.Attempts, &lastError, &nextAttemptAt, &e.CreatedAt, &sentAt); err != nil {
+		return nil, err
+	}
+	if lastError.Valid {
+		e.LastError = &lastError.String
+	}
+	if nextAttemptAt.Valid {
+		e.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if sentAt.Valid {
+		e.SentAt = &sentAt.Time
+	}
+	return e, nil
+}
+
+func (r *EmailQueueRepository) list(ctx context.Context, query string, args ...interface{}) ([]*models.QueuedEmail, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []*models.QueuedEmail
+	for rows.Next() {
+		e, err := scanQueuedEmail(rows)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, e)
+	}
+	return emails, rows.Err()
+}
+
+// Enqueue adds a pending email, first tried at its NextAttemptAt
+func (r *EmailQueueRepository) Enqueue(ctx context.Context, email *models.QueuedEmail) error {
+	email.Status = EmailPending
+	if email.CreatedAt.IsZero() {
+		email.CreatedAt = time.Now()
+	}
+
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO email_queue (recipient, subject, body, html, status, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, email.Recipient, email.Subject, email.Body, email.HTML, email.Status, email.NextAttemptAt, email.CreatedAt).Scan(&email.ID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetByID retrieves a queued email by ID
+func (r *EmailQueueRepository) GetByID(ctx context.Context, id int64) (*models.QueuedEmail, error) {
+	e, err := scanQueuedEmail(r.db.QueryRowContext(ctx, `
+		SELECT `+queuedEmailColumns+` FROM email_queue WHERE id = ?
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrQueuedEmailNotFound
+	}
+	return e, err
+}
+
+// ListDue returns pending emails whose next attempt is due, oldest first
+func (r *EmailQueueRepository) ListDue(ctx context.Context, now time.Time, limit int) ([]*models.QueuedEmail, error) {
+	return r.list(ctx, `
+		SELECT `+queuedEmailColumns+` FROM email_queue
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at, id LIMIT ?
+	`, EmailPending, now, limit)
+}
+
+// ListByStatus returns the emails in a status, newest first, with pagination
+func (r *EmailQueueRepository) ListByStatus(ctx context.Context, status string, limit, offset int) ([]*models.QueuedEmail, error) {
+	return r.list(ctx, `
+		SELECT `+queuedEmailColumns+` FROM email_queue
+		WHERE status = ? ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?
+	`, status, limit, offset)
+}
+
+// CountByStatus returns how many emails are in a status
+func (r *EmailQueueRepository) CountByStatus(ctx context.Context, status string) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM email_queue WHERE status = ?`, status).Scan(&count)
+	return count, err
+}
+
+// MarkSent records a delivered email
+func (r *EmailQueueRepository) MarkSent(ctx context.Context, id int64, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE email_queue SET status = ?, attempts = attempts + 1, last_error = NULL, next_attempt_at = NULL, sent_at = ?
+		WHERE id = ?
+	`, EmailSent, at, id)
+	return err
+}
+
+// MarkFailed records a failed attempt. The email is tried again at next,
+// or becomes a dead letter when next is nil.
+func (r *EmailQueueRepository) MarkFailed(ctx context.Context, id int64, lastError string, next *time.Time) error {
+	status := EmailPending
+	if next == nil {
+		status = EmailDead
+	}
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE email_queue SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ?
+		WHERE id = ?
+	`, status, lastError, next, id)
+	return err
+}
+
+// Retry puts a dead letter back in the queue with a fresh set of attempts
+func (r *EmailQueueRepository) Retry(ctx context.Context, id int64, at time.Time) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE email_queue SET status = ?, attempts = 0, next_attempt_at = ?
+		WHERE id = ? AND status = ?
+	`, EmailPending, at, id, EmailDead)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrQueuedEmailNotFound
+	}
+	return nil
+}
+
+// Delete removes a queued email
+func (r *EmailQueueRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM email_queue WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrQueuedEmailNotFound
+	}
+	return nil
+}
+
+// DeleteSentBefore removes emails delivered before a time and returns how
+// many
+func (r *EmailQueueRepository) DeleteSentBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM email_queue WHERE status = ? AND sent_at < ?`, EmailSent, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
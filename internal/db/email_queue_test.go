@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestEmailQueueRepository_Lifecycle(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	later := now.Add(time.Minute)
+	email := &models.QueuedEmail{Recipient: "admin@example.com", Subject: "New Voicemail", Body: "Hello", NextAttemptAt: &later}
+	if err := database.EmailQueue.Enqueue(ctx, email); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if email.ID == 0 || email.Status != EmailPending {
+		t.Fatalf("Expected a pending email with an ID, got %+v", email)
+	}
+
+	if due, _ := database.EmailQueue.ListDue(ctx, now, 10); len(due) != 0 {
+		t.Errorf("Expected nothing due yet, got %d", len(due))
+	}
+	due, err := database.EmailQueue.ListDue(ctx, later, 10)
+	if err != nil || len(due) != 1 || due[0].Recipient != "admin@example.com" {
+		t.Fatalf("ListDue = %+v, %v", due, err)
+	}
+
+	retryAt := later.Add(time.Minute)
+	if err := database.EmailQueue.MarkFailed(ctx, email.ID, "rcpt: Relay replied 451 try later", &retryAt); err != nil {
+		t.Fatalf("MarkFailed failed: %v", err)
+	}
+	got, _ := database.EmailQueue.GetByID(ctx, email.ID)
+	if got.Status != EmailPending || got.Attempts != 1 || got.LastError == nil || *got.LastError != "rcpt: Relay replied 451 try later" {
+		t.Errorf("Expected a pending email with one failed attempt, got %+v", got)
+	}
+
+	if err := database.EmailQueue.MarkFailed(ctx, email.ID, "connect: refused", nil); err != nil {
+		t.Fatal(err)
+	}
+	if dead, _ := database.EmailQueue.ListByStatus(ctx, EmailDead, 10, 0); len(dead) != 1 || dead[0].Attempts != 2 {
+		t.Fatalf("Expected a dead letter after two attempts, got %+v", dead)
+	}
+	if due, _ := database.EmailQueue.ListDue(ctx, retryAt.Add(time.Hour), 10); len(due) != 0 {
+		t.Errorf("Dead letters shouldn't be due, got %d", len(due))
+	}
+
+	if err := database.EmailQueue.Retry(ctx, email.ID, now); err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	if err := database.EmailQueue.Retry(ctx, email.ID, now); err != ErrQueuedEmailNotFound {
+		t.Errorf("Retry of a pending email = %v, want ErrQueuedEmailNotFound", err)
+	}
+	got, _ = database.EmailQueue.GetByID(ctx, email.ID)
+	if got.Status != EmailPending || got.Attempts != 0 {
+		t.Errorf("Expected a fresh pending email, got %+v", got)
+	}
+
+	if err := database.EmailQueue.MarkSent(ctx, email.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := database.EmailQueue.CountByStatus(ctx, EmailSent); count != 1 {
+		t.Errorf("Expected one sent email, got %d", count)
+	}
+	if removed, _ := database.EmailQueue.DeleteSentBefore(ctx, now.Add(-time.Hour)); removed != 0 {
+		t.Errorf("Removed %d recently sent emails", removed)
+	}
+	if removed, _ := database.EmailQueue.DeleteSentBefore(ctx, now.Add(time.Hour)); removed != 1 {
+		t.Errorf("Expected the sent email removed, got %d", removed)
+	}
+	if err := database.EmailQueue.Delete(ctx, email.ID); err != ErrQueuedEmailNotFound {
+		t.Errorf("Delete of a removed email = %v, want ErrQueuedEmailNotFound", err)
+	}
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrEscalationPolicyNotFound = errors.New("escalation policy not found")
+
+// EscalationPolicyRepository handles database operations for escalation policies
+type EscalationPolicyRepository struct {
+	db *sql.DB
+}
+
+// NewEscalationPolicyRepository creates a new EscalationPolicyRepository
+func NewEscalationPolicyRepository(db *sql.DB) *EscalationPolicyRepository {
+	return &EscalationPolicyRepository{db: db}
+}
+
+const escalationPolicyColumns = `id, name, levels, repeat, created_at, updated_at`
+
+func scanEscalationPolicy(row rowScanner) (*models.EscalationPolicy, error) {
+	p := &models.EscalationPolicy{}
+	var levels []byte
+	if err := row.Scan(&p.ID, &p.Name, &levels, &p.Repeat, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(levels, &p.Levels); err != nil {
+		return nil, err
+	}
+	if p.Levels == nil {
+		p.Levels = []models.EscalationLevel{}
+	}
+	return p, nil
+}
+
+// Create inserts a new escalation policy
+func (r *EscalationPolicyRepository) Create(ctx context.Context, p *models.EscalationPolicy) error {
+	levels, err := marshalEscalationLevels(p.Levels)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO escalation_policies (name, levels, repeat, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
+	`, p.Name, levels, p.Repeat, now, now).Scan(&p.ID); err != nil {
+		return err
+	}
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	return nil
+}
+
+// GetByID retrieves an escalation policy by ID
+func (r *EscalationPolicyRepository) GetByID(ctx context.Context, id int64) (*models.EscalationPolicy, error) {
+	p, err := scanEscalationPolicy(r.db.QueryRowContext(ctx, `
+		SELECT `+escalationPolicyColumns+` FROM escalation_policies WHERE id = ?
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrEscalationPolicyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// List returns all escalation policies in creation order
+func (r *EscalationPolicyRepository) List(ctx context.Context) ([]*models.EscalationPolicy, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+escalationPolicyColumns+` FROM escalation_policies ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []*models.EscalationPolicy
+	for rows.Next() {
+		p, err := scanEscalationPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+// Update updates a policy's name, levels and repeat count
+func (r *EscalationPolicyRepository) Update(ctx context.Context, p *models.EscalationPolicy) error {
+	levels, err := marshalEscalationLevels(p.Levels)
+	if err != nil {
+		return err
+	}
+
+	p.UpdatedAt = time.Now()
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE escalation_policies SET name = ?, levels = ?, repeat = ?, updated_at = ?
+		WHERE id = ?
+	`, p.Name, levels, p.Repeat, p.UpdatedAt, p.ID)
+	return err
+}
+
+// Delete removes an escalation policy
+func (r *EscalationPolicyRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM escalation_policies WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrEscalationPolicyNotFound
+	}
+	return nil
+}
+
+// marshalEscalationLevels encodes a policy's levels, storing nil as an empty array
+func marshalEscalationLevels(levels []models.EscalationLevel) ([]byte, error) {
+	if levels == nil {
+		levels = []models.EscalationLevel{}
+	}
+	return json.Marshal(levels)
+}
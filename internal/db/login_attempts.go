@@ -0,0 +1,155 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// Login lockout scopes
+const (
+	LockoutScopeIP      = "ip"
+	LockoutScopeAccount = "account"
+)
+
+// Login attempt failure reasons
+const (
+	LoginReasonInvalidCredentials = "invalid_credentials"
+	LoginReasonLockedOut          = "locked_out"
+)
+
+// loginAttemptColumns is the column list shared by all login attempt queries
+const loginAttemptColumns = `id, email, ip_address, user_agent, success, reason, created_at`
+
+// loginLockoutColumns is the column list shared by all login lockout queries
+const loginLockoutColumns = `scope, key, failures, lockouts, locked_until, last_failure_at`
+
+// LoginAttemptRepository handles database operations for sign-in history and lockouts
+type LoginAttemptRepository struct {
+	db *sql.DB
+}
+
+// NewLoginAttemptRepository creates a new LoginAttemptRepository
+func NewLoginAttemptRepository(db *sql.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+// Record adds a sign-in attempt to the history
+func (r *LoginAttemptRepository) Record(ctx context.Context, a *models.LoginAttempt) error {
+	a.CreatedAt = time.Now()
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO login_attempts (email, ip_address, user_agent, success, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, a.Email, a.IPAddress, a.UserAgent, a.Success, a.Reason, a.CreatedAt).Scan(&a.ID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// List returns sign-in attempts, newest first, optionally only failures
+func (r *LoginAttemptRepository) List(ctx context.Context, failuresOnly bool, limit, offset int) ([]*models.LoginAttempt, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+loginAttemptColumns+` FROM login_attempts
+		WHERE (? = FALSE OR success = FALSE)
+		ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?
+	`, failuresOnly, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []*models.LoginAttempt
+	for rows.Next() {
+		a := &models.LoginAttempt{}
+		if err := rows.Scan(&a.ID, &a.Email, &a.IPAddress, &a.UserAgent, &a.Success, &a.Reason, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// Count returns the number of sign-in attempts, optionally only failures
+func (r *LoginAttemptRepository) Count(ctx context.Context, failuresOnly bool) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM login_attempts WHERE (? = FALSE OR success = FALSE)
+	`, failuresOnly).Scan(&count)
+	return count, err
+}
+
+// DeleteOlderThan prunes sign-in history recorded before cutoff
+func (r *LoginAttemptRepository) DeleteOlderThan(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE created_at < ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func scanLoginLockout(row rowScanner) (*models.LoginLockout, error) {
+	l := &models.LoginLockout{}
+	if err := row.Scan(&l.Scope, &l.Key, &l.Failures, &l.Lockouts, &l.LockedUntil, &l.LastFailureAt); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// GetLockout returns the failure counters of an IP address or account, or
+// nil when it has no recent failures
+func (r *LoginAttemptRepository) GetLockout(ctx context.Context, scope, key string) (*models.LoginLockout, error) {
+	l, err := scanLoginLockout(r.db.QueryRowContext(ctx, `
+		SELECT `+loginLockoutColumns+` FROM login_lockouts WHERE scope = ? AND key = ?
+	`, scope, key))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return l, err
+}
+
+// SaveLockout creates or replaces failure counters
+func (r *LoginAttemptRepository) SaveLockout(ctx context.Context, l *models.LoginLockout) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO login_lockouts (`+loginLockoutColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(scope, key) DO UPDATE SET failures = excluded.failures, lockouts = excluded.lockouts,
+			locked_until = excluded.locked_until, last_failure_at = excluded.last_failure_at
+	`, l.Scope, l.Key, l.Failures, l.Lockouts, l.LockedUntil, l.LastFailureAt)
+	return err
+}
+
+// ClearLockout resets the failure counters of an IP address or account,
+// reporting whether it had any
+func (r *LoginAttemptRepository) ClearLockout(ctx context.Context, scope, key string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM login_lockouts WHERE scope = ? AND key = ?`, scope, key)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// ListLocked returns the IP addresses and accounts locked out at now
+func (r *LoginAttemptRepository) ListLocked(ctx context.Context, now time.Time) ([]*models.LoginLockout, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+loginLockoutColumns+` FROM login_lockouts
+		WHERE locked_until > ? ORDER BY locked_until DESC
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lockouts []*models.LoginLockout
+	for rows.Next() {
+		l, err := scanLoginLockout(rows)
+		if err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, l)
+	}
+	return lockouts, rows.Err()
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestLoginAttemptRepository_ListFailures(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	for _, a := range []*models.LoginAttempt{
+		{Email: "alice@example.com", IPAddress: "10.0.0.1", Success: true},
+		{Email: "alice@example.com", IPAddress: "10.0.0.2", Reason: LoginReasonInvalidCredentials},
+		{Email: "bob@example.com", IPAddress: "10.0.0.2", Reason: LoginReasonLockedOut},
+	} {
+		if err := db.LoginAttempts.Record(ctx, a); err != nil {
+			t.Fatalf("Failed to record login attempt: %v", err)
+		}
+	}
+
+	failures, err := db.LoginAttempts.List(ctx, true, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list login attempts: %v", err)
+	}
+	if len(failures) != 2 || failures[0].Email != "bob@example.com" {
+		t.Errorf("Expected 2 failures newest first, got %+v", failures)
+	}
+
+	if count, _ := db.LoginAttempts.Count(ctx, false); count != 3 {
+		t.Errorf("Expected 3 attempts, got %d", count)
+	}
+
+	deleted, err := db.LoginAttempts.DeleteOlderThan(ctx, time.Now().Add(time.Minute))
+	if err != nil || deleted != 3 {
+		t.Errorf("Expected 3 attempts pruned, got %d (%v)", deleted, err)
+	}
+}
+
+func TestLoginAttemptRepository_Lockouts(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	now := time.Now()
+	until := now.Add(time.Hour)
+
+	if l, err := db.LoginAttempts.GetLockout(ctx, LockoutScopeIP, "10.0.0.1"); err != nil || l != nil {
+		t.Fatalf("Expected no lockout, got %+v (%v)", l, err)
+	}
+
+	locked := &models.LoginLockout{Scope: LockoutScopeAccount, Key: "alice@example.com", Lockouts: 1, LockedUntil: &until, LastFailureAt: now}
+	counting := &models.LoginLockout{Scope: LockoutScopeIP, Key: "10.0.0.1", Failures: 2, LastFailureAt: now}
+	for _, l := range []*models.LoginLockout{locked, counting} {
+		if err := db.LoginAttempts.SaveLockout(ctx, l); err != nil {
+			t.Fatalf("Failed to save lockout: %v", err)
+		}
+	}
+
+	counting.Failures = 3
+	if err := db.LoginAttempts.SaveLockout(ctx, counting); err != nil {
+		t.Fatalf("Failed to update lockout: %v", err)
+	}
+	got, err := db.LoginAttempts.GetLockout(ctx, LockoutScopeIP, "10.0.0.1")
+	if err != nil || got == nil || got.Failures != 3 || got.LockedUntil != nil {
+		t.Errorf("Unexpected lockout %+v (%v)", got, err)
+	}
+
+	list, err := db.LoginAttempts.ListLocked(ctx, now)
+	if err != nil {
+		t.Fatalf("Failed to list lockouts: %v", err)
+	}
+	if len(list) != 1 || list[0].Key != "alice@example.com" {
+		t.Errorf("Expected only the locked account, got %+v", list)
+	}
+
+	if cleared, _ := db.LoginAttempts.ClearLockout(ctx, LockoutScopeAccount, "alice@example.com"); !cleared {
+		t.Error("Expected lockout to be cleared")
+	}
+	if cleared, _ := db.LoginAttempts.ClearLockout(ctx, LockoutScopeAccount, "alice@example.com"); cleared {
+		t.Error("Expected nothing left to clear")
+	}
+}
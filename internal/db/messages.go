@@ -6,6 +6,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/btafoya/gosip/internal/channels"
 	"github.com/btafoya/gosip/internal/models"
 )
 
@@ -21,85 +22,91 @@ func NewMessageRepository(db *sql.DB) *MessageRepository {
 	return &MessageRepository{db: db}
 }
 
-// Create inserts a new message
-func (r *MessageRepository) Create(ctx context.Context, msg *models.Message) error {
-	result, err := r.db.ExecContext(ctx, `
-		INSERT INTO messages (message_sid, direction, from_number, to_number, did_id, body, media_urls, status, created_at, is_read)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, msg.MessageSID, msg.Direction, msg.FromNumber, msg.ToNumber, msg.DIDID, msg.Body, msg.MediaURLs, msg.Status, time.Now(), msg.IsRead)
-	if err != nil {
-		return err
+// messageColumns is the column list shared by all message queries
+const messageColumns = `id, message_sid, direction, from_number, to_number, did_id, body, media_urls, status, created_at, is_read, channel, estimated_cost, actual_cost, error_code, error_message, tenant_id`
+
+// scanMessage scans a single message row selected with messageColumns
+func scanMessage(row rowScanner) (*models.Message, error) {
+	msg := &models.Message{}
+	var didID, errorCode sql.NullInt64
+	var messageSID, body, status sql.NullString
+	var mediaURLs []byte
+	if err := row.Scan(&msg.ID, &messageSID, &msg.Direction, &msg.FromNumber, &msg.ToNumber, &didID, &body, &mediaURLs, &status, &msg.CreatedAt, &msg.IsRead, &msg.Channel, &msg.EstimatedCost, &msg.ActualCost, &errorCode, &msg.ErrorMessage, &msg.TenantID); err != nil {
+		return nil, err
+	}
+	if didID.Valid {
+		msg.DIDID = &didID.Int64
+	}
+	msg.MessageSID = messageSID.String
+	msg.Body = body.String
+	msg.Status = status.String
+	msg.MediaURLs = mediaURLs
+	if errorCode.Valid {
+		code := int(errorCode.Int64)
+		msg.ErrorCode = &code
 	}
+	return msg, nil
+}
 
-	id, err := result.LastInsertId()
+// list runs a message query and scans every returned row
+func (r *MessageRepository) list(ctx context.Context, query string, args ...interface{}) ([]*models.Message, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []*models.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, rows.Err()
+}
+
+// Create inserts a new message under the tenant of its DID
+func (r *MessageRepository) Create(ctx context.Context, msg *models.Message) error {
+	if msg.Channel == "" {
+		msg.Channel = channels.SMS
+	}
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO messages (message_sid, direction, from_number, to_number, did_id, body, media_urls, status, created_at, is_read, channel, tenant_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, (SELECT tenant_id FROM dids WHERE id = ?))
+		RETURNING id, tenant_id
+	`, msg.MessageSID, msg.Direction, msg.FromNumber, msg.ToNumber, msg.DIDID, msg.Body, msg.MediaURLs, msg.Status, time.Now(), msg.IsRead, msg.Channel, msg.DIDID).Scan(&msg.ID, &msg.TenantID); err != nil {
 		return err
 	}
-	msg.ID = id
 	return nil
 }
 
 // GetByID retrieves a message by ID
 func (r *MessageRepository) GetByID(ctx context.Context, id int64) (*models.Message, error) {
-	msg := &models.Message{}
-	var didID sql.NullInt64
-	var messageSID, body, status sql.NullString
-	var mediaURLs []byte
-	err := r.db.QueryRowContext(ctx, `
-		SELECT id, message_sid, direction, from_number, to_number, did_id, body, media_urls, status, created_at, is_read
-		FROM messages WHERE id = ?
-	`, id).Scan(&msg.ID, &messageSID, &msg.Direction, &msg.FromNumber, &msg.ToNumber, &didID, &body, &mediaURLs, &status, &msg.CreatedAt, &msg.IsRead)
+	msg, err := scanMessage(r.db.QueryRowContext(ctx, `
+		SELECT `+messageColumns+` FROM messages WHERE id = ?
+	`, id))
 	if err == sql.ErrNoRows {
 		return nil, ErrMessageNotFound
 	}
 	if err != nil {
 		return nil, err
 	}
-	if didID.Valid {
-		msg.DIDID = &didID.Int64
-	}
-	if messageSID.Valid {
-		msg.MessageSID = messageSID.String
-	}
-	if body.Valid {
-		msg.Body = body.String
-	}
-	if status.Valid {
-		msg.Status = status.String
-	}
-	msg.MediaURLs = mediaURLs
 	return msg, nil
 }
 
 // GetByMessageSID retrieves a message by Twilio Message SID
 func (r *MessageRepository) GetByMessageSID(ctx context.Context, msgSID string) (*models.Message, error) {
-	msg := &models.Message{}
-	var didID sql.NullInt64
-	var messageSID, body, status sql.NullString
-	var mediaURLs []byte
-	err := r.db.QueryRowContext(ctx, `
-		SELECT id, message_sid, direction, from_number, to_number, did_id, body, media_urls, status, created_at, is_read
-		FROM messages WHERE message_sid = ?
-	`, msgSID).Scan(&msg.ID, &messageSID, &msg.Direction, &msg.FromNumber, &msg.ToNumber, &didID, &body, &mediaURLs, &status, &msg.CreatedAt, &msg.IsRead)
+	msg, err := scanMessage(r.db.QueryRowContext(ctx, `
+		SELECT `+messageColumns+` FROM messages WHERE message_sid = ?
+	`, msgSID))
 	if err == sql.ErrNoRows {
 		return nil, ErrMessageNotFound
 	}
 	if err != nil {
 		return nil, err
 	}
-	if didID.Valid {
-		msg.DIDID = &didID.Int64
-	}
-	if messageSID.Valid {
-		msg.MessageSID = messageSID.String
-	}
-	if body.Valid {
-		msg.Body = body.String
-	}
-	if status.Valid {
-		msg.Status = status.String
-	}
-	msg.MediaURLs = mediaURLs
 	return msg, nil
 }
 
@@ -107,9 +114,11 @@ func (r *MessageRepository) GetByMessageSID(ctx context.Context, msgSID string)
 func (r *MessageRepository) Update(ctx context.Context, msg *models.Message) error {
 	_, err := r.db.ExecContext(ctx, `
 		UPDATE messages SET message_sid = ?, direction = ?, from_number = ?, to_number = ?,
-		did_id = ?, body = ?, media_urls = ?, status = ?, is_read = ?
+		did_id = ?, body = ?, media_urls = ?, status = ?, is_read = ?, channel = ?,
+		error_code = ?, error_message = ?
 		WHERE id = ?
-	`, msg.MessageSID, msg.Direction, msg.FromNumber, msg.ToNumber, msg.DIDID, msg.Body, msg.MediaURLs, msg.Status, msg.IsRead, msg.ID)
+	`, msg.MessageSID, msg.Direction, msg.FromNumber, msg.ToNumber, msg.DIDID, msg.Body, msg.MediaURLs, msg.Status, msg.IsRead, msg.Channel,
+		msg.ErrorCode, msg.ErrorMessage, msg.ID)
 	return err
 }
 
@@ -119,6 +128,50 @@ func (r *MessageRepository) UpdateStatus(ctx context.Context, id int64, status s
 	return err
 }
 
+// UpdateStatusWithError updates the status of a message along with the
+// error that failed it. A nil code and empty message clear the error.
+func (r *MessageRepository) UpdateStatusWithError(ctx context.Context, id int64, status string, code *int, message string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE messages SET status = ?, error_code = ?, error_message = ? WHERE id = ?`, status, code, message, id)
+	return err
+}
+
+// SetEstimatedCost records the rate table cost of a message; nil clears it
+func (r *MessageRepository) SetEstimatedCost(ctx context.Context, id int64, cost *float64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE messages SET estimated_cost = ? WHERE id = ?`, cost, id)
+	return err
+}
+
+// SetActualCost records what Twilio charged for a message
+func (r *MessageRepository) SetActualCost(ctx context.Context, id int64, cost float64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE messages SET actual_cost = ? WHERE id = ?`, cost, id)
+	return err
+}
+
+// ListUnreconciled returns outbound Twilio messages created in [start, end)
+// without Twilio's price, oldest first
+func (r *MessageRepository) ListUnreconciled(ctx context.Context, start, end time.Time, limit int) ([]*models.Message, error) {
+	return r.list(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE direction = 'outbound' AND message_sid != '' AND actual_cost IS NULL
+		AND created_at >= ? AND created_at < ?
+		ORDER BY created_at ASC, id ASC
+		LIMIT ?
+	`, start, end, limit)
+}
+
+// CostTotals sums the costs of outbound messages created in [start, end)
+func (r *MessageRepository) CostTotals(ctx context.Context, start, end time.Time) (models.CostTotals, error) {
+	var totals models.CostTotals
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(estimated_cost), 0), COALESCE(SUM(actual_cost), 0),
+		COUNT(*) - COUNT(estimated_cost), COUNT(actual_cost)
+		FROM messages
+		WHERE direction = 'outbound' AND message_sid != '' AND created_at >= ? AND created_at < ?
+	`, start, end).Scan(&totals.Count, &totals.EstimatedCost, &totals.ActualCost, &totals.Unrated, &totals.Reconciled)
+	return totals, err
+}
+
 // Delete removes a message
 func (r *MessageRepository) Delete(ctx context.Context, id int64) error {
 	_, err := r.db.ExecContext(ctx, `DELETE FROM messages WHERE id = ?`, id)
@@ -127,168 +180,68 @@ func (r *MessageRepository) Delete(ctx context.Context, id int64) error {
 
 // MarkAsRead marks a message as read
 func (r *MessageRepository) MarkAsRead(ctx context.Context, id int64) error {
-	_, err := r.db.ExecContext(ctx, `UPDATE messages SET is_read = 1 WHERE id = ?`, id)
+	_, err := r.db.ExecContext(ctx, `UPDATE messages SET is_read = TRUE WHERE id = ?`, id)
 	return err
 }
 
 // List returns messages with pagination
 func (r *MessageRepository) List(ctx context.Context, limit, offset int) ([]*models.Message, error) {
-	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, message_sid, direction, from_number, to_number, did_id, body, media_urls, status, created_at, is_read
+	return r.list(ctx, `
+		SELECT `+messageColumns+`
 		FROM messages ORDER BY created_at DESC LIMIT ? OFFSET ?
 	`, limit, offset)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var msgs []*models.Message
-	for rows.Next() {
-		msg := &models.Message{}
-		var didID sql.NullInt64
-		var messageSID, body, status sql.NullString
-		var mediaURLs []byte
-		if err := rows.Scan(&msg.ID, &messageSID, &msg.Direction, &msg.FromNumber, &msg.ToNumber, &didID, &body, &mediaURLs, &status, &msg.CreatedAt, &msg.IsRead); err != nil {
-			return nil, err
-		}
-		if didID.Valid {
-			msg.DIDID = &didID.Int64
-		}
-		if messageSID.Valid {
-			msg.MessageSID = messageSID.String
-		}
-		if body.Valid {
-			msg.Body = body.String
-		}
-		if status.Valid {
-			msg.Status = status.String
-		}
-		msg.MediaURLs = mediaURLs
-		msgs = append(msgs, msg)
-	}
-	return msgs, rows.Err()
 }
 
 // ListByDID returns messages for a specific DID
 func (r *MessageRepository) ListByDID(ctx context.Context, didID int64, limit, offset int) ([]*models.Message, error) {
-	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, message_sid, direction, from_number, to_number, did_id, body, media_urls, status, created_at, is_read
+	return r.list(ctx, `
+		SELECT `+messageColumns+`
 		FROM messages WHERE did_id = ? ORDER BY created_at DESC LIMIT ? OFFSET ?
 	`, didID, limit, offset)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var msgs []*models.Message
-	for rows.Next() {
-		msg := &models.Message{}
-		var nullDIDID sql.NullInt64
-		var messageSID, body, status sql.NullString
-		var mediaURLs []byte
-		if err := rows.Scan(&msg.ID, &messageSID, &msg.Direction, &msg.FromNumber, &msg.ToNumber, &nullDIDID, &body, &mediaURLs, &status, &msg.CreatedAt, &msg.IsRead); err != nil {
-			return nil, err
-		}
-		if nullDIDID.Valid {
-			msg.DIDID = &nullDIDID.Int64
-		}
-		if messageSID.Valid {
-			msg.MessageSID = messageSID.String
-		}
-		if body.Valid {
-			msg.Body = body.String
-		}
-		if status.Valid {
-			msg.Status = status.String
-		}
-		msg.MediaURLs = mediaURLs
-		msgs = append(msgs, msg)
-	}
-	return msgs, rows.Err()
 }
 
 // GetConversation returns messages between a DID and a specific phone number (threaded view)
 func (r *MessageRepository) GetConversation(ctx context.Context, didID int64, phoneNumber string, limit, offset int) ([]*models.Message, error) {
-	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, message_sid, direction, from_number, to_number, did_id, body, media_urls, status, created_at, is_read
+	return r.list(ctx, `
+		SELECT `+messageColumns+`
 		FROM messages
 		WHERE did_id = ? AND (from_number = ? OR to_number = ?)
 		ORDER BY created_at DESC LIMIT ? OFFSET ?
 	`, didID, phoneNumber, phoneNumber, limit, offset)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+}
 
-	var msgs []*models.Message
-	for rows.Next() {
-		msg := &models.Message{}
-		var nullDIDID sql.NullInt64
-		var messageSID, body, status sql.NullString
-		var mediaURLs []byte
-		if err := rows.Scan(&msg.ID, &messageSID, &msg.Direction, &msg.FromNumber, &msg.ToNumber, &nullDIDID, &body, &mediaURLs, &status, &msg.CreatedAt, &msg.IsRead); err != nil {
-			return nil, err
-		}
-		if nullDIDID.Valid {
-			msg.DIDID = &nullDIDID.Int64
-		}
-		if messageSID.Valid {
-			msg.MessageSID = messageSID.String
-		}
-		if body.Valid {
-			msg.Body = body.String
-		}
-		if status.Valid {
-			msg.Status = status.String
-		}
-		msg.MediaURLs = mediaURLs
-		msgs = append(msgs, msg)
-	}
-	return msgs, rows.Err()
+// ListConversation returns every message in a conversation, oldest first
+func (r *MessageRepository) ListConversation(ctx context.Context, didID int64, phoneNumber string) ([]*models.Message, error) {
+	return r.list(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE did_id = ? AND (from_number = ? OR to_number = ?)
+		ORDER BY created_at ASC, id ASC
+	`, didID, phoneNumber, phoneNumber)
+}
+
+// ListBetween returns the messages created in [start, end), oldest first
+func (r *MessageRepository) ListBetween(ctx context.Context, start, end time.Time) ([]*models.Message, error) {
+	return r.list(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE created_at >= ? AND created_at < ?
+		ORDER BY created_at ASC, id ASC
+	`, start, end)
 }
 
 // ListUnread returns unread messages
 func (r *MessageRepository) ListUnread(ctx context.Context) ([]*models.Message, error) {
-	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, message_sid, direction, from_number, to_number, did_id, body, media_urls, status, created_at, is_read
-		FROM messages WHERE is_read = 0 ORDER BY created_at DESC
+	return r.list(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages WHERE is_read = FALSE ORDER BY created_at DESC
 	`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var msgs []*models.Message
-	for rows.Next() {
-		msg := &models.Message{}
-		var didID sql.NullInt64
-		var messageSID, body, status sql.NullString
-		var mediaURLs []byte
-		if err := rows.Scan(&msg.ID, &messageSID, &msg.Direction, &msg.FromNumber, &msg.ToNumber, &didID, &body, &mediaURLs, &status, &msg.CreatedAt, &msg.IsRead); err != nil {
-			return nil, err
-		}
-		if didID.Valid {
-			msg.DIDID = &didID.Int64
-		}
-		if messageSID.Valid {
-			msg.MessageSID = messageSID.String
-		}
-		if body.Valid {
-			msg.Body = body.String
-		}
-		if status.Valid {
-			msg.Status = status.String
-		}
-		msg.MediaURLs = mediaURLs
-		msgs = append(msgs, msg)
-	}
-	return msgs, rows.Err()
 }
 
 // CountUnread returns the count of unread messages
 func (r *MessageRepository) CountUnread(ctx context.Context) (int, error) {
 	var count int
-	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM messages WHERE is_read = 0`).Scan(&count)
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM messages WHERE is_read = FALSE`).Scan(&count)
 	return count, err
 }
 
@@ -299,6 +252,13 @@ func (r *MessageRepository) Count(ctx context.Context) (int, error) {
 	return count, err
 }
 
+// CountSince returns the count of messages created at or after the given time
+func (r *MessageRepository) CountSince(ctx context.Context, since time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM messages WHERE created_at >= ?`, since).Scan(&count)
+	return count, err
+}
+
 // CountByDID returns the count of messages for a specific DID
 func (r *MessageRepository) CountByDID(ctx context.Context, didID int64) (int, error) {
 	var count int
@@ -320,92 +280,107 @@ func (r *MessageRepository) CountByRemoteNumber(ctx context.Context, remoteNumbe
 	return count, err
 }
 
+// MessageFilter narrows a tenant's message list; zero fields don't filter
+type MessageFilter struct {
+	DIDID        *int64
+	Direction    string
+	RemoteNumber string // Messages from or to this number
+	Channel      string
+}
+
+// tenantWhere builds the WHERE clause selecting a tenant's messages that
+// match the filter
+func (f MessageFilter) tenantWhere(tenantID int64) (string, []interface{}) {
+	where := "tenant_id = ?"
+	args := []interface{}{tenantID}
+	if f.DIDID != nil {
+		where += " AND did_id = ?"
+		args = append(args, *f.DIDID)
+	}
+	if f.Direction != "" {
+		where += " AND direction = ?"
+		args = append(args, f.Direction)
+	}
+	if f.RemoteNumber != "" {
+		where += " AND (from_number = ? OR to_number = ?)"
+		args = append(args, f.RemoteNumber, f.RemoteNumber)
+	}
+	if f.Channel != "" {
+		where += " AND channel = ?"
+		args = append(args, f.Channel)
+	}
+	return where, args
+}
+
+// ListByTenant returns a tenant's messages, newest first
+func (r *MessageRepository) ListByTenant(ctx context.Context, tenantID int64, filter MessageFilter, limit, offset int) ([]*models.Message, error) {
+	where, args := filter.tenantWhere(tenantID)
+	return r.list(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages WHERE `+where+` ORDER BY created_at DESC LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+}
+
+// CountByTenant returns the number of a tenant's messages matching the filter
+func (r *MessageRepository) CountByTenant(ctx context.Context, tenantID int64, filter MessageFilter) (int, error) {
+	where, args := filter.tenantWhere(tenantID)
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM messages WHERE `+where, args...).Scan(&count)
+	return count, err
+}
+
 // ListByDirection returns messages with a specific direction with pagination
 func (r *MessageRepository) ListByDirection(ctx context.Context, direction string, limit, offset int) ([]*models.Message, error) {
-	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, message_sid, direction, from_number, to_number, did_id, body, media_urls, status, created_at, is_read
+	return r.list(ctx, `
+		SELECT `+messageColumns+`
 		FROM messages WHERE direction = ? ORDER BY created_at DESC LIMIT ? OFFSET ?
 	`, direction, limit, offset)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var msgs []*models.Message
-	for rows.Next() {
-		msg := &models.Message{}
-		var didID sql.NullInt64
-		var messageSID, body, status sql.NullString
-		var mediaURLs []byte
-		if err := rows.Scan(&msg.ID, &messageSID, &msg.Direction, &msg.FromNumber, &msg.ToNumber, &didID, &body, &mediaURLs, &status, &msg.CreatedAt, &msg.IsRead); err != nil {
-			return nil, err
-		}
-		if didID.Valid {
-			msg.DIDID = &didID.Int64
-		}
-		if messageSID.Valid {
-			msg.MessageSID = messageSID.String
-		}
-		if body.Valid {
-			msg.Body = body.String
-		}
-		if status.Valid {
-			msg.Status = status.String
-		}
-		msg.MediaURLs = mediaURLs
-		msgs = append(msgs, msg)
-	}
-	return msgs, rows.Err()
 }
 
 // ListByRemoteNumber returns messages with a specific remote number with pagination
 func (r *MessageRepository) ListByRemoteNumber(ctx context.Context, remoteNumber string, limit, offset int) ([]*models.Message, error) {
-	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, message_sid, direction, from_number, to_number, did_id, body, media_urls, status, created_at, is_read
+	return r.list(ctx, `
+		SELECT `+messageColumns+`
 		FROM messages WHERE from_number = ? OR to_number = ? ORDER BY created_at DESC LIMIT ? OFFSET ?
 	`, remoteNumber, remoteNumber, limit, offset)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+}
 
-	var msgs []*models.Message
-	for rows.Next() {
-		msg := &models.Message{}
-		var didID sql.NullInt64
-		var messageSID, body, status sql.NullString
-		var mediaURLs []byte
-		if err := rows.Scan(&msg.ID, &messageSID, &msg.Direction, &msg.FromNumber, &msg.ToNumber, &didID, &body, &mediaURLs, &status, &msg.CreatedAt, &msg.IsRead); err != nil {
-			return nil, err
-		}
-		if didID.Valid {
-			msg.DIDID = &didID.Int64
-		}
-		if messageSID.Valid {
-			msg.MessageSID = messageSID.String
-		}
-		if body.Valid {
-			msg.Body = body.String
-		}
-		if status.Valid {
-			msg.Status = status.String
-		}
-		msg.MediaURLs = mediaURLs
-		msgs = append(msgs, msg)
-	}
-	return msgs, rows.Err()
+// ListByChannel returns messages sent or received on a channel with pagination
+func (r *MessageRepository) ListByChannel(ctx context.Context, channel string, limit, offset int) ([]*models.Message, error) {
+	return r.list(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages WHERE channel = ? ORDER BY created_at DESC LIMIT ? OFFSET ?
+	`, channel, limit, offset)
+}
+
+// CountByChannel returns the count of messages on a channel
+func (r *MessageRepository) CountByChannel(ctx context.Context, channel string) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM messages WHERE channel = ?`, channel).Scan(&count)
+	return count, err
 }
 
 // MarkConversationAsRead marks all inbound messages in a conversation as read
 func (r *MessageRepository) MarkConversationAsRead(ctx context.Context, didID int64, remoteNumber string) error {
 	_, err := r.db.ExecContext(ctx, `
-		UPDATE messages SET is_read = 1
-		WHERE did_id = ? AND direction = 'inbound' AND is_read = 0
+		UPDATE messages SET is_read = TRUE
+		WHERE did_id = ? AND direction = 'inbound' AND is_read = FALSE
 		AND (from_number = ? OR to_number = ?)
 	`, didID, remoteNumber, remoteNumber)
 	return err
 }
 
+// ListUnreadInConversation returns the unread inbound messages in a conversation
+func (r *MessageRepository) ListUnreadInConversation(ctx context.Context, didID int64, remoteNumber string) ([]*models.Message, error) {
+	return r.list(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE did_id = ? AND direction = 'inbound' AND is_read = FALSE
+		AND (from_number = ? OR to_number = ?)
+		ORDER BY created_at ASC
+	`, didID, remoteNumber, remoteNumber)
+}
+
 // UpdateStatusByMessageSID updates the status of a message by its Twilio Message SID
 func (r *MessageRepository) UpdateStatusByMessageSID(ctx context.Context, messageSID string, status string) error {
 	_, err := r.db.ExecContext(ctx, `UPDATE messages SET status = ? WHERE message_sid = ?`, status, messageSID)
@@ -439,7 +414,7 @@ func (r *MessageRepository) GetStats(ctx context.Context) (map[string]interface{
 
 	// Unread count
 	var unread int
-	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM messages WHERE is_read = 0 AND direction = 'inbound'`).Scan(&unread); err != nil {
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM messages WHERE is_read = FALSE AND direction = 'inbound'`).Scan(&unread); err != nil {
 		return nil, err
 	}
 	stats["unread"] = unread
@@ -451,27 +426,53 @@ func (r *MessageRepository) GetStats(ctx context.Context) (map[string]interface{
 	}
 	stats["failed"] = failed
 
+	// Days and months start at midnight UTC. Times are passed in local time
+	// like the stored timestamps, so SQLite compares them as text correctly.
+	now := time.Now().UTC()
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	startOfMonth := startOfDay.AddDate(0, 0, 1-now.Day())
+
 	// Today's messages
 	var today int
-	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM messages WHERE date(created_at) = date('now')`).Scan(&today); err != nil {
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM messages WHERE created_at >= ?`, startOfDay.Local()).Scan(&today); err != nil {
 		return nil, err
 	}
 	stats["today"] = today
 
 	// This week's messages
 	var thisWeek int
-	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM messages WHERE created_at >= datetime('now', '-7 days')`).Scan(&thisWeek); err != nil {
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM messages WHERE created_at >= ?`, now.AddDate(0, 0, -7).Local()).Scan(&thisWeek); err != nil {
 		return nil, err
 	}
 	stats["this_week"] = thisWeek
 
 	// This month's messages
 	var thisMonth int
-	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM messages WHERE created_at >= datetime('now', 'start of month')`).Scan(&thisMonth); err != nil {
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM messages WHERE created_at >= ?`, startOfMonth.Local()).Scan(&thisMonth); err != nil {
 		return nil, err
 	}
 	stats["this_month"] = thisMonth
 
+	// Per-channel counts
+	rows, err := r.db.QueryContext(ctx, `SELECT channel, COUNT(*) FROM messages GROUP BY channel`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byChannel := make(map[string]int)
+	for rows.Next() {
+		var channel string
+		var count int
+		if err := rows.Scan(&channel, &count); err != nil {
+			return nil, err
+		}
+		byChannel[channel] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	stats["by_channel"] = byChannel
+
 	return stats, nil
 }
 
@@ -487,7 +488,7 @@ func (r *MessageRepository) GetConversationSummaries(ctx context.Context, didID
 				CASE WHEN direction = 'inbound' THEN from_number ELSE to_number END as phone_number,
 				MAX(created_at) as last_message_at,
 				COUNT(*) as message_count,
-				SUM(CASE WHEN is_read = 0 AND direction = 'inbound' THEN 1 ELSE 0 END) as unread_count
+				SUM(CASE WHEN is_read = FALSE AND direction = 'inbound' THEN 1 ELSE 0 END) as unread_count
 			FROM messages
 			WHERE did_id = ?
 			GROUP BY CASE WHEN direction = 'inbound' THEN from_number ELSE to_number END
@@ -499,7 +500,7 @@ func (r *MessageRepository) GetConversationSummaries(ctx context.Context, didID
 				CASE WHEN direction = 'inbound' THEN from_number ELSE to_number END as phone_number,
 				MAX(created_at) as last_message_at,
 				COUNT(*) as message_count,
-				SUM(CASE WHEN is_read = 0 AND direction = 'inbound' THEN 1 ELSE 0 END) as unread_count
+				SUM(CASE WHEN is_read = FALSE AND direction = 'inbound' THEN 1 ELSE 0 END) as unread_count
 			FROM messages
 			GROUP BY CASE WHEN direction = 'inbound' THEN from_number ELSE to_number END
 			ORDER BY last_message_at DESC
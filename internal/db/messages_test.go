@@ -492,3 +492,106 @@ func TestMessageRepository_GetConversationSummaries(t *testing.T) {
 		t.Errorf("Expected 2 conversation summaries, got %d", len(summaries))
 	}
 }
+
+func TestMessageRepository_ListUnreadInConversation(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	did := &models.DID{Number: "+15559876543", SMSEnabled: true}
+	if err := db.DIDs.Create(ctx, did); err != nil {
+		t.Fatalf("Failed to create DID: %v", err)
+	}
+
+	msgs := []*models.Message{
+		{Direction: "inbound", FromNumber: "+15551234567", ToNumber: did.Number, Body: "one", Status: "received"},
+		{Direction: "inbound", FromNumber: "+15551234567", ToNumber: did.Number, Body: "two", Status: "received", IsRead: true},
+		{Direction: "outbound", FromNumber: did.Number, ToNumber: "+15551234567", Body: "reply", Status: "sent"},
+		{Direction: "inbound", FromNumber: "+15550000000", ToNumber: did.Number, Body: "other", Status: "received"},
+	}
+	for i, msg := range msgs {
+		msg.MessageSID = "SM_CONV_" + string(rune('0'+i))
+		msg.DIDID = &did.ID
+		if err := db.Messages.Create(ctx, msg); err != nil {
+			t.Fatalf("Failed to create message: %v", err)
+		}
+	}
+
+	unread, err := db.Messages.ListUnreadInConversation(ctx, did.ID, "+15551234567")
+	if err != nil {
+		t.Fatalf("ListUnreadInConversation failed: %v", err)
+	}
+	if len(unread) != 1 || unread[0].ID != msgs[0].ID {
+		t.Errorf("Expected only the first message, got %d messages", len(unread))
+	}
+}
+
+func TestMessageRepository_ListConversation(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	did := &models.DID{Number: "+15559876543", SMSEnabled: true}
+	if err := db.DIDs.Create(ctx, did); err != nil {
+		t.Fatalf("Failed to create DID: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		msg := &models.Message{
+			MessageSID: "SM_EXPORT_" + string(rune('0'+i)),
+			DIDID:      &did.ID,
+			Direction:  "inbound",
+			FromNumber: "+15551234567",
+			ToNumber:   did.Number,
+			Body:       "Test",
+			Status:     "received",
+		}
+		if err := db.Messages.Create(ctx, msg); err != nil {
+			t.Fatalf("Failed to create message: %v", err)
+		}
+	}
+
+	msgs, err := db.Messages.ListConversation(ctx, did.ID, "+15551234567")
+	if err != nil {
+		t.Fatalf("ListConversation failed: %v", err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(msgs))
+	}
+	for i := 1; i < len(msgs); i++ {
+		if msgs[i].ID < msgs[i-1].ID {
+			t.Error("Expected messages oldest first")
+		}
+	}
+}
+
+func TestMessageRepository_ListByChannel(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	for i, channel := range []string{"", "whatsapp", "whatsapp"} {
+		msg := &models.Message{
+			MessageSID: "SM" + string(rune('A'+i)),
+			Direction:  "inbound",
+			FromNumber: "+15559876543",
+			ToNumber:   "+15551234567",
+			Body:       "Hello",
+			Status:     "received",
+			Channel:    channel,
+		}
+		if err := db.Messages.Create(ctx, msg); err != nil {
+			t.Fatalf("Failed to create message: %v", err)
+		}
+	}
+
+	msgs, err := db.Messages.ListByChannel(ctx, "whatsapp", 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list messages: %v", err)
+	}
+	if len(msgs) != 2 {
+		t.Errorf("Expected 2 WhatsApp messages, got %d", len(msgs))
+	}
+
+	count, _ := db.Messages.CountByChannel(ctx, "sms")
+	if count != 1 {
+		t.Errorf("Expected messages without a channel to default to sms, got %d", count)
+	}
+}
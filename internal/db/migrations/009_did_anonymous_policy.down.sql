@@ -0,0 +1,3 @@
+-- Migration 009 rollback: Remove per-DID anonymous caller policy
+DELETE FROM config WHERE key = 'anonymous_challenge_prompt';
+ALTER TABLE dids DROP COLUMN anonymous_action
@@ -0,0 +1,6 @@
+-- Migration 009: Per-DID anonymous caller policy
+-- allow: route normally, reject: refuse the call, challenge: ask the caller to record their name
+ALTER TABLE dids ADD COLUMN anonymous_action TEXT NOT NULL DEFAULT 'allow' CHECK(anonymous_action IN ('allow', 'reject', 'challenge'));
+
+-- Prompt played to anonymous callers when the challenge policy is active
+INSERT OR IGNORE INTO config (key, value, updated_at) VALUES ('anonymous_challenge_prompt', 'Please state your name after the tone.', datetime('now'))
@@ -0,0 +1,4 @@
+-- Migration 010 rollback: Remove voicemail greetings
+DELETE FROM config WHERE key = 'voicemail_greeting_feature_code';
+DROP INDEX IF EXISTS idx_voicemail_greetings_did;
+DROP TABLE IF EXISTS voicemail_greetings
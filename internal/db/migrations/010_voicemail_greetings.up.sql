@@ -0,0 +1,19 @@
+-- Migration 010: Per-mailbox voicemail greetings
+-- Voicemail boxes are keyed by DID, and each box holds one standard and one temporary greeting
+CREATE TABLE voicemail_greetings (
+    id INTEGER PRIMARY KEY,
+    did_id INTEGER NOT NULL REFERENCES dids(id) ON DELETE CASCADE,
+    greeting_type TEXT NOT NULL CHECK(greeting_type IN ('standard', 'temporary')),
+    audio_url TEXT NOT NULL,
+    duration INTEGER DEFAULT 0,
+    is_active BOOLEAN DEFAULT FALSE,
+    expires_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(did_id, greeting_type)
+);
+
+CREATE INDEX idx_voicemail_greetings_did ON voicemail_greetings(did_id);
+
+-- Feature code dialed from a registered device to manage greetings by phone
+INSERT OR IGNORE INTO config (key, value, updated_at) VALUES ('voicemail_greeting_feature_code', '*97', datetime('now'))
@@ -0,0 +1,4 @@
+-- Migration 011 rollback: Remove per-DID and per-user language
+DELETE FROM config WHERE key = 'default_language';
+ALTER TABLE users DROP COLUMN language;
+ALTER TABLE dids DROP COLUMN language
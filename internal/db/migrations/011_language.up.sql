@@ -0,0 +1,7 @@
+-- Migration 011: Per-DID and per-user language
+-- DIDs select the prompt set played to callers, users the language of API messages
+ALTER TABLE dids ADD COLUMN language TEXT NOT NULL DEFAULT '' CHECK(language IN ('', 'en', 'es', 'fr', 'de'));
+ALTER TABLE users ADD COLUMN language TEXT NOT NULL DEFAULT '' CHECK(language IN ('', 'en', 'es', 'fr', 'de'));
+
+-- Language used when a DID or user has none set
+INSERT OR IGNORE INTO config (key, value, updated_at) VALUES ('default_language', 'en', datetime('now'))
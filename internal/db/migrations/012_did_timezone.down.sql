@@ -0,0 +1,2 @@
+-- Migration 012 rollback: Remove per-DID timezone
+ALTER TABLE dids DROP COLUMN timezone
@@ -0,0 +1,3 @@
+-- Migration 012: Per-DID timezone for time-based routes
+-- Empty uses the system timezone setting
+ALTER TABLE dids ADD COLUMN timezone TEXT NOT NULL DEFAULT ''
@@ -0,0 +1,34 @@
+-- Migration 013 rollback: Remove LAN device auto-discovery
+DELETE FROM config WHERE key = 'discovery_enabled';
+
+CREATE TABLE device_events_old (
+    id INTEGER PRIMARY KEY,
+    device_id INTEGER REFERENCES devices(id) ON DELETE CASCADE,
+    event_type TEXT CHECK(event_type IN (
+        'config_fetch', 'config_fetch_failed',
+        'registration', 'registration_failed', 'unregistration',
+        'provision_start', 'provision_complete', 'provision_failed',
+        'call_start', 'call_end',
+        'firmware_check', 'firmware_update',
+        'error', 'warning', 'info'
+    )) NOT NULL,
+    event_data JSON,
+    ip_address TEXT,
+    user_agent TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO device_events_old (id, device_id, event_type, event_data, ip_address, user_agent, created_at)
+SELECT id, device_id, event_type, event_data, ip_address, user_agent, created_at FROM device_events WHERE event_type != 'discovered';
+
+DROP TABLE device_events;
+
+ALTER TABLE device_events_old RENAME TO device_events;
+
+CREATE INDEX idx_device_events_device ON device_events(device_id);
+CREATE INDEX idx_device_events_type ON device_events(event_type);
+CREATE INDEX idx_device_events_created ON device_events(created_at);
+
+DROP INDEX IF EXISTS idx_discovered_devices_ip;
+DROP INDEX IF EXISTS idx_discovered_devices_mac;
+DROP TABLE IF EXISTS discovered_devices
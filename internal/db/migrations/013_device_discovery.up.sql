@@ -0,0 +1,52 @@
+-- Migration 013: LAN device auto-discovery
+-- Phones found by the mDNS/SSDP scanner, keyed by MAC address when known and IP address otherwise
+CREATE TABLE discovered_devices (
+    id INTEGER PRIMARY KEY,
+    mac_address TEXT,
+    ip_address TEXT NOT NULL,
+    vendor TEXT,
+    model TEXT,
+    firmware_version TEXT,
+    source TEXT NOT NULL CHECK(source IN ('mdns', 'ssdp')),
+    banner TEXT,
+    device_id INTEGER REFERENCES devices(id) ON DELETE SET NULL,
+    first_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_seen DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_discovered_devices_mac ON discovered_devices(mac_address);
+CREATE INDEX idx_discovered_devices_ip ON discovered_devices(ip_address);
+
+-- Add the discovered event type
+-- SQLite doesn't support ALTER TABLE to modify constraints, so we need to recreate the table
+CREATE TABLE device_events_new (
+    id INTEGER PRIMARY KEY,
+    device_id INTEGER REFERENCES devices(id) ON DELETE CASCADE,
+    event_type TEXT CHECK(event_type IN (
+        'config_fetch', 'config_fetch_failed',
+        'registration', 'registration_failed', 'unregistration',
+        'provision_start', 'provision_complete', 'provision_failed',
+        'call_start', 'call_end',
+        'firmware_check', 'firmware_update',
+        'discovered',
+        'error', 'warning', 'info'
+    )) NOT NULL,
+    event_data JSON,
+    ip_address TEXT,
+    user_agent TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO device_events_new (id, device_id, event_type, event_data, ip_address, user_agent, created_at)
+SELECT id, device_id, event_type, event_data, ip_address, user_agent, created_at FROM device_events;
+
+DROP TABLE device_events;
+
+ALTER TABLE device_events_new RENAME TO device_events;
+
+CREATE INDEX idx_device_events_device ON device_events(device_id);
+CREATE INDEX idx_device_events_type ON device_events(event_type);
+CREATE INDEX idx_device_events_created ON device_events(created_at);
+
+-- Scanning the LAN is opt-in
+INSERT OR IGNORE INTO config (key, value, updated_at) VALUES ('discovery_enabled', 'false', datetime('now'))
@@ -0,0 +1 @@
+DELETE FROM config WHERE key = 'provisioning_responder_enabled'
@@ -0,0 +1,3 @@
+-- Serving configs by MAC address to phones pointed at GoSIP through
+-- DHCP option 66/160 is opt-in
+INSERT OR IGNORE INTO config (key, value, updated_at) VALUES ('provisioning_responder_enabled', 'false', datetime('now'))
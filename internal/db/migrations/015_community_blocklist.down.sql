@@ -0,0 +1,4 @@
+DELETE FROM config WHERE key IN ('blocklist_feeds_enabled', 'blocklist_feed_schedule');
+DROP INDEX IF EXISTS idx_community_blocklist_number;
+DROP TABLE IF EXISTS community_blocklist;
+DROP TABLE IF EXISTS blocklist_feeds
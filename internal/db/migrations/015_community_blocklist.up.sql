@@ -0,0 +1,25 @@
+-- External spam number feeds feeding the community blocklist tier
+CREATE TABLE blocklist_feeds (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    url TEXT NOT NULL UNIQUE,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    entry_count INTEGER NOT NULL DEFAULT 0,
+    last_fetched_at DATETIME,
+    last_success_at DATETIME,
+    last_error TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Numbers published by feeds, replaced wholesale on every successful refresh
+CREATE TABLE community_blocklist (
+    feed_id INTEGER NOT NULL REFERENCES blocklist_feeds(id) ON DELETE CASCADE,
+    number TEXT NOT NULL,
+    PRIMARY KEY (feed_id, number)
+);
+
+CREATE INDEX idx_community_blocklist_number ON community_blocklist(number);
+
+-- Feed subscriptions are opt-in and refresh every 6 hours by default
+INSERT OR IGNORE INTO config (key, value, updated_at) VALUES ('blocklist_feeds_enabled', 'false', datetime('now'));
+INSERT OR IGNORE INTO config (key, value, updated_at) VALUES ('blocklist_feed_schedule', '0 */6 * * *', datetime('now'))
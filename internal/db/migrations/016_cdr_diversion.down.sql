@@ -0,0 +1,2 @@
+-- Migration 016 rollback: Remove CDR diversion chain
+ALTER TABLE cdrs DROP COLUMN diversion_chain
@@ -0,0 +1,3 @@
+-- Migration 016: Record the diversion chain of forwarded calls
+-- JSON array of numbers the call was diverted through, original called number first
+ALTER TABLE cdrs ADD COLUMN diversion_chain JSON
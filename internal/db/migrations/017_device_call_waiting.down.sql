@@ -0,0 +1,2 @@
+-- Migration 017 rollback: Remove per-device call waiting
+ALTER TABLE devices DROP COLUMN call_waiting
@@ -0,0 +1,3 @@
+-- Migration 017: Per-device call waiting
+-- When disabled, new calls to a device that is already on a call get busy handling
+ALTER TABLE devices ADD COLUMN call_waiting BOOLEAN NOT NULL DEFAULT TRUE
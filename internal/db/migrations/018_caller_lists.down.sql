@@ -0,0 +1 @@
+DROP TABLE IF EXISTS caller_lists
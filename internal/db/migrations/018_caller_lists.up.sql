@@ -0,0 +1,9 @@
+-- Named caller lists that set a distinctive ring (Alert-Info) for matching callers
+CREATE TABLE caller_lists (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    numbers JSON NOT NULL DEFAULT '[]',
+    alert_info TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+)
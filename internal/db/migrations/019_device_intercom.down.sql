@@ -0,0 +1,2 @@
+-- Migration 019 rollback: Remove per-device intercom auto-answer
+ALTER TABLE devices DROP COLUMN intercom_allowed
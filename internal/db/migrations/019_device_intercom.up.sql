@@ -0,0 +1,3 @@
+-- Migration 019: Per-device intercom auto-answer
+-- Devices must opt in before intercom calls are answered automatically
+ALTER TABLE devices ADD COLUMN intercom_allowed BOOLEAN NOT NULL DEFAULT FALSE
@@ -0,0 +1,4 @@
+-- Migration 020 rollback: Remove the internal extension numbering plan
+ALTER TABLE cdrs DROP COLUMN internal;
+DROP INDEX IF EXISTS idx_devices_extension;
+ALTER TABLE devices DROP COLUMN extension;
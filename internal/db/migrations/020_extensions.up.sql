@@ -0,0 +1,7 @@
+-- Migration 020: Internal extension numbering plan
+-- Extensions let registered devices call each other without going through Twilio
+ALTER TABLE devices ADD COLUMN extension TEXT;
+CREATE UNIQUE INDEX idx_devices_extension ON devices(extension) WHERE extension IS NOT NULL;
+
+-- Internal calls are kept out of billing statistics
+ALTER TABLE cdrs ADD COLUMN internal BOOLEAN NOT NULL DEFAULT FALSE;
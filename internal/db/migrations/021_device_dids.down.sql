@@ -0,0 +1,3 @@
+-- Migration 021 rollback: Remove outbound caller ID selection
+DROP TABLE IF EXISTS device_did_memory;
+DROP TABLE IF EXISTS device_dids
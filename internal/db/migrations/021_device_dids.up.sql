@@ -0,0 +1,17 @@
+-- Migration 021: Outbound caller ID selection for devices shared across DIDs
+-- DIDs a device may present as caller ID, one of them the default
+CREATE TABLE device_dids (
+    device_id INTEGER NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    did_id INTEGER NOT NULL REFERENCES dids(id) ON DELETE CASCADE,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (device_id, did_id)
+);
+
+-- The DID a device last called each destination from
+CREATE TABLE device_did_memory (
+    device_id INTEGER NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    destination TEXT NOT NULL,
+    did_id INTEGER NOT NULL REFERENCES dids(id) ON DELETE CASCADE,
+    used_at DATETIME NOT NULL,
+    PRIMARY KEY (device_id, destination)
+)
@@ -0,0 +1,2 @@
+-- Migration 022 rollback: Remove SIP MESSAGE delivery to devices
+ALTER TABLE devices DROP COLUMN sip_messaging
@@ -0,0 +1,3 @@
+-- Migration 022: SIP MESSAGE delivery of SMS to devices
+-- Devices that opt in receive their DIDs' texts and exchange read receipts (IMDN)
+ALTER TABLE devices ADD COLUMN sip_messaging BOOLEAN NOT NULL DEFAULT FALSE
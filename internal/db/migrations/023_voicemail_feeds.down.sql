@@ -0,0 +1,2 @@
+-- Migration 023 rollback: Remove voicemail podcast feeds
+DROP TABLE IF EXISTS voicemail_feeds
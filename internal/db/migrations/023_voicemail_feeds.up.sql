@@ -0,0 +1,9 @@
+-- Migration 023: Private voicemail podcast feeds
+-- One secret feed token per voicemail box (boxes are keyed by DID)
+CREATE TABLE voicemail_feeds (
+    did_id INTEGER PRIMARY KEY REFERENCES dids(id) ON DELETE CASCADE,
+    token TEXT UNIQUE NOT NULL,
+    created_at DATETIME NOT NULL,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    last_fetched_at DATETIME
+)
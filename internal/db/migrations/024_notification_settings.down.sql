@@ -0,0 +1,2 @@
+-- Migration 024 rollback: Remove per-user notification settings
+DROP TABLE IF EXISTS user_notification_settings
@@ -0,0 +1,13 @@
+-- Migration 024: Per-user notification settings
+-- Personal email/push delivery with timezone-aware quiet hours that VIP callers can break through
+CREATE TABLE user_notification_settings (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    push_token TEXT NOT NULL DEFAULT '',
+    quiet_hours_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    quiet_start TEXT NOT NULL DEFAULT '22:00',
+    quiet_end TEXT NOT NULL DEFAULT '07:00',
+    timezone TEXT NOT NULL DEFAULT '',
+    vip_breakthrough BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at DATETIME NOT NULL
+)
@@ -0,0 +1,2 @@
+-- Migration 025 rollback: Remove announcement banners
+DROP TABLE IF EXISTS announcements
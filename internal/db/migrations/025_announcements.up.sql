@@ -0,0 +1,15 @@
+-- Migration 025: Announcement banners
+-- Banners posted by admins, plus system announcements raised and cleared by health checks
+CREATE TABLE announcements (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    level TEXT NOT NULL DEFAULT 'info',
+    title TEXT NOT NULL DEFAULT '',
+    message TEXT NOT NULL,
+    source TEXT NOT NULL DEFAULT 'admin',
+    system_key TEXT UNIQUE,
+    starts_at DATETIME,
+    ends_at DATETIME,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+)
@@ -0,0 +1,3 @@
+-- Migration 026 rollback: Remove persistent login brute-force protection
+DROP TABLE IF EXISTS login_lockouts;
+DROP TABLE IF EXISTS login_attempts
@@ -0,0 +1,24 @@
+-- Migration 026: Persistent login brute-force protection
+-- Sign-in history for the admin audit view, and failure counters that survive restarts
+CREATE TABLE login_attempts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email TEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    success BOOLEAN NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_login_attempts_created_at ON login_attempts(created_at);
+
+-- One row per IP address or account with recent failures
+CREATE TABLE login_lockouts (
+    scope TEXT NOT NULL,
+    key TEXT NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    lockouts INTEGER NOT NULL DEFAULT 0,
+    locked_until DATETIME,
+    last_failure_at DATETIME NOT NULL,
+    PRIMARY KEY (scope, key)
+)
@@ -0,0 +1,2 @@
+-- Migration 027 rollback: Remove per-DID Twilio Messaging Service
+ALTER TABLE dids DROP COLUMN messaging_service_sid
@@ -0,0 +1,3 @@
+-- Migration 027: Per-DID Twilio Messaging Service
+-- Outbound SMS from the DID is sent through the service when set
+ALTER TABLE dids ADD COLUMN messaging_service_sid TEXT NOT NULL DEFAULT ''
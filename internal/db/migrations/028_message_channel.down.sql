@@ -0,0 +1,4 @@
+-- Migration 028 rollback: Remove message channels
+DROP INDEX IF EXISTS idx_messages_channel;
+
+ALTER TABLE messages DROP COLUMN channel
@@ -0,0 +1,7 @@
+-- Migration 028: Message channels
+-- Existing messages with media were sent or received as MMS, the rest as SMS
+ALTER TABLE messages ADD COLUMN channel TEXT NOT NULL DEFAULT 'sms';
+
+UPDATE messages SET channel = 'mms' WHERE media_urls IS NOT NULL AND media_urls NOT IN ('', 'null', '[]');
+
+CREATE INDEX idx_messages_channel ON messages(channel)
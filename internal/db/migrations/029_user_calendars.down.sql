@@ -0,0 +1,46 @@
+-- Migration 029 rollback: Remove user calendars
+-- Calendar routes and auto-replies can't satisfy the old checks, so they are dropped
+DELETE FROM routes WHERE condition_type = 'calendar';
+
+CREATE TABLE routes_old (
+    id INTEGER PRIMARY KEY,
+    did_id INTEGER REFERENCES dids(id) ON DELETE CASCADE,
+    priority INTEGER NOT NULL DEFAULT 0,
+    name TEXT NOT NULL,
+    condition_type TEXT CHECK(condition_type IN ('time', 'callerid', 'default')),
+    condition_data JSON,
+    action_type TEXT CHECK(action_type IN ('ring', 'forward', 'voicemail', 'reject')),
+    action_data JSON,
+    enabled BOOLEAN DEFAULT TRUE
+);
+
+INSERT INTO routes_old (id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled)
+SELECT id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled FROM routes;
+
+DROP TABLE routes;
+
+ALTER TABLE routes_old RENAME TO routes;
+
+CREATE INDEX idx_routes_did_priority ON routes(did_id, priority);
+
+DELETE FROM auto_replies WHERE trigger_type = 'calendar_busy';
+
+CREATE TABLE auto_replies_old (
+    id INTEGER PRIMARY KEY,
+    did_id INTEGER REFERENCES dids(id) ON DELETE CASCADE,
+    trigger_type TEXT CHECK(trigger_type IN ('dnd', 'after_hours', 'keyword', 'always')),
+    trigger_data JSON,
+    reply_text TEXT NOT NULL,
+    enabled BOOLEAN DEFAULT TRUE
+);
+
+INSERT INTO auto_replies_old (id, did_id, trigger_type, trigger_data, reply_text, enabled)
+SELECT id, did_id, trigger_type, trigger_data, reply_text, enabled FROM auto_replies;
+
+DROP TABLE auto_replies;
+
+ALTER TABLE auto_replies_old RENAME TO auto_replies;
+
+DROP INDEX IF EXISTS idx_calendar_busy_blocks_calendar;
+DROP TABLE IF EXISTS calendar_busy_blocks;
+DROP TABLE IF EXISTS user_calendars
@@ -0,0 +1,64 @@
+-- Migration 029: User calendars
+-- Linked calendars are synced into busy blocks that routing rules and SMS auto-replies check
+CREATE TABLE user_calendars (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    url TEXT NOT NULL,
+    username TEXT NOT NULL DEFAULT '',
+    password TEXT NOT NULL DEFAULT '',
+    enabled INTEGER NOT NULL DEFAULT 1,
+    last_synced_at DATETIME,
+    last_error TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Busy periods from the last successful sync, replaced wholesale on every sync
+CREATE TABLE calendar_busy_blocks (
+    calendar_id INTEGER NOT NULL REFERENCES user_calendars(id) ON DELETE CASCADE,
+    starts_at DATETIME NOT NULL,
+    ends_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_calendar_busy_blocks_calendar ON calendar_busy_blocks(calendar_id, starts_at);
+
+-- Add the calendar condition type
+-- SQLite doesn't support ALTER TABLE to modify constraints, so we need to recreate the table
+CREATE TABLE routes_new (
+    id INTEGER PRIMARY KEY,
+    did_id INTEGER REFERENCES dids(id) ON DELETE CASCADE,
+    priority INTEGER NOT NULL DEFAULT 0,
+    name TEXT NOT NULL,
+    condition_type TEXT CHECK(condition_type IN ('time', 'callerid', 'default', 'calendar')),
+    condition_data JSON,
+    action_type TEXT CHECK(action_type IN ('ring', 'forward', 'voicemail', 'reject')),
+    action_data JSON,
+    enabled BOOLEAN DEFAULT TRUE
+);
+
+INSERT INTO routes_new (id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled)
+SELECT id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled FROM routes;
+
+DROP TABLE routes;
+
+ALTER TABLE routes_new RENAME TO routes;
+
+CREATE INDEX idx_routes_did_priority ON routes(did_id, priority)
+;
+
+-- Add the calendar_busy auto-reply trigger
+CREATE TABLE auto_replies_new (
+    id INTEGER PRIMARY KEY,
+    did_id INTEGER REFERENCES dids(id) ON DELETE CASCADE,
+    trigger_type TEXT CHECK(trigger_type IN ('dnd', 'after_hours', 'keyword', 'always', 'calendar_busy')),
+    trigger_data JSON,
+    reply_text TEXT NOT NULL,
+    enabled BOOLEAN DEFAULT TRUE
+);
+
+INSERT INTO auto_replies_new (id, did_id, trigger_type, trigger_data, reply_text, enabled)
+SELECT id, did_id, trigger_type, trigger_data, reply_text, enabled FROM auto_replies;
+
+DROP TABLE auto_replies;
+
+ALTER TABLE auto_replies_new RENAME TO auto_replies
\ No newline at end of file
@@ -0,0 +1,47 @@
+-- Migration 030: On-call schedules
+-- Rotations of users that oncall routes page, escalating through levels until someone answers
+CREATE TABLE oncall_schedules (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    timezone TEXT NOT NULL DEFAULT '',
+    levels JSON NOT NULL DEFAULT '[]',
+    ical_token TEXT NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Overrides put another user on call at one level for a period, such as a swapped shift
+CREATE TABLE oncall_overrides (
+    id INTEGER PRIMARY KEY,
+    schedule_id INTEGER NOT NULL REFERENCES oncall_schedules(id) ON DELETE CASCADE,
+    level INTEGER NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    starts_at DATETIME NOT NULL,
+    ends_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_oncall_overrides_schedule ON oncall_overrides(schedule_id, ends_at);
+
+-- Add the oncall action type
+-- SQLite doesn't support ALTER TABLE to modify constraints, so we need to recreate the table
+CREATE TABLE routes_new (
+    id INTEGER PRIMARY KEY,
+    did_id INTEGER REFERENCES dids(id) ON DELETE CASCADE,
+    priority INTEGER NOT NULL DEFAULT 0,
+    name TEXT NOT NULL,
+    condition_type TEXT CHECK(condition_type IN ('time', 'callerid', 'default', 'calendar')),
+    condition_data JSON,
+    action_type TEXT CHECK(action_type IN ('ring', 'forward', 'voicemail', 'reject', 'oncall')),
+    action_data JSON,
+    enabled BOOLEAN DEFAULT TRUE
+);
+
+INSERT INTO routes_new (id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled)
+SELECT id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled FROM routes;
+
+DROP TABLE routes;
+
+ALTER TABLE routes_new RENAME TO routes;
+
+CREATE INDEX idx_routes_did_priority ON routes(did_id, priority)
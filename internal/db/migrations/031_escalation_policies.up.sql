@@ -0,0 +1,36 @@
+-- Migration 031: Escalation policies
+-- Levels of users and numbers that escalate routes call, repeating until someone acknowledges
+CREATE TABLE escalation_policies (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    levels JSON NOT NULL DEFAULT '[]',
+    repeat INTEGER NOT NULL DEFAULT 1,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- JSON array of the steps an escalated call went through
+ALTER TABLE cdrs ADD COLUMN escalation_timeline JSON;
+
+-- Add the escalate action type
+-- SQLite doesn't support ALTER TABLE to modify constraints, so we need to recreate the table
+CREATE TABLE routes_new (
+    id INTEGER PRIMARY KEY,
+    did_id INTEGER REFERENCES dids(id) ON DELETE CASCADE,
+    priority INTEGER NOT NULL DEFAULT 0,
+    name TEXT NOT NULL,
+    condition_type TEXT CHECK(condition_type IN ('time', 'callerid', 'default', 'calendar')),
+    condition_data JSON,
+    action_type TEXT CHECK(action_type IN ('ring', 'forward', 'voicemail', 'reject', 'oncall', 'escalate')),
+    action_data JSON,
+    enabled BOOLEAN DEFAULT TRUE
+);
+
+INSERT INTO routes_new (id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled)
+SELECT id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled FROM routes;
+
+DROP TABLE routes;
+
+ALTER TABLE routes_new RENAME TO routes;
+
+CREATE INDEX idx_routes_did_priority ON routes(did_id, priority)
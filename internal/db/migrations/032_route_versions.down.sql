@@ -0,0 +1,2 @@
+-- Migration 032 rollback: Remove route version history
+DROP TABLE IF EXISTS route_versions
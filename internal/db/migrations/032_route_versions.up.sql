@@ -0,0 +1,16 @@
+-- Migration 032: Route version history
+-- A copy of a route after every change, kept after the route is deleted so
+-- any edit can be rolled back
+CREATE TABLE route_versions (
+    id INTEGER PRIMARY KEY,
+    route_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    change TEXT NOT NULL CHECK(change IN ('created', 'updated', 'reordered', 'deleted', 'rolled_back')),
+    route JSON NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    user_email TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(route_id, version)
+);
+
+CREATE INDEX idx_route_versions_created ON route_versions(created_at)
@@ -0,0 +1,2 @@
+-- Migration 033 rollback: Remove scheduled change sets
+DROP TABLE IF EXISTS change_sets
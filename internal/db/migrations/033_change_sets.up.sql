@@ -0,0 +1,19 @@
+-- Migration 033: Scheduled change sets
+-- Setting and route changes applied together at a scheduled time, with the
+-- changes that undo them saved when they are applied
+CREATE TABLE change_sets (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    changes JSON NOT NULL DEFAULT '[]',
+    undo JSON NOT NULL DEFAULT '[]',
+    apply_at DATETIME NOT NULL,
+    revert_at DATETIME,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'applied', 'reverted', 'cancelled', 'failed')),
+    error TEXT NOT NULL DEFAULT '',
+    applied_at DATETIME,
+    reverted_at DATETIME,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_change_sets_status ON change_sets(status)
@@ -0,0 +1,26 @@
+-- Migration 034 rollback: Remove the split action
+DROP TABLE IF EXISTS route_split_counts;
+
+-- Split routes can't satisfy the old action check, so they are dropped
+DELETE FROM routes WHERE action_type = 'split';
+
+CREATE TABLE routes_old (
+    id INTEGER PRIMARY KEY,
+    did_id INTEGER REFERENCES dids(id) ON DELETE CASCADE,
+    priority INTEGER NOT NULL DEFAULT 0,
+    name TEXT NOT NULL,
+    condition_type TEXT CHECK(condition_type IN ('time', 'callerid', 'default', 'calendar')),
+    condition_data JSON,
+    action_type TEXT CHECK(action_type IN ('ring', 'forward', 'voicemail', 'reject', 'oncall', 'escalate')),
+    action_data JSON,
+    enabled BOOLEAN DEFAULT TRUE
+);
+
+INSERT INTO routes_old (id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled)
+SELECT id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled FROM routes;
+
+DROP TABLE routes;
+
+ALTER TABLE routes_old RENAME TO routes;
+
+CREATE INDEX idx_routes_did_priority ON routes(did_id, priority)
@@ -0,0 +1,32 @@
+-- Migration 034: Split action
+-- Add the split action type, which distributes calls across other actions
+-- SQLite doesn't support ALTER TABLE to modify constraints, so we need to recreate the table
+CREATE TABLE routes_new (
+    id INTEGER PRIMARY KEY,
+    did_id INTEGER REFERENCES dids(id) ON DELETE CASCADE,
+    priority INTEGER NOT NULL DEFAULT 0,
+    name TEXT NOT NULL,
+    condition_type TEXT CHECK(condition_type IN ('time', 'callerid', 'default', 'calendar')),
+    condition_data JSON,
+    action_type TEXT CHECK(action_type IN ('ring', 'forward', 'voicemail', 'reject', 'oncall', 'escalate', 'split')),
+    action_data JSON,
+    enabled BOOLEAN DEFAULT TRUE
+);
+
+INSERT INTO routes_new (id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled)
+SELECT id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled FROM routes;
+
+DROP TABLE routes;
+
+ALTER TABLE routes_new RENAME TO routes;
+
+CREATE INDEX idx_routes_did_priority ON routes(did_id, priority);
+
+-- How many calls each target of a split route has received
+CREATE TABLE route_split_counts (
+    route_id INTEGER NOT NULL REFERENCES routes(id) ON DELETE CASCADE,
+    target INTEGER NOT NULL,
+    calls INTEGER NOT NULL DEFAULT 0,
+    last_call_at DATETIME,
+    PRIMARY KEY (route_id, target)
+)
@@ -0,0 +1,2 @@
+-- Migration 035 rollback: Remove the CDR codec
+ALTER TABLE cdrs DROP COLUMN codec
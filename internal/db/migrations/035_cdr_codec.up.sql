@@ -0,0 +1,3 @@
+-- Migration 035: Record the audio codec of calls
+-- SDP encoding name the device leg negotiated, e.g. G722, or empty when unknown
+ALTER TABLE cdrs ADD COLUMN codec TEXT NOT NULL DEFAULT ''
@@ -0,0 +1,2 @@
+-- Migration 036 rollback: Remove per-device comfort noise
+ALTER TABLE devices DROP COLUMN comfort_noise
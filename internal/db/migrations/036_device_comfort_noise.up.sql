@@ -0,0 +1,3 @@
+-- Migration 036: Per-device comfort noise
+-- When disabled, CN and silence suppression are left out of the SDP offered to the device
+ALTER TABLE devices ADD COLUMN comfort_noise BOOLEAN NOT NULL DEFAULT TRUE
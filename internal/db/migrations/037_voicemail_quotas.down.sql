@@ -0,0 +1,4 @@
+-- Migration 037 rollback: Remove voicemail storage quotas
+DROP TABLE IF EXISTS voicemail_quotas;
+
+ALTER TABLE voicemails DROP COLUMN size_bytes
@@ -0,0 +1,17 @@
+-- Migration 037: Voicemail storage quotas
+-- Mailboxes are keyed by DID. A limit of 0 leaves that dimension unlimited.
+CREATE TABLE voicemail_quotas (
+    did_id INTEGER PRIMARY KEY REFERENCES dids(id) ON DELETE CASCADE,
+    max_messages INTEGER NOT NULL DEFAULT 0,
+    max_mb INTEGER NOT NULL DEFAULT 0,
+    warn_percent INTEGER NOT NULL DEFAULT 80,
+    action TEXT NOT NULL DEFAULT 'reject' CHECK(action IN ('reject', 'delete_oldest')),
+    warned_at DATETIME,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Twilio doesn't report recording sizes, so they are estimated from the
+-- length at the 32 kbit/s of its MP3 recordings
+ALTER TABLE voicemails ADD COLUMN size_bytes INTEGER NOT NULL DEFAULT 0;
+
+UPDATE voicemails SET size_bytes = duration * 4000
@@ -0,0 +1,4 @@
+-- Migration 038 rollback: Remove shared voicemail boxes
+DROP TABLE IF EXISTS voicemail_assignments;
+DROP TABLE IF EXISTS voicemail_reads;
+DROP TABLE IF EXISTS voicemail_box_members
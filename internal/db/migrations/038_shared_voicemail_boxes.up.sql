@@ -0,0 +1,27 @@
+-- Migration 038: Shared voicemail boxes
+-- A voicemail box (keyed by DID) with members is shared. Each member keeps
+-- their own read state, and voicemails can be assigned to a member.
+CREATE TABLE voicemail_box_members (
+    did_id INTEGER NOT NULL REFERENCES dids(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (did_id, user_id)
+);
+
+CREATE INDEX idx_voicemail_box_members_user ON voicemail_box_members(user_id);
+
+CREATE TABLE voicemail_reads (
+    voicemail_id INTEGER NOT NULL REFERENCES voicemails(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    read_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (voicemail_id, user_id)
+);
+
+CREATE TABLE voicemail_assignments (
+    voicemail_id INTEGER PRIMARY KEY REFERENCES voicemails(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    assigned_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    assigned_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_voicemail_assignments_user ON voicemail_assignments(user_id)
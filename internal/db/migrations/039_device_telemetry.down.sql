@@ -0,0 +1,2 @@
+-- Migration 039 rollback: Remove device health telemetry
+DROP TABLE IF EXISTS device_telemetry
@@ -0,0 +1,16 @@
+-- Migration 039: Device health telemetry
+-- Samples come from registrations (interval since the last one), OPTIONS
+-- pings (round trip time, NULL when the phone didn't answer) and beacons
+-- phones send with their firmware and uptime.
+CREATE TABLE device_telemetry (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id INTEGER NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    source TEXT NOT NULL,
+    rtt_ms INTEGER,
+    register_interval_seconds INTEGER,
+    firmware TEXT,
+    uptime_seconds INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_device_telemetry_device ON device_telemetry(device_id, created_at)
@@ -0,0 +1,2 @@
+-- Migration 040 rollback: Remove Twilio trunk disaster recovery
+DROP TABLE IF EXISTS trunk_failovers
@@ -0,0 +1,14 @@
+-- Migration 040: Twilio trunk disaster recovery
+-- The failover configured for each trunk, so it can be checked against
+-- what Twilio has and flagged when it changes.
+CREATE TABLE trunk_failovers (
+    trunk_sid TEXT PRIMARY KEY,
+    forward_to TEXT,
+    disaster_recovery_url TEXT NOT NULL DEFAULT '',
+    secondary_uri TEXT NOT NULL DEFAULT '',
+    intact INTEGER NOT NULL DEFAULT 1,
+    problems TEXT,
+    verified_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+)
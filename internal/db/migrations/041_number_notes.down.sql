@@ -0,0 +1,2 @@
+-- Migration 041 rollback: Remove notes about external numbers
+DROP TABLE IF EXISTS number_notes
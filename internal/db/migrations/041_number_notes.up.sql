@@ -0,0 +1,12 @@
+-- Migration 041: Notes about external numbers
+-- Free-form notes kept against a caller's number, shown in the caller
+-- journey timeline alongside their calls, messages and voicemails.
+CREATE TABLE number_notes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    number TEXT NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    body TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_number_notes_number ON number_notes(number, created_at)
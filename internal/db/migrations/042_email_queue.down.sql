@@ -0,0 +1,2 @@
+-- Migration 042 rollback: Remove the outbound email queue
+DROP TABLE IF EXISTS email_queue
@@ -0,0 +1,19 @@
+-- Migration 042: Outbound email queue
+-- Emails are queued and retried with exponential backoff when the relay
+-- fails. Ones that run out of attempts stay as dead letters until an admin
+-- retries or deletes them.
+CREATE TABLE email_queue (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    recipient TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    body TEXT NOT NULL,
+    html INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    sent_at DATETIME
+);
+
+CREATE INDEX idx_email_queue_status ON email_queue(status, next_attempt_at)
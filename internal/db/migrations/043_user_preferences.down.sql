@@ -0,0 +1,2 @@
+-- Migration 043 rollback: Remove per-user preferences
+DROP TABLE IF EXISTS user_preferences
@@ -0,0 +1,10 @@
+-- Migration 043: Per-user UI and API preferences
+-- One JSON value per user and key, so settings such as table column
+-- layouts follow a user across browsers.
+CREATE TABLE user_preferences (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, key)
+)
@@ -0,0 +1,2 @@
+-- Migration 044 rollback: Remove Twilio number webhook configuration
+DROP TABLE IF EXISTS did_webhooks
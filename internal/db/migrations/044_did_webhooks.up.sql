@@ -0,0 +1,13 @@
+-- Migration 044: Twilio number webhook configuration
+-- The public URL each DID's Twilio number was pointed at, so its webhooks
+-- can be checked against what Twilio has and flagged when they drift.
+CREATE TABLE did_webhooks (
+    did_id INTEGER PRIMARY KEY REFERENCES dids(id) ON DELETE CASCADE,
+    phone_number_sid TEXT NOT NULL,
+    base_url TEXT NOT NULL,
+    intact INTEGER NOT NULL DEFAULT 1,
+    problems TEXT,
+    verified_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+)
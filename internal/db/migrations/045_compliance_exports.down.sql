@@ -0,0 +1,2 @@
+-- Migration 045 rollback: Remove compliance exports
+DROP TABLE IF EXISTS compliance_exports
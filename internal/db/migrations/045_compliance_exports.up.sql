@@ -0,0 +1,24 @@
+-- Migration 045: Compliance exports
+-- Signed JSONL exports of calls and messages for a time range. Every line
+-- carries a SHA-256 hash chained to the line before, and each export's
+-- chain starts from the previous export's last hash. Completed exports are
+-- never changed or deleted.
+CREATE TABLE compliance_exports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'complete', 'failed')),
+    range_start DATETIME NOT NULL,
+    range_end DATETIME NOT NULL,
+    requested_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    file_name TEXT,
+    calls INTEGER NOT NULL DEFAULT 0,
+    messages INTEGER NOT NULL DEFAULT 0,
+    previous_hash TEXT,
+    head_hash TEXT,
+    file_sha256 TEXT,
+    signature TEXT,
+    error TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    completed_at DATETIME
+);
+
+CREATE INDEX idx_compliance_exports_status ON compliance_exports(status, id)
@@ -0,0 +1,2 @@
+-- Migration 046 rollback: Remove phone number verifications
+DROP TABLE IF EXISTS verifications
@@ -0,0 +1,21 @@
+-- Migration 046: Phone number verifications
+-- One-time codes sent by SMS or voice call for apps verifying phone numbers.
+-- Only a bcrypt hash of each code is kept.
+CREATE TABLE verifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    did_id INTEGER REFERENCES dids(id) ON DELETE SET NULL,
+    to_number TEXT NOT NULL,
+    channel TEXT NOT NULL CHECK (channel IN ('sms', 'call')),
+    code_hash TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'canceled', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    sid TEXT,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_verifications_to_number ON verifications(to_number, created_at);
+
+CREATE INDEX idx_verifications_user ON verifications(user_id, created_at)
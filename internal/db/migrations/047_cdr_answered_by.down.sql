@@ -0,0 +1,2 @@
+-- Migration 047 rollback: Remove the CDR answered-by result
+ALTER TABLE cdrs DROP COLUMN answered_by
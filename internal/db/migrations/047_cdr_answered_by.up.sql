@@ -0,0 +1,4 @@
+-- Migration 047: Record who answered forwarded calls
+-- Twilio's answering machine detection result for the forwarded leg, e.g.
+-- human or machine_start, or empty when detection wasn't used
+ALTER TABLE cdrs ADD COLUMN answered_by TEXT NOT NULL DEFAULT ''
@@ -0,0 +1,9 @@
+-- Migration 048: Provision the default Grandstream profile with the dial plan
+UPDATE provisioning_profiles
+SET config_template = replace(config_template, '    <!-- Security -->', '    <!-- Dial Plan: extensions dial at once, other numbers after a pause -->
+    <config name="P290" value="{{.DigitMap}}"/>
+    <config name="P85" value="{{.DigitMapTimeout}}"/>
+
+    <!-- Security -->'),
+    updated_at = CURRENT_TIMESTAMP
+WHERE vendor = 'grandstream' AND model = 'GXP1760W' AND is_default = 1
@@ -0,0 +1,6 @@
+-- Migration 049 rollback: Remove rate tables and cost estimates
+ALTER TABLE messages DROP COLUMN actual_cost;
+ALTER TABLE messages DROP COLUMN estimated_cost;
+ALTER TABLE cdrs DROP COLUMN actual_cost;
+ALTER TABLE cdrs DROP COLUMN estimated_cost;
+DROP TABLE IF EXISTS rates
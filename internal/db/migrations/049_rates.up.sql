@@ -0,0 +1,14 @@
+-- Migration 049: Rate tables for estimating call and message costs
+CREATE TABLE IF NOT EXISTS rates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,               -- 'call' (per minute), 'sms' (per segment) or 'mms' (per message)
+    prefix TEXT NOT NULL,             -- Leading digits of E.164 numbers, without '+'
+    rate REAL NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    UNIQUE(kind, prefix)
+);
+
+ALTER TABLE cdrs ADD COLUMN estimated_cost REAL;
+ALTER TABLE cdrs ADD COLUMN actual_cost REAL;
+ALTER TABLE messages ADD COLUMN estimated_cost REAL;
+ALTER TABLE messages ADD COLUMN actual_cost REAL
@@ -0,0 +1,5 @@
+-- Migration 050 rollback: Remove server-side call recordings
+DROP INDEX IF EXISTS idx_recordings_cdr_id;
+DROP INDEX IF EXISTS idx_recordings_call_id;
+DROP TABLE IF EXISTS recordings;
+ALTER TABLE dids DROP COLUMN recording_enabled
@@ -0,0 +1,19 @@
+-- Migration 050: Server-side call recordings
+-- Calls to DIDs with recording_enabled are recorded by GoSIP when their
+-- media passes through it
+ALTER TABLE dids ADD COLUMN recording_enabled INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS recordings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    call_id TEXT NOT NULL,               -- SIP Call-ID of the recorded call
+    cdr_id INTEGER REFERENCES cdrs(id) ON DELETE SET NULL,
+    file_name TEXT NOT NULL,             -- WAV file in the recordings directory
+    status TEXT NOT NULL,                -- 'recording', 'completed' or 'failed'
+    duration INTEGER NOT NULL DEFAULT 0, -- Seconds of audio, pauses excluded
+    size_bytes INTEGER NOT NULL DEFAULT 0,
+    started_at DATETIME NOT NULL,
+    ended_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_recordings_call_id ON recordings(call_id);
+CREATE INDEX IF NOT EXISTS idx_recordings_cdr_id ON recordings(cdr_id)
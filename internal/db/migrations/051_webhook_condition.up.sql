@@ -0,0 +1,30 @@
+-- Migration 051: Webhook condition
+-- Add the webhook condition type, which asks an external service what to do with a call
+-- SQLite doesn't support ALTER TABLE to modify constraints, so we need to recreate the table.
+-- Dropping routes deletes split counts through their foreign key, so they are kept aside.
+CREATE TABLE route_split_counts_saved AS SELECT * FROM route_split_counts;
+
+CREATE TABLE routes_new (
+    id INTEGER PRIMARY KEY,
+    did_id INTEGER REFERENCES dids(id) ON DELETE CASCADE,
+    priority INTEGER NOT NULL DEFAULT 0,
+    name TEXT NOT NULL,
+    condition_type TEXT CHECK(condition_type IN ('time', 'callerid', 'default', 'calendar', 'webhook')),
+    condition_data JSON,
+    action_type TEXT CHECK(action_type IN ('ring', 'forward', 'voicemail', 'reject', 'oncall', 'escalate', 'split')),
+    action_data JSON,
+    enabled BOOLEAN DEFAULT TRUE
+);
+
+INSERT INTO routes_new (id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled)
+SELECT id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled FROM routes;
+
+DROP TABLE routes;
+
+ALTER TABLE routes_new RENAME TO routes;
+
+CREATE INDEX idx_routes_did_priority ON routes(did_id, priority);
+
+INSERT INTO route_split_counts SELECT * FROM route_split_counts_saved;
+
+DROP TABLE route_split_counts_saved
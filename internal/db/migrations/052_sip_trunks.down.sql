@@ -0,0 +1,2 @@
+-- Migration 052 rollback: Remove SIP trunks
+DROP TABLE IF EXISTS sip_trunks
@@ -0,0 +1,19 @@
+-- Migration 052: SIP trunks
+-- Providers other than Twilio that GoSIP registers with, and the
+-- credentials it registers with
+CREATE TABLE sip_trunks (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    host TEXT NOT NULL,
+    port INTEGER NOT NULL DEFAULT 5060,
+    transport TEXT NOT NULL DEFAULT 'udp' CHECK(transport IN ('udp', 'tcp', 'tls')),
+    domain TEXT NOT NULL DEFAULT '',
+    username TEXT NOT NULL,
+    auth_username TEXT NOT NULL DEFAULT '',
+    password TEXT NOT NULL DEFAULT '',
+    expires INTEGER NOT NULL DEFAULT 3600,
+    register INTEGER NOT NULL DEFAULT 1,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+)
@@ -0,0 +1,3 @@
+-- Migration 053 rollback: Remove outbound caller ID privacy
+ALTER TABLE devices DROP COLUMN anonymous_calls;
+ALTER TABLE users DROP COLUMN hide_caller_id
@@ -0,0 +1,5 @@
+-- Migration 053: Outbound caller ID privacy
+-- Users can withhold their caller ID on every outbound call, and admins can
+-- stop a device's calls from withholding it
+ALTER TABLE users ADD COLUMN hide_caller_id BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE devices ADD COLUMN anonymous_calls BOOLEAN NOT NULL DEFAULT TRUE
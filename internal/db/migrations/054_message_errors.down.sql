@@ -0,0 +1,3 @@
+-- Migration 054 rollback: Remove message send errors
+ALTER TABLE messages DROP COLUMN error_message;
+ALTER TABLE messages DROP COLUMN error_code
@@ -0,0 +1,5 @@
+-- Migration 054: Message send errors
+-- The Twilio error code and message of messages that failed to send or be
+-- delivered, so users can be told why
+ALTER TABLE messages ADD COLUMN error_code INTEGER;
+ALTER TABLE messages ADD COLUMN error_message TEXT NOT NULL DEFAULT ''
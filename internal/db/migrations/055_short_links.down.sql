@@ -0,0 +1,2 @@
+-- Migration 055 rollback: Remove short links
+DROP TABLE IF EXISTS short_links
@@ -0,0 +1,14 @@
+-- Migration 055: Short links in outbound messages
+-- Links in outbound messages replaced by short links GoSIP serves itself,
+-- with how often each was clicked
+CREATE TABLE short_links (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT NOT NULL UNIQUE,
+    message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    clicks INTEGER NOT NULL DEFAULT 0,
+    last_clicked_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_short_links_message ON short_links(message_id)
@@ -0,0 +1,2 @@
+-- Migration 056 rollback: Remove appointment reminders
+DROP TABLE IF EXISTS reminders
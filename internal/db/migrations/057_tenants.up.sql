@@ -0,0 +1,37 @@
+-- Migration 057: Tenants
+-- Households or companies hosted on one GoSIP instance. Users, devices,
+-- DIDs, routes, messages and CDRs without a tenant belong to the instance.
+CREATE TABLE tenants (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    sip_domain TEXT UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Settings a tenant overrides for itself
+CREATE TABLE tenant_config (
+    tenant_id INTEGER NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, key)
+);
+
+ALTER TABLE users ADD COLUMN tenant_id INTEGER;
+ALTER TABLE devices ADD COLUMN tenant_id INTEGER;
+ALTER TABLE dids ADD COLUMN tenant_id INTEGER;
+ALTER TABLE routes ADD COLUMN tenant_id INTEGER;
+ALTER TABLE messages ADD COLUMN tenant_id INTEGER;
+ALTER TABLE cdrs ADD COLUMN tenant_id INTEGER;
+
+CREATE INDEX idx_users_tenant ON users(tenant_id);
+CREATE INDEX idx_devices_tenant ON devices(tenant_id);
+CREATE INDEX idx_dids_tenant ON dids(tenant_id);
+CREATE INDEX idx_routes_tenant ON routes(tenant_id);
+CREATE INDEX idx_messages_tenant ON messages(tenant_id, created_at DESC);
+CREATE INDEX idx_cdrs_tenant ON cdrs(tenant_id, started_at DESC);
+
+-- Each tenant numbers its extensions itself
+DROP INDEX idx_devices_extension;
+CREATE UNIQUE INDEX idx_devices_extension ON devices(COALESCE(tenant_id, 0), extension) WHERE extension IS NOT NULL
@@ -0,0 +1,3 @@
+-- Migration 058 rollback: Remove media checksums
+ALTER TABLE voicemails DROP COLUMN checksum;
+ALTER TABLE recordings DROP COLUMN checksum
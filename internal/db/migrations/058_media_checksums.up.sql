@@ -0,0 +1,6 @@
+-- Migration 058: Media checksums
+-- SHA-256 of the WAV files GoSIP writes for recordings and local voicemail,
+-- checked before serving them and by the daily integrity check. Empty for
+-- files written before checksums were kept until the check records one.
+ALTER TABLE recordings ADD COLUMN checksum TEXT NOT NULL DEFAULT '';
+ALTER TABLE voicemails ADD COLUMN checksum TEXT NOT NULL DEFAULT ''
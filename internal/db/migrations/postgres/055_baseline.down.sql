@@ -0,0 +1,52 @@
+-- Migration 055 rollback: Remove the Postgres baseline
+DROP TABLE IF EXISTS short_links;
+DROP TABLE IF EXISTS sip_trunks;
+DROP TABLE IF EXISTS recordings;
+DROP TABLE IF EXISTS rates;
+DROP TABLE IF EXISTS verifications;
+DROP TABLE IF EXISTS compliance_exports;
+DROP TABLE IF EXISTS did_webhooks;
+DROP TABLE IF EXISTS user_preferences;
+DROP TABLE IF EXISTS email_queue;
+DROP TABLE IF EXISTS number_notes;
+DROP TABLE IF EXISTS trunk_failovers;
+DROP TABLE IF EXISTS device_telemetry;
+DROP TABLE IF EXISTS voicemail_assignments;
+DROP TABLE IF EXISTS voicemail_reads;
+DROP TABLE IF EXISTS voicemail_box_members;
+DROP TABLE IF EXISTS voicemail_quotas;
+DROP TABLE IF EXISTS route_split_counts;
+DROP TABLE IF EXISTS routes;
+DROP TABLE IF EXISTS change_sets;
+DROP TABLE IF EXISTS route_versions;
+DROP TABLE IF EXISTS escalation_policies;
+DROP TABLE IF EXISTS oncall_overrides;
+DROP TABLE IF EXISTS oncall_schedules;
+DROP TABLE IF EXISTS auto_replies;
+DROP TABLE IF EXISTS calendar_busy_blocks;
+DROP TABLE IF EXISTS user_calendars;
+DROP TABLE IF EXISTS login_lockouts;
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS announcements;
+DROP TABLE IF EXISTS user_notification_settings;
+DROP TABLE IF EXISTS voicemail_feeds;
+DROP TABLE IF EXISTS device_did_memory;
+DROP TABLE IF EXISTS device_dids;
+DROP TABLE IF EXISTS caller_lists;
+DROP TABLE IF EXISTS community_blocklist;
+DROP TABLE IF EXISTS blocklist_feeds;
+DROP TABLE IF EXISTS device_events;
+DROP TABLE IF EXISTS discovered_devices;
+DROP TABLE IF EXISTS voicemail_greetings;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS provisioning_profiles;
+DROP TABLE IF EXISTS provisioning_tokens;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS voicemails;
+DROP TABLE IF EXISTS cdrs;
+DROP TABLE IF EXISTS blocklist;
+DROP TABLE IF EXISTS dids;
+DROP TABLE IF EXISTS registrations;
+DROP TABLE IF EXISTS devices;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS config
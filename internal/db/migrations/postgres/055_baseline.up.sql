@@ -0,0 +1,851 @@
+-- Migration 055: Postgres baseline
+-- The SQLite schema as of migration 055, for new Postgres databases. Booleans
+-- stored as integers in SQLite are BOOLEAN here and JSON is kept as text.
+CREATE TABLE config (
+    key TEXT PRIMARY KEY,
+    value TEXT,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE users (
+    id BIGSERIAL PRIMARY KEY,
+    email TEXT UNIQUE NOT NULL,
+    password_hash TEXT NOT NULL,
+    role TEXT CHECK(role IN ('admin', 'user')) NOT NULL DEFAULT 'user',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    last_login TIMESTAMPTZ,
+    language TEXT NOT NULL DEFAULT '' CHECK(language IN ('', 'en', 'es', 'fr', 'de')),
+    hide_caller_id BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE devices (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT REFERENCES users(id),
+    name TEXT NOT NULL,
+    username TEXT UNIQUE NOT NULL,
+    password_hash TEXT NOT NULL,
+    device_type TEXT CHECK(device_type IN ('grandstream', 'softphone', 'webrtc', 'linphone')),
+    recording_enabled BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    mac_address TEXT,
+    vendor TEXT,
+    model TEXT,
+    firmware_version TEXT,
+    provisioning_status TEXT DEFAULT 'unknown' CHECK(provisioning_status IN ('pending', 'provisioned', 'failed', 'unknown')),
+    last_config_fetch TIMESTAMPTZ,
+    last_registration TIMESTAMPTZ,
+    config_template TEXT,
+    call_waiting BOOLEAN NOT NULL DEFAULT TRUE,
+    intercom_allowed BOOLEAN NOT NULL DEFAULT FALSE,
+    extension TEXT,
+    sip_messaging BOOLEAN NOT NULL DEFAULT FALSE,
+    comfort_noise BOOLEAN NOT NULL DEFAULT TRUE,
+    anonymous_calls BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE INDEX idx_devices_username ON devices(username);
+
+CREATE INDEX idx_devices_user_id ON devices(user_id);
+
+CREATE UNIQUE INDEX idx_devices_extension ON devices(extension) WHERE extension IS NOT NULL;
+
+CREATE TABLE registrations (
+    id BIGSERIAL PRIMARY KEY,
+    device_id BIGINT REFERENCES devices(id) ON DELETE CASCADE,
+    contact TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    user_agent TEXT,
+    ip_address TEXT,
+    transport TEXT CHECK(transport IN ('udp', 'tcp', 'tls', 'ws', 'wss')),
+    last_seen TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_registrations_device ON registrations(device_id);
+
+CREATE INDEX idx_registrations_expires ON registrations(expires_at);
+
+CREATE TABLE dids (
+    id BIGSERIAL PRIMARY KEY,
+    number TEXT UNIQUE NOT NULL,
+    twilio_sid TEXT,
+    name TEXT,
+    sms_enabled BOOLEAN DEFAULT FALSE,
+    voice_enabled BOOLEAN DEFAULT TRUE,
+    anonymous_action TEXT NOT NULL DEFAULT 'allow' CHECK(anonymous_action IN ('allow', 'reject', 'challenge')),
+    language TEXT NOT NULL DEFAULT '' CHECK(language IN ('', 'en', 'es', 'fr', 'de')),
+    timezone TEXT NOT NULL DEFAULT '',
+    messaging_service_sid TEXT NOT NULL DEFAULT '',
+    recording_enabled BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE blocklist (
+    id BIGSERIAL PRIMARY KEY,
+    pattern TEXT NOT NULL,
+    pattern_type TEXT CHECK(pattern_type IN ('exact', 'prefix', 'regex')),
+    reason TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE cdrs (
+    id BIGSERIAL PRIMARY KEY,
+    call_sid TEXT UNIQUE,
+    direction TEXT CHECK(direction IN ('inbound', 'outbound')),
+    from_number TEXT NOT NULL,
+    to_number TEXT NOT NULL,
+    did_id BIGINT REFERENCES dids(id),
+    device_id BIGINT REFERENCES devices(id),
+    started_at TIMESTAMPTZ NOT NULL,
+    answered_at TIMESTAMPTZ,
+    ended_at TIMESTAMPTZ,
+    duration BIGINT DEFAULT 0,
+    disposition TEXT CHECK(disposition IN ('answered', 'voicemail', 'missed', 'blocked', 'busy', 'failed')),
+    recording_url TEXT,
+    spam_score DOUBLE PRECISION,
+    diversion_chain TEXT,
+    internal BOOLEAN NOT NULL DEFAULT FALSE,
+    escalation_timeline TEXT,
+    codec TEXT NOT NULL DEFAULT '',
+    answered_by TEXT NOT NULL DEFAULT '',
+    estimated_cost DOUBLE PRECISION,
+    actual_cost DOUBLE PRECISION
+);
+
+CREATE INDEX idx_cdrs_started ON cdrs(started_at DESC);
+
+CREATE INDEX idx_cdrs_disposition ON cdrs(disposition);
+
+CREATE INDEX idx_cdrs_did ON cdrs(did_id);
+
+CREATE TABLE voicemails (
+    id BIGSERIAL PRIMARY KEY,
+    cdr_id BIGINT REFERENCES cdrs(id),
+    user_id BIGINT REFERENCES users(id),
+    from_number TEXT NOT NULL,
+    audio_url TEXT,
+    transcript TEXT,
+    duration BIGINT DEFAULT 0,
+    is_read BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    size_bytes BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_voicemails_user ON voicemails(user_id);
+
+CREATE INDEX idx_voicemails_read ON voicemails(is_read);
+
+CREATE TABLE messages (
+    id BIGSERIAL PRIMARY KEY,
+    message_sid TEXT UNIQUE,
+    direction TEXT CHECK(direction IN ('inbound', 'outbound')),
+    from_number TEXT NOT NULL,
+    to_number TEXT NOT NULL,
+    did_id BIGINT REFERENCES dids(id),
+    body TEXT,
+    media_urls TEXT,
+    status TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    is_read BOOLEAN DEFAULT FALSE,
+    channel TEXT NOT NULL DEFAULT 'sms',
+    estimated_cost DOUBLE PRECISION,
+    actual_cost DOUBLE PRECISION,
+    error_code BIGINT,
+    error_message TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_messages_created ON messages(created_at DESC);
+
+CREATE INDEX idx_messages_did ON messages(did_id);
+
+CREATE INDEX idx_messages_channel ON messages(channel);
+
+CREATE TABLE provisioning_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    token TEXT UNIQUE NOT NULL,
+    device_id BIGINT REFERENCES devices(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked BOOLEAN DEFAULT FALSE,
+    revoked_at TIMESTAMPTZ,
+    used_count BIGINT DEFAULT 0,
+    max_uses BIGINT DEFAULT 1,
+    ip_restriction TEXT,
+    created_by BIGINT REFERENCES users(id)
+);
+
+CREATE INDEX idx_provisioning_tokens_token ON provisioning_tokens(token);
+
+CREATE INDEX idx_provisioning_tokens_device ON provisioning_tokens(device_id);
+
+CREATE INDEX idx_provisioning_tokens_expires ON provisioning_tokens(expires_at);
+
+CREATE TABLE provisioning_profiles (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    vendor TEXT NOT NULL,
+    model TEXT,
+    description TEXT,
+    config_template TEXT NOT NULL,
+    variables TEXT,
+    is_default BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_provisioning_profiles_vendor ON provisioning_profiles(vendor);
+
+CREATE INDEX idx_provisioning_profiles_vendor_model ON provisioning_profiles(vendor, model);
+
+CREATE TABLE sessions (
+    id BIGSERIAL PRIMARY KEY,
+    token TEXT UNIQUE NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_activity TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    user_agent TEXT,
+    ip_address TEXT
+);
+
+CREATE INDEX idx_sessions_token ON sessions(token);
+
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+
+CREATE INDEX idx_sessions_expires_at ON sessions(expires_at);
+
+CREATE TABLE voicemail_greetings (
+    id BIGSERIAL PRIMARY KEY,
+    did_id BIGINT NOT NULL REFERENCES dids(id) ON DELETE CASCADE,
+    greeting_type TEXT NOT NULL CHECK(greeting_type IN ('standard', 'temporary')),
+    audio_url TEXT NOT NULL,
+    duration BIGINT DEFAULT 0,
+    is_active BOOLEAN DEFAULT FALSE,
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(did_id, greeting_type)
+);
+
+CREATE INDEX idx_voicemail_greetings_did ON voicemail_greetings(did_id);
+
+CREATE TABLE discovered_devices (
+    id BIGSERIAL PRIMARY KEY,
+    mac_address TEXT,
+    ip_address TEXT NOT NULL,
+    vendor TEXT,
+    model TEXT,
+    firmware_version TEXT,
+    source TEXT NOT NULL CHECK(source IN ('mdns', 'ssdp')),
+    banner TEXT,
+    device_id BIGINT REFERENCES devices(id) ON DELETE SET NULL,
+    first_seen TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    last_seen TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_discovered_devices_mac ON discovered_devices(mac_address);
+
+CREATE INDEX idx_discovered_devices_ip ON discovered_devices(ip_address);
+
+CREATE TABLE device_events (
+    id BIGSERIAL PRIMARY KEY,
+    device_id BIGINT REFERENCES devices(id) ON DELETE CASCADE,
+    event_type TEXT CHECK(event_type IN ( 'config_fetch', 'config_fetch_failed', 'registration', 'registration_failed', 'unregistration', 'provision_start', 'provision_complete', 'provision_failed', 'call_start', 'call_end', 'firmware_check', 'firmware_update', 'discovered', 'error', 'warning', 'info' )) NOT NULL,
+    event_data TEXT,
+    ip_address TEXT,
+    user_agent TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_device_events_device ON device_events(device_id);
+
+CREATE INDEX idx_device_events_type ON device_events(event_type);
+
+CREATE INDEX idx_device_events_created ON device_events(created_at);
+
+CREATE TABLE blocklist_feeds (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    url TEXT NOT NULL UNIQUE,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    entry_count BIGINT NOT NULL DEFAULT 0,
+    last_fetched_at TIMESTAMPTZ,
+    last_success_at TIMESTAMPTZ,
+    last_error TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE community_blocklist (
+    feed_id BIGINT NOT NULL REFERENCES blocklist_feeds(id) ON DELETE CASCADE,
+    number TEXT NOT NULL,
+    PRIMARY KEY (feed_id, number)
+);
+
+CREATE INDEX idx_community_blocklist_number ON community_blocklist(number);
+
+CREATE TABLE caller_lists (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    numbers TEXT NOT NULL DEFAULT '[]',
+    alert_info TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE device_dids (
+    device_id BIGINT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    did_id BIGINT NOT NULL REFERENCES dids(id) ON DELETE CASCADE,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (device_id, did_id)
+);
+
+CREATE TABLE device_did_memory (
+    device_id BIGINT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    destination TEXT NOT NULL,
+    did_id BIGINT NOT NULL REFERENCES dids(id) ON DELETE CASCADE,
+    used_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (device_id, destination)
+);
+
+CREATE TABLE voicemail_feeds (
+    did_id BIGINT PRIMARY KEY REFERENCES dids(id) ON DELETE CASCADE,
+    token TEXT UNIQUE NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    last_fetched_at TIMESTAMPTZ
+);
+
+CREATE TABLE user_notification_settings (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    push_token TEXT NOT NULL DEFAULT '',
+    quiet_hours_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    quiet_start TEXT NOT NULL DEFAULT '22:00',
+    quiet_end TEXT NOT NULL DEFAULT '07:00',
+    timezone TEXT NOT NULL DEFAULT '',
+    vip_breakthrough BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE announcements (
+    id BIGSERIAL PRIMARY KEY,
+    level TEXT NOT NULL DEFAULT 'info',
+    title TEXT NOT NULL DEFAULT '',
+    message TEXT NOT NULL,
+    source TEXT NOT NULL DEFAULT 'admin',
+    system_key TEXT UNIQUE,
+    starts_at TIMESTAMPTZ,
+    ends_at TIMESTAMPTZ,
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE login_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    email TEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    success BOOLEAN NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_login_attempts_created_at ON login_attempts(created_at);
+
+CREATE TABLE login_lockouts (
+    scope TEXT NOT NULL,
+    key TEXT NOT NULL,
+    failures BIGINT NOT NULL DEFAULT 0,
+    lockouts BIGINT NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE TABLE user_calendars (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    url TEXT NOT NULL,
+    username TEXT NOT NULL DEFAULT '',
+    password TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    last_synced_at TIMESTAMPTZ,
+    last_error TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE calendar_busy_blocks (
+    calendar_id BIGINT NOT NULL REFERENCES user_calendars(id) ON DELETE CASCADE,
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_calendar_busy_blocks_calendar ON calendar_busy_blocks(calendar_id, starts_at);
+
+CREATE TABLE auto_replies (
+    id BIGSERIAL PRIMARY KEY,
+    did_id BIGINT REFERENCES dids(id) ON DELETE CASCADE,
+    trigger_type TEXT CHECK(trigger_type IN ('dnd', 'after_hours', 'keyword', 'always', 'calendar_busy')),
+    trigger_data TEXT,
+    reply_text TEXT NOT NULL,
+    enabled BOOLEAN DEFAULT TRUE
+);
+
+CREATE TABLE oncall_schedules (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    timezone TEXT NOT NULL DEFAULT '',
+    levels TEXT NOT NULL DEFAULT '[]',
+    ical_token TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE oncall_overrides (
+    id BIGSERIAL PRIMARY KEY,
+    schedule_id BIGINT NOT NULL REFERENCES oncall_schedules(id) ON DELETE CASCADE,
+    level BIGINT NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_oncall_overrides_schedule ON oncall_overrides(schedule_id, ends_at);
+
+CREATE TABLE escalation_policies (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    levels TEXT NOT NULL DEFAULT '[]',
+    repeat BIGINT NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE route_versions (
+    id BIGSERIAL PRIMARY KEY,
+    route_id BIGINT NOT NULL,
+    version BIGINT NOT NULL,
+    change TEXT NOT NULL CHECK(change IN ('created', 'updated', 'reordered', 'deleted', 'rolled_back')),
+    route TEXT NOT NULL,
+    user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    user_email TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(route_id, version)
+);
+
+CREATE INDEX idx_route_versions_created ON route_versions(created_at);
+
+CREATE TABLE change_sets (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    changes TEXT NOT NULL DEFAULT '[]',
+    undo TEXT NOT NULL DEFAULT '[]',
+    apply_at TIMESTAMPTZ NOT NULL,
+    revert_at TIMESTAMPTZ,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'applied', 'reverted', 'cancelled', 'failed')),
+    error TEXT NOT NULL DEFAULT '',
+    applied_at TIMESTAMPTZ,
+    reverted_at TIMESTAMPTZ,
+    user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_change_sets_status ON change_sets(status);
+
+CREATE TABLE routes (
+    id BIGSERIAL PRIMARY KEY,
+    did_id BIGINT REFERENCES dids(id) ON DELETE CASCADE,
+    priority BIGINT NOT NULL DEFAULT 0,
+    name TEXT NOT NULL,
+    condition_type TEXT CHECK(condition_type IN ('time', 'callerid', 'default', 'calendar', 'webhook')),
+    condition_data TEXT,
+    action_type TEXT CHECK(action_type IN ('ring', 'forward', 'voicemail', 'reject', 'oncall', 'escalate', 'split')),
+    action_data TEXT,
+    enabled BOOLEAN DEFAULT TRUE
+);
+
+CREATE INDEX idx_routes_did_priority ON routes(did_id, priority);
+
+CREATE TABLE route_split_counts (
+    route_id BIGINT NOT NULL REFERENCES routes(id) ON DELETE CASCADE,
+    target BIGINT NOT NULL,
+    calls BIGINT NOT NULL DEFAULT 0,
+    last_call_at TIMESTAMPTZ,
+    PRIMARY KEY (route_id, target)
+);
+
+CREATE TABLE voicemail_quotas (
+    did_id BIGINT PRIMARY KEY REFERENCES dids(id) ON DELETE CASCADE,
+    max_messages BIGINT NOT NULL DEFAULT 0,
+    max_mb BIGINT NOT NULL DEFAULT 0,
+    warn_percent BIGINT NOT NULL DEFAULT 80,
+    action TEXT NOT NULL DEFAULT 'reject' CHECK(action IN ('reject', 'delete_oldest')),
+    warned_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE voicemail_box_members (
+    did_id BIGINT NOT NULL REFERENCES dids(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (did_id, user_id)
+);
+
+CREATE INDEX idx_voicemail_box_members_user ON voicemail_box_members(user_id);
+
+CREATE TABLE voicemail_reads (
+    voicemail_id BIGINT NOT NULL REFERENCES voicemails(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    read_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (voicemail_id, user_id)
+);
+
+CREATE TABLE voicemail_assignments (
+    voicemail_id BIGINT PRIMARY KEY REFERENCES voicemails(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    assigned_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    assigned_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_voicemail_assignments_user ON voicemail_assignments(user_id);
+
+CREATE TABLE device_telemetry (
+    id BIGSERIAL PRIMARY KEY,
+    device_id BIGINT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    source TEXT NOT NULL,
+    rtt_ms BIGINT,
+    register_interval_seconds BIGINT,
+    firmware TEXT,
+    uptime_seconds BIGINT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_device_telemetry_device ON device_telemetry(device_id, created_at);
+
+CREATE TABLE trunk_failovers (
+    trunk_sid TEXT PRIMARY KEY,
+    forward_to TEXT,
+    disaster_recovery_url TEXT NOT NULL DEFAULT '',
+    secondary_uri TEXT NOT NULL DEFAULT '',
+    intact BOOLEAN NOT NULL DEFAULT TRUE,
+    problems TEXT,
+    verified_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE number_notes (
+    id BIGSERIAL PRIMARY KEY,
+    number TEXT NOT NULL,
+    user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_number_notes_number ON number_notes(number, created_at);
+
+CREATE TABLE email_queue (
+    id BIGSERIAL PRIMARY KEY,
+    recipient TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    body TEXT NOT NULL,
+    html BOOLEAN NOT NULL DEFAULT FALSE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'dead')),
+    attempts BIGINT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_email_queue_status ON email_queue(status, next_attempt_at);
+
+CREATE TABLE user_preferences (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE TABLE did_webhooks (
+    did_id BIGINT PRIMARY KEY REFERENCES dids(id) ON DELETE CASCADE,
+    phone_number_sid TEXT NOT NULL,
+    base_url TEXT NOT NULL,
+    intact BOOLEAN NOT NULL DEFAULT TRUE,
+    problems TEXT,
+    verified_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE compliance_exports (
+    id BIGSERIAL PRIMARY KEY,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'complete', 'failed')),
+    range_start TIMESTAMPTZ NOT NULL,
+    range_end TIMESTAMPTZ NOT NULL,
+    requested_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    file_name TEXT,
+    calls BIGINT NOT NULL DEFAULT 0,
+    messages BIGINT NOT NULL DEFAULT 0,
+    previous_hash TEXT,
+    head_hash TEXT,
+    file_sha256 TEXT,
+    signature TEXT,
+    error TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_compliance_exports_status ON compliance_exports(status, id);
+
+CREATE TABLE verifications (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    did_id BIGINT REFERENCES dids(id) ON DELETE SET NULL,
+    to_number TEXT NOT NULL,
+    channel TEXT NOT NULL CHECK (channel IN ('sms', 'call')),
+    code_hash TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'canceled', 'failed')),
+    attempts BIGINT NOT NULL DEFAULT 0,
+    sid TEXT,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_verifications_to_number ON verifications(to_number, created_at);
+
+CREATE INDEX idx_verifications_user ON verifications(user_id, created_at);
+
+CREATE TABLE rates (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    rate DOUBLE PRECISION NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    UNIQUE(kind, prefix)
+);
+
+CREATE TABLE recordings (
+    id BIGSERIAL PRIMARY KEY,
+    call_id TEXT NOT NULL,
+    cdr_id BIGINT REFERENCES cdrs(id) ON DELETE SET NULL,
+    file_name TEXT NOT NULL,
+    status TEXT NOT NULL,
+    duration BIGINT NOT NULL DEFAULT 0,
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    started_at TIMESTAMPTZ NOT NULL,
+    ended_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_recordings_call_id ON recordings(call_id);
+
+CREATE INDEX idx_recordings_cdr_id ON recordings(cdr_id);
+
+CREATE TABLE sip_trunks (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    host TEXT NOT NULL,
+    port BIGINT NOT NULL DEFAULT 5060,
+    transport TEXT NOT NULL DEFAULT 'udp' CHECK(transport IN ('udp', 'tcp', 'tls')),
+    domain TEXT NOT NULL DEFAULT '',
+    username TEXT NOT NULL,
+    auth_username TEXT NOT NULL DEFAULT '',
+    password TEXT NOT NULL DEFAULT '',
+    expires BIGINT NOT NULL DEFAULT 3600,
+    register BOOLEAN NOT NULL DEFAULT TRUE,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE short_links (
+    id BIGSERIAL PRIMARY KEY,
+    code TEXT NOT NULL UNIQUE,
+    message_id BIGINT REFERENCES messages(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    last_clicked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_short_links_message ON short_links(message_id);
+
+INSERT INTO config (key, value) VALUES
+    ('tls.enabled', 'false'),
+    ('tls.port', '5061'),
+    ('tls.wss_port', '5081'),
+    ('tls.cert_mode', 'acme'),
+    ('tls.cert_file', ''),
+    ('tls.key_file', ''),
+    ('tls.ca_file', ''),
+    ('tls.min_version', '1.2'),
+    ('tls.client_auth', 'none'),
+    ('acme.email', ''),
+    ('acme.domain', ''),
+    ('acme.domains', ''),
+    ('acme.ca', 'staging'),
+    ('cloudflare.api_token', ''),
+    ('srtp.enabled', 'false'),
+    ('srtp.profile', 'AES_CM_128_HMAC_SHA1_80'),
+    ('tls.cert_expiry', ''),
+    ('tls.cert_issuer', ''),
+    ('tls.last_renewal', ''),
+    ('tls.next_renewal', ''),
+    ('tls.disable_unencrypted', 'false'),
+    ('zrtp.enabled', 'false'),
+    ('zrtp.cache_expiry_days', '90'),
+    ('anonymous_challenge_prompt', 'Please state your name after the tone.'),
+    ('voicemail_greeting_feature_code', '*97'),
+    ('default_language', 'en'),
+    ('discovery_enabled', 'false'),
+    ('provisioning_responder_enabled', 'false'),
+    ('blocklist_feeds_enabled', 'false'),
+    ('blocklist_feed_schedule', '0 */6 * * *');
+
+INSERT INTO provisioning_profiles (name, vendor, model, description, config_template, variables, is_default) VALUES (
+    'Grandstream GXP1760W Default',
+    'grandstream',
+    'GXP1760W',
+    'Default configuration template for Grandstream GXP1760W phones',
+    '<?xml version="1.0" encoding="UTF-8"?>
+<gs_provision version="1">
+    <!-- Account 1 Settings -->
+    <config name="P271" value="{{.SIPServer}}"/>
+    <config name="P47" value="{{.SIPPort}}"/>
+    <config name="P35" value="{{.AuthID}}"/>
+    <config name="P36" value="{{.AuthPassword}}"/>
+    <config name="P3" value="{{.DisplayName}}"/>
+    <config name="P34" value="{{.Username}}"/>
+
+    <!-- Registration Settings -->
+    <config name="P81" value="1"/>
+    <config name="P32" value="300"/>
+
+    <!-- Codec Settings (G.711u preferred) -->
+    <config name="P57" value="0"/>
+    <config name="P58" value="8"/>
+
+    <!-- NAT Settings -->
+    <config name="P52" value="2"/>
+    <config name="P48" value="{{.STUNServer}}"/>
+
+    <!-- Time Settings -->
+    <config name="P64" value="{{.NTPServer}}"/>
+    <config name="P75" value="{{.Timezone}}"/>
+
+    <!-- Dial Plan: extensions dial at once, other numbers after a pause -->
+    <config name="P290" value="{{.DigitMap}}"/>
+    <config name="P85" value="{{.DigitMapTimeout}}"/>
+
+    <!-- Security -->
+    <config name="P2" value="{{.AdminPassword}}"/>
+</gs_provision>',
+    '{"SIPServer": "", "SIPPort": "5060", "AuthID": "", "AuthPassword": "", "DisplayName": "", "Username": "", "STUNServer": "stun.l.google.com", "NTPServer": "pool.ntp.org", "Timezone": "America/New_York", "AdminPassword": ""}',
+    TRUE
+);
+
+INSERT INTO provisioning_profiles (name, vendor, model, description, config_template, variables, is_default) VALUES (
+    'Linphone Default',
+    'linphone',
+    NULL,
+    'Remote provisioning template for Linphone softphone (iOS, Android, Desktop). Supports XML format per Linphone remote provisioning specification.',
+    '<?xml version="1.0" encoding="UTF-8"?>
+<config xmlns="http://www.linphone.org/xsds/lpconfig.xsd"
+        xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"
+        xsi:schemaLocation="http://www.linphone.org/xsds/lpconfig.xsd lpconfig.xsd">
+
+    <!-- Apply settings only once, not on each app restart -->
+    <section name="misc">
+        <entry name="transient_provisioning" overwrite="true">1</entry>
+    </section>
+
+    <!-- SIP Transport Settings -->
+    <section name="sip">
+        <entry name="sip_port" overwrite="true">-1</entry>
+        <entry name="sip_tcp_port" overwrite="true">-1</entry>
+        <entry name="sip_tls_port" overwrite="true">-1</entry>
+        <entry name="default_proxy" overwrite="true">0</entry>
+        <entry name="register_only_when_network_is_up" overwrite="true">1</entry>
+    </section>
+
+    <!-- Proxy/Account Configuration -->
+    <section name="proxy_0">
+        <entry name="reg_proxy" overwrite="true">sip:{{.SIPServer}}:{{.SIPPort}}</entry>
+        <entry name="reg_identity" overwrite="true">sip:{{.Username}}@{{.SIPServer}}</entry>
+        <entry name="reg_expires" overwrite="true">600</entry>
+        <entry name="reg_sendregister" overwrite="true">1</entry>
+        <entry name="publish" overwrite="true">0</entry>
+        <entry name="dial_escape_plus" overwrite="true">0</entry>
+        <entry name="quality_reporting_enabled" overwrite="true">0</entry>
+        <entry name="avpf" overwrite="true">-1</entry>
+        <entry name="avpf_rr_interval" overwrite="true">1</entry>
+        <entry name="nat_policy_ref" overwrite="true">nat_policy_0</entry>
+    </section>
+
+    <!-- Authentication Credentials -->
+    <section name="auth_info_0">
+        <entry name="username" overwrite="true">{{.Username}}</entry>
+        <entry name="userid" overwrite="true">{{.AuthID}}</entry>
+        <entry name="passwd" overwrite="true">{{.AuthPassword}}</entry>
+        <entry name="realm" overwrite="true">{{.SIPServer}}</entry>
+        <entry name="domain" overwrite="true">{{.SIPServer}}</entry>
+        <entry name="algorithm" overwrite="true">MD5</entry>
+    </section>
+
+    <!-- NAT Traversal Policy -->
+    <section name="nat_policy_0">
+        <entry name="stun_server" overwrite="true">{{.STUNServer}}</entry>
+        <entry name="protocols" overwrite="true">stun,ice</entry>
+        <entry name="stun_server_username" overwrite="true"></entry>
+    </section>
+
+    <!-- RTP Settings -->
+    <section name="rtp">
+        <entry name="audio_rtp_port" overwrite="true">7078</entry>
+        <entry name="video_rtp_port" overwrite="true">9078</entry>
+        <entry name="audio_jitt_comp" overwrite="true">60</entry>
+        <entry name="video_jitt_comp" overwrite="true">60</entry>
+        <entry name="nortp_timeout" overwrite="true">30</entry>
+    </section>
+
+    <!-- Audio Codec Preferences (G.711u, G.711a, Opus) -->
+    <section name="audio_codec_0">
+        <entry name="mime" overwrite="true">PCMU</entry>
+        <entry name="rate" overwrite="true">8000</entry>
+        <entry name="channels" overwrite="true">1</entry>
+        <entry name="enabled" overwrite="true">1</entry>
+    </section>
+    <section name="audio_codec_1">
+        <entry name="mime" overwrite="true">PCMA</entry>
+        <entry name="rate" overwrite="true">8000</entry>
+        <entry name="channels" overwrite="true">1</entry>
+        <entry name="enabled" overwrite="true">1</entry>
+    </section>
+    <section name="audio_codec_2">
+        <entry name="mime" overwrite="true">opus</entry>
+        <entry name="rate" overwrite="true">48000</entry>
+        <entry name="channels" overwrite="true">2</entry>
+        <entry name="enabled" overwrite="true">1</entry>
+    </section>
+
+    <!-- Video disabled by default for bandwidth -->
+    <section name="video">
+        <entry name="display" overwrite="true">0</entry>
+        <entry name="capture" overwrite="true">0</entry>
+        <entry name="show_local" overwrite="true">0</entry>
+        <entry name="automatically_initiate" overwrite="true">0</entry>
+        <entry name="automatically_accept" overwrite="true">0</entry>
+    </section>
+
+    <!-- MWI (Message Waiting Indicator) -->
+    <section name="sip">
+        <entry name="subscribe_expires" overwrite="true">600</entry>
+    </section>
+
+</config>',
+    '{"SIPServer": "", "SIPPort": "5060", "AuthID": "", "AuthPassword": "", "DisplayName": "", "Username": "", "STUNServer": "stun.l.google.com:19302"}',
+    TRUE
+)
@@ -0,0 +1,25 @@
+-- Migration 056: Appointment reminders
+-- Reminders texted or called to a contact ahead of an appointment, and
+-- whether the contact confirmed or cancelled it
+CREATE TABLE reminders (
+    id BIGSERIAL PRIMARY KEY,
+    did_id BIGINT NOT NULL REFERENCES dids(id) ON DELETE CASCADE,
+    contact_name TEXT NOT NULL DEFAULT '',
+    to_number TEXT NOT NULL,
+    appointment_at TIMESTAMPTZ NOT NULL,
+    remind_at TIMESTAMPTZ NOT NULL,
+    template TEXT NOT NULL DEFAULT '',
+    channels TEXT NOT NULL DEFAULT '["sms"]',
+    status TEXT NOT NULL DEFAULT 'scheduled' CHECK (status IN ('scheduled', 'sent', 'confirmed', 'cancelled', 'failed')),
+    sent_at TIMESTAMPTZ,
+    responded_at TIMESTAMPTZ,
+    call_sid TEXT,
+    error TEXT,
+    user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_reminders_due ON reminders(status, remind_at);
+
+CREATE INDEX idx_reminders_to_number ON reminders(to_number, appointment_at)
@@ -0,0 +1,20 @@
+-- Migration 057 rollback: Remove tenants
+DROP INDEX idx_devices_extension;
+CREATE UNIQUE INDEX idx_devices_extension ON devices(extension) WHERE extension IS NOT NULL;
+
+DROP INDEX idx_cdrs_tenant;
+DROP INDEX idx_messages_tenant;
+DROP INDEX idx_routes_tenant;
+DROP INDEX idx_dids_tenant;
+DROP INDEX idx_devices_tenant;
+DROP INDEX idx_users_tenant;
+
+ALTER TABLE cdrs DROP COLUMN tenant_id;
+ALTER TABLE messages DROP COLUMN tenant_id;
+ALTER TABLE routes DROP COLUMN tenant_id;
+ALTER TABLE dids DROP COLUMN tenant_id;
+ALTER TABLE devices DROP COLUMN tenant_id;
+ALTER TABLE users DROP COLUMN tenant_id;
+
+DROP TABLE IF EXISTS tenant_config;
+DROP TABLE IF EXISTS tenants
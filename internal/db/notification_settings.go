@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// notificationSettingsColumns is the column list shared by all notification settings queries
+const notificationSettingsColumns = `user_id, email_enabled, push_token, quiet_hours_enabled, quiet_start, quiet_end, timezone, vip_breakthrough, updated_at`
+
+// NotificationSettingsRepository handles database operations for per-user notification settings
+type NotificationSettingsRepository struct {
+	db *sql.DB
+}
+
+// NewNotificationSettingsRepository creates a new NotificationSettingsRepository
+func NewNotificationSettingsRepository(db *sql.DB) *NotificationSettingsRepository {
+	return &NotificationSettingsRepository{db: db}
+}
+
+// DefaultNotificationSettings returns the settings of a user who has not saved any
+func DefaultNotificationSettings(userID int64) *models.NotificationSettings {
+	return &models.NotificationSettings{
+		UserID:          userID,
+		QuietStart:      "22:00",
+		QuietEnd:        "07:00",
+		VIPBreakthrough: true,
+	}
+}
+
+func scanNotificationSettings(row rowScanner) (*models.NotificationSettings, error) {
+	s := &models.NotificationSettings{}
+	err := row.Scan(&s.UserID, &s.EmailEnabled, &s.PushToken, &s.QuietHoursEnabled,
+		&s.QuietStart, &s.QuietEnd, &s.Timezone, &s.VIPBreakthrough, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get retrieves a user's notification settings, returning the defaults when
+// the user has not saved any
+func (r *NotificationSettingsRepository) Get(ctx context.Context, userID int64) (*models.NotificationSettings, error) {
+	s, err := scanNotificationSettings(r.db.QueryRowContext(ctx, `
+		SELECT `+notificationSettingsColumns+` FROM user_notification_settings WHERE user_id = ?
+	`, userID))
+	if err == sql.ErrNoRows {
+		return DefaultNotificationSettings(userID), nil
+	}
+	return s, err
+}
+
+// Save creates or replaces a user's notification settings
+func (r *NotificationSettingsRepository) Save(ctx context.Context, s *models.NotificationSettings) error {
+	s.UpdatedAt = time.Now()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_notification_settings (`+notificationSettingsColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET email_enabled = excluded.email_enabled,
+			push_token = excluded.push_token, quiet_hours_enabled = excluded.quiet_hours_enabled,
+			quiet_start = excluded.quiet_start, quiet_end = excluded.quiet_end,
+			timezone = excluded.timezone, vip_breakthrough = excluded.vip_breakthrough,
+			updated_at = excluded.updated_at
+	`, s.UserID, s.EmailEnabled, s.PushToken, s.QuietHoursEnabled, s.QuietStart, s.QuietEnd,
+		s.Timezone, s.VIPBreakthrough, s.UpdatedAt)
+	return err
+}
+
+// ListSubscribed returns the settings of users with a personal notification channel
+func (r *NotificationSettingsRepository) ListSubscribed(ctx context.Context) ([]*models.NotificationSettings, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+notificationSettingsColumns+` FROM user_notification_settings
+		WHERE email_enabled = TRUE OR push_token != ''
+		ORDER BY user_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var settings []*models.NotificationSettings
+	for rows.Next() {
+		s, err := scanNotificationSettings(rows)
+		if err != nil {
+			return nil, err
+		}
+		settings = append(settings, s)
+	}
+	return settings, rows.Err()
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestNotificationSettingsRepository_SaveAndList(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	user := &models.User{Email: "quiet@example.com", PasswordHash: "hash", Role: "user"}
+	if err := db.Users.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	settings, err := db.NotificationSettings.Get(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get default settings: %v", err)
+	}
+	if settings.EmailEnabled || settings.QuietHoursEnabled || !settings.VIPBreakthrough || settings.QuietStart != "22:00" {
+		t.Errorf("Unexpected default settings %+v", settings)
+	}
+
+	subscribed, err := db.NotificationSettings.ListSubscribed(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list subscribed users: %v", err)
+	}
+	if len(subscribed) != 0 {
+		t.Errorf("Expected no subscribed users, got %d", len(subscribed))
+	}
+
+	settings.EmailEnabled = true
+	settings.QuietHoursEnabled = true
+	settings.QuietStart = "21:30"
+	settings.Timezone = "America/Chicago"
+	if err := db.NotificationSettings.Save(ctx, settings); err != nil {
+		t.Fatalf("Failed to save settings: %v", err)
+	}
+	settings.PushToken = "gotify-app-token"
+	if err := db.NotificationSettings.Save(ctx, settings); err != nil {
+		t.Fatalf("Failed to update settings: %v", err)
+	}
+
+	saved, err := db.NotificationSettings.Get(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get settings: %v", err)
+	}
+	if !saved.EmailEnabled || saved.PushToken != "gotify-app-token" || saved.QuietStart != "21:30" || saved.Timezone != "America/Chicago" {
+		t.Errorf("Settings not saved, got %+v", saved)
+	}
+
+	subscribed, err = db.NotificationSettings.ListSubscribed(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list subscribed users: %v", err)
+	}
+	if len(subscribed) != 1 || subscribed[0].UserID != user.ID {
+		t.Errorf("Expected user %d to be subscribed, got %+v", user.ID, subscribed)
+	}
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrNumberNoteNotFound = errors.New("number note not found")
+
+// NumberNoteRepository handles database operations for notes about external
+// numbers
+type NumberNoteRepository struct {
+	db *sql.DB
+}
+
+// NewNumberNoteRepository creates a new NumberNoteRepository
+func NewNumberNoteRepository(db *sql.DB) *NumberNoteRepository {
+	return &NumberNoteRepository{db: db}
+}
+
+// Create inserts a new note
+func (r *NumberNoteRepository) Create(ctx context.Context, note *models.NumberNote) error {
+	if note.CreatedAt.IsZero() {
+		note.CreatedAt = time.Now()
+	}
+
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO number_notes (number, user_id, body, created_at)
+		VALUES (?, ?, ?, ?)
+		RETURNING id
+	`, note.Number, note.UserID, note.Body, note.CreatedAt).Scan(&note.ID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ListByNumber returns the notes about a number, newest first, with
+// pagination
+func (r *NumberNoteRepository) ListByNumber(ctx context.Context, number string, limit, offset int) ([]*models.NumberNote, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, number, user_id, body, created_at
+		FROM number_notes WHERE number = ?
+		ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?
+	`, number, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []*models.NumberNote
+	for rows.Next() {
+		n := &models.NumberNote{}
+		if err := rows.Scan(&n.ID, &n.Number, &n.UserID, &n.Body, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+// CountByNumber returns how many notes there are about a number
+func (r *NumberNoteRepository) CountByNumber(ctx context.Context, number string) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM number_notes WHERE number = ?`, number).Scan(&count)
+	return count, err
+}
+
+// Delete removes a note about a number
+func (r *NumberNoteRepository) Delete(ctx context.Context, number string, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM number_notes WHERE id = ? AND number = ?`, id, number)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNumberNoteNotFound
+	}
+	return nil
+}
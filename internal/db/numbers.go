@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// NumberRepository handles database operations across the records that
+// refer to external numbers: calls, messages, voicemails and notes
+type NumberRepository struct {
+	db *sql.DB
+}
+
+// NewNumberRepository creates a new NumberRepository
+func NewNumberRepository(db *sql.DB) *NumberRepository {
+	return &NumberRepository{db: db}
+}
+
+// NormalizeE164 returns the E.164 form of a phone number written with
+// common separators, or "" if it isn't one. Numbers without a country code
+// are taken as North American, as Twilio numbers are: 10 digits, or 11
+// starting with 1. Extensions and SIP usernames aren't phone numbers.
+func NormalizeE164(number string) string {
+	number = strings.TrimSpace(number)
+	international := strings.HasPrefix(number, "+")
+
+	var digits strings.Builder
+	for i, ch := range number {
+		switch {
+		case ch >= '0' && ch <= '9':
+			digits.WriteRune(ch)
+		case ch == '+' && i == 0:
+		case ch == ' ' || ch == '-' || ch == '.' || ch == '(' || ch == ')':
+		default:
+			return ""
+		}
+	}
+
+	d := digits.String()
+	switch {
+	case international && len(d) >= 8 && len(d) <= 15 && d[0] != '0':
+		return "+" + d
+	case !international && len(d) == 10:
+		return "+1" + d
+	case !international && len(d) == 11 && d[0] == '1':
+		return "+" + d
+	}
+	return ""
+}
+
+// ListVariants returns every number recorded on a call, message, voicemail
+// or note, with how many of each use it
+func (r *NumberRepository) ListVariants(ctx context.Context) ([]*models.NumberVariant, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT number, SUM(calls), SUM(messages), SUM(voicemails), SUM(notes) FROM (
+			SELECT from_number AS number, 1 AS calls, 0 AS messages, 0 AS voicemails, 0 AS notes FROM cdrs
+			UNION ALL SELECT to_number, 1, 0, 0, 0 FROM cdrs
+			UNION ALL SELECT from_number, 0, 1, 0, 0 FROM messages
+			UNION ALL SELECT to_number, 0, 1, 0, 0 FROM messages
+			UNION ALL SELECT from_number, 0, 0, 1, 0 FROM voicemails
+			UNION ALL SELECT number, 0, 0, 0, 1 FROM number_notes
+		) AS uses WHERE number IS NOT NULL AND number != ''
+		GROUP BY number ORDER BY number
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var variants []*models.NumberVariant
+	for rows.Next() {
+		v := &models.NumberVariant{}
+		if err := rows.Scan(&v.Number, &v.Calls, &v.Messages, &v.Voicemails, &v.Notes); err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+	return variants, rows.Err()
+}
+
+// Duplicates returns the numbers recorded under more than one spelling of
+// the same E.164 number
+func (r *NumberRepository) Duplicates(ctx context.Context) ([]*models.DuplicateNumber, error) {
+	variants, err := r.ListVariants(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*models.DuplicateNumber)
+	for _, v := range variants {
+		e164 := NormalizeE164(v.Number)
+		if e164 == "" {
+			continue
+		}
+		group, ok := groups[e164]
+		if !ok {
+			group = &models.DuplicateNumber{Number: e164}
+			groups[e164] = group
+		}
+		group.Variants = append(group.Variants, v)
+	}
+
+	duplicates := []*models.DuplicateNumber{}
+	for _, group := range groups {
+		if len(group.Variants) > 1 {
+			duplicates = append(duplicates, group)
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		return duplicates[i].Number < duplicates[j].Number
+	})
+	return duplicates, nil
+}
+
+// Merge re-links the calls, messages, voicemails and notes recorded under
+// other spellings of a number to the surviving one, all or nothing
+func (r *NumberRepository) Merge(ctx context.Context, into string, numbers []string) (*models.NumberMerge, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	merge := &models.NumberMerge{Number: into, Merged: []string{}}
+	relink := func(count *int, query string, args ...interface{}) error {
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		*count += int(affected)
+		return nil
+	}
+
+	for _, number := range numbers {
+		if number == into {
+			continue
+		}
+		if err := relink(&merge.Calls, `
+			UPDATE cdrs SET
+				from_number = CASE WHEN from_number = ? THEN ? ELSE from_number END,
+				to_number = CASE WHEN to_number = ? THEN ? ELSE to_number END
+			WHERE from_number = ? OR to_number = ?
+		`, number, into, number, into, number, number); err != nil {
+			return nil, err
+		}
+		if err := relink(&merge.Messages, `
+			UPDATE messages SET
+				from_number = CASE WHEN from_number = ? THEN ? ELSE from_number END,
+				to_number = CASE WHEN to_number = ? THEN ? ELSE to_number END
+			WHERE from_number = ? OR to_number = ?
+		`, number, into, number, into, number, number); err != nil {
+			return nil, err
+		}
+		if err := relink(&merge.Voicemails, `UPDATE voicemails SET from_number = ? WHERE from_number = ?`, into, number); err != nil {
+			return nil, err
+		}
+		if err := relink(&merge.Notes, `UPDATE number_notes SET number = ? WHERE number = ?`, into, number); err != nil {
+			return nil, err
+		}
+		merge.Merged = append(merge.Merged, number)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return merge, nil
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestNormalizeE164(t *testing.T) {
+	tests := []struct {
+		number string
+		want   string
+	}{
+		{"+15559876543", "+15559876543"},
+		{"+1 (555) 987-6543", "+15559876543"},
+		{"5559876543", "+15559876543"},
+		{"555.987.6543", "+15559876543"},
+		{"15559876543", "+15559876543"},
+		{"+442071838750", "+442071838750"},
+		{"201", ""},
+		{"alice", ""},
+		{"25559876543", ""},
+		{"+0123456789", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeE164(tt.number); got != tt.want {
+			t.Errorf("NormalizeE164(%q) = %q, want %q", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestNumberRepository_Merge(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	for i, from := range []string{"+15559876543", "(555) 987-6543", "201"} {
+		cdr := &models.CDR{CallSID: "CA" + string(rune('a'+i)), Direction: "inbound", FromNumber: from, ToNumber: "+15551230000", Disposition: "answered"}
+		if err := db.CDRs.Create(ctx, cdr); err != nil {
+			t.Fatalf("Failed to create CDR: %v", err)
+		}
+	}
+	msg := &models.Message{Direction: "outbound", FromNumber: "+15551230000", ToNumber: "555-987-6543", Body: "Hi", Status: "sent"}
+	if err := db.Messages.Create(ctx, msg); err != nil {
+		t.Fatalf("Failed to create message: %v", err)
+	}
+	if err := db.NumberNotes.Create(ctx, &models.NumberNote{Number: "(555) 987-6543", Body: "VIP"}); err != nil {
+		t.Fatalf("Failed to create note: %v", err)
+	}
+
+	duplicates, err := db.Numbers.Duplicates(ctx)
+	if err != nil || len(duplicates) != 1 {
+		t.Fatalf("Duplicates = %+v, %v; want one number", duplicates, err)
+	}
+	if d := duplicates[0]; d.Number != "+15559876543" || len(d.Variants) != 3 {
+		t.Fatalf("Unexpected duplicate %+v", d)
+	}
+
+	merge, err := db.Numbers.Merge(ctx, "+15559876543", []string{"(555) 987-6543", "555-987-6543"})
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if merge.Calls != 1 || merge.Messages != 1 || merge.Voicemails != 0 || merge.Notes != 1 {
+		t.Errorf("Unexpected merge %+v", merge)
+	}
+
+	if duplicates, _ := db.Numbers.Duplicates(ctx); len(duplicates) != 0 {
+		t.Errorf("Expected no duplicates after merging, got %+v", duplicates)
+	}
+	if calls, _ := db.CDRs.Count(ctx, CDRFilter{Number: "+15559876543"}); calls != 2 {
+		t.Errorf("Expected both calls under the surviving number, got %d", calls)
+	}
+	if stored, _ := db.Messages.GetByID(ctx, msg.ID); stored.ToNumber != "+15559876543" || stored.FromNumber != "+15551230000" {
+		t.Errorf("Message not re-linked: %+v", stored)
+	}
+}
@@ -0,0 +1,224 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var (
+	ErrOnCallScheduleNotFound = errors.New("on-call schedule not found")
+	ErrOnCallOverrideNotFound = errors.New("on-call override not found")
+)
+
+// OnCallRepository handles database operations for on-call schedules and their overrides
+type OnCallRepository struct {
+	db *sql.DB
+}
+
+// NewOnCallRepository creates a new OnCallRepository
+func NewOnCallRepository(db *sql.DB) *OnCallRepository {
+	return &OnCallRepository{db: db}
+}
+
+const onCallScheduleColumns = `id, name, timezone, levels, ical_token, created_at, updated_at`
+
+func scanOnCallSchedule(row rowScanner) (*models.OnCallSchedule, error) {
+	s := &models.OnCallSchedule{}
+	var levels []byte
+	if err := row.Scan(&s.ID, &s.Name, &s.Timezone, &levels, &s.ICalToken, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(levels, &s.Levels); err != nil {
+		return nil, err
+	}
+	if s.Levels == nil {
+		s.Levels = []models.OnCallLevel{}
+	}
+	return s, nil
+}
+
+// Create inserts a new on-call schedule with a fresh iCal feed token
+func (r *OnCallRepository) Create(ctx context.Context, s *models.OnCallSchedule) error {
+	levels, err := marshalOnCallLevels(s.Levels)
+	if err != nil {
+		return err
+	}
+	token, err := GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO oncall_schedules (name, timezone, levels, ical_token, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, s.Name, s.Timezone, levels, token, now, now).Scan(&s.ID); err != nil {
+		return err
+	}
+	s.ICalToken = token
+	s.CreatedAt = now
+	s.UpdatedAt = now
+	return nil
+}
+
+// GetByID retrieves an on-call schedule by ID
+func (r *OnCallRepository) GetByID(ctx context.Context, id int64) (*models.OnCallSchedule, error) {
+	s, err := scanOnCallSchedule(r.db.QueryRowContext(ctx, `
+		SELECT `+onCallScheduleColumns+` FROM oncall_schedules WHERE id = ?
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrOnCallScheduleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetByToken retrieves an on-call schedule by its secret iCal feed token
+func (r *OnCallRepository) GetByToken(ctx context.Context, token string) (*models.OnCallSchedule, error) {
+	s, err := scanOnCallSchedule(r.db.QueryRowContext(ctx, `
+		SELECT `+onCallScheduleColumns+` FROM oncall_schedules WHERE ical_token = ?
+	`, token))
+	if err == sql.ErrNoRows {
+		return nil, ErrOnCallScheduleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// List returns all on-call schedules in creation order
+func (r *OnCallRepository) List(ctx context.Context) ([]*models.OnCallSchedule, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+onCallScheduleColumns+` FROM oncall_schedules ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []*models.OnCallSchedule
+	for rows.Next() {
+		s, err := scanOnCallSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// Update updates a schedule's name, timezone and levels
+func (r *OnCallRepository) Update(ctx context.Context, s *models.OnCallSchedule) error {
+	levels, err := marshalOnCallLevels(s.Levels)
+	if err != nil {
+		return err
+	}
+
+	s.UpdatedAt = time.Now()
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE oncall_schedules SET name = ?, timezone = ?, levels = ?, updated_at = ?
+		WHERE id = ?
+	`, s.Name, s.Timezone, levels, s.UpdatedAt, s.ID)
+	return err
+}
+
+// RotateToken gives a schedule a new iCal feed token. Subscribers using the
+// previous token lose access.
+func (r *OnCallRepository) RotateToken(ctx context.Context, s *models.OnCallSchedule) error {
+	token, err := GenerateToken()
+	if err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, `UPDATE oncall_schedules SET ical_token = ? WHERE id = ?`, token, s.ID); err != nil {
+		return err
+	}
+	s.ICalToken = token
+	return nil
+}
+
+// Delete removes an on-call schedule and its overrides
+func (r *OnCallRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM oncall_schedules WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrOnCallScheduleNotFound
+	}
+	return nil
+}
+
+const onCallOverrideColumns = `id, schedule_id, level, user_id, starts_at, ends_at, created_at`
+
+func scanOnCallOverride(row rowScanner) (*models.OnCallOverride, error) {
+	o := &models.OnCallOverride{}
+	if err := row.Scan(&o.ID, &o.ScheduleID, &o.Level, &o.UserID, &o.StartsAt, &o.EndsAt, &o.CreatedAt); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// CreateOverride adds an override to a schedule
+func (r *OnCallRepository) CreateOverride(ctx context.Context, o *models.OnCallOverride) error {
+	// Times are stored in UTC so they compare correctly as text
+	now := time.Now()
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO oncall_overrides (schedule_id, level, user_id, starts_at, ends_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, o.ScheduleID, o.Level, o.UserID, o.StartsAt.UTC(), o.EndsAt.UTC(), now).Scan(&o.ID); err != nil {
+		return err
+	}
+	o.CreatedAt = now
+	return nil
+}
+
+// ListOverrides returns a schedule's overrides that end after from, earliest first
+func (r *OnCallRepository) ListOverrides(ctx context.Context, scheduleID int64, from time.Time) ([]*models.OnCallOverride, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+onCallOverrideColumns+` FROM oncall_overrides
+		WHERE schedule_id = ? AND ends_at > ?
+		ORDER BY starts_at, id
+	`, scheduleID, from.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var overrides []*models.OnCallOverride
+	for rows.Next() {
+		o, err := scanOnCallOverride(rows)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, rows.Err()
+}
+
+// DeleteOverride removes an override from a schedule
+func (r *OnCallRepository) DeleteOverride(ctx context.Context, scheduleID, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM oncall_overrides WHERE id = ? AND schedule_id = ?`, id, scheduleID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrOnCallOverrideNotFound
+	}
+	return nil
+}
+
+// marshalOnCallLevels encodes a schedule's levels, storing nil as an empty array
+func marshalOnCallLevels(levels []models.OnCallLevel) ([]byte, error) {
+	if levels == nil {
+		levels = []models.OnCallLevel{}
+	}
+	return json.Marshal(levels)
+}
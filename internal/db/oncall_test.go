@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestOnCallRepository_CRUD(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	user := &models.User{Email: "oncall@example.com", PasswordHash: "hash", Role: "user"}
+	if err := db.Users.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	schedule := &models.OnCallSchedule{
+		Name:   "Ops",
+		Levels: []models.OnCallLevel{{UserIDs: []int64{user.ID}, RotationStart: start, ShiftHours: 168, Timeout: 30}},
+	}
+	if err := db.OnCall.Create(ctx, schedule); err != nil {
+		t.Fatalf("Failed to create schedule: %v", err)
+	}
+	if schedule.ID == 0 || schedule.ICalToken == "" {
+		t.Fatalf("Expected ID and iCal token to be set, got %+v", schedule)
+	}
+
+	got, err := db.OnCall.GetByToken(ctx, schedule.ICalToken)
+	if err != nil {
+		t.Fatalf("Failed to get schedule by token: %v", err)
+	}
+	if got.Name != "Ops" || len(got.Levels) != 1 || got.Levels[0].UserIDs[0] != user.ID || !got.Levels[0].RotationStart.Equal(start) {
+		t.Errorf("Unexpected schedule: %+v", got)
+	}
+
+	oldToken := got.ICalToken
+	if err := db.OnCall.RotateToken(ctx, got); err != nil {
+		t.Fatalf("Failed to rotate token: %v", err)
+	}
+	if _, err := db.OnCall.GetByToken(ctx, oldToken); !errors.Is(err, ErrOnCallScheduleNotFound) {
+		t.Errorf("Expected old token to stop working, got %v", err)
+	}
+
+	now := time.Now()
+	past := &models.OnCallOverride{ScheduleID: schedule.ID, Level: 1, UserID: user.ID, StartsAt: now.Add(-3 * time.Hour), EndsAt: now.Add(-time.Hour)}
+	current := &models.OnCallOverride{ScheduleID: schedule.ID, Level: 1, UserID: user.ID, StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)}
+	for _, o := range []*models.OnCallOverride{past, current} {
+		if err := db.OnCall.CreateOverride(ctx, o); err != nil {
+			t.Fatalf("Failed to create override: %v", err)
+		}
+	}
+
+	overrides, err := db.OnCall.ListOverrides(ctx, schedule.ID, now)
+	if err != nil {
+		t.Fatalf("Failed to list overrides: %v", err)
+	}
+	if len(overrides) != 1 || overrides[0].ID != current.ID {
+		t.Errorf("Expected only the current override, got %+v", overrides)
+	}
+
+	if err := db.OnCall.DeleteOverride(ctx, schedule.ID+1, current.ID); !errors.Is(err, ErrOnCallOverrideNotFound) {
+		t.Errorf("Expected override of another schedule to be not found, got %v", err)
+	}
+	if err := db.OnCall.DeleteOverride(ctx, schedule.ID, current.ID); err != nil {
+		t.Errorf("Failed to delete override: %v", err)
+	}
+
+	if err := db.OnCall.Delete(ctx, schedule.ID); err != nil {
+		t.Fatalf("Failed to delete schedule: %v", err)
+	}
+	if _, err := db.OnCall.GetByID(ctx, schedule.ID); !errors.Is(err, ErrOnCallScheduleNotFound) {
+		t.Errorf("Expected schedule to be deleted, got %v", err)
+	}
+}
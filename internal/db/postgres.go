@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// The repositories are written with SQLite's ? placeholders and store JSON
+// in text columns. postgresConnector hands out connections that rewrite
+// the placeholders to Postgres's $1, $2, ... and send byte slices such as
+// json.RawMessage as text rather than bytea, so the same SQL runs on both.
+type postgresConnector struct {
+	connector *pq.Connector
+}
+
+// newPostgresConnector parses a Postgres connection string
+func newPostgresConnector(dsn string) (*postgresConnector, error) {
+	c, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresConnector{connector: c}, nil
+}
+
+// Connect opens a connection to the server
+func (c *postgresConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresConn{conn: conn}, nil
+}
+
+// Driver returns the driver isPostgres recognizes
+func (c *postgresConnector) Driver() driver.Driver {
+	return postgresDriver{}
+}
+
+// postgresDriver marks connections opened by postgresConnector. Opening by
+// name isn't supported; sql.OpenDB is used with the connector instead.
+type postgresDriver struct{}
+
+// Open is not supported
+func (postgresDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("postgres connections are opened with a connector")
+}
+
+// isPostgres reports whether db is a Postgres database, for the few
+// statements that can't be written the same way for both backends
+func isPostgres(db *sql.DB) bool {
+	_, ok := db.Driver().(postgresDriver)
+	return ok
+}
+
+// postgresConn rebinds the queries of a pq connection
+type postgresConn struct {
+	conn driver.Conn
+}
+
+func (c *postgresConn) Prepare(query string) (driver.Stmt, error) {
+	return c.conn.Prepare(rebind(query))
+}
+
+func (c *postgresConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.conn.(driver.ConnPrepareContext).PrepareContext(ctx, rebind(query))
+}
+
+func (c *postgresConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.conn.(driver.ExecerContext).ExecContext(ctx, rebind(query), args)
+}
+
+func (c *postgresConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.conn.(driver.QueryerContext).QueryContext(ctx, rebind(query), args)
+}
+
+func (c *postgresConn) Begin() (driver.Tx, error) {
+	return c.conn.Begin()
+}
+
+func (c *postgresConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c *postgresConn) Ping(ctx context.Context) error {
+	return c.conn.(driver.Pinger).Ping(ctx)
+}
+
+func (c *postgresConn) ResetSession(ctx context.Context) error {
+	return c.conn.(driver.SessionResetter).ResetSession(ctx)
+}
+
+func (c *postgresConn) IsValid() bool {
+	return c.conn.(driver.Validator).IsValid()
+}
+
+func (c *postgresConn) Close() error {
+	return c.conn.Close()
+}
+
+// CheckNamedValue sends byte slices as text. Everything else is converted
+// as usual.
+func (c *postgresConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if v := reflect.ValueOf(nv.Value); v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+		if v.IsNil() {
+			nv.Value = nil
+		} else {
+			nv.Value = string(v.Bytes())
+		}
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+// rebind replaces the ? placeholders in query with $1, $2, ..., leaving
+// question marks in string literals, quoted identifiers and comments alone
+func rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'' || ch == '"':
+			end := strings.IndexByte(query[i+1:], ch)
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+2])
+			i += end + 1
+		case ch == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end])
+			i += end - 1
+		case ch == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+4])
+			i += end + 3
+		case ch == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
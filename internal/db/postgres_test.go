@@ -0,0 +1,187 @@
+package db
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT * FROM users WHERE id = ?", "SELECT * FROM users WHERE id = $1"},
+		{"INSERT INTO t (a, b) VALUES (?, ?)", "INSERT INTO t (a, b) VALUES ($1, $2)"},
+		{"SELECT '?' FROM t WHERE a = ?", "SELECT '?' FROM t WHERE a = $1"},
+		{"SELECT 'it''s?' FROM t WHERE a = ?", "SELECT 'it''s?' FROM t WHERE a = $1"},
+		{`SELECT "odd?name" FROM t WHERE a = ?`, `SELECT "odd?name" FROM t WHERE a = $1`},
+		{"SELECT a -- why?\nFROM t WHERE a = ?", "SELECT a -- why?\nFROM t WHERE a = $1"},
+		{"SELECT a /* why? */ FROM t WHERE a = ?", "SELECT a /* why? */ FROM t WHERE a = $1"},
+		{"SELECT a FROM t WHERE a = '?", "SELECT a FROM t WHERE a = '?"},
+	}
+	for _, tt := range tests {
+		if got := rebind(tt.query); got != tt.want {
+			t.Errorf("rebind(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestPostgresConnCheckNamedValue(t *testing.T) {
+	conn := &postgresConn{}
+
+	nv := &driver.NamedValue{Value: json.RawMessage(`{"a":1}`)}
+	if err := conn.CheckNamedValue(nv); err != nil || nv.Value != `{"a":1}` {
+		t.Errorf("Expected JSON to be sent as text, got %#v, %v", nv.Value, err)
+	}
+
+	nv = &driver.NamedValue{Value: []byte(nil)}
+	if err := conn.CheckNamedValue(nv); err != nil || nv.Value != nil {
+		t.Errorf("Expected nil bytes to be sent as NULL, got %#v, %v", nv.Value, err)
+	}
+
+	nv = &driver.NamedValue{Value: int64(1)}
+	if err := conn.CheckNamedValue(nv); err != driver.ErrSkip {
+		t.Errorf("Expected other values to be converted as usual, got %v", err)
+	}
+}
+
+// TestPostgresMigrations checks that the Postgres migrations keep up with
+// the SQLite ones, creating the same tables and columns
+func TestPostgresMigrations(t *testing.T) {
+	db := setupTestDB(t)
+
+	want := make(map[string][]string)
+	rows, err := db.conn.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name != 'schema_migrations'")
+	if err != nil {
+		t.Fatalf("Failed to list tables: %v", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		tables = append(tables, name)
+	}
+	rows.Close()
+	for _, table := range tables {
+		cols, err := db.conn.Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table))
+		if err != nil {
+			t.Fatalf("Failed to list columns of %s: %v", table, err)
+		}
+		for cols.Next() {
+			var name string
+			cols.Scan(&name)
+			want[table] = append(want[table], name)
+		}
+		cols.Close()
+		sort.Strings(want[table])
+	}
+
+	got, version := postgresSchema(t)
+	if sqliteVersion := latestMigration(t, "migrations"); version != sqliteVersion {
+		t.Errorf("Expected a Postgres migration for version %d, latest is %d", sqliteVersion, version)
+	}
+	for table, cols := range want {
+		if strings.Join(got[table], ",") != strings.Join(cols, ",") {
+			t.Errorf("Table %s has columns %v in Postgres, want %v", table, got[table], cols)
+		}
+	}
+	for table := range got {
+		if _, ok := want[table]; !ok {
+			t.Errorf("Table %s is only in Postgres", table)
+		}
+	}
+}
+
+var (
+	createTablePattern = regexp.MustCompile(`(?is)CREATE TABLE (\w+) \((.*)\)`)
+	addColumnPattern   = regexp.MustCompile(`(?i)ALTER TABLE (\w+) ADD COLUMN (\w+)`)
+	dropTablePattern   = regexp.MustCompile(`(?i)DROP TABLE (?:IF EXISTS )?(\w+)`)
+)
+
+// postgresSchema returns the columns of each table the Postgres migrations
+// create, and the latest migration version
+func postgresSchema(t *testing.T) (map[string][]string, int) {
+	t.Helper()
+
+	entries, err := migrationsFS.ReadDir("migrations/postgres")
+	if err != nil {
+		t.Fatalf("Failed to read Postgres migrations: %v", err)
+	}
+	schema := make(map[string][]string)
+	version := 0
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".up.sql") {
+			continue
+		}
+		fmt.Sscanf(entry.Name(), "%d_", &version)
+		content, err := migrationsFS.ReadFile("migrations/postgres/" + entry.Name())
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", entry.Name(), err)
+		}
+		for _, stmt := range strings.Split(string(content), ";") {
+			if m := createTablePattern.FindStringSubmatch(stmt); m != nil {
+				schema[m[1]] = nil
+				for _, def := range splitColumns(m[2]) {
+					name := strings.Fields(strings.Replace(def, "(", " (", 1))[0]
+					switch strings.ToUpper(name) {
+					case "PRIMARY", "UNIQUE", "CHECK", "FOREIGN", "CONSTRAINT":
+						continue
+					}
+					schema[m[1]] = append(schema[m[1]], name)
+				}
+			} else if m := addColumnPattern.FindStringSubmatch(stmt); m != nil {
+				schema[m[1]] = append(schema[m[1]], m[2])
+			} else if m := dropTablePattern.FindStringSubmatch(stmt); m != nil {
+				delete(schema, m[1])
+			}
+		}
+	}
+	for _, cols := range schema {
+		sort.Strings(cols)
+	}
+	return schema, version
+}
+
+// splitColumns splits the body of a CREATE TABLE at the commas between
+// column definitions
+func splitColumns(body string) []string {
+	var defs []string
+	depth, start := 0, 0
+	for i, ch := range body {
+		switch ch {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				defs = append(defs, strings.TrimSpace(body[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(defs, strings.TrimSpace(body[start:]))
+}
+
+// latestMigration returns the version of the last migration in dir
+func latestMigration(t *testing.T, dir string) int {
+	t.Helper()
+
+	entries, err := migrationsFS.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", dir, err)
+	}
+	version := 0
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".up.sql") {
+			fmt.Sscanf(entry.Name(), "%d_", &version)
+		}
+	}
+	return version
+}
@@ -29,19 +29,13 @@ func (r *ProvisioningProfileRepository) Create(ctx context.Context, profile *mod
 	profile.CreatedAt = now
 	profile.UpdatedAt = now
 
-	result, err := r.db.ExecContext(ctx, `
+	if err := r.db.QueryRowContext(ctx, `
 		INSERT INTO provisioning_profiles (name, vendor, model, description, config_template, variables, is_default, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, profile.Name, profile.Vendor, profile.Model, profile.Description, profile.ConfigTemplate, profile.Variables, profile.IsDefault, now, now)
-	if err != nil {
-		return err
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
+		RETURNING id
+	`, profile.Name, profile.Vendor, profile.Model, profile.Description, profile.ConfigTemplate, profile.Variables, profile.IsDefault, now, now).Scan(&profile.ID); err != nil {
 		return err
 	}
-	profile.ID = id
 	return nil
 }
 
@@ -50,19 +50,13 @@ func (r *ProvisioningTokenRepository) Create(ctx context.Context, token *models.
 	now := time.Now()
 	token.CreatedAt = now
 
-	result, err := r.db.ExecContext(ctx, `
+	if err := r.db.QueryRowContext(ctx, `
 		INSERT INTO provisioning_tokens (token, device_id, created_at, expires_at, revoked, used_count, max_uses, ip_restriction, created_by)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, token.Token, token.DeviceID, now, token.ExpiresAt, false, 0, token.MaxUses, token.IPRestriction, token.CreatedBy)
-	if err != nil {
-		return err
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
+		RETURNING id
+	`, token.Token, token.DeviceID, now, token.ExpiresAt, false, 0, token.MaxUses, token.IPRestriction, token.CreatedBy).Scan(&token.ID); err != nil {
 		return err
 	}
-	token.ID = id
 	return nil
 }
 
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// Rate kinds
+const (
+	RateKindCall = "call"
+	RateKindSMS  = "sms"
+	RateKindMMS  = "mms"
+)
+
+// RateRepository handles database operations for the cost rate table
+type RateRepository struct {
+	db *sql.DB
+}
+
+// NewRateRepository creates a new RateRepository
+func NewRateRepository(db *sql.DB) *RateRepository {
+	return &RateRepository{db: db}
+}
+
+// List returns all rates ordered by kind and prefix
+func (r *RateRepository) List(ctx context.Context) ([]*models.Rate, error) {
+	return r.list(ctx, `
+		SELECT id, kind, prefix, rate, description
+		FROM rates
+		ORDER BY kind, prefix
+	`)
+}
+
+// ListMatching returns the rates of a kind whose prefix starts a number's
+// digits, longest prefix first
+func (r *RateRepository) ListMatching(ctx context.Context, kind, digits string) ([]*models.Rate, error) {
+	return r.list(ctx, `
+		SELECT id, kind, prefix, rate, description
+		FROM rates
+		WHERE kind = ? AND substr(?, 1, length(prefix)) = prefix
+		ORDER BY length(prefix) DESC
+	`, kind, digits)
+}
+
+func (r *RateRepository) list(ctx context.Context, query string, args ...interface{}) ([]*models.Rate, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []*models.Rate
+	for rows.Next() {
+		rate := &models.Rate{}
+		if err := rows.Scan(&rate.ID, &rate.Kind, &rate.Prefix, &rate.Rate, &rate.Description); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
+
+// Replace swaps the whole rate table for a new one; a later entry for the
+// same kind and prefix wins
+func (r *RateRepository) Replace(ctx context.Context, rates []*models.Rate) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM rates`); err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO rates (kind, prefix, rate, description) VALUES (?, ?, ?, ?)
+		ON CONFLICT(kind, prefix) DO UPDATE SET rate = excluded.rate, description = excluded.description
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, rate := range rates {
+		if _, err := stmt.ExecContext(ctx, rate.Kind, rate.Prefix, rate.Rate, rate.Description); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteAll empties the rate table
+func (r *RateRepository) DeleteAll(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM rates`)
+	return err
+}
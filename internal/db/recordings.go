@@ -0,0 +1,187 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrRecordingNotFound = errors.New("recording not found")
+
+// Recording statuses
+const (
+	RecordingInProgress = "recording"
+	RecordingCompleted  = "completed"
+	RecordingFailed     = "failed"
+)
+
+// RecordingRepository handles database operations for server-side call
+// recordings
+type RecordingRepository struct {
+	db *sql.DB
+}
+
+// NewRecordingRepository creates a new RecordingRepository
+func NewRecordingRepository(db *sql.DB) *RecordingRepository {
+	return &RecordingRepository{db: db}
+}
+
+const recordingColumns = `id, call_id, cdr_id, file_name, status, duration, size_bytes, checksum, started_at, ended_at`
+
+func scanRecording(row rowScanner) (*models.Recording, error) {
+	rec := &models.Recording{}
+	var cdrID sql.NullInt64
+	var endedAt sql.NullTime
+	if err := row.Scan(&rec.ID, &rec.CallID, &cdrID, &rec.FileName, &rec.Status, &rec.Duration, &rec.SizeBytes,
+		&rec.Checksum, &rec.StartedAt, &endedAt); err != nil {
+		return nil, err
+	}
+	if cdrID.Valid {
+		rec.CDRID = &cdrID.Int64
+	}
+	if endedAt.Valid {
+		rec.EndedAt = &endedAt.Time
+	}
+	return rec, nil
+}
+
+// RecordingFilter narrows a recording listing
+type RecordingFilter struct {
+	CallID string
+	CDRID  *int64
+	Limit  int
+	Offset int
+}
+
+// Create adds a recording that has just started
+func (r *RecordingRepository) Create(ctx context.Context, rec *models.Recording) error {
+	rec.Status = RecordingInProgress
+	if rec.StartedAt.IsZero() {
+		rec.StartedAt = time.Now()
+	}
+
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO recordings (call_id, file_name, status, started_at)
+		VALUES (?, ?, ?, ?)
+		RETURNING id
+	`, rec.CallID, rec.FileName, rec.Status, rec.StartedAt).Scan(&rec.ID)
+}
+
+// Finish records how a recording ended: its status, length, size and
+// checksum
+func (r *RecordingRepository) Finish(ctx context.Context, rec *models.Recording) error {
+	if rec.EndedAt == nil {
+		now := time.Now()
+		rec.EndedAt = &now
+	}
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE recordings SET status = ?, duration = ?, size_bytes = ?, checksum = ?, ended_at = ? WHERE id = ?
+	`, rec.Status, rec.Duration, rec.SizeBytes, rec.Checksum, rec.EndedAt, rec.ID)
+	return err
+}
+
+// SetChecksum records the checksum of a recording's file
+func (r *RecordingRepository) SetChecksum(ctx context.Context, id int64, checksum string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE recordings SET checksum = ? WHERE id = ?`, checksum, id)
+	return err
+}
+
+// SetCDR links a recording to the CDR of its call
+func (r *RecordingRepository) SetCDR(ctx context.Context, id, cdrID int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE recordings SET cdr_id = ? WHERE id = ?`, cdrID, id)
+	return err
+}
+
+// FailUnfinished marks recordings still in progress as failed. Recordings
+// can't outlive the server, so these were cut off by a restart.
+func (r *RecordingRepository) FailUnfinished(ctx context.Context) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE recordings SET status = ?, ended_at = ? WHERE status = ?
+	`, RecordingFailed, time.Now(), RecordingInProgress)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetByID retrieves a recording
+func (r *RecordingRepository) GetByID(ctx context.Context, id int64) (*models.Recording, error) {
+	rec, err := scanRecording(r.db.QueryRowContext(ctx, `SELECT `+recordingColumns+` FROM recordings WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrRecordingNotFound
+	}
+	return rec, err
+}
+
+// where returns the conditions of a recording filter
+func (f RecordingFilter) where() (string, []interface{}) {
+	query := " WHERE 1=1"
+	args := []interface{}{}
+
+	if f.CallID != "" {
+		query += " AND call_id = ?"
+		args = append(args, f.CallID)
+	}
+	if f.CDRID != nil {
+		query += " AND cdr_id = ?"
+		args = append(args, *f.CDRID)
+	}
+	return query, args
+}
+
+// List returns recordings, newest first
+func (r *RecordingRepository) List(ctx context.Context, filter RecordingFilter) ([]*models.Recording, error) {
+	where, args := filter.where()
+	query := `SELECT ` + recordingColumns + ` FROM recordings` + where
+
+	query += " ORDER BY started_at DESC, id DESC"
+
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query += " OFFSET ?"
+		args = append(args, filter.Offset)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recordings []*models.Recording
+	for rows.Next() {
+		rec, err := scanRecording(rows)
+		if err != nil {
+			return nil, err
+		}
+		recordings = append(recordings, rec)
+	}
+	return recordings, rows.Err()
+}
+
+// Count returns the number of recordings matching a filter, ignoring its
+// limit and offset
+func (r *RecordingRepository) Count(ctx context.Context, filter RecordingFilter) (int, error) {
+	where, args := filter.where()
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM recordings`+where, args...).Scan(&count)
+	return count, err
+}
+
+// Delete removes a recording's row; the caller removes its file
+func (r *RecordingRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM recordings WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrRecordingNotFound
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestRecordingRepository_Lifecycle(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	cdr := &models.CDR{CallSID: "call-1@pbx", Direction: "outbound", FromNumber: "101", ToNumber: "102", StartedAt: time.Now(), Disposition: "answered", Internal: true}
+	if err := db.CDRs.Create(ctx, cdr); err != nil {
+		t.Fatalf("Failed to create CDR: %v", err)
+	}
+
+	rec := &models.Recording{CallID: "call-1@pbx", FileName: "20260101-120000-ab12cd34.wav"}
+	if err := db.Recordings.Create(ctx, rec); err != nil {
+		t.Fatalf("Failed to create recording: %v", err)
+	}
+	if rec.Status != RecordingInProgress {
+		t.Errorf("Expected a new recording to be %q, got %q", RecordingInProgress, rec.Status)
+	}
+
+	rec.Status, rec.Duration, rec.SizeBytes = RecordingCompleted, 42, 2688044
+	if err := db.Recordings.Finish(ctx, rec); err != nil {
+		t.Fatalf("Failed to finish recording: %v", err)
+	}
+	if err := db.Recordings.SetCDR(ctx, rec.ID, cdr.ID); err != nil {
+		t.Fatalf("Failed to link recording: %v", err)
+	}
+
+	got, err := db.Recordings.GetByID(ctx, rec.ID)
+	if err != nil {
+		t.Fatalf("Failed to get recording: %v", err)
+	}
+	if got.Status != RecordingCompleted || got.Duration != 42 || got.SizeBytes != 2688044 || got.EndedAt == nil {
+		t.Errorf("Finished recording not stored: %+v", got)
+	}
+	if got.CDRID == nil || *got.CDRID != cdr.ID {
+		t.Errorf("Expected recording linked to CDR %d, got %v", cdr.ID, got.CDRID)
+	}
+
+	list, err := db.Recordings.List(ctx, RecordingFilter{CDRID: &cdr.ID})
+	if err != nil || len(list) != 1 || list[0].ID != rec.ID {
+		t.Errorf("Expected the recording listed for its CDR, got %v (%v)", list, err)
+	}
+	if n, err := db.Recordings.Count(ctx, RecordingFilter{CallID: "call-1@pbx"}); err != nil || n != 1 {
+		t.Errorf("Expected 1 recording counted for the call, got %d (%v)", n, err)
+	}
+	if list, _ := db.Recordings.List(ctx, RecordingFilter{CallID: "other@pbx"}); len(list) != 0 {
+		t.Errorf("Expected no recordings for another call, got %d", len(list))
+	}
+
+	// Deleting the CDR keeps the recording
+	if err := db.CDRs.Delete(ctx, cdr.ID); err != nil {
+		t.Fatalf("Failed to delete CDR: %v", err)
+	}
+	if got, err := db.Recordings.GetByID(ctx, rec.ID); err != nil || got.CDRID != nil {
+		t.Errorf("Expected the recording unlinked from the deleted CDR, got %+v (%v)", got, err)
+	}
+
+	if err := db.Recordings.Delete(ctx, rec.ID); err != nil {
+		t.Fatalf("Failed to delete recording: %v", err)
+	}
+	if _, err := db.Recordings.GetByID(ctx, rec.ID); err != ErrRecordingNotFound {
+		t.Errorf("Expected ErrRecordingNotFound after delete, got %v", err)
+	}
+	if err := db.Recordings.Delete(ctx, rec.ID); err != ErrRecordingNotFound {
+		t.Errorf("Expected ErrRecordingNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestRecordingRepository_FailUnfinished(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	inProgress := &models.Recording{CallID: "a@pbx", FileName: "a.wav"}
+	done := &models.Recording{CallID: "b@pbx", FileName: "b.wav"}
+	for _, rec := range []*models.Recording{inProgress, done} {
+		if err := db.Recordings.Create(ctx, rec); err != nil {
+			t.Fatalf("Failed to create recording: %v", err)
+		}
+	}
+	done.Status = RecordingCompleted
+	if err := db.Recordings.Finish(ctx, done); err != nil {
+		t.Fatalf("Failed to finish recording: %v", err)
+	}
+
+	n, err := db.Recordings.FailUnfinished(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 unfinished recording failed, got %d (%v)", n, err)
+	}
+	if got, _ := db.Recordings.GetByID(ctx, inProgress.ID); got.Status != RecordingFailed || got.EndedAt == nil {
+		t.Errorf("Expected the cut off recording failed, got %+v", got)
+	}
+	if got, _ := db.Recordings.GetByID(ctx, done.ID); got.Status != RecordingCompleted {
+		t.Errorf("Expected the completed recording kept, got %q", got.Status)
+	}
+}
@@ -23,19 +23,13 @@ func NewRegistrationRepository(db *sql.DB) *RegistrationRepository {
 
 // Create inserts a new registration
 func (r *RegistrationRepository) Create(ctx context.Context, reg *models.Registration) error {
-	result, err := r.db.ExecContext(ctx, `
+	if err := r.db.QueryRowContext(ctx, `
 		INSERT INTO registrations (device_id, contact, expires_at, user_agent, ip_address, transport, last_seen)
 		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, reg.DeviceID, reg.Contact, reg.ExpiresAt, reg.UserAgent, reg.IPAddress, reg.Transport, time.Now())
-	if err != nil {
-		return err
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
+		RETURNING id
+	`, reg.DeviceID, reg.Contact, reg.ExpiresAt, reg.UserAgent, reg.IPAddress, reg.Transport, time.Now()).Scan(&reg.ID); err != nil {
 		return err
 	}
-	reg.ID = id
 	return nil
 }
 
@@ -0,0 +1,279 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var (
+	ErrReminderNotFound = errors.New("reminder not found")
+	// ErrReminderState is returned for reminders that can't be changed or
+	// answered in their current status
+	ErrReminderState = errors.New("reminder can't be changed in its current status")
+)
+
+// Reminder statuses
+const (
+	ReminderScheduled = "scheduled"
+	ReminderSent      = "sent"
+	ReminderConfirmed = "confirmed"
+	ReminderCancelled = "cancelled"
+	ReminderFailed    = "failed" // Couldn't be sent, or was due after the appointment
+)
+
+// ReminderRepository handles database operations for appointment reminders.
+// Times are stored in UTC so they compare correctly as SQLite text.
+type ReminderRepository struct {
+	db *sql.DB
+}
+
+// NewReminderRepository creates a new ReminderRepository
+func NewReminderRepository(db *sql.DB) *ReminderRepository {
+	return &ReminderRepository{db: db}
+}
+
+// ReminderFilter narrows a reminder listing to a status and the
+// appointments from From up to To
+type ReminderFilter struct {
+	Status string
+	From   *time.Time
+	To     *time.Time
+	Limit  int
+	Offset int
+}
+
+const reminderColumns = `id, did_id, contact_name, to_number, appointment_at, remind_at, template, channels, status, sent_at, responded_at, call_sid, error, user_id, created_at, updated_at`
+
+func scanReminder(row rowScanner) (*models.Reminder, error) {
+	rem := &models.Reminder{}
+	var channels []byte
+	var sentAt, respondedAt sql.NullTime
+	var callSID, reminderError sql.NullString
+	var userID sql.NullInt64
+	if err := row.Scan(&rem.ID, &rem.DIDID, &rem.ContactName, &rem.ToNumber, &rem.AppointmentAt, &rem.RemindAt, &rem.Template, &channels,
+		&rem.Status, &sentAt, &respondedAt, &callSID, &reminderError, &userID, &rem.CreatedAt, &rem.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(channels, &rem.Channels); err != nil {
+		return nil, err
+	}
+	if sentAt.Valid {
+		rem.SentAt = &sentAt.Time
+	}
+	if respondedAt.Valid {
+		rem.RespondedAt = &respondedAt.Time
+	}
+	rem.CallSID = callSID.String
+	if reminderError.Valid {
+		rem.Error = &reminderError.String
+	}
+	if userID.Valid {
+		rem.UserID = &userID.Int64
+	}
+	return rem, nil
+}
+
+// Create schedules a new reminder
+func (r *ReminderRepository) Create(ctx context.Context, rem *models.Reminder) error {
+	channels, err := json.Marshal(rem.Channels)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	rem.AppointmentAt = rem.AppointmentAt.UTC()
+	rem.RemindAt = rem.RemindAt.UTC()
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO reminders (did_id, contact_name, to_number, appointment_at, remind_at, template, channels, status, user_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, rem.DIDID, rem.ContactName, rem.ToNumber, rem.AppointmentAt, rem.RemindAt, rem.Template, channels, ReminderScheduled, rem.UserID, now, now).Scan(&rem.ID); err != nil {
+		return err
+	}
+	rem.Status = ReminderScheduled
+	rem.CreatedAt = now
+	rem.UpdatedAt = now
+	return nil
+}
+
+// GetByID retrieves a reminder by ID
+func (r *ReminderRepository) GetByID(ctx context.Context, id int64) (*models.Reminder, error) {
+	rem, err := scanReminder(r.db.QueryRowContext(ctx, `SELECT `+reminderColumns+` FROM reminders WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrReminderNotFound
+	}
+	return rem, err
+}
+
+// List returns the reminders matching a filter, the soonest appointment first
+func (r *ReminderRepository) List(ctx context.Context, filter ReminderFilter) ([]*models.Reminder, error) {
+	where, args := reminderWhere(filter)
+	query := `SELECT ` + reminderColumns + ` FROM reminders` + where + ` ORDER BY appointment_at ASC, id ASC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, filter.Limit, filter.Offset)
+	}
+	return r.list(ctx, query, args...)
+}
+
+// Count returns how many reminders match a filter, ignoring its limit
+func (r *ReminderRepository) Count(ctx context.Context, filter ReminderFilter) (int, error) {
+	where, args := reminderWhere(filter)
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM reminders`+where, args...).Scan(&count)
+	return count, err
+}
+
+func reminderWhere(filter ReminderFilter) (string, []interface{}) {
+	where := ` WHERE 1=1`
+	var args []interface{}
+	if filter.Status != "" {
+		where += ` AND status = ?`
+		args = append(args, filter.Status)
+	}
+	if filter.From != nil {
+		where += ` AND appointment_at >= ?`
+		args = append(args, filter.From.UTC())
+	}
+	if filter.To != nil {
+		where += ` AND appointment_at < ?`
+		args = append(args, filter.To.UTC())
+	}
+	return where, args
+}
+
+// ListDue returns the scheduled reminders due to be sent at now, oldest first
+func (r *ReminderRepository) ListDue(ctx context.Context, now time.Time) ([]*models.Reminder, error) {
+	return r.list(ctx, `
+		SELECT `+reminderColumns+` FROM reminders
+		WHERE status = ? AND remind_at <= ?
+		ORDER BY remind_at ASC, id ASC
+	`, ReminderScheduled, now.UTC())
+}
+
+// ListUnconfirmed returns the reminders of appointments from from up to to
+// that haven't been confirmed or cancelled, the soonest first
+func (r *ReminderRepository) ListUnconfirmed(ctx context.Context, from, to time.Time) ([]*models.Reminder, error) {
+	return r.list(ctx, `
+		SELECT `+reminderColumns+` FROM reminders
+		WHERE status IN (?, ?, ?) AND appointment_at >= ? AND appointment_at < ?
+		ORDER BY appointment_at ASC, id ASC
+	`, ReminderScheduled, ReminderSent, ReminderFailed, from.UTC(), to.UTC())
+}
+
+// GetAwaitingReply returns the reminder a reply from a number to a DID
+// answers: the last one sent for an appointment still ahead at now.
+// Confirmed appointments can still be cancelled.
+func (r *ReminderRepository) GetAwaitingReply(ctx context.Context, didID int64, toNumber string, now time.Time) (*models.Reminder, error) {
+	rem, err := scanReminder(r.db.QueryRowContext(ctx, `
+		SELECT `+reminderColumns+` FROM reminders
+		WHERE did_id = ? AND to_number = ? AND status IN (?, ?) AND appointment_at > ?
+		ORDER BY sent_at DESC, id DESC LIMIT 1
+	`, didID, toNumber, ReminderSent, ReminderConfirmed, now.UTC()))
+	if err == sql.ErrNoRows {
+		return nil, ErrReminderNotFound
+	}
+	return rem, err
+}
+
+func (r *ReminderRepository) list(ctx context.Context, query string, args ...interface{}) ([]*models.Reminder, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []*models.Reminder
+	for rows.Next() {
+		rem, err := scanReminder(rows)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, rem)
+	}
+	return reminders, rows.Err()
+}
+
+// Update changes a reminder that hasn't been sent yet
+func (r *ReminderRepository) Update(ctx context.Context, rem *models.Reminder) error {
+	channels, err := json.Marshal(rem.Channels)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	rem.AppointmentAt = rem.AppointmentAt.UTC()
+	rem.RemindAt = rem.RemindAt.UTC()
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE reminders
+		SET did_id = ?, contact_name = ?, to_number = ?, appointment_at = ?, remind_at = ?, template = ?, channels = ?, updated_at = ?
+		WHERE id = ? AND status = ?
+	`, rem.DIDID, rem.ContactName, rem.ToNumber, rem.AppointmentAt, rem.RemindAt, rem.Template, channels, now, rem.ID, ReminderScheduled)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := r.GetByID(ctx, rem.ID); err != nil {
+			return err
+		}
+		return ErrReminderState
+	}
+	rem.UpdatedAt = now
+	return nil
+}
+
+// RecordSend records how sending a scheduled reminder went: status is sent
+// or failed, and sendErr describes the channels that failed
+func (r *ReminderRepository) RecordSend(ctx context.Context, id int64, status, callSID string, sendErr *string, now time.Time) error {
+	var sid interface{}
+	if callSID != "" {
+		sid = callSID
+	}
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE reminders SET status = ?, sent_at = ?, call_sid = ?, error = ?, updated_at = ?
+		WHERE id = ? AND status = ?
+	`, status, now.UTC(), sid, sendErr, now.UTC(), id, ReminderScheduled)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrReminderState
+	}
+	return nil
+}
+
+// Respond records a contact confirming or cancelling a sent reminder's
+// appointment
+func (r *ReminderRepository) Respond(ctx context.Context, id int64, status string, now time.Time) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE reminders SET status = ?, responded_at = ?, updated_at = ?
+		WHERE id = ? AND status IN (?, ?)
+	`, status, now.UTC(), now.UTC(), id, ReminderSent, ReminderConfirmed)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := r.GetByID(ctx, id); err != nil {
+			return err
+		}
+		return ErrReminderState
+	}
+	return nil
+}
+
+// Delete removes a reminder
+func (r *ReminderRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM reminders WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrReminderNotFound
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestReminderRepository(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	did := &models.DID{Number: "+15550001111", SMSEnabled: true}
+	if err := db.DIDs.Create(ctx, did); err != nil {
+		t.Fatalf("Failed to create DID: %v", err)
+	}
+
+	// Times in any zone compare as the instants they are
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	eastern := time.FixedZone("EST", -5*3600)
+	due := &models.Reminder{DIDID: did.ID, ContactName: "Ann", ToNumber: "+15550002222", AppointmentAt: now.Add(24 * time.Hour), RemindAt: now.Add(-time.Minute).In(eastern), Channels: []string{"sms"}}
+	later := &models.Reminder{DIDID: did.ID, ToNumber: "+15550003333", AppointmentAt: now.Add(48 * time.Hour), RemindAt: now.Add(time.Hour).In(eastern), Channels: []string{"sms", "voice"}}
+	for _, rem := range []*models.Reminder{later, due} {
+		if err := db.Reminders.Create(ctx, rem); err != nil {
+			t.Fatalf("Failed to create reminder: %v", err)
+		}
+	}
+
+	list, err := db.Reminders.ListDue(ctx, now)
+	if err != nil {
+		t.Fatalf("Failed to list due reminders: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != due.ID || list[0].Status != ReminderScheduled {
+		t.Fatalf("Expected only the due reminder, got %+v", list)
+	}
+
+	all, err := db.Reminders.List(ctx, ReminderFilter{})
+	if err != nil {
+		t.Fatalf("Failed to list reminders: %v", err)
+	}
+	if len(all) != 2 || all[0].ID != due.ID || len(all[1].Channels) != 2 {
+		t.Errorf("Expected reminders by appointment, got %+v", all)
+	}
+	from := now.Add(36 * time.Hour)
+	if count, err := db.Reminders.Count(ctx, ReminderFilter{Status: ReminderScheduled, From: &from}); err != nil || count != 1 {
+		t.Errorf("Expected one scheduled reminder from %v, got %d, %v", from, count, err)
+	}
+
+	// Nothing awaits a reply until the reminder is sent
+	if _, err := db.Reminders.GetAwaitingReply(ctx, did.ID, due.ToNumber, now); err != ErrReminderNotFound {
+		t.Errorf("Expected ErrReminderNotFound before sending, got %v", err)
+	}
+	if err := db.Reminders.RecordSend(ctx, due.ID, ReminderSent, "", nil, now); err != nil {
+		t.Fatalf("Failed to record send: %v", err)
+	}
+	if err := db.Reminders.RecordSend(ctx, due.ID, ReminderSent, "", nil, now); err != ErrReminderState {
+		t.Errorf("Expected a reminder sent once, got %v", err)
+	}
+	due.ContactName = "Anne"
+	if err := db.Reminders.Update(ctx, due); err != ErrReminderState {
+		t.Errorf("Expected a sent reminder not editable, got %v", err)
+	}
+
+	rem, err := db.Reminders.GetAwaitingReply(ctx, did.ID, due.ToNumber, now)
+	if err != nil || rem.ID != due.ID {
+		t.Fatalf("Expected the sent reminder to await a reply, got %+v, %v", rem, err)
+	}
+	if err := db.Reminders.Respond(ctx, rem.ID, ReminderConfirmed, now); err != nil {
+		t.Fatalf("Failed to confirm: %v", err)
+	}
+	if err := db.Reminders.Respond(ctx, rem.ID, ReminderCancelled, now); err != nil {
+		t.Fatalf("Failed to cancel a confirmed appointment: %v", err)
+	}
+	if err := db.Reminders.Respond(ctx, rem.ID, ReminderConfirmed, now); err != ErrReminderState {
+		t.Errorf("Expected a cancelled appointment to stay cancelled, got %v", err)
+	}
+	rem, _ = db.Reminders.GetByID(ctx, due.ID)
+	if rem.Status != ReminderCancelled || rem.SentAt == nil || rem.RespondedAt == nil {
+		t.Errorf("Unexpected reminder after replies: %+v", rem)
+	}
+
+	unconfirmed, err := db.Reminders.ListUnconfirmed(ctx, now, now.Add(72*time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to list unconfirmed reminders: %v", err)
+	}
+	if len(unconfirmed) != 1 || unconfirmed[0].ID != later.ID {
+		t.Errorf("Expected only the unanswered appointment, got %+v", unconfirmed)
+	}
+
+	if err := db.Reminders.Delete(ctx, later.ID); err != nil {
+		t.Fatalf("Failed to delete reminder: %v", err)
+	}
+	if _, err := db.Reminders.GetByID(ctx, later.ID); err != ErrReminderNotFound {
+		t.Errorf("Expected ErrReminderNotFound, got %v", err)
+	}
+}
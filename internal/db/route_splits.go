@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// RouteSplitRepository handles the distribution counters of split routes
+type RouteSplitRepository struct {
+	db *sql.DB
+}
+
+// NewRouteSplitRepository creates a new RouteSplitRepository
+func NewRouteSplitRepository(db *sql.DB) *RouteSplitRepository {
+	return &RouteSplitRepository{db: db}
+}
+
+// Counts returns the calls each target of a route has received, by target
+// index. Targets that never received a call aren't included.
+func (r *RouteSplitRepository) Counts(ctx context.Context, routeID int64) ([]*models.RouteSplitCount, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT route_id, target, calls, last_call_at FROM route_split_counts
+		WHERE route_id = ? ORDER BY target
+	`, routeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []*models.RouteSplitCount
+	for rows.Next() {
+		c := &models.RouteSplitCount{}
+		var lastCallAt sql.NullTime
+		if err := rows.Scan(&c.RouteID, &c.Target, &c.Calls, &lastCallAt); err != nil {
+			return nil, err
+		}
+		if lastCallAt.Valid {
+			c.LastCallAt = &lastCallAt.Time
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// Increment counts a call sent to a target of a route
+func (r *RouteSplitRepository) Increment(ctx context.Context, routeID int64, target int, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO route_split_counts (route_id, target, calls, last_call_at) VALUES (?, ?, 1, ?)
+		ON CONFLICT(route_id, target) DO UPDATE SET calls = calls + 1, last_call_at = excluded.last_call_at
+	`, routeID, target, at)
+	return err
+}
+
+// Reset clears the counters of a route
+func (r *RouteSplitRepository) Reset(ctx context.Context, routeID int64) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM route_split_counts WHERE route_id = ?`, routeID)
+	return err
+}
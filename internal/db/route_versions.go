@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrRouteVersionNotFound = errors.New("route version not found")
+
+// RouteVersionsKept is how many versions of each route are kept
+const RouteVersionsKept = 100
+
+// RouteVersionRepository handles database operations for route version history
+type RouteVersionRepository struct {
+	db *sql.DB
+}
+
+// NewRouteVersionRepository creates a new RouteVersionRepository
+func NewRouteVersionRepository(db *sql.DB) *RouteVersionRepository {
+	return &RouteVersionRepository{db: db}
+}
+
+const routeVersionColumns = `id, route_id, version, change, route, user_id, user_email, created_at`
+
+func scanRouteVersion(row rowScanner) (*models.RouteVersion, error) {
+	v := &models.RouteVersion{}
+	var route []byte
+	var userID sql.NullInt64
+	if err := row.Scan(&v.ID, &v.RouteID, &v.Version, &v.Change, &route, &userID, &v.UserEmail, &v.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(route, &v.Route); err != nil {
+		return nil, err
+	}
+	if userID.Valid {
+		v.UserID = &userID.Int64
+	}
+	return v, nil
+}
+
+// Record saves a copy of route as its next version, made by user (nil for
+// changes the system made). Versions beyond RouteVersionsKept are removed.
+func (r *RouteVersionRepository) Record(ctx context.Context, change string, route *models.Route, user *models.User) (*models.RouteVersion, error) {
+	var userID *int64
+	var email string
+	if user != nil {
+		userID, email = &user.ID, user.Email
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	v, err := recordRouteVersion(ctx, tx, change, route, userID, email)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// recordRouteVersion saves a route version within a transaction
+func recordRouteVersion(ctx context.Context, tx *sql.Tx, change string, route *models.Route, userID *int64, email string) (*models.RouteVersion, error) {
+	data, err := json.Marshal(route)
+	if err != nil {
+		return nil, err
+	}
+	v := &models.RouteVersion{
+		RouteID:   route.ID,
+		Change:    change,
+		Route:     *route,
+		UserID:    userID,
+		UserEmail: email,
+		CreatedAt: time.Now(),
+	}
+
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(version), 0) + 1 FROM route_versions WHERE route_id = ?
+	`, route.ID).Scan(&v.Version); err != nil {
+		return nil, err
+	}
+
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO route_versions (route_id, version, change, route, user_id, user_email, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, v.RouteID, v.Version, v.Change, data, v.UserID, v.UserEmail, v.CreatedAt).Scan(&v.ID); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM route_versions WHERE route_id = ? AND version <= ?
+	`, route.ID, v.Version-RouteVersionsKept); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Get retrieves one version of a route
+func (r *RouteVersionRepository) Get(ctx context.Context, routeID int64, version int) (*models.RouteVersion, error) {
+	v, err := scanRouteVersion(r.db.QueryRowContext(ctx, `
+		SELECT `+routeVersionColumns+` FROM route_versions WHERE route_id = ? AND version = ?
+	`, routeID, version))
+	if err == sql.ErrNoRows {
+		return nil, ErrRouteVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// ListByRoute returns the versions of a route, newest first
+func (r *RouteVersionRepository) ListByRoute(ctx context.Context, routeID int64) ([]*models.RouteVersion, error) {
+	return r.list(ctx, `
+		SELECT `+routeVersionColumns+` FROM route_versions WHERE route_id = ? ORDER BY version DESC
+	`, routeID)
+}
+
+// ListRecent returns the latest changes to any route, including deleted
+// ones, newest first
+func (r *RouteVersionRepository) ListRecent(ctx context.Context, limit int) ([]*models.RouteVersion, error) {
+	return r.list(ctx, `
+		SELECT `+routeVersionColumns+` FROM route_versions ORDER BY created_at DESC, id DESC LIMIT ?
+	`, limit)
+}
+
+func (r *RouteVersionRepository) list(ctx context.Context, query string, args ...interface{}) ([]*models.RouteVersion, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []*models.RouteVersion{}
+	for rows.Next() {
+		v, err := scanRouteVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
@@ -20,21 +20,15 @@ func NewRouteRepository(db *sql.DB) *RouteRepository {
 	return &RouteRepository{db: db}
 }
 
-// Create inserts a new route
+// Create inserts a new route. A route belongs to the tenant of its DID.
 func (r *RouteRepository) Create(ctx context.Context, route *models.Route) error {
-	result, err := r.db.ExecContext(ctx, `
-		INSERT INTO routes (did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, route.DIDID, route.Priority, route.Name, route.ConditionType, route.ConditionData, route.ActionType, route.ActionData, route.Enabled)
-	if err != nil {
-		return err
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO routes (did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled, tenant_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, (SELECT tenant_id FROM dids WHERE id = ?))
+		RETURNING id, tenant_id
+	`, route.DIDID, route.Priority, route.Name, route.ConditionType, route.ConditionData, route.ActionType, route.ActionData, route.Enabled, route.DIDID).Scan(&route.ID, &route.TenantID); err != nil {
 		return err
 	}
-	route.ID = id
 	return nil
 }
 
@@ -44,9 +38,9 @@ func (r *RouteRepository) GetByID(ctx context.Context, id int64) (*models.Route,
 	var didID sql.NullInt64
 	var conditionData, actionData []byte
 	err := r.db.QueryRowContext(ctx, `
-		SELECT id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled
+		SELECT id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled, tenant_id
 		FROM routes WHERE id = ?
-	`, id).Scan(&route.ID, &didID, &route.Priority, &route.Name, &route.ConditionType, &conditionData, &route.ActionType, &actionData, &route.Enabled)
+	`, id).Scan(&route.ID, &didID, &route.Priority, &route.Name, &route.ConditionType, &conditionData, &route.ActionType, &actionData, &route.Enabled, &route.TenantID)
 	if err == sql.ErrNoRows {
 		return nil, ErrRouteNotFound
 	}
@@ -65,9 +59,23 @@ func (r *RouteRepository) GetByID(ctx context.Context, id int64) (*models.Route,
 func (r *RouteRepository) Update(ctx context.Context, route *models.Route) error {
 	_, err := r.db.ExecContext(ctx, `
 		UPDATE routes SET did_id = ?, priority = ?, name = ?, condition_type = ?,
-		condition_data = ?, action_type = ?, action_data = ?, enabled = ?
+		condition_data = ?, action_type = ?, action_data = ?, enabled = ?,
+		tenant_id = (SELECT tenant_id FROM dids WHERE id = ?)
 		WHERE id = ?
-	`, route.DIDID, route.Priority, route.Name, route.ConditionType, route.ConditionData, route.ActionType, route.ActionData, route.Enabled, route.ID)
+	`, route.DIDID, route.Priority, route.Name, route.ConditionType, route.ConditionData, route.ActionType, route.ActionData, route.Enabled, route.DIDID, route.ID)
+	return err
+}
+
+// Restore writes route back under its own ID, recreating it if it was deleted
+func (r *RouteRepository) Restore(ctx context.Context, route *models.Route) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO routes (id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled, tenant_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, (SELECT tenant_id FROM dids WHERE id = ?))
+		ON CONFLICT(id) DO UPDATE SET did_id = excluded.did_id, priority = excluded.priority,
+		name = excluded.name, condition_type = excluded.condition_type, condition_data = excluded.condition_data,
+		action_type = excluded.action_type, action_data = excluded.action_data, enabled = excluded.enabled,
+		tenant_id = excluded.tenant_id
+	`, route.ID, route.DIDID, route.Priority, route.Name, route.ConditionType, route.ConditionData, route.ActionType, route.ActionData, route.Enabled, route.DIDID)
 	return err
 }
 
@@ -80,7 +88,7 @@ func (r *RouteRepository) Delete(ctx context.Context, id int64) error {
 // GetByDID returns all routes for a specific DID, ordered by priority
 func (r *RouteRepository) GetByDID(ctx context.Context, didID int64) ([]*models.Route, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled
+		SELECT id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled, tenant_id
 		FROM routes WHERE did_id = ? ORDER BY priority ASC
 	`, didID)
 	if err != nil {
@@ -93,7 +101,7 @@ func (r *RouteRepository) GetByDID(ctx context.Context, didID int64) ([]*models.
 		route := &models.Route{}
 		var nullDIDID sql.NullInt64
 		var conditionData, actionData []byte
-		if err := rows.Scan(&route.ID, &nullDIDID, &route.Priority, &route.Name, &route.ConditionType, &conditionData, &route.ActionType, &actionData, &route.Enabled); err != nil {
+		if err := rows.Scan(&route.ID, &nullDIDID, &route.Priority, &route.Name, &route.ConditionType, &conditionData, &route.ActionType, &actionData, &route.Enabled, &route.TenantID); err != nil {
 			return nil, err
 		}
 		if nullDIDID.Valid {
@@ -109,8 +117,8 @@ func (r *RouteRepository) GetByDID(ctx context.Context, didID int64) ([]*models.
 // GetEnabledByDID returns all enabled routes for a specific DID, ordered by priority
 func (r *RouteRepository) GetEnabledByDID(ctx context.Context, didID int64) ([]*models.Route, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled
-		FROM routes WHERE did_id = ? AND enabled = 1 ORDER BY priority ASC
+		SELECT id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled, tenant_id
+		FROM routes WHERE did_id = ? AND enabled = TRUE ORDER BY priority ASC
 	`, didID)
 	if err != nil {
 		return nil, err
@@ -122,7 +130,7 @@ func (r *RouteRepository) GetEnabledByDID(ctx context.Context, didID int64) ([]*
 		route := &models.Route{}
 		var nullDIDID sql.NullInt64
 		var conditionData, actionData []byte
-		if err := rows.Scan(&route.ID, &nullDIDID, &route.Priority, &route.Name, &route.ConditionType, &conditionData, &route.ActionType, &actionData, &route.Enabled); err != nil {
+		if err := rows.Scan(&route.ID, &nullDIDID, &route.Priority, &route.Name, &route.ConditionType, &conditionData, &route.ActionType, &actionData, &route.Enabled, &route.TenantID); err != nil {
 			return nil, err
 		}
 		if nullDIDID.Valid {
@@ -138,7 +146,7 @@ func (r *RouteRepository) GetEnabledByDID(ctx context.Context, didID int64) ([]*
 // List returns all routes
 func (r *RouteRepository) List(ctx context.Context) ([]*models.Route, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled
+		SELECT id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled, tenant_id
 		FROM routes ORDER BY did_id, priority ASC
 	`)
 	if err != nil {
@@ -151,7 +159,36 @@ func (r *RouteRepository) List(ctx context.Context) ([]*models.Route, error) {
 		route := &models.Route{}
 		var nullDIDID sql.NullInt64
 		var conditionData, actionData []byte
-		if err := rows.Scan(&route.ID, &nullDIDID, &route.Priority, &route.Name, &route.ConditionType, &conditionData, &route.ActionType, &actionData, &route.Enabled); err != nil {
+		if err := rows.Scan(&route.ID, &nullDIDID, &route.Priority, &route.Name, &route.ConditionType, &conditionData, &route.ActionType, &actionData, &route.Enabled, &route.TenantID); err != nil {
+			return nil, err
+		}
+		if nullDIDID.Valid {
+			route.DIDID = &nullDIDID.Int64
+		}
+		route.ConditionData = conditionData
+		route.ActionData = actionData
+		routes = append(routes, route)
+	}
+	return routes, rows.Err()
+}
+
+// ListByTenant returns a tenant's routes
+func (r *RouteRepository) ListByTenant(ctx context.Context, tenantID int64) ([]*models.Route, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, did_id, priority, name, condition_type, condition_data, action_type, action_data, enabled, tenant_id
+		FROM routes WHERE tenant_id = ? ORDER BY did_id, priority ASC
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var routes []*models.Route
+	for rows.Next() {
+		route := &models.Route{}
+		var nullDIDID sql.NullInt64
+		var conditionData, actionData []byte
+		if err := rows.Scan(&route.ID, &nullDIDID, &route.Priority, &route.Name, &route.ConditionType, &conditionData, &route.ActionType, &actionData, &route.Enabled, &route.TenantID); err != nil {
 			return nil, err
 		}
 		if nullDIDID.Valid {
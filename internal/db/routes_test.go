@@ -346,3 +346,46 @@ func TestRouteRepository_UpdatePriorities(t *testing.T) {
 		}
 	}
 }
+
+func TestRouteVersionRepository_Record(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	route := &models.Route{Priority: 1, Name: "All calls", ConditionType: "default", ActionType: "voicemail", Enabled: true}
+	if err := db.Routes.Create(ctx, route); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < RouteVersionsKept+2; i++ {
+		route.Priority = i
+		v, err := db.RouteVersions.Record(ctx, "updated", route, nil)
+		if err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+		if v.Version != i+1 {
+			t.Fatalf("Version = %d, want %d", v.Version, i+1)
+		}
+	}
+
+	versions, err := db.RouteVersions.ListByRoute(ctx, route.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != RouteVersionsKept || versions[0].Version != RouteVersionsKept+2 {
+		t.Errorf("Kept %d versions starting at %d", len(versions), versions[0].Version)
+	}
+	if _, err := db.RouteVersions.Get(ctx, route.ID, 2); err != ErrRouteVersionNotFound {
+		t.Errorf("Expected version 2 to be pruned, got %v", err)
+	}
+
+	// Deleted routes are restored under their own ID
+	v, _ := db.RouteVersions.Get(ctx, route.ID, 50)
+	db.Routes.Delete(ctx, route.ID)
+	if err := db.Routes.Restore(ctx, &v.Route); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	restored, err := db.Routes.GetByID(ctx, route.ID)
+	if err != nil || restored.Priority != 49 {
+		t.Errorf("Restored route = %+v, %v", restored, err)
+	}
+}
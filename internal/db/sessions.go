@@ -33,19 +33,15 @@ func NewSessionRepository(conn *sql.DB) *SessionRepository {
 func (r *SessionRepository) Create(ctx context.Context, token string, userID int64, expiresAt time.Time, userAgent, ipAddress string) (*Session, error) {
 	now := time.Now()
 
-	result, err := r.conn.ExecContext(ctx, `
+	var id int64
+	if err := r.conn.QueryRowContext(ctx, `
 		INSERT INTO sessions (token, user_id, created_at, expires_at, last_activity, user_agent, ip_address)
 		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, token, userID, now, expiresAt, now, userAgent, ipAddress)
-	if err != nil {
+		RETURNING id
+	`, token, userID, now, expiresAt, now, userAgent, ipAddress).Scan(&id); err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get session ID: %w", err)
-	}
-
 	return &Session{
 		ID:           id,
 		Token:        token,
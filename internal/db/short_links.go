@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrShortLinkNotFound = errors.New("short link not found")
+
+// ShortLinkRepository handles database operations for the short links in
+// outbound messages
+type ShortLinkRepository struct {
+	db *sql.DB
+}
+
+// NewShortLinkRepository creates a new ShortLinkRepository
+func NewShortLinkRepository(db *sql.DB) *ShortLinkRepository {
+	return &ShortLinkRepository{db: db}
+}
+
+const shortLinkColumns = `id, code, message_id, url, clicks, last_clicked_at, created_at`
+
+func scanShortLink(row rowScanner) (*models.ShortLink, error) {
+	link := &models.ShortLink{}
+	var messageID sql.NullInt64
+	var lastClickedAt sql.NullTime
+	if err := row.Scan(&link.ID, &link.Code, &messageID, &link.URL, &link.Clicks, &lastClickedAt, &link.CreatedAt); err != nil {
+		return nil, err
+	}
+	if messageID.Valid {
+		link.MessageID = &messageID.Int64
+	}
+	if lastClickedAt.Valid {
+		link.LastClickedAt = &lastClickedAt.Time
+	}
+	return link, nil
+}
+
+// Create inserts a new short link. Codes are unique, so creating a link
+// with a code already in use fails.
+func (r *ShortLinkRepository) Create(ctx context.Context, link *models.ShortLink) error {
+	if link.CreatedAt.IsZero() {
+		link.CreatedAt = time.Now()
+	}
+
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO short_links (code, message_id, url, created_at)
+		VALUES (?, ?, ?, ?)
+		RETURNING id
+	`, link.Code, link.MessageID, link.URL, link.CreatedAt).Scan(&link.ID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetByCode retrieves a short link by its code
+func (r *ShortLinkRepository) GetByCode(ctx context.Context, code string) (*models.ShortLink, error) {
+	link, err := scanShortLink(r.db.QueryRowContext(ctx, `SELECT `+shortLinkColumns+` FROM short_links WHERE code = ?`, code))
+	if err == sql.ErrNoRows {
+		return nil, ErrShortLinkNotFound
+	}
+	return link, err
+}
+
+// RecordClick counts a click of a short link and returns the link
+func (r *ShortLinkRepository) RecordClick(ctx context.Context, code string) (*models.ShortLink, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE short_links SET clicks = clicks + 1, last_clicked_at = ? WHERE code = ?
+	`, time.Now(), code)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrShortLinkNotFound
+	}
+	return r.GetByCode(ctx, code)
+}
+
+// ListByMessage returns the short links in a message, in the order they
+// appear
+func (r *ShortLinkRepository) ListByMessage(ctx context.Context, messageID int64) ([]*models.ShortLink, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+shortLinkColumns+` FROM short_links WHERE message_id = ? ORDER BY id`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []*models.ShortLink
+	for rows.Next() {
+		link, err := scanShortLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
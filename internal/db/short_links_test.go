@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestShortLinkRepository(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	message := &models.Message{Direction: "outbound", FromNumber: "+15550001111", ToNumber: "+15550002222", Body: "See https://example.com/a", Status: "queued", Channel: "sms"}
+	if err := db.Messages.Create(ctx, message); err != nil {
+		t.Fatalf("Failed to create message: %v", err)
+	}
+
+	first := &models.ShortLink{Code: "abc123", MessageID: &message.ID, URL: "https://example.com/a"}
+	second := &models.ShortLink{Code: "def456", MessageID: &message.ID, URL: "https://example.com/b"}
+	for _, link := range []*models.ShortLink{first, second} {
+		if err := db.ShortLinks.Create(ctx, link); err != nil {
+			t.Fatalf("Failed to create short link: %v", err)
+		}
+	}
+	if err := db.ShortLinks.Create(ctx, &models.ShortLink{Code: "abc123", URL: "https://example.com/c"}); err == nil {
+		t.Error("Expected a duplicate code refused")
+	}
+
+	if _, err := db.ShortLinks.RecordClick(ctx, "missing"); err != ErrShortLinkNotFound {
+		t.Errorf("Expected ErrShortLinkNotFound, got %v", err)
+	}
+	db.ShortLinks.RecordClick(ctx, "abc123")
+	link, err := db.ShortLinks.RecordClick(ctx, "abc123")
+	if err != nil {
+		t.Fatalf("Failed to record click: %v", err)
+	}
+	if link.Clicks != 2 || link.LastClickedAt == nil || link.URL != "https://example.com/a" {
+		t.Errorf("Unexpected link after two clicks: %+v", link)
+	}
+
+	links, err := db.ShortLinks.ListByMessage(ctx, message.ID)
+	if err != nil {
+		t.Fatalf("Failed to list short links: %v", err)
+	}
+	if len(links) != 2 || links[0].Code != "abc123" || links[1].Clicks != 0 || links[1].LastClickedAt != nil {
+		t.Errorf("Unexpected links: %+v", links)
+	}
+
+	// Links go with their message
+	if err := db.Messages.Delete(ctx, message.ID); err != nil {
+		t.Fatalf("Failed to delete message: %v", err)
+	}
+	if _, err := db.ShortLinks.GetByCode(ctx, "def456"); err != ErrShortLinkNotFound {
+		t.Errorf("Expected the links deleted with the message, got %v", err)
+	}
+}
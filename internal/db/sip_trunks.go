@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrSIPTrunkNotFound = errors.New("SIP trunk not found")
+
+// SIPTrunkRepository handles database operations for SIP trunks to
+// providers other than Twilio
+type SIPTrunkRepository struct {
+	db *sql.DB
+}
+
+// NewSIPTrunkRepository creates a new SIPTrunkRepository
+func NewSIPTrunkRepository(db *sql.DB) *SIPTrunkRepository {
+	return &SIPTrunkRepository{db: db}
+}
+
+const sipTrunkColumns = `id, name, host, port, transport, domain, username, auth_username, password, expires, register, enabled, created_at, updated_at`
+
+// scanSIPTrunk reads a SIP trunk from a row
+func scanSIPTrunk(row interface{ Scan(...interface{}) error }) (*models.SIPTrunk, error) {
+	t := &models.SIPTrunk{}
+	err := row.Scan(&t.ID, &t.Name, &t.Host, &t.Port, &t.Transport, &t.Domain, &t.Username, &t.AuthUsername, &t.Password,
+		&t.Expires, &t.Register, &t.Enabled, &t.CreatedAt, &t.UpdatedAt)
+	return t, err
+}
+
+// Create adds a SIP trunk
+func (r *SIPTrunkRepository) Create(ctx context.Context, t *models.SIPTrunk) error {
+	now := time.Now()
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO sip_trunks (name, host, port, transport, domain, username, auth_username, password, expires, register, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, t.Name, t.Host, t.Port, t.Transport, t.Domain, t.Username, t.AuthUsername, t.Password, t.Expires, t.Register, t.Enabled, now, now).Scan(&t.ID); err != nil {
+		return err
+	}
+	t.CreatedAt = now
+	t.UpdatedAt = now
+	return nil
+}
+
+// GetByID retrieves a SIP trunk
+func (r *SIPTrunkRepository) GetByID(ctx context.Context, id int64) (*models.SIPTrunk, error) {
+	t, err := scanSIPTrunk(r.db.QueryRowContext(ctx, `
+		SELECT `+sipTrunkColumns+` FROM sip_trunks WHERE id = ?
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrSIPTrunkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// List returns every SIP trunk
+func (r *SIPTrunkRepository) List(ctx context.Context) ([]*models.SIPTrunk, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+sipTrunkColumns+` FROM sip_trunks ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trunks []*models.SIPTrunk
+	for rows.Next() {
+		t, err := scanSIPTrunk(rows)
+		if err != nil {
+			return nil, err
+		}
+		trunks = append(trunks, t)
+	}
+	return trunks, rows.Err()
+}
+
+// Update saves changes to a SIP trunk
+func (r *SIPTrunkRepository) Update(ctx context.Context, t *models.SIPTrunk) error {
+	t.UpdatedAt = time.Now()
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE sip_trunks SET name = ?, host = ?, port = ?, transport = ?, domain = ?, username = ?, auth_username = ?,
+			password = ?, expires = ?, register = ?, enabled = ?, updated_at = ?
+		WHERE id = ?
+	`, t.Name, t.Host, t.Port, t.Transport, t.Domain, t.Username, t.AuthUsername, t.Password, t.Expires, t.Register, t.Enabled, t.UpdatedAt, t.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSIPTrunkNotFound
+	}
+	return nil
+}
+
+// Delete removes a SIP trunk
+func (r *SIPTrunkRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM sip_trunks WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSIPTrunkNotFound
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Stats summarizes the database for diagnostics
+type Stats struct {
+	SchemaVersion int              `json:"schema_version"`
+	SizeBytes     int64            `json:"size_bytes"`
+	WALBytes      int64            `json:"wal_bytes"`
+	Tables        map[string]int64 `json:"tables"` // Row count per table
+}
+
+// Stats returns the schema version, database size and row counts of every
+// table. The WAL size is only known for SQLite.
+func (db *DB) Stats(ctx context.Context) (*Stats, error) {
+	stats := &Stats{Tables: make(map[string]int64)}
+
+	if err := db.conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&stats.SchemaVersion); err != nil {
+		return nil, fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	tablesQuery := "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name"
+	if db.postgres {
+		db.conn.QueryRowContext(ctx, "SELECT pg_database_size(current_database())").Scan(&stats.SizeBytes)
+		tablesQuery = "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' ORDER BY table_name"
+	} else {
+		var pageCount, pageSize int64
+		db.conn.QueryRowContext(ctx, "PRAGMA page_count").Scan(&pageCount)
+		db.conn.QueryRowContext(ctx, "PRAGMA page_size").Scan(&pageSize)
+		stats.SizeBytes = pageCount * pageSize
+		if info, err := os.Stat(db.dbPath + "-wal"); err == nil {
+			stats.WALBytes = info.Size()
+		}
+	}
+
+	rows, err := db.conn.QueryContext(ctx, tablesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan table name: %w", err)
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	for _, table := range tables {
+		var count int64
+		query := `SELECT COUNT(*) FROM "` + strings.ReplaceAll(table, `"`, `""`) + `"`
+		if err := db.conn.QueryRowContext(ctx, query).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", table, err)
+		}
+		stats.Tables[table] = count
+	}
+
+	return stats, nil
+}
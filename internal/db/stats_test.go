@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestDB_Stats(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	if err := db.Users.Create(ctx, &models.User{Email: "stats@example.com", PasswordHash: "hash", Role: "user"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	stats, err := db.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.SchemaVersion < 31 {
+		t.Errorf("Expected every migration to be applied, got version %d", stats.SchemaVersion)
+	}
+	if stats.SizeBytes <= 0 {
+		t.Errorf("Expected a database size, got %d", stats.SizeBytes)
+	}
+	if stats.Tables["users"] != 1 {
+		t.Errorf("Expected 1 user, got %d", stats.Tables["users"])
+	}
+	if _, ok := stats.Tables["cdrs"]; !ok {
+		t.Errorf("Expected cdrs in table counts, got %v", stats.Tables)
+	}
+}
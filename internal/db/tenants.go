@@ -0,0 +1,194 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var (
+	ErrTenantNotFound = errors.New("tenant not found")
+	// ErrTenantInUse is returned when deleting a tenant that still has
+	// users, devices, DIDs or routes
+	ErrTenantInUse = errors.New("tenant still has users, devices, DIDs or routes")
+)
+
+// TenantRepository handles database operations for tenants and the
+// settings they override
+type TenantRepository struct {
+	db *sql.DB
+}
+
+// NewTenantRepository creates a new TenantRepository
+func NewTenantRepository(db *sql.DB) *TenantRepository {
+	return &TenantRepository{db: db}
+}
+
+const tenantColumns = `id, name, sip_domain, created_at, updated_at`
+
+func scanTenant(row rowScanner) (*models.Tenant, error) {
+	tenant := &models.Tenant{}
+	var domain sql.NullString
+	if err := row.Scan(&tenant.ID, &tenant.Name, &domain, &tenant.CreatedAt, &tenant.UpdatedAt); err != nil {
+		return nil, err
+	}
+	tenant.SIPDomain = domain.String
+	return tenant, nil
+}
+
+// sipDomainValue stores a SIP domain lowercased, and no domain as NULL so
+// any number of tenants can be without one
+func sipDomainValue(domain string) interface{} {
+	if domain == "" {
+		return nil
+	}
+	return strings.ToLower(domain)
+}
+
+// Create inserts a new tenant
+func (r *TenantRepository) Create(ctx context.Context, tenant *models.Tenant) error {
+	now := time.Now()
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO tenants (name, sip_domain, created_at, updated_at)
+		VALUES (?, ?, ?, ?)
+		RETURNING id
+	`, tenant.Name, sipDomainValue(tenant.SIPDomain), now, now).Scan(&tenant.ID); err != nil {
+		return err
+	}
+	tenant.SIPDomain = strings.ToLower(tenant.SIPDomain)
+	tenant.CreatedAt = now
+	tenant.UpdatedAt = now
+	return nil
+}
+
+// GetByID retrieves a tenant by ID
+func (r *TenantRepository) GetByID(ctx context.Context, id int64) (*models.Tenant, error) {
+	tenant, err := scanTenant(r.db.QueryRowContext(ctx, `SELECT `+tenantColumns+` FROM tenants WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrTenantNotFound
+	}
+	return tenant, err
+}
+
+// GetBySIPDomain retrieves the tenant a SIP domain belongs to
+func (r *TenantRepository) GetBySIPDomain(ctx context.Context, domain string) (*models.Tenant, error) {
+	if domain == "" {
+		return nil, ErrTenantNotFound
+	}
+	tenant, err := scanTenant(r.db.QueryRowContext(ctx, `SELECT `+tenantColumns+` FROM tenants WHERE sip_domain = ?`, strings.ToLower(domain)))
+	if err == sql.ErrNoRows {
+		return nil, ErrTenantNotFound
+	}
+	return tenant, err
+}
+
+// List returns all tenants by name
+func (r *TenantRepository) List(ctx context.Context) ([]*models.Tenant, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+tenantColumns+` FROM tenants ORDER BY name, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []*models.Tenant
+	for rows.Next() {
+		tenant, err := scanTenant(rows)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+	return tenants, rows.Err()
+}
+
+// Update changes a tenant's name and SIP domain
+func (r *TenantRepository) Update(ctx context.Context, tenant *models.Tenant) error {
+	now := time.Now()
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE tenants SET name = ?, sip_domain = ?, updated_at = ? WHERE id = ?
+	`, tenant.Name, sipDomainValue(tenant.SIPDomain), now, tenant.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrTenantNotFound
+	}
+	tenant.SIPDomain = strings.ToLower(tenant.SIPDomain)
+	tenant.UpdatedAt = now
+	return nil
+}
+
+// Delete removes a tenant that has no users, devices, DIDs or routes left.
+// Its messages and call history stay, as the instance's.
+func (r *TenantRepository) Delete(ctx context.Context, id int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inUse bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE tenant_id = ?)
+			OR EXISTS (SELECT 1 FROM devices WHERE tenant_id = ?)
+			OR EXISTS (SELECT 1 FROM dids WHERE tenant_id = ?)
+			OR EXISTS (SELECT 1 FROM routes WHERE tenant_id = ?)
+	`, id, id, id, id).Scan(&inUse); err != nil {
+		return err
+	}
+	if inUse {
+		return ErrTenantInUse
+	}
+
+	for _, table := range []string{"messages", "cdrs"} {
+		if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET tenant_id = NULL WHERE tenant_id = ?`, id); err != nil {
+			return err
+		}
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM tenants WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrTenantNotFound
+	}
+	return tx.Commit()
+}
+
+// GetConfig returns the settings a tenant overrides
+func (r *TenantRepository) GetConfig(ctx context.Context, tenantID int64) ([]*models.SystemConfig, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT key, value, updated_at FROM tenant_config WHERE tenant_id = ? ORDER BY key`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var configs []*models.SystemConfig
+	for rows.Next() {
+		cfg := &models.SystemConfig{}
+		if err := rows.Scan(&cfg.Key, &cfg.Value, &cfg.UpdatedAt); err != nil {
+			return nil, err
+		}
+		configs = append(configs, cfg)
+	}
+	return configs, rows.Err()
+}
+
+// SetConfig overrides a setting for a tenant
+func (r *TenantRepository) SetConfig(ctx context.Context, tenantID int64, key, value string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO tenant_config (tenant_id, key, value, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(tenant_id, key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+	`, tenantID, key, value, time.Now())
+	return err
+}
+
+// DeleteConfig makes a tenant use the instance's setting again
+func (r *TenantRepository) DeleteConfig(ctx context.Context, tenantID int64, key string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM tenant_config WHERE tenant_id = ? AND key = ?`, tenantID, key)
+	return err
+}
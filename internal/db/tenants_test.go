@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestTenantRepository(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	acme := &models.Tenant{Name: "Acme", SIPDomain: "SIP.Acme.example"}
+	if err := db.Tenants.Create(ctx, acme); err != nil {
+		t.Fatalf("Failed to create tenant: %v", err)
+	}
+	globex := &models.Tenant{Name: "Globex"}
+	if err := db.Tenants.Create(ctx, globex); err != nil {
+		t.Fatalf("Failed to create tenant: %v", err)
+	}
+	// Any number of tenants may be without a domain
+	if err := db.Tenants.Create(ctx, &models.Tenant{Name: "Initech"}); err != nil {
+		t.Fatalf("Failed to create second tenant without a domain: %v", err)
+	}
+	if err := db.Tenants.Create(ctx, &models.Tenant{Name: "Copy", SIPDomain: "sip.acme.example"}); err == nil {
+		t.Error("Expected a duplicate SIP domain to be rejected")
+	}
+
+	found, err := db.Tenants.GetBySIPDomain(ctx, "sip.ACME.example")
+	if err != nil || found.ID != acme.ID || found.SIPDomain != "sip.acme.example" {
+		t.Errorf("Expected Acme by domain, got %+v, %v", found, err)
+	}
+	if _, err := db.Tenants.GetBySIPDomain(ctx, ""); err != ErrTenantNotFound {
+		t.Errorf("Expected no tenant for an empty domain, got %v", err)
+	}
+	if tenants, _ := db.Tenants.List(ctx); len(tenants) != 3 || tenants[0].Name != "Acme" {
+		t.Errorf("Expected three tenants by name, got %+v", tenants)
+	}
+
+	// Settings fall back to the instance's
+	db.Config.Set(ctx, "timezone", "America/New_York")
+	db.Tenants.SetConfig(ctx, acme.ID, "timezone", "Europe/Berlin")
+	if tz := db.Config.GetForTenant(ctx, &acme.ID, "timezone", "UTC"); tz != "Europe/Berlin" {
+		t.Errorf("Expected the tenant's timezone, got %s", tz)
+	}
+	if tz := db.Config.GetForTenant(ctx, &globex.ID, "timezone", "UTC"); tz != "America/New_York" {
+		t.Errorf("Expected the instance's timezone, got %s", tz)
+	}
+	if lang := db.Config.GetForTenant(ctx, nil, "default_language", "en"); lang != "en" {
+		t.Errorf("Expected the default language, got %s", lang)
+	}
+	db.Tenants.DeleteConfig(ctx, acme.ID, "timezone")
+	if configs, _ := db.Tenants.GetConfig(ctx, acme.ID); len(configs) != 0 {
+		t.Errorf("Expected no tenant settings left, got %+v", configs)
+	}
+
+	// Routes, messages and calls follow their DID
+	did := &models.DID{Number: "+15551234567", SMSEnabled: true, VoiceEnabled: true}
+	db.DIDs.Create(ctx, did)
+	route := &models.Route{DIDID: &did.ID, Name: "All", ConditionType: "default", ActionType: "voicemail"}
+	if err := db.Routes.Create(ctx, route); err != nil {
+		t.Fatalf("Failed to create route: %v", err)
+	}
+	if route.TenantID != nil {
+		t.Errorf("Expected an instance route, got tenant %d", *route.TenantID)
+	}
+	before := &models.Message{MessageSID: "SM1", Direction: "inbound", FromNumber: "+15559876543", ToNumber: did.Number, DIDID: &did.ID, Body: "before"}
+	db.Messages.Create(ctx, before)
+
+	if err := db.DIDs.SetTenant(ctx, did.ID, &acme.ID); err != nil {
+		t.Fatalf("Failed to move DID: %v", err)
+	}
+	if moved, _ := db.Routes.GetByID(ctx, route.ID); moved.TenantID == nil || *moved.TenantID != acme.ID {
+		t.Errorf("Expected the route moved with its DID, got %+v", moved.TenantID)
+	}
+	after := &models.Message{MessageSID: "SM2", Direction: "inbound", FromNumber: "+15559876543", ToNumber: did.Number, DIDID: &did.ID, Body: "after"}
+	db.Messages.Create(ctx, after)
+	if after.TenantID == nil || *after.TenantID != acme.ID {
+		t.Errorf("Expected the message under Acme, got %v", after.TenantID)
+	}
+	msgs, _ := db.Messages.ListByTenant(ctx, acme.ID, MessageFilter{DIDID: &did.ID}, 10, 0)
+	if count, _ := db.Messages.CountByTenant(ctx, acme.ID, MessageFilter{Direction: "inbound"}); count != 1 || len(msgs) != 1 || msgs[0].ID != after.ID {
+		t.Errorf("Expected only the message received under Acme, got %d (%d)", len(msgs), count)
+	}
+
+	cdr := &models.CDR{CallSID: "CA1", Direction: "inbound", FromNumber: "+15559876543", ToNumber: did.Number, StartedAt: time.Now(), Disposition: "answered"}
+	db.CDRs.Create(ctx, cdr)
+	if cdr.TenantID != nil {
+		t.Errorf("Expected a call without a DID yet under the instance")
+	}
+	cdr.DIDID = &did.ID
+	db.CDRs.Update(ctx, cdr)
+	if calls, _ := db.CDRs.List(ctx, CDRFilter{TenantID: &acme.ID}); len(calls) != 1 || calls[0].ID != cdr.ID {
+		t.Errorf("Expected the call under Acme once its DID is known, got %+v", calls)
+	}
+
+	// Extensions are numbered per tenant
+	ext := "201"
+	own := &models.Device{Name: "Desk", Username: "desk", DeviceType: "grandstream", Extension: &ext}
+	tenantDevice := &models.Device{Name: "Acme Desk", Username: "acme-desk", DeviceType: "grandstream", Extension: &ext, TenantID: &acme.ID}
+	for _, device := range []*models.Device{own, tenantDevice} {
+		if err := db.Devices.Create(ctx, device); err != nil {
+			t.Fatalf("Failed to create device %s: %v", device.Username, err)
+		}
+	}
+	if err := db.Devices.Create(ctx, &models.Device{Name: "Copy", Username: "acme-copy", DeviceType: "grandstream", Extension: &ext, TenantID: &acme.ID}); err == nil {
+		t.Error("Expected a duplicate extension within a tenant to be rejected")
+	}
+	if found, _ := db.Devices.GetByExtension(ctx, &acme.ID, "201"); found == nil || found.ID != tenantDevice.ID {
+		t.Errorf("Expected Acme's extension 201, got %+v", found)
+	}
+	if found, _ := db.Devices.GetByExtension(ctx, nil, "201"); found == nil || found.ID != own.ID {
+		t.Errorf("Expected the instance's extension 201, got %+v", found)
+	}
+	if exts, _ := db.Devices.ListExtensions(ctx, &globex.ID); len(exts) != 0 {
+		t.Errorf("Expected no Globex extensions, got %v", exts)
+	}
+
+	// A tenant still in use can't be deleted; its history stays with the instance
+	if err := db.Tenants.Delete(ctx, acme.ID); err != ErrTenantInUse {
+		t.Errorf("Expected ErrTenantInUse, got %v", err)
+	}
+	db.Devices.SetTenant(ctx, tenantDevice.ID, nil)
+	db.Devices.Delete(ctx, tenantDevice.ID)
+	db.DIDs.SetTenant(ctx, did.ID, nil)
+	if err := db.Tenants.Delete(ctx, acme.ID); err != nil {
+		t.Fatalf("Failed to delete tenant: %v", err)
+	}
+	if msg, _ := db.Messages.GetByID(ctx, after.ID); msg.TenantID != nil {
+		t.Errorf("Expected the message back with the instance, got %v", *msg.TenantID)
+	}
+	if _, err := db.Tenants.GetByID(ctx, acme.ID); err != ErrTenantNotFound {
+		t.Errorf("Expected ErrTenantNotFound, got %v", err)
+	}
+}
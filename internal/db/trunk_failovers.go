@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrTrunkFailoverNotFound = errors.New("trunk failover not found")
+
+// TrunkFailoverRepository handles database operations for Twilio trunk
+// disaster recovery settings
+type TrunkFailoverRepository struct {
+	db *sql.DB
+}
+
+// NewTrunkFailoverRepository creates a new TrunkFailoverRepository
+func NewTrunkFailoverRepository(db *sql.DB) *TrunkFailoverRepository {
+	return &TrunkFailoverRepository{db: db}
+}
+
+const trunkFailoverColumns = `trunk_sid, forward_to, disaster_recovery_url, secondary_uri, intact, problems, verified_at, created_at, updated_at`
+
+// scanTrunkFailover reads a trunk failover from a row
+func scanTrunkFailover(row interface{ Scan(...interface{}) error }) (*models.TrunkFailover, error) {
+	f := &models.TrunkFailover{}
+	var problems sql.NullString
+	if err := row.Scan(&f.TrunkSID, &f.ForwardTo, &f.DisasterRecoveryURL, &f.SecondaryURI, &f.Intact, &problems, &f.VerifiedAt, &f.CreatedAt, &f.UpdatedAt); err != nil {
+		return nil, err
+	}
+	f.Problems = []string{}
+	if problems.Valid && problems.String != "" {
+		if err := json.Unmarshal([]byte(problems.String), &f.Problems); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Get retrieves the failover configured for a trunk
+func (r *TrunkFailoverRepository) Get(ctx context.Context, trunkSID string) (*models.TrunkFailover, error) {
+	f, err := scanTrunkFailover(r.db.QueryRowContext(ctx, `
+		SELECT `+trunkFailoverColumns+` FROM trunk_failovers WHERE trunk_sid = ?
+	`, trunkSID))
+	if err == sql.ErrNoRows {
+		return nil, ErrTrunkFailoverNotFound
+	}
+	return f, err
+}
+
+// List returns every configured trunk failover
+func (r *TrunkFailoverRepository) List(ctx context.Context) ([]*models.TrunkFailover, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+trunkFailoverColumns+` FROM trunk_failovers ORDER BY trunk_sid
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failovers []*models.TrunkFailover
+	for rows.Next() {
+		f, err := scanTrunkFailover(rows)
+		if err != nil {
+			return nil, err
+		}
+		failovers = append(failovers, f)
+	}
+	return failovers, rows.Err()
+}
+
+// Upsert stores the failover configured for a trunk
+func (r *TrunkFailoverRepository) Upsert(ctx context.Context, f *models.TrunkFailover) error {
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO trunk_failovers (trunk_sid, forward_to, disaster_recovery_url, secondary_uri, intact, created_at, updated_at)
+		VALUES (?, ?, ?, ?, 1, ?, ?)
+		ON CONFLICT(trunk_sid) DO UPDATE SET
+			forward_to = excluded.forward_to,
+			disaster_recovery_url = excluded.disaster_recovery_url,
+			secondary_uri = excluded.secondary_uri,
+			updated_at = excluded.updated_at
+	`, f.TrunkSID, f.ForwardTo, f.DisasterRecoveryURL, f.SecondaryURI, now, now)
+	return err
+}
+
+// RecordVerification stores the outcome of checking a trunk's failover
+// against Twilio
+func (r *TrunkFailoverRepository) RecordVerification(ctx context.Context, trunkSID string, problems []string, verifiedAt time.Time) error {
+	if problems == nil {
+		problems = []string{}
+	}
+	data, err := json.Marshal(problems)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE trunk_failovers SET intact = ?, problems = ?, verified_at = ? WHERE trunk_sid = ?
+	`, len(problems) == 0, string(data), verifiedAt, trunkSID)
+	return err
+}
+
+// Delete removes the failover configured for a trunk
+func (r *TrunkFailoverRepository) Delete(ctx context.Context, trunkSID string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM trunk_failovers WHERE trunk_sid = ?`, trunkSID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTrunkFailoverNotFound
+	}
+	return nil
+}
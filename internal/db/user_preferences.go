@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// UserPreferenceRepository handles database operations for per-user
+// preferences, stored as one JSON value per key
+type UserPreferenceRepository struct {
+	db *sql.DB
+}
+
+// NewUserPreferenceRepository creates a new UserPreferenceRepository
+func NewUserPreferenceRepository(db *sql.DB) *UserPreferenceRepository {
+	return &UserPreferenceRepository{db: db}
+}
+
+// Get returns a user's preferences by key, empty when none are saved
+func (r *UserPreferenceRepository) Get(ctx context.Context, userID int64) (map[string]json.RawMessage, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT key, value FROM user_preferences WHERE user_id = ? ORDER BY key
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prefs := make(map[string]json.RawMessage)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		prefs[key] = json.RawMessage(value)
+	}
+	return prefs, rows.Err()
+}
+
+// Update saves the set preferences and removes the others, all or nothing
+func (r *UserPreferenceRepository) Update(ctx context.Context, userID int64, set map[string]json.RawMessage, remove []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for key, value := range set {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO user_preferences (user_id, key, value, updated_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(user_id, key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+		`, userID, key, string(value), now); err != nil {
+			return err
+		}
+	}
+	for _, key := range remove {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_preferences WHERE user_id = ? AND key = ?`, userID, key); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
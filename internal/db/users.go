@@ -26,19 +26,13 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 
 // Create inserts a new user
 func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
-	result, err := r.db.ExecContext(ctx, `
-		INSERT INTO users (email, password_hash, role, created_at)
-		VALUES (?, ?, ?, ?)
-	`, user.Email, user.PasswordHash, user.Role, time.Now())
-	if err != nil {
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO users (email, password_hash, role, language, hide_caller_id, tenant_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, user.Email, user.PasswordHash, user.Role, user.Language, user.HideCallerID, user.TenantID, time.Now()).Scan(&user.ID); err != nil {
 		return err
 	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return err
-	}
-	user.ID = id
 	return nil
 }
 
@@ -46,9 +40,9 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 func (r *UserRepository) GetByID(ctx context.Context, id int64) (*models.User, error) {
 	user := &models.User{}
 	err := r.db.QueryRowContext(ctx, `
-		SELECT id, email, password_hash, role, created_at, last_login
+		SELECT id, email, password_hash, role, language, hide_caller_id, tenant_id, created_at, last_login
 		FROM users WHERE id = ?
-	`, id).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.CreatedAt, &user.LastLogin)
+	`, id).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.Language, &user.HideCallerID, &user.TenantID, &user.CreatedAt, &user.LastLogin)
 	if err == sql.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
@@ -62,9 +56,9 @@ func (r *UserRepository) GetByID(ctx context.Context, id int64) (*models.User, e
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	user := &models.User{}
 	err := r.db.QueryRowContext(ctx, `
-		SELECT id, email, password_hash, role, created_at, last_login
+		SELECT id, email, password_hash, role, language, hide_caller_id, tenant_id, created_at, last_login
 		FROM users WHERE email = ?
-	`, email).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.CreatedAt, &user.LastLogin)
+	`, email).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.Language, &user.HideCallerID, &user.TenantID, &user.CreatedAt, &user.LastLogin)
 	if err == sql.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
@@ -77,9 +71,15 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 // Update updates an existing user
 func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 	_, err := r.db.ExecContext(ctx, `
-		UPDATE users SET email = ?, password_hash = ?, role = ?, last_login = ?
+		UPDATE users SET email = ?, password_hash = ?, role = ?, language = ?, hide_caller_id = ?, last_login = ?
 		WHERE id = ?
-	`, user.Email, user.PasswordHash, user.Role, user.LastLogin, user.ID)
+	`, user.Email, user.PasswordHash, user.Role, user.Language, user.HideCallerID, user.LastLogin, user.ID)
+	return err
+}
+
+// SetTenant moves a user to a tenant, or to the instance when tenantID is nil
+func (r *UserRepository) SetTenant(ctx context.Context, id int64, tenantID *int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET tenant_id = ? WHERE id = ?`, tenantID, id)
 	return err
 }
 
@@ -101,7 +101,7 @@ func (r *UserRepository) Delete(ctx context.Context, id int64) error {
 // List returns all users with pagination
 func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]*models.User, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, email, password_hash, role, created_at, last_login
+		SELECT id, email, password_hash, role, language, hide_caller_id, tenant_id, created_at, last_login
 		FROM users ORDER BY created_at DESC LIMIT ? OFFSET ?
 	`, limit, offset)
 	if err != nil {
@@ -112,7 +112,29 @@ func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]*models
 	var users []*models.User
 	for rows.Next() {
 		user := &models.User{}
-		if err := rows.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.CreatedAt, &user.LastLogin); err != nil {
+		if err := rows.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.Language, &user.HideCallerID, &user.TenantID, &user.CreatedAt, &user.LastLogin); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// ListByTenant returns a tenant's users with pagination
+func (r *UserRepository) ListByTenant(ctx context.Context, tenantID int64, limit, offset int) ([]*models.User, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, email, password_hash, role, language, hide_caller_id, tenant_id, created_at, last_login
+		FROM users WHERE tenant_id = ? ORDER BY created_at DESC LIMIT ? OFFSET ?
+	`, tenantID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user := &models.User{}
+		if err := rows.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.Language, &user.HideCallerID, &user.TenantID, &user.CreatedAt, &user.LastLogin); err != nil {
 			return nil, err
 		}
 		users = append(users, user)
@@ -120,6 +142,13 @@ func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]*models
 	return users, rows.Err()
 }
 
+// CountByTenant returns the number of a tenant's users
+func (r *UserRepository) CountByTenant(ctx context.Context, tenantID int64) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE tenant_id = ?`, tenantID).Scan(&count)
+	return count, err
+}
+
 // Count returns the total number of users
 func (r *UserRepository) Count(ctx context.Context) (int, error) {
 	var count int
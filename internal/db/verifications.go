@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrVerificationNotFound = errors.New("verification not found")
+
+// Verification statuses
+const (
+	VerificationPending  = "pending"
+	VerificationApproved = "approved"
+	VerificationCanceled = "canceled" // Replaced by a newer code to the same number
+	VerificationFailed   = "failed"   // Out of attempts, or the code couldn't be sent
+)
+
+// VerificationRepository handles database operations for phone number
+// verifications
+type VerificationRepository struct {
+	db *sql.DB
+}
+
+// NewVerificationRepository creates a new VerificationRepository
+func NewVerificationRepository(db *sql.DB) *VerificationRepository {
+	return &VerificationRepository{db: db}
+}
+
+const verificationColumns = `id, user_id, did_id, to_number, channel, code_hash, status, attempts, sid, expires_at, created_at, updated_at`
+
+func scanVerification(row rowScanner) (*models.Verification, error) {
+	v := &models.Verification{}
+	var didID sql.NullInt64
+	var sid sql.NullString
+	if err := row.Scan(&v.ID, &v.UserID, &didID, &v.ToNumber, &v.Channel, &v.CodeHash, &v.Status, &v.Attempts, &sid,
+		&v.ExpiresAt, &v.CreatedAt, &v.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if didID.Valid {
+		v.DIDID = &didID.Int64
+	}
+	v.SID = sid.String
+	return v, nil
+}
+
+// Create adds a pending verification, canceling any pending one the same
+// user started for the number
+func (r *VerificationRepository) Create(ctx context.Context, v *models.Verification) error {
+	now := time.Now()
+	v.Status = VerificationPending
+	v.CreatedAt = now
+	v.UpdatedAt = now
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE verifications SET status = ?, updated_at = ? WHERE user_id = ? AND to_number = ? AND status = ?
+	`, VerificationCanceled, now, v.UserID, v.ToNumber, VerificationPending); err != nil {
+		return err
+	}
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO verifications (user_id, did_id, to_number, channel, code_hash, status, expires_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, v.UserID, v.DIDID, v.ToNumber, v.Channel, v.CodeHash, v.Status, v.ExpiresAt, v.CreatedAt, v.UpdatedAt).Scan(&v.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetPending returns the verification a user has pending for a number
+func (r *VerificationRepository) GetPending(ctx context.Context, userID int64, toNumber string) (*models.Verification, error) {
+	v, err := scanVerification(r.db.QueryRowContext(ctx, `
+		SELECT `+verificationColumns+` FROM verifications
+		WHERE user_id = ? AND to_number = ? AND status = ?
+		ORDER BY id DESC LIMIT 1
+	`, userID, toNumber, VerificationPending))
+	if err == sql.ErrNoRows {
+		return nil, ErrVerificationNotFound
+	}
+	return v, err
+}
+
+// SetSID records the Twilio message or call that delivered the code
+func (r *VerificationRepository) SetSID(ctx context.Context, id int64, sid string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE verifications SET sid = ?, updated_at = ? WHERE id = ?`, sid, time.Now(), id)
+	return err
+}
+
+// UpdateStatus changes a pending verification's status
+func (r *VerificationRepository) UpdateStatus(ctx context.Context, id int64, status string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE verifications SET status = ?, updated_at = ? WHERE id = ? AND status = ?
+	`, status, time.Now(), id, VerificationPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrVerificationNotFound
+	}
+	return nil
+}
+
+// RecordAttempt counts a wrong code against a pending verification and
+// returns the attempts made, failing it once maxAttempts is reached
+func (r *VerificationRepository) RecordAttempt(ctx context.Context, id int64, maxAttempts int) (int, error) {
+	var attempts int
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE verifications
+		SET attempts = attempts + 1,
+			status = CASE WHEN attempts + 1 >= ? THEN ? ELSE status END,
+			updated_at = ?
+		WHERE id = ? AND status = ?
+		RETURNING attempts
+	`, maxAttempts, VerificationFailed, time.Now(), id, VerificationPending).Scan(&attempts)
+	if err == sql.ErrNoRows {
+		return 0, ErrVerificationNotFound
+	}
+	return attempts, err
+}
+
+// CountToNumberSince returns how many codes were sent to a number since a
+// time, and when the last one was
+func (r *VerificationRepository) CountToNumberSince(ctx context.Context, toNumber string, since time.Time) (int, *time.Time, error) {
+	var count int
+	if err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM verifications WHERE to_number = ? AND created_at >= ?
+	`, toNumber, since).Scan(&count); err != nil || count == 0 {
+		return count, nil, err
+	}
+	var last time.Time
+	err := r.db.QueryRowContext(ctx, `
+		SELECT created_at FROM verifications WHERE to_number = ? ORDER BY id DESC LIMIT 1
+	`, toNumber).Scan(&last)
+	return count, &last, err
+}
+
+// CountByUserSince returns how many codes a user sent since a time
+func (r *VerificationRepository) CountByUserSince(ctx context.Context, userID int64, since time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM verifications WHERE user_id = ? AND created_at >= ?
+	`, userID, since).Scan(&count)
+	return count, err
+}
+
+// DeleteOlderThan prunes verifications created before cutoff
+func (r *VerificationRepository) DeleteOlderThan(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM verifications WHERE created_at < ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,287 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrVoicemailAssignmentNotFound = errors.New("voicemail assignment not found")
+
+// VoicemailBoxRepository handles database operations for shared voicemail
+// boxes: their members, each member's read state and assignments
+type VoicemailBoxRepository struct {
+	db *sql.DB
+}
+
+// NewVoicemailBoxRepository creates a new VoicemailBoxRepository
+func NewVoicemailBoxRepository(db *sql.DB) *VoicemailBoxRepository {
+	return &VoicemailBoxRepository{db: db}
+}
+
+// ListMembers returns the users sharing a voicemail box
+func (r *VoicemailBoxRepository) ListMembers(ctx context.Context, didID int64) ([]*models.VoicemailBoxMember, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT m.did_id, m.user_id, u.email, m.created_at
+		FROM voicemail_box_members m JOIN users u ON u.id = m.user_id
+		WHERE m.did_id = ? ORDER BY u.email
+	`, didID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []*models.VoicemailBoxMember
+	for rows.Next() {
+		m := &models.VoicemailBoxMember{}
+		if err := rows.Scan(&m.DIDID, &m.UserID, &m.Email, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// SetMembers replaces the users sharing a voicemail box. An empty list
+// makes the box private again.
+func (r *VoicemailBoxRepository) SetMembers(ctx context.Context, didID int64, userIDs []int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM voicemail_box_members WHERE did_id = ?`, didID); err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO voicemail_box_members (did_id, user_id, created_at) VALUES (?, ?, ?)
+			ON CONFLICT DO NOTHING
+		`, didID, userID, time.Now()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// IsMember reports whether a user shares a voicemail box
+func (r *VoicemailBoxRepository) IsMember(ctx context.Context, didID, userID int64) (bool, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM voicemail_box_members WHERE did_id = ? AND user_id = ?
+	`, didID, userID).Scan(&count)
+	return count > 0, err
+}
+
+// IsShared reports whether a voicemail box has members
+func (r *VoicemailBoxRepository) IsShared(ctx context.Context, didID int64) (bool, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM voicemail_box_members WHERE did_id = ?
+	`, didID).Scan(&count)
+	return count > 0, err
+}
+
+// ListBoxesForUser returns the DIDs of the voicemail boxes a user shares
+func (r *VoicemailBoxRepository) ListBoxesForUser(ctx context.Context, userID int64) ([]int64, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT did_id FROM voicemail_box_members WHERE user_id = ? ORDER BY did_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var didIDs []int64
+	for rows.Next() {
+		var didID int64
+		if err := rows.Scan(&didID); err != nil {
+			return nil, err
+		}
+		didIDs = append(didIDs, didID)
+	}
+	return didIDs, rows.Err()
+}
+
+// MarkRead records that a member has read a voicemail
+func (r *VoicemailBoxRepository) MarkRead(ctx context.Context, voicemailID, userID int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO voicemail_reads (voicemail_id, user_id, read_at) VALUES (?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`, voicemailID, userID, time.Now())
+	return err
+}
+
+// MarkUnread makes a voicemail unread again for a member
+func (r *VoicemailBoxRepository) MarkUnread(ctx context.Context, voicemailID, userID int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM voicemail_reads WHERE voicemail_id = ? AND user_id = ?
+	`, voicemailID, userID)
+	return err
+}
+
+// ReadByAll reports whether every member of a voicemail's box has read it
+func (r *VoicemailBoxRepository) ReadByAll(ctx context.Context, voicemailID, didID int64) (bool, error) {
+	var unread int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM voicemail_box_members m
+		WHERE m.did_id = ? AND NOT EXISTS (
+			SELECT 1 FROM voicemail_reads r WHERE r.voicemail_id = ? AND r.user_id = m.user_id
+		)
+	`, didID, voicemailID).Scan(&unread)
+	return unread == 0, err
+}
+
+// ReadSet returns the IDs of the voicemails in a box that a member has read
+func (r *VoicemailBoxRepository) ReadSet(ctx context.Context, didID, userID int64) (map[int64]bool, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT r.voicemail_id FROM voicemail_reads r
+		JOIN voicemails v ON v.id = r.voicemail_id
+		WHERE v.user_id = ? AND r.user_id = ?
+	`, didID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	read := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		read[id] = true
+	}
+	return read, rows.Err()
+}
+
+// CountUnread returns the number of voicemails in a box a member hasn't read
+func (r *VoicemailBoxRepository) CountUnread(ctx context.Context, didID, userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM voicemails v
+		WHERE v.user_id = ? AND NOT EXISTS (
+			SELECT 1 FROM voicemail_reads r WHERE r.voicemail_id = v.id AND r.user_id = ?
+		)
+	`, didID, userID).Scan(&count)
+	return count, err
+}
+
+// ListUnread returns the voicemails in a box a member hasn't read
+func (r *VoicemailBoxRepository) ListUnread(ctx context.Context, didID, userID int64) ([]*models.Voicemail, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT v.id, v.cdr_id, v.user_id, v.from_number, v.audio_url, v.transcript, v.duration, v.is_read, v.size_bytes, v.created_at
+		FROM voicemails v
+		WHERE v.user_id = ? AND NOT EXISTS (
+			SELECT 1 FROM voicemail_reads r WHERE r.voicemail_id = v.id AND r.user_id = ?
+		)
+		ORDER BY v.created_at DESC
+	`, didID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanVoicemailRows(rows)
+}
+
+// Assign hands a voicemail to a user for follow-up, replacing any earlier
+// assignment
+func (r *VoicemailBoxRepository) Assign(ctx context.Context, voicemailID, userID int64, assignedBy *int64) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO voicemail_assignments (voicemail_id, user_id, assigned_by, assigned_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(voicemail_id) DO UPDATE SET
+			user_id = excluded.user_id,
+			assigned_by = excluded.assigned_by,
+			assigned_at = excluded.assigned_at
+	`, voicemailID, userID, assignedBy, time.Now())
+	return err
+}
+
+// Unassign removes the assignment of a voicemail
+func (r *VoicemailBoxRepository) Unassign(ctx context.Context, voicemailID int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM voicemail_assignments WHERE voicemail_id = ?`, voicemailID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVoicemailAssignmentNotFound
+	}
+	return nil
+}
+
+// GetAssignment retrieves the assignment of a voicemail
+func (r *VoicemailBoxRepository) GetAssignment(ctx context.Context, voicemailID int64) (*models.VoicemailAssignment, error) {
+	a := &models.VoicemailAssignment{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT voicemail_id, user_id, assigned_by, assigned_at
+		FROM voicemail_assignments WHERE voicemail_id = ?
+	`, voicemailID).Scan(&a.VoicemailID, &a.UserID, &a.AssignedBy, &a.AssignedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrVoicemailAssignmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// AssigneesForBox returns who each assigned voicemail in a box is assigned
+// to, keyed by voicemail ID
+func (r *VoicemailBoxRepository) AssigneesForBox(ctx context.Context, didID int64) (map[int64]int64, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT a.voicemail_id, a.user_id FROM voicemail_assignments a
+		JOIN voicemails v ON v.id = a.voicemail_id
+		WHERE v.user_id = ?
+	`, didID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignees := make(map[int64]int64)
+	for rows.Next() {
+		var voicemailID, userID int64
+		if err := rows.Scan(&voicemailID, &userID); err != nil {
+			return nil, err
+		}
+		assignees[voicemailID] = userID
+	}
+	return assignees, rows.Err()
+}
+
+// ListAssigned returns the voicemails assigned to a user, newest first
+func (r *VoicemailBoxRepository) ListAssigned(ctx context.Context, userID int64) ([]*models.Voicemail, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT v.id, v.cdr_id, v.user_id, v.from_number, v.audio_url, v.transcript, v.duration, v.is_read, v.size_bytes, v.created_at
+		FROM voicemails v JOIN voicemail_assignments a ON a.voicemail_id = v.id
+		WHERE a.user_id = ?
+		ORDER BY v.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanVoicemailRows(rows)
+}
+
+// scanVoicemailRows reads voicemails from a query and closes it
+func scanVoicemailRows(rows *sql.Rows) ([]*models.Voicemail, error) {
+	defer rows.Close()
+
+	var vms []*models.Voicemail
+	for rows.Next() {
+		vm := &models.Voicemail{}
+		if err := rows.Scan(&vm.ID, &vm.CDRID, &vm.UserID, &vm.FromNumber, &vm.AudioURL, &vm.Transcript, &vm.Duration, &vm.IsRead, &vm.SizeBytes, &vm.CreatedAt); err != nil {
+			return nil, err
+		}
+		vms = append(vms, vm)
+	}
+	return vms, rows.Err()
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestVoicemailBoxRepository_ReadState(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	// Voicemail boxes are keyed by DID, stored in the voicemail's user_id,
+	// so the first user and DID share an ID
+	alice := &models.User{Email: "alice@example.com", PasswordHash: "hashed", Role: "user"}
+	bob := &models.User{Email: "bob@example.com", PasswordHash: "hashed", Role: "user"}
+	for _, u := range []*models.User{alice, bob} {
+		if err := db.Users.Create(ctx, u); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	did := createGreetingTestDID(t, db)
+
+	if shared, err := db.VoicemailBoxes.IsShared(ctx, did.ID); err != nil || shared {
+		t.Fatalf("Expected a private box, got %v, %v", shared, err)
+	}
+	if err := db.VoicemailBoxes.SetMembers(ctx, did.ID, []int64{bob.ID, alice.ID, bob.ID}); err != nil {
+		t.Fatalf("Failed to set members: %v", err)
+	}
+	members, err := db.VoicemailBoxes.ListMembers(ctx, did.ID)
+	if err != nil || len(members) != 2 || members[0].Email != "alice@example.com" {
+		t.Fatalf("ListMembers = %+v, %v", members, err)
+	}
+	if boxes, err := db.VoicemailBoxes.ListBoxesForUser(ctx, bob.ID); err != nil || len(boxes) != 1 || boxes[0] != did.ID {
+		t.Errorf("ListBoxesForUser = %v, %v", boxes, err)
+	}
+
+	var vms []*models.Voicemail
+	for _, from := range []string{"+15550000001", "+15550000002"} {
+		vm := &models.Voicemail{UserID: &did.ID, FromNumber: from, Duration: 5}
+		if err := db.Voicemails.Create(ctx, vm); err != nil {
+			t.Fatalf("Failed to create voicemail: %v", err)
+		}
+		vms = append(vms, vm)
+	}
+
+	// Alice reading a voicemail leaves it unread for Bob
+	if err := db.VoicemailBoxes.MarkRead(ctx, vms[0].ID, alice.ID); err != nil {
+		t.Fatalf("MarkRead failed: %v", err)
+	}
+	if n, err := db.VoicemailBoxes.CountUnread(ctx, did.ID, alice.ID); err != nil || n != 1 {
+		t.Errorf("Alice's unread count = %d, %v; want 1", n, err)
+	}
+	if n, err := db.VoicemailBoxes.CountUnread(ctx, did.ID, bob.ID); err != nil || n != 2 {
+		t.Errorf("Bob's unread count = %d, %v; want 2", n, err)
+	}
+	unread, err := db.VoicemailBoxes.ListUnread(ctx, did.ID, alice.ID)
+	if err != nil || len(unread) != 1 || unread[0].ID != vms[1].ID {
+		t.Errorf("Alice's unread voicemails = %+v, %v", unread, err)
+	}
+	if all, err := db.VoicemailBoxes.ReadByAll(ctx, vms[0].ID, did.ID); err != nil || all {
+		t.Errorf("ReadByAll = %v, %v; want false until Bob reads it", all, err)
+	}
+	if read, err := db.VoicemailBoxes.ReadSet(ctx, did.ID, alice.ID); err != nil || !read[vms[0].ID] || read[vms[1].ID] {
+		t.Errorf("ReadSet = %v, %v", read, err)
+	}
+
+	if err := db.VoicemailBoxes.MarkUnread(ctx, vms[0].ID, alice.ID); err != nil {
+		t.Fatalf("MarkUnread failed: %v", err)
+	}
+	if n, _ := db.VoicemailBoxes.CountUnread(ctx, did.ID, alice.ID); n != 2 {
+		t.Errorf("Expected both voicemails unread for Alice again, got %d", n)
+	}
+
+	// Clearing the members makes the box private
+	if err := db.VoicemailBoxes.SetMembers(ctx, did.ID, nil); err != nil {
+		t.Fatalf("Failed to clear members: %v", err)
+	}
+	if shared, _ := db.VoicemailBoxes.IsShared(ctx, did.ID); shared {
+		t.Error("Expected the box to be private again")
+	}
+}
+
+func TestVoicemailBoxRepository_Assign(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	user := &models.User{Email: "alice@example.com", PasswordHash: "hashed", Role: "user"}
+	if err := db.Users.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	vm := &models.Voicemail{UserID: &user.ID, FromNumber: "+15550000001", Duration: 5}
+	if err := db.Voicemails.Create(ctx, vm); err != nil {
+		t.Fatalf("Failed to create voicemail: %v", err)
+	}
+
+	if err := db.VoicemailBoxes.Assign(ctx, vm.ID, user.ID, &user.ID); err != nil {
+		t.Fatalf("Assign failed: %v", err)
+	}
+	a, err := db.VoicemailBoxes.GetAssignment(ctx, vm.ID)
+	if err != nil || a.UserID != user.ID || a.AssignedBy == nil {
+		t.Fatalf("GetAssignment = %+v, %v", a, err)
+	}
+	if assignees, err := db.VoicemailBoxes.AssigneesForBox(ctx, user.ID); err != nil || assignees[vm.ID] != user.ID {
+		t.Errorf("AssigneesForBox = %v, %v", assignees, err)
+	}
+	assigned, err := db.VoicemailBoxes.ListAssigned(ctx, user.ID)
+	if err != nil || len(assigned) != 1 || assigned[0].ID != vm.ID {
+		t.Errorf("ListAssigned = %+v, %v", assigned, err)
+	}
+
+	// Deleting the voicemail removes its assignment
+	if err := db.Voicemails.Delete(ctx, vm.ID); err != nil {
+		t.Fatalf("Failed to delete voicemail: %v", err)
+	}
+	if _, err := db.VoicemailBoxes.GetAssignment(ctx, vm.ID); err != ErrVoicemailAssignmentNotFound {
+		t.Errorf("Expected ErrVoicemailAssignmentNotFound, got %v", err)
+	}
+	if err := db.VoicemailBoxes.Unassign(ctx, vm.ID); err != ErrVoicemailAssignmentNotFound {
+		t.Errorf("Expected ErrVoicemailAssignmentNotFound unassigning, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrVoicemailFeedNotFound = errors.New("voicemail feed not found")
+
+// voicemailFeedColumns is the column list shared by all voicemail feed queries
+const voicemailFeedColumns = `did_id, token, created_at, created_by, last_fetched_at`
+
+// VoicemailFeedRepository handles database operations for voicemail podcast feeds
+type VoicemailFeedRepository struct {
+	db *sql.DB
+}
+
+// NewVoicemailFeedRepository creates a new VoicemailFeedRepository
+func NewVoicemailFeedRepository(db *sql.DB) *VoicemailFeedRepository {
+	return &VoicemailFeedRepository{db: db}
+}
+
+func scanVoicemailFeed(row rowScanner) (*models.VoicemailFeed, error) {
+	feed := &models.VoicemailFeed{}
+	err := row.Scan(&feed.DIDID, &feed.Token, &feed.CreatedAt, &feed.CreatedBy, &feed.LastFetchedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrVoicemailFeedNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+// GetByDID retrieves the feed of a voicemail box
+func (r *VoicemailFeedRepository) GetByDID(ctx context.Context, didID int64) (*models.VoicemailFeed, error) {
+	return scanVoicemailFeed(r.db.QueryRowContext(ctx, `
+		SELECT `+voicemailFeedColumns+` FROM voicemail_feeds WHERE did_id = ?
+	`, didID))
+}
+
+// GetByToken retrieves a feed by its secret token
+func (r *VoicemailFeedRepository) GetByToken(ctx context.Context, token string) (*models.VoicemailFeed, error) {
+	return scanVoicemailFeed(r.db.QueryRowContext(ctx, `
+		SELECT `+voicemailFeedColumns+` FROM voicemail_feeds WHERE token = ?
+	`, token))
+}
+
+// Rotate gives a voicemail box a new feed token, creating the feed if needed.
+// Subscribers using the previous token lose access.
+func (r *VoicemailFeedRepository) Rotate(ctx context.Context, didID int64, createdBy *int64) (*models.VoicemailFeed, error) {
+	token, err := GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &models.VoicemailFeed{
+		DIDID:     didID,
+		Token:     token,
+		CreatedAt: time.Now(),
+		CreatedBy: createdBy,
+	}
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO voicemail_feeds (did_id, token, created_at, created_by)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(did_id) DO UPDATE SET token = excluded.token, created_at = excluded.created_at,
+			created_by = excluded.created_by, last_fetched_at = NULL
+	`, feed.DIDID, feed.Token, feed.CreatedAt, feed.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+// RecordFetch notes when a podcast app last fetched the feed
+func (r *VoicemailFeedRepository) RecordFetch(ctx context.Context, didID int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE voicemail_feeds SET last_fetched_at = ? WHERE did_id = ?`, time.Now(), didID)
+	return err
+}
+
+// Delete revokes a voicemail box's feed
+func (r *VoicemailFeedRepository) Delete(ctx context.Context, didID int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM voicemail_feeds WHERE did_id = ?`, didID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrVoicemailFeedNotFound
+	}
+	return nil
+}
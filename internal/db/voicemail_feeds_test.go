@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestVoicemailFeedRepository_Rotate(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	did := createGreetingTestDID(t, db)
+
+	if _, err := db.VoicemailFeeds.GetByDID(ctx, did.ID); err != ErrVoicemailFeedNotFound {
+		t.Errorf("Expected ErrVoicemailFeedNotFound before enabling, got %v", err)
+	}
+
+	first, err := db.VoicemailFeeds.Rotate(ctx, did.ID, nil)
+	if err != nil {
+		t.Fatalf("Failed to create feed: %v", err)
+	}
+	if first.Token == "" {
+		t.Fatal("Expected feed token to be generated")
+	}
+	if err := db.VoicemailFeeds.RecordFetch(ctx, did.ID); err != nil {
+		t.Fatalf("Failed to record fetch: %v", err)
+	}
+
+	second, err := db.VoicemailFeeds.Rotate(ctx, did.ID, nil)
+	if err != nil {
+		t.Fatalf("Failed to rotate feed: %v", err)
+	}
+	if second.Token == first.Token {
+		t.Error("Expected rotation to issue a new token")
+	}
+	if second.LastFetchedAt != nil {
+		t.Error("Expected rotation to reset last fetch time")
+	}
+
+	if _, err := db.VoicemailFeeds.GetByToken(ctx, first.Token); err != ErrVoicemailFeedNotFound {
+		t.Errorf("Expected old token to be revoked, got %v", err)
+	}
+	feed, err := db.VoicemailFeeds.GetByToken(ctx, second.Token)
+	if err != nil {
+		t.Fatalf("Failed to get feed by token: %v", err)
+	}
+	if feed.DIDID != did.ID {
+		t.Errorf("Expected feed for DID %d, got %d", did.ID, feed.DIDID)
+	}
+}
+
+func TestVoicemailFeedRepository_Delete(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	did := createGreetingTestDID(t, db)
+
+	feed, err := db.VoicemailFeeds.Rotate(ctx, did.ID, nil)
+	if err != nil {
+		t.Fatalf("Failed to create feed: %v", err)
+	}
+
+	if err := db.VoicemailFeeds.Delete(ctx, did.ID); err != nil {
+		t.Fatalf("Failed to delete feed: %v", err)
+	}
+	if _, err := db.VoicemailFeeds.GetByToken(ctx, feed.Token); err != ErrVoicemailFeedNotFound {
+		t.Errorf("Expected deleted feed token to be rejected, got %v", err)
+	}
+	if err := db.VoicemailFeeds.Delete(ctx, did.ID); err != ErrVoicemailFeedNotFound {
+		t.Errorf("Expected ErrVoicemailFeedNotFound deleting twice, got %v", err)
+	}
+}
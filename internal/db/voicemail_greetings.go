@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrGreetingNotFound = errors.New("voicemail greeting not found")
+
+// Voicemail greeting types
+const (
+	GreetingTypeStandard  = "standard"
+	GreetingTypeTemporary = "temporary"
+)
+
+// VoicemailGreetingRepository handles database operations for voicemail greetings
+type VoicemailGreetingRepository struct {
+	db *sql.DB
+}
+
+// NewVoicemailGreetingRepository creates a new VoicemailGreetingRepository
+func NewVoicemailGreetingRepository(db *sql.DB) *VoicemailGreetingRepository {
+	return &VoicemailGreetingRepository{db: db}
+}
+
+// Save creates or replaces the greeting of the given type for a mailbox.
+// The active flag of an existing greeting is kept unless g.IsActive is set.
+func (r *VoicemailGreetingRepository) Save(ctx context.Context, g *models.VoicemailGreeting) error {
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO voicemail_greetings (did_id, greeting_type, audio_url, duration, is_active, expires_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(did_id, greeting_type) DO UPDATE SET
+			audio_url = excluded.audio_url,
+			duration = excluded.duration,
+			is_active = voicemail_greetings.is_active OR excluded.is_active,
+			expires_at = excluded.expires_at,
+			updated_at = excluded.updated_at
+	`, g.DIDID, g.GreetingType, g.AudioURL, g.Duration, g.IsActive, g.ExpiresAt, now, now)
+	if err != nil {
+		return err
+	}
+
+	saved, err := r.GetByType(ctx, g.DIDID, g.GreetingType)
+	if err != nil {
+		return err
+	}
+	*g = *saved
+
+	if g.IsActive {
+		return r.SetActive(ctx, g.DIDID, g.GreetingType)
+	}
+	return nil
+}
+
+// GetByType retrieves a mailbox greeting by type
+func (r *VoicemailGreetingRepository) GetByType(ctx context.Context, didID int64, greetingType string) (*models.VoicemailGreeting, error) {
+	g := &models.VoicemailGreeting{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, did_id, greeting_type, audio_url, duration, is_active, expires_at, created_at, updated_at
+		FROM voicemail_greetings WHERE did_id = ? AND greeting_type = ?
+	`, didID, greetingType).Scan(&g.ID, &g.DIDID, &g.GreetingType, &g.AudioURL, &g.Duration, &g.IsActive, &g.ExpiresAt, &g.CreatedAt, &g.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrGreetingNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// ListByDID returns all greetings for a mailbox
+func (r *VoicemailGreetingRepository) ListByDID(ctx context.Context, didID int64) ([]*models.VoicemailGreeting, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, did_id, greeting_type, audio_url, duration, is_active, expires_at, created_at, updated_at
+		FROM voicemail_greetings WHERE did_id = ? ORDER BY greeting_type ASC
+	`, didID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var greetings []*models.VoicemailGreeting
+	for rows.Next() {
+		g := &models.VoicemailGreeting{}
+		if err := rows.Scan(&g.ID, &g.DIDID, &g.GreetingType, &g.AudioURL, &g.Duration, &g.IsActive, &g.ExpiresAt, &g.CreatedAt, &g.UpdatedAt); err != nil {
+			return nil, err
+		}
+		greetings = append(greetings, g)
+	}
+	return greetings, rows.Err()
+}
+
+// SetActive makes the given greeting type the one played for a mailbox
+func (r *VoicemailGreetingRepository) SetActive(ctx context.Context, didID int64, greetingType string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE voicemail_greetings SET is_active = TRUE, updated_at = ? WHERE did_id = ? AND greeting_type = ?
+	`, time.Now(), didID, greetingType)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		tx.Rollback()
+		return ErrGreetingNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE voicemail_greetings SET is_active = FALSE WHERE did_id = ? AND greeting_type != ?
+	`, didID, greetingType); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetActive returns the greeting to play for a mailbox.
+// An expired temporary greeting falls back to the standard greeting.
+func (r *VoicemailGreetingRepository) GetActive(ctx context.Context, didID int64) (*models.VoicemailGreeting, error) {
+	greetings, err := r.ListByDID(ctx, didID)
+	if err != nil {
+		return nil, err
+	}
+
+	var standard *models.VoicemailGreeting
+	for _, g := range greetings {
+		if g.GreetingType == GreetingTypeStandard {
+			standard = g
+		}
+		if !g.IsActive {
+			continue
+		}
+		if g.ExpiresAt != nil && time.Now().After(*g.ExpiresAt) {
+			continue
+		}
+		return g, nil
+	}
+
+	if standard != nil {
+		return standard, nil
+	}
+	return nil, ErrGreetingNotFound
+}
+
+// Delete removes a mailbox greeting
+func (r *VoicemailGreetingRepository) Delete(ctx context.Context, didID int64, greetingType string) error {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM voicemail_greetings WHERE did_id = ? AND greeting_type = ?
+	`, didID, greetingType)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrGreetingNotFound
+	}
+	return nil
+}
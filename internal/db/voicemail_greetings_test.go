@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func createGreetingTestDID(t *testing.T, db *DB) *models.DID {
+	t.Helper()
+
+	did := &models.DID{Number: "+15551234567", Name: "Main Line", VoiceEnabled: true}
+	if err := db.DIDs.Create(context.Background(), did); err != nil {
+		t.Fatalf("Failed to create DID: %v", err)
+	}
+	return did
+}
+
+func TestVoicemailGreetingRepository_SaveReplaces(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	did := createGreetingTestDID(t, db)
+
+	first := &models.VoicemailGreeting{DIDID: did.ID, GreetingType: GreetingTypeStandard, AudioURL: "https://example.com/a.wav", Duration: 5}
+	if err := db.Greetings.Save(ctx, first); err != nil {
+		t.Fatalf("Failed to save greeting: %v", err)
+	}
+
+	second := &models.VoicemailGreeting{DIDID: did.ID, GreetingType: GreetingTypeStandard, AudioURL: "https://example.com/b.wav", Duration: 7}
+	if err := db.Greetings.Save(ctx, second); err != nil {
+		t.Fatalf("Failed to re-record greeting: %v", err)
+	}
+
+	if second.ID != first.ID {
+		t.Errorf("Expected re-recording to replace greeting %d, got new ID %d", first.ID, second.ID)
+	}
+
+	greetings, err := db.Greetings.ListByDID(ctx, did.ID)
+	if err != nil {
+		t.Fatalf("Failed to list greetings: %v", err)
+	}
+	if len(greetings) != 1 || greetings[0].AudioURL != "https://example.com/b.wav" {
+		t.Errorf("Expected one greeting with the new recording, got %+v", greetings)
+	}
+}
+
+func TestVoicemailGreetingRepository_SetActive(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	did := createGreetingTestDID(t, db)
+
+	if err := db.Greetings.SetActive(ctx, did.ID, GreetingTypeStandard); err != ErrGreetingNotFound {
+		t.Errorf("Expected ErrGreetingNotFound for unrecorded greeting, got %v", err)
+	}
+
+	for _, greetingType := range []string{GreetingTypeStandard, GreetingTypeTemporary} {
+		g := &models.VoicemailGreeting{DIDID: did.ID, GreetingType: greetingType, AudioURL: "https://example.com/" + greetingType + ".wav", IsActive: true}
+		if err := db.Greetings.Save(ctx, g); err != nil {
+			t.Fatalf("Failed to save %s greeting: %v", greetingType, err)
+		}
+	}
+
+	active, err := db.Greetings.GetActive(ctx, did.ID)
+	if err != nil {
+		t.Fatalf("Failed to get active greeting: %v", err)
+	}
+	if active.GreetingType != GreetingTypeTemporary {
+		t.Errorf("Expected most recently activated temporary greeting, got %s", active.GreetingType)
+	}
+
+	if err := db.Greetings.SetActive(ctx, did.ID, GreetingTypeStandard); err != nil {
+		t.Fatalf("Failed to activate standard greeting: %v", err)
+	}
+	active, _ = db.Greetings.GetActive(ctx, did.ID)
+	if active.GreetingType != GreetingTypeStandard {
+		t.Errorf("Expected standard greeting to be active, got %s", active.GreetingType)
+	}
+}
+
+func TestVoicemailGreetingRepository_GetActive_ExpiredTemporary(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	did := createGreetingTestDID(t, db)
+
+	if _, err := db.Greetings.GetActive(ctx, did.ID); err != ErrGreetingNotFound {
+		t.Errorf("Expected ErrGreetingNotFound without greetings, got %v", err)
+	}
+
+	expired := time.Now().Add(-time.Hour)
+	if err := db.Greetings.Save(ctx, &models.VoicemailGreeting{DIDID: did.ID, GreetingType: GreetingTypeStandard, AudioURL: "https://example.com/standard.wav"}); err != nil {
+		t.Fatalf("Failed to save standard greeting: %v", err)
+	}
+	if err := db.Greetings.Save(ctx, &models.VoicemailGreeting{DIDID: did.ID, GreetingType: GreetingTypeTemporary, AudioURL: "https://example.com/away.wav", IsActive: true, ExpiresAt: &expired}); err != nil {
+		t.Fatalf("Failed to save temporary greeting: %v", err)
+	}
+
+	active, err := db.Greetings.GetActive(ctx, did.ID)
+	if err != nil {
+		t.Fatalf("Failed to get active greeting: %v", err)
+	}
+	if active.GreetingType != GreetingTypeStandard {
+		t.Errorf("Expected expired temporary greeting to fall back to standard, got %s", active.GreetingType)
+	}
+}
+
+func TestVoicemailGreetingRepository_Delete(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	did := createGreetingTestDID(t, db)
+
+	if err := db.Greetings.Save(ctx, &models.VoicemailGreeting{DIDID: did.ID, GreetingType: GreetingTypeStandard, AudioURL: "https://example.com/a.wav"}); err != nil {
+		t.Fatalf("Failed to save greeting: %v", err)
+	}
+
+	if err := db.Greetings.Delete(ctx, did.ID, GreetingTypeStandard); err != nil {
+		t.Fatalf("Failed to delete greeting: %v", err)
+	}
+	if err := db.Greetings.Delete(ctx, did.ID, GreetingTypeStandard); err != ErrGreetingNotFound {
+		t.Errorf("Expected ErrGreetingNotFound on second delete, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+var ErrVoicemailQuotaNotFound = errors.New("voicemail quota not found")
+
+// What happens to new voicemails once a mailbox is at its quota
+const (
+	QuotaActionReject       = "reject"        // Callers hear that the mailbox is full
+	QuotaActionDeleteOldest = "delete_oldest" // The oldest messages make room
+)
+
+// VoicemailQuotaRepository handles database operations for voicemail box quotas
+type VoicemailQuotaRepository struct {
+	db *sql.DB
+}
+
+// NewVoicemailQuotaRepository creates a new VoicemailQuotaRepository
+func NewVoicemailQuotaRepository(db *sql.DB) *VoicemailQuotaRepository {
+	return &VoicemailQuotaRepository{db: db}
+}
+
+// Get retrieves the quota of a mailbox
+func (r *VoicemailQuotaRepository) Get(ctx context.Context, didID int64) (*models.VoicemailQuota, error) {
+	q := &models.VoicemailQuota{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT did_id, max_messages, max_mb, warn_percent, action, warned_at, updated_at
+		FROM voicemail_quotas WHERE did_id = ?
+	`, didID).Scan(&q.DIDID, &q.MaxMessages, &q.MaxMB, &q.WarnPercent, &q.Action, &q.WarnedAt, &q.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrVoicemailQuotaNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Save creates or replaces the quota of a mailbox. Whether the mailbox has
+// been warned is kept.
+func (r *VoicemailQuotaRepository) Save(ctx context.Context, q *models.VoicemailQuota) error {
+	q.UpdatedAt = time.Now()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO voicemail_quotas (did_id, max_messages, max_mb, warn_percent, action, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(did_id) DO UPDATE SET
+			max_messages = excluded.max_messages,
+			max_mb = excluded.max_mb,
+			warn_percent = excluded.warn_percent,
+			action = excluded.action,
+			updated_at = excluded.updated_at
+	`, q.DIDID, q.MaxMessages, q.MaxMB, q.WarnPercent, q.Action, q.UpdatedAt)
+	return err
+}
+
+// SetWarned records when a mailbox was warned it is near its quota, or
+// clears it with nil once usage drops back
+func (r *VoicemailQuotaRepository) SetWarned(ctx context.Context, didID int64, at *time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE voicemail_quotas SET warned_at = ? WHERE did_id = ?`, at, didID)
+	return err
+}
+
+// Delete removes the quota of a mailbox, leaving it unlimited
+func (r *VoicemailQuotaRepository) Delete(ctx context.Context, didID int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM voicemail_quotas WHERE did_id = ?`, didID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVoicemailQuotaNotFound
+	}
+	return nil
+}
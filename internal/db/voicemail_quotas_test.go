@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestVoicemailQuotaRepository(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	did := createGreetingTestDID(t, db)
+
+	if _, err := db.VoicemailQuotas.Get(ctx, did.ID); err != ErrVoicemailQuotaNotFound {
+		t.Fatalf("Expected ErrVoicemailQuotaNotFound, got %v", err)
+	}
+
+	quota := &models.VoicemailQuota{DIDID: did.ID, MaxMessages: 20, MaxMB: 10, WarnPercent: 80, Action: QuotaActionReject}
+	if err := db.VoicemailQuotas.Save(ctx, quota); err != nil {
+		t.Fatalf("Failed to save quota: %v", err)
+	}
+	now := time.Now()
+	if err := db.VoicemailQuotas.SetWarned(ctx, did.ID, &now); err != nil {
+		t.Fatalf("Failed to mark quota warned: %v", err)
+	}
+
+	// Changing the limits keeps the warning state
+	quota.MaxMessages, quota.Action = 30, QuotaActionDeleteOldest
+	if err := db.VoicemailQuotas.Save(ctx, quota); err != nil {
+		t.Fatalf("Failed to update quota: %v", err)
+	}
+	got, err := db.VoicemailQuotas.Get(ctx, did.ID)
+	if err != nil {
+		t.Fatalf("Failed to get quota: %v", err)
+	}
+	if got.MaxMessages != 30 || got.MaxMB != 10 || got.Action != QuotaActionDeleteOldest || got.WarnedAt == nil {
+		t.Errorf("Unexpected quota %+v", got)
+	}
+
+	if err := db.VoicemailQuotas.Delete(ctx, did.ID); err != nil {
+		t.Fatalf("Failed to delete quota: %v", err)
+	}
+	if err := db.VoicemailQuotas.Delete(ctx, did.ID); err != ErrVoicemailQuotaNotFound {
+		t.Errorf("Expected ErrVoicemailQuotaNotFound deleting twice, got %v", err)
+	}
+
+	// Only known actions are stored
+	quota.Action = "shout"
+	if err := db.VoicemailQuotas.Save(ctx, quota); err == nil {
+		t.Error("Expected an unknown action to be rejected")
+	}
+}
+
+func TestVoicemailRepository_UsageAndOldest(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	user := &models.User{Email: "box@example.com", PasswordHash: "hashed", Role: "user"}
+	if err := db.Users.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	for i, size := range []int64{1000, 2000, 3000} {
+		vm := &models.Voicemail{UserID: &user.ID, FromNumber: "+1555000000" + string(rune('0'+i)), Duration: 1, SizeBytes: size}
+		if err := db.Voicemails.Create(ctx, vm); err != nil {
+			t.Fatalf("Failed to create voicemail: %v", err)
+		}
+	}
+
+	usage, err := db.Voicemails.Usage(ctx, user.ID)
+	if err != nil || usage.Messages != 3 || usage.Bytes != 6000 {
+		t.Errorf("Usage = %+v, %v; want 3 messages, 6000 bytes", usage, err)
+	}
+	if empty, err := db.Voicemails.Usage(ctx, user.ID+1); err != nil || empty.Messages != 0 || empty.Bytes != 0 {
+		t.Errorf("Usage of an empty mailbox = %+v, %v", empty, err)
+	}
+
+	oldest, err := db.Voicemails.ListOldest(ctx, user.ID, 2)
+	if err != nil || len(oldest) != 2 || oldest[0].SizeBytes != 1000 || oldest[1].SizeBytes != 2000 {
+		t.Errorf("ListOldest = %+v, %v", oldest, err)
+	}
+}
@@ -23,19 +23,13 @@ func NewVoicemailRepository(db *sql.DB) *VoicemailRepository {
 
 // Create inserts a new voicemail
 func (r *VoicemailRepository) Create(ctx context.Context, vm *models.Voicemail) error {
-	result, err := r.db.ExecContext(ctx, `
-		INSERT INTO voicemails (cdr_id, user_id, from_number, audio_url, transcript, duration, is_read, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, vm.CDRID, vm.UserID, vm.FromNumber, vm.AudioURL, vm.Transcript, vm.Duration, vm.IsRead, time.Now())
-	if err != nil {
-		return err
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO voicemails (cdr_id, user_id, from_number, audio_url, transcript, duration, is_read, size_bytes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, vm.CDRID, vm.UserID, vm.FromNumber, vm.AudioURL, vm.Transcript, vm.Duration, vm.IsRead, vm.SizeBytes, time.Now()).Scan(&vm.ID); err != nil {
 		return err
 	}
-	vm.ID = id
 	return nil
 }
 
@@ -43,9 +37,9 @@ func (r *VoicemailRepository) Create(ctx context.Context, vm *models.Voicemail)
 func (r *VoicemailRepository) GetByID(ctx context.Context, id int64) (*models.Voicemail, error) {
 	vm := &models.Voicemail{}
 	err := r.db.QueryRowContext(ctx, `
-		SELECT id, cdr_id, user_id, from_number, audio_url, transcript, duration, is_read, created_at
+		SELECT id, cdr_id, user_id, from_number, audio_url, transcript, duration, is_read, size_bytes, created_at
 		FROM voicemails WHERE id = ?
-	`, id).Scan(&vm.ID, &vm.CDRID, &vm.UserID, &vm.FromNumber, &vm.AudioURL, &vm.Transcript, &vm.Duration, &vm.IsRead, &vm.CreatedAt)
+	`, id).Scan(&vm.ID, &vm.CDRID, &vm.UserID, &vm.FromNumber, &vm.AudioURL, &vm.Transcript, &vm.Duration, &vm.IsRead, &vm.SizeBytes, &vm.CreatedAt)
 	if err == sql.ErrNoRows {
 		return nil, ErrVoicemailNotFound
 	}
@@ -59,9 +53,9 @@ func (r *VoicemailRepository) GetByID(ctx context.Context, id int64) (*models.Vo
 func (r *VoicemailRepository) Update(ctx context.Context, vm *models.Voicemail) error {
 	_, err := r.db.ExecContext(ctx, `
 		UPDATE voicemails SET cdr_id = ?, user_id = ?, from_number = ?, audio_url = ?,
-		transcript = ?, duration = ?, is_read = ?
+		transcript = ?, duration = ?, is_read = ?, size_bytes = ?
 		WHERE id = ?
-	`, vm.CDRID, vm.UserID, vm.FromNumber, vm.AudioURL, vm.Transcript, vm.Duration, vm.IsRead, vm.ID)
+	`, vm.CDRID, vm.UserID, vm.FromNumber, vm.AudioURL, vm.Transcript, vm.Duration, vm.IsRead, vm.SizeBytes, vm.ID)
 	return err
 }
 
@@ -73,7 +67,7 @@ func (r *VoicemailRepository) Delete(ctx context.Context, id int64) error {
 
 // MarkAsRead marks a voicemail as read
 func (r *VoicemailRepository) MarkAsRead(ctx context.Context, id int64) error {
-	result, err := r.db.ExecContext(ctx, `UPDATE voicemails SET is_read = 1 WHERE id = ?`, id)
+	result, err := r.db.ExecContext(ctx, `UPDATE voicemails SET is_read = TRUE WHERE id = ?`, id)
 	if err != nil {
 		return err
 	}
@@ -89,14 +83,14 @@ func (r *VoicemailRepository) MarkAsRead(ctx context.Context, id int64) error {
 
 // MarkAsUnread marks a voicemail as unread
 func (r *VoicemailRepository) MarkAsUnread(ctx context.Context, id int64) error {
-	_, err := r.db.ExecContext(ctx, `UPDATE voicemails SET is_read = 0 WHERE id = ?`, id)
+	_, err := r.db.ExecContext(ctx, `UPDATE voicemails SET is_read = FALSE WHERE id = ?`, id)
 	return err
 }
 
 // List returns voicemails with pagination
 func (r *VoicemailRepository) List(ctx context.Context, limit, offset int) ([]*models.Voicemail, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, cdr_id, user_id, from_number, audio_url, transcript, duration, is_read, created_at
+		SELECT id, cdr_id, user_id, from_number, audio_url, transcript, duration, is_read, size_bytes, created_at
 		FROM voicemails ORDER BY created_at DESC LIMIT ? OFFSET ?
 	`, limit, offset)
 	if err != nil {
@@ -107,7 +101,7 @@ func (r *VoicemailRepository) List(ctx context.Context, limit, offset int) ([]*m
 	var vms []*models.Voicemail
 	for rows.Next() {
 		vm := &models.Voicemail{}
-		if err := rows.Scan(&vm.ID, &vm.CDRID, &vm.UserID, &vm.FromNumber, &vm.AudioURL, &vm.Transcript, &vm.Duration, &vm.IsRead, &vm.CreatedAt); err != nil {
+		if err := rows.Scan(&vm.ID, &vm.CDRID, &vm.UserID, &vm.FromNumber, &vm.AudioURL, &vm.Transcript, &vm.Duration, &vm.IsRead, &vm.SizeBytes, &vm.CreatedAt); err != nil {
 			return nil, err
 		}
 		vms = append(vms, vm)
@@ -118,7 +112,7 @@ func (r *VoicemailRepository) List(ctx context.Context, limit, offset int) ([]*m
 // ListByUser returns voicemails for a specific user
 func (r *VoicemailRepository) ListByUser(ctx context.Context, userID int64, limit, offset int) ([]*models.Voicemail, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, cdr_id, user_id, from_number, audio_url, transcript, duration, is_read, created_at
+		SELECT id, cdr_id, user_id, from_number, audio_url, transcript, duration, is_read, size_bytes, created_at
 		FROM voicemails WHERE user_id = ? ORDER BY created_at DESC LIMIT ? OFFSET ?
 	`, userID, limit, offset)
 	if err != nil {
@@ -129,7 +123,29 @@ func (r *VoicemailRepository) ListByUser(ctx context.Context, userID int64, limi
 	var vms []*models.Voicemail
 	for rows.Next() {
 		vm := &models.Voicemail{}
-		if err := rows.Scan(&vm.ID, &vm.CDRID, &vm.UserID, &vm.FromNumber, &vm.AudioURL, &vm.Transcript, &vm.Duration, &vm.IsRead, &vm.CreatedAt); err != nil {
+		if err := rows.Scan(&vm.ID, &vm.CDRID, &vm.UserID, &vm.FromNumber, &vm.AudioURL, &vm.Transcript, &vm.Duration, &vm.IsRead, &vm.SizeBytes, &vm.CreatedAt); err != nil {
+			return nil, err
+		}
+		vms = append(vms, vm)
+	}
+	return vms, rows.Err()
+}
+
+// ListByFromNumber returns voicemails left by a caller with pagination
+func (r *VoicemailRepository) ListByFromNumber(ctx context.Context, fromNumber string, limit, offset int) ([]*models.Voicemail, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, cdr_id, user_id, from_number, audio_url, transcript, duration, is_read, size_bytes, created_at
+		FROM voicemails WHERE from_number = ? ORDER BY created_at DESC LIMIT ? OFFSET ?
+	`, fromNumber, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var vms []*models.Voicemail
+	for rows.Next() {
+		vm := &models.Voicemail{}
+		if err := rows.Scan(&vm.ID, &vm.CDRID, &vm.UserID, &vm.FromNumber, &vm.AudioURL, &vm.Transcript, &vm.Duration, &vm.IsRead, &vm.SizeBytes, &vm.CreatedAt); err != nil {
 			return nil, err
 		}
 		vms = append(vms, vm)
@@ -137,11 +153,18 @@ func (r *VoicemailRepository) ListByUser(ctx context.Context, userID int64, limi
 	return vms, rows.Err()
 }
 
+// CountByFromNumber returns the count of voicemails left by a caller
+func (r *VoicemailRepository) CountByFromNumber(ctx context.Context, fromNumber string) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM voicemails WHERE from_number = ?`, fromNumber).Scan(&count)
+	return count, err
+}
+
 // ListUnread returns unread voicemails
 func (r *VoicemailRepository) ListUnread(ctx context.Context, userID *int64) ([]*models.Voicemail, error) {
 	query := `
-		SELECT id, cdr_id, user_id, from_number, audio_url, transcript, duration, is_read, created_at
-		FROM voicemails WHERE is_read = 0
+		SELECT id, cdr_id, user_id, from_number, audio_url, transcript, duration, is_read, size_bytes, created_at
+		FROM voicemails WHERE is_read = FALSE
 	`
 	args := []interface{}{}
 
@@ -161,7 +184,7 @@ func (r *VoicemailRepository) ListUnread(ctx context.Context, userID *int64) ([]
 	var vms []*models.Voicemail
 	for rows.Next() {
 		vm := &models.Voicemail{}
-		if err := rows.Scan(&vm.ID, &vm.CDRID, &vm.UserID, &vm.FromNumber, &vm.AudioURL, &vm.Transcript, &vm.Duration, &vm.IsRead, &vm.CreatedAt); err != nil {
+		if err := rows.Scan(&vm.ID, &vm.CDRID, &vm.UserID, &vm.FromNumber, &vm.AudioURL, &vm.Transcript, &vm.Duration, &vm.IsRead, &vm.SizeBytes, &vm.CreatedAt); err != nil {
 			return nil, err
 		}
 		vms = append(vms, vm)
@@ -171,7 +194,7 @@ func (r *VoicemailRepository) ListUnread(ctx context.Context, userID *int64) ([]
 
 // CountUnread returns the count of unread voicemails
 func (r *VoicemailRepository) CountUnread(ctx context.Context, userID *int64) (int, error) {
-	query := `SELECT COUNT(*) FROM voicemails WHERE is_read = 0`
+	query := `SELECT COUNT(*) FROM voicemails WHERE is_read = FALSE`
 	args := []interface{}{}
 
 	if userID != nil {
@@ -203,3 +226,78 @@ func (r *VoicemailRepository) UpdateTranscript(ctx context.Context, id int64, tr
 	_, err := r.db.ExecContext(ctx, `UPDATE voicemails SET transcript = ? WHERE id = ?`, transcript, id)
 	return err
 }
+
+// Usage returns the number and total size of the voicemails in a mailbox
+func (r *VoicemailRepository) Usage(ctx context.Context, userID int64) (models.VoicemailUsage, error) {
+	var usage models.VoicemailUsage
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(size_bytes), 0) FROM voicemails WHERE user_id = ?
+	`, userID).Scan(&usage.Messages, &usage.Bytes)
+	return usage, err
+}
+
+// ListOldest returns the oldest voicemails of a mailbox, oldest first
+func (r *VoicemailRepository) ListOldest(ctx context.Context, userID int64, limit int) ([]*models.Voicemail, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, cdr_id, user_id, from_number, audio_url, transcript, duration, is_read, size_bytes, created_at
+		FROM voicemails WHERE user_id = ? ORDER BY created_at ASC, id ASC LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var vms []*models.Voicemail
+	for rows.Next() {
+		vm := &models.Voicemail{}
+		if err := rows.Scan(&vm.ID, &vm.CDRID, &vm.UserID, &vm.FromNumber, &vm.AudioURL, &vm.Transcript, &vm.Duration, &vm.IsRead, &vm.SizeBytes, &vm.CreatedAt); err != nil {
+			return nil, err
+		}
+		vms = append(vms, vm)
+	}
+	return vms, rows.Err()
+}
+
+// SetChecksum records the checksum of a voicemail's local audio file
+func (r *VoicemailRepository) SetChecksum(ctx context.Context, id int64, checksum string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE voicemails SET checksum = ? WHERE id = ?`, checksum, id)
+	return err
+}
+
+// Checksum returns the checksum of a voicemail's local audio file, empty
+// when none was recorded
+func (r *VoicemailRepository) Checksum(ctx context.Context, id int64) (string, error) {
+	var checksum string
+	err := r.db.QueryRowContext(ctx, `SELECT checksum FROM voicemails WHERE id = ?`, id).Scan(&checksum)
+	if err == sql.ErrNoRows {
+		return "", ErrVoicemailNotFound
+	}
+	return checksum, err
+}
+
+// VoicemailMedia is where a voicemail's audio is and the checksum of its
+// local file
+type VoicemailMedia struct {
+	ID       int64
+	AudioURL string
+	Checksum string
+}
+
+// ListMedia returns the audio of every voicemail, oldest first
+func (r *VoicemailRepository) ListMedia(ctx context.Context) ([]VoicemailMedia, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, COALESCE(audio_url, ''), checksum FROM voicemails ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var media []VoicemailMedia
+	for rows.Next() {
+		var m VoicemailMedia
+		if err := rows.Scan(&m.ID, &m.AudioURL, &m.Checksum); err != nil {
+			return nil, err
+		}
+		media = append(media, m)
+	}
+	return media, rows.Err()
+}
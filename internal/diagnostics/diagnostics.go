@@ -0,0 +1,237 @@
+// Package diagnostics keeps recovered panics and recent log lines in memory
+// so they can be included in support bundles
+package diagnostics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redacted replaces secret values in support bundles
+const Redacted = "[redacted]"
+
+// Crash is a panic that was recovered
+type Crash struct {
+	ID     int64     `json:"id"`
+	Source string    `json:"source"` // What was running, e.g. "http GET /api/dids" or "sip INVITE"
+	Panic  string    `json:"panic"`
+	Stack  string    `json:"stack"`
+	At     time.Time `json:"at"`
+}
+
+// Store keeps the most recent crashes and log lines. A nil Store ignores
+// everything, so code can report panics whether or not diagnostics are set up.
+type Store struct {
+	mu         sync.Mutex
+	crashes    []Crash
+	maxCrashes int
+	nextID     int64
+	logs       [][]byte
+	maxLogs    int
+}
+
+// NewStore creates a Store holding up to maxCrashes crashes and maxLogs log lines
+func NewStore(maxCrashes, maxLogs int) *Store {
+	return &Store{maxCrashes: maxCrashes, maxLogs: maxLogs, nextID: 1}
+}
+
+// RecordPanic stores a recovered panic and logs it
+func (s *Store) RecordPanic(source string, value any, stack []byte) {
+	slog.Error("Recovered from panic", "source", source, "panic", fmt.Sprint(value), "stack", string(stack))
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.crashes = append(s.crashes, Crash{
+		ID:     s.nextID,
+		Source: source,
+		Panic:  fmt.Sprint(value),
+		Stack:  string(stack),
+		At:     time.Now(),
+	})
+	s.nextID++
+	if len(s.crashes) > s.maxCrashes {
+		s.crashes = s.crashes[len(s.crashes)-s.maxCrashes:]
+	}
+}
+
+// Recover records a panic in the calling goroutine instead of letting it
+// crash the server. It must be deferred directly:
+//
+//	defer store.Recover("registration cleanup")
+func (s *Store) Recover(source string) {
+	if v := recover(); v != nil {
+		s.RecordPanic(source, v, debug.Stack())
+	}
+}
+
+// Crashes returns the stored crashes, newest first
+func (s *Store) Crashes() []Crash {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	crashes := make([]Crash, len(s.crashes))
+	for i, c := range s.crashes {
+		crashes[len(crashes)-1-i] = c
+	}
+	return crashes
+}
+
+// Logs returns the stored log lines, oldest first. Each line is a JSON object.
+func (s *Store) Logs() []json.RawMessage {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	logs := make([]json.RawMessage, len(s.logs))
+	for i, line := range s.logs {
+		logs[i] = json.RawMessage(line)
+	}
+	return logs
+}
+
+// Write stores one log line. The JSON handler writes each record in a
+// single call.
+func (s *Store) Write(p []byte) (int, error) {
+	line := bytes.TrimRight(p, "\n")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs = append(s.logs, append([]byte(nil), line...))
+	if len(s.logs) > s.maxLogs {
+		s.logs = s.logs[len(s.logs)-s.maxLogs:]
+	}
+	return len(p), nil
+}
+
+// LogHandler returns a handler that writes records to the store, with
+// secret attributes redacted
+func (s *Store) LogHandler() slog.Handler {
+	return slog.NewJSONHandler(s, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if IsSecret(a.Key) {
+				return slog.String(a.Key, Redacted)
+			}
+			return a
+		},
+	})
+}
+
+// secretWords mark field and attribute names that hold credentials. Call
+// and message SIDs aren't secret and stay readable for tracing.
+var secretWords = []string{"password", "token", "secret", "key", "accountsid", "credential", "authorization", "cookie", "dsn"}
+
+// IsSecret reports whether a field or attribute name looks like it holds
+// a credential
+func IsSecret(name string) bool {
+	name = strings.ToLower(strings.ReplaceAll(name, "_", ""))
+	for _, word := range secretWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns v as generic JSON with non-empty secret fields replaced,
+// for including configuration in support bundles
+func Redact(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return redactValue(out), nil
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if IsSecret(key) && !isEmpty(value) {
+				v[key] = Redacted
+				continue
+			}
+			v[key] = redactValue(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	}
+	return v
+}
+
+// isEmpty reports whether a secret field is unset, so bundles still show
+// which credentials are missing
+func isEmpty(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
+
+// TeeHandler sends every record to each of its handlers
+type TeeHandler []slog.Handler
+
+// Enabled reports whether any handler accepts level
+func (t TeeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle passes r to each handler that accepts it, returning the first error
+func (t TeeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var first error
+	for _, h := range t {
+		if !h.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, r.Clone()); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// WithAttrs returns a TeeHandler whose handlers include attrs
+func (t TeeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(TeeHandler, len(t))
+	for i, h := range t {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+// WithGroup returns a TeeHandler whose handlers nest attributes under name
+func (t TeeHandler) WithGroup(name string) slog.Handler {
+	out := make(TeeHandler, len(t))
+	for i, h := range t {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
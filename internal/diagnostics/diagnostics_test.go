@@ -0,0 +1,103 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestStore_Crashes(t *testing.T) {
+	store := NewStore(2, 10)
+	for _, source := range []string{"first", "second", "third"} {
+		func() {
+			defer store.Recover(source)
+			panic(source + " failed")
+		}()
+	}
+
+	crashes := store.Crashes()
+	if len(crashes) != 2 {
+		t.Fatalf("Expected the 2 newest crashes, got %d", len(crashes))
+	}
+	if crashes[0].Source != "third" || crashes[0].ID != 3 || crashes[1].Panic != "second failed" {
+		t.Errorf("Expected newest first, got %+v", crashes)
+	}
+	if !strings.Contains(crashes[0].Stack, "TestStore_Crashes") {
+		t.Errorf("Expected the stack to show where the panic happened, got %s", crashes[0].Stack)
+	}
+}
+
+func TestStore_NilIgnoresPanics(t *testing.T) {
+	var store *Store
+	func() {
+		defer store.Recover("nil store")
+		panic("boom")
+	}()
+	if crashes := store.Crashes(); crashes != nil {
+		t.Errorf("Expected no crashes, got %+v", crashes)
+	}
+}
+
+func TestStore_LogHandler(t *testing.T) {
+	store := NewStore(10, 2)
+	logger := slog.New(store.LogHandler())
+
+	logger.Info("one")
+	logger.Info("two", "auth_token", "s3cret", "call_sid", "CA123")
+	logger.Info("three", "password", "hunter2")
+
+	logs := store.Logs()
+	if len(logs) != 2 {
+		t.Fatalf("Expected the 2 newest lines, got %d", len(logs))
+	}
+	var line map[string]any
+	if err := json.Unmarshal(logs[0], &line); err != nil {
+		t.Fatalf("Expected a JSON line, got %s", logs[0])
+	}
+	if line["msg"] != "two" || line["auth_token"] != Redacted || line["call_sid"] != "CA123" {
+		t.Errorf("Expected the token redacted and the call SID kept, got %v", line)
+	}
+	if strings.Contains(string(logs[1]), "hunter2") {
+		t.Errorf("Expected the password redacted, got %s", logs[1])
+	}
+}
+
+func TestRedact(t *testing.T) {
+	type tls struct {
+		Enabled bool
+		KeyFile string
+	}
+	cfg := struct {
+		SIPPort          int
+		TwilioAccountSID string
+		TwilioAuthToken  string
+		SMTPPassword     string
+		GotifyToken      string
+		TLS              *tls
+	}{
+		SIPPort:          5060,
+		TwilioAccountSID: "AC123",
+		TwilioAuthToken:  "s3cret",
+		TLS:              &tls{Enabled: true, KeyFile: "/certs/key.pem"},
+	}
+
+	out, err := Redact(cfg)
+	if err != nil {
+		t.Fatalf("Failed to redact: %v", err)
+	}
+	m := out.(map[string]any)
+	if m["TwilioAccountSID"] != Redacted || m["TwilioAuthToken"] != Redacted {
+		t.Errorf("Expected Twilio credentials redacted, got %v", m)
+	}
+	// Unset secrets stay empty so the bundle shows they're missing
+	if m["SMTPPassword"] != "" || m["GotifyToken"] != "" {
+		t.Errorf("Expected unset secrets left empty, got %v", m)
+	}
+	if m["SIPPort"] != float64(5060) {
+		t.Errorf("Expected other settings kept, got %v", m["SIPPort"])
+	}
+	if m["TLS"].(map[string]any)["KeyFile"] != Redacted {
+		t.Errorf("Expected nested secrets redacted, got %v", m["TLS"])
+	}
+}
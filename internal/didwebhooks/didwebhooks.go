@@ -0,0 +1,264 @@
+// Package didwebhooks points the Twilio numbers behind DIDs at this
+// server's webhooks, and periodically checks that they still point there
+package didwebhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/announcements"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/publicurl"
+	"github.com/btafoya/gosip/internal/twilio"
+)
+
+// Webhook paths under the public URL
+const (
+	VoicePath  = "/api/webhooks/voice/incoming"
+	StatusPath = "/api/webhooks/voice/status"
+	SMSPath    = "/api/webhooks/sms/incoming"
+)
+
+// ErrNumberNotFound is returned when a DID isn't a number on the Twilio
+// account
+var ErrNumberNotFound = errors.New("number is not on the Twilio account")
+
+// NumberClient is the part of the Twilio client used to manage number
+// webhooks
+type NumberClient interface {
+	ListIncomingPhoneNumbers(ctx context.Context) ([]twilio.IncomingPhoneNumber, error)
+	GetNumberWebhooks(ctx context.Context, phoneNumberSID string) (*twilio.NumberWebhooks, error)
+	SetNumberWebhooks(ctx context.Context, phoneNumberSID string, hooks twilio.NumberWebhooks) error
+}
+
+// Manager configures and verifies number webhooks
+type Manager struct {
+	cfg      *config.Config
+	database *db.DB
+	hub      *events.Hub
+	numbers  NumberClient
+	client   *http.Client
+
+	// mu serializes changes so a verification never sees half a change
+	mu sync.Mutex
+}
+
+// NewManager creates a Manager
+func NewManager(cfg *config.Config, database *db.DB, hub *events.Hub, numbers NumberClient) *Manager {
+	return &Manager{
+		cfg:      cfg,
+		database: database,
+		hub:      hub,
+		numbers:  numbers,
+		client:   &http.Client{Timeout: config.DIDWebhookCheckTimeout},
+	}
+}
+
+// Start verifies every configured DID now and then every
+// DIDWebhookCheckInterval
+func (m *Manager) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(config.DIDWebhookCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			m.VerifyAll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Expected returns the webhooks a number should have under a public URL
+func Expected(baseURL string) twilio.NumberWebhooks {
+	return twilio.NumberWebhooks{
+		VoiceURL:             baseURL + VoicePath,
+		VoiceMethod:          http.MethodPost,
+		StatusCallback:       baseURL + StatusPath,
+		StatusCallbackMethod: http.MethodPost,
+		SMSURL:               baseURL + SMSPath,
+		SMSMethod:            http.MethodPost,
+	}
+}
+
+// ValidateBaseURL checks that the public base URL is set and reaches this
+// server, so numbers are never pointed at an address Twilio can't use. It
+// returns the URL.
+func (m *Manager) ValidateBaseURL(ctx context.Context) (string, error) {
+	base := publicurl.Get(ctx, m.cfg, m.database)
+	if base == "" {
+		return "", fmt.Errorf("the public base URL is not set")
+	}
+	u, err := publicurl.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	health := u.JoinPath("/api/health").String()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, health, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("GET %s failed: %w", health, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s returned %d", health, resp.StatusCode)
+	}
+	return base, nil
+}
+
+// Configure points a DID's Twilio number at the webhooks under baseURL,
+// which should have passed ValidateBaseURL, stores it and verifies Twilio
+// has it
+func (m *Manager) Configure(ctx context.Context, did *models.DID, baseURL string) (*models.DIDWebhooks, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sid, err := m.phoneNumberSID(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.numbers.SetNumberWebhooks(ctx, sid, Expected(baseURL)); err != nil {
+		return nil, err
+	}
+	if err := m.database.DIDWebhooks.Upsert(ctx, did.ID, sid, baseURL); err != nil {
+		return nil, err
+	}
+
+	slog.Info("DID webhooks configured", "did", did.Number, "phone_number_sid", sid, "base_url", baseURL)
+	return m.verify(ctx, did.ID)
+}
+
+// phoneNumberSID returns the Twilio SID of a DID's number, looking it up
+// and storing it on the DID when it isn't known yet
+func (m *Manager) phoneNumberSID(ctx context.Context, did *models.DID) (string, error) {
+	if did.TwilioSID != "" {
+		return did.TwilioSID, nil
+	}
+
+	numbers, err := m.numbers.ListIncomingPhoneNumbers(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, n := range numbers {
+		if n.PhoneNumber == did.Number {
+			did.TwilioSID = n.SID
+			if err := m.database.DIDs.Update(ctx, did); err != nil {
+				return "", err
+			}
+			return n.SID, nil
+		}
+	}
+	return "", ErrNumberNotFound
+}
+
+// Remove stops verifying a DID's webhooks. Twilio keeps them.
+func (m *Manager) Remove(ctx context.Context, didID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.database.DIDWebhooks.Delete(ctx, didID); err != nil {
+		return err
+	}
+	m.updateAnnouncement(ctx)
+	return nil
+}
+
+// Verify checks a DID's webhooks against Twilio and records the outcome
+func (m *Manager) Verify(ctx context.Context, didID int64) (*models.DIDWebhooks, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.verify(ctx, didID)
+}
+
+// VerifyAll checks every configured DID. Numbers Twilio can't be asked
+// about keep their last result.
+func (m *Manager) VerifyAll(ctx context.Context) {
+	hooks, err := m.database.DIDWebhooks.List(ctx)
+	if err != nil {
+		slog.Error("Failed to list DID webhooks", "error", err)
+		return
+	}
+	for _, h := range hooks {
+		if _, err := m.Verify(ctx, h.DIDID); err != nil {
+			slog.Warn("Failed to verify DID webhooks", "error", err, "did", h.Number)
+		}
+	}
+}
+
+// verify checks a DID's webhooks with mu held
+func (m *Manager) verify(ctx context.Context, didID int64) (*models.DIDWebhooks, error) {
+	h, err := m.database.DIDWebhooks.Get(ctx, didID)
+	if err != nil {
+		return nil, err
+	}
+	actual, err := m.numbers.GetNumberWebhooks(ctx, h.PhoneNumberSID)
+	if err != nil {
+		return nil, err
+	}
+
+	found := Problems(h, publicurl.Get(ctx, m.cfg, m.database), actual)
+	if len(found) > 0 && h.Intact {
+		slog.Error("DID webhooks no longer match Twilio", "did", h.Number, "problems", found)
+	}
+	if err := m.database.DIDWebhooks.RecordVerification(ctx, didID, found, time.Now()); err != nil {
+		return nil, err
+	}
+	m.updateAnnouncement(ctx)
+	return m.database.DIDWebhooks.Get(ctx, didID)
+}
+
+// updateAnnouncement raises or clears the drifted webhooks announcement
+// from the stored verification results
+func (m *Manager) updateAnnouncement(ctx context.Context) {
+	hooks, err := m.database.DIDWebhooks.List(ctx)
+	if err != nil {
+		slog.Error("Failed to list DID webhooks", "error", err)
+		return
+	}
+	var drifted []string
+	for _, h := range hooks {
+		if !h.Intact {
+			drifted = append(drifted, h.Number)
+		}
+	}
+	announcements.RecordDIDWebhooks(ctx, m.database, m.hub, drifted)
+}
+
+// Problems lists how a number's webhooks differ from the ones configured.
+// A public URL that changed since then is reported too, as the numbers
+// need configuring again.
+func Problems(h *models.DIDWebhooks, publicURL string, actual *twilio.NumberWebhooks) []string {
+	var problems []string
+	if publicURL != "" && publicURL != h.BaseURL {
+		problems = append(problems, fmt.Sprintf("Public URL changed from %q to %q", h.BaseURL, publicURL))
+	}
+
+	expected := Expected(h.BaseURL)
+	check := func(name, got, want string) {
+		if got != want {
+			problems = append(problems, fmt.Sprintf("%s is %q, expected %q", name, got, want))
+		}
+	}
+	check("Voice URL", actual.VoiceURL, expected.VoiceURL)
+	check("Voice method", actual.VoiceMethod, expected.VoiceMethod)
+	check("Status callback", actual.StatusCallback, expected.StatusCallback)
+	check("Status callback method", actual.StatusCallbackMethod, expected.StatusCallbackMethod)
+	check("SMS URL", actual.SMSURL, expected.SMSURL)
+	check("SMS method", actual.SMSMethod, expected.SMSMethod)
+	return problems
+}
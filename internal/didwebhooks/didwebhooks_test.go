@@ -0,0 +1,160 @@
+package didwebhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/announcements"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/twilio"
+)
+
+// setupTestDB creates an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	database, err := db.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Close()
+	})
+	return database
+}
+
+// fakeNumbers holds the account's numbers and their webhooks as Twilio would
+type fakeNumbers struct {
+	numbers []twilio.IncomingPhoneNumber
+	hooks   map[string]twilio.NumberWebhooks
+}
+
+func (f *fakeNumbers) ListIncomingPhoneNumbers(ctx context.Context) ([]twilio.IncomingPhoneNumber, error) {
+	return f.numbers, nil
+}
+
+func (f *fakeNumbers) GetNumberWebhooks(ctx context.Context, phoneNumberSID string) (*twilio.NumberWebhooks, error) {
+	h := f.hooks[phoneNumberSID]
+	return &h, nil
+}
+
+func (f *fakeNumbers) SetNumberWebhooks(ctx context.Context, phoneNumberSID string, hooks twilio.NumberWebhooks) error {
+	f.hooks[phoneNumberSID] = hooks
+	return nil
+}
+
+func TestManager_ValidateBaseURL(t *testing.T) {
+	database := setupTestDB(t)
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	for _, tt := range []struct {
+		publicURL string
+		ok        bool
+	}{
+		{"", false},
+		{"ftp://pbx.example.com", false},
+		{healthy.URL, true},
+		{healthy.URL + "/gosip", false}, // No GoSIP under that path
+	} {
+		m := NewManager(&config.Config{PublicURL: tt.publicURL}, database, nil, &fakeNumbers{})
+		base, err := m.ValidateBaseURL(context.Background())
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateBaseURL(%q) = %q, %v", tt.publicURL, base, err)
+		}
+	}
+}
+
+func TestManager_ConfigureAndVerify(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+	did := &models.DID{Number: "+15551234567", VoiceEnabled: true, SMSEnabled: true}
+	if err := database.DIDs.Create(ctx, did); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{PublicURL: "https://pbx.example.com"}
+	numbers := &fakeNumbers{
+		numbers: []twilio.IncomingPhoneNumber{{SID: "PN1", PhoneNumber: "+15551234567"}},
+		hooks:   map[string]twilio.NumberWebhooks{"PN1": {VoiceURL: "https://demo.twilio.com/welcome/voice/"}},
+	}
+	m := NewManager(cfg, database, events.NewHub(10), numbers)
+
+	h, err := m.Configure(ctx, did, cfg.PublicURL)
+	if err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	if !h.Intact || h.VerifiedAt == nil || h.PhoneNumberSID != "PN1" || h.Number != "+15551234567" {
+		t.Fatalf("Expected intact, verified webhooks, got %+v", h)
+	}
+	if numbers.hooks["PN1"].VoiceURL != "https://pbx.example.com/api/webhooks/voice/incoming" ||
+		numbers.hooks["PN1"].SMSURL != "https://pbx.example.com/api/webhooks/sms/incoming" {
+		t.Errorf("Expected the number pointed at this server, got %+v", numbers.hooks["PN1"])
+	}
+	if stored, _ := database.DIDs.GetByID(ctx, did.ID); stored.TwilioSID != "PN1" {
+		t.Errorf("Expected the number's SID stored on the DID, got %q", stored.TwilioSID)
+	}
+
+	// Someone points the SMS URL elsewhere in the Twilio console
+	hooks := numbers.hooks["PN1"]
+	hooks.SMSURL = "https://other.example.com/sms"
+	numbers.hooks["PN1"] = hooks
+	m.VerifyAll(ctx)
+	h, _ = database.DIDWebhooks.Get(ctx, did.ID)
+	if h.Intact || len(h.Problems) != 1 {
+		t.Errorf("Expected the drift reported, got %+v", h)
+	}
+	if _, err := database.Announcements.GetByKey(ctx, announcements.KeyDIDWebhooks); err != nil {
+		t.Errorf("Expected an announcement for the drifted number: %v", err)
+	}
+
+	// Configuring again repairs it and clears the announcement
+	if h, err = m.Configure(ctx, did, cfg.PublicURL); err != nil || !h.Intact {
+		t.Fatalf("Expected the webhooks repaired, got %+v, %v", h, err)
+	}
+	if _, err := database.Announcements.GetByKey(ctx, announcements.KeyDIDWebhooks); err == nil {
+		t.Error("Expected the announcement cleared")
+	}
+
+	// A new public URL means the numbers need configuring again
+	cfg.PublicURL = "https://new.example.com"
+	if h, _ = m.Verify(ctx, did.ID); h.Intact || len(h.Problems) != 1 {
+		t.Errorf("Expected the public URL change reported, got %+v", h)
+	}
+
+	if err := m.Remove(ctx, did.ID); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := database.Announcements.GetByKey(ctx, announcements.KeyDIDWebhooks); err == nil {
+		t.Error("Expected the announcement cleared once the DID isn't verified")
+	}
+}
+
+func TestManager_Configure_UnknownNumber(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+	did := &models.DID{Number: "+15559999999"}
+	if err := database.DIDs.Create(ctx, did); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(&config.Config{}, database, nil, &fakeNumbers{hooks: map[string]twilio.NumberWebhooks{}})
+	if _, err := m.Configure(ctx, did, "https://pbx.example.com"); !errors.Is(err, ErrNumberNotFound) {
+		t.Errorf("Configure = %v, want ErrNumberNotFound", err)
+	}
+}
@@ -0,0 +1,92 @@
+package discovery
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Identity is the vendor, model and firmware parsed from a device banner
+type Identity struct {
+	Vendor   string
+	Model    string
+	Firmware string
+}
+
+// bannerPatterns match the SSDP server strings, mDNS instance names and
+// user agents of common IP phones. The first group captures the model.
+var bannerPatterns = []struct {
+	vendor  string
+	pattern *regexp.Regexp
+}{
+	{"grandstream", regexp.MustCompile(`(?i)grandstream[\s/_-]*(?:model[\s:]*)?((?:GXP|GXV|GRP|DP|WP|HT|GAC)\d{3,4}[A-Z]*)`)},
+	{"yealink", regexp.MustCompile(`(?i)yealink[\s/_-]*(?:SIP[\s_-]?)?((?:T|W|CP|VP)\d{2,3}[A-Z]*)`)},
+	{"polycom", regexp.MustCompile(`(?i)poly(?:com)?[\s/_-]*(?:soundpoint[\s_-]*ip[\s_-]*|soundstation[\s_-]*ip[\s_-]*|vvx[\s_-]*)?((?:VVX[\s_-]?|IP[\s_-]?|CCX[\s_-]?|Trio[\s_-]?)?\d{3,4}[A-Z]*)`)},
+	{"snom", regexp.MustCompile(`(?i)snom[\s/_-]*(D?\d{3}[A-Z]*)`)},
+	{"cisco", regexp.MustCompile(`(?i)cisco[\s/_-]*((?:SPA|CP-?)\d{3,4}[A-Z]*)`)},
+	{"fanvil", regexp.MustCompile(`(?i)fanvil[\s/_-]*([A-Z]\d{1,3}[A-Z]*)`)},
+}
+
+// firmwarePattern matches a dotted version number such as 1.0.11.23
+var firmwarePattern = regexp.MustCompile(`\d+(?:\.\d+){2,}`)
+
+// ouiVendors maps the MAC address prefixes of IP phone vendors
+var ouiVendors = map[string]string{
+	"00:0b:82": "grandstream",
+	"c0:74:ad": "grandstream",
+	"00:15:65": "yealink",
+	"24:9a:d8": "yealink",
+	"80:5e:c0": "yealink",
+	"00:04:f2": "polycom",
+	"64:16:7f": "polycom",
+	"00:04:13": "snom",
+	"0c:38:3e": "fanvil",
+}
+
+// Identify parses the vendor, model and firmware version from a banner,
+// returning an empty Identity when the banner is not a known IP phone
+func Identify(banner string) Identity {
+	for _, bp := range bannerPatterns {
+		loc := bp.pattern.FindStringSubmatchIndex(banner)
+		if loc == nil {
+			continue
+		}
+
+		model := strings.ToUpper(banner[loc[2]:loc[3]])
+		model = strings.NewReplacer(" ", "", "_", "").Replace(model)
+
+		id := Identity{Vendor: bp.vendor, Model: model}
+		id.Firmware = firmwarePattern.FindString(banner[loc[1]:])
+		return id
+	}
+	return Identity{}
+}
+
+// VendorForMAC returns the IP phone vendor that owns a MAC address prefix,
+// or an empty string when the prefix is unknown
+func VendorForMAC(mac string) string {
+	mac = NormalizeMAC(mac)
+	if len(mac) < 8 {
+		return ""
+	}
+	return ouiVendors[mac[:8]]
+}
+
+// NormalizeMAC formats a MAC address as lowercase colon-separated octets,
+// returning an empty string when it is not a valid MAC address
+func NormalizeMAC(mac string) string {
+	hex := strings.ToLower(strings.NewReplacer(":", "", "-", "", ".", "").Replace(strings.TrimSpace(mac)))
+	if len(hex) != 12 {
+		return ""
+	}
+	for _, c := range hex {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return ""
+		}
+	}
+
+	octets := make([]string, 6)
+	for i := range octets {
+		octets[i] = hex[i*2 : i*2+2]
+	}
+	return strings.Join(octets, ":")
+}
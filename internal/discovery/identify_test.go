@@ -0,0 +1,58 @@
+package discovery
+
+import "testing"
+
+func TestIdentify(t *testing.T) {
+	tests := []struct {
+		banner string
+		want   Identity
+	}{
+		{"Linux/2.6 UPnP/1.0 Grandstream GXP2170/1.0.9.135", Identity{"grandstream", "GXP2170", "1.0.9.135"}},
+		{"Grandstream Model: GXP1760W 1.0.4.100", Identity{"grandstream", "GXP1760W", "1.0.4.100"}},
+		{"Yealink SIP-T46S 66.86.0.15", Identity{"yealink", "T46S", "66.86.0.15"}},
+		{"Yealink T54W", Identity{"yealink", "T54W", ""}},
+		{"PolycomVVX-VVX_411-UA/6.3.1.8427", Identity{"polycom", "VVX411", "6.3.1.8427"}},
+		{"snomD785/10.1.54.13", Identity{"snom", "D785", "10.1.54.13"}},
+		{"Cisco/SPA504G-7.6.2e", Identity{"cisco", "SPA504G", "7.6.2"}},
+		{"Cisco CP-7841 sip78xx.14-1-1", Identity{"cisco", "CP-7841", ""}},
+		{"Fanvil X4 2.4.5.1", Identity{"fanvil", "X4", "2.4.5.1"}},
+		{"Linux/3.10 UPnP/1.0 MiniDLNA/1.3.0", Identity{}},
+		{"", Identity{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.banner, func(t *testing.T) {
+			if got := Identify(tt.banner); got != tt.want {
+				t.Errorf("Identify(%q) = %+v, want %+v", tt.banner, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVendorForMAC(t *testing.T) {
+	tests := []struct {
+		mac  string
+		want string
+	}{
+		{"00:0B:82:12:34:56", "grandstream"},
+		{"80-5e-c0-aa-bb-cc", "yealink"},
+		{"0004.f2aa.bbcc", "polycom"},
+		{"aa:bb:cc:dd:ee:ff", ""},
+		{"not-a-mac", ""},
+	}
+
+	for _, tt := range tests {
+		if got := VendorForMAC(tt.mac); got != tt.want {
+			t.Errorf("VendorForMAC(%q) = %q, want %q", tt.mac, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeMAC(t *testing.T) {
+	if got := NormalizeMAC("000B82123456"); got != "00:0b:82:12:34:56" {
+		t.Errorf("Expected 00:0b:82:12:34:56, got %s", got)
+	}
+	if got := NormalizeMAC("00:0b:82:12:34"); got != "" {
+		t.Errorf("Expected invalid MAC to be rejected, got %s", got)
+	}
+}
@@ -0,0 +1,359 @@
+// Package discovery finds IP phones on the local network using SSDP and mDNS
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Discovery sources
+const (
+	SourceSSDP = "ssdp"
+	SourceMDNS = "mdns"
+)
+
+const (
+	ssdpAddr = "239.255.255.250:1900"
+	mdnsAddr = "224.0.0.251:5353"
+)
+
+// mdnsServices are the DNS-SD service types queried over mDNS
+var mdnsServices = []string{"_sip._udp.local.", "_sip._tcp.local.", "_http._tcp.local."}
+
+// Device is an IP phone found on the network
+type Device struct {
+	IPAddress  string
+	MACAddress string
+	Vendor     string
+	Model      string
+	Firmware   string
+	Source     string
+	Banner     string
+}
+
+// Scanner discovers IP phones with SSDP M-SEARCH and mDNS queries
+type Scanner struct {
+	// ARPTable is read to resolve MAC addresses (default: /proc/net/arp)
+	ARPTable string
+	client   *http.Client
+}
+
+// NewScanner creates a new Scanner
+func NewScanner() *Scanner {
+	return &Scanner{
+		ARPTable: "/proc/net/arp",
+		client:   &http.Client{Timeout: 2 * time.Second},
+	}
+}
+
+// Scan listens for SSDP and mDNS responses until the timeout elapses and
+// returns the responders identified as IP phones
+func (s *Scanner) Scan(ctx context.Context, timeout time.Duration) ([]Device, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		found   []Device
+		errs    []error
+		collect = func(devices []Device, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			found = append(found, devices...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		collect(s.scanSSDP(ctx))
+	}()
+	go func() {
+		defer wg.Done()
+		collect(s.scanMDNS(ctx))
+	}()
+	wg.Wait()
+
+	// Only fail when neither protocol could be used
+	if len(errs) == 2 {
+		return nil, errs[0]
+	}
+
+	macs := readARPTable(s.ARPTable)
+	return identifyPhones(merge(found), macs), nil
+}
+
+// scanSSDP sends an M-SEARCH and collects the responses
+func (s *Scanner) scanSSDP(ctx context.Context) ([]Device, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	addr, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddr + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: ssdp:all\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(search), addr); err != nil {
+		return nil, err
+	}
+
+	var devices []Device
+	for _, resp := range readPackets(ctx, conn) {
+		device, location, ok := parseSSDPResponse(resp.data)
+		if !ok {
+			continue
+		}
+		device.IPAddress = resp.ip
+		if location != "" && Identify(device.Banner).Vendor == "" {
+			if desc := s.fetchDescription(ctx, location); desc != "" {
+				device.Banner = strings.TrimSpace(device.Banner + " " + desc)
+			}
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// scanMDNS sends a one-shot mDNS query for phone-related services
+func (s *Scanner) scanMDNS(ctx context.Context) ([]Device, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	addr, err := net.ResolveUDPAddr("udp4", mdnsAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	query := new(dns.Msg)
+	for _, service := range mdnsServices {
+		query.Question = append(query.Question, dns.Question{Name: service, Qtype: dns.TypePTR, Qclass: dns.ClassINET})
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteTo(packed, addr); err != nil {
+		return nil, err
+	}
+
+	var devices []Device
+	for _, resp := range readPackets(ctx, conn) {
+		msg := new(dns.Msg)
+		if err := msg.Unpack(resp.data); err != nil {
+			continue
+		}
+		if device, ok := parseMDNSResponse(msg); ok {
+			device.IPAddress = resp.ip
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
+type packet struct {
+	ip   string
+	data []byte
+}
+
+// readPackets reads datagrams until the context is done
+func readPackets(ctx context.Context, conn net.PacketConn) []packet {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+	}
+	go func() {
+		<-ctx.Done()
+		conn.SetReadDeadline(time.Now())
+	}()
+
+	var packets []packet
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return packets
+		}
+		udpAddr, ok := from.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		packets = append(packets, packet{ip: udpAddr.IP.String(), data: append([]byte(nil), buf[:n]...)})
+	}
+}
+
+// parseSSDPResponse extracts the banner and description URL from an M-SEARCH response
+func parseSSDPResponse(data []byte) (Device, string, bool) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+	if err != nil {
+		return Device{}, "", false
+	}
+	resp.Body.Close()
+
+	banner := resp.Header.Get("Server")
+	if banner == "" {
+		banner = resp.Header.Get("User-Agent")
+	}
+	return Device{Source: SourceSSDP, Banner: banner}, resp.Header.Get("Location"), true
+}
+
+// deviceDescription is the subset of a UPnP device description used for identification
+type deviceDescription struct {
+	Device struct {
+		Manufacturer string `xml:"manufacturer"`
+		ModelName    string `xml:"modelName"`
+		ModelNumber  string `xml:"modelNumber"`
+	} `xml:"device"`
+}
+
+// fetchDescription returns "manufacturer modelName modelNumber" from a UPnP
+// description document, or an empty string when it cannot be read
+func (s *Scanner) fetchDescription(ctx context.Context, location string) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return ""
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	var desc deviceDescription
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&desc); err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(desc.Device.Manufacturer+" "+desc.Device.ModelName+" "+desc.Device.ModelNumber), " ")
+}
+
+// parseMDNSResponse builds a banner from the service instance name and TXT records
+func parseMDNSResponse(msg *dns.Msg) (Device, bool) {
+	var parts []string
+	for _, rr := range append(msg.Answer, msg.Extra...) {
+		switch rec := rr.(type) {
+		case *dns.PTR:
+			// "Yealink T54W._http._tcp.local." -> "Yealink T54W"
+			if labels := dns.SplitDomainName(rec.Ptr); len(labels) > 0 {
+				parts = append(parts, unescapeLabel(labels[0]))
+			}
+		case *dns.TXT:
+			for _, txt := range rec.Txt {
+				key, value, ok := strings.Cut(txt, "=")
+				if !ok {
+					continue
+				}
+				switch strings.ToLower(key) {
+				case "vendor", "manufacturer", "model", "md", "product", "fw", "firmware", "version":
+					parts = append(parts, value)
+				}
+			}
+		}
+	}
+
+	if len(parts) == 0 {
+		return Device{}, false
+	}
+	return Device{Source: SourceMDNS, Banner: strings.Join(parts, " ")}, true
+}
+
+// unescapeLabel removes DNS presentation-format escapes from a label
+func unescapeLabel(label string) string {
+	return strings.ReplaceAll(label, `\ `, " ")
+}
+
+// merge combines sightings of the same IP address, preferring the banner
+// that identifies a phone
+func merge(devices []Device) []Device {
+	byIP := make(map[string]*Device)
+	var order []string
+	for i := range devices {
+		d := devices[i]
+		existing, ok := byIP[d.IPAddress]
+		if !ok {
+			byIP[d.IPAddress] = &d
+			order = append(order, d.IPAddress)
+			continue
+		}
+		if Identify(existing.Banner).Vendor == "" && Identify(d.Banner).Vendor != "" {
+			existing.Banner = d.Banner
+			existing.Source = d.Source
+		}
+	}
+
+	merged := make([]Device, 0, len(order))
+	for _, ip := range order {
+		merged = append(merged, *byIP[ip])
+	}
+	return merged
+}
+
+// identifyPhones fills in vendor details and drops responders that are not IP phones
+func identifyPhones(devices []Device, macs map[string]string) []Device {
+	var phones []Device
+	for _, d := range devices {
+		d.MACAddress = macs[d.IPAddress]
+
+		id := Identify(d.Banner)
+		d.Vendor, d.Model, d.Firmware = id.Vendor, id.Model, id.Firmware
+		if d.Vendor == "" {
+			d.Vendor = VendorForMAC(d.MACAddress)
+		}
+		if d.Vendor == "" {
+			continue
+		}
+		phones = append(phones, d)
+	}
+
+	sort.Slice(phones, func(i, j int) bool { return phones[i].IPAddress < phones[j].IPAddress })
+	return phones
+}
+
+// readARPTable maps IP addresses to MAC addresses from a Linux ARP table.
+// A missing table yields an empty map, leaving MAC addresses unknown.
+func readARPTable(path string) map[string]string {
+	macs := make(map[string]string)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return macs
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		if mac := NormalizeMAC(fields[3]); mac != "" && mac != "00:00:00:00:00:00" {
+			macs[fields[0]] = mac
+		}
+	}
+	return macs
+}
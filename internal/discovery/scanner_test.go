@@ -0,0 +1,117 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseSSDPResponse(t *testing.T) {
+	resp := "HTTP/1.1 200 OK\r\n" +
+		"CACHE-CONTROL: max-age=1800\r\n" +
+		"LOCATION: http://192.168.1.50:80/description.xml\r\n" +
+		"SERVER: Linux/2.6 UPnP/1.0 Grandstream GXP2170/1.0.9.135\r\n" +
+		"ST: upnp:rootdevice\r\n" +
+		"USN: uuid:12345678-1234-1234-1234-000b82123456::upnp:rootdevice\r\n\r\n"
+
+	device, location, ok := parseSSDPResponse([]byte(resp))
+	if !ok {
+		t.Fatal("Expected response to parse")
+	}
+	if device.Source != SourceSSDP {
+		t.Errorf("Expected source ssdp, got %s", device.Source)
+	}
+	if device.Banner != "Linux/2.6 UPnP/1.0 Grandstream GXP2170/1.0.9.135" {
+		t.Errorf("Unexpected banner: %s", device.Banner)
+	}
+	if location != "http://192.168.1.50:80/description.xml" {
+		t.Errorf("Unexpected location: %s", location)
+	}
+
+	if _, _, ok := parseSSDPResponse([]byte("garbage")); ok {
+		t.Error("Expected malformed response to be rejected")
+	}
+}
+
+func TestParseMDNSResponse(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{
+		&dns.PTR{
+			Hdr: dns.RR_Header{Name: "_http._tcp.local.", Rrtype: dns.TypePTR, Class: dns.ClassINET},
+			Ptr: `Yealink\ T54W._http._tcp.local.`,
+		},
+	}
+	msg.Extra = []dns.RR{
+		&dns.TXT{
+			Hdr: dns.RR_Header{Name: `Yealink\ T54W._http._tcp.local.`, Rrtype: dns.TypeTXT, Class: dns.ClassINET},
+			Txt: []string{"fw=96.86.0.70", "path=/"},
+		},
+	}
+
+	device, ok := parseMDNSResponse(msg)
+	if !ok {
+		t.Fatal("Expected response to parse")
+	}
+	if device.Banner != "Yealink T54W 96.86.0.70" {
+		t.Errorf("Unexpected banner: %s", device.Banner)
+	}
+	if id := Identify(device.Banner); id.Vendor != "yealink" || id.Model != "T54W" || id.Firmware != "96.86.0.70" {
+		t.Errorf("Unexpected identity: %+v", id)
+	}
+
+	if _, ok := parseMDNSResponse(new(dns.Msg)); ok {
+		t.Error("Expected empty response to be rejected")
+	}
+}
+
+func TestIdentifyPhones(t *testing.T) {
+	devices := merge([]Device{
+		{IPAddress: "192.168.1.20", Source: SourceSSDP, Banner: "Linux/3.10 UPnP/1.0 MiniDLNA/1.3.0"},
+		{IPAddress: "192.168.1.50", Source: SourceSSDP, Banner: "Linux/2.6 UPnP/1.0"},
+		{IPAddress: "192.168.1.50", Source: SourceMDNS, Banner: "Grandstream GXP2170 1.0.9.135"},
+		{IPAddress: "192.168.1.60", Source: SourceSSDP, Banner: "Linux/2.6 UPnP/1.0"},
+	})
+	macs := map[string]string{
+		"192.168.1.50": "00:0b:82:12:34:56",
+		"192.168.1.60": "80:5e:c0:aa:bb:cc",
+	}
+
+	phones := identifyPhones(devices, macs)
+	if len(phones) != 2 {
+		t.Fatalf("Expected 2 phones, got %+v", phones)
+	}
+
+	gs := phones[0]
+	if gs.IPAddress != "192.168.1.50" || gs.Vendor != "grandstream" || gs.Model != "GXP2170" || gs.Source != SourceMDNS {
+		t.Errorf("Unexpected Grandstream result: %+v", gs)
+	}
+	if gs.MACAddress != "00:0b:82:12:34:56" {
+		t.Errorf("Expected MAC from ARP table, got %s", gs.MACAddress)
+	}
+
+	// Identified by MAC prefix alone
+	if yl := phones[1]; yl.Vendor != "yealink" || yl.Model != "" {
+		t.Errorf("Unexpected Yealink result: %+v", yl)
+	}
+}
+
+func TestReadARPTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "arp")
+	table := "IP address       HW type     Flags       HW address            Mask     Device\n" +
+		"192.168.1.50     0x1         0x2         00:0b:82:12:34:56     *        eth0\n" +
+		"192.168.1.99     0x1         0x0         00:00:00:00:00:00     *        eth0\n"
+	if err := os.WriteFile(path, []byte(table), 0644); err != nil {
+		t.Fatalf("Failed to write ARP table: %v", err)
+	}
+
+	macs := readARPTable(path)
+	if len(macs) != 1 || macs["192.168.1.50"] != "00:0b:82:12:34:56" {
+		t.Errorf("Unexpected ARP entries: %v", macs)
+	}
+
+	if macs := readARPTable(filepath.Join(t.TempDir(), "missing")); len(macs) != 0 {
+		t.Errorf("Expected missing table to yield no entries, got %v", macs)
+	}
+}
@@ -0,0 +1,248 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+)
+
+const waitTimeout = 5 * time.Second
+
+func TestRegister(t *testing.T) {
+	h := Start(t)
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	device := h.CreateDevice(t, "alice", "secret", nil)
+	alice := h.NewUA(t, "alice", "secret")
+
+	res, err := alice.Register(ctx, 3600)
+	if err != nil || res.StatusCode != sip.StatusOK {
+		t.Fatalf("Register = %v, %v; want 200 OK", res, err)
+	}
+	reg, err := h.DB.Registrations.GetByDeviceID(ctx, device.ID)
+	if err != nil {
+		t.Fatalf("Expected a registration: %v", err)
+	}
+	if want := alice.Contact(); !strings.Contains(reg.Contact, want.HostPort()) {
+		t.Errorf("Registered contact %q, want %s", reg.Contact, want.HostPort())
+	}
+
+	since := time.Now().Add(-time.Minute)
+	if telemetry, err := h.DB.DeviceTelemetry.ListSince(ctx, device.ID, since); err != nil || len(telemetry) == 0 {
+		t.Errorf("Expected registration telemetry, got %v, %v", telemetry, err)
+	}
+
+	res, err = alice.Register(ctx, 0)
+	if err != nil || res.StatusCode != sip.StatusOK {
+		t.Fatalf("Unregister = %v, %v; want 200 OK", res, err)
+	}
+	if _, err := h.DB.Registrations.GetByDeviceID(ctx, device.ID); err == nil {
+		t.Error("Expected the registration removed")
+	}
+
+	mallory := h.NewUA(t, "alice", "wrong")
+	if res, err := mallory.Register(ctx, 3600); err != nil || res.StatusCode != sip.StatusForbidden {
+		t.Errorf("Register with a wrong password = %v, %v; want 403", res, err)
+	}
+}
+
+func TestExtensionCall(t *testing.T) {
+	h := Start(t)
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	h.CreateDevice(t, "alice", "secret", nil)
+	bobDevice := h.CreateDevice(t, "bob", "secret", nil)
+	ext := "201"
+	bobDevice.Extension = &ext
+	if err := h.DB.Devices.Update(ctx, bobDevice); err != nil {
+		t.Fatalf("Failed to set extension: %v", err)
+	}
+
+	alice := h.NewUA(t, "alice", "secret")
+	bob := h.NewUA(t, "bob", "secret")
+	for _, ua := range []*UA{alice, bob} {
+		if res, err := ua.Register(ctx, 3600); err != nil || res.StatusCode != sip.StatusOK {
+			t.Fatalf("Register %s = %v, %v", ua.Username, res, err)
+		}
+	}
+
+	call, err := alice.Dial(ctx, ext)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if call.Final.StatusCode != sip.StatusOK {
+		t.Fatalf("Call statuses %v, want answered", call.Statuses())
+	}
+	select {
+	case <-bob.Invites:
+	default:
+		t.Error("Expected the INVITE relayed to Bob")
+	}
+	if err := alice.Ack(call); err != nil {
+		t.Fatalf("ACK failed: %v", err)
+	}
+	if res, err := alice.Hangup(ctx, call); err != nil || res.StatusCode != sip.StatusOK {
+		t.Errorf("Hangup = %v, %v; want 200 OK from Bob", res, err)
+	}
+
+	cdr := waitCDR(t, h, call.Request.CallID().Value())
+	if !cdr.Internal || cdr.Disposition != "answered" || cdr.ToNumber != ext || cdr.Codec != "PCMU" {
+		t.Errorf("Unexpected CDR %+v", cdr)
+	}
+
+	// A busy callee is recorded as such
+	bob.AnswerWith(sip.StatusBusyHere)
+	call, err = alice.Dial(ctx, ext)
+	if err != nil || call.Final.StatusCode != sip.StatusBusyHere {
+		t.Fatalf("Dial = %v, %v; want 486", call.Statuses(), err)
+	}
+	if cdr := waitCDR(t, h, call.Request.CallID().Value()); cdr.Disposition != "busy" {
+		t.Errorf("Disposition %q, want busy", cdr.Disposition)
+	}
+}
+
+func TestInboundCall(t *testing.T) {
+	h := Start(t)
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	device := h.CreateDevice(t, "alice", "secret", nil)
+	did := &models.DID{Number: "+15551230000", SMSEnabled: true, VoiceEnabled: true}
+	if err := h.DB.DIDs.Create(ctx, did); err != nil {
+		t.Fatalf("Failed to create DID: %v", err)
+	}
+	ring, _ := json.Marshal(map[string]interface{}{"devices": []int64{device.ID}})
+	route := &models.Route{
+		DIDID:         &did.ID,
+		Name:          "Known callers",
+		Priority:      1,
+		ConditionType: "callerid",
+		ConditionData: json.RawMessage(`{"pattern": "+1555987"}`),
+		ActionType:    "ring",
+		ActionData:    ring,
+		Enabled:       true,
+	}
+	if err := h.DB.Routes.Create(ctx, route); err != nil {
+		t.Fatalf("Failed to create route: %v", err)
+	}
+
+	incoming := func(from, callSID string) string {
+		status, body := h.Webhook(t, "/api/webhooks/voice/incoming", url.Values{
+			"From":    {from},
+			"To":      {did.Number},
+			"CallSid": {callSID},
+		})
+		if status != 200 {
+			t.Fatalf("Voice webhook returned %d: %s", status, body)
+		}
+		return body
+	}
+
+	// The matching rule rings the device; other callers reach voicemail
+	if twiml := incoming("+15559876543", "CA-known"); !strings.Contains(twiml, "<Sip>alice@") {
+		t.Errorf("Expected the device rung, got %s", twiml)
+	}
+	if twiml := incoming("+15550001111", "CA-other"); strings.Contains(twiml, "<Sip") || !strings.Contains(twiml, "<Record") {
+		t.Errorf("Expected voicemail, got %s", twiml)
+	}
+	for _, sid := range []string{"CA-known", "CA-other"} {
+		cdr, err := h.DB.CDRs.GetByCallSID(ctx, sid)
+		if err != nil || cdr.Direction != "inbound" || cdr.DIDID == nil || *cdr.DIDID != did.ID {
+			t.Errorf("CDR for %s = %+v, %v", sid, cdr, err)
+		}
+	}
+
+	// Twilio then delivers the call to GoSIP over SIP. Call routing to
+	// devices is not implemented yet, so GoSIP rings and answers busy.
+	trunk := h.NewUA(t, "twilio", "")
+	call, err := trunk.Invite(ctx, "alice")
+	if err != nil {
+		t.Fatalf("INVITE failed: %v", err)
+	}
+	if call.Final.StatusCode != sip.StatusBusyHere {
+		t.Errorf("Call statuses %v, want 486", call.Statuses())
+	}
+	if sent := fmt.Sprint(h.SentStatuses(call.Request.CallID().Value())); sent != "[100 180 486]" {
+		t.Errorf("GoSIP answered the INVITE with %s, want [100 180 486]", sent)
+	}
+	if res, err := trunk.Hangup(ctx, call); err != nil || res.StatusCode != sip.StatusOK {
+		t.Errorf("BYE = %v, %v; want 200 OK", res, err)
+	}
+}
+
+func TestMWI(t *testing.T) {
+	h := Start(t)
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	// MWI finds a voicemail box's phones through their user ID, which is
+	// the DID's, so the first user and DID share an ID
+	user := &models.User{Email: "alice@example.com", PasswordHash: "hashed", Role: "user"}
+	if err := h.DB.Users.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	did := &models.DID{Number: "+15551230000", SMSEnabled: true, VoiceEnabled: true}
+	if err := h.DB.DIDs.Create(ctx, did); err != nil {
+		t.Fatalf("Failed to create DID: %v", err)
+	}
+	h.CreateDevice(t, "alice", "secret", &user.ID)
+	alice := h.NewUA(t, "alice", "secret")
+
+	res, err := alice.Subscribe(ctx, "message-summary", 3600)
+	if err != nil || res.StatusCode != sip.StatusOK {
+		t.Fatalf("SUBSCRIBE = %v, %v; want 200 OK", res, err)
+	}
+	notify, err := alice.WaitNotify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := string(notify.Body()); !strings.Contains(body, "Messages-Waiting: no") {
+		t.Errorf("Initial NOTIFY body %q, want no messages waiting", body)
+	}
+
+	status, body := h.Webhook(t, "/api/webhooks/recording", url.Values{
+		"RecordingSid":      {"RE123"},
+		"RecordingUrl":      {"https://api.twilio.com/recordings/RE123"},
+		"RecordingDuration": {"12"},
+		"From":              {"+15559876543"},
+		"DidId":             {fmt.Sprint(did.ID)},
+	})
+	if status != 200 {
+		t.Fatalf("Recording webhook returned %d: %s", status, body)
+	}
+
+	notify, err = alice.WaitNotify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = string(notify.Body())
+	if !strings.Contains(body, "Messages-Waiting: yes") || !strings.Contains(body, "Voice-Message: 1/0") {
+		t.Errorf("NOTIFY body %q, want one new message", body)
+	}
+}
+
+// waitCDR waits for the CDR of a call, which GoSIP writes once the INVITE
+// transaction completes
+func waitCDR(t *testing.T, h *Harness, callID string) *models.CDR {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		cdr, err := h.DB.CDRs.GetByCallSID(context.Background(), callID)
+		if err == nil {
+			return cdr
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("No CDR for call %s: %v", callID, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,241 @@
+// Package e2e runs the whole of GoSIP in-process for end-to-end tests: an
+// in-memory database, the SIP server on a free port and the HTTP API, driven
+// by embedded SIP user agents and signed Twilio webhooks.
+package e2e
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/api"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/pkg/sip"
+)
+
+const (
+	// Realm is the digest realm GoSIP challenges with and the domain of the
+	// mailbox AORs it sends MWI for
+	Realm = "gosip"
+
+	// TwilioAuthToken signs the webhooks sent with Harness.Webhook
+	TwilioAuthToken = "e2e-auth-token"
+
+	// readyTimeout bounds how long Start waits for the SIP listener
+	readyTimeout = 5 * time.Second
+)
+
+// Harness is a running GoSIP server
+type Harness struct {
+	DB     *db.DB
+	SIP    *sip.Server
+	Events *events.Hub
+	API    *httptest.Server
+
+	// SIPAddr is the host:port the SIP server listens on over UDP and TCP
+	SIPAddr string
+}
+
+// Start runs GoSIP with a fresh in-memory database, the SIP server on a free
+// port and the HTTP API on a test server. Everything is stopped when the
+// test ends.
+func Start(t testing.TB) *Harness {
+	t.Helper()
+
+	database, err := db.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		database.Close()
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		database.Close()
+		t.Fatalf("Failed to find a free SIP port: %v", err)
+	}
+
+	cfg := &config.Config{
+		SIPPort:         port,
+		SIPDomain:       "127.0.0.1",
+		DataDir:         t.TempDir(),
+		TwilioAuthToken: TwilioAuthToken,
+	}
+
+	sipServer, err := sip.NewServer(sip.Config{
+		Port:      port,
+		UserAgent: config.DefaultUserAgent,
+		DataDir:   cfg.DataDir,
+	}, database)
+	if err != nil {
+		database.Close()
+		t.Fatalf("Failed to create SIP server: %v", err)
+	}
+	hub := events.NewHub(config.EventHistorySize)
+	sipServer.SetEventHub(hub)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := sipServer.Start(ctx); err != nil {
+		cancel()
+		database.Close()
+		t.Fatalf("Failed to start SIP server: %v", err)
+	}
+
+	apiServer := httptest.NewServer(api.NewRouter(&api.Dependencies{
+		Config: cfg,
+		DB:     database,
+		SIP:    sipServer,
+		Events: hub,
+	}))
+
+	h := &Harness{
+		DB:      database,
+		SIP:     sipServer,
+		Events:  hub,
+		API:     apiServer,
+		SIPAddr: fmt.Sprintf("127.0.0.1:%d", port),
+	}
+	t.Cleanup(func() {
+		apiServer.Close()
+		sipServer.Stop()
+		cancel()
+		database.Close()
+	})
+
+	h.waitReady(t)
+	return h
+}
+
+// waitReady pings the SIP server until its UDP listener answers
+func (h *Harness) waitReady(t testing.TB) {
+	t.Helper()
+
+	probe := h.NewUA(t, "probe", "")
+	deadline := time.Now().Add(readyTimeout)
+	for time.Now().Before(deadline) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		res, err := probe.Options(ctx)
+		cancel()
+		if err == nil && res.StatusCode == 200 {
+			return
+		}
+	}
+	t.Fatalf("SIP server did not start listening on %s", h.SIPAddr)
+}
+
+// CreateDevice adds a phone with SIP credentials. userID, when set, owns
+// the device.
+func (h *Harness) CreateDevice(t testing.TB, username, password string, userID *int64) *models.Device {
+	t.Helper()
+
+	device := &models.Device{
+		UserID:       userID,
+		Name:         username,
+		Username:     username,
+		PasswordHash: sip.GenerateHA1(username, Realm, password),
+		DeviceType:   "softphone",
+	}
+	if err := h.DB.Devices.Create(context.Background(), device); err != nil {
+		t.Fatalf("Failed to create device %s: %v", username, err)
+	}
+	return device
+}
+
+// SentStatuses returns the status codes GoSIP answered a call's INVITE
+// with, from its SIP trace. The phone may see fewer: a provisional response
+// closely followed by the final one can be skipped by its transaction.
+func (h *Harness) SentStatuses(callID string) []int {
+	diag, ok := h.SIP.CallDiagnostics(callID)
+	if !ok {
+		return nil
+	}
+	var codes []int
+	for _, msg := range diag.Messages {
+		if msg.Direction == sip.TraceOut && msg.Method == "INVITE" && msg.Status > 0 {
+			codes = append(codes, msg.Status)
+		}
+	}
+	return codes
+}
+
+// Webhook posts a Twilio webhook to the API, signed with TwilioAuthToken,
+// and returns the status and body of the response
+func (h *Harness) Webhook(t testing.TB, path string, form url.Values) (int, string) {
+	t.Helper()
+
+	target := h.API.URL + path
+	req, err := http.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatalf("Failed to build webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Twilio-Signature", twilioSignature(target, form))
+
+	res, err := h.API.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Webhook %s failed: %v", path, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Failed to read webhook response: %v", err)
+	}
+	return res.StatusCode, string(body)
+}
+
+// twilioSignature signs a webhook the way Twilio does: HMAC-SHA1 of the URL
+// followed by the sorted form fields
+func twilioSignature(target string, form url.Values) string {
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	data := target
+	for _, k := range keys {
+		data += k + form.Get(k)
+	}
+
+	mac := hmac.New(sha1.New, []byte(TwilioAuthToken))
+	mac.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// freePort finds a port that is free for both UDP and TCP, as the SIP
+// server listens on both
+func freePort() (int, error) {
+	for i := 0; i < 10; i++ {
+		udp, err := net.ListenPacket("udp", "0.0.0.0:0")
+		if err != nil {
+			return 0, err
+		}
+		port := udp.LocalAddr().(*net.UDPAddr).Port
+
+		tcp, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", port))
+		udp.Close()
+		if err != nil {
+			continue
+		}
+		tcp.Close()
+		return port, nil
+	}
+	return 0, fmt.Errorf("no port free for both UDP and TCP")
+}
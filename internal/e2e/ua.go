@@ -0,0 +1,387 @@
+package e2e
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo"
+	"github.com/emiago/sipgo/sip"
+)
+
+// UA is a SIP phone embedded in the test. It sends requests to the
+// harness's SIP server from its own UDP port, which is also its contact
+// address, and answers the requests GoSIP sends it.
+type UA struct {
+	Username string
+	password string
+
+	h      *Harness
+	ua     *sipgo.UserAgent
+	client *sipgo.Client
+	server *sipgo.Server
+	addr   *net.UDPAddr
+
+	// Notifies receives the NOTIFY requests sent to the phone
+	Notifies chan *sip.Request
+
+	// Invites receives the INVITEs GoSIP relays to the phone
+	Invites chan *sip.Request
+
+	mu     sync.Mutex
+	answer sip.StatusCode
+}
+
+// Call is an INVITE sent by a UA and the responses it got
+type Call struct {
+	Request     *sip.Request
+	Provisional []*sip.Response
+	Final       *sip.Response
+}
+
+// Statuses returns the status codes of every response to the INVITE, the
+// final one last
+func (c *Call) Statuses() []int {
+	var codes []int
+	for _, res := range c.Provisional {
+		codes = append(codes, int(res.StatusCode))
+	}
+	if c.Final != nil {
+		codes = append(codes, int(c.Final.StatusCode))
+	}
+	return codes
+}
+
+// NewUA creates a phone that registers as username with password. It
+// answers INVITEs with 200 OK until told otherwise with AnswerWith.
+func (h *Harness) NewUA(t testing.TB, username, password string) *UA {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen for UA %s: %v", username, err)
+	}
+	addr := conn.LocalAddr().(*net.UDPAddr)
+
+	ua, err := sipgo.NewUA(sipgo.WithUserAgent("GoSIP-E2E/"+username), sipgo.WithUserAgentHostname("127.0.0.1"))
+	if err != nil {
+		conn.Close()
+		t.Fatalf("Failed to create UA %s: %v", username, err)
+	}
+	server, err := sipgo.NewServer(ua)
+	if err != nil {
+		conn.Close()
+		t.Fatalf("Failed to create UA server %s: %v", username, err)
+	}
+	// Sending from the listening port makes it the phone's address
+	client, err := sipgo.NewClient(ua, sipgo.WithClientHostname("127.0.0.1"), sipgo.WithClientPort(addr.Port))
+	if err != nil {
+		conn.Close()
+		t.Fatalf("Failed to create UA client %s: %v", username, err)
+	}
+
+	u := &UA{
+		Username: username,
+		password: password,
+		h:        h,
+		ua:       ua,
+		client:   client,
+		server:   server,
+		addr:     addr,
+		Notifies: make(chan *sip.Request, 16),
+		Invites:  make(chan *sip.Request, 16),
+		answer:   sip.StatusOK,
+	}
+	server.OnNotify(u.handleNotify)
+	server.OnInvite(u.handleInvite)
+	server.OnAck(func(req *sip.Request, tx sip.ServerTransaction) {})
+	server.OnBye(func(req *sip.Request, tx sip.ServerTransaction) {
+		tx.Respond(sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil))
+	})
+	server.OnOptions(func(req *sip.Request, tx sip.ServerTransaction) {
+		tx.Respond(sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil))
+	})
+
+	go server.ServeUDP(conn)
+	t.Cleanup(func() {
+		ua.Close()
+		conn.Close()
+	})
+
+	// Requests only go out from the listening port once it is serving
+	deadline := time.Now().Add(readyTimeout)
+	for {
+		if c, _ := ua.TransportLayer().GetConnection("udp", addr.String()); c != nil {
+			return u
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("UA %s did not start listening", username)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// AnswerWith sets the final status the phone answers INVITEs with
+func (u *UA) AnswerWith(status sip.StatusCode) {
+	u.mu.Lock()
+	u.answer = status
+	u.mu.Unlock()
+}
+
+// Contact is the phone's contact URI
+func (u *UA) Contact() sip.Uri {
+	return sip.Uri{User: u.Username, Host: u.addr.IP.String(), Port: u.addr.Port}
+}
+
+// AOR is the phone's mailbox address, which MWI is sent for
+func (u *UA) AOR() sip.Uri {
+	return sip.Uri{User: u.Username, Host: Realm}
+}
+
+// Register registers the phone's contact for expires seconds, answering
+// GoSIP's digest challenge. Expires 0 unregisters.
+func (u *UA) Register(ctx context.Context, expires int) (*sip.Response, error) {
+	req := u.newRequest(sip.REGISTER, u.serverURI(""), u.AOR())
+	req.AppendHeader(sip.NewHeader("Expires", strconv.Itoa(expires)))
+
+	res, err := u.do(ctx, req, nil)
+	if err != nil || res.StatusCode != sip.StatusUnauthorized {
+		return res, err
+	}
+
+	tx, err := u.client.DoDigestAuth(ctx, req, res, sipgo.DigestAuth{Username: u.Username, Password: u.password})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Terminate()
+	return finalResponse(ctx, tx, nil)
+}
+
+// Options pings the SIP server
+func (u *UA) Options(ctx context.Context) (*sip.Response, error) {
+	return u.do(ctx, u.newRequest(sip.OPTIONS, u.serverURI(""), u.AOR()), nil)
+}
+
+// Invite calls number the way the Twilio trunk does: an INVITE with an SDP
+// offer and no credentials
+func (u *UA) Invite(ctx context.Context, number string) (*Call, error) {
+	req := u.newRequest(sip.INVITE, u.serverURI(number), sip.Uri{User: number, Host: Realm})
+	return u.invite(ctx, req)
+}
+
+// Dial calls number as a registered device. GoSIP doesn't challenge
+// INVITEs, so the phone authenticates with a nonce from a REGISTER
+// challenge up front.
+func (u *UA) Dial(ctx context.Context, number string) (*Call, error) {
+	req := u.newRequest(sip.INVITE, u.serverURI(number), sip.Uri{User: number, Host: Realm})
+
+	nonce, err := u.nonce(ctx)
+	if err != nil {
+		return nil, err
+	}
+	uri := req.Recipient.String()
+	ha1 := md5Hex(u.Username + ":" + Realm + ":" + u.password)
+	response := md5Hex(ha1 + ":" + nonce + ":" + md5Hex("INVITE:"+uri))
+	req.AppendHeader(sip.NewHeader("Authorization", fmt.Sprintf(
+		`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s", algorithm=MD5`,
+		u.Username, Realm, nonce, uri, response)))
+
+	return u.invite(ctx, req)
+}
+
+// Ack confirms an answered call, sending the ACK to the party that answered
+func (u *UA) Ack(call *Call) error {
+	ack := sip.NewAckRequest(call.Request, call.Final, nil)
+	ack.SetDestination(ack.Recipient.HostPort())
+	return u.client.WriteRequest(ack)
+}
+
+// Hangup sends BYE for a call: to the party that answered, as GoSIP doesn't
+// stay in the path of calls it relays, or to GoSIP for calls it never
+// handed on
+func (u *UA) Hangup(ctx context.Context, call *Call) (*sip.Response, error) {
+	target := call.Request.Recipient
+	if call.Final != nil {
+		if contact := call.Final.Contact(); contact != nil && call.Final.IsSuccess() {
+			target = contact.Address
+		}
+	}
+
+	bye := sip.NewRequest(sip.BYE, *target.Clone())
+	sip.CopyHeaders("From", call.Request, bye)
+	if call.Final != nil {
+		sip.CopyHeaders("To", call.Final, bye)
+	} else {
+		sip.CopyHeaders("To", call.Request, bye)
+	}
+	sip.CopyHeaders("Call-ID", call.Request, bye)
+	bye.AppendHeader(&sip.CSeqHeader{SeqNo: call.Request.CSeq().SeqNo + 1, MethodName: sip.BYE})
+	bye.SetDestination(target.HostPort())
+
+	return u.do(ctx, bye, nil)
+}
+
+// Subscribe subscribes the phone to an event package for its own AOR
+func (u *UA) Subscribe(ctx context.Context, event string, expires int) (*sip.Response, error) {
+	req := u.newRequest(sip.SUBSCRIBE, u.serverURI(u.Username), u.AOR())
+	req.AppendHeader(sip.NewHeader("Event", event))
+	req.AppendHeader(sip.NewHeader("Expires", strconv.Itoa(expires)))
+	return u.do(ctx, req, nil)
+}
+
+// WaitNotify returns the next NOTIFY the phone receives
+func (u *UA) WaitNotify(ctx context.Context) (*sip.Request, error) {
+	select {
+	case req := <-u.Notifies:
+		return req, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("no NOTIFY received: %w", ctx.Err())
+	}
+}
+
+func (u *UA) invite(ctx context.Context, req *sip.Request) (*Call, error) {
+	req.AppendHeader(sip.NewHeader("Content-Type", "application/sdp"))
+	req.SetBody(sdpOffer(u.Username))
+
+	call := &Call{Request: req}
+	res, err := u.do(ctx, req, func(res *sip.Response) {
+		call.Provisional = append(call.Provisional, res)
+	})
+	if err != nil {
+		return call, err
+	}
+	call.Final = res
+	return call, nil
+}
+
+// nonce asks GoSIP for a digest challenge with an unauthenticated REGISTER
+func (u *UA) nonce(ctx context.Context) (string, error) {
+	res, err := u.do(ctx, u.newRequest(sip.REGISTER, u.serverURI(""), u.AOR()), nil)
+	if err != nil {
+		return "", err
+	}
+	challenge := res.GetHeader("WWW-Authenticate")
+	if challenge == nil {
+		return "", fmt.Errorf("REGISTER was not challenged: %d %s", res.StatusCode, res.Reason)
+	}
+	for _, part := range strings.Split(strings.TrimPrefix(challenge.Value(), "Digest "), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok && key == "nonce" {
+			return strings.Trim(value, `"`), nil
+		}
+	}
+	return "", fmt.Errorf("challenge has no nonce: %s", challenge.Value())
+}
+
+// do sends a request and waits for its final response, passing any
+// provisional responses to onProvisional
+func (u *UA) do(ctx context.Context, req *sip.Request, onProvisional func(*sip.Response)) (*sip.Response, error) {
+	tx, err := u.client.TransactionRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Terminate()
+	return finalResponse(ctx, tx, onProvisional)
+}
+
+func finalResponse(ctx context.Context, tx sip.ClientTransaction, onProvisional func(*sip.Response)) (*sip.Response, error) {
+	for {
+		select {
+		case res := <-tx.Responses():
+			if res.IsProvisional() {
+				if onProvisional != nil {
+					onProvisional(res)
+				}
+				continue
+			}
+			return res, nil
+		case <-tx.Done():
+			return nil, fmt.Errorf("transaction ended without a final response: %v", tx.Err())
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// newRequest builds a request from the phone with its contact
+func (u *UA) newRequest(method sip.RequestMethod, recipient, to sip.Uri) *sip.Request {
+	req := sip.NewRequest(method, recipient)
+
+	fromParams := sip.NewParams()
+	fromParams.Add("tag", sip.GenerateTagN(16))
+	req.AppendHeader(&sip.FromHeader{Address: u.AOR(), Params: fromParams})
+	req.AppendHeader(&sip.ToHeader{Address: to, Params: sip.NewParams()})
+	req.AppendHeader(&sip.ContactHeader{Address: u.Contact()})
+	req.SetTransport("UDP")
+	return req
+}
+
+// serverURI addresses user at the harness's SIP server
+func (u *UA) serverURI(user string) sip.Uri {
+	host, port, _ := net.SplitHostPort(u.h.SIPAddr)
+	p, _ := strconv.Atoi(port)
+	return sip.Uri{User: user, Host: host, Port: p}
+}
+
+func (u *UA) handleNotify(req *sip.Request, tx sip.ServerTransaction) {
+	tx.Respond(sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil))
+	select {
+	case u.Notifies <- req:
+	default:
+	}
+}
+
+// handleInvite rings and answers a relayed call with the status set by
+// AnswerWith, with an SDP answer when accepting it
+func (u *UA) handleInvite(req *sip.Request, tx sip.ServerTransaction) {
+	select {
+	case u.Invites <- req:
+	default:
+	}
+
+	tx.Respond(sip.NewResponseFromRequest(req, sip.StatusRinging, "Ringing", nil))
+
+	u.mu.Lock()
+	status := u.answer
+	u.mu.Unlock()
+
+	var res *sip.Response
+	if status == sip.StatusOK {
+		res = sip.NewSDPResponseFromRequest(req, sdpOffer(u.Username))
+	} else {
+		res = sip.NewResponseFromRequest(req, status, "", nil)
+	}
+	res.AppendHeader(&sip.ContactHeader{Address: u.Contact()})
+	if to := res.To(); to != nil {
+		if _, ok := to.Params.Get("tag"); !ok {
+			to.Params.Add("tag", sip.GenerateTagN(16))
+		}
+	}
+	tx.Respond(res)
+}
+
+// sdpOffer is an audio offer for PCMU and PCMA. No media is sent.
+func sdpOffer(user string) []byte {
+	return []byte("v=0\r\n" +
+		"o=" + user + " 1 1 IN IP4 127.0.0.1\r\n" +
+		"s=GoSIP E2E\r\n" +
+		"c=IN IP4 127.0.0.1\r\n" +
+		"t=0 0\r\n" +
+		"m=audio 40000 RTP/AVP 0 8 101\r\n" +
+		"a=rtpmap:0 PCMU/8000\r\n" +
+		"a=rtpmap:8 PCMA/8000\r\n" +
+		"a=rtpmap:101 telephone-event/8000\r\n" +
+		"a=sendrecv\r\n")
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,141 @@
+// Package events provides the in-process event stream consumed by API clients
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published by GoSIP
+const (
+	TypeAnnouncements      = "announcements.changed"
+	TypeCallAnnouncement   = "call.announcement"
+	TypeCallAnswered       = "call.answered"
+	TypeCallConference     = "call.conference"
+	TypeCallDTMF           = "call.dtmf"
+	TypeCallDurationLimit  = "call.duration_limit"
+	TypeCallEscalation     = "call.escalation"
+	TypeCallHeld           = "call.held"
+	TypeCallHoldTimeout    = "call.hold_timeout"
+	TypeCallLimit          = "call.limit_reached"
+	TypeCallRecording      = "call.recording"
+	TypeCallResumed        = "call.resumed"
+	TypeCallStarted        = "call.started"
+	TypeCallStatus         = "call.status"
+	TypeCallTerminated     = "call.terminated"
+	TypeCallTransferRecall = "call.transfer_recall"
+	TypeCallZRTPSecured    = "call.zrtp_secured"
+	TypeDeviceDiscovered   = "device.discovered"
+	TypeDeviceReprovision  = "device.reprovision"
+	TypeMessageRead        = "message.read"
+	TypeMessageReceived    = "message.received"
+	TypeMessageStatus      = "message.status"
+	TypeRegistrationDown   = "registration.down"
+	TypeRegistrationUp     = "registration.up"
+	TypeReminderAnswered   = "reminder.answered"
+	TypeVoicemailAssigned  = "voicemail.assigned"
+	TypeVoicemailReceived  = "voicemail.received"
+	TypeWANIPChanged       = "system.wan_ip_changed"
+)
+
+// subscriberBuffer is the number of undelivered events a subscriber may hold
+// before it is disconnected
+const subscriberBuffer = 64
+
+// Event is a single entry in the event stream
+type Event struct {
+	ID        int64       `json:"id"`
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// Hub fans published events out to subscribers and keeps the most recent
+// events so clients can resume from a Last-Event-ID
+type Hub struct {
+	mu          sync.Mutex
+	nextID      int64
+	history     []Event
+	capacity    int
+	subscribers map[chan Event]struct{}
+}
+
+// NewHub creates a Hub that retains up to capacity events for replay
+func NewHub(capacity int) *Hub {
+	return &Hub{
+		capacity:    capacity,
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Publish assigns the next event ID and delivers the event to all subscribers.
+// Subscribers that have fallen behind are disconnected so they can resume
+// from their last event instead of silently missing events.
+// Publishing on a nil Hub is a no-op.
+func (h *Hub) Publish(eventType string, data interface{}) Event {
+	if h == nil {
+		return Event{}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	event := Event{
+		ID:        h.nextID,
+		Type:      eventType,
+		Data:      data,
+		CreatedAt: time.Now(),
+	}
+
+	h.history = append(h.history, event)
+	if len(h.history) > h.capacity {
+		h.history = h.history[len(h.history)-h.capacity:]
+	}
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return event
+}
+
+// Subscribe registers a subscriber and returns the retained events published
+// after lastID, followed by a channel of new events. The channel is closed
+// when the subscriber falls behind. cancel must be called to unsubscribe.
+func (h *Hub) Subscribe(lastID int64) (backlog []Event, events <-chan Event, cancel func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, event := range h.history {
+		if event.ID > lastID {
+			backlog = append(backlog, event)
+		}
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	h.subscribers[ch] = struct{}{}
+
+	cancel = func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return backlog, ch, cancel
+}
+
+// LastID returns the ID of the most recently published event
+func (h *Hub) LastID() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.nextID
+}
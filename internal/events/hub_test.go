@@ -0,0 +1,98 @@
+package events
+
+import "testing"
+
+func TestHub_PublishSubscribe(t *testing.T) {
+	hub := NewHub(10)
+
+	_, ch, cancel := hub.Subscribe(0)
+	defer cancel()
+
+	published := hub.Publish(TypeMessageReceived, map[string]string{"from": "+15551234567"})
+	if published.ID != 1 {
+		t.Errorf("Expected first event ID 1, got %d", published.ID)
+	}
+
+	event := <-ch
+	if event.ID != published.ID || event.Type != TypeMessageReceived {
+		t.Errorf("Expected event %d of type %s, got %+v", published.ID, TypeMessageReceived, event)
+	}
+}
+
+func TestHub_SubscribeReplaysAfterLastID(t *testing.T) {
+	hub := NewHub(10)
+	for i := 0; i < 5; i++ {
+		hub.Publish(TypeCallStatus, nil)
+	}
+
+	backlog, _, cancel := hub.Subscribe(3)
+	defer cancel()
+
+	if len(backlog) != 2 {
+		t.Fatalf("Expected 2 replayed events, got %d", len(backlog))
+	}
+	if backlog[0].ID != 4 || backlog[1].ID != 5 {
+		t.Errorf("Expected events 4 and 5, got %d and %d", backlog[0].ID, backlog[1].ID)
+	}
+}
+
+func TestHub_HistoryCapacity(t *testing.T) {
+	hub := NewHub(3)
+	for i := 0; i < 5; i++ {
+		hub.Publish(TypeCallStatus, nil)
+	}
+
+	backlog, _, cancel := hub.Subscribe(0)
+	defer cancel()
+
+	if len(backlog) != 3 {
+		t.Fatalf("Expected 3 retained events, got %d", len(backlog))
+	}
+	if backlog[0].ID != 3 {
+		t.Errorf("Expected oldest retained event 3, got %d", backlog[0].ID)
+	}
+	if hub.LastID() != 5 {
+		t.Errorf("Expected last ID 5, got %d", hub.LastID())
+	}
+}
+
+func TestHub_SlowSubscriberDisconnected(t *testing.T) {
+	hub := NewHub(10)
+
+	_, ch, cancel := hub.Subscribe(0)
+	defer cancel()
+
+	for i := 0; i < subscriberBuffer+1; i++ {
+		hub.Publish(TypeCallStatus, nil)
+	}
+
+	received := 0
+	for range ch {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("Expected %d buffered events before disconnect, got %d", subscriberBuffer, received)
+	}
+}
+
+func TestHub_CancelClosesChannel(t *testing.T) {
+	hub := NewHub(10)
+
+	_, ch, cancel := hub.Subscribe(0)
+	cancel()
+	cancel()
+
+	if _, ok := <-ch; ok {
+		t.Error("Expected channel to be closed after cancel")
+	}
+
+	// Publishing after cancel must not panic
+	hub.Publish(TypeCallStatus, nil)
+}
+
+func TestHub_NilPublish(t *testing.T) {
+	var hub *Hub
+	if event := hub.Publish(TypeCallStatus, nil); event.ID != 0 {
+		t.Errorf("Expected zero event from nil hub, got %+v", event)
+	}
+}
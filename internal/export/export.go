@@ -0,0 +1,147 @@
+// Package export renders SMS/MMS conversations as PDF and mbox archives for record keeping
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// Conversation is a conversation between a DID and a remote number, oldest message first
+type Conversation struct {
+	DIDNumber    string
+	RemoteNumber string
+	ExportedAt   time.Time
+	Location     *time.Location // Zone for timestamps; UTC when nil
+	Messages     []*models.Message
+	// Media holds the downloaded MMS media of each message, by message ID.
+	// Media that could not be downloaded is listed by URL only.
+	Media map[int64][]Media
+}
+
+// Media is one MMS attachment
+type Media struct {
+	URL         string
+	ContentType string
+	Data        []byte // Nil when the media could not be downloaded
+}
+
+// MediaURLs returns the media URLs stored on a message
+func MediaURLs(msg *models.Message) []string {
+	var urls []string
+	if len(msg.MediaURLs) > 0 {
+		json.Unmarshal(msg.MediaURLs, &urls)
+	}
+	return urls
+}
+
+// media returns a message's attachments, falling back to its bare URLs
+func (c *Conversation) media(msg *models.Message) []Media {
+	if m, ok := c.Media[msg.ID]; ok {
+		return m
+	}
+	var media []Media
+	for _, mediaURL := range MediaURLs(msg) {
+		media = append(media, Media{URL: mediaURL})
+	}
+	return media
+}
+
+// location returns the zone timestamps are shown in
+func (c *Conversation) location() *time.Location {
+	if c.Location == nil {
+		return time.UTC
+	}
+	return c.Location
+}
+
+// timestamp formats a time for the archive
+func (c *Conversation) timestamp(t time.Time) string {
+	return t.In(c.location()).Format("2006-01-02 15:04:05 MST")
+}
+
+// Filename returns the download name for an archive with extension ext
+func (c *Conversation) Filename(ext string) string {
+	return fmt.Sprintf("conversation-%s-%s.%s",
+		strings.TrimPrefix(c.RemoteNumber, "+"), c.ExportedAt.UTC().Format("20060102T150405Z"), ext)
+}
+
+// Fetcher downloads MMS media. Twilio media URLs may require the account
+// credentials, which are only sent to Twilio hosts.
+type Fetcher struct {
+	Client     *http.Client
+	AccountSID string
+	AuthToken  string
+}
+
+// NewFetcher creates a Fetcher with the export download limits
+func NewFetcher(accountSID, authToken string) *Fetcher {
+	return &Fetcher{
+		Client:     &http.Client{Timeout: config.ExportMediaTimeout},
+		AccountSID: accountSID,
+		AuthToken:  authToken,
+	}
+}
+
+// Fetch downloads one attachment. Media that fails to download, or is
+// larger than ExportMediaMaxBytes, is returned without data.
+func (f *Fetcher) Fetch(ctx context.Context, mediaURL string) Media {
+	media := Media{URL: mediaURL}
+	data, contentType, err := f.download(ctx, mediaURL)
+	if err != nil {
+		slog.Warn("Failed to download media for export", "error", err, "url", mediaURL)
+		return media
+	}
+	media.ContentType = contentType
+	media.Data = data
+	return media
+}
+
+func (f *Fetcher) download(ctx context.Context, mediaURL string) ([]byte, string, error) {
+	u, err := url.Parse(mediaURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, "", fmt.Errorf("unsupported media URL")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, mediaURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", config.DefaultUserAgent)
+	if f.AccountSID != "" && (u.Hostname() == "twilio.com" || strings.HasSuffix(u.Hostname(), ".twilio.com")) {
+		req.SetBasicAuth(f.AccountSID, f.AuthToken)
+	}
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, config.ExportMediaMaxBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > config.ExportMediaMaxBytes {
+		return nil, "", fmt.Errorf("media larger than %d bytes", config.ExportMediaMaxBytes)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	return data, contentType, nil
+}
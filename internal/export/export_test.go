@@ -0,0 +1,194 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func testConversation(t *testing.T) *Conversation {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for x := 0; x < 40; x++ {
+		img.Set(x, 10, color.RGBA{R: 255, A: 255})
+	}
+	var pic bytes.Buffer
+	if err := png.Encode(&pic, img); err != nil {
+		t.Fatalf("Failed to encode image: %v", err)
+	}
+
+	at := time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC)
+	return &Conversation{
+		DIDNumber:    "+15551234567",
+		RemoteNumber: "+15559876543",
+		ExportedAt:   at.Add(24 * time.Hour),
+		Messages: []*models.Message{
+			{ID: 1, Direction: "inbound", FromNumber: "+15559876543", ToNumber: "+15551234567", Body: "Can you send the invoice (PDF)?\nThanks — Sam", Status: "received", CreatedAt: at},
+			{ID: 2, Direction: "outbound", FromNumber: "+15551234567", ToNumber: "+15559876543", Body: "From the office: here it is", Status: "delivered", CreatedAt: at.Add(time.Minute),
+				MediaURLs: []byte(`["https://api.twilio.com/media/1","https://api.twilio.com/media/2"]`)},
+		},
+		Media: map[int64][]Media{
+			2: {
+				{URL: "https://api.twilio.com/media/1", ContentType: "image/png", Data: pic.Bytes()},
+				{URL: "https://api.twilio.com/media/2"},
+			},
+		},
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePDF(&buf, testConversation(t)); err != nil {
+		t.Fatalf("WritePDF failed: %v", err)
+	}
+	pdf := buf.String()
+
+	if !strings.HasPrefix(pdf, "%PDF-1.4") || !strings.HasSuffix(pdf, "%%EOF\n") {
+		t.Error("Expected PDF header and trailer")
+	}
+	if !strings.Contains(pdf, "/Subtype /Image") || !strings.Contains(pdf, "/DCTDecode") {
+		t.Error("Expected MMS image to be embedded")
+	}
+	if !strings.Contains(pdf, "/Count 1") {
+		t.Error("Expected a single page")
+	}
+
+	// The xref offset points at the cross-reference table
+	idx := strings.LastIndex(pdf, "startxref\n")
+	var offset int
+	if _, err := fmt.Sscan(pdf[idx+len("startxref\n"):], &offset); err != nil {
+		t.Fatalf("Failed to read startxref: %v", err)
+	}
+	if !strings.HasPrefix(pdf[offset:], "xref\n") {
+		t.Errorf("startxref %d does not point at xref table", offset)
+	}
+}
+
+func TestWritePDF_Paginates(t *testing.T) {
+	c := testConversation(t)
+	for i := 0; i < 120; i++ {
+		c.Messages = append(c.Messages, &models.Message{ID: int64(10 + i), Direction: "inbound", FromNumber: c.RemoteNumber, ToNumber: c.DIDNumber, Body: strings.Repeat("word ", 40), CreatedAt: c.ExportedAt})
+	}
+
+	var buf bytes.Buffer
+	if err := WritePDF(&buf, c); err != nil {
+		t.Fatalf("WritePDF failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "/Count 1 ") {
+		t.Error("Expected long conversation to span several pages")
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	lines := wrapText("The quick brown fox jumps over the lazy dog", bodyFontSize, 100)
+	if len(lines) < 2 {
+		t.Fatalf("Expected text to wrap, got %q", lines)
+	}
+	for _, line := range lines {
+		if textWidth(line, bodyFontSize) > 100 {
+			t.Errorf("Line %q is wider than 100pt", line)
+		}
+	}
+
+	long := wrapText(strings.Repeat("x", 200), bodyFontSize, 100)
+	if len(long) < 2 || strings.Join(long, "") != strings.Repeat("x", 200) {
+		t.Errorf("Expected long word to be split, got %q", long)
+	}
+
+	if got := wrapText("", bodyFontSize, 100); len(got) != 1 || got[0] != "" {
+		t.Errorf("Expected blank paragraph to be kept, got %q", got)
+	}
+}
+
+func TestPDFString(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"plain", "(plain)"},
+		{`a (b) \c`, `(a \(b\) \\c)`},
+		{"café — ok", `(caf\351 \227 ok)`},
+		{"hi 😀", "(hi ?)"},
+	}
+	for _, tt := range tests {
+		if got := pdfString(tt.in); got != tt.want {
+			t.Errorf("pdfString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWriteMbox(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMbox(&buf, testConversation(t)); err != nil {
+		t.Fatalf("WriteMbox failed: %v", err)
+	}
+	mbox := buf.String()
+
+	if n := strings.Count(mbox, "\nFrom ") + 1; !strings.HasPrefix(mbox, "From ") || n != 2 {
+		t.Errorf("Expected 2 mbox entries, got %d", n)
+	}
+	if !strings.Contains(mbox, "From 15559876543@sms.invalid Sat Mar 14 09:30:00 2026\n") {
+		t.Error("Expected mbox separator with sender and date")
+	}
+	if !strings.Contains(mbox, "\n>From the office") {
+		t.Error("Expected body line starting with From to be quoted")
+	}
+	if !strings.Contains(mbox, "multipart/mixed") || !strings.Contains(mbox, `filename="message-2-1.png"`) {
+		t.Error("Expected MMS image as attachment")
+	}
+	if !strings.Contains(mbox, "[Attachment] https://api.twilio.com/media/2") {
+		t.Error("Expected undownloaded media to be listed by URL")
+	}
+	if !strings.Contains(mbox, "Date: Sat, 14 Mar 2026 09:30:00 +0000") {
+		t.Error("Expected Date header")
+	}
+}
+
+func TestFetcher_Fetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); ok {
+			t.Error("Credentials must only be sent to Twilio")
+		}
+		switch r.URL.Path {
+		case "/pic":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write([]byte("jpeg data"))
+		case "/big":
+			w.Write(make([]byte, 5<<20+1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	f := NewFetcher("AC123", "secret")
+	ctx := context.Background()
+
+	m := f.Fetch(ctx, srv.URL+"/pic")
+	if m.ContentType != "image/jpeg" || string(m.Data) != "jpeg data" {
+		t.Errorf("Unexpected media: %s %q", m.ContentType, m.Data)
+	}
+	for _, path := range []string{"/big", "/missing"} {
+		if m := f.Fetch(ctx, srv.URL+path); m.Data != nil {
+			t.Errorf("Expected %s to be listed without data", path)
+		}
+	}
+	if m := f.Fetch(ctx, "file:///etc/passwd"); m.Data != nil {
+		t.Error("Expected non-HTTP URL to be refused")
+	}
+}
+
+func TestConversation_Filename(t *testing.T) {
+	c := testConversation(t)
+	if got := c.Filename("pdf"); got != "conversation-15559876543-20260315T093000Z.pdf" {
+		t.Errorf("Unexpected filename %s", got)
+	}
+}
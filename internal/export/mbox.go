@@ -0,0 +1,172 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// smsDomain is the address domain given to phone numbers; .invalid is reserved so it never routes
+const smsDomain = "sms.invalid"
+
+// mboxFromLine matches body lines mboxrd quotes so readers don't split messages on them
+var mboxFromLine = regexp.MustCompile(`^>*From `)
+
+// WriteMbox renders the conversation as an mboxrd archive with one RFC 5322
+// message per text, so it can be imported into any mail client. MMS media
+// are attached; media that could not be downloaded are listed by URL.
+func WriteMbox(w io.Writer, c *Conversation) error {
+	bw := bufio.NewWriter(w)
+	for _, msg := range c.Messages {
+		eml, err := buildEML(c, msg)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(bw, "From %s %s\n", smsAddress(msg.FromNumber), msg.CreatedAt.UTC().Format(time.ANSIC))
+		for _, line := range strings.Split(strings.TrimRight(strings.ReplaceAll(string(eml), "\r\n", "\n"), "\n"), "\n") {
+			if mboxFromLine.MatchString(line) {
+				bw.WriteByte('>')
+			}
+			bw.WriteString(line)
+			bw.WriteByte('\n')
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// smsAddress turns a phone number into an email address
+func smsAddress(number string) string {
+	return strings.TrimPrefix(number, "+") + "@" + smsDomain
+}
+
+// buildEML encodes one text as an email message
+func buildEML(c *Conversation, msg *models.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+
+	subject := "Text from " + msg.FromNumber
+	if msg.Direction == "outbound" {
+		subject = "Text to " + msg.ToNumber
+	}
+	header("From", fmt.Sprintf("%q <%s>", msg.FromNumber, smsAddress(msg.FromNumber)))
+	header("To", fmt.Sprintf("%q <%s>", msg.ToNumber, smsAddress(msg.ToNumber)))
+	header("Date", msg.CreatedAt.In(c.location()).Format(time.RFC1123Z))
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Message-ID", fmt.Sprintf("<message-%d@%s>", msg.ID, smsDomain))
+	header("MIME-Version", "1.0")
+	header("X-GoSIP-Direction", msg.Direction)
+	if msg.Status != "" {
+		header("X-GoSIP-Status", msg.Status)
+	}
+	if msg.MessageSID != "" {
+		header("X-Twilio-Message-SID", msg.MessageSID)
+	}
+
+	body := msg.Body
+	media := c.media(msg)
+	var attachments []Media
+	for _, m := range media {
+		if m.Data != nil {
+			attachments = append(attachments, m)
+		} else {
+			body += "\n[Attachment] " + m.URL
+		}
+	}
+
+	if len(attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintable(part, body); err != nil {
+		return nil, err
+	}
+
+	for i, m := range attachments {
+		contentType := m.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("inline; filename=%q", mediaFilename(msg, i, contentType))},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(part, m.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mediaFilename names the i'th attachment of a message
+func mediaFilename(msg *models.Message, i int, contentType string) string {
+	ext := ".bin"
+	if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+		ext = exts[0]
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType == "image/jpeg" {
+		ext = ".jpg"
+	}
+	return fmt.Sprintf("message-%d-%d%s", msg.ID, i+1, ext)
+}
+
+// writeQuotedPrintable writes text quoted-printable with CRLF line endings
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qw := quotedprintable.NewWriter(w)
+	s = strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "\r\n")
+	if _, err := qw.Write([]byte(s)); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+// writeBase64 writes data base64-encoded in 76-character lines
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(w, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := io.WriteString(w, encoded+"\r\n")
+	return err
+}
@@ -0,0 +1,368 @@
+package export
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	_ "image/gif" // Register decoders for MMS images
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// Page layout in points, US Letter
+const (
+	pageWidth     = 612.0
+	pageHeight    = 792.0
+	pageMargin    = 54.0
+	footerHeight  = 24.0
+	bodyFontSize  = 10.0
+	lineHeight    = 13.0
+	imageMaxH     = 280.0
+	maxImagePixel = 40_000_000 // Larger images are listed rather than embedded
+)
+
+// contentWidth is the usable width between the margins
+const contentWidth = pageWidth - 2*pageMargin
+
+// WritePDF renders the conversation as a PDF transcript with MMS images inline
+func WritePDF(w io.Writer, c *Conversation) error {
+	p := newPDFWriter()
+
+	p.newPage()
+	p.text("F2", 14, 18, "Conversation with "+c.RemoteNumber)
+	p.text("F1", bodyFontSize, lineHeight, "Number: "+c.DIDNumber)
+	p.text("F1", bodyFontSize, lineHeight, "Exported: "+c.timestamp(c.ExportedAt))
+	p.text("F1", bodyFontSize, lineHeight, fmt.Sprintf("Messages: %d", len(c.Messages)))
+	p.rule()
+
+	for _, msg := range c.Messages {
+		p.ensure(2*lineHeight + 6)
+		p.y -= 6
+		p.text("F2", 9, lineHeight, messageHeading(c, msg))
+		for _, para := range strings.Split(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n") {
+			for _, line := range wrapText(para, bodyFontSize, contentWidth) {
+				p.text("F1", bodyFontSize, lineHeight, line)
+			}
+		}
+		for _, m := range c.media(msg) {
+			if m.Data != nil && p.image(m.Data) {
+				continue
+			}
+			label := "[Attachment"
+			if m.ContentType != "" {
+				label += ": " + m.ContentType
+			}
+			for _, line := range wrapText(label+"] "+m.URL, bodyFontSize, contentWidth) {
+				p.text("F1", bodyFontSize, lineHeight, line)
+			}
+		}
+	}
+
+	return p.write(w)
+}
+
+// messageHeading describes who sent a message and when
+func messageHeading(c *Conversation, msg *models.Message) string {
+	direction := "Received"
+	if msg.Direction == "outbound" {
+		direction = "Sent"
+	}
+	heading := fmt.Sprintf("%s  %s  from %s to %s", c.timestamp(msg.CreatedAt), direction, msg.FromNumber, msg.ToNumber)
+	if msg.Status != "" {
+		heading += "  (" + msg.Status + ")"
+	}
+	return heading
+}
+
+// pdfWriter lays out text and images on pages and assembles the PDF objects
+type pdfWriter struct {
+	objects [][]byte // Object n is objects[n-1]
+	pages   []int
+
+	content    bytes.Buffer
+	pageImages map[string]int
+	imageCount int
+	y          float64
+}
+
+// Fixed object numbers
+const (
+	catalogObj = 1
+	pagesObj   = 2
+	fontObj    = 3
+	boldObj    = 4
+)
+
+func newPDFWriter() *pdfWriter {
+	p := &pdfWriter{objects: make([][]byte, 4)}
+	p.objects[catalogObj-1] = []byte(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesObj))
+	p.objects[fontObj-1] = []byte("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	p.objects[boldObj-1] = []byte("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	return p
+}
+
+// add appends an object and returns its number
+func (p *pdfWriter) add(obj []byte) int {
+	p.objects = append(p.objects, obj)
+	return len(p.objects)
+}
+
+// addStream appends a Flate-compressed stream object
+func (p *pdfWriter) addStream(dict string, data []byte) int {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return p.addRawStream(dict+" /Filter /FlateDecode", buf.Bytes())
+}
+
+// addRawStream appends a stream object whose data is already encoded
+func (p *pdfWriter) addRawStream(dict string, data []byte) int {
+	var obj bytes.Buffer
+	fmt.Fprintf(&obj, "<< %s /Length %d >>\nstream\n", dict, len(data))
+	obj.Write(data)
+	obj.WriteString("\nendstream")
+	return p.add(obj.Bytes())
+}
+
+// newPage finishes the current page, if any, and starts another
+func (p *pdfWriter) newPage() {
+	if p.pageImages != nil {
+		p.finishPage()
+	}
+	p.content.Reset()
+	p.pageImages = make(map[string]int)
+	p.y = pageHeight - pageMargin
+}
+
+// ensure starts a new page unless height points fit above the footer
+func (p *pdfWriter) ensure(height float64) {
+	if p.y-height < pageMargin+footerHeight {
+		p.newPage()
+	}
+}
+
+// text writes one line of text at the left margin
+func (p *pdfWriter) text(font string, size, leading float64, s string) {
+	p.ensure(leading)
+	p.y -= leading
+	fmt.Fprintf(&p.content, "BT /%s %.1f Tf %.2f %.2f Td %s Tj ET\n", font, size, pageMargin, p.y, pdfString(s))
+}
+
+// rule draws a horizontal separator
+func (p *pdfWriter) rule() {
+	p.ensure(12)
+	p.y -= 8
+	fmt.Fprintf(&p.content, "0.6 G 0.5 w %.2f %.2f m %.2f %.2f l S 0 G\n", pageMargin, p.y, pageWidth-pageMargin, p.y)
+	p.y -= 4
+}
+
+// image embeds a picture scaled to fit the page. It returns false for
+// media that is not a supported image.
+func (p *pdfWriter) image(data []byte) bool {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width == 0 || cfg.Height == 0 || cfg.Width*cfg.Height > maxImagePixel {
+		return false
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+
+	// Re-encode as JPEG so every format embeds with DCTDecode
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 85}); err != nil {
+		return false
+	}
+	colorSpace := "/DeviceRGB"
+	if _, ok := img.(*image.Gray); ok {
+		colorSpace = "/DeviceGray"
+	}
+	bounds := img.Bounds()
+	obj := p.addRawStream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode",
+		bounds.Dx(), bounds.Dy(), colorSpace), encoded.Bytes())
+
+	// Scale to fit, never enlarging past one point per pixel
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	scale := 1.0
+	if w*scale > contentWidth {
+		scale = contentWidth / w
+	}
+	if h*scale > imageMaxH {
+		scale = imageMaxH / h
+	}
+	w, h = w*scale, h*scale
+
+	p.ensure(h + 6)
+	p.imageCount++
+	name := fmt.Sprintf("Im%d", p.imageCount)
+	p.pageImages[name] = obj
+	p.y -= h + 3
+	fmt.Fprintf(&p.content, "q %.2f 0 0 %.2f %.2f %.2f cm /%s Do Q\n", w, h, pageMargin, p.y, name)
+	p.y -= 3
+	return true
+}
+
+// finishPage writes the page footer, content stream and page object
+func (p *pdfWriter) finishPage() {
+	footer := fmt.Sprintf("Page %d", len(p.pages)+1)
+	fmt.Fprintf(&p.content, "BT /F1 8 Tf %.2f %.2f Td %s Tj ET\n",
+		pageWidth-pageMargin-textWidth(footer, 8), pageMargin, pdfString(footer))
+
+	content := p.addStream("", p.content.Bytes())
+
+	var xobjects strings.Builder
+	for name, obj := range p.pageImages {
+		fmt.Fprintf(&xobjects, " /%s %d 0 R", name, obj)
+	}
+	page := p.add([]byte(fmt.Sprintf(
+		"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 %d 0 R /F2 %d 0 R >> /XObject <<%s >> >> /Contents %d 0 R >>",
+		pagesObj, pageWidth, pageHeight, fontObj, boldObj, xobjects.String(), content)))
+	p.pages = append(p.pages, page)
+}
+
+// write finishes the last page and writes the document with its cross-reference table
+func (p *pdfWriter) write(w io.Writer) error {
+	p.finishPage()
+
+	kids := make([]string, len(p.pages))
+	for i, page := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", page)
+	}
+	p.objects[pagesObj-1] = []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(p.objects))
+	for i, obj := range p.objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n", i+1)
+		buf.Write(obj)
+		buf.WriteString("\nendobj\n")
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(p.objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(p.objects)+1, catalogObj, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// winAnsi maps the punctuation phones commonly send outside Latin-1 to WinAnsiEncoding
+var winAnsi = map[rune]byte{
+	'€': 0x80, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+}
+
+// encodeWinAnsi converts text to the standard fonts' WinAnsiEncoding,
+// replacing characters it can't represent, such as emoji, with '?'
+func encodeWinAnsi(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		switch {
+		case r == '\t':
+			out = append(out, ' ')
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			out = append(out, byte(r))
+		default:
+			if b, ok := winAnsi[r]; ok {
+				out = append(out, b)
+			} else if r >= 0x20 {
+				out = append(out, '?')
+			}
+		}
+	}
+	return out
+}
+
+// pdfString encodes text as a PDF literal string
+func pdfString(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, c := range encodeWinAnsi(s) {
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c >= 0x80:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// helveticaWidths are the Helvetica glyph widths, in thousandths of the
+// font size, of the printable ASCII characters from space to tilde
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// textWidth returns the width in points of text set in Helvetica
+func textWidth(s string, size float64) float64 {
+	var units int
+	for _, c := range encodeWinAnsi(s) {
+		switch {
+		case c >= 0x20 && c < 0x7f:
+			units += helveticaWidths[c-0x20]
+		case c == 0x85 || c == 0x97:
+			units += 1000
+		default:
+			units += 556
+		}
+	}
+	return float64(units) * size / 1000
+}
+
+// wrapText breaks a paragraph into lines no wider than width, splitting
+// words that are too long to fit on a line of their own
+func wrapText(s string, size, width float64) []string {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return []string{""}
+	}
+
+	var lines []string
+	var line string
+	for _, word := range words {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if textWidth(candidate, size) <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		line = word
+		for textWidth(line, size) > width {
+			cut := len(line) - 1
+			for cut > 1 && (textWidth(line[:cut], size) > width || !utf8.RuneStart(line[cut])) {
+				cut--
+			}
+			lines = append(lines, line[:cut])
+			line = line[cut:]
+		}
+	}
+	return append(lines, line)
+}
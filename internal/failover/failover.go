@@ -0,0 +1,211 @@
+// Package failover configures disaster recovery on Twilio trunks, so calls
+// reach a secondary server or a cell phone while GoSIP is down, and
+// periodically verifies that Twilio still has it
+package failover
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/announcements"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/twilio"
+)
+
+// TrunkClient is the part of the Twilio client used to manage trunk failover
+type TrunkClient interface {
+	GetTrunkFailover(ctx context.Context, trunkSID string) (*twilio.TrunkFailoverSettings, error)
+	SetTrunkDisasterRecovery(ctx context.Context, trunkSID, disasterRecoveryURL string) error
+	SetSecondaryOrigination(ctx context.Context, trunkSID, sipURI string) error
+}
+
+// Request configures a trunk's failover. ForwardTo and DisasterRecoveryURL
+// are alternatives: a number is forwarded to with Twilio's hosted TwiML.
+type Request struct {
+	ForwardTo           string `json:"forward_to"`
+	DisasterRecoveryURL string `json:"disaster_recovery_url"`
+	SecondaryURI        string `json:"secondary_uri"`
+}
+
+// Manager applies and verifies trunk failover settings
+type Manager struct {
+	database *db.DB
+	hub      *events.Hub
+	trunks   TrunkClient
+
+	// mu serializes changes so a verification never sees half a change
+	mu sync.Mutex
+}
+
+// NewManager creates a Manager
+func NewManager(database *db.DB, hub *events.Hub, trunks TrunkClient) *Manager {
+	return &Manager{
+		database: database,
+		hub:      hub,
+		trunks:   trunks,
+	}
+}
+
+// Start verifies every configured trunk now and then every
+// TrunkFailoverCheckInterval
+func (m *Manager) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(config.TrunkFailoverCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			m.VerifyAll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Configure sets a trunk's secondary origination URL and disaster recovery
+// URL in one step, stores them and verifies Twilio has them
+func (m *Manager) Configure(ctx context.Context, trunkSID string, req Request) (*models.TrunkFailover, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f := &models.TrunkFailover{
+		TrunkSID:            trunkSID,
+		DisasterRecoveryURL: req.DisasterRecoveryURL,
+		SecondaryURI:        req.SecondaryURI,
+	}
+	if req.ForwardTo != "" {
+		forwardTo := req.ForwardTo
+		f.ForwardTo = &forwardTo
+		f.DisasterRecoveryURL = twilio.ForwardTwimletURL(forwardTo)
+	}
+
+	if err := m.trunks.SetSecondaryOrigination(ctx, trunkSID, f.SecondaryURI); err != nil {
+		return nil, err
+	}
+	if err := m.trunks.SetTrunkDisasterRecovery(ctx, trunkSID, f.DisasterRecoveryURL); err != nil {
+		return nil, err
+	}
+	if err := m.database.TrunkFailovers.Upsert(ctx, f); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Trunk failover configured", "trunk_sid", trunkSID, "secondary_uri", f.SecondaryURI, "disaster_recovery_url", f.DisasterRecoveryURL)
+	return m.verify(ctx, trunkSID)
+}
+
+// Remove clears a trunk's disaster recovery URL and secondary origination
+// URL and forgets its failover
+func (m *Manager) Remove(ctx context.Context, trunkSID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.database.TrunkFailovers.Get(ctx, trunkSID); err != nil {
+		return err
+	}
+	if err := m.trunks.SetSecondaryOrigination(ctx, trunkSID, ""); err != nil {
+		return err
+	}
+	if err := m.trunks.SetTrunkDisasterRecovery(ctx, trunkSID, ""); err != nil {
+		return err
+	}
+	if err := m.database.TrunkFailovers.Delete(ctx, trunkSID); err != nil {
+		return err
+	}
+	m.updateAnnouncement(ctx)
+	return nil
+}
+
+// Verify checks a trunk's failover against Twilio and records the outcome
+func (m *Manager) Verify(ctx context.Context, trunkSID string) (*models.TrunkFailover, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.verify(ctx, trunkSID)
+}
+
+// VerifyAll checks every configured trunk. Trunks Twilio can't be asked
+// about keep their last result.
+func (m *Manager) VerifyAll(ctx context.Context) {
+	failovers, err := m.database.TrunkFailovers.List(ctx)
+	if err != nil {
+		slog.Error("Failed to list trunk failovers", "error", err)
+		return
+	}
+	for _, f := range failovers {
+		if _, err := m.Verify(ctx, f.TrunkSID); err != nil {
+			slog.Warn("Failed to verify trunk failover", "error", err, "trunk_sid", f.TrunkSID)
+		}
+	}
+}
+
+// verify checks a trunk's failover with mu held
+func (m *Manager) verify(ctx context.Context, trunkSID string) (*models.TrunkFailover, error) {
+	f, err := m.database.TrunkFailovers.Get(ctx, trunkSID)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := m.trunks.GetTrunkFailover(ctx, trunkSID)
+	if err != nil {
+		return nil, err
+	}
+
+	found := Problems(f, settings)
+	if len(found) > 0 && f.Intact {
+		slog.Error("Trunk failover no longer matches Twilio", "trunk_sid", trunkSID, "problems", found)
+	}
+	if err := m.database.TrunkFailovers.RecordVerification(ctx, trunkSID, found, time.Now()); err != nil {
+		return nil, err
+	}
+	m.updateAnnouncement(ctx)
+	return m.database.TrunkFailovers.Get(ctx, trunkSID)
+}
+
+// updateAnnouncement raises or clears the broken failover announcement from
+// the stored verification results
+func (m *Manager) updateAnnouncement(ctx context.Context) {
+	failovers, err := m.database.TrunkFailovers.List(ctx)
+	if err != nil {
+		slog.Error("Failed to list trunk failovers", "error", err)
+		return
+	}
+	var broken []string
+	for _, f := range failovers {
+		if !f.Intact {
+			broken = append(broken, f.TrunkSID)
+		}
+	}
+	announcements.RecordTrunkFailover(ctx, m.database, m.hub, broken)
+}
+
+// Problems lists how Twilio's settings differ from a configured failover
+func Problems(f *models.TrunkFailover, s *twilio.TrunkFailoverSettings) []string {
+	var problems []string
+	switch {
+	case f.DisasterRecoveryURL != "" && s.DisasterRecoveryURL == "":
+		problems = append(problems, "Disaster recovery URL was removed")
+	case f.DisasterRecoveryURL != s.DisasterRecoveryURL:
+		problems = append(problems, fmt.Sprintf("Disaster recovery URL is %q, expected %q", s.DisasterRecoveryURL, f.DisasterRecoveryURL))
+	}
+
+	if f.SecondaryURI == "" {
+		return problems
+	}
+	switch {
+	case s.SecondaryURI == "":
+		problems = append(problems, "Secondary origination URL was removed")
+	case s.SecondaryURI != f.SecondaryURI:
+		problems = append(problems, fmt.Sprintf("Secondary origination URL is %q, expected %q", s.SecondaryURI, f.SecondaryURI))
+	case !s.SecondaryEnabled:
+		problems = append(problems, "Secondary origination URL is disabled")
+	case s.PrimaryPriority != 0 && s.SecondaryPriority <= s.PrimaryPriority:
+		problems = append(problems, "Secondary origination URL is tried before the primary")
+	}
+	return problems
+}
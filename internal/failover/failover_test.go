@@ -0,0 +1,123 @@
+package failover
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/announcements"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/twilio"
+)
+
+// setupTestDB creates an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	database, err := db.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Close()
+	})
+	return database
+}
+
+// fakeTrunks holds one trunk's failover settings as Twilio would
+type fakeTrunks struct {
+	settings twilio.TrunkFailoverSettings
+}
+
+func (f *fakeTrunks) GetTrunkFailover(ctx context.Context, trunkSID string) (*twilio.TrunkFailoverSettings, error) {
+	s := f.settings
+	s.TrunkSID = trunkSID
+	return &s, nil
+}
+
+func (f *fakeTrunks) SetTrunkDisasterRecovery(ctx context.Context, trunkSID, disasterRecoveryURL string) error {
+	f.settings.DisasterRecoveryURL = disasterRecoveryURL
+	return nil
+}
+
+func (f *fakeTrunks) SetSecondaryOrigination(ctx context.Context, trunkSID, sipURI string) error {
+	f.settings.SecondaryURI = sipURI
+	f.settings.SecondaryEnabled = sipURI != ""
+	f.settings.SecondaryPriority = 20
+	return nil
+}
+
+func TestManager_ConfigureAndVerify(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+	trunks := &fakeTrunks{settings: twilio.TrunkFailoverSettings{PrimaryPriority: 10}}
+	m := NewManager(database, events.NewHub(10), trunks)
+
+	f, err := m.Configure(ctx, "TK1", Request{ForwardTo: "+15551234567", SecondaryURI: "sip:backup.example.com"})
+	if err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	if !f.Intact || f.VerifiedAt == nil || f.ForwardTo == nil || *f.ForwardTo != "+15551234567" {
+		t.Fatalf("Expected an intact, verified failover, got %+v", f)
+	}
+	if trunks.settings.DisasterRecoveryURL != twilio.ForwardTwimletURL("+15551234567") {
+		t.Errorf("Expected the forwarding TwiML set, got %q", trunks.settings.DisasterRecoveryURL)
+	}
+
+	// Someone removes the disaster recovery URL in the Twilio console
+	trunks.settings.DisasterRecoveryURL = ""
+	f, err = m.Verify(ctx, "TK1")
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if f.Intact || len(f.Problems) != 1 || f.Problems[0] != "Disaster recovery URL was removed" {
+		t.Errorf("Expected the removal reported, got %+v", f)
+	}
+	if _, err := database.Announcements.GetByKey(ctx, announcements.KeyTrunkFailover); err != nil {
+		t.Errorf("Expected an announcement for the broken failover: %v", err)
+	}
+
+	if err := m.Remove(ctx, "TK1"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if trunks.settings.SecondaryURI != "" {
+		t.Error("Expected the secondary origination URL removed")
+	}
+	if _, err := database.Announcements.GetByKey(ctx, announcements.KeyTrunkFailover); err == nil {
+		t.Error("Expected the announcement cleared")
+	}
+	if err := m.Remove(ctx, "TK1"); err != db.ErrTrunkFailoverNotFound {
+		t.Errorf("Expected ErrTrunkFailoverNotFound, got %v", err)
+	}
+}
+
+func TestProblems_Secondary(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+	m := NewManager(database, events.NewHub(10), &fakeTrunks{})
+	if _, err := m.Configure(ctx, "TK1", Request{SecondaryURI: "sip:backup.example.com"}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	f, _ := database.TrunkFailovers.Get(ctx, "TK1")
+
+	tests := []struct {
+		name     string
+		settings twilio.TrunkFailoverSettings
+		want     string
+	}{
+		{"disabled", twilio.TrunkFailoverSettings{SecondaryURI: "sip:backup.example.com", SecondaryPriority: 20, PrimaryPriority: 10}, "Secondary origination URL is disabled"},
+		{"tried first", twilio.TrunkFailoverSettings{SecondaryURI: "sip:backup.example.com", SecondaryEnabled: true, SecondaryPriority: 5, PrimaryPriority: 10}, "Secondary origination URL is tried before the primary"},
+		{"removed", twilio.TrunkFailoverSettings{}, "Secondary origination URL was removed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Problems(f, &tt.settings)
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("Problems = %v, want [%s]", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Package i18n provides the voice prompt sets and API message translations for GoSIP
+package i18n
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Supported languages
+const (
+	English = "en"
+	Spanish = "es"
+	French  = "fr"
+	German  = "de"
+)
+
+// DefaultLanguage is used when no language is configured or requested
+const DefaultLanguage = English
+
+// Languages lists every language with a shipped prompt set
+var Languages = []string{English, Spanish, French, German}
+
+// voiceLocales maps a language to the locale passed to Twilio's <Say language="...">
+var voiceLocales = map[string]string{
+	English: "en-US",
+	Spanish: "es-ES",
+	French:  "fr-FR",
+	German:  "de-DE",
+}
+
+// IsSupported reports whether a language has a shipped prompt set
+func IsSupported(lang string) bool {
+	_, ok := voiceLocales[lang]
+	return ok
+}
+
+// Normalize reduces a language tag such as "es-MX" to a supported language,
+// returning an empty string when the language is not supported
+func Normalize(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if IsSupported(tag) {
+		return tag
+	}
+	return ""
+}
+
+// Resolve returns the first supported language among the candidates,
+// falling back to DefaultLanguage
+func Resolve(candidates ...string) string {
+	for _, c := range candidates {
+		if lang := Normalize(c); lang != "" {
+			return lang
+		}
+	}
+	return DefaultLanguage
+}
+
+// VoiceLocale returns the text-to-speech locale for a language
+func VoiceLocale(lang string) string {
+	if locale, ok := voiceLocales[Normalize(lang)]; ok {
+		return locale
+	}
+	return voiceLocales[DefaultLanguage]
+}
+
+// ParseAcceptLanguage returns the preferred supported language from an
+// Accept-Language header, or an empty string when none is supported
+func ParseAcceptLanguage(header string) string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+
+	var prefs []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		lang := Normalize(fields[0])
+		if lang == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			prefs = append(prefs, weighted{lang: lang, q: q})
+		}
+	}
+
+	if len(prefs) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+	return prefs[0].lang
+}
+
+// Prompt returns the voice prompt for a key in the given language,
+// falling back to English when the language or key is unknown
+func Prompt(lang, key string) string {
+	if set, ok := prompts[Normalize(lang)]; ok {
+		if text, ok := set[key]; ok {
+			return text
+		}
+	}
+	return prompts[DefaultLanguage][key]
+}
+
+// Translate returns the translation of an English API message,
+// or the message itself when no translation exists
+func Translate(lang, message string) string {
+	lang = Normalize(lang)
+	if lang == "" || lang == English {
+		return message
+	}
+	if translated, ok := messages[lang][message]; ok {
+		return translated
+	}
+	return message
+}
@@ -0,0 +1,77 @@
+package i18n
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"en", English},
+		{"es-MX", Spanish},
+		{"FR_ca", French},
+		{" de ", German},
+		{"it", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.input); got != tt.expected {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{"es-ES,es;q=0.9,en;q=0.8", Spanish},
+		{"it-IT,fr;q=0.5,de;q=0.7", German},
+		{"en;q=0, fr", French},
+		{"*", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ParseAcceptLanguage(tt.header); got != tt.expected {
+			t.Errorf("ParseAcceptLanguage(%q) = %q, want %q", tt.header, got, tt.expected)
+		}
+	}
+}
+
+func TestPrompt_AllLanguagesComplete(t *testing.T) {
+	for key := range prompts[English] {
+		for _, lang := range Languages {
+			if _, ok := prompts[lang][key]; !ok {
+				t.Errorf("Prompt %q missing for language %s", key, lang)
+			}
+		}
+	}
+
+	if got := Prompt("it", PromptGoodbye); got != "Goodbye." {
+		t.Errorf("Expected English fallback for unsupported language, got %q", got)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	if got := Translate(German, "Validation failed"); got != "Validierung fehlgeschlagen" {
+		t.Errorf("Unexpected German translation: %q", got)
+	}
+	if got := Translate(French, "No such message"); got != "No such message" {
+		t.Errorf("Expected untranslated message to pass through, got %q", got)
+	}
+	if got := Translate(English, "Validation failed"); got != "Validation failed" {
+		t.Errorf("Expected English message unchanged, got %q", got)
+	}
+}
+
+func TestVoiceLocale(t *testing.T) {
+	if got := VoiceLocale("es"); got != "es-ES" {
+		t.Errorf("VoiceLocale(es) = %q, want es-ES", got)
+	}
+	if got := VoiceLocale(""); got != "en-US" {
+		t.Errorf("VoiceLocale(\"\") = %q, want en-US", got)
+	}
+}
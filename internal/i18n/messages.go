@@ -0,0 +1,146 @@
+package i18n
+
+// messages translates API error and validation messages, keyed by the English text
+var messages = map[string]map[string]string{
+	Spanish: {
+		"Validation failed":                       "Error de validación",
+		"Invalid request body":                    "Cuerpo de la solicitud no válido",
+		"Internal server error":                   "Error interno del servidor",
+		"Authentication required":                 "Se requiere autenticación",
+		"Invalid or expired session":              "Sesión no válida o caducada",
+		"Access denied":                           "Acceso denegado",
+		"Admin access required":                   "Se requiere acceso de administrador",
+		"Invalid email or password":               "Correo electrónico o contraseña incorrectos",
+		"Email and password are required":         "El correo electrónico y la contraseña son obligatorios",
+		"Email is required":                       "El correo electrónico es obligatorio",
+		"Password is required":                    "La contraseña es obligatoria",
+		"Password must be at least 8 characters":  "La contraseña debe tener al menos 8 caracteres",
+		"Current password is incorrect":           "La contraseña actual es incorrecta",
+		"Name is required":                        "El nombre es obligatorio",
+		"Username is required":                    "El nombre de usuario es obligatorio",
+		"Phone number is required":                "El número de teléfono es obligatorio",
+		"To number is required":                   "El número de destino es obligatorio",
+		"Pattern is required":                     "El patrón es obligatorio",
+		"Audio URL is required":                   "La URL del audio es obligatoria",
+		"Invalid DID ID":                          "ID de DID no válido",
+		"Invalid user ID":                         "ID de usuario no válido",
+		"Invalid device ID":                       "ID de dispositivo no válido",
+		"Invalid route ID":                        "ID de ruta no válido",
+		"Invalid message ID":                      "ID de mensaje no válido",
+		"Invalid voicemail ID":                    "ID de buzón de voz no válido",
+		"DID not found":                           "DID no encontrado",
+		"User not found":                          "Usuario no encontrado",
+		"Device not found":                        "Dispositivo no encontrado",
+		"Route not found":                         "Ruta no encontrada",
+		"Message not found":                       "Mensaje no encontrado",
+		"Voicemail not found":                     "Mensaje de voz no encontrado",
+		"Greeting not found":                      "Saludo no encontrado",
+		"Language must be one of: en, es, fr, de": "El idioma debe ser uno de: en, es, fr, de",
+
+		// Password policy
+		"Password must be at most 72 characters":    "La contraseña debe tener como máximo 72 caracteres",
+		"Password must contain an uppercase letter": "La contraseña debe contener una letra mayúscula",
+		"Password must contain a lowercase letter":  "La contraseña debe contener una letra minúscula",
+		"Password must contain a number":            "La contraseña debe contener un número",
+		"Password must contain a symbol":            "La contraseña debe contener un símbolo",
+		"Password is too common":                    "La contraseña es demasiado común",
+		"Password has appeared in a data breach":    "La contraseña ha aparecido en una filtración de datos",
+
+		// Read-only mode
+		"The server is in read-only mode. Changes are disabled until an administrator turns read-only mode off.": "El servidor está en modo de solo lectura. Los cambios están desactivados hasta que un administrador desactive el modo de solo lectura.",
+	},
+	French: {
+		"Validation failed":                       "Échec de la validation",
+		"Invalid request body":                    "Corps de la requête invalide",
+		"Internal server error":                   "Erreur interne du serveur",
+		"Authentication required":                 "Authentification requise",
+		"Invalid or expired session":              "Session invalide ou expirée",
+		"Access denied":                           "Accès refusé",
+		"Admin access required":                   "Accès administrateur requis",
+		"Invalid email or password":               "E-mail ou mot de passe incorrect",
+		"Email and password are required":         "L'e-mail et le mot de passe sont obligatoires",
+		"Email is required":                       "L'e-mail est obligatoire",
+		"Password is required":                    "Le mot de passe est obligatoire",
+		"Password must be at least 8 characters":  "Le mot de passe doit contenir au moins 8 caractères",
+		"Current password is incorrect":           "Le mot de passe actuel est incorrect",
+		"Name is required":                        "Le nom est obligatoire",
+		"Username is required":                    "Le nom d'utilisateur est obligatoire",
+		"Phone number is required":                "Le numéro de téléphone est obligatoire",
+		"To number is required":                   "Le numéro du destinataire est obligatoire",
+		"Pattern is required":                     "Le motif est obligatoire",
+		"Audio URL is required":                   "L'URL audio est obligatoire",
+		"Invalid DID ID":                          "ID de DID invalide",
+		"Invalid user ID":                         "ID d'utilisateur invalide",
+		"Invalid device ID":                       "ID d'appareil invalide",
+		"Invalid route ID":                        "ID de route invalide",
+		"Invalid message ID":                      "ID de message invalide",
+		"Invalid voicemail ID":                    "ID de message vocal invalide",
+		"DID not found":                           "DID introuvable",
+		"User not found":                          "Utilisateur introuvable",
+		"Device not found":                        "Appareil introuvable",
+		"Route not found":                         "Route introuvable",
+		"Message not found":                       "Message introuvable",
+		"Voicemail not found":                     "Message vocal introuvable",
+		"Greeting not found":                      "Annonce introuvable",
+		"Language must be one of: en, es, fr, de": "La langue doit être l'une des suivantes : en, es, fr, de",
+
+		// Password policy
+		"Password must be at most 72 characters":    "Le mot de passe doit contenir au plus 72 caractères",
+		"Password must contain an uppercase letter": "Le mot de passe doit contenir une lettre majuscule",
+		"Password must contain a lowercase letter":  "Le mot de passe doit contenir une lettre minuscule",
+		"Password must contain a number":            "Le mot de passe doit contenir un chiffre",
+		"Password must contain a symbol":            "Le mot de passe doit contenir un symbole",
+		"Password is too common":                    "Le mot de passe est trop courant",
+		"Password has appeared in a data breach":    "Le mot de passe figure dans une fuite de données",
+
+		// Read-only mode
+		"The server is in read-only mode. Changes are disabled until an administrator turns read-only mode off.": "Le serveur est en mode lecture seule. Les modifications sont désactivées jusqu'à ce qu'un administrateur désactive le mode lecture seule.",
+	},
+	German: {
+		"Validation failed":                       "Validierung fehlgeschlagen",
+		"Invalid request body":                    "Ungültiger Anfrageinhalt",
+		"Internal server error":                   "Interner Serverfehler",
+		"Authentication required":                 "Authentifizierung erforderlich",
+		"Invalid or expired session":              "Ungültige oder abgelaufene Sitzung",
+		"Access denied":                           "Zugriff verweigert",
+		"Admin access required":                   "Administratorzugriff erforderlich",
+		"Invalid email or password":               "Ungültige E-Mail-Adresse oder ungültiges Passwort",
+		"Email and password are required":         "E-Mail-Adresse und Passwort sind erforderlich",
+		"Email is required":                       "E-Mail-Adresse ist erforderlich",
+		"Password is required":                    "Passwort ist erforderlich",
+		"Password must be at least 8 characters":  "Das Passwort muss mindestens 8 Zeichen lang sein",
+		"Current password is incorrect":           "Das aktuelle Passwort ist falsch",
+		"Name is required":                        "Name ist erforderlich",
+		"Username is required":                    "Benutzername ist erforderlich",
+		"Phone number is required":                "Telefonnummer ist erforderlich",
+		"To number is required":                   "Zielnummer ist erforderlich",
+		"Pattern is required":                     "Muster ist erforderlich",
+		"Audio URL is required":                   "Audio-URL ist erforderlich",
+		"Invalid DID ID":                          "Ungültige DID-ID",
+		"Invalid user ID":                         "Ungültige Benutzer-ID",
+		"Invalid device ID":                       "Ungültige Geräte-ID",
+		"Invalid route ID":                        "Ungültige Routen-ID",
+		"Invalid message ID":                      "Ungültige Nachrichten-ID",
+		"Invalid voicemail ID":                    "Ungültige Voicemail-ID",
+		"DID not found":                           "DID nicht gefunden",
+		"User not found":                          "Benutzer nicht gefunden",
+		"Device not found":                        "Gerät nicht gefunden",
+		"Route not found":                         "Route nicht gefunden",
+		"Message not found":                       "Nachricht nicht gefunden",
+		"Voicemail not found":                     "Voicemail nicht gefunden",
+		"Greeting not found":                      "Ansage nicht gefunden",
+		"Language must be one of: en, es, fr, de": "Die Sprache muss eine der folgenden sein: en, es, fr, de",
+
+		// Password policy
+		"Password must be at most 72 characters":    "Das Passwort darf höchstens 72 Zeichen lang sein",
+		"Password must contain an uppercase letter": "Das Passwort muss einen Großbuchstaben enthalten",
+		"Password must contain a lowercase letter":  "Das Passwort muss einen Kleinbuchstaben enthalten",
+		"Password must contain a number":            "Das Passwort muss eine Ziffer enthalten",
+		"Password must contain a symbol":            "Das Passwort muss ein Sonderzeichen enthalten",
+		"Password is too common":                    "Das Passwort ist zu häufig",
+		"Password has appeared in a data breach":    "Das Passwort ist in einem Datenleck aufgetaucht",
+
+		// Read-only mode
+		"The server is in read-only mode. Changes are disabled until an administrator turns read-only mode off.": "Der Server ist im Nur-Lese-Modus. Änderungen sind deaktiviert, bis ein Administrator den Nur-Lese-Modus ausschaltet.",
+	},
+}
@@ -0,0 +1,177 @@
+package i18n
+
+// Voice prompt keys
+const (
+	PromptVoicemailGreeting    = "voicemail_greeting"
+	PromptGoodbye              = "goodbye"
+	PromptVoicemailFull        = "voicemail_full"
+	PromptNoResponse           = "no_response"
+	PromptAnonymousChallenge   = "anonymous_challenge"
+	PromptAnonymousCallFrom    = "anonymous_call_from"
+	PromptNumberNotFound       = "number_not_found"
+	PromptExtensionNotFound    = "extension_not_found"
+	PromptExtensionUnavailable = "extension_unavailable"
+	PromptGreetingMailbox      = "greeting_mailbox"
+	PromptGreetingMailboxTie   = "greeting_mailbox_tie"
+	PromptGreetingMenu         = "greeting_menu"
+	PromptGreetingRecord       = "greeting_record"
+	PromptGreetingReview       = "greeting_review"
+	PromptGreetingPlayback     = "greeting_playback"
+	PromptGreetingCurrent      = "greeting_current"
+	PromptGreetingSaved        = "greeting_saved"
+	PromptGreetingActivated    = "greeting_activated"
+	PromptGreetingNotRecorded  = "greeting_not_recorded"
+	PromptGreetingSystem       = "greeting_system"
+	PromptGreetingDiscarded    = "greeting_discarded"
+	PromptGreetingNotSaved     = "greeting_not_saved"
+	PromptGreetingNoRecording  = "greeting_no_recording"
+	PromptEscalationCall       = "escalation_call"
+	PromptEscalationAccept     = "escalation_accept"
+	PromptEscalationText       = "escalation_text"
+	PromptVerificationCode     = "verification_code"
+	PromptReminderAppointment  = "reminder_appointment"
+	PromptReminderReply        = "reminder_reply"
+	PromptReminderPress        = "reminder_press"
+	PromptReminderConfirmed    = "reminder_confirmed"
+	PromptReminderCancelled    = "reminder_cancelled"
+)
+
+// prompts holds the shipped prompt set for every supported language
+var prompts = map[string]map[string]string{
+	English: {
+		PromptVoicemailGreeting:    "Please leave a message after the beep.",
+		PromptGoodbye:              "Goodbye.",
+		PromptVoicemailFull:        "The mailbox is full and cannot take new messages. Goodbye.",
+		PromptNoResponse:           "We did not receive a response. Goodbye.",
+		PromptAnonymousChallenge:   "Please state your name after the tone.",
+		PromptAnonymousCallFrom:    "Anonymous call from",
+		PromptNumberNotFound:       "The number you dialed is not available.",
+		PromptExtensionNotFound:    "Extension not found.",
+		PromptExtensionUnavailable: "Extension is not available.",
+		PromptGreetingMailbox:      "Enter the mailbox number or its last four digits, then press pound.",
+		PromptGreetingMailboxTie:   "More than one mailbox ends in those digits. Enter the full mailbox number, then press pound.",
+		PromptGreetingMenu:         "Press 1 to record your standard greeting. Press 2 to record a temporary greeting. Press 3 to use your standard greeting, or 4 to use your temporary greeting. Press 5 to hear your current greeting.",
+		PromptGreetingRecord:       "Record your greeting after the tone. Press pound when finished.",
+		PromptGreetingReview:       "Press 1 to save it, 2 to record it again, or 3 to discard it.",
+		PromptGreetingPlayback:     "Here is your new greeting.",
+		PromptGreetingCurrent:      "Your current greeting is",
+		PromptGreetingSaved:        "Your greeting has been saved and is now active.",
+		PromptGreetingActivated:    "Your greeting is now active.",
+		PromptGreetingNotRecorded:  "That greeting has not been recorded.",
+		PromptGreetingSystem:       "You are using the system greeting.",
+		PromptGreetingDiscarded:    "Recording discarded.",
+		PromptGreetingNotSaved:     "Your greeting could not be saved.",
+		PromptGreetingNoRecording:  "No recording was received.",
+		PromptEscalationCall:       "Urgent call from",
+		PromptEscalationAccept:     "Press any key to accept the call.",
+		PromptEscalationText:       "Answer the call and press any key to acknowledge it.",
+		PromptVerificationCode:     "Your verification code is",
+		PromptReminderAppointment:  "Reminder: you have an appointment on {date} at {time}.",
+		PromptReminderReply:        "Reply C to confirm or X to cancel.",
+		PromptReminderPress:        "Press 1 to confirm, or 2 to cancel.",
+		PromptReminderConfirmed:    "Thank you, your appointment is confirmed.",
+		PromptReminderCancelled:    "Your appointment has been cancelled.",
+	},
+	Spanish: {
+		PromptVoicemailGreeting:    "Por favor, deje un mensaje después del tono.",
+		PromptGoodbye:              "Adiós.",
+		PromptVoicemailFull:        "El buzón de voz está lleno y no admite mensajes nuevos. Adiós.",
+		PromptNoResponse:           "No recibimos respuesta. Adiós.",
+		PromptAnonymousChallenge:   "Por favor, diga su nombre después del tono.",
+		PromptAnonymousCallFrom:    "Llamada anónima de",
+		PromptNumberNotFound:       "El número que marcó no está disponible.",
+		PromptExtensionNotFound:    "Extensión no encontrada.",
+		PromptExtensionUnavailable: "La extensión no está disponible.",
+		PromptGreetingMailbox:      "Marque el número del buzón o sus últimos cuatro dígitos y pulse la tecla numeral.",
+		PromptGreetingMailboxTie:   "Hay más de un buzón que termina en esos dígitos. Marque el número completo del buzón y pulse la tecla numeral.",
+		PromptGreetingMenu:         "Pulse 1 para grabar su saludo estándar. Pulse 2 para grabar un saludo temporal. Pulse 3 para usar su saludo estándar, o 4 para usar su saludo temporal. Pulse 5 para escuchar su saludo actual.",
+		PromptGreetingRecord:       "Grabe su saludo después del tono. Pulse almohadilla al terminar.",
+		PromptGreetingReview:       "Pulse 1 para guardarlo, 2 para grabarlo de nuevo, o 3 para descartarlo.",
+		PromptGreetingPlayback:     "Este es su nuevo saludo.",
+		PromptGreetingCurrent:      "Su saludo actual es",
+		PromptGreetingSaved:        "Su saludo se ha guardado y ya está activo.",
+		PromptGreetingActivated:    "Su saludo ya está activo.",
+		PromptGreetingNotRecorded:  "Ese saludo no ha sido grabado.",
+		PromptGreetingSystem:       "Está usando el saludo del sistema.",
+		PromptGreetingDiscarded:    "Grabación descartada.",
+		PromptGreetingNotSaved:     "No se pudo guardar su saludo.",
+		PromptGreetingNoRecording:  "No se recibió ninguna grabación.",
+		PromptEscalationCall:       "Llamada urgente de",
+		PromptEscalationAccept:     "Pulse cualquier tecla para aceptar la llamada.",
+		PromptEscalationText:       "Conteste la llamada y pulse cualquier tecla para confirmarla.",
+		PromptVerificationCode:     "Su código de verificación es",
+		PromptReminderAppointment:  "Recordatorio: tiene una cita el {date} a las {time}.",
+		PromptReminderReply:        "Responda C para confirmar o X para cancelar.",
+		PromptReminderPress:        "Pulse 1 para confirmar, o 2 para cancelar.",
+		PromptReminderConfirmed:    "Gracias, su cita está confirmada.",
+		PromptReminderCancelled:    "Su cita ha sido cancelada.",
+	},
+	French: {
+		PromptVoicemailGreeting:    "Veuillez laisser un message après le bip.",
+		PromptGoodbye:              "Au revoir.",
+		PromptVoicemailFull:        "La boîte vocale est pleine et ne peut plus recevoir de messages. Au revoir.",
+		PromptNoResponse:           "Nous n'avons reçu aucune réponse. Au revoir.",
+		PromptAnonymousChallenge:   "Veuillez indiquer votre nom après la tonalité.",
+		PromptAnonymousCallFrom:    "Appel anonyme de",
+		PromptNumberNotFound:       "Le numéro que vous avez composé n'est pas disponible.",
+		PromptExtensionNotFound:    "Poste introuvable.",
+		PromptExtensionUnavailable: "Le poste n'est pas disponible.",
+		PromptGreetingMailbox:      "Saisissez le numéro de la messagerie ou ses quatre derniers chiffres, puis appuyez sur dièse.",
+		PromptGreetingMailboxTie:   "Plusieurs messageries se terminent par ces chiffres. Saisissez le numéro complet de la messagerie, puis appuyez sur dièse.",
+		PromptGreetingMenu:         "Appuyez sur 1 pour enregistrer votre annonce standard. Appuyez sur 2 pour enregistrer une annonce temporaire. Appuyez sur 3 pour utiliser votre annonce standard, ou sur 4 pour utiliser votre annonce temporaire. Appuyez sur 5 pour écouter votre annonce actuelle.",
+		PromptGreetingRecord:       "Enregistrez votre annonce après la tonalité. Appuyez sur dièse pour terminer.",
+		PromptGreetingReview:       "Appuyez sur 1 pour l'enregistrer, sur 2 pour la réenregistrer, ou sur 3 pour la supprimer.",
+		PromptGreetingPlayback:     "Voici votre nouvelle annonce.",
+		PromptGreetingCurrent:      "Votre annonce actuelle est",
+		PromptGreetingSaved:        "Votre annonce a été enregistrée et est maintenant active.",
+		PromptGreetingActivated:    "Votre annonce est maintenant active.",
+		PromptGreetingNotRecorded:  "Cette annonce n'a pas été enregistrée.",
+		PromptGreetingSystem:       "Vous utilisez l'annonce du système.",
+		PromptGreetingDiscarded:    "Enregistrement supprimé.",
+		PromptGreetingNotSaved:     "Votre annonce n'a pas pu être enregistrée.",
+		PromptGreetingNoRecording:  "Aucun enregistrement n'a été reçu.",
+		PromptEscalationCall:       "Appel urgent de",
+		PromptEscalationAccept:     "Appuyez sur une touche pour accepter l'appel.",
+		PromptEscalationText:       "Répondez à l'appel et appuyez sur une touche pour le confirmer.",
+		PromptVerificationCode:     "Votre code de vérification est",
+		PromptReminderAppointment:  "Rappel : vous avez un rendez-vous le {date} à {time}.",
+		PromptReminderReply:        "Répondez C pour confirmer ou X pour annuler.",
+		PromptReminderPress:        "Appuyez sur 1 pour confirmer, ou sur 2 pour annuler.",
+		PromptReminderConfirmed:    "Merci, votre rendez-vous est confirmé.",
+		PromptReminderCancelled:    "Votre rendez-vous a été annulé.",
+	},
+	German: {
+		PromptVoicemailGreeting:    "Bitte hinterlassen Sie eine Nachricht nach dem Signalton.",
+		PromptGoodbye:              "Auf Wiederhören.",
+		PromptVoicemailFull:        "Das Postfach ist voll und kann keine neuen Nachrichten annehmen. Auf Wiederhören.",
+		PromptNoResponse:           "Wir haben keine Antwort erhalten. Auf Wiederhören.",
+		PromptAnonymousChallenge:   "Bitte nennen Sie nach dem Signalton Ihren Namen.",
+		PromptAnonymousCallFrom:    "Anonymer Anruf von",
+		PromptNumberNotFound:       "Die gewählte Rufnummer ist nicht verfügbar.",
+		PromptExtensionNotFound:    "Nebenstelle nicht gefunden.",
+		PromptExtensionUnavailable: "Die Nebenstelle ist nicht erreichbar.",
+		PromptGreetingMailbox:      "Geben Sie die Mailbox-Nummer oder ihre letzten vier Ziffern ein und drücken Sie die Rautetaste.",
+		PromptGreetingMailboxTie:   "Mehrere Mailboxen enden mit diesen Ziffern. Geben Sie die vollständige Mailbox-Nummer ein und drücken Sie die Rautetaste.",
+		PromptGreetingMenu:         "Drücken Sie 1, um Ihre Standardansage aufzunehmen. Drücken Sie 2, um eine vorübergehende Ansage aufzunehmen. Drücken Sie 3, um Ihre Standardansage zu verwenden, oder 4 für Ihre vorübergehende Ansage. Drücken Sie 5, um Ihre aktuelle Ansage anzuhören.",
+		PromptGreetingRecord:       "Sprechen Sie Ihre Ansage nach dem Signalton. Drücken Sie die Raute-Taste, wenn Sie fertig sind.",
+		PromptGreetingReview:       "Drücken Sie 1 zum Speichern, 2 zum erneuten Aufnehmen oder 3 zum Verwerfen.",
+		PromptGreetingPlayback:     "Hier ist Ihre neue Ansage.",
+		PromptGreetingCurrent:      "Ihre aktuelle Ansage lautet",
+		PromptGreetingSaved:        "Ihre Ansage wurde gespeichert und ist jetzt aktiv.",
+		PromptGreetingActivated:    "Ihre Ansage ist jetzt aktiv.",
+		PromptGreetingNotRecorded:  "Diese Ansage wurde noch nicht aufgenommen.",
+		PromptGreetingSystem:       "Sie verwenden die Systemansage.",
+		PromptGreetingDiscarded:    "Aufnahme verworfen.",
+		PromptGreetingNotSaved:     "Ihre Ansage konnte nicht gespeichert werden.",
+		PromptGreetingNoRecording:  "Es wurde keine Aufnahme empfangen.",
+		PromptEscalationCall:       "Dringender Anruf von",
+		PromptEscalationAccept:     "Drücken Sie eine beliebige Taste, um den Anruf anzunehmen.",
+		PromptEscalationText:       "Nehmen Sie den Anruf an und drücken Sie eine beliebige Taste, um ihn zu bestätigen.",
+		PromptVerificationCode:     "Ihr Bestätigungscode lautet",
+		PromptReminderAppointment:  "Erinnerung: Sie haben am {date} um {time} einen Termin.",
+		PromptReminderReply:        "Antworten Sie C zum Bestätigen oder X zum Absagen.",
+		PromptReminderPress:        "Drücken Sie 1 zum Bestätigen oder 2 zum Absagen.",
+		PromptReminderConfirmed:    "Vielen Dank, Ihr Termin ist bestätigt.",
+		PromptReminderCancelled:    "Ihr Termin wurde abgesagt.",
+	},
+}
@@ -0,0 +1,239 @@
+// Package integrity checks that the recordings and voicemails GoSIP keeps
+// on disk are still there and unchanged since they were written
+package integrity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/announcements"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/pkg/sip"
+)
+
+var (
+	// ErrMissing is returned for media files that are gone from disk
+	ErrMissing = errors.New("media file missing")
+	// ErrCorrupted is returned for media files that no longer match the
+	// checksum taken when they were written
+	ErrCorrupted = errors.New("media file corrupted")
+)
+
+// Kinds of media files
+const (
+	KindRecording = "recording"
+	KindVoicemail = "voicemail"
+)
+
+// Problems found with a media file
+const (
+	ProblemMissing   = "missing"
+	ProblemCorrupted = "corrupted"
+)
+
+// Checksum returns the hex SHA-256 of a file
+func Checksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// Verify checks a file against the checksum taken when it was written.
+// Files written before checksums were kept have none and are only checked
+// to exist.
+func Verify(path, checksum string) error {
+	actual, err := Checksum(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrMissing
+	}
+	if err != nil {
+		return err
+	}
+	if checksum != "" && actual != checksum {
+		return ErrCorrupted
+	}
+	return nil
+}
+
+// Problem is a media file that failed verification
+type Problem struct {
+	Kind    string `json:"kind"` // "recording" or "voicemail"
+	ID      int64  `json:"id"`
+	File    string `json:"file"`
+	Problem string `json:"problem"` // "missing" or "corrupted"
+}
+
+// Report is the outcome of a verification run
+type Report struct {
+	Checked   int       `json:"checked"`  // Files verified
+	Recorded  int       `json:"recorded"` // Files without a checksum that got one
+	Problems  []Problem `json:"problems"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Monitor verifies every recording and local voicemail file every
+// MediaVerifyInterval, raising an announcement while any are damaged
+type Monitor struct {
+	cfg      *config.Config
+	database *db.DB
+	hub      *events.Hub
+
+	// checkMu serializes checks so scheduled and manual checks don't interleave
+	checkMu sync.Mutex
+
+	mu     sync.RWMutex
+	report *Report
+}
+
+// NewMonitor creates a Monitor
+func NewMonitor(cfg *config.Config, database *db.DB, hub *events.Hub) *Monitor {
+	return &Monitor{
+		cfg:      cfg,
+		database: database,
+		hub:      hub,
+	}
+}
+
+// Start verifies the files now and then every MediaVerifyInterval
+func (m *Monitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(config.MediaVerifyInterval)
+		defer ticker.Stop()
+
+		for {
+			m.Check(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Report returns the last check, nil before the first
+func (m *Monitor) Report() *Report {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.report
+}
+
+// Check verifies the files of completed recordings and of voicemails GoSIP
+// recorded itself, records checksums for files that have none and updates
+// the damaged media announcement
+func (m *Monitor) Check(ctx context.Context) *Report {
+	m.checkMu.Lock()
+	defer m.checkMu.Unlock()
+
+	report := &Report{Problems: []Problem{}, CheckedAt: time.Now()}
+	if err := m.checkRecordings(ctx, report); err != nil {
+		report.Error = err.Error()
+	}
+	if err := m.checkVoicemails(ctx, report); err != nil && report.Error == "" {
+		report.Error = err.Error()
+	}
+	if report.Error != "" {
+		slog.Error("Media integrity check failed", "error", report.Error)
+	}
+
+	m.mu.Lock()
+	m.report = report
+	m.mu.Unlock()
+
+	announcements.RecordMediaDamaged(ctx, m.database, m.hub, len(report.Problems))
+	return report
+}
+
+// checkRecordings verifies the files of completed recordings
+func (m *Monitor) checkRecordings(ctx context.Context, report *Report) error {
+	recordings, err := m.database.Recordings.List(ctx, db.RecordingFilter{})
+	if err != nil {
+		return err
+	}
+	for _, rec := range recordings {
+		if rec.Status != db.RecordingCompleted {
+			continue
+		}
+		path := filepath.Join(m.cfg.RecordingsPath(), filepath.Base(rec.FileName))
+		m.verify(ctx, report, KindRecording, rec.ID, path, rec.Checksum, func() bool {
+			_, err := m.database.Recordings.GetByID(ctx, rec.ID)
+			return err == nil
+		}, m.database.Recordings.SetChecksum)
+	}
+	return nil
+}
+
+// checkVoicemails verifies the files of voicemails GoSIP recorded itself;
+// the audio of the others is kept by Twilio
+func (m *Monitor) checkVoicemails(ctx context.Context, report *Report) error {
+	media, err := m.database.Voicemails.ListMedia(ctx)
+	if err != nil {
+		return err
+	}
+	for _, vm := range media {
+		if vm.AudioURL != sip.VoicemailURL(vm.ID) {
+			continue
+		}
+		path := filepath.Join(m.cfg.VoicemailsPath(), sip.VoicemailFile(vm.ID))
+		m.verify(ctx, report, KindVoicemail, vm.ID, path, vm.Checksum, func() bool {
+			_, err := m.database.Voicemails.Checksum(ctx, vm.ID)
+			return err == nil
+		}, m.database.Voicemails.SetChecksum)
+	}
+	return nil
+}
+
+// verify checks one file, adding it to the report. Files without a
+// checksum get one. A file that fails is only reported when its row still
+// exists, since it may have been deleted while the check ran.
+func (m *Monitor) verify(ctx context.Context, report *Report, kind string, id int64, path, checksum string,
+	exists func() bool, setChecksum func(ctx context.Context, id int64, checksum string) error) {
+	actual, err := Checksum(path)
+	problem := ""
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		problem = ProblemMissing
+	case err != nil:
+		slog.Warn("Failed to verify media file", "error", err, "kind", kind, "id", id)
+		return
+	case checksum != "" && actual != checksum:
+		problem = ProblemCorrupted
+	}
+	report.Checked++
+
+	if problem == "" {
+		if checksum != "" {
+			return
+		}
+		if err := setChecksum(ctx, id, actual); err != nil {
+			slog.Warn("Failed to record media checksum", "error", err, "kind", kind, "id", id)
+			return
+		}
+		report.Recorded++
+		return
+	}
+	if !exists() {
+		return
+	}
+	slog.Warn("Media file damaged", "kind", kind, "id", id, "file", path, "problem", problem)
+	report.Problems = append(report.Problems, Problem{Kind: kind, ID: id, File: filepath.Base(path), Problem: problem})
+}
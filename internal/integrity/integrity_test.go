@@ -0,0 +1,159 @@
+package integrity
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/announcements"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/pkg/sip"
+)
+
+func setupTestMonitor(t *testing.T) (*Monitor, *config.Config, *db.DB) {
+	t.Helper()
+
+	database, err := db.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Close()
+	})
+
+	cfg := &config.Config{DataDir: t.TempDir()}
+	if err := cfg.EnsureDirectories(); err != nil {
+		t.Fatalf("Failed to create data directories: %v", err)
+	}
+	return NewMonitor(cfg, database, nil), cfg, database
+}
+
+// addRecording stores a completed recording whose file holds data
+func addRecording(t *testing.T, cfg *config.Config, database *db.DB, name, data, checksum string) *models.Recording {
+	t.Helper()
+	ctx := context.Background()
+
+	rec := &models.Recording{CallID: name, FileName: name + ".wav"}
+	if err := database.Recordings.Create(ctx, rec); err != nil {
+		t.Fatalf("Failed to create recording: %v", err)
+	}
+	rec.Status, rec.Checksum = db.RecordingCompleted, checksum
+	if err := database.Recordings.Finish(ctx, rec); err != nil {
+		t.Fatalf("Failed to finish recording: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(cfg.RecordingsPath(), rec.FileName), []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed to write recording: %v", err)
+	}
+	return rec
+}
+
+func checksumOf(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	checksum, err := Checksum(path)
+	if err != nil {
+		t.Fatalf("Failed to checksum file: %v", err)
+	}
+	return checksum
+}
+
+func TestMonitor_Check(t *testing.T) {
+	m, cfg, database := setupTestMonitor(t)
+	ctx := context.Background()
+
+	intact := addRecording(t, cfg, database, "intact", "audio", checksumOf(t, "audio"))
+	corrupted := addRecording(t, cfg, database, "corrupted", "changed", checksumOf(t, "audio"))
+	missing := addRecording(t, cfg, database, "missing", "audio", checksumOf(t, "audio"))
+	os.Remove(filepath.Join(cfg.RecordingsPath(), missing.FileName))
+	legacy := addRecording(t, cfg, database, "legacy", "older audio", "")
+
+	// Local voicemail is checked, voicemail kept by Twilio isn't
+	local := &models.Voicemail{FromNumber: "+15559876543"}
+	remote := &models.Voicemail{FromNumber: "+15559876543", AudioURL: "https://api.twilio.com/recording.wav"}
+	for _, vm := range []*models.Voicemail{local, remote} {
+		if err := database.Voicemails.Create(ctx, vm); err != nil {
+			t.Fatalf("Failed to create voicemail: %v", err)
+		}
+	}
+	local.AudioURL = sip.VoicemailURL(local.ID)
+	if err := database.Voicemails.Update(ctx, local); err != nil {
+		t.Fatalf("Failed to update voicemail: %v", err)
+	}
+	if err := database.Voicemails.SetChecksum(ctx, local.ID, checksumOf(t, "message")); err != nil {
+		t.Fatalf("Failed to set checksum: %v", err)
+	}
+
+	report := m.Check(ctx)
+	if report.Error != "" || report.Checked != 5 || report.Recorded != 1 {
+		t.Fatalf("Expected 5 files checked and 1 checksum recorded, got %+v", report)
+	}
+	want := map[int64]string{corrupted.ID: ProblemCorrupted, missing.ID: ProblemMissing}
+	found := map[string]string{}
+	for _, p := range report.Problems {
+		found[p.Kind+"/"+p.File] = p.Problem
+		if p.Kind == KindRecording && want[p.ID] != p.Problem {
+			t.Errorf("Unexpected problem %+v", p)
+		}
+	}
+	if len(report.Problems) != 3 || found[KindVoicemail+"/"+sip.VoicemailFile(local.ID)] != ProblemMissing {
+		t.Errorf("Expected 2 damaged recordings and the missing voicemail, got %+v", report.Problems)
+	}
+	if m.Report() != report {
+		t.Error("Expected the report kept")
+	}
+	if _, err := database.Announcements.GetByKey(ctx, announcements.KeyMediaDamaged); err != nil {
+		t.Errorf("Expected the damaged media announcement, got %v", err)
+	}
+
+	// Files without a checksum get the one they have now
+	if rec, _ := database.Recordings.GetByID(ctx, legacy.ID); rec.Checksum != checksumOf(t, "older audio") {
+		t.Errorf("Expected the legacy recording's checksum recorded, got %q", rec.Checksum)
+	}
+	if rec, _ := database.Recordings.GetByID(ctx, intact.ID); rec.Checksum != checksumOf(t, "audio") {
+		t.Errorf("Expected the intact recording's checksum kept, got %q", rec.Checksum)
+	}
+
+	// The announcement clears once the damaged files are dealt with
+	for _, rec := range []*models.Recording{corrupted, missing} {
+		if err := database.Recordings.Delete(ctx, rec.ID); err != nil {
+			t.Fatalf("Failed to delete recording: %v", err)
+		}
+	}
+	database.Voicemails.Delete(ctx, local.ID)
+	if report := m.Check(ctx); len(report.Problems) != 0 {
+		t.Errorf("Expected no problems left, got %+v", report.Problems)
+	}
+	if _, err := database.Announcements.GetByKey(ctx, announcements.KeyMediaDamaged); err == nil {
+		t.Error("Expected the damaged media announcement cleared")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audio.wav")
+	if err := os.WriteFile(path, []byte("audio"), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	checksum := checksumOf(t, "audio")
+
+	if err := Verify(path, checksum); err != nil {
+		t.Errorf("Expected the file verified, got %v", err)
+	}
+	if err := Verify(path, ""); err != nil {
+		t.Errorf("Expected a file without a checksum accepted, got %v", err)
+	}
+	if err := Verify(path, checksumOf(t, "other")); err != ErrCorrupted {
+		t.Errorf("Expected ErrCorrupted, got %v", err)
+	}
+	if err := Verify(path+".gone", checksum); err != ErrMissing {
+		t.Errorf("Expected ErrMissing, got %v", err)
+	}
+}
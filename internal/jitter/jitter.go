@@ -0,0 +1,247 @@
+// Package jitter provides an adaptive RTP jitter buffer with packet loss
+// concealment. The buffer reorders packets, holds them for a playout delay
+// that follows the measured interarrival jitter (RFC 3550) between a
+// configured minimum and maximum, and reports the frames that have to be
+// concealed because their packet was lost or arrived too late.
+package jitter
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// Defaults for unset Config fields
+const (
+	DefaultFrameDuration = 20 * time.Millisecond
+	DefaultClockRate     = 8000
+)
+
+// jitterMultiple is how many times the jitter estimate the playout delay
+// covers, on top of one frame
+const jitterMultiple = 3
+
+// Config holds jitter buffer settings
+type Config struct {
+	// MinDelay and MaxDelay bound the playout delay
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// FrameDuration is the audio carried by each packet
+	FrameDuration time.Duration
+	// ClockRate is the RTP timestamp rate of the stream
+	ClockRate int
+}
+
+// Frame is the audio due for playout. Concealed frames carry no payload:
+// their packet was lost or late, and the caller fills the gap with a
+// Concealer.
+type Frame struct {
+	SequenceNumber uint16
+	Timestamp      uint32
+	Payload        []byte
+	Concealed      bool
+}
+
+// Stats describe a buffer's traffic and current state
+type Stats struct {
+	Received  uint64  `json:"received"`  // Packets pushed
+	Played    uint64  `json:"played"`    // Frames played from a packet
+	Lost      uint64  `json:"lost"`      // Packets that never arrived in time
+	Late      uint64  `json:"late"`      // Packets dropped for arriving after playout
+	Duplicate uint64  `json:"duplicate"` // Packets dropped as duplicates
+	Discarded uint64  `json:"discarded"` // Packets dropped to shrink the delay
+	Concealed uint64  `json:"concealed"` // Frames filled in by loss concealment
+	Underruns uint64  `json:"underruns"` // Times the buffer ran dry and rebuffered
+	JitterMs  float64 `json:"jitter_ms"` // Interarrival jitter estimate
+	DelayMs   int64   `json:"delay_ms"`  // Current target playout delay
+	Depth     int     `json:"depth"`     // Packets waiting for playout
+}
+
+// Buffer is an adaptive jitter buffer for one RTP stream. Push is called
+// as packets arrive and Pop once per frame duration by the playout clock.
+type Buffer struct {
+	mu  sync.Mutex
+	cfg Config
+
+	queue   map[uint16]*rtp.Packet
+	nextSeq uint16
+	primed  bool // nextSeq is set
+	started bool // Playout has begun, so nextSeq only moves forward
+	playing bool
+	// bufferingSince is when the first packet arrived while buffering
+	bufferingSince time.Time
+
+	// RFC 3550 interarrival jitter, in timestamp units
+	jitter      float64
+	lastArrival time.Time
+	lastTS      uint32
+	haveLast    bool
+
+	target time.Duration
+	stats  Stats
+}
+
+// New creates a Buffer. A MaxDelay below MinDelay is raised to match it.
+func New(cfg Config) *Buffer {
+	if cfg.FrameDuration <= 0 {
+		cfg.FrameDuration = DefaultFrameDuration
+	}
+	if cfg.ClockRate <= 0 {
+		cfg.ClockRate = DefaultClockRate
+	}
+	if cfg.MinDelay < 0 {
+		cfg.MinDelay = 0
+	}
+	if cfg.MaxDelay < cfg.MinDelay {
+		cfg.MaxDelay = cfg.MinDelay
+	}
+	if cfg.MaxDelay < cfg.FrameDuration {
+		cfg.MaxDelay = cfg.FrameDuration
+	}
+	b := &Buffer{cfg: cfg, queue: make(map[uint16]*rtp.Packet)}
+	b.target = b.clampDelay(cfg.FrameDuration)
+	return b
+}
+
+// Push adds a packet that arrived at arrival
+func (b *Buffer) Push(pkt *rtp.Packet, arrival time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stats.Received++
+	b.updateJitter(pkt.Timestamp, arrival)
+
+	seq := pkt.SequenceNumber
+	if !b.primed {
+		b.nextSeq, b.primed = seq, true
+	}
+	switch {
+	case b.queue[seq] != nil:
+		b.stats.Duplicate++
+		return
+	case seqBefore(seq, b.nextSeq):
+		if b.started {
+			b.stats.Late++
+			return
+		}
+		// Reordered ahead of the first packet played
+		b.nextSeq = seq
+	}
+
+	if !b.playing && len(b.queue) == 0 {
+		b.bufferingSince = arrival
+	}
+	b.queue[seq] = pkt.Clone()
+
+	// Never hold more audio than the maximum delay
+	for b.buffered() > b.cfg.MaxDelay {
+		b.dropOldest()
+	}
+}
+
+// Pop returns the frame due for playout at now. It returns false while the
+// buffer is filling up to its playout delay, when nothing should play.
+func (b *Buffer) Pop(now time.Time) (Frame, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.playing {
+		if len(b.queue) == 0 || now.Sub(b.bufferingSince) < b.target {
+			return Frame{}, false
+		}
+		b.playing, b.started = true, true
+	}
+
+	// Catch up gradually when the jitter has settled below the delay held
+	if b.buffered() > b.target+2*b.cfg.FrameDuration {
+		b.dropOldest()
+	}
+
+	seq := b.nextSeq
+	if pkt := b.queue[seq]; pkt != nil {
+		delete(b.queue, seq)
+		b.nextSeq++
+		b.stats.Played++
+		return Frame{SequenceNumber: seq, Timestamp: pkt.Timestamp, Payload: pkt.Payload}, true
+	}
+
+	b.stats.Concealed++
+	if len(b.queue) > 0 {
+		// Later packets are here, so this one is lost
+		b.stats.Lost++
+		b.nextSeq++
+	} else {
+		// Out of audio: rebuffer up to the playout delay before resuming.
+		// The missing packet may still turn up.
+		b.stats.Underruns++
+		b.playing = false
+	}
+	return Frame{SequenceNumber: seq, Concealed: true}, true
+}
+
+// Stats returns the buffer's statistics
+func (b *Buffer) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := b.stats
+	stats.JitterMs = math.Round(b.jitter/float64(b.cfg.ClockRate)*1e6) / 1e3
+	stats.DelayMs = b.target.Milliseconds()
+	stats.Depth = len(b.queue)
+	return stats
+}
+
+// updateJitter folds a packet's transit time into the jitter estimate
+// (RFC 3550 section 6.4.1) and moves the playout delay to match
+func (b *Buffer) updateJitter(ts uint32, arrival time.Time) {
+	if b.haveLast {
+		arrivalUnits := arrival.Sub(b.lastArrival).Seconds() * float64(b.cfg.ClockRate)
+		d := math.Abs(arrivalUnits - float64(int32(ts-b.lastTS)))
+		b.jitter += (d - b.jitter) / 16
+	}
+	b.lastArrival, b.lastTS, b.haveLast = arrival, ts, true
+
+	jitter := time.Duration(b.jitter / float64(b.cfg.ClockRate) * float64(time.Second))
+	b.target = b.clampDelay(b.cfg.FrameDuration + jitterMultiple*jitter)
+}
+
+// clampDelay rounds a delay up to whole frames within the configured bounds
+func (b *Buffer) clampDelay(d time.Duration) time.Duration {
+	frame := b.cfg.FrameDuration
+	d = (d + frame - 1) / frame * frame
+	if d < b.cfg.MinDelay {
+		d = b.cfg.MinDelay
+	}
+	if d > b.cfg.MaxDelay {
+		d = b.cfg.MaxDelay
+	}
+	return d
+}
+
+// buffered returns the audio waiting for playout
+func (b *Buffer) buffered() time.Duration {
+	return time.Duration(len(b.queue)) * b.cfg.FrameDuration
+}
+
+// dropOldest discards the next packet due for playout, counting any gap
+// before it as lost
+func (b *Buffer) dropOldest() {
+	for len(b.queue) > 0 {
+		seq := b.nextSeq
+		b.nextSeq++
+		if b.queue[seq] != nil {
+			delete(b.queue, seq)
+			b.stats.Discarded++
+			return
+		}
+		b.stats.Lost++
+	}
+}
+
+// seqBefore reports whether sequence number a comes before b, allowing for
+// wraparound
+func seqBefore(a, b uint16) bool {
+	return int16(a-b) < 0
+}
@@ -0,0 +1,165 @@
+package jitter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// packet returns a 20 ms PCMU packet with sequence number seq
+func packet(seq uint16) *rtp.Packet {
+	return &rtp.Packet{
+		Header:  rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 160},
+		Payload: []byte{byte(seq)},
+	}
+}
+
+// playout pops frames every 20 ms from start until end and returns the
+// sequence numbers played, with -1 for concealed frames
+func playout(b *Buffer, start, end time.Time) []int {
+	var played []int
+	for now := start; now.Before(end); now = now.Add(20 * time.Millisecond) {
+		frame, ok := b.Pop(now)
+		switch {
+		case !ok:
+		case frame.Concealed:
+			played = append(played, -1)
+		default:
+			played = append(played, int(frame.SequenceNumber))
+		}
+	}
+	return played
+}
+
+func TestBuffer_ReordersAndConceals(t *testing.T) {
+	b := New(Config{MinDelay: 60 * time.Millisecond, MaxDelay: 200 * time.Millisecond})
+	start := time.Unix(1000, 0)
+
+	// 3 arrives before 2, 4 is lost and 1 is duplicated
+	for i, seq := range []uint16{1, 3, 2, 1, 5, 6} {
+		b.Push(packet(seq), start.Add(time.Duration(i)*20*time.Millisecond))
+	}
+
+	played := playout(b, start, start.Add(300*time.Millisecond))
+	want := []int{1, 2, 3, -1, 5, 6}
+	if len(played) < len(want) {
+		t.Fatalf("played %v, want %v first", played, want)
+	}
+	for i := range want {
+		if played[i] != want[i] {
+			t.Fatalf("played %v, want %v first", played, want)
+		}
+	}
+
+	// A packet after its playout slot is dropped
+	b.Push(packet(4), start.Add(300*time.Millisecond))
+
+	stats := b.Stats()
+	if stats.Received != 7 || stats.Duplicate != 1 || stats.Lost != 1 || stats.Late != 1 || stats.Played != 5 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if stats.Underruns == 0 || stats.Depth != 0 {
+		t.Errorf("Expected the buffer to have run dry, got %+v", stats)
+	}
+}
+
+func TestBuffer_WaitsForPlayoutDelay(t *testing.T) {
+	b := New(Config{MinDelay: 60 * time.Millisecond, MaxDelay: 200 * time.Millisecond})
+	start := time.Unix(1000, 0)
+	b.Push(packet(10), start)
+
+	if _, ok := b.Pop(start.Add(40 * time.Millisecond)); ok {
+		t.Error("Expected nothing to play before the minimum delay")
+	}
+	if frame, ok := b.Pop(start.Add(60 * time.Millisecond)); !ok || frame.SequenceNumber != 10 {
+		t.Errorf("Pop after the delay = %+v, %v", frame, ok)
+	}
+}
+
+func TestBuffer_AdaptsToJitter(t *testing.T) {
+	cfg := Config{MinDelay: 40 * time.Millisecond, MaxDelay: 160 * time.Millisecond}
+	steady, flaky := New(cfg), New(cfg)
+	start := time.Unix(1000, 0)
+
+	for seq := uint16(0); seq < 200; seq++ {
+		sent := start.Add(time.Duration(seq) * 20 * time.Millisecond)
+		steady.Push(packet(seq), sent)
+		// Wi-Fi style bursts: every other packet is held back 50 ms
+		flaky.Push(packet(seq), sent.Add(time.Duration(seq%2)*50*time.Millisecond))
+	}
+
+	if d := steady.Stats().DelayMs; d != 40 {
+		t.Errorf("Steady stream delay = %d ms, want the 40 ms minimum", d)
+	}
+	stats := flaky.Stats()
+	if stats.JitterMs < 20 || stats.DelayMs <= 40 {
+		t.Errorf("Expected the delay to grow with the jitter, got %+v", stats)
+	}
+	if stats.DelayMs > 160 {
+		t.Errorf("Delay %d ms is over the 160 ms maximum", stats.DelayMs)
+	}
+}
+
+func TestBuffer_MaxDelay(t *testing.T) {
+	b := New(Config{MinDelay: 20 * time.Millisecond, MaxDelay: 100 * time.Millisecond})
+	start := time.Unix(1000, 0)
+
+	// A burst after a stall never queues more than the maximum delay
+	for seq := uint16(0); seq < 20; seq++ {
+		b.Push(packet(seq), start)
+	}
+	stats := b.Stats()
+	if stats.Depth != 5 || stats.Discarded != 15 {
+		t.Errorf("Expected 5 packets kept and 15 discarded, got %+v", stats)
+	}
+	if frame, ok := b.Pop(start.Add(100 * time.Millisecond)); !ok || frame.SequenceNumber != 15 {
+		t.Errorf("Expected the newest audio to play, got %+v, %v", frame, ok)
+	}
+}
+
+func TestBuffer_SequenceWrap(t *testing.T) {
+	b := New(Config{MinDelay: 40 * time.Millisecond, MaxDelay: 200 * time.Millisecond})
+	start := time.Unix(1000, 0)
+	for i, seq := range []uint16{65534, 65535, 0, 1} {
+		pkt := packet(seq)
+		pkt.Timestamp = uint32(i) * 160
+		b.Push(pkt, start.Add(time.Duration(i)*20*time.Millisecond))
+	}
+
+	played := playout(b, start, start.Add(200*time.Millisecond))
+	if len(played) < 4 || played[0] != 65534 || played[2] != 0 || played[3] != 1 {
+		t.Errorf("played %v across the wrap", played)
+	}
+}
+
+func TestConcealer(t *testing.T) {
+	var c Concealer
+	if pcm := c.Conceal(160); pcm[0] != 0 {
+		t.Error("Expected silence before any audio")
+	}
+
+	frame := make([]int16, 160)
+	for i := range frame {
+		frame[i] = 1000
+	}
+	c.Good(append([]int16(nil), frame...))
+
+	// The first concealed frame starts at the last frame's level and fades
+	first := c.Conceal(160)
+	if first[0] != 1000 || first[159] >= 1000 || first[159] < 700 {
+		t.Errorf("First concealed frame runs %d to %d", first[0], first[159])
+	}
+	for i := 1; i < concealFrames; i++ {
+		c.Conceal(160)
+	}
+	if pcm := c.Conceal(160); pcm[0] != 0 || pcm[159] != 0 {
+		t.Error("Expected silence after a long loss")
+	}
+
+	// Audio fades back in after a loss
+	resumed := c.Good(append([]int16(nil), frame...))
+	if resumed[0] != 0 || resumed[159] < 990 {
+		t.Errorf("Resumed frame runs %d to %d", resumed[0], resumed[159])
+	}
+}
@@ -0,0 +1,53 @@
+package jitter
+
+// concealFrames is how many frames in a row are concealed before the
+// output fades to silence
+const concealFrames = 5
+
+// Concealer fills in frames lost from a decoded audio stream. It repeats
+// the last good frame, fading it out over concealFrames frames, so short
+// losses are bridged without clicks and long ones become silence rather
+// than a stuck tone.
+type Concealer struct {
+	last   []int16
+	losses int
+}
+
+// Good records a decoded frame that played normally and returns it. The
+// first frame after a loss fades in from the concealed level.
+func (c *Concealer) Good(pcm []int16) []int16 {
+	if c.losses > 0 && c.last != nil {
+		from := c.gain(c.losses)
+		for i := range pcm {
+			g := from + (1-from)*float64(i)/float64(len(pcm))
+			pcm[i] = int16(float64(pcm[i]) * g)
+		}
+	}
+	c.last = append(c.last[:0], pcm...)
+	c.losses = 0
+	return pcm
+}
+
+// Conceal returns n samples to play in place of a lost frame
+func (c *Concealer) Conceal(n int) []int16 {
+	pcm := make([]int16, n)
+	c.losses++
+	if len(c.last) == 0 || c.losses > concealFrames {
+		return pcm
+	}
+
+	from, to := c.gain(c.losses-1), c.gain(c.losses)
+	for i := range pcm {
+		g := from + (to-from)*float64(i)/float64(n)
+		pcm[i] = int16(float64(c.last[i%len(c.last)]) * g)
+	}
+	return pcm
+}
+
+// gain returns the level after losses concealed frames
+func (c *Concealer) gain(losses int) float64 {
+	if losses >= concealFrames {
+		return 0
+	}
+	return 1 - float64(losses)/concealFrames
+}
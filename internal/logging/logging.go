@@ -0,0 +1,270 @@
+// Package logging filters log records by per-subsystem levels that can be
+// changed while the server runs
+package logging
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Subsystems whose log level can be set on its own
+const (
+	SubsystemSIP    = "sip"
+	SubsystemTwilio = "twilio"
+	SubsystemAPI    = "api"
+	SubsystemDB     = "db"
+	SubsystemRules  = "rules"
+)
+
+// Default is the level of everything outside the named subsystems
+const Default = "default"
+
+// ErrUnknownSubsystem is returned for subsystem names that aren't logged separately
+var ErrUnknownSubsystem = errors.New("unknown subsystem")
+
+// modulePath prefixes the package paths records are attributed by
+const modulePath = "github.com/btafoya/gosip/"
+
+// subsystemPackages maps packages to the subsystem their records belong to
+var subsystemPackages = map[string]string{
+	modulePath + "pkg/sip":         SubsystemSIP,
+	modulePath + "internal/twilio": SubsystemTwilio,
+	modulePath + "internal/api":    SubsystemAPI,
+	modulePath + "internal/db":     SubsystemDB,
+	modulePath + "internal/rules":  SubsystemRules,
+}
+
+// Subsystems returns the names of the subsystems with their own level
+func Subsystems() []string {
+	names := make([]string, 0, len(subsystemPackages))
+	for _, name := range subsystemPackages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseLevel parses "debug", "info", "warn" or "error"
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, errors.New("unknown log level " + s)
+}
+
+// LevelName returns the lowercase name ParseLevel accepts for level
+func LevelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
+
+// Level is the current level of one subsystem
+type Level struct {
+	Subsystem string `json:"subsystem"`
+	Level     string `json:"level"`
+	// DebugUntil is when a temporary debug level reverts
+	DebugUntil *time.Time `json:"debug_until,omitempty"`
+}
+
+// debugOverride is a temporary debug level and the level it reverts to
+type debugOverride struct {
+	previous slog.Level
+	until    time.Time
+	timer    *time.Timer
+}
+
+// Levels holds the log level of every subsystem
+type Levels struct {
+	mu     sync.RWMutex
+	levels map[string]slog.Level // Keyed by subsystem, including Default
+	debug  map[string]*debugOverride
+}
+
+// NewLevels creates Levels with every subsystem at level
+func NewLevels(level slog.Level) *Levels {
+	l := &Levels{
+		levels: map[string]slog.Level{Default: level},
+		debug:  make(map[string]*debugOverride),
+	}
+	for _, name := range Subsystems() {
+		l.levels[name] = level
+	}
+	return l
+}
+
+// Level returns the level of a subsystem. Unknown names get the default level.
+func (l *Levels) Level(subsystem string) slog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if level, ok := l.levels[subsystem]; ok {
+		return level
+	}
+	return l.levels[Default]
+}
+
+// Set changes the level of a subsystem, ending any temporary debug level
+func (l *Levels) Set(subsystem string, level slog.Level) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.levels[subsystem]; !ok {
+		return ErrUnknownSubsystem
+	}
+	if o := l.debug[subsystem]; o != nil {
+		o.timer.Stop()
+		delete(l.debug, subsystem)
+	}
+	l.levels[subsystem] = level
+	return nil
+}
+
+// Debug turns on debug logging for a subsystem for d, then restores its
+// previous level. Calling it again extends the period.
+func (l *Levels) Debug(subsystem string, d time.Duration) (time.Time, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.levels[subsystem]; !ok {
+		return time.Time{}, ErrUnknownSubsystem
+	}
+
+	o := l.debug[subsystem]
+	if o == nil {
+		o = &debugOverride{previous: l.levels[subsystem]}
+		l.debug[subsystem] = o
+	} else {
+		o.timer.Stop()
+	}
+	o.until = time.Now().Add(d)
+	o.timer = time.AfterFunc(d, func() { l.revert(subsystem, o) })
+	l.levels[subsystem] = slog.LevelDebug
+	return o.until, nil
+}
+
+// revert ends a temporary debug level unless it was replaced in the meantime
+func (l *Levels) revert(subsystem string, o *debugOverride) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.debug[subsystem] != o {
+		return
+	}
+	delete(l.debug, subsystem)
+	l.levels[subsystem] = o.previous
+	slog.Info("Temporary debug logging ended", "subsystem", subsystem, "level", LevelName(o.previous))
+}
+
+// Snapshot returns the level of every subsystem, the default level first
+func (l *Levels) Snapshot() []Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	names := append([]string{Default}, Subsystems()...)
+	snapshot := make([]Level, 0, len(names))
+	for _, name := range names {
+		level := Level{Subsystem: name, Level: LevelName(l.levels[name])}
+		if o := l.debug[name]; o != nil {
+			until := o.until
+			level.DebugUntil = &until
+		}
+		snapshot = append(snapshot, level)
+	}
+	return snapshot
+}
+
+// minLevel returns the lowest level of any subsystem
+func (l *Levels) minLevel() slog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	min := slog.LevelError
+	for _, level := range l.levels {
+		if level < min {
+			min = level
+		}
+	}
+	return min
+}
+
+// Handler passes records on to another handler when they meet the level of
+// the subsystem that logged them. The subsystem is worked out from the
+// package of the calling code, so log calls need no changes, and is added
+// to each record as the "subsystem" attribute.
+type Handler struct {
+	inner  slog.Handler
+	levels *Levels
+}
+
+// NewHandler creates a Handler writing to inner, which should accept every level
+func NewHandler(inner slog.Handler, levels *Levels) *Handler {
+	return &Handler{inner: inner, levels: levels}
+}
+
+// Enabled reports whether any subsystem logs at level
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.levels.minLevel()
+}
+
+// Handle filters a record by its subsystem's level
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	subsystem := subsystemOf(r.PC)
+	if r.Level < h.levels.Level(subsystem) {
+		return nil
+	}
+	if subsystem != Default {
+		r = r.Clone()
+		r.AddAttrs(slog.String("subsystem", subsystem))
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+// WithAttrs returns a Handler whose records include attrs
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{inner: h.inner.WithAttrs(attrs), levels: h.levels}
+}
+
+// WithGroup returns a Handler that nests later attributes under name
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{inner: h.inner.WithGroup(name), levels: h.levels}
+}
+
+// subsystemCache remembers the subsystem of each calling program counter
+var subsystemCache sync.Map
+
+// subsystemOf returns the subsystem of the code at pc, or Default
+func subsystemOf(pc uintptr) string {
+	if pc == 0 {
+		return Default
+	}
+	if name, ok := subsystemCache.Load(pc); ok {
+		return name.(string)
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	name := functionSubsystem(frame.Function)
+	subsystemCache.Store(pc, name)
+	return name
+}
+
+// functionSubsystem returns the subsystem of a fully qualified function
+// name such as "github.com/btafoya/gosip/pkg/sip.(*Server).Start"
+func functionSubsystem(function string) string {
+	pkg := function
+	if slash := strings.LastIndex(pkg, "/"); slash >= 0 {
+		if dot := strings.Index(pkg[slash:], "."); dot >= 0 {
+			pkg = pkg[:slash+dot]
+		}
+	}
+	if name, ok := subsystemPackages[pkg]; ok {
+		return name
+	}
+	return Default
+}
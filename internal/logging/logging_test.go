@@ -0,0 +1,120 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFunctionSubsystem(t *testing.T) {
+	tests := []struct {
+		function string
+		want     string
+	}{
+		{"github.com/btafoya/gosip/pkg/sip.(*Server).Start", SubsystemSIP},
+		{"github.com/btafoya/gosip/pkg/sip.(*Registrar).cleanup.func1", SubsystemSIP},
+		{"github.com/btafoya/gosip/internal/twilio.(*Client).SendSMS", SubsystemTwilio},
+		{"github.com/btafoya/gosip/internal/api.(*WebhookHandler).VoiceIncoming", SubsystemAPI},
+		{"github.com/btafoya/gosip/internal/db.New", SubsystemDB},
+		{"github.com/btafoya/gosip/internal/rules.(*Engine).Evaluate", SubsystemRules},
+		{"github.com/btafoya/gosip/internal/tftp.(*Server).Serve", Default},
+		{"github.com/btafoya/gosip/internal/apikeys.New", Default},
+		{"main.main", Default},
+		{"", Default},
+	}
+	for _, tt := range tests {
+		if got := functionSubsystem(tt.function); got != tt.want {
+			t.Errorf("functionSubsystem(%q) = %q, want %q", tt.function, got, tt.want)
+		}
+	}
+}
+
+func TestLevels_Set(t *testing.T) {
+	levels := NewLevels(slog.LevelInfo)
+
+	if err := levels.Set(SubsystemSIP, slog.LevelWarn); err != nil {
+		t.Fatalf("Failed to set level: %v", err)
+	}
+	if got := levels.Level(SubsystemSIP); got != slog.LevelWarn {
+		t.Errorf("Expected sip at warn, got %v", got)
+	}
+	if got := levels.Level(SubsystemDB); got != slog.LevelInfo {
+		t.Errorf("Expected db to keep info, got %v", got)
+	}
+	if err := levels.Set("voip", slog.LevelWarn); err != ErrUnknownSubsystem {
+		t.Errorf("Expected ErrUnknownSubsystem, got %v", err)
+	}
+}
+
+func TestLevels_Debug(t *testing.T) {
+	levels := NewLevels(slog.LevelInfo)
+	levels.Set(SubsystemTwilio, slog.LevelWarn)
+
+	until, err := levels.Debug(SubsystemTwilio, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Failed to enable debug: %v", err)
+	}
+	if until.IsZero() || levels.Level(SubsystemTwilio) != slog.LevelDebug {
+		t.Fatalf("Expected twilio at debug until %v", until)
+	}
+	for _, level := range levels.Snapshot() {
+		if (level.DebugUntil != nil) != (level.Subsystem == SubsystemTwilio) {
+			t.Errorf("Unexpected debug_until for %s: %v", level.Subsystem, level.DebugUntil)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for levels.Level(SubsystemTwilio) == slog.LevelDebug && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := levels.Level(SubsystemTwilio); got != slog.LevelWarn {
+		t.Errorf("Expected twilio to revert to warn, got %v", got)
+	}
+}
+
+func TestLevels_SetEndsDebug(t *testing.T) {
+	levels := NewLevels(slog.LevelInfo)
+	levels.Debug(SubsystemAPI, 50*time.Millisecond)
+	levels.Set(SubsystemAPI, slog.LevelError)
+
+	time.Sleep(100 * time.Millisecond)
+	if got := levels.Level(SubsystemAPI); got != slog.LevelError {
+		t.Errorf("Expected an explicit level to outlast debug mode, got %v", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	levels := NewLevels(slog.LevelInfo)
+	logger := slog.New(NewHandler(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}), levels))
+
+	// Records from this package belong to no subsystem
+	logger.Debug("hidden")
+	logger.Info("shown")
+	if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "shown") {
+		t.Errorf("Expected only info records at the default level, got %s", buf.String())
+	}
+	if strings.Contains(buf.String(), "subsystem=") {
+		t.Errorf("Expected no subsystem attribute, got %s", buf.String())
+	}
+
+	buf.Reset()
+	levels.Set(Default, slog.LevelDebug)
+	logger.With("call", "CA123").Debug("details")
+	if !strings.Contains(buf.String(), "details") || !strings.Contains(buf.String(), "call=CA123") {
+		t.Errorf("Expected debug record with attributes, got %s", buf.String())
+	}
+
+	// A subsystem at debug lowers the level the handler is enabled for
+	levels.Set(Default, slog.LevelWarn)
+	if logger.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("Expected debug to be disabled with every level above it")
+	}
+	levels.Debug(SubsystemSIP, time.Minute)
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("Expected debug to be enabled while sip is at debug")
+	}
+}
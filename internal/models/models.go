@@ -15,6 +15,66 @@ type User struct {
 	Role         string     `json:"role"` // "admin" or "user"
 	CreatedAt    time.Time  `json:"created_at"`
 	LastLogin    *time.Time `json:"last_login,omitempty"`
+	Language     string     `json:"language,omitempty"` // "en", "es", "fr", "de"; empty uses default_language
+	HideCallerID bool       `json:"hide_caller_id"`     // Withhold the caller ID of the user's devices' outbound calls
+	// TenantID is the tenant the user belongs to; nil for the instance's own users
+	TenantID *int64 `json:"tenant_id,omitempty"`
+}
+
+// LoginAttempt is one sign-in attempt in the authentication history
+type LoginAttempt struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"` // "invalid_credentials", "locked_out"
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginLockout counts recent failed sign-ins from an IP address or for an account
+type LoginLockout struct {
+	Scope         string     `json:"scope"` // "ip", "account"
+	Key           string     `json:"key"`   // IP address or lowercased email
+	Failures      int        `json:"failures"`
+	Lockouts      int        `json:"lockouts"` // Consecutive lockouts; each doubles the cooldown
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+}
+
+// UserCalendar is a calendar linked to a user, whose busy blocks drive
+// availability-based routing and SMS auto-replies
+type UserCalendar struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"user_id"`
+	Provider     string     `json:"provider"` // "caldav", "google"
+	URL          string     `json:"url"`
+	Username     string     `json:"username,omitempty"`
+	Password     string     `json:"-"`
+	Enabled      bool       `json:"enabled"`
+	Status       string     `json:"status"` // "pending", "ok", "error", "disabled"
+	LastSyncedAt *time.Time `json:"last_synced_at,omitempty"`
+	LastError    *string    `json:"last_error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// BusyBlock is a period during which a linked calendar shows its owner as busy
+type BusyBlock struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// NotificationSettings holds a user's personal notification channels and quiet hours
+type NotificationSettings struct {
+	UserID            int64     `json:"user_id"`
+	EmailEnabled      bool      `json:"email_enabled"` // Notify at the account email address
+	PushToken         string    `json:"-"`             // Gotify application token; never serialized
+	QuietHoursEnabled bool      `json:"quiet_hours_enabled"`
+	QuietStart        string    `json:"quiet_start"`        // "22:00"
+	QuietEnd          string    `json:"quiet_end"`          // "07:00"
+	Timezone          string    `json:"timezone,omitempty"` // IANA name; empty uses the system timezone
+	VIPBreakthrough   bool      `json:"vip_breakthrough"`   // VIP callers notify during quiet hours
+	UpdatedAt         time.Time `json:"updated_at"`
 }
 
 // Device represents a registered SIP device (phone, softphone, etc.)
@@ -36,6 +96,32 @@ type Device struct {
 	LastConfigFetch    *time.Time `json:"last_config_fetch,omitempty"`
 	LastRegistration   *time.Time `json:"last_registration,omitempty"`
 	ConfigTemplate     *string    `json:"config_template,omitempty"`
+	// CallWaiting lets a device that is already on a call receive a second one
+	CallWaiting bool `json:"call_waiting"`
+	// IntercomAllowed lets intercom calls to this device be answered automatically
+	IntercomAllowed bool `json:"intercom_allowed"`
+	// Extension is the short internal number other devices dial to reach this one
+	Extension *string `json:"extension,omitempty"`
+	// SIPMessaging delivers texts for the device's DIDs over SIP MESSAGE
+	SIPMessaging bool `json:"sip_messaging"`
+	// ComfortNoise offers CN (RFC 3389) to the device and fills silence
+	// with comfort noise; off strips CN and silence suppression from offers
+	ComfortNoise bool `json:"comfort_noise"`
+	// AnonymousCalls lets the device's outbound calls withhold their
+	// caller ID; only admins change it
+	AnonymousCalls bool `json:"anonymous_calls"`
+	// TenantID is the tenant the device belongs to; nil for the instance
+	TenantID *int64 `json:"tenant_id,omitempty"`
+}
+
+// DeviceDID is a DID a device may present as caller ID on outbound calls
+type DeviceDID struct {
+	DeviceID  int64  `json:"device_id"`
+	DIDID     int64  `json:"did_id"`
+	Number    string `json:"number"`
+	Name      string `json:"name,omitempty"`
+	Position  int    `json:"position"` // 1-based, dialed after the DID selection prefix
+	IsDefault bool   `json:"is_default"`
 }
 
 // Registration represents an active SIP registration
@@ -58,6 +144,18 @@ type DID struct {
 	Name         string `json:"name,omitempty"`
 	SMSEnabled   bool   `json:"sms_enabled"`
 	VoiceEnabled bool   `json:"voice_enabled"`
+	// AnonymousAction controls calls without caller ID: "allow", "reject" or "challenge"
+	AnonymousAction string `json:"anonymous_action"`
+	// Language selects the prompt set played to callers; empty uses default_language
+	Language string `json:"language,omitempty"`
+	// Timezone is the IANA timezone for schedules on this DID; empty uses the system timezone
+	Timezone string `json:"timezone,omitempty"`
+	// MessagingServiceSID sends outbound SMS through a Twilio Messaging Service; empty uses the global setting
+	MessagingServiceSID string `json:"messaging_service_sid,omitempty"`
+	// RecordingEnabled records calls to the DID whose media passes through GoSIP
+	RecordingEnabled bool `json:"recording_enabled"`
+	// TenantID is the tenant the DID is assigned to; nil for the instance
+	TenantID *int64 `json:"tenant_id,omitempty"`
 }
 
 // Route represents a call routing rule
@@ -66,11 +164,62 @@ type Route struct {
 	DIDID         *int64          `json:"did_id,omitempty"`
 	Priority      int             `json:"priority"`
 	Name          string          `json:"name"`
-	ConditionType string          `json:"condition_type"` // "time", "callerid", "default"
+	ConditionType string          `json:"condition_type"` // "time", "callerid", "default", "calendar", "webhook"
 	ConditionData json.RawMessage `json:"condition_data,omitempty"`
-	ActionType    string          `json:"action_type"` // "ring", "forward", "voicemail", "reject"
+	ActionType    string          `json:"action_type"` // "ring", "forward", "voicemail", "reject", "oncall", "escalate", "split"
 	ActionData    json.RawMessage `json:"action_data,omitempty"`
 	Enabled       bool            `json:"enabled"`
+	TenantID      *int64          `json:"tenant_id,omitempty"` // Follows the route's DID
+}
+
+// RouteVersion is a copy of a route saved after a change
+type RouteVersion struct {
+	ID      int64  `json:"id"`
+	RouteID int64  `json:"route_id"`
+	Version int    `json:"version"` // Counts up from 1 for each route
+	Change  string `json:"change"`  // "created", "updated", "reordered", "deleted", "rolled_back"
+	// Route is the route after the change, or before it was deleted
+	Route     Route     `json:"route"`
+	UserID    *int64    `json:"user_id,omitempty"`
+	UserEmail string    `json:"user_email,omitempty"` // Kept after the user is deleted
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RouteSplitCount is how many calls one target of a split route received
+type RouteSplitCount struct {
+	RouteID    int64      `json:"route_id"`
+	Target     int        `json:"target"` // Index into the split action's targets
+	Calls      int64      `json:"calls"`
+	LastCallAt *time.Time `json:"last_call_at,omitempty"`
+}
+
+// ChangeSet is a group of setting and route changes applied together at a
+// scheduled time, and optionally undone at another
+type ChangeSet struct {
+	ID       int64      `json:"id"`
+	Name     string     `json:"name"`
+	Changes  []Change   `json:"changes"`
+	Undo     []Change   `json:"-"` // Saved when applied, run in reverse to revert
+	ApplyAt  time.Time  `json:"apply_at"`
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+	// Status is "pending", "applied", "reverted", "cancelled" or "failed"
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	AppliedAt  *time.Time `json:"applied_at,omitempty"`
+	RevertedAt *time.Time `json:"reverted_at,omitempty"`
+	UserID     *int64     `json:"user_id,omitempty"` // Who scheduled it
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Change is one step of a change set
+type Change struct {
+	// Type is "setting", "route_create", "route_update" or "route_delete".
+	// Undo steps also use "route_restore", which recreates a deleted route.
+	Type    string  `json:"type"`
+	Key     string  `json:"key,omitempty"`   // Setting key
+	Value   *string `json:"value,omitempty"` // Setting value; nil removes the setting
+	RouteID int64   `json:"route_id,omitempty"`
+	Route   *Route  `json:"route,omitempty"` // The route to create, or its new state
 }
 
 // TimeCondition represents time-based routing conditions
@@ -92,6 +241,7 @@ type RingAction struct {
 	DeviceIDs []int64 `json:"device_ids"`
 	Timeout   int     `json:"timeout"` // seconds
 	Fallback  string  `json:"fallback"` // "voicemail", "forward", "reject"
+	AlertInfo string  `json:"alert_info,omitempty"` // Distinctive ring class
 }
 
 // ForwardAction represents action data for call forwarding
@@ -109,6 +259,91 @@ type BlocklistEntry struct {
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// BlocklistFeed represents a subscribed external spam number feed
+type BlocklistFeed struct {
+	ID            int64      `json:"id"`
+	Name          string     `json:"name"`
+	URL           string     `json:"url"`
+	Enabled       bool       `json:"enabled"`
+	Status        string     `json:"status"` // "pending", "ok", "error", "disabled"
+	EntryCount    int        `json:"entry_count"`
+	LastFetchedAt *time.Time `json:"last_fetched_at,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	LastError     *string    `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// CallerList is a named group of caller numbers that ring devices with a
+// distinctive Alert-Info tone
+type CallerList struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Numbers   []string  `json:"numbers"`
+	AlertInfo string    `json:"alert_info"` // Ring class, e.g. "vip"
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OnCallSchedule is a rotation of users paged by oncall routes. Levels are
+// rung in order until someone answers.
+type OnCallSchedule struct {
+	ID        int64         `json:"id"`
+	Name      string        `json:"name"`
+	Timezone  string        `json:"timezone,omitempty"` // Keeps daily handoffs at the same wall-clock time; empty uses the system timezone
+	Levels    []OnCallLevel `json:"levels"`
+	ICalToken string        `json:"-"` // Secret token in the iCal feed URL
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// OnCallLevel is one escalation level of an on-call schedule. Its users take
+// shifts of ShiftHours in turn, starting from RotationStart.
+type OnCallLevel struct {
+	UserIDs       []int64   `json:"user_ids"`
+	RotationStart time.Time `json:"rotation_start"`
+	ShiftHours    int       `json:"shift_hours"`
+	Timeout       int       `json:"timeout"` // Seconds to ring before escalating to the next level
+}
+
+// OnCallOverride puts a user on call at one level of a schedule for a period
+type OnCallOverride struct {
+	ID         int64     `json:"id"`
+	ScheduleID int64     `json:"schedule_id"`
+	Level      int       `json:"level"` // 1 is the first level
+	UserID     int64     `json:"user_id"`
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// EscalationPolicy calls its levels in turn until someone acknowledges the
+// call by pressing a digit, starting over up to Repeat times
+type EscalationPolicy struct {
+	ID        int64             `json:"id"`
+	Name      string            `json:"name"`
+	Levels    []EscalationLevel `json:"levels"`
+	Repeat    int               `json:"repeat"` // Number of passes through the levels
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// EscalationLevel is one step of an escalation policy
+type EscalationLevel struct {
+	UserIDs []int64  `json:"user_ids,omitempty"` // Users whose devices ring
+	Numbers []string `json:"numbers,omitempty"`  // External numbers called, E.164
+	SMS     bool     `json:"sms"`                // Text Numbers before calling them
+	Timeout int      `json:"timeout"`            // Seconds to ring before escalating
+}
+
+// EscalationStep is one entry in an escalated call's timeline
+type EscalationStep struct {
+	Action  string    `json:"action"` // "called", "texted", "unanswered", "acknowledged", "exhausted"
+	Round   int       `json:"round,omitempty"`
+	Level   int       `json:"level,omitempty"` // 1 is the first level
+	Targets []string  `json:"targets,omitempty"`
+	At      time.Time `json:"at"`
+}
+
 // CDR represents a Call Detail Record
 type CDR struct {
 	ID           int64          `json:"id"`
@@ -125,6 +360,25 @@ type CDR struct {
 	Disposition  string         `json:"disposition"` // "answered", "voicemail", "missed", "blocked", "busy", "failed"
 	RecordingURL sql.NullString `json:"recording_url,omitempty"`
 	SpamScore    *float64       `json:"spam_score,omitempty"`
+	// DiversionChain is a JSON array of the numbers a forwarded call passed
+	// through, original called number first
+	DiversionChain json.RawMessage `json:"diversion_chain,omitempty"`
+	// EscalationTimeline is a JSON array of the EscalationSteps an
+	// escalated call went through
+	EscalationTimeline json.RawMessage `json:"escalation_timeline,omitempty"`
+	// Internal marks device-to-device calls, which are not billed by Twilio
+	Internal bool `json:"internal"`
+	// Codec is the audio codec the device leg negotiated, e.g. "G722"
+	Codec string `json:"codec,omitempty"`
+	// AnsweredBy is the answering machine detection result for a forwarded
+	// call: "human", "machine_start", "fax" or "unknown"
+	AnsweredBy string `json:"answered_by,omitempty"`
+	// EstimatedCost is what an outbound call cost by the rate table, and
+	// ActualCost what Twilio charged once billing is synced
+	EstimatedCost *float64 `json:"estimated_cost,omitempty"`
+	ActualCost    *float64 `json:"actual_cost,omitempty"`
+	// TenantID is the tenant of the call's DID or device when it was made
+	TenantID *int64 `json:"tenant_id,omitempty"`
 }
 
 // Voicemail represents a voicemail message
@@ -137,9 +391,66 @@ type Voicemail struct {
 	Transcript string    `json:"transcript,omitempty"`
 	Duration   int       `json:"duration"` // seconds
 	IsRead     bool      `json:"is_read"`
+	SizeBytes  int64     `json:"size_bytes"` // Estimated from the duration
 	CreatedAt  time.Time `json:"created_at"`
 }
 
+// VoicemailQuota limits the storage of a voicemail box (keyed by DID)
+type VoicemailQuota struct {
+	DIDID       int64      `json:"did_id"`
+	MaxMessages int        `json:"max_messages"` // 0 is unlimited
+	MaxMB       int        `json:"max_mb"`       // 0 is unlimited
+	WarnPercent int        `json:"warn_percent"` // Usage that triggers a warning
+	Action      string     `json:"action"`       // At quota: "reject" or "delete_oldest"
+	WarnedAt    *time.Time `json:"warned_at,omitempty"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// VoicemailUsage is the storage a voicemail box uses
+type VoicemailUsage struct {
+	Messages int   `json:"messages"`
+	Bytes    int64 `json:"bytes"`
+}
+
+// VoicemailBoxMember is a user sharing a voicemail box (keyed by DID). A box
+// with members is shared, and each member keeps their own read state.
+type VoicemailBoxMember struct {
+	DIDID     int64     `json:"did_id"`
+	UserID    int64     `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// VoicemailAssignment hands a voicemail to a user for follow-up
+type VoicemailAssignment struct {
+	VoicemailID int64     `json:"voicemail_id"`
+	UserID      int64     `json:"user_id"`
+	AssignedBy  *int64    `json:"assigned_by,omitempty"`
+	AssignedAt  time.Time `json:"assigned_at"`
+}
+
+// VoicemailFeed is the private podcast feed of a voicemail box (keyed by DID)
+type VoicemailFeed struct {
+	DIDID         int64      `json:"did_id"`
+	Token         string     `json:"token"`
+	CreatedAt     time.Time  `json:"created_at"`
+	CreatedBy     *int64     `json:"created_by,omitempty"`
+	LastFetchedAt *time.Time `json:"last_fetched_at,omitempty"`
+}
+
+// VoicemailGreeting represents a recorded greeting for a voicemail box (keyed by DID)
+type VoicemailGreeting struct {
+	ID           int64      `json:"id"`
+	DIDID        int64      `json:"did_id"`
+	GreetingType string     `json:"greeting_type"` // "standard", "temporary"
+	AudioURL     string     `json:"audio_url"`
+	Duration     int        `json:"duration"` // seconds
+	IsActive     bool       `json:"is_active"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"` // temporary greetings only
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
 // Message represents an SMS/MMS message
 type Message struct {
 	ID          int64           `json:"id"`
@@ -153,6 +464,17 @@ type Message struct {
 	Status      string          `json:"status,omitempty"`
 	CreatedAt   time.Time       `json:"created_at"`
 	IsRead      bool            `json:"is_read"`
+	Channel     string          `json:"channel"` // "sms", "mms", "whatsapp", "sip-message", "internal"
+	// EstimatedCost is what an outbound message cost by the rate table, and
+	// ActualCost what Twilio charged once billing is synced
+	EstimatedCost *float64 `json:"estimated_cost,omitempty"`
+	ActualCost    *float64 `json:"actual_cost,omitempty"`
+	// ErrorCode is the Twilio error code of a message that failed to send
+	// or be delivered, and ErrorMessage what went wrong
+	ErrorCode    *int   `json:"error_code,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
+	// TenantID is the tenant of the message's DID when it was sent or received
+	TenantID *int64 `json:"tenant_id,omitempty"`
 }
 
 // AutoReply represents an automatic reply rule
@@ -204,7 +526,7 @@ type ProvisioningProfile struct {
 // DeviceEvent represents an operational event for a device
 type DeviceEvent struct {
 	ID        int64           `json:"id"`
-	DeviceID  int64           `json:"device_id"`
+	DeviceID  *int64          `json:"device_id"`  // Nil for discoveries not yet adopted
 	EventType string          `json:"event_type"` // "config_fetch", "registration", "provision_complete", etc.
 	EventData json.RawMessage `json:"event_data,omitempty"`
 	IPAddress *string         `json:"ip_address,omitempty"`
@@ -212,19 +534,181 @@ type DeviceEvent struct {
 	CreatedAt time.Time       `json:"created_at"`
 }
 
+// DeviceTelemetry is one health sample for a device
+type DeviceTelemetry struct {
+	ID                      int64     `json:"id"`
+	DeviceID                int64     `json:"device_id"`
+	Source                  string    `json:"source"`                              // "register", "ping" or "beacon"
+	RTTMs                   *int      `json:"rtt_ms,omitempty"`                    // Nil for a ping the phone didn't answer
+	RegisterIntervalSeconds *int      `json:"register_interval_seconds,omitempty"` // Time since the previous registration
+	Firmware                *string   `json:"firmware,omitempty"`
+	UptimeSeconds           *int64    `json:"uptime_seconds,omitempty"`
+	CreatedAt               time.Time `json:"created_at"`
+}
+
+// TrunkFailover is the disaster recovery configured for a Twilio trunk
+type TrunkFailover struct {
+	TrunkSID            string     `json:"trunk_sid"`
+	ForwardTo           *string    `json:"forward_to,omitempty"`    // Number calls are forwarded to when GoSIP is down
+	DisasterRecoveryURL string     `json:"disaster_recovery_url"`   // TwiML Twilio fetches when no origination URL answers
+	SecondaryURI        string     `json:"secondary_uri,omitempty"` // Origination URL tried after the primary
+	Intact              bool       `json:"intact"`                  // Whether Twilio matched at the last verification
+	Problems            []string   `json:"problems"`
+	VerifiedAt          *time.Time `json:"verified_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// SIPTrunk is a SIP provider other than Twilio that GoSIP registers with
+type SIPTrunk struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	Host         string    `json:"host"` // Registrar or proxy the requests are sent to
+	Port         int       `json:"port"`
+	Transport    string    `json:"transport"` // "udp", "tcp" or "tls"
+	Domain       string    `json:"domain"`    // Domain of the registered address; empty uses Host
+	Username     string    `json:"username"`
+	AuthUsername string    `json:"auth_username"` // Digest username when it differs from Username
+	Password     string    `json:"-"`
+	Expires      int       `json:"expires"`  // Registration lifetime asked for, in seconds
+	Register     bool      `json:"register"` // False for providers that authenticate by IP address
+	Enabled      bool      `json:"enabled"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// DIDWebhooks records that a DID's Twilio number was pointed at this
+// server's webhooks, and whether it still is
+type DIDWebhooks struct {
+	DIDID          int64      `json:"did_id"`
+	Number         string     `json:"number"`
+	PhoneNumberSID string     `json:"phone_number_sid"`
+	BaseURL        string     `json:"base_url"` // Public URL the webhooks were set under
+	Intact         bool       `json:"intact"`   // Whether Twilio matched at the last verification
+	Problems       []string   `json:"problems"`
+	VerifiedAt     *time.Time `json:"verified_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// NumberNote is a note kept about an external phone number
+type NumberNote struct {
+	ID        int64     `json:"id"`
+	Number    string    `json:"number"`
+	UserID    *int64    `json:"user_id,omitempty"` // Author, nil once the user is deleted
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NumberVariant is one spelling of an external number and how many records
+// use it
+type NumberVariant struct {
+	Number     string `json:"number"`
+	Calls      int    `json:"calls"`
+	Messages   int    `json:"messages"`
+	Voicemails int    `json:"voicemails"`
+	Notes      int    `json:"notes"`
+}
+
+// DuplicateNumber is a number recorded under several spellings that are the
+// same E.164 number
+type DuplicateNumber struct {
+	Number   string           `json:"number"` // E.164 form
+	Variants []*NumberVariant `json:"variants"`
+}
+
+// NumberMerge reports the records re-linked by merging spellings of a number
+type NumberMerge struct {
+	Number     string   `json:"number"` // Surviving spelling
+	Merged     []string `json:"merged"`
+	Calls      int      `json:"calls"`
+	Messages   int      `json:"messages"`
+	Voicemails int      `json:"voicemails"`
+	Notes      int      `json:"notes"`
+}
+
+// QueuedEmail is an outbound email waiting for delivery, sent, or given up
+// on after its last attempt
+type QueuedEmail struct {
+	ID            int64      `json:"id"`
+	Recipient     string     `json:"recipient"`
+	Subject       string     `json:"subject"`
+	Body          string     `json:"body"`
+	HTML          bool       `json:"html"`
+	Status        string     `json:"status"` // "pending", "sent", "dead"
+	Attempts      int        `json:"attempts"`
+	LastError     *string    `json:"last_error,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+// ComplianceExport is a signed, hash-chained JSONL export of the calls and
+// messages in a time range. Completed exports are never changed.
+type ComplianceExport struct {
+	ID           int64      `json:"id"`
+	Status       string     `json:"status"` // "pending", "complete", "failed"
+	RangeStart   time.Time  `json:"range_start"`
+	RangeEnd     time.Time  `json:"range_end"`
+	RequestedBy  *int64     `json:"requested_by,omitempty"`
+	FileName     string     `json:"file_name,omitempty"`
+	Calls        int        `json:"calls"`
+	Messages     int        `json:"messages"`
+	PreviousHash string     `json:"previous_hash,omitempty"` // Head hash of the export before this one
+	HeadHash     string     `json:"head_hash,omitempty"`     // Hash of the file's last line
+	FileSHA256   string     `json:"file_sha256,omitempty"`
+	Signature    string     `json:"signature,omitempty"` // Ed25519 signature of the head hash, base64
+	Error        *string    `json:"error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+}
+
+// Verification is a one-time code sent to a phone number by SMS or voice
+// call, for apps verifying that a user owns the number
+type Verification struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	DIDID     *int64    `json:"did_id,omitempty"`
+	ToNumber  string    `json:"to_number"`
+	Channel   string    `json:"channel"` // "sms", "call"
+	CodeHash  string    `json:"-"`
+	Status    string    `json:"status"` // "pending", "approved", "canceled", "failed"
+	Attempts  int       `json:"attempts"`
+	SID       string    `json:"sid,omitempty"` // Twilio message or call SID
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DiscoveredDevice represents an IP phone found on the LAN by the discovery scanner
+type DiscoveredDevice struct {
+	ID              int64     `json:"id"`
+	MACAddress      *string   `json:"mac_address,omitempty"`
+	IPAddress       string    `json:"ip_address"`
+	Vendor          *string   `json:"vendor,omitempty"`
+	Model           *string   `json:"model,omitempty"`
+	FirmwareVersion *string   `json:"firmware_version,omitempty"`
+	Source          string    `json:"source"` // "mdns", "ssdp"
+	Banner          *string   `json:"banner,omitempty"`
+	DeviceID        *int64    `json:"device_id,omitempty"` // Set once adopted
+	FirstSeen       time.Time `json:"first_seen"`
+	LastSeen        time.Time `json:"last_seen"`
+}
+
 // ProvisioningRequest represents a request to provision a device
 type ProvisioningRequest struct {
-	DeviceName   string `json:"device_name"`
-	Username     string `json:"username"`
-	Password     string `json:"password"`
-	DeviceType   string `json:"device_type"`
-	Vendor       string `json:"vendor"`
-	Model        string `json:"model,omitempty"`
-	MACAddress   string `json:"mac_address,omitempty"`
-	ProfileID    *int64 `json:"profile_id,omitempty"`
-	UserID       *int64 `json:"user_id,omitempty"`
-	GenerateURL  bool   `json:"generate_url"`
-	URLExpiresIn int    `json:"url_expires_in"` // seconds
+	DeviceName       string `json:"device_name"`
+	Username         string `json:"username"`
+	Password         string `json:"password"`
+	GeneratePassword bool   `json:"generate_password"` // Generate a password that meets the password policy
+	DeviceType       string `json:"device_type"`
+	Vendor           string `json:"vendor"`
+	Model            string `json:"model,omitempty"`
+	MACAddress       string `json:"mac_address,omitempty"`
+	ProfileID        *int64 `json:"profile_id,omitempty"`
+	UserID           *int64 `json:"user_id,omitempty"`
+	GenerateURL      bool   `json:"generate_url"`
+	URLExpiresIn     int    `json:"url_expires_in"` // seconds
 }
 
 // ProvisioningResponse represents the response from provisioning a device
@@ -236,4 +720,99 @@ type ProvisioningResponse struct {
 	SIPServer        string  `json:"sip_server"`
 	SIPPort          int     `json:"sip_port"`
 	ConfigInstructions string `json:"config_instructions,omitempty"`
+	GeneratedPassword  string `json:"generated_password,omitempty"` // Only set when the password was just generated
+}
+
+// Announcement is a banner shown to all web UI users, posted by an admin or
+// raised by a system health check
+type Announcement struct {
+	ID        int64      `json:"id"`
+	Level     string     `json:"level"` // "info", "warning"
+	Title     string     `json:"title,omitempty"`
+	Message   string     `json:"message"`
+	Source    string     `json:"source"`        // "admin", "system"
+	Key       *string    `json:"key,omitempty"` // Identifies the system check that raised it
+	StartsAt  *time.Time `json:"starts_at,omitempty"`
+	EndsAt    *time.Time `json:"ends_at,omitempty"`
+	CreatedBy *int64     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Rate is a rate table entry for numbers starting with Prefix
+type Rate struct {
+	ID          int64   `json:"id"`
+	Kind        string  `json:"kind"`   // "call" (per minute), "sms" (per segment) or "mms" (per message)
+	Prefix      string  `json:"prefix"` // Leading digits of E.164 numbers, without "+"
+	Rate        float64 `json:"rate"`
+	Description string  `json:"description,omitempty"`
+}
+
+// CostTotals sums the costs of outbound calls or messages
+type CostTotals struct {
+	Count         int     `json:"count"`
+	EstimatedCost float64 `json:"estimated_cost"`
+	ActualCost    float64 `json:"actual_cost"`
+	Unrated       int     `json:"unrated"`    // No rate matched
+	Reconciled    int     `json:"reconciled"` // Twilio's price is known
+}
+
+// Recording is a call recorded by GoSIP from the media it carries. The
+// audio is a stereo WAV file with the caller on the left channel.
+type Recording struct {
+	ID        int64      `json:"id"`
+	CallID    string     `json:"call_id"`
+	CDRID     *int64     `json:"cdr_id,omitempty"`
+	FileName  string     `json:"file_name"`
+	Status    string     `json:"status"`   // "recording", "completed", "failed"
+	Duration  int        `json:"duration"` // Seconds of audio, pauses excluded
+	SizeBytes int64      `json:"size_bytes"`
+	Checksum  string     `json:"checksum,omitempty"` // SHA-256 of the WAV file
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+}
+
+// ShortLink is a link in an outbound message replaced by a short link
+// GoSIP redirects from, counting the clicks
+type ShortLink struct {
+	ID            int64      `json:"id"`
+	Code          string     `json:"code"`
+	MessageID     *int64     `json:"message_id,omitempty"`
+	URL           string     `json:"url"` // The original link
+	Clicks        int        `json:"clicks"`
+	LastClickedAt *time.Time `json:"last_clicked_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Reminder is an appointment reminder texted or called to a contact ahead
+// of the appointment, which the contact can confirm or cancel
+type Reminder struct {
+	ID            int64      `json:"id"`
+	DIDID         int64      `json:"did_id"` // DID the reminder is sent from
+	ContactName   string     `json:"contact_name,omitempty"`
+	ToNumber      string     `json:"to_number"`
+	AppointmentAt time.Time  `json:"appointment_at"`
+	RemindAt      time.Time  `json:"remind_at"`
+	Template      string     `json:"template,omitempty"` // Message text with {name}, {date} and {time} placeholders
+	Channels      []string   `json:"channels"`           // "sms", "voice"
+	Status        string     `json:"status"`             // "scheduled", "sent", "confirmed", "cancelled", "failed"
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	RespondedAt   *time.Time `json:"responded_at,omitempty"`
+	CallSID       string     `json:"call_sid,omitempty"`
+	Error         *string    `json:"error,omitempty"`
+	UserID        *int64     `json:"user_id,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Tenant is a household or company hosted on the instance. Its users only
+// see its own devices, DIDs, routes, messages and call history.
+type Tenant struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// SIPDomain is the domain the tenant's devices register to; requests
+	// to it are only accepted from the tenant's devices
+	SIPDomain string    `json:"sip_domain,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -0,0 +1,285 @@
+package notifications
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/retry"
+)
+
+// SMTPStep is one step of a conversation with the SMTP relay
+type SMTPStep struct {
+	Step   string `json:"step"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"` // The relay's reply, or why the step failed
+}
+
+// SMTPTestResult reports each step of sending a test email
+type SMTPTestResult struct {
+	OK        bool       `json:"ok"`
+	Recipient string     `json:"recipient"`
+	Steps     []SMTPStep `json:"steps"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// SendEmail queues a plain text email and tries to send it right away. If
+// the relay can't be reached the email stays queued and is retried, so the
+// error only reports that SMTP isn't configured or the queue failed.
+func (n *Notifier) SendEmail(to, subject, body string) error {
+	return n.queueEmail(to, subject, body, false)
+}
+
+// SendHTMLEmail queues an HTML email and tries to send it right away
+func (n *Notifier) SendHTMLEmail(to, subject, htmlBody string) error {
+	return n.queueEmail(to, subject, htmlBody, true)
+}
+
+func (n *Notifier) queueEmail(to, subject, body string, html bool) error {
+	if n.cfg.SMTPHost == "" {
+		return fmt.Errorf("SMTP not configured")
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	// Held back from the queue worker for as long as the attempt below can take
+	held := now.Add(config.SMTPDialTimeout + config.SMTPSessionTimeout)
+	email := &models.QueuedEmail{Recipient: to, Subject: subject, Body: body, HTML: html, NextAttemptAt: &held, CreatedAt: now}
+	if err := n.database.EmailQueue.Enqueue(ctx, email); err != nil {
+		return fmt.Errorf("failed to queue email: %w", err)
+	}
+
+	n.attemptEmail(ctx, email, now)
+	return nil
+}
+
+// Start sends due emails now and then every EmailQueueInterval
+func (n *Notifier) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(config.EmailQueueInterval)
+		defer ticker.Stop()
+
+		for {
+			n.Run(ctx, time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Run retries the queued emails due at now and removes delivered ones past
+// their retention
+func (n *Notifier) Run(ctx context.Context, now time.Time) {
+	if n.cfg.SMTPHost == "" {
+		return
+	}
+
+	due, err := n.database.EmailQueue.ListDue(ctx, now, config.EmailQueueBatchSize)
+	if err != nil {
+		slog.Warn("Failed to list queued emails", "error", err)
+		return
+	}
+	for _, email := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		n.attemptEmail(ctx, email, now)
+	}
+
+	if removed, err := n.database.EmailQueue.DeleteSentBefore(ctx, now.Add(-config.EmailSentRetention)); err != nil {
+		slog.Warn("Failed to clean up sent emails", "error", err)
+	} else if removed > 0 {
+		slog.Debug("Removed sent emails", "count", removed)
+	}
+}
+
+// attemptEmail tries to deliver a queued email once and records the
+// outcome. Failures are retried with exponential backoff until the email
+// runs out of attempts and becomes a dead letter.
+func (n *Notifier) attemptEmail(ctx context.Context, email *models.QueuedEmail, now time.Time) {
+	err := n.smtpSession(email.Recipient, n.buildMessage(email), nil)
+	if err == nil {
+		retry.For(config.RetryWorkerEmail).Succeeded()
+		if err := n.database.EmailQueue.MarkSent(ctx, email.ID, time.Now()); err != nil {
+			slog.Error("Failed to mark email sent", "id", email.ID, "error", err)
+		}
+		return
+	}
+
+	attempts := email.Attempts + 1
+	worker := retry.For(config.RetryWorkerEmail)
+	var next *time.Time
+	if !worker.Exhausted(attempts) {
+		worker.Failed(err, true)
+		at := now.Add(emailRetryDelay(attempts))
+		next = &at
+		slog.Warn("Email delivery failed, will retry", "id", email.ID, "to", email.Recipient,
+			"attempt", attempts, "retry_at", at, "error", err)
+	} else {
+		worker.Failed(err, false)
+		slog.Error("Email delivery failed, moved to dead letters", "id", email.ID, "to", email.Recipient,
+			"subject", email.Subject, "attempts", attempts, "error", err)
+	}
+	if err := n.database.EmailQueue.MarkFailed(ctx, email.ID, err.Error(), next); err != nil {
+		slog.Error("Failed to record email delivery failure", "id", email.ID, "error", err)
+	}
+}
+
+// emailRetryDelay is the wait after a number of failed attempts, doubling
+// each time by default
+func emailRetryDelay(attempts int) time.Duration {
+	return retry.For(config.RetryWorkerEmail).Delay(attempts)
+}
+
+// buildMessage formats a queued email for the relay
+func (n *Notifier) buildMessage(email *models.QueuedEmail) string {
+	contentType := "text/plain"
+	if email.HTML {
+		contentType = "text/html"
+	}
+	return fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: %s; charset=UTF-8\r\n\r\n%s",
+		n.fromAddress(), email.Recipient, email.Subject, contentType, email.Body)
+}
+
+// fromAddress is the sender, the SMTP username when none is set
+func (n *Notifier) fromAddress() string {
+	if n.cfg.SMTPFrom != "" {
+		return n.cfg.SMTPFrom
+	}
+	return n.cfg.SMTPUser
+}
+
+// TestSMTP sends a test email and reports each step of the conversation
+// with the relay. It bypasses the queue so the result is immediate.
+func (n *Notifier) TestSMTP(to string) *SMTPTestResult {
+	result := &SMTPTestResult{Recipient: to, Steps: []SMTPStep{}}
+	if n.cfg.SMTPHost == "" {
+		result.Error = "SMTP not configured"
+		return result
+	}
+
+	email := &models.QueuedEmail{
+		Recipient: to,
+		Subject:   "GoSIP test email",
+		Body:      fmt.Sprintf("This is a test email from GoSIP, sent at %s.\r\n\r\nEmail notifications are working.", time.Now().Format("Jan 2, 2006 3:04 PM")),
+	}
+	if err := n.smtpSession(to, n.buildMessage(email), &result.Steps); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.OK = true
+	return result
+}
+
+// smtpSession delivers one message to the relay, recording each step in
+// steps when it isn't nil. Errors name the failed step and include the
+// relay's reply.
+func (n *Notifier) smtpSession(to, msg string, steps *[]SMTPStep) error {
+	step := func(name, detail string, err error) error {
+		if err != nil {
+			detail = smtpErrorDetail(err)
+		}
+		if steps != nil {
+			*steps = append(*steps, SMTPStep{Step: name, OK: err == nil, Detail: detail})
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, detail)
+		}
+		return nil
+	}
+
+	host := n.cfg.SMTPHost
+	addr := net.JoinHostPort(host, strconv.Itoa(n.cfg.SMTPPort))
+	dialer := &net.Dialer{Timeout: config.SMTPDialTimeout}
+
+	var conn net.Conn
+	var err error
+	if n.cfg.SMTPTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err := step("connect", "Connected to "+addr, err); err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(config.SMTPSessionTimeout))
+
+	client, err := smtp.NewClient(conn, host)
+	if err := step("greeting", "Relay is ready", err); err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := step("ehlo", "Relay accepted EHLO", client.Hello("localhost")); err != nil {
+		return err
+	}
+
+	if !n.cfg.SMTPTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := step("starttls", "Upgraded to TLS", client.StartTLS(&tls.Config{ServerName: host})); err != nil {
+				return err
+			}
+		}
+	}
+
+	if n.cfg.SMTPUser != "" {
+		auth := smtp.PlainAuth("", n.cfg.SMTPUser, n.cfg.SMTPPassword, host)
+		if err := step("auth", "Signed in as "+n.cfg.SMTPUser, client.Auth(auth)); err != nil {
+			return err
+		}
+	}
+
+	from := n.fromAddress()
+	if err := step("mail", "Sender "+from+" accepted", client.Mail(from)); err != nil {
+		return err
+	}
+	if err := step("rcpt", "Recipient "+to+" accepted", client.Rcpt(to)); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err == nil {
+		_, err = w.Write([]byte(msg))
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err := step("data", "Message accepted", err); err != nil {
+		return err
+	}
+
+	// The message is delivered once DATA is accepted, so a failed QUIT is
+	// only reported
+	detail := "Disconnected"
+	if err := client.Quit(); err != nil {
+		detail += ": " + smtpErrorDetail(err)
+	}
+	return step("quit", detail, nil)
+}
+
+// smtpErrorDetail describes an SMTP failure, with the relay's status code
+// when it replied
+func smtpErrorDetail(err error) string {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return fmt.Sprintf("Relay replied %d %s", protoErr.Code, protoErr.Msg)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "Timed out: " + err.Error()
+	}
+	return err.Error()
+}
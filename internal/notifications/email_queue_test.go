@@ -0,0 +1,235 @@
+package notifications
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+)
+
+// fakeSMTP is a minimal SMTP relay that records what it is sent
+type fakeSMTP struct {
+	listener   net.Listener
+	mu         sync.Mutex
+	rejectRcpt bool
+	from       []string
+	messages   []string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{listener: l}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) config() *config.Config {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return &config.Config{SMTPHost: "127.0.0.1", SMTPPort: addr.Port, SMTPUser: "gosip@example.com", SMTPPassword: "secret"}
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO":
+			tp.PrintfLine("250-fake")
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			tp.PrintfLine("235 2.7.0 Authenticated")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = append(s.from, line)
+			s.mu.Unlock()
+			tp.PrintfLine("250 2.1.0 OK")
+		case "RCPT":
+			s.mu.Lock()
+			reject := s.rejectRcpt
+			s.mu.Unlock()
+			if reject {
+				tp.PrintfLine("550 5.1.1 No such user")
+			} else {
+				tp.PrintfLine("250 2.1.5 OK")
+			}
+		case "DATA":
+			tp.PrintfLine("354 Go ahead")
+			body, err := bufio.NewReader(tp.DotReader()).ReadString(0)
+			if err != nil && body == "" {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, body)
+			s.mu.Unlock()
+			tp.PrintfLine("250 2.0.0 Queued")
+		case "QUIT":
+			tp.PrintfLine("221 2.0.0 Bye")
+			return
+		default:
+			tp.PrintfLine("502 5.5.2 Unknown command")
+		}
+	}
+}
+
+func (s *fakeSMTP) setRejectRcpt(reject bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejectRcpt = reject
+}
+
+func (s *fakeSMTP) sent() ([]string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.from...), append([]string(nil), s.messages...)
+}
+
+func TestNotifier_SendEmail_Delivered(t *testing.T) {
+	database := setupTestDB(t)
+	relay := newFakeSMTP(t)
+	notifier := NewNotifier(relay.config(), database)
+
+	if err := notifier.SendHTMLEmail("admin@example.com", "New Voicemail", "<p>Hello</p>"); err != nil {
+		t.Fatalf("SendHTMLEmail failed: %v", err)
+	}
+
+	from, messages := relay.sent()
+	if len(messages) != 1 || !strings.Contains(messages[0], "Content-Type: text/html") || !strings.Contains(messages[0], "<p>Hello</p>") {
+		t.Fatalf("Expected the HTML message at the relay, got %q", messages)
+	}
+	if len(from) != 1 || !strings.Contains(from[0], "<gosip@example.com>") {
+		t.Errorf("Expected the SMTP user as sender, got %q", from)
+	}
+
+	ctx := context.Background()
+	if count, _ := database.EmailQueue.CountByStatus(ctx, db.EmailSent); count != 1 {
+		t.Errorf("Expected the email recorded as sent, got %d", count)
+	}
+}
+
+func TestNotifier_SendEmail_RetriesThenDeadLetter(t *testing.T) {
+	database := setupTestDB(t)
+	relay := newFakeSMTP(t)
+	relay.setRejectRcpt(true)
+	notifier := NewNotifier(relay.config(), database)
+	ctx := context.Background()
+
+	if err := notifier.SendEmail("admin@example.com", "New Voicemail", "Hello"); err != nil {
+		t.Fatalf("A relay failure should leave the email queued, got %v", err)
+	}
+
+	pending, _ := database.EmailQueue.ListByStatus(ctx, db.EmailPending, 10, 0)
+	if len(pending) != 1 || pending[0].Attempts != 1 || pending[0].LastError == nil {
+		t.Fatalf("Expected a pending email after one failed attempt, got %+v", pending)
+	}
+	if !strings.Contains(*pending[0].LastError, "rcpt") || !strings.Contains(*pending[0].LastError, "550") {
+		t.Errorf("Expected the relay's reply in the error, got %q", *pending[0].LastError)
+	}
+
+	// Each attempt waits twice as long as the one before
+	at := time.Now()
+	for attempt := 1; attempt < config.EmailMaxAttempts; attempt++ {
+		at = at.Add(emailRetryDelay(attempt))
+		notifier.Run(ctx, at)
+	}
+	dead, _ := database.EmailQueue.ListByStatus(ctx, db.EmailDead, 10, 0)
+	if len(dead) != 1 || dead[0].Attempts != config.EmailMaxAttempts {
+		t.Fatalf("Expected a dead letter after %d attempts, got %+v", config.EmailMaxAttempts, dead)
+	}
+
+	// Retried dead letters go out once the relay recovers
+	relay.setRejectRcpt(false)
+	if err := database.EmailQueue.Retry(ctx, dead[0].ID, at); err != nil {
+		t.Fatal(err)
+	}
+	notifier.Run(ctx, at)
+	if count, _ := database.EmailQueue.CountByStatus(ctx, db.EmailSent); count != 1 {
+		t.Errorf("Expected the retried email sent, got %d", count)
+	}
+}
+
+func TestEmailRetryDelay(t *testing.T) {
+	var total time.Duration
+	for attempt := 1; attempt < config.EmailMaxAttempts; attempt++ {
+		total += emailRetryDelay(attempt)
+	}
+	if emailRetryDelay(1) != config.EmailRetryBackoff || emailRetryDelay(3) != 4*config.EmailRetryBackoff {
+		t.Errorf("Expected doubling delays, got %v and %v", emailRetryDelay(1), emailRetryDelay(3))
+	}
+	if total < 45*time.Minute || total > 90*time.Minute {
+		t.Errorf("Expected retries to span about an hour, got %v", total)
+	}
+}
+
+func TestNotifier_TestSMTP(t *testing.T) {
+	database := setupTestDB(t)
+	relay := newFakeSMTP(t)
+	notifier := NewNotifier(relay.config(), database)
+
+	result := notifier.TestSMTP("admin@example.com")
+	if !result.OK || result.Error != "" {
+		t.Fatalf("Expected a successful test, got %+v", result)
+	}
+	var steps []string
+	for _, s := range result.Steps {
+		steps = append(steps, s.Step)
+	}
+	if got := strings.Join(steps, ","); got != "connect,greeting,ehlo,auth,mail,rcpt,data,quit" {
+		t.Errorf("Steps = %s", got)
+	}
+
+	relay.setRejectRcpt(true)
+	result = notifier.TestSMTP("nobody@example.com")
+	if result.OK {
+		t.Fatal("Expected the test to fail when the relay rejects the recipient")
+	}
+	last := result.Steps[len(result.Steps)-1]
+	if last.Step != "rcpt" || last.OK || last.Detail != "Relay replied 550 5.1.1 No such user" {
+		t.Errorf("Expected the failed rcpt step with the relay's reply, got %+v", last)
+	}
+
+	if count, _ := database.EmailQueue.CountByStatus(context.Background(), db.EmailPending); count != 0 {
+		t.Errorf("Test emails shouldn't be queued, got %d", count)
+	}
+}
+
+func TestNotifier_TestSMTP_Unreachable(t *testing.T) {
+	database := setupTestDB(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	notifier := NewNotifier(&config.Config{SMTPHost: "127.0.0.1", SMTPPort: port}, database)
+	result := notifier.TestSMTP("admin@example.com")
+	if result.OK || len(result.Steps) != 1 || result.Steps[0].Step != "connect" || result.Steps[0].OK {
+		t.Errorf("Expected a failed connect step, got %+v", result)
+	}
+}
@@ -3,17 +3,20 @@ package notifications
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"log/slog"
 	"net/http"
-	"net/smtp"
+	"strings"
 	"time"
 
 	"github.com/btafoya/gosip/internal/config"
 	"github.com/btafoya/gosip/internal/db"
 	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/retry"
+	"github.com/btafoya/gosip/internal/rules"
+	"github.com/btafoya/gosip/pkg/sip"
 )
 
 // Notifier handles all notification types (email, push, webhooks)
@@ -87,12 +90,15 @@ Listen to this voicemail at: %s
 	}
 
 	// Send push notification
+	pushBody := fmt.Sprintf("From %s - %d seconds", voicemail.FromNumber, voicemail.Duration)
 	if n.cfg.GotifyURL != "" {
-		if err := n.SendPush(subject, fmt.Sprintf("From %s - %d seconds", voicemail.FromNumber, voicemail.Duration)); err != nil {
+		if err := n.SendPush(subject, pushBody); err != nil {
 			fmt.Printf("Failed to send push notification: %v\n", err)
 		}
 	}
 
+	n.notifyUsers(ctx, didTenant(did), voicemail.FromNumber, subject, body, pushBody)
+
 	return nil
 }
 
@@ -157,109 +163,232 @@ Message:
 
 	// Send push notification
 	if n.cfg.GotifyURL != "" {
-		pushBody := message.Body
-		if len(pushBody) > 100 {
-			pushBody = pushBody[:100] + "..."
-		}
+		pushBody := truncatePush(message.Body)
 		if err := n.SendPush(subject, pushBody); err != nil {
 			fmt.Printf("Failed to send push notification: %v\n", err)
 		}
 	}
 
+	n.notifyUsers(ctx, didTenant(did), remoteNumber, subject, body, truncatePush(message.Body))
+
 	return nil
 }
 
-// SendEmail sends an email notification
-func (n *Notifier) SendEmail(to, subject, body string) error {
-	if n.cfg.SMTPHost == "" {
-		return fmt.Errorf("SMTP not configured")
-	}
+// SendVoicemailQuotaWarning warns that a voicemail box is close to its quota
+func (n *Notifier) SendVoicemailQuotaWarning(did *models.DID, quota *models.VoicemailQuota, usage models.VoicemailUsage, percent int) error {
+	ctx := context.Background()
 
-	from := n.cfg.SMTPFrom
-	if from == "" {
-		from = n.cfg.SMTPUser
+	limits := ""
+	if quota.MaxMessages > 0 {
+		limits += fmt.Sprintf("Messages: %d of %d\n", usage.Messages, quota.MaxMessages)
 	}
-
-	// Build message
-	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
-		from, to, subject, body)
-
-	var auth smtp.Auth
-	if n.cfg.SMTPUser != "" {
-		auth = smtp.PlainAuth("", n.cfg.SMTPUser, n.cfg.SMTPPassword, n.cfg.SMTPHost)
+	if quota.MaxMB > 0 {
+		limits += fmt.Sprintf("Storage: %.1f of %d MB\n", float64(usage.Bytes)/(1<<20), quota.MaxMB)
+	}
+	atQuota := "new voicemails will be rejected"
+	if quota.Action == db.QuotaActionDeleteOldest {
+		atQuota = "the oldest voicemails will be deleted to make room"
 	}
 
-	addr := fmt.Sprintf("%s:%d", n.cfg.SMTPHost, n.cfg.SMTPPort)
+	subject := fmt.Sprintf("Voicemail box %s is %d%% full", did.Number, percent)
+	body := fmt.Sprintf(`
+The voicemail box for %s is %d%% full:
 
-	// Retry logic
-	var lastErr error
-	for attempt := 0; attempt < config.EmailMaxRetries; attempt++ {
-		var err error
-		if n.cfg.SMTPTLS {
-			err = n.sendEmailTLS(addr, auth, from, to, msg)
-		} else {
-			err = smtp.SendMail(addr, auth, from, []string{to}, []byte(msg))
-		}
+%s
+Once it is full, %s. Delete old voicemails to free up space.
+`, did.Number, percent, limits, atQuota)
 
-		if err == nil {
-			return nil
+	if n.cfg.SMTPHost != "" {
+		notificationEmail, _ := n.database.Config.Get(ctx, "notification_email")
+		if notificationEmail != "" {
+			if err := n.SendEmail(notificationEmail, subject, body); err != nil {
+				fmt.Printf("Failed to send email notification: %v\n", err)
+			}
 		}
-		lastErr = err
+	}
 
-		// Exponential backoff
-		time.Sleep(time.Duration(1<<uint(attempt)) * time.Second)
+	pushBody := fmt.Sprintf("Once it is full, %s", atQuota)
+	if n.cfg.GotifyURL != "" {
+		if err := n.SendPush(subject, pushBody); err != nil {
+			fmt.Printf("Failed to send push notification: %v\n", err)
+		}
 	}
 
-	return fmt.Errorf("failed after %d retries: %w", config.EmailMaxRetries, lastErr)
+	n.notifyUsers(ctx, did.TenantID, "", subject, body, pushBody)
+
+	return nil
 }
 
-func (n *Notifier) sendEmailTLS(addr string, auth smtp.Auth, from, to, msg string) error {
-	conn, err := tls.Dial("tcp", addr, &tls.Config{
-		ServerName: n.cfg.SMTPHost,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
+// SendLowDiskWarning warns that the data directory is low on free space
+// and new recordings are being refused
+func (n *Notifier) SendLowDiskWarning(path string, free, minFree uint64) error {
+	ctx := context.Background()
+
+	subject := "GoSIP is low on disk space"
+	body := fmt.Sprintf(`
+Only %.1f MB is free in %s, below the %.1f MB minimum.
+
+New voicemails and recordings are refused until space is freed. The
+storage page under System lists what uses the space and what can be
+cleaned up.
+`, float64(free)/(1<<20), path, float64(minFree)/(1<<20))
+
+	if n.cfg.SMTPHost != "" {
+		notificationEmail, _ := n.database.Config.Get(ctx, "notification_email")
+		if notificationEmail != "" {
+			if err := n.SendEmail(notificationEmail, subject, body); err != nil {
+				fmt.Printf("Failed to send email notification: %v\n", err)
+			}
+		}
 	}
-	defer conn.Close()
 
-	client, err := smtp.NewClient(conn, n.cfg.SMTPHost)
-	if err != nil {
-		return fmt.Errorf("failed to create SMTP client: %w", err)
+	if n.cfg.GotifyURL != "" {
+		pushBody := "New voicemails and recordings are refused until space is freed"
+		if err := n.SendPush(subject, pushBody); err != nil {
+			fmt.Printf("Failed to send push notification: %v\n", err)
+		}
 	}
-	defer client.Close()
 
-	if auth != nil {
-		if err := client.Auth(auth); err != nil {
-			return fmt.Errorf("authentication failed: %w", err)
+	return nil
+}
+
+// SendReminderDigest lists the upcoming appointments whose reminders
+// haven't been confirmed, with times in loc
+func (n *Notifier) SendReminderDigest(reminders []*models.Reminder, loc *time.Location) error {
+	ctx := context.Background()
+
+	subject := fmt.Sprintf("%d unconfirmed appointments", len(reminders))
+	if len(reminders) == 1 {
+		subject = "1 unconfirmed appointment"
+	}
+	var lines strings.Builder
+	for _, rem := range reminders {
+		contact := rem.ToNumber
+		if rem.ContactName != "" {
+			contact = rem.ContactName + " (" + rem.ToNumber + ")"
+		}
+		status := "reminder not sent yet"
+		switch rem.Status {
+		case db.ReminderSent:
+			status = "no reply"
+		case db.ReminderFailed:
+			status = "reminder failed"
 		}
+		fmt.Fprintf(&lines, "%s  %s, %s\n", rem.AppointmentAt.In(loc).Format("Mon Jan 2 3:04 PM"), contact, status)
 	}
+	body := fmt.Sprintf(`
+These appointments haven't been confirmed:
+
+%s
+Contacts confirm or cancel by replying to their reminder text or pressing
+a key during the reminder call.
+`, lines.String())
 
-	if err := client.Mail(from); err != nil {
-		return fmt.Errorf("MAIL command failed: %w", err)
+	if n.cfg.SMTPHost != "" {
+		notificationEmail, _ := n.database.Config.Get(ctx, "notification_email")
+		if notificationEmail != "" {
+			if err := n.SendEmail(notificationEmail, subject, body); err != nil {
+				fmt.Printf("Failed to send email notification: %v\n", err)
+			}
+		}
 	}
 
-	if err := client.Rcpt(to); err != nil {
-		return fmt.Errorf("RCPT command failed: %w", err)
+	if n.cfg.GotifyURL != "" {
+		if err := n.SendPush(subject, truncatePush(lines.String())); err != nil {
+			fmt.Printf("Failed to send push notification: %v\n", err)
+		}
 	}
 
-	w, err := client.Data()
+	return nil
+}
+
+// notifyUsers sends a notification to the personal channels of each user of
+// the tenant it concerns; tenantID is nil for the instance. During a user's
+// quiet hours it is held back unless the caller is on a VIP caller list and
+// the user lets VIPs break through.
+func (n *Notifier) notifyUsers(ctx context.Context, tenantID *int64, caller, subject, body, pushBody string) {
+	subscribers, err := n.database.NotificationSettings.ListSubscribed(ctx)
 	if err != nil {
-		return fmt.Errorf("DATA command failed: %w", err)
+		slog.Error("Failed to load notification settings", "error", err)
+		return
+	}
+	if len(subscribers) == 0 {
+		return
 	}
 
-	if _, err := w.Write([]byte(msg)); err != nil {
-		return fmt.Errorf("failed to write message: %w", err)
+	now := time.Now()
+	system := rules.LoadLocation(n.database.Config.GetWithDefault(ctx, "timezone", ""), time.Local)
+	vip, vipChecked := false, false
+
+	for _, settings := range subscribers {
+		user, err := n.database.Users.GetByID(ctx, settings.UserID)
+		if err != nil {
+			slog.Warn("Failed to load notification recipient", "error", err, "user_id", settings.UserID)
+			continue
+		}
+		if !sameTenant(user.TenantID, tenantID) {
+			continue
+		}
+
+		if InQuietHours(settings, now, system) {
+			if settings.VIPBreakthrough && !vipChecked {
+				vip, err = n.database.CallerLists.MatchesClass(ctx, caller, sip.RingClassVIP)
+				if err != nil {
+					slog.Warn("Failed to check VIP caller lists", "error", err)
+				}
+				vipChecked = true
+			}
+			if !settings.VIPBreakthrough || !vip {
+				slog.Debug("Notification held for quiet hours", "user_id", settings.UserID, "caller", caller)
+				continue
+			}
+		}
+
+		if settings.EmailEnabled && n.cfg.SMTPHost != "" {
+			if err := n.SendEmail(user.Email, subject, body); err != nil {
+				slog.Warn("Failed to send user email notification", "error", err, "user_id", settings.UserID)
+			}
+		}
+		if settings.PushToken != "" && n.cfg.GotifyURL != "" {
+			if err := n.sendPush(settings.PushToken, subject, pushBody); err != nil {
+				slog.Warn("Failed to send user push notification", "error", err, "user_id", settings.UserID)
+			}
+		}
 	}
+}
 
-	if err := w.Close(); err != nil {
-		return fmt.Errorf("failed to close writer: %w", err)
+// didTenant returns the tenant of a DID; nil for the instance or no DID
+func didTenant(did *models.DID) *int64 {
+	if did == nil {
+		return nil
 	}
+	return did.TenantID
+}
 
-	return client.Quit()
+// sameTenant reports whether two tenant IDs refer to the same tenant, nil
+// being the instance
+func sameTenant(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// truncatePush shortens a message body for a push notification
+func truncatePush(body string) string {
+	if len(body) > 100 {
+		return body[:100] + "..."
+	}
+	return body
 }
 
 // SendPush sends a push notification via Gotify
 func (n *Notifier) SendPush(title, message string) error {
+	return n.sendPush(n.cfg.GotifyToken, title, message)
+}
+
+// sendPush sends a push notification to the Gotify application of token
+func (n *Notifier) sendPush(token, title, message string) error {
 	if n.cfg.GotifyURL == "" {
 		return fmt.Errorf("Gotify not configured")
 	}
@@ -275,11 +404,9 @@ func (n *Notifier) SendPush(title, message string) error {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	url := fmt.Sprintf("%s/message?token=%s", n.cfg.GotifyURL, n.cfg.GotifyToken)
+	url := fmt.Sprintf("%s/message?token=%s", n.cfg.GotifyURL, token)
 
-	// Retry logic
-	var lastErr error
-	for attempt := 0; attempt < config.GotifyMaxRetries; attempt++ {
+	return retry.For(config.RetryWorkerGotify).Do(context.Background(), func() error {
 		req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
 		if err != nil {
 			return fmt.Errorf("failed to create request: %w", err)
@@ -288,21 +415,15 @@ func (n *Notifier) SendPush(title, message string) error {
 
 		resp, err := n.client.Do(req)
 		if err != nil {
-			lastErr = err
-			time.Sleep(time.Duration(1<<uint(attempt)) * time.Second)
-			continue
+			return err
 		}
 		resp.Body.Close()
 
-		if resp.StatusCode == http.StatusOK {
-			return nil
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 		}
-
-		lastErr = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-		time.Sleep(time.Duration(1<<uint(attempt)) * time.Second)
-	}
-
-	return fmt.Errorf("failed after %d retries: %w", config.GotifyMaxRetries, lastErr)
+		return nil
+	})
 }
 
 // SendWebhook sends a webhook notification
@@ -371,31 +492,3 @@ var voicemailHTMLTemplate = template.Must(template.New("voicemail").Parse(`
 </body>
 </html>
 `))
-
-// SendHTMLEmail sends an HTML email notification
-func (n *Notifier) SendHTMLEmail(to, subject, htmlBody string) error {
-	if n.cfg.SMTPHost == "" {
-		return fmt.Errorf("SMTP not configured")
-	}
-
-	from := n.cfg.SMTPFrom
-	if from == "" {
-		from = n.cfg.SMTPUser
-	}
-
-	// Build message with HTML content type
-	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n%s",
-		from, to, subject, htmlBody)
-
-	var auth smtp.Auth
-	if n.cfg.SMTPUser != "" {
-		auth = smtp.PlainAuth("", n.cfg.SMTPUser, n.cfg.SMTPPassword, n.cfg.SMTPHost)
-	}
-
-	addr := fmt.Sprintf("%s:%d", n.cfg.SMTPHost, n.cfg.SMTPPort)
-
-	if n.cfg.SMTPTLS {
-		return n.sendEmailTLS(addr, auth, from, to, msg)
-	}
-	return smtp.SendMail(addr, auth, from, []string{to}, []byte(msg))
-}
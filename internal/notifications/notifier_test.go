@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -443,23 +444,22 @@ func TestNotifier_SendWebhook_InvalidURL(t *testing.T) {
 
 func TestNotifier_SendEmail_FromAddress(t *testing.T) {
 	database := setupTestDB(t)
-	cfg := &config.Config{
-		SMTPHost:     "smtp.example.com",
-		SMTPPort:     587,
-		SMTPUser:     "user@example.com",
-		SMTPPassword: "password",
-		SMTPFrom:     "", // Empty, should fall back to SMTPUser
-	}
+	relay := newFakeSMTP(t)
+	cfg := relay.config()
+	cfg.SMTPFrom = "voicemail@example.com"
 
 	notifier := NewNotifier(cfg, database)
 
-	// This will fail because we can't actually connect to SMTP
-	// But we can at least verify the configuration is being used
-	err := notifier.SendEmail("test@example.com", "Test", "Body")
-	if err == nil {
-		t.Error("Expected error when SMTP server is unreachable")
+	if err := notifier.SendEmail("test@example.com", "Test", "Body"); err != nil {
+		t.Fatalf("SendEmail failed: %v", err)
+	}
+	from, messages := relay.sent()
+	if len(from) != 1 || !strings.Contains(from[0], "<voicemail@example.com>") {
+		t.Errorf("Expected the configured sender, got %q", from)
+	}
+	if len(messages) != 1 || !strings.Contains(messages[0], "From: voicemail@example.com") {
+		t.Errorf("Expected the sender in the From header, got %q", messages)
 	}
-	// The error should be connection-related, not configuration-related
 }
 
 func TestNotifier_ClientTimeout(t *testing.T) {
@@ -0,0 +1,58 @@
+package notifications
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// ParseClock parses a 24-hour "HH:MM" time into minutes after midnight
+func ParseClock(s string) (int, error) {
+	hourStr, minuteStr, ok := strings.Cut(s, ":")
+	if !ok || len(hourStr) != 2 || len(minuteStr) != 2 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	hour, err := strconv.Atoi(hourStr)
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("invalid hour %q", hourStr)
+	}
+	minute, err := strconv.Atoi(minuteStr)
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid minute %q", minuteStr)
+	}
+	return hour*60 + minute, nil
+}
+
+// InQuietHours reports whether t falls inside a user's quiet hours. The wall
+// clock is read in the user's timezone, falling back to loc, and a window
+// whose end is before its start runs overnight. Equal start and end times
+// never match.
+func InQuietHours(s *models.NotificationSettings, t time.Time, loc *time.Location) bool {
+	if !s.QuietHoursEnabled {
+		return false
+	}
+	start, err := ParseClock(s.QuietStart)
+	if err != nil {
+		return false
+	}
+	end, err := ParseClock(s.QuietEnd)
+	if err != nil {
+		return false
+	}
+
+	if s.Timezone != "" {
+		if userLoc, err := time.LoadLocation(s.Timezone); err == nil {
+			loc = userLoc
+		}
+	}
+	local := t.In(loc)
+	now := local.Hour()*60 + local.Minute()
+
+	if start <= end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
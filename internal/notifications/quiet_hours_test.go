@@ -0,0 +1,211 @@
+package notifications
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"00:00", 0, false},
+		{"07:30", 450, false},
+		{"23:59", 1439, false},
+		{"24:00", 0, true},
+		{"7:30", 0, true},
+		{"07:60", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseClock(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseClock(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseClock(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestInQuietHours(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	overnight := &models.NotificationSettings{QuietHoursEnabled: true, QuietStart: "22:00", QuietEnd: "07:00"}
+	daytime := &models.NotificationSettings{QuietHoursEnabled: true, QuietStart: "09:00", QuietEnd: "17:00"}
+	disabled := &models.NotificationSettings{QuietStart: "00:00", QuietEnd: "23:59"}
+	userZone := &models.NotificationSettings{QuietHoursEnabled: true, QuietStart: "22:00", QuietEnd: "07:00", Timezone: "America/New_York"}
+
+	tests := []struct {
+		name     string
+		settings *models.NotificationSettings
+		t        time.Time
+		want     bool
+	}{
+		{"overnight late", overnight, time.Date(2026, 1, 5, 23, 0, 0, 0, time.UTC), true},
+		{"overnight early", overnight, time.Date(2026, 1, 5, 6, 59, 0, 0, time.UTC), true},
+		{"overnight end", overnight, time.Date(2026, 1, 5, 7, 0, 0, 0, time.UTC), false},
+		{"overnight afternoon", overnight, time.Date(2026, 1, 5, 15, 0, 0, 0, time.UTC), false},
+		{"daytime inside", daytime, time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC), true},
+		{"daytime outside", daytime, time.Date(2026, 1, 5, 18, 0, 0, 0, time.UTC), false},
+		{"disabled", disabled, time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC), false},
+		// 03:00 UTC is 22:00 the previous evening in New York
+		{"user timezone", userZone, time.Date(2026, 1, 5, 3, 0, 0, 0, time.UTC), true},
+		{"user timezone outside", userZone, time.Date(2026, 1, 5, 1, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := InQuietHours(tt.settings, tt.t, time.UTC); got != tt.want {
+				t.Errorf("InQuietHours() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Without a user timezone the system zone applies
+	if !InQuietHours(overnight, time.Date(2026, 1, 5, 3, 0, 0, 0, time.UTC), newYork) {
+		t.Error("Expected system timezone to be used when the user has none")
+	}
+}
+
+func TestNotifier_NotifyUsers_QuietHours(t *testing.T) {
+	var mu sync.Mutex
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		tokens = append(tokens, r.URL.Query().Get("token"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	database := setupTestDB(t)
+	ctx := context.Background()
+	notifier := NewNotifier(&config.Config{GotifyURL: server.URL}, database)
+
+	if err := database.CallerLists.Create(ctx, &models.CallerList{Name: "Family", Numbers: []string{"+15550000001"}, AlertInfo: "vip"}); err != nil {
+		t.Fatalf("Failed to create caller list: %v", err)
+	}
+
+	// Quiet hours covering the current time, whatever it is
+	now := time.Now().UTC()
+	start := now.Add(-time.Hour).Format("15:04")
+	end := now.Add(time.Hour).Format("15:04")
+
+	for _, tc := range []struct {
+		token           string
+		quiet           bool
+		vipBreakthrough bool
+	}{
+		{"awake", false, true},
+		{"asleep-vip", true, true},
+		{"asleep", true, false},
+	} {
+		user := &models.User{Email: tc.token + "@example.com", PasswordHash: "x", Role: "user"}
+		if err := database.Users.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		settings := &models.NotificationSettings{
+			UserID:            user.ID,
+			PushToken:         tc.token,
+			QuietHoursEnabled: tc.quiet,
+			QuietStart:        start,
+			QuietEnd:          end,
+			Timezone:          "UTC",
+			VIPBreakthrough:   tc.vipBreakthrough,
+		}
+		if err := database.NotificationSettings.Save(ctx, settings); err != nil {
+			t.Fatalf("Failed to save settings: %v", err)
+		}
+	}
+
+	tests := []struct {
+		caller string
+		want   []string
+	}{
+		{"+15559999999", []string{"awake"}},
+		{"+15550000001", []string{"asleep-vip", "awake"}},
+	}
+
+	for _, tt := range tests {
+		tokens = nil
+		notifier.notifyUsers(ctx, nil, tt.caller, "New Voicemail", "body", "push")
+
+		sort.Strings(tokens)
+		if len(tokens) != len(tt.want) {
+			t.Errorf("Caller %s notified %v, want %v", tt.caller, tokens, tt.want)
+			continue
+		}
+		for i := range tokens {
+			if tokens[i] != tt.want[i] {
+				t.Errorf("Caller %s notified %v, want %v", tt.caller, tokens, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestNotifier_SendSMSNotification_Tenants(t *testing.T) {
+	var mu sync.Mutex
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if token := r.URL.Query().Get("token"); token != "" {
+			tokens = append(tokens, token)
+		}
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	database := setupTestDB(t)
+	ctx := context.Background()
+	notifier := NewNotifier(&config.Config{GotifyURL: server.URL}, database)
+
+	acme := &models.Tenant{Name: "Acme"}
+	globex := &models.Tenant{Name: "Globex"}
+	for _, tenant := range []*models.Tenant{acme, globex} {
+		if err := database.Tenants.Create(ctx, tenant); err != nil {
+			t.Fatalf("Failed to create tenant: %v", err)
+		}
+	}
+
+	// One subscribed user each for the instance and both tenants
+	for token, tenantID := range map[string]*int64{"instance": nil, "acme": &acme.ID, "globex": &globex.ID} {
+		user := &models.User{Email: token + "@example.com", PasswordHash: "x", Role: "user", TenantID: tenantID}
+		if err := database.Users.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		if err := database.NotificationSettings.Save(ctx, &models.NotificationSettings{UserID: user.ID, PushToken: token}); err != nil {
+			t.Fatalf("Failed to save settings: %v", err)
+		}
+	}
+
+	did := &models.DID{Number: "+15550001111", SMSEnabled: true, TenantID: &acme.ID}
+	if err := database.DIDs.Create(ctx, did); err != nil {
+		t.Fatalf("Failed to create DID: %v", err)
+	}
+
+	message := &models.Message{DIDID: &did.ID, FromNumber: "+15559876543", ToNumber: did.Number, Body: "Hi", Direction: "inbound", CreatedAt: time.Now()}
+	if err := notifier.SendSMSNotification(message); err != nil {
+		t.Fatalf("SendSMSNotification failed: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0] != "acme" {
+		t.Errorf("Expected only the Acme user notified, got %v", tokens)
+	}
+}
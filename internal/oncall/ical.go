@@ -0,0 +1,77 @@
+package oncall
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+const icalTime = "20060102T150405Z"
+
+// WriteICal writes shifts as an iCalendar object that calendar apps can
+// subscribe to. names maps user IDs to the names shown on the events.
+func WriteICal(w io.Writer, schedule *models.OnCallSchedule, shifts []Shift, names map[int64]string, now time.Time) error {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//GoSIP//On-call schedule//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + escapeText(schedule.Name),
+	}
+
+	for _, s := range shifts {
+		name := names[s.UserID]
+		if name == "" {
+			name = fmt.Sprintf("User %d", s.UserID)
+		}
+		summary := fmt.Sprintf("On call: %s (level %d)", name, s.Level)
+		if s.Override {
+			summary += " - override"
+		}
+
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:oncall-%d-%d-%d@gosip", schedule.ID, s.Level, s.Start.Unix()),
+			"DTSTAMP:"+now.UTC().Format(icalTime),
+			"DTSTART:"+s.Start.UTC().Format(icalTime),
+			"DTEND:"+s.End.UTC().Format(icalTime),
+			"SUMMARY:"+escapeText(summary),
+			"TRANSP:TRANSPARENT",
+			"END:VEVENT",
+		)
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, fold(line)+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapeText escapes an iCalendar TEXT value
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// fold splits a content line into lines of at most 75 octets, continued
+// with a leading space, without splitting UTF-8 characters
+func fold(line string) string {
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
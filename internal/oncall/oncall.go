@@ -0,0 +1,151 @@
+// Package oncall works out who is on call in an on-call schedule and
+// exports its rotation as an iCalendar feed
+package oncall
+
+import (
+	"sort"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// Shift is a period during which one user is on call at one level
+type Shift struct {
+	Level    int       `json:"level"` // 1 is the first level
+	UserID   int64     `json:"user_id"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Override bool      `json:"override"`
+}
+
+// Responder returns the user on call at a level of schedule at t. Overrides
+// take precedence over the rotation; the latest override wins when several
+// cover t. It returns false for unknown levels and levels without users.
+func Responder(schedule *models.OnCallSchedule, overrides []*models.OnCallOverride, level int, t time.Time, loc *time.Location) (int64, bool) {
+	if level < 1 || level > len(schedule.Levels) {
+		return 0, false
+	}
+
+	var override *models.OnCallOverride
+	for _, o := range overrides {
+		if o.Level == level && !t.Before(o.StartsAt) && t.Before(o.EndsAt) {
+			if override == nil || o.StartsAt.After(override.StartsAt) {
+				override = o
+			}
+		}
+	}
+	if override != nil {
+		return override.UserID, true
+	}
+
+	l := schedule.Levels[level-1]
+	if len(l.UserIDs) == 0 {
+		return 0, false
+	}
+	n, _, _ := shiftAt(l, t, loc)
+	return l.UserIDs[mod(n, len(l.UserIDs))], true
+}
+
+// Shifts returns the shifts at every level of schedule that overlap
+// [from, to), with overrides cut out of the rotation
+func Shifts(schedule *models.OnCallSchedule, overrides []*models.OnCallOverride, from, to time.Time, loc *time.Location) []Shift {
+	var shifts []Shift
+	for i, l := range schedule.Levels {
+		level := i + 1
+		if len(l.UserIDs) == 0 {
+			continue
+		}
+
+		var levelOverrides []*models.OnCallOverride
+		for _, o := range overrides {
+			if o.Level == level && o.StartsAt.Before(to) && o.EndsAt.After(from) {
+				levelOverrides = append(levelOverrides, o)
+				shifts = append(shifts, Shift{Level: level, UserID: o.UserID, Start: o.StartsAt, End: o.EndsAt, Override: true})
+			}
+		}
+
+		n, start, end := shiftAt(l, from, loc)
+		for start.Before(to) {
+			userID := l.UserIDs[mod(n, len(l.UserIDs))]
+			for _, part := range subtract(start, end, levelOverrides) {
+				if part[0].Before(to) && part[1].After(from) {
+					shifts = append(shifts, Shift{Level: level, UserID: userID, Start: part[0], End: part[1]})
+				}
+			}
+			n++
+			start, end = end, shiftStart(l, n+1, loc)
+		}
+	}
+
+	sort.Slice(shifts, func(i, j int) bool {
+		if !shifts[i].Start.Equal(shifts[j].Start) {
+			return shifts[i].Start.Before(shifts[j].Start)
+		}
+		return shifts[i].Level < shifts[j].Level
+	})
+	return shifts
+}
+
+// shiftAt returns the number of the rotation shift covering t and its
+// bounds. Shifts before the rotation start have negative numbers.
+func shiftAt(l models.OnCallLevel, t time.Time, loc *time.Location) (int, time.Time, time.Time) {
+	length := time.Duration(l.ShiftHours) * time.Hour
+	if length <= 0 {
+		length = 24 * time.Hour
+	}
+
+	// Estimate from elapsed time, then correct for daylight saving changes
+	// that move whole-day handoffs by an hour
+	n := int(t.Sub(l.RotationStart) / length)
+	if t.Before(l.RotationStart) {
+		n--
+	}
+	for shiftStart(l, n, loc).After(t) {
+		n--
+	}
+	for !shiftStart(l, n+1, loc).After(t) {
+		n++
+	}
+	return n, shiftStart(l, n, loc), shiftStart(l, n+1, loc)
+}
+
+// shiftStart returns when shift n of a rotation starts. Shifts of whole
+// days hand off at the same wall-clock time in loc across daylight saving
+// changes; other shifts have a fixed length.
+func shiftStart(l models.OnCallLevel, n int, loc *time.Location) time.Time {
+	hours := l.ShiftHours
+	if hours <= 0 {
+		hours = 24
+	}
+	if hours%24 == 0 {
+		return l.RotationStart.In(loc).AddDate(0, 0, n*hours/24)
+	}
+	return l.RotationStart.Add(time.Duration(n*hours) * time.Hour)
+}
+
+// subtract returns the parts of [start, end) not covered by overrides
+func subtract(start, end time.Time, overrides []*models.OnCallOverride) [][2]time.Time {
+	parts := [][2]time.Time{{start, end}}
+	for _, o := range overrides {
+		var next [][2]time.Time
+		for _, p := range parts {
+			if !o.StartsAt.Before(p[1]) || !o.EndsAt.After(p[0]) {
+				next = append(next, p)
+				continue
+			}
+			if o.StartsAt.After(p[0]) {
+				next = append(next, [2]time.Time{p[0], o.StartsAt})
+			}
+			if o.EndsAt.Before(p[1]) {
+				next = append(next, [2]time.Time{o.EndsAt, p[1]})
+			}
+		}
+		parts = next
+	}
+	return parts
+}
+
+// mod returns n modulo m, which is never negative
+func mod(n, m int) int {
+	return ((n % m) + m) % m
+}
@@ -0,0 +1,155 @@
+package oncall
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func testSchedule() *models.OnCallSchedule {
+	start := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC) // A Monday
+	return &models.OnCallSchedule{
+		ID:   1,
+		Name: "Ops",
+		Levels: []models.OnCallLevel{
+			{UserIDs: []int64{1, 2, 3}, RotationStart: start, ShiftHours: 24 * 7, Timeout: 30},
+			{UserIDs: []int64{4}, RotationStart: start, ShiftHours: 12, Timeout: 30},
+		},
+	}
+}
+
+func TestResponder_Rotation(t *testing.T) {
+	schedule := testSchedule()
+	start := schedule.Levels[0].RotationStart
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want int64
+	}{
+		{"first shift", start, 1},
+		{"end of first shift", start.Add(7*24*time.Hour - time.Second), 1},
+		{"second shift", start.Add(7 * 24 * time.Hour), 2},
+		{"wraps around", start.Add(21 * 24 * time.Hour), 1},
+		{"before rotation start", start.Add(-time.Hour), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Responder(schedule, nil, 1, tt.at, time.UTC)
+			if !ok || got != tt.want {
+				t.Errorf("Expected user %d, got %d (%v)", tt.want, got, ok)
+			}
+		})
+	}
+
+	if _, ok := Responder(schedule, nil, 3, start, time.UTC); ok {
+		t.Error("Expected no responder for unknown level")
+	}
+}
+
+func TestResponder_Override(t *testing.T) {
+	schedule := testSchedule()
+	start := schedule.Levels[0].RotationStart
+	overrides := []*models.OnCallOverride{
+		{Level: 1, UserID: 9, StartsAt: start.Add(time.Hour), EndsAt: start.Add(3 * time.Hour)},
+		{Level: 1, UserID: 8, StartsAt: start.Add(2 * time.Hour), EndsAt: start.Add(4 * time.Hour)},
+		{Level: 2, UserID: 7, StartsAt: start, EndsAt: start.Add(time.Hour)},
+	}
+
+	if got, _ := Responder(schedule, overrides, 1, start.Add(90*time.Minute), time.UTC); got != 9 {
+		t.Errorf("Expected override user 9, got %d", got)
+	}
+	if got, _ := Responder(schedule, overrides, 1, start.Add(150*time.Minute), time.UTC); got != 8 {
+		t.Errorf("Expected latest override user 8, got %d", got)
+	}
+	if got, _ := Responder(schedule, overrides, 1, start.Add(4*time.Hour), time.UTC); got != 1 {
+		t.Errorf("Expected rotation user 1 after overrides, got %d", got)
+	}
+}
+
+func TestResponder_DailyHandoffAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("timezone data unavailable")
+	}
+	schedule := &models.OnCallSchedule{Levels: []models.OnCallLevel{
+		{UserIDs: []int64{1, 2}, RotationStart: time.Date(2026, 3, 6, 9, 0, 0, 0, loc), ShiftHours: 24},
+	}}
+
+	// Clocks go forward on March 8; handoffs stay at 09:00 local time
+	// rather than moving to 10:00
+	if got, _ := Responder(schedule, nil, 1, time.Date(2026, 3, 9, 8, 30, 0, 0, loc), loc); got != 1 {
+		t.Errorf("Expected user 1 before the 09:00 handoff, got %d", got)
+	}
+	if got, _ := Responder(schedule, nil, 1, time.Date(2026, 3, 9, 9, 30, 0, 0, loc), loc); got != 2 {
+		t.Errorf("Expected user 2 after the 09:00 handoff, got %d", got)
+	}
+}
+
+func TestShifts(t *testing.T) {
+	schedule := testSchedule()
+	schedule.Levels = schedule.Levels[:1]
+	start := schedule.Levels[0].RotationStart
+	overrides := []*models.OnCallOverride{
+		{Level: 1, UserID: 9, StartsAt: start.Add(24 * time.Hour), EndsAt: start.Add(48 * time.Hour)},
+	}
+
+	shifts := Shifts(schedule, overrides, start, start.Add(14*24*time.Hour), time.UTC)
+
+	want := []Shift{
+		{Level: 1, UserID: 1, Start: start, End: start.Add(24 * time.Hour)},
+		{Level: 1, UserID: 9, Start: start.Add(24 * time.Hour), End: start.Add(48 * time.Hour), Override: true},
+		{Level: 1, UserID: 1, Start: start.Add(48 * time.Hour), End: start.Add(7 * 24 * time.Hour)},
+		{Level: 1, UserID: 2, Start: start.Add(7 * 24 * time.Hour), End: start.Add(14 * 24 * time.Hour)},
+	}
+	if len(shifts) != len(want) {
+		t.Fatalf("Expected %d shifts, got %+v", len(want), shifts)
+	}
+	for i := range want {
+		got := shifts[i]
+		if got.UserID != want[i].UserID || !got.Start.Equal(want[i].Start) || !got.End.Equal(want[i].End) || got.Override != want[i].Override {
+			t.Errorf("Shift %d: expected %+v, got %+v", i, want[i], got)
+		}
+	}
+}
+
+func TestWriteICal(t *testing.T) {
+	schedule := testSchedule()
+	schedule.Name = "Ops, nights"
+	start := schedule.Levels[0].RotationStart
+	shifts := []Shift{{Level: 1, UserID: 1, Start: start, End: start.Add(7 * 24 * time.Hour)}}
+
+	var buf bytes.Buffer
+	if err := WriteICal(&buf, schedule, shifts, map[int64]string{1: "alice@example.com"}, start); err != nil {
+		t.Fatalf("WriteICal failed: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-WR-CALNAME:Ops\\, nights\r\n",
+		"DTSTART:20260105T090000Z\r\n",
+		"DTEND:20260112T090000Z\r\n",
+		"SUMMARY:On call: alice@example.com (level 1)\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in feed:\n%s", want, out)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("é", 60)
+	for _, part := range strings.Split(fold(line), "\r\n") {
+		if len(part) > 75 {
+			t.Errorf("Expected folded lines of at most 75 octets, got %d", len(part))
+		}
+	}
+	if unfolded := strings.ReplaceAll(fold(line), "\r\n ", ""); unfolded != line {
+		t.Errorf("Expected folding to round-trip, got %q", unfolded)
+	}
+}
@@ -0,0 +1,70 @@
+package passwords
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/config"
+)
+
+// BreachChecker looks passwords up in the Have I Been Pwned password
+// database. Only the first 5 hex characters of the SHA-1 hash are sent
+// (k-anonymity), so the password never leaves the server.
+type BreachChecker struct {
+	client  *http.Client
+	baseURL string
+}
+
+// NewBreachChecker creates a BreachChecker for the public Pwned Passwords API
+func NewBreachChecker() *BreachChecker {
+	return &BreachChecker{
+		client:  &http.Client{Timeout: config.BreachCheckTimeout},
+		baseURL: config.BreachCheckURL,
+	}
+}
+
+// Breached returns how many times a password appears in known breaches
+func (c *BreachChecker) Breached(ctx context.Context, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+prefix, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "GoSIP")
+	// Padding hides the number of matches from observers of the response size
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("breach check returned HTTP %d", resp.StatusCode)
+	}
+
+	// Each line is "SUFFIX:COUNT"
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, 1<<20))
+	for scanner.Scan() {
+		lineSuffix, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(lineSuffix, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return 0, fmt.Errorf("invalid breach count %q", count)
+		}
+		return n, nil
+	}
+	return 0, scanner.Err()
+}
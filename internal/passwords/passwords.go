@@ -0,0 +1,222 @@
+// Package passwords enforces the password policy for web UI accounts and
+// generates SIP device passwords that satisfy it
+package passwords
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+)
+
+// Policy describes the passwords GoSIP accepts
+type Policy struct {
+	MinLength        int  `json:"min_length"`
+	MaxLength        int  `json:"max_length"`
+	RequireUppercase bool `json:"require_uppercase"`
+	RequireLowercase bool `json:"require_lowercase"`
+	RequireDigit     bool `json:"require_digit"`
+	RequireSymbol    bool `json:"require_symbol"`
+	BlockCommon      bool `json:"block_common"`
+	BreachCheck      bool `json:"breach_check"`
+}
+
+// Config keys of the policy settings
+const (
+	keyMinLength        = "password_min_length"
+	keyRequireUppercase = "password_require_uppercase"
+	keyRequireLowercase = "password_require_lowercase"
+	keyRequireDigit     = "password_require_digit"
+	keyRequireSymbol    = "password_require_symbol"
+	keyBlockCommon      = "password_block_common"
+	keyBreachCheck      = "password_breach_check"
+)
+
+// Messages returned for policy violations. They are also keys of the API
+// message translations.
+const (
+	MsgTooLong          = "Password must be at most 72 characters"
+	MsgRequireUppercase = "Password must contain an uppercase letter"
+	MsgRequireLowercase = "Password must contain a lowercase letter"
+	MsgRequireDigit     = "Password must contain a number"
+	MsgRequireSymbol    = "Password must contain a symbol"
+	MsgCommon           = "Password is too common"
+	MsgBreached         = "Password has appeared in a data breach"
+)
+
+//go:embed common.txt
+var commonList string
+
+// common holds the embedded common passwords, lowercased
+var common = func() map[string]struct{} {
+	set := make(map[string]struct{})
+	scanner := bufio.NewScanner(strings.NewReader(commonList))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			set[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return set
+}()
+
+// DefaultPolicy returns the policy used until an admin changes it
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:   config.DefaultPasswordMinLength,
+		MaxLength:   config.PasswordMaxLength,
+		BlockCommon: true,
+	}
+}
+
+// LoadPolicy reads the policy from the system settings
+func LoadPolicy(ctx context.Context, database *db.DB) Policy {
+	p := DefaultPolicy()
+	if n, err := strconv.Atoi(database.Config.GetWithDefault(ctx, keyMinLength, "")); err == nil {
+		p.MinLength = n
+	}
+	flag := func(key string, def bool) bool {
+		return database.Config.GetWithDefault(ctx, key, strconv.FormatBool(def)) == "true"
+	}
+	p.RequireUppercase = flag(keyRequireUppercase, p.RequireUppercase)
+	p.RequireLowercase = flag(keyRequireLowercase, p.RequireLowercase)
+	p.RequireDigit = flag(keyRequireDigit, p.RequireDigit)
+	p.RequireSymbol = flag(keyRequireSymbol, p.RequireSymbol)
+	p.BlockCommon = flag(keyBlockCommon, p.BlockCommon)
+	p.BreachCheck = flag(keyBreachCheck, p.BreachCheck)
+	return p
+}
+
+// SavePolicy stores the policy in the system settings
+func SavePolicy(ctx context.Context, database *db.DB, p Policy) error {
+	settings := map[string]string{
+		keyMinLength:        strconv.Itoa(p.MinLength),
+		keyRequireUppercase: strconv.FormatBool(p.RequireUppercase),
+		keyRequireLowercase: strconv.FormatBool(p.RequireLowercase),
+		keyRequireDigit:     strconv.FormatBool(p.RequireDigit),
+		keyRequireSymbol:    strconv.FormatBool(p.RequireSymbol),
+		keyBlockCommon:      strconv.FormatBool(p.BlockCommon),
+		keyBreachCheck:      strconv.FormatBool(p.BreachCheck),
+	}
+	for key, value := range settings {
+		if err := database.Config.Set(ctx, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MinLengthMessage returns the violation message for passwords shorter than n
+func MinLengthMessage(n int) string {
+	return fmt.Sprintf("Password must be at least %d characters", n)
+}
+
+// Check returns the rules a password breaks, without the breach check
+func (p Policy) Check(password string) []string {
+	var violations []string
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, MinLengthMessage(p.MinLength))
+	}
+	// bcrypt only hashes the first 72 bytes
+	if len(password) > config.PasswordMaxLength {
+		violations = append(violations, MsgTooLong)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c) || c == ' ':
+			symbol = true
+		}
+	}
+	if p.RequireUppercase && !upper {
+		violations = append(violations, MsgRequireUppercase)
+	}
+	if p.RequireLowercase && !lower {
+		violations = append(violations, MsgRequireLowercase)
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, MsgRequireDigit)
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, MsgRequireSymbol)
+	}
+	if p.BlockCommon && IsCommon(password) {
+		violations = append(violations, MsgCommon)
+	}
+	return violations
+}
+
+// IsCommon reports whether a password is on the embedded list of commonly
+// used passwords, ignoring case
+func IsCommon(password string) bool {
+	_, ok := common[strings.ToLower(password)]
+	return ok
+}
+
+// Character sets for generated passwords. Look-alike characters are left
+// out so the password can be typed into a phone's keypad menus.
+const (
+	upperChars  = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	lowerChars  = "abcdefghijkmnopqrstuvwxyz"
+	digitChars  = "23456789"
+	symbolChars = "-_.!@#%+="
+)
+
+// Generate returns a random password of at least length characters that
+// satisfies the policy. Every character class is used, so it also passes
+// policies an admin tightens later.
+func (p Policy) Generate(length int) (string, error) {
+	if length < p.MinLength {
+		length = p.MinLength
+	}
+	sets := []string{upperChars, lowerChars, digitChars, symbolChars}
+	if length < len(sets) {
+		length = len(sets)
+	}
+	all := strings.Join(sets, "")
+
+	chars := make([]byte, length)
+	for i := range chars {
+		set := all
+		if i < len(sets) {
+			set = sets[i]
+		}
+		c, err := randomChar(set)
+		if err != nil {
+			return "", err
+		}
+		chars[i] = c
+	}
+
+	// Shuffle so the guaranteed classes aren't always first
+	for i := len(chars) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		chars[i], chars[j.Int64()] = chars[j.Int64()], chars[i]
+	}
+	return string(chars), nil
+}
+
+func randomChar(set string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(set))))
+	if err != nil {
+		return 0, err
+	}
+	return set[n.Int64()], nil
+}
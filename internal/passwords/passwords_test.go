@@ -0,0 +1,88 @@
+package passwords
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	policy := Policy{MinLength: 10, RequireUppercase: true, RequireDigit: true, RequireSymbol: true, BlockCommon: true}
+
+	tests := []struct {
+		password string
+		want     []string
+	}{
+		{"Violet-Harbor-42", nil},
+		{"violet-harbor-42", []string{MsgRequireUppercase}},
+		{"Short-1", []string{MinLengthMessage(10)}},
+		{"VioletHarbor", []string{MsgRequireDigit, MsgRequireSymbol}},
+		{"Password123", []string{MsgRequireSymbol, MsgCommon}},
+		{strings.Repeat("Ab1-", 19), []string{MsgTooLong}},
+	}
+	for _, tt := range tests {
+		got := policy.Check(tt.password)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("Check(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestIsCommon(t *testing.T) {
+	if !IsCommon("Password123") {
+		t.Error("Expected Password123 to be common, ignoring case")
+	}
+	if IsCommon("violet-harbor-42") {
+		t.Error("Expected violet-harbor-42 not to be common")
+	}
+}
+
+func TestPolicy_Generate(t *testing.T) {
+	policy := Policy{MinLength: 24, RequireUppercase: true, RequireLowercase: true, RequireDigit: true, RequireSymbol: true, BlockCommon: true}
+
+	password, err := policy.Generate(16)
+	if err != nil {
+		t.Fatalf("Failed to generate password: %v", err)
+	}
+	if len(password) != 24 {
+		t.Errorf("Expected the policy minimum of 24 characters, got %d", len(password))
+	}
+	if violations := policy.Check(password); len(violations) > 0 {
+		t.Errorf("Generated password %q breaks the policy: %v", password, violations)
+	}
+
+	other, _ := policy.Generate(16)
+	if other == password {
+		t.Error("Expected generated passwords to differ")
+	}
+}
+
+func TestBreachChecker_Breached(t *testing.T) {
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		fmt.Fprint(w, "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\r\n")
+	}))
+	defer server.Close()
+
+	checker := &BreachChecker{client: server.Client(), baseURL: server.URL + "/range/"}
+
+	count, err := checker.Breached(context.Background(), "password")
+	if err != nil {
+		t.Fatalf("Breach check failed: %v", err)
+	}
+	if gotPath != "/range/5BAA6" {
+		t.Errorf("Expected only the hash prefix to be sent, got path %s", gotPath)
+	}
+	if count != 3861493 {
+		t.Errorf("Expected 3861493 breaches, got %d", count)
+	}
+
+	if count, _ := checker.Breached(context.Background(), "violet-harbor-42"); count != 0 {
+		t.Errorf("Expected no breaches, got %d", count)
+	}
+}
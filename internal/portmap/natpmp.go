@@ -0,0 +1,154 @@
+package portmap
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// natpmpPort is the UDP port routers answer NAT-PMP requests on (RFC 6886)
+const natpmpPort = 5351
+
+// natpmpResults explains NAT-PMP result codes
+var natpmpResults = map[uint16]string{
+	1: "unsupported version",
+	2: "not authorized (port mapping is disabled on the router)",
+	3: "network failure",
+	4: "out of resources",
+	5: "unsupported opcode",
+}
+
+// natPMP requests forwards with NAT-PMP
+type natPMP struct {
+	addr string // host:port of the router
+}
+
+func (n *natPMP) Method() string  { return MethodNATPMP }
+func (n *natPMP) Address() string { return n.addr }
+
+// ExternalIP asks the router for its public address
+func (n *natPMP) ExternalIP(ctx context.Context) (string, error) {
+	resp, err := n.request(ctx, []byte{0, 0}, 12)
+	if err != nil {
+		return "", err
+	}
+	return net.IP(resp[8:12]).String(), nil
+}
+
+// AddMapping forwards externalPort on the router to internalPort here.
+// The router may grant a different external port and lease.
+func (n *natPMP) AddMapping(ctx context.Context, protocol string, internalPort, externalPort int, lease time.Duration, description string) (int, time.Duration, error) {
+	req := make([]byte, 12)
+	req[1] = natpmpOpcode(protocol)
+	binary.BigEndian.PutUint16(req[4:6], uint16(internalPort))
+	binary.BigEndian.PutUint16(req[6:8], uint16(externalPort))
+	binary.BigEndian.PutUint32(req[8:12], uint32(lease/time.Second))
+
+	resp, err := n.request(ctx, req, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	granted := int(binary.BigEndian.Uint16(resp[10:12]))
+	lifetime := time.Duration(binary.BigEndian.Uint32(resp[12:16])) * time.Second
+	return granted, lifetime, nil
+}
+
+// DeleteMapping removes a forward by requesting it with no lifetime
+func (n *natPMP) DeleteMapping(ctx context.Context, protocol string, internalPort, externalPort int) error {
+	req := make([]byte, 12)
+	req[1] = natpmpOpcode(protocol)
+	binary.BigEndian.PutUint16(req[4:6], uint16(internalPort))
+	_, err := n.request(ctx, req, 16)
+	return err
+}
+
+func natpmpOpcode(protocol string) byte {
+	if protocol == ProtocolTCP {
+		return 2
+	}
+	return 1
+}
+
+// request sends a NAT-PMP request, resending it with the doubling delays of
+// RFC 6886 section 3.1 until the router answers or ctx is done
+func (n *natPMP) request(ctx context.Context, req []byte, size int) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp4", n.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	resp := make([]byte, 16)
+	for wait := 250 * time.Millisecond; ; wait *= 2 {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+
+		deadline := time.Now().Add(wait)
+		if limit, ok := ctx.Deadline(); ok && limit.Before(deadline) {
+			deadline = limit
+		}
+		conn.SetReadDeadline(deadline)
+
+		for {
+			count, err := conn.Read(resp)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			// Ignore stray packets, such as address change announcements
+			if count < size || resp[0] != 0 || resp[1] != req[1]+128 {
+				continue
+			}
+			if code := binary.BigEndian.Uint16(resp[2:4]); code != 0 {
+				if reason, ok := natpmpResults[code]; ok {
+					return nil, fmt.Errorf("router refused the request: %s", reason)
+				}
+				return nil, fmt.Errorf("router refused the request: result code %d", code)
+			}
+			return resp[:size], nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("no NAT-PMP response from %s", n.addr)
+		}
+	}
+}
+
+// defaultGateway reads the IPv4 default gateway from a Linux routing table
+// such as /proc/net/route
+func defaultGateway(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("can't find the router, set GOSIP_PORTMAP_GATEWAY: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		b, err := hex.DecodeString(fields[2])
+		if err != nil || len(b) != 4 {
+			continue
+		}
+		// The table is in host byte order, little-endian on x86 and ARM
+		return net.IPv4(b[3], b[2], b[1], b[0]).String(), nil
+	}
+	return "", errors.New("no default route, set GOSIP_PORTMAP_GATEWAY")
+}
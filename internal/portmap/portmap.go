@@ -0,0 +1,332 @@
+// Package portmap asks the home router to forward the SIP and RTP ports to
+// GoSIP with NAT-PMP or UPnP, renewing the forwards before they expire
+package portmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+)
+
+// Forwarding methods
+const (
+	MethodNATPMP = "natpmp"
+	MethodUPnP   = "upnp"
+)
+
+// Protocols
+const (
+	ProtocolUDP = "udp"
+	ProtocolTCP = "tcp"
+)
+
+// gateway requests forwards from a router
+type gateway interface {
+	Method() string
+	Address() string
+	ExternalIP(ctx context.Context) (string, error)
+	// AddMapping returns the external port and lease the router granted.
+	// A lease of 0 means the forward doesn't expire.
+	AddMapping(ctx context.Context, protocol string, internalPort, externalPort int, lease time.Duration, description string) (int, time.Duration, error)
+	DeleteMapping(ctx context.Context, protocol string, internalPort, externalPort int) error
+}
+
+// Port is a port GoSIP listens on that should be reachable from the internet
+type Port struct {
+	Protocol    string `json:"protocol"`
+	Port        int    `json:"port"`
+	Description string `json:"description"`
+}
+
+// Mapping is the state of one forward on the router
+type Mapping struct {
+	Port
+	ExternalPort int        `json:"external_port,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"` // Empty for forwards that don't expire
+	Error        string     `json:"error,omitempty"`
+}
+
+// Status reports the forwards and the router that holds them
+type Status struct {
+	Mode        string     `json:"mode"`
+	Method      string     `json:"method,omitempty"`
+	Gateway     string     `json:"gateway,omitempty"`
+	ExternalIP  string     `json:"external_ip,omitempty"`
+	Mappings    []Mapping  `json:"mappings"`
+	RefreshedAt *time.Time `json:"refreshed_at,omitempty"`
+	NextRefresh *time.Time `json:"next_refresh,omitempty"`
+	Error       string     `json:"error,omitempty"` // Why the router couldn't be used
+}
+
+// Ports lists the ports to forward for a configuration: SIP over UDP and
+// TCP unless unencrypted SIP is disabled, SIPS when TLS is on, and the
+// configured RTP range
+func Ports(cfg *config.Config) []Port {
+	var ports []Port
+	if cfg.TLS == nil || !cfg.TLS.Enabled || !cfg.TLS.DisableUnencrypted {
+		ports = append(ports,
+			Port{ProtocolUDP, cfg.SIPPort, "GoSIP SIP"},
+			Port{ProtocolTCP, cfg.SIPPort, "GoSIP SIP"},
+		)
+	}
+	if cfg.TLS != nil && cfg.TLS.Enabled {
+		ports = append(ports, Port{ProtocolTCP, cfg.TLS.Port, "GoSIP SIPS"})
+	}
+	if cfg.PortMap != nil {
+		if low, high, err := cfg.PortMap.RTPRange(); err == nil && low > 0 {
+			for p := low; p <= high; p++ {
+				ports = append(ports, Port{ProtocolUDP, p, "GoSIP RTP"})
+			}
+		}
+	}
+	return ports
+}
+
+// Mapper keeps the router forwarding GoSIP's ports
+type Mapper struct {
+	cfg   *config.PortMapConfig
+	ports []Port
+
+	// discover finds the router, replaced in tests
+	discover func(ctx context.Context) (gateway, error)
+	// routeTable is read to find the NAT-PMP router (default: /proc/net/route)
+	routeTable string
+
+	// runMu serializes refreshes so scheduled and manual ones don't interleave
+	runMu sync.Mutex
+	gw    gateway
+
+	mu     sync.RWMutex
+	status Status
+}
+
+// NewMapper creates a Mapper for the ports of cfg
+func NewMapper(cfg *config.Config) *Mapper {
+	pm := cfg.PortMap
+	if pm == nil {
+		pm = &config.PortMapConfig{Mode: config.PortMapOff}
+	}
+	m := &Mapper{
+		cfg:        pm,
+		ports:      Ports(cfg),
+		routeTable: "/proc/net/route",
+		status:     Status{Mode: pm.Mode, Mappings: []Mapping{}},
+	}
+	m.discover = m.discoverGateway
+	return m
+}
+
+// Enabled reports whether port mapping is turned on
+func (m *Mapper) Enabled() bool {
+	return m.cfg.Mode != config.PortMapOff && m.cfg.Mode != ""
+}
+
+// Start requests the forwards now and renews them at half their lease.
+// Failures are retried every PortMapRetryInterval.
+func (m *Mapper) Start(ctx context.Context) {
+	if !m.Enabled() {
+		return
+	}
+
+	go func() {
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+
+			status, err := m.Refresh(ctx)
+			if err != nil {
+				slog.Warn("Router port mapping failed", "error", err)
+			}
+			wait := config.PortMapRetryInterval
+			if status.NextRefresh != nil {
+				wait = time.Until(*status.NextRefresh)
+			}
+			timer.Reset(wait)
+		}
+	}()
+}
+
+// Status returns the forwards and the outcome of the last refresh
+func (m *Mapper) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	status := m.status
+	status.Mappings = append([]Mapping{}, m.status.Mappings...)
+	return status
+}
+
+// Refresh requests every forward from the router, finding the router first
+// if needed. It fails only when no router could be used; forwards the
+// router refused are reported in the status.
+func (m *Mapper) Refresh(ctx context.Context) (Status, error) {
+	if !m.Enabled() {
+		return m.Status(), errors.New("port mapping is off, set GOSIP_PORTMAP")
+	}
+
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	now := time.Now()
+	retry := now.Add(config.PortMapRetryInterval)
+
+	if m.gw == nil {
+		ctx, cancel := context.WithTimeout(ctx, config.PortMapTimeout)
+		gw, err := m.discover(ctx)
+		cancel()
+		if err != nil {
+			m.setStatus(func(s *Status) {
+				s.Method, s.Gateway, s.Error = "", "", err.Error()
+				s.RefreshedAt, s.NextRefresh = &now, &retry
+			})
+			return m.Status(), err
+		}
+		m.gw = gw
+		slog.Info("Found router for port mapping", "method", gw.Method(), "gateway", gw.Address())
+	}
+
+	mappings := make([]Mapping, len(m.ports))
+	var shortest time.Duration
+	failed := 0
+	for i, p := range m.ports {
+		mappings[i] = Mapping{Port: p}
+		ctx, cancel := context.WithTimeout(ctx, config.PortMapTimeout)
+		external, lease, err := m.gw.AddMapping(ctx, p.Protocol, p.Port, p.Port, config.PortMapLease, p.Description)
+		cancel()
+		if err != nil {
+			mappings[i].Error = err.Error()
+			failed++
+			continue
+		}
+		mappings[i].ExternalPort = external
+		if external != p.Port {
+			mappings[i].Error = fmt.Sprintf("the router forwards port %d instead", external)
+		}
+		if lease > 0 {
+			expires := now.Add(lease)
+			mappings[i].ExpiresAt = &expires
+			if shortest == 0 || lease < shortest {
+				shortest = lease
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.PortMapTimeout)
+	externalIP, _ := m.gw.ExternalIP(ctx)
+	cancel()
+
+	next := retry
+	if failed < len(m.ports) && shortest > 0 {
+		next = now.Add(shortest / 2)
+	} else if failed < len(m.ports) {
+		next = now.Add(config.PortMapLease / 2) // Permanent forwards: check they're still there
+	}
+
+	var err error
+	if failed > 0 && failed == len(m.ports) {
+		err = fmt.Errorf("the router refused every forward: %s", mappings[0].Error)
+		// The router may have changed, so look for it again next time
+		m.gw = nil
+	}
+
+	gw := m.gw
+	m.setStatus(func(s *Status) {
+		s.Method, s.Gateway, s.Error = "", "", ""
+		if gw != nil {
+			s.Method, s.Gateway = gw.Method(), gw.Address()
+		}
+		if err != nil {
+			s.Error = err.Error()
+		}
+		s.ExternalIP = externalIP
+		s.Mappings = mappings
+		s.RefreshedAt, s.NextRefresh = &now, &next
+	})
+	if failed > 0 && err == nil {
+		slog.Warn("Router refused some port forwards", "failed", failed, "total", len(m.ports))
+	}
+	return m.Status(), err
+}
+
+// Close removes the forwards from the router
+func (m *Mapper) Close() {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+	if m.gw == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.PortMapTimeout)
+	defer cancel()
+	for _, mapping := range m.Status().Mappings {
+		if mapping.ExternalPort == 0 {
+			continue
+		}
+		if err := m.gw.DeleteMapping(ctx, mapping.Protocol, mapping.Port.Port, mapping.ExternalPort); err != nil {
+			slog.Warn("Failed to remove router port forward", "protocol", mapping.Protocol, "port", mapping.ExternalPort, "error", err)
+		}
+	}
+	m.gw = nil
+}
+
+func (m *Mapper) setStatus(update func(*Status)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	update(&m.status)
+}
+
+// discoverGateway tries NAT-PMP, which answers quickly, before UPnP
+func (m *Mapper) discoverGateway(ctx context.Context) (gateway, error) {
+	var errs []error
+	if m.cfg.Mode == config.PortMapAuto || m.cfg.Mode == config.PortMapNATPMP {
+		gw, err := m.natPMPGateway(ctx)
+		if err == nil {
+			return gw, nil
+		}
+		errs = append(errs, fmt.Errorf("NAT-PMP: %w", err))
+	}
+	if m.cfg.Mode == config.PortMapAuto || m.cfg.Mode == config.PortMapUPnP {
+		gw, err := discoverUPnP(ctx, &http.Client{Timeout: config.PortMapTimeout})
+		if err == nil {
+			return gw, nil
+		}
+		errs = append(errs, fmt.Errorf("UPnP: %w", err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// natPMPGateway finds the router and checks it speaks NAT-PMP by asking
+// for its public address
+func (m *Mapper) natPMPGateway(ctx context.Context) (gateway, error) {
+	host := m.cfg.Gateway
+	if host == "" {
+		var err error
+		if host, err = defaultGateway(m.routeTable); err != nil {
+			return nil, err
+		}
+	}
+
+	gw := &natPMP{addr: net.JoinHostPort(host, fmt.Sprint(natpmpPort))}
+	// In auto mode, leave time for UPnP discovery
+	if m.cfg.Mode == config.PortMapAuto {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+	}
+	if _, err := gw.ExternalIP(ctx); err != nil {
+		return nil, err
+	}
+	return gw, nil
+}
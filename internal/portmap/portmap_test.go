@@ -0,0 +1,289 @@
+package portmap
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+)
+
+// fakeGateway grants forwards and records them
+type fakeGateway struct {
+	mu      sync.Mutex
+	lease   time.Duration
+	refuse  map[int]bool
+	added   []string
+	deleted []string
+}
+
+func (g *fakeGateway) Method() string  { return MethodNATPMP }
+func (g *fakeGateway) Address() string { return "192.168.1.1:5351" }
+
+func (g *fakeGateway) ExternalIP(ctx context.Context) (string, error) {
+	return "203.0.113.10", nil
+}
+
+func (g *fakeGateway) AddMapping(ctx context.Context, protocol string, internalPort, externalPort int, lease time.Duration, description string) (int, time.Duration, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.refuse[internalPort] {
+		return 0, 0, errors.New("port in use")
+	}
+	g.added = append(g.added, protocol+":"+description)
+	return externalPort, g.lease, nil
+}
+
+func (g *fakeGateway) DeleteMapping(ctx context.Context, protocol string, internalPort, externalPort int) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.deleted = append(g.deleted, protocol)
+	return nil
+}
+
+func TestPorts(t *testing.T) {
+	cfg := &config.Config{
+		SIPPort: 5060,
+		TLS:     &config.TLSConfig{Enabled: true, Port: 5061, DisableUnencrypted: true},
+		PortMap: &config.PortMapConfig{Mode: config.PortMapAuto, RTPPorts: "10000-10003"},
+	}
+	ports := Ports(cfg)
+	if len(ports) != 5 || ports[0] != (Port{ProtocolTCP, 5061, "GoSIP SIPS"}) || ports[4].Port != 10003 {
+		t.Errorf("Expected SIPS and four RTP ports, got %+v", ports)
+	}
+
+	ports = Ports(&config.Config{SIPPort: 5060})
+	if len(ports) != 2 || ports[0].Protocol != ProtocolUDP || ports[1].Protocol != ProtocolTCP {
+		t.Errorf("Expected SIP over UDP and TCP, got %+v", ports)
+	}
+}
+
+func TestMapper_Refresh(t *testing.T) {
+	m := NewMapper(&config.Config{SIPPort: 5060, PortMap: &config.PortMapConfig{Mode: config.PortMapAuto}})
+	gw := &fakeGateway{lease: time.Hour, refuse: map[int]bool{}}
+	discoveries := 0
+	m.discover = func(ctx context.Context) (gateway, error) {
+		discoveries++
+		return gw, nil
+	}
+
+	before := time.Now()
+	status, err := m.Refresh(context.Background())
+	if err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if status.Method != MethodNATPMP || status.ExternalIP != "203.0.113.10" || len(status.Mappings) != 2 {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+	for _, mapping := range status.Mappings {
+		if mapping.ExternalPort != 5060 || mapping.ExpiresAt == nil || mapping.Error != "" {
+			t.Errorf("Expected a leased forward, got %+v", mapping)
+		}
+	}
+	// Renewed at half the lease
+	if status.NextRefresh == nil || status.NextRefresh.Before(before.Add(29*time.Minute)) || status.NextRefresh.After(time.Now().Add(31*time.Minute)) {
+		t.Errorf("Expected renewal in 30 minutes, got %v", status.NextRefresh)
+	}
+
+	// Every forward refused: look for the router again next time
+	gw.refuse[5060] = true
+	status, err = m.Refresh(context.Background())
+	if err == nil || !strings.Contains(status.Error, "port in use") || status.Mappings[0].Error == "" {
+		t.Fatalf("Expected refused forwards reported, got %v %+v", err, status)
+	}
+	gw.refuse[5060] = false
+	if _, err := m.Refresh(context.Background()); err != nil || discoveries != 2 {
+		t.Errorf("Expected the router found again, got %v after %d discoveries", err, discoveries)
+	}
+
+	m.Close()
+	if len(gw.deleted) != 2 {
+		t.Errorf("Expected both forwards removed, got %v", gw.deleted)
+	}
+}
+
+func TestMapper_Off(t *testing.T) {
+	m := NewMapper(&config.Config{SIPPort: 5060, PortMap: &config.PortMapConfig{Mode: config.PortMapOff}})
+	if m.Enabled() {
+		t.Error("Expected port mapping off")
+	}
+	if _, err := m.Refresh(context.Background()); err == nil {
+		t.Error("Expected refresh to fail while off")
+	}
+}
+
+// natpmpServer answers NAT-PMP requests like a router
+func natpmpServer(t *testing.T, resultCode uint16) (string, func() [][]byte) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var mu sync.Mutex
+	var requests [][]byte
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := append([]byte(nil), buf[:n]...)
+			mu.Lock()
+			requests = append(requests, req)
+			mu.Unlock()
+
+			resp := make([]byte, 16)
+			resp[1] = req[1] + 128
+			binary.BigEndian.PutUint16(resp[2:4], resultCode)
+			if req[1] == 0 {
+				copy(resp[8:12], net.IPv4(203, 0, 113, 10).To4())
+				conn.WriteTo(resp[:12], from)
+				continue
+			}
+			copy(resp[8:10], req[4:6])
+			binary.BigEndian.PutUint16(resp[10:12], 40000)
+			copy(resp[12:16], req[8:12])
+			conn.WriteTo(resp, from)
+		}
+	}()
+	return conn.LocalAddr().String(), func() [][]byte {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestNATPMP(t *testing.T) {
+	addr, requests := natpmpServer(t, 0)
+	gw := &natPMP{addr: addr}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	ip, err := gw.ExternalIP(ctx)
+	if err != nil || ip != "203.0.113.10" {
+		t.Fatalf("ExternalIP() = %q, %v", ip, err)
+	}
+
+	external, lease, err := gw.AddMapping(ctx, ProtocolTCP, 5061, 5061, time.Hour, "GoSIP SIPS")
+	if err != nil {
+		t.Fatalf("AddMapping failed: %v", err)
+	}
+	if external != 40000 || lease != time.Hour {
+		t.Errorf("Expected the granted port and lease, got %d %v", external, lease)
+	}
+	req := requests()[1]
+	if req[1] != 2 || binary.BigEndian.Uint16(req[4:6]) != 5061 || binary.BigEndian.Uint32(req[8:12]) != 3600 {
+		t.Errorf("Unexpected mapping request % x", req)
+	}
+
+	addr, _ = natpmpServer(t, 2)
+	if _, _, err := (&natPMP{addr: addr}).AddMapping(ctx, ProtocolUDP, 5060, 5060, time.Hour, ""); err == nil || !strings.Contains(err.Error(), "not authorized") {
+		t.Errorf("Expected the refusal explained, got %v", err)
+	}
+}
+
+func TestDefaultGateway(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "route")
+	table := "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\n" +
+		"eth0\t0001A8C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\n" +
+		"eth0\t00000000\t0101A8C0\t0003\t0\t0\t0\t00000000\n"
+	os.WriteFile(path, []byte(table), 0o644)
+
+	gw, err := defaultGateway(path)
+	if err != nil || gw != "192.168.1.1" {
+		t.Errorf("defaultGateway() = %q, %v; want 192.168.1.1", gw, err)
+	}
+	if _, err := defaultGateway(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected an error without a routing table")
+	}
+}
+
+const igdDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL>/ctl/IPConn</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`
+
+func TestUPnP(t *testing.T) {
+	var actions []string
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			io.WriteString(w, igdDescription)
+			return
+		}
+		action := r.Header.Get("SOAPAction")
+		body, _ := io.ReadAll(r.Body)
+		actions = append(actions, action)
+		bodies = append(bodies, string(body))
+
+		switch {
+		case strings.HasSuffix(action, `#GetExternalIPAddress"`):
+			io.WriteString(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1"><NewExternalIPAddress>203.0.113.10</NewExternalIPAddress></u:GetExternalIPAddressResponse></s:Body></s:Envelope>`)
+		case strings.Contains(string(body), "<NewLeaseDuration>3600</NewLeaseDuration>"):
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>725</errorCode><errorDescription>OnlyPermanentLeasesSupported</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`)
+		default:
+			io.WriteString(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:AddPortMappingResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1"/></s:Body></s:Envelope>`)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	gw, err := newUPnP(ctx, server.Client(), server.URL+"/rootDesc.xml")
+	if err != nil {
+		t.Fatalf("newUPnP failed: %v", err)
+	}
+	if gw.controlURL != server.URL+"/ctl/IPConn" || gw.localIP != "127.0.0.1" {
+		t.Errorf("Expected the nested WANIPConnection service, got %+v", gw)
+	}
+
+	if ip, err := gw.ExternalIP(ctx); err != nil || ip != "203.0.113.10" {
+		t.Errorf("ExternalIP() = %q, %v", ip, err)
+	}
+
+	// The router only keeps permanent forwards
+	external, lease, err := gw.AddMapping(ctx, ProtocolUDP, 5060, 5060, time.Hour, "GoSIP <SIP>")
+	if err != nil {
+		t.Fatalf("AddMapping failed: %v", err)
+	}
+	if external != 5060 || lease != 0 || len(actions) != 3 {
+		t.Errorf("Expected a permanent forward after one retry, got %d %v (%d calls)", external, lease, len(actions))
+	}
+	if actions[1] != `"urn:schemas-upnp-org:service:WANIPConnection:1#AddPortMapping"` {
+		t.Errorf("Unexpected SOAPAction %s", actions[1])
+	}
+	for _, want := range []string{"<NewProtocol>UDP</NewProtocol>", "<NewInternalClient>127.0.0.1</NewInternalClient>", "GoSIP &lt;SIP&gt;", "<NewLeaseDuration>0</NewLeaseDuration>"} {
+		if !strings.Contains(bodies[2], want) {
+			t.Errorf("Expected %s in the request, got %s", want, bodies[2])
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package portmap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ssdpAddr = "239.255.255.250:1900"
+
+// igdServices are the UPnP services that manage port forwards, in order of preference
+var igdServices = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+// upnpOnlyPermanentLeases is the error routers return when they can't
+// expire forwards (UPnP IGD WANIPConnection section 2.4.16)
+const upnpOnlyPermanentLeases = 725
+
+// upnp requests forwards from an Internet Gateway Device
+type upnp struct {
+	client      *http.Client
+	controlURL  string
+	serviceType string
+	localIP     string // Address of this server on the router's network
+}
+
+func (u *upnp) Method() string  { return MethodUPnP }
+func (u *upnp) Address() string { return u.controlURL }
+
+// discoverUPnP finds an Internet Gateway Device with an SSDP M-SEARCH
+func discoverUPnP(ctx context.Context, client *http.Client) (*upnp, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	addr, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range []string{"urn:schemas-upnp-org:device:InternetGatewayDevice:2", "urn:schemas-upnp-org:device:InternetGatewayDevice:1"} {
+		search := "M-SEARCH * HTTP/1.1\r\n" +
+			"HOST: " + ssdpAddr + "\r\n" +
+			"MAN: \"ssdp:discover\"\r\n" +
+			"MX: 2\r\n" +
+			"ST: " + st + "\r\n\r\n"
+		if _, err := conn.WriteTo([]byte(search), addr); err != nil {
+			return nil, err
+		}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+	}
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return nil, errors.New("no UPnP router answered")
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if location := resp.Header.Get("Location"); location != "" {
+			if gw, err := newUPnP(ctx, client, location); err == nil {
+				return gw, nil
+			}
+		}
+	}
+}
+
+// upnpDevice is the part of a UPnP device description that lists services,
+// including those of embedded devices
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// newUPnP reads a gateway's device description to find its port forwarding service
+func newUPnP(ctx context.Context, client *http.Client, location string) (*upnp, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var desc struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 256*1024)).Decode(&desc); err != nil {
+		return nil, fmt.Errorf("invalid device description: %w", err)
+	}
+
+	base, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	if desc.URLBase != "" {
+		if b, err := url.Parse(desc.URLBase); err == nil {
+			base = b
+		}
+	}
+
+	for _, serviceType := range igdServices {
+		controlURL := findService(desc.Device, serviceType)
+		if controlURL == "" {
+			continue
+		}
+		ref, err := url.Parse(controlURL)
+		if err != nil {
+			return nil, err
+		}
+		control := base.ResolveReference(ref)
+
+		// The router forwards to the address we reach it from
+		conn, err := net.Dial("udp4", control.Host)
+		if err != nil {
+			return nil, err
+		}
+		localIP := conn.LocalAddr().(*net.UDPAddr).IP.String()
+		conn.Close()
+
+		return &upnp{client: client, controlURL: control.String(), serviceType: serviceType, localIP: localIP}, nil
+	}
+	return nil, errors.New("the router has no port forwarding service")
+}
+
+func findService(d upnpDevice, serviceType string) string {
+	for _, s := range d.Services {
+		if s.ServiceType == serviceType {
+			return s.ControlURL
+		}
+	}
+	for _, child := range d.Devices {
+		if u := findService(child, serviceType); u != "" {
+			return u
+		}
+	}
+	return ""
+}
+
+// ExternalIP asks the router for its public address
+func (u *upnp) ExternalIP(ctx context.Context) (string, error) {
+	resp, err := u.call(ctx, "GetExternalIPAddress", nil)
+	if err != nil {
+		return "", err
+	}
+	return resp["NewExternalIPAddress"], nil
+}
+
+// AddMapping forwards externalPort on the router to internalPort here.
+// Routers that only keep permanent forwards get one without a lease.
+func (u *upnp) AddMapping(ctx context.Context, protocol string, internalPort, externalPort int, lease time.Duration, description string) (int, time.Duration, error) {
+	args := func(lease time.Duration) [][2]string {
+		return [][2]string{
+			{"NewRemoteHost", ""},
+			{"NewExternalPort", strconv.Itoa(externalPort)},
+			{"NewProtocol", strings.ToUpper(protocol)},
+			{"NewInternalPort", strconv.Itoa(internalPort)},
+			{"NewInternalClient", u.localIP},
+			{"NewEnabled", "1"},
+			{"NewPortMappingDescription", description},
+			{"NewLeaseDuration", strconv.Itoa(int(lease / time.Second))},
+		}
+	}
+
+	_, err := u.call(ctx, "AddPortMapping", args(lease))
+	var upnpErr *upnpError
+	if errors.As(err, &upnpErr) && upnpErr.Code == upnpOnlyPermanentLeases {
+		lease = 0
+		_, err = u.call(ctx, "AddPortMapping", args(lease))
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return externalPort, lease, nil
+}
+
+// DeleteMapping removes a forward
+func (u *upnp) DeleteMapping(ctx context.Context, protocol string, internalPort, externalPort int) error {
+	_, err := u.call(ctx, "DeletePortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(externalPort)},
+		{"NewProtocol", strings.ToUpper(protocol)},
+	})
+	return err
+}
+
+// upnpError is a fault returned by a UPnP action
+type upnpError struct {
+	Code        int
+	Description string
+}
+
+func (e *upnpError) Error() string {
+	return fmt.Sprintf("router refused the request: %s (UPnP error %d)", e.Description, e.Code)
+}
+
+// call invokes a SOAP action and returns the response arguments
+func (u *upnp) call(ctx context.Context, action string, args [][2]string) (map[string]string, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:` + action + ` xmlns:u="` + u.serviceType + `">`)
+	for _, arg := range args {
+		body.WriteString("<" + arg[0] + ">")
+		xml.EscapeText(&body, []byte(arg[1]))
+		body.WriteString("</" + arg[0] + ">")
+	}
+	body.WriteString(`</u:` + action + `></s:Body></s:Envelope>`)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.controlURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+u.serviceType+"#"+action+`"`)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	values, err := soapValues(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s response (%s): %w", action, resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		code, _ := strconv.Atoi(values["errorCode"])
+		if code == 0 {
+			return nil, fmt.Errorf("%s failed: %s", action, resp.Status)
+		}
+		return nil, &upnpError{Code: code, Description: values["errorDescription"]}
+	}
+	return values, nil
+}
+
+// soapValues collects the text of every leaf element in a SOAP envelope,
+// which covers both action responses and UPnP faults
+func soapValues(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+	dec := xml.NewDecoder(r)
+	var name string
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name = t.Name.Local
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if t.Name.Local == name {
+				values[name] = strings.TrimSpace(text.String())
+			}
+			name = ""
+		}
+	}
+}
@@ -0,0 +1,360 @@
+// Package publicurl resolves the public base URL that provisioning links,
+// feed links, QR codes and Twilio webhooks are built from, and checks that
+// it reaches this server
+package publicurl
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/announcements"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+)
+
+// SettingKey is the database setting holding the public base URL
+const SettingKey = "public_base_url"
+
+// Check outcomes
+const (
+	CheckPass = "pass"
+	CheckFail = "fail"
+	CheckSkip = "skip" // Not applicable, or an earlier check failed
+)
+
+// Check is the outcome of one check of the public base URL
+type Check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"` // How to fix a failure
+}
+
+// Report is the outcome of the last check of the public base URL
+type Report struct {
+	URL        string     `json:"url"`
+	OK         bool       `json:"ok"`
+	Checks     []Check    `json:"checks"`
+	Mismatches []string   `json:"mismatches"` // Places still using another URL
+	CheckedAt  *time.Time `json:"checked_at,omitempty"`
+}
+
+// Get returns the public base URL without a trailing slash: the
+// public_base_url setting, then GOSIP_PUBLIC_URL. It is empty when neither
+// is set.
+func Get(ctx context.Context, cfg *config.Config, database *db.DB) string {
+	if value := database.Config.GetWithDefault(ctx, SettingKey, ""); value != "" {
+		return strings.TrimRight(value, "/")
+	}
+	if cfg != nil {
+		return cfg.PublicURL
+	}
+	return ""
+}
+
+// Parse checks that a public base URL is an absolute http or https URL
+// without a query or fragment. A path is allowed for servers behind a
+// reverse proxy under a prefix.
+func Parse(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an http or https URL", raw)
+	}
+	if u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return nil, fmt.Errorf("%q can't have credentials, a query or a fragment", raw)
+	}
+	return u, nil
+}
+
+// Monitor checks the public base URL every PublicURLCheckInterval and
+// raises an announcement while it has problems
+type Monitor struct {
+	cfg      *config.Config
+	database *db.DB
+	hub      *events.Hub
+	client   *http.Client
+
+	// Replaced in tests
+	lookup  func(ctx context.Context, host string) ([]net.IPAddr, error)
+	rootCAs *x509.CertPool
+
+	// checkMu serializes checks so scheduled and manual checks don't interleave
+	checkMu sync.Mutex
+
+	mu         sync.RWMutex
+	report     *Report
+	webhookURL string // Last webhook Twilio signed for a URL outside the public base URL
+}
+
+// NewMonitor creates a Monitor
+func NewMonitor(cfg *config.Config, database *db.DB, hub *events.Hub) *Monitor {
+	return &Monitor{
+		cfg:      cfg,
+		database: database,
+		hub:      hub,
+		client:   &http.Client{Timeout: config.PublicURLCheckTimeout},
+		lookup:   net.DefaultResolver.LookupIPAddr,
+	}
+}
+
+// Start checks the public base URL now and then every
+// PublicURLCheckInterval
+func (m *Monitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(config.PublicURLCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			m.Check(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Report returns the last check, nil before the first
+func (m *Monitor) Report() *Report {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.report
+}
+
+// Check validates the current public base URL, looks for places still
+// using another one and records the outcome
+func (m *Monitor) Check(ctx context.Context) *Report {
+	m.checkMu.Lock()
+	defer m.checkMu.Unlock()
+
+	base := Get(ctx, m.cfg, m.database)
+	now := time.Now()
+	report := &Report{URL: base, OK: true, Checks: []Check{}, Mismatches: []string{}, CheckedAt: &now}
+	if base != "" {
+		report.Checks = m.Validate(ctx, base)
+		report.Mismatches = m.mismatches(ctx, base)
+	}
+	for _, check := range report.Checks {
+		if check.Status == CheckFail {
+			report.OK = false
+		}
+	}
+
+	m.mu.Lock()
+	m.report = report
+	m.mu.Unlock()
+
+	m.updateAnnouncement(ctx, report)
+	return report
+}
+
+// Validate checks that a public base URL parses, resolves to a public
+// address, presents a valid certificate when it is https, and reaches this
+// server's health endpoint. Checks after a failure are skipped.
+func (m *Monitor) Validate(ctx context.Context, raw string) []Check {
+	checks := []Check{
+		{Name: "url"},
+		{Name: "dns"},
+		{Name: "tls"},
+		{Name: "reachability"},
+	}
+	skip := func(from int) []Check {
+		for i := from; i < len(checks); i++ {
+			checks[i].Status = CheckSkip
+			checks[i].Detail = "Skipped after an earlier check failed"
+		}
+		return checks
+	}
+
+	u, err := Parse(raw)
+	if err != nil {
+		checks[0] = Check{Name: "url", Status: CheckFail, Detail: err.Error(), Hint: "Use a full URL such as https://pbx.example.com"}
+		return skip(1)
+	}
+	checks[0].Status = CheckPass
+	checks[0].Detail = fmt.Sprintf("%s is a valid %s URL", raw, u.Scheme)
+
+	checks[1] = m.checkDNS(ctx, u)
+	if checks[1].Status == CheckFail {
+		return skip(2)
+	}
+	checks[2] = m.checkTLS(ctx, u)
+	if checks[2].Status == CheckFail {
+		return skip(3)
+	}
+	checks[3] = m.checkReachability(ctx, u)
+	return checks
+}
+
+// checkDNS makes sure the host resolves to an address Twilio and remote
+// phones can reach
+func (m *Monitor) checkDNS(ctx context.Context, u *url.URL) Check {
+	check := Check{Name: "dns"}
+
+	ctx, cancel := context.WithTimeout(ctx, config.PublicURLCheckTimeout)
+	defer cancel()
+	ips, err := m.lookup(ctx, u.Hostname())
+	if err != nil || len(ips) == 0 {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("%s does not resolve", u.Hostname())
+		check.Hint = "Create a DNS record for the public host pointing at this server or its reverse proxy"
+		return check
+	}
+	for _, ip := range ips {
+		if !ip.IP.IsLoopback() && !ip.IP.IsPrivate() && !ip.IP.IsLinkLocalUnicast() {
+			check.Status = CheckPass
+			check.Detail = fmt.Sprintf("%s resolves to %s", u.Hostname(), ip.IP)
+			return check
+		}
+	}
+	check.Status = CheckFail
+	check.Detail = fmt.Sprintf("%s resolves to %s, which Twilio can't reach", u.Hostname(), ips[0].IP)
+	check.Hint = "Use a public host name, or expose GoSIP through a reverse proxy or tunnel"
+	return check
+}
+
+// checkTLS makes sure an https URL presents a trusted certificate for its
+// host that isn't about to expire
+func (m *Monitor) checkTLS(ctx context.Context, u *url.URL) Check {
+	check := Check{Name: "tls"}
+	if u.Scheme != "https" {
+		check.Status = CheckSkip
+		check.Detail = "Not an https URL"
+		check.Hint = "Twilio recommends https webhook URLs, and phones fetch provisioning over https"
+		return check
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: config.PublicURLCheckTimeout},
+		Config:    &tls.Config{ServerName: u.Hostname(), RootCAs: m.rootCAs},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("TLS handshake with %s failed: %v", u.Host, err)
+		check.Hint = "Install a certificate for the public host from a public CA, e.g. Let's Encrypt"
+		return check
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	notAfter := state.PeerCertificates[0].NotAfter
+	if time.Until(notAfter) < config.PublicURLCertWarning {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("The certificate for %s expires %s", u.Hostname(), notAfter.Format(time.RFC3339))
+		check.Hint = "Renew the certificate, and check that automatic renewal works"
+		return check
+	}
+	check.Status = CheckPass
+	check.Detail = fmt.Sprintf("The certificate for %s is valid until %s", u.Hostname(), notAfter.Format(time.RFC3339))
+	return check
+}
+
+// checkReachability fetches the health endpoint through the URL
+func (m *Monitor) checkReachability(ctx context.Context, u *url.URL) Check {
+	check := Check{Name: "reachability"}
+
+	health := u.JoinPath("/api/health").String()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, health, nil)
+	if err != nil {
+		check.Status = CheckFail
+		check.Detail = err.Error()
+		return check
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("GET %s failed: %v", health, err)
+		check.Hint = "Check the firewall, port forwarding and reverse proxy for the public URL"
+		return check
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("GET %s returned %d", health, resp.StatusCode)
+		check.Hint = "Make sure the reverse proxy forwards /api/ to GoSIP"
+		return check
+	}
+	check.Status = CheckPass
+	check.Detail = fmt.Sprintf("GET %s succeeded", health)
+	return check
+}
+
+// mismatches lists the places still using a URL other than base: Twilio
+// numbers configured under another URL, and webhooks Twilio sent elsewhere
+func (m *Monitor) mismatches(ctx context.Context, base string) []string {
+	found := []string{}
+	hooks, err := m.database.DIDWebhooks.List(ctx)
+	if err != nil {
+		slog.Error("Failed to list DID webhooks", "error", err)
+	}
+	for _, h := range hooks {
+		if h.BaseURL != base {
+			found = append(found, fmt.Sprintf("Twilio number %s sends webhooks to %s", h.Number, h.BaseURL))
+		}
+	}
+
+	m.mu.RLock()
+	webhookURL := m.webhookURL
+	m.mu.RUnlock()
+	if webhookURL != "" && !strings.HasPrefix(webhookURL, base+"/") {
+		found = append(found, fmt.Sprintf("Twilio sent a webhook to %s", webhookURL))
+	}
+	return found
+}
+
+// ObserveWebhook records a webhook Twilio signed for a URL outside the
+// public base URL. The first time, the URL is checked again in the
+// background so the mismatch is reported without waiting for the next check.
+func (m *Monitor) ObserveWebhook(ctx context.Context, webhookURL string) {
+	if m == nil {
+		return
+	}
+	if u, err := url.Parse(webhookURL); err == nil {
+		webhookURL = u.Scheme + "://" + u.Host + u.Path
+	}
+	m.mu.Lock()
+	seen := m.webhookURL == webhookURL
+	m.webhookURL = webhookURL
+	m.mu.Unlock()
+	if !seen {
+		slog.Warn("Twilio sent a webhook outside the public base URL", "url", webhookURL)
+		go m.Check(context.WithoutCancel(ctx))
+	}
+}
+
+// ForgetWebhooks drops the recorded webhook mismatch, after the public
+// base URL changed
+func (m *Monitor) ForgetWebhooks() {
+	m.mu.Lock()
+	m.webhookURL = ""
+	m.mu.Unlock()
+}
+
+// updateAnnouncement raises or clears the public URL announcement from a
+// report
+func (m *Monitor) updateAnnouncement(ctx context.Context, report *Report) {
+	var problems []string
+	for _, check := range report.Checks {
+		if check.Status == CheckFail {
+			problems = append(problems, check.Detail)
+		}
+	}
+	problems = append(problems, report.Mismatches...)
+	announcements.RecordPublicURL(ctx, m.database, m.hub, report.URL, problems)
+}
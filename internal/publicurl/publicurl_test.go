@@ -0,0 +1,175 @@
+package publicurl
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/announcements"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// setupTestDB creates an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	database, err := db.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Close()
+	})
+	return database
+}
+
+// newTestMonitor returns a Monitor that trusts server's certificate and
+// resolves every host to a public address
+func newTestMonitor(cfg *config.Config, database *db.DB, server *httptest.Server) *Monitor {
+	m := NewMonitor(cfg, database, nil)
+	m.client = server.Client()
+	m.rootCAs = x509.NewCertPool()
+	m.rootCAs.AddCert(server.Certificate())
+	m.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("203.0.113.10")}}, nil
+	}
+	return m
+}
+
+func newHealthServer() *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func statuses(checks []Check) string {
+	parts := make([]string, len(checks))
+	for i, c := range checks {
+		parts[i] = c.Name + "=" + c.Status
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestGet(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+	cfg := &config.Config{PublicURL: "https://env.example.com"}
+
+	if got := Get(ctx, cfg, database); got != "https://env.example.com" {
+		t.Errorf("Get = %q, want GOSIP_PUBLIC_URL", got)
+	}
+	database.Config.Set(ctx, SettingKey, "https://pbx.example.com/gosip/")
+	if got := Get(ctx, cfg, database); got != "https://pbx.example.com/gosip" {
+		t.Errorf("Get = %q, want the setting without its trailing slash", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for raw, ok := range map[string]bool{
+		"https://pbx.example.com":         true,
+		"http://pbx.example.com:8080/pbx": true,
+		"pbx.example.com":                 false,
+		"ftp://pbx.example.com":           false,
+		"https://pbx.example.com/?a=b":    false,
+		"https://user:pw@pbx.example.com": false,
+	} {
+		if _, err := Parse(raw); (err == nil) != ok {
+			t.Errorf("Parse(%q) = %v", raw, err)
+		}
+	}
+}
+
+func TestMonitor_Validate(t *testing.T) {
+	database := setupTestDB(t)
+	server := newHealthServer()
+	defer server.Close()
+	m := newTestMonitor(&config.Config{}, database, server)
+	ctx := context.Background()
+
+	if got := statuses(m.Validate(ctx, server.URL)); got != "url=pass dns=pass tls=pass reachability=pass" {
+		t.Errorf("Expected every check to pass, got %s", got)
+	}
+	if got := statuses(m.Validate(ctx, server.URL+"/gosip")); got != "url=pass dns=pass tls=pass reachability=fail" {
+		t.Errorf("Expected reachability to fail under a path GoSIP isn't at, got %s", got)
+	}
+	if got := statuses(m.Validate(ctx, "pbx.example.com")); got != "url=fail dns=skip tls=skip reachability=skip" {
+		t.Errorf("Expected an invalid URL to skip the rest, got %s", got)
+	}
+
+	// Without the test CA the certificate isn't trusted
+	m.rootCAs = nil
+	if got := statuses(m.Validate(ctx, server.URL)); got != "url=pass dns=pass tls=fail reachability=skip" {
+		t.Errorf("Expected an untrusted certificate to fail, got %s", got)
+	}
+
+	m.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("192.168.1.10")}}, nil
+	}
+	if got := statuses(m.Validate(ctx, server.URL)); got != "url=pass dns=fail tls=skip reachability=skip" {
+		t.Errorf("Expected a private address to fail, got %s", got)
+	}
+}
+
+func TestMonitor_Check(t *testing.T) {
+	database := setupTestDB(t)
+	server := newHealthServer()
+	defer server.Close()
+	ctx := context.Background()
+	m := newTestMonitor(&config.Config{}, database, server)
+
+	// Nothing to check without a public base URL
+	if report := m.Check(ctx); !report.OK || len(report.Checks) != 0 {
+		t.Errorf("Expected an empty report, got %+v", report)
+	}
+
+	database.Config.Set(ctx, SettingKey, server.URL)
+	if report := m.Check(ctx); !report.OK || report.URL != server.URL || len(report.Mismatches) != 0 {
+		t.Fatalf("Expected a clean report, got %+v", report)
+	}
+	if _, err := database.Announcements.GetByKey(ctx, announcements.KeyPublicURL); err == nil {
+		t.Error("Expected no announcement for a working URL")
+	}
+
+	// A number configured under the old URL and a webhook Twilio sent
+	// elsewhere are reported
+	did := &models.DID{Number: "+15551234567"}
+	if err := database.DIDs.Create(ctx, did); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DIDWebhooks.Upsert(ctx, did.ID, "PN1", "https://old.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	m.webhookURL = "https://old.example.com/api/webhooks/voice/incoming"
+	report := m.Check(ctx)
+	if len(report.Mismatches) != 2 {
+		t.Fatalf("Expected two mismatches, got %v", report.Mismatches)
+	}
+	if a, err := database.Announcements.GetByKey(ctx, announcements.KeyPublicURL); err != nil || !strings.Contains(a.Message, "+15551234567") {
+		t.Errorf("Expected an announcement naming the number, got %+v, %v", a, err)
+	}
+	if m.Report() != report {
+		t.Error("Expected the last report kept")
+	}
+
+	m.ForgetWebhooks()
+	database.DIDWebhooks.Delete(ctx, did.ID)
+	if report := m.Check(ctx); len(report.Mismatches) != 0 {
+		t.Errorf("Expected the mismatches gone, got %v", report.Mismatches)
+	}
+	if _, err := database.Announcements.GetByKey(ctx, announcements.KeyPublicURL); err == nil {
+		t.Error("Expected the announcement cleared")
+	}
+}
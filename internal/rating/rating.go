@@ -0,0 +1,258 @@
+// Package rating estimates what outbound calls and messages cost from a
+// local rate table, matching numbers by their longest rated prefix
+package rating
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// ErrInvalidCSV wraps the problems found in an imported rate table
+var ErrInvalidCSV = errors.New("invalid rate table")
+
+// SMS segment sizes, in characters for GSM-7 and UTF-16 code units for UCS-2
+const (
+	gsmSingleSegment  = 160
+	gsmMultiSegment   = 153
+	ucs2SingleSegment = 70
+	ucs2MultiSegment  = 67
+)
+
+// gsmBasic is the GSM 03.38 basic character set, and gsmExtended the
+// characters sent as two septets with an escape
+const (
+	gsmBasic    = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsmExtended = "^{}\\[~]|€\f"
+)
+
+// Table looks up rates by kind and number
+type Table struct {
+	rates     map[string]map[string]float64 // Kind, then prefix
+	maxPrefix int
+}
+
+// NewTable builds a lookup table from rate entries
+func NewTable(rates []*models.Rate) *Table {
+	t := &Table{rates: make(map[string]map[string]float64)}
+	for _, rate := range rates {
+		if t.rates[rate.Kind] == nil {
+			t.rates[rate.Kind] = make(map[string]float64)
+		}
+		t.rates[rate.Kind][rate.Prefix] = rate.Rate
+		if len(rate.Prefix) > t.maxPrefix {
+			t.maxPrefix = len(rate.Prefix)
+		}
+	}
+	return t
+}
+
+// Load reads the rate table from the database
+func Load(ctx context.Context, database *db.DB) (*Table, error) {
+	rates, err := database.Rates.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewTable(rates), nil
+}
+
+// LoadFor reads just the rates of a kind that can match a number, for
+// pricing a single call or message without the whole table
+func LoadFor(ctx context.Context, database *db.DB, kind, number string) (*Table, error) {
+	e164 := db.NormalizeE164(number)
+	if e164 == "" {
+		return NewTable(nil), nil
+	}
+	rates, err := database.Rates.ListMatching(ctx, kind, strings.TrimPrefix(e164, "+"))
+	if err != nil {
+		return nil, err
+	}
+	return NewTable(rates), nil
+}
+
+// MessageKind returns the rate kind a message is priced by
+func MessageKind(hasMedia bool) string {
+	if hasMedia {
+		return db.RateKindMMS
+	}
+	return db.RateKindSMS
+}
+
+// Empty reports whether the table has no rates
+func (t *Table) Empty() bool {
+	return len(t.rates) == 0
+}
+
+// Lookup returns the rate of the longest prefix matching a number
+func (t *Table) Lookup(kind, number string) (float64, bool) {
+	byPrefix := t.rates[kind]
+	e164 := db.NormalizeE164(number)
+	if byPrefix == nil || e164 == "" {
+		return 0, false
+	}
+
+	digits := strings.TrimPrefix(e164, "+")
+	for n := min(len(digits), t.maxPrefix); n > 0; n-- {
+		if rate, ok := byPrefix[digits[:n]]; ok {
+			return rate, true
+		}
+	}
+	return 0, false
+}
+
+// CallCost estimates an outbound call, billed per started minute. Calls
+// that were never answered cost nothing. It returns nil when no rate matches.
+func (t *Table) CallCost(number string, durationSeconds int) *float64 {
+	rate, ok := t.Lookup(db.RateKindCall, number)
+	if !ok {
+		return nil
+	}
+	minutes := (max(durationSeconds, 0) + 59) / 60
+	return round(rate * float64(minutes))
+}
+
+// MessageCost estimates an outbound message: MMS per message, SMS per
+// segment. It returns nil when no rate matches.
+func (t *Table) MessageCost(number, body string, hasMedia bool) *float64 {
+	rate, ok := t.Lookup(MessageKind(hasMedia), number)
+	if !ok {
+		return nil
+	}
+	if hasMedia {
+		return round(rate)
+	}
+	return round(rate * float64(Segments(body)))
+}
+
+// round keeps costs to a hundredth of a cent
+func round(cost float64) *float64 {
+	cost = math.Round(cost*1e5) / 1e5
+	return &cost
+}
+
+// Segments returns how many SMS segments a body is sent as: GSM-7 when
+// every character is in the GSM alphabet, UCS-2 otherwise
+func Segments(body string) int {
+	if body == "" {
+		return 1
+	}
+
+	septets, units, gsm := 0, 0, true
+	for _, ch := range body {
+		switch {
+		case strings.ContainsRune(gsmBasic, ch):
+			septets++
+		case strings.ContainsRune(gsmExtended, ch):
+			septets += 2
+		default:
+			gsm = false
+		}
+		if ch > 0xFFFF {
+			units += 2
+		} else {
+			units++
+		}
+	}
+
+	if gsm {
+		return segmentCount(septets, gsmSingleSegment, gsmMultiSegment)
+	}
+	return segmentCount(units, ucs2SingleSegment, ucs2MultiSegment)
+}
+
+func segmentCount(length, single, multi int) int {
+	if length <= single {
+		return 1
+	}
+	return (length + multi - 1) / multi
+}
+
+// ParseCSV reads a rate table with a header row naming the kind, prefix
+// and rate columns, and optionally description. Prefixes may start with
+// "+"; rates are in the account's currency.
+func ParseCSV(r io.Reader) ([]*models.Rate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidCSV)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"kind", "prefix", "rate"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: missing %q column", ErrInvalidCSV, required)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rates []*models.Rate
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rates, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if len(rates) == config.RateImportMaxRows {
+			return nil, fmt.Errorf("%w: more than %d rates", ErrInvalidCSV, config.RateImportMaxRows)
+		}
+
+		rate := &models.Rate{
+			Kind:        strings.ToLower(field(record, "kind")),
+			Prefix:      strings.TrimPrefix(field(record, "prefix"), "+"),
+			Description: field(record, "description"),
+		}
+		if rate.Kind != db.RateKindCall && rate.Kind != db.RateKindSMS && rate.Kind != db.RateKindMMS {
+			return nil, fmt.Errorf("%w: line %d: kind must be call, sms or mms", ErrInvalidCSV, line)
+		}
+		if !validPrefix(rate.Prefix) {
+			return nil, fmt.Errorf("%w: line %d: prefix must be 1 to 15 digits", ErrInvalidCSV, line)
+		}
+		rate.Rate, err = strconv.ParseFloat(field(record, "rate"), 64)
+		if err != nil || rate.Rate < 0 || math.IsInf(rate.Rate, 0) || math.IsNaN(rate.Rate) {
+			return nil, fmt.Errorf("%w: line %d: rate must be a non-negative number", ErrInvalidCSV, line)
+		}
+		rates = append(rates, rate)
+	}
+}
+
+func validPrefix(prefix string) bool {
+	if len(prefix) == 0 || len(prefix) > 15 {
+		return false
+	}
+	for _, ch := range prefix {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
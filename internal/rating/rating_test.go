@@ -0,0 +1,140 @@
+package rating
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func testTable() *Table {
+	return NewTable([]*models.Rate{
+		{Kind: "call", Prefix: "1", Rate: 0.014},
+		{Kind: "call", Prefix: "1876", Rate: 0.25},
+		{Kind: "call", Prefix: "44", Rate: 0.05},
+		{Kind: "sms", Prefix: "1", Rate: 0.0079},
+		{Kind: "mms", Prefix: "1", Rate: 0.02},
+	})
+}
+
+func TestLookup(t *testing.T) {
+	table := testTable()
+
+	tests := []struct {
+		kind, number string
+		want         float64
+		ok           bool
+	}{
+		{"call", "+15551234567", 0.014, true},
+		{"call", "(876) 555-1234", 0.25, true}, // North American without a country code
+		{"call", "+18765551234", 0.25, true},
+		{"call", "+442071234567", 0.05, true},
+		{"call", "+33123456789", 0, false},
+		{"call", "101", 0, false},
+		{"sms", "+442071234567", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := table.Lookup(tt.kind, tt.number)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Lookup(%q, %q) = %v, %v, want %v, %v", tt.kind, tt.number, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCallCost(t *testing.T) {
+	table := testTable()
+
+	tests := []struct {
+		duration int
+		want     float64
+	}{
+		{0, 0},
+		{1, 0.014},
+		{60, 0.014},
+		{61, 0.028},
+		{600, 0.14},
+	}
+
+	for _, tt := range tests {
+		got := table.CallCost("+15551234567", tt.duration)
+		if got == nil || *got != tt.want {
+			t.Errorf("CallCost(%d) = %v, want %v", tt.duration, got, tt.want)
+		}
+	}
+
+	if got := table.CallCost("+33123456789", 60); got != nil {
+		t.Errorf("CallCost for an unrated number = %v, want nil", *got)
+	}
+}
+
+func TestMessageCost(t *testing.T) {
+	table := testTable()
+
+	if got := table.MessageCost("+15551234567", strings.Repeat("a", 161), false); got == nil || *got != 0.0158 {
+		t.Errorf("two segment SMS = %v, want 0.0158", got)
+	}
+	if got := table.MessageCost("+15551234567", strings.Repeat("a", 500), true); got == nil || *got != 0.02 {
+		t.Errorf("MMS = %v, want 0.02", got)
+	}
+	if got := table.MessageCost("+442071234567", "hi", false); got != nil {
+		t.Errorf("unrated SMS = %v, want nil", *got)
+	}
+}
+
+func TestSegments(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"empty", "", 1},
+		{"GSM single", strings.Repeat("a", 160), 1},
+		{"GSM multi", strings.Repeat("a", 161), 2},
+		{"GSM extended characters count twice", strings.Repeat("€", 81), 2},
+		{"GSM three segments", strings.Repeat("a", 307), 3},
+		{"UCS-2 single", strings.Repeat("ä", 69) + "ł", 1},
+		{"UCS-2 multi", strings.Repeat("ł", 71), 2},
+		{"emoji use two units", strings.Repeat("😀", 35), 1},
+		{"emoji multi", strings.Repeat("😀", 36), 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Segments(tt.body); got != tt.want {
+				t.Errorf("Segments() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	rates, err := ParseCSV(strings.NewReader("\ufeffKind,Prefix,Rate,Description\ncall,+1,0.014,US and Canada\n\nSMS,44,0.04,\n"))
+	if err != nil {
+		t.Fatalf("ParseCSV() error = %v", err)
+	}
+	if len(rates) != 2 {
+		t.Fatalf("ParseCSV() returned %d rates, want 2", len(rates))
+	}
+	if r := rates[0]; r.Kind != "call" || r.Prefix != "1" || r.Rate != 0.014 || r.Description != "US and Canada" {
+		t.Errorf("first rate = %+v", r)
+	}
+	if r := rates[1]; r.Kind != "sms" || r.Prefix != "44" || r.Rate != 0.04 {
+		t.Errorf("second rate = %+v", r)
+	}
+
+	invalid := []string{
+		"",
+		"kind,rate\ncall,0.1\n",
+		"kind,prefix,rate\nfax,1,0.1\n",
+		"kind,prefix,rate\ncall,1x,0.1\n",
+		"kind,prefix,rate\ncall,1,-0.1\n",
+		"kind,prefix,rate\ncall,1,free\n",
+	}
+	for _, body := range invalid {
+		if _, err := ParseCSV(strings.NewReader(body)); !errors.Is(err, ErrInvalidCSV) {
+			t.Errorf("ParseCSV(%q) error = %v, want ErrInvalidCSV", body, err)
+		}
+	}
+}
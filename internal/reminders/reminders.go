@@ -0,0 +1,346 @@
+// Package reminders sends appointment reminders by SMS or voice call when
+// they are due, records contacts confirming or cancelling their
+// appointments, and sends a daily digest of the appointments not yet
+// confirmed
+package reminders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/channels"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/i18n"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/publicurl"
+	"github.com/btafoya/gosip/internal/rating"
+	"github.com/btafoya/gosip/internal/rules"
+	"github.com/btafoya/gosip/internal/shortlinks"
+	"github.com/btafoya/gosip/internal/twilio"
+)
+
+// Delivery channels
+const (
+	ChannelSMS   = "sms"
+	ChannelVoice = "voice"
+)
+
+// Digits a contact presses during a reminder call
+const (
+	DigitConfirm = "1"
+	DigitCancel  = "2"
+)
+
+// VoicePath is the webhook a reminder call sends the pressed digit to
+const VoicePath = "/api/webhooks/voice/reminder"
+
+// SettingDigestHour is the hour of the day, in the system timezone, the
+// digest of unconfirmed appointments is sent; -1 turns it off
+const SettingDigestHour = "reminder_digest_hour"
+
+// settingDigestSent records the day the last digest was sent, so a restart
+// doesn't send it twice
+const settingDigestSent = "reminder_digest_sent"
+
+// Reply keywords, matched case-insensitively against the whole reply
+var (
+	confirmKeywords = map[string]bool{"C": true, "CONFIRM": true, "YES": true, "Y": true, "1": true, "SI": true, "SÍ": true, "OUI": true, "JA": true}
+	cancelKeywords  = map[string]bool{"X": true, "CANCEL": true, "NO": true, "N": true, "2": true, "ANNULER": true, "NON": true, "NEIN": true, "ABSAGEN": true, "CANCELAR": true}
+)
+
+// dateLayouts and timeLayouts format the {date} and {time} placeholders
+var (
+	dateLayouts = map[string]string{i18n.English: "Mon Jan 2", i18n.Spanish: "02/01/2006", i18n.French: "02/01/2006", i18n.German: "02.01.2006"}
+	timeLayouts = map[string]string{i18n.English: "3:04 PM", i18n.Spanish: "15:04", i18n.French: "15:04", i18n.German: "15:04"}
+)
+
+// Sender is the part of the Twilio client used to deliver reminders
+type Sender interface {
+	SendSMS(from, to, body string, mediaURLs []string) (string, error)
+	MakeCallTwiML(from, to, twiml string) (string, error)
+}
+
+// Notifier is sent the daily digest
+type Notifier interface {
+	SendReminderDigest(reminders []*models.Reminder, loc *time.Location) error
+}
+
+// Scheduler periodically sends due reminders and the daily digest
+type Scheduler struct {
+	cfg      *config.Config
+	database *db.DB
+	sender   Sender
+	notifier Notifier
+}
+
+// NewScheduler creates a Scheduler. notifier may be nil.
+func NewScheduler(cfg *config.Config, database *db.DB, sender Sender, notifier Notifier) *Scheduler {
+	return &Scheduler{cfg: cfg, database: database, sender: sender, notifier: notifier}
+}
+
+// Start sends due reminders now and then every ReminderCheckInterval
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(config.ReminderCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			s.Run(ctx, time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Run sends the reminders due at now, and the digest once its hour has come
+func (s *Scheduler) Run(ctx context.Context, now time.Time) {
+	due, err := s.database.Reminders.ListDue(ctx, now)
+	if err != nil {
+		slog.Warn("Failed to list due reminders", "error", err)
+	}
+	for _, rem := range due {
+		s.Send(ctx, rem, now)
+	}
+
+	s.sendDigest(ctx, now)
+}
+
+// Send delivers a scheduled reminder over each of its channels. It counts
+// as sent when any channel delivered it; the channels that failed are
+// recorded as its error.
+func (s *Scheduler) Send(ctx context.Context, rem *models.Reminder, now time.Time) {
+	var sent bool
+	var callSID string
+	var failures []string
+
+	did, err := s.database.DIDs.GetByID(ctx, rem.DIDID)
+	switch {
+	case err != nil:
+		failures = append(failures, "DID: "+err.Error())
+	case !rem.AppointmentAt.After(now):
+		// The reminder was due while the server was down
+		failures = append(failures, "the appointment had passed")
+	default:
+		lang := i18n.Resolve(did.Language, s.database.Config.GetForTenant(ctx, did.TenantID, "default_language", i18n.DefaultLanguage))
+		text := Render(rem, lang, s.location(ctx, did))
+		for _, channel := range rem.Channels {
+			var err error
+			switch {
+			case channel == ChannelSMS && !did.SMSEnabled:
+				err = errors.New("the DID is not SMS-enabled")
+			case channel == ChannelSMS:
+				err = s.sendSMS(ctx, did, rem.ToNumber, text+" "+i18n.Prompt(lang, i18n.PromptReminderReply))
+			case channel == ChannelVoice && !did.VoiceEnabled:
+				err = errors.New("the DID is not voice-enabled")
+			case channel == ChannelVoice:
+				callSID, err = s.sender.MakeCallTwiML(did.Number, rem.ToNumber, s.callTwiML(ctx, rem, lang, text))
+			default:
+				err = fmt.Errorf("unknown channel %q", channel)
+			}
+			if err != nil {
+				failures = append(failures, channel+": "+err.Error())
+				continue
+			}
+			sent = true
+		}
+	}
+
+	status := db.ReminderSent
+	if !sent {
+		status = db.ReminderFailed
+	}
+	var sendErr *string
+	if len(failures) > 0 {
+		joined := strings.Join(failures, "; ")
+		sendErr = &joined
+		slog.Warn("Failed to send reminder", "id", rem.ID, "error", joined)
+	}
+	if err := s.database.Reminders.RecordSend(ctx, rem.ID, status, callSID, sendErr, now); err != nil {
+		slog.Error("Failed to record reminder", "id", rem.ID, "error", err)
+		return
+	}
+	if sent {
+		slog.Info("Reminder sent", "id", rem.ID, "channels", rem.Channels)
+	}
+}
+
+// sendSMS texts a reminder, recording it as an outbound message of the DID.
+// Its links are shortened like those of other outbound messages.
+func (s *Scheduler) sendSMS(ctx context.Context, did *models.DID, to, body string) error {
+	didID := did.ID
+	message := &models.Message{
+		DIDID:      &didID,
+		Direction:  "outbound",
+		FromNumber: did.Number,
+		ToNumber:   to,
+		Body:       body,
+		Status:     "queued",
+		CreatedAt:  time.Now(),
+		Channel:    channels.SMS,
+	}
+	if err := s.database.Messages.Create(ctx, message); err != nil {
+		return err
+	}
+	if err := shortlinks.Shorten(ctx, s.cfg, s.database, message); err != nil {
+		slog.Warn("Failed to shorten reminder links", "id", message.ID, "error", err)
+	}
+	body = message.Body
+
+	sid, err := s.sender.SendSMS(s.smsFrom(ctx, did), to, body, nil)
+	if err != nil {
+		var code *int
+		reason := err.Error()
+		if info := twilio.ExplainError(err); info != nil {
+			code, reason = &info.Code, info.Message
+		}
+		s.database.Messages.UpdateStatusWithError(ctx, message.ID, "failed", code, reason)
+		return err
+	}
+	message.MessageSID = sid
+	message.Status = "sent"
+	s.database.Messages.Update(ctx, message)
+
+	if table, err := rating.LoadFor(ctx, s.database, rating.MessageKind(false), to); err == nil {
+		if cost := table.MessageCost(to, body, false); cost != nil {
+			s.database.Messages.SetEstimatedCost(ctx, message.ID, cost)
+		}
+	}
+	return nil
+}
+
+// smsFrom returns what a DID's SMS are sent from: its Messaging Service,
+// else the global one, else its own number
+func (s *Scheduler) smsFrom(ctx context.Context, did *models.DID) string {
+	if did.MessagingServiceSID != "" {
+		return did.MessagingServiceSID
+	}
+	if sid := s.database.Config.GetWithDefault(ctx, "twilio_messaging_service_sid", ""); sid != "" {
+		return sid
+	}
+	return did.Number
+}
+
+// callTwiML reads a reminder out. The contact is asked to press a key to
+// confirm or cancel when there is a public base URL to send it to.
+func (s *Scheduler) callTwiML(ctx context.Context, rem *models.Reminder, lang, text string) string {
+	say := func(text string) string {
+		return `<Say language="` + i18n.VoiceLocale(lang) + `">` + html.EscapeString(text) + `</Say>`
+	}
+
+	twiml := `<Response><Pause length="1"/>` + say(text)
+	if base := publicurl.Get(ctx, s.cfg, s.database); base != "" {
+		action := base + VoicePath + "?ReminderId=" + strconv.FormatInt(rem.ID, 10)
+		twiml += `<Gather numDigits="1" timeout="10" action="` + html.EscapeString(action) + `">` +
+			say(i18n.Prompt(lang, i18n.PromptReminderPress)) + `</Gather>`
+	}
+	return twiml + say(i18n.Prompt(lang, i18n.PromptGoodbye)) + `</Response>`
+}
+
+// location returns the timezone a DID's appointments are given in
+func (s *Scheduler) location(ctx context.Context, did *models.DID) *time.Location {
+	system := rules.LoadLocation(s.database.Config.GetForTenant(ctx, did.TenantID, "timezone", ""), time.Local)
+	return rules.LoadLocation(did.Timezone, system)
+}
+
+// sendDigest sends the digest of unconfirmed appointments once a day,
+// from its hour on
+func (s *Scheduler) sendDigest(ctx context.Context, now time.Time) {
+	hour := config.DefaultReminderDigestHour
+	if h, err := strconv.Atoi(s.database.Config.GetWithDefault(ctx, SettingDigestHour, "")); err == nil {
+		hour = h
+	}
+	if hour < 0 {
+		return
+	}
+
+	loc := rules.LoadLocation(s.database.Config.GetWithDefault(ctx, "timezone", ""), time.Local)
+	local := now.In(loc)
+	day := local.Format("2006-01-02")
+	if local.Hour() < hour || s.database.Config.GetWithDefault(ctx, settingDigestSent, "") == day {
+		return
+	}
+	// Recorded first, so a digest that fails isn't retried every minute
+	if err := s.database.Config.Set(ctx, settingDigestSent, day); err != nil {
+		slog.Warn("Failed to record reminder digest", "error", err)
+		return
+	}
+
+	unconfirmed, err := s.database.Reminders.ListUnconfirmed(ctx, now, now.Add(config.ReminderDigestWindow))
+	if err != nil {
+		slog.Warn("Failed to list unconfirmed appointments", "error", err)
+		return
+	}
+	if len(unconfirmed) == 0 || s.notifier == nil {
+		return
+	}
+	if err := s.notifier.SendReminderDigest(unconfirmed, loc); err != nil {
+		slog.Warn("Failed to send reminder digest", "error", err)
+	}
+}
+
+// Render fills in a reminder's message text, or the default text when it
+// has none, with the appointment's date and time in loc
+func Render(rem *models.Reminder, lang string, loc *time.Location) string {
+	text := rem.Template
+	if text == "" {
+		text = i18n.Prompt(lang, i18n.PromptReminderAppointment)
+	}
+	dateLayout, ok := dateLayouts[lang]
+	if !ok {
+		dateLayout = dateLayouts[i18n.English]
+	}
+	timeLayout, ok := timeLayouts[lang]
+	if !ok {
+		timeLayout = timeLayouts[i18n.English]
+	}
+	at := rem.AppointmentAt.In(loc)
+	return strings.NewReplacer(
+		"{name}", rem.ContactName,
+		"{date}", at.Format(dateLayout),
+		"{time}", at.Format(timeLayout),
+	).Replace(text)
+}
+
+// ParseReply returns the status a reply to a reminder asks for: confirmed,
+// cancelled, or "" when the reply is neither
+func ParseReply(body string) string {
+	word := strings.ToUpper(strings.Trim(strings.TrimSpace(body), ".!"))
+	switch {
+	case confirmKeywords[word]:
+		return db.ReminderConfirmed
+	case cancelKeywords[word]:
+		return db.ReminderCancelled
+	}
+	return ""
+}
+
+// ParseDigit returns the status a digit pressed during a reminder call
+// asks for, or ""
+func ParseDigit(digit string) string {
+	switch digit {
+	case DigitConfirm:
+		return db.ReminderConfirmed
+	case DigitCancel:
+		return db.ReminderCancelled
+	}
+	return ""
+}
+
+// Acknowledgment returns what a contact is told after confirming or
+// cancelling
+func Acknowledgment(lang, status string) string {
+	if status == db.ReminderCancelled {
+		return i18n.Prompt(lang, i18n.PromptReminderCancelled)
+	}
+	return i18n.Prompt(lang, i18n.PromptReminderConfirmed)
+}
@@ -0,0 +1,250 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/i18n"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/shortlinks"
+)
+
+// setupTestDB creates an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	database, err := db.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Close()
+	})
+	return database
+}
+
+type fakeSender struct {
+	texts   []string
+	calls   []string
+	failSMS bool
+}
+
+func (f *fakeSender) SendSMS(from, to, body string, mediaURLs []string) (string, error) {
+	if f.failSMS {
+		return "", errors.New("twilio unavailable")
+	}
+	f.texts = append(f.texts, body)
+	return "SM" + strings.Repeat("0", 31) + string(rune('a'+len(f.texts))), nil
+}
+
+func (f *fakeSender) MakeCallTwiML(from, to, twiml string) (string, error) {
+	f.calls = append(f.calls, twiml)
+	return "CA123", nil
+}
+
+type fakeNotifier struct {
+	digests [][]*models.Reminder
+}
+
+func (f *fakeNotifier) SendReminderDigest(reminders []*models.Reminder, loc *time.Location) error {
+	f.digests = append(f.digests, reminders)
+	return nil
+}
+
+func createReminder(t *testing.T, database *db.DB, rem *models.Reminder) *models.Reminder {
+	t.Helper()
+	if err := database.Reminders.Create(context.Background(), rem); err != nil {
+		t.Fatalf("Failed to create reminder: %v", err)
+	}
+	return rem
+}
+
+func TestScheduler_Run(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+	database.Config.Set(ctx, SettingDigestHour, "-1")
+	database.Config.Set(ctx, "public_base_url", "https://pbx.example.com")
+	now := time.Date(2026, 3, 2, 14, 0, 0, 0, time.UTC)
+
+	did := &models.DID{Number: "+15550001111", SMSEnabled: true, VoiceEnabled: true, Timezone: "America/New_York"}
+	if err := database.DIDs.Create(ctx, did); err != nil {
+		t.Fatalf("Failed to create DID: %v", err)
+	}
+	textOnly := &models.DID{Number: "+15550001112", SMSEnabled: true}
+	if err := database.DIDs.Create(ctx, textOnly); err != nil {
+		t.Fatalf("Failed to create DID: %v", err)
+	}
+
+	appointment := time.Date(2026, 3, 3, 15, 30, 0, 0, time.UTC)
+	both := createReminder(t, database, &models.Reminder{DIDID: did.ID, ContactName: "Ann", ToNumber: "+15550002222", AppointmentAt: appointment, RemindAt: now.Add(-time.Minute),
+		Template: "Hi {name}, see you {date} at {time}.", Channels: []string{ChannelSMS, ChannelVoice}})
+	noVoice := createReminder(t, database, &models.Reminder{DIDID: textOnly.ID, ToNumber: "+15550003333", AppointmentAt: appointment, RemindAt: now, Channels: []string{ChannelVoice}})
+	passed := createReminder(t, database, &models.Reminder{DIDID: did.ID, ToNumber: "+15550004444", AppointmentAt: now.Add(-time.Hour), RemindAt: now.Add(-2 * time.Hour), Channels: []string{ChannelSMS}})
+	later := createReminder(t, database, &models.Reminder{DIDID: did.ID, ToNumber: "+15550005555", AppointmentAt: appointment, RemindAt: now.Add(time.Hour), Channels: []string{ChannelSMS}})
+
+	sender := &fakeSender{}
+	NewScheduler(nil, database, sender, nil).Run(ctx, now)
+
+	// Times are given in the DID's timezone
+	if len(sender.texts) != 1 || !strings.HasPrefix(sender.texts[0], "Hi Ann, see you Tue Mar 3 at 10:30 AM. Reply C") {
+		t.Errorf("Unexpected texts: %q", sender.texts)
+	}
+	if len(sender.calls) != 1 || !strings.Contains(sender.calls[0], `action="https://pbx.example.com/api/webhooks/voice/reminder?ReminderId=`) {
+		t.Errorf("Expected a call asking for a digit, got %q", sender.calls)
+	}
+
+	rem, _ := database.Reminders.GetByID(ctx, both.ID)
+	if rem.Status != db.ReminderSent || rem.CallSID != "CA123" || rem.SentAt == nil || rem.Error != nil {
+		t.Errorf("Unexpected sent reminder: %+v", rem)
+	}
+	messages, _ := database.Messages.List(ctx, 10, 0)
+	if len(messages) != 1 || messages[0].Status != "sent" || messages[0].ToNumber != "+15550002222" {
+		t.Errorf("Expected the text recorded as a sent message, got %+v", messages)
+	}
+
+	for _, id := range []int64{noVoice.ID, passed.ID} {
+		rem, _ := database.Reminders.GetByID(ctx, id)
+		if rem.Status != db.ReminderFailed || rem.Error == nil {
+			t.Errorf("Expected reminder %d failed, got %+v", id, rem)
+		}
+	}
+	if rem, _ := database.Reminders.GetByID(ctx, later.ID); rem.Status != db.ReminderScheduled {
+		t.Errorf("Expected the later reminder still scheduled, got %s", rem.Status)
+	}
+}
+
+func TestScheduler_RunSendFailed(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+	database.Config.Set(ctx, SettingDigestHour, "-1")
+	now := time.Now()
+
+	did := &models.DID{Number: "+15550001111", SMSEnabled: true}
+	if err := database.DIDs.Create(ctx, did); err != nil {
+		t.Fatalf("Failed to create DID: %v", err)
+	}
+	rem := createReminder(t, database, &models.Reminder{DIDID: did.ID, ToNumber: "+15550002222", AppointmentAt: now.Add(time.Hour), RemindAt: now, Channels: []string{ChannelSMS}})
+
+	NewScheduler(nil, database, &fakeSender{failSMS: true}, nil).Run(ctx, now)
+
+	rem, _ = database.Reminders.GetByID(ctx, rem.ID)
+	if rem.Status != db.ReminderFailed || rem.Error == nil || !strings.Contains(*rem.Error, "twilio unavailable") {
+		t.Errorf("Expected the reminder failed with the send error, got %+v", rem)
+	}
+	messages, _ := database.Messages.List(ctx, 10, 0)
+	if len(messages) != 1 || messages[0].Status != "failed" {
+		t.Errorf("Expected the text recorded as failed, got %+v", messages)
+	}
+}
+
+func TestScheduler_RunShortLinks(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+	database.Config.Set(ctx, SettingDigestHour, "-1")
+	database.Config.Set(ctx, "public_base_url", "https://pbx.example.com")
+	database.Config.Set(ctx, shortlinks.SettingEnabled, "true")
+	now := time.Now()
+
+	did := &models.DID{Number: "+15550001111", SMSEnabled: true}
+	if err := database.DIDs.Create(ctx, did); err != nil {
+		t.Fatalf("Failed to create DID: %v", err)
+	}
+	createReminder(t, database, &models.Reminder{DIDID: did.ID, ToNumber: "+15550002222", AppointmentAt: now.Add(time.Hour), RemindAt: now,
+		Template: "Directions: https://clinic.example.com/map", Channels: []string{ChannelSMS}})
+
+	sender := &fakeSender{}
+	NewScheduler(nil, database, sender, nil).Run(ctx, now)
+
+	if len(sender.texts) != 1 || !strings.HasPrefix(sender.texts[0], "Directions: https://pbx.example.com/l/") {
+		t.Fatalf("Expected the link shortened, got %q", sender.texts)
+	}
+	messages, _ := database.Messages.List(ctx, 10, 0)
+	if len(messages) != 1 || messages[0].Body != sender.texts[0] {
+		t.Errorf("Expected the shortened text recorded, got %+v", messages)
+	}
+	links, _ := database.ShortLinks.ListByMessage(ctx, messages[0].ID)
+	if len(links) != 1 || links[0].URL != "https://clinic.example.com/map" {
+		t.Errorf("Expected a short link for the message, got %+v", links)
+	}
+}
+
+func TestScheduler_Digest(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+	database.Config.Set(ctx, "timezone", "UTC")
+	database.Config.Set(ctx, SettingDigestHour, "8")
+
+	did := &models.DID{Number: "+15550001111", SMSEnabled: true}
+	if err := database.DIDs.Create(ctx, did); err != nil {
+		t.Fatalf("Failed to create DID: %v", err)
+	}
+	morning := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	pending := createReminder(t, database, &models.Reminder{DIDID: did.ID, ToNumber: "+15550002222", AppointmentAt: morning.Add(3 * time.Hour), RemindAt: morning.Add(2 * time.Hour), Channels: []string{ChannelSMS}})
+	confirmed := createReminder(t, database, &models.Reminder{DIDID: did.ID, ToNumber: "+15550003333", AppointmentAt: morning.Add(4 * time.Hour), RemindAt: morning.Add(-time.Hour), Channels: []string{ChannelSMS}})
+	database.Reminders.RecordSend(ctx, confirmed.ID, db.ReminderSent, "", nil, morning)
+	database.Reminders.Respond(ctx, confirmed.ID, db.ReminderConfirmed, morning)
+	tomorrow := createReminder(t, database, &models.Reminder{DIDID: did.ID, ToNumber: "+15550004444", AppointmentAt: morning.Add(config.ReminderDigestWindow + time.Hour), RemindAt: morning.Add(time.Hour), Channels: []string{ChannelSMS}})
+
+	notifier := &fakeNotifier{}
+	scheduler := NewScheduler(nil, database, &fakeSender{}, notifier)
+	scheduler.Run(ctx, morning.Add(-time.Minute))
+	if len(notifier.digests) != 0 {
+		t.Fatal("Expected no digest before its hour")
+	}
+
+	scheduler.Run(ctx, morning)
+	scheduler.Run(ctx, morning.Add(time.Minute))
+	if len(notifier.digests) != 1 {
+		t.Fatalf("Expected one digest a day, got %d", len(notifier.digests))
+	}
+	if got := notifier.digests[0]; len(got) != 1 || got[0].ID != pending.ID {
+		t.Errorf("Expected only the unconfirmed appointment within the window, got %+v", got)
+	}
+
+	scheduler.Run(ctx, morning.Add(24*time.Hour))
+	if len(notifier.digests) != 2 || notifier.digests[1][0].ID != tomorrow.ID {
+		t.Errorf("Expected the next day's digest, got %+v", notifier.digests)
+	}
+}
+
+func TestRender(t *testing.T) {
+	rem := &models.Reminder{ContactName: "Ann", AppointmentAt: time.Date(2026, 3, 3, 15, 30, 0, 0, time.UTC)}
+	if got := Render(rem, i18n.English, time.UTC); got != "Reminder: you have an appointment on Tue Mar 3 at 3:30 PM." {
+		t.Errorf("Unexpected default text: %q", got)
+	}
+	if got := Render(rem, i18n.German, time.UTC); got != "Erinnerung: Sie haben am 03.03.2026 um 15:30 einen Termin." {
+		t.Errorf("Unexpected German text: %q", got)
+	}
+	rem.Template = "{name}: {time}"
+	if got := Render(rem, i18n.French, time.UTC); got != "Ann: 15:30" {
+		t.Errorf("Unexpected template text: %q", got)
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"C", db.ReminderConfirmed},
+		{" yes! ", db.ReminderConfirmed},
+		{"Oui", db.ReminderConfirmed},
+		{"x", db.ReminderCancelled},
+		{"cancel.", db.ReminderCancelled},
+		{"Can I come at 4 instead?", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ParseReply(tt.body); got != tt.want {
+			t.Errorf("ParseReply(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
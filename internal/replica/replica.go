@@ -0,0 +1,341 @@
+// Package replica keeps a warm standby copy of the SQLite database in S3 or
+// another directory. Whenever the database changes, a consistent snapshot
+// is uploaded within a few seconds, and a new container with an empty data
+// volume restores the latest one before starting.
+package replica
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// snapshotPrefix holds the snapshots, named by UTC time so they sort in order
+const snapshotPrefix = "snapshots/"
+
+// maxSnapshotSize limits a compressed snapshot held in memory
+const maxSnapshotSize = 512 << 20
+
+// Database takes consistent copies of the live database
+type Database interface {
+	Snapshot(ctx context.Context, path string) error
+}
+
+// Status reports replication progress
+type Status struct {
+	Enabled      bool       `json:"enabled"`
+	URL          string     `json:"url,omitempty"`
+	LastSnapshot string     `json:"last_snapshot,omitempty"`
+	LastSize     int64      `json:"last_size,omitempty"` // Compressed bytes
+	ReplicatedAt *time.Time `json:"replicated_at,omitempty"`
+	Snapshots    int        `json:"snapshots"`
+	Error        string     `json:"error,omitempty"`
+	RestoredFrom string     `json:"restored_from,omitempty"` // Snapshot restored at startup
+}
+
+// fileState identifies a version of the database files
+type fileState struct {
+	size, walSize int64
+	mod, walMod   time.Time
+}
+
+// Replicator uploads a snapshot whenever the database changes
+type Replicator struct {
+	cfg    *config.ReplicaConfig
+	store  store
+	db     Database
+	dbPath string
+
+	// runMu serializes syncs so scheduled and manual ones don't interleave
+	runMu sync.Mutex
+	last  fileState
+
+	mu     sync.RWMutex
+	status Status
+}
+
+// NewReplicator creates a Replicator for the database at dbPath. It does
+// nothing unless GOSIP_REPLICA_URL is set.
+func NewReplicator(cfg *config.Config, db Database, dbPath string) (*Replicator, error) {
+	r := &Replicator{
+		cfg:    cfg.Replica,
+		db:     db,
+		dbPath: dbPath,
+	}
+	if !r.Enabled() {
+		return r, nil
+	}
+
+	s, err := newStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	r.store = s
+	r.status = Status{Enabled: true, URL: cfg.Replica.URL}
+	return r, nil
+}
+
+// Enabled reports whether replication is configured
+func (r *Replicator) Enabled() bool {
+	return r != nil && r.cfg.Enabled()
+}
+
+// SetRestoredFrom records the snapshot the database was restored from
+func (r *Replicator) SetRestoredFrom(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.RestoredFrom = name
+}
+
+// Status returns the outcome of the last sync
+func (r *Replicator) Status() Status {
+	if r == nil {
+		return Status{}
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.status
+}
+
+// Start checks for changes every Interval and uploads a snapshot when
+// there are any
+func (r *Replicator) Start(ctx context.Context) {
+	if !r.Enabled() {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := r.Sync(ctx, false); err != nil {
+					slog.Warn("Database replication failed", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Sync uploads a snapshot if the database changed since the last one, or
+// always when force is set
+func (r *Replicator) Sync(ctx context.Context, force bool) (Status, error) {
+	if !r.Enabled() {
+		return r.Status(), errors.New("replication is off, set GOSIP_REPLICA_URL")
+	}
+
+	r.runMu.Lock()
+	defer r.runMu.Unlock()
+
+	state, err := r.fileState()
+	if err != nil {
+		return r.fail(err)
+	}
+	if !force && state == r.last {
+		return r.Status(), nil
+	}
+
+	data, err := r.snapshot(ctx)
+	if err != nil {
+		return r.fail(err)
+	}
+
+	name := snapshotPrefix + time.Now().UTC().Format("20060102T150405.000Z") + ".db.gz"
+	ctx, cancel := context.WithTimeout(ctx, config.ReplicaTimeout)
+	defer cancel()
+	if err := r.store.Put(ctx, name, data); err != nil {
+		return r.fail(err)
+	}
+	r.last = state
+
+	names, err := r.store.List(ctx, snapshotPrefix)
+	if err != nil {
+		return r.fail(err)
+	}
+	for len(names) > r.cfg.Retention {
+		if err := r.store.Delete(ctx, names[0]); err != nil {
+			slog.Warn("Failed to remove old database snapshot", "snapshot", names[0], "error", err)
+			break
+		}
+		names = names[1:]
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	r.status.LastSnapshot = strings.TrimPrefix(name, snapshotPrefix)
+	r.status.LastSize = int64(len(data))
+	r.status.ReplicatedAt = &now
+	r.status.Snapshots = len(names)
+	r.status.Error = ""
+	status := r.status
+	r.mu.Unlock()
+
+	slog.Debug("Database replicated", "snapshot", name, "size", len(data))
+	return status, nil
+}
+
+// Close uploads any last changes before shutdown
+func (r *Replicator) Close() {
+	if !r.Enabled() {
+		return
+	}
+	if _, err := r.Sync(context.Background(), false); err != nil {
+		slog.Warn("Final database replication failed", "error", err)
+	}
+}
+
+func (r *Replicator) fail(err error) (Status, error) {
+	r.mu.Lock()
+	r.status.Error = err.Error()
+	status := r.status
+	r.mu.Unlock()
+	return status, err
+}
+
+// fileState reads the size and modification time of the database and its
+// write-ahead log, which change with every commit
+func (r *Replicator) fileState() (fileState, error) {
+	var state fileState
+	info, err := os.Stat(r.dbPath)
+	if err != nil {
+		return state, err
+	}
+	state.size, state.mod = info.Size(), info.ModTime()
+	if info, err := os.Stat(r.dbPath + "-wal"); err == nil {
+		state.walSize, state.walMod = info.Size(), info.ModTime()
+	}
+	return state, nil
+}
+
+// snapshot copies the database and compresses the copy
+func (r *Replicator) snapshot(ctx context.Context) ([]byte, error) {
+	tmp := filepath.Join(filepath.Dir(r.dbPath), "replica_snapshot.db")
+	os.Remove(tmp)
+	defer os.Remove(tmp)
+
+	if err := r.db.Snapshot(ctx, tmp); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(tmp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.Copy(zw, f); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() > maxSnapshotSize {
+		return nil, fmt.Errorf("compressed snapshot is %d bytes, more than the %d byte limit", buf.Len(), maxSnapshotSize)
+	}
+	return buf.Bytes(), nil
+}
+
+// Restore downloads the latest snapshot to dbPath when there is no
+// database there yet, returning the snapshot's name. It returns "" when
+// replication or restoring is off, a database exists, or the replica is
+// empty.
+func Restore(ctx context.Context, cfg *config.Config, dbPath string) (string, error) {
+	if !cfg.Replica.Enabled() || !cfg.Replica.Restore {
+		return "", nil
+	}
+	if info, err := os.Stat(dbPath); err == nil && info.Size() > 0 {
+		return "", nil
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	s, err := newStore(cfg)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, config.ReplicaTimeout)
+	defer cancel()
+
+	names, err := s.List(ctx, snapshotPrefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	name := names[len(names)-1]
+
+	data, err := s.Get(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("invalid snapshot %s: %w", name, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return "", err
+	}
+	tmp := dbPath + ".restore"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, zr)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = checkIntegrity(tmp)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("invalid snapshot %s: %w", name, err)
+	}
+
+	// Leftover journal files belong to a different database
+	os.Remove(dbPath + "-wal")
+	os.Remove(dbPath + "-shm")
+	if err := os.Rename(tmp, dbPath); err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(name, snapshotPrefix), nil
+}
+
+// checkIntegrity opens a restored database and runs SQLite's integrity check
+func checkIntegrity(path string) error {
+	conn, err := sql.Open("sqlite3", path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var result string
+	if err := conn.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package replica
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/awssign"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+)
+
+func testConfig(url string) *config.Config {
+	return &config.Config{
+		Replica: &config.ReplicaConfig{URL: url, Interval: time.Second, Retention: 2, Restore: true},
+		Secrets: &config.SecretsConfig{AWSAccessKeyID: "AKID", AWSSecretAccessKey: "secret"},
+	}
+}
+
+func openDB(t *testing.T, path string) *db.DB {
+	t.Helper()
+	database, err := db.New(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+func TestReplicateAndRestore(t *testing.T) {
+	ctx := context.Background()
+	replicaDir := t.TempDir()
+	cfg := testConfig("file://" + replicaDir)
+
+	primaryPath := filepath.Join(t.TempDir(), "gosip.db")
+	primary := openDB(t, primaryPath)
+	r, err := NewReplicator(cfg, primary, primaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := r.Sync(ctx, false)
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	first := status.LastSnapshot
+	if first == "" || status.Snapshots != 1 {
+		t.Fatalf("Expected one snapshot, got %+v", status)
+	}
+
+	// Nothing changed, so nothing is uploaded
+	if status, _ = r.Sync(ctx, false); status.LastSnapshot != first {
+		t.Errorf("Expected no new snapshot without changes, got %s", status.LastSnapshot)
+	}
+
+	for i, tz := range []string{"Europe/Berlin", "Asia/Tokyo"} {
+		time.Sleep(10 * time.Millisecond) // Snapshot names have millisecond precision
+		if err := primary.Config.Set(ctx, "timezone", tz); err != nil {
+			t.Fatal(err)
+		}
+		if status, err = r.Sync(ctx, false); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+		if status.LastSnapshot == first {
+			t.Errorf("Change %d wasn't replicated", i)
+		}
+	}
+	if status.Snapshots != 2 {
+		t.Errorf("Snapshots = %d, want the retention of 2", status.Snapshots)
+	}
+
+	// A new container with an empty volume restores the latest snapshot
+	standbyPath := filepath.Join(t.TempDir(), "data", "gosip.db")
+	name, err := Restore(ctx, cfg, standbyPath)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if name != status.LastSnapshot {
+		t.Errorf("Restored %s, want %s", name, status.LastSnapshot)
+	}
+	standby := openDB(t, standbyPath)
+	if tz, _ := standby.Config.Get(ctx, "timezone"); tz != "Asia/Tokyo" {
+		t.Errorf("Restored timezone = %q, want Asia/Tokyo", tz)
+	}
+
+	// An existing database is left alone
+	if name, err := Restore(ctx, cfg, primaryPath); err != nil || name != "" {
+		t.Errorf("Restore() over an existing database = %q, %v", name, err)
+	}
+}
+
+func TestRestoreEmptyReplica(t *testing.T) {
+	cfg := testConfig("file://" + t.TempDir())
+	name, err := Restore(context.Background(), cfg, filepath.Join(t.TempDir(), "gosip.db"))
+	if err != nil || name != "" {
+		t.Errorf("Restore() = %q, %v, want nothing restored", name, err)
+	}
+}
+
+// fakeS3 serves path-style requests from memory
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") || r.Header.Get("X-Amz-Content-Sha256") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`))
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/bucket":
+		var keys []string
+		for k := range f.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		w.Write([]byte(`<ListBucketResult>`))
+		for _, k := range keys {
+			w.Write([]byte(`<Contents><Key>` + k + `</Key></Contents>`))
+		}
+		w.Write([]byte(`</ListBucketResult>`))
+	case r.Method == http.MethodPut:
+		f.objects[key], _ = io.ReadAll(r.Body)
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s, err := newStore(testConfig("s3://bucket/gosip/primary?endpoint=" + server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, name := range []string{"snapshots/b.db.gz", "snapshots/a.db.gz"} {
+		if err := s.Put(ctx, name, []byte(name)); err != nil {
+			t.Fatalf("Put(%s) error = %v", name, err)
+		}
+	}
+	if _, ok := fake.objects["gosip/primary/snapshots/a.db.gz"]; !ok {
+		t.Errorf("Expected keys under the URL's prefix, got %v", fake.objects)
+	}
+
+	names, err := s.List(ctx, snapshotPrefix)
+	if err != nil || len(names) != 2 || names[0] != "snapshots/a.db.gz" {
+		t.Fatalf("List() = %v, %v", names, err)
+	}
+	if data, err := s.Get(ctx, names[1]); err != nil || string(data) != "snapshots/b.db.gz" {
+		t.Errorf("Get() = %q, %v", data, err)
+	}
+	if err := s.Delete(ctx, names[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, names[0]); err != errNotFound {
+		t.Errorf("Get() of a deleted snapshot error = %v, want errNotFound", err)
+	}
+
+	s.(*s3Store).creds.Static = awssign.Credentials{AccessKeyID: "OTHER", SecretAccessKey: "secret"}
+	if err := s.Put(ctx, "snapshots/c.db.gz", nil); err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("Put() with the wrong key error = %v, want AccessDenied", err)
+	}
+}
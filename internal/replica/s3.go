@@ -0,0 +1,138 @@
+package replica
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/awssign"
+)
+
+// s3Store keeps snapshots in an S3 bucket or an S3-compatible store such
+// as MinIO or Backblaze B2
+type s3Store struct {
+	bucket string
+	prefix string // Key prefix, without slashes at either end
+	region string
+	// endpoint is set for S3-compatible stores, which are addressed
+	// path-style: endpoint/bucket/key
+	endpoint string
+	creds    *awssign.Provider
+	client   *http.Client
+}
+
+// url returns the address of a key, with an already canonical query
+func (s *s3Store) url(key, query string) string {
+	var u string
+	if s.endpoint != "" {
+		u = s.endpoint + "/" + s.bucket
+		if key != "" {
+			u += "/" + key
+		}
+	} else {
+		u = "https://" + s.bucket + ".s3." + s.region + ".amazonaws.com/" + key
+	}
+	if query != "" {
+		u += "?" + query
+	}
+	return u
+}
+
+func (s *s3Store) key(name string) string {
+	if s.prefix == "" {
+		return name
+	}
+	return s.prefix + "/" + name
+}
+
+// do sends a signed request and returns the response body, failing on
+// error statuses
+func (s *s3Store) do(ctx context.Context, method, u string, body []byte) ([]byte, int, error) {
+	creds, err := s.creds.Credentials(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("s3: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	req.Header.Set("X-Amz-Content-Sha256", awssign.PayloadHash(body))
+	awssign.Sign(req, body, creds, s.region, "s3", time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("s3: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := readAll(resp.Body, maxSnapshotSize)
+	if err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("s3: reading response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		var s3Err struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		if xml.Unmarshal(data, &s3Err) == nil && s3Err.Code != "" {
+			return nil, resp.StatusCode, fmt.Errorf("s3: %s %s: %s (%s)", method, u, s3Err.Code, s3Err.Message)
+		}
+		return nil, resp.StatusCode, fmt.Errorf("s3: %s %s: %s", method, u, resp.Status)
+	}
+	return data, resp.StatusCode, nil
+}
+
+func (s *s3Store) Put(ctx context.Context, name string, data []byte) error {
+	if data == nil {
+		data = []byte{}
+	}
+	_, _, err := s.do(ctx, http.MethodPut, s.url(s.key(name), ""), data)
+	return err
+}
+
+func (s *s3Store) Get(ctx context.Context, name string) ([]byte, error) {
+	data, status, err := s.do(ctx, http.MethodGet, s.url(s.key(name), ""), nil)
+	if status == http.StatusNotFound {
+		return nil, errNotFound
+	}
+	return data, err
+}
+
+func (s *s3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	query := awssign.CanonicalQuery(map[string]string{"list-type": "2", "prefix": s.key(prefix)})
+	data, _, err := s.do(ctx, http.MethodGet, s.url("", query), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Contents []struct {
+			Key string `xml:"Key"`
+		} `xml:"Contents"`
+	}
+	if err := xml.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("s3: invalid listing: %w", err)
+	}
+	// Keys are returned in order
+	names := make([]string, 0, len(result.Contents))
+	for _, c := range result.Contents {
+		name := c.Key
+		if s.prefix != "" {
+			name = strings.TrimPrefix(name, s.prefix+"/")
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, name string) error {
+	_, _, err := s.do(ctx, http.MethodDelete, s.url(s.key(name), ""), nil)
+	return err
+}
@@ -0,0 +1,125 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/awssign"
+	"github.com/btafoya/gosip/internal/config"
+)
+
+// errNotFound is returned by Get for objects the store doesn't have
+var errNotFound = errors.New("not found")
+
+// store keeps snapshots somewhere other than this server's disk
+type store interface {
+	Put(ctx context.Context, name string, data []byte) error
+	Get(ctx context.Context, name string) ([]byte, error)
+	// List returns the names starting with prefix, sorted
+	List(ctx context.Context, prefix string) ([]string, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// newStore opens the store a replica URL names
+func newStore(cfg *config.Config) (store, error) {
+	u, err := url.Parse(cfg.Replica.URL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		return &fileStore{dir: u.Path}, nil
+	case "s3":
+		region := u.Query().Get("region")
+		if region == "" && cfg.Secrets != nil {
+			region = cfg.Secrets.AWSRegion
+		}
+		if region == "" {
+			region = "us-east-1"
+		}
+		client := &http.Client{Timeout: config.ReplicaTimeout}
+		return &s3Store{
+			bucket:   u.Host,
+			prefix:   strings.Trim(u.Path, "/"),
+			region:   region,
+			endpoint: strings.TrimRight(u.Query().Get("endpoint"), "/"),
+			creds:    awssign.NewProvider(cfg.Secrets, client),
+			client:   client,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported replica URL scheme %q", u.Scheme)
+}
+
+// fileStore keeps snapshots in a directory, such as a network mount
+type fileStore struct {
+	dir string
+}
+
+func (s *fileStore) Put(ctx context.Context, name string, data []byte) error {
+	path := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Write then rename so a standby never reads a partial snapshot
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *fileStore) Get(ctx context.Context, name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errNotFound
+	}
+	return data, err
+}
+
+func (s *fileStore) List(ctx context.Context, prefix string) ([]string, error) {
+	dir := filepath.Join(s.dir, filepath.FromSlash(prefix))
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && !strings.HasSuffix(e.Name(), ".tmp") {
+			names = append(names, prefix+e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *fileStore) Delete(ctx context.Context, name string) error {
+	err := os.Remove(filepath.Join(s.dir, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// readAll reads a response body up to limit bytes
+func readAll(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("larger than %d bytes", limit)
+	}
+	return data, nil
+}
@@ -0,0 +1,219 @@
+// Package reprocess recomputes the fields of historical CDRs that are
+// derived from the numbering plan and the rate table, so call history stays
+// consistent after DIDs, extensions or rates change
+package reprocess
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/rating"
+)
+
+// Options selects the CDRs to reprocess
+type Options struct {
+	Since  *time.Time
+	Until  *time.Time
+	DryRun bool // Report the changes without saving them
+}
+
+// FieldChange is one field a CDR would change
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// CDRChange lists the changes to one CDR
+type CDRChange struct {
+	CDRID   int64         `json:"cdr_id"`
+	CallSID string        `json:"call_sid,omitempty"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// Report is the outcome of a reprocessing run
+type Report struct {
+	DryRun  bool        `json:"dry_run"`
+	Scanned int         `json:"scanned"`
+	Changed int         `json:"changed"`
+	CDRs    []CDRChange `json:"cdrs"`
+	// Truncated is set when more CDRs changed than are listed
+	Truncated bool `json:"truncated"`
+}
+
+// Plan is the numbering plan CDRs are classified against
+type Plan struct {
+	dids    map[string]*models.DID // By E.164 number
+	devices map[string]bool        // Device usernames and extensions
+}
+
+// LoadPlan reads the current DIDs and devices
+func LoadPlan(ctx context.Context, database *db.DB) (*Plan, error) {
+	plan := &Plan{dids: make(map[string]*models.DID), devices: make(map[string]bool)}
+
+	dids, err := database.DIDs.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, did := range dids {
+		plan.dids[did.Number] = did
+	}
+
+	for offset := 0; ; offset += config.CDRReprocessBatchSize {
+		devices, err := database.Devices.List(ctx, config.CDRReprocessBatchSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, device := range devices {
+			plan.devices[device.Username] = true
+			if device.Extension != nil && *device.Extension != "" {
+				plan.devices[*device.Extension] = true
+			}
+		}
+		if len(devices) < config.CDRReprocessBatchSize {
+			return plan, nil
+		}
+	}
+}
+
+// did returns the DID with a number, in any common spelling
+func (p *Plan) did(number string) *models.DID {
+	if e164 := db.NormalizeE164(number); e164 != "" {
+		return p.dids[e164]
+	}
+	return nil
+}
+
+// Classify recomputes a CDR's direction, internal flag and DID in place and
+// returns what changed. Calls between two devices are internal outbound
+// calls with no DID. Calls to a DID are inbound and calls from one are
+// outbound; calls between two DIDs keep their direction. CDRs matching
+// neither are left alone.
+func (p *Plan) Classify(cdr *models.CDR) []FieldChange {
+	from, to := p.did(cdr.FromNumber), p.did(cdr.ToNumber)
+
+	direction, internal, did := cdr.Direction, cdr.Internal, cdr.DIDID
+	switch {
+	case from == nil && to == nil && p.devices[cdr.FromNumber] && p.devices[cdr.ToNumber]:
+		direction, internal, did = "outbound", true, nil
+	case to != nil && from == nil:
+		direction, internal, did = "inbound", false, &to.ID
+	case from != nil && to == nil:
+		direction, internal, did = "outbound", false, &from.ID
+	case from != nil && to != nil:
+		internal = false
+		if direction == "inbound" {
+			did = &to.ID
+		} else {
+			did = &from.ID
+		}
+	default:
+		return nil
+	}
+
+	var changes []FieldChange
+	if direction != cdr.Direction {
+		changes = append(changes, FieldChange{Field: "direction", Old: cdr.Direction, New: direction})
+		cdr.Direction = direction
+	}
+	if internal != cdr.Internal {
+		changes = append(changes, FieldChange{Field: "internal", Old: strconv.FormatBool(cdr.Internal), New: strconv.FormatBool(internal)})
+		cdr.Internal = internal
+	}
+	if didString(did) != didString(cdr.DIDID) {
+		changes = append(changes, FieldChange{Field: "did_id", Old: didString(cdr.DIDID), New: didString(did)})
+		cdr.DIDID = did
+	}
+	return changes
+}
+
+// Rate re-estimates the cost of an ended outbound call in place and
+// returns the change, if any. Other calls cost nothing.
+func Rate(table *rating.Table, cdr *models.CDR) []FieldChange {
+	var cost *float64
+	if cdr.Direction == "outbound" && !cdr.Internal && cdr.EndedAt != nil {
+		cost = table.CallCost(cdr.ToNumber, cdr.Duration)
+	}
+	if costString(cost) == costString(cdr.EstimatedCost) {
+		return nil
+	}
+	change := FieldChange{Field: "estimated_cost", Old: costString(cdr.EstimatedCost), New: costString(cost)}
+	cdr.EstimatedCost = cost
+	return []FieldChange{change}
+}
+
+func costString(cost *float64) string {
+	if cost == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*cost, 'f', -1, 64)
+}
+
+func didString(id *int64) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatInt(*id, 10)
+}
+
+// Run reclassifies the selected CDRs against the current numbering plan
+// and re-estimates their cost when there is a rate table, saving the
+// changes unless it is a dry run
+func Run(ctx context.Context, database *db.DB, opts Options) (*Report, error) {
+	plan, err := LoadPlan(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	rates, err := rating.Load(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{DryRun: opts.DryRun, CDRs: []CDRChange{}}
+	filter := db.CDRFilter{StartDate: opts.Since, EndDate: opts.Until, Limit: config.CDRReprocessBatchSize}
+	for {
+		cdrs, err := database.CDRs.List(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, cdr := range cdrs {
+			report.Scanned++
+			changes := plan.Classify(cdr)
+			reclassified := len(changes) > 0
+			var costChanges []FieldChange
+			if !rates.Empty() {
+				costChanges = Rate(rates, cdr)
+				changes = append(changes, costChanges...)
+			}
+			if len(changes) == 0 {
+				continue
+			}
+			if !opts.DryRun {
+				if reclassified {
+					if err := database.CDRs.Update(ctx, cdr); err != nil {
+						return nil, err
+					}
+				}
+				if len(costChanges) > 0 {
+					if err := database.CDRs.SetEstimatedCost(ctx, cdr.ID, cdr.EstimatedCost); err != nil {
+						return nil, err
+					}
+				}
+			}
+			report.Changed++
+			if len(report.CDRs) < config.CDRReprocessMaxListed {
+				report.CDRs = append(report.CDRs, CDRChange{CDRID: cdr.ID, CallSID: cdr.CallSID, Changes: changes})
+			} else {
+				report.Truncated = true
+			}
+		}
+		if len(cdrs) < filter.Limit {
+			return report, nil
+		}
+		filter.Offset += filter.Limit
+	}
+}
@@ -0,0 +1,84 @@
+package reprocess
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/rating"
+)
+
+func TestClassify(t *testing.T) {
+	plan := &Plan{
+		dids:    map[string]*models.DID{"+15551234567": {ID: 1}, "+15550001111": {ID: 2}},
+		devices: map[string]bool{"alice": true, "101": true, "102": true},
+	}
+	didID := func(id int64) *int64 { return &id }
+
+	tests := []struct {
+		name string
+		cdr  models.CDR
+		want models.CDR
+	}{
+		{
+			"extension call",
+			models.CDR{Direction: "inbound", FromNumber: "alice", ToNumber: "102", DIDID: didID(1)},
+			models.CDR{Direction: "outbound", FromNumber: "alice", ToNumber: "102", Internal: true},
+		},
+		{
+			"call to a DID",
+			models.CDR{Direction: "outbound", FromNumber: "+15559876543", ToNumber: "5551234567", Internal: true},
+			models.CDR{Direction: "inbound", FromNumber: "+15559876543", ToNumber: "5551234567", DIDID: didID(1)},
+		},
+		{
+			"call from a DID",
+			models.CDR{Direction: "outbound", FromNumber: "+15550001111", ToNumber: "+15559876543", DIDID: didID(1)},
+			models.CDR{Direction: "outbound", FromNumber: "+15550001111", ToNumber: "+15559876543", DIDID: didID(2)},
+		},
+		{
+			"call between DIDs keeps its direction",
+			models.CDR{Direction: "inbound", FromNumber: "+15550001111", ToNumber: "+15551234567"},
+			models.CDR{Direction: "inbound", FromNumber: "+15550001111", ToNumber: "+15551234567", DIDID: didID(1)},
+		},
+		{
+			"unknown numbers are left alone",
+			models.CDR{Direction: "outbound", FromNumber: "bob", ToNumber: "+15559876543"},
+			models.CDR{Direction: "outbound", FromNumber: "bob", ToNumber: "+15559876543"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cdr := tt.cdr
+			changes := plan.Classify(&cdr)
+			if !reflect.DeepEqual(cdr, tt.want) {
+				t.Errorf("Classify() = %+v, want %+v", cdr, tt.want)
+			}
+			if (len(changes) == 0) != reflect.DeepEqual(tt.cdr, tt.want) {
+				t.Errorf("Unexpected changes %+v", changes)
+			}
+		})
+	}
+}
+
+func TestRate(t *testing.T) {
+	table := rating.NewTable([]*models.Rate{{Kind: "call", Prefix: "1", Rate: 0.014}})
+	ended := time.Now()
+	cost := func(c float64) *float64 { return &c }
+
+	cdr := &models.CDR{Direction: "outbound", ToNumber: "+15559876543", Duration: 90, EndedAt: &ended}
+	changes := Rate(table, cdr)
+	if len(changes) != 1 || changes[0] != (FieldChange{Field: "estimated_cost", Old: "", New: "0.028"}) {
+		t.Errorf("Rate() changes = %+v", changes)
+	}
+	if changes := Rate(table, cdr); len(changes) != 0 {
+		t.Errorf("Rate() on a rated CDR changes = %+v, want none", changes)
+	}
+
+	internal := &models.CDR{Direction: "outbound", Internal: true, ToNumber: "102", EndedAt: &ended, EstimatedCost: cost(0.014)}
+	changes = Rate(table, internal)
+	if len(changes) != 1 || changes[0].New != "" || internal.EstimatedCost != nil {
+		t.Errorf("Rate() on an internal call changes = %+v, cost = %v", changes, internal.EstimatedCost)
+	}
+}
@@ -0,0 +1,219 @@
+// Package retry applies the retry policies of background workers and keeps
+// statistics on how each worker fares
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+)
+
+// Worker is a background worker that retries failed operations
+type Worker struct {
+	name string
+
+	mu     sync.Mutex
+	policy *config.RetryPolicy // nil for workers that retry on their own schedule
+	stats  Stats
+}
+
+// Stats counts a worker's attempts since the server started
+type Stats struct {
+	Attempts      int64      `json:"attempts"`
+	Successes     int64      `json:"successes"`
+	Failures      int64      `json:"failures"`
+	Retries       int64      `json:"retries"` // Failures followed by another attempt
+	GaveUp        int64      `json:"gave_up"` // Operations abandoned after the last attempt
+	LastError     string     `json:"last_error,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	LastFailureAt *time.Time `json:"last_failure_at,omitempty"`
+}
+
+// Snapshot is a worker's policy and statistics
+type Snapshot struct {
+	Name string `json:"name"`
+	// Policy is empty for workers that retry on their own schedule
+	Policy string `json:"policy,omitempty"`
+	Stats
+}
+
+var (
+	mu       sync.Mutex
+	policies = config.DefaultRetryPolicies
+	workers  = map[string]*Worker{}
+)
+
+// Configure sets the policies workers retry with, by worker name. Workers
+// without a policy keep their default.
+func Configure(p map[string]config.RetryPolicy) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	policies = make(map[string]config.RetryPolicy, len(config.DefaultRetryPolicies))
+	for name, def := range config.DefaultRetryPolicies {
+		policies[name] = def
+	}
+	for name, policy := range p {
+		policies[name] = policy
+	}
+	for name, w := range workers {
+		w.setPolicy(policies[name])
+	}
+}
+
+// For returns the named worker
+func For(name string) *Worker {
+	mu.Lock()
+	defer mu.Unlock()
+	return worker(name)
+}
+
+// worker returns the named worker, creating it with its policy the first
+// time. mu must be held.
+func worker(name string) *Worker {
+	w, ok := workers[name]
+	if !ok {
+		w = &Worker{name: name}
+		if policy, ok := policies[name]; ok {
+			w.policy = &policy
+		}
+		workers[name] = w
+	}
+	return w
+}
+
+// All returns a snapshot of every worker that has a policy or has run,
+// sorted by name
+func All() []Snapshot {
+	mu.Lock()
+	for name := range policies {
+		worker(name)
+	}
+	all := make([]*Worker, 0, len(workers))
+	for _, w := range workers {
+		all = append(all, w)
+	}
+	mu.Unlock()
+
+	snapshots := make([]Snapshot, 0, len(all))
+	for _, w := range all {
+		snapshots = append(snapshots, w.Snapshot())
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Name < snapshots[j].Name })
+	return snapshots
+}
+
+func (w *Worker) setPolicy(policy config.RetryPolicy) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.policy != nil {
+		w.policy = &policy
+	}
+}
+
+// Policy returns the worker's retry policy
+func (w *Worker) Policy() config.RetryPolicy {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.policy == nil {
+		return config.RetryPolicy{}
+	}
+	return *w.policy
+}
+
+// Snapshot returns the worker's policy and statistics
+func (w *Worker) Snapshot() Snapshot {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s := Snapshot{Name: w.name, Stats: w.stats}
+	if w.policy != nil {
+		s.Policy = w.policy.String()
+	}
+	return s
+}
+
+// Delay returns how long to wait after failures failed attempts in a row
+func (w *Worker) Delay(failures int) time.Duration {
+	return Delay(w.Policy(), failures)
+}
+
+// Exhausted reports whether an operation that failed attempts times should
+// be given up
+func (w *Worker) Exhausted(attempts int) bool {
+	p := w.Policy()
+	return p.MaxAttempts > 0 && attempts >= p.MaxAttempts
+}
+
+// Succeeded records a successful attempt
+func (w *Worker) Succeeded() {
+	now := time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stats.Attempts++
+	w.stats.Successes++
+	w.stats.LastSuccessAt = &now
+}
+
+// Failed records a failed attempt, and whether it is retried
+func (w *Worker) Failed(err error, retried bool) {
+	now := time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stats.Attempts++
+	w.stats.Failures++
+	if retried {
+		w.stats.Retries++
+	} else {
+		w.stats.GaveUp++
+	}
+	if err != nil {
+		w.stats.LastError = err.Error()
+	}
+	w.stats.LastFailureAt = &now
+}
+
+// Do calls fn until it succeeds, the policy runs out of attempts or ctx
+// ends, waiting between attempts. It returns the last error.
+func (w *Worker) Do(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			w.Succeeded()
+			return nil
+		}
+		if w.Exhausted(attempt) || ctx.Err() != nil {
+			w.Failed(err, false)
+			return fmt.Errorf("failed after %d attempts: %w", attempt, err)
+		}
+		w.Failed(err, true)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed after %d attempts: %w", attempt, err)
+		case <-time.After(w.Delay(attempt)):
+		}
+	}
+}
+
+// Delay returns how long policy waits after failures failed attempts in a
+// row
+func Delay(policy config.RetryPolicy, failures int) time.Duration {
+	if failures < 1 {
+		failures = 1
+	}
+	delay := float64(policy.Initial) * math.Pow(policy.Multiplier, float64(failures-1))
+	if max := float64(policy.Max); policy.Max > 0 && delay > max {
+		delay = max
+	}
+	if policy.Jitter > 0 {
+		delay -= delay * policy.Jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
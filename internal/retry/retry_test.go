@@ -0,0 +1,133 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+)
+
+// reset forgets every worker and sets policies
+func reset(t *testing.T, policies map[string]config.RetryPolicy) {
+	t.Helper()
+	mu.Lock()
+	workers = map[string]*Worker{}
+	mu.Unlock()
+	Configure(policies)
+	t.Cleanup(func() { Configure(nil) })
+}
+
+func TestDelay(t *testing.T) {
+	policy := config.RetryPolicy{Initial: time.Second, Max: 10 * time.Second, Multiplier: 3}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 3 * time.Second},
+		{3, 9 * time.Second},
+		{4, 10 * time.Second},
+		{500, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := Delay(policy, tt.failures); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := Delay(policy, 3); got < 4500*time.Millisecond || got > 9*time.Second {
+			t.Fatalf("Delay with jitter = %v, want between 4.5s and 9s", got)
+		}
+	}
+}
+
+func TestWorkerDo(t *testing.T) {
+	reset(t, map[string]config.RetryPolicy{
+		"test_do": {MaxAttempts: 3, Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 2},
+	})
+	w := For("test_do")
+
+	calls := 0
+	err := w.Do(context.Background(), func() error {
+		calls++
+		if calls < 2 {
+			return errors.New("busy")
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("Do() = %v after %d calls, want success on the second", err, calls)
+	}
+
+	calls = 0
+	failure := errors.New("down")
+	err = w.Do(context.Background(), func() error {
+		calls++
+		return failure
+	})
+	if !errors.Is(err, failure) || calls != 3 {
+		t.Fatalf("Do() = %v after %d calls, want the error after 3", err, calls)
+	}
+
+	s := w.Snapshot()
+	if s.Attempts != 5 || s.Successes != 1 || s.Failures != 4 || s.Retries != 3 || s.GaveUp != 1 || s.LastError != "down" {
+		t.Errorf("Unexpected stats %+v", s.Stats)
+	}
+	if s.LastSuccessAt == nil || s.LastFailureAt == nil {
+		t.Error("Expected the last success and failure times")
+	}
+}
+
+func TestWorkerDoStopsWithContext(t *testing.T) {
+	reset(t, map[string]config.RetryPolicy{
+		"test_ctx": {Initial: time.Hour, Max: time.Hour, Multiplier: 1},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	calls := 0
+	err := For("test_ctx").Do(ctx, func() error {
+		calls++
+		return errors.New("down")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Do() = %v after %d calls, want to stop waiting when ctx ends", err, calls)
+	}
+}
+
+func TestConfigureUpdatesWorkers(t *testing.T) {
+	reset(t, nil)
+	w := For(config.RetryWorkerTwilio)
+	if w.Policy() != config.DefaultRetryPolicies[config.RetryWorkerTwilio] {
+		t.Fatalf("Expected the default policy, got %+v", w.Policy())
+	}
+
+	custom := config.RetryPolicy{MaxAttempts: 7, Initial: time.Second, Max: time.Minute, Multiplier: 2, Jitter: 0.1}
+	Configure(map[string]config.RetryPolicy{config.RetryWorkerTwilio: custom})
+	if w.Policy() != custom || !w.Exhausted(7) || w.Exhausted(6) {
+		t.Errorf("Expected the new policy to apply to the existing worker, got %+v", w.Policy())
+	}
+}
+
+func TestAll(t *testing.T) {
+	reset(t, nil)
+	For(config.RetryWorkerACME).Failed(errors.New("rate limited"), true)
+
+	byName := map[string]Snapshot{}
+	for _, s := range All() {
+		byName[s.Name] = s
+	}
+	for name := range config.DefaultRetryPolicies {
+		if byName[name].Policy == "" {
+			t.Errorf("Expected %s to be listed with its policy", name)
+		}
+	}
+	if acme := byName[config.RetryWorkerACME]; acme.Policy != "" || acme.Retries != 1 {
+		t.Errorf("Expected acme without a policy of its own, got %+v", acme)
+	}
+}
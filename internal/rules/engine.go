@@ -3,12 +3,16 @@ package rules
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"math/rand"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/btafoya/gosip/internal/config"
 	"github.com/btafoya/gosip/internal/db"
 	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/pkg/sip"
 )
 
 // Engine evaluates call routing rules and determines actions
@@ -36,6 +40,11 @@ type CallContext struct {
 	CalledNumber string
 	DIDID        int64
 	Time         time.Time
+
+	// DeviceBusy reports whether a device is on a call with call waiting
+	// disabled. Ring routes whose devices are all busy are skipped so a
+	// later route can handle the busy case. Nil treats every device as free.
+	DeviceBusy func(deviceID int64) bool
 }
 
 // Action represents the action to take for a call
@@ -44,17 +53,129 @@ type Action struct {
 	Data       json.RawMessage // Action-specific data
 	RouteName  string          // Name of the matching route for logging
 	Priority   int             // Priority of the matching rule
+	AlertInfo  string          // Distinctive ring class for ring actions
 }
 
 // RingAction contains data for the "ring" action
 type RingAction struct {
-	Devices []int64 `json:"devices"`
-	Timeout int     `json:"timeout"`
+	Devices     []int64 `json:"devices"`
+	Timeout     int     `json:"timeout"`
+	AlertInfo   string  `json:"alert_info,omitempty"`   // Ring class sent in Alert-Info
+	MaxDuration int     `json:"max_duration,omitempty"` // Seconds the answered call may last
+	// MediaRelay anchors the call's media at GoSIP: "off", "nat" or
+	// "always". Empty uses the server's mode.
+	MediaRelay string `json:"media_relay,omitempty"`
+	// Record records the call's audio at GoSIP once it is answered
+	Record bool `json:"record,omitempty"`
 }
 
 // ForwardAction contains data for the "forward" action
 type ForwardAction struct {
-	Number string `json:"number"`
+	Number      string `json:"number"`
+	MaxDuration int    `json:"max_duration,omitempty"`
+	// DetectVoicemail pulls calls answered by the forward target's voicemail,
+	// or not answered at all, back to GoSIP's own voicemail
+	DetectVoicemail bool `json:"detect_voicemail,omitempty"`
+}
+
+// OnCallAction contains data for the "oncall" action
+type OnCallAction struct {
+	ScheduleID  int64 `json:"schedule_id"`
+	MaxDuration int   `json:"max_duration,omitempty"`
+}
+
+// EscalateAction contains data for the "escalate" action
+type EscalateAction struct {
+	PolicyID    int64 `json:"policy_id"`
+	MaxDuration int   `json:"max_duration,omitempty"`
+}
+
+// RejectAction contains data for the "reject" action. Calls reach GoSIP
+// through Twilio, which can only tell the caller's carrier that a call was
+// busy or rejected: 486 and 480 play a busy signal, 603 and 404 a
+// disconnected number.
+type RejectAction struct {
+	SIPCode int    `json:"sip_code,omitempty"` // 603 (default), 486, 480 or 404
+	Reason  string `json:"reason,omitempty"`   // Reason header text, e.g. "Blocked caller"
+}
+
+// RejectCodes are the SIP responses a reject action may give, with their
+// reason phrases
+var RejectCodes = map[int]string{
+	603: "Decline",
+	486: "Busy Here",
+	480: "Temporarily Unavailable",
+	404: "Not Found",
+}
+
+// DefaultRejectCode is the response for reject actions that don't set one
+const DefaultRejectCode = 603
+
+// ParseRejectAction reads a reject action's data. Empty or unreadable data
+// rejects with the default code.
+func ParseRejectAction(data json.RawMessage) RejectAction {
+	var action RejectAction
+	if len(data) > 0 {
+		json.Unmarshal(data, &action)
+	}
+	if _, ok := RejectCodes[action.SIPCode]; !ok {
+		action.SIPCode = DefaultRejectCode
+	}
+	return action
+}
+
+// TwiMLReason returns the <Reject> reason Twilio signals the code with
+func (a RejectAction) TwiMLReason() string {
+	if a.SIPCode == 486 || a.SIPCode == 480 {
+		return "busy"
+	}
+	return "rejected"
+}
+
+// ReasonHeader returns the Reason header value for the rejection (RFC 3326)
+func (a RejectAction) ReasonHeader() string {
+	text := a.Reason
+	if text == "" {
+		text = RejectCodes[a.SIPCode]
+	}
+	return fmt.Sprintf(`SIP;cause=%d;text="%s"`, a.SIPCode, text)
+}
+
+// MaxDuration returns the number of seconds a call answered through the
+// route may last: the route's own limit, or fallback when it has none
+func MaxDuration(route *models.Route, fallback int) int {
+	var data struct {
+		MaxDuration int `json:"max_duration"`
+	}
+	if len(route.ActionData) > 0 && json.Unmarshal(route.ActionData, &data) == nil && data.MaxDuration > 0 {
+		return data.MaxDuration
+	}
+	return fallback
+}
+
+// MediaRelay returns the media relay mode a ring route chooses for its
+// calls, or an empty string to use the server's
+func MediaRelay(route *models.Route) string {
+	if route.ActionType != "ring" {
+		return ""
+	}
+	var action RingAction
+	if err := json.Unmarshal(route.ActionData, &action); err != nil {
+		return ""
+	}
+	return action.MediaRelay
+}
+
+// Record reports whether a ring route records its calls
+func Record(route *models.Route) bool {
+	if route.ActionType != "ring" {
+		return false
+	}
+	var action RingAction
+	if err := json.Unmarshal(route.ActionData, &action); err != nil {
+		return false
+	}
+	return action.Record
 }
 
 // Evaluate evaluates all rules for the given call context and returns the action
@@ -68,6 +189,13 @@ func (e *Engine) Evaluate(ctx context.Context, callCtx *CallContext) (*Action, e
 		}, nil
 	}
 
+	// Schedules are evaluated in the DID's timezone when it has one
+	loc := e.timezone
+	did, didErr := e.database.DIDs.GetByID(ctx, callCtx.DIDID)
+	if didErr == nil {
+		loc = LoadLocation(did.Timezone, e.timezone)
+	}
+
 	// Get active routes for this DID, ordered by priority
 	routes, err := e.database.Routes.GetEnabledByDID(ctx, callCtx.DIDID)
 	if err != nil {
@@ -89,14 +217,39 @@ func (e *Engine) Evaluate(ctx context.Context, callCtx *CallContext) (*Action, e
 
 	// Evaluate each rule
 	for _, route := range routes {
-		if e.evaluateCondition(route, callCtx) {
-			return &Action{
-				Type:      route.ActionType,
-				Data:      route.ActionData,
-				RouteName: route.Name,
-				Priority:  route.Priority,
-			}, nil
+		if route.ConditionType == "webhook" {
+			// The webhook may reject the call or send it to another route
+			route = MatchWebhookCondition(ctx, e.database.Routes, route, WebhookRequest{
+				CallerID:     callCtx.CallerID,
+				CalledNumber: callCtx.CalledNumber,
+				DIDID:        callCtx.DIDID,
+				Time:         callCtx.Time,
+			})
+			if route == nil {
+				continue
+			}
+		} else if !e.evaluateCondition(ctx, route, callCtx, loc) {
+			continue
 		}
+
+		// Split routes hand the call to one of their targets
+		if route.ActionType == "split" {
+			target, _, err := ResolveSplit(ctx, e.database.RouteSplits, route, rand.Intn(100))
+			if err != nil {
+				continue
+			}
+			route = target
+		}
+		if AllDevicesBusy(route, callCtx.DeviceBusy) {
+			continue
+		}
+		return &Action{
+			Type:      route.ActionType,
+			Data:      route.ActionData,
+			RouteName: route.Name,
+			Priority:  route.Priority,
+			AlertInfo: AlertInfo(ctx, e.database.CallerLists, route, callCtx.CallerID),
+		}, nil
 	}
 
 	// Default action: voicemail
@@ -106,27 +259,77 @@ func (e *Engine) Evaluate(ctx context.Context, callCtx *CallContext) (*Action, e
 	}, nil
 }
 
-func (e *Engine) evaluateCondition(route *models.Route, callCtx *CallContext) bool {
+func (e *Engine) evaluateCondition(ctx context.Context, route *models.Route, callCtx *CallContext, loc *time.Location) bool {
 	switch route.ConditionType {
 	case "default":
 		return true
 
 	case "callerid":
+		if IsCommunityCondition(route.ConditionData) {
+			listed, _, err := e.database.BlocklistFeeds.IsListed(ctx, callCtx.CallerID)
+			return err == nil && listed
+		}
 		return e.evaluateCallerIDCondition(route.ConditionData, callCtx.CallerID)
 
 	case "time":
-		return e.evaluateTimeCondition(route.ConditionData, callCtx.Time)
+		return MatchTimeCondition(route.ConditionData, callCtx.Time, loc)
+
+	case "calendar":
+		return MatchCalendarCondition(ctx, e.database.Calendars, route.ConditionData, callCtx.Time)
 
 	default:
 		return false
 	}
 }
 
+// AllDevicesBusy reports whether route is a ring action whose devices are
+// all busy. Routes without devices are never considered busy.
+func AllDevicesBusy(route *models.Route, busy func(deviceID int64) bool) bool {
+	if busy == nil || route.ActionType != "ring" {
+		return false
+	}
+
+	var action RingAction
+	if err := json.Unmarshal(route.ActionData, &action); err != nil || len(action.Devices) == 0 {
+		return false
+	}
+	for _, deviceID := range action.Devices {
+		if !busy(deviceID) {
+			return false
+		}
+	}
+	return true
+}
+
+// AlertInfo returns the distinctive ring class for a call matched by route.
+// A ring action's own alert_info wins; otherwise the class of the first
+// caller list containing callerID is used. Non-ring routes never set one.
+func AlertInfo(ctx context.Context, lists *db.CallerListRepository, route *models.Route, callerID string) string {
+	if route.ActionType != "ring" {
+		return ""
+	}
+
+	var action RingAction
+	if err := json.Unmarshal(route.ActionData, &action); err == nil && action.AlertInfo != "" {
+		return action.AlertInfo
+	}
+
+	if lists == nil {
+		return ""
+	}
+	list, err := lists.Match(ctx, callerID)
+	if err != nil || list == nil {
+		return ""
+	}
+	return list.AlertInfo
+}
+
 // CallerIDCondition defines caller ID matching rules
 type CallerIDCondition struct {
 	Pattern     string `json:"pattern"`
 	MatchType   string `json:"match_type"` // exact, contains, prefix, regex
 	Anonymous   bool   `json:"anonymous"`  // Match anonymous/blocked callers
+	Community   bool   `json:"community"`  // Match callers on the community blocklist
 }
 
 func (e *Engine) evaluateCallerIDCondition(data json.RawMessage, callerID string) bool {
@@ -137,14 +340,7 @@ func (e *Engine) evaluateCallerIDCondition(data json.RawMessage, callerID string
 
 	// Check for anonymous caller
 	if condition.Anonymous {
-		anonymousPatterns := []string{"anonymous", "blocked", "private", "unavailable", "unknown", "restricted"}
-		callerLower := strings.ToLower(callerID)
-		for _, pattern := range anonymousPatterns {
-			if strings.Contains(callerLower, pattern) || callerID == "" {
-				return true
-			}
-		}
-		return false
+		return IsAnonymousCaller(callerID)
 	}
 
 	// Match based on match type
@@ -168,6 +364,34 @@ func (e *Engine) evaluateCallerIDCondition(data json.RawMessage, callerID string
 	}
 }
 
+// IsCommunityCondition reports whether a caller ID condition matches callers on
+// the community blocklist. Manual blocklist entries reject calls before any
+// route is evaluated, so community entries only act through such routes.
+func IsCommunityCondition(data json.RawMessage) bool {
+	var condition CallerIDCondition
+	if err := json.Unmarshal(data, &condition); err != nil {
+		return false
+	}
+	return condition.Community
+}
+
+// anonymousPatterns are caller ID values carriers use for withheld numbers
+var anonymousPatterns = []string{"anonymous", "blocked", "private", "unavailable", "unknown", "restricted"}
+
+// IsAnonymousCaller reports whether a caller ID is empty or a withheld-number placeholder
+func IsAnonymousCaller(callerID string) bool {
+	if strings.TrimSpace(callerID) == "" {
+		return true
+	}
+	callerLower := strings.ToLower(callerID)
+	for _, pattern := range anonymousPatterns {
+		if strings.Contains(callerLower, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
 // TimeCondition defines time-based routing rules
 type TimeCondition struct {
 	StartHour   int   `json:"start_hour"`   // 0-23
@@ -175,16 +399,36 @@ type TimeCondition struct {
 	Days        []int `json:"days"`         // 0=Sunday, 6=Saturday
 	BusinessHours bool `json:"business_hours"` // Use system business hours
 	AfterHours   bool `json:"after_hours"`    // Inverse of business hours
+	Timezone    string `json:"timezone,omitempty"` // IANA name, overrides the DID and engine timezone
+}
+
+// LoadLocation returns the named IANA timezone, or fallback when the name is empty or unknown
+func LoadLocation(name string, fallback *time.Location) *time.Location {
+	if name == "" {
+		return fallback
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fallback
+	}
+	return loc
 }
 
 func (e *Engine) evaluateTimeCondition(data json.RawMessage, callTime time.Time) bool {
+	return MatchTimeCondition(data, callTime, e.timezone)
+}
+
+// MatchTimeCondition reports whether callTime falls inside a time condition.
+// The wall clock is read in the condition's own timezone, falling back to loc,
+// so schedules follow daylight saving changes of their region.
+func MatchTimeCondition(data json.RawMessage, callTime time.Time, loc *time.Location) bool {
 	var condition TimeCondition
 	if err := json.Unmarshal(data, &condition); err != nil {
 		return false
 	}
 
-	// Convert to configured timezone
-	localTime := callTime.In(e.timezone)
+	// Convert to the schedule's timezone
+	localTime := callTime.In(LoadLocation(condition.Timezone, loc))
 	hour := localTime.Hour()
 	weekday := int(localTime.Weekday())
 
@@ -223,6 +467,28 @@ func (e *Engine) evaluateTimeCondition(data json.RawMessage, callTime time.Time)
 	}
 }
 
+// CalendarCondition matches calls by a user's linked calendar
+type CalendarCondition struct {
+	UserID int64 `json:"user_id"`
+	Free   bool  `json:"free,omitempty"` // Match while the user is free instead of busy
+}
+
+// MatchCalendarCondition reports whether the user's linked calendar shows
+// them as busy at t, or free when the condition asks for that. Users
+// without a synced calendar are free.
+func MatchCalendarCondition(ctx context.Context, calendars *db.CalendarRepository, data json.RawMessage, t time.Time) bool {
+	var condition CalendarCondition
+	if err := json.Unmarshal(data, &condition); err != nil {
+		return false
+	}
+
+	busy, err := calendars.IsUserBusy(ctx, condition.UserID, t)
+	if err != nil {
+		return false
+	}
+	return busy != condition.Free
+}
+
 // ParseAction parses action data into the appropriate struct
 func ParseAction(action *Action) (interface{}, error) {
 	switch action.Type {
@@ -240,7 +506,32 @@ func ParseAction(action *Action) (interface{}, error) {
 		}
 		return &forwardAction, nil
 
-	case "voicemail", "reject":
+	case "oncall":
+		var onCallAction OnCallAction
+		if err := json.Unmarshal(action.Data, &onCallAction); err != nil {
+			return nil, err
+		}
+		return &onCallAction, nil
+
+	case "escalate":
+		var escalateAction EscalateAction
+		if err := json.Unmarshal(action.Data, &escalateAction); err != nil {
+			return nil, err
+		}
+		return &escalateAction, nil
+
+	case "split":
+		var splitAction SplitAction
+		if err := json.Unmarshal(action.Data, &splitAction); err != nil {
+			return nil, err
+		}
+		return &splitAction, nil
+
+	case "reject":
+		rejectAction := ParseRejectAction(action.Data)
+		return &rejectAction, nil
+
+	case "voicemail":
 		return nil, nil
 
 	default:
@@ -277,13 +568,13 @@ func ValidateRule(route *models.Route) []string {
 	var errors []string
 
 	// Validate condition type
-	validConditions := map[string]bool{"default": true, "callerid": true, "time": true}
+	validConditions := map[string]bool{"default": true, "callerid": true, "time": true, "calendar": true, "webhook": true}
 	if !validConditions[route.ConditionType] {
 		errors = append(errors, "Invalid condition type: "+route.ConditionType)
 	}
 
 	// Validate action type
-	validActions := map[string]bool{"ring": true, "forward": true, "voicemail": true, "reject": true}
+	validActions := map[string]bool{"ring": true, "forward": true, "voicemail": true, "reject": true, "oncall": true, "escalate": true, "split": true}
 	if !validActions[route.ActionType] {
 		errors = append(errors, "Invalid action type: "+route.ActionType)
 	}
@@ -305,6 +596,26 @@ func ValidateRule(route *models.Route) []string {
 					errors = append(errors, "Day must be between 0 (Sunday) and 6 (Saturday)")
 				}
 			}
+			if condition.Timezone != "" {
+				if _, err := time.LoadLocation(condition.Timezone); err != nil {
+					errors = append(errors, "Unknown timezone: "+condition.Timezone)
+				}
+			}
+		}
+	}
+
+	if route.ConditionType == "calendar" {
+		var condition CalendarCondition
+		if err := json.Unmarshal(route.ConditionData, &condition); err != nil {
+			errors = append(errors, "Invalid calendar condition data")
+		} else if condition.UserID <= 0 {
+			errors = append(errors, "Calendar condition requires a user")
+		}
+	}
+
+	if route.ConditionType == "webhook" {
+		if _, err := ParseWebhookCondition(route.ConditionData); err != nil {
+			errors = append(errors, "Invalid webhook condition: "+err.Error())
 		}
 	}
 
@@ -320,6 +631,12 @@ func ValidateRule(route *models.Route) []string {
 			if action.Timeout < 0 || action.Timeout > 300 {
 				errors = append(errors, "Timeout must be between 0 and 300 seconds")
 			}
+			if action.AlertInfo != "" && !sip.ValidRingClass(action.AlertInfo) {
+				errors = append(errors, "Alert-Info ring class must be 1-32 letters, digits, '-' or '_'")
+			}
+			if action.MediaRelay != "" && !config.ValidMediaRelayMode(action.MediaRelay) {
+				errors = append(errors, "Media relay must be off, nat or always")
+			}
 		}
 	}
 
@@ -334,9 +651,67 @@ func ValidateRule(route *models.Route) []string {
 		}
 	}
 
+	if route.ActionType == "reject" && len(route.ActionData) > 0 {
+		var action RejectAction
+		if err := json.Unmarshal(route.ActionData, &action); err != nil {
+			errors = append(errors, "Invalid reject action data: "+err.Error())
+		} else {
+			if _, ok := RejectCodes[action.SIPCode]; action.SIPCode != 0 && !ok {
+				errors = append(errors, "Reject SIP code must be 603, 486, 480 or 404")
+			}
+			if !ValidRejectReason(action.Reason) {
+				errors = append(errors, "Reject reason must be at most 128 printable characters without quotes")
+			}
+		}
+	}
+
+	if route.ActionType == "oncall" {
+		var action OnCallAction
+		if err := json.Unmarshal(route.ActionData, &action); err != nil {
+			errors = append(errors, "Invalid oncall action data")
+		} else if action.ScheduleID <= 0 {
+			errors = append(errors, "Oncall action requires a schedule")
+		}
+	}
+
+	if route.ActionType == "escalate" {
+		var action EscalateAction
+		if err := json.Unmarshal(route.ActionData, &action); err != nil {
+			errors = append(errors, "Invalid escalate action data")
+		} else if action.PolicyID <= 0 {
+			errors = append(errors, "Escalate action requires a policy")
+		}
+	}
+
+	if route.ActionType == "split" {
+		errors = append(errors, ValidateSplitAction(route.ActionData)...)
+	}
+
+	var limit struct {
+		MaxDuration int `json:"max_duration"`
+	}
+	if len(route.ActionData) > 0 && json.Unmarshal(route.ActionData, &limit) == nil &&
+		(limit.MaxDuration < 0 || limit.MaxDuration > config.MaxRouteCallDuration) {
+		errors = append(errors, fmt.Sprintf("Max duration must be between 0 and %d seconds", config.MaxRouteCallDuration))
+	}
+
 	return errors
 }
 
+// ValidRejectReason reports whether text fits in a Reason header's quoted
+// text
+func ValidRejectReason(text string) bool {
+	if len(text) > 128 {
+		return false
+	}
+	for _, r := range text {
+		if r < ' ' || r == '"' || r == '\\' || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
 // PresetRule represents a preset routing rule template
 type PresetRule struct {
 	Name          string
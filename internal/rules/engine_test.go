@@ -3,6 +3,7 @@ package rules
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"testing"
 	"time"
 
@@ -364,6 +365,22 @@ func TestEngine_Evaluate_Blocklist(t *testing.T) {
 	}
 }
 
+func TestIsAnonymousCaller(t *testing.T) {
+	tests := map[string]bool{
+		"":             true,
+		"Anonymous":    true,
+		"+266696687":   false,
+		"unavailable":  true,
+		"+15551234567": false,
+	}
+
+	for callerID, expected := range tests {
+		if got := IsAnonymousCaller(callerID); got != expected {
+			t.Errorf("IsAnonymousCaller(%q) = %v, want %v", callerID, got, expected)
+		}
+	}
+}
+
 func TestEngine_Evaluate_DefaultToVoicemail(t *testing.T) {
 	database := setupTestDB(t)
 	engine := NewEngine(database, "UTC")
@@ -392,6 +409,63 @@ func TestEngine_Evaluate_DefaultToVoicemail(t *testing.T) {
 	}
 }
 
+func TestEngine_Evaluate_CommunityBlocklist(t *testing.T) {
+	database := setupTestDB(t)
+	engine := NewEngine(database, "UTC")
+	ctx := context.Background()
+
+	did := createTestDID(t, database, "+15551234567")
+
+	feed := &models.BlocklistFeed{Name: "Spam Feed", URL: "https://feeds.example.com/spam.txt", Enabled: true}
+	if err := database.BlocklistFeeds.Create(ctx, feed); err != nil {
+		t.Fatalf("Failed to create feed: %v", err)
+	}
+	if err := database.BlocklistFeeds.RecordSuccess(ctx, feed.ID, []string{"+15558888888", "+15559999999"}); err != nil {
+		t.Fatalf("Failed to record feed numbers: %v", err)
+	}
+
+	// Manual entries take precedence over routes consulting the community tier
+	database.Blocklist.Create(ctx, &models.BlocklistEntry{Pattern: "+15559999999", PatternType: "exact"})
+
+	createTestRoute(t, database, &models.Route{
+		Name:          "Community Spam",
+		DIDID:         &did.ID,
+		Priority:      1,
+		Enabled:       true,
+		ConditionType: "callerid",
+		ConditionData: json.RawMessage(`{"community": true}`),
+		ActionType:    "voicemail",
+	})
+
+	tests := []struct {
+		callerID  string
+		wantType  string
+		wantRoute string
+	}{
+		{"+15559999999", "reject", "Blocklist"},
+		{"+1 (555) 888-8888", "voicemail", "Community Spam"},
+		{"+15557777777", "voicemail", "Default"},
+	}
+
+	for _, tt := range tests {
+		action, err := engine.Evaluate(ctx, &CallContext{CallerID: tt.callerID, DIDID: did.ID, Time: time.Now()})
+		if err != nil {
+			t.Fatalf("Evaluate failed: %v", err)
+		}
+		if action.Type != tt.wantType || action.RouteName != tt.wantRoute {
+			t.Errorf("Caller %s: expected %s via %q, got %s via %q", tt.callerID, tt.wantType, tt.wantRoute, action.Type, action.RouteName)
+		}
+	}
+
+	// Disabled feeds no longer match
+	feed.Enabled = false
+	database.BlocklistFeeds.Update(ctx, feed)
+	action, _ := engine.Evaluate(ctx, &CallContext{CallerID: "+15558888888", DIDID: did.ID, Time: time.Now()})
+	if action.RouteName != "Default" {
+		t.Errorf("Expected disabled feed to be ignored, got route %q", action.RouteName)
+	}
+}
+
 func TestEngine_Evaluate_MatchingRoute(t *testing.T) {
 	database := setupTestDB(t)
 	engine := NewEngine(database, "UTC")
@@ -724,3 +798,471 @@ func TestAction(t *testing.T) {
 		t.Errorf("Priority mismatch")
 	}
 }
+
+func TestMatchTimeCondition_DST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	businessHours, _ := json.Marshal(TimeCondition{BusinessHours: true})
+	overnight, _ := json.Marshal(TimeCondition{StartHour: 22, EndHour: 6})
+
+	tests := []struct {
+		name     string
+		data     json.RawMessage
+		callTime time.Time
+		expected bool
+	}{
+		// 13:30 UTC is 08:30 EST before the March change and 09:30 EDT after it
+		{"friday before spring forward", businessHours, time.Date(2026, 3, 6, 13, 30, 0, 0, time.UTC), false},
+		{"monday after spring forward", businessHours, time.Date(2026, 3, 9, 13, 30, 0, 0, time.UTC), true},
+		// 13:30 UTC is 09:30 EDT before the November change and 08:30 EST after it
+		{"friday before fall back", businessHours, time.Date(2026, 10, 30, 13, 30, 0, 0, time.UTC), true},
+		{"monday after fall back", businessHours, time.Date(2026, 11, 2, 13, 30, 0, 0, time.UTC), false},
+		// 06:30 UTC is 01:30 EST, inside the overnight window on the night clocks change
+		{"overnight on spring forward night", overnight, time.Date(2026, 3, 8, 6, 30, 0, 0, time.UTC), true},
+		// 11:30 UTC is 07:30 EDT, after the overnight window
+		{"overnight ends after spring forward", overnight, time.Date(2026, 3, 8, 11, 30, 0, 0, time.UTC), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchTimeCondition(tt.data, tt.callTime, newYork); got != tt.expected {
+				t.Errorf("MatchTimeCondition() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMatchTimeCondition_ScheduleTimezone(t *testing.T) {
+	// Wednesday 16:30 UTC is 11:30 in New York and 08:30 in Los Angeles
+	callTime := time.Date(2024, 1, 10, 16, 30, 0, 0, time.UTC)
+
+	losAngeles, _ := json.Marshal(TimeCondition{BusinessHours: true, Timezone: "America/Los_Angeles"})
+	if MatchTimeCondition(losAngeles, callTime, time.UTC) {
+		t.Error("Expected schedule timezone to override the fallback location")
+	}
+
+	unknown, _ := json.Marshal(TimeCondition{BusinessHours: true, Timezone: "Mars/Olympus_Mons"})
+	if !MatchTimeCondition(unknown, callTime, time.UTC) {
+		t.Error("Expected unknown schedule timezone to fall back to the given location")
+	}
+}
+
+func TestEvaluate_PerDIDTimezone(t *testing.T) {
+	database := setupTestDB(t)
+	engine := NewEngine(database, "UTC")
+	ctx := context.Background()
+
+	// Wednesday 16:30 UTC is 11:30 in New York and 08:30 in Los Angeles
+	callTime := time.Date(2024, 1, 10, 16, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		number   string
+		timezone string
+		expected string
+	}{
+		{"+12125550100", "America/New_York", "ring"},
+		{"+13105550100", "America/Los_Angeles", "voicemail"},
+	}
+
+	for _, tt := range tests {
+		did := createTestDID(t, database, tt.number)
+		did.Timezone = tt.timezone
+		if err := database.DIDs.Update(ctx, did); err != nil {
+			t.Fatalf("Failed to update DID: %v", err)
+		}
+
+		createTestRoute(t, database, &models.Route{
+			DIDID:         &did.ID,
+			Name:          "Business Hours",
+			ConditionType: "time",
+			ConditionData: json.RawMessage(`{"business_hours": true}`),
+			ActionType:    "ring",
+			ActionData:    json.RawMessage(`{"devices": [1]}`),
+			Enabled:       true,
+		})
+
+		action, err := engine.Evaluate(ctx, &CallContext{CallerID: "+15559876543", DIDID: did.ID, Time: callTime})
+		if err != nil {
+			t.Fatalf("Evaluate() error: %v", err)
+		}
+		if action.Type != tt.expected {
+			t.Errorf("DID in %s: expected %s, got %s", tt.timezone, tt.expected, action.Type)
+		}
+	}
+}
+
+func TestValidateRule_Timezone(t *testing.T) {
+	route := &models.Route{
+		ConditionType: "time",
+		ConditionData: json.RawMessage(`{"start_hour": 9, "end_hour": 17, "timezone": "Nowhere/Invalid"}`),
+		ActionType:    "voicemail",
+	}
+
+	if errs := ValidateRule(route); len(errs) != 1 {
+		t.Errorf("Expected one validation error for unknown timezone, got %v", errs)
+	}
+}
+
+func TestEngine_Evaluate_BusyDevicesFallThrough(t *testing.T) {
+	database := setupTestDB(t)
+	engine := NewEngine(database, "UTC")
+	ctx := context.Background()
+
+	did := createTestDID(t, database, "+15551234567")
+	createTestRoute(t, database, &models.Route{
+		DIDID:         &did.ID,
+		Priority:      1,
+		Name:          "Ring desk phone",
+		ConditionType: "default",
+		ActionType:    "ring",
+		ActionData:    json.RawMessage(`{"devices": [1, 2]}`),
+		Enabled:       true,
+	})
+	createTestRoute(t, database, &models.Route{
+		DIDID:         &did.ID,
+		Priority:      2,
+		Name:          "Busy forward",
+		ConditionType: "default",
+		ActionType:    "forward",
+		ActionData:    json.RawMessage(`{"number": "+15550001111"}`),
+		Enabled:       true,
+	})
+
+	busy := map[int64]bool{1: true}
+	callCtx := &CallContext{
+		CallerID:   "+15559876543",
+		DIDID:      did.ID,
+		Time:       time.Now(),
+		DeviceBusy: func(id int64) bool { return busy[id] },
+	}
+
+	action, err := engine.Evaluate(ctx, callCtx)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if action.Type != "ring" {
+		t.Errorf("Expected ring while a device is free, got %s", action.Type)
+	}
+
+	busy[2] = true
+	action, err = engine.Evaluate(ctx, callCtx)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if action.Type != "forward" || action.RouteName != "Busy forward" {
+		t.Errorf("Expected busy calls to fall through to forward, got %s (%s)", action.Type, action.RouteName)
+	}
+}
+
+func TestAllDevicesBusy(t *testing.T) {
+	allBusy := func(int64) bool { return true }
+	ring := &models.Route{ActionType: "ring", ActionData: json.RawMessage(`{"devices": [1]}`)}
+
+	if !AllDevicesBusy(ring, allBusy) {
+		t.Error("Expected ring route to be busy")
+	}
+	if AllDevicesBusy(ring, nil) {
+		t.Error("Nil busy func should never report busy")
+	}
+	if AllDevicesBusy(&models.Route{ActionType: "voicemail"}, allBusy) {
+		t.Error("Non-ring routes should never be busy")
+	}
+	if AllDevicesBusy(&models.Route{ActionType: "ring", ActionData: json.RawMessage(`{"devices": []}`)}, allBusy) {
+		t.Error("Ring routes without devices should not be busy")
+	}
+}
+
+func TestEngine_Evaluate_AlertInfo(t *testing.T) {
+	database := setupTestDB(t)
+	engine := NewEngine(database, "UTC")
+	ctx := context.Background()
+
+	did := createTestDID(t, database, "+15551234567")
+	createTestRoute(t, database, &models.Route{
+		DIDID:         &did.ID,
+		Priority:      1,
+		Name:          "Ring desk phone",
+		ConditionType: "default",
+		ActionType:    "ring",
+		ActionData:    json.RawMessage(`{"devices": [1]}`),
+		Enabled:       true,
+	})
+	if err := database.CallerLists.Create(ctx, &models.CallerList{
+		Name:      "Family",
+		Numbers:   []string{"+15559876543"},
+		AlertInfo: "vip",
+	}); err != nil {
+		t.Fatalf("Failed to create caller list: %v", err)
+	}
+
+	tests := []struct {
+		callerID string
+		want     string
+	}{
+		{"+15559876543", "vip"},
+		{"+15550002222", ""},
+	}
+
+	for _, tt := range tests {
+		action, err := engine.Evaluate(ctx, &CallContext{CallerID: tt.callerID, DIDID: did.ID, Time: time.Now()})
+		if err != nil {
+			t.Fatalf("Evaluate failed: %v", err)
+		}
+		if action.AlertInfo != tt.want {
+			t.Errorf("caller %s: AlertInfo = %q, want %q", tt.callerID, action.AlertInfo, tt.want)
+		}
+	}
+}
+
+func TestValidateRule_AlertInfo(t *testing.T) {
+	route := &models.Route{
+		Name:          "Ring",
+		ConditionType: "default",
+		ActionType:    "ring",
+		ActionData:    json.RawMessage(`{"devices": [1], "alert_info": "not valid"}`),
+	}
+	if errs := ValidateRule(route); len(errs) != 1 {
+		t.Errorf("Expected one validation error for invalid ring class, got %v", errs)
+	}
+
+	route.ActionData = json.RawMessage(`{"devices": [1], "alert_info": "vip"}`)
+	if errs := ValidateRule(route); len(errs) != 0 {
+		t.Errorf("Expected valid ring class to pass, got %v", errs)
+	}
+}
+
+func TestEvaluate_CalendarCondition(t *testing.T) {
+	database := setupTestDB(t)
+	engine := NewEngine(database, "UTC")
+	ctx := context.Background()
+
+	user := &models.User{Email: "alice@example.com", PasswordHash: "hash", Role: "user"}
+	if err := database.Users.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	cal := &models.UserCalendar{UserID: user.ID, Provider: db.CalendarProviderCalDAV, URL: "https://dav.example.com/alice/", Enabled: true}
+	if err := database.Calendars.Save(ctx, cal); err != nil {
+		t.Fatalf("Failed to save calendar: %v", err)
+	}
+	meeting := time.Date(2024, 1, 10, 14, 0, 0, 0, time.UTC)
+	if err := database.Calendars.RecordSuccess(ctx, cal.ID, []models.BusyBlock{{Start: meeting, End: meeting.Add(time.Hour)}}); err != nil {
+		t.Fatalf("Failed to record busy blocks: %v", err)
+	}
+
+	did := createTestDID(t, database, "+15551234567")
+	createTestRoute(t, database, &models.Route{
+		DIDID:         &did.ID,
+		Priority:      1,
+		Name:          "In a meeting",
+		ConditionType: "calendar",
+		ConditionData: json.RawMessage(fmt.Sprintf(`{"user_id": %d}`, user.ID)),
+		ActionType:    "reject",
+		Enabled:       true,
+	})
+
+	tests := []struct {
+		name     string
+		time     time.Time
+		expected string
+	}{
+		{"during meeting", meeting.Add(15 * time.Minute), "reject"},
+		{"after meeting", meeting.Add(2 * time.Hour), "voicemail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := engine.Evaluate(ctx, &CallContext{CallerID: "+15559876543", DIDID: did.ID, Time: tt.time})
+			if err != nil {
+				t.Fatalf("Evaluate() error: %v", err)
+			}
+			if action.Type != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, action.Type)
+			}
+		})
+	}
+}
+
+func TestValidateRule_Calendar(t *testing.T) {
+	route := &models.Route{
+		ConditionType: "calendar",
+		ConditionData: json.RawMessage(`{"free": true}`),
+		ActionType:    "voicemail",
+	}
+
+	if errs := ValidateRule(route); len(errs) != 1 {
+		t.Errorf("Expected one validation error for missing user, got %v", errs)
+	}
+}
+
+func TestValidateRule_OnCall(t *testing.T) {
+	route := &models.Route{
+		ConditionType: "default",
+		ActionType:    "oncall",
+		ActionData:    json.RawMessage(`{"schedule_id": 1}`),
+	}
+	if errs := ValidateRule(route); len(errs) != 0 {
+		t.Errorf("Expected no validation errors, got %v", errs)
+	}
+
+	route.ActionData = json.RawMessage(`{}`)
+	if errs := ValidateRule(route); len(errs) != 1 {
+		t.Errorf("Expected one validation error for missing schedule, got %v", errs)
+	}
+}
+
+func TestValidateRule_Escalate(t *testing.T) {
+	route := &models.Route{
+		ConditionType: "default",
+		ActionType:    "escalate",
+		ActionData:    json.RawMessage(`{"policy_id": 1}`),
+	}
+	if errs := ValidateRule(route); len(errs) != 0 {
+		t.Errorf("Expected no validation errors, got %v", errs)
+	}
+
+	route.ActionData = json.RawMessage(`{"schedule_id": 1}`)
+	if errs := ValidateRule(route); len(errs) != 1 {
+		t.Errorf("Expected one validation error for missing policy, got %v", errs)
+	}
+}
+
+func TestValidateRule_Reject(t *testing.T) {
+	route := &models.Route{
+		ConditionType: "default",
+		ActionType:    "reject",
+		ActionData:    json.RawMessage(`{"sip_code": 486, "reason": "Blocked caller"}`),
+	}
+	if errs := ValidateRule(route); len(errs) != 0 {
+		t.Errorf("Expected no validation errors, got %v", errs)
+	}
+
+	for _, data := range []string{`{"sip_code": 500}`, `{"reason": "say \"no\""}`} {
+		route.ActionData = json.RawMessage(data)
+		if errs := ValidateRule(route); len(errs) != 1 {
+			t.Errorf("Expected one validation error for %s, got %v", data, errs)
+		}
+	}
+}
+
+func TestParseRejectAction(t *testing.T) {
+	tests := []struct {
+		data   string
+		twiml  string
+		reason string
+	}{
+		{``, "rejected", `SIP;cause=603;text="Decline"`},
+		{`{"sip_code": 486}`, "busy", `SIP;cause=486;text="Busy Here"`},
+		{`{"sip_code": 480, "reason": "Closed"}`, "busy", `SIP;cause=480;text="Closed"`},
+		{`{"sip_code": 404}`, "rejected", `SIP;cause=404;text="Not Found"`},
+		{`{"sip_code": 200}`, "rejected", `SIP;cause=603;text="Decline"`},
+	}
+
+	for _, tt := range tests {
+		action := ParseRejectAction(json.RawMessage(tt.data))
+		if got := action.TwiMLReason(); got != tt.twiml {
+			t.Errorf("TwiMLReason(%s) = %q, want %q", tt.data, got, tt.twiml)
+		}
+		if got := action.ReasonHeader(); got != tt.reason {
+			t.Errorf("ReasonHeader(%s) = %q, want %q", tt.data, got, tt.reason)
+		}
+	}
+}
+
+func TestMaxDuration(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want int
+	}{
+		{"route limit", `{"devices":[1],"max_duration":600}`, 600},
+		{"no route limit", `{"devices":[1]}`, 3600},
+		{"no action data", ``, 3600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &models.Route{ActionType: "ring", ActionData: json.RawMessage(tt.data)}
+			if got := MaxDuration(route, 3600); got != tt.want {
+				t.Errorf("MaxDuration() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMediaRelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		data   string
+		want   string
+	}{
+		{"ring route mode", "ring", `{"devices":[1],"media_relay":"always"}`, "always"},
+		{"ring route without mode", "ring", `{"devices":[1]}`, ""},
+		{"other actions", "forward", `{"number":"+15551234567","media_relay":"always"}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &models.Route{ActionType: tt.action, ActionData: json.RawMessage(tt.data)}
+			if got := MediaRelay(route); got != tt.want {
+				t.Errorf("MediaRelay() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	route := &models.Route{
+		ConditionType: "default",
+		ActionType:    "ring",
+		ActionData:    json.RawMessage(`{"devices": [1], "media_relay": "sometimes"}`),
+	}
+	if errs := ValidateRule(route); len(errs) != 1 {
+		t.Errorf("Expected one validation error for an unknown relay mode, got %v", errs)
+	}
+	route.ActionData = json.RawMessage(`{"devices": [1], "media_relay": "nat"}`)
+	if errs := ValidateRule(route); len(errs) != 0 {
+		t.Errorf("Expected nat to pass, got %v", errs)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		data   string
+		want   bool
+	}{
+		{"recorded ring route", "ring", `{"devices":[1],"record":true}`, true},
+		{"ring route", "ring", `{"devices":[1]}`, false},
+		{"other actions", "forward", `{"number":"+15551234567","record":true}`, false},
+		{"bad action data", "ring", `{"devices":`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &models.Route{ActionType: tt.action, ActionData: json.RawMessage(tt.data)}
+			if got := Record(route); got != tt.want {
+				t.Errorf("Record() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRule_MaxDuration(t *testing.T) {
+	route := &models.Route{
+		ConditionType: "default",
+		ActionType:    "forward",
+		ActionData:    json.RawMessage(`{"number": "+15551234567", "max_duration": 1800}`),
+	}
+	if errs := ValidateRule(route); len(errs) != 0 {
+		t.Errorf("Expected no validation errors, got %v", errs)
+	}
+
+	for _, data := range []string{`{"number": "+15551234567", "max_duration": -1}`, `{"number": "+15551234567", "max_duration": 86401}`} {
+		route.ActionData = json.RawMessage(data)
+		if errs := ValidateRule(route); len(errs) != 1 {
+			t.Errorf("Expected one validation error for %s, got %v", data, errs)
+		}
+	}
+}
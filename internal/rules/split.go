@@ -0,0 +1,142 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// Split modes
+const (
+	SplitPercent    = "percent"     // Each call goes to a random target, weighted by percent
+	SplitRoundRobin = "round_robin" // Each call goes to the target that received the fewest calls
+)
+
+// MaxSplitTargets is the most targets a split action can have
+const MaxSplitTargets = 10
+
+// SplitAction contains data for the "split" action, which distributes
+// calls across other actions
+type SplitAction struct {
+	Mode    string        `json:"mode"` // "percent" (default) or "round_robin"
+	Targets []SplitTarget `json:"targets"`
+}
+
+// SplitTarget is one action a split action sends calls to
+type SplitTarget struct {
+	Label      string          `json:"label,omitempty"`
+	Percent    int             `json:"percent,omitempty"` // Share of calls in percent mode
+	ActionType string          `json:"action_type"`       // Any action type except split
+	ActionData json.RawMessage `json:"action_data,omitempty"`
+}
+
+// Route returns a copy of the split route that takes the target's action
+func (t SplitTarget) Route(route *models.Route) *models.Route {
+	target := *route
+	target.ActionType = t.ActionType
+	target.ActionData = t.ActionData
+	return &target
+}
+
+// ChooseSplitTarget returns the index of the target the next call goes to.
+// calls holds the calls each target received so far. roll is a random
+// number from 0 to 99, used in percent mode.
+func ChooseSplitTarget(action *SplitAction, calls []int64, roll int) int {
+	if action.Mode == SplitRoundRobin {
+		chosen := 0
+		for i := range action.Targets {
+			if callsAt(calls, i) < callsAt(calls, chosen) {
+				chosen = i
+			}
+		}
+		return chosen
+	}
+
+	for i, t := range action.Targets {
+		if roll < t.Percent {
+			return i
+		}
+		roll -= t.Percent
+	}
+	return len(action.Targets) - 1
+}
+
+func callsAt(calls []int64, i int) int64 {
+	if i < len(calls) {
+		return calls[i]
+	}
+	return 0
+}
+
+// ResolveSplit chooses the target of a split route for a call and counts
+// the call. It returns the route with the target's action and the target's
+// index. roll is a random number from 0 to 99.
+func ResolveSplit(ctx context.Context, splits *db.RouteSplitRepository, route *models.Route, roll int) (*models.Route, int, error) {
+	var action SplitAction
+	if err := json.Unmarshal(route.ActionData, &action); err != nil {
+		return nil, 0, err
+	}
+	if len(action.Targets) == 0 {
+		return nil, 0, fmt.Errorf("split route %d has no targets", route.ID)
+	}
+
+	var calls []int64
+	if action.Mode == SplitRoundRobin {
+		counts, err := splits.Counts(ctx, route.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		calls = make([]int64, len(action.Targets))
+		for _, c := range counts {
+			if c.Target < len(calls) {
+				calls[c.Target] = c.Calls
+			}
+		}
+	}
+
+	chosen := ChooseSplitTarget(&action, calls, roll)
+	if err := splits.Increment(ctx, route.ID, chosen, time.Now()); err != nil {
+		return nil, 0, err
+	}
+	return action.Targets[chosen].Route(route), chosen, nil
+}
+
+// ValidateSplitAction checks the data of a split action
+func ValidateSplitAction(data json.RawMessage) []string {
+	var action SplitAction
+	if err := json.Unmarshal(data, &action); err != nil {
+		return []string{"Invalid split action data"}
+	}
+
+	var errors []string
+	if action.Mode != "" && action.Mode != SplitPercent && action.Mode != SplitRoundRobin {
+		errors = append(errors, "Split mode must be percent or round_robin")
+	}
+	if len(action.Targets) < 2 || len(action.Targets) > MaxSplitTargets {
+		errors = append(errors, fmt.Sprintf("Split action requires 2-%d targets", MaxSplitTargets))
+	}
+
+	total := 0
+	for i, t := range action.Targets {
+		if t.ActionType == "split" {
+			errors = append(errors, fmt.Sprintf("Split target %d can't be another split", i+1))
+			continue
+		}
+		target := &models.Route{ConditionType: "default", ActionType: t.ActionType, ActionData: t.ActionData}
+		for _, err := range ValidateRule(target) {
+			errors = append(errors, fmt.Sprintf("Split target %d: %s", i+1, err))
+		}
+		if t.Percent < 0 || t.Percent > 100 {
+			errors = append(errors, fmt.Sprintf("Split target %d: percent must be between 0 and 100", i+1))
+		}
+		total += t.Percent
+	}
+	if action.Mode != SplitRoundRobin && len(action.Targets) > 0 && total != 100 {
+		errors = append(errors, "Split target percentages must add up to 100")
+	}
+	return errors
+}
@@ -0,0 +1,105 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestChooseSplitTarget(t *testing.T) {
+	percent := &SplitAction{Targets: []SplitTarget{{Percent: 70}, {Percent: 30}}}
+	tests := []struct {
+		roll int
+		want int
+	}{
+		{0, 0},
+		{69, 0},
+		{70, 1},
+		{99, 1},
+	}
+	for _, tt := range tests {
+		if got := ChooseSplitTarget(percent, nil, tt.roll); got != tt.want {
+			t.Errorf("ChooseSplitTarget(roll %d) = %d, want %d", tt.roll, got, tt.want)
+		}
+	}
+
+	roundRobin := &SplitAction{Mode: SplitRoundRobin, Targets: []SplitTarget{{}, {}, {}}}
+	if got := ChooseSplitTarget(roundRobin, []int64{2, 1, 1}, 0); got != 1 {
+		t.Errorf("Round robin chose %d, want the first target with the fewest calls", got)
+	}
+	// A target added after calls were counted catches up first
+	if got := ChooseSplitTarget(roundRobin, []int64{3, 3}, 0); got != 2 {
+		t.Errorf("Round robin chose %d, want the new target", got)
+	}
+}
+
+func TestValidateSplitAction(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"valid percent", `{"targets":[{"percent":50,"action_type":"voicemail"},{"percent":50,"action_type":"forward","action_data":{"number":"+15551234567"}}]}`, ""},
+		{"valid round robin", `{"mode":"round_robin","targets":[{"action_type":"voicemail"},{"action_type":"reject"}]}`, ""},
+		{"bad mode", `{"mode":"random","targets":[{"percent":50,"action_type":"voicemail"},{"percent":50,"action_type":"reject"}]}`, "Split mode"},
+		{"one target", `{"targets":[{"percent":100,"action_type":"voicemail"}]}`, "2-10 targets"},
+		{"bad total", `{"targets":[{"percent":50,"action_type":"voicemail"},{"percent":40,"action_type":"reject"}]}`, "add up to 100"},
+		{"nested", `{"mode":"round_robin","targets":[{"action_type":"split"},{"action_type":"reject"}]}`, "can't be another split"},
+		{"bad target", `{"mode":"round_robin","targets":[{"action_type":"forward","action_data":{}},{"action_type":"reject"}]}`, "Split target 1: Forward action requires a phone number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := strings.Join(ValidateSplitAction(json.RawMessage(tt.data)), "; ")
+			if tt.want == "" && errs != "" {
+				t.Errorf("Unexpected errors: %s", errs)
+			}
+			if tt.want != "" && !strings.Contains(errs, tt.want) {
+				t.Errorf("Errors %q don't mention %q", errs, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngine_Evaluate_Split(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+	did := createTestDID(t, database, "+15551234567")
+
+	route := createTestRoute(t, database, &models.Route{
+		DIDID:         &did.ID,
+		Priority:      1,
+		Name:          "Share the load",
+		ConditionType: "default",
+		ActionType:    "split",
+		ActionData:    json.RawMessage(`{"mode":"round_robin","targets":[{"action_type":"forward","action_data":{"number":"+15550000001"}},{"action_type":"voicemail"}]}`),
+		Enabled:       true,
+	})
+
+	engine := NewEngine(database, "UTC")
+	var got []string
+	for i := 0; i < 4; i++ {
+		action, err := engine.Evaluate(ctx, &CallContext{CallerID: "+15559876543", DIDID: did.ID, Time: time.Now()})
+		if err != nil {
+			t.Fatalf("Evaluate failed: %v", err)
+		}
+		if action.RouteName != "Share the load" {
+			t.Errorf("RouteName = %q", action.RouteName)
+		}
+		got = append(got, action.Type)
+	}
+	if strings.Join(got, ",") != "forward,voicemail,forward,voicemail" {
+		t.Errorf("Actions = %v, want the targets to take turns", got)
+	}
+
+	counts, err := database.RouteSplits.Counts(ctx, route.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 2 || counts[0].Calls != 2 || counts[1].Calls != 2 {
+		t.Errorf("Unexpected counts: %+v", counts)
+	}
+}
@@ -0,0 +1,217 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// Webhook verdicts
+const (
+	VerdictAllow = "allow" // The route takes the call
+	VerdictDeny  = "deny"  // The call is rejected
+	VerdictRoute = "route" // The call takes another route's action
+	VerdictSkip  = "skip"  // The route doesn't match and the next one is evaluated
+)
+
+// WebhookSignatureHeader carries the HMAC-SHA256 of the request body when
+// the condition has a secret
+const WebhookSignatureHeader = "X-GoSIP-Signature"
+
+// WebhookCondition asks an external service what to do with each call
+type WebhookCondition struct {
+	URL       string `json:"url"`
+	TimeoutMS int    `json:"timeout_ms,omitempty"` // Defaults to 2000, at most 5000
+	Secret    string `json:"secret,omitempty"`     // Signs requests in X-GoSIP-Signature
+	// Fallback is the verdict used when the service fails, times out or
+	// answers with something unusable: "skip" (default), "allow" or "deny"
+	Fallback string `json:"fallback,omitempty"`
+}
+
+// WebhookRequest is the call context posted to the service
+type WebhookRequest struct {
+	CallerID     string    `json:"caller_id"`
+	CalledNumber string    `json:"called_number"`
+	DIDID        int64     `json:"did_id"`
+	RouteID      int64     `json:"route_id"`
+	RouteName    string    `json:"route_name"`
+	Time         time.Time `json:"time"`
+}
+
+// WebhookVerdict is the service's answer
+type WebhookVerdict struct {
+	Verdict string `json:"verdict"`
+	RouteID int64  `json:"route_id,omitempty"` // Route whose action a "route" verdict takes
+	SIPCode int    `json:"sip_code,omitempty"` // Reject code for "deny"
+	Reason  string `json:"reason,omitempty"`   // Reject reason for "deny"
+}
+
+// webhookClient posts to condition webhooks. Each request has its own
+// deadline, so the client sets none.
+var webhookClient = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// ParseWebhookCondition reads and checks a webhook condition
+func ParseWebhookCondition(data json.RawMessage) (WebhookCondition, error) {
+	var condition WebhookCondition
+	if err := json.Unmarshal(data, &condition); err != nil {
+		return condition, errors.New("invalid webhook condition data")
+	}
+	u, err := url.Parse(condition.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return condition, errors.New("webhook URL must be an http or https URL")
+	}
+	if condition.TimeoutMS < 0 || time.Duration(condition.TimeoutMS)*time.Millisecond > config.RuleWebhookMaxTimeout {
+		return condition, fmt.Errorf("webhook timeout must be between 0 and %d ms", config.RuleWebhookMaxTimeout.Milliseconds())
+	}
+	switch condition.Fallback {
+	case "", VerdictSkip, VerdictAllow, VerdictDeny:
+	default:
+		return condition, errors.New("webhook fallback must be skip, allow or deny")
+	}
+	return condition, nil
+}
+
+// timeout returns how long the condition waits for a verdict
+func (c WebhookCondition) timeout() time.Duration {
+	if c.TimeoutMS <= 0 {
+		return config.RuleWebhookDefaultTimeout
+	}
+	return time.Duration(c.TimeoutMS) * time.Millisecond
+}
+
+// fallback returns the verdict used when the service can't give one
+func (c WebhookCondition) fallback() WebhookVerdict {
+	if c.Fallback == "" {
+		return WebhookVerdict{Verdict: VerdictSkip}
+	}
+	return WebhookVerdict{Verdict: c.Fallback}
+}
+
+// AskWebhook posts the call to the condition's service and returns its
+// verdict, or the condition's fallback when it doesn't answer in time
+// with a 2xx response holding a known verdict
+func AskWebhook(ctx context.Context, condition WebhookCondition, call WebhookRequest) WebhookVerdict {
+	verdict, err := askWebhook(ctx, condition, call)
+	if err != nil {
+		slog.Warn("Route webhook failed, using fallback", "route_id", call.RouteID, "url", condition.URL, "fallback", condition.fallback().Verdict, "error", err)
+		return condition.fallback()
+	}
+	return verdict
+}
+
+func askWebhook(ctx context.Context, condition WebhookCondition, call WebhookRequest) (WebhookVerdict, error) {
+	body, err := json.Marshal(call)
+	if err != nil {
+		return WebhookVerdict{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, condition.timeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, condition.URL, bytes.NewReader(body))
+	if err != nil {
+		return WebhookVerdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if condition.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(condition.Secret))
+		mac.Write(body)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return WebhookVerdict{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return WebhookVerdict{}, fmt.Errorf("returned %d", resp.StatusCode)
+	}
+
+	var verdict WebhookVerdict
+	if err := json.NewDecoder(io.LimitReader(resp.Body, config.RuleWebhookMaxBytes)).Decode(&verdict); err != nil {
+		return WebhookVerdict{}, fmt.Errorf("invalid verdict: %w", err)
+	}
+	switch verdict.Verdict {
+	case VerdictAllow, VerdictDeny, VerdictSkip:
+	case VerdictRoute:
+		if verdict.RouteID <= 0 {
+			return WebhookVerdict{}, errors.New("route verdict without a route_id")
+		}
+	default:
+		return WebhookVerdict{}, fmt.Errorf("unknown verdict %q", verdict.Verdict)
+	}
+	return verdict, nil
+}
+
+// MatchWebhookCondition asks a webhook route's service about the call and
+// returns the route the call takes: the route itself when allowed, a copy
+// that rejects the call when denied, or a copy taking another route's
+// action. It returns nil when the call moves on to the next route.
+func MatchWebhookCondition(ctx context.Context, routes *db.RouteRepository, route *models.Route, call WebhookRequest) *models.Route {
+	condition, err := ParseWebhookCondition(route.ConditionData)
+	if err != nil {
+		return nil
+	}
+	call.RouteID, call.RouteName = route.ID, route.Name
+
+	verdict := AskWebhook(ctx, condition, call)
+	if verdict.Verdict == VerdictRoute {
+		target, err := webhookTarget(ctx, routes, route, verdict.RouteID)
+		if err == nil {
+			return target
+		}
+		slog.Warn("Route webhook named an unusable route, using fallback", "route_id", route.ID, "target", verdict.RouteID, "error", err)
+		verdict = condition.fallback()
+	}
+
+	switch verdict.Verdict {
+	case VerdictAllow:
+		return route
+	case VerdictDeny:
+		reject := *route
+		reject.ActionType = "reject"
+		reject.ActionData, _ = json.Marshal(RejectAction{SIPCode: verdict.SIPCode, Reason: verdict.Reason})
+		if _, ok := RejectCodes[verdict.SIPCode]; (verdict.SIPCode != 0 && !ok) || !ValidRejectReason(verdict.Reason) {
+			reject.ActionData = nil
+		}
+		return &reject
+	default:
+		return nil
+	}
+}
+
+// webhookTarget returns a copy of the webhook route taking the action of
+// the route a verdict named. It must be global or belong to the same DID.
+func webhookTarget(ctx context.Context, routes *db.RouteRepository, route *models.Route, id int64) (*models.Route, error) {
+	target, err := routes.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if target.DIDID != nil && (route.DIDID == nil || *target.DIDID != *route.DIDID) {
+		return nil, errors.New("route belongs to another DID")
+	}
+	if target.ID == route.ID {
+		return route, nil
+	}
+	routed := *route
+	routed.Name = target.Name
+	routed.ActionType = target.ActionType
+	routed.ActionData = target.ActionData
+	return &routed, nil
+}
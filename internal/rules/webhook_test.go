@@ -0,0 +1,191 @@
+package rules
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestParseWebhookCondition(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"valid", `{"url": "https://screen.example.com/calls", "timeout_ms": 1500, "fallback": "deny"}`, false},
+		{"defaults", `{"url": "http://10.0.0.5:8080/"}`, false},
+		{"no URL", `{}`, true},
+		{"wrong scheme", `{"url": "ftp://screen.example.com/"}`, true},
+		{"timeout too long", `{"url": "https://screen.example.com/", "timeout_ms": 10000}`, true},
+		{"negative timeout", `{"url": "https://screen.example.com/", "timeout_ms": -1}`, true},
+		{"unknown fallback", `{"url": "https://screen.example.com/", "fallback": "route"}`, true},
+		{"not JSON", `nope`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseWebhookCondition(json.RawMessage(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseWebhookCondition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAskWebhook(t *testing.T) {
+	var got WebhookRequest
+	var signature string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(body)
+		signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		if r.Header.Get(WebhookSignatureHeader) != signature {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"verdict": "deny", "sip_code": 486}`))
+	}))
+	defer srv.Close()
+
+	verdict := AskWebhook(context.Background(), WebhookCondition{URL: srv.URL, Secret: "s3cret"}, WebhookRequest{CallerID: "+15559876543", DIDID: 3})
+	if verdict.Verdict != VerdictDeny || verdict.SIPCode != 486 {
+		t.Errorf("Expected deny with 486, got %+v", verdict)
+	}
+	if got.CallerID != "+15559876543" || got.DIDID != 3 {
+		t.Errorf("Expected the call context to be posted, got %+v", got)
+	}
+}
+
+func TestAskWebhook_Fallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"error status", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }},
+		{"invalid JSON", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`allow`)) }},
+		{"unknown verdict", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{"verdict": "maybe"}`)) }},
+		{"route without ID", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{"verdict": "route"}`)) }},
+		{"too slow", func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+			w.Write([]byte(`{"verdict": "allow"}`))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			condition := WebhookCondition{URL: srv.URL, TimeoutMS: 100, Fallback: VerdictDeny}
+			if verdict := AskWebhook(context.Background(), condition, WebhookRequest{}); verdict.Verdict != VerdictDeny {
+				t.Errorf("Expected the deny fallback, got %+v", verdict)
+			}
+			condition.Fallback = ""
+			if verdict := AskWebhook(context.Background(), condition, WebhookRequest{}); verdict.Verdict != VerdictSkip {
+				t.Errorf("Expected the default skip fallback, got %+v", verdict)
+			}
+		})
+	}
+}
+
+func TestEvaluate_WebhookCondition(t *testing.T) {
+	database := setupTestDB(t)
+	engine := NewEngine(database, "UTC")
+	ctx := context.Background()
+
+	verdict := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(verdict))
+	}))
+	defer srv.Close()
+
+	did := createTestDID(t, database, "+15551234567")
+	other := createTestDID(t, database, "+15551230000")
+	createTestRoute(t, database, &models.Route{
+		DIDID:         &did.ID,
+		Priority:      1,
+		Name:          "Screening",
+		ConditionType: "webhook",
+		ConditionData: json.RawMessage(fmt.Sprintf(`{"url": %q}`, srv.URL)),
+		ActionType:    "ring",
+		ActionData:    json.RawMessage(`{"devices": [1]}`),
+		Enabled:       true,
+	})
+	forward := createTestRoute(t, database, &models.Route{
+		DIDID:         &did.ID,
+		Priority:      2,
+		Name:          "Assistant",
+		ConditionType: "time",
+		ConditionData: json.RawMessage(`{"start_hour": 0, "end_hour": 0}`),
+		ActionType:    "forward",
+		ActionData:    json.RawMessage(`{"number": "+15550001111"}`),
+		Enabled:       false,
+	})
+	foreign := createTestRoute(t, database, &models.Route{
+		DIDID:         &other.ID,
+		Priority:      1,
+		Name:          "Other DID",
+		ConditionType: "default",
+		ActionType:    "forward",
+		ActionData:    json.RawMessage(`{"number": "+15550002222"}`),
+		Enabled:       true,
+	})
+
+	tests := []struct {
+		name     string
+		verdict  string
+		expected string
+	}{
+		{"allow", `{"verdict": "allow"}`, "ring"},
+		{"deny", `{"verdict": "deny", "reason": "Spam"}`, "reject"},
+		{"skip", `{"verdict": "skip"}`, "voicemail"},
+		{"route", fmt.Sprintf(`{"verdict": "route", "route_id": %d}`, forward.ID), "forward"},
+		{"route of another DID", fmt.Sprintf(`{"verdict": "route", "route_id": %d}`, foreign.ID), "voicemail"},
+		{"unknown route", `{"verdict": "route", "route_id": 999}`, "voicemail"},
+		{"unusable", `{}`, "voicemail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict = tt.verdict
+			action, err := engine.Evaluate(ctx, &CallContext{CallerID: "+15559876543", DIDID: did.ID, Time: time.Now()})
+			if err != nil {
+				t.Fatalf("Evaluate() error: %v", err)
+			}
+			if action.Type != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, action.Type)
+			}
+			if tt.name == "deny" && ParseRejectAction(action.Data).Reason != "Spam" {
+				t.Errorf("Expected the verdict's reject reason, got %s", action.Data)
+			}
+		})
+	}
+}
+
+func TestValidateRule_Webhook(t *testing.T) {
+	route := &models.Route{
+		ConditionType: "webhook",
+		ConditionData: json.RawMessage(`{"url": "https://screen.example.com/", "fallback": "maybe"}`),
+		ActionType:    "voicemail",
+	}
+	if errs := ValidateRule(route); len(errs) != 1 {
+		t.Errorf("Expected one validation error for the fallback, got %v", errs)
+	}
+
+	route.ConditionData = json.RawMessage(`{"url": "https://screen.example.com/"}`)
+	if errs := ValidateRule(route); len(errs) != 0 {
+		t.Errorf("Expected no validation errors, got %v", errs)
+	}
+}
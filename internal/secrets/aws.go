@@ -0,0 +1,68 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/awssign"
+)
+
+// aws reads a secret from AWS Secrets Manager. Secrets stored as a JSON
+// object are split into fields; other secrets are kept whole.
+func (r *Resolver) aws(ctx context.Context, secretID string) (map[string]string, error) {
+	if r.awsEndpoint == "" {
+		return nil, errors.New("set AWS_REGION to read secrets from AWS Secrets Manager")
+	}
+	creds, err := r.awsCreds.Credentials(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("aws secrets manager: %w", err)
+	}
+
+	body, _ := json.Marshal(map[string]string{"SecretId": secretID})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.awsEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	awssign.Sign(req, body, creds, r.cfg.AWSRegion, "secretsmanager", time.Now())
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("aws secrets manager: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		SecretString string `json:"SecretString"`
+		Type         string `json:"__type"`
+		Message      string `json:"message"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("aws secrets manager: invalid response (%s): %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// __type looks like "com.amazonaws...#ResourceNotFoundException" or just the name
+		kind := result.Type
+		if i := strings.LastIndex(kind, "#"); i >= 0 {
+			kind = kind[i+1:]
+		}
+		return nil, fmt.Errorf("aws secrets manager: reading %s failed: %s %s", secretID, kind, result.Message)
+	}
+	if result.SecretString == "" {
+		return nil, fmt.Errorf("aws secrets manager: %s has no text value", secretID)
+	}
+
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(result.SecretString), &object); err == nil {
+		return stringFields(object), nil
+	}
+	return map[string]string{"": result.SecretString}, nil
+}
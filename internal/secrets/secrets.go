@@ -0,0 +1,151 @@
+// Package secrets resolves secret settings that reference an external
+// secret store instead of holding the secret itself:
+//
+//	vault:secret/data/gosip#twilio_auth_token
+//	aws-sm:gosip/production#smtp_password
+//
+// The part after # picks a field of the secret. AWS secrets stored as plain
+// text are used whole when it is left out.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/awssign"
+	"github.com/btafoya/gosip/internal/config"
+)
+
+// Reference prefixes
+const (
+	PrefixVault = "vault:"
+	PrefixAWS   = "aws-sm:"
+)
+
+// IsReference reports whether a setting refers to a secret store
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, PrefixVault) || strings.HasPrefix(value, PrefixAWS)
+}
+
+// Resolver fetches secrets from Vault and AWS Secrets Manager
+type Resolver struct {
+	cfg    *config.SecretsConfig
+	client *http.Client
+
+	// awsEndpoint is the Secrets Manager URL, replaced in tests
+	awsEndpoint string
+	awsCreds    *awssign.Provider
+
+	// cache holds each fetched secret so several fields cost one request
+	cache map[string]map[string]string
+}
+
+// NewResolver creates a Resolver for the configured secret stores
+func NewResolver(cfg *config.SecretsConfig) *Resolver {
+	if cfg == nil {
+		cfg = &config.SecretsConfig{}
+	}
+	client := &http.Client{Timeout: config.SecretsTimeout}
+	r := &Resolver{
+		cfg:      cfg,
+		client:   client,
+		awsCreds: awssign.NewProvider(cfg, client),
+		cache:    make(map[string]map[string]string),
+	}
+	if cfg.AWSRegion != "" {
+		r.awsEndpoint = "https://secretsmanager." + cfg.AWSRegion + ".amazonaws.com/"
+	}
+	return r
+}
+
+// Resolve returns the secret a reference points to. Other values are
+// returned unchanged.
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	var store, ref string
+	switch {
+	case strings.HasPrefix(value, PrefixVault):
+		store, ref = PrefixVault, strings.TrimPrefix(value, PrefixVault)
+	case strings.HasPrefix(value, PrefixAWS):
+		store, ref = PrefixAWS, strings.TrimPrefix(value, PrefixAWS)
+	default:
+		return value, nil
+	}
+
+	name, field, _ := strings.Cut(ref, "#")
+	if name == "" {
+		return "", fmt.Errorf("%s reference has no secret name", strings.TrimSuffix(store, ":"))
+	}
+
+	fields, ok := r.cache[store+name]
+	if !ok {
+		var err error
+		if store == PrefixVault {
+			fields, err = r.vault(ctx, name)
+		} else {
+			fields, err = r.aws(ctx, name)
+		}
+		if err != nil {
+			return "", err
+		}
+		r.cache[store+name] = fields
+	}
+
+	if field == "" {
+		if s, ok := fields[""]; ok {
+			return s, nil
+		}
+		if len(fields) == 1 {
+			for _, s := range fields {
+				return s, nil
+			}
+		}
+		return "", fmt.Errorf("secret %s has several fields, add #field to pick one", name)
+	}
+	s, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no field %s", name, field)
+	}
+	return s, nil
+}
+
+// secretSetting is a Config field that may hold a reference
+type secretSetting struct {
+	key   string // Environment variable, for errors
+	value *string
+}
+
+// ResolveConfig replaces references in the Twilio auth token, SMTP password,
+// Cloudflare tokens and Postgres connection string with the secrets they
+// point to
+func (r *Resolver) ResolveConfig(ctx context.Context, cfg *config.Config) error {
+	settings := []secretSetting{
+		{"TWILIO_AUTH_TOKEN", &cfg.TwilioAuthToken},
+		{"SMTP_PASSWORD", &cfg.SMTPPassword},
+	}
+	if cfg.TLS != nil {
+		settings = append(settings, secretSetting{"CLOUDFLARE_DNS_API_TOKEN", &cfg.TLS.CloudflareAPIToken})
+	}
+	if cfg.WANIP != nil {
+		settings = append(settings, secretSetting{"GOSIP_DDNS_CLOUDFLARE_TOKEN", &cfg.WANIP.CloudflareToken})
+	}
+	if cfg.Database != nil {
+		settings = append(settings, secretSetting{"GOSIP_DB_DSN", &cfg.Database.DSN})
+	}
+
+	var errs []error
+	for _, s := range settings {
+		if !IsReference(*s.value) {
+			continue
+		}
+		secret, err := r.Resolve(ctx, *s.value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.key, err))
+			continue
+		}
+		*s.value = secret
+	}
+	return errors.Join(errs...)
+}
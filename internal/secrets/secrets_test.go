@@ -0,0 +1,118 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+)
+
+func TestResolveVault(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/gosip":
+			w.Write([]byte(`{"data":{"data":{"twilio_auth_token":"tw-secret","smtp_password":"smtp-secret"},"metadata":{"version":3}}}`))
+		case "/v1/kv/gosip":
+			w.Write([]byte(`{"data":{"token":"v1-secret"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	r := NewResolver(&config.SecretsConfig{VaultAddr: server.URL, VaultToken: "vault-token"})
+	ctx := context.Background()
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{"vault:secret/data/gosip#twilio_auth_token", "tw-secret", ""},
+		{"vault:secret/data/gosip#smtp_password", "smtp-secret", ""},
+		{"vault:kv/gosip", "v1-secret", ""},
+		{"vault:secret/data/gosip", "", "several fields"},
+		{"vault:secret/data/gosip#missing", "", "no field missing"},
+		{"vault:secret/data/other#token", "", "404"},
+		{"not-a-reference", "not-a-reference", ""},
+	}
+	for _, tt := range tests {
+		got, err := r.Resolve(ctx, tt.ref)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Resolve(%q) error = %v, want it to mention %q", tt.ref, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Resolve(%q) = %q, %v, want %q", tt.ref, got, err, tt.want)
+		}
+	}
+	// secret/data/gosip, kv/gosip and secret/data/other
+	if requests != 3 {
+		t.Errorf("Vault requests = %d, want 3", requests)
+	}
+
+	r = NewResolver(&config.SecretsConfig{})
+	if _, err := r.Resolve(ctx, "vault:secret/data/gosip#token"); err == nil || !strings.Contains(err.Error(), "VAULT_ADDR") {
+		t.Errorf("Expected an error naming VAULT_ADDR, got %v", err)
+	}
+}
+
+func TestResolveAWS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/creds" {
+			w.Write([]byte(`{"AccessKeyId":"ASIATASK","SecretAccessKey":"task-secret","Token":"task-session"}`))
+			return
+		}
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ASIATASK/") ||
+			r.Header.Get("X-Amz-Security-Token") != "task-session" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"UnrecognizedClientException","message":"bad signature"}`))
+			return
+		}
+		var body struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&body)
+		switch body.SecretId {
+		case "gosip/production":
+			w.Write([]byte(`{"SecretString":"{\"twilio_auth_token\":\"tw-secret\",\"smtp_password\":\"smtp-secret\"}"}`))
+		case "gosip/cloudflare":
+			w.Write([]byte(`{"SecretString":"cf-secret"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazonaws.secretsmanager#ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`))
+		}
+	}))
+	defer server.Close()
+
+	r := NewResolver(&config.SecretsConfig{AWSRegion: "us-east-1"})
+	r.awsEndpoint = server.URL + "/"
+	r.awsCreds.TaskRoleURL = server.URL + "/creds"
+
+	cfg := &config.Config{
+		TwilioAuthToken: "aws-sm:gosip/production#twilio_auth_token",
+		SMTPPassword:    "plain-password",
+		TLS:             &config.TLSConfig{CloudflareAPIToken: "aws-sm:gosip/cloudflare"},
+		WANIP:           &config.WANIPConfig{CloudflareToken: "aws-sm:gosip/missing"},
+	}
+	err := r.ResolveConfig(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "GOSIP_DDNS_CLOUDFLARE_TOKEN") || !strings.Contains(err.Error(), "ResourceNotFoundException") {
+		t.Errorf("ResolveConfig() error = %v, want the missing Cloudflare secret", err)
+	}
+	if cfg.TwilioAuthToken != "tw-secret" || cfg.SMTPPassword != "plain-password" || cfg.TLS.CloudflareAPIToken != "cf-secret" {
+		t.Errorf("Resolved %q, %q, %q", cfg.TwilioAuthToken, cfg.SMTPPassword, cfg.TLS.CloudflareAPIToken)
+	}
+}
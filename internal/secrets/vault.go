@@ -0,0 +1,76 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// vault reads a secret from a Vault KV secrets engine. Version 2 paths
+// include data/, e.g. secret/data/gosip.
+func (r *Resolver) vault(ctx context.Context, path string) (map[string]string, error) {
+	if r.cfg.VaultAddr == "" || r.cfg.VaultToken == "" {
+		return nil, errors.New("set VAULT_ADDR and VAULT_TOKEN to read secrets from Vault")
+	}
+
+	u := strings.TrimRight(r.cfg.VaultAddr, "/") + "/v1/" + strings.TrimLeft(path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", r.cfg.VaultToken)
+	if r.cfg.VaultNamespace != "" {
+		req.Header.Set("X-Vault-Namespace", r.cfg.VaultNamespace)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body)
+		if len(body.Errors) > 0 {
+			return nil, fmt.Errorf("vault: reading %s failed: %s (%s)", path, strings.Join(body.Errors, "; "), resp.Status)
+		}
+		return nil, fmt.Errorf("vault: reading %s failed: %s", path, resp.Status)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("vault: invalid response: %w", err)
+	}
+
+	// KV version 2 nests the fields under data.data
+	data := body.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, versioned := data["metadata"]; versioned {
+			data = nested
+		}
+	}
+	return stringFields(data), nil
+}
+
+// stringFields keeps the fields of a secret that hold text or numbers
+func stringFields(data map[string]interface{}) map[string]string {
+	fields := make(map[string]string, len(data))
+	for key, v := range data {
+		switch v := v.(type) {
+		case string:
+			fields[key] = v
+		case float64, bool:
+			fields[key] = fmt.Sprint(v)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,91 @@
+// Package shortlinks replaces the links in outbound messages with short
+// links GoSIP redirects from, so clicks can be counted
+package shortlinks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/publicurl"
+)
+
+// SettingEnabled turns on short links in outbound messages
+const SettingEnabled = "link_shortening_enabled"
+
+// linkPattern matches the http and https links in message text
+var linkPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// trimLink drops the punctuation a link is followed by in a sentence, e.g.
+// the full stop in "see https://example.com.", keeping closing brackets
+// that belong to the link
+func trimLink(link string) string {
+	for link != "" {
+		last := link[len(link)-1]
+		switch {
+		case strings.IndexByte(".,;:!?'", last) >= 0:
+		case last == ')' && strings.Count(link, "(") < strings.Count(link, ")"):
+		case last == ']' && strings.Count(link, "[") < strings.Count(link, "]"):
+		default:
+			return link
+		}
+		link = link[:len(link)-1]
+	}
+	return link
+}
+
+// newCode returns a random, URL-safe short link code
+func newCode() (string, error) {
+	b := make([]byte, config.ShortLinkCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("crypto/rand.Read failed: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)[:config.ShortLinkCodeLength], nil
+}
+
+// Shorten replaces the links in a saved outbound message with short links
+// GoSIP redirects from, counting the clicks, when link shortening is on and
+// a public base URL is set. Links shortened before an error are kept, so
+// the body is always saved as it will be sent.
+func Shorten(ctx context.Context, cfg *config.Config, database *db.DB, message *models.Message) error {
+	if database.Config.GetWithDefault(ctx, SettingEnabled, "") != "true" {
+		return nil
+	}
+	base := publicurl.Get(ctx, cfg, database)
+	if base == "" {
+		return nil
+	}
+	prefix := base + config.ShortLinkPath
+
+	var failed error
+	body := linkPattern.ReplaceAllStringFunc(message.Body, func(match string) string {
+		link := trimLink(match)
+		if failed != nil || strings.HasPrefix(link, prefix) {
+			return match
+		}
+		code, err := newCode()
+		if err != nil {
+			failed = err
+			return match
+		}
+		if err := database.ShortLinks.Create(ctx, &models.ShortLink{Code: code, MessageID: &message.ID, URL: link}); err != nil {
+			failed = err
+			return match
+		}
+		return prefix + code + match[len(link):]
+	})
+
+	if body != message.Body {
+		message.Body = body
+		if err := database.Messages.Update(ctx, message); err != nil {
+			return err
+		}
+	}
+	return failed
+}
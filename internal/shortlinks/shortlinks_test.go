@@ -0,0 +1,18 @@
+package shortlinks
+
+import "testing"
+
+func TestTrimLink(t *testing.T) {
+	for link, want := range map[string]string{
+		"https://example.com/a":                "https://example.com/a",
+		"https://example.com/a.":               "https://example.com/a",
+		"https://example.com/a?b=1,":           "https://example.com/a?b=1",
+		"https://example.com/a)":               "https://example.com/a",
+		"https://en.wikipedia.org/wiki/Go_(x)": "https://en.wikipedia.org/wiki/Go_(x)",
+		"https://example.com/a!?'":             "https://example.com/a",
+	} {
+		if got := trimLink(link); got != want {
+			t.Errorf("trimLink(%q) = %q; want %q", link, got, want)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+// Package sipdns builds and checks the DNS records SIP clients and carriers
+// use to find the server: NAPTR for transport selection (RFC 3263), SRV for
+// ports and the A record of the SRV target
+package sipdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Record check outcomes
+const (
+	StatusOK         = "ok"
+	StatusMissing    = "missing"
+	StatusMismatch   = "mismatch"
+	StatusUnexpected = "unexpected" // Advertises a transport the server doesn't offer
+)
+
+// TTL of generated records
+const TTL = 3600
+
+// Params describe the server the records should point at
+type Params struct {
+	Domain      string // SIP domain, e.g. example.com
+	Target      string // Host running GoSIP, e.g. sip.example.com. Defaults to Domain.
+	IP          string // Public IPv4 or IPv6 address, empty when unknown
+	Port        int    // UDP and TCP SIP port
+	TLSPort     int    // SIPS port, 0 when TLS is off
+	Unencrypted bool   // Whether UDP and TCP are offered
+}
+
+// transport is one way of reaching the server
+type transport struct {
+	naptrService string
+	service      string
+	proto        string
+	preference   uint16
+}
+
+// transports in order of preference: encrypted first
+var transports = []transport{
+	{"SIPS+D2T", "_sips", "_tcp", 10},
+	{"SIP+D2T", "_sip", "_tcp", 20},
+	{"SIP+D2U", "_sip", "_udp", 30},
+}
+
+// Record is a DNS record GoSIP needs, with its check result
+type Record struct {
+	Type     string   `json:"type"`
+	Name     string   `json:"name"`
+	Expected string   `json:"expected"`        // Zone file line to create
+	Found    []string `json:"found,omitempty"` // Records of this name and type in DNS
+	Status   string   `json:"status"`
+	Required bool     `json:"required"`
+	Detail   string   `json:"detail,omitempty"`
+
+	// What the check compares against
+	rr dns.RR
+}
+
+// Report is the result of checking every record
+type Report struct {
+	Domain  string   `json:"domain"`
+	Target  string   `json:"target"`
+	IP      string   `json:"ip,omitempty"`
+	OK      bool     `json:"ok"`
+	Records []Record `json:"records"`
+	Zone    string   `json:"zone"` // Every expected record, ready to paste into a zone file
+}
+
+func (p Params) offers(t transport) (int, bool) {
+	if t.service == "_sips" {
+		return p.TLSPort, p.TLSPort > 0
+	}
+	return p.Port, p.Unencrypted && p.Port > 0
+}
+
+func (p Params) target() string {
+	if p.Target != "" {
+		return p.Target
+	}
+	return p.Domain
+}
+
+// Expected returns the records for p: a NAPTR and SRV record per offered
+// transport and the address record of the target
+func Expected(p Params) []Record {
+	domain := dns.Fqdn(p.Domain)
+	target := dns.Fqdn(p.target())
+	hdr := func(name string, rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: TTL}
+	}
+
+	var naptrs, srvs []Record
+	for _, t := range transports {
+		port, ok := p.offers(t)
+		if !ok {
+			continue
+		}
+		srvName := t.service + "." + t.proto + "." + domain
+		naptrs = append(naptrs, newRecord(&dns.NAPTR{
+			Hdr:         hdr(domain, dns.TypeNAPTR),
+			Order:       10,
+			Preference:  t.preference,
+			Flags:       "s",
+			Service:     t.naptrService,
+			Replacement: srvName,
+		}, false))
+		srvs = append(srvs, newRecord(&dns.SRV{
+			Hdr:      hdr(srvName, dns.TypeSRV),
+			Priority: 10,
+			Weight:   10,
+			Port:     uint16(port),
+			Target:   target,
+		}, true))
+	}
+
+	records := append(naptrs, srvs...)
+	if ip := net.ParseIP(p.IP); ip != nil {
+		if ip.To4() != nil {
+			records = append(records, newRecord(&dns.A{Hdr: hdr(target, dns.TypeA), A: ip.To4()}, true))
+		} else {
+			records = append(records, newRecord(&dns.AAAA{Hdr: hdr(target, dns.TypeAAAA), AAAA: ip}, true))
+		}
+	} else {
+		// The address is unknown, so only check that one exists
+		records = append(records, Record{Type: "A", Name: target, Required: true, rr: &dns.A{Hdr: hdr(target, dns.TypeA)}})
+	}
+	return records
+}
+
+func newRecord(rr dns.RR, required bool) Record {
+	return Record{
+		Type:     dns.TypeToString[rr.Header().Rrtype],
+		Name:     rr.Header().Name,
+		Expected: rr.String(),
+		Required: required,
+		rr:       rr,
+	}
+}
+
+// Zone returns the expected records as zone file lines
+func Zone(records []Record) string {
+	var b strings.Builder
+	for _, r := range records {
+		if r.Expected != "" {
+			b.WriteString(r.Expected)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// QueryFunc looks up the records of one name and type
+type QueryFunc func(ctx context.Context, name string, qtype uint16) ([]dns.RR, error)
+
+// Checker compares DNS with the expected records
+type Checker struct {
+	Query QueryFunc
+}
+
+// NewChecker creates a Checker that asks the system's nameservers
+func NewChecker() (*Checker, error) {
+	cfg, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resolver configuration: %w", err)
+	}
+	if len(cfg.Servers) == 0 {
+		return nil, errors.New("no nameservers configured")
+	}
+	server := net.JoinHostPort(cfg.Servers[0], cfg.Port)
+	return &Checker{Query: NewQueryFunc(server)}, nil
+}
+
+// NewQueryFunc returns a QueryFunc that asks server (host:port), retrying
+// over TCP when the answer is truncated
+func NewQueryFunc(server string) QueryFunc {
+	return func(ctx context.Context, name string, qtype uint16) ([]dns.RR, error) {
+		msg := new(dns.Msg)
+		msg.SetQuestion(dns.Fqdn(name), qtype)
+		msg.SetEdns0(4096, false)
+
+		client := &dns.Client{Timeout: 5 * time.Second}
+		resp, _, err := client.ExchangeContext(ctx, msg, server)
+		if err == nil && resp.Truncated {
+			client.Net = "tcp"
+			resp, _, err = client.ExchangeContext(ctx, msg, server)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+			return nil, fmt.Errorf("%s lookup of %s failed: %s", dns.TypeToString[qtype], name, dns.RcodeToString[resp.Rcode])
+		}
+
+		var rrs []dns.RR
+		for _, rr := range resp.Answer {
+			if rr.Header().Rrtype == qtype && strings.EqualFold(rr.Header().Name, dns.Fqdn(name)) {
+				rrs = append(rrs, rr)
+			}
+		}
+		return rrs, nil
+	}
+}
+
+// Check looks up every record p needs, plus records for transports the
+// server doesn't offer
+func (c *Checker) Check(ctx context.Context, p Params) (*Report, error) {
+	expected := Expected(p)
+	report := &Report{
+		Domain: dns.Fqdn(p.Domain),
+		Target: dns.Fqdn(p.target()),
+		IP:     p.IP,
+		OK:     true,
+		Zone:   Zone(expected),
+	}
+
+	naptrs, err := c.Query(ctx, p.Domain, dns.TypeNAPTR)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range expected {
+		found := naptrs
+		if r.Type != "NAPTR" {
+			if found, err = c.Query(ctx, r.Name, r.rr.Header().Rrtype); err != nil {
+				return nil, err
+			}
+		}
+		report.Records = append(report.Records, compare(r, found, p.IP))
+	}
+
+	// Records pointing clients at transports that aren't offered make them
+	// fail instead of falling back
+	for _, t := range transports {
+		if _, ok := p.offers(t); ok {
+			continue
+		}
+		srvName := t.service + "." + t.proto + "." + dns.Fqdn(p.Domain)
+		srvs, err := c.Query(ctx, srvName, dns.TypeSRV)
+		if err != nil {
+			return nil, err
+		}
+		var stale []dns.RR
+		for _, rr := range naptrs {
+			if strings.EqualFold(rr.(*dns.NAPTR).Service, t.naptrService) {
+				stale = append(stale, rr)
+			}
+		}
+		if len(stale) > 0 {
+			report.Records = append(report.Records, unexpected("NAPTR", dns.Fqdn(p.Domain), stale, t))
+		}
+		if len(srvs) > 0 {
+			report.Records = append(report.Records, unexpected("SRV", srvName, srvs, t))
+		}
+	}
+
+	for _, r := range report.Records {
+		if r.Status == StatusMismatch || r.Status == StatusUnexpected || (r.Required && r.Status != StatusOK) {
+			report.OK = false
+		}
+	}
+	return report, nil
+}
+
+func unexpected(rrtype, name string, found []dns.RR, t transport) Record {
+	return Record{
+		Type:   rrtype,
+		Name:   name,
+		Found:  rrStrings(found),
+		Status: StatusUnexpected,
+		Detail: fmt.Sprintf("GoSIP doesn't offer %s, so clients using this record will fail. Delete it.", t.naptrService),
+	}
+}
+
+// compare checks the records found in DNS against one expected record
+func compare(r Record, found []dns.RR, ip string) Record {
+	var matching []dns.RR
+	switch want := r.rr.(type) {
+	case *dns.NAPTR:
+		for _, rr := range found {
+			if strings.EqualFold(rr.(*dns.NAPTR).Service, want.Service) {
+				matching = append(matching, rr)
+			}
+		}
+	default:
+		matching = found
+	}
+	r.Found = rrStrings(matching)
+
+	if len(matching) == 0 {
+		r.Status = StatusMissing
+		r.Detail = "No record found"
+		if !r.Required {
+			r.Detail = "No record found. It's optional: clients fall back to the SRV records."
+		}
+		if r.Expected == "" {
+			r.Detail = "No address record found. Set GOSIP_EXTERNAL_IP to generate it."
+		}
+		return r
+	}
+
+	for _, rr := range matching {
+		if matches(r.rr, rr) {
+			r.Status = StatusOK
+			return r
+		}
+	}
+
+	r.Status = StatusMismatch
+	switch want := r.rr.(type) {
+	case *dns.NAPTR:
+		r.Detail = fmt.Sprintf("Should point to %s", want.Replacement)
+	case *dns.SRV:
+		r.Detail = fmt.Sprintf("Should point to %s port %d", want.Target, want.Port)
+	default:
+		r.Detail = fmt.Sprintf("Should point to this server's address %s", ip)
+	}
+	return r
+}
+
+// matches reports whether a record found in DNS is the one wanted
+func matches(want, got dns.RR) bool {
+	switch want := want.(type) {
+	case *dns.NAPTR:
+		g := got.(*dns.NAPTR)
+		return strings.EqualFold(g.Flags, "s") && strings.EqualFold(dns.Fqdn(g.Replacement), want.Replacement)
+	case *dns.SRV:
+		g := got.(*dns.SRV)
+		return g.Port == want.Port && strings.EqualFold(dns.Fqdn(g.Target), want.Target)
+	case *dns.A:
+		// Without a known address any address will do
+		return want.A == nil || want.A.Equal(got.(*dns.A).A)
+	case *dns.AAAA:
+		return want.AAAA.Equal(got.(*dns.AAAA).AAAA)
+	}
+	return false
+}
+
+func rrStrings(rrs []dns.RR) []string {
+	out := make([]string, len(rrs))
+	for i, rr := range rrs {
+		out[i] = rr.String()
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,159 @@
+package sipdns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// zone answers queries from a list of zone file lines
+func zone(t *testing.T, lines ...string) QueryFunc {
+	var rrs []dns.RR
+	for _, line := range lines {
+		rr, err := dns.NewRR(line)
+		if err != nil {
+			t.Fatalf("Invalid record %q: %v", line, err)
+		}
+		rrs = append(rrs, rr)
+	}
+	return func(ctx context.Context, name string, qtype uint16) ([]dns.RR, error) {
+		var out []dns.RR
+		for _, rr := range rrs {
+			if rr.Header().Rrtype == qtype && strings.EqualFold(rr.Header().Name, dns.Fqdn(name)) {
+				out = append(out, rr)
+			}
+		}
+		return out, nil
+	}
+}
+
+func TestExpected(t *testing.T) {
+	records := Expected(Params{Domain: "example.com", Target: "sip.example.com", IP: "203.0.113.10", Port: 5060, TLSPort: 5061, Unencrypted: true})
+
+	want := []string{
+		"example.com.\t3600\tIN\tNAPTR\t10 10 \"s\" \"SIPS+D2T\" \"\" _sips._tcp.example.com.",
+		"example.com.\t3600\tIN\tNAPTR\t10 20 \"s\" \"SIP+D2T\" \"\" _sip._tcp.example.com.",
+		"example.com.\t3600\tIN\tNAPTR\t10 30 \"s\" \"SIP+D2U\" \"\" _sip._udp.example.com.",
+		"_sips._tcp.example.com.\t3600\tIN\tSRV\t10 10 5061 sip.example.com.",
+		"_sip._tcp.example.com.\t3600\tIN\tSRV\t10 10 5060 sip.example.com.",
+		"_sip._udp.example.com.\t3600\tIN\tSRV\t10 10 5060 sip.example.com.",
+		"sip.example.com.\t3600\tIN\tA\t203.0.113.10",
+	}
+	if got := Zone(records); got != strings.Join(want, "\n")+"\n" {
+		t.Errorf("Unexpected zone:\n%s", got)
+	}
+
+	// TLS only, on the domain itself, with an IPv6 address
+	records = Expected(Params{Domain: "example.com", IP: "2001:db8::10", Port: 5060, TLSPort: 5061})
+	if len(records) != 3 || records[1].Expected != "_sips._tcp.example.com.\t3600\tIN\tSRV\t10 10 5061 example.com." || records[2].Type != "AAAA" {
+		t.Errorf("Expected only SIPS records, got %+v", records)
+	}
+}
+
+func TestChecker_Check(t *testing.T) {
+	params := Params{Domain: "example.com", Target: "sip.example.com", IP: "203.0.113.10", Port: 5060, TLSPort: 5061}
+
+	checker := &Checker{Query: zone(t,
+		`example.com. 300 IN NAPTR 10 10 "s" "SIPS+D2T" "" _sips._tcp.example.com.`,
+		`_sips._tcp.example.com. 300 IN SRV 10 10 5061 sip.example.com.`,
+		`sip.example.com. 300 IN A 203.0.113.10`,
+	)}
+	report, err := checker.Check(context.Background(), params)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if !report.OK || len(report.Records) != 3 {
+		t.Fatalf("Expected matching records to pass, got %+v", report)
+	}
+	for _, r := range report.Records {
+		if r.Status != StatusOK {
+			t.Errorf("Expected %s %s ok, got %+v", r.Type, r.Name, r)
+		}
+	}
+
+	checker = &Checker{Query: zone(t,
+		`_sips._tcp.example.com. 300 IN SRV 10 10 5060 sip.example.com.`,
+		`_sip._udp.example.com. 300 IN SRV 10 10 5060 sip.example.com.`,
+		`sip.example.com. 300 IN A 198.51.100.7`,
+	)}
+	report, err = checker.Check(context.Background(), params)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if report.OK {
+		t.Error("Expected wrong records to fail")
+	}
+
+	got := make(map[string]Record)
+	for _, r := range report.Records {
+		got[r.Type+" "+r.Name] = r
+	}
+	if r := got["NAPTR example.com."]; r.Status != StatusMissing || r.Required {
+		t.Errorf("Expected an optional missing NAPTR, got %+v", r)
+	}
+	if r := got["SRV _sips._tcp.example.com."]; r.Status != StatusMismatch || !strings.Contains(r.Detail, "port 5061") {
+		t.Errorf("Expected the SIPS SRV on the wrong port, got %+v", r)
+	}
+	if r := got["A sip.example.com."]; r.Status != StatusMismatch || len(r.Found) != 1 {
+		t.Errorf("Expected the A record at the wrong address, got %+v", r)
+	}
+	// UDP is off, so its SRV record sends clients nowhere
+	if r := got["SRV _sip._udp.example.com."]; r.Status != StatusUnexpected {
+		t.Errorf("Expected the UDP SRV flagged, got %+v", r)
+	}
+}
+
+func TestChecker_UnknownIP(t *testing.T) {
+	checker := &Checker{Query: zone(t,
+		`_sip._udp.example.com. 300 IN SRV 10 10 5060 example.com.`,
+		`_sip._tcp.example.com. 300 IN SRV 10 10 5060 example.com.`,
+		`example.com. 300 IN A 198.51.100.7`,
+	)}
+	report, err := checker.Check(context.Background(), Params{Domain: "example.com", Port: 5060, Unencrypted: true})
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if !report.OK {
+		t.Errorf("Expected any address to do without GOSIP_EXTERNAL_IP, got %+v", report)
+	}
+	if strings.Contains(report.Zone, "IN\tA") {
+		t.Errorf("Expected no A record generated without an address, got:\n%s", report.Zone)
+	}
+}
+
+func TestNewQueryFunc(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	mux := dns.NewServeMux()
+	mux.HandleFunc("example.com.", func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		if req.Question[0].Qtype == dns.TypeSRV {
+			rr, _ := dns.NewRR("_sip._udp.example.com. 300 IN SRV 10 10 5060 sip.example.com.")
+			resp.Answer = append(resp.Answer, rr)
+		}
+		w.WriteMsg(resp)
+	})
+	server := &dns.Server{PacketConn: pc, Handler: mux}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	query := NewQueryFunc(pc.LocalAddr().String())
+	rrs, err := query(context.Background(), "_sip._udp.example.com", dns.TypeSRV)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(rrs) != 1 || rrs[0].(*dns.SRV).Port != 5060 {
+		t.Errorf("Expected the SRV record, got %v", rrs)
+	}
+
+	rrs, err = query(context.Background(), "example.com", dns.TypeNAPTR)
+	if err != nil || len(rrs) != 0 {
+		t.Errorf("Expected no NAPTR records, got %v, %v", rrs, err)
+	}
+}
@@ -0,0 +1,121 @@
+package smtpd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// Message is the readable part of a received email
+type Message struct {
+	From    string // Address in the From header
+	Subject string
+	Text    string
+}
+
+// ParseMessage extracts the sender, subject and text body of an RFC 5322
+// message. The text/plain part is preferred; HTML-only messages are reduced
+// to text and attachments are ignored.
+func ParseMessage(data []byte) (*Message, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{}
+	if from, err := mail.ParseAddress(m.Header.Get("From")); err == nil {
+		msg.From = from.Address
+	}
+	decoder := &mime.WordDecoder{}
+	if subject, err := decoder.DecodeHeader(m.Header.Get("Subject")); err == nil {
+		msg.Subject = subject
+	} else {
+		msg.Subject = m.Header.Get("Subject")
+	}
+
+	text, isHTML, err := textPart(m.Header.Get("Content-Type"), m.Header.Get("Content-Transfer-Encoding"), m.Body)
+	if err != nil {
+		return nil, err
+	}
+	if isHTML {
+		text = htmlToText(text)
+	}
+	msg.Text = text
+	return msg, nil
+}
+
+// textPart returns the text of a message part, searching multipart bodies
+// for a text/plain part and falling back to text/html
+func textPart(contentType, encoding string, body io.Reader) (string, bool, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		var fallback string
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return fallback, fallback != "", nil
+			}
+			if err != nil {
+				return "", false, err
+			}
+			if disposition, _, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition")); disposition == "attachment" {
+				continue
+			}
+			text, isHTML, err := textPart(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil {
+				return "", false, err
+			}
+			if text == "" {
+				continue
+			}
+			if !isHTML {
+				return text, false, nil
+			}
+			if fallback == "" {
+				fallback = text
+			}
+		}
+	case mediaType == "text/plain", mediaType == "text/html":
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return "", false, err
+		}
+		return string(data), mediaType == "text/html", nil
+	default:
+		return "", false, nil
+	}
+}
+
+var (
+	htmlHidden = regexp.MustCompile(`(?is)<(script|style|head)\b.*?</(script|style|head)>`)
+	htmlBreak  = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|tr|h[1-6])>`)
+	htmlTag    = regexp.MustCompile(`<[^>]*>`)
+)
+
+// htmlToText drops markup from an HTML body, keeping line breaks
+func htmlToText(s string) string {
+	s = htmlHidden.ReplaceAllString(s, "")
+	s = htmlBreak.ReplaceAllString(s, "\n")
+	s = htmlTag.ReplaceAllString(s, "")
+	return html.UnescapeString(s)
+}
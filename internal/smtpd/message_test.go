@@ -0,0 +1,66 @@
+package smtpd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		from    string
+		subject string
+		text    string
+	}{
+		{
+			name:    "plain text",
+			data:    "From: Alice <alice@example.com>\r\nSubject: Hello\r\n\r\nCall me back\r\n",
+			from:    "alice@example.com",
+			subject: "Hello",
+			text:    "Call me back",
+		},
+		{
+			name:    "encoded subject and quoted-printable body",
+			data:    "From: alice@example.com\r\nSubject: =?UTF-8?Q?Caf=C3=A9?=\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nMeet at the caf=C3=A9 at 5=\r\npm\r\n",
+			from:    "alice@example.com",
+			subject: "Café",
+			text:    "Meet at the café at 5pm",
+		},
+		{
+			name: "multipart prefers plain text",
+			data: "From: alice@example.com\r\nContent-Type: multipart/alternative; boundary=b1\r\n\r\n" +
+				"--b1\r\nContent-Type: text/html\r\n\r\n<p>HTML version</p>\r\n" +
+				"--b1\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\nUGxhaW4gdmVyc2lv\r\nbg==\r\n" +
+				"--b1--\r\n",
+			from: "alice@example.com",
+			text: "Plain version",
+		},
+		{
+			name: "html only, attachment ignored",
+			data: "From: alice@example.com\r\nContent-Type: multipart/mixed; boundary=b1\r\n\r\n" +
+				"--b1\r\nContent-Type: text/html\r\n\r\n<style>p{}</style><p>Running &amp; late</p>\r\n" +
+				"--b1\r\nContent-Type: text/plain\r\nContent-Disposition: attachment; filename=notes.txt\r\n\r\nsecret\r\n" +
+				"--b1--\r\n",
+			from: "alice@example.com",
+			text: "Running & late",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := ParseMessage([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("ParseMessage failed: %v", err)
+			}
+			if msg.From != tt.from {
+				t.Errorf("Expected from %q, got %q", tt.from, msg.From)
+			}
+			if msg.Subject != tt.subject {
+				t.Errorf("Expected subject %q, got %q", tt.subject, msg.Subject)
+			}
+			if got := strings.TrimSpace(msg.Text); got != tt.text {
+				t.Errorf("Expected text %q, got %q", tt.text, got)
+			}
+		})
+	}
+}
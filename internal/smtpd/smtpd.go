@@ -0,0 +1,260 @@
+// Package smtpd implements a minimal receive-only SMTP server (RFC 5321)
+// used by the email-to-SMS gateway. It never relays: the Handler decides
+// which senders and recipients are accepted.
+package smtpd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRejected is wrapped by Handler errors that permanently refuse a
+// sender, recipient or message. Other errors are reported as temporary.
+var ErrRejected = errors.New("rejected")
+
+// errTooLarge is returned when a message exceeds the size limit
+var errTooLarge = errors.New("message too large")
+
+// Envelope is a message received from a client
+type Envelope struct {
+	Remote net.Addr
+	From   string
+	To     []string
+	Data   []byte
+}
+
+// Handler accepts senders and recipients and delivers received messages
+type Handler interface {
+	Sender(from string, remote net.Addr) error
+	Recipient(to string) error
+	Deliver(env *Envelope) error
+}
+
+// Server accepts mail for a Handler
+type Server struct {
+	handler       Handler
+	hostname      string
+	maxSize       int
+	maxRecipients int
+	timeout       time.Duration
+
+	mu       sync.Mutex
+	listener net.Listener
+}
+
+// NewServer creates a Server for the handler that accepts messages of up
+// to maxSize bytes
+func NewServer(handler Handler, hostname string, maxSize int) *Server {
+	return &Server{
+		handler:       handler,
+		hostname:      hostname,
+		maxSize:       maxSize,
+		maxRecipients: 10,
+		timeout:       2 * time.Minute,
+	}
+}
+
+// ListenAndServe listens on the TCP address and serves clients until Close is called
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve serves clients connecting to l until Close is called
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// handleConn runs an SMTP session
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	reply := func(code int, msg string) {
+		tp.PrintfLine("%d %s", code, msg)
+	}
+
+	reply(220, s.hostname+" ESMTP GoSIP")
+
+	var env *Envelope
+	for {
+		conn.SetDeadline(time.Now().Add(s.timeout))
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			reply(250, s.hostname)
+		case "EHLO":
+			tp.PrintfLine("250-%s", s.hostname)
+			tp.PrintfLine("250-8BITMIME")
+			reply(250, fmt.Sprintf("SIZE %d", s.maxSize))
+		case "MAIL":
+			if env != nil {
+				reply(503, "Sender already specified")
+				continue
+			}
+			from, params, ok := parsePath(arg, "FROM:")
+			if !ok {
+				reply(501, "Syntax: MAIL FROM:<address>")
+				continue
+			}
+			if size, err := strconv.Atoi(params["SIZE"]); err == nil && size > s.maxSize {
+				reply(552, "Message too large")
+				continue
+			}
+			if err := s.handler.Sender(from, conn.RemoteAddr()); err != nil {
+				replyError(reply, err)
+				continue
+			}
+			env = &Envelope{Remote: conn.RemoteAddr(), From: from}
+			reply(250, "OK")
+		case "RCPT":
+			if env == nil {
+				reply(503, "Need MAIL before RCPT")
+				continue
+			}
+			to, _, ok := parsePath(arg, "TO:")
+			if !ok || to == "" {
+				reply(501, "Syntax: RCPT TO:<address>")
+				continue
+			}
+			if len(env.To) >= s.maxRecipients {
+				reply(452, "Too many recipients")
+				continue
+			}
+			if err := s.handler.Recipient(to); err != nil {
+				replyError(reply, err)
+				continue
+			}
+			env.To = append(env.To, to)
+			reply(250, "OK")
+		case "DATA":
+			if env == nil || len(env.To) == 0 {
+				reply(503, "Need RCPT before DATA")
+				continue
+			}
+			reply(354, "End data with <CR><LF>.<CR><LF>")
+			data, err := readData(tp.DotReader(), s.maxSize)
+			if errors.Is(err, errTooLarge) {
+				env = nil
+				reply(552, "Message too large")
+				continue
+			}
+			if err != nil {
+				return
+			}
+
+			env.Data = data
+			err = s.handler.Deliver(env)
+			if err != nil {
+				slog.Debug("SMTP delivery refused", "from", env.From, "remote", env.Remote.String(), "error", err)
+				replyError(reply, err)
+			} else {
+				reply(250, "OK: queued")
+			}
+			env = nil
+		case "RSET":
+			env = nil
+			reply(250, "OK")
+		case "NOOP":
+			reply(250, "OK")
+		case "VRFY":
+			reply(252, "Cannot VRFY user")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			reply(502, "Command not implemented")
+		}
+	}
+}
+
+// replyError reports a Handler error as a permanent or temporary failure
+func replyError(reply func(int, string), err error) {
+	if errors.Is(err, ErrRejected) {
+		reply(550, err.Error())
+		return
+	}
+	reply(451, "Local error, try again later")
+}
+
+// readData reads a dot-terminated message, discarding the rest of it once
+// it exceeds maxSize so the session can continue
+func readData(r io.Reader, maxSize int) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSize {
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return nil, err
+		}
+		return nil, errTooLarge
+	}
+	return data, nil
+}
+
+// parsePath parses the argument of MAIL or RCPT, such as
+// "FROM:<user@example.com> SIZE=1024", into the address and its parameters
+func parsePath(arg, prefix string) (string, map[string]string, bool) {
+	arg = strings.TrimSpace(arg)
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", nil, false
+	}
+	arg = strings.TrimSpace(arg[len(prefix):])
+
+	var address, rest string
+	if strings.HasPrefix(arg, "<") {
+		end := strings.Index(arg, ">")
+		if end < 0 {
+			return "", nil, false
+		}
+		address, rest = arg[1:end], arg[end+1:]
+	} else {
+		address, rest, _ = strings.Cut(arg, " ")
+	}
+
+	params := make(map[string]string)
+	for _, p := range strings.Fields(rest) {
+		key, value, _ := strings.Cut(p, "=")
+		params[strings.ToUpper(key)] = value
+	}
+	return address, params, true
+}
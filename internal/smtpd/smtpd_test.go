@@ -0,0 +1,126 @@
+package smtpd
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type testHandler struct {
+	mu        sync.Mutex
+	delivered []*Envelope
+}
+
+func (h *testHandler) Sender(from string, remote net.Addr) error {
+	if from != "alice@example.com" {
+		return fmt.Errorf("%w: sender not allowed", ErrRejected)
+	}
+	return nil
+}
+
+func (h *testHandler) Recipient(to string) error {
+	if !strings.HasSuffix(to, "@sms.example.com") {
+		return fmt.Errorf("%w: relay not permitted", ErrRejected)
+	}
+	return nil
+}
+
+func (h *testHandler) Deliver(env *Envelope) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.delivered = append(h.delivered, env)
+	return nil
+}
+
+func startServer(t *testing.T, handler Handler, maxSize int) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	server := NewServer(handler, "mail.example.com", maxSize)
+	go server.Serve(l)
+	t.Cleanup(func() { server.Close() })
+
+	return l.Addr().String()
+}
+
+func TestServer_Deliver(t *testing.T) {
+	handler := &testHandler{}
+	addr := startServer(t, handler, 1024)
+
+	msg := "From: alice@example.com\r\nSubject: Hi\r\n\r\nHello there\r\n"
+	err := smtp.SendMail(addr, nil, "alice@example.com", []string{"+15551234567@sms.example.com"}, []byte(msg))
+	if err != nil {
+		t.Fatalf("SendMail failed: %v", err)
+	}
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if len(handler.delivered) != 1 {
+		t.Fatalf("Expected 1 delivered message, got %d", len(handler.delivered))
+	}
+	env := handler.delivered[0]
+	if env.From != "alice@example.com" || len(env.To) != 1 || env.To[0] != "+15551234567@sms.example.com" {
+		t.Errorf("Unexpected envelope: from %q, to %v", env.From, env.To)
+	}
+	if !strings.Contains(string(env.Data), "Hello there") {
+		t.Errorf("Expected message body in data, got %q", env.Data)
+	}
+}
+
+func TestServer_Rejections(t *testing.T) {
+	addr := startServer(t, &testHandler{}, 64)
+
+	tests := []struct {
+		name string
+		from string
+		to   string
+		body string
+		want string
+	}{
+		{"sender not allowed", "mallory@example.com", "+15551234567@sms.example.com", "Hi", "550"},
+		{"relay refused", "alice@example.com", "bob@example.org", "Hi", "550"},
+		{"too large", "alice@example.com", "+15551234567@sms.example.com", strings.Repeat("x", 200), "552"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := smtp.SendMail(addr, nil, tt.from, []string{tt.to}, []byte("Subject: x\r\n\r\n"+tt.body+"\r\n"))
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("Expected %s error, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    string
+		size    string
+		wantErr bool
+	}{
+		{"FROM:<alice@example.com>", "alice@example.com", "", false},
+		{"from: <alice@example.com> SIZE=512 BODY=8BITMIME", "alice@example.com", "512", false},
+		{"FROM:<>", "", "", false},
+		{"FROM:alice@example.com", "alice@example.com", "", false},
+		{"FROM:<alice@example.com", "", "", true},
+		{"TO:<bob@example.com>", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, params, ok := parsePath(tt.arg, "FROM:")
+			if ok == tt.wantErr {
+				t.Fatalf("Expected ok=%v, got %v", !tt.wantErr, ok)
+			}
+			if got != tt.want || params["SIZE"] != tt.size {
+				t.Errorf("Expected %q size %q, got %q size %q", tt.want, tt.size, got, params["SIZE"])
+			}
+		})
+	}
+}
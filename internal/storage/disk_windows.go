@@ -0,0 +1,8 @@
+package storage
+
+import "errors"
+
+// DiskUsage isn't implemented on Windows
+func DiskUsage(path string) (free, total uint64, err error) {
+	return 0, 0, errors.New("not supported on Windows")
+}
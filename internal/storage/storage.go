@@ -0,0 +1,258 @@
+// Package storage measures what the data directory holds, refuses new
+// recordings before the disk fills up and suggests what to clean up
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/announcements"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+)
+
+// SettingMinFreeMB is the database setting holding the free space, in MB,
+// below which new recordings are refused. 0 turns the guardrail off.
+const SettingMinFreeMB = "storage_min_free_mb"
+
+// Categories of stored data
+const (
+	CategoryDatabase   = "database"
+	CategoryRecordings = "recordings"
+	CategoryVoicemails = "voicemails"
+	CategoryBackups    = "backups"
+	CategoryCompliance = "compliance_exports"
+	CategoryPrompts    = "prompts"
+)
+
+// Category is the disk space one kind of data uses
+type Category struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+	Files int    `json:"files"`
+}
+
+// Suggestion is something that could be cleaned up to free space
+type Suggestion struct {
+	Category string `json:"category"`
+	Message  string `json:"message"`
+	Bytes    int64  `json:"bytes"`            // Space it would free
+	Action   string `json:"action,omitempty"` // API request that does it
+}
+
+// Report is the outcome of a disk usage check
+type Report struct {
+	Path         string       `json:"path"`
+	FreeBytes    uint64       `json:"free_bytes"`
+	TotalBytes   uint64       `json:"total_bytes"`
+	MinFreeBytes uint64       `json:"min_free_bytes"`
+	Low          bool         `json:"low"` // New recordings are refused
+	Error        string       `json:"error,omitempty"`
+	Categories   []Category   `json:"categories"`
+	Suggestions  []Suggestion `json:"suggestions"`
+	CheckedAt    time.Time    `json:"checked_at"`
+}
+
+// Notifier is told when the disk runs low
+type Notifier interface {
+	SendLowDiskWarning(path string, free, minFree uint64) error
+}
+
+// Monitor measures disk usage every StorageCheckInterval, raising an
+// announcement and notifying once while free space is below the minimum
+type Monitor struct {
+	cfg      *config.Config
+	database *db.DB
+	hub      *events.Hub
+	notifier Notifier
+
+	// Replaced in tests
+	diskUsage func(path string) (free, total uint64, err error)
+
+	// checkMu serializes checks so scheduled and manual checks don't interleave
+	checkMu sync.Mutex
+
+	mu       sync.RWMutex
+	report   *Report
+	notified bool // The low disk notification went out
+}
+
+// NewMonitor creates a Monitor. notifier may be nil.
+func NewMonitor(cfg *config.Config, database *db.DB, hub *events.Hub, notifier Notifier) *Monitor {
+	return &Monitor{
+		cfg:       cfg,
+		database:  database,
+		hub:       hub,
+		notifier:  notifier,
+		diskUsage: DiskUsage,
+	}
+}
+
+// Start checks disk usage now and then every StorageCheckInterval
+func (m *Monitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(config.StorageCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			m.Check(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Report returns the last check, nil before the first
+func (m *Monitor) Report() *Report {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.report
+}
+
+// minFree returns the free space below which recordings are refused
+func (m *Monitor) minFree(ctx context.Context) uint64 {
+	mb := config.DefaultStorageMinFreeMB
+	if value, err := m.database.Config.Get(ctx, SettingMinFreeMB); err == nil && value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+			mb = parsed
+		}
+	}
+	return uint64(mb) << 20
+}
+
+// Low reports whether free space is below the minimum right now. It is
+// checked before every recording, so it doesn't wait for the next
+// scheduled check. Unknown free space isn't low.
+func (m *Monitor) Low(ctx context.Context) bool {
+	free, _, err := m.diskUsage(m.cfg.DataDir)
+	return err == nil && free < m.minFree(ctx)
+}
+
+// Check measures free space and what each category uses, updates the low
+// disk announcement and notifies when free space first drops too low
+func (m *Monitor) Check(ctx context.Context) *Report {
+	m.checkMu.Lock()
+	defer m.checkMu.Unlock()
+
+	now := time.Now()
+	report := &Report{Path: m.cfg.DataDir, MinFreeBytes: m.minFree(ctx), CheckedAt: now}
+	if free, total, err := m.diskUsage(m.cfg.DataDir); err != nil {
+		report.Error = fmt.Sprintf("Free space is unknown: %v", err)
+	} else {
+		report.FreeBytes, report.TotalBytes = free, total
+		report.Low = free < report.MinFreeBytes
+	}
+	report.Categories, report.Suggestions = m.measure(now)
+
+	m.mu.Lock()
+	m.report = report
+	notify := report.Low && !m.notified
+	m.notified = report.Low
+	m.mu.Unlock()
+
+	problem := ""
+	if report.Low {
+		problem = fmt.Sprintf("Only %s is free in %s, below the %s minimum",
+			FormatBytes(report.FreeBytes), report.Path, FormatBytes(report.MinFreeBytes))
+	}
+	announcements.RecordLowDisk(ctx, m.database, m.hub, problem)
+
+	if notify && m.notifier != nil {
+		if err := m.notifier.SendLowDiskWarning(report.Path, report.FreeBytes, report.MinFreeBytes); err != nil {
+			slog.Warn("Failed to send low disk space notification", "error", err)
+		}
+	}
+	return report
+}
+
+// measure totals each category and suggests what to clean up, largest first
+func (m *Monitor) measure(now time.Time) ([]Category, []Suggestion) {
+	dbPath := m.cfg.DBPath()
+	dirs := []struct {
+		name, path string
+		maxAge     time.Duration // Files older than this are suggested for cleanup
+		suggestion string
+		action     string
+	}{
+		{CategoryRecordings, m.cfg.RecordingsPath(), config.StorageFileMaxAge, "Delete %d recordings older than %d days", ""},
+		{CategoryVoicemails, m.cfg.VoicemailsPath(), config.StorageFileMaxAge, "Delete %d voicemail files older than %d days", ""},
+		{CategoryBackups, m.database.GetBackupsDir(), config.StorageBackupMaxAge, "Delete %d backups older than %d days", "POST /api/system/backups/cleanup"},
+		{CategoryCompliance, m.cfg.CompliancePath(), config.StorageFileMaxAge, "Move %d compliance exports older than %d days off the server", ""},
+		{CategoryPrompts, m.cfg.PromptsPath(), 0, "", ""},
+	}
+
+	database := Category{Name: CategoryDatabase, Path: dbPath}
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if info, err := os.Stat(dbPath + suffix); err == nil {
+			database.Bytes += info.Size()
+			database.Files++
+		}
+	}
+	categories := []Category{database}
+
+	var suggestions []Suggestion
+	for _, dir := range dirs {
+		category := Category{Name: dir.name, Path: dir.path}
+		var oldBytes int64
+		var oldFiles int
+		filepath.WalkDir(dir.path, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+			category.Bytes += info.Size()
+			category.Files++
+			if dir.maxAge > 0 && now.Sub(info.ModTime()) > dir.maxAge {
+				oldBytes += info.Size()
+				oldFiles++
+			}
+			return nil
+		})
+		categories = append(categories, category)
+
+		if oldFiles > 0 {
+			suggestions = append(suggestions, Suggestion{
+				Category: dir.name,
+				Message:  fmt.Sprintf(dir.suggestion, oldFiles, int(dir.maxAge.Hours()/24)),
+				Bytes:    oldBytes,
+				Action:   dir.action,
+			})
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool { return suggestions[i].Bytes > suggestions[j].Bytes })
+	if suggestions == nil {
+		suggestions = []Suggestion{}
+	}
+	return categories, suggestions
+}
+
+// FormatBytes renders a size in binary units, e.g. "1.5 GiB"
+func FormatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/announcements"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+)
+
+type lowDiskNotifier struct {
+	warnings int
+}
+
+func (n *lowDiskNotifier) SendLowDiskWarning(path string, free, minFree uint64) error {
+	n.warnings++
+	return nil
+}
+
+func setupTestMonitor(t *testing.T) (*Monitor, *lowDiskNotifier, string) {
+	t.Helper()
+
+	database, err := db.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Close()
+	})
+
+	dir := t.TempDir()
+	cfg := &config.Config{DataDir: dir}
+	if err := cfg.EnsureDirectories(); err != nil {
+		t.Fatalf("Failed to create data directories: %v", err)
+	}
+	if err := database.SetBackupsDir(cfg.BackupsPath()); err != nil {
+		t.Fatalf("Failed to set backups directory: %v", err)
+	}
+
+	notifier := &lowDiskNotifier{}
+	return NewMonitor(cfg, database, nil, notifier), notifier, dir
+}
+
+func writeFile(t *testing.T, path string, size int, age time.Duration) {
+	t.Helper()
+	if err := os.WriteFile(path, make([]byte, size), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	modified := time.Now().Add(-age)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatalf("Failed to age %s: %v", path, err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	m, notifier, dir := setupTestMonitor(t)
+	ctx := context.Background()
+
+	writeFile(t, filepath.Join(dir, config.DefaultDBFile), 4096, 0)
+	writeFile(t, filepath.Join(dir, config.BackupsDir, "backup_old.db"), 2000, 40*24*time.Hour)
+	writeFile(t, filepath.Join(dir, config.BackupsDir, "backup_new.db"), 1000, time.Hour)
+	writeFile(t, filepath.Join(dir, config.ComplianceDir, "export.jsonl"), 500, 100*24*time.Hour)
+
+	free := uint64(2 << 30)
+	m.diskUsage = func(path string) (uint64, uint64, error) { return free, 100 << 30, nil }
+
+	report := m.Check(ctx)
+	if report.Low || report.MinFreeBytes != config.DefaultStorageMinFreeMB<<20 {
+		t.Fatalf("Expected plenty of space against the default minimum, got %+v", report)
+	}
+	sizes := map[string]int64{}
+	for _, category := range report.Categories {
+		sizes[category.Name] = category.Bytes
+	}
+	if sizes[CategoryDatabase] != 4096 || sizes[CategoryBackups] != 3000 || sizes[CategoryCompliance] != 500 || sizes[CategoryRecordings] != 0 {
+		t.Errorf("Unexpected category sizes %v", sizes)
+	}
+	if len(report.Suggestions) != 2 || report.Suggestions[0].Category != CategoryBackups ||
+		report.Suggestions[0].Bytes != 2000 || report.Suggestions[0].Action == "" || report.Suggestions[1].Category != CategoryCompliance {
+		t.Errorf("Unexpected suggestions %+v", report.Suggestions)
+	}
+
+	// Running low raises an announcement and notifies once
+	free = 512 << 20
+	if !m.Low(ctx) {
+		t.Error("Expected Low below the minimum")
+	}
+	m.Check(ctx)
+	m.Check(ctx)
+	if notifier.warnings != 1 {
+		t.Errorf("Expected one low disk notification, got %d", notifier.warnings)
+	}
+	if _, err := m.database.Announcements.GetByKey(ctx, announcements.KeyLowDisk); err != nil {
+		t.Errorf("Expected a low disk announcement, got %v", err)
+	}
+
+	// A lower minimum clears it
+	m.database.Config.Set(ctx, SettingMinFreeMB, "256")
+	if report := m.Check(ctx); report.Low || m.Low(ctx) {
+		t.Errorf("Expected enough space against a 256 MB minimum, got %+v", report)
+	}
+	if _, err := m.database.Announcements.GetByKey(ctx, announcements.KeyLowDisk); err != db.ErrAnnouncementNotFound {
+		t.Errorf("Expected the announcement cleared, got %v", err)
+	}
+
+	// 0 turns the guardrail off
+	m.database.Config.Set(ctx, SettingMinFreeMB, "0")
+	free = 0
+	if m.Low(ctx) {
+		t.Error("Expected no guardrail with a 0 MB minimum")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[uint64]string{512: "512 B", 1536: "1.5 KiB", 5 << 30: "5.0 GiB"} {
+		if got := FormatBytes(n); got != want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Package tftp implements a minimal read-only TFTP server (RFC 1350) used to
+// serve provisioning files to IP phones that only support TFTP
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TFTP opcodes
+const (
+	opRRQ   = 1
+	opWRQ   = 2
+	opDATA  = 3
+	opACK   = 4
+	opERROR = 5
+)
+
+// TFTP error codes
+const (
+	errCodeUndefined       = 0
+	errCodeFileNotFound    = 1
+	errCodeAccessViolation = 2
+	errCodeIllegalOp       = 4
+)
+
+// blockSize is the fixed RFC 1350 data block size
+const blockSize = 512
+
+// Errors a Handler returns to send a specific TFTP error to the client
+var (
+	ErrFileNotFound    = errors.New("file not found")
+	ErrAccessViolation = errors.New("access violation")
+)
+
+// Handler returns the contents of a requested file
+type Handler func(filename string, remote net.Addr) ([]byte, error)
+
+// Server serves read requests from a Handler
+type Server struct {
+	handler Handler
+	timeout time.Duration
+	retries int
+
+	mu   sync.Mutex
+	conn net.PacketConn
+}
+
+// NewServer creates a Server for the handler
+func NewServer(handler Handler) *Server {
+	return &Server{
+		handler: handler,
+		timeout: time.Second,
+		retries: 5,
+	}
+}
+
+// ListenAndServe listens on the UDP address and serves requests until Close is called
+func (s *Server) ListenAndServe(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(conn)
+}
+
+// Serve serves requests arriving on conn until Close is called
+func (s *Server) Serve(conn net.PacketConn) error {
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+
+	buf := make([]byte, 1500)
+	for {
+		n, remote, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.handleRequest(append([]byte(nil), buf[:n]...), remote)
+	}
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// handleRequest answers a request from a new transfer ID (port), as RFC 1350 requires
+func (s *Server) handleRequest(packet []byte, remote net.Addr) {
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		slog.Error("TFTP transfer socket failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	if len(packet) < 2 {
+		return
+	}
+
+	switch binary.BigEndian.Uint16(packet) {
+	case opRRQ:
+	case opWRQ:
+		sendError(conn, remote, errCodeAccessViolation, "server is read-only")
+		return
+	default:
+		sendError(conn, remote, errCodeIllegalOp, "illegal TFTP operation")
+		return
+	}
+
+	filename, err := parseRequest(packet)
+	if err != nil {
+		sendError(conn, remote, errCodeIllegalOp, err.Error())
+		return
+	}
+
+	data, err := s.handler(filename, remote)
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		sendError(conn, remote, errCodeFileNotFound, "file not found")
+		return
+	case errors.Is(err, ErrAccessViolation):
+		sendError(conn, remote, errCodeAccessViolation, "access violation")
+		return
+	case err != nil:
+		sendError(conn, remote, errCodeUndefined, "internal error")
+		return
+	}
+
+	if err := s.send(conn, remote, data); err != nil {
+		slog.Debug("TFTP transfer failed", "file", filename, "remote", remote.String(), "error", err)
+	}
+}
+
+// send transfers data in 512-byte blocks, waiting for each block to be acknowledged
+func (s *Server) send(conn net.PacketConn, remote net.Addr, data []byte) error {
+	ack := make([]byte, 4)
+	for block := uint16(1); ; block++ {
+		chunk := data
+		if len(chunk) > blockSize {
+			chunk = chunk[:blockSize]
+		}
+		data = data[len(chunk):]
+
+		packet := make([]byte, 4+len(chunk))
+		binary.BigEndian.PutUint16(packet, opDATA)
+		binary.BigEndian.PutUint16(packet[2:], block)
+		copy(packet[4:], chunk)
+
+		if err := s.sendBlock(conn, remote, packet, block, ack); err != nil {
+			return err
+		}
+
+		// A short block ends the transfer
+		if len(chunk) < blockSize {
+			return nil
+		}
+	}
+}
+
+// sendBlock sends a DATA packet and retransmits it until the matching ACK arrives
+func (s *Server) sendBlock(conn net.PacketConn, remote net.Addr, packet []byte, block uint16, ack []byte) error {
+	for attempt := 0; attempt <= s.retries; attempt++ {
+		if _, err := conn.WriteTo(packet, remote); err != nil {
+			return err
+		}
+
+		conn.SetReadDeadline(time.Now().Add(s.timeout))
+		for {
+			n, from, err := conn.ReadFrom(ack)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return err
+			}
+			if from.String() != remote.String() || n < 4 {
+				continue
+			}
+			switch binary.BigEndian.Uint16(ack) {
+			case opACK:
+				if binary.BigEndian.Uint16(ack[2:]) == block {
+					return nil
+				}
+			case opERROR:
+				return errors.New("transfer aborted by client")
+			}
+		}
+	}
+	return fmt.Errorf("no acknowledgement for block %d", block)
+}
+
+// parseRequest extracts the filename from a read request, rejecting paths
+// that try to leave the served directory
+func parseRequest(packet []byte) (string, error) {
+	fields := bytes.Split(packet[2:], []byte{0})
+	if len(fields) < 2 || len(fields[0]) == 0 {
+		return "", errors.New("malformed request")
+	}
+
+	mode := strings.ToLower(string(fields[1]))
+	if mode != "octet" && mode != "netascii" {
+		return "", fmt.Errorf("unsupported mode %q", mode)
+	}
+
+	filename := strings.TrimLeft(string(fields[0]), "/")
+	if strings.Contains(filename, "..") {
+		return "", errors.New("invalid filename")
+	}
+	return filename, nil
+}
+
+// sendError sends an ERROR packet
+func sendError(conn net.PacketConn, remote net.Addr, code uint16, message string) {
+	packet := make([]byte, 4, 5+len(message))
+	binary.BigEndian.PutUint16(packet, opERROR)
+	binary.BigEndian.PutUint16(packet[2:], code)
+	packet = append(packet, message...)
+	packet = append(packet, 0)
+	conn.WriteTo(packet, remote)
+}
+
+// Fetch downloads a file from a TFTP server
+func Fetch(ctx context.Context, addr, filename string) ([]byte, error) {
+	server, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	if d, ok := ctx.Deadline(); ok {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	request := make([]byte, 2, 2+len(filename)+1+len("octet")+1)
+	binary.BigEndian.PutUint16(request, opRRQ)
+	request = append(request, filename...)
+	request = append(request, 0)
+	request = append(request, "octet"...)
+	request = append(request, 0)
+	if _, err := conn.WriteTo(request, server); err != nil {
+		return nil, err
+	}
+
+	var (
+		data     []byte
+		expected = uint16(1)
+		buf      = make([]byte, 4+blockSize)
+		ack      = make([]byte, 4)
+	)
+	binary.BigEndian.PutUint16(ack, opACK)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return nil, err
+		}
+		if n < 4 {
+			continue
+		}
+
+		switch binary.BigEndian.Uint16(buf) {
+		case opERROR:
+			return nil, fmt.Errorf("tftp error %d: %s", binary.BigEndian.Uint16(buf[2:]), strings.TrimRight(string(buf[4:n]), "\x00"))
+		case opDATA:
+			block := binary.BigEndian.Uint16(buf[2:])
+			binary.BigEndian.PutUint16(ack[2:], block)
+			if _, err := conn.WriteTo(ack, from); err != nil {
+				return nil, err
+			}
+			if block != expected {
+				continue
+			}
+			data = append(data, buf[4:n]...)
+			expected++
+			if n-4 < blockSize {
+				return data, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startServer(t *testing.T, handler Handler) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	server := NewServer(handler)
+	go server.Serve(conn)
+	t.Cleanup(func() { server.Close() })
+
+	return conn.LocalAddr().String()
+}
+
+func TestServer_Fetch(t *testing.T) {
+	files := map[string][]byte{
+		"small.cfg": []byte("hello"),
+		"exact.cfg": bytes.Repeat([]byte("a"), blockSize),
+		"large.cfg": bytes.Repeat([]byte("0123456789"), 200),
+	}
+	addr := startServer(t, func(filename string, remote net.Addr) ([]byte, error) {
+		if data, ok := files[filename]; ok {
+			return data, nil
+		}
+		return nil, ErrFileNotFound
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for name, want := range files {
+		t.Run(name, func(t *testing.T) {
+			got, err := Fetch(ctx, addr, name)
+			if err != nil {
+				t.Fatalf("Fetch failed: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Expected %d bytes, got %d", len(want), len(got))
+			}
+		})
+	}
+}
+
+func TestServer_FileNotFound(t *testing.T) {
+	addr := startServer(t, func(filename string, remote net.Addr) ([]byte, error) {
+		return nil, ErrFileNotFound
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := Fetch(ctx, addr, "missing.cfg")
+	if err == nil || !strings.Contains(err.Error(), "tftp error 1") {
+		t.Errorf("Expected file not found error, got %v", err)
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		packet  []byte
+		want    string
+		wantErr bool
+	}{
+		{"octet", []byte("\x00\x01cfg000b82123456.xml\x00octet\x00"), "cfg000b82123456.xml", false},
+		{"netascii with leading slash", []byte("\x00\x01/805ec0aabbcc.cfg\x00netascii\x00"), "805ec0aabbcc.cfg", false},
+		{"path traversal", []byte("\x00\x01../etc/passwd\x00octet\x00"), "", true},
+		{"mail mode", []byte("\x00\x01file\x00mail\x00"), "", true},
+		{"malformed", []byte("\x00\x01"), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRequest(tt.packet)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRequest error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -2,11 +2,14 @@ package twilio
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/retry"
 	"github.com/twilio/twilio-go"
 	twilioApi "github.com/twilio/twilio-go/rest/api/v2010"
 )
@@ -51,6 +54,9 @@ func (c *Client) UpdateCredentials(accountSID, authToken string) {
 		Username: accountSID,
 		Password: authToken,
 	})
+	if c.cfg != nil && c.cfg.TwilioEdge != "" {
+		c.client.SetEdge(c.cfg.TwilioEdge)
+	}
 	c.healthy = true
 	c.failureCount = 0
 }
@@ -62,7 +68,8 @@ func (c *Client) IsHealthy() bool {
 	return c.healthy && c.client != nil
 }
 
-// SendSMS sends an SMS message with retry logic
+// SendSMS sends an SMS message with retry logic. from is either a phone
+// number or a Messaging Service SID, which lets Twilio pick the sender.
 func (c *Client) SendSMS(from, to, body string, mediaURLs []string) (string, error) {
 	c.mu.RLock()
 	if c.client == nil {
@@ -71,22 +78,17 @@ func (c *Client) SendSMS(from, to, body string, mediaURLs []string) (string, err
 	}
 	c.mu.RUnlock()
 
-	var lastErr error
-	for attempt := 0; attempt < config.TwilioMaxRetries; attempt++ {
-		sid, err := c.sendSMSOnce(from, to, body, mediaURLs)
-		if err == nil {
-			c.recordSuccess()
-			return sid, nil
+	var sid string
+	err := retry.For(config.RetryWorkerTwilio).Do(context.Background(), func() error {
+		var err error
+		if sid, err = c.sendSMSOnce(from, to, body, mediaURLs); err != nil {
+			c.recordFailure()
+			return err
 		}
-		lastErr = err
-		c.recordFailure()
-
-		// Exponential backoff
-		backoff := time.Duration(1<<uint(attempt)) * time.Second
-		time.Sleep(backoff)
-	}
-
-	return "", fmt.Errorf("failed after %d retries: %w", config.TwilioMaxRetries, lastErr)
+		c.recordSuccess()
+		return nil
+	})
+	return sid, err
 }
 
 func (c *Client) sendSMSOnce(from, to, body string, mediaURLs []string) (string, error) {
@@ -95,7 +97,7 @@ func (c *Client) sendSMSOnce(from, to, body string, mediaURLs []string) (string,
 	c.mu.RUnlock()
 
 	params := &twilioApi.CreateMessageParams{}
-	params.SetFrom(from)
+	setSender(params, from)
 	params.SetTo(to)
 	params.SetBody(body)
 
@@ -115,8 +117,42 @@ func (c *Client) sendSMSOnce(from, to, body string, mediaURLs []string) (string,
 	return *resp.Sid, nil
 }
 
+// IsMessagingServiceSID reports whether s is a Twilio Messaging Service SID
+// rather than a phone number
+func IsMessagingServiceSID(s string) bool {
+	if len(s) != 34 || !strings.HasPrefix(s, "MG") {
+		return false
+	}
+	_, err := hex.DecodeString(s[2:])
+	return err == nil
+}
+
+// setSender sends from a Messaging Service when from is its SID, so Twilio
+// picks the number from the service's sender pool
+func setSender(params *twilioApi.CreateMessageParams, from string) {
+	if IsMessagingServiceSID(from) {
+		params.SetMessagingServiceSid(from)
+		return
+	}
+	params.SetFrom(from)
+}
+
 // MakeCall initiates an outbound call
 func (c *Client) MakeCall(from, to, url string) (string, error) {
+	params := &twilioApi.CreateCallParams{}
+	params.SetUrl(url)
+	return c.createCall(from, to, params)
+}
+
+// MakeCallTwiML initiates an outbound call that runs the given TwiML, so no
+// webhook has to be reachable
+func (c *Client) MakeCallTwiML(from, to, twiml string) (string, error) {
+	params := &twilioApi.CreateCallParams{}
+	params.SetTwiml(twiml)
+	return c.createCall(from, to, params)
+}
+
+func (c *Client) createCall(from, to string, params *twilioApi.CreateCallParams) (string, error) {
 	c.mu.RLock()
 	if c.client == nil {
 		c.mu.RUnlock()
@@ -125,10 +161,8 @@ func (c *Client) MakeCall(from, to, url string) (string, error) {
 	client := c.client
 	c.mu.RUnlock()
 
-	params := &twilioApi.CreateCallParams{}
 	params.SetFrom(from)
 	params.SetTo(to)
-	params.SetUrl(url)
 
 	resp, err := client.Api.CreateCall(params)
 	if err != nil {
@@ -513,6 +547,30 @@ func (c *Client) GetMessage(ctx context.Context, messageSID string) (*TwilioMess
 	return msg, nil
 }
 
+// GetCallPrice fetches what Twilio charged for a call. Price is empty
+// until Twilio has finalized it, usually a few minutes after the call ends.
+func (c *Client) GetCallPrice(ctx context.Context, callSID string) (price, priceUnit string, err error) {
+	c.mu.RLock()
+	if c.client == nil {
+		c.mu.RUnlock()
+		return "", "", fmt.Errorf("twilio client not initialized")
+	}
+	client := c.client
+	c.mu.RUnlock()
+
+	resp, err := client.Api.FetchCall(callSID, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("twilio API error: %w", err)
+	}
+	if resp.Price != nil {
+		price = *resp.Price
+	}
+	if resp.PriceUnit != nil {
+		priceUnit = *resp.PriceUnit
+	}
+	return price, priceUnit, nil
+}
+
 // ListMessages retrieves messages from Twilio with optional filtering
 func (c *Client) ListMessages(ctx context.Context, from, to string, limit int) ([]*TwilioMessage, error) {
 	c.mu.RLock()
@@ -621,22 +679,17 @@ func (c *Client) SendSMSWithCallback(from, to, body string, mediaURLs []string,
 	}
 	c.mu.RUnlock()
 
-	var lastErr error
-	for attempt := 0; attempt < config.TwilioMaxRetries; attempt++ {
-		sid, err := c.sendSMSWithCallbackOnce(from, to, body, mediaURLs, statusCallback)
-		if err == nil {
-			c.recordSuccess()
-			return sid, nil
+	var sid string
+	err := retry.For(config.RetryWorkerTwilio).Do(context.Background(), func() error {
+		var err error
+		if sid, err = c.sendSMSWithCallbackOnce(from, to, body, mediaURLs, statusCallback); err != nil {
+			c.recordFailure()
+			return err
 		}
-		lastErr = err
-		c.recordFailure()
-
-		// Exponential backoff
-		backoff := time.Duration(1<<uint(attempt)) * time.Second
-		time.Sleep(backoff)
-	}
-
-	return "", fmt.Errorf("failed after %d retries: %w", config.TwilioMaxRetries, lastErr)
+		c.recordSuccess()
+		return nil
+	})
+	return sid, err
 }
 
 func (c *Client) sendSMSWithCallbackOnce(from, to, body string, mediaURLs []string, statusCallback string) (string, error) {
@@ -645,7 +698,7 @@ func (c *Client) sendSMSWithCallbackOnce(from, to, body string, mediaURLs []stri
 	c.mu.RUnlock()
 
 	params := &twilioApi.CreateMessageParams{}
-	params.SetFrom(from)
+	setSender(params, from)
 	params.SetTo(to)
 	params.SetBody(body)
 
@@ -706,7 +759,7 @@ func (c *Client) GetMediaURLs(ctx context.Context, messageSID string) ([]string,
 	for _, media := range resp {
 		if media.Uri != nil {
 			// Convert relative URI to full URL
-			url := fmt.Sprintf("https://api.twilio.com%s", *media.Uri)
+			url := APIBaseURL(c.Edge()) + *media.Uri
 			// Remove .json extension for actual media URL
 			url = url[:len(url)-5] // Remove ".json"
 			urls = append(urls, url)
@@ -787,3 +787,24 @@ func TestClient_LastCheckUpdated(t *testing.T) {
 		t.Error("lastCheck should be updated to current time")
 	}
 }
+
+func TestIsMessagingServiceSID(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"MG0123456789abcdef0123456789abcdef", true},
+		{"MG0123456789ABCDEF0123456789ABCDEF", true},
+		{"+15551234567", false},
+		{"PN0123456789abcdef0123456789abcdef", false},
+		{"MG0123456789abcdef", false},
+		{"MGzz23456789abcdef0123456789abcdef", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsMessagingServiceSID(tt.input); got != tt.want {
+			t.Errorf("IsMessagingServiceSID(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
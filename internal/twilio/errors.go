@@ -0,0 +1,184 @@
+package twilio
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/twilio/twilio-go/client"
+)
+
+// ErrorInfo explains a Twilio error code to the people who run into it:
+// what went wrong and what to do about it
+type ErrorInfo struct {
+	Code        int    `json:"code,omitempty"` // Zero for errors that didn't come from Twilio
+	Title       string `json:"title"`
+	Message     string `json:"message,omitempty"` // What Twilio said, when it said more
+	Explanation string `json:"explanation,omitempty"`
+	Remediation string `json:"remediation,omitempty"`
+	MoreInfo    string `json:"more_info,omitempty"` // Twilio's page for the code
+}
+
+// errorKnowledgeBase holds the Twilio errors GoSIP users commonly run into,
+// by code
+var errorKnowledgeBase = map[int]ErrorInfo{
+	20003: {
+		Title:       "Authentication failed",
+		Explanation: "Twilio rejected the Account SID and Auth Token GoSIP signed in with.",
+		Remediation: "Check the Twilio credentials in the system settings. The Auth Token changes when it is rotated in the Twilio Console.",
+	},
+	20404: {
+		Title:       "Resource not found",
+		Explanation: "The number, message, call or trunk doesn't exist in this Twilio account.",
+		Remediation: "Check that it wasn't released or deleted in the Twilio Console, and that GoSIP uses the account that owns it.",
+	},
+	20429: {
+		Title:       "Too many requests",
+		Explanation: "Twilio is rate limiting the account.",
+		Remediation: "Wait a moment and try again. Sending fewer messages at once avoids it.",
+	},
+	21211: {
+		Title:       "Invalid 'To' phone number",
+		Explanation: "The number the message or call is to isn't a valid phone number.",
+		Remediation: "Enter the number in E.164 format, with + and the country code, e.g. +15551234567.",
+	},
+	21212: {
+		Title:       "Invalid 'From' phone number",
+		Explanation: "The number the message or call is from isn't a valid phone number or Messaging Service.",
+		Remediation: "Check the DID's number, or the Messaging Service SID in the settings.",
+	},
+	21215: {
+		Title:       "Calls to this country are not allowed",
+		Explanation: "The account's voice geographic permissions don't allow calls to this number.",
+		Remediation: "Enable the country under Voice > Settings > Geo permissions in the Twilio Console.",
+	},
+	21219: {
+		Title:       "Number not verified",
+		Explanation: "Trial accounts can only call verified numbers.",
+		Remediation: "Verify the number in the Twilio Console, or upgrade the account.",
+	},
+	21408: {
+		Title:       "SMS to this region is not enabled",
+		Explanation: "The account's messaging geographic permissions don't allow texts to this number's country.",
+		Remediation: "Enable the country under Messaging > Settings > Geo permissions in the Twilio Console.",
+	},
+	21602: {
+		Title:       "Message body required",
+		Explanation: "The message has neither text nor media.",
+		Remediation: "Add some text or an attachment.",
+	},
+	21606: {
+		Title:       "Number can't send messages",
+		Explanation: "The number the message is from isn't a messaging-capable Twilio number for this destination.",
+		Remediation: "Send from a DID with SMS enabled, or use a Messaging Service.",
+	},
+	21608: {
+		Title:       "Number not verified",
+		Explanation: "Trial accounts can only text verified numbers.",
+		Remediation: "Verify the number in the Twilio Console, or upgrade the account.",
+	},
+	21610: {
+		Title:       "Recipient unsubscribed",
+		Explanation: "The recipient replied STOP, so Twilio won't send them messages from this number.",
+		Remediation: "The recipient must reply START to receive messages again.",
+	},
+	21612: {
+		Title:       "Number can't receive messages",
+		Explanation: "The number the message is to can't be reached by SMS from this number, e.g. a landline or an unsupported carrier.",
+		Remediation: "Check that the recipient's number is a mobile number.",
+	},
+	21614: {
+		Title:       "Not a mobile number",
+		Explanation: "The number the message is to isn't a mobile number, so it can't receive texts.",
+		Remediation: "Call the number instead, or ask the recipient for a mobile number.",
+	},
+	21617: {
+		Title:       "Message too long",
+		Explanation: "The message is over Twilio's 1600 character limit.",
+		Remediation: "Shorten the message or split it into several.",
+	},
+	21620: {
+		Title:       "Invalid media URL",
+		Explanation: "Twilio couldn't use an attachment's URL.",
+		Remediation: "Check that attachments are publicly reachable over HTTPS and of a supported type.",
+	},
+	21660: {
+		Title:       "Number belongs to another account",
+		Explanation: "The number the message is from isn't in the Twilio account GoSIP uses.",
+		Remediation: "Check the DID's number and the Twilio credentials in the system settings.",
+	},
+	30003: {
+		Title:       "Handset unreachable",
+		Explanation: "The recipient's phone is off or out of coverage.",
+		Remediation: "Try again later.",
+	},
+	30004: {
+		Title:       "Message blocked",
+		Explanation: "The recipient or their carrier blocked the message.",
+		Remediation: "The recipient may have blocked the number; contact them another way.",
+	},
+	30005: {
+		Title:       "Unknown destination",
+		Explanation: "The recipient's number doesn't exist or is no longer in service.",
+		Remediation: "Check the number.",
+	},
+	30006: {
+		Title:       "Landline or unreachable carrier",
+		Explanation: "The number the message is to is a landline, or its carrier can't take texts.",
+		Remediation: "Call the number instead.",
+	},
+	30007: {
+		Title:       "Message filtered",
+		Explanation: "The carrier filtered the message as spam or against its rules.",
+		Remediation: "Register the number for A2P 10DLC or toll-free verification, and avoid link shorteners and spam-like wording.",
+	},
+	30008: {
+		Title:       "Unknown delivery error",
+		Explanation: "The carrier didn't say why the message wasn't delivered.",
+		Remediation: "Try again later; if it keeps failing, contact Twilio support with the message SID.",
+	},
+	30032: {
+		Title:       "Toll-free number not verified",
+		Explanation: "Carriers block texts from toll-free numbers that haven't been verified.",
+		Remediation: "Submit the toll-free verification in the Twilio Console.",
+	},
+	30034: {
+		Title:       "Number not registered for A2P 10DLC",
+		Explanation: "US carriers block texts from local numbers that aren't registered to an A2P 10DLC campaign.",
+		Remediation: "Register a brand and campaign in the Twilio Console and add the number to it.",
+	},
+	63016: {
+		Title:       "Outside the WhatsApp messaging window",
+		Explanation: "WhatsApp only allows free-form messages within 24 hours of the customer's last message.",
+		Remediation: "Wait for the customer to message first, or send an approved template.",
+	},
+}
+
+// errorDocsURL is Twilio's page for each error code
+const errorDocsURL = "https://www.twilio.com/docs/api/errors/"
+
+// LookupError returns the explanation of a Twilio error code. ok is false
+// for codes GoSIP doesn't know, which still get Twilio's page.
+func LookupError(code int) (info ErrorInfo, ok bool) {
+	info, ok = errorKnowledgeBase[code]
+	info.Code = code
+	info.MoreInfo = errorDocsURL + strconv.Itoa(code)
+	if !ok {
+		info.Title = "Twilio error " + strconv.Itoa(code)
+	}
+	return info, ok
+}
+
+// ExplainError returns the explanation of the Twilio error behind err, or
+// nil when err didn't come from the Twilio API
+func ExplainError(err error) *ErrorInfo {
+	var restErr *client.TwilioRestError
+	if !errors.As(err, &restErr) || restErr.Code == 0 {
+		return nil
+	}
+	info, _ := LookupError(restErr.Code)
+	info.Message = restErr.Message
+	if restErr.MoreInfo != "" {
+		info.MoreInfo = restErr.MoreInfo
+	}
+	return &info
+}
@@ -0,0 +1,50 @@
+package twilio
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/twilio/twilio-go/client"
+)
+
+func TestLookupError(t *testing.T) {
+	info, ok := LookupError(21610)
+	if !ok || info.Code != 21610 || info.Title != "Recipient unsubscribed" || info.Remediation == "" {
+		t.Errorf("Expected the unsubscribed explanation, got %+v", info)
+	}
+	if info.MoreInfo != "https://www.twilio.com/docs/api/errors/21610" {
+		t.Errorf("Expected Twilio's page, got %s", info.MoreInfo)
+	}
+
+	info, ok = LookupError(99999)
+	if ok || info.Title != "Twilio error 99999" || info.MoreInfo != "https://www.twilio.com/docs/api/errors/99999" {
+		t.Errorf("Expected a generic explanation for an unknown code, got %+v", info)
+	}
+}
+
+func TestExplainError(t *testing.T) {
+	restErr := &client.TwilioRestError{
+		Code:     21211,
+		Message:  "The 'To' number 555 is not a valid phone number.",
+		MoreInfo: "https://www.twilio.com/docs/errors/21211",
+		Status:   400,
+	}
+	// Errors come wrapped by the client and its retries
+	err := fmt.Errorf("failed after 3 attempts: %w", fmt.Errorf("twilio API error: %w", restErr))
+
+	info := ExplainError(err)
+	if info == nil {
+		t.Fatal("Expected the Twilio error explained")
+	}
+	if info.Code != 21211 || info.Title != "Invalid 'To' phone number" || info.Message != restErr.Message || info.MoreInfo != restErr.MoreInfo {
+		t.Errorf("Unexpected explanation %+v", info)
+	}
+
+	if ExplainError(errors.New("twilio client not initialized")) != nil {
+		t.Error("Expected no explanation for errors that didn't come from Twilio")
+	}
+	if ExplainError(&client.TwilioRestError{Status: 500}) != nil {
+		t.Error("Expected no explanation without an error code")
+	}
+}
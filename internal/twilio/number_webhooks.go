@@ -0,0 +1,87 @@
+package twilio
+
+import (
+	"context"
+	"fmt"
+
+	twilioApi "github.com/twilio/twilio-go/rest/api/v2010"
+)
+
+// NumberWebhooks are the URLs Twilio calls for a phone number: incoming
+// calls, their status changes, and incoming messages
+type NumberWebhooks struct {
+	VoiceURL             string `json:"voice_url"`
+	VoiceMethod          string `json:"voice_method"`
+	StatusCallback       string `json:"status_callback"`
+	StatusCallbackMethod string `json:"status_callback_method"`
+	SMSURL               string `json:"sms_url"`
+	SMSMethod            string `json:"sms_method"`
+}
+
+// GetNumberWebhooks returns the webhooks Twilio has for a phone number
+func (c *Client) GetNumberWebhooks(ctx context.Context, phoneNumberSID string) (*NumberWebhooks, error) {
+	c.mu.RLock()
+	if c.client == nil {
+		c.mu.RUnlock()
+		return nil, fmt.Errorf("twilio client not initialized")
+	}
+	client := c.client
+	c.mu.RUnlock()
+
+	resp, err := client.Api.FetchIncomingPhoneNumber(phoneNumberSID, &twilioApi.FetchIncomingPhoneNumberParams{})
+	if err != nil {
+		c.recordFailure()
+		return nil, fmt.Errorf("failed to fetch phone number: %w", err)
+	}
+	c.recordSuccess()
+
+	hooks := &NumberWebhooks{}
+	if resp.VoiceUrl != nil {
+		hooks.VoiceURL = *resp.VoiceUrl
+	}
+	if resp.VoiceMethod != nil {
+		hooks.VoiceMethod = *resp.VoiceMethod
+	}
+	if resp.StatusCallback != nil {
+		hooks.StatusCallback = *resp.StatusCallback
+	}
+	if resp.StatusCallbackMethod != nil {
+		hooks.StatusCallbackMethod = *resp.StatusCallbackMethod
+	}
+	if resp.SmsUrl != nil {
+		hooks.SMSURL = *resp.SmsUrl
+	}
+	if resp.SmsMethod != nil {
+		hooks.SMSMethod = *resp.SmsMethod
+	}
+	return hooks, nil
+}
+
+// SetNumberWebhooks points a phone number's webhooks at the given URLs. It
+// clears any TwiML application on the number, which would take precedence.
+func (c *Client) SetNumberWebhooks(ctx context.Context, phoneNumberSID string, hooks NumberWebhooks) error {
+	c.mu.RLock()
+	if c.client == nil {
+		c.mu.RUnlock()
+		return fmt.Errorf("twilio client not initialized")
+	}
+	client := c.client
+	c.mu.RUnlock()
+
+	params := &twilioApi.UpdateIncomingPhoneNumberParams{}
+	params.SetVoiceApplicationSid("")
+	params.SetVoiceUrl(hooks.VoiceURL)
+	params.SetVoiceMethod(hooks.VoiceMethod)
+	params.SetStatusCallback(hooks.StatusCallback)
+	params.SetStatusCallbackMethod(hooks.StatusCallbackMethod)
+	params.SetSmsApplicationSid("")
+	params.SetSmsUrl(hooks.SMSURL)
+	params.SetSmsMethod(hooks.SMSMethod)
+
+	if _, err := client.Api.UpdateIncomingPhoneNumber(phoneNumberSID, params); err != nil {
+		c.recordFailure()
+		return fmt.Errorf("failed to update phone number webhooks: %w", err)
+	}
+	c.recordSuccess()
+	return nil
+}
@@ -0,0 +1,110 @@
+package twilio
+
+import (
+	"context"
+	"strings"
+)
+
+// TrunkEdge is the Twilio edge location a trunk's calls to GoSIP leave
+// Twilio's network from, as set on its origination URLs
+type TrunkEdge struct {
+	TrunkSID string
+	Edge     string   // Shared by every origination URL, "" when Twilio picks
+	Mixed    bool     // The origination URLs have different edges
+	URIs     []string // The origination URLs
+}
+
+// APIBaseURL returns the base URL of the Twilio API reached through an
+// edge location, or the default one for an empty edge
+func APIBaseURL(edge string) string {
+	if edge == "" {
+		return "https://api.twilio.com"
+	}
+	return "https://api." + edge + ".us1.twilio.com"
+}
+
+// Edge returns the edge location the API is reached through, "" for the default
+func (c *Client) Edge() string {
+	if c.cfg == nil {
+		return ""
+	}
+	return c.cfg.TwilioEdge
+}
+
+// OriginationEdge returns the edge parameter of an origination SIP URI,
+// e.g. "dublin" for sip:pbx.example.com;edge=dublin
+func OriginationEdge(sipURI string) string {
+	uri, _, _ := strings.Cut(sipURI, "?")
+	params := strings.Split(uri, ";")
+	for _, p := range params[1:] {
+		if name, value, _ := strings.Cut(p, "="); strings.EqualFold(strings.TrimSpace(name), "edge") {
+			return strings.ToLower(strings.TrimSpace(value))
+		}
+	}
+	return ""
+}
+
+// WithOriginationEdge returns an origination SIP URI with its edge
+// parameter set to edge, or removed for an empty edge
+func WithOriginationEdge(sipURI, edge string) string {
+	uri, headers, hasHeaders := strings.Cut(sipURI, "?")
+	params := strings.Split(uri, ";")
+	kept := params[:1]
+	for _, p := range params[1:] {
+		if name, _, _ := strings.Cut(p, "="); !strings.EqualFold(strings.TrimSpace(name), "edge") {
+			kept = append(kept, p)
+		}
+	}
+	if edge != "" {
+		kept = append(kept, "edge="+edge)
+	}
+	uri = strings.Join(kept, ";")
+	if hasHeaders {
+		uri += "?" + headers
+	}
+	return uri
+}
+
+// GetTrunkEdge returns the edge location set on a trunk's origination URLs
+func (c *Client) GetTrunkEdge(ctx context.Context, trunkSID string) (*TrunkEdge, error) {
+	urls, err := c.ListOriginationURLs(ctx, trunkSID)
+	if err != nil {
+		return nil, err
+	}
+
+	te := &TrunkEdge{TrunkSID: trunkSID, URIs: []string{}}
+	for i, u := range urls {
+		edge := OriginationEdge(u.SipURL)
+		if i == 0 {
+			te.Edge = edge
+		} else if edge != te.Edge {
+			te.Mixed = true
+		}
+		te.URIs = append(te.URIs, u.SipURL)
+	}
+	if te.Mixed {
+		te.Edge = ""
+	}
+	return te, nil
+}
+
+// SetTrunkEdge sets the edge location on every origination URL of a trunk,
+// so Twilio sends its calls to GoSIP from that edge. An empty edge lets
+// Twilio pick.
+func (c *Client) SetTrunkEdge(ctx context.Context, trunkSID, edge string) error {
+	urls, err := c.ListOriginationURLs(ctx, trunkSID)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range urls {
+		uri := WithOriginationEdge(u.SipURL, edge)
+		if uri == u.SipURL {
+			continue
+		}
+		if err := c.UpdateOriginationURL(ctx, trunkSID, u.SID, uri, u.Priority, u.Weight, u.Enabled); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package twilio
+
+import (
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+)
+
+func TestWithOriginationEdge(t *testing.T) {
+	tests := []struct {
+		uri  string
+		edge string
+		want string
+	}{
+		{"sip:pbx.example.com", "dublin", "sip:pbx.example.com;edge=dublin"},
+		{"sips:pbx.example.com:5061;transport=tls", "sydney", "sips:pbx.example.com:5061;transport=tls;edge=sydney"},
+		{"sip:pbx.example.com;edge=ashburn;transport=udp", "dublin", "sip:pbx.example.com;transport=udp;edge=dublin"},
+		{"sip:pbx.example.com;Edge=dublin", "", "sip:pbx.example.com"},
+		{"sip:pbx.example.com?X-Test=1", "tokyo", "sip:pbx.example.com;edge=tokyo?X-Test=1"},
+	}
+	for _, tt := range tests {
+		got := WithOriginationEdge(tt.uri, tt.edge)
+		if got != tt.want {
+			t.Errorf("WithOriginationEdge(%q, %q) = %q, want %q", tt.uri, tt.edge, got, tt.want)
+		}
+		if edge := OriginationEdge(got); edge != tt.edge {
+			t.Errorf("OriginationEdge(%q) = %q, want %q", got, edge, tt.edge)
+		}
+	}
+}
+
+func TestAPIBaseURL(t *testing.T) {
+	if got := APIBaseURL(""); got != "https://api.twilio.com" {
+		t.Errorf("APIBaseURL(\"\") = %q", got)
+	}
+	if got := APIBaseURL("dublin"); got != "https://api.dublin.us1.twilio.com" {
+		t.Errorf("APIBaseURL(dublin) = %q", got)
+	}
+
+	c := NewClient(&config.Config{TwilioAccountSID: "AC123", TwilioAuthToken: "token", TwilioEdge: "sydney"})
+	if c.Edge() != "sydney" || c.client.RequestHandler.Edge != "sydney" {
+		t.Errorf("Expected the API reached through sydney, got %q", c.client.RequestHandler.Edge)
+	}
+}
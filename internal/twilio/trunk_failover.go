@@ -0,0 +1,160 @@
+package twilio
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	trunking "github.com/twilio/twilio-go/rest/trunking/v1"
+)
+
+// SecondaryOriginationName is the friendly name of the origination URL GoSIP
+// manages as a trunk's secondary server
+const SecondaryOriginationName = "GoSIP Secondary"
+
+// forwardTwimletURL is Twilio's hosted TwiML that forwards a call to a number
+const forwardTwimletURL = "https://twimlets.com/forward"
+
+// TrunkFailoverSettings is a trunk's disaster recovery configuration as
+// Twilio has it
+type TrunkFailoverSettings struct {
+	TrunkSID               string
+	DisasterRecoveryURL    string // Fetched for TwiML when no origination URL answers
+	DisasterRecoveryMethod string
+	SecondaryURI           string // The SecondaryOriginationName origination URL, if any
+	SecondaryEnabled       bool
+	SecondaryPriority      int
+	PrimaryPriority        int // Best priority of the other origination URLs, 0 if none
+}
+
+// ForwardTwimletURL returns the hosted TwiML URL that forwards calls to a number
+func ForwardTwimletURL(number string) string {
+	return forwardTwimletURL + "?" + url.Values{"PhoneNumber": {number}}.Encode()
+}
+
+// ForwardNumber returns the number a forwarding TwiML URL from
+// ForwardTwimletURL forwards to, or "" for any other URL
+func ForwardNumber(disasterRecoveryURL string) string {
+	u, err := url.Parse(disasterRecoveryURL)
+	if err != nil || !strings.EqualFold(u.Host, "twimlets.com") || u.Path != "/forward" {
+		return ""
+	}
+	return u.Query().Get("PhoneNumber")
+}
+
+// GetTrunkFailover returns a trunk's disaster recovery URL and secondary
+// origination URL
+func (c *Client) GetTrunkFailover(ctx context.Context, trunkSID string) (*TrunkFailoverSettings, error) {
+	c.mu.RLock()
+	if c.client == nil {
+		c.mu.RUnlock()
+		return nil, fmt.Errorf("twilio client not initialized")
+	}
+	client := c.client
+	c.mu.RUnlock()
+
+	resp, err := client.TrunkingV1.FetchTrunk(trunkSID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch SIP trunk: %w", err)
+	}
+
+	settings := &TrunkFailoverSettings{TrunkSID: trunkSID}
+	if resp.DisasterRecoveryUrl != nil {
+		settings.DisasterRecoveryURL = *resp.DisasterRecoveryUrl
+	}
+	if resp.DisasterRecoveryMethod != nil {
+		settings.DisasterRecoveryMethod = *resp.DisasterRecoveryMethod
+	}
+
+	urls, err := c.ListOriginationURLs(ctx, trunkSID)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range urls {
+		if u.FriendlyName == SecondaryOriginationName {
+			settings.SecondaryURI = u.SipURL
+			settings.SecondaryEnabled = u.Enabled
+			settings.SecondaryPriority = u.Priority
+			continue
+		}
+		if u.Enabled && (settings.PrimaryPriority == 0 || u.Priority < settings.PrimaryPriority) {
+			settings.PrimaryPriority = u.Priority
+		}
+	}
+
+	return settings, nil
+}
+
+// SetTrunkDisasterRecovery sets the URL Twilio fetches TwiML from when no
+// origination URL answers. An empty URL removes it.
+func (c *Client) SetTrunkDisasterRecovery(ctx context.Context, trunkSID, disasterRecoveryURL string) error {
+	c.mu.RLock()
+	if c.client == nil {
+		c.mu.RUnlock()
+		return fmt.Errorf("twilio client not initialized")
+	}
+	client := c.client
+	c.mu.RUnlock()
+
+	params := &trunking.UpdateTrunkParams{}
+	params.SetDisasterRecoveryUrl(disasterRecoveryURL)
+	params.SetDisasterRecoveryMethod("POST")
+
+	if _, err := client.TrunkingV1.UpdateTrunk(trunkSID, params); err != nil {
+		return fmt.Errorf("failed to set disaster recovery URL: %w", err)
+	}
+	return nil
+}
+
+// SetSecondaryOrigination points the trunk's secondary origination URL at
+// sipURI, tried only after every other origination URL. An empty URI
+// removes it.
+func (c *Client) SetSecondaryOrigination(ctx context.Context, trunkSID, sipURI string) error {
+	urls, err := c.ListOriginationURLs(ctx, trunkSID)
+	if err != nil {
+		return err
+	}
+
+	var existing *OriginationURL
+	priority := 10
+	for _, u := range urls {
+		if u.FriendlyName == SecondaryOriginationName {
+			existing = u
+			continue
+		}
+		// Twilio tries lower priorities first
+		if u.Priority >= priority {
+			priority = u.Priority + 10
+		}
+	}
+
+	switch {
+	case sipURI == "" && existing == nil:
+		return nil
+	case sipURI == "":
+		return c.DeleteOriginationURL(ctx, trunkSID, existing.SID)
+	case existing != nil:
+		return c.UpdateOriginationURL(ctx, trunkSID, existing.SID, sipURI, priority, 100, true)
+	}
+
+	c.mu.RLock()
+	if c.client == nil {
+		c.mu.RUnlock()
+		return fmt.Errorf("twilio client not initialized")
+	}
+	client := c.client
+	c.mu.RUnlock()
+
+	params := &trunking.CreateOriginationUrlParams{}
+	params.SetSipUrl(sipURI)
+	params.SetFriendlyName(SecondaryOriginationName)
+	params.SetPriority(priority)
+	params.SetWeight(100)
+	params.SetEnabled(true)
+
+	if _, err := client.TrunkingV1.CreateOriginationUrl(trunkSID, params); err != nil {
+		return fmt.Errorf("failed to create secondary origination URL: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package twilio
+
+import "testing"
+
+func TestForwardTwimletURL(t *testing.T) {
+	u := ForwardTwimletURL("+15551234567")
+	if u != "https://twimlets.com/forward?PhoneNumber=%2B15551234567" {
+		t.Errorf("Unexpected URL %q", u)
+	}
+	if got := ForwardNumber(u); got != "+15551234567" {
+		t.Errorf("ForwardNumber = %q, want +15551234567", got)
+	}
+	if got := ForwardNumber("https://example.com/forward?PhoneNumber=%2B15551234567"); got != "" {
+		t.Errorf("Expected no number for another host, got %q", got)
+	}
+}
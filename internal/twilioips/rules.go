@@ -0,0 +1,184 @@
+package twilioips
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/config"
+)
+
+// Firewall rule formats
+const (
+	FormatNFTables = "nftables"
+	FormatIPTables = "iptables"
+	FormatUFW      = "ufw"
+)
+
+// Formats lists the firewall rule formats
+var Formats = []string{FormatNFTables, FormatIPTables, FormatUFW}
+
+// Port is a port or port range Twilio reaches GoSIP on
+type Port struct {
+	Protocol string `json:"protocol"` // "udp" or "tcp"
+	Low      int    `json:"low"`
+	High     int    `json:"high"` // Equal to Low for a single port
+	Media    bool   `json:"media"`
+}
+
+// privateNetworks are always allowed, so phones on the LAN keep working
+var privateNetworks = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16", "fc00::/7", "fe80::/10"}
+
+// Ports returns the ports Twilio sends SIP and media to: SIP over UDP and
+// TCP unless unencrypted SIP is disabled, SIPS when TLS is on, and the
+// media relay's RTP range, or the forwarded RTP range without a relay
+func Ports(cfg *config.Config) []Port {
+	var ports []Port
+	if cfg.TLS == nil || !cfg.TLS.Enabled || !cfg.TLS.DisableUnencrypted {
+		ports = append(ports,
+			Port{Protocol: "udp", Low: cfg.SIPPort, High: cfg.SIPPort},
+			Port{Protocol: "tcp", Low: cfg.SIPPort, High: cfg.SIPPort},
+		)
+	}
+	if cfg.TLS != nil && cfg.TLS.Enabled {
+		ports = append(ports, Port{Protocol: "tcp", Low: cfg.TLS.Port, High: cfg.TLS.Port})
+	}
+
+	var low, high int
+	if cfg.MediaRelay != nil && cfg.MediaRelay.Mode != config.MediaRelayOff {
+		low, high, _ = cfg.MediaRelay.PortRange()
+	} else if cfg.PortMap != nil {
+		low, high, _ = cfg.PortMap.RTPRange()
+	}
+	if low > 0 {
+		ports = append(ports, Port{Protocol: "udp", Low: low, High: high, Media: true})
+	}
+	return ports
+}
+
+// sources splits the networks allowed to reach a port into IPv4 and IPv6
+func sources(twilio []string, extra []*net.IPNet) (v4, v6 []string) {
+	all := append(append([]string(nil), twilio...), privateNetworks...)
+	for _, n := range extra {
+		all = append(all, n.String())
+	}
+	for _, cidr := range all {
+		if strings.Contains(cidr, ":") {
+			v6 = append(v6, cidr)
+		} else {
+			v4 = append(v4, cidr)
+		}
+	}
+	return v4, v6
+}
+
+// Rules renders firewall rules that let only Twilio, private networks and
+// extra networks reach GoSIP's SIP and media ports. Other ports are left
+// alone.
+func Rules(format string, r Ranges, ports []Port, extra []*net.IPNet) (string, error) {
+	sig4, sig6 := sources(r.Signaling, extra)
+	media4, media6 := sources(r.Media, extra)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Twilio SIP signaling and media allowlist for GoSIP (%s ranges", r.Source)
+	if r.UpdatedAt != nil {
+		fmt.Fprintf(&b, " from %s", r.UpdatedAt.UTC().Format("2006-01-02"))
+	}
+	b.WriteString(")\n# Only GoSIP's ports are filtered. Private networks are allowed.\n")
+	if len(ports) == 0 {
+		b.WriteString("# No ports to filter\n")
+		return b.String(), nil
+	}
+
+	switch format {
+	case FormatNFTables:
+		writeNFTables(&b, ports, sig4, sig6, media4, media6)
+	case FormatIPTables:
+		writeIPTables(&b, ports, sig4, sig6, media4, media6)
+	case FormatUFW:
+		writeUFW(&b, ports, append(sig4, sig6...), append(media4, media6...))
+	default:
+		return "", fmt.Errorf("unknown firewall format %q", format)
+	}
+	return b.String(), nil
+}
+
+// portText writes a port or range with sep between its ends
+func portText(p Port, sep string) string {
+	if p.Low == p.High {
+		return fmt.Sprint(p.Low)
+	}
+	return fmt.Sprintf("%d%s%d", p.Low, sep, p.High)
+}
+
+func writeNFTables(b *strings.Builder, ports []Port, sig4, sig6, media4, media6 []string) {
+	set := func(name, addrType string, elements []string) {
+		fmt.Fprintf(b, "\tset %s {\n\t\ttype %s\n\t\tflags interval\n\t\tauto-merge\n\t\telements = { %s }\n\t}\n",
+			name, addrType, strings.Join(elements, ", "))
+	}
+
+	b.WriteString("table inet gosip_twilio\ndelete table inet gosip_twilio\ntable inet gosip_twilio {\n")
+	set("signaling", "ipv4_addr", sig4)
+	set("signaling6", "ipv6_addr", sig6)
+	set("media", "ipv4_addr", media4)
+	set("media6", "ipv6_addr", media6)
+	b.WriteString("\tchain input {\n\t\ttype filter hook input priority -10; policy accept;\n")
+	b.WriteString("\t\tiifname \"lo\" accept\n\t\tct state established,related accept\n")
+	for _, p := range ports {
+		name := "signaling"
+		if p.Media {
+			name = "media"
+		}
+		dport := fmt.Sprintf("%s dport %s", p.Protocol, portText(p, "-"))
+		fmt.Fprintf(b, "\t\t%s ip saddr @%s accept\n", dport, name)
+		fmt.Fprintf(b, "\t\t%s ip6 saddr @%s6 accept\n", dport, name)
+		fmt.Fprintf(b, "\t\t%s drop\n", dport)
+	}
+	b.WriteString("\t}\n}\n")
+}
+
+func writeIPTables(b *strings.Builder, ports []Port, sig4, sig6, media4, media6 []string) {
+	for _, family := range []struct {
+		cmd              string
+		signaling, media []string
+	}{
+		{"iptables", sig4, media4},
+		{"ip6tables", sig6, media6},
+	} {
+		for _, chain := range []struct {
+			name     string
+			networks []string
+		}{
+			{"GOSIP_SIGNALING", family.signaling},
+			{"GOSIP_MEDIA", family.media},
+		} {
+			fmt.Fprintf(b, "%s -N %s\n", family.cmd, chain.name)
+			fmt.Fprintf(b, "%s -A %s -i lo -j ACCEPT\n", family.cmd, chain.name)
+			fmt.Fprintf(b, "%s -A %s -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT\n", family.cmd, chain.name)
+			for _, n := range chain.networks {
+				fmt.Fprintf(b, "%s -A %s -s %s -j ACCEPT\n", family.cmd, chain.name, n)
+			}
+			fmt.Fprintf(b, "%s -A %s -j DROP\n", family.cmd, chain.name)
+		}
+		for _, p := range ports {
+			chain := "GOSIP_SIGNALING"
+			if p.Media {
+				chain = "GOSIP_MEDIA"
+			}
+			fmt.Fprintf(b, "%s -I INPUT -p %s --dport %s -j %s\n", family.cmd, p.Protocol, portText(p, ":"), chain)
+		}
+	}
+}
+
+func writeUFW(b *strings.Builder, ports []Port, signaling, media []string) {
+	for _, p := range ports {
+		networks, comment := signaling, "GoSIP Twilio signaling"
+		if p.Media {
+			networks, comment = media, "GoSIP Twilio media"
+		}
+		for _, n := range networks {
+			fmt.Fprintf(b, "ufw allow proto %s from %s to any port %s comment '%s'\n", p.Protocol, n, portText(p, ":"), comment)
+		}
+		fmt.Fprintf(b, "ufw deny proto %s to any port %s comment '%s'\n", p.Protocol, portText(p, ":"), comment)
+	}
+}
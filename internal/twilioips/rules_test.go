@@ -0,0 +1,79 @@
+package twilioips
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+)
+
+func TestPorts(t *testing.T) {
+	cfg := &config.Config{
+		SIPPort:    5060,
+		TLS:        &config.TLSConfig{Enabled: true, Port: 5061, DisableUnencrypted: true},
+		MediaRelay: &config.MediaRelayConfig{Mode: config.MediaRelayAlways, Ports: "30000-30999"},
+	}
+	ports := Ports(cfg)
+	if len(ports) != 2 || ports[0] != (Port{Protocol: "tcp", Low: 5061, High: 5061}) || ports[1] != (Port{Protocol: "udp", Low: 30000, High: 30999, Media: true}) {
+		t.Errorf("Unexpected ports %+v", ports)
+	}
+
+	// Without a relay the forwarded RTP range is filtered
+	cfg = &config.Config{SIPPort: 5060, PortMap: &config.PortMapConfig{RTPPorts: "10000-10099"}}
+	if ports := Ports(cfg); len(ports) != 3 || ports[2].Low != 10000 || !ports[2].Media {
+		t.Errorf("Unexpected ports %+v", ports)
+	}
+}
+
+func TestRules(t *testing.T) {
+	ranges := Ranges{Signaling: []string{"54.172.60.0/30"}, Media: []string{"54.172.60.0/23"}, Source: SourceBundled}
+	ports := []Port{{Protocol: "udp", Low: 5060, High: 5060}, {Protocol: "udp", Low: 10000, High: 10099, Media: true}}
+	_, extra, _ := net.ParseCIDR("2001:db8::/32")
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{FormatNFTables, []string{
+			"set signaling {\n\t\ttype ipv4_addr\n\t\tflags interval\n\t\tauto-merge\n\t\telements = { 54.172.60.0/30, 10.0.0.0/8,",
+			"elements = { fc00::/7, fe80::/10, 2001:db8::/32 }",
+			"udp dport 5060 ip saddr @signaling accept",
+			"udp dport 10000-10099 ip6 saddr @media6 accept",
+			"udp dport 10000-10099 drop",
+		}},
+		{FormatIPTables, []string{
+			"iptables -A GOSIP_SIGNALING -s 54.172.60.0/30 -j ACCEPT",
+			"iptables -A GOSIP_MEDIA -s 54.172.60.0/23 -j ACCEPT",
+			"ip6tables -A GOSIP_SIGNALING -s 2001:db8::/32 -j ACCEPT",
+			"iptables -I INPUT -p udp --dport 10000:10099 -j GOSIP_MEDIA",
+			"iptables -A GOSIP_SIGNALING -j DROP",
+		}},
+		{FormatUFW, []string{
+			"ufw allow proto udp from 54.172.60.0/30 to any port 5060 comment 'GoSIP Twilio signaling'",
+			"ufw allow proto udp from 2001:db8::/32 to any port 10000:10099 comment 'GoSIP Twilio media'",
+			"ufw deny proto udp to any port 5060",
+		}},
+	}
+	for _, tt := range tests {
+		rules, err := Rules(tt.format, ranges, ports, []*net.IPNet{extra})
+		if err != nil {
+			t.Fatalf("Rules(%s) failed: %v", tt.format, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(rules, want) {
+				t.Errorf("Rules(%s) missing %q:\n%s", tt.format, want, rules)
+			}
+		}
+	}
+
+	// ufw rules are applied in order, so every allow comes before the deny
+	rules, _ := Rules(FormatUFW, ranges, ports, nil)
+	if strings.Index(rules, "ufw deny proto udp to any port 5060") < strings.Index(rules, "ufw allow proto udp from 192.168.0.0/16 to any port 5060") {
+		t.Error("Expected the deny after the allows")
+	}
+
+	if _, err := Rules("pf", ranges, ports, nil); err == nil {
+		t.Error("Expected an unknown format refused")
+	}
+}
@@ -0,0 +1,257 @@
+// Package twilioips keeps the address ranges Twilio sends SIP signaling and
+// media from, renders them as firewall rules for GoSIP's ports, and tells
+// the SIP server which UDP senders to accept
+package twilioips
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+)
+
+// SettingKey is the database setting holding ranges that replace the
+// bundled ones
+const SettingKey = "twilio_ip_ranges"
+
+// Where the ranges in use came from
+const (
+	SourceBundled   = "bundled"
+	SourceRefreshed = "refreshed" // Fetched from GOSIP_TWILIO_RANGES_URL
+	SourceCustom    = "custom"    // Set by an admin
+)
+
+// ErrNoRangesURL is returned refreshing without GOSIP_TWILIO_RANGES_URL
+var ErrNoRangesURL = errors.New("GOSIP_TWILIO_RANGES_URL is not set")
+
+// Ranges are the networks Twilio sends SIP signaling and RTP media from
+type Ranges struct {
+	Signaling []string   `json:"signaling"`
+	Media     []string   `json:"media"`
+	Source    string     `json:"source"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// bundledSignaling are Twilio's SIP signaling networks for every edge:
+// the shared range, then the older per-edge ranges
+var bundledSignaling = []string{
+	"168.86.128.0/18",
+	"54.172.60.0/30",    // ashburn
+	"54.244.51.0/30",    // umatilla
+	"54.171.127.192/30", // dublin
+	"35.156.191.128/30", // frankfurt
+	"54.65.63.192/30",   // tokyo
+	"54.169.127.128/30", // singapore
+	"54.252.254.64/30",  // sydney
+	"177.71.206.192/30", // sao-paulo
+}
+
+// bundledMedia are Twilio's RTP media networks for every edge
+var bundledMedia = []string{
+	"168.86.128.0/18",
+	"54.172.60.0/23", "34.203.250.0/23", // ashburn
+	"54.244.51.0/24",                       // umatilla
+	"54.171.127.192/26", "52.215.127.0/24", // dublin
+	"35.156.191.128/25", "3.122.181.0/24", // frankfurt
+	"54.65.63.192/26", "3.112.80.0/24", // tokyo
+	"54.169.127.128/26", "3.1.77.0/24", // singapore
+	"54.252.254.64/26", "3.104.90.0/24", // sydney
+	"177.71.206.192/26", "18.228.249.0/24", // sao-paulo
+}
+
+// Bundled returns the ranges shipped with GoSIP
+func Bundled() Ranges {
+	return Ranges{
+		Signaling: append([]string(nil), bundledSignaling...),
+		Media:     append([]string(nil), bundledMedia...),
+		Source:    SourceBundled,
+	}
+}
+
+// parseNetworks parses CIDRs
+func parseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", cidr)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Validate checks that both lists hold networks
+func (r Ranges) Validate() error {
+	if len(r.Signaling) == 0 || len(r.Media) == 0 {
+		return errors.New("signaling and media networks are required")
+	}
+	if _, err := parseNetworks(r.Signaling); err != nil {
+		return fmt.Errorf("signaling: %w", err)
+	}
+	if _, err := parseNetworks(r.Media); err != nil {
+		return fmt.Errorf("media: %w", err)
+	}
+	return nil
+}
+
+// List holds the Twilio ranges in use and decides which UDP SIP senders
+// are accepted
+type List struct {
+	cfg      *config.SIPAllowlistConfig
+	database *db.DB
+	client   *http.Client
+
+	mu        sync.RWMutex
+	ranges    Ranges
+	signaling []*net.IPNet
+}
+
+// NewList creates a List using the bundled ranges until Load is called
+func NewList(cfg *config.Config, database *db.DB) *List {
+	allow := cfg.SIPAllowlist
+	if allow == nil {
+		allow = &config.SIPAllowlistConfig{}
+	}
+	l := &List{
+		cfg:      allow,
+		database: database,
+		client:   &http.Client{Timeout: config.TwilioRangesFetchTimeout},
+	}
+	l.use(Bundled())
+	return l
+}
+
+// use makes ranges the ones in use. They must be valid.
+func (l *List) use(r Ranges) {
+	signaling, _ := parseNetworks(r.Signaling)
+	l.mu.Lock()
+	l.ranges, l.signaling = r, signaling
+	l.mu.Unlock()
+}
+
+// Load uses the ranges stored in the database, if any
+func (l *List) Load(ctx context.Context) {
+	value := l.database.Config.GetWithDefault(ctx, SettingKey, "")
+	if value == "" {
+		return
+	}
+	var r Ranges
+	if err := json.Unmarshal([]byte(value), &r); err != nil || r.Validate() != nil {
+		slog.Warn("Ignoring stored Twilio address ranges", "error", err)
+		return
+	}
+	l.use(r)
+}
+
+// Ranges returns the ranges in use
+func (l *List) Ranges() Ranges {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.ranges
+}
+
+// Enforced reports whether UDP SIP is restricted to Twilio
+func (l *List) Enforced() bool {
+	return l.cfg.TwilioOnly
+}
+
+// AllowedNetworks returns the networks allowed besides Twilio's
+func (l *List) AllowedNetworks() []*net.IPNet {
+	return l.cfg.Networks
+}
+
+// AllowsSIP reports whether a UDP SIP request from ip is accepted: always
+// when the allowlist isn't enforced, otherwise from Twilio's signaling
+// ranges, private and loopback addresses, and GOSIP_SIP_ALLOWLIST
+func (l *List) AllowsSIP(ip net.IP) bool {
+	if !l.cfg.TwilioOnly {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() {
+		return true
+	}
+	for _, n := range l.cfg.Networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, n := range l.signaling {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Set replaces the ranges in use and stores them
+func (l *List) Set(ctx context.Context, r Ranges) (Ranges, error) {
+	if err := r.Validate(); err != nil {
+		return Ranges{}, err
+	}
+	now := time.Now()
+	if r.Source == "" {
+		r.Source = SourceCustom
+	}
+	r.UpdatedAt = &now
+
+	value, err := json.Marshal(r)
+	if err != nil {
+		return Ranges{}, err
+	}
+	if err := l.database.Config.Set(ctx, SettingKey, string(value)); err != nil {
+		return Ranges{}, err
+	}
+	l.use(r)
+	return r, nil
+}
+
+// Reset goes back to the bundled ranges
+func (l *List) Reset(ctx context.Context) (Ranges, error) {
+	if err := l.database.Config.Delete(ctx, SettingKey); err != nil {
+		return Ranges{}, err
+	}
+	l.use(Bundled())
+	return l.Ranges(), nil
+}
+
+// Refresh fetches ranges from GOSIP_TWILIO_RANGES_URL, a JSON object with
+// "signaling" and "media" lists of networks, and uses them
+func (l *List) Refresh(ctx context.Context) (Ranges, error) {
+	if l.cfg.RangesURL == "" {
+		return Ranges{}, ErrNoRangesURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.cfg.RangesURL, nil)
+	if err != nil {
+		return Ranges{}, err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return Ranges{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Ranges{}, fmt.Errorf("%s returned %d", l.cfg.RangesURL, resp.StatusCode)
+	}
+
+	var fetched Ranges
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&fetched); err != nil {
+		return Ranges{}, fmt.Errorf("invalid ranges: %w", err)
+	}
+	return l.Set(ctx, Ranges{Signaling: fetched.Signaling, Media: fetched.Media, Source: SourceRefreshed})
+}
@@ -0,0 +1,123 @@
+package twilioips
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+)
+
+// setupTestDB creates an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	database, err := db.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Close()
+	})
+	return database
+}
+
+func TestBundledValid(t *testing.T) {
+	if err := Bundled().Validate(); err != nil {
+		t.Errorf("Bundled ranges invalid: %v", err)
+	}
+	if err := (Ranges{Signaling: []string{"54.172.60.0/30"}, Media: []string{"not-a-network"}}).Validate(); err == nil || !strings.HasPrefix(err.Error(), "media") {
+		t.Errorf("Expected an invalid media network rejected, got %v", err)
+	}
+}
+
+func TestList_AllowsSIP(t *testing.T) {
+	database := setupTestDB(t)
+
+	open := NewList(&config.Config{}, database)
+	if !open.AllowsSIP(net.ParseIP("198.51.100.7")) {
+		t.Error("Expected every source accepted without GOSIP_SIP_TWILIO_ONLY")
+	}
+
+	_, extra, _ := net.ParseCIDR("203.0.113.0/24")
+	l := NewList(&config.Config{SIPAllowlist: &config.SIPAllowlistConfig{TwilioOnly: true, Networks: []*net.IPNet{extra}}}, database)
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"54.172.60.2", true},   // Twilio ashburn
+		{"168.86.130.10", true}, // Twilio shared range
+		{"192.168.1.40", true},  // LAN phone
+		{"127.0.0.1", true},
+		{"203.0.113.9", true}, // GOSIP_SIP_ALLOWLIST
+		{"198.51.100.7", false},
+		{"2001:db8::1", false},
+	}
+	for _, tt := range tests {
+		if got := l.AllowsSIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("AllowsSIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestList_SetRefreshReset(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+
+	ranges := `{"signaling": ["198.51.100.0/24"], "media": ["198.51.100.0/23"]}`
+	served := ranges
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(served))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{SIPAllowlist: &config.SIPAllowlistConfig{TwilioOnly: true, RangesURL: server.URL}}
+	l := NewList(cfg, database)
+	r, err := l.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if r.Source != SourceRefreshed || r.UpdatedAt == nil || !l.AllowsSIP(net.ParseIP("198.51.100.7")) || l.AllowsSIP(net.ParseIP("54.172.60.2")) {
+		t.Errorf("Expected the fetched ranges in use, got %+v", r)
+	}
+
+	// The fetched ranges survive a restart
+	restarted := NewList(cfg, database)
+	restarted.Load(ctx)
+	if got := restarted.Ranges(); got.Source != SourceRefreshed || got.Signaling[0] != "198.51.100.0/24" {
+		t.Errorf("Expected the stored ranges loaded, got %+v", got)
+	}
+
+	// Bad ranges are refused and the ones in use kept
+	served = `{"signaling": ["nope"], "media": []}`
+	if _, err := l.Refresh(ctx); err == nil {
+		t.Error("Expected invalid fetched ranges refused")
+	}
+	if l.Ranges().Source != SourceRefreshed {
+		t.Errorf("Expected the previous ranges kept, got %+v", l.Ranges())
+	}
+
+	if r, err := l.Set(ctx, Ranges{Signaling: []string{"192.0.2.0/24"}, Media: []string{"192.0.2.0/24"}}); err != nil || r.Source != SourceCustom {
+		t.Errorf("Expected custom ranges set, got %+v (%v)", r, err)
+	}
+
+	if r, err := l.Reset(ctx); err != nil || r.Source != SourceBundled {
+		t.Errorf("Expected the bundled ranges back, got %+v (%v)", r, err)
+	}
+	restarted = NewList(cfg, database)
+	restarted.Load(ctx)
+	if restarted.Ranges().Source != SourceBundled {
+		t.Errorf("Expected nothing stored after a reset, got %+v", restarted.Ranges())
+	}
+
+	if _, err := NewList(&config.Config{}, database).Refresh(ctx); err != ErrNoRangesURL {
+		t.Errorf("Expected ErrNoRangesURL, got %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+// Package verify sends one-time codes to phone numbers by SMS or voice call
+// from a DID and checks them, so self-hosted apps can verify that a user
+// owns a number without their own Twilio integration
+package verify
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/i18n"
+	"github.com/btafoya/gosip/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Delivery channels
+const (
+	ChannelSMS  = "sms"
+	ChannelCall = "call"
+)
+
+var (
+	// ErrChannelUnavailable is returned when the DID can't send codes over
+	// the requested channel
+	ErrChannelUnavailable = errors.New("the DID can't send codes over this channel")
+	// ErrExpired is returned when the pending code is too old to check
+	ErrExpired = errors.New("the verification code has expired")
+	// ErrSendFailed wraps Twilio's error when a code couldn't be delivered
+	ErrSendFailed = errors.New("the verification code couldn't be sent")
+)
+
+// RateLimitError is returned when a code would exceed a send limit
+type RateLimitError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return e.Reason
+}
+
+// Sender is the part of the Twilio client used to deliver codes
+type Sender interface {
+	SendSMS(from, to, body string, mediaURLs []string) (string, error)
+	MakeCallTwiML(from, to, twiml string) (string, error)
+}
+
+// Service sends and checks verification codes
+type Service struct {
+	database *db.DB
+	sender   Sender
+
+	// mu makes checking the send limits and recording a code atomic
+	mu sync.Mutex
+}
+
+// NewService creates a Service
+func NewService(database *db.DB, sender Sender) *Service {
+	return &Service{database: database, sender: sender}
+}
+
+// Request describes a code to send
+type Request struct {
+	UserID  int64
+	DID     *models.DID
+	SMSFrom string // What SMS is sent from: a Messaging Service or the DID's number
+	To      string // E.164
+	Channel string
+}
+
+// CheckResult is the outcome of checking a code
+type CheckResult struct {
+	Valid             bool   `json:"valid"`
+	Status            string `json:"status"`
+	AttemptsRemaining int    `json:"attempts_remaining"`
+}
+
+// Start sends a new code to a number, replacing any code the user has
+// pending for it
+func (s *Service) Start(ctx context.Context, req Request) (*models.Verification, error) {
+	switch {
+	case req.Channel == ChannelSMS && !req.DID.SMSEnabled,
+		req.Channel == ChannelCall && !req.DID.VoiceEnabled:
+		return nil, ErrChannelUnavailable
+	case req.Channel != ChannelSMS && req.Channel != ChannelCall:
+		return nil, fmt.Errorf("unknown channel %q", req.Channel)
+	}
+	code, err := newCode()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	didID := req.DID.ID
+	v := &models.Verification{
+		UserID:    req.UserID,
+		DIDID:     &didID,
+		ToNumber:  req.To,
+		Channel:   req.Channel,
+		CodeHash:  string(hash),
+		ExpiresAt: time.Now().Add(config.VerificationTTL),
+	}
+	if err := s.record(ctx, v); err != nil {
+		return nil, err
+	}
+
+	lang := i18n.Resolve(req.DID.Language, s.database.Config.GetForTenant(ctx, req.DID.TenantID, "default_language", i18n.DefaultLanguage))
+	var sid string
+	if req.Channel == ChannelSMS {
+		sid, err = s.sender.SendSMS(req.SMSFrom, req.To, i18n.Prompt(lang, i18n.PromptVerificationCode)+" "+code, nil)
+	} else {
+		sid, err = s.sender.MakeCallTwiML(req.DID.Number, req.To, codeTwiML(lang, code))
+	}
+	if err != nil {
+		if err := s.database.Verifications.UpdateStatus(ctx, v.ID, db.VerificationFailed); err != nil {
+			slog.Error("Failed to record undelivered verification", "error", err, "verification_id", v.ID)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrSendFailed, err)
+	}
+	v.SID = sid
+	if err := s.database.Verifications.SetSID(ctx, v.ID, sid); err != nil {
+		slog.Error("Failed to record verification SID", "error", err, "verification_id", v.ID)
+	}
+
+	if _, err := s.database.Verifications.DeleteOlderThan(ctx, time.Now().Add(-config.VerificationRetention)); err != nil {
+		slog.Error("Failed to prune verifications", "error", err)
+	}
+	return v, nil
+}
+
+// record checks the send limits and records a code that is within them
+func (s *Service) record(ctx context.Context, v *models.Verification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkLimits(ctx, v.UserID, v.ToNumber); err != nil {
+		return err
+	}
+	return s.database.Verifications.Create(ctx, v)
+}
+
+// checkLimits returns a RateLimitError when another code to a number, or
+// from a user, would be too many
+func (s *Service) checkLimits(ctx context.Context, userID int64, to string) error {
+	now := time.Now()
+	since := now.Add(-config.VerificationSendWindow)
+
+	sent, last, err := s.database.Verifications.CountToNumberSince(ctx, to, since)
+	if err != nil {
+		return err
+	}
+	if last != nil && now.Sub(*last) < config.VerificationResendCooldown {
+		return &RateLimitError{Reason: "A code was just sent to this number", RetryAfter: config.VerificationResendCooldown - now.Sub(*last)}
+	}
+	if sent >= config.VerificationMaxPerNumber {
+		return &RateLimitError{Reason: "Too many codes sent to this number", RetryAfter: config.VerificationSendWindow}
+	}
+
+	sent, err = s.database.Verifications.CountByUserSince(ctx, userID, since)
+	if err != nil {
+		return err
+	}
+	if sent >= config.VerificationMaxPerUser {
+		return &RateLimitError{Reason: "Too many codes sent", RetryAfter: config.VerificationSendWindow}
+	}
+	return nil
+}
+
+// Check compares a code with the one the user has pending for a number. A
+// wrong code counts against the verification's attempts. It returns
+// db.ErrVerificationNotFound when no code is pending.
+func (s *Service) Check(ctx context.Context, userID int64, to, code string) (*CheckResult, error) {
+	v, err := s.database.Verifications.GetPending(ctx, userID, to)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(v.ExpiresAt) {
+		if err := s.database.Verifications.UpdateStatus(ctx, v.ID, db.VerificationFailed); err != nil && err != db.ErrVerificationNotFound {
+			return nil, err
+		}
+		return nil, ErrExpired
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(v.CodeHash), []byte(strings.TrimSpace(code))) == nil {
+		if err := s.database.Verifications.UpdateStatus(ctx, v.ID, db.VerificationApproved); err != nil {
+			return nil, err
+		}
+		return &CheckResult{Valid: true, Status: db.VerificationApproved}, nil
+	}
+
+	attempts, err := s.database.Verifications.RecordAttempt(ctx, v.ID, config.VerificationMaxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	result := &CheckResult{Status: db.VerificationPending, AttemptsRemaining: config.VerificationMaxAttempts - attempts}
+	if result.AttemptsRemaining <= 0 {
+		result.Status = db.VerificationFailed
+		result.AttemptsRemaining = 0
+	}
+	return result, nil
+}
+
+// newCode returns a random code of VerificationCodeLength digits
+func newCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < config.VerificationCodeLength; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", config.VerificationCodeLength, n), nil
+}
+
+// codeTwiML reads the code out digit by digit, twice
+func codeTwiML(lang, code string) string {
+	digits := strings.Join(strings.Split(code, ""), ", ")
+	say := `<Say language="` + i18n.VoiceLocale(lang) + `">` + html.EscapeString(i18n.Prompt(lang, i18n.PromptVerificationCode)) + ` ` + digits + `.</Say>`
+	return `<Response>` + say + `<Pause length="1"/>` + say + `</Response>`
+}
@@ -0,0 +1,201 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// setupTestDB creates an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	database, err := db.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Close()
+	})
+	return database
+}
+
+// fakeSender records what was sent
+type fakeSender struct {
+	body  string
+	twiml string
+	err   error
+}
+
+func (f *fakeSender) SendSMS(from, to, body string, mediaURLs []string) (string, error) {
+	f.body = body
+	return "SM123", f.err
+}
+
+func (f *fakeSender) MakeCallTwiML(from, to, twiml string) (string, error) {
+	f.twiml = twiml
+	return "CA123", f.err
+}
+
+var codePattern = regexp.MustCompile(`\d{6}`)
+
+// setup returns a service, a user and an SMS-only DID
+func setup(t *testing.T) (*Service, *fakeSender, *db.DB, *models.User, *models.DID) {
+	t.Helper()
+	ctx := context.Background()
+	database := setupTestDB(t)
+	user := &models.User{Email: "app@example.com", PasswordHash: "x", Role: "user"}
+	if err := database.Users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	did := &models.DID{Number: "+15551234567", SMSEnabled: true}
+	if err := database.DIDs.Create(ctx, did); err != nil {
+		t.Fatal(err)
+	}
+	sender := &fakeSender{}
+	return NewService(database, sender), sender, database, user, did
+}
+
+func TestStartAndCheck(t *testing.T) {
+	service, sender, _, user, did := setup(t)
+	ctx := context.Background()
+	to := "+15559876543"
+
+	if _, err := service.Start(ctx, Request{UserID: user.ID, DID: did, SMSFrom: did.Number, To: to, Channel: ChannelCall}); err != ErrChannelUnavailable {
+		t.Errorf("Expected a call from an SMS-only DID rejected, got %v", err)
+	}
+
+	v, err := service.Start(ctx, Request{UserID: user.ID, DID: did, SMSFrom: did.Number, To: to, Channel: ChannelSMS})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if v.Status != db.VerificationPending || v.SID != "SM123" {
+		t.Errorf("Unexpected verification %+v", v)
+	}
+	code := codePattern.FindString(sender.body)
+	if code == "" || !strings.HasPrefix(sender.body, "Your verification code is") {
+		t.Fatalf("Expected the code in the SMS, got %q", sender.body)
+	}
+
+	// Another user can't check the code
+	if _, err := service.Check(ctx, user.ID+1, to, code); err != db.ErrVerificationNotFound {
+		t.Errorf("Expected no pending verification for another user, got %v", err)
+	}
+
+	result, err := service.Check(ctx, user.ID, to, "000000x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid || result.AttemptsRemaining != config.VerificationMaxAttempts-1 {
+		t.Errorf("Expected a wrong code counted, got %+v", result)
+	}
+
+	result, err = service.Check(ctx, user.ID, to, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid || result.Status != db.VerificationApproved {
+		t.Errorf("Expected the code approved, got %+v", result)
+	}
+
+	// A code is only good once
+	if _, err := service.Check(ctx, user.ID, to, code); err != db.ErrVerificationNotFound {
+		t.Errorf("Expected the approved code used up, got %v", err)
+	}
+}
+
+func TestCheck_Attempts(t *testing.T) {
+	service, _, _, user, did := setup(t)
+	ctx := context.Background()
+	to := "+15559876543"
+
+	if _, err := service.Start(ctx, Request{UserID: user.ID, DID: did, SMSFrom: did.Number, To: to, Channel: ChannelSMS}); err != nil {
+		t.Fatal(err)
+	}
+	var result *CheckResult
+	for i := 0; i < config.VerificationMaxAttempts; i++ {
+		var err error
+		if result, err = service.Check(ctx, user.ID, to, "wrong"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if result.Status != db.VerificationFailed || result.AttemptsRemaining != 0 {
+		t.Errorf("Expected the verification failed after %d attempts, got %+v", config.VerificationMaxAttempts, result)
+	}
+	if _, err := service.Check(ctx, user.ID, to, "wrong"); err != db.ErrVerificationNotFound {
+		t.Errorf("Expected no more attempts, got %v", err)
+	}
+}
+
+func TestCheck_Expired(t *testing.T) {
+	service, sender, database, user, did := setup(t)
+	ctx := context.Background()
+	to := "+15559876543"
+
+	v, err := service.Start(ctx, Request{UserID: user.ID, DID: did, SMSFrom: did.Number, To: to, Channel: ChannelSMS})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.Conn().Exec(`UPDATE verifications SET expires_at = ? WHERE id = ?`, time.Now().Add(-time.Minute), v.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Check(ctx, user.ID, to, codePattern.FindString(sender.body)); err != ErrExpired {
+		t.Errorf("Expected the code expired, got %v", err)
+	}
+}
+
+func TestStart_Limits(t *testing.T) {
+	service, sender, database, user, did := setup(t)
+	ctx := context.Background()
+	to := "+15559876543"
+	req := Request{UserID: user.ID, DID: did, SMSFrom: did.Number, To: to, Channel: ChannelSMS}
+
+	if _, err := service.Start(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	var limited *RateLimitError
+	if _, err := service.Start(ctx, req); !errors.As(err, &limited) || limited.RetryAfter > config.VerificationResendCooldown {
+		t.Fatalf("Expected the resend cooldown, got %v", err)
+	}
+
+	// Past the cooldown, the per-number limit applies
+	for i := 1; i < config.VerificationMaxPerNumber; i++ {
+		if _, err := database.Conn().Exec(`UPDATE verifications SET created_at = ?`, time.Now().Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := service.Start(ctx, req); err != nil {
+			t.Fatalf("Start %d: %v", i+1, err)
+		}
+	}
+	database.Conn().Exec(`UPDATE verifications SET created_at = ?`, time.Now().Add(-time.Minute))
+	if _, err := service.Start(ctx, req); !errors.As(err, &limited) {
+		t.Fatalf("Expected the per-number limit, got %v", err)
+	}
+
+	// An undelivered code fails the verification
+	sender.err = errors.New("twilio API error")
+	req.To = "+15550001111"
+	if _, err := service.Start(ctx, req); !errors.Is(err, ErrSendFailed) {
+		t.Errorf("Expected the send failure reported, got %v", err)
+	}
+	if _, err := database.Verifications.GetPending(ctx, user.ID, req.To); err != db.ErrVerificationNotFound {
+		t.Errorf("Expected no pending verification after a failed send, got %v", err)
+	}
+}
+
+func TestCodeTwiML(t *testing.T) {
+	got := codeTwiML("en", "123456")
+	if !strings.Contains(got, "1, 2, 3, 4, 5, 6.") || strings.Count(got, "<Say") != 2 {
+		t.Errorf("Unexpected TwiML %s", got)
+	}
+}
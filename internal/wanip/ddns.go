@@ -0,0 +1,154 @@
+package wanip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// updateDNS points every configured dynamic DNS record at ip
+func (m *Monitor) updateDNS(ctx context.Context, ip string) []Update {
+	var updates []Update
+	if m.cfg.CloudflareToken != "" && m.cfg.CloudflareZoneID != "" && m.cfg.CloudflareRecord != "" {
+		update := Update{Target: "cloudflare:" + m.cfg.CloudflareRecord, OK: true}
+		if err := m.updateCloudflare(ctx, ip); err != nil {
+			update.OK, update.Error = false, err.Error()
+		}
+		updates = append(updates, update)
+	}
+	if m.cfg.DuckDNSToken != "" && len(m.cfg.DuckDNSDomains) > 0 {
+		update := Update{Target: "duckdns:" + strings.Join(m.cfg.DuckDNSDomains, ","), OK: true}
+		if err := m.updateDuckDNS(ctx, ip); err != nil {
+			update.OK, update.Error = false, err.Error()
+		}
+		updates = append(updates, update)
+	}
+	return updates
+}
+
+// cloudflareResponse is the envelope of every Cloudflare API response
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+// cloudflareRecord is a DNS record in the Cloudflare API
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl,omitempty"`
+	Proxied *bool  `json:"proxied,omitempty"`
+}
+
+// updateCloudflare updates the A record, creating it if it doesn't exist.
+// New records aren't proxied since Cloudflare's proxy doesn't carry SIP.
+func (m *Monitor) updateCloudflare(ctx context.Context, ip string) error {
+	base := m.cloudflareAPI + "/zones/" + url.PathEscape(m.cfg.CloudflareZoneID) + "/dns_records"
+
+	var records []cloudflareRecord
+	query := url.Values{"type": {"A"}, "name": {m.cfg.CloudflareRecord}}
+	if err := m.cloudflare(ctx, http.MethodGet, base+"?"+query.Encode(), nil, &records); err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		proxied := false
+		return m.cloudflare(ctx, http.MethodPost, base, cloudflareRecord{
+			Type:    "A",
+			Name:    m.cfg.CloudflareRecord,
+			Content: ip,
+			TTL:     1, // Automatic
+			Proxied: &proxied,
+		}, nil)
+	}
+	if records[0].Content == ip {
+		return nil
+	}
+	return m.cloudflare(ctx, http.MethodPatch, base+"/"+url.PathEscape(records[0].ID), cloudflareRecord{Content: ip}, nil)
+}
+
+// cloudflare sends one Cloudflare API request and decodes its result
+func (m *Monitor) cloudflare(ctx context.Context, method, u string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.cfg.CloudflareToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var envelope cloudflareResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&envelope); err != nil {
+		return fmt.Errorf("invalid Cloudflare response (%s): %w", resp.Status, err)
+	}
+	if !envelope.Success {
+		var msgs []string
+		for _, e := range envelope.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return fmt.Errorf("cloudflare rejected the request (%s): %s", resp.Status, strings.Join(msgs, "; "))
+	}
+	if result != nil {
+		return json.Unmarshal(envelope.Result, result)
+	}
+	return nil
+}
+
+// updateDuckDNS updates every configured DuckDNS subdomain at once
+func (m *Monitor) updateDuckDNS(ctx context.Context, ip string) error {
+	query := url.Values{
+		"domains": {strings.Join(m.cfg.DuckDNSDomains, ",")},
+		"token":   {m.cfg.DuckDNSToken},
+		"ip":      {ip},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.duckDNSAPI+"/update?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		// The error includes the URL, and with it the token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("duckdns request failed: %w", urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return err
+	}
+	// DuckDNS answers KO for a bad token or domain
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != "OK" {
+		return fmt.Errorf("duckdns rejected the update (%s): %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
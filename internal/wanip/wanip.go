@@ -0,0 +1,287 @@
+// Package wanip watches the server's public IPv4 address and, when it
+// changes, updates dynamic DNS records and Twilio origination URLs that
+// point at the old address
+package wanip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/twilio"
+)
+
+// configKey stores the last detected address so a restart doesn't count as a change
+const configKey = "wan_ip"
+
+// TrunkClient is the part of the Twilio client used to repoint origination URLs
+type TrunkClient interface {
+	ListSIPTrunks(ctx context.Context) ([]*twilio.SIPTrunk, error)
+	ListOriginationURLs(ctx context.Context, trunkSID string) ([]*twilio.OriginationURL, error)
+	UpdateOriginationURL(ctx context.Context, trunkSID, originationURLSID, sipURI string, priority, weight int, enabled bool) error
+}
+
+// Update is the outcome of repointing one record or URL at a new address
+type Update struct {
+	Target string `json:"target"` // e.g. cloudflare:sip.example.com, duckdns:mypbx, twilio:TK123/OU456
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Status reports the public address and the last check
+type Status struct {
+	IP        string     `json:"ip,omitempty"`
+	Detect    bool       `json:"detect"` // Whether the address is checked every WANIPCheckInterval
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	ChangedAt *time.Time `json:"changed_at,omitempty"`
+	Error     string     `json:"error,omitempty"`   // Why the last lookup failed
+	Updates   []Update   `json:"updates,omitempty"` // Results of the last change
+}
+
+// Monitor detects changes to the public address
+type Monitor struct {
+	cfg      *config.WANIPConfig
+	database *db.DB
+	hub      *events.Hub
+	trunks   TrunkClient
+	client   *http.Client
+
+	// Provider API base URLs, replaced in tests
+	cloudflareAPI string
+	duckDNSAPI    string
+
+	// checkMu serializes checks so scheduled and manual checks don't interleave
+	checkMu sync.Mutex
+
+	mu     sync.RWMutex
+	status Status
+}
+
+// NewMonitor creates a Monitor. The address starts as GOSIP_EXTERNAL_IP
+// until Start loads the last detected one.
+func NewMonitor(cfg *config.Config, database *db.DB, hub *events.Hub, trunks TrunkClient) *Monitor {
+	wan := cfg.WANIP
+	if wan == nil {
+		wan = &config.WANIPConfig{}
+	}
+	return &Monitor{
+		cfg:           wan,
+		database:      database,
+		hub:           hub,
+		trunks:        trunks,
+		client:        &http.Client{Timeout: config.WANIPCheckTimeout},
+		cloudflareAPI: "https://api.cloudflare.com/client/v4",
+		duckDNSAPI:    "https://www.duckdns.org",
+		status:        Status{IP: cfg.ExternalIP, Detect: wan.Detect},
+	}
+}
+
+// Start loads the last detected address and, when detection is enabled,
+// checks for changes now and then every WANIPCheckInterval
+func (m *Monitor) Start(ctx context.Context) {
+	if ip, err := m.database.Config.Get(ctx, configKey); err == nil && ip != "" {
+		m.mu.Lock()
+		m.status.IP = ip
+		m.mu.Unlock()
+	}
+	if !m.cfg.Detect {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(config.WANIPCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := m.Check(ctx); err != nil {
+				slog.Warn("Public IP lookup failed", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// IP returns the current public address, empty when unknown
+func (m *Monitor) IP() string {
+	if m == nil {
+		return ""
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status.IP
+}
+
+// Status returns the current address and the outcome of the last check
+func (m *Monitor) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	status := m.status
+	status.Updates = append([]Update(nil), m.status.Updates...)
+	return status
+}
+
+// Check looks up the public address and, if it changed, updates dynamic
+// DNS and Twilio and publishes a TypeWANIPChanged event
+func (m *Monitor) Check(ctx context.Context) (Status, error) {
+	m.checkMu.Lock()
+	defer m.checkMu.Unlock()
+
+	ip, err := m.lookup(ctx)
+	now := time.Now()
+
+	m.mu.Lock()
+	m.status.CheckedAt = &now
+	m.status.Error = ""
+	if err != nil {
+		m.status.Error = err.Error()
+	}
+	old := m.status.IP
+	m.mu.Unlock()
+
+	if err != nil || ip == old {
+		return m.Status(), err
+	}
+
+	slog.Warn("Public IP address changed", "old_ip", old, "ip", ip)
+	updates := m.updateDNS(ctx, ip)
+	if old != "" {
+		updates = append(updates, m.updateOrigination(ctx, old, ip)...)
+	}
+	for _, u := range updates {
+		if !u.OK {
+			slog.Error("Failed to point record at new public IP", "target", u.Target, "error", u.Error)
+		}
+	}
+
+	if err := m.database.Config.Set(ctx, configKey, ip); err != nil {
+		slog.Error("Failed to save public IP", "error", err)
+	}
+
+	m.mu.Lock()
+	m.status.IP = ip
+	m.status.ChangedAt = &now
+	m.status.Updates = updates
+	m.mu.Unlock()
+
+	m.hub.Publish(events.TypeWANIPChanged, map[string]interface{}{
+		"old_ip":  old,
+		"ip":      ip,
+		"updates": updates,
+	})
+	return m.Status(), nil
+}
+
+// lookup asks each IP echo service in turn for the public IPv4 address
+func (m *Monitor) lookup(ctx context.Context) (string, error) {
+	var errs []error
+	for _, u := range m.cfg.URLs {
+		ip, err := m.fetchIP(ctx, u)
+		if err == nil {
+			return ip, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", u, err))
+	}
+	if len(errs) == 0 {
+		return "", errors.New("no IP lookup services configured")
+	}
+	return "", errors.Join(errs...)
+}
+
+func (m *Monitor) fetchIP(ctx context.Context, u string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", config.DefaultUserAgent)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return "", err
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil || ip.To4() == nil {
+		return "", fmt.Errorf("not an IPv4 address: %q", strings.TrimSpace(string(body)))
+	}
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsUnspecified() {
+		return "", fmt.Errorf("%s is not a public address", ip)
+	}
+	return ip.String(), nil
+}
+
+// updateOrigination repoints Twilio origination URLs that use the old
+// address directly rather than a host name
+func (m *Monitor) updateOrigination(ctx context.Context, old, ip string) []Update {
+	if m.trunks == nil {
+		return nil
+	}
+
+	trunks, err := m.trunks.ListSIPTrunks(ctx)
+	if err != nil {
+		return []Update{{Target: "twilio", Error: err.Error()}}
+	}
+
+	var updates []Update
+	for _, trunk := range trunks {
+		urls, err := m.trunks.ListOriginationURLs(ctx, trunk.SID)
+		if err != nil {
+			updates = append(updates, Update{Target: "twilio:" + trunk.SID, Error: err.Error()})
+			continue
+		}
+		for _, u := range urls {
+			uri, ok := ReplaceHost(u.SipURL, old, ip)
+			if !ok {
+				continue
+			}
+			update := Update{Target: "twilio:" + trunk.SID + "/" + u.SID, OK: true}
+			if err := m.trunks.UpdateOriginationURL(ctx, trunk.SID, u.SID, uri, u.Priority, u.Weight, u.Enabled); err != nil {
+				update.OK, update.Error = false, err.Error()
+			}
+			updates = append(updates, update)
+		}
+	}
+	return updates
+}
+
+// ReplaceHost swaps the host of a sip: or sips: URI when it is old, keeping
+// the port and parameters. It reports whether the URI used old.
+func ReplaceHost(uri, old, ip string) (string, bool) {
+	scheme, rest, ok := strings.Cut(uri, ":")
+	if !ok || (!strings.EqualFold(scheme, "sip") && !strings.EqualFold(scheme, "sips")) {
+		return uri, false
+	}
+	userinfo := ""
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		userinfo, rest = rest[:i+1], rest[i+1:]
+	}
+	end := strings.IndexAny(rest, ":;?>")
+	if end < 0 {
+		end = len(rest)
+	}
+	if rest[:end] != old {
+		return uri, false
+	}
+	return scheme + ":" + userinfo + ip + rest[end:], true
+}
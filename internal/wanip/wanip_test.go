@@ -0,0 +1,230 @@
+package wanip
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/twilio"
+)
+
+// setupTestDB creates an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	database, err := db.New(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	t.Cleanup(func() {
+		database.Close()
+	})
+	return database
+}
+
+// fakeTrunks records origination URL updates
+type fakeTrunks struct {
+	urls    []*twilio.OriginationURL
+	updated map[string]string
+}
+
+func (f *fakeTrunks) ListSIPTrunks(ctx context.Context) ([]*twilio.SIPTrunk, error) {
+	return []*twilio.SIPTrunk{{SID: "TK1"}}, nil
+}
+
+func (f *fakeTrunks) ListOriginationURLs(ctx context.Context, trunkSID string) ([]*twilio.OriginationURL, error) {
+	return f.urls, nil
+}
+
+func (f *fakeTrunks) UpdateOriginationURL(ctx context.Context, trunkSID, sid, uri string, priority, weight int, enabled bool) error {
+	f.updated[sid] = uri
+	return nil
+}
+
+func TestMonitor_Check(t *testing.T) {
+	database := setupTestDB(t)
+	hub := events.NewHub(10)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	currentIP := "203.0.113.10"
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		io.WriteString(w, currentIP+"\n")
+	}))
+	defer echo.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer broken.Close()
+
+	var cloudflareCalls []string
+	var patched map[string]string
+	cloudflare := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cloudflareCalls = append(cloudflareCalls, r.Method+" "+r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer cf-token" {
+			t.Errorf("Expected the API token, got %q", r.Header.Get("Authorization"))
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if r.URL.Query().Get("name") != "sip.example.com" {
+				t.Errorf("Expected a lookup of the record, got %s", r.URL.RawQuery)
+			}
+			io.WriteString(w, `{"success":true,"result":[{"id":"rec1","content":"203.0.113.10"}]}`)
+		case http.MethodPatch:
+			json.NewDecoder(r.Body).Decode(&patched)
+			io.WriteString(w, `{"success":true,"result":{}}`)
+		}
+	}))
+	defer cloudflare.Close()
+
+	var duckQuery string
+	duck := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		duckQuery = r.URL.RawQuery
+		io.WriteString(w, "OK")
+	}))
+	defer duck.Close()
+
+	trunks := &fakeTrunks{
+		urls: []*twilio.OriginationURL{
+			{SID: "OU1", SipURL: "sip:203.0.113.10:5060;transport=udp", Enabled: true},
+			{SID: "OU2", SipURL: "sip:pbx.example.com:5060", Enabled: true},
+		},
+		updated: make(map[string]string),
+	}
+
+	m := NewMonitor(&config.Config{
+		ExternalIP: "203.0.113.10",
+		WANIP: &config.WANIPConfig{
+			URLs:             []string{broken.URL, echo.URL},
+			CloudflareToken:  "cf-token",
+			CloudflareZoneID: "zone1",
+			CloudflareRecord: "sip.example.com",
+			DuckDNSToken:     "duck-token",
+			DuckDNSDomains:   []string{"mypbx"},
+		},
+	}, database, hub, trunks)
+	m.cloudflareAPI = cloudflare.URL
+	m.duckDNSAPI = duck.URL
+
+	// Unchanged: nothing to update
+	status, err := m.Check(ctx)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if status.IP != "203.0.113.10" || status.ChangedAt != nil || len(cloudflareCalls) != 0 || hub.LastID() != 0 {
+		t.Fatalf("Expected no change, got %+v", status)
+	}
+
+	mu.Lock()
+	currentIP = "198.51.100.7"
+	mu.Unlock()
+
+	status, err = m.Check(ctx)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if status.IP != "198.51.100.7" || status.ChangedAt == nil {
+		t.Fatalf("Expected the new address, got %+v", status)
+	}
+	if len(status.Updates) != 3 {
+		t.Fatalf("Expected Cloudflare, DuckDNS and one origination URL updated, got %+v", status.Updates)
+	}
+	for _, u := range status.Updates {
+		if !u.OK {
+			t.Errorf("Expected %s updated, got %+v", u.Target, u)
+		}
+	}
+
+	if patched["content"] != "198.51.100.7" || cloudflareCalls[1] != "PATCH /zones/zone1/dns_records/rec1" {
+		t.Errorf("Expected the Cloudflare record patched, got %v %v", cloudflareCalls, patched)
+	}
+	if duckQuery != "domains=mypbx&ip=198.51.100.7&token=duck-token" {
+		t.Errorf("Unexpected DuckDNS update %q", duckQuery)
+	}
+	if trunks.updated["OU1"] != "sip:198.51.100.7:5060;transport=udp" {
+		t.Errorf("Expected the IP origination URL repointed, got %v", trunks.updated)
+	}
+	if _, ok := trunks.updated["OU2"]; ok {
+		t.Error("Expected origination URLs using a host name left alone")
+	}
+
+	if stored, _ := database.Config.Get(ctx, configKey); stored != "198.51.100.7" {
+		t.Errorf("Expected the address saved, got %q", stored)
+	}
+	backlog, _, cancel := hub.Subscribe(0)
+	defer cancel()
+	if len(backlog) != 1 || backlog[0].Type != events.TypeWANIPChanged {
+		t.Errorf("Expected a %s event, got %+v", events.TypeWANIPChanged, backlog)
+	}
+
+	// A restart picks up the saved address instead of GOSIP_EXTERNAL_IP
+	restarted := NewMonitor(&config.Config{ExternalIP: "203.0.113.10", WANIP: &config.WANIPConfig{}}, database, hub, nil)
+	restarted.Start(ctx)
+	if restarted.IP() != "198.51.100.7" {
+		t.Errorf("Expected the saved address after a restart, got %q", restarted.IP())
+	}
+}
+
+func TestMonitor_LookupErrors(t *testing.T) {
+	private := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "192.168.1.20")
+	}))
+	defer private.Close()
+
+	m := NewMonitor(&config.Config{WANIP: &config.WANIPConfig{URLs: []string{private.URL}}}, setupTestDB(t), events.NewHub(10), nil)
+	status, err := m.Check(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "not a public address") {
+		t.Fatalf("Expected a private address to be rejected, got %v", err)
+	}
+	if status.Error == "" || status.CheckedAt == nil || status.IP != "" {
+		t.Errorf("Expected the failure recorded, got %+v", status)
+	}
+}
+
+func TestDuckDNSRejected(t *testing.T) {
+	duck := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "KO")
+	}))
+	defer duck.Close()
+
+	m := NewMonitor(&config.Config{WANIP: &config.WANIPConfig{DuckDNSToken: "bad", DuckDNSDomains: []string{"mypbx"}}}, nil, nil, nil)
+	m.duckDNSAPI = duck.URL
+	updates := m.updateDNS(context.Background(), "198.51.100.7")
+	if len(updates) != 1 || updates[0].OK || !strings.Contains(updates[0].Error, "KO") {
+		t.Errorf("Expected the rejected update reported, got %+v", updates)
+	}
+}
+
+func TestReplaceHost(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want string
+		ok   bool
+	}{
+		{"sip:203.0.113.10", "sip:198.51.100.7", true},
+		{"sips:203.0.113.10:5061;transport=tls", "sips:198.51.100.7:5061;transport=tls", true},
+		{"sip:trunk@203.0.113.10:5060", "sip:trunk@198.51.100.7:5060", true},
+		{"sip:203.0.113.100:5060", "sip:203.0.113.100:5060", false},
+		{"sip:pbx.example.com", "sip:pbx.example.com", false},
+		{"https://203.0.113.10", "https://203.0.113.10", false},
+	}
+	for _, tt := range tests {
+		got, ok := ReplaceHost(tt.uri, "203.0.113.10", "198.51.100.7")
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ReplaceHost(%q) = %q, %v; want %q, %v", tt.uri, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Package sip provides Alert-Info distinctive ring support for GoSIP
+package sip
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// Built-in ring classes. Any other class matching ValidRingClass may be used
+// as long as the phone is provisioned with a ring tone for it.
+const (
+	RingClassInternal = "internal"
+	RingClassExternal = "external"
+	RingClassVIP      = "vip"
+)
+
+// TrunkAlertInfoHeader carries the ring class on calls delivered by Twilio.
+// Twilio only copies X- prefixed parameters of a <Sip> URI into the INVITE,
+// so Alert-Info itself cannot be set from TwiML.
+const TrunkAlertInfoHeader = "X-Alert-Info"
+
+// alertInfoURI is the placeholder tone URI; phones select the ring tone from
+// the info parameter rather than fetching the URI
+const alertInfoURI = "http://127.0.0.1"
+
+var ringClassPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ValidRingClass reports whether class can be carried in an Alert-Info info parameter
+func ValidRingClass(class string) bool {
+	return ringClassPattern.MatchString(class)
+}
+
+// AlertInfoValue returns the Alert-Info header value for a ring class. The
+// <uri>;info=class form is understood by Grandstream, Yealink, Polycom and
+// Cisco phones, which map the info text to a configured ring tone.
+func AlertInfoValue(class string) string {
+	return fmt.Sprintf("<%s>;info=%s", alertInfoURI, class)
+}
+
+// SetAlertInfo replaces any Alert-Info on req with one for class. An empty
+// or invalid class only removes existing headers.
+func SetAlertInfo(req *sip.Request, class string) {
+	for _, h := range req.GetHeaders("Alert-Info") {
+		req.RemoveHeader(h.Name())
+	}
+	if ValidRingClass(class) {
+		req.AppendHeader(sip.NewHeader("Alert-Info", AlertInfoValue(class)))
+	}
+}
+
+// RingClass returns the ring class requested for req, taken from the
+// Alert-Info info parameter or, for trunk calls, the X-Alert-Info header.
+// It returns an empty string when neither carries a valid class.
+func RingClass(req *sip.Request) string {
+	if h := req.GetHeader("Alert-Info"); h != nil {
+		for _, param := range strings.Split(h.Value(), ";") {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(strings.ToLower(param), "info=") {
+				if class := strings.Trim(param[len("info="):], `"`); ValidRingClass(class) {
+					return class
+				}
+			}
+		}
+	}
+	if h := req.GetHeader(TrunkAlertInfoHeader); h != nil {
+		if class := strings.TrimSpace(h.Value()); ValidRingClass(class) {
+			return class
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package sip
+
+import "testing"
+
+func TestValidRingClass(t *testing.T) {
+	tests := []struct {
+		class string
+		valid bool
+	}{
+		{"vip", true},
+		{"Bellcore-dr2", true},
+		{"ring_3", true},
+		{"", false},
+		{"has space", false},
+		{"semi;colon", false},
+		{"averyveryveryveryveryverylongclassname", false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidRingClass(tt.class); got != tt.valid {
+			t.Errorf("ValidRingClass(%q) = %v, want %v", tt.class, got, tt.valid)
+		}
+	}
+}
+
+func TestSetAlertInfo(t *testing.T) {
+	req := parseTestInvite(t, "Alert-Info: <http://carrier.example/ring.wav>")
+
+	SetAlertInfo(req, RingClassVIP)
+
+	headers := req.GetHeaders("Alert-Info")
+	if len(headers) != 1 {
+		t.Fatalf("Expected a single Alert-Info header, got %d", len(headers))
+	}
+	if headers[0].Value() != "<http://127.0.0.1>;info=vip" {
+		t.Errorf("Unexpected Alert-Info value: %s", headers[0].Value())
+	}
+
+	SetAlertInfo(req, "")
+	if h := req.GetHeader("Alert-Info"); h != nil {
+		t.Errorf("Expected Alert-Info to be removed, got %s", h.Value())
+	}
+}
+
+func TestRingClass(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		want    string
+	}{
+		{"none", nil, ""},
+		{"alert-info", []string{"Alert-Info: <http://127.0.0.1>;info=vip"}, "vip"},
+		{"quoted", []string{`Alert-Info: <http://127.0.0.1>;info="internal"`}, "internal"},
+		{"trunk header", []string{"X-Alert-Info: family"}, "family"},
+		{"alert-info wins", []string{"Alert-Info: <http://127.0.0.1>;info=vip", "X-Alert-Info: family"}, "vip"},
+		{"uri only", []string{"Alert-Info: <http://carrier.example/ring.wav>"}, ""},
+		{"invalid trunk class", []string{"X-Alert-Info: not valid"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := parseTestInvite(t, tt.headers...)
+			if got := RingClass(req); got != tt.want {
+				t.Errorf("RingClass() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCallSession_AlertInfo(t *testing.T) {
+	req := parseTestInvite(t, "X-Alert-Info: vip")
+	session := NewCallSession(req, CallDirectionInbound)
+	if session.AlertInfo != RingClassVIP {
+		t.Errorf("Expected session ring class vip, got %q", session.AlertInfo)
+	}
+}
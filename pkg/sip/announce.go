@@ -0,0 +1,209 @@
+// Package sip provides in-call announcement playback for GoSIP
+package sip
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Legs of a call an announcement is played to
+const (
+	AnnounceCaller = "caller"
+	AnnounceCallee = "callee"
+	AnnounceBoth   = "both"
+)
+
+// Announcement statuses
+const (
+	AnnouncementQueued    = "queued"
+	AnnouncementPlaying   = "playing"
+	AnnouncementCompleted = "completed"
+	AnnouncementCancelled = "cancelled"
+)
+
+// MaxQueuedAnnouncements is how many announcements a call can have playing
+// or waiting
+const MaxQueuedAnnouncements = 10
+
+// ErrAnnouncementQueueFull is returned when a call already has
+// MaxQueuedAnnouncements
+var ErrAnnouncementQueueFull = errors.New("announcement queue is full")
+
+// Announcement is a prompt played into an active call
+type Announcement struct {
+	ID         string     `json:"id"`
+	CallID     string     `json:"call_id"`
+	Prompt     string     `json:"prompt"`
+	Leg        string     `json:"leg"`
+	Status     string     `json:"status"`
+	Duration   float64    `json:"duration"` // Seconds
+	QueuedAt   time.Time  `json:"queued_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	audio []byte
+}
+
+// AnnouncementHandler is told when an announcement starts, completes or is cancelled
+type AnnouncementHandler func(a Announcement)
+
+// AnnouncementPlayer plays queued announcements into calls one at a time,
+// in the order they were queued
+type AnnouncementPlayer struct {
+	mu      sync.Mutex
+	queues  map[string][]*Announcement // By call ID; the first one is playing
+	running map[string]bool            // Calls with a goroutine working through their queue
+	nextID  int64
+	onEvent AnnouncementHandler
+	frame   time.Duration // Time one audio frame takes to play
+}
+
+// NewAnnouncementPlayer creates an AnnouncementPlayer. onEvent may be nil.
+func NewAnnouncementPlayer(onEvent AnnouncementHandler) *AnnouncementPlayer {
+	return &AnnouncementPlayer{
+		queues:  make(map[string][]*Announcement),
+		running: make(map[string]bool),
+		onEvent: onEvent,
+		frame:   20 * time.Millisecond, // 20ms RTP packet interval
+	}
+}
+
+// Enqueue queues audio (8kHz 8-bit samples, without a WAV header) to be played to a
+// leg of a call. It starts playing right away when nothing else is.
+func (p *AnnouncementPlayer) Enqueue(session *CallSession, prompt, leg string, audio []byte) (*Announcement, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	queue := p.queues[session.CallID]
+	if len(queue) >= MaxQueuedAnnouncements {
+		return nil, ErrAnnouncementQueueFull
+	}
+
+	p.nextID++
+	a := &Announcement{
+		ID:       fmt.Sprintf("ann-%d", p.nextID),
+		CallID:   session.CallID,
+		Prompt:   prompt,
+		Leg:      leg,
+		Status:   AnnouncementQueued,
+		Duration: float64(len(audio)) / 8000,
+		QueuedAt: time.Now(),
+		audio:    audio,
+	}
+	p.queues[session.CallID] = append(queue, a)
+
+	if !p.running[session.CallID] {
+		p.running[session.CallID] = true
+		go p.play(session)
+	}
+	return a, nil
+}
+
+// List returns the playing and queued announcements of a call
+func (p *AnnouncementPlayer) List(callID string) []Announcement {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	list := make([]Announcement, len(p.queues[callID]))
+	for i, a := range p.queues[callID] {
+		list[i] = *a
+	}
+	return list
+}
+
+// Cancel drops every announcement of a call, stopping the one playing
+func (p *AnnouncementPlayer) Cancel(callID string) {
+	p.mu.Lock()
+	queue := p.queues[callID]
+	delete(p.queues, callID)
+	p.mu.Unlock()
+
+	for _, a := range queue {
+		p.finish(a, AnnouncementCancelled)
+	}
+}
+
+// play works through a call's queue until it is empty
+func (p *AnnouncementPlayer) play(session *CallSession) {
+	for {
+		p.mu.Lock()
+		queue := p.queues[session.CallID]
+		if len(queue) == 0 {
+			delete(p.queues, session.CallID)
+			delete(p.running, session.CallID)
+			p.mu.Unlock()
+			return
+		}
+		a := queue[0]
+		now := time.Now()
+		a.Status = AnnouncementPlaying
+		a.StartedAt = &now
+		started := *a
+		p.mu.Unlock()
+
+		p.notify(started)
+		slog.Info("Announcement started", "call_id", a.CallID, "id", a.ID, "prompt", a.Prompt, "leg", a.Leg)
+
+		// Cancelled announcements were already reported by Cancel
+		if p.stream(session, a) {
+			p.mu.Lock()
+			if q := p.queues[session.CallID]; len(q) > 0 && q[0] == a {
+				p.queues[session.CallID] = q[1:]
+			}
+			p.mu.Unlock()
+			p.finish(a, AnnouncementCompleted)
+		}
+	}
+}
+
+// stream sends the announcement's audio to the call. It returns false when
+// the announcement was cancelled or the call ended first.
+func (p *AnnouncementPlayer) stream(session *CallSession, a *Announcement) bool {
+	// In a full implementation, this would transcode the audio to the
+	// call's codec and send it as RTP to the chosen leg, mixed over the
+	// other party's audio. For now, it takes as long as playing would.
+	ticker := time.NewTicker(p.frame)
+	defer ticker.Stop()
+
+	packetSize := 160 // 20ms at 8kHz
+	for position := 0; position < len(a.audio); position += packetSize {
+		<-ticker.C
+
+		if session.GetState() == CallStateTerminated {
+			p.Cancel(session.CallID)
+			return false
+		}
+		p.mu.Lock()
+		q := p.queues[session.CallID]
+		current := len(q) > 0 && q[0] == a
+		p.mu.Unlock()
+		if !current {
+			return false
+		}
+
+		// In full implementation, send RTP packet here
+		// sendRTPPacket(session, a.Leg, a.audio[position:position+packetSize])
+	}
+	return true
+}
+
+func (p *AnnouncementPlayer) finish(a *Announcement, status string) {
+	p.mu.Lock()
+	now := time.Now()
+	a.Status = status
+	a.FinishedAt = &now
+	snapshot := *a
+	p.mu.Unlock()
+
+	p.notify(snapshot)
+	slog.Info("Announcement finished", "call_id", a.CallID, "id", a.ID, "status", status)
+}
+
+func (p *AnnouncementPlayer) notify(a Announcement) {
+	if p.onEvent != nil {
+		p.onEvent(a)
+	}
+}
@@ -0,0 +1,114 @@
+package sip
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// announcementRecorder collects announcement events
+type announcementRecorder struct {
+	mu     sync.Mutex
+	events []Announcement
+}
+
+func (r *announcementRecorder) record(a Announcement) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, a)
+}
+
+func (r *announcementRecorder) statuses() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var s []string
+	for _, a := range r.events {
+		s = append(s, a.ID+" "+a.Status)
+	}
+	return s
+}
+
+// waitFor polls until cond holds or a second has passed
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAnnouncementPlayer_PlaysInOrder(t *testing.T) {
+	rec := &announcementRecorder{}
+	p := NewAnnouncementPlayer(rec.record)
+	p.frame = time.Millisecond
+	session := &CallSession{CallID: "call-1", State: CallStateActive}
+
+	first, err := p.Enqueue(session, "recorded", AnnounceBoth, make([]byte, 1600))
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if first.Duration != 0.2 {
+		t.Errorf("Duration = %v, want 0.2", first.Duration)
+	}
+	second, _ := p.Enqueue(session, "one_minute", AnnounceCaller, make([]byte, 320))
+
+	if list := p.List("call-1"); len(list) != 2 || list[1].Status != AnnouncementQueued {
+		t.Errorf("List() = %+v", list)
+	}
+
+	waitFor(t, func() bool { return len(rec.statuses()) == 4 })
+	want := []string{first.ID + " playing", first.ID + " completed", second.ID + " playing", second.ID + " completed"}
+	for i, s := range rec.statuses() {
+		if s != want[i] {
+			t.Errorf("Event %d = %q, want %q", i, s, want[i])
+		}
+	}
+	waitFor(t, func() bool { return len(p.List("call-1")) == 0 })
+
+	// A later announcement starts a new run
+	if _, err := p.Enqueue(session, "recorded", AnnounceCallee, make([]byte, 160)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return len(rec.statuses()) == 6 })
+}
+
+func TestAnnouncementPlayer_CallEnds(t *testing.T) {
+	rec := &announcementRecorder{}
+	p := NewAnnouncementPlayer(rec.record)
+	p.frame = time.Millisecond
+	session := &CallSession{CallID: "call-2", State: CallStateActive}
+
+	// About a minute of audio, so it is still playing when the call ends
+	p.Enqueue(session, "long", AnnounceBoth, make([]byte, 8000*60))
+	p.Enqueue(session, "next", AnnounceBoth, make([]byte, 160))
+	waitFor(t, func() bool { return len(rec.statuses()) == 1 })
+
+	session.SetState(CallStateTerminated)
+	waitFor(t, func() bool { return len(rec.statuses()) == 3 })
+	for _, s := range rec.statuses()[1:] {
+		if s[len(s)-len(AnnouncementCancelled):] != AnnouncementCancelled {
+			t.Errorf("Expected cancelled, got %q", s)
+		}
+	}
+	if len(p.List("call-2")) != 0 {
+		t.Error("Expected the queue to be cleared")
+	}
+}
+
+func TestAnnouncementPlayer_QueueFull(t *testing.T) {
+	p := NewAnnouncementPlayer(nil)
+	session := &CallSession{CallID: "call-3", State: CallStateActive}
+
+	for i := 0; i < MaxQueuedAnnouncements; i++ {
+		if _, err := p.Enqueue(session, "long", AnnounceBoth, make([]byte, 8000*60)); err != nil {
+			t.Fatalf("Enqueue %d error = %v", i, err)
+		}
+	}
+	if _, err := p.Enqueue(session, "long", AnnounceBoth, make([]byte, 160)); err != ErrAnnouncementQueueFull {
+		t.Errorf("Enqueue() error = %v, want ErrAnnouncementQueueFull", err)
+	}
+	p.Cancel("call-3")
+}
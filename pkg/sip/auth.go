@@ -11,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/btafoya/gosip/internal/config"
 	"github.com/btafoya/gosip/internal/db"
 	"github.com/btafoya/gosip/internal/models"
 	"github.com/emiago/sipgo/sip"
@@ -21,12 +22,20 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrDeviceNotFound     = errors.New("device not found")
 	ErrInvalidNonce       = errors.New("invalid or expired nonce")
+	ErrWrongDomain        = errors.New("device does not belong to this SIP domain")
 )
 
+// webCredential is a short-lived password handed to a browser phone
+type webCredential struct {
+	ha1     string
+	expires time.Time
+}
+
 // Authenticator handles SIP digest authentication
 type Authenticator struct {
 	db     *db.DB
 	nonces map[string]time.Time
+	web    map[string][]webCredential // By device username
 	mu     sync.RWMutex
 	realm  string
 }
@@ -36,6 +45,7 @@ func NewAuthenticator(database *db.DB) *Authenticator {
 	auth := &Authenticator{
 		db:     database,
 		nonces: make(map[string]time.Time),
+		web:    make(map[string][]webCredential),
 		realm:  "gosip",
 	}
 
@@ -96,16 +106,100 @@ func (a *Authenticator) Authenticate(ctx context.Context, req *sip.Request) (*mo
 	ha2 := md5Hash(fmt.Sprintf("%s:%s", method, uri))
 	expectedResponse := md5Hash(fmt.Sprintf("%s:%s:%s", ha1, nonce, ha2))
 
-	if response != expectedResponse {
+	if response != expectedResponse && !a.webCredentialMatches(username, nonce, ha2, response) {
 		return nil, ErrInvalidCredentials
 	}
 
+	if err := a.checkDomain(ctx, req, device); err != nil {
+		return nil, err
+	}
+
 	// Remove used nonce (one-time use for security)
 	a.removeNonce(nonce)
 
 	return device, nil
 }
 
+// checkDomain maps the SIP domain a request is from to a tenant. A tenant's
+// domain only accepts that tenant's devices, and devices of a tenant with a
+// domain must use it.
+func (a *Authenticator) checkDomain(ctx context.Context, req *sip.Request, device *models.Device) error {
+	var domain string
+	if from := req.From(); from != nil {
+		domain = from.Address.Host
+	}
+	tenant, err := a.db.Tenants.GetBySIPDomain(ctx, domain)
+	if err == nil {
+		if !sameTenant(device.TenantID, &tenant.ID) {
+			return ErrWrongDomain
+		}
+		return nil
+	}
+	if !errors.Is(err, db.ErrTenantNotFound) {
+		return err
+	}
+
+	if device.TenantID == nil {
+		return nil
+	}
+	own, err := a.db.Tenants.GetByID(ctx, *device.TenantID)
+	if err != nil {
+		return err
+	}
+	if own.SIPDomain != "" {
+		return ErrWrongDomain
+	}
+	return nil
+}
+
+// sameTenant reports whether two tenant IDs are the same tenant, nil being
+// the instance's own
+func sameTenant(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// AddWebCredential lets a device also authenticate with the password whose
+// HA1 is given, until expires. Browser phones are handed such passwords
+// instead of the device's own; a device keeps its latest few.
+func (a *Authenticator) AddWebCredential(username, ha1 string, expires time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	creds := []webCredential{{ha1: ha1, expires: expires}}
+	for _, c := range a.web[username] {
+		if c.expires.After(now) && len(creds) < config.WebCredentialsPerDevice {
+			creds = append(creds, c)
+		}
+	}
+	a.web[username] = creds
+}
+
+// RevokeWebCredentials drops every short-lived password of a device
+func (a *Authenticator) RevokeWebCredentials(username string) {
+	a.mu.Lock()
+	delete(a.web, username)
+	a.mu.Unlock()
+}
+
+// webCredentialMatches reports whether a digest response was made with one
+// of a device's short-lived passwords
+func (a *Authenticator) webCredentialMatches(username, nonce, ha2, response string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	now := time.Now()
+	for _, c := range a.web[username] {
+		if c.expires.After(now) && md5Hash(fmt.Sprintf("%s:%s:%s", c.ha1, nonce, ha2)) == response {
+			return true
+		}
+	}
+	return false
+}
+
 // GenerateNonce creates a new nonce for auth challenges
 func (a *Authenticator) GenerateNonce() string {
 	bytes := make([]byte, 16)
@@ -151,6 +245,19 @@ func (a *Authenticator) cleanupNonces() {
 				delete(a.nonces, nonce)
 			}
 		}
+		for username, creds := range a.web {
+			live := creds[:0]
+			for _, c := range creds {
+				if c.expires.After(now) {
+					live = append(live, c)
+				}
+			}
+			if len(live) == 0 {
+				delete(a.web, username)
+			} else {
+				a.web[username] = live
+			}
+		}
 		a.mu.Unlock()
 	}
 }
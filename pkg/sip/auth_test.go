@@ -2,11 +2,14 @@ package sip
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/btafoya/gosip/internal/config"
 	"github.com/btafoya/gosip/internal/db"
 	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
 )
 
 // setupTestDB creates an in-memory SQLite database for testing
@@ -383,3 +386,88 @@ func TestAuthenticator_NonceConcurrency(t *testing.T) {
 		}
 	}
 }
+
+// digestInvite is an INVITE signed with password for username
+func digestInvite(t *testing.T, auth *Authenticator, username, password string) *sip.Request {
+	t.Helper()
+	nonce := auth.GenerateNonce()
+	uri := "sip:+15551234567@gosip.local"
+	ha2 := md5Hash("INVITE:" + uri)
+	response := md5Hash(GenerateHA1(username, "gosip", password) + ":" + nonce + ":" + ha2)
+	return parseTestInvite(t, `Authorization: Digest username="`+username+`", realm="gosip", nonce="`+nonce+`", uri="`+uri+`", response="`+response+`"`)
+}
+
+func TestAuthenticator_WebCredentials(t *testing.T) {
+	database := setupTestDB(t)
+	auth := NewAuthenticator(database)
+	ctx := context.Background()
+	createTestDevice(t, database, "web-1", GenerateHA1("web-1", "gosip", "devicepass"))
+
+	// The device's own password still works
+	if _, err := auth.Authenticate(ctx, digestInvite(t, auth, "web-1", "devicepass")); err != nil {
+		t.Errorf("Expected the device password accepted: %v", err)
+	}
+	if _, err := auth.Authenticate(ctx, digestInvite(t, auth, "web-1", "tabpass")); err != ErrInvalidCredentials {
+		t.Errorf("Expected an unknown password refused, got %v", err)
+	}
+
+	auth.AddWebCredential("web-1", GenerateHA1("web-1", "gosip", "tabpass"), time.Now().Add(time.Hour))
+	auth.AddWebCredential("web-1", GenerateHA1("web-1", "gosip", "oldpass"), time.Now().Add(-time.Minute))
+	if _, err := auth.Authenticate(ctx, digestInvite(t, auth, "web-1", "tabpass")); err != nil {
+		t.Errorf("Expected the short-lived password accepted: %v", err)
+	}
+	if _, err := auth.Authenticate(ctx, digestInvite(t, auth, "web-1", "oldpass")); err != ErrInvalidCredentials {
+		t.Errorf("Expected an expired password refused, got %v", err)
+	}
+
+	// A device keeps only its latest few
+	for i := 0; i < config.WebCredentialsPerDevice; i++ {
+		auth.AddWebCredential("web-1", GenerateHA1("web-1", "gosip", fmt.Sprintf("pass%d", i)), time.Now().Add(time.Hour))
+	}
+	if _, err := auth.Authenticate(ctx, digestInvite(t, auth, "web-1", "tabpass")); err != ErrInvalidCredentials {
+		t.Errorf("Expected the oldest password dropped, got %v", err)
+	}
+
+	auth.RevokeWebCredentials("web-1")
+	if _, err := auth.Authenticate(ctx, digestInvite(t, auth, "web-1", "pass0")); err != ErrInvalidCredentials {
+		t.Errorf("Expected revoked passwords refused, got %v", err)
+	}
+}
+
+func TestAuthenticator_TenantDomains(t *testing.T) {
+	database := setupTestDB(t)
+	auth := NewAuthenticator(database)
+	ctx := context.Background()
+
+	acme := &models.Tenant{Name: "Acme", SIPDomain: "sip.acme.example"}
+	database.Tenants.Create(ctx, acme)
+	plain := &models.Tenant{Name: "Globex"}
+	database.Tenants.Create(ctx, plain)
+	createTestDevice(t, database, "desk", GenerateHA1("desk", "gosip", "pass"))
+	acmeDesk := createTestDevice(t, database, "acme-desk", GenerateHA1("acme-desk", "gosip", "pass"))
+	database.Devices.SetTenant(ctx, acmeDesk.ID, &acme.ID)
+	globexDesk := createTestDevice(t, database, "globex-desk", GenerateHA1("globex-desk", "gosip", "pass"))
+	database.Devices.SetTenant(ctx, globexDesk.ID, &plain.ID)
+
+	from := func(username, host string) *sip.Request {
+		req := digestInvite(t, auth, username, "pass")
+		req.From().Address.Host = host
+		return req
+	}
+	for _, tc := range []struct {
+		username, host string
+		want           error
+	}{
+		{"acme-desk", "SIP.acme.example", nil},
+		{"acme-desk", "gosip.local", ErrWrongDomain},
+		{"desk", "sip.acme.example", ErrWrongDomain},
+		{"globex-desk", "sip.acme.example", ErrWrongDomain},
+		{"desk", "gosip.local", nil},
+		// Tenants without a domain share the instance's
+		{"globex-desk", "gosip.local", nil},
+	} {
+		if _, err := auth.Authenticate(ctx, from(tc.username, tc.host)); err != tc.want {
+			t.Errorf("%s from %s: expected %v, got %v", tc.username, tc.host, tc.want, err)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Package sip provides per-call network diagnostics for GoSIP
+package sip
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/jitter"
+)
+
+// Media key exchange methods found in SDP
+const (
+	KeyExchangeSDES = "sdes" // a=crypto (RFC 4568)
+	KeyExchangeDTLS = "dtls" // a=fingerprint (RFC 5763)
+	KeyExchangeZRTP = "zrtp" // a=zrtp-hash (RFC 6189)
+)
+
+// CallDiagnostics gathers what GoSIP knows about a call's signaling and
+// media, for working out why a call sounds bad
+type CallDiagnostics struct {
+	CallID string `json:"call_id"`
+	// Active is false for calls GoSIP has handed off to the phones or that
+	// have ended; their diagnostics come from the SIP trace alone
+	Active    bool   `json:"active"`
+	State     string `json:"state,omitempty"`
+	Transport string `json:"transport,omitempty"` // SIP transport the call arrived on
+
+	Codec        string         `json:"codec,omitempty"` // Negotiated audio codec
+	ComfortNoise bool           `json:"comfort_noise"`   // The answer accepted CN payloads
+	Offer        *MediaEndpoint `json:"offer,omitempty"`
+	Answer       *MediaEndpoint `json:"answer,omitempty"`
+	Security     MediaSecurity  `json:"security"`
+
+	// RTP is set on calls whose RTP passes through GoSIP
+	RTP *jitter.Stats `json:"rtp,omitempty"`
+
+	Messages []SIPMessage `json:"messages"` // Recent SIP messages, oldest first
+}
+
+// MediaEndpoint describes the audio stream one side of a call offered or
+// answered in SDP
+type MediaEndpoint struct {
+	Address    string         `json:"address"` // Connection address and port
+	Profile    string         `json:"profile"` // e.g. RTP/AVP or RTP/SAVP
+	Direction  string         `json:"direction"`
+	Codecs     []string       `json:"codecs"`
+	Candidates []ICECandidate `json:"ice_candidates,omitempty"`
+	// Selected is the ICE candidate media is sent to: the one matching the
+	// connection address, as the default candidate does
+	Selected    *ICECandidate `json:"ice_selected,omitempty"`
+	KeyExchange string        `json:"key_exchange,omitempty"`
+}
+
+// ICECandidate is an a=candidate line of an SDP body (RFC 8839)
+type ICECandidate struct {
+	Foundation string `json:"foundation"`
+	Component  int    `json:"component"`
+	Transport  string `json:"transport"`
+	Priority   uint32 `json:"priority"`
+	Address    string `json:"address"`
+	Port       int    `json:"port"`
+	Type       string `json:"type"` // host, srflx, prflx or relay
+}
+
+// MediaSecurity describes how a call's audio is protected
+type MediaSecurity struct {
+	SRTP        bool   `json:"srtp"`                   // The audio is encrypted
+	KeyExchange string `json:"key_exchange,omitempty"` // sdes, dtls or zrtp
+	SRTPProfile string `json:"srtp_profile,omitempty"` // For SRTP GoSIP terminates
+	ZRTPState   string `json:"zrtp_state,omitempty"`
+}
+
+// CallDiagnostics returns the diagnostics of an active or recent call
+func (s *Server) CallDiagnostics(callID string) (*CallDiagnostics, bool) {
+	session := s.sessions.Get(callID)
+	trace, traced := s.trace.dialog(callID)
+	if session == nil && !traced {
+		return nil, false
+	}
+
+	diag := &CallDiagnostics{
+		CallID:    callID,
+		Transport: strings.ToUpper(trace.transport),
+		Messages:  trace.messages,
+	}
+	offer, answer := trace.offer, trace.answer
+	if session != nil {
+		state := session.GetState()
+		diag.Active = state != CallStateTerminated
+		diag.State = string(state)
+		diag.Codec = session.Codec
+		if offer == nil {
+			offer = session.RemoteSDP
+		}
+	}
+	if diag.Messages == nil {
+		diag.Messages = []SIPMessage{}
+	}
+
+	diag.Offer = parseMediaEndpoint(offer)
+	diag.Answer = parseMediaEndpoint(answer)
+	if diag.Answer != nil {
+		if diag.Codec == "" {
+			diag.Codec = NegotiatedCodec(answer)
+		}
+		diag.ComfortNoise = SDPHasComfortNoise(answer)
+	}
+
+	// The answer settles the media; until then go by the offer
+	if agreed := diag.Answer; agreed != nil || diag.Offer != nil {
+		if agreed == nil {
+			agreed = diag.Offer
+		}
+		diag.Security.SRTP = strings.Contains(agreed.Profile, "SAVP")
+		diag.Security.KeyExchange = agreed.KeyExchange
+	}
+	if ctx, ok := s.srtpMgr.Get(callID); ok {
+		diag.Security.SRTP = true
+		diag.Security.SRTPProfile = string(ctx.Profile())
+	}
+	if s.zrtpMgr != nil {
+		if zs, ok := s.zrtpMgr.GetSession(callID); ok {
+			zs.mu.RLock()
+			diag.Security.ZRTPState = string(zs.State)
+			zs.mu.RUnlock()
+		}
+	}
+
+	if stats, ok := s.jitterMgr.Stats(callID); ok {
+		diag.RTP = &stats
+	}
+	return diag, true
+}
+
+// parseMediaEndpoint reads the audio stream of an SDP body, or returns nil
+// when it has none
+func parseMediaEndpoint(sdp []byte) *MediaEndpoint {
+	var ep *MediaEndpoint
+	var sessionAddr, mediaAddr, port string
+	inAudio := false
+	for _, line := range strings.Split(string(sdp), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "m="):
+			if ep != nil {
+				inAudio = false
+				continue
+			}
+			fields := strings.Fields(line)
+			inAudio = len(fields) >= 3 && fields[0] == "m=audio"
+			if inAudio {
+				ep = &MediaEndpoint{Profile: fields[2], Direction: "sendrecv"}
+				port = fields[1]
+			}
+		case strings.HasPrefix(line, "c="):
+			// c=IN IP4 192.0.2.1
+			if fields := strings.Fields(line); len(fields) == 3 {
+				if inAudio {
+					mediaAddr = fields[2]
+				} else if ep == nil {
+					sessionAddr = fields[2]
+				}
+			}
+		case !inAudio:
+		case line == "a=sendrecv", line == "a=sendonly", line == "a=recvonly", line == "a=inactive":
+			ep.Direction = strings.TrimPrefix(line, "a=")
+		case strings.HasPrefix(line, "a=candidate:"):
+			if c, ok := parseICECandidate(line); ok {
+				ep.Candidates = append(ep.Candidates, c)
+			}
+		case strings.HasPrefix(line, "a=crypto:"):
+			ep.KeyExchange = KeyExchangeSDES
+		case strings.HasPrefix(line, "a=fingerprint:"):
+			ep.KeyExchange = KeyExchangeDTLS
+		case strings.HasPrefix(line, "a=zrtp-hash:"):
+			ep.KeyExchange = KeyExchangeZRTP
+		}
+	}
+	if ep == nil {
+		return nil
+	}
+
+	addr := mediaAddr
+	if addr == "" {
+		addr = sessionAddr
+	}
+	ep.Address = addr + ":" + port
+	ep.Codecs = SDPCodecs(sdp)
+	for i, c := range ep.Candidates {
+		if c.Component == 1 && c.Address == addr && strconv.Itoa(c.Port) == port {
+			ep.Selected = &ep.Candidates[i]
+			break
+		}
+	}
+	return ep
+}
+
+// parseICECandidate parses an a=candidate line:
+// a=candidate:foundation component transport priority address port typ type ...
+func parseICECandidate(line string) (ICECandidate, bool) {
+	fields := strings.Fields(strings.TrimPrefix(line, "a=candidate:"))
+	if len(fields) < 8 || fields[6] != "typ" {
+		return ICECandidate{}, false
+	}
+	component, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return ICECandidate{}, false
+	}
+	priority, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return ICECandidate{}, false
+	}
+	port, err := strconv.Atoi(fields[5])
+	if err != nil {
+		return ICECandidate{}, false
+	}
+	return ICECandidate{
+		Foundation: fields[0],
+		Component:  component,
+		Transport:  strings.ToUpper(fields[2]),
+		Priority:   uint32(priority),
+		Address:    fields[4],
+		Port:       port,
+		Type:       fields[7],
+	}, true
+}
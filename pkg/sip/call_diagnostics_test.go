@@ -0,0 +1,91 @@
+package sip
+
+import (
+	"testing"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+const iceOffer = "v=0\r\n" +
+	"o=- 1 1 IN IP4 192.168.1.20\r\n" +
+	"s=-\r\n" +
+	"c=IN IP4 203.0.113.7\r\n" +
+	"t=0 0\r\n" +
+	"m=audio 40000 RTP/SAVP 9 0\r\n" +
+	"a=rtpmap:9 G722/8000\r\n" +
+	"a=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:WVNfX19zZW1jdGwgKCkgewkyMjA7fQp9CnVubGVz\r\n" +
+	"a=candidate:1 1 UDP 2130706431 192.168.1.20 40000 typ host\r\n" +
+	"a=candidate:2 1 UDP 1694498815 203.0.113.7 40000 typ srflx raddr 192.168.1.20 rport 40000\r\n" +
+	"a=candidate:bad\r\n" +
+	"a=sendonly\r\n" +
+	"m=video 0 RTP/AVP 96\r\n" +
+	"a=sendrecv\r\n"
+
+func TestParseMediaEndpoint(t *testing.T) {
+	ep := parseMediaEndpoint([]byte(iceOffer))
+	if ep == nil {
+		t.Fatal("Expected an audio endpoint")
+	}
+	if ep.Address != "203.0.113.7:40000" || ep.Profile != "RTP/SAVP" || ep.Direction != "sendonly" {
+		t.Errorf("Unexpected endpoint %+v", ep)
+	}
+	if len(ep.Codecs) != 2 || ep.Codecs[0] != "G722" || ep.KeyExchange != KeyExchangeSDES {
+		t.Errorf("Unexpected codecs %v or key exchange %q", ep.Codecs, ep.KeyExchange)
+	}
+	if len(ep.Candidates) != 2 {
+		t.Fatalf("Expected 2 ICE candidates, got %+v", ep.Candidates)
+	}
+	if ep.Selected == nil || ep.Selected.Type != "srflx" || ep.Selected.Priority != 1694498815 {
+		t.Errorf("Expected the srflx candidate to be in use, got %+v", ep.Selected)
+	}
+
+	// Media without a candidate at its address
+	if ep := parseMediaEndpoint([]byte(yealinkOffer)); ep == nil || ep.Selected != nil || ep.Address != "10.0.0.5:11800" {
+		t.Errorf("Unexpected endpoint without ICE %+v", ep)
+	}
+	if ep := parseMediaEndpoint([]byte("v=0\r\n")); ep != nil {
+		t.Errorf("Expected no endpoint without audio, got %+v", ep)
+	}
+}
+
+func TestServer_CallDiagnostics(t *testing.T) {
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0"}, setupTestDB(t))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	invite := sdpInvite(t, iceOffer)
+	callID := invite.CallID().Value()
+	if _, ok := server.CallDiagnostics(callID); ok {
+		t.Fatal("Expected no diagnostics for an unknown call")
+	}
+
+	// A call already handed off to the phones has its trace
+	server.trace.Record(TraceIn, invite)
+	answer := sip.NewResponseFromRequest(invite, sip.StatusOK, "OK",
+		[]byte("v=0\r\nc=IN IP4 10.0.0.9\r\nm=audio 6000 RTP/SAVP 9 13\r\na=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:x\r\n"))
+	answer.AppendHeader(sip.NewHeader("Content-Type", "application/sdp"))
+	server.trace.Record(TraceOut, answer)
+
+	diag, ok := server.CallDiagnostics(callID)
+	if !ok {
+		t.Fatal("Expected diagnostics from the trace")
+	}
+	if diag.Active || diag.Transport != "UDP" || diag.Codec != "G722" || !diag.ComfortNoise {
+		t.Errorf("Unexpected diagnostics %+v", diag)
+	}
+	if diag.Answer == nil || diag.Answer.Address != "10.0.0.9:6000" || diag.Offer.Selected == nil {
+		t.Errorf("Unexpected media %+v / %+v", diag.Offer, diag.Answer)
+	}
+	if !diag.Security.SRTP || diag.Security.KeyExchange != KeyExchangeSDES || len(diag.Messages) != 2 || diag.RTP != nil {
+		t.Errorf("Unexpected security %+v or %d messages", diag.Security, len(diag.Messages))
+	}
+
+	// Calls GoSIP still tracks report their state and the media it handles
+	session := NewCallSession(invite, CallDirectionInbound)
+	server.sessions.Add(session)
+	server.JitterBufferForCall(session)
+	if diag, _ = server.CallDiagnostics(callID); !diag.Active || diag.State != string(CallStateRinging) || diag.RTP == nil {
+		t.Errorf("Expected an active ringing call with RTP stats, got %+v", diag)
+	}
+}
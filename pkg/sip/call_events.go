@@ -0,0 +1,123 @@
+package sip
+
+import (
+	"context"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/events"
+)
+
+// CallEvent is a call starting, being answered, held, resumed or ending,
+// as reported on the event stream
+type CallEvent struct {
+	CallID        string        `json:"call_id"`
+	Direction     CallDirection `json:"direction"`
+	DeviceID      int64         `json:"device_id,omitempty"`
+	DIDID         *int64        `json:"did_id,omitempty"`
+	FromNumber    string        `json:"from_number"`
+	ToNumber      string        `json:"to_number"`
+	State         CallState     `json:"state"`
+	PreviousState CallState     `json:"previous_state,omitempty"`
+	AnsweredAt    *time.Time    `json:"answered_at,omitempty"`
+	Duration      int           `json:"duration"` // Seconds since the call was answered
+}
+
+// RegistrationEvent is a device coming online or going offline
+type RegistrationEvent struct {
+	DeviceID int64  `json:"device_id"`
+	Username string `json:"username,omitempty"`
+	Reason   string `json:"reason"` // registered, unregistered or expired
+}
+
+// ZRTPEvent is a call's media being secured with ZRTP
+type ZRTPEvent struct {
+	CallID    string    `json:"call_id"`
+	SecuredAt time.Time `json:"secured_at"`
+}
+
+// callEventTypes maps the states calls enter to event types. Calls
+// entering CallStateActive are answered the first time and resumed after.
+var callEventTypes = map[CallState]string{
+	CallStateRinging:    events.TypeCallStarted,
+	CallStateHeld:       events.TypeCallHeld,
+	CallStateHolding:    events.TypeCallHeld,
+	CallStateTerminated: events.TypeCallTerminated,
+}
+
+// publishCallState reports a call changing state on the event stream
+func (s *Server) publishCallState(session *CallSession, state CallState) {
+	s.mu.RLock()
+	hub := s.events
+	s.mu.RUnlock()
+	if hub == nil {
+		return
+	}
+
+	event := CallEvent{Duration: session.Duration()}
+	session.mu.RLock()
+	event.CallID = session.CallID
+	event.Direction = session.Direction
+	event.DeviceID = session.DeviceID
+	event.DIDID = session.DIDID
+	event.FromNumber = session.FromNumber
+	event.ToNumber = session.ToNumber
+	event.State = state
+	event.PreviousState = session.PreviousState
+	event.AnsweredAt = session.AnsweredAt
+	session.mu.RUnlock()
+
+	eventType, ok := callEventTypes[state]
+	if state == CallStateActive {
+		eventType, ok = events.TypeCallResumed, true
+		if event.PreviousState == CallStateRinging {
+			eventType = events.TypeCallAnswered
+		}
+	}
+	if ok {
+		hub.Publish(eventType, event)
+	}
+}
+
+// publishRegistration reports a device coming online or going offline on
+// the event stream
+func (s *Server) publishRegistration(deviceID int64, registered bool, reason string) {
+	s.mu.RLock()
+	hub := s.events
+	s.mu.RUnlock()
+	if hub == nil {
+		return
+	}
+
+	event := RegistrationEvent{DeviceID: deviceID, Reason: reason}
+	ctx, cancel := context.WithTimeout(context.Background(), config.CallSetupTimeout)
+	defer cancel()
+	if device, err := s.db.Devices.GetByID(ctx, deviceID); err == nil {
+		event.Username = device.Username
+	}
+
+	eventType := events.TypeRegistrationDown
+	if registered {
+		eventType = events.TypeRegistrationUp
+	}
+	hub.Publish(eventType, event)
+}
+
+// handleZRTPEvent reports calls secured with ZRTP on the event stream and
+// passes every ZRTP event on to the callback set with SetZRTPEventCallback
+func (s *Server) handleZRTPEvent(session *ZRTPSession, event string) {
+	s.mu.RLock()
+	hub := s.events
+	cb := s.zrtpEvents
+	s.mu.RUnlock()
+
+	if event == "secured" {
+		session.mu.RLock()
+		secured := ZRTPEvent{CallID: session.CallID, SecuredAt: session.SecuredAt}
+		session.mu.RUnlock()
+		hub.Publish(events.TypeCallZRTPSecured, secured)
+	}
+	if cb != nil {
+		cb(session, event)
+	}
+}
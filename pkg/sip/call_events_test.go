@@ -0,0 +1,130 @@
+package sip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/events"
+)
+
+// nextEvent waits for the next published event
+func nextEvent(t *testing.T, published <-chan events.Event) events.Event {
+	t.Helper()
+	select {
+	case e := <-published:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("Expected an event")
+	}
+	return events.Event{}
+}
+
+func TestServer_PublishesCallEvents(t *testing.T) {
+	database := setupTestDB(t)
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0"}, database)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	hub := events.NewHub(16)
+	server.SetEventHub(hub)
+	_, published, cancel := hub.Subscribe(0)
+	defer cancel()
+
+	session := &CallSession{
+		CallID:     "call-1",
+		Direction:  CallDirectionInbound,
+		DeviceID:   7,
+		FromNumber: "+15551234567",
+		ToNumber:   "+15557654321",
+		State:      CallStateRinging,
+	}
+	server.sessions.Add(session)
+	for _, state := range []CallState{CallStateActive, CallStateHolding, CallStateActive, CallStateTransferring, CallStateTerminated} {
+		if err := session.SetState(state); err != nil {
+			t.Fatalf("SetState(%s) failed: %v", state, err)
+		}
+	}
+
+	// Transfers are not published on their own
+	want := []string{
+		events.TypeCallStarted,
+		events.TypeCallAnswered,
+		events.TypeCallHeld,
+		events.TypeCallResumed,
+		events.TypeCallTerminated,
+	}
+	for _, eventType := range want {
+		e := nextEvent(t, published)
+		if e.Type != eventType {
+			t.Fatalf("Event type = %s, want %s", e.Type, eventType)
+		}
+		call, ok := e.Data.(CallEvent)
+		if !ok || call.CallID != "call-1" || call.DeviceID != 7 || call.FromNumber != "+15551234567" {
+			t.Errorf("Unexpected %s data %+v", e.Type, e.Data)
+		}
+		if eventType == events.TypeCallAnswered && call.AnsweredAt == nil {
+			t.Error("Expected the answer time on call.answered")
+		}
+	}
+
+	// Sessions added after they started are not reported as new calls
+	server.sessions.Add(&CallSession{CallID: "call-2", State: CallStateActive})
+	select {
+	case e := <-published:
+		t.Errorf("Unexpected event %s", e.Type)
+	default:
+	}
+}
+
+func TestServer_PublishesRegistrationEvents(t *testing.T) {
+	database := setupTestDB(t)
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0"}, database)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	hub := events.NewHub(8)
+	server.SetEventHub(hub)
+	_, published, cancel := hub.Subscribe(0)
+	defer cancel()
+
+	device := createTestDevice(t, database, "alice", "passwordhash")
+	server.publishRegistration(device.ID, true, RegistrationRegistered)
+	server.publishRegistration(device.ID, false, RegistrationExpired)
+
+	up := nextEvent(t, published)
+	if up.Type != events.TypeRegistrationUp {
+		t.Fatalf("Event type = %s, want %s", up.Type, events.TypeRegistrationUp)
+	}
+	if reg := up.Data.(RegistrationEvent); reg.DeviceID != device.ID || reg.Username != "alice" || reg.Reason != RegistrationRegistered {
+		t.Errorf("Unexpected registration.up data %+v", reg)
+	}
+	if down := nextEvent(t, published); down.Type != events.TypeRegistrationDown || down.Data.(RegistrationEvent).Reason != RegistrationExpired {
+		t.Errorf("Expected registration.down for the expiry, got %+v", down)
+	}
+}
+
+func TestServer_PublishesZRTPSecured(t *testing.T) {
+	database := setupTestDB(t)
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0"}, database)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	hub := events.NewHub(8)
+	server.SetEventHub(hub)
+	_, published, cancel := hub.Subscribe(0)
+	defer cancel()
+
+	var told []string
+	server.SetZRTPEventCallback(func(_ *ZRTPSession, event string) { told = append(told, event) })
+
+	session := &ZRTPSession{CallID: "call-1", SecuredAt: time.Now()}
+	server.handleZRTPEvent(session, "started")
+	server.handleZRTPEvent(session, "secured")
+
+	if e := nextEvent(t, published); e.Type != events.TypeCallZRTPSecured || e.Data.(ZRTPEvent).CallID != "call-1" {
+		t.Errorf("Expected call.zrtp_secured for call-1, got %+v", e)
+	}
+	if len(told) != 2 {
+		t.Errorf("Expected the callback to be told about both events, got %v", told)
+	}
+}
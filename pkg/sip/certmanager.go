@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/retry"
 	"github.com/caddyserver/certmagic"
 	"github.com/libdns/cloudflare"
 )
@@ -175,15 +176,20 @@ func (cm *CertManager) initACME() error {
 	domains := []string{cm.config.ACMEDomain}
 	domains = append(domains, cm.config.ACMEDomains...)
 
-	// Set up event handler for certificate status updates
+	// Set up event handler for certificate status updates. CertMagic retries
+	// failed orders on its own schedule; the acme worker only counts them.
+	worker := retry.For(config.RetryWorkerACME)
 	cm.magic.OnEvent = func(ctx context.Context, event string, data map[string]any) error {
 		switch event {
 		case "cert_obtained", "cert_renewed":
 			cm.mu.Lock()
 			cm.lastRenewal = time.Now()
 			cm.mu.Unlock()
+			worker.Succeeded()
 			slog.Info("Certificate obtained/renewed", "event", event, "data", data)
 		case "cert_failed":
+			err, _ := data["error"].(error)
+			worker.Failed(err, true)
 			slog.Error("Certificate operation failed", "event", event, "data", data)
 		}
 		return nil
@@ -0,0 +1,251 @@
+// Package sip provides audio codec negotiation for GoSIP
+package sip
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/codec"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/pion/rtp"
+)
+
+// staticPayloadTypes are the encoding names of the static RTP payload types
+// phones offer without an rtpmap (RFC 3551)
+var staticPayloadTypes = map[string]string{
+	"0":  "PCMU",
+	"3":  "GSM",
+	"8":  "PCMA",
+	"9":  "G722",
+	"13": "CN",
+	"18": "G729",
+}
+
+// sdpAudioFormats returns the payload types of the audio m= line of an SDP
+// body in the order offered, with the encoding name of each
+func sdpAudioFormats(sdp []byte) (payloadTypes []string, names map[string]string) {
+	names = make(map[string]string)
+	for _, line := range strings.Split(string(sdp), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "m=audio ") && payloadTypes == nil:
+			if fields := strings.Fields(line); len(fields) > 3 {
+				payloadTypes = fields[3:]
+			}
+		case strings.HasPrefix(line, "a=rtpmap:"):
+			pt, encoding, ok := strings.Cut(strings.TrimPrefix(line, "a=rtpmap:"), " ")
+			if ok {
+				name, _, _ := strings.Cut(encoding, "/")
+				names[pt] = name
+			}
+		}
+	}
+	for _, pt := range payloadTypes {
+		if _, ok := names[pt]; !ok {
+			names[pt] = staticPayloadTypes[pt]
+		}
+	}
+	return payloadTypes, names
+}
+
+// SDPCodecs returns the encoding names of the audio formats in an SDP body,
+// most preferred first
+func SDPCodecs(sdp []byte) []string {
+	payloadTypes, names := sdpAudioFormats(sdp)
+	codecs := make([]string, 0, len(payloadTypes))
+	for _, pt := range payloadTypes {
+		codecs = append(codecs, names[pt])
+	}
+	return codecs
+}
+
+// NegotiatedCodec returns the codec an SDP answer settled on: its first
+// audio format other than DTMF events and comfort noise. It is empty when
+// the answer has no audio.
+func NegotiatedCodec(answer []byte) string {
+	for _, name := range SDPCodecs(answer) {
+		if name != "" && !strings.EqualFold(name, "telephone-event") && !strings.EqualFold(name, "CN") {
+			if c, ok := codec.Lookup(name); ok {
+				return c.Name
+			}
+			return name
+		}
+	}
+	return ""
+}
+
+// PreferCodecs reorders the audio formats of an SDP offer so the codecs in
+// prefs come first, in that order. Other formats keep their place after
+// them, so the answerer can still pick one GoSIP doesn't know.
+func PreferCodecs(sdp []byte, prefs []codec.Codec) []byte {
+	payloadTypes, names := sdpAudioFormats(sdp)
+	if len(payloadTypes) == 0 {
+		return sdp
+	}
+
+	ordered := make([]string, 0, len(payloadTypes))
+	used := make(map[string]bool)
+	for _, c := range prefs {
+		for _, pt := range payloadTypes {
+			if !used[pt] && strings.EqualFold(names[pt], c.Name) {
+				ordered = append(ordered, pt)
+				used[pt] = true
+			}
+		}
+	}
+	for _, pt := range payloadTypes {
+		if !used[pt] {
+			ordered = append(ordered, pt)
+		}
+	}
+
+	lines := bytes.Split(sdp, []byte("\n"))
+	for i, line := range lines {
+		if !bytes.HasPrefix(line, []byte("m=audio ")) {
+			continue
+		}
+		cr := bytes.HasSuffix(line, []byte("\r"))
+		fields := strings.Fields(string(line))
+		rewritten := strings.Join(append(fields[:3:3], ordered...), " ")
+		if cr {
+			rewritten += "\r"
+		}
+		lines[i] = []byte(rewritten)
+		break
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// basicSDP returns an SDP body offering codecs and DTMF events, for
+// re-INVITEs on calls whose own SDP GoSIP doesn't have
+func basicSDP(direction string, codecs []codec.Codec) []byte {
+	return mediaSDP(direction, codecs, sdpTelephoneEvent, net.IPv4zero, 0)
+}
+
+// sdpTelephoneEvent is the payload type GoSIP offers DTMF events on
+const sdpTelephoneEvent = 101
+
+// mediaSDP returns an SDP body for audio received at ip and port, in codecs
+// and, unless telephoneEvent is 0, DTMF events on that payload type
+func mediaSDP(direction string, codecs []codec.Codec, telephoneEvent uint8, ip net.IP, port int) []byte {
+	var formats, rtpmaps strings.Builder
+	for _, c := range codecs {
+		fmt.Fprintf(&formats, " %d", c.PayloadType)
+		fmt.Fprintf(&rtpmaps, "a=rtpmap:%d %s\n", c.PayloadType, c.Rtpmap())
+	}
+	if telephoneEvent != 0 {
+		fmt.Fprintf(&formats, " %d", telephoneEvent)
+		fmt.Fprintf(&rtpmaps, "a=rtpmap:%d telephone-event/8000\n", telephoneEvent)
+	}
+	return []byte(fmt.Sprintf(`v=0
+o=gosip 0 0 IN IP4 %s
+s=GoSIP Call
+c=IN IP4 %s
+t=0 0
+m=audio %d RTP/AVP%s
+a=%s
+%s`, ip, ip, port, formats.String(), direction, rtpmaps.String()))
+}
+
+// rtpSender encodes 16 kHz audio as a party's RTP stream
+type rtpSender struct {
+	encoding    string
+	encoder     codec.Encoder
+	resampler   *codec.Resampler
+	payloadType uint8
+	clockRate   int
+	seq         uint16
+	timestamp   uint32
+	ssrc        uint32
+}
+
+// newRTPSender creates an rtpSender with a random start, which sends
+// nothing until it has an encoding
+func newRTPSender() rtpSender {
+	return rtpSender{seq: uint16(rand.Uint32()), timestamp: rand.Uint32(), ssrc: rand.Uint32()}
+}
+
+// setEncoding switches the stream to an encoding. Encodings GoSIP can't
+// encode leave the sender without an encoder.
+func (r *rtpSender) setEncoding(encoding string, payloadType uint8) {
+	r.encoding = encoding
+	r.payloadType = payloadType
+	r.encoder = nil
+
+	cd, ok := codec.Lookup(encoding)
+	if !ok {
+		return
+	}
+	enc, err := codec.NewEncoder(cd)
+	if err != nil {
+		slog.Debug("Cannot encode audio", "codec", encoding, "error", err)
+		return
+	}
+	r.encoder = enc
+	r.resampler = codec.NewResampler(recordingRate, cd.SampleRate)
+	r.clockRate = cd.ClockRate
+}
+
+// packet encodes audio as the stream's next RTP packet
+func (r *rtpSender) packet(pcm []int16) ([]byte, error) {
+	payload, err := r.encoder.Encode(r.resampler.Resample(pcm))
+	if err != nil {
+		return nil, err
+	}
+	pkt := rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    r.payloadType,
+			SequenceNumber: r.seq,
+			Timestamp:      r.timestamp,
+			SSRC:           r.ssrc,
+		},
+		Payload: payload,
+	}
+	r.seq++
+	r.timestamp += uint32(len(pcm) * r.clockRate / recordingRate)
+	return pkt.Marshal()
+}
+
+// codecPreferences resolves configured codec names, dropping those GoSIP
+// can't encode in this build (Opus without libopus) or doesn't know
+func codecPreferences(names []string, defaults string) []codec.Codec {
+	if len(names) == 0 {
+		names = strings.Split(defaults, ",")
+	}
+	var codecs []codec.Codec
+	for _, name := range names {
+		c, ok := codec.Lookup(strings.TrimSpace(name))
+		if !ok || !codec.Available(c) {
+			slog.Debug("Skipping unavailable codec", "codec", name)
+			continue
+		}
+		codecs = append(codecs, c)
+	}
+	if len(codecs) == 0 {
+		codecs = []codec.Codec{codec.PCMU, codec.PCMA}
+	}
+	return codecs
+}
+
+// sessionCodecs returns the codecs preferred for a call: narrowband for
+// calls with a Twilio trunk leg and the device codecs otherwise
+func (s *Server) sessionCodecs(session *CallSession) []codec.Codec {
+	if session.TrunkCallSID != "" {
+		return s.trunkCodecs
+	}
+	return s.deviceCodecs
+}
+
+// newCodecPreferences resolves the configured device and trunk codecs
+func newCodecPreferences(media *config.MediaConfig) (device, trunk []codec.Codec) {
+	if media == nil {
+		media = &config.MediaConfig{}
+	}
+	return codecPreferences(media.DeviceCodecs, config.DefaultDeviceCodecs),
+		codecPreferences(media.TrunkCodecs, config.DefaultTrunkCodecs)
+}
@@ -0,0 +1,100 @@
+package sip
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/codec"
+	"github.com/btafoya/gosip/internal/config"
+)
+
+const yealinkOffer = "v=0\r\n" +
+	"o=- 20 20 IN IP4 10.0.0.5\r\n" +
+	"s=SDP data\r\n" +
+	"c=IN IP4 10.0.0.5\r\n" +
+	"t=0 0\r\n" +
+	"m=audio 11800 RTP/AVP 0 8 9 18 101\r\n" +
+	"a=rtpmap:0 PCMU/8000\r\n" +
+	"a=rtpmap:8 PCMA/8000\r\n" +
+	"a=rtpmap:9 G722/8000\r\n" +
+	"a=rtpmap:101 telephone-event/8000\r\n" +
+	"a=sendrecv\r\n"
+
+func TestSDPCodecs(t *testing.T) {
+	if got := strings.Join(SDPCodecs([]byte(yealinkOffer)), ","); got != "PCMU,PCMA,G722,G729,telephone-event" {
+		t.Errorf("SDPCodecs = %s", got)
+	}
+
+	// Static payload types need no rtpmap
+	if got := strings.Join(SDPCodecs([]byte("m=audio 5000 RTP/AVP 9 0\n")), ","); got != "G722,PCMU" {
+		t.Errorf("SDPCodecs without rtpmap = %s", got)
+	}
+}
+
+func TestPreferCodecs(t *testing.T) {
+	sdp := PreferCodecs([]byte(yealinkOffer), []codec.Codec{codec.Opus, codec.G722, codec.PCMU})
+	if !strings.Contains(string(sdp), "m=audio 11800 RTP/AVP 9 0 8 18 101\r\n") {
+		t.Errorf("Expected G722 then PCMU first, got\n%s", sdp)
+	}
+	if len(sdp) != len(yealinkOffer) {
+		t.Errorf("Expected only the m= line to change, got\n%s", sdp)
+	}
+
+	if got := PreferCodecs([]byte("v=0\n"), []codec.Codec{codec.G722}); string(got) != "v=0\n" {
+		t.Errorf("Expected SDP without audio to be unchanged, got %q", got)
+	}
+}
+
+func TestNegotiatedCodec(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   string
+	}{
+		{"m=audio 5000 RTP/AVP 9 101\na=rtpmap:9 G722/8000\na=rtpmap:101 telephone-event/8000\n", "G722"},
+		{"m=audio 5000 RTP/AVP 101 0\na=rtpmap:101 telephone-event/8000\n", "PCMU"},
+		{"m=audio 5000 RTP/AVP 96\na=rtpmap:96 OPUS/48000/2\n", "opus"},
+		{"m=audio 5000 RTP/AVP 13\n", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NegotiatedCodec([]byte(tt.answer)); got != tt.want {
+			t.Errorf("NegotiatedCodec(%q) = %q, want %q", tt.answer, got, tt.want)
+		}
+	}
+}
+
+func TestCodecPreferences(t *testing.T) {
+	got := codecPreferences([]string{"opus", "g722", "G729", "PCMU"}, config.DefaultDeviceCodecs)
+	var names []string
+	for _, c := range got {
+		names = append(names, c.Name)
+	}
+	want := "G722,PCMU"
+	if codec.Available(codec.Opus) {
+		want = "opus," + want
+	}
+	if strings.Join(names, ",") != want {
+		t.Errorf("codecPreferences = %v, want %s", names, want)
+	}
+
+	if got := codecPreferences(nil, config.DefaultTrunkCodecs); len(got) != 2 || got[0] != codec.PCMU {
+		t.Errorf("Expected the trunk defaults, got %v", got)
+	}
+}
+
+func TestHoldManager_BasicSDP(t *testing.T) {
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0"}, setupTestDB(t))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	// Calls between phones offer wideband, trunk calls stay on G.711
+	device := string(server.holdMgr.generateHoldSDP(&CallSession{CallID: "device"}))
+	if !strings.Contains(device, "a=rtpmap:9 G722/8000") || !strings.Contains(device, "a=sendonly") {
+		t.Errorf("Expected G722 on a device call, got\n%s", device)
+	}
+	trunk := string(server.holdMgr.generateResumeSDP(&CallSession{CallID: "trunk", TrunkCallSID: "CA123"}))
+	if strings.Contains(trunk, "G722") || !strings.Contains(trunk, "m=audio 0 RTP/AVP 0 8 101") {
+		t.Errorf("Expected G.711 only on a trunk call, got\n%s", trunk)
+	}
+}
@@ -0,0 +1,129 @@
+// Package sip provides comfort noise negotiation for GoSIP
+package sip
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/codec"
+)
+
+// silenceSuppOff disables voice activity detection for the audio stream
+// (RFC 3108), so the endpoint sends audio through silence
+const silenceSuppOff = "a=silenceSupp:off - - - -"
+
+// SDPHasComfortNoise reports whether an SDP body carries CN payloads
+func SDPHasComfortNoise(sdp []byte) bool {
+	for _, name := range SDPCodecs(sdp) {
+		if strings.EqualFold(name, codec.CN.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyComfortNoise adjusts an SDP offer for a device's comfort noise
+// setting. Enabled adds CN to the audio formats when it is missing.
+// Disabled removes CN, turns off silence suppression and asks G.729
+// endpoints not to use Annex B, so the device gets audio throughout.
+func ApplyComfortNoise(sdp []byte, enabled bool) []byte {
+	payloadTypes, names := sdpAudioFormats(sdp)
+	if len(payloadTypes) == 0 {
+		return sdp
+	}
+
+	// g729Annexb is true while a G.729 offer has no fmtp saying annexb=no
+	cnTypes := make(map[string]bool)
+	g729Annexb := false
+	for _, pt := range payloadTypes {
+		switch {
+		case strings.EqualFold(names[pt], codec.CN.Name):
+			cnTypes[pt] = true
+		case pt == "18":
+			g729Annexb = true
+		}
+	}
+	if enabled && len(cnTypes) > 0 {
+		return sdp
+	}
+
+	eol := "\n"
+	if bytes.Contains(sdp, []byte("\r\n")) {
+		eol = "\r\n"
+	}
+
+	// sectionEnd returns the attributes added at the end of the audio section
+	sectionEnd := func() []string {
+		switch {
+		case enabled:
+			return []string{"a=rtpmap:13 " + codec.CN.Rtpmap()}
+		case g729Annexb:
+			return []string{silenceSuppOff, "a=fmtp:18 annexb=no"}
+		}
+		return []string{silenceSuppOff}
+	}
+
+	var out []string
+	inAudio, seenAudio := false, false
+	for _, line := range strings.Split(strings.TrimRight(string(sdp), "\r\n"), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "m=") {
+			if inAudio {
+				out = append(out, sectionEnd()...)
+			}
+			inAudio = !seenAudio && strings.HasPrefix(line, "m=audio ")
+			if inAudio {
+				seenAudio = true
+				line = rewriteAudioFormats(line, enabled, cnTypes)
+			}
+			out = append(out, line)
+			continue
+		}
+
+		if inAudio && !enabled {
+			switch pt := attributePayloadType(line); {
+			case cnTypes[pt], strings.HasPrefix(line, "a=silenceSupp:"):
+				continue
+			case pt == "18" && strings.HasPrefix(line, "a=fmtp:"):
+				g729Annexb = false
+				line = "a=fmtp:18 annexb=no"
+			}
+		}
+		out = append(out, line)
+	}
+	if inAudio {
+		out = append(out, sectionEnd()...)
+	}
+	return []byte(strings.Join(out, eol) + eol)
+}
+
+// rewriteAudioFormats adds CN to, or removes the CN types from, the format
+// list of an m=audio line
+func rewriteAudioFormats(line string, addCN bool, cnTypes map[string]bool) string {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return line
+	}
+	formats := fields[:3:3]
+	for _, pt := range fields[3:] {
+		if !cnTypes[pt] {
+			formats = append(formats, pt)
+		}
+	}
+	if addCN {
+		formats = append(formats, "13")
+	}
+	return strings.Join(formats, " ")
+}
+
+// attributePayloadType returns the payload type an a=rtpmap or a=fmtp line
+// describes, or an empty string for other lines
+func attributePayloadType(line string) string {
+	for _, prefix := range []string{"a=rtpmap:", "a=fmtp:"} {
+		if strings.HasPrefix(line, prefix) {
+			pt, _, _ := strings.Cut(strings.TrimPrefix(line, prefix), " ")
+			return pt
+		}
+	}
+	return ""
+}
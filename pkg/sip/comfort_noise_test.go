@@ -0,0 +1,52 @@
+package sip
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyComfortNoise_Enabled(t *testing.T) {
+	sdp := string(ApplyComfortNoise([]byte(yealinkOffer), true))
+	if !strings.Contains(sdp, "m=audio 11800 RTP/AVP 0 8 9 18 101 13\r\n") || !strings.Contains(sdp, "a=rtpmap:13 CN/8000\r\n") {
+		t.Errorf("Expected CN to be offered, got\n%s", sdp)
+	}
+	if !SDPHasComfortNoise([]byte(sdp)) {
+		t.Error("Expected SDPHasComfortNoise to find CN")
+	}
+
+	// An offer that already has CN is left alone
+	if again := string(ApplyComfortNoise([]byte(sdp), true)); again != sdp {
+		t.Errorf("Expected no change, got\n%s", again)
+	}
+}
+
+func TestApplyComfortNoise_Disabled(t *testing.T) {
+	offer := "v=0\n" +
+		"m=audio 5000 RTP/AVP 0 18 13 101\n" +
+		"a=rtpmap:13 CN/8000\n" +
+		"a=rtpmap:101 telephone-event/8000\n" +
+		"a=silenceSupp:on - - - -\n" +
+		"m=video 5002 RTP/AVP 96\n" +
+		"a=rtpmap:96 H264/90000\n"
+
+	sdp := string(ApplyComfortNoise([]byte(offer), false))
+	want := "v=0\n" +
+		"m=audio 5000 RTP/AVP 0 18 101\n" +
+		"a=rtpmap:101 telephone-event/8000\n" +
+		"a=silenceSupp:off - - - -\n" +
+		"a=fmtp:18 annexb=no\n" +
+		"m=video 5002 RTP/AVP 96\n" +
+		"a=rtpmap:96 H264/90000\n"
+	if sdp != want {
+		t.Errorf("ApplyComfortNoise(false) =\n%s\nwant\n%s", sdp, want)
+	}
+	if SDPHasComfortNoise([]byte(sdp)) {
+		t.Error("Expected CN to be removed")
+	}
+
+	// An existing G.729 fmtp is rewritten rather than repeated
+	sdp = string(ApplyComfortNoise([]byte("m=audio 5000 RTP/AVP 18\na=fmtp:18 annexb=yes\n"), false))
+	if strings.Count(sdp, "a=fmtp:18") != 1 || !strings.Contains(sdp, "a=fmtp:18 annexb=no") {
+		t.Errorf("Expected a single annexb=no, got\n%s", sdp)
+	}
+}
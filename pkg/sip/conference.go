@@ -0,0 +1,907 @@
+// Package sip provides ad-hoc conferences that mix the audio of relayed
+// calls
+package sip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo"
+	"github.com/emiago/sipgo/sip"
+)
+
+var (
+	ErrConferenceUnavailable = errors.New("conferences need the media relay")
+	ErrCallNotConferenceable = errors.New("the call's media doesn't pass through GoSIP")
+	ErrCallNotAnswered       = errors.New("the call has not been answered")
+	ErrAlreadyConference     = errors.New("the call is already a conference")
+	ErrNotConference         = errors.New("the call is not a conference")
+	ErrConferenceFull        = errors.New("the conference is full")
+	ErrParticipantNotFound   = errors.New("no such conference participant")
+	ErrConferenceTarget      = errors.New("no device has that extension or username")
+)
+
+// Conference participant legs
+const (
+	ConferenceLegCaller  = "caller"
+	ConferenceLegCallee  = "callee"
+	ConferenceLegInvited = "invited"
+)
+
+// Conference participant states
+const (
+	ParticipantRinging = "ringing"
+	ParticipantJoined  = "joined"
+)
+
+// Conference event actions
+const (
+	ConferenceStarted  = "started"
+	ConferenceInvited  = "invited"
+	ConferenceJoined   = "joined"
+	ConferenceDeclined = "declined"
+	ConferenceMuted    = "muted"
+	ConferenceUnmuted  = "unmuted"
+	ConferenceLeft     = "left"
+	ConferenceEnded    = "ended"
+)
+
+// Conference audio is mixed at the recording rate in 20 ms frames
+const (
+	conferenceFrame   = 20 * time.Millisecond
+	conferenceSamples = recordingRate / 50
+
+	// conferenceBacklog caps the audio held for a participant between
+	// frames, so a party whose clock runs fast doesn't fall behind
+	conferenceBacklog = 10 * conferenceSamples
+)
+
+// ConferenceStatus is a conference and its participants
+type ConferenceStatus struct {
+	CallID       string                  `json:"call_id"`
+	CreatedAt    time.Time               `json:"created_at"`
+	Participants []ConferenceParticipant `json:"participants"`
+}
+
+// ConferenceParticipant is a party to a conference
+type ConferenceParticipant struct {
+	ID       string     `json:"id"`
+	Leg      string     `json:"leg"`             // "caller", "callee" or "invited"
+	Name     string     `json:"name"`            // The party's display name or user, or the device invited
+	State    string     `json:"state"`           // "ringing" or "joined"
+	Muted    bool       `json:"muted"`           // Left out of the mix the others hear
+	Codec    string     `json:"codec,omitempty"` // What the party sends and hears
+	JoinedAt *time.Time `json:"joined_at,omitempty"`
+}
+
+// ConferenceEvent is a conference starting or ending, or a participant
+// joining, leaving or being muted
+type ConferenceEvent struct {
+	CallID      string                 `json:"call_id"`
+	Action      string                 `json:"action"`
+	Participant *ConferenceParticipant `json:"participant,omitempty"`
+}
+
+// ConferenceManager turns relayed calls into conferences. GoSIP decodes
+// the audio of every participant and sends each the mix of the others,
+// in the codec it sends, so phones with different codecs can meet.
+type ConferenceManager struct {
+	server *Server
+	relay  *MediaRelay
+	max    int
+
+	mu          sync.Mutex
+	conferences map[string]*Conference // By the Call-ID of the call escalated
+	invited     map[string]*Conference // By the Call-ID of the INVITEs sent
+}
+
+// NewConferenceManager creates the manager of conferences between the
+// parties of calls the relay carries
+func NewConferenceManager(server *Server, relay *MediaRelay) *ConferenceManager {
+	return &ConferenceManager{
+		server:      server,
+		relay:       relay,
+		max:         config.ConferenceMaxParticipants,
+		conferences: make(map[string]*Conference),
+		invited:     make(map[string]*Conference),
+	}
+}
+
+// Get returns the conference a call was escalated to, or nil
+func (m *ConferenceManager) Get(callID string) *Conference {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.conferences[callID]
+}
+
+// Close ends every conference without hanging up its participants
+func (m *ConferenceManager) Close() {
+	m.mu.Lock()
+	conferences := make([]*Conference, 0, len(m.conferences))
+	for _, c := range m.conferences {
+		conferences = append(conferences, c)
+	}
+	m.mu.Unlock()
+
+	for _, c := range conferences {
+		c.end(false)
+	}
+}
+
+// start escalates an answered relayed call to a conference of its two
+// parties
+func (m *ConferenceManager) start(call *RelayedCall) (*Conference, error) {
+	call.mu.Lock()
+	answered := call.answered && call.invite != nil && call.answer != nil
+	var callerName, calleeName, encoding string
+	var payloadType uint8
+	if answered {
+		callerName = partyName(call.invite.From().DisplayName, call.invite.From().Address)
+		calleeName = partyName(call.answer.To().DisplayName, call.answer.To().Address)
+		// Both parties hear the codec they settled on until they send
+		if formats, _ := sdpAudioFormats(call.answer.Body()); len(formats) > 0 {
+			payloadType = parsePayloadType(formats[0])
+			encoding = call.payloads[payloadType]
+		}
+	}
+	call.mu.Unlock()
+	if !answered {
+		return nil, ErrCallNotAnswered
+	}
+
+	now := time.Now()
+	c := &Conference{
+		CallID:    call.CallID,
+		CreatedAt: now,
+		m:         m,
+		call:      call,
+		done:      make(chan struct{}),
+	}
+	c.caller = c.newParticipant(ConferenceLegCaller, callerName)
+	c.callee = c.newParticipant(ConferenceLegCallee, calleeName)
+	for _, p := range []*participant{c.caller, c.callee} {
+		p.info.State = ParticipantJoined
+		p.info.JoinedAt = &now
+		if encoding != "" {
+			p.setEncoding(encoding, payloadType)
+		}
+	}
+
+	m.mu.Lock()
+	if m.conferences[call.CallID] != nil {
+		m.mu.Unlock()
+		return nil, ErrAlreadyConference
+	}
+	m.conferences[call.CallID] = c
+	m.mu.Unlock()
+
+	call.setMixer(c)
+	go c.run()
+	slog.Info("Call escalated to a conference", "call_id", c.CallID)
+	c.publish(ConferenceStarted, nil)
+
+	// A call that ended meanwhile never tells the conference
+	select {
+	case <-call.closed:
+		c.ended()
+	default:
+	}
+	return c, nil
+}
+
+// inviteTarget finds the device an invite is for, by extension or username,
+// among the devices of the conference's tenant
+func (c *Conference) inviteTarget(ctx context.Context, target string) (*models.Device, error) {
+	s := c.m.server
+	tenantID, err := s.callTenant(ctx, c.CallID)
+	if err != nil {
+		return nil, err
+	}
+	device, err := s.db.Devices.GetByExtension(ctx, tenantID, target)
+	if err != nil {
+		device, err = s.db.Devices.GetByUsername(ctx, target)
+	}
+	if err != nil || !sameTenant(device.TenantID, tenantID) {
+		return nil, ErrConferenceTarget
+	}
+	return device, nil
+}
+
+// callTenant returns the tenant of a call: that of its device, or else of
+// its DID. It is nil for the instance's calls.
+func (s *Server) callTenant(ctx context.Context, callID string) (*int64, error) {
+	session := s.sessions.Get(callID)
+	if session == nil {
+		return nil, nil
+	}
+	if session.DeviceID != 0 {
+		device, err := s.db.Devices.GetByID(ctx, session.DeviceID)
+		if err != nil {
+			return nil, err
+		}
+		return device.TenantID, nil
+	}
+	if session.DIDID != nil {
+		did, err := s.db.DIDs.GetByID(ctx, *session.DIDID)
+		if err != nil {
+			return nil, err
+		}
+		return did.TenantID, nil
+	}
+	return nil, nil
+}
+
+// invitedBy returns the conference and participant an INVITE GoSIP sent
+// belongs to
+func (m *ConferenceManager) invitedBy(callID string) (*Conference, *participant) {
+	m.mu.Lock()
+	c := m.invited[callID]
+	m.mu.Unlock()
+	if c == nil {
+		return nil, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, p := range c.members {
+		if p.callID == callID {
+			return c, p
+		}
+	}
+	return nil, nil
+}
+
+// partyName is how a party introduces itself in its From or To header
+func partyName(displayName string, uri sip.Uri) string {
+	if name := strings.Trim(displayName, `"`); name != "" {
+		return name
+	}
+	return uri.User
+}
+
+// Conference is a call escalated to a conference. The original caller
+// and callee stay in their dialogs with GoSIP; participants invited later
+// have dialogs of their own with it.
+type Conference struct {
+	CallID    string
+	CreatedAt time.Time
+
+	m    *ConferenceManager
+	call *RelayedCall
+	done chan struct{}
+
+	mu             sync.Mutex
+	caller, callee *participant
+	members        []*participant // In the order they were added
+	nextID         int
+	finished       bool
+	callClosed     bool
+}
+
+// participant is a party's side of a conference: the audio it sent that
+// hasn't been mixed yet and the RTP stream it hears
+type participant struct {
+	info ConferenceParticipant
+
+	decoders legDecoders
+	pending  []int16 // 16 kHz audio waiting for the next frame
+
+	// The party hears the mix in the encoding it sends
+	rtpSender
+
+	// Invited participants have a dialog and media ports of their own
+	callID   string
+	cancel   context.CancelFunc // Gives up ringing
+	dialog   *sipgo.DialogClientSession
+	rtp      *net.UDPConn
+	rtcp     *net.UDPConn
+	payloads payloadNames
+	dest     *net.UDPAddr // Where its media goes: its SDP address, then where its RTP comes from
+	latched  bool
+}
+
+// newParticipant creates a participant with the next ID. c.mu must be held
+// or the conference not yet shared.
+func (c *Conference) newParticipant(leg, name string) *participant {
+	c.nextID++
+	p := &participant{
+		info:      ConferenceParticipant{ID: fmt.Sprintf("p%d", c.nextID), Leg: leg, Name: name, State: ParticipantRinging},
+		decoders:  make(legDecoders),
+		rtpSender: newRTPSender(),
+	}
+	c.members = append(c.members, p)
+	return p
+}
+
+// Status returns the conference and its participants
+func (c *Conference) Status() ConferenceStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := ConferenceStatus{CallID: c.CallID, CreatedAt: c.CreatedAt, Participants: make([]ConferenceParticipant, 0, len(c.members))}
+	for _, p := range c.members {
+		status.Participants = append(status.Participants, p.info)
+	}
+	return status
+}
+
+// participant returns the member with an ID. c.mu must be held.
+func (c *Conference) participant(id string) *participant {
+	for _, p := range c.members {
+		if p.info.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// SetMuted leaves a participant out of the mix the others hear, or puts
+// it back
+func (c *Conference) SetMuted(id string, muted bool) (ConferenceParticipant, error) {
+	c.mu.Lock()
+	p := c.participant(id)
+	if p == nil {
+		c.mu.Unlock()
+		return ConferenceParticipant{}, ErrParticipantNotFound
+	}
+	changed := p.info.Muted != muted
+	p.info.Muted = muted
+	info := p.info
+	c.mu.Unlock()
+
+	if changed {
+		action := ConferenceUnmuted
+		if muted {
+			action = ConferenceMuted
+		}
+		c.publish(action, &info)
+	}
+	return info, nil
+}
+
+// Kick hangs up a participant and removes it from the conference
+func (c *Conference) Kick(ctx context.Context, id string) error {
+	c.mu.Lock()
+	p := c.participant(id)
+	c.mu.Unlock()
+	if p == nil {
+		return ErrParticipantNotFound
+	}
+
+	c.hangUp(ctx, p)
+	c.remove(p, ConferenceLeft)
+	return nil
+}
+
+// Invite calls a registered device of the call's tenant, by extension or
+// username, into the conference. It returns once the INVITE is on its way:
+// the participant rings until the device answers or declines.
+func (c *Conference) Invite(ctx context.Context, target string) (ConferenceParticipant, error) {
+	s := c.m.server
+	if s.client == nil {
+		return ConferenceParticipant{}, ErrConferenceUnavailable
+	}
+	c.mu.Lock()
+	full := len(c.members) >= c.m.max
+	finished := c.finished
+	c.mu.Unlock()
+	if finished {
+		return ConferenceParticipant{}, ErrNotConference
+	}
+	if full {
+		return ConferenceParticipant{}, ErrConferenceFull
+	}
+
+	device, err := c.inviteTarget(ctx, target)
+	if err != nil {
+		return ConferenceParticipant{}, err
+	}
+	reg, err := s.registrar.GetRegistration(ctx, device.ID)
+	if err != nil {
+		return ConferenceParticipant{}, ErrDeviceNotRegistered
+	}
+	var uri sip.Uri
+	if err := sip.ParseUri(strings.Trim(reg.Contact, "<>"), &uri); err != nil {
+		return ConferenceParticipant{}, fmt.Errorf("invalid contact %q: %w", reg.Contact, err)
+	}
+	host := reg.IPAddress
+	if host == "" {
+		host = uri.Host
+	}
+
+	rtpConn, rtcpConn, err := c.m.relay.ports.listenPair()
+	if err != nil {
+		return ConferenceParticipant{}, err
+	}
+	ip := c.m.relay.mediaIP(host)
+	offer := mediaSDP("sendrecv", s.deviceCodecs, sdpTelephoneEvent, ip, rtpConn.LocalAddr().(*net.UDPAddr).Port)
+
+	c.mu.Lock()
+	if c.finished || len(c.members) >= c.m.max {
+		c.mu.Unlock()
+		rtpConn.Close()
+		rtcpConn.Close()
+		if c.finished {
+			return ConferenceParticipant{}, ErrNotConference
+		}
+		return ConferenceParticipant{}, ErrConferenceFull
+	}
+	p := c.newParticipant(ConferenceLegInvited, device.Name)
+	p.callID = sip.GenerateTagN(16) + "@gosip"
+	p.rtp, p.rtcp = rtpConn, rtcpConn
+	p.payloads = make(payloadNames)
+	ringCtx, cancel := context.WithTimeout(context.Background(), config.DeviceRingTimeout)
+	p.cancel = cancel
+	info := p.info
+	c.mu.Unlock()
+
+	c.m.mu.Lock()
+	c.m.invited[p.callID] = c
+	c.m.mu.Unlock()
+
+	// The device reaches GoSIP on the address its media goes to
+	contact := sip.ContactHeader{
+		Address: sip.Uri{User: "conference", Host: ip.String(), Port: s.cfg.Port, UriParams: sip.NewParams(), Headers: sip.NewParams()},
+		Params:  sip.NewParams(),
+	}
+	invite := sip.NewRequest(sip.INVITE, uri)
+	from := &sip.FromHeader{DisplayName: "Conference", Address: contact.Address, Params: sip.NewParams()}
+	from.Params.Add("tag", sip.GenerateTagN(16))
+	invite.AppendHeader(from)
+	invite.AppendHeader(&sip.ToHeader{
+		Address: sip.Uri{User: device.Username, Host: s.client.GetHostname(), UriParams: sip.NewParams(), Headers: sip.NewParams()},
+		Params:  sip.NewParams(),
+	})
+	callID := sip.CallIDHeader(p.callID)
+	invite.AppendHeader(&callID)
+	invite.AppendHeader(sip.NewHeader("Content-Type", "application/sdp"))
+	invite.SetBody(offer)
+	if reg.Transport != "" {
+		invite.SetTransport(strings.ToUpper(reg.Transport))
+	}
+
+	go c.ring(ringCtx, p, sipgo.NewDialogClient(s.client, contact), invite)
+	slog.Info("Inviting device to conference", "call_id", c.CallID, "device_id", device.ID, "participant", info.ID)
+	c.publish(ConferenceInvited, &info)
+	return info, nil
+}
+
+// ring sends an invited participant's INVITE and waits for the device to
+// answer, adding it to the mix when it does
+func (c *Conference) ring(ctx context.Context, p *participant, dialogs *sipgo.DialogClient, invite *sip.Request) {
+	defer p.cancel()
+
+	s := c.m.server
+	s.trace.Record(TraceOut, invite)
+	dialog, err := dialogs.WriteInvite(ctx, invite)
+	if err == nil {
+		err = dialog.WaitAnswer(ctx, sipgo.AnswerOptions{})
+	}
+	if err == nil {
+		s.trace.Record(TraceIn, dialog.InviteResponse)
+		err = dialog.Ack(ctx)
+	}
+	if err != nil {
+		slog.Info("Conference invite failed", "error", err, "call_id", c.CallID, "participant", p.info.ID)
+		c.remove(p, ConferenceDeclined)
+		return
+	}
+
+	answer := dialog.InviteResponse.Body()
+	audio := parseSDPAudio(answer)
+
+	c.mu.Lock()
+	if c.participant(p.info.ID) == nil {
+		// Kicked or the conference ended while it rang
+		c.mu.Unlock()
+		dialog.Bye(context.Background())
+		return
+	}
+	now := time.Now()
+	p.dialog = dialog
+	p.info.State = ParticipantJoined
+	p.info.JoinedAt = &now
+	p.payloads.learn(answer)
+	if audio != nil {
+		if ip := net.ParseIP(audio.address); ip != nil && audio.port > 0 {
+			p.dest = &net.UDPAddr{IP: ip, Port: audio.port}
+		}
+		// The device hears the first codec of its answer until it sends
+		for _, pt := range audio.formats {
+			if name := p.payloads[parsePayloadType(pt)]; name != "" {
+				p.setEncoding(name, parsePayloadType(pt))
+				break
+			}
+		}
+	}
+	info := p.info
+	c.mu.Unlock()
+
+	go c.readInvited(p)
+	slog.Info("Device joined conference", "call_id", c.CallID, "participant", info.ID, "codec", info.Codec)
+	c.publish(ConferenceJoined, &info)
+}
+
+// parsePayloadType reads an SDP format as an RTP payload type, or 255
+func parsePayloadType(format string) uint8 {
+	pt, err := strconv.Atoi(format)
+	if err != nil || pt < 0 || pt > 127 {
+		return 255
+	}
+	return uint8(pt)
+}
+
+// readInvited takes the audio an invited participant sends, following
+// where its packets come from like the relay does
+func (c *Conference) readInvited(p *participant) {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := p.rtp.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if n < 12 || buf[0]&0xc0 != 0x80 || isRTCP(buf[:n]) {
+			continue
+		}
+
+		c.mu.Lock()
+		if !p.latched {
+			p.dest, p.latched = addr, true
+		} else if !addrEqual(p.dest, addr) {
+			c.mu.Unlock()
+			continue
+		}
+		encoding := p.payloads.encoding(buf[:n])
+		c.mu.Unlock()
+
+		if encoding != "" {
+			c.receive(p, encoding, buf[:n])
+		}
+	}
+}
+
+// media and ended make the conference the mixer of the escalated call
+func (c *Conference) media(fromCaller bool, encoding string, packet []byte) {
+	p := c.callee
+	if fromCaller {
+		p = c.caller
+	}
+	c.receive(p, encoding, packet)
+}
+
+func (c *Conference) ended() {
+	c.mu.Lock()
+	c.callClosed = true
+	c.mu.Unlock()
+	c.remove(c.caller, ConferenceLeft)
+	c.remove(c.callee, ConferenceLeft)
+}
+
+// receive decodes a participant's RTP for the next frame. Packets that
+// aren't audio GoSIP can decode, such as DTMF events, are dropped.
+func (c *Conference) receive(p *participant, encoding string, packet []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.finished {
+		return
+	}
+
+	pcm := p.decoders.decode(encoding, packet)
+	if pcm == nil {
+		return
+	}
+	if pt := packet[1] & 0x7f; p.encoder == nil || p.info.Codec != encoding || p.payloadType != pt {
+		p.setEncoding(encoding, pt)
+	}
+	p.pending = append(p.pending, pcm...)
+	if over := len(p.pending) - conferenceBacklog; over > 0 {
+		p.pending = p.pending[over:]
+	}
+}
+
+// setEncoding makes the participant hear the mix in an encoding. c.mu
+// must be held.
+func (p *participant) setEncoding(encoding string, payloadType uint8) {
+	p.info.Codec = encoding
+	p.rtpSender.setEncoding(encoding, payloadType)
+}
+
+// run mixes a frame every 20 ms until the conference ends
+func (c *Conference) run() {
+	ticker := time.NewTicker(conferenceFrame)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.mix()
+		}
+	}
+}
+
+// mix sends every joined participant the next frame of everyone else's
+// audio. Muted participants and those with nothing buffered add silence.
+func (c *Conference) mix() {
+	type outgoing struct {
+		p      *participant
+		dest   *net.UDPAddr
+		packet []byte
+	}
+
+	c.mu.Lock()
+	var total [conferenceSamples]int32
+	frames := make(map[*participant][]int16, len(c.members))
+	for _, p := range c.members {
+		if len(p.pending) < conferenceSamples {
+			continue
+		}
+		frame := p.pending[:conferenceSamples]
+		p.pending = p.pending[conferenceSamples:]
+		if p.info.Muted {
+			continue
+		}
+		frames[p] = frame
+		for i, v := range frame {
+			total[i] += int32(v)
+		}
+	}
+
+	var out []outgoing
+	for _, p := range c.members {
+		if p.info.State != ParticipantJoined || p.encoder == nil {
+			continue
+		}
+		own := frames[p]
+		pcm := make([]int16, conferenceSamples)
+		for i := range pcm {
+			v := total[i]
+			if own != nil {
+				v -= int32(own[i])
+			}
+			pcm[i] = clamp16(v)
+		}
+		packet, err := p.packet(pcm)
+		if err != nil {
+			continue
+		}
+		out = append(out, outgoing{p: p, dest: p.dest, packet: packet})
+	}
+	c.mu.Unlock()
+
+	for _, o := range out {
+		switch {
+		case o.p.info.Leg == ConferenceLegCaller:
+			c.call.sendMedia(true, o.packet)
+		case o.p.info.Leg == ConferenceLegCallee:
+			c.call.sendMedia(false, o.packet)
+		case o.dest != nil:
+			o.p.rtp.WriteToUDP(o.packet, o.dest)
+		}
+	}
+}
+
+// clamp16 limits a mixed sample to 16 bits
+func clamp16(v int32) int16 {
+	if v > 32767 {
+		return 32767
+	}
+	if v < -32768 {
+		return -32768
+	}
+	return int16(v)
+}
+
+// left handles a BYE from a participant, which GoSIP answers rather than
+// passing on: the others stay in the conference
+func (c *Conference) left(p *participant) {
+	c.mu.Lock()
+	dialog := p.dialog
+	c.mu.Unlock()
+	if dialog != nil {
+		dialog.Close()
+	}
+	slog.Info("Participant left conference", "call_id", c.CallID, "participant", p.info.ID)
+	c.remove(p, ConferenceLeft)
+}
+
+// hangUp ends a participant's dialog: the original parties get a BYE as
+// if the other had hung up, ringing devices a CANCEL and joined devices a
+// BYE from GoSIP
+func (c *Conference) hangUp(ctx context.Context, p *participant) {
+	s := c.m.server
+	if p.info.Leg == ConferenceLegInvited {
+		c.mu.Lock()
+		dialog, cancel := p.dialog, p.cancel
+		c.mu.Unlock()
+		if dialog == nil {
+			if cancel != nil {
+				cancel()
+			}
+			return
+		}
+		if err := dialog.Bye(ctx); err != nil {
+			slog.Warn("Failed to hang up conference participant", "error", err, "call_id", c.CallID, "participant", p.info.ID)
+		}
+		return
+	}
+
+	bye := c.call.byeRequest(p.info.Leg == ConferenceLegCaller)
+	if bye == nil || s.client == nil {
+		return
+	}
+	s.trace.Record(TraceOut, bye)
+	res, err := s.requestFinalResponse(ctx, bye)
+	if err != nil {
+		slog.Warn("Failed to hang up conference participant", "error", err, "call_id", c.CallID, "participant", p.info.ID)
+		return
+	}
+	s.trace.Record(TraceIn, res)
+}
+
+// remove takes a participant out of the conference. The escalated call
+// closes once its caller and callee are both gone, and the conference
+// ends when fewer than two participants are left.
+func (c *Conference) remove(p *participant, action string) {
+	c.mu.Lock()
+	i := -1
+	for j, m := range c.members {
+		if m == p {
+			i = j
+		}
+	}
+	if i < 0 {
+		c.mu.Unlock()
+		return
+	}
+	c.members = append(c.members[:i:i], c.members[i+1:]...)
+	info := p.info
+	originals := 0
+	for _, m := range c.members {
+		if m.info.Leg != ConferenceLegInvited {
+			originals++
+		}
+	}
+	closeCall := originals == 0 && !c.callClosed
+	if closeCall {
+		c.callClosed = true
+	}
+	end := len(c.members) < 2
+	c.mu.Unlock()
+
+	c.release(p)
+	c.publish(action, &info)
+	if closeCall {
+		c.call.Close()
+	}
+	if end {
+		c.end(true)
+	}
+}
+
+// release frees an invited participant's ports and forgets its INVITE
+func (c *Conference) release(p *participant) {
+	if p.info.Leg != ConferenceLegInvited {
+		return
+	}
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.rtp.Close()
+	p.rtcp.Close()
+
+	c.m.mu.Lock()
+	delete(c.m.invited, p.callID)
+	c.m.mu.Unlock()
+}
+
+// end stops the mix, hanging up the participants left when hangUp is set,
+// and closes the escalated call
+func (c *Conference) end(hangUp bool) {
+	c.mu.Lock()
+	if c.finished {
+		c.mu.Unlock()
+		return
+	}
+	c.finished = true
+	close(c.done)
+	last := c.members
+	c.members = nil
+	// The call may be closing already, and telling the conference so
+	closeCall := !c.callClosed
+	c.callClosed = true
+	c.mu.Unlock()
+
+	c.m.mu.Lock()
+	if c.m.conferences[c.CallID] == c {
+		delete(c.m.conferences, c.CallID)
+	}
+	c.m.mu.Unlock()
+
+	if hangUp {
+		ctx, cancel := context.WithTimeout(context.Background(), config.CallSetupTimeout)
+		defer cancel()
+		for _, p := range last {
+			c.hangUp(ctx, p)
+		}
+	}
+	for _, p := range last {
+		c.release(p)
+	}
+	if closeCall {
+		c.call.Close()
+	}
+
+	slog.Info("Conference ended", "call_id", c.CallID)
+	c.publish(ConferenceEnded, nil)
+}
+
+// publish reports a conference change on the event stream
+func (c *Conference) publish(action string, p *ConferenceParticipant) {
+	s := c.m.server
+	s.mu.RLock()
+	hub := s.events
+	s.mu.RUnlock()
+	hub.Publish(events.TypeCallConference, ConferenceEvent{CallID: c.CallID, Action: action, Participant: p})
+}
+
+// StartConference escalates an answered call whose media GoSIP relays to
+// a conference of its caller and callee, who then hear each other through
+// the mix
+func (s *Server) StartConference(callID string) (*Conference, error) {
+	if s.conferences == nil {
+		return nil, ErrConferenceUnavailable
+	}
+	call := s.relay.Call(callID)
+	if call == nil {
+		return nil, ErrCallNotConferenceable
+	}
+	return s.conferences.start(call)
+}
+
+// Conference returns the conference a call was escalated to
+func (s *Server) Conference(callID string) (*Conference, error) {
+	if s.conferences == nil {
+		return nil, ErrConferenceUnavailable
+	}
+	if c := s.conferences.Get(callID); c != nil {
+		return c, nil
+	}
+	return nil, ErrNotConference
+}
+
+// conferenceBye answers a BYE from a conference participant, reporting
+// false when the request isn't from one
+func (s *Server) conferenceBye(req *sip.Request, tx sip.ServerTransaction) bool {
+	if s.conferences == nil {
+		return false
+	}
+	callID := req.CallID().Value()
+
+	c, p := s.conferences.invitedBy(callID)
+	if p == nil {
+		if c = s.conferences.Get(callID); c == nil {
+			return false
+		}
+		p = c.callee
+		if tag, _ := req.From().Params.Get("tag"); tag == c.call.fromTag {
+			p = c.caller
+		}
+	}
+
+	s.sendResponse(tx, req, sip.StatusOK, "OK")
+	c.left(p)
+	return true
+}
@@ -0,0 +1,260 @@
+package sip
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/codec"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+)
+
+// answerInvite is a callee's 200 OK to invite, with its tag and contact
+func answerInvite(invite *sip.Request, contact string) *sip.Response {
+	res := sip.NewResponseFromRequest(invite, sip.StatusOK, "OK", nil)
+	res.To().Params.Add("tag", "callee-tag")
+	res.AppendHeader(sip.NewHeader("Contact", contact))
+	return res
+}
+
+func TestRelayedCall_ByeRequest(t *testing.T) {
+	relay := newTestRelay(t, config.MediaRelayAlways)
+	call, err := relay.NewCall("call-1", "1928301774", "127.0.0.1", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("NewCall failed: %v", err)
+	}
+	call.transport = "UDP"
+	if call.byeRequest(true) != nil {
+		t.Error("Expected no BYE before the call is answered")
+	}
+
+	invite := parseTestInvite(t, "Contact: <sip:desk@192.168.1.20:5060>")
+	call.SetRoute("sip:desk@192.168.1.20:5060", "203.0.113.5:41234", "UDP")
+	call.setDialog(invite, answerInvite(invite, "<sip:kitchen@192.168.1.30:5062>"))
+	call.noteCSeq(false, 7)
+
+	toCallee := call.byeRequest(false)
+	if toCallee.Recipient.String() != "sip:kitchen@192.168.1.30:5062" || toCallee.Destination() != "192.168.1.30:5062" {
+		t.Errorf("Expected the BYE sent to the callee's contact, got %s to %s", toCallee.Recipient.String(), toCallee.Destination())
+	}
+	if tag, _ := toCallee.From().Params.Get("tag"); tag != "1928301774" {
+		t.Errorf("Expected the BYE from the caller, got tag %q", tag)
+	}
+	if tag, _ := toCallee.To().Params.Get("tag"); tag != "callee-tag" {
+		t.Errorf("Expected the BYE to the callee, got tag %q", tag)
+	}
+	if toCallee.CSeq().SeqNo != 314159 || toCallee.CallID().Value() != invite.CallID().Value() {
+		t.Errorf("Expected the caller's dialog, got CSeq %d Call-ID %s", toCallee.CSeq().SeqNo, toCallee.CallID().Value())
+	}
+
+	toCaller := call.byeRequest(true)
+	if toCaller.Destination() != "203.0.113.5:41234" {
+		t.Errorf("Expected the BYE sent where the caller's requests come from, got %s", toCaller.Destination())
+	}
+	if tag, _ := toCaller.From().Params.Get("tag"); tag != "callee-tag" {
+		t.Errorf("Expected the BYE from the callee, got tag %q", tag)
+	}
+	if toCaller.CSeq().SeqNo != 7 {
+		t.Errorf("Expected the callee's last CSeq, got %d", toCaller.CSeq().SeqNo)
+	}
+}
+
+// loudness is the mean amplitude of a PCMU packet's audio
+func loudness(t *testing.T, conn *net.UDPConn) int {
+	t.Helper()
+	buf := make([]byte, 1500)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("Expected the mix, got %v", err)
+	}
+	if buf[1]&0x7f != 0 || n <= 12 {
+		t.Fatalf("Expected PCMU, got payload type %d", buf[1]&0x7f)
+	}
+	total := 0
+	for _, u := range buf[12:n] {
+		s := int(codec.UlawToLinear(u))
+		if s < 0 {
+			s = -s
+		}
+		total += s
+	}
+	return total / (n - 12)
+}
+
+// waitLoudness reads the mix until a packet is loud or quiet
+func waitLoudness(t *testing.T, conn *net.UDPConn, loud bool) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if level := loudness(t, conn); (level > 1000) == loud {
+			return
+		}
+	}
+	t.Fatalf("Expected the mix to turn loud=%v", loud)
+}
+
+func TestConference_Mix(t *testing.T) {
+	database := setupTestDB(t)
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0", MediaRelay: &config.MediaRelayConfig{Mode: config.MediaRelayAlways}}, database)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	t.Cleanup(server.relay.Close)
+	server.client = nil // Nothing to send BYEs to
+	hub := events.NewHub(16)
+	server.SetEventHub(hub)
+	_, published, cancel := hub.Subscribe(0)
+	defer cancel()
+
+	if _, err := server.StartConference("call-1"); !errors.Is(err, ErrCallNotConferenceable) {
+		t.Errorf("Expected ErrCallNotConferenceable for an unknown call, got %v", err)
+	}
+
+	call, err := server.relay.NewCall("call-1", "1928301774", "127.0.0.1", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("NewCall failed: %v", err)
+	}
+	caller, callee := newTestPhone(t), newTestPhone(t)
+	call.Translate(caller.sdp(""), true, true)
+	answer, _ := call.Translate(callee.sdp(""), false, false)
+	toCallee := relayedAddr(t, answer)
+
+	if _, err := server.StartConference("call-1"); !errors.Is(err, ErrCallNotAnswered) {
+		t.Errorf("Expected ErrCallNotAnswered before the answer, got %v", err)
+	}
+	invite := parseTestInvite(t, "Contact: <sip:desk@127.0.0.1:5070>")
+	res := answerInvite(invite, "<sip:kitchen@127.0.0.1:5072>")
+	res.SetBody(callee.sdp(""))
+	call.setDialog(invite, res)
+	call.Answered()
+
+	conf, err := server.StartConference("call-1")
+	if err != nil {
+		t.Fatalf("StartConference failed: %v", err)
+	}
+	if _, err := server.StartConference("call-1"); !errors.Is(err, ErrAlreadyConference) {
+		t.Errorf("Expected ErrAlreadyConference escalating twice, got %v", err)
+	}
+	if got, err := server.Conference("call-1"); err != nil || got != conf {
+		t.Fatalf("Expected the conference found, got %v", err)
+	}
+	status := conf.Status()
+	if len(status.Participants) != 2 || status.Participants[0].Leg != ConferenceLegCaller || status.Participants[1].Name != "+15551234567" {
+		t.Fatalf("Expected the caller and callee as participants, got %+v", status.Participants)
+	}
+	if event := nextEvent(t, published); event.Type != events.TypeCallConference || event.Data.(ConferenceEvent).Action != ConferenceStarted {
+		t.Errorf("Expected the conference start published, got %+v", event)
+	}
+
+	// The callee hears the caller through the mix, and the caller hears
+	// the quiet callee rather than itself
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		loud := string(bytes.Repeat([]byte{0x80}, 160))
+		ticker := time.NewTicker(conferenceFrame)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				caller.rtp.WriteToUDP(rtpPacket(0, loud), toCallee)
+			}
+		}
+	}()
+	waitLoudness(t, callee.rtp, true)
+	if level := loudness(t, caller.rtp); level > 1000 {
+		t.Errorf("Expected the caller not to hear itself, got level %d", level)
+	}
+
+	// Muting the caller leaves it out of the mix
+	p, err := conf.SetMuted("p1", true)
+	if err != nil || !p.Muted {
+		t.Fatalf("SetMuted failed: %v", err)
+	}
+	waitLoudness(t, callee.rtp, false)
+	for i := 0; i < 5; i++ {
+		if level := loudness(t, callee.rtp); level > 1000 {
+			t.Fatalf("Expected silence from the muted caller, got level %d", level)
+		}
+	}
+	if _, err := conf.SetMuted("p9", true); !errors.Is(err, ErrParticipantNotFound) {
+		t.Errorf("Expected ErrParticipantNotFound, got %v", err)
+	}
+
+	// With one party left, the conference and the call end
+	if err := conf.Kick(context.Background(), "p2"); err != nil {
+		t.Fatalf("Kick failed: %v", err)
+	}
+	if _, err := server.Conference("call-1"); !errors.Is(err, ErrNotConference) {
+		t.Errorf("Expected the conference ended, got %v", err)
+	}
+	if server.relay.Call("call-1") != nil {
+		t.Error("Expected the escalated call closed")
+	}
+}
+
+func TestConference_InviteTarget(t *testing.T) {
+	database := setupTestDB(t)
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0", MediaRelay: &config.MediaRelayConfig{Mode: config.MediaRelayAlways}}, database)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	t.Cleanup(server.relay.Close)
+	ctx := context.Background()
+
+	acme := &models.Tenant{Name: "Acme"}
+	if err := database.Tenants.Create(ctx, acme); err != nil {
+		t.Fatalf("Failed to create tenant: %v", err)
+	}
+	ext := "101"
+	desk := &models.Device{Name: "Desk", Username: "desk", PasswordHash: "x", DeviceType: "grandstream", Extension: &ext}
+	acmeDesk := &models.Device{Name: "Acme desk", Username: "acme-desk", PasswordHash: "x", DeviceType: "grandstream", Extension: &ext, TenantID: &acme.ID}
+	acmeLobby := &models.Device{Name: "Acme lobby", Username: "acme-lobby", PasswordHash: "x", DeviceType: "grandstream", TenantID: &acme.ID}
+	for _, d := range []*models.Device{desk, acmeDesk, acmeLobby} {
+		if err := database.Devices.Create(ctx, d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+
+	// A call of an Acme phone invites Acme's devices only
+	session := NewCallSession(parseTestInvite(t, "Max-Forwards: 70"), CallDirectionOutbound)
+	session.DeviceID = acmeLobby.ID
+	server.sessions.Add(session)
+	tenantConf := &Conference{CallID: session.CallID, m: server.conferences}
+	instanceConf := &Conference{CallID: "instance-call", m: server.conferences}
+
+	tests := []struct {
+		name   string
+		conf   *Conference
+		target string
+		want   int64
+	}{
+		{"tenant extension", tenantConf, "101", acmeDesk.ID},
+		{"tenant username", tenantConf, "acme-desk", acmeDesk.ID},
+		{"instance username from a tenant call", tenantConf, "desk", 0},
+		{"instance extension", instanceConf, "101", desk.ID},
+		{"tenant username from an instance call", instanceConf, "acme-lobby", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device, err := tt.conf.inviteTarget(ctx, tt.target)
+			if tt.want == 0 {
+				if !errors.Is(err, ErrConferenceTarget) {
+					t.Errorf("Expected ErrConferenceTarget, got %v, %v", device, err)
+				}
+				return
+			}
+			if err != nil || device.ID != tt.want {
+				t.Errorf("Expected device %d, got %v, %v", tt.want, device, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// Package sip provides remote device actions for GoSIP
+package sip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+)
+
+// Remote device actions, sent to a registered phone as an unsolicited NOTIFY
+const (
+	DeviceActionCheckSync    = "check-sync"    // The phone checks its configuration; many reboot to apply it
+	DeviceActionResync       = "resync"        // Fetch the configuration without rebooting
+	DeviceActionReboot       = "reboot"        // Restart the phone
+	DeviceActionFactoryReset = "factory_reset" // No vendor accepts this over SIP
+)
+
+var (
+	ErrDeviceActionUnknown     = errors.New("unknown device action")
+	ErrDeviceActionUnsupported = errors.New("device action not supported by this vendor")
+	ErrDeviceNotRegistered     = errors.New("device is not registered")
+)
+
+// deviceActionEvents maps vendors to the Event header that triggers each
+// action. Vendors not listed get the Yealink/snom style, which most phones
+// follow.
+var deviceActionEvents = map[string]map[string]string{
+	"cisco": {
+		DeviceActionResync: "resync",
+		DeviceActionReboot: "reboot",
+	},
+	"grandstream": {
+		DeviceActionResync: "resync",
+		DeviceActionReboot: "check-sync",
+	},
+	"polycom": {
+		DeviceActionResync: "check-sync;reboot=false",
+		DeviceActionReboot: "check-sync",
+	},
+	"": {
+		DeviceActionResync: "check-sync;reboot=false",
+		DeviceActionReboot: "check-sync;reboot=true",
+	},
+}
+
+// DeviceActionEvent returns the Event header that triggers an action on a
+// phone of the given vendor
+func DeviceActionEvent(vendor, action string) (string, error) {
+	switch action {
+	case DeviceActionCheckSync:
+		return "check-sync", nil
+	case DeviceActionResync, DeviceActionReboot:
+	case DeviceActionFactoryReset:
+		return "", ErrDeviceActionUnsupported
+	default:
+		return "", ErrDeviceActionUnknown
+	}
+
+	events, ok := deviceActionEvents[strings.ToLower(vendor)]
+	if !ok {
+		events = deviceActionEvents[""]
+	}
+	return events[action], nil
+}
+
+// DeviceActionResult is how a phone answered a remote action
+type DeviceActionResult struct {
+	Action  string `json:"action"`
+	Event   string `json:"event"`
+	Contact string `json:"contact"`
+	Status  int    `json:"status"`
+	Reason  string `json:"reason"`
+	// Accepted is true when the phone answered 2xx. Phones accept an action
+	// before carrying it out.
+	Accepted bool `json:"accepted"`
+}
+
+// SendDeviceAction asks a registered phone to reboot, resync or check its
+// configuration with an out-of-dialog NOTIFY, and returns how it answered.
+// A phone that rejects the NOTIFY is reported in the result, not as an error.
+func (s *Server) SendDeviceAction(ctx context.Context, device *models.Device, action string) (*DeviceActionResult, error) {
+	vendor := ""
+	if device.Vendor != nil {
+		vendor = *device.Vendor
+	}
+	event, err := DeviceActionEvent(vendor, action)
+	if err != nil {
+		return nil, err
+	}
+	if s.client == nil {
+		return nil, fmt.Errorf("SIP client not initialized")
+	}
+	if !s.registrar.IsRegistered(ctx, device.ID) {
+		return nil, ErrDeviceNotRegistered
+	}
+	reg, err := s.registrar.GetRegistration(ctx, device.ID)
+	if err != nil {
+		return nil, ErrDeviceNotRegistered
+	}
+
+	var uri sip.Uri
+	if err := sip.ParseUri(strings.Trim(reg.Contact, "<>"), &uri); err != nil {
+		return nil, fmt.Errorf("invalid contact %q: %w", reg.Contact, err)
+	}
+
+	aor := fmt.Sprintf("sip:%s@%s", device.Username, s.client.GetHostname())
+	req := sip.NewRequest(sip.NOTIFY, uri)
+	req.AppendHeader(sip.NewHeader("From", fmt.Sprintf("<sip:gosip@%s>;tag=%s", s.client.GetHostname(), sip.GenerateTagN(16))))
+	req.AppendHeader(sip.NewHeader("To", fmt.Sprintf("<%s>", aor)))
+	req.AppendHeader(sip.NewHeader("Event", event))
+	req.AppendHeader(sip.NewHeader("Subscription-State", "terminated"))
+
+	res, err := s.requestFinalResponse(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceActionResult{
+		Action:   action,
+		Event:    event,
+		Contact:  reg.Contact,
+		Status:   int(res.StatusCode),
+		Reason:   res.Reason,
+		Accepted: res.IsSuccess(),
+	}, nil
+}
+
+// requestFinalResponse sends an out-of-dialog request and waits for its
+// final response
+func (s *Server) requestFinalResponse(ctx context.Context, req *sip.Request) (*sip.Response, error) {
+	tx, err := s.client.TransactionRequest(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send %s: %w", req.Method, err)
+	}
+	defer tx.Terminate()
+
+	for {
+		select {
+		case res := <-tx.Responses():
+			if res.IsProvisional() {
+				continue
+			}
+			return res, nil
+		case <-tx.Done():
+			return nil, fmt.Errorf("%s transaction terminated without response", req.Method)
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%s timeout: %w", req.Method, ctx.Err())
+		}
+	}
+}
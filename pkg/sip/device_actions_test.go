@@ -0,0 +1,31 @@
+package sip
+
+import "testing"
+
+func TestDeviceActionEvent(t *testing.T) {
+	tests := []struct {
+		vendor string
+		action string
+		want   string
+	}{
+		{"", DeviceActionCheckSync, "check-sync"},
+		{"yealink", DeviceActionResync, "check-sync;reboot=false"},
+		{"yealink", DeviceActionReboot, "check-sync;reboot=true"},
+		{"Cisco", DeviceActionReboot, "reboot"},
+		{"grandstream", DeviceActionResync, "resync"},
+		{"polycom", DeviceActionReboot, "check-sync"},
+	}
+	for _, tt := range tests {
+		got, err := DeviceActionEvent(tt.vendor, tt.action)
+		if err != nil || got != tt.want {
+			t.Errorf("DeviceActionEvent(%q, %q) = %q, %v; want %q", tt.vendor, tt.action, got, err, tt.want)
+		}
+	}
+
+	if _, err := DeviceActionEvent("yealink", DeviceActionFactoryReset); err != ErrDeviceActionUnsupported {
+		t.Errorf("Expected ErrDeviceActionUnsupported, got %v", err)
+	}
+	if _, err := DeviceActionEvent("yealink", "explode"); err != ErrDeviceActionUnknown {
+		t.Errorf("Expected ErrDeviceActionUnknown, got %v", err)
+	}
+}
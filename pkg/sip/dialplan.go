@@ -0,0 +1,74 @@
+// Package sip provides the dial plan GoSIP provisions phones with
+package sip
+
+import (
+	"sort"
+	"strings"
+)
+
+// DialPlan is the numbering plan the server interprets dialed digits with.
+// Phones are provisioned with digit maps generated from it, so they send
+// internal numbers as soon as they're complete and wait for the rest of
+// anything else.
+type DialPlan struct {
+	Extensions      []string // Assigned internal extensions
+	FeatureCodes    []string // Codes the server handles, e.g. "*97"
+	IntercomPrefix  string   // Dialed before an extension for an intercom call
+	DIDSelectPrefix string   // Dialed with a DID position before a number
+}
+
+// DialNow returns the numbers phones should dial as soon as they're
+// entered: extensions, intercom calls to them and feature codes. A number
+// that begins a longer one is left out so phones wait for the rest.
+func (p DialPlan) DialNow() []string {
+	var numbers []string
+	for _, ext := range p.Extensions {
+		numbers = append(numbers, ext)
+		if p.IntercomPrefix != "" {
+			numbers = append(numbers, p.IntercomPrefix+ext)
+		}
+	}
+	numbers = append(numbers, p.FeatureCodes...)
+	sort.Strings(numbers)
+
+	var unique []string
+	for i, n := range numbers {
+		if n != "" && (i == 0 || n != numbers[i-1]) {
+			unique = append(unique, n)
+		}
+	}
+
+	var now []string
+	for i, n := range unique {
+		if p.DIDSelectPrefix != "" && strings.HasPrefix(p.DIDSelectPrefix, n) {
+			continue
+		}
+		// Sorted, so a longer number starting with n comes right after it
+		if i+1 < len(unique) && strings.HasPrefix(unique[i+1], n) {
+			continue
+		}
+		now = append(now, n)
+	}
+	return now
+}
+
+// DigitMap returns the dial plan in a vendor's digit map syntax. Grandstream
+// phones take a braced list with x+ for any number of digits; Polycom,
+// Yealink and other phones take MGCP-style maps where T waits for the
+// inter-digit timeout.
+func (p DialPlan) DigitMap(vendor string) string {
+	rules := p.DialNow()
+	if strings.ToLower(vendor) == "grandstream" {
+		if p.DIDSelectPrefix != "" {
+			rules = append(rules, p.DIDSelectPrefix+"x+")
+		}
+		rules = append(rules, "*x+", `\+x+`, "x+")
+		return "{ " + strings.Join(rules, " | ") + " }"
+	}
+
+	if p.DIDSelectPrefix != "" {
+		rules = append(rules, p.DIDSelectPrefix+"xx.T")
+	}
+	rules = append(rules, "*xx.T", "xx.T")
+	return strings.Join(rules, "|")
+}
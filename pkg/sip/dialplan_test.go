@@ -0,0 +1,34 @@
+package sip
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDialPlan(t *testing.T) {
+	plan := DialPlan{
+		Extensions:      []string{"201", "101", "1012"},
+		FeatureCodes:    []string{"*97", "*5"},
+		IntercomPrefix:  "*80",
+		DIDSelectPrefix: "*5",
+	}
+
+	// 101 begins extension 1012, and *5 begins every DID selection
+	want := []string{"*801012", "*80201", "*97", "1012", "201"}
+	if got := plan.DialNow(); !reflect.DeepEqual(got, want) {
+		t.Errorf("DialNow() = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		vendor string
+		want   string
+	}{
+		{"grandstream", `{ *801012 | *80201 | *97 | 1012 | 201 | *5x+ | *x+ | \+x+ | x+ }`},
+		{"yealink", "*801012|*80201|*97|1012|201|*5xx.T|*xx.T|xx.T"},
+	}
+	for _, tt := range tests {
+		if got := plan.DigitMap(tt.vendor); got != tt.want {
+			t.Errorf("DigitMap(%q) = %q, want %q", tt.vendor, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Package sip provides History-Info and Diversion header support for GoSIP
+package sip
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// DiversionReason describes why a call was redirected (RFC 5806)
+type DiversionReason string
+
+const (
+	DiversionUnconditional DiversionReason = "unconditional"
+	DiversionUserBusy      DiversionReason = "user-busy"
+	DiversionNoAnswer      DiversionReason = "no-answer"
+	DiversionDeflection    DiversionReason = "deflection"
+)
+
+// historyInfoCause maps a diversion reason to the cause URI parameter
+// defined by RFC 4458 for History-Info entries
+func historyInfoCause(reason DiversionReason) int {
+	switch reason {
+	case DiversionUserBusy:
+		return 486
+	case DiversionNoAnswer:
+		return 408
+	case DiversionDeflection:
+		return 480
+	default:
+		return 302
+	}
+}
+
+// AddDiversion records that the request was diverted away from divertedFrom.
+// The newest Diversion header is placed first and its counter reflects how
+// many diversions the call has already been through.
+func AddDiversion(req *sip.Request, divertedFrom string, reason DiversionReason) {
+	counter := len(req.GetHeaders("Diversion")) + 1
+	value := fmt.Sprintf("<%s>;reason=%s;counter=%d", divertedFrom, reason, counter)
+	req.PrependHeader(sip.NewHeader("Diversion", value))
+}
+
+// AddHistoryInfo appends History-Info entries (RFC 7044) recording that the
+// request was retargeted from original to target. When the request carries
+// no History-Info yet, an entry for original is added first.
+func AddHistoryInfo(req *sip.Request, original, target string, reason DiversionReason) {
+	indexes := historyInfoIndexes(req)
+	if len(indexes) == 0 {
+		req.AppendHeader(sip.NewHeader("History-Info", fmt.Sprintf("<%s>;index=1", original)))
+		indexes = []string{"1"}
+	}
+
+	// The retargeted entry is a child of the most recent entry
+	index := indexes[len(indexes)-1] + ".1"
+	value := fmt.Sprintf("<%s;cause=%d>;index=%s", target, historyInfoCause(reason), index)
+	req.AppendHeader(sip.NewHeader("History-Info", value))
+}
+
+// DiversionChain returns the user parts of the numbers the request was
+// diverted through, original called number first and the current target
+// last. History-Info is preferred; Diversion headers are used otherwise.
+func DiversionChain(req *sip.Request) []string {
+	var chain []string
+
+	if history := historyInfoTargets(req); len(history) > 0 {
+		for _, uri := range history {
+			chain = appendChain(chain, uriUser(uri))
+		}
+	} else {
+		// Diversion headers are newest first
+		diversions := diversionTargets(req)
+		if len(diversions) == 0 {
+			return nil
+		}
+		for i := len(diversions) - 1; i >= 0; i-- {
+			chain = appendChain(chain, uriUser(diversions[i]))
+		}
+	}
+
+	return appendChain(chain, req.Recipient.User)
+}
+
+// appendChain adds number to chain unless it repeats the previous entry
+func appendChain(chain []string, number string) []string {
+	if number == "" || (len(chain) > 0 && chain[len(chain)-1] == number) {
+		return chain
+	}
+	return append(chain, number)
+}
+
+// diversionTargets returns the URIs in Diversion headers, newest first
+func diversionTargets(req *sip.Request) []string {
+	var targets []string
+	for _, h := range req.GetHeaders("Diversion") {
+		for _, entry := range strings.Split(h.Value(), ",") {
+			start := strings.Index(entry, "<")
+			end := strings.Index(entry, ">")
+			if start < 0 || end <= start {
+				continue
+			}
+			targets = append(targets, entry[start+1:end])
+		}
+	}
+	return targets
+}
+
+// historyInfoIndexes returns the index parameter of each History-Info entry
+func historyInfoIndexes(req *sip.Request) []string {
+	var indexes []string
+	for _, h := range req.GetHeaders("History-Info") {
+		for _, entry := range strings.Split(h.Value(), ",") {
+			end := strings.Index(entry, ">")
+			if end < 0 {
+				continue
+			}
+			for _, param := range strings.Split(entry[end+1:], ";") {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "index=") {
+					indexes = append(indexes, strings.TrimPrefix(param, "index="))
+				}
+			}
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,73 @@
+package sip
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddHistoryInfo(t *testing.T) {
+	req := parseTestInvite(t)
+
+	AddHistoryInfo(req, "sip:+15551234567@gosip.local", "sip:+15557654321@gosip.local", DiversionUnconditional)
+	AddHistoryInfo(req, "sip:+15557654321@gosip.local", "sip:+15550001111@gosip.local", DiversionNoAnswer)
+
+	headers := req.GetHeaders("History-Info")
+	if len(headers) != 3 {
+		t.Fatalf("Expected 3 History-Info headers, got %d", len(headers))
+	}
+	want := []string{
+		"<sip:+15551234567@gosip.local>;index=1",
+		"<sip:+15557654321@gosip.local;cause=302>;index=1.1",
+		"<sip:+15550001111@gosip.local;cause=408>;index=1.1.1",
+	}
+	for i, h := range headers {
+		if h.Value() != want[i] {
+			t.Errorf("History-Info[%d] = %s, want %s", i, h.Value(), want[i])
+		}
+	}
+}
+
+func TestAddDiversion(t *testing.T) {
+	req := parseTestInvite(t)
+
+	AddDiversion(req, "sip:+15552223333@carrier.example", DiversionUserBusy)
+	AddDiversion(req, "sip:+15557654321@gosip.local", DiversionUnconditional)
+
+	headers := req.GetHeaders("Diversion")
+	if len(headers) != 2 {
+		t.Fatalf("Expected 2 Diversion headers, got %d", len(headers))
+	}
+	if headers[0].Value() != "<sip:+15557654321@gosip.local>;reason=unconditional;counter=2" {
+		t.Errorf("Newest Diversion should be first, got %s", headers[0].Value())
+	}
+}
+
+func TestDiversionChain_HistoryInfo(t *testing.T) {
+	req := parseTestInvite(t,
+		"History-Info: <sip:+15557654321@gosip.local>;index=1, <sip:+15551234567@gosip.local;cause=302>;index=1.1",
+	)
+
+	chain := DiversionChain(req)
+	if strings.Join(chain, ",") != "+15557654321,+15551234567" {
+		t.Errorf("Unexpected chain: %v", chain)
+	}
+}
+
+func TestDiversionChain_Diversion(t *testing.T) {
+	req := parseTestInvite(t,
+		"Diversion: <sip:+15557654321@gosip.local>;reason=no-answer;counter=2",
+		"Diversion: <sip:+15552223333@carrier.example>;reason=unconditional;counter=1",
+	)
+
+	chain := DiversionChain(req)
+	if strings.Join(chain, ",") != "+15552223333,+15557654321,+15551234567" {
+		t.Errorf("Unexpected chain: %v", chain)
+	}
+}
+
+func TestDiversionChain_NotDiverted(t *testing.T) {
+	req := parseTestInvite(t)
+	if chain := DiversionChain(req); chain != nil {
+		t.Errorf("Expected nil chain, got %v", chain)
+	}
+}
@@ -0,0 +1,374 @@
+package sip
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/emiago/sipgo/sip"
+	"github.com/pion/rtp"
+)
+
+// Phones signal the keys pressed during calls as RTP telephone-events (RFC
+// 4733, which replaced RFC 2833) or in SIP INFO requests. GoSIP reports
+// the digits of calls whose media or signalling passes through it, and can
+// send digits into calls whose media it relays, e.g. to drive an IVR.
+
+// How DTMF digits are signalled
+const (
+	DTMFMethodRTP  = "rtp"
+	DTMFMethodInfo = "info"
+)
+
+// DTMF errors
+var (
+	ErrInvalidDTMF      = errors.New("digits must be 0-9, *, #, or A-D")
+	ErrCallNotDTMF      = errors.New("the call's media doesn't pass through GoSIP")
+	ErrNoTelephoneEvent = errors.New("the party doesn't take RTP telephone-events")
+)
+
+// dtmfDigits are the digits of telephone-events 0 to 15
+const dtmfDigits = "0123456789*#ABCD"
+
+// telephoneEvent is the encoding name of RTP DTMF
+const telephoneEvent = "telephone-event"
+
+// dtmfClockRate is the RTP clock of telephone-events. Phones offer them at
+// the 8 kHz of narrowband audio.
+const dtmfClockRate = 8000
+
+// DTMFEvent is a key pressed on a call, as reported on the event stream
+type DTMFEvent struct {
+	CallID     string `json:"call_id"`
+	Digit      string `json:"digit"`
+	Duration   int    `json:"duration,omitempty"` // Milliseconds the key was held, when known
+	FromCaller bool   `json:"from_caller"`        // Pressed by the caller rather than the callee
+	Method     string `json:"method"`             // "rtp" or "info"
+	DeviceID   int64  `json:"device_id,omitempty"`
+}
+
+// ValidDTMF reports whether digits are all DTMF digits. Letters may be
+// either case.
+func ValidDTMF(digits string) bool {
+	if digits == "" {
+		return false
+	}
+	for _, d := range strings.ToUpper(digits) {
+		if !strings.ContainsRune(dtmfDigits, d) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseDTMFInfo returns the digit a SIP INFO request carries, and how many
+// milliseconds it was held when given. application/dtmf-relay bodies have
+// "Signal=5" and "Duration=160" lines, and application/dtmf bodies just
+// the digit. Some phones send * and # as signals 10 and 11.
+func ParseDTMFInfo(req *sip.Request) (digit string, duration int, ok bool) {
+	contentType := ""
+	if h := req.ContentType(); h != nil {
+		contentType, _, _ = strings.Cut(h.Value(), ";")
+	}
+	body := strings.TrimSpace(string(req.Body()))
+
+	switch strings.ToLower(strings.TrimSpace(contentType)) {
+	case "application/dtmf-relay":
+		for _, line := range strings.Split(body, "\n") {
+			key, value, found := strings.Cut(line, "=")
+			if !found {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "signal":
+				digit = value
+			case "duration":
+				duration, _ = strconv.Atoi(value)
+			}
+		}
+	case "application/dtmf":
+		digit = body
+	default:
+		return "", 0, false
+	}
+
+	if n, err := strconv.Atoi(digit); err == nil && n >= 10 && n < len(dtmfDigits) {
+		digit = dtmfDigits[n : n+1]
+	}
+	digit = strings.ToUpper(digit)
+	if len(digit) != 1 || !ValidDTMF(digit) {
+		return "", 0, false
+	}
+	return digit, duration, true
+}
+
+// dtmfDetector reports the digits of a party's telephone-events. A digit's
+// end packet is sent three times, so each event is reported once, by its
+// timestamp.
+type dtmfDetector struct {
+	last    uint32
+	started bool
+}
+
+// detect returns the digit a telephone-event packet ends and how many
+// milliseconds it lasted. ok is false for the packets sent while the key
+// is held, and for repeated end packets.
+func (d *dtmfDetector) detect(packet []byte) (digit string, duration int, ok bool) {
+	var pkt rtp.Packet
+	if err := pkt.Unmarshal(packet); err != nil || len(pkt.Payload) < 4 {
+		return "", 0, false
+	}
+	event, end := pkt.Payload[0], pkt.Payload[1]&0x80 != 0
+	if !end || int(event) >= len(dtmfDigits) || (d.started && pkt.Timestamp == d.last) {
+		return "", 0, false
+	}
+	d.last, d.started = pkt.Timestamp, true
+	samples := binary.BigEndian.Uint16(pkt.Payload[2:4])
+	return dtmfDigits[event : event+1], int(samples) * 1000 / dtmfClockRate, true
+}
+
+// dtmfSender sends digits as telephone-events in an RTP stream of its own
+type dtmfSender struct {
+	payloadType uint8
+	seq         uint16
+	timestamp   uint32
+	ssrc        uint32
+}
+
+// packets returns the telephone-events of a digit held for duration: one
+// every 20 ms with how long it has lasted so far, then the end packet
+// three times. The next digit starts gap after this one ends.
+func (d *dtmfSender) packets(digit byte, duration, gap time.Duration) [][]byte {
+	event := strings.IndexByte(dtmfDigits, digit)
+	total := int(duration.Milliseconds()) * dtmfClockRate / 1000
+	step := dtmfClockRate / 50
+
+	var packets [][]byte
+	for elapsed := step; ; elapsed += step {
+		end := elapsed >= total
+		if end {
+			elapsed = total
+		}
+		// Volume 10 is -10 dBm0, as phones send
+		payload := []byte{byte(event), 10, byte(elapsed >> 8), byte(elapsed)}
+		copies := 1
+		if end {
+			payload[1] |= 0x80
+			copies = 3
+		}
+		for i := 0; i < copies; i++ {
+			pkt := rtp.Packet{
+				Header: rtp.Header{
+					Version:        2,
+					Marker:         len(packets) == 0,
+					PayloadType:    d.payloadType,
+					SequenceNumber: d.seq,
+					Timestamp:      d.timestamp,
+					SSRC:           d.ssrc,
+				},
+				Payload: payload,
+			}
+			d.seq++
+			if b, err := pkt.Marshal(); err == nil {
+				packets = append(packets, b)
+			}
+		}
+		if end {
+			break
+		}
+	}
+	d.timestamp += uint32((duration + gap).Milliseconds()) * dtmfClockRate / 1000
+	return packets
+}
+
+// setDTMFHandler has fn told of the digits either party sends as
+// telephone-events
+func (c *RelayedCall) setDTMFHandler(fn func(fromCaller bool, digit string, duration int)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onDTMF = fn
+}
+
+// telephoneEventType returns the payload type the parties negotiated for
+// telephone-events
+func (c *RelayedCall) telephoneEventType() (uint8, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	found, payloadType := false, uint8(0)
+	for pt, name := range c.payloads {
+		if strings.EqualFold(name, telephoneEvent) && (!found || pt < payloadType) {
+			found, payloadType = true, pt
+		}
+	}
+	return payloadType, found
+}
+
+// sendDTMF plays digits to a party as telephone-events. It returns once
+// they are sent or the call ends.
+func (c *RelayedCall) sendDTMF(toCaller bool, digits string, payloadType uint8) {
+	c.dtmfMu.Lock()
+	defer c.dtmfMu.Unlock()
+
+	sender := dtmfSender{payloadType: payloadType}
+	start := newRTPSender()
+	sender.seq, sender.timestamp, sender.ssrc = start.seq, start.timestamp, start.ssrc
+
+	for i := 0; i < len(digits); i++ {
+		for _, packet := range sender.packets(digits[i], config.DTMFDigitDuration, config.DTMFDigitGap) {
+			c.sendMedia(toCaller, packet)
+			select {
+			case <-c.closed:
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+		select {
+		case <-c.closed:
+			return
+		case <-time.After(config.DTMFDigitGap):
+		}
+	}
+}
+
+// SendDTMF sends digits to one party of an answered call whose media GoSIP
+// relays: the caller when toCaller, otherwise the callee. method is
+// DTMFMethodRTP, DTMFMethodInfo, or "" for RTP when the parties
+// negotiated telephone-events and INFO when they didn't. The digits are
+// sent in the background; SendDTMF returns the method used.
+//
+// INFO requests GoSIP sends take a CSeq in the other party's dialog, so a
+// request that party sends next may be refused as out of order. RTP is
+// preferred for that reason.
+func (s *Server) SendDTMF(callID, digits string, toCaller bool, method string) (string, error) {
+	if !ValidDTMF(digits) {
+		return "", ErrInvalidDTMF
+	}
+	digits = strings.ToUpper(digits)
+
+	var call *RelayedCall
+	if s.relay != nil {
+		call = s.relay.Call(callID)
+	}
+	if call == nil {
+		return "", ErrCallNotDTMF
+	}
+	call.mu.Lock()
+	answered := call.answered && call.invite != nil && call.answer != nil
+	call.mu.Unlock()
+	if !answered {
+		return "", ErrCallNotAnswered
+	}
+
+	payloadType, rtpOK := call.telephoneEventType()
+	switch method {
+	case "":
+		method = DTMFMethodInfo
+		if rtpOK {
+			method = DTMFMethodRTP
+		}
+	case DTMFMethodRTP:
+		if !rtpOK {
+			return "", ErrNoTelephoneEvent
+		}
+	case DTMFMethodInfo:
+	default:
+		return "", fmt.Errorf("unknown DTMF method %q", method)
+	}
+
+	slog.Info("Sending DTMF", "call_id", callID, "digits", len(digits), "to_caller", toCaller, "method", method)
+	if method == DTMFMethodRTP {
+		go call.sendDTMF(toCaller, digits, payloadType)
+	} else {
+		go s.sendDTMFInfo(call, toCaller, digits)
+	}
+	return method, nil
+}
+
+// sendDTMFInfo sends digits to a party as SIP INFO requests, one at a time
+func (s *Server) sendDTMFInfo(call *RelayedCall, toCaller bool, digits string) {
+	call.dtmfMu.Lock()
+	defer call.dtmfMu.Unlock()
+
+	for i := 0; i < len(digits); i++ {
+		req := call.inDialogRequest(sip.INFO, toCaller)
+		if req == nil || s.client == nil {
+			return
+		}
+		req.AppendHeader(sip.NewHeader("Content-Type", "application/dtmf-relay"))
+		req.SetBody([]byte(fmt.Sprintf("Signal=%c\r\nDuration=%d\r\n", digits[i], config.DTMFDigitDuration.Milliseconds())))
+
+		ctx, cancel := context.WithTimeout(context.Background(), config.CallSetupTimeout)
+		s.trace.Record(TraceOut, req)
+		res, err := s.requestFinalResponse(ctx, req)
+		cancel()
+		if err != nil {
+			slog.Warn("Failed to send DTMF", "error", err, "call_id", call.CallID)
+			return
+		}
+		s.trace.Record(TraceIn, res)
+		call.noteCSeq(!toCaller, req.CSeq().SeqNo)
+
+		select {
+		case <-call.closed:
+			return
+		case <-time.After(config.DTMFDigitGap):
+		}
+	}
+}
+
+// publishDTMF reports a key pressed on a call on the event stream
+func (s *Server) publishDTMF(callID string, fromCaller bool, digit string, duration int, method string) {
+	slog.Debug("DTMF received", "call_id", callID, "from_caller", fromCaller, "method", method)
+
+	s.mu.RLock()
+	hub := s.events
+	s.mu.RUnlock()
+	if hub == nil {
+		return
+	}
+
+	event := DTMFEvent{CallID: callID, Digit: digit, Duration: duration, FromCaller: fromCaller, Method: method}
+	if session := s.sessions.Get(callID); session != nil {
+		session.mu.RLock()
+		event.DeviceID = session.DeviceID
+		session.mu.RUnlock()
+	}
+	hub.Publish(events.TypeCallDTMF, event)
+}
+
+// handleInfo processes INFO requests. The digits phones send in them
+// during calls are reported on the event stream, and anchored calls pass
+// them on to the other party.
+func (s *Server) handleInfo(req *sip.Request, tx sip.ServerTransaction) {
+	callID := req.CallID().Value()
+	call := s.anchoredCall(callID)
+	session := s.sessions.Get(callID)
+
+	if digit, duration, ok := ParseDTMFInfo(req); ok && (call != nil || session != nil) {
+		// Calls GoSIP answers itself only hear from the caller
+		fromCaller := true
+		if call != nil {
+			_, fromTag := call.dialog()
+			tag, _ := req.From().Params.Get("tag")
+			fromCaller = tag == fromTag
+		}
+		s.publishDTMF(callID, fromCaller, digit, duration, DTMFMethodInfo)
+	}
+
+	switch {
+	case call != nil:
+		s.relayInDialog(req, tx, call)
+	case session != nil:
+		s.sendResponse(tx, req, sip.StatusOK, "OK")
+	default:
+		s.sendResponse(tx, req, sip.StatusCallTransactionDoesNotExists, "Call/Transaction Does Not Exist")
+	}
+}
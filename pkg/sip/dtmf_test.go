@@ -0,0 +1,245 @@
+package sip
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/emiago/sipgo/sip"
+	"github.com/emiago/sipgo/siptest"
+	"github.com/pion/rtp"
+)
+
+// infoRequest builds an in-dialog INFO from the caller of parseTestInvite
+func infoRequest(t *testing.T, contentType, body string) *sip.Request {
+	t.Helper()
+	req := parseTestInvite(t)
+	req.Method = sip.INFO
+	req.CSeq().MethodName = sip.INFO
+	req.CSeq().SeqNo++
+	req.To().Params.Add("tag", "callee-tag")
+	if contentType != "" {
+		req.AppendHeader(sip.NewHeader("Content-Type", contentType))
+	}
+	req.SetBody([]byte(body))
+	return req
+}
+
+// withTelephoneEvents offers telephone-events on payload type 101
+func withTelephoneEvents(sdp []byte) []byte {
+	out := strings.Replace(string(sdp), "RTP/AVP 0", "RTP/AVP 0 101", 1)
+	return []byte(out + "a=rtpmap:101 telephone-event/8000\r\na=fmtp:101 0-16\r\n")
+}
+
+func TestValidDTMF(t *testing.T) {
+	for digits, want := range map[string]bool{
+		"0123456789*#": true,
+		"abcdABCD":     true,
+		"":             false,
+		"12 3":         false,
+		"1e":           false,
+	} {
+		if got := ValidDTMF(digits); got != want {
+			t.Errorf("ValidDTMF(%q) = %v; want %v", digits, got, want)
+		}
+	}
+}
+
+func TestParseDTMFInfo(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		digit       string
+		duration    int
+		ok          bool
+	}{
+		{"dtmf-relay", "application/dtmf-relay", "Signal=5\r\nDuration=160\r\n", "5", 160, true},
+		{"dtmf-relay spaces", "Application/DTMF-Relay", "Signal= #\nDuration= 250", "#", 250, true},
+		{"numeric star", "application/dtmf-relay", "Signal=10\r\nDuration=100\r\n", "*", 100, true},
+		{"numeric pound", "application/dtmf-relay", "Signal=11\r\n", "#", 0, true},
+		{"dtmf", "application/dtmf", "7", "7", 0, true},
+		{"letter", "application/dtmf", "d", "D", 0, true},
+		{"no signal", "application/dtmf-relay", "Duration=100\r\n", "", 0, false},
+		{"invalid signal", "application/dtmf-relay", "Signal=x\r\n", "", 0, false},
+		{"other body", "application/media_control+xml", "<media_control/>", "", 0, false},
+		{"no body", "", "", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			digit, duration, ok := ParseDTMFInfo(infoRequest(t, tt.contentType, tt.body))
+			if digit != tt.digit || duration != tt.duration || ok != tt.ok {
+				t.Errorf("ParseDTMFInfo() = %q, %d, %v; want %q, %d, %v", digit, duration, ok, tt.digit, tt.duration, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDTMFSender_Packets(t *testing.T) {
+	sender := dtmfSender{payloadType: 101, seq: 65535, timestamp: 1000, ssrc: 42}
+	packets := sender.packets('5', 100*time.Millisecond, 100*time.Millisecond)
+
+	// Four packets while the key is held, then the end three times
+	if len(packets) != 7 {
+		t.Fatalf("Expected 7 packets, got %d", len(packets))
+	}
+	var detector dtmfDetector
+	detected := 0
+	for i, packet := range packets {
+		var pkt rtp.Packet
+		if err := pkt.Unmarshal(packet); err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		if pkt.PayloadType != 101 || pkt.Timestamp != 1000 || pkt.Marker != (i == 0) || pkt.Payload[0] != 5 {
+			t.Errorf("Unexpected packet %d: %+v", i, pkt.Header)
+		}
+		if end := pkt.Payload[1]&0x80 != 0; end != (i >= 4) {
+			t.Errorf("Expected packet %d end bit %v", i, i >= 4)
+		}
+		if digit, duration, ok := detector.detect(packet); ok {
+			detected++
+			if digit != "5" || duration != 100 {
+				t.Errorf("Expected 5 held for 100 ms, got %q for %d ms", digit, duration)
+			}
+		}
+	}
+	if detected != 1 {
+		t.Errorf("Expected the digit detected once, got %d", detected)
+	}
+
+	// The next digit starts after this one and the gap, continuing the stream
+	next := sender.packets('#', 100*time.Millisecond, 100*time.Millisecond)
+	var pkt rtp.Packet
+	if err := pkt.Unmarshal(next[0]); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if pkt.Timestamp != 1000+1600 || pkt.SequenceNumber != 6 || pkt.Payload[0] != 11 {
+		t.Errorf("Unexpected next digit %+v, event %d", pkt.Header, pkt.Payload[0])
+	}
+	if digit, _, ok := detector.detect(next[len(next)-1]); !ok || digit != "#" {
+		t.Errorf("Expected # detected, got %q", digit)
+	}
+}
+
+func TestServer_DTMF(t *testing.T) {
+	database := setupTestDB(t)
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0", MediaRelay: &config.MediaRelayConfig{Mode: config.MediaRelayAlways}}, database)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	t.Cleanup(server.relay.Close)
+	hub := events.NewHub(16)
+	server.SetEventHub(hub)
+	_, published, cancel := hub.Subscribe(0)
+	defer cancel()
+
+	if _, err := server.SendDTMF("call-1", "12x", false, ""); !errors.Is(err, ErrInvalidDTMF) {
+		t.Errorf("Expected ErrInvalidDTMF, got %v", err)
+	}
+	if _, err := server.SendDTMF("call-1", "1", false, ""); !errors.Is(err, ErrCallNotDTMF) {
+		t.Errorf("Expected ErrCallNotDTMF for an unknown call, got %v", err)
+	}
+
+	call, err := server.relay.NewCall("call-1", "1928301774", "127.0.0.1", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("NewCall failed: %v", err)
+	}
+	call.setDTMFHandler(func(fromCaller bool, digit string, duration int) {
+		server.publishDTMF(call.CallID, fromCaller, digit, duration, DTMFMethodRTP)
+	})
+	caller, callee := newTestPhone(t), newTestPhone(t)
+	offer, _ := call.Translate(caller.sdp(""), true, true)
+	answer, _ := call.Translate(callee.sdp(""), false, false)
+	toCallee, toCaller := relayedAddr(t, answer), relayedAddr(t, offer)
+
+	if _, err := server.SendDTMF("call-1", "1", false, ""); !errors.Is(err, ErrCallNotAnswered) {
+		t.Errorf("Expected ErrCallNotAnswered before the answer, got %v", err)
+	}
+	invite := parseTestInvite(t, "Contact: <sip:desk@127.0.0.1:5070>")
+	call.setDialog(invite, answerInvite(invite, "<sip:kitchen@127.0.0.1:5072>"))
+	call.Answered()
+
+	// Without telephone-events only INFO can carry digits
+	if _, err := server.SendDTMF("call-1", "1", false, DTMFMethodRTP); !errors.Is(err, ErrNoTelephoneEvent) {
+		t.Errorf("Expected ErrNoTelephoneEvent, got %v", err)
+	}
+	if _, err := server.SendDTMF("call-1", "1", false, "inband"); err == nil {
+		t.Error("Expected an unknown method refused")
+	}
+
+	// The caller's telephone-events reach the callee and are reported once
+	call.Translate(withTelephoneEvents(caller.sdp("")), true, true)
+	call.Translate(withTelephoneEvents(callee.sdp("")), false, false)
+	sender := dtmfSender{payloadType: 101, timestamp: 8000, ssrc: 7}
+	for _, packet := range sender.packets('9', 100*time.Millisecond, 0) {
+		caller.rtp.WriteToUDP(packet, toCallee)
+	}
+	event := nextEvent(t, published)
+	if dtmf, ok := event.Data.(DTMFEvent); event.Type != events.TypeCallDTMF || !ok ||
+		dtmf.Digit != "9" || !dtmf.FromCaller || dtmf.Method != DTMFMethodRTP || dtmf.Duration != 100 {
+		t.Errorf("Expected the caller's 9 published, got %+v", event)
+	}
+	select {
+	case event := <-published:
+		t.Errorf("Expected the digit reported once, got %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Digits sent to the caller go on its telephone-event payload type
+	callee.rtp.WriteToUDP(rtpPacket(0, "hello"), toCaller)
+	expect(t, caller.rtp, "hello")
+	method, err := server.SendDTMF("call-1", "#", true, "")
+	if err != nil || method != DTMFMethodRTP {
+		t.Fatalf("Expected the digits sent over RTP, got %q: %v", method, err)
+	}
+	buf := make([]byte, 1500)
+	caller.rtp.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := caller.rtp.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("Expected a telephone-event, got %v", err)
+	}
+	var pkt rtp.Packet
+	if err := pkt.Unmarshal(buf[:n]); err != nil || pkt.PayloadType != 101 || !pkt.Marker || pkt.Payload[0] != 11 {
+		t.Errorf("Expected the start of #, got %+v: %v", pkt.Header, err)
+	}
+	call.Close()
+}
+
+func TestServer_HandleInfo(t *testing.T) {
+	database := setupTestDB(t)
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0"}, database)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	hub := events.NewHub(16)
+	server.SetEventHub(hub)
+	_, published, cancel := hub.Subscribe(0)
+	defer cancel()
+
+	// INFO outside a call is refused
+	req := infoRequest(t, "application/dtmf-relay", "Signal=4\r\nDuration=100\r\n")
+	tx := siptest.NewServerTxRecorder(req)
+	server.handleInfo(req, tx)
+	if res := tx.Result(); len(res) != 1 || res[0].StatusCode != sip.StatusCallTransactionDoesNotExists {
+		t.Errorf("Expected 481, got %v", res)
+	}
+
+	// Digits sent on calls GoSIP answers are reported as the caller's
+	session := NewCallSession(parseTestInvite(t), CallDirectionInbound)
+	session.DeviceID = 3
+	server.sessions.Add(session)
+	nextEvent(t, published) // call.started
+	tx = siptest.NewServerTxRecorder(req)
+	server.handleInfo(req, tx)
+	if res := tx.Result(); len(res) != 1 || res[0].StatusCode != sip.StatusOK {
+		t.Errorf("Expected 200, got %v", res)
+	}
+	event := nextEvent(t, published)
+	if dtmf, ok := event.Data.(DTMFEvent); !ok || dtmf.Digit != "4" || dtmf.Duration != 100 ||
+		!dtmf.FromCaller || dtmf.Method != DTMFMethodInfo || dtmf.DeviceID != 3 || dtmf.CallID != session.CallID {
+		t.Errorf("Expected the caller's 4 published, got %+v", event)
+	}
+}
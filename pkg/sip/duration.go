@@ -0,0 +1,107 @@
+// Package sip provides call duration limits for GoSIP
+package sip
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// TrunkMaxDurationHeader carries the duration limit of a route on calls
+// delivered by Twilio, in seconds
+const TrunkMaxDurationHeader = "X-Max-Duration"
+
+// TrunkMaxDuration returns the duration limit requested for a trunk call,
+// or 0 when it has none
+func TrunkMaxDuration(req *sip.Request) int {
+	h := req.GetHeader(TrunkMaxDurationHeader)
+	if h == nil {
+		return 0
+	}
+	seconds, err := strconv.Atoi(strings.TrimSpace(h.Value()))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return seconds
+}
+
+// DurationEnforcer warns connected calls that are about to reach their
+// MaxDuration and ends them once they do
+type DurationEnforcer struct {
+	mu       sync.Mutex
+	sessions *SessionManager
+	warning  time.Duration
+	warned   map[string]bool
+	onWarn   func(*CallSession)
+	onEnd    func(*CallSession)
+}
+
+// NewDurationEnforcer creates a DurationEnforcer. onWarn is called once per
+// call, warning before the limit; onEnd is called when the limit is reached.
+func NewDurationEnforcer(sessions *SessionManager, warning time.Duration, onWarn, onEnd func(*CallSession)) *DurationEnforcer {
+	return &DurationEnforcer{
+		sessions: sessions,
+		warning:  warning,
+		warned:   make(map[string]bool),
+		onWarn:   onWarn,
+		onEnd:    onEnd,
+	}
+}
+
+// Check compares every connected call with its limit at now
+func (e *DurationEnforcer) Check(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	seen := make(map[string]bool)
+	for _, session := range e.sessions.GetAll() {
+		answeredAt := session.AnsweredTime()
+		if session.MaxDuration <= 0 || answeredAt == nil || session.GetState() == CallStateRinging {
+			continue
+		}
+		seen[session.CallID] = true
+
+		elapsed := now.Sub(*answeredAt)
+		limit := time.Duration(session.MaxDuration) * time.Second
+		if elapsed >= limit {
+			e.onEnd(session)
+			continue
+		}
+		if elapsed >= limit-e.warning && !e.warned[session.CallID] {
+			e.warned[session.CallID] = true
+			e.onWarn(session)
+		}
+	}
+
+	// Forget calls that have ended
+	for callID := range e.warned {
+		if !seen[callID] {
+			delete(e.warned, callID)
+		}
+	}
+}
+
+// WarningTone returns three short 1kHz beeps as 8kHz 8-bit audio, played
+// when no warning prompt has been uploaded
+func WarningTone() []byte {
+	const (
+		rate   = 8000
+		beep   = rate / 5 // 200ms
+		gap    = rate / 5
+		volume = 60
+	)
+	var tone []byte
+	for i := 0; i < 3; i++ {
+		for n := 0; n < beep; n++ {
+			tone = append(tone, byte(128+volume*math.Sin(2*math.Pi*1000*float64(n)/rate)))
+		}
+		for n := 0; i < 2 && n < gap; n++ {
+			tone = append(tone, 128) // Silence
+		}
+	}
+	return tone
+}
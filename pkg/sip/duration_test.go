@@ -0,0 +1,78 @@
+package sip
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrunkMaxDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		want    int
+	}{
+		{"none", nil, 0},
+		{"limit", []string{"X-Max-Duration: 3600"}, 3600},
+		{"invalid", []string{"X-Max-Duration: forever"}, 0},
+		{"negative", []string{"X-Max-Duration: -5"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := parseTestInvite(t, tt.headers...)
+			if got := TrunkMaxDuration(req); got != tt.want {
+				t.Errorf("TrunkMaxDuration() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDurationEnforcer_Check(t *testing.T) {
+	sessions := NewSessionManager()
+	answered := time.Now()
+
+	limited := &CallSession{CallID: "limited", State: CallStateActive, AnsweredAt: &answered, MaxDuration: 600}
+	unlimited := &CallSession{CallID: "unlimited", State: CallStateActive, AnsweredAt: &answered}
+	ringing := &CallSession{CallID: "ringing", State: CallStateRinging, MaxDuration: 1}
+	sessions.Add(limited)
+	sessions.Add(unlimited)
+	sessions.Add(ringing)
+
+	var warned, ended []string
+	e := NewDurationEnforcer(sessions, time.Minute,
+		func(s *CallSession) { warned = append(warned, s.CallID) },
+		func(s *CallSession) {
+			ended = append(ended, s.CallID)
+			s.SetState(CallStateTerminated)
+		})
+
+	e.Check(answered.Add(8 * time.Minute))
+	if len(warned) != 0 || len(ended) != 0 {
+		t.Fatalf("Expected nothing before the warning, got warned %v ended %v", warned, ended)
+	}
+
+	// The warning plays once, a minute before the limit
+	e.Check(answered.Add(9 * time.Minute))
+	e.Check(answered.Add(9*time.Minute + 30*time.Second))
+	if len(warned) != 1 || warned[0] != "limited" || len(ended) != 0 {
+		t.Fatalf("Expected one warning, got warned %v ended %v", warned, ended)
+	}
+
+	e.Check(answered.Add(10 * time.Minute))
+	if len(ended) != 1 || ended[0] != "limited" {
+		t.Fatalf("Expected the limited call to end, got %v", ended)
+	}
+
+	e.Check(answered.Add(11 * time.Minute))
+	if len(ended) != 1 || len(e.warned) != 0 {
+		t.Errorf("Expected the ended call to be forgotten, got ended %v warned %v", ended, e.warned)
+	}
+}
+
+func TestWarningTone(t *testing.T) {
+	tone := WarningTone()
+	// Three 200ms beeps with two 200ms gaps at 8kHz
+	if len(tone) != 5*1600 {
+		t.Errorf("len(WarningTone()) = %d, want %d", len(tone), 5*1600)
+	}
+}
@@ -0,0 +1,129 @@
+// Package sip provides the internal extension numbering plan for GoSIP
+package sip
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+)
+
+// ValidExtension reports whether ext fits the internal numbering plan:
+// MinExtensionLength to MaxExtensionLength digits
+func ValidExtension(ext string) bool {
+	if len(ext) < config.MinExtensionLength || len(ext) > config.MaxExtensionLength {
+		return false
+	}
+	for _, c := range ext {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// internalDisposition maps the final status of a device-to-device call to a CDR disposition
+func internalDisposition(status sip.StatusCode) string {
+	switch {
+	case status >= 200 && status < 300:
+		return "answered"
+	case status == sip.StatusBusyHere || status == sip.StatusGlobalBusyEverywhere:
+		return "busy"
+	case status == 0 || status == sip.StatusRequestTerminated || status == sip.StatusTemporarilyUnavailable ||
+		status == sip.StatusRequestTimeout || status == sip.StatusGlobalDecline:
+		return "missed"
+	default:
+		return "failed"
+	}
+}
+
+// handleExtensionCall connects an authenticated device's call to another
+// registered device of its tenant when the dialed number is an internal
+// extension. It
+// returns false, leaving the call untouched, when no device has the
+// extension so the number can still be dialed out.
+func (s *Server) handleExtensionCall(ctx context.Context, req *sip.Request, tx sip.ServerTransaction, session *CallSession, caller *models.Device) bool {
+	ext := req.Recipient.User
+	if !ValidExtension(ext) {
+		return false
+	}
+
+	callee, reg, err := s.registrar.ResolveExtension(ctx, caller.TenantID, ext)
+	if errors.Is(err, db.ErrDeviceNotFound) {
+		return false
+	}
+
+	if callee == nil {
+		slog.Error("Failed to resolve extension", "error", err, "call_id", session.CallID, "extension", ext)
+		s.releaseCall(session)
+		s.sendResponse(tx, req, sip.StatusInternalServerError, "Internal Server Error")
+		return true
+	}
+
+	var status sip.StatusCode
+	switch {
+	case callee.ID == caller.ID, s.sessions.IsDeviceBusy(callee.ID) && !callee.CallWaiting:
+		s.releaseCall(session)
+		status = sip.StatusBusyHere
+		s.sendResponse(tx, req, status, "Busy Here")
+
+	case reg == nil:
+		s.releaseCall(session)
+		status = sip.StatusTemporarilyUnavailable
+		s.sendResponse(tx, req, status, "Temporarily Unavailable")
+
+	default:
+		slog.Info("Extension call",
+			"call_id", session.CallID,
+			"caller", caller.Username,
+			"extension", ext,
+			"callee", callee.Username,
+		)
+		alertInfo := session.AlertInfo
+		status = s.forwardToDevice(req, tx, session, reg, func(fwd *sip.Request) {
+			SetAlertInfo(fwd, alertInfo)
+		})
+	}
+
+	s.recordInternalCall(session, caller, ext, status)
+	return true
+}
+
+// recordInternalCall writes the CDR for a device-to-device call. Internal
+// CDRs are excluded from billing statistics. GoSIP leaves the signalling
+// path once the call is answered, so answered calls have no end time.
+func (s *Server) recordInternalCall(session *CallSession, caller *models.Device, ext string, status sip.StatusCode) {
+	from := caller.Username
+	if caller.Extension != nil && *caller.Extension != "" {
+		from = *caller.Extension
+	}
+
+	now := time.Now()
+	cdr := &models.CDR{
+		CallSID:     session.CallID,
+		Direction:   "outbound",
+		FromNumber:  from,
+		ToNumber:    ext,
+		DeviceID:    &caller.ID,
+		StartedAt:   session.CreatedAt,
+		Disposition: internalDisposition(status),
+		Codec:       session.Codec,
+		Internal:    true,
+	}
+	if cdr.Disposition == "answered" {
+		cdr.AnsweredAt = &now
+	} else {
+		cdr.EndedAt = &now
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.CallSetupTimeout)
+	defer cancel()
+	if err := s.db.CDRs.Create(ctx, cdr); err != nil {
+		slog.Warn("Failed to record internal call", "error", err, "call_id", session.CallID)
+	}
+}
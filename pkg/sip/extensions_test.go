@@ -0,0 +1,118 @@
+package sip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+	"github.com/emiago/sipgo/siptest"
+)
+
+func TestValidExtension(t *testing.T) {
+	tests := []struct {
+		ext  string
+		want bool
+	}{
+		{"201", true},
+		{"4001", true},
+		{"123456", true},
+		{"20", false},
+		{"1234567", false},
+		{"2a1", false},
+		{"+15551234567", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidExtension(tt.ext); got != tt.want {
+			t.Errorf("ValidExtension(%q) = %v, want %v", tt.ext, got, tt.want)
+		}
+	}
+}
+
+func TestInternalDisposition(t *testing.T) {
+	tests := []struct {
+		status sip.StatusCode
+		want   string
+	}{
+		{sip.StatusOK, "answered"},
+		{sip.StatusBusyHere, "busy"},
+		{sip.StatusGlobalBusyEverywhere, "busy"},
+		{sip.StatusRequestTerminated, "missed"},
+		{sip.StatusTemporarilyUnavailable, "missed"},
+		{0, "missed"},
+		{sip.StatusServiceUnavailable, "failed"},
+		{sip.StatusForbidden, "failed"},
+	}
+
+	for _, tt := range tests {
+		if got := internalDisposition(tt.status); got != tt.want {
+			t.Errorf("internalDisposition(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestServer_HandleExtensionCall(t *testing.T) {
+	database := setupTestDB(t)
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0"}, database)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	ctx := context.Background()
+
+	callerExt, calleeExt := "201", "202"
+	caller := &models.Device{Name: "Office", Username: "office", PasswordHash: "x", DeviceType: "grandstream", Extension: &callerExt}
+	callee := &models.Device{Name: "Kitchen", Username: "kitchen", PasswordHash: "x", DeviceType: "grandstream", Extension: &calleeExt}
+	for _, d := range []*models.Device{caller, callee} {
+		if err := database.Devices.Create(ctx, d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+
+	newCall := func(user string) (*sip.Request, *siptest.ServerTxRecorder, *CallSession) {
+		req := parseTestInvite(t, "Max-Forwards: 70")
+		req.Recipient.User = user
+		session := NewCallSession(req, CallDirectionOutbound)
+		session.DeviceID = caller.ID
+		server.sessions.Add(session)
+		if err := server.limiter.Acquire(session.CallID, "", caller.ID); err != nil {
+			t.Fatalf("Acquire failed: %v", err)
+		}
+		return req, siptest.NewServerTxRecorder(req), session
+	}
+
+	// Unknown extensions are left for outbound routing
+	req, tx, session := newCall("999")
+	if server.handleExtensionCall(ctx, req, tx, session, caller) {
+		t.Fatal("Expected unknown extension not to be handled")
+	}
+	server.releaseCall(session)
+
+	// The callee exists but has not registered
+	req, tx, session = newCall("202")
+	if !server.handleExtensionCall(ctx, req, tx, session, caller) {
+		t.Fatal("Expected extension call to be handled")
+	}
+	res := tx.Result()
+	if len(res) != 1 || res[0].StatusCode != sip.StatusTemporarilyUnavailable {
+		t.Fatalf("Expected 480 for unregistered extension, got %v", res)
+	}
+	if server.limiter.Active() != 0 {
+		t.Error("Expected extension call to release its limiter slot")
+	}
+
+	cdr, err := database.CDRs.GetByCallSID(ctx, session.CallID)
+	if err != nil {
+		t.Fatalf("Expected CDR for extension call: %v", err)
+	}
+	if !cdr.Internal {
+		t.Error("Expected extension call CDR to be internal")
+	}
+	if cdr.FromNumber != "201" || cdr.ToNumber != "202" {
+		t.Errorf("Expected CDR 201 -> 202, got %s -> %s", cdr.FromNumber, cdr.ToNumber)
+	}
+	if cdr.Disposition != "missed" {
+		t.Errorf("Expected missed disposition, got %s", cdr.Disposition)
+	}
+}
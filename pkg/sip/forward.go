@@ -0,0 +1,219 @@
+// Package sip provides INVITE relaying to registered devices for GoSIP
+package sip
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo"
+	"github.com/emiago/sipgo/sip"
+)
+
+// forwardRequest copies req and retargets it at a registered contact
+func forwardRequest(req *sip.Request, contact string) (*sip.Request, error) {
+	var uri sip.Uri
+	if err := sip.ParseUri(strings.Trim(contact, "<>"), &uri); err != nil {
+		return nil, fmt.Errorf("invalid contact %q: %w", contact, err)
+	}
+
+	// The copy would otherwise go where the original arrived: back to us.
+	// Clone leaves the body behind.
+	fwd := req.Clone()
+	fwd.Recipient = uri
+	fwd.SetDestination(uri.HostPort())
+	fwd.SetBody(req.Body())
+	return fwd, nil
+}
+
+// forwardVia is a client request option that decrements Max-Forwards and
+// adds our Via with the loop detection branch. The port is left for the
+// transport to fill in: the listeners are bound to every interface, so
+// sending from the SIP port on the host address would fail to bind.
+func (s *Server) forwardVia(c *sipgo.Client, r *sip.Request) error {
+	via := &sip.ViaHeader{
+		ProtocolName:    "SIP",
+		ProtocolVersion: "2.0",
+		Transport:       r.Transport(),
+		Host:            c.GetHostname(),
+		Params:          sip.NewParams(),
+	}
+	return PrepareForward(r, via)
+}
+
+// releaseCall removes a call's session and frees its call limit slot
+func (s *Server) releaseCall(session *CallSession) {
+	s.sessions.Remove(session.CallID)
+	s.decrementCallCount()
+	s.limiter.Release(session.CallID)
+}
+
+// forwardToDevice relays an INVITE to a device's registered contact and
+// relays the device's responses back to the caller. prepare, when set, may
+// add headers to the relayed INVITE. The codec the device answers with is
+// kept in session.Codec, and its comfort noise setting and whether it
+// accepted CN in session.ComfortNoise and session.CNNegotiated. It returns the final status sent to the
+// caller, or 0 if the caller gave up first.
+//
+// GoSIP does not Record-Route, so once the call is answered ACK, BYE and
+// re-INVITEs flow directly between the phones; the session and its call
+// limit slot are released when the INVITE transaction completes. Calls
+// whose media GoSIP carries are the exception: see bridgeWebRTC and
+// relayMedia.
+func (s *Server) forwardToDevice(req *sip.Request, tx sip.ServerTransaction, session *CallSession, reg *models.Registration, prepare func(*sip.Request)) sip.StatusCode {
+	callID := session.CallID
+	defer func() {
+		if err := session.SetState(CallStateTerminated); err != nil {
+			slog.Debug("Failed to set terminated state", "error", err, "call_id", callID)
+		}
+		s.releaseCall(session)
+	}()
+
+	if s.client == nil {
+		s.sendResponse(tx, req, sip.StatusServiceUnavailable, "Service Unavailable")
+		return sip.StatusServiceUnavailable
+	}
+
+	fwd, err := forwardRequest(req, reg.Contact)
+	if err != nil {
+		slog.Warn("Cannot relay call to device", "error", err, "call_id", callID, "device_id", reg.DeviceID)
+		s.sendResponse(tx, req, sip.StatusTemporarilyUnavailable, "Temporarily Unavailable")
+		return sip.StatusTemporarilyUnavailable
+	}
+	if prepare != nil {
+		prepare(fwd)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.DeviceRingTimeout)
+	defer cancel()
+
+	// Comfort noise is on unless the device has turned it off
+	session.ComfortNoise = true
+	if device, err := s.db.Devices.GetByID(ctx, reg.DeviceID); err == nil {
+		session.ComfortNoise = device.ComfortNoise
+		session.Record = session.Record || device.RecordingEnabled
+	}
+	// Calls from phones that record their calls are recorded too
+	if session.Direction == CallDirectionOutbound && session.DeviceID != 0 && !session.Record {
+		if caller, err := s.db.Devices.GetByID(ctx, session.DeviceID); err == nil {
+			session.Record = caller.RecordingEnabled
+		}
+	}
+
+	// Put the codecs GoSIP prefers for the call first, so HD phones settle
+	// on wideband audio between themselves
+	if body := fwd.Body(); len(body) > 0 {
+		body = PreferCodecs(body, s.sessionCodecs(session))
+		fwd.SetBody(ApplyComfortNoise(body, session.ComfortNoise))
+	}
+
+	// Calls with browsers go through the WebRTC gateway, and the relay
+	// carries the media of other calls that need it
+	bridge, status, reason := s.bridgeWebRTC(req, fwd, reg)
+	if status != 0 {
+		s.sendResponse(tx, req, status, reason)
+		return status
+	}
+	var anchored anchoredCall
+	if bridge != nil {
+		anchored = bridge
+	} else if call := s.relayMedia(req, fwd, session, reg); call != nil {
+		anchored = call
+	}
+	offered := len(fwd.Body()) > 0
+	answered := false
+	defer func() {
+		if anchored != nil && !answered {
+			anchored.Close()
+		}
+	}()
+
+	s.trace.Record(TraceOut, fwd)
+	clTx, err := s.client.TransactionRequest(ctx, fwd, s.forwardVia)
+	if err != nil {
+		if loopErr, ok := err.(*LoopError); ok {
+			s.rejectLoop(req, tx, loopErr)
+			code, _ := loopErr.StatusCode()
+			return code
+		}
+		slog.Warn("Failed to relay call to device", "error", err, "call_id", callID, "device_id", reg.DeviceID)
+		s.sendResponse(tx, req, sip.StatusTemporarilyUnavailable, "Temporarily Unavailable")
+		return sip.StatusTemporarilyUnavailable
+	}
+	defer clTx.Terminate()
+
+	for {
+		select {
+		case res := <-clTx.Responses():
+			s.trace.Record(TraceIn, res)
+
+			// We already sent 100 Trying to the caller
+			if res.StatusCode == sip.StatusTrying {
+				continue
+			}
+
+			// Strip our Via so the response matches the caller's transaction,
+			// and send it to the caller rather than the address in that Via
+			relayed := res.Clone()
+			relayed.RemoveHeader("Via")
+			relayed.SetDestination(req.Source())
+			if anchored != nil {
+				s.anchorResponse(anchored, relayed, !offered, false)
+			}
+			if err := tx.Respond(relayed); err != nil {
+				slog.Error("Failed to relay response", "error", err, "call_id", callID, "status", res.StatusCode)
+				return 0
+			}
+
+			if res.StatusCode >= 200 {
+				if res.IsSuccess() {
+					if err := session.SetState(CallStateActive); err != nil {
+						slog.Debug("Failed to mark call answered", "error", err, "call_id", callID)
+					}
+					session.Codec = NegotiatedCodec(res.Body())
+					session.CNNegotiated = SDPHasComfortNoise(res.Body())
+					if anchored != nil {
+						answered = true
+						if call, ok := anchored.(*RelayedCall); ok {
+							call.setDialog(fwd, res)
+						}
+						anchored.Answered()
+						s.recordAnswered(session, anchored)
+					}
+				}
+				slog.Info("Device call completed",
+					"call_id", callID,
+					"device_id", reg.DeviceID,
+					"status", res.StatusCode,
+					"codec", session.Codec,
+				)
+				return res.StatusCode
+			}
+
+		case cancelReq := <-tx.Cancels():
+			// The device answers the relayed CANCEL with 487, which we pass on
+			s.sendResponse(tx, cancelReq, sip.StatusOK, "OK")
+			if err := clTx.Cancel(); err != nil {
+				slog.Warn("Failed to cancel relayed call", "error", err, "call_id", callID)
+			}
+
+		case <-clTx.Done():
+			s.sendResponse(tx, req, sip.StatusRequestTimeout, "Request Timeout")
+			return sip.StatusRequestTimeout
+
+		case <-ctx.Done():
+			// The device never answered
+			if err := clTx.Cancel(); err != nil {
+				slog.Warn("Failed to cancel relayed call", "error", err, "call_id", callID)
+			}
+			s.sendResponse(tx, req, sip.StatusTemporarilyUnavailable, "Temporarily Unavailable")
+			return sip.StatusTemporarilyUnavailable
+
+		case <-tx.Done():
+			return 0
+		}
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/events"
 	"github.com/btafoya/gosip/internal/models"
 	"github.com/emiago/sipgo/sip"
 )
@@ -53,6 +56,9 @@ func (s *Server) handleRegister(req *sip.Request, tx sip.ServerTransaction) {
 			s.sendResponse(tx, req, sip.StatusInternalServerError, "Internal Server Error")
 			return
 		}
+		if s.webrtc != nil {
+			s.webrtc.RemoveRoute(contact.Address.String())
+		}
 		slog.Info("Device unregistered", "device", device.Username)
 		s.sendResponse(tx, req, sip.StatusOK, "OK")
 		return
@@ -74,6 +80,11 @@ func (s *Server) handleRegister(req *sip.Request, tx sip.ServerTransaction) {
 		return
 	}
 
+	// Browsers are reached down the WebSocket they registered over
+	if s.webrtc != nil && isWebSocket(reg.Transport) {
+		s.webrtc.SetRoute(reg.Contact, req.Source(), req.Transport(), reg.ExpiresAt)
+	}
+
 	slog.Info("Device registered",
 		"device", device.Username,
 		"contact", contact.Address.String(),
@@ -83,7 +94,7 @@ func (s *Server) handleRegister(req *sip.Request, tx sip.ServerTransaction) {
 	// Send 200 OK
 	res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
 	res.AppendHeader(sip.NewHeader("Contact", contact.Value()))
-	res.AppendHeader(sip.NewHeader("Expires", string(rune(expires))))
+	res.AppendHeader(sip.NewHeader("Expires", strconv.Itoa(expires)))
 
 	if err := tx.Respond(res); err != nil {
 		slog.Error("Failed to send REGISTER response", "error", err)
@@ -103,6 +114,13 @@ func (s *Server) handleInvite(req *sip.Request, tx sip.ServerTransaction) {
 		"to", req.To().Address.String(),
 	)
 
+	// Calls whose media GoSIP carries keep it on the route: pass
+	// re-INVITEs on
+	if call := s.anchoredCall(callID); call != nil && req.To().Params.Has("tag") {
+		s.relayInDialog(req, tx, call)
+		return
+	}
+
 	// Check if this is a re-INVITE for an existing session (hold/resume)
 	existingSession := s.sessions.Get(callID)
 	if existingSession != nil {
@@ -113,6 +131,12 @@ func (s *Server) handleInvite(req *sip.Request, tx sip.ServerTransaction) {
 		return
 	}
 
+	// Reject requests that have run out of hops or looped back to us
+	if err := CheckLoop(req); err != nil {
+		s.rejectLoop(req, tx, err)
+		return
+	}
+
 	// Send 100 Trying immediately for new call
 	s.sendResponse(tx, req, sip.StatusTrying, "Trying")
 
@@ -131,42 +155,199 @@ func (s *Server) handleInvite(req *sip.Request, tx sip.ServerTransaction) {
 			return
 		}
 
+		if !s.admitCall(req, tx, "", device.ID) {
+			return
+		}
+
 		// Create session for outbound call
 		session := NewCallSession(req, CallDirectionOutbound)
 		session.DeviceID = device.ID
+		session.MaxDuration = s.limiter.Limits().MaxCallDuration
+		if session.AlertInfo == "" {
+			session.AlertInfo = RingClassInternal
+		}
 		s.sessions.Add(session)
 		s.incrementCallCount()
 
+		// Strip the anonymous call prefix before the number is looked at
+		if !s.applyCallerIDPrivacy(ctx, req, tx, session, device) {
+			return
+		}
+
+		// Intercom calls go straight to the callee device with auto-answer
+		if target, ok := IntercomTarget(req, s.intercomPrefix(ctx)); ok {
+			s.handleIntercom(ctx, req, tx, session, device, target)
+			return
+		}
+
+		// Internal extensions ring the registered device without going through Twilio
+		if s.handleExtensionCall(ctx, req, tx, session, device) {
+			return
+		}
+
+		// Pick the caller ID for devices shared across several DIDs
+		if !s.applyOutboundDID(ctx, req, tx, session, device) {
+			return
+		}
+
 		slog.Debug("Authenticated outbound call",
 			"device", device.Username,
 			"call_id", callID,
+			"from_did", session.FromNumber,
+			"to", session.ToNumber,
+			"anonymous", session.Anonymous,
 		)
 		// TODO: Route outbound call through Twilio
+		s.limiter.Release(callID)
 		s.sendResponse(tx, req, sip.StatusNotImplemented, "Outbound calls not yet implemented")
 		return
 	}
 
+	// Twilio never calls over WebSocket: browsers have to authenticate
+	if isWebSocket(req.Transport()) {
+		s.sendAuthChallenge(req, tx)
+		return
+	}
+
 	// External incoming call - should be from Twilio
+	if !s.admitCall(req, tx, extractNumber(toURI.String()), 0) {
+		return
+	}
+
+	// Apply call waiting when the call is for a registered device
+	callWaiting := false
+	device, err := s.db.Devices.GetByUsername(ctx, toURI.User)
+	if err == nil && s.sessions.IsDeviceBusy(device.ID) {
+		if !device.CallWaiting {
+			slog.Info("Device busy and call waiting disabled",
+				"call_id", callID,
+				"device", device.Username,
+			)
+			s.limiter.Release(callID)
+			s.sendResponse(tx, req, sip.StatusBusyHere, "Busy Here")
+			return
+		}
+		callWaiting = true
+	}
+
 	// Create session for inbound call
 	session := NewCallSession(req, CallDirectionInbound)
+	if device != nil {
+		session.DeviceID = device.ID
+	}
+	// Routes pass their own duration limit upstream
+	session.MaxDuration = TrunkMaxDuration(req)
+	if session.MaxDuration == 0 {
+		session.MaxDuration = s.limiter.Limits().MaxCallDuration
+	}
+	session.TrunkCallSID = TrunkCallSID(req)
+	session.MediaRelay = TrunkMediaRelay(req)
+	session.Record = TrunkRecord(req)
+	// Routes and caller lists pick the ring class upstream; other
+	// trunk calls ring as external
+	if session.AlertInfo == "" {
+		session.AlertInfo = RingClassExternal
+	}
 	s.sessions.Add(session)
 	s.incrementCallCount()
 
+	// 182 Queued tells the caller the callee is on another call (call waiting)
+	if callWaiting {
+		s.sendResponse(tx, req, sip.StatusQueued, "Queued")
+	} else {
+		s.sendResponse(tx, req, sip.StatusRinging, "Ringing")
+	}
+
 	// TODO: Validate request is from Twilio and route to appropriate device
 	slog.Info("Incoming call",
 		"call_id", callID,
 		"from", fromURI.String(),
 		"to", toURI.String(),
+		"alert_info", session.AlertInfo,
 	)
 
+	// Calls routed to voicemail are answered and recorded by GoSIP
+	if s.answerVoicemail(ctx, req, tx, session) {
+		return
+	}
+
 	// For now, send 486 Busy Here until call routing is implemented
+	s.limiter.Release(callID)
 	s.sendResponse(tx, req, sip.StatusBusyHere, "Busy Here")
 }
 
+// rejectLoop answers a looping request with 482 or 483 and logs the path
+// it took so misconfigured forwarding rules can be traced
+func (s *Server) rejectLoop(req *sip.Request, tx sip.ServerTransaction, err error) {
+	loopErr, ok := err.(*LoopError)
+	if !ok {
+		s.sendResponse(tx, req, sip.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	slog.Warn("Request loop detected",
+		"call_id", req.CallID().Value(),
+		"method", req.Method.String(),
+		"reason", loopErr.Reason,
+		"path", strings.Join(loopErr.Path, " -> "),
+		"from", req.From().Address.String(),
+		"to", req.To().Address.String(),
+	)
+
+	code, reason := loopErr.StatusCode()
+	s.sendResponse(tx, req, code, reason)
+}
+
+// admitCall reserves a concurrency slot for a new call. When a cap is hit
+// it rejects the INVITE, publishes a call limit event and returns false.
+func (s *Server) admitCall(req *sip.Request, tx sip.ServerTransaction, did string, deviceID int64) bool {
+	callID := req.CallID().Value()
+
+	err := s.limiter.Acquire(callID, did, deviceID)
+	if err == nil {
+		return true
+	}
+
+	limitErr, ok := err.(*LimitError)
+	if !ok {
+		s.sendResponse(tx, req, sip.StatusInternalServerError, "Internal Server Error")
+		return false
+	}
+
+	slog.Warn("Call rejected by concurrency limit",
+		"call_id", callID,
+		"scope", limitErr.Scope,
+		"key", limitErr.Key,
+		"limit", limitErr.Limit,
+		"from", req.From().Address.String(),
+		"to", req.To().Address.String(),
+	)
+
+	s.mu.RLock()
+	hub := s.events
+	s.mu.RUnlock()
+	hub.Publish(events.TypeCallLimit, map[string]interface{}{
+		"call_id": callID,
+		"scope":   limitErr.Scope,
+		"key":     limitErr.Key,
+		"limit":   limitErr.Limit,
+		"active":  limitErr.Active,
+		"from":    extractNumber(req.From().Address.String()),
+		"to":      extractNumber(req.To().Address.String()),
+	})
+
+	code, reason := limitErr.StatusCode()
+	s.sendResponse(tx, req, code, reason)
+	return false
+}
+
 // handleAck processes ACK requests
 func (s *Server) handleAck(req *sip.Request, tx sip.ServerTransaction) {
 	slog.Debug("Received ACK request", "call_id", req.CallID().Value())
-	// ACK doesn't require a response
+	// ACK doesn't require a response, but anchored calls pass it on
+	if call := s.anchoredCall(req.CallID().Value()); call != nil {
+		s.relayInDialog(req, tx, call)
+	}
 }
 
 // handleBye processes BYE requests to end calls
@@ -174,34 +355,21 @@ func (s *Server) handleBye(req *sip.Request, tx sip.ServerTransaction) {
 	callID := req.CallID().Value()
 	slog.Debug("Received BYE request", "call_id", callID)
 
+	// Conference participants leave without ending the conference
+	if s.conferenceBye(req, tx) {
+		return
+	}
+
+	// Anchored calls end at the other party, not here
+	if call := s.anchoredCall(callID); call != nil {
+		s.relayInDialog(req, tx, call)
+		return
+	}
+
 	// Find and terminate the session
 	session := s.sessions.Get(callID)
 	if session != nil {
-		// Stop MOH if active
-		if s.mohMgr != nil && s.mohMgr.IsActive(callID) {
-			s.mohMgr.Stop(callID)
-		}
-
-		// Clean up SRTP context if active
-		if s.srtpMgr != nil {
-			if err := s.srtpMgr.Remove(callID); err != nil {
-				slog.Warn("Failed to cleanup SRTP context", "error", err, "call_id", callID)
-			}
-		}
-
-		// Clean up ZRTP session if active
-		if s.zrtpMgr != nil {
-			if err := s.zrtpMgr.EndSession(callID); err != nil {
-				slog.Warn("Failed to cleanup ZRTP session", "error", err, "call_id", callID)
-			}
-		}
-
-		// Update session state
-		if err := session.SetState(CallStateTerminated); err != nil {
-			slog.Warn("Failed to set terminated state", "error", err, "call_id", callID)
-		}
-
-		s.decrementCallCount()
+		s.terminateSession(session)
 
 		slog.Info("Call terminated",
 			"call_id", callID,
@@ -214,6 +382,53 @@ func (s *Server) handleBye(req *sip.Request, tx sip.ServerTransaction) {
 	s.sendResponse(tx, req, sip.StatusOK, "OK")
 }
 
+// terminateSession stops the media of an ended call and frees its slot
+func (s *Server) terminateSession(session *CallSession) {
+	callID := session.CallID
+
+	// Stop MOH if active
+	if s.mohMgr != nil && s.mohMgr.IsActive(callID) {
+		s.mohMgr.Stop(callID)
+	}
+
+	// Drop announcements that haven't finished
+	if s.announcer != nil {
+		s.announcer.Cancel(callID)
+	}
+
+	// Store the message of a caller leaving voicemail
+	if s.voicemail != nil {
+		s.voicemail.hungUp(callID)
+	}
+
+	// Clean up SRTP context if active
+	if s.srtpMgr != nil {
+		if err := s.srtpMgr.Remove(callID); err != nil {
+			slog.Warn("Failed to cleanup SRTP context", "error", err, "call_id", callID)
+		}
+	}
+
+	// Drop the jitter buffer
+	if s.jitterMgr != nil {
+		s.jitterMgr.Remove(callID)
+	}
+
+	// Clean up ZRTP session if active
+	if s.zrtpMgr != nil {
+		if err := s.zrtpMgr.EndSession(callID); err != nil {
+			slog.Warn("Failed to cleanup ZRTP session", "error", err, "call_id", callID)
+		}
+	}
+
+	// Update session state
+	if err := session.SetState(CallStateTerminated); err != nil {
+		slog.Warn("Failed to set terminated state", "error", err, "call_id", callID)
+	}
+
+	s.decrementCallCount()
+	s.limiter.Release(callID)
+}
+
 // handleCancel processes CANCEL requests
 func (s *Server) handleCancel(req *sip.Request, tx sip.ServerTransaction) {
 	callID := req.CallID().Value()
@@ -227,6 +442,7 @@ func (s *Server) handleCancel(req *sip.Request, tx sip.ServerTransaction) {
 				slog.Warn("Failed to set terminated state", "error", err, "call_id", callID)
 			}
 			s.decrementCallCount()
+			s.limiter.Release(callID)
 			slog.Info("Call cancelled", "call_id", callID)
 		}
 	}
@@ -245,12 +461,25 @@ func (s *Server) handleRefer(req *sip.Request, tx sip.ServerTransaction) {
 	}
 }
 
+// handleNotify processes NOTIFY requests reporting the progress of transfers
+func (s *Server) handleNotify(req *sip.Request, tx sip.ServerTransaction) {
+	event := ""
+	if h := req.GetHeader("Event"); h != nil {
+		event = strings.TrimSpace(strings.SplitN(h.Value(), ";", 2)[0])
+	}
+	if event != "refer" {
+		s.sendResponse(tx, req, 489, "Bad Event")
+		return
+	}
+	s.transferMgr.HandleNotify(req, tx)
+}
+
 // handleOptions processes OPTIONS requests (health check / capabilities)
 func (s *Server) handleOptions(req *sip.Request, tx sip.ServerTransaction) {
 	slog.Debug("Received OPTIONS request", "from", req.From().Address.String())
 
 	res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
-	res.AppendHeader(sip.NewHeader("Allow", "INVITE, ACK, CANCEL, OPTIONS, BYE, REGISTER, REFER, NOTIFY"))
+	res.AppendHeader(sip.NewHeader("Allow", "INVITE, ACK, CANCEL, OPTIONS, BYE, REGISTER, REFER, NOTIFY, MESSAGE, INFO"))
 	res.AppendHeader(sip.NewHeader("Accept", "application/sdp"))
 	res.AppendHeader(sip.NewHeader("Accept-Language", "en"))
 	res.AppendHeader(sip.NewHeader("Supported", "replaces, timer"))
@@ -316,8 +545,9 @@ func getSourceIP(req *sip.Request) string {
 }
 
 func getTransport(req *sip.Request) string {
+	// Via carries the transport in upper case, registrations store it lower
 	if via := req.Via(); via != nil {
-		return via.Transport
+		return strings.ToLower(via.Transport)
 	}
 	return "udp"
 }
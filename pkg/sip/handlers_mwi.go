@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/btafoya/gosip/internal/config"
 	"github.com/emiago/sipgo/sip"
 )
 
@@ -14,6 +16,16 @@ import (
 func (s *Server) handleSubscribe(req *sip.Request, tx sip.ServerTransaction) {
 	ctx := context.Background()
 
+	if source := getSourceIP(req); !s.subscribeLimiter.Allow(source, time.Now()) {
+		slog.Warn("SUBSCRIBE rate limit exceeded", slog.String("source", source))
+		resp := sip.NewResponseFromRequest(req, sip.StatusServiceUnavailable, "Service Unavailable", nil)
+		resp.AppendHeader(sip.NewHeader("Retry-After", strconv.Itoa(int(config.SubscribeRateWindow.Seconds()))))
+		if err := tx.Respond(resp); err != nil {
+			slog.Error("Failed to send SUBSCRIBE response", slog.String("error", err.Error()))
+		}
+		return
+	}
+
 	// Get the Event header
 	eventHeader := req.GetHeader("Event")
 	if eventHeader == nil {
@@ -21,16 +33,22 @@ func (s *Server) handleSubscribe(req *sip.Request, tx sip.ServerTransaction) {
 		return
 	}
 
-	event := strings.ToLower(eventHeader.Value())
+	event := strings.ToLower(strings.TrimSpace(strings.SplitN(eventHeader.Value(), ";", 2)[0]))
 
-	switch {
-	case strings.HasPrefix(event, "message-summary"):
+	switch event {
+	case EventMessageSummary:
 		s.handleMWISubscribe(ctx, req, tx)
+	case EventReg:
+		s.handleRegSubscribe(ctx, req, tx)
 	default:
 		slog.Debug("Unsupported SUBSCRIBE event",
 			slog.String("event", event),
 		)
-		s.respondToSubscribe(tx, req, sip.StatusCode(489), "Bad Event")
+		resp := sip.NewResponseFromRequest(req, sip.StatusCode(489), "Bad Event", nil)
+		resp.AppendHeader(sip.NewHeader("Allow-Events", EventMessageSummary+", "+EventReg))
+		if err := tx.Respond(resp); err != nil {
+			slog.Error("Failed to send SUBSCRIBE response", slog.String("error", err.Error()))
+		}
 	}
 }
 
@@ -49,91 +67,59 @@ func (s *Server) handleMWISubscribe(ctx context.Context, req *sip.Request, tx si
 		return
 	}
 
+	expires, tooBrief := subscriptionExpires(req)
+	if tooBrief {
+		s.rejectIntervalTooBrief(tx, req)
+		return
+	}
+
 	// Get AOR from To header (the mailbox being subscribed to)
 	aor := toHeader.Address.String()
+	subID := subscriptionID(req)
 
-	// Get Contact header for sending NOTIFY
-	contactHeader := req.GetHeader("Contact")
-	contactURI := ""
-	if contactHeader != nil {
-		contactURI = contactHeader.Value()
-		// Clean up contact URI (remove < and >)
-		contactURI = strings.Trim(strings.TrimSpace(contactURI), "<>")
-	}
-	if contactURI == "" {
-		// Fall back to Via header
-		via := req.Via()
-		if via != nil {
-			contactURI = fmt.Sprintf("sip:%s:%d", via.Host, via.Port)
-		}
-	}
-
-	// Get Expires header (default to 3600 seconds per RFC)
-	expires := 3600
-	if expiresHeader := req.GetHeader("Expires"); expiresHeader != nil {
-		if _, err := fmt.Sscanf(expiresHeader.Value(), "%d", &expires); err != nil {
-			expires = 3600
-		}
+	// A refresh must belong to a dialog GoSIP created
+	existing := s.mwiMgr.GetSubscription(subID)
+	if toTag := requestToTag(req); toTag != "" && (existing == nil || existing.ToTag != toTag) {
+		s.respondToSubscribe(tx, req, sip.StatusCode(481), "Subscription Does Not Exist")
+		return
 	}
 
 	// Handle unsubscribe (Expires: 0)
 	if expires == 0 {
-		s.handleMWIUnsubscribe(ctx, req, tx)
+		s.handleMWIUnsubscribe(ctx, req, tx, existing)
 		return
 	}
 
-	// Create subscription ID from Call-ID + From tag
-	fromTag := ""
-	if fromHeader.Params != nil {
-		fromTag, _ = fromHeader.Params.Get("tag")
-	}
-	subID := fmt.Sprintf("%s-%s", req.CallID().Value(), fromTag)
-
-	// Create or refresh subscription
-	sub := &MWISubscription{
-		ID:         subID,
-		AOR:        aor,
-		ContactURI: contactURI,
-		FromURI:    fromHeader.Address.String(),
-		ToURI:      toHeader.Address.String(),
-		CallID:     req.CallID().Value(),
-		FromTag:    fromTag,
-		Expires:    expires,
-	}
-
-	// Check if this is a refresh of existing subscription
-	existing := s.mwiMgr.GetSubscription(subID)
+	var toTag string
 	if existing != nil {
 		if err := s.mwiMgr.RefreshSubscription(subID, expires); err != nil {
 			slog.Error("Failed to refresh MWI subscription", "error", err)
 			s.respondToSubscribe(tx, req, sip.StatusCode(500), "Internal Server Error")
 			return
 		}
+		toTag = existing.ToTag
 	} else {
-		s.mwiMgr.AddSubscription(sub)
-	}
-
-	// Generate To tag for response
-	toTag := fmt.Sprintf("mwi-%d", time.Now().UnixNano())
-
-	// Send 200 OK response
-	resp := sip.NewResponseFromRequest(req, 200, "OK", nil)
-
-	// Add Contact header
-	resp.AppendHeader(sip.NewHeader("Contact", fmt.Sprintf("<%s>", s.getLocalContact(req))))
-
-	// Add Expires header
-	resp.AppendHeader(sip.NewHeader("Expires", fmt.Sprintf("%d", expires)))
-
-	// Add To tag
-	if toHeader != nil && resp.To() != nil {
-		if resp.To().Params == nil {
-			resp.To().Params = sip.NewParams()
+		if len(s.mwiMgr.GetSubscriptionsForAOR(aor)) >= config.MaxSubscriptionsPerAOR {
+			slog.Warn("Too many MWI subscriptions", slog.String("aor", aor))
+			s.respondToSubscribe(tx, req, sip.StatusForbidden, "Too Many Subscriptions")
+			return
 		}
-		resp.To().Params.Add("tag", toTag)
-	}
 
-	if err := tx.Respond(resp); err != nil {
+		toTag = fmt.Sprintf("mwi-%d", time.Now().UnixNano())
+		s.mwiMgr.AddSubscription(&MWISubscription{
+			ID:         subID,
+			AOR:        aor,
+			ContactURI: subscriberContact(req),
+			FromURI:    fromHeader.Address.String(),
+			ToURI:      toHeader.Address.String(),
+			CallID:     req.CallID().Value(),
+			FromTag:    requestFromTag(req),
+			ToTag:      toTag,
+			Expires:    expires,
+		})
+	}
+
+	if err := s.acceptSubscribe(tx, req, toTag, expires); err != nil {
 		slog.Error("Failed to send SUBSCRIBE 200 OK", "error", err)
 		return
 	}
@@ -141,43 +127,77 @@ func (s *Server) handleMWISubscribe(ctx context.Context, req *sip.Request, tx si
 	slog.Info("MWI subscription accepted",
 		slog.String("id", subID),
 		slog.String("aor", aor),
-		slog.String("contact", contactURI),
 		slog.Int("expires", expires),
+		slog.Bool("refresh", existing != nil),
 	)
 
-	// Send initial NOTIFY with current state
-	if sub.ToTag == "" {
-		sub.ToTag = toTag
-	}
-	if err := s.mwiMgr.NotifyAllSubscribers(ctx, aor); err != nil {
-		slog.Error("Failed to send initial MWI NOTIFY", "error", err)
-	}
+	// Send NOTIFY with current state, as required after every SUBSCRIBE
+	go func() {
+		defer s.recoverPanic("MWI NOTIFY")
+		ctx, cancel := context.WithTimeout(context.Background(), config.SubscriptionNotifyTimeout)
+		defer cancel()
+		if err := s.mwiMgr.NotifySubscriber(ctx, subID); err != nil {
+			slog.Error("Failed to send MWI NOTIFY", "error", err)
+		}
+	}()
 }
 
-// handleMWIUnsubscribe handles MWI unsubscribe (Expires: 0)
-func (s *Server) handleMWIUnsubscribe(ctx context.Context, req *sip.Request, tx sip.ServerTransaction) {
-	fromHeader := req.From()
-	fromTag := ""
-	if fromHeader != nil && fromHeader.Params != nil {
-		fromTag, _ = fromHeader.Params.Get("tag")
+// handleMWIUnsubscribe handles MWI unsubscribe (Expires: 0). The subscriber
+// gets a final NOTIFY ending the subscription.
+func (s *Server) handleMWIUnsubscribe(ctx context.Context, req *sip.Request, tx sip.ServerTransaction, existing *MWISubscription) {
+	toTag := requestToTag(req)
+	if existing != nil {
+		toTag = existing.ToTag
+	}
+	if err := s.acceptSubscribe(tx, req, toTag, 0); err != nil {
+		slog.Error("Failed to send SUBSCRIBE 200 OK (unsubscribe)", "error", err)
+	}
+	if existing == nil {
+		return
 	}
 
-	subID := fmt.Sprintf("%s-%s", req.CallID().Value(), fromTag)
+	slog.Info("MWI subscription removed",
+		slog.String("id", existing.ID),
+	)
 
-	s.mwiMgr.RemoveSubscription(subID)
+	go func() {
+		defer s.recoverPanic("MWI NOTIFY")
+		defer s.mwiMgr.RemoveSubscription(existing.ID)
+		ctx, cancel := context.WithTimeout(ctx, config.SubscriptionNotifyTimeout)
+		defer cancel()
+		if err := s.mwiMgr.RefreshSubscription(existing.ID, 0); err != nil {
+			return
+		}
+		if err := s.mwiMgr.NotifySubscriber(ctx, existing.ID); err != nil {
+			slog.Debug("Final MWI NOTIFY failed", "error", err)
+		}
+	}()
+}
 
-	// Send 200 OK
+// acceptSubscribe sends 200 OK for a SUBSCRIBE within the subscription
+// dialog identified by toTag
+func (s *Server) acceptSubscribe(tx sip.ServerTransaction, req *sip.Request, toTag string, expires int) error {
 	resp := sip.NewResponseFromRequest(req, 200, "OK", nil)
-	resp.AppendHeader(sip.NewHeader("Expires", "0"))
+	resp.AppendHeader(sip.NewHeader("Contact", fmt.Sprintf("<%s>", s.getLocalContact(req))))
+	resp.AppendHeader(sip.NewHeader("Expires", strconv.Itoa(expires)))
 
-	if err := tx.Respond(resp); err != nil {
-		slog.Error("Failed to send SUBSCRIBE 200 OK (unsubscribe)", "error", err)
-		return
+	if to := resp.To(); to != nil && toTag != "" {
+		if to.Params == nil {
+			to.Params = sip.NewParams()
+		}
+		to.Params.Add("tag", toTag)
 	}
+	return tx.Respond(resp)
+}
 
-	slog.Info("MWI subscription removed",
-		slog.String("id", subID),
-	)
+// rejectIntervalTooBrief sends 423 for a SUBSCRIBE shorter than
+// config.MinSubscriptionExpires
+func (s *Server) rejectIntervalTooBrief(tx sip.ServerTransaction, req *sip.Request) {
+	resp := sip.NewResponseFromRequest(req, sip.StatusCode(423), "Interval Too Brief", nil)
+	resp.AppendHeader(sip.NewHeader("Min-Expires", strconv.Itoa(config.MinSubscriptionExpires)))
+	if err := tx.Respond(resp); err != nil {
+		slog.Error("Failed to send SUBSCRIBE response", slog.String("error", err.Error()))
+	}
 }
 
 // respondToSubscribe sends a response to a SUBSCRIBE request
@@ -0,0 +1,178 @@
+package sip
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+)
+
+// handleRegSubscribe handles SUBSCRIBE requests for the reg event package
+// (RFC 3680). Registration state reveals where phones are, so only
+// authenticated devices may subscribe.
+func (s *Server) handleRegSubscribe(ctx context.Context, req *sip.Request, tx sip.ServerTransaction) {
+	if req.GetHeader("Authorization") == nil {
+		s.sendAuthChallenge(req, tx)
+		return
+	}
+	subscriber, err := s.auth.Authenticate(ctx, req)
+	if err != nil {
+		slog.Warn("reg SUBSCRIBE authentication failed", "error", err, "from", req.From().Address.String())
+		s.respondToSubscribe(tx, req, sip.StatusForbidden, "Forbidden")
+		return
+	}
+
+	expires, tooBrief := subscriptionExpires(req)
+	if tooBrief {
+		s.rejectIntervalTooBrief(tx, req)
+		return
+	}
+
+	subID := subscriptionID(req)
+	existing := s.regEvents.Get(subID)
+	if toTag := requestToTag(req); toTag != "" && (existing == nil || existing.ToTag != toTag) {
+		s.respondToSubscribe(tx, req, sip.StatusCode(481), "Subscription Does Not Exist")
+		return
+	}
+
+	if expires == 0 {
+		s.handleRegUnsubscribe(tx, req, existing)
+		return
+	}
+
+	var toTag string
+	if existing != nil {
+		if err := s.regEvents.Refresh(subID, expires); err != nil {
+			slog.Error("Failed to refresh reg subscription", "error", err)
+			s.respondToSubscribe(tx, req, sip.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		toTag = existing.ToTag
+	} else {
+		target, err := s.resolveRegTarget(ctx, subscriber, req.To().Address.User)
+		if err != nil {
+			s.respondToSubscribe(tx, req, sip.StatusNotFound, "Not Found")
+			return
+		}
+
+		toTag = fmt.Sprintf("reg-%d", time.Now().UnixNano())
+		err = s.regEvents.Add(&RegSubscription{
+			ID:             subID,
+			AOR:            req.To().Address.String(),
+			TargetDeviceID: target.ID,
+			DeviceID:       subscriber.ID,
+			ContactURI:     subscriberContact(req),
+			FromURI:        req.From().Address.String(),
+			ToURI:          req.To().Address.String(),
+			CallID:         req.CallID().Value(),
+			FromTag:        requestFromTag(req),
+			ToTag:          toTag,
+			Expires:        expires,
+		})
+		if err != nil {
+			slog.Warn("Too many reg subscriptions", slog.String("aor", req.To().Address.String()))
+			s.respondToSubscribe(tx, req, sip.StatusForbidden, "Too Many Subscriptions")
+			return
+		}
+	}
+
+	if err := s.acceptSubscribe(tx, req, toTag, expires); err != nil {
+		slog.Error("Failed to send SUBSCRIBE 200 OK", "error", err)
+		return
+	}
+
+	slog.Info("reg subscription accepted",
+		slog.String("id", subID),
+		slog.String("aor", req.To().Address.String()),
+		slog.String("subscriber", subscriber.Username),
+		slog.Int("expires", expires),
+		slog.Bool("refresh", existing != nil),
+	)
+
+	go func() {
+		defer s.recoverPanic("reg NOTIFY")
+		s.sendRegNotify(subID, false)
+	}()
+}
+
+// handleRegUnsubscribe ends a reg subscription with a final NOTIFY
+func (s *Server) handleRegUnsubscribe(tx sip.ServerTransaction, req *sip.Request, existing *RegSubscription) {
+	toTag := requestToTag(req)
+	if existing != nil {
+		toTag = existing.ToTag
+	}
+	if err := s.acceptSubscribe(tx, req, toTag, 0); err != nil {
+		slog.Error("Failed to send SUBSCRIBE 200 OK (unsubscribe)", "error", err)
+	}
+	if existing == nil {
+		return
+	}
+
+	slog.Info("reg subscription removed", slog.String("id", existing.ID))
+
+	go func() {
+		defer s.recoverPanic("reg NOTIFY")
+		defer s.regEvents.Remove(existing.ID)
+		if err := s.regEvents.Refresh(existing.ID, 0); err == nil {
+			s.sendRegNotify(existing.ID, false)
+		}
+	}()
+}
+
+// resolveRegTarget finds the device a reg SUBSCRIBE is about from the user
+// part of its To URI: a device username or extension in the subscriber's
+// tenant
+func (s *Server) resolveRegTarget(ctx context.Context, subscriber *models.Device, user string) (*models.Device, error) {
+	if device, err := s.db.Devices.GetByUsername(ctx, user); err == nil && sameTenant(device.TenantID, subscriber.TenantID) {
+		return device, nil
+	}
+	return s.db.Devices.GetByExtension(ctx, subscriber.TenantID, user)
+}
+
+// notifyRegState sends the registration state of a device to everyone
+// watching it. unregistered is true when the device has just unregistered.
+func (s *Server) notifyRegState(deviceID int64, unregistered bool) {
+	defer s.recoverPanic("reg NOTIFY")
+	for _, id := range s.regEvents.ForDevice(deviceID) {
+		s.sendRegNotify(id, unregistered)
+	}
+}
+
+// sendRegNotify sends the full registration state of the watched device to
+// one subscriber
+func (s *Server) sendRegNotify(id string, unregistered bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.SubscriptionNotifyTimeout)
+	defer cancel()
+
+	sub := s.regEvents.nextNotify(id)
+	if sub == nil {
+		return
+	}
+
+	var reg *models.Registration
+	if !unregistered {
+		reg, _ = s.registrar.GetRegistration(ctx, sub.TargetDeviceID) // Not registered leaves it nil
+	}
+
+	err := s.sendEventNotify(ctx, &eventNotify{
+		Event:       EventReg,
+		ContentType: RegInfoContentType,
+		Body:        BuildRegInfo(sub.AOR, sub.TargetDeviceID, sub.Version, reg, unregistered, time.Now()),
+		ContactURI:  sub.ContactURI,
+		CallID:      sub.CallID,
+		LocalURI:    sub.ToURI,
+		LocalTag:    sub.ToTag,
+		RemoteURI:   sub.FromURI,
+		RemoteTag:   sub.FromTag,
+		CSeq:        sub.CSeq,
+		ExpiresAt:   sub.ExpiresAt,
+		Reason:      endReason(sub.Expires),
+	})
+	if err != nil {
+		slog.Warn("reg NOTIFY failed", slog.String("aor", sub.AOR), slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,309 @@
+package sip
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+)
+
+// anchoredCall is a call GoSIP stays in the signalling path of because it
+// carries the call's media: a WebRTC bridge or a relayed call
+type anchoredCall interface {
+	// dialog returns the Call-ID and the caller's From tag
+	dialog() (callID, fromTag string)
+	// defaultTransport is how requests reach a party without a route
+	defaultTransport() string
+	SetRoute(contact, source, transport string)
+	Route(contact string) (source, transport string, ok bool)
+	// translate converts SDP from one party for the other
+	translate(sdp []byte, offer, fromCaller bool) ([]byte, error)
+	Renegotiate()
+	Answered()
+	// setTap hands the call's audio to tap, reporting false when the
+	// media doesn't pass through GoSIP
+	setTap(tap mediaTap) bool
+	Close()
+}
+
+// dialog, defaultTransport and translate make the call an anchoredCall
+func (c *RelayedCall) dialog() (string, string) { return c.CallID, c.fromTag }
+func (c *RelayedCall) defaultTransport() string { return c.transport }
+func (c *RelayedCall) translate(sdp []byte, offer, fromCaller bool) ([]byte, error) {
+	return c.Translate(sdp, offer, fromCaller)
+}
+
+// Renegotiate does nothing: the parties' own SDP versions are kept
+func (c *RelayedCall) Renegotiate() {}
+
+// anchoredCall returns the bridge or relayed call with a Call-ID, or nil
+func (s *Server) anchoredCall(callID string) anchoredCall {
+	if bridge := s.webrtcBridge(callID); bridge != nil {
+		return bridge
+	}
+	if s.relay != nil {
+		if call := s.relay.Call(callID); call != nil {
+			return call
+		}
+	}
+	return nil
+}
+
+// behindNAT reports whether a party whose packets come from source
+// advertises other IP addresses in its Contact or SDP. Host names, such
+// as the .invalid hosts of browsers, are ignored.
+func behindNAT(source string, advertised ...string) bool {
+	src := net.ParseIP(source)
+	if src == nil {
+		return false
+	}
+	for _, host := range advertised {
+		if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() && !ip.Equal(src) {
+			return true
+		}
+	}
+	return false
+}
+
+// relayMedia anchors the media of a call between phones at GoSIP when
+// the call's relay mode asks for it: always, or when either phone is
+// behind NAT. The route's mode wins over the server's. Like bridgeWebRTC
+// it records the route and translates the offer. Calls that can't be
+// relayed go ahead with their media direct.
+func (s *Server) relayMedia(req, fwd *sip.Request, session *CallSession, reg *models.Registration) *RelayedCall {
+	if s.relay == nil {
+		return nil
+	}
+	mode := session.MediaRelay
+	if mode == "" {
+		mode = s.relay.Mode()
+	}
+	// Recorded calls need their media
+	if session.Record && s.recorder != nil {
+		mode = config.MediaRelayAlways
+	}
+
+	callerHost, _, _ := net.SplitHostPort(req.Source())
+	calleeHost := reg.IPAddress
+	if calleeHost == "" {
+		calleeHost = fwd.Recipient.Host
+	}
+
+	var audio *sdpAudio
+	if len(fwd.Body()) > 0 {
+		if audio = parseSDPAudio(fwd.Body()); audio == nil {
+			return nil
+		}
+	}
+
+	switch mode {
+	case config.MediaRelayAlways:
+	case config.MediaRelayNAT:
+		var callerAddrs []string
+		if contact := req.Contact(); contact != nil {
+			callerAddrs = append(callerAddrs, contact.Address.Host)
+		}
+		if audio != nil {
+			callerAddrs = append(callerAddrs, audio.address)
+		}
+		if !behindNAT(callerHost, callerAddrs...) && !behindNAT(reg.IPAddress, fwd.Recipient.Host) {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	fromTag, _ := req.From().Params.Get("tag")
+	call, err := s.relay.NewCall(session.CallID, fromTag, callerHost, calleeHost)
+	if err != nil {
+		slog.Warn("Cannot relay call media", "error", err, "call_id", session.CallID)
+		return nil
+	}
+	call.transport = "UDP"
+	if reg.Transport != "" {
+		call.transport = strings.ToUpper(reg.Transport)
+	}
+	call.setDTMFHandler(func(fromCaller bool, digit string, duration int) {
+		s.publishDTMF(session.CallID, fromCaller, digit, duration, DTMFMethodRTP)
+	})
+
+	if audio != nil {
+		body, err := call.Translate(fwd.Body(), true, true)
+		if err != nil {
+			slog.Warn("Cannot translate relayed call offer", "error", err, "call_id", session.CallID)
+			call.Close()
+			return nil
+		}
+		fwd.SetBody(body)
+	}
+
+	if contact := req.Contact(); contact != nil {
+		call.SetRoute(contact.Address.String(), req.Source(), req.Transport())
+	}
+
+	// Phones on different networks reach GoSIP on different addresses,
+	// so each gets its own Record-Route (RFC 5658): the callee uses the
+	// top one and the caller the bottom one
+	callerRoute := s.recordRoute(call.caller.ip, req.Transport())
+	calleeRoute := s.recordRoute(call.callee.ip, fwd.Transport())
+	fwd.PrependHeader(callerRoute)
+	if calleeRoute.Value() != callerRoute.Value() {
+		fwd.PrependHeader(calleeRoute)
+	}
+
+	session.Relayed = true
+	slog.Info("Relaying call media", "call_id", session.CallID, "mode", mode, "caller", callerHost, "callee", calleeHost)
+	return call
+}
+
+// recordRoute is GoSIP's Record-Route for anchored calls, on the address
+// a party reaches it at. GoSIP stays on the path after the call is
+// answered so in-dialog requests reach the media it carries.
+func (s *Server) recordRoute(ip net.IP, transport string) *sip.RecordRouteHeader {
+	uri := sip.Uri{Host: ip.String(), Port: s.cfg.Port, UriParams: sip.NewParams()}
+	switch strings.ToUpper(transport) {
+	case "TCP":
+		uri.UriParams.Add("transport", "tcp")
+	case "TLS":
+		if s.cfg.TLS != nil {
+			uri.Port = s.cfg.TLS.Port
+		}
+		uri.UriParams.Add("transport", "tls")
+	}
+	uri.UriParams.Add("lr", "")
+	return &sip.RecordRouteHeader{Address: uri}
+}
+
+// anchorResponse prepares a party's response in an anchored call for the
+// other party: the sender's contact is reached where the response came
+// from, and its SDP is translated
+func (s *Server) anchorResponse(call anchoredCall, res *sip.Response, offer, fromCaller bool) {
+	if contact := res.Contact(); contact != nil {
+		call.SetRoute(contact.Address.String(), res.Source(), res.Transport())
+	}
+	if len(res.Body()) == 0 {
+		return
+	}
+
+	body, err := call.translate(res.Body(), offer, fromCaller)
+	if err != nil {
+		callID, _ := call.dialog()
+		slog.Warn("Cannot translate anchored call SDP", "error", err, "call_id", callID, "status", res.StatusCode)
+		return
+	}
+	res.SetBody(body)
+}
+
+// relayInDialog passes an in-dialog request of an anchored call on to the
+// other party, translating its SDP, and relays the final response back.
+// BYE ends the anchoring.
+func (s *Server) relayInDialog(req *sip.Request, tx sip.ServerTransaction, call anchoredCall) {
+	callID, fromTag := call.dialog()
+	if req.Method == sip.BYE {
+		defer call.Close()
+	}
+
+	if s.client == nil {
+		if !req.IsAck() {
+			s.sendResponse(tx, req, sip.StatusServiceUnavailable, "Service Unavailable")
+		}
+		return
+	}
+
+	tag, _ := req.From().Params.Get("tag")
+	fromCaller := tag == fromTag
+	if relayed, ok := call.(*RelayedCall); ok && !req.IsAck() {
+		relayed.noteCSeq(fromCaller, req.CSeq().SeqNo)
+	}
+	if contact := req.Contact(); contact != nil {
+		call.SetRoute(contact.Address.String(), req.Source(), req.Transport())
+	}
+
+	// The route set is the Record-Route GoSIP added, so the request goes
+	// straight to the other party's contact
+	fwd := req.Clone()
+	fwd.SetBody(req.Body())
+	for fwd.GetHeader("Route") != nil {
+		fwd.RemoveHeader("Route")
+	}
+	if source, transport, ok := call.Route(req.Recipient.String()); ok {
+		fwd.SetDestination(source)
+		fwd.SetTransport(transport)
+	} else {
+		fwd.SetDestination(req.Recipient.HostPort())
+		fwd.SetTransport(call.defaultTransport())
+	}
+
+	if req.IsInvite() {
+		call.Renegotiate()
+	}
+	offered := len(fwd.Body()) > 0
+	if offered {
+		body, err := call.translate(fwd.Body(), req.IsInvite(), fromCaller)
+		if err != nil {
+			slog.Warn("Cannot translate anchored call SDP", "error", err, "call_id", callID, "method", req.Method.String())
+			if !req.IsAck() {
+				s.sendResponse(tx, req, sip.StatusNotAcceptableHere, "Not Acceptable Here")
+			}
+			return
+		}
+		fwd.SetBody(body)
+	}
+
+	s.trace.Record(TraceOut, fwd)
+	if req.IsAck() {
+		if err := s.client.WriteRequest(fwd, s.forwardVia); err != nil {
+			slog.Warn("Failed to relay ACK", "error", err, "call_id", callID)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.DeviceRingTimeout)
+	defer cancel()
+
+	clTx, err := s.client.TransactionRequest(ctx, fwd, s.forwardVia)
+	if err != nil {
+		slog.Warn("Failed to relay in-dialog request", "error", err, "call_id", callID, "method", req.Method.String())
+		s.sendResponse(tx, req, sip.StatusTemporarilyUnavailable, "Temporarily Unavailable")
+		return
+	}
+	defer clTx.Terminate()
+
+	for {
+		select {
+		case res := <-clTx.Responses():
+			s.trace.Record(TraceIn, res)
+			if res.StatusCode == sip.StatusTrying {
+				continue
+			}
+
+			relayed := res.Clone()
+			relayed.RemoveHeader("Via")
+			relayed.SetDestination(req.Source())
+			// A re-INVITE without SDP gets the offer in the response
+			s.anchorResponse(call, relayed, req.IsInvite() && !offered, !fromCaller)
+			if err := tx.Respond(relayed); err != nil {
+				slog.Error("Failed to relay response", "error", err, "call_id", callID, "status", res.StatusCode)
+				return
+			}
+			if res.StatusCode >= 200 {
+				return
+			}
+
+		case <-clTx.Done():
+			s.sendResponse(tx, req, sip.StatusRequestTimeout, "Request Timeout")
+			return
+
+		case <-ctx.Done():
+			s.sendResponse(tx, req, sip.StatusRequestTimeout, "Request Timeout")
+			return
+
+		case <-tx.Done():
+			return
+		}
+	}
+}
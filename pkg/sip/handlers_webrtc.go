@@ -0,0 +1,94 @@
+package sip
+
+import (
+	"log/slog"
+	"net"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+)
+
+// webrtcBridge returns the bridge of a call with a browser leg, or nil
+func (s *Server) webrtcBridge(callID string) *WebRTCBridge {
+	if s.webrtc == nil {
+		return nil
+	}
+	return s.webrtc.Bridge(callID)
+}
+
+// bridgeWebRTC prepares the relayed INVITE of a call with a browser leg.
+// Browsers are reached down their WebSocket connection, GoSIP records the
+// route so in-dialog requests pass through it, and between a browser and
+// a phone the offer is translated for the media relay. It returns a nil
+// bridge for calls between phones, or the status to reject the call with
+// when it can't be bridged.
+func (s *Server) bridgeWebRTC(req, fwd *sip.Request, reg *models.Registration) (*WebRTCBridge, sip.StatusCode, string) {
+	browserCaller := isWebSocket(req.Transport())
+	browserCallee := isWebSocket(reg.Transport)
+	if !browserCaller && !browserCallee {
+		return nil, 0, ""
+	}
+	callID := req.CallID().Value()
+
+	// Phones and browsers can't reach each other without the gateway
+	if s.webrtc == nil {
+		slog.Info("Call with a browser needs the WebRTC gateway", "call_id", callID, "device_id", reg.DeviceID)
+		if browserCallee {
+			return nil, sip.StatusTemporarilyUnavailable, "Temporarily Unavailable"
+		}
+		return nil, sip.StatusNotAcceptableHere, "Not Acceptable Here"
+	}
+
+	phoneHost, phoneTransport := "", "UDP"
+	switch {
+	case !browserCallee:
+		phoneHost = fwd.Recipient.Host
+		if reg.Transport != "" {
+			phoneTransport = strings.ToUpper(reg.Transport)
+		}
+	case !browserCaller:
+		phoneHost, _, _ = net.SplitHostPort(req.Source())
+		phoneTransport = req.Transport()
+	}
+
+	bridge, err := s.webrtc.NewBridge(callID, browserCaller != browserCallee, phoneHost)
+	if err != nil {
+		slog.Error("Failed to bridge browser call", "error", err, "call_id", callID)
+		return nil, sip.StatusServiceUnavailable, "Service Unavailable"
+	}
+	bridge.phoneTransport = phoneTransport
+	bridge.fromTag, _ = req.From().Params.Get("tag")
+	bridge.mu.Lock()
+	bridge.browserCaller = browserCaller
+	bridge.mu.Unlock()
+
+	if browserCallee {
+		source, transport, ok := s.webrtc.Route(reg.Contact)
+		if !ok {
+			bridge.Close()
+			return nil, sip.StatusTemporarilyUnavailable, "Temporarily Unavailable"
+		}
+		fwd.SetDestination(source)
+		fwd.SetTransport(transport)
+	} else {
+		fwd.SetTransport(phoneTransport)
+	}
+	if browserCaller {
+		if contact := req.Contact(); contact != nil {
+			bridge.SetRoute(contact.Address.String(), req.Source(), req.Transport())
+		}
+	}
+	fwd.PrependHeader(s.recordRoute(bridge.LocalIP(), phoneTransport))
+
+	if bridge.Relays() && len(fwd.Body()) > 0 {
+		body, err := bridge.Translate(fwd.Body(), true)
+		if err != nil {
+			slog.Warn("Cannot translate browser call offer", "error", err, "call_id", callID)
+			bridge.Close()
+			return nil, sip.StatusNotAcceptableHere, "Not Acceptable Here"
+		}
+		fwd.SetBody(body)
+	}
+	return bridge, 0, ""
+}
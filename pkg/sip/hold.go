@@ -9,6 +9,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/btafoya/gosip/internal/codec"
 	"github.com/emiago/sipgo/sip"
 )
 
@@ -192,6 +193,7 @@ func (h *HoldManager) PutOnHold(ctx context.Context, session *CallSession) error
 	req := h.createReInviteRequest(session, holdSDP)
 
 	// Send re-INVITE
+	h.server.trace.Record(TraceOut, req)
 	tx, err := h.server.client.TransactionRequest(ctx, req)
 	if err != nil {
 		return fmt.Errorf("failed to send hold re-INVITE: %w", err)
@@ -201,6 +203,7 @@ func (h *HoldManager) PutOnHold(ctx context.Context, session *CallSession) error
 	// Wait for response
 	select {
 	case res := <-tx.Responses():
+		h.server.trace.Record(TraceIn, res)
 		if res.IsSuccess() {
 			if err := session.SetState(CallStateHolding); err != nil {
 				return err
@@ -239,6 +242,7 @@ func (h *HoldManager) Resume(ctx context.Context, session *CallSession) error {
 	req := h.createReInviteRequest(session, activeSDP)
 
 	// Send re-INVITE
+	h.server.trace.Record(TraceOut, req)
 	tx, err := h.server.client.TransactionRequest(ctx, req)
 	if err != nil {
 		return fmt.Errorf("failed to send resume re-INVITE: %w", err)
@@ -248,6 +252,7 @@ func (h *HoldManager) Resume(ctx context.Context, session *CallSession) error {
 	// Wait for response
 	select {
 	case res := <-tx.Responses():
+		h.server.trace.Record(TraceIn, res)
 		if res.IsSuccess() {
 			if err := session.SetState(CallStateActive); err != nil {
 				return err
@@ -297,17 +302,7 @@ func (h *HoldManager) generateHoldSDP(session *CallSession) []byte {
 
 	if localSDP == nil {
 		// Generate basic hold SDP
-		return []byte(`v=0
-o=gosip 0 0 IN IP4 0.0.0.0
-s=GoSIP Call
-c=IN IP4 0.0.0.0
-t=0 0
-m=audio 0 RTP/AVP 0 8 101
-a=sendonly
-a=rtpmap:0 PCMU/8000
-a=rtpmap:8 PCMA/8000
-a=rtpmap:101 telephone-event/8000
-`)
+		return basicSDP("sendonly", h.codecs(session))
 	}
 
 	// Modify existing SDP to be sendonly
@@ -328,22 +323,20 @@ func (h *HoldManager) generateResumeSDP(session *CallSession) []byte {
 
 	if baseSDP == nil {
 		// Generate basic active SDP
-		return []byte(`v=0
-o=gosip 0 0 IN IP4 0.0.0.0
-s=GoSIP Call
-c=IN IP4 0.0.0.0
-t=0 0
-m=audio 0 RTP/AVP 0 8 101
-a=sendrecv
-a=rtpmap:0 PCMU/8000
-a=rtpmap:8 PCMA/8000
-a=rtpmap:101 telephone-event/8000
-`)
+		return basicSDP("sendrecv", h.codecs(session))
 	}
 
 	return ModifySDPDirection(baseSDP, "sendrecv")
 }
 
+// codecs returns the codecs to offer on a call, G.711 without a server
+func (h *HoldManager) codecs(session *CallSession) []codec.Codec {
+	if h.server == nil {
+		return []codec.Codec{codec.PCMU, codec.PCMA}
+	}
+	return h.server.sessionCodecs(session)
+}
+
 // generateHoldResponseSDP creates response SDP accepting hold
 func (h *HoldManager) generateHoldResponseSDP(session *CallSession, offerSDP []byte) []byte {
 	// Mirror the offer with recvonly (we receive their silence)
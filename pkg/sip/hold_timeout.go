@@ -0,0 +1,76 @@
+// Package sip provides hold time limits for GoSIP
+package sip
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// TrunkCallSIDHeader carries the Twilio call SID of the caller on calls
+// delivered by Twilio, so a call held too long can go back to Twilio for
+// voicemail
+const TrunkCallSIDHeader = "X-Call-Sid"
+
+// TrunkCallSID returns the caller's Twilio call SID of a trunk call, or an
+// empty string when it has none
+func TrunkCallSID(req *sip.Request) string {
+	if h := req.GetHeader(TrunkCallSIDHeader); h != nil {
+		return strings.TrimSpace(h.Value())
+	}
+	return ""
+}
+
+// HoldTimer reports calls that have been on hold for longer than a limit
+type HoldTimer struct {
+	mu       sync.Mutex
+	sessions *SessionManager
+	limit    time.Duration
+	expired  map[string]bool
+	onExpire func(*CallSession)
+}
+
+// NewHoldTimer creates a HoldTimer. onExpire is called once each time a call
+// stays on hold for limit.
+func NewHoldTimer(sessions *SessionManager, limit time.Duration, onExpire func(*CallSession)) *HoldTimer {
+	return &HoldTimer{
+		sessions: sessions,
+		limit:    limit,
+		expired:  make(map[string]bool),
+		onExpire: onExpire,
+	}
+}
+
+// Check compares every held call with the limit at now
+func (t *HoldTimer) Check(now time.Time) {
+	if t.limit <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	held := make(map[string]bool)
+	for _, session := range t.sessions.GetAll() {
+		state := session.GetState()
+		heldAt := session.HeldTime()
+		if (state != CallStateHeld && state != CallStateHolding) || heldAt == nil {
+			continue
+		}
+		held[session.CallID] = true
+
+		if now.Sub(*heldAt) >= t.limit && !t.expired[session.CallID] {
+			t.expired[session.CallID] = true
+			t.onExpire(session)
+		}
+	}
+
+	// Calls taken off hold start over the next time they are held
+	for callID := range t.expired {
+		if !held[callID] {
+			delete(t.expired, callID)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package sip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/events"
+)
+
+func TestTrunkCallSID(t *testing.T) {
+	if sid := TrunkCallSID(parseTestInvite(t, "X-Call-Sid: CA123")); sid != "CA123" {
+		t.Errorf("TrunkCallSID() = %q, want CA123", sid)
+	}
+	if sid := TrunkCallSID(parseTestInvite(t)); sid != "" {
+		t.Errorf("TrunkCallSID() = %q, want empty", sid)
+	}
+}
+
+func TestHoldTimer_Check(t *testing.T) {
+	sessions := NewSessionManager()
+	heldAt := time.Now()
+
+	held := &CallSession{CallID: "held", State: CallStateHolding, HeldAt: &heldAt}
+	active := &CallSession{CallID: "active", State: CallStateActive, HeldAt: &heldAt}
+	sessions.Add(held)
+	sessions.Add(active)
+
+	var expired []string
+	timer := NewHoldTimer(sessions, 5*time.Minute, func(s *CallSession) { expired = append(expired, s.CallID) })
+
+	timer.Check(heldAt.Add(4 * time.Minute))
+	if len(expired) != 0 {
+		t.Fatalf("Expected no expired calls yet, got %v", expired)
+	}
+
+	// Each hold is reported once
+	timer.Check(heldAt.Add(5 * time.Minute))
+	timer.Check(heldAt.Add(6 * time.Minute))
+	if len(expired) != 1 || expired[0] != "held" {
+		t.Fatalf("Expected the held call to expire once, got %v", expired)
+	}
+
+	// Holding the call again starts a new timer
+	held.SetState(CallStateActive)
+	timer.Check(heldAt.Add(7 * time.Minute))
+	held.SetState(CallStateHolding)
+	timer.Check(held.HeldTime().Add(5 * time.Minute))
+	if len(expired) != 2 {
+		t.Errorf("Expected the second hold to expire, got %v", expired)
+	}
+}
+
+func TestHoldTimer_Disabled(t *testing.T) {
+	sessions := NewSessionManager()
+	heldAt := time.Now()
+	sessions.Add(&CallSession{CallID: "held", State: CallStateHeld, HeldAt: &heldAt})
+
+	timer := NewHoldTimer(sessions, 0, func(s *CallSession) { t.Errorf("Unexpected expiry of %s", s.CallID) })
+	timer.Check(heldAt.Add(24 * time.Hour))
+}
+
+func TestServer_HoldTimedOut_Voicemail(t *testing.T) {
+	database := setupTestDB(t)
+	server, err := NewServer(Config{
+		Port:      5060,
+		UserAgent: "GoSIP-Test/1.0",
+		CallLimits: &config.CallLimitsConfig{
+			MaxHoldTime:       300,
+			HoldTimeoutAction: config.HoldTimeoutVoicemail,
+		},
+	}, database)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	hub := events.NewHub(8)
+	server.SetEventHub(hub)
+	_, published, cancel := hub.Subscribe(0)
+	defer cancel()
+
+	heldAt := time.Now().Add(-6 * time.Minute)
+	session := &CallSession{CallID: "held", State: CallStateHeld, HeldAt: &heldAt, TrunkCallSID: "CA123"}
+	server.sessions.Add(session)
+
+	server.holdTimer.Check(time.Now())
+
+	if session.GetState() != CallStateTerminated {
+		t.Errorf("Expected the phone's leg to end, got %s", session.GetState())
+	}
+	// The call ending is published first
+	for timedOut := false; !timedOut; {
+		select {
+		case e := <-published:
+			timedOut = e.Type == events.TypeCallHoldTimeout
+			if !timedOut && e.Type != events.TypeCallTerminated {
+				t.Errorf("Event type = %s, want %s", e.Type, events.TypeCallHoldTimeout)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected a hold timeout event")
+		}
+	}
+
+	if !server.TakeHoldDiversion("CA123") {
+		t.Error("Expected the call to be sent to voicemail")
+	}
+	if server.TakeHoldDiversion("CA123") {
+		t.Error("Expected the diversion to be forgotten once taken")
+	}
+}
@@ -0,0 +1,176 @@
+// Package sip provides IMDN read receipts (RFC 5438) for SIP MESSAGE clients
+package sip
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Content types used for SIP MESSAGE bodies
+const (
+	IMDNContentType = "message/imdn+xml"
+	CPIMContentType = "message/cpim"
+)
+
+// IMDN notification statuses
+const (
+	IMDNDelivered = "delivered"
+	IMDNDisplayed = "displayed"
+)
+
+// imdnMessageIDPrefix marks IMDN Message-IDs that refer to stored messages
+const imdnMessageIDPrefix = "gosip-"
+
+// IMDN is a delivery or display notification for one message
+type IMDN struct {
+	MessageID string
+	DateTime  time.Time
+	Status    string // IMDNDelivered or IMDNDisplayed
+}
+
+// imdnXML is the message/imdn+xml document
+type imdnXML struct {
+	XMLName   xml.Name          `xml:"urn:ietf:params:xml:ns:imdn imdn"`
+	MessageID string            `xml:"message-id"`
+	DateTime  string            `xml:"datetime"`
+	Delivery  *imdnNotification `xml:"delivery-notification,omitempty"`
+	Display   *imdnNotification `xml:"display-notification,omitempty"`
+}
+
+type imdnNotification struct {
+	Status struct {
+		Value struct {
+			XMLName xml.Name
+		} `xml:",any"`
+	} `xml:"status"`
+}
+
+// IMDNMessageID returns the IMDN Message-ID GoSIP gives a stored message
+func IMDNMessageID(messageID int64) string {
+	return imdnMessageIDPrefix + strconv.FormatInt(messageID, 10)
+}
+
+// ParseIMDNMessageID returns the stored message an IMDN Message-ID refers to
+func ParseIMDNMessageID(id string) (int64, bool) {
+	if !strings.HasPrefix(id, imdnMessageIDPrefix) {
+		return 0, false
+	}
+	messageID, err := strconv.ParseInt(strings.TrimPrefix(id, imdnMessageIDPrefix), 10, 64)
+	if err != nil || messageID <= 0 {
+		return 0, false
+	}
+	return messageID, true
+}
+
+// BuildCPIM wraps a text in a message/cpim body that asks the receiving
+// client for delivery and display notifications
+func BuildCPIM(from, to, messageID string, at time.Time, text string) []byte {
+	return cpimBody(from, to, messageID, at, "positive-delivery, display", "text/plain; charset=utf-8", []byte(text))
+}
+
+// WrapIMDN wraps a message/imdn+xml notification in message/cpim, which
+// RFC 5438 requires for IMDNs sent over SIP MESSAGE
+func WrapIMDN(from, to string, n IMDN, notification []byte) []byte {
+	return cpimBody(from, to, n.MessageID+"-"+n.Status, n.DateTime, "", IMDNContentType, notification)
+}
+
+// cpimBody builds a message/cpim body carrying content of contentType
+func cpimBody(from, to, messageID string, at time.Time, disposition, contentType string, content []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: <%s>\r\n", from)
+	fmt.Fprintf(&b, "To: <%s>\r\n", to)
+	b.WriteString("NS: imdn <urn:ietf:params:imdn>\r\n")
+	fmt.Fprintf(&b, "imdn.Message-ID: %s\r\n", messageID)
+	fmt.Fprintf(&b, "DateTime: %s\r\n", at.UTC().Format(time.RFC3339))
+	if disposition != "" {
+		fmt.Fprintf(&b, "imdn.Disposition-Notification: %s\r\n", disposition)
+	}
+	b.WriteString("\r\n")
+	fmt.Fprintf(&b, "Content-Type: %s\r\n", contentType)
+	b.WriteString("\r\n")
+	b.Write(content)
+	return b.Bytes()
+}
+
+// BuildIMDN encodes a notification as a message/imdn+xml body
+func BuildIMDN(n IMDN) ([]byte, error) {
+	doc := imdnXML{
+		MessageID: n.MessageID,
+		DateTime:  n.DateTime.UTC().Format(time.RFC3339),
+	}
+	notification := &imdnNotification{}
+	notification.Status.Value.XMLName = xml.Name{Local: n.Status}
+	switch n.Status {
+	case IMDNDelivered:
+		doc.Delivery = notification
+	case IMDNDisplayed:
+		doc.Display = notification
+	default:
+		return nil, fmt.Errorf("unsupported IMDN status %q", n.Status)
+	}
+
+	body, err := xml.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// ParseIMDN decodes a notification sent as message/imdn+xml, either directly
+// or wrapped in message/cpim as most clients send it
+func ParseIMDN(contentType string, body []byte) (*IMDN, error) {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if mediaType == CPIMContentType {
+		var err error
+		if mediaType, body, err = cpimContent(body); err != nil {
+			return nil, err
+		}
+	}
+	if mediaType != IMDNContentType {
+		return nil, fmt.Errorf("not an IMDN notification: %s", mediaType)
+	}
+
+	var doc imdnXML
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("invalid IMDN: %w", err)
+	}
+
+	n := &IMDN{MessageID: strings.TrimSpace(doc.MessageID)}
+	if t, err := time.Parse(time.RFC3339, strings.TrimSpace(doc.DateTime)); err == nil {
+		n.DateTime = t
+	}
+	switch {
+	case doc.Display != nil:
+		n.Status = doc.Display.Status.Value.XMLName.Local
+	case doc.Delivery != nil:
+		n.Status = doc.Delivery.Status.Value.XMLName.Local
+	}
+	if n.MessageID == "" || n.Status == "" {
+		return nil, fmt.Errorf("invalid IMDN: missing message-id or status")
+	}
+	return n, nil
+}
+
+// cpimContent returns the media type and body of the content a message/cpim
+// body carries. CPIM has a block of message headers, then content headers,
+// then the content, each separated by a blank line.
+func cpimContent(body []byte) (string, []byte, error) {
+	normalized := bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))
+	parts := bytes.SplitN(normalized, []byte("\n\n"), 3)
+	if len(parts) < 3 {
+		return "", nil, fmt.Errorf("invalid CPIM body")
+	}
+
+	var mediaType string
+	for _, line := range strings.Split(string(parts[1]), "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Type") {
+			mediaType = strings.ToLower(strings.TrimSpace(strings.Split(value, ";")[0]))
+		}
+	}
+	return mediaType, parts[2], nil
+}
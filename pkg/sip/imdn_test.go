@@ -0,0 +1,103 @@
+package sip
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIMDNMessageID(t *testing.T) {
+	id := IMDNMessageID(42)
+	if id != "gosip-42" {
+		t.Errorf("Expected gosip-42, got %s", id)
+	}
+
+	tests := []struct {
+		id   string
+		want int64
+		ok   bool
+	}{
+		{"gosip-42", 42, true},
+		{"gosip-0", 0, false},
+		{"gosip-abc", 0, false},
+		{"34a2bc1f", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseIMDNMessageID(tt.id)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseIMDNMessageID(%q) = %d, %v; want %d, %v", tt.id, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBuildIMDN_RoundTrip(t *testing.T) {
+	at := time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC)
+	for _, status := range []string{IMDNDelivered, IMDNDisplayed} {
+		body, err := BuildIMDN(IMDN{MessageID: "gosip-7", DateTime: at, Status: status})
+		if err != nil {
+			t.Fatalf("BuildIMDN failed: %v", err)
+		}
+
+		n, err := ParseIMDN(IMDNContentType, body)
+		if err != nil {
+			t.Fatalf("ParseIMDN failed: %v", err)
+		}
+		if n.MessageID != "gosip-7" || n.Status != status || !n.DateTime.Equal(at) {
+			t.Errorf("Unexpected round trip result: %+v", n)
+		}
+	}
+
+	if _, err := BuildIMDN(IMDN{MessageID: "gosip-7", Status: "processed"}); err == nil {
+		t.Error("Expected error for unsupported status")
+	}
+}
+
+func TestParseIMDN_CPIM(t *testing.T) {
+	// Display notification as sent by a softphone, wrapped in CPIM with LF line endings
+	body := strings.Join([]string{
+		"From: <sip:alice@gosip.local>",
+		"To: <sip:+15559876543@gosip.local>",
+		"NS: imdn <urn:ietf:params:imdn>",
+		"imdn.Message-ID: 1a2b3c",
+		"",
+		"Content-Type: message/imdn+xml",
+		"Content-Disposition: notification",
+		"",
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<imdn xmlns="urn:ietf:params:xml:ns:imdn">`,
+		`<message-id>gosip-12</message-id>`,
+		`<datetime>2026-03-14T09:30:00Z</datetime>`,
+		`<display-notification><status><displayed/></status></display-notification>`,
+		`</imdn>`,
+	}, "\n")
+
+	n, err := ParseIMDN("message/cpim", []byte(body))
+	if err != nil {
+		t.Fatalf("ParseIMDN failed: %v", err)
+	}
+	if n.MessageID != "gosip-12" || n.Status != IMDNDisplayed {
+		t.Errorf("Unexpected notification: %+v", n)
+	}
+
+	// Our own wrapped receipts parse back the same way
+	receipt := IMDN{MessageID: "gosip-12", DateTime: time.Now(), Status: IMDNDisplayed}
+	xmlBody, err := BuildIMDN(receipt)
+	if err != nil {
+		t.Fatalf("BuildIMDN failed: %v", err)
+	}
+	wrapped := WrapIMDN("sip:+15551234567@gosip.local", "sip:alice@gosip.local", receipt, xmlBody)
+	if n, err := ParseIMDN(CPIMContentType, wrapped); err != nil || n.MessageID != "gosip-12" {
+		t.Errorf("Failed to parse wrapped receipt: %+v, %v", n, err)
+	}
+}
+
+func TestParseIMDN_NotNotification(t *testing.T) {
+	if _, err := ParseIMDN("text/plain", []byte("hello")); err == nil {
+		t.Error("Expected error for text/plain body")
+	}
+
+	text := BuildCPIM("sip:a@gosip.local", "sip:b@gosip.local", "gosip-1", time.Now(), "hello")
+	if _, err := ParseIMDN(CPIMContentType, text); err == nil {
+		t.Error("Expected error for CPIM-wrapped text")
+	}
+}
@@ -0,0 +1,122 @@
+// Package sip provides intercom auto-answer calls between GoSIP devices
+package sip
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+)
+
+// IntercomHeader marks an INVITE as an intercom call for clients that
+// can't dial the intercom prefix, such as softphones driven by the API
+const IntercomHeader = "X-GoSIP-Intercom"
+
+// autoAnswerAlertInfo is the Alert-Info class phones map to auto-answer
+const autoAnswerAlertInfo = "alert-autoanswer"
+
+// IntercomTarget returns the username an intercom INVITE is for. A call is
+// an intercom call when the dialed user starts with prefix, or when it
+// carries IntercomHeader set to "1", "true" or "yes".
+func IntercomTarget(req *sip.Request, prefix string) (string, bool) {
+	user := req.Recipient.User
+	if prefix != "" && strings.HasPrefix(user, prefix) && len(user) > len(prefix) {
+		return strings.TrimPrefix(user, prefix), true
+	}
+	if h := req.GetHeader(IntercomHeader); h != nil && user != "" {
+		switch strings.ToLower(strings.TrimSpace(h.Value())) {
+		case "1", "true", "yes":
+			return user, true
+		}
+	}
+	return "", false
+}
+
+// AddAutoAnswer asks the callee phone to answer immediately. Polycom phones
+// act on an Alert-Info class; Yealink, Grandstream, Snom and Linphone act
+// on Call-Info answer-after. Unknown vendors get both.
+func AddAutoAnswer(req *sip.Request, vendor string) {
+	req.RemoveHeader(IntercomHeader)
+	SetAlertInfo(req, "")
+
+	callInfo := fmt.Sprintf("<sip:%s>;answer-after=0", req.Recipient.Host)
+	switch strings.ToLower(vendor) {
+	case "polycom":
+		req.AppendHeader(sip.NewHeader("Alert-Info", AlertInfoValue(autoAnswerAlertInfo)))
+	case "yealink", "grandstream", "snom", "linphone":
+		req.AppendHeader(sip.NewHeader("Call-Info", callInfo))
+	default:
+		req.AppendHeader(sip.NewHeader("Alert-Info", AlertInfoValue(autoAnswerAlertInfo)))
+		req.AppendHeader(sip.NewHeader("Call-Info", callInfo))
+	}
+}
+
+// deviceVendor returns the provisioning vendor of a device, falling back to its type
+func deviceVendor(device *models.Device) string {
+	if device.Vendor != nil && *device.Vendor != "" {
+		return *device.Vendor
+	}
+	return device.DeviceType
+}
+
+// intercomPrefix returns the configured intercom dialing prefix
+func (s *Server) intercomPrefix(ctx context.Context) string {
+	if s.db == nil {
+		return config.DefaultIntercomPrefix
+	}
+	return s.db.Config.GetWithDefault(ctx, "intercom_prefix", config.DefaultIntercomPrefix)
+}
+
+// handleIntercom relays an authenticated device's intercom call to the
+// callee device of its tenant, found by extension or username, with
+// auto-answer headers. Devices that have not allowed intercom calls reject
+// them with 403 rather than ringing normally.
+func (s *Server) handleIntercom(ctx context.Context, req *sip.Request, tx sip.ServerTransaction, session *CallSession, caller *models.Device, target string) {
+	callee, err := s.db.Devices.GetByExtension(ctx, caller.TenantID, target)
+	if err != nil {
+		callee, err = s.db.Devices.GetByUsername(ctx, target)
+	}
+	if err != nil || !sameTenant(callee.TenantID, caller.TenantID) {
+		s.releaseCall(session)
+		s.sendResponse(tx, req, sip.StatusNotFound, "Not Found")
+		return
+	}
+	if !callee.IntercomAllowed {
+		slog.Info("Intercom call refused by device",
+			"call_id", session.CallID,
+			"caller", caller.Username,
+			"callee", callee.Username,
+		)
+		s.releaseCall(session)
+		s.sendResponse(tx, req, sip.StatusForbidden, "Intercom Not Allowed")
+		return
+	}
+	if s.sessions.IsDeviceBusy(callee.ID) {
+		s.releaseCall(session)
+		s.sendResponse(tx, req, sip.StatusBusyHere, "Busy Here")
+		return
+	}
+
+	reg, err := s.registrar.GetRegistration(ctx, callee.ID)
+	if err != nil {
+		s.releaseCall(session)
+		s.sendResponse(tx, req, sip.StatusTemporarilyUnavailable, "Temporarily Unavailable")
+		return
+	}
+
+	session.Intercom = true
+	slog.Info("Intercom call",
+		"call_id", session.CallID,
+		"caller", caller.Username,
+		"callee", callee.Username,
+	)
+
+	vendor := deviceVendor(callee)
+	s.forwardToDevice(req, tx, session, reg, func(fwd *sip.Request) {
+		AddAutoAnswer(fwd, vendor)
+	})
+}
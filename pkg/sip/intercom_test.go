@@ -0,0 +1,143 @@
+package sip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/siptest"
+	"github.com/emiago/sipgo/sip"
+)
+
+func TestIntercomTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		uri     string
+		headers []string
+		want    string
+		ok      bool
+	}{
+		{"prefix", "INVITE sip:*80kitchen@gosip.local SIP/2.0", nil, "kitchen", true},
+		{"prefix only", "INVITE sip:*80@gosip.local SIP/2.0", nil, "", false},
+		{"header flag", "INVITE sip:kitchen@gosip.local SIP/2.0", []string{"X-GoSIP-Intercom: true"}, "kitchen", true},
+		{"header off", "INVITE sip:kitchen@gosip.local SIP/2.0", []string{"X-GoSIP-Intercom: 0"}, "", false},
+		{"plain call", "INVITE sip:kitchen@gosip.local SIP/2.0", nil, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := parseTestInvite(t, tt.headers...)
+			var uri sip.Uri
+			if err := sip.ParseUri(tt.uri[len("INVITE "):len(tt.uri)-len(" SIP/2.0")], &uri); err != nil {
+				t.Fatalf("Failed to parse URI: %v", err)
+			}
+			req.Recipient = uri
+
+			got, ok := IntercomTarget(req, "*80")
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("IntercomTarget() = %q, %v; want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAddAutoAnswer(t *testing.T) {
+	tests := []struct {
+		vendor    string
+		alertInfo bool
+		callInfo  bool
+	}{
+		{"polycom", true, false},
+		{"yealink", false, true},
+		{"grandstream", false, true},
+		{"webrtc", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.vendor, func(t *testing.T) {
+			req := parseTestInvite(t, "Alert-Info: <http://127.0.0.1>;info=vip", "X-GoSIP-Intercom: 1")
+			AddAutoAnswer(req, tt.vendor)
+
+			alert := req.GetHeader("Alert-Info")
+			if tt.alertInfo {
+				if alert == nil || alert.Value() != "<http://127.0.0.1>;info=alert-autoanswer" {
+					t.Errorf("Expected auto-answer Alert-Info, got %v", alert)
+				}
+			} else if alert != nil {
+				t.Errorf("Expected no Alert-Info, got %s", alert.Value())
+			}
+
+			callInfo := req.GetHeader("Call-Info")
+			if tt.callInfo {
+				if callInfo == nil || callInfo.Value() != "<sip:gosip.local>;answer-after=0" {
+					t.Errorf("Expected answer-after Call-Info, got %v", callInfo)
+				}
+			} else if callInfo != nil {
+				t.Errorf("Expected no Call-Info, got %s", callInfo.Value())
+			}
+
+			if req.GetHeader(IntercomHeader) != nil {
+				t.Error("Expected intercom flag to be stripped before relaying")
+			}
+		})
+	}
+}
+
+func TestForwardRequest(t *testing.T) {
+	req := parseTestInvite(t)
+	sdp := []byte("v=0\r\nm=audio 4000 RTP/AVP 0\r\n")
+	req.SetBody(sdp)
+
+	fwd, err := forwardRequest(req, "sip:kitchen@192.168.1.20:5062;transport=udp")
+	if err != nil {
+		t.Fatalf("forwardRequest failed: %v", err)
+	}
+	if fwd.Recipient.Host != "192.168.1.20" || fwd.Recipient.Port != 5062 {
+		t.Errorf("Expected request retargeted at the contact, got %s", fwd.Recipient.String())
+	}
+	if string(fwd.Body()) != string(sdp) {
+		t.Errorf("Expected the SDP relayed, got %q", fwd.Body())
+	}
+	if req.Recipient.Host != "gosip.local" {
+		t.Error("Original request must not be modified")
+	}
+}
+
+func TestServer_HandleIntercom_NotAllowed(t *testing.T) {
+	database := setupTestDB(t)
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0"}, database)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	ctx := context.Background()
+
+	caller := &models.Device{Name: "Office", Username: "office", PasswordHash: "x", DeviceType: "grandstream"}
+	callee := &models.Device{Name: "Kitchen", Username: "kitchen", PasswordHash: "x", DeviceType: "grandstream"}
+	for _, d := range []*models.Device{caller, callee} {
+		if err := database.Devices.Create(ctx, d); err != nil {
+			t.Fatalf("Failed to create device: %v", err)
+		}
+	}
+
+	req := parseTestInvite(t, "Max-Forwards: 70")
+	tx := siptest.NewServerTxRecorder(req)
+	session := NewCallSession(req, CallDirectionOutbound)
+	session.DeviceID = caller.ID
+	server.sessions.Add(session)
+	if err := server.limiter.Acquire(session.CallID, "", caller.ID); err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	server.handleIntercom(ctx, req, tx, session, caller, "kitchen")
+
+	res := tx.Result()
+	if len(res) != 1 || res[0].StatusCode != sip.StatusForbidden {
+		t.Fatalf("Expected 403 for device without intercom, got %v", res)
+	}
+	if server.sessions.Get(session.CallID) != nil {
+		t.Error("Expected refused intercom session to be removed")
+	}
+	if server.limiter.Active() != 0 {
+		t.Error("Expected refused intercom call to release its limiter slot")
+	}
+}
@@ -0,0 +1,96 @@
+// Package sip provides per-call jitter buffers for GoSIP
+package sip
+
+import (
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/codec"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/jitter"
+)
+
+// JitterBufferManager keeps a jitter buffer for each call whose RTP passes
+// through GoSIP, so audio from phones on flaky Wi-Fi is reordered, held
+// for an adaptive playout delay and concealed where packets are lost
+type JitterBufferManager struct {
+	cfg     jitter.Config
+	buffers map[string]*jitter.Buffer // keyed by call ID
+	mu      sync.RWMutex
+}
+
+// NewJitterBufferManager creates a JitterBufferManager with the configured
+// playout delay bounds
+func NewJitterBufferManager(media *config.MediaConfig) *JitterBufferManager {
+	minDelay, maxDelay := config.DefaultJitterMinDelay, config.DefaultJitterMaxDelay
+	if media != nil && media.JitterMinDelay > 0 {
+		minDelay = media.JitterMinDelay
+	}
+	if media != nil && media.JitterMaxDelay > 0 {
+		maxDelay = media.JitterMaxDelay
+	}
+	return &JitterBufferManager{
+		cfg: jitter.Config{
+			MinDelay: time.Duration(minDelay) * time.Millisecond,
+			MaxDelay: time.Duration(maxDelay) * time.Millisecond,
+		},
+		buffers: make(map[string]*jitter.Buffer),
+	}
+}
+
+// GetOrCreate returns the jitter buffer of a call, creating it for a stream
+// with the given RTP clock rate
+func (m *JitterBufferManager) GetOrCreate(callID string, clockRate int) *jitter.Buffer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if b, ok := m.buffers[callID]; ok {
+		return b
+	}
+	cfg := m.cfg
+	cfg.ClockRate = clockRate
+	b := jitter.New(cfg)
+	m.buffers[callID] = b
+	return b
+}
+
+// Get retrieves the jitter buffer of a call
+func (m *JitterBufferManager) Get(callID string) (*jitter.Buffer, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	b, ok := m.buffers[callID]
+	return b, ok
+}
+
+// Stats returns the jitter buffer statistics of a call
+func (m *JitterBufferManager) Stats(callID string) (jitter.Stats, bool) {
+	b, ok := m.Get(callID)
+	if !ok {
+		return jitter.Stats{}, false
+	}
+	return b.Stats(), true
+}
+
+// Remove drops the jitter buffer of a call
+func (m *JitterBufferManager) Remove(callID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.buffers, callID)
+}
+
+// JitterBufferForCall returns the jitter buffer for the RTP of a call,
+// sized for its negotiated codec
+func (s *Server) JitterBufferForCall(session *CallSession) *jitter.Buffer {
+	clockRate := codec.PCMU.ClockRate
+	if c, ok := codec.Lookup(session.Codec); ok {
+		clockRate = c.ClockRate
+	}
+	return s.jitterMgr.GetOrCreate(session.CallID, clockRate)
+}
+
+// GetJitterStats returns the jitter buffer statistics of a call, when its
+// RTP passes through GoSIP
+func (s *Server) GetJitterStats(callID string) (jitter.Stats, bool) {
+	return s.jitterMgr.Stats(callID)
+}
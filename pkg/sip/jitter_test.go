@@ -0,0 +1,55 @@
+package sip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/pion/rtp"
+)
+
+func TestJitterBufferManager(t *testing.T) {
+	m := NewJitterBufferManager(&config.MediaConfig{JitterMinDelay: 60, JitterMaxDelay: 120})
+	if m.cfg.MinDelay != 60*time.Millisecond || m.cfg.MaxDelay != 120*time.Millisecond {
+		t.Errorf("Unexpected delay bounds %v/%v", m.cfg.MinDelay, m.cfg.MaxDelay)
+	}
+	if d := NewJitterBufferManager(nil).cfg.MaxDelay; d != config.DefaultJitterMaxDelay*time.Millisecond {
+		t.Errorf("Default max delay = %v", d)
+	}
+
+	if _, ok := m.Stats("call-1"); ok {
+		t.Error("Expected no stats before the call has a buffer")
+	}
+	b := m.GetOrCreate("call-1", 8000)
+	if m.GetOrCreate("call-1", 8000) != b {
+		t.Error("Expected the call's buffer to be reused")
+	}
+	b.Push(&rtp.Packet{Header: rtp.Header{SequenceNumber: 1}}, time.Now())
+	if stats, ok := m.Stats("call-1"); !ok || stats.Received != 1 || stats.DelayMs != 60 {
+		t.Errorf("Stats = %+v, %v", stats, ok)
+	}
+
+	m.Remove("call-1")
+	if _, ok := m.Get("call-1"); ok {
+		t.Error("Expected the buffer to be removed")
+	}
+}
+
+func TestServer_JitterBufferForCall(t *testing.T) {
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0"}, setupTestDB(t))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	// Opus timestamps run at 48 kHz, so 20 ms apart is 960 units
+	b := server.JitterBufferForCall(&CallSession{CallID: "opus-call", Codec: "opus"})
+	start := time.Now()
+	for seq := uint16(0); seq < 50; seq++ {
+		b.Push(&rtp.Packet{Header: rtp.Header{SequenceNumber: seq, Timestamp: uint32(seq) * 960}},
+			start.Add(time.Duration(seq)*20*time.Millisecond))
+	}
+	stats, ok := server.GetJitterStats("opus-call")
+	if !ok || stats.JitterMs != 0 || stats.DelayMs != config.DefaultJitterMinDelay {
+		t.Errorf("Expected a steady Opus stream at the minimum delay, got %+v, %v", stats, ok)
+	}
+}
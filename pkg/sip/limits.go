@@ -0,0 +1,149 @@
+// Package sip provides concurrent call limiting for GoSIP
+package sip
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/emiago/sipgo/sip"
+)
+
+// LimitScope identifies which concurrency cap rejected a call
+type LimitScope string
+
+const (
+	LimitScopeGlobal LimitScope = "global"
+	LimitScopeDID    LimitScope = "did"
+	LimitScopeDevice LimitScope = "device"
+)
+
+// LimitError is returned when admitting a call would exceed a concurrency cap
+type LimitError struct {
+	Scope  LimitScope
+	Key    string // DID number or device ID; empty for the global cap
+	Limit  int
+	Active int
+}
+
+func (e *LimitError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("%s call limit reached (%d/%d)", e.Scope, e.Active, e.Limit)
+	}
+	return fmt.Sprintf("%s call limit reached for %s (%d/%d)", e.Scope, e.Key, e.Active, e.Limit)
+}
+
+// StatusCode returns the SIP response used to reject the call. Server-wide
+// exhaustion is reported as 503 so upstream carriers can fail over, while a
+// single busy DID or device is reported as 486 Busy Here.
+func (e *LimitError) StatusCode() (sip.StatusCode, string) {
+	if e.Scope == LimitScopeGlobal {
+		return sip.StatusServiceUnavailable, "Service Unavailable"
+	}
+	return sip.StatusBusyHere, "Busy Here"
+}
+
+// callSlot records which counters a call holds so it can release them
+type callSlot struct {
+	did      string
+	deviceID int64
+}
+
+// CallLimiter enforces global, per-DID and per-device concurrent call caps
+type CallLimiter struct {
+	mu        sync.Mutex
+	cfg       config.CallLimitsConfig
+	calls     map[string]callSlot
+	perDID    map[string]int
+	perDevice map[int64]int
+}
+
+// NewCallLimiter creates a limiter. A nil config disables all caps.
+func NewCallLimiter(cfg *config.CallLimitsConfig) *CallLimiter {
+	l := &CallLimiter{
+		calls:     make(map[string]callSlot),
+		perDID:    make(map[string]int),
+		perDevice: make(map[int64]int),
+	}
+	if cfg != nil {
+		l.cfg = *cfg
+	}
+	return l
+}
+
+// Acquire admits a call, counting it against the global cap and, when set,
+// the DID and device caps. An empty did or zero deviceID skips that cap.
+// Acquiring an already admitted call ID is a no-op.
+func (l *CallLimiter) Acquire(callID, did string, deviceID int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.calls[callID]; ok {
+		return nil
+	}
+
+	if l.cfg.MaxCalls > 0 && len(l.calls) >= l.cfg.MaxCalls {
+		return &LimitError{Scope: LimitScopeGlobal, Limit: l.cfg.MaxCalls, Active: len(l.calls)}
+	}
+	if did != "" && l.cfg.MaxCallsPerDID > 0 && l.perDID[did] >= l.cfg.MaxCallsPerDID {
+		return &LimitError{Scope: LimitScopeDID, Key: did, Limit: l.cfg.MaxCallsPerDID, Active: l.perDID[did]}
+	}
+	if deviceID != 0 && l.cfg.MaxCallsPerDevice > 0 && l.perDevice[deviceID] >= l.cfg.MaxCallsPerDevice {
+		return &LimitError{
+			Scope:  LimitScopeDevice,
+			Key:    fmt.Sprintf("%d", deviceID),
+			Limit:  l.cfg.MaxCallsPerDevice,
+			Active: l.perDevice[deviceID],
+		}
+	}
+
+	l.calls[callID] = callSlot{did: did, deviceID: deviceID}
+	if did != "" {
+		l.perDID[did]++
+	}
+	if deviceID != 0 {
+		l.perDevice[deviceID]++
+	}
+	return nil
+}
+
+// Release frees the slots held by a call. Unknown call IDs are ignored.
+func (l *CallLimiter) Release(callID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	slot, ok := l.calls[callID]
+	if !ok {
+		return
+	}
+	delete(l.calls, callID)
+
+	if slot.did != "" {
+		if l.perDID[slot.did] <= 1 {
+			delete(l.perDID, slot.did)
+		} else {
+			l.perDID[slot.did]--
+		}
+	}
+	if slot.deviceID != 0 {
+		if l.perDevice[slot.deviceID] <= 1 {
+			delete(l.perDevice, slot.deviceID)
+		} else {
+			l.perDevice[slot.deviceID]--
+		}
+	}
+}
+
+// Active returns the number of admitted calls
+func (l *CallLimiter) Active() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.calls)
+}
+
+// Limits returns the configured caps
+func (l *CallLimiter) Limits() config.CallLimitsConfig {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cfg
+}
@@ -0,0 +1,135 @@
+package sip
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/emiago/sipgo/sip"
+)
+
+func TestCallLimiter_GlobalLimit(t *testing.T) {
+	l := NewCallLimiter(&config.CallLimitsConfig{MaxCalls: 2})
+
+	if err := l.Acquire("call-1", "", 0); err != nil {
+		t.Fatalf("Acquire call-1: %v", err)
+	}
+	if err := l.Acquire("call-2", "", 0); err != nil {
+		t.Fatalf("Acquire call-2: %v", err)
+	}
+
+	err := l.Acquire("call-3", "", 0)
+	limitErr, ok := err.(*LimitError)
+	if !ok {
+		t.Fatalf("Expected *LimitError, got %v", err)
+	}
+	if limitErr.Scope != LimitScopeGlobal {
+		t.Errorf("Scope = %s, want global", limitErr.Scope)
+	}
+	if code, _ := limitErr.StatusCode(); code != sip.StatusServiceUnavailable {
+		t.Errorf("StatusCode = %d, want 503", code)
+	}
+
+	l.Release("call-1")
+	if err := l.Acquire("call-3", "", 0); err != nil {
+		t.Errorf("Acquire after release: %v", err)
+	}
+}
+
+func TestCallLimiter_PerDIDLimit(t *testing.T) {
+	l := NewCallLimiter(&config.CallLimitsConfig{MaxCallsPerDID: 1})
+
+	if err := l.Acquire("call-1", "+15551234567", 0); err != nil {
+		t.Fatalf("Acquire call-1: %v", err)
+	}
+
+	err := l.Acquire("call-2", "+15551234567", 0)
+	limitErr, ok := err.(*LimitError)
+	if !ok {
+		t.Fatalf("Expected *LimitError, got %v", err)
+	}
+	if limitErr.Scope != LimitScopeDID || limitErr.Key != "+15551234567" {
+		t.Errorf("Unexpected limit error: %+v", limitErr)
+	}
+	if code, _ := limitErr.StatusCode(); code != sip.StatusBusyHere {
+		t.Errorf("StatusCode = %d, want 486", code)
+	}
+
+	// Other DIDs are unaffected
+	if err := l.Acquire("call-3", "+15557654321", 0); err != nil {
+		t.Errorf("Acquire for other DID: %v", err)
+	}
+}
+
+func TestCallLimiter_PerDeviceLimit(t *testing.T) {
+	l := NewCallLimiter(&config.CallLimitsConfig{MaxCallsPerDevice: 1})
+
+	if err := l.Acquire("call-1", "", 7); err != nil {
+		t.Fatalf("Acquire call-1: %v", err)
+	}
+	err := l.Acquire("call-2", "", 7)
+	if limitErr, ok := err.(*LimitError); !ok || limitErr.Scope != LimitScopeDevice {
+		t.Fatalf("Expected device limit error, got %v", err)
+	}
+
+	l.Release("call-1")
+	if err := l.Acquire("call-2", "", 7); err != nil {
+		t.Errorf("Acquire after release: %v", err)
+	}
+}
+
+func TestCallLimiter_DuplicateAndUnknown(t *testing.T) {
+	l := NewCallLimiter(&config.CallLimitsConfig{MaxCalls: 1})
+
+	if err := l.Acquire("call-1", "", 0); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	// Retransmitted INVITE must not count twice
+	if err := l.Acquire("call-1", "", 0); err != nil {
+		t.Errorf("Duplicate acquire should be a no-op: %v", err)
+	}
+	if l.Active() != 1 {
+		t.Errorf("Active = %d, want 1", l.Active())
+	}
+
+	l.Release("unknown")
+	l.Release("call-1")
+	l.Release("call-1")
+	if l.Active() != 0 {
+		t.Errorf("Active = %d, want 0", l.Active())
+	}
+}
+
+func TestCallLimiter_NilConfigUnlimited(t *testing.T) {
+	l := NewCallLimiter(nil)
+	for i := 0; i < 100; i++ {
+		if err := l.Acquire(fmt.Sprintf("call-%d", i), "+15551234567", 1); err != nil {
+			t.Fatalf("Acquire %d: %v", i, err)
+		}
+	}
+}
+
+func TestCallLimiter_Concurrency(t *testing.T) {
+	l := NewCallLimiter(&config.CallLimitsConfig{MaxCalls: 10})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	admitted := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if l.Acquire(fmt.Sprintf("call-%d", i), "", 0) == nil {
+				mu.Lock()
+				admitted++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if admitted != 10 {
+		t.Errorf("Admitted %d calls, want 10", admitted)
+	}
+}
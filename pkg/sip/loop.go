@@ -0,0 +1,181 @@
+// Package sip provides Max-Forwards enforcement and loop detection for GoSIP
+package sip
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// DefaultMaxForwards is the Max-Forwards value for requests GoSIP originates (RFC 3261 8.1.1.6)
+const DefaultMaxForwards = 70
+
+// loopBranchPrefix marks Via branches added by GoSIP. It starts with the
+// RFC 3261 magic cookie so the branch remains a valid transaction ID.
+const loopBranchPrefix = "z9hG4bK-gosip-"
+
+// LoopReason identifies why a request was rejected as looping
+type LoopReason string
+
+const (
+	LoopReasonTooManyHops LoopReason = "too_many_hops"
+	LoopReasonVia         LoopReason = "via_branch"
+	LoopReasonHistoryInfo LoopReason = "history_info"
+)
+
+// LoopError is returned when a request has looped back to GoSIP
+type LoopError struct {
+	Reason LoopReason
+	Path   []string // Hops the request traversed, oldest first
+}
+
+func (e *LoopError) Error() string {
+	if len(e.Path) == 0 {
+		return fmt.Sprintf("request loop detected (%s)", e.Reason)
+	}
+	return fmt.Sprintf("request loop detected (%s): %s", e.Reason, strings.Join(e.Path, " -> "))
+}
+
+// StatusCode returns the SIP response used to reject the request
+func (e *LoopError) StatusCode() (sip.StatusCode, string) {
+	if e.Reason == LoopReasonTooManyHops {
+		return sip.StatusTooManyHops, "Too Many Hops"
+	}
+	return sip.StatusLoopDetected, "Loop Detected"
+}
+
+// CheckLoop inspects an incoming request for exhausted Max-Forwards and for
+// signs that GoSIP has already forwarded it. A Via carrying a GoSIP branch
+// whose hash matches the request is a loop; a non-matching GoSIP branch is a
+// spiral (the request was retargeted) and is allowed, per RFC 3261 16.3.
+// A History-Info chain that already contains the Request-URI target is
+// also treated as a loop so forwarding rules that point at each other are
+// stopped even when intermediate hops rewrite Via.
+func CheckLoop(req *sip.Request) error {
+	if mf := req.MaxForwards(); mf != nil && mf.Val() == 0 {
+		return &LoopError{Reason: LoopReasonTooManyHops, Path: viaPath(req)}
+	}
+
+	branch := LoopBranch(req)
+	for _, h := range req.GetHeaders("Via") {
+		via, ok := h.(*sip.ViaHeader)
+		if !ok {
+			continue
+		}
+		if b, _ := via.Params.Get("branch"); b == branch {
+			return &LoopError{Reason: LoopReasonVia, Path: viaPath(req)}
+		}
+	}
+
+	history := historyInfoTargets(req)
+	target := req.Recipient.User
+	if target != "" && len(history) > 1 {
+		// The last entry is the current target; any earlier match means the
+		// diversion chain has returned to a number it already visited.
+		for _, uri := range history[:len(history)-1] {
+			if uriUser(uri) == target {
+				return &LoopError{Reason: LoopReasonHistoryInfo, Path: history}
+			}
+		}
+	}
+
+	return nil
+}
+
+// LoopBranch returns the Via branch GoSIP uses when forwarding req. It hashes
+// the fields that determine where the request is routed so a request that
+// comes back unchanged produces the same branch.
+func LoopBranch(req *sip.Request) string {
+	h := sha1.New()
+	h.Write([]byte(req.Recipient.String()))
+	if from := req.From(); from != nil {
+		tag, _ := from.Params.Get("tag")
+		h.Write([]byte(tag))
+	}
+	if callID := req.CallID(); callID != nil {
+		h.Write([]byte(callID.Value()))
+	}
+	if cseq := req.CSeq(); cseq != nil {
+		h.Write([]byte(fmt.Sprintf("%d", cseq.SeqNo)))
+	}
+	return loopBranchPrefix + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// PrepareForward readies a request for forwarding by decrementing
+// Max-Forwards and prepending a Via with the loop detection branch.
+// It returns a LoopError when the request has no hops left.
+func PrepareForward(req *sip.Request, via *sip.ViaHeader) error {
+	mf := req.MaxForwards()
+	if mf == nil {
+		v := sip.MaxForwardsHeader(DefaultMaxForwards)
+		mf = &v
+		req.AppendHeader(mf)
+	}
+	if mf.Val() == 0 {
+		return &LoopError{Reason: LoopReasonTooManyHops, Path: viaPath(req)}
+	}
+	mf.Dec()
+
+	if via != nil {
+		via = via.Clone()
+		if via.Params == nil {
+			via.Params = sip.NewParams()
+		}
+		via.Params.Add("branch", LoopBranch(req))
+		req.PrependHeader(via)
+	}
+	return nil
+}
+
+// viaPath lists the sent-by of each Via, oldest hop first
+func viaPath(req *sip.Request) []string {
+	vias := req.GetHeaders("Via")
+	path := make([]string, 0, len(vias))
+	for i := len(vias) - 1; i >= 0; i-- {
+		if via, ok := vias[i].(*sip.ViaHeader); ok {
+			path = append(path, via.SentBy())
+			continue
+		}
+		path = append(path, vias[i].Value())
+	}
+	return path
+}
+
+// historyInfoTargets returns the URIs recorded in History-Info headers (RFC 7044)
+func historyInfoTargets(req *sip.Request) []string {
+	var targets []string
+	for _, h := range req.GetHeaders("History-Info") {
+		for _, entry := range strings.Split(h.Value(), ",") {
+			entry = strings.TrimSpace(entry)
+			start := strings.Index(entry, "<")
+			end := strings.Index(entry, ">")
+			if start < 0 || end <= start {
+				continue
+			}
+			uri := entry[start+1 : end]
+			// Drop embedded headers and URI parameters such as ?Reason=...
+			if i := strings.IndexAny(uri, "?;"); i >= 0 {
+				uri = uri[:i]
+			}
+			targets = append(targets, uri)
+		}
+	}
+	return targets
+}
+
+// uriUser returns the user part of a sip, sips or tel URI
+func uriUser(uri string) string {
+	for _, scheme := range []string{"sip:", "sips:", "tel:"} {
+		if strings.HasPrefix(uri, scheme) {
+			uri = uri[len(scheme):]
+			break
+		}
+	}
+	if i := strings.Index(uri, "@"); i >= 0 {
+		return uri[:i]
+	}
+	return uri
+}
@@ -0,0 +1,165 @@
+package sip
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+func parseTestInvite(t *testing.T, extraHeaders ...string) *sip.Request {
+	t.Helper()
+
+	lines := []string{
+		"INVITE sip:+15551234567@gosip.local SIP/2.0",
+		"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bK776asdhds",
+		"From: <sip:+15559876543@carrier.example>;tag=1928301774",
+		"To: <sip:+15551234567@gosip.local>",
+		"Call-ID: a84b4c76e66710@carrier.example",
+		"CSeq: 314159 INVITE",
+	}
+	lines = append(lines, extraHeaders...)
+	raw := strings.Join(lines, "\r\n") + "\r\nContent-Length: 0\r\n\r\n"
+
+	msg, err := sip.ParseMessage([]byte(raw))
+	if err != nil {
+		t.Fatalf("Failed to parse test INVITE: %v", err)
+	}
+	req, ok := msg.(*sip.Request)
+	if !ok {
+		t.Fatalf("Parsed message is not a request")
+	}
+	return req
+}
+
+func TestCheckLoop_CleanRequest(t *testing.T) {
+	req := parseTestInvite(t, "Max-Forwards: 70")
+	if err := CheckLoop(req); err != nil {
+		t.Errorf("Expected no loop, got %v", err)
+	}
+}
+
+func TestCheckLoop_MaxForwardsExhausted(t *testing.T) {
+	req := parseTestInvite(t, "Max-Forwards: 0")
+
+	err := CheckLoop(req)
+	loopErr, ok := err.(*LoopError)
+	if !ok {
+		t.Fatalf("Expected *LoopError, got %v", err)
+	}
+	if loopErr.Reason != LoopReasonTooManyHops {
+		t.Errorf("Reason = %s, want %s", loopErr.Reason, LoopReasonTooManyHops)
+	}
+	if code, _ := loopErr.StatusCode(); code != sip.StatusTooManyHops {
+		t.Errorf("StatusCode = %d, want 483", code)
+	}
+}
+
+func TestCheckLoop_ViaBranch(t *testing.T) {
+	req := parseTestInvite(t, "Max-Forwards: 70")
+	if err := PrepareForward(req, &sip.ViaHeader{
+		ProtocolName:    "SIP",
+		ProtocolVersion: "2.0",
+		Transport:       "UDP",
+		Host:            "gosip.local",
+		Port:            5060,
+	}); err != nil {
+		t.Fatalf("PrepareForward: %v", err)
+	}
+
+	if mf := req.MaxForwards(); mf == nil || mf.Val() != 69 {
+		t.Errorf("Max-Forwards not decremented: %v", mf)
+	}
+
+	// The same request arriving back unchanged is a loop
+	err := CheckLoop(req)
+	loopErr, ok := err.(*LoopError)
+	if !ok {
+		t.Fatalf("Expected *LoopError, got %v", err)
+	}
+	if loopErr.Reason != LoopReasonVia {
+		t.Errorf("Reason = %s, want %s", loopErr.Reason, LoopReasonVia)
+	}
+	if code, _ := loopErr.StatusCode(); code != sip.StatusLoopDetected {
+		t.Errorf("StatusCode = %d, want 482", code)
+	}
+	if len(loopErr.Path) != 2 || loopErr.Path[0] != "10.0.0.1:5060" || loopErr.Path[1] != "gosip.local:5060" {
+		t.Errorf("Unexpected loop path: %v", loopErr.Path)
+	}
+}
+
+func TestCheckLoop_SpiralAllowed(t *testing.T) {
+	req := parseTestInvite(t, "Max-Forwards: 70")
+	if err := PrepareForward(req, &sip.ViaHeader{
+		ProtocolName:    "SIP",
+		ProtocolVersion: "2.0",
+		Transport:       "UDP",
+		Host:            "gosip.local",
+	}); err != nil {
+		t.Fatalf("PrepareForward: %v", err)
+	}
+
+	// Retargeting changes the Request-URI, so the request is a spiral
+	req.Recipient.User = "+15557654321"
+	if err := CheckLoop(req); err != nil {
+		t.Errorf("Spiral should not be treated as a loop: %v", err)
+	}
+}
+
+func TestCheckLoop_HistoryInfo(t *testing.T) {
+	req := parseTestInvite(t,
+		"History-Info: <sip:+15551234567@gosip.local>;index=1, <sip:+15557654321@gosip.local?Reason=SIP%3Bcause%3D302>;index=1.1",
+		"History-Info: <sip:+15551234567@gosip.local>;index=1.1.1",
+	)
+
+	err := CheckLoop(req)
+	loopErr, ok := err.(*LoopError)
+	if !ok {
+		t.Fatalf("Expected *LoopError, got %v", err)
+	}
+	if loopErr.Reason != LoopReasonHistoryInfo {
+		t.Errorf("Reason = %s, want %s", loopErr.Reason, LoopReasonHistoryInfo)
+	}
+	want := []string{"sip:+15551234567@gosip.local", "sip:+15557654321@gosip.local", "sip:+15551234567@gosip.local"}
+	if strings.Join(loopErr.Path, ",") != strings.Join(want, ",") {
+		t.Errorf("Path = %v, want %v", loopErr.Path, want)
+	}
+}
+
+func TestCheckLoop_HistoryInfoSingleDiversion(t *testing.T) {
+	req := parseTestInvite(t,
+		"History-Info: <sip:+15557654321@gosip.local>;index=1, <sip:+15551234567@gosip.local>;index=1.1",
+	)
+	if err := CheckLoop(req); err != nil {
+		t.Errorf("Single diversion should not be a loop: %v", err)
+	}
+}
+
+func TestPrepareForward_NoHopsLeft(t *testing.T) {
+	req := parseTestInvite(t, "Max-Forwards: 0")
+	err := PrepareForward(req, nil)
+	if loopErr, ok := err.(*LoopError); !ok || loopErr.Reason != LoopReasonTooManyHops {
+		t.Errorf("Expected too many hops error, got %v", err)
+	}
+}
+
+func TestPrepareForward_AddsMaxForwards(t *testing.T) {
+	req := parseTestInvite(t)
+	if err := PrepareForward(req, nil); err != nil {
+		t.Fatalf("PrepareForward: %v", err)
+	}
+	if mf := req.MaxForwards(); mf == nil || mf.Val() != DefaultMaxForwards-1 {
+		t.Errorf("Max-Forwards = %v, want %d", mf, DefaultMaxForwards-1)
+	}
+}
+
+func TestLoopBranch_MagicCookie(t *testing.T) {
+	req := parseTestInvite(t)
+	branch := LoopBranch(req)
+	if !strings.HasPrefix(branch, "z9hG4bK") {
+		t.Errorf("Branch %q must start with the RFC 3261 magic cookie", branch)
+	}
+	if branch != LoopBranch(req) {
+		t.Error("LoopBranch should be deterministic")
+	}
+}
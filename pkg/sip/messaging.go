@@ -0,0 +1,212 @@
+// Package sip provides SMS delivery and read receipts for SIP MESSAGE clients
+package sip
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/events"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+)
+
+// handleMessage processes MESSAGE requests from devices. GoSIP accepts IMDN
+// delivery and display notifications for texts it delivered; a displayed
+// notification marks the message read in the inbox and clears it on the
+// device's other messaging clients.
+func (s *Server) handleMessage(req *sip.Request, tx sip.ServerTransaction) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.CallSetupTimeout)
+	defer cancel()
+
+	slog.Debug("Received MESSAGE request", "from", req.From().Address.String())
+
+	if req.GetHeader("Authorization") == nil {
+		s.sendAuthChallenge(req, tx)
+		return
+	}
+
+	device, err := s.auth.Authenticate(ctx, req)
+	if err != nil {
+		slog.Warn("MESSAGE authentication failed", "error", err, "from", req.From().Address.String())
+		s.sendResponse(tx, req, sip.StatusForbidden, "Forbidden")
+		return
+	}
+
+	var contentType string
+	if h := req.ContentType(); h != nil {
+		contentType = h.Value()
+	}
+	n, err := ParseIMDN(contentType, req.Body())
+	if err != nil {
+		slog.Debug("Unsupported MESSAGE body", "error", err, "device", device.Username)
+		res := sip.NewResponseFromRequest(req, sip.StatusUnsupportedMediaType, "Unsupported Media Type", nil)
+		res.AppendHeader(sip.NewHeader("Accept", IMDNContentType+", "+CPIMContentType))
+		if err := tx.Respond(res); err != nil {
+			slog.Error("Failed to send MESSAGE response", "error", err)
+		}
+		return
+	}
+
+	s.applyIMDN(ctx, device, n)
+	s.sendResponse(tx, req, sip.StatusOK, "OK")
+}
+
+// applyIMDN records a device's notification for a text GoSIP delivered.
+// Notifications for messages GoSIP did not send are ignored.
+func (s *Server) applyIMDN(ctx context.Context, device *models.Device, n *IMDN) {
+	messageID, ok := ParseIMDNMessageID(n.MessageID)
+	if !ok {
+		return
+	}
+
+	if n.Status != IMDNDisplayed {
+		slog.Debug("Message notification from device",
+			"message_id", messageID,
+			"device", device.Username,
+			"status", n.Status,
+		)
+		return
+	}
+
+	msg, err := s.db.Messages.GetByID(ctx, messageID)
+	if err != nil {
+		slog.Debug("Read receipt for unknown message", "error", err, "message_id", messageID)
+		return
+	}
+	if msg.IsRead {
+		return
+	}
+	if err := s.db.Messages.MarkAsRead(ctx, msg.ID); err != nil {
+		slog.Error("Failed to mark message read", "error", err, "message_id", msg.ID)
+		return
+	}
+
+	slog.Info("Message read on device", "message_id", msg.ID, "device", device.Username)
+
+	s.mu.RLock()
+	hub := s.events
+	s.mu.RUnlock()
+	hub.Publish(events.TypeMessageRead, map[string]interface{}{
+		"id":        msg.ID,
+		"did_id":    msg.DIDID,
+		"device_id": device.ID,
+	})
+
+	go func() {
+		defer s.recoverPanic("read notification")
+		ctx, cancel := context.WithTimeout(context.Background(), config.SIPMessageTimeout)
+		defer cancel()
+		s.NotifyMessagesRead(ctx, []*models.Message{msg}, device.ID)
+	}()
+}
+
+// DeliverMessage sends an inbound text to the registered devices that
+// receive its DID's texts over SIP MESSAGE. The message/cpim body asks each
+// client for a display notification so reading it on the phone marks it read.
+func (s *Server) DeliverMessage(ctx context.Context, msg *models.Message) {
+	if msg.DIDID == nil {
+		return
+	}
+	s.forEachMessagingDevice(ctx, *msg.DIDID, 0, func(device *models.Device, reg *models.Registration, host string) {
+		from := fmt.Sprintf("sip:%s@%s", msg.FromNumber, host)
+		to := fmt.Sprintf("sip:%s@%s", device.Username, host)
+		body := BuildCPIM(from, to, IMDNMessageID(msg.ID), msg.CreatedAt, msg.Body)
+		if err := s.sendMessage(ctx, reg, from, to, CPIMContentType, body); err != nil {
+			slog.Warn("Failed to deliver message to device", "error", err, "message_id", msg.ID, "device", device.Username)
+		}
+	})
+}
+
+// NotifyMessagesRead sends display notifications for messages read in the
+// inbox, or on another device, to the messaging devices of their DIDs so
+// clients clear their unread indicators. exceptDeviceID, when set, skips
+// the device the messages were read on.
+func (s *Server) NotifyMessagesRead(ctx context.Context, msgs []*models.Message, exceptDeviceID int64) {
+	byDID := make(map[int64][]*models.Message)
+	for _, msg := range msgs {
+		if msg.DIDID != nil {
+			byDID[*msg.DIDID] = append(byDID[*msg.DIDID], msg)
+		}
+	}
+
+	now := time.Now()
+	for didID, didMsgs := range byDID {
+		s.forEachMessagingDevice(ctx, didID, exceptDeviceID, func(device *models.Device, reg *models.Registration, host string) {
+			to := fmt.Sprintf("sip:%s@%s", device.Username, host)
+			for _, msg := range didMsgs {
+				from := fmt.Sprintf("sip:%s@%s", msg.FromNumber, host)
+				n := IMDN{MessageID: IMDNMessageID(msg.ID), DateTime: now, Status: IMDNDisplayed}
+				notification, err := BuildIMDN(n)
+				if err != nil {
+					slog.Error("Failed to build read receipt", "error", err, "message_id", msg.ID)
+					continue
+				}
+				body := WrapIMDN(from, to, n, notification)
+				if err := s.sendMessage(ctx, reg, from, to, CPIMContentType, body); err != nil {
+					slog.Warn("Failed to send read receipt to device", "error", err, "message_id", msg.ID, "device", device.Username)
+				}
+			}
+		})
+	}
+}
+
+// forEachMessagingDevice calls fn for each registered messaging device of a
+// DID other than exceptDeviceID
+func (s *Server) forEachMessagingDevice(ctx context.Context, didID, exceptDeviceID int64, fn func(*models.Device, *models.Registration, string)) {
+	if s.client == nil {
+		return
+	}
+	devices, err := s.db.Devices.ListMessagingByDID(ctx, didID)
+	if err != nil {
+		slog.Error("Failed to load messaging devices", "error", err, "did_id", didID)
+		return
+	}
+
+	host := s.client.GetHostname()
+	for _, device := range devices {
+		if device.ID == exceptDeviceID {
+			continue
+		}
+		reg, err := s.registrar.GetRegistration(ctx, device.ID)
+		if err != nil {
+			continue
+		}
+		fn(device, reg, host)
+	}
+}
+
+// sendMessage sends a MESSAGE request to a device's registered contact
+func (s *Server) sendMessage(ctx context.Context, reg *models.Registration, from, to, contentType string, body []byte) error {
+	var uri sip.Uri
+	if err := sip.ParseUri(strings.Trim(reg.Contact, "<>"), &uri); err != nil {
+		return fmt.Errorf("invalid contact %q: %w", reg.Contact, err)
+	}
+
+	req := sip.NewRequest(sip.MESSAGE, uri)
+	req.AppendHeader(sip.NewHeader("From", fmt.Sprintf("<%s>;tag=%s", from, sip.GenerateTagN(16))))
+	req.AppendHeader(sip.NewHeader("To", fmt.Sprintf("<%s>", to)))
+	req.AppendHeader(sip.NewHeader("Content-Type", contentType))
+	req.SetBody(body)
+
+	tx, err := s.client.TransactionRequest(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to send MESSAGE: %w", err)
+	}
+	defer tx.Terminate()
+
+	select {
+	case res := <-tx.Responses():
+		if res.StatusCode >= 200 && res.StatusCode < 300 {
+			return nil
+		}
+		return fmt.Errorf("MESSAGE rejected: %d %s", res.StatusCode, res.Reason)
+	case <-tx.Done():
+		return fmt.Errorf("MESSAGE transaction terminated without response")
+	case <-ctx.Done():
+		return fmt.Errorf("MESSAGE timeout: %w", ctx.Err())
+	}
+}
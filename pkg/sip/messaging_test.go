@@ -0,0 +1,60 @@
+package sip
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+func TestServer_ApplyIMDN(t *testing.T) {
+	database := setupTestDB(t)
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0"}, database)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	ctx := context.Background()
+
+	device := &models.Device{Name: "Softphone", Username: "softphone", PasswordHash: "x", DeviceType: "softphone", SIPMessaging: true}
+	if err := database.Devices.Create(ctx, device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	did := &models.DID{Number: "+15559876543", SMSEnabled: true}
+	if err := database.DIDs.Create(ctx, did); err != nil {
+		t.Fatalf("Failed to create DID: %v", err)
+	}
+	msg := &models.Message{
+		DIDID:      &did.ID,
+		Direction:  "inbound",
+		FromNumber: "+15551234567",
+		ToNumber:   did.Number,
+		Body:       "Running late",
+		Status:     "received",
+	}
+	if err := database.Messages.Create(ctx, msg); err != nil {
+		t.Fatalf("Failed to create message: %v", err)
+	}
+
+	// Delivery notifications leave the message unread
+	server.applyIMDN(ctx, device, &IMDN{MessageID: IMDNMessageID(msg.ID), DateTime: time.Now(), Status: IMDNDelivered})
+	got, err := database.Messages.GetByID(ctx, msg.ID)
+	if err != nil {
+		t.Fatalf("Failed to get message: %v", err)
+	}
+	if got.IsRead {
+		t.Error("Expected delivered notification to leave message unread")
+	}
+
+	// Notifications for messages GoSIP did not deliver are ignored
+	server.applyIMDN(ctx, device, &IMDN{MessageID: "34a2bc1f", Status: IMDNDisplayed})
+
+	server.applyIMDN(ctx, device, &IMDN{MessageID: IMDNMessageID(msg.ID), DateTime: time.Now(), Status: IMDNDisplayed})
+	got, err = database.Messages.GetByID(ctx, msg.ID)
+	if err != nil {
+		t.Fatalf("Failed to get message: %v", err)
+	}
+	if !got.IsRead {
+		t.Error("Expected displayed notification to mark message read")
+	}
+}
@@ -2,20 +2,32 @@
 package sip
 
 import (
+	"bytes"
 	"io"
 	"log/slog"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
+
+	"github.com/btafoya/gosip/internal/codec"
+	"github.com/btafoya/gosip/internal/config"
 )
 
+// mohFrameSize is the number of samples in a 20 ms RTP packet at 8 kHz
+const mohFrameSize = 160
+
+// silentFrame is 20 ms of PCMU silence
+var silentFrame = bytes.Repeat([]byte{0xFF}, mohFrameSize)
+
 // MOHManager manages Music on Hold streams
 type MOHManager struct {
 	mu           sync.RWMutex
 	activeStreams map[string]*MOHStream
 	audioPath    string
 	enabled      bool
+	sender       func(callID string, packet *RTPPacket)
 }
 
 // MOHStream represents an active MOH stream for a call
@@ -25,6 +37,13 @@ type MOHStream struct {
 	StartedAt time.Time
 	StopChan  chan struct{}
 	AudioData []byte
+
+	// Comfort noise replaces silent frames when the call wants it: CN
+	// packets when the device accepted them, otherwise low-level noise
+	comfortNoise bool
+	cnNegotiated bool
+	noise        *codec.NoiseGenerator
+	silentFrames int
 }
 
 // MOHConfig holds configuration for Music on Hold
@@ -49,9 +68,11 @@ func NewMOHManager(cfg MOHConfig) *MOHManager {
 	return mgr
 }
 
-// Start begins streaming MOH for a held call
+// Start begins streaming MOH for a held call. With MOH disabled, calls
+// that want comfort noise get that instead of dead air.
 func (m *MOHManager) Start(callID string, session *CallSession) error {
-	if !m.enabled {
+	comfortNoise := session != nil && session.ComfortNoise
+	if !m.enabled && !comfortNoise {
 		slog.Debug("MOH disabled, not starting stream", "call_id", callID)
 		return nil
 	}
@@ -66,18 +87,25 @@ func (m *MOHManager) Start(callID string, session *CallSession) error {
 	}
 
 	// Load audio data
-	audioData, err := m.loadAudioFile()
-	if err != nil {
-		slog.Warn("Failed to load MOH audio, using silence", "error", err)
-		audioData = m.generateSilence()
+	var audioData []byte
+	if m.enabled {
+		var err error
+		audioData, err = m.loadAudioFile()
+		if err != nil {
+			slog.Warn("Failed to load MOH audio, using silence", "error", err)
+			audioData = m.generateSilence()
+		}
 	}
 
 	stream := &MOHStream{
-		CallID:    callID,
-		Session:   session,
-		StartedAt: time.Now(),
-		StopChan:  make(chan struct{}),
-		AudioData: audioData,
+		CallID:       callID,
+		Session:      session,
+		StartedAt:    time.Now(),
+		StopChan:     make(chan struct{}),
+		AudioData:    audioData,
+		comfortNoise: comfortNoise,
+		cnNegotiated: comfortNoise && session.CNNegotiated,
+		noise:        codec.NewNoiseGenerator(config.ComfortNoiseLevel),
 	}
 
 	m.activeStreams[callID] = stream
@@ -85,7 +113,7 @@ func (m *MOHManager) Start(callID string, session *CallSession) error {
 	// Start streaming in background
 	go m.streamAudio(stream)
 
-	slog.Info("MOH started", "call_id", callID)
+	slog.Info("MOH started", "call_id", callID, "music", m.enabled, "comfort_noise", comfortNoise)
 	return nil
 }
 
@@ -139,45 +167,92 @@ func (m *MOHManager) StopAll() {
 
 // streamAudio handles the actual audio streaming
 func (m *MOHManager) streamAudio(stream *MOHStream) {
-	// In a full implementation, this would:
+	// In a full implementation, this would also:
 	// 1. Parse the audio file (WAV/MP3)
-	// 2. Transcode to appropriate codec (PCMU/PCMA)
-	// 3. Send RTP packets to the held party
-	// 4. Loop the audio until stop is signaled
-
-	// For now, this is a placeholder that simulates streaming
+	// 2. Transcode to the call's codec
 	ticker := time.NewTicker(20 * time.Millisecond) // 20ms RTP packet interval
 	defer ticker.Stop()
 
-	audioLen := len(stream.AudioData)
-	if audioLen == 0 {
-		audioLen = 160 // Minimum packet size
-	}
-
 	position := 0
-	packetSize := 160 // 20ms at 8kHz
+	var seq uint16
+	var timestamp uint32
+	ssrc := rand.Uint32()
 
 	for {
 		select {
 		case <-stream.StopChan:
 			return
 		case <-ticker.C:
-			// Calculate packet to send
-			endPos := position + packetSize
-			if endPos > audioLen {
-				// Loop back to start
-				position = 0
-				endPos = packetSize
+			// Loop the audio, or play silence when there is none
+			frame := silentFrame
+			if len(stream.AudioData) >= mohFrameSize {
+				if position+mohFrameSize > len(stream.AudioData) {
+					position = 0
+				}
+				frame = stream.AudioData[position : position+mohFrameSize]
+				position += mohFrameSize
+			}
+
+			if payloadType, payload := stream.nextPayload(frame); payload != nil {
+				m.send(stream.CallID, CreateRTPPacket(payloadType, seq, timestamp, ssrc, payload))
+				seq++
 			}
+			timestamp += mohFrameSize
+		}
+	}
+}
 
-			// In full implementation, send RTP packet here
-			// sendRTPPacket(stream.Session, stream.AudioData[position:endPos])
+// nextPayload returns the RTP payload to send for a 20 ms PCMU frame, or
+// nil when nothing is sent for it. Silent frames become comfort noise when
+// the call wants it. With CN negotiated, a CN packet marks the start of
+// silence and is repeated every config.ComfortNoiseUpdateFrames frames
+// (RFC 3389); otherwise the silence is filled with low-level noise.
+func (st *MOHStream) nextPayload(frame []byte) (uint8, []byte) {
+	if !st.comfortNoise {
+		return PayloadTypePCMU, frame
+	}
+
+	pcm := make([]int16, len(frame))
+	for i, b := range frame {
+		pcm[i] = codec.UlawToLinear(b)
+	}
+	if codec.NoiseLevel(pcm) < config.ComfortNoiseSilenceLevel {
+		st.silentFrames = 0
+		return PayloadTypePCMU, frame
+	}
 
-			position = endPos
+	st.silentFrames++
+	if st.cnNegotiated {
+		if (st.silentFrames-1)%config.ComfortNoiseUpdateFrames == 0 {
+			return codec.CN.PayloadType, codec.ComfortNoisePayload(config.ComfortNoiseLevel)
 		}
+		return 0, nil
+	}
+
+	noise := make([]byte, len(frame))
+	for i, sample := range st.noise.Generate(len(frame)) {
+		noise[i] = codec.LinearToUlaw(sample)
+	}
+	return PayloadTypePCMU, noise
+}
+
+// send passes an RTP packet to the sender, if one is set
+func (m *MOHManager) send(callID string, packet *RTPPacket) {
+	m.mu.RLock()
+	sender := m.sender
+	m.mu.RUnlock()
+	if sender != nil {
+		sender(callID, packet)
 	}
 }
 
+// SetSender sets where the RTP packets of MOH streams go
+func (m *MOHManager) SetSender(sender func(callID string, packet *RTPPacket)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sender = sender
+}
+
 // loadAudioFile loads the MOH audio file
 func (m *MOHManager) loadAudioFile() ([]byte, error) {
 	// Check if file exists
@@ -3,6 +3,9 @@ package sip
 import (
 	"testing"
 	"time"
+
+	"github.com/btafoya/gosip/internal/codec"
+	"github.com/btafoya/gosip/internal/config"
 )
 
 func TestNewMOHManager(t *testing.T) {
@@ -267,3 +270,67 @@ func TestPayloadTypeConstants(t *testing.T) {
 		t.Errorf("PayloadTypeG729 = %d, want 18", PayloadTypeG729)
 	}
 }
+
+func TestMOHStream_NextPayload(t *testing.T) {
+	speech := make([]byte, mohFrameSize)
+	for i := range speech {
+		speech[i] = codec.LinearToUlaw(int16(4000 * (i%2*2 - 1)))
+	}
+
+	// Without comfort noise, silence is sent as is
+	plain := &MOHStream{}
+	if pt, payload := plain.nextPayload(silentFrame); pt != PayloadTypePCMU || string(payload) != string(silentFrame) {
+		t.Error("Expected silence to pass through without comfort noise")
+	}
+
+	// With CN negotiated, silence starts with a CN packet and is updated periodically
+	cn := &MOHStream{comfortNoise: true, cnNegotiated: true}
+	var sent []uint8
+	for i := 0; i < config.ComfortNoiseUpdateFrames+1; i++ {
+		if pt, payload := cn.nextPayload(silentFrame); payload != nil {
+			sent = append(sent, pt)
+		}
+	}
+	if len(sent) != 2 || sent[0] != codec.CN.PayloadType || sent[1] != codec.CN.PayloadType {
+		t.Errorf("Expected two CN packets, got %v", sent)
+	}
+	if pt, payload := cn.nextPayload(speech); pt != PayloadTypePCMU || string(payload) != string(speech) {
+		t.Error("Expected audio to pass through")
+	}
+	if _, payload := cn.nextPayload(silentFrame); len(payload) != 1 {
+		t.Error("Expected a CN packet when silence starts again")
+	}
+
+	// Without CN, silence is filled with noise
+	noise := &MOHStream{comfortNoise: true, noise: codec.NewNoiseGenerator(config.ComfortNoiseLevel)}
+	pt, payload := noise.nextPayload(silentFrame)
+	if pt != PayloadTypePCMU || len(payload) != mohFrameSize || string(payload) == string(silentFrame) {
+		t.Error("Expected silence to be replaced with noise")
+	}
+}
+
+func TestMOHManager_ComfortNoiseWithoutMusic(t *testing.T) {
+	mgr := NewMOHManager(MOHConfig{Enabled: false})
+	packets := make(chan *RTPPacket, 10)
+	mgr.SetSender(func(callID string, packet *RTPPacket) {
+		select {
+		case packets <- packet:
+		default:
+		}
+	})
+
+	session := &CallSession{CallID: "cn-call", State: CallStateHeld, ComfortNoise: true, CNNegotiated: true}
+	if err := mgr.Start("cn-call", session); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer mgr.Stop("cn-call")
+
+	select {
+	case packet := <-packets:
+		if packet.PayloadType != codec.CN.PayloadType {
+			t.Errorf("PayloadType = %d, want CN", packet.PayloadType)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a comfort noise packet")
+	}
+}
@@ -312,6 +312,19 @@ func (m *MWIManager) GetAllStates() map[string]*MWIState {
 	return result
 }
 
+// ListSubscriptions returns every subscription
+func (m *MWIManager) ListSubscriptions() []*MWISubscription {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	subs := make([]*MWISubscription, 0, len(m.subscriptions))
+	for _, sub := range m.subscriptions {
+		copy := *sub
+		subs = append(subs, &copy)
+	}
+	return subs
+}
+
 // GetSubscriptionCount returns the total number of active subscriptions
 func (m *MWIManager) GetSubscriptionCount() int {
 	m.mu.RLock()
@@ -341,6 +354,24 @@ func (m *MWIManager) RefreshSubscription(id string, expires int) error {
 	return nil
 }
 
+// NotifySubscriber sends the current state of its mailbox to one subscriber
+func (m *MWIManager) NotifySubscriber(ctx context.Context, id string) error {
+	m.mu.RLock()
+	sub := m.subscriptions[id]
+	if sub == nil {
+		m.mu.RUnlock()
+		return fmt.Errorf("subscription not found: %s", id)
+	}
+	state := m.states[sub.AOR]
+	if state == nil {
+		state = &MWIState{AOR: sub.AOR, LastUpdated: time.Now()}
+	}
+	stateCopy := *state
+	m.mu.RUnlock()
+
+	return m.sendNotify(ctx, sub, &stateCopy)
+}
+
 // NotifyAllSubscribers sends NOTIFY to all subscribers for an AOR
 // Used when we need to force a notification (e.g., on initial subscription)
 func (m *MWIManager) NotifyAllSubscribers(ctx context.Context, aor string) error {
@@ -0,0 +1,156 @@
+// Package sip provides outbound caller ID selection for devices shared across DIDs
+package sip
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+)
+
+// DIDHeader selects the caller ID DID, by number, for clients that can't
+// dial the DID selection prefix, such as softphones driven by the API
+const DIDHeader = "X-GoSIP-DID"
+
+// ErrDIDNotAllowed is returned when a call selects a DID the device is not associated with
+var ErrDIDNotAllowed = errors.New("DID not associated with device")
+
+// ParseDIDSelection splits a number dialed as prefix, a DID position from 1
+// to 9, then the destination. ok is false when dialed does not use the scheme.
+func ParseDIDSelection(dialed, prefix string) (position int, destination string, ok bool) {
+	if prefix == "" || !strings.HasPrefix(dialed, prefix) {
+		return 0, "", false
+	}
+	rest := dialed[len(prefix):]
+	if len(rest) < 2 || rest[0] < '1' || rest[0] > '9' {
+		return 0, "", false
+	}
+	return int(rest[0] - '0'), rest[1:], true
+}
+
+// SelectOutboundDID picks the DID whose caller ID a device presents. A DID
+// selected for this call by position or number wins, then the DID last
+// selected for the destination, then the device's default, then its first
+// DID. explicit reports whether the call selected the DID itself.
+func SelectOutboundDID(dids []*models.DeviceDID, position int, number string, lastUsed *int64) (selected *models.DeviceDID, explicit bool, err error) {
+	if len(dids) == 0 {
+		if position != 0 || number != "" {
+			return nil, false, ErrDIDNotAllowed
+		}
+		return nil, false, nil
+	}
+
+	switch {
+	case position != 0:
+		if position > len(dids) {
+			return nil, false, ErrDIDNotAllowed
+		}
+		return dids[position-1], true, nil
+
+	case number != "":
+		for _, dd := range dids {
+			if digitsOnly(dd.Number) == digitsOnly(number) {
+				return dd, true, nil
+			}
+		}
+		return nil, false, ErrDIDNotAllowed
+	}
+
+	if lastUsed != nil {
+		for _, dd := range dids {
+			if dd.DIDID == *lastUsed {
+				return dd, false, nil
+			}
+		}
+	}
+	for _, dd := range dids {
+		if dd.IsDefault {
+			return dd, false, nil
+		}
+	}
+	return dids[0], false, nil
+}
+
+// digitsOnly strips everything but digits so formatted numbers compare equal
+func digitsOnly(number string) string {
+	var b strings.Builder
+	for _, c := range number {
+		if c >= '0' && c <= '9' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// didSelectPrefix returns the configured DID selection dialing prefix
+func (s *Server) didSelectPrefix(ctx context.Context) string {
+	if s.db == nil {
+		return config.DefaultDIDSelectPrefix
+	}
+	return s.db.Config.GetWithDefault(ctx, "did_select_prefix", config.DefaultDIDSelectPrefix)
+}
+
+// applyOutboundDID sets the caller ID DID and destination of a device's
+// outbound call. A DID the caller selects is remembered for the destination
+// so later calls to it use the same caller ID. It returns false after
+// rejecting the call with 403 when the selected DID is not one of the
+// device's.
+func (s *Server) applyOutboundDID(ctx context.Context, req *sip.Request, tx sip.ServerTransaction, session *CallSession, device *models.Device) bool {
+	destination := req.Recipient.User
+	position, dialed, ok := ParseDIDSelection(destination, s.didSelectPrefix(ctx))
+	if ok {
+		destination = dialed
+	}
+	var number string
+	if h := req.GetHeader(DIDHeader); h != nil {
+		number = strings.TrimSpace(h.Value())
+	}
+	session.ToNumber = destination
+
+	dids, err := s.db.DeviceDIDs.ListByDevice(ctx, device.ID)
+	if err != nil {
+		slog.Error("Failed to load device DIDs", "error", err, "device_id", device.ID)
+		return true
+	}
+	lastUsed, err := s.db.DeviceDIDs.GetLastUsed(ctx, device.ID, destination)
+	if err != nil {
+		slog.Warn("Failed to load last used DID", "error", err, "device_id", device.ID)
+	}
+
+	selected, explicit, err := SelectOutboundDID(dids, position, number, lastUsed)
+	if err != nil {
+		slog.Info("Outbound caller ID not allowed",
+			"call_id", session.CallID,
+			"device", device.Username,
+			"position", position,
+			"did", number,
+		)
+		s.releaseCall(session)
+		s.sendResponse(tx, req, sip.StatusForbidden, "Caller ID Not Allowed")
+		return false
+	}
+	if selected == nil {
+		return true
+	}
+
+	session.DIDID = &selected.DIDID
+	session.FromNumber = selected.Number
+	if explicit {
+		if err := s.db.DeviceDIDs.RememberLastUsed(ctx, device.ID, destination, selected.DIDID); err != nil {
+			slog.Warn("Failed to remember outbound DID", "error", err, "device_id", device.ID)
+		}
+	}
+
+	slog.Debug("Outbound caller ID selected",
+		"call_id", session.CallID,
+		"device", device.Username,
+		"did", selected.Number,
+		"destination", destination,
+		"explicit", explicit,
+	)
+	return true
+}
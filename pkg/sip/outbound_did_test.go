@@ -0,0 +1,153 @@
+package sip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+	"github.com/emiago/sipgo/siptest"
+)
+
+func TestParseDIDSelection(t *testing.T) {
+	tests := []struct {
+		dialed      string
+		position    int
+		destination string
+		ok          bool
+	}{
+		{"*5215559990000", 2, "15559990000", true},
+		{"*51+15559990000", 1, "+15559990000", true},
+		{"*50155599", 0, "", false},
+		{"*52", 0, "", false},
+		{"15559990000", 0, "", false},
+		{"*8015559990000", 0, "", false},
+	}
+
+	for _, tt := range tests {
+		position, destination, ok := ParseDIDSelection(tt.dialed, "*5")
+		if position != tt.position || destination != tt.destination || ok != tt.ok {
+			t.Errorf("ParseDIDSelection(%q) = %d, %q, %v; want %d, %q, %v",
+				tt.dialed, position, destination, ok, tt.position, tt.destination, tt.ok)
+		}
+	}
+}
+
+func TestSelectOutboundDID(t *testing.T) {
+	dids := []*models.DeviceDID{
+		{DIDID: 10, Number: "+15551110000", Position: 1},
+		{DIDID: 20, Number: "+15552220000", Position: 2, IsDefault: true},
+		{DIDID: 30, Number: "+15553330000", Position: 3},
+	}
+	last := int64(30)
+	stale := int64(99)
+
+	tests := []struct {
+		name     string
+		dids     []*models.DeviceDID
+		position int
+		number   string
+		lastUsed *int64
+		want     int64
+		explicit bool
+		err      error
+	}{
+		{"default", dids, 0, "", nil, 20, false, nil},
+		{"last used for destination", dids, 0, "", &last, 30, false, nil},
+		{"last used DID removed", dids, 0, "", &stale, 20, false, nil},
+		{"dialed position", dids, 1, "", &last, 10, true, nil},
+		{"header number without country code", dids, 0, "(555) 111-0000", &last, 0, false, ErrDIDNotAllowed},
+		{"header E.164", dids, 0, "+1 555 111 0000", nil, 10, true, nil},
+		{"position out of range", dids, 4, "", nil, 0, false, ErrDIDNotAllowed},
+		{"first without default", dids[:1], 0, "", nil, 10, false, nil},
+		{"no DIDs", nil, 0, "", nil, 0, false, nil},
+		{"selection without DIDs", nil, 1, "", nil, 0, false, ErrDIDNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, explicit, err := SelectOutboundDID(tt.dids, tt.position, tt.number, tt.lastUsed)
+			if err != tt.err {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+			var got int64
+			if selected != nil {
+				got = selected.DIDID
+			}
+			if got != tt.want || explicit != tt.explicit {
+				t.Errorf("Expected DID %d (explicit %v), got %d (explicit %v)", tt.want, tt.explicit, got, explicit)
+			}
+		})
+	}
+}
+
+func TestServer_ApplyOutboundDID(t *testing.T) {
+	database := setupTestDB(t)
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0"}, database)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	ctx := context.Background()
+
+	device := &models.Device{Name: "Shared", Username: "shared", PasswordHash: "x", DeviceType: "grandstream"}
+	if err := database.Devices.Create(ctx, device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+	sales := &models.DID{Number: "+15551110000"}
+	support := &models.DID{Number: "+15552220000"}
+	for _, did := range []*models.DID{sales, support} {
+		if err := database.DIDs.Create(ctx, did); err != nil {
+			t.Fatalf("Failed to create DID: %v", err)
+		}
+	}
+	if err := database.DeviceDIDs.SetForDevice(ctx, device.ID, []int64{sales.ID, support.ID}, &sales.ID); err != nil {
+		t.Fatalf("Failed to set device DIDs: %v", err)
+	}
+
+	call := func(user string) (*siptest.ServerTxRecorder, *CallSession, bool) {
+		req := parseTestInvite(t, "Max-Forwards: 70")
+		req.Recipient.User = user
+		tx := siptest.NewServerTxRecorder(req)
+		session := NewCallSession(req, CallDirectionOutbound)
+		session.DeviceID = device.ID
+		server.sessions.Add(session)
+		if err := server.limiter.Acquire(session.CallID, "", device.ID); err != nil {
+			t.Fatalf("Acquire failed: %v", err)
+		}
+		ok := server.applyOutboundDID(ctx, req, tx, session, device)
+		if ok {
+			server.releaseCall(session)
+		}
+		return tx, session, ok
+	}
+
+	// Dialing *52 picks the second DID and remembers it for the destination
+	_, session, ok := call("*5215559990000")
+	if !ok || session.DIDID == nil || *session.DIDID != support.ID {
+		t.Fatalf("Expected support DID to be selected, got %v", session.DIDID)
+	}
+	if session.ToNumber != "15559990000" {
+		t.Errorf("Expected prefix to be stripped from destination, got %s", session.ToNumber)
+	}
+
+	_, session, _ = call("15559990000")
+	if session.FromNumber != support.Number {
+		t.Errorf("Expected remembered DID %s, got %s", support.Number, session.FromNumber)
+	}
+
+	_, session, _ = call("15558880000")
+	if session.FromNumber != sales.Number {
+		t.Errorf("Expected default DID %s, got %s", sales.Number, session.FromNumber)
+	}
+
+	tx, _, ok := call("*5315559990000")
+	if ok {
+		t.Fatal("Expected unknown DID position to be rejected")
+	}
+	if res := tx.Result(); len(res) != 1 || res[0].StatusCode != sip.StatusForbidden {
+		t.Errorf("Expected 403, got %v", res)
+	}
+	if server.limiter.Active() != 0 {
+		t.Error("Expected rejected call to release its limiter slot")
+	}
+}
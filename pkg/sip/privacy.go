@@ -0,0 +1,104 @@
+// Package sip provides outbound caller ID blocking
+package sip
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+)
+
+// AnonymousHeader withholds ("true") or shows ("false") the caller ID of a
+// call, for clients that can't dial the anonymous call prefix, such as
+// softphones driven by the API
+const AnonymousHeader = "X-GoSIP-Anonymous"
+
+// ParseAnonymousPrefix strips the anonymous call prefix from a dialed
+// number. ok is false when the number wasn't dialed with it.
+func ParseAnonymousPrefix(dialed, prefix string) (destination string, ok bool) {
+	if prefix == "" || !strings.HasPrefix(dialed, prefix) || len(dialed) == len(prefix) {
+		return dialed, false
+	}
+	return dialed[len(prefix):], true
+}
+
+// CallerIDPrivacy returns whether a device's INVITE asks for its caller ID
+// to be withheld, from the AnonymousHeader or an RFC 3323 Privacy header.
+// set is false when the INVITE doesn't say either way.
+func CallerIDPrivacy(req *sip.Request) (anonymous, set bool) {
+	if h := req.GetHeader(AnonymousHeader); h != nil {
+		if v, err := strconv.ParseBool(strings.TrimSpace(h.Value())); err == nil {
+			return v, true
+		}
+	}
+	if h := req.GetHeader("Privacy"); h != nil {
+		for _, value := range strings.Split(h.Value(), ";") {
+			switch strings.ToLower(strings.TrimSpace(value)) {
+			case "id", "user", "header":
+				return true, true
+			case "none":
+				return false, true
+			}
+		}
+	}
+	return false, false
+}
+
+// WithholdCallerID makes an INVITE to the trunk hide the caller's number.
+// From becomes anonymous, and the DID the call is from moves to
+// P-Asserted-Identity with Privacy: id: Twilio and other carriers need it
+// to accept and bill the call, and don't pass it on to the callee.
+func WithholdCallerID(req *sip.Request, number, domain string) {
+	if from := req.From(); from != nil {
+		from.DisplayName = "Anonymous"
+		from.Address = sip.Uri{User: "anonymous", Host: "anonymous.invalid"}
+	}
+	req.RemoveHeader("P-Asserted-Identity")
+	req.RemoveHeader("Remote-Party-ID")
+	req.RemoveHeader("Privacy")
+	req.AppendHeader(sip.NewHeader("P-Asserted-Identity", "<sip:"+number+"@"+domain+">"))
+	req.AppendHeader(sip.NewHeader("Privacy", "id"))
+}
+
+// anonymousPrefix returns the configured anonymous call dialing prefix
+func (s *Server) anonymousPrefix(ctx context.Context) string {
+	if s.db == nil {
+		return config.DefaultAnonymousPrefix
+	}
+	return s.db.Config.GetWithDefault(ctx, "anonymous_prefix", config.DefaultAnonymousPrefix)
+}
+
+// applyCallerIDPrivacy decides whether a device's outbound call withholds
+// its caller ID: the anonymous call prefix or the INVITE's own request
+// win, then the setting of the device's user. The prefix is removed from
+// the number dialed. It returns false after rejecting the call with 403
+// when the call asks to be anonymous and the device may not make such
+// calls; a user's setting is then ignored instead.
+func (s *Server) applyCallerIDPrivacy(ctx context.Context, req *sip.Request, tx sip.ServerTransaction, session *CallSession, device *models.Device) bool {
+	anonymous, requested := CallerIDPrivacy(req)
+	if dialed, ok := ParseAnonymousPrefix(req.Recipient.User, s.anonymousPrefix(ctx)); ok {
+		req.Recipient.User = dialed
+		anonymous, requested = true, true
+	}
+	if !requested && device.UserID != nil {
+		if user, err := s.db.Users.GetByID(ctx, *device.UserID); err == nil {
+			anonymous = user.HideCallerID && device.AnonymousCalls
+		}
+	}
+
+	if anonymous && !device.AnonymousCalls {
+		slog.Info("Anonymous call not allowed",
+			"call_id", session.CallID,
+			"device", device.Username,
+		)
+		s.releaseCall(session)
+		s.sendResponse(tx, req, sip.StatusForbidden, "Anonymous Calls Not Allowed")
+		return false
+	}
+	session.Anonymous = anonymous
+	return true
+}
@@ -0,0 +1,147 @@
+package sip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+	"github.com/emiago/sipgo/siptest"
+)
+
+func TestParseAnonymousPrefix(t *testing.T) {
+	tests := []struct {
+		dialed, prefix string
+		want           string
+		ok             bool
+	}{
+		{"*6715559990000", "*67", "15559990000", true},
+		{"*67101", "*67", "101", true},
+		{"15559990000", "*67", "15559990000", false},
+		{"*67", "*67", "*67", false},
+		{"*6715559990000", "", "*6715559990000", false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseAnonymousPrefix(tt.dialed, tt.prefix)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseAnonymousPrefix(%q, %q) = %q, %v; want %q, %v", tt.dialed, tt.prefix, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCallerIDPrivacy(t *testing.T) {
+	tests := []struct {
+		header    string
+		anonymous bool
+		set       bool
+	}{
+		{"Max-Forwards: 70", false, false},
+		{"X-GoSIP-Anonymous: true", true, true},
+		{"X-GoSIP-Anonymous: false", false, true},
+		{"X-GoSIP-Anonymous: maybe", false, false},
+		{"Privacy: id", true, true},
+		{"Privacy: user; critical", true, true},
+		{"Privacy: none", false, true},
+	}
+	for _, tt := range tests {
+		anonymous, set := CallerIDPrivacy(parseTestInvite(t, tt.header))
+		if anonymous != tt.anonymous || set != tt.set {
+			t.Errorf("CallerIDPrivacy(%q) = %v, %v; want %v, %v", tt.header, anonymous, set, tt.anonymous, tt.set)
+		}
+	}
+}
+
+func TestWithholdCallerID(t *testing.T) {
+	req := parseTestInvite(t, "P-Asserted-Identity: <sip:alice@gosip.local>", "Privacy: none")
+	WithholdCallerID(req, "+15551234567", "gosip.pstn.twilio.com")
+
+	if from := req.From(); from.DisplayName != "Anonymous" || from.Address.String() != "sip:anonymous@anonymous.invalid" {
+		t.Errorf("Expected an anonymous From, got %s", from.Value())
+	}
+	if !req.From().Params.Has("tag") {
+		t.Error("Expected the From tag kept")
+	}
+	if pai := req.GetHeaders("P-Asserted-Identity"); len(pai) != 1 || pai[0].Value() != "<sip:+15551234567@gosip.pstn.twilio.com>" {
+		t.Errorf("Expected the DID asserted, got %v", pai)
+	}
+	if privacy := req.GetHeaders("Privacy"); len(privacy) != 1 || privacy[0].Value() != "id" {
+		t.Errorf("Expected Privacy: id, got %v", privacy)
+	}
+}
+
+func TestServer_ApplyCallerIDPrivacy(t *testing.T) {
+	database := setupTestDB(t)
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0"}, database)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	ctx := context.Background()
+
+	user := &models.User{Email: "alice@example.com", PasswordHash: "x", Role: "user", HideCallerID: true}
+	if err := database.Users.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	device := &models.Device{Name: "Desk", Username: "desk", PasswordHash: "x", DeviceType: "grandstream", UserID: &user.ID, AnonymousCalls: true}
+	if err := database.Devices.Create(ctx, device); err != nil {
+		t.Fatalf("Failed to create device: %v", err)
+	}
+
+	call := func(dialed string, headers ...string) (*siptest.ServerTxRecorder, *sip.Request, *CallSession, bool) {
+		req := parseTestInvite(t, append([]string{"Max-Forwards: 70"}, headers...)...)
+		req.Recipient.User = dialed
+		tx := siptest.NewServerTxRecorder(req)
+		session := NewCallSession(req, CallDirectionOutbound)
+		session.DeviceID = device.ID
+		server.sessions.Add(session)
+		if err := server.limiter.Acquire(session.CallID, "", device.ID); err != nil {
+			t.Fatalf("Acquire failed: %v", err)
+		}
+		ok := server.applyCallerIDPrivacy(ctx, req, tx, session, device)
+		if ok {
+			server.releaseCall(session)
+		}
+		return tx, req, session, ok
+	}
+
+	// The user hides their caller ID unless the call says otherwise
+	_, _, session, ok := call("15559990000")
+	if !ok || !session.Anonymous {
+		t.Error("Expected the user's setting to withhold the caller ID")
+	}
+	_, _, session, _ = call("15559990000", "X-GoSIP-Anonymous: false")
+	if session.Anonymous {
+		t.Error("Expected the call to show its caller ID")
+	}
+
+	// *67 is stripped before the number is dialed
+	user.HideCallerID = false
+	if err := database.Users.Update(ctx, user); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	_, req, session, _ := call("*6715559990000")
+	if !session.Anonymous || req.Recipient.User != "15559990000" {
+		t.Errorf("Expected an anonymous call to 15559990000, got %v to %s", session.Anonymous, req.Recipient.User)
+	}
+
+	// Devices that may not hide their caller ID have anonymous calls refused
+	device.AnonymousCalls = false
+	tx, _, _, ok := call("*6715559990000")
+	if ok {
+		t.Fatal("Expected the anonymous call rejected")
+	}
+	if res := tx.Result(); len(res) != 1 || res[0].StatusCode != sip.StatusForbidden {
+		t.Errorf("Expected 403, got %v", res)
+	}
+	if server.limiter.Active() != 0 {
+		t.Error("Expected rejected call to release its limiter slot")
+	}
+
+	// ...while the user's setting just doesn't apply to them
+	user.HideCallerID = true
+	if err := database.Users.Update(ctx, user); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	if _, _, session, ok := call("15559990000"); !ok || session.Anonymous {
+		t.Error("Expected the call placed showing its caller ID")
+	}
+}
@@ -0,0 +1,639 @@
+// Package sip provides server-side call recording for GoSIP
+package sip
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/audio"
+	"github.com/btafoya/gosip/internal/codec"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+	"github.com/pion/rtp"
+)
+
+// TrunkRecordHeader asks for a trunk call to be recorded, for routes and
+// DIDs that record their calls
+const TrunkRecordHeader = "X-Record"
+
+// TrunkRecord reports whether a trunk call should be recorded
+func TrunkRecord(req *sip.Request) bool {
+	h := req.GetHeader(TrunkRecordHeader)
+	if h == nil {
+		return false
+	}
+	record, _ := strconv.ParseBool(strings.TrimSpace(h.Value()))
+	return record
+}
+
+// Recording states of a call
+const (
+	RecordingOff    = "off"
+	RecordingActive = "recording"
+	RecordingPaused = "paused"
+)
+
+// recordingRate is the sample rate of recordings, which keeps the audio of
+// wideband codecs
+const recordingRate = 16000
+
+// recordingSlack is how far a party's audio may fall behind the recording
+// before the gap is filled with silence, so jitter doesn't add any
+const recordingSlack = recordingRate * 60 / 1000
+
+// Recording errors
+var (
+	ErrRecordingUnavailable = errors.New("call recording is not available")
+	ErrCallNotRecordable    = errors.New("the call's media doesn't pass through GoSIP")
+	ErrAlreadyRecording     = errors.New("the call is already being recorded")
+	ErrNotRecording         = errors.New("the call is not being recorded")
+	ErrRecordingDiskLow     = errors.New("the server is low on disk space")
+)
+
+// mediaTap receives the audio an anchored call carries
+type mediaTap interface {
+	// media is given each RTP packet a party sends, with the encoding
+	// name of its payload type
+	media(fromCaller bool, encoding string, packet []byte)
+	// ended is called once the call's media has ended
+	ended()
+}
+
+// payloadNames maps the RTP payload types of a call to their encoding names
+type payloadNames map[uint8]string
+
+// learn adds the audio payload types of an SDP body
+func (p payloadNames) learn(sdp []byte) {
+	_, names := sdpAudioFormats(sdp)
+	for pt, name := range names {
+		if n, err := strconv.Atoi(pt); err == nil && n >= 0 && n < 128 && name != "" {
+			p[uint8(n)] = name
+		}
+	}
+}
+
+// encoding returns the encoding name of an RTP packet's payload type
+func (p payloadNames) encoding(packet []byte) string {
+	if len(packet) < 2 {
+		return ""
+	}
+	return p[packet[1]&0x7f]
+}
+
+// RecordingStatus is the recording state of a call
+type RecordingStatus struct {
+	CallID      string  `json:"call_id"`
+	State       string  `json:"state"`                  // "off", "recording" or "paused"
+	RecordingID int64   `json:"recording_id,omitempty"` // The recording being written, or the last one
+	Duration    float64 `json:"duration"`               // Seconds recorded, pauses excluded
+}
+
+// RecordingManager records calls whose media GoSIP carries. Every answered
+// call it carries gets a CallRecorder, which writes nothing until the
+// recording is started.
+type RecordingManager struct {
+	dir      string
+	database *db.DB
+	onEvent  func(RecordingStatus)
+
+	// diskLow refuses new recordings when the disk is nearly full
+	diskLow func(ctx context.Context) bool
+
+	mu    sync.Mutex
+	calls map[string]*CallRecorder
+
+	// finishing counts recordings being written out
+	finishing sync.WaitGroup
+}
+
+// NewRecordingManager creates a RecordingManager writing to dir. onEvent,
+// told when a recording starts, pauses, resumes or stops, may be nil.
+// Recordings a restart cut off are marked as failed.
+func NewRecordingManager(dir string, database *db.DB, onEvent func(RecordingStatus)) *RecordingManager {
+	ctx, cancel := context.WithTimeout(context.Background(), config.CallSetupTimeout)
+	defer cancel()
+	if n, err := database.Recordings.FailUnfinished(ctx); err != nil {
+		slog.Warn("Failed to check for unfinished recordings", "error", err)
+	} else if n > 0 {
+		slog.Warn("Recordings cut off by a restart marked as failed", "count", n)
+	}
+
+	return &RecordingManager{
+		dir:      dir,
+		database: database,
+		onEvent:  onEvent,
+		calls:    make(map[string]*CallRecorder),
+	}
+}
+
+// SetDiskCheck sets the check that refuses new recordings when the disk
+// is low on free space
+func (m *RecordingManager) SetDiskCheck(low func(ctx context.Context) bool) {
+	m.mu.Lock()
+	m.diskLow = low
+	m.mu.Unlock()
+}
+
+// Path returns the file of a recording
+func (m *RecordingManager) Path(rec *models.Recording) string {
+	return filepath.Join(m.dir, filepath.Base(rec.FileName))
+}
+
+// attach tracks an answered call whose media GoSIP carries. cdrSID is the
+// Call SID of the CDR its recordings are linked to. It returns nil when
+// the call's media doesn't pass through GoSIP.
+func (m *RecordingManager) attach(callID, cdrSID string, call anchoredCall) *CallRecorder {
+	r := &CallRecorder{CallID: callID, m: m, cdrSID: cdrSID, state: RecordingOff}
+	if !call.setTap(r) {
+		return nil
+	}
+
+	m.mu.Lock()
+	m.calls[callID] = r
+	m.mu.Unlock()
+	return r
+}
+
+// Call returns the recorder of an answered call GoSIP carries, or nil
+func (m *RecordingManager) Call(callID string) *CallRecorder {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[callID]
+}
+
+// Wait blocks until stopped recordings have been written out
+func (m *RecordingManager) Wait() {
+	m.finishing.Wait()
+}
+
+// Close stops every recording and waits for them to be written out
+func (m *RecordingManager) Close() {
+	m.mu.Lock()
+	calls := make([]*CallRecorder, 0, len(m.calls))
+	for _, r := range m.calls {
+		calls = append(calls, r)
+	}
+	m.mu.Unlock()
+
+	for _, r := range calls {
+		r.ended()
+	}
+	m.Wait()
+}
+
+// publish tells onEvent about a recording's new state
+func (m *RecordingManager) publish(status RecordingStatus) {
+	if m.onEvent != nil {
+		m.onEvent(status)
+	}
+}
+
+// recordingLeg holds one party's audio while it is recorded: 16 kHz PCM
+// in a file of its own, merged with the other party's when recording stops
+type recordingLeg struct {
+	path    string
+	file    *os.File
+	w       *bufio.Writer
+	samples int64 // Written so far
+
+	decoders legDecoders
+}
+
+// legDecoders turn the RTP a party sends into 16 kHz audio, by encoding
+// name. Encodings that can't be decoded map to nil.
+type legDecoders map[string]*legDecoder
+
+// legDecoder turns one encoding's payloads into 16 kHz audio
+type legDecoder struct {
+	dec       codec.Decoder
+	resampler *codec.Resampler
+}
+
+// newRecordingLeg creates the audio file of a party
+func newRecordingLeg(path string) (*recordingLeg, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingLeg{path: path, file: f, w: bufio.NewWriter(f), decoders: make(legDecoders)}, nil
+}
+
+// decode returns the audio of an RTP packet at the recording rate, or nil
+// for packets that aren't audio GoSIP can decode, such as DTMF events
+func (l *recordingLeg) decode(encoding string, packet []byte) []int16 {
+	return l.decoders.decode(encoding, packet)
+}
+
+// decode returns the audio of an RTP packet at 16 kHz, or nil for packets
+// that aren't audio GoSIP can decode
+func (ds legDecoders) decode(encoding string, packet []byte) []int16 {
+	d, seen := ds[encoding]
+	if !seen {
+		if c, ok := codec.Lookup(encoding); ok {
+			if dec, err := codec.NewDecoder(c); err == nil {
+				d = &legDecoder{dec: dec, resampler: codec.NewResampler(c.SampleRate, recordingRate)}
+			} else {
+				slog.Debug("Cannot decode codec", "codec", encoding, "error", err)
+			}
+		}
+		ds[encoding] = d
+	}
+	if d == nil {
+		return nil
+	}
+
+	var p rtp.Packet
+	if err := p.Unmarshal(packet); err != nil || len(p.Payload) == 0 {
+		return nil
+	}
+	pcm, err := d.dec.Decode(p.Payload)
+	if err != nil {
+		return nil
+	}
+	return d.resampler.Resample(pcm)
+}
+
+// write appends samples, first filling any gap before at with silence
+func (l *recordingLeg) write(at int64, pcm []int16) error {
+	if gap := at - l.samples; gap > recordingSlack {
+		if err := l.writeSamples(make([]int16, gap)); err != nil {
+			return err
+		}
+	}
+	return l.writeSamples(pcm)
+}
+
+func (l *recordingLeg) writeSamples(pcm []int16) error {
+	if err := binary.Write(l.w, binary.LittleEndian, pcm); err != nil {
+		return err
+	}
+	l.samples += int64(len(pcm))
+	return nil
+}
+
+// close flushes and closes the leg's file
+func (l *recordingLeg) close() error {
+	err := l.w.Flush()
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// CallRecorder records one call. Each party is a channel of the recording:
+// the caller on the left, the callee on the right. Audio is placed by when
+// it arrives, so silence and holds keep their length. Paused time is left
+// out of the recording.
+type CallRecorder struct {
+	CallID string
+
+	m      *RecordingManager
+	cdrSID string
+
+	mu       sync.Mutex
+	state    string
+	rec      *models.Recording
+	legs     [2]*recordingLeg // Caller, callee
+	clock    time.Time        // When the recording started, moved on by pauses
+	pausedAt time.Time
+	failed   error // Writing a leg failed
+	hungUp   bool
+}
+
+// Status returns the call's recording state
+func (r *CallRecorder) Status() RecordingStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status()
+}
+
+func (r *CallRecorder) status() RecordingStatus {
+	status := RecordingStatus{CallID: r.CallID, State: r.state}
+	if r.rec != nil {
+		status.RecordingID = r.rec.ID
+		status.Duration = float64(r.rec.Duration)
+	}
+	switch r.state {
+	case RecordingActive:
+		status.Duration = time.Since(r.clock).Seconds()
+	case RecordingPaused:
+		status.Duration = r.pausedAt.Sub(r.clock).Seconds()
+	}
+	return status
+}
+
+// Start starts a new recording of the call
+func (r *CallRecorder) Start(ctx context.Context) error {
+	r.m.mu.Lock()
+	diskLow := r.m.diskLow
+	r.m.mu.Unlock()
+	if diskLow != nil && diskLow(ctx) {
+		return ErrRecordingDiskLow
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.hungUp:
+		return ErrCallNotRecordable
+	case r.state != RecordingOff:
+		return ErrAlreadyRecording
+	}
+
+	if err := os.MkdirAll(r.m.dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create recordings directory: %w", err)
+	}
+	var id [4]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return err
+	}
+	now := time.Now()
+	rec := &models.Recording{
+		CallID:    r.CallID,
+		FileName:  now.Format("20060102-150405") + "-" + hex.EncodeToString(id[:]) + ".wav",
+		StartedAt: now,
+	}
+
+	path := r.m.Path(rec)
+	caller, err := newRecordingLeg(path + ".caller")
+	if err != nil {
+		return fmt.Errorf("failed to create recording: %w", err)
+	}
+	callee, err := newRecordingLeg(path + ".callee")
+	if err != nil {
+		caller.close()
+		os.Remove(caller.path)
+		return fmt.Errorf("failed to create recording: %w", err)
+	}
+	if err := r.m.database.Recordings.Create(ctx, rec); err != nil {
+		for _, leg := range []*recordingLeg{caller, callee} {
+			leg.close()
+			os.Remove(leg.path)
+		}
+		return fmt.Errorf("failed to save recording: %w", err)
+	}
+
+	r.rec, r.legs, r.clock, r.failed = rec, [2]*recordingLeg{caller, callee}, now, nil
+	r.state = RecordingActive
+	slog.Info("Call recording started", "call_id", r.CallID, "recording_id", rec.ID)
+	r.m.publish(r.status())
+	return nil
+}
+
+// Pause stops recording the call's audio until Resume
+func (r *CallRecorder) Pause() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch r.state {
+	case RecordingOff:
+		return ErrNotRecording
+	case RecordingActive:
+		r.state, r.pausedAt = RecordingPaused, time.Now()
+		r.m.publish(r.status())
+	}
+	return nil
+}
+
+// Resume carries on recording a paused call
+func (r *CallRecorder) Resume() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch r.state {
+	case RecordingOff:
+		return ErrNotRecording
+	case RecordingPaused:
+		r.clock = r.clock.Add(time.Since(r.pausedAt))
+		r.state = RecordingActive
+		r.m.publish(r.status())
+	}
+	return nil
+}
+
+// Stop ends the recording. The file is written out in the background.
+func (r *CallRecorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state == RecordingOff {
+		return ErrNotRecording
+	}
+	r.stop()
+	return nil
+}
+
+// stop ends the recording and starts writing it out
+func (r *CallRecorder) stop() {
+	duration := r.status().Duration
+	rec, legs, failed := r.rec, r.legs, r.failed
+	r.state, r.legs = RecordingOff, [2]*recordingLeg{}
+	rec.Duration = int(duration + 0.5)
+
+	r.m.finishing.Add(1)
+	go r.m.finish(rec, legs, r.cdrSID, failed)
+	r.m.publish(r.status())
+}
+
+// media records an RTP packet from a party
+func (r *CallRecorder) media(fromCaller bool, encoding string, packet []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state != RecordingActive || r.failed != nil {
+		return
+	}
+
+	leg := r.legs[1]
+	if fromCaller {
+		leg = r.legs[0]
+	}
+	pcm := leg.decode(encoding, packet)
+	if len(pcm) == 0 {
+		return
+	}
+	// The packet's audio ends about now
+	at := int64(time.Since(r.clock)*recordingRate/time.Second) - int64(len(pcm))
+	if err := leg.write(at, pcm); err != nil {
+		slog.Error("Failed to write call recording", "error", err, "call_id", r.CallID, "recording_id", r.rec.ID)
+		r.failed = err
+	}
+}
+
+// ended stops recording when the call's media ends
+func (r *CallRecorder) ended() {
+	r.m.mu.Lock()
+	if r.m.calls[r.CallID] == r {
+		delete(r.m.calls, r.CallID)
+	}
+	r.m.mu.Unlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hungUp = true
+	if r.state != RecordingOff {
+		r.stop()
+	}
+}
+
+// finish merges the parties' audio into the recording's WAV file, stores
+// how it ended and links it to the call's CDR
+func (m *RecordingManager) finish(rec *models.Recording, legs [2]*recordingLeg, cdrSID string, failed error) {
+	defer m.finishing.Done()
+
+	err := failed
+	for _, leg := range legs {
+		if cerr := leg.close(); err == nil {
+			err = cerr
+		}
+	}
+	if err == nil {
+		rec.SizeBytes, rec.Checksum, err = mergeRecording(m.Path(rec), legs[0], legs[1])
+	}
+	for _, leg := range legs {
+		os.Remove(leg.path)
+	}
+
+	rec.Status = db.RecordingCompleted
+	if err != nil {
+		slog.Error("Failed to write call recording", "error", err, "call_id", rec.CallID, "recording_id", rec.ID)
+		rec.Status = db.RecordingFailed
+		os.Remove(m.Path(rec))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.CallSetupTimeout)
+	defer cancel()
+	if err := m.database.Recordings.Finish(ctx, rec); err != nil {
+		slog.Error("Failed to save call recording", "error", err, "recording_id", rec.ID)
+		return
+	}
+	if rec.Status != db.RecordingCompleted {
+		return
+	}
+	slog.Info("Call recording saved", "call_id", rec.CallID, "recording_id", rec.ID, "duration", rec.Duration)
+
+	// The CDR exists by now: trunk calls have one from the start, and
+	// calls between phones get theirs once they are answered
+	cdr, err := m.database.CDRs.GetByCallSID(ctx, cdrSID)
+	if err != nil {
+		if !errors.Is(err, db.ErrCDRNotFound) {
+			slog.Warn("Failed to find the CDR of a recording", "error", err, "recording_id", rec.ID)
+		}
+		return
+	}
+	if err := m.database.Recordings.SetCDR(ctx, rec.ID, cdr.ID); err != nil {
+		slog.Warn("Failed to link recording to its CDR", "error", err, "recording_id", rec.ID)
+		return
+	}
+	if err := m.database.CDRs.SetRecordingURL(ctx, cdr.ID, RecordingURL(rec.ID)); err != nil {
+		slog.Warn("Failed to link CDR to its recording", "error", err, "recording_id", rec.ID)
+	}
+}
+
+// RecordingURL is the API path a recording's audio is served from
+func RecordingURL(id int64) string {
+	return "/api/recordings/" + strconv.FormatInt(id, 10) + "/audio"
+}
+
+// mergeRecording writes a stereo WAV file from the audio of the caller and
+// the callee, padding the shorter one with silence. It returns the file's
+// size and checksum.
+func mergeRecording(path string, caller, callee *recordingLeg) (int64, string, error) {
+	left, err := os.Open(caller.path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer left.Close()
+	right, err := os.Open(callee.path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer right.Close()
+
+	frames := caller.samples
+	if callee.samples > frames {
+		frames = callee.samples
+	}
+	dataSize := frames * 2 * 2
+	if dataSize > 0xffffffff-audio.WAVHeaderSize {
+		return 0, "", errors.New("recording is too long for a WAV file")
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	sum := sha256.New()
+	w := bufio.NewWriter(io.MultiWriter(f, sum))
+	if err := audio.WriteWAVHeader(w, audio.ChannelsStereo, recordingRate, uint32(dataSize)); err != nil {
+		return 0, "", err
+	}
+
+	l, r := bufio.NewReader(left), bufio.NewReader(right)
+	var sample [2]byte
+	for i := int64(0); i < frames; i++ {
+		for _, in := range []*bufio.Reader{l, r} {
+			if _, err := io.ReadFull(in, sample[:]); err != nil {
+				sample = [2]byte{}
+			}
+			if _, err := w.Write(sample[:]); err != nil {
+				return 0, "", err
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return 0, "", err
+	}
+	if err := f.Sync(); err != nil {
+		return 0, "", err
+	}
+	return audio.WAVHeaderSize + dataSize, hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// recordAnswered lets an answered call whose media GoSIP carries be
+// recorded, and starts recording calls whose route, DID or devices ask
+// for it
+func (s *Server) recordAnswered(session *CallSession, call anchoredCall) {
+	if s.recorder == nil {
+		return
+	}
+	cdrSID := session.TrunkCallSID
+	if cdrSID == "" {
+		cdrSID = session.CallID
+	}
+	r := s.recorder.attach(session.CallID, cdrSID, call)
+	if r == nil || !session.Record {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.CallSetupTimeout)
+	defer cancel()
+	if err := r.Start(ctx); err != nil {
+		slog.Warn("Cannot record call", "error", err, "call_id", session.CallID)
+	}
+}
+
+// Recorder returns the recorder of an answered call whose media GoSIP
+// carries
+func (s *Server) Recorder(callID string) (*CallRecorder, error) {
+	if s.recorder == nil {
+		return nil, ErrRecordingUnavailable
+	}
+	if r := s.recorder.Call(callID); r != nil {
+		return r, nil
+	}
+	return nil, ErrCallNotRecordable
+}
@@ -0,0 +1,210 @@
+package sip
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+)
+
+func TestTrunkRecord(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"X-Record: 1", true},
+		{"X-Record: true", true},
+		{"X-Record: 0", false},
+		{"X-Record: please", false},
+	}
+	for _, tt := range tests {
+		var req *sip.Request
+		if tt.header == "" {
+			req = parseTestInvite(t)
+		} else {
+			req = parseTestInvite(t, tt.header)
+		}
+		if got := TrunkRecord(req); got != tt.want {
+			t.Errorf("TrunkRecord(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+// recordedSamples returns how much audio of each party a recording holds
+func recordedSamples(r *CallRecorder) (caller, callee int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.legs[0] == nil {
+		return 0, 0
+	}
+	return r.legs[0].samples, r.legs[1].samples
+}
+
+func TestRecordingManager_RelayedCall(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+
+	cdr := &models.CDR{CallSID: "CA123", Direction: "inbound", FromNumber: "+15559876543", ToNumber: "+15551234567", StartedAt: time.Now(), Disposition: "answered"}
+	if err := database.CDRs.Create(ctx, cdr); err != nil {
+		t.Fatalf("Failed to create CDR: %v", err)
+	}
+
+	var mu sync.Mutex
+	var states []string
+	dir := t.TempDir()
+	mgr := NewRecordingManager(dir, database, func(status RecordingStatus) {
+		mu.Lock()
+		states = append(states, status.State)
+		mu.Unlock()
+	})
+
+	relay := newTestRelay(t, config.MediaRelayAlways)
+	call, err := relay.NewCall("call-1", "caller-tag", "127.0.0.1", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("NewCall failed: %v", err)
+	}
+	caller, callee := newTestPhone(t), newTestPhone(t)
+	offer, _ := call.Translate(caller.sdp(""), true, true)
+	answer, _ := call.Translate(callee.sdp(""), false, false)
+	toCallee, toCaller := relayedAddr(t, answer), relayedAddr(t, offer)
+	call.Answered()
+
+	r := mgr.attach("call-1", "CA123", call)
+	if r == nil || mgr.Call("call-1") != r {
+		t.Fatal("Expected the relayed call to be recordable")
+	}
+	if err := r.Pause(); !errors.Is(err, ErrNotRecording) {
+		t.Errorf("Expected ErrNotRecording pausing before the start, got %v", err)
+	}
+	if err := r.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := r.Start(ctx); !errors.Is(err, ErrAlreadyRecording) {
+		t.Errorf("Expected ErrAlreadyRecording starting twice, got %v", err)
+	}
+
+	// 20 ms of loud PCMU from the caller, quiet from the callee
+	loud, quiet := string(bytes.Repeat([]byte{0x80}, 160)), string(bytes.Repeat([]byte{0xfe}, 160))
+	for i := 0; i < 3; i++ {
+		caller.rtp.WriteToUDP(rtpPacket(0, loud), toCallee)
+		expect(t, callee.rtp, loud)
+	}
+	callee.rtp.WriteToUDP(rtpPacket(0, quiet), toCaller)
+	expect(t, caller.rtp, quiet)
+	waitFor(t, func() bool {
+		a, b := recordedSamples(r)
+		return a == 960 && b == 320
+	})
+
+	if err := r.Pause(); err != nil {
+		t.Fatalf("Pause failed: %v", err)
+	}
+	if status := r.Status(); status.State != RecordingPaused {
+		t.Errorf("Expected the recording paused, got %+v", status)
+	}
+	if err := r.Resume(); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+
+	// Audio while paused isn't recorded, and hanging up stops the
+	// recording and writes it out
+	if err := r.Pause(); err != nil {
+		t.Fatalf("Pause failed: %v", err)
+	}
+	caller.rtp.WriteToUDP(rtpPacket(0, loud), toCallee)
+	expect(t, callee.rtp, loud)
+	call.Close()
+	mgr.Wait()
+	if mgr.Call("call-1") != nil {
+		t.Error("Expected the ended call forgotten")
+	}
+	if err := r.Start(ctx); !errors.Is(err, ErrCallNotRecordable) {
+		t.Errorf("Expected ErrCallNotRecordable after the call, got %v", err)
+	}
+
+	recs, err := database.Recordings.List(ctx, db.RecordingFilter{CallID: "call-1"})
+	if err != nil || len(recs) != 1 {
+		t.Fatalf("Expected one recording, got %v (%v)", recs, err)
+	}
+	rec := recs[0]
+	if rec.Status != db.RecordingCompleted || rec.CDRID == nil || *rec.CDRID != cdr.ID {
+		t.Errorf("Expected a completed recording linked to the CDR, got %+v", rec)
+	}
+	if got, _ := database.CDRs.GetByID(ctx, cdr.ID); got.RecordingURL.String != RecordingURL(rec.ID) {
+		t.Errorf("Expected the CDR linked to the recording, got %q", got.RecordingURL.String)
+	}
+
+	// A stereo 16 kHz WAV: the caller on the left, the callee padded with silence
+	data, err := os.ReadFile(mgr.Path(rec))
+	if err != nil {
+		t.Fatalf("Failed to read recording: %v", err)
+	}
+	if int64(len(data)) != rec.SizeBytes || len(data) != 44+960*4 {
+		t.Fatalf("Expected %d bytes of WAV, got %d (size %d)", 44+960*4, len(data), rec.SizeBytes)
+	}
+	if sum := sha256.Sum256(data); rec.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected the file's checksum stored, got %q", rec.Checksum)
+	}
+	if channels, rate := binary.LittleEndian.Uint16(data[22:]), binary.LittleEndian.Uint32(data[24:]); channels != 2 || rate != 16000 {
+		t.Errorf("Expected stereo 16 kHz, got %d channels at %d Hz", channels, rate)
+	}
+	sample := func(frame, channel int) int16 {
+		return int16(binary.LittleEndian.Uint16(data[44+frame*4+channel*2:]))
+	}
+	if left := sample(500, 0); left < 8000 {
+		t.Errorf("Expected the caller's loud audio on the left, got %d", left)
+	}
+	if right := sample(100, 1); right == 0 || right < -100 || right > 100 {
+		t.Errorf("Expected the callee's quiet audio on the right, got %d", right)
+	}
+	if right := sample(500, 1); right != 0 {
+		t.Errorf("Expected silence after the callee's audio, got %d", right)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the WAV file left, got %d files", len(entries))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{RecordingActive, RecordingPaused, RecordingActive, RecordingPaused, RecordingOff}
+	if len(states) != len(want) {
+		t.Fatalf("Expected events %v, got %v", want, states)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Errorf("Expected events %v, got %v", want, states)
+			break
+		}
+	}
+}
+
+func TestRecordingManager_DiskLow(t *testing.T) {
+	database := setupTestDB(t)
+	mgr := NewRecordingManager(t.TempDir(), database, nil)
+	mgr.SetDiskCheck(func(context.Context) bool { return true })
+
+	relay := newTestRelay(t, config.MediaRelayAlways)
+	call, err := relay.NewCall("call-1", "caller-tag", "127.0.0.1", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("NewCall failed: %v", err)
+	}
+	r := mgr.attach("call-1", "call-1", call)
+	if err := r.Start(context.Background()); !errors.Is(err, ErrRecordingDiskLow) {
+		t.Errorf("Expected ErrRecordingDiskLow, got %v", err)
+	}
+	if recs, _ := database.Recordings.List(context.Background(), db.RecordingFilter{}); len(recs) != 0 {
+		t.Errorf("Expected no recording, got %d", len(recs))
+	}
+}
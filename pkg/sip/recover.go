@@ -0,0 +1,57 @@
+package sip
+
+import (
+	"runtime/debug"
+
+	"github.com/btafoya/gosip/internal/diagnostics"
+	"github.com/emiago/sipgo"
+	"github.com/emiago/sipgo/sip"
+)
+
+// SetDiagnostics sets the store that recovered panics are reported to
+func (s *Server) SetDiagnostics(store *diagnostics.Store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.diagnostics = store
+}
+
+func (s *Server) diagnosticsStore() *diagnostics.Store {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.diagnostics
+}
+
+// recoverPanic keeps a panic in a background goroutine from crashing the
+// server. It must be deferred directly.
+func (s *Server) recoverPanic(source string) {
+	if v := recover(); v != nil {
+		s.diagnosticsStore().RecordPanic("sip "+source, v, debug.Stack())
+	}
+}
+
+// guard wraps a request handler so a panic is recorded and answered with
+// 500 instead of crashing the server. Requests and responses in call
+// dialogs are added to the SIP trace.
+func (s *Server) guard(method string, handler sipgo.RequestHandler) sipgo.RequestHandler {
+	return func(req *sip.Request, tx sip.ServerTransaction) {
+		if !s.acceptsSource(req) {
+			return
+		}
+		s.trace.Record(TraceIn, req)
+		if tx != nil {
+			tx = &tracedTransaction{ServerTransaction: tx, trace: s.trace}
+		}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			s.diagnosticsStore().RecordPanic("sip "+method, v, debug.Stack())
+			// ACKs are never answered
+			if req.Method != sip.ACK && tx != nil {
+				s.sendResponse(tx, req, sip.StatusInternalServerError, "Internal Server Error")
+			}
+		}()
+		handler(req, tx)
+	}
+}
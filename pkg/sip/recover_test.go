@@ -0,0 +1,73 @@
+package sip
+
+import (
+	"net"
+	"testing"
+
+	"github.com/btafoya/gosip/internal/diagnostics"
+	"github.com/emiago/sipgo/sip"
+)
+
+func TestServer_GuardRecordsPanic(t *testing.T) {
+	store := diagnostics.NewStore(10, 10)
+	server := &Server{}
+	server.SetDiagnostics(store)
+
+	handler := server.guard("ACK", func(req *sip.Request, tx sip.ServerTransaction) {
+		panic("boom")
+	})
+	handler(sip.NewRequest(sip.ACK, sip.Uri{User: "100", Host: "gosip.local"}), nil)
+
+	crashes := store.Crashes()
+	if len(crashes) != 1 || crashes[0].Source != "sip ACK" || crashes[0].Panic != "boom" {
+		t.Fatalf("Expected the panic to be recorded, got %+v", crashes)
+	}
+	if crashes[0].Stack == "" {
+		t.Error("Expected a stack trace")
+	}
+}
+
+func TestServer_RecoverPanic(t *testing.T) {
+	store := diagnostics.NewStore(10, 10)
+	server := &Server{}
+	server.SetDiagnostics(store)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer server.recoverPanic("session cleanup")
+		var counts map[string]int
+		counts["calls"]++
+	}()
+	<-done
+
+	if crashes := store.Crashes(); len(crashes) != 1 || crashes[0].Source != "sip session cleanup" {
+		t.Errorf("Expected the goroutine panic to be recorded, got %+v", crashes)
+	}
+}
+
+func TestServer_GuardDropsFilteredSources(t *testing.T) {
+	server := &Server{}
+	server.SetSourceFilter(func(ip net.IP) bool { return ip.Equal(net.ParseIP("203.0.113.5")) })
+
+	var handled []string
+	handler := server.guard("OPTIONS", func(req *sip.Request, tx sip.ServerTransaction) {
+		handled = append(handled, req.Source())
+	})
+	send := func(source, transport string) {
+		req := sip.NewRequest(sip.OPTIONS, sip.Uri{Host: "gosip.local"})
+		req.SetSource(source)
+		req.SetTransport(transport)
+		handler(req, nil)
+	}
+	send("203.0.113.5:5060", "UDP")
+	send("198.51.100.7:5060", "UDP")
+	send("198.51.100.7:49152", "TLS")
+
+	if len(handled) != 2 || handled[0] != "203.0.113.5:5060" || handled[1] != "198.51.100.7:49152" {
+		t.Errorf("Expected only the filtered UDP request dropped, handled %v", handled)
+	}
+	if n := server.DroppedRequests(); n != 1 {
+		t.Errorf("Expected 1 dropped request, got %d", n)
+	}
+}
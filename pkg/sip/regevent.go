@@ -0,0 +1,220 @@
+// Package sip provides the registration event package (RFC 3680) for GoSIP
+package sip
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// RegInfoContentType is the body type of reg event NOTIFY requests
+const RegInfoContentType = "application/reginfo+xml"
+
+// ErrTooManySubscriptions is returned when an address already has
+// config.MaxSubscriptionsPerAOR subscriptions
+var ErrTooManySubscriptions = errors.New("too many subscriptions")
+
+// RegSubscription is a subscription to the registration state of a device
+type RegSubscription struct {
+	ID             string
+	AOR            string // Address of Record being watched, as subscribed
+	TargetDeviceID int64  // Device whose registration is watched
+	DeviceID       int64  // Device that subscribed
+	ContactURI     string // Where to send NOTIFY
+	FromURI        string // From header of the SUBSCRIBE
+	ToURI          string // To header of the SUBSCRIBE
+	CallID         string
+	FromTag        string
+	ToTag          string
+	CSeq           uint32
+	Version        int // reginfo version of the last NOTIFY
+	Expires        int
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+}
+
+// RegEventManager keeps subscriptions to the reg event package
+type RegEventManager struct {
+	mu            sync.Mutex
+	subscriptions map[string]*RegSubscription // By subscription ID
+}
+
+// NewRegEventManager creates a RegEventManager
+func NewRegEventManager() *RegEventManager {
+	return &RegEventManager{subscriptions: make(map[string]*RegSubscription)}
+}
+
+// Add stores a new subscription. It fails when the device already has
+// config.MaxSubscriptionsPerAOR watchers.
+func (m *RegEventManager) Add(sub *RegSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	watchers := 0
+	for _, existing := range m.subscriptions {
+		if existing.TargetDeviceID == sub.TargetDeviceID {
+			watchers++
+		}
+	}
+	if watchers >= config.MaxSubscriptionsPerAOR {
+		return ErrTooManySubscriptions
+	}
+
+	now := time.Now()
+	sub.CreatedAt = now
+	sub.ExpiresAt = now.Add(time.Duration(sub.Expires) * time.Second)
+	m.subscriptions[sub.ID] = sub
+	return nil
+}
+
+// Get returns a copy of a subscription, or nil when it doesn't exist
+func (m *RegEventManager) Get(id string) *RegSubscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if sub := m.subscriptions[id]; sub != nil {
+		copy := *sub
+		return &copy
+	}
+	return nil
+}
+
+// Refresh extends a subscription by expires seconds. Refreshing with 0
+// ends it at the next NOTIFY.
+func (m *RegEventManager) Refresh(id string, expires int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sub := m.subscriptions[id]
+	if sub == nil {
+		return fmt.Errorf("subscription not found: %s", id)
+	}
+	sub.Expires = expires
+	sub.ExpiresAt = time.Now().Add(time.Duration(expires) * time.Second)
+	return nil
+}
+
+// Remove deletes a subscription
+func (m *RegEventManager) Remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.subscriptions, id)
+}
+
+// ForDevice returns the IDs of the subscriptions watching a device
+func (m *RegEventManager) ForDevice(deviceID int64) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []string
+	for id, sub := range m.subscriptions {
+		if sub.TargetDeviceID == deviceID {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// ListSubscriptions returns every subscription
+func (m *RegEventManager) ListSubscriptions() []*RegSubscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subs := make([]*RegSubscription, 0, len(m.subscriptions))
+	for _, sub := range m.subscriptions {
+		copy := *sub
+		subs = append(subs, &copy)
+	}
+	return subs
+}
+
+// nextNotify advances the CSeq and reginfo version of a subscription for
+// its next NOTIFY and returns a copy of it
+func (m *RegEventManager) nextNotify(id string) *RegSubscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sub := m.subscriptions[id]
+	if sub == nil {
+		return nil
+	}
+	sub.CSeq++
+	copy := *sub
+	sub.Version++
+	return &copy
+}
+
+// CleanupExpired removes expired subscriptions
+func (m *RegEventManager) CleanupExpired() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for id, sub := range m.subscriptions {
+		if sub.ExpiresAt.Before(now) {
+			delete(m.subscriptions, id)
+			removed++
+		}
+	}
+	if removed > 0 {
+		slog.Info("Cleaned up expired reg subscriptions", slog.Int("count", removed))
+	}
+	return removed
+}
+
+// regInfo is a reginfo document (RFC 3680)
+type regInfo struct {
+	XMLName       xml.Name              `xml:"urn:ietf:params:xml:ns:reginfo reginfo"`
+	Version       int                   `xml:"version,attr"`
+	State         string                `xml:"state,attr"`
+	Registrations []regInfoRegistration `xml:"registration"`
+}
+
+type regInfoRegistration struct {
+	AOR      string           `xml:"aor,attr"`
+	ID       string           `xml:"id,attr"`
+	State    string           `xml:"state,attr"` // "init", "active" or "terminated"
+	Contacts []regInfoContact `xml:"contact"`
+}
+
+type regInfoContact struct {
+	ID      string `xml:"id,attr"`
+	State   string `xml:"state,attr"` // "active" or "terminated"
+	Event   string `xml:"event,attr"`
+	Expires int    `xml:"expires,attr,omitempty"`
+	URI     string `xml:"uri"`
+}
+
+// BuildRegInfo returns the full reginfo document for an address. reg is
+// the device's registration, or nil when it isn't registered;
+// unregistered is true when the device has just unregistered.
+func BuildRegInfo(aor string, deviceID int64, version int, reg *models.Registration, unregistered bool, now time.Time) string {
+	registration := regInfoRegistration{
+		AOR:   aor,
+		ID:    fmt.Sprintf("reg-%d", deviceID),
+		State: "init",
+	}
+	switch {
+	case reg != nil && reg.ExpiresAt.After(now):
+		registration.State = "active"
+		registration.Contacts = []regInfoContact{{
+			ID:      fmt.Sprintf("contact-%d", reg.ID),
+			State:   "active",
+			Event:   "registered",
+			Expires: int(reg.ExpiresAt.Sub(now).Seconds()),
+			URI:     reg.Contact,
+		}}
+	case unregistered:
+		registration.State = "terminated"
+	}
+
+	doc := regInfo{Version: version, State: "full", Registrations: []regInfoRegistration{registration}}
+	body, _ := xml.MarshalIndent(doc, "", "  ") // Only strings and numbers, which always marshal
+	return xml.Header + string(body) + "\n"
+}
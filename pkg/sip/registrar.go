@@ -32,16 +32,28 @@ type Registrar struct {
 	cache map[int64]*models.Registration
 	mu    sync.RWMutex
 
+	// When each device last registered, for registration interval telemetry
+	registeredAt map[int64]time.Time
+
 	// Event callbacks
 	onRegister   func(deviceID int64)
 	onUnregister func(deviceID int64)
+	onChange     func(deviceID int64, registered bool, reason string)
 }
 
+// Reasons a registration changes state
+const (
+	RegistrationRegistered   = "registered"
+	RegistrationUnregistered = "unregistered"
+	RegistrationExpired      = "expired"
+)
+
 // NewRegistrar creates a new Registrar
 func NewRegistrar(database *db.DB) *Registrar {
 	return &Registrar{
-		db:    database,
-		cache: make(map[int64]*models.Registration),
+		db:           database,
+		cache:        make(map[int64]*models.Registration),
+		registeredAt: make(map[int64]time.Time),
 	}
 }
 
@@ -54,13 +66,20 @@ func (r *Registrar) Register(ctx context.Context, reg *models.Registration) erro
 
 	// Update cache
 	r.mu.Lock()
+	prev, existed := r.cache[reg.DeviceID]
+	wasRegistered := existed && time.Now().Before(prev.ExpiresAt)
 	r.cache[reg.DeviceID] = reg
 	r.mu.Unlock()
 
-	// Fire callback
+	r.recordRegistration(ctx, reg)
+
+	// Fire callbacks; refreshes aren't a change of state
 	if r.onRegister != nil {
 		go r.onRegister(reg.DeviceID)
 	}
+	if r.onChange != nil && !wasRegistered {
+		go r.onChange(reg.DeviceID, true, RegistrationRegistered)
+	}
 
 	slog.Debug("Device registered",
 		"device_id", reg.DeviceID,
@@ -80,13 +99,18 @@ func (r *Registrar) Unregister(ctx context.Context, deviceID int64) error {
 
 	// Remove from cache
 	r.mu.Lock()
+	_, existed := r.cache[deviceID]
 	delete(r.cache, deviceID)
+	delete(r.registeredAt, deviceID)
 	r.mu.Unlock()
 
-	// Fire callback
+	// Fire callbacks
 	if r.onUnregister != nil {
 		go r.onUnregister(deviceID)
 	}
+	if r.onChange != nil && existed {
+		go r.onChange(deviceID, false, RegistrationUnregistered)
+	}
 
 	slog.Debug("Device unregistered", "device_id", deviceID)
 
@@ -143,6 +167,23 @@ func (r *Registrar) GetRegistration(ctx context.Context, deviceID int64) (*model
 	return dbReg, nil
 }
 
+// ResolveExtension finds the device with an internal extension in a tenant
+// and its current registration. The device is returned with a nil
+// registration and db.ErrRegistrationNotFound when it exists but is not
+// registered.
+func (r *Registrar) ResolveExtension(ctx context.Context, tenantID *int64, extension string) (*models.Device, *models.Registration, error) {
+	device, err := r.db.Devices.GetByExtension(ctx, tenantID, extension)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reg, err := r.GetRegistration(ctx, device.ID)
+	if err != nil {
+		return device, nil, err
+	}
+	return device, reg, nil
+}
+
 // GetActiveRegistrations returns all active registrations with device info
 func (r *Registrar) GetActiveRegistrations(ctx context.Context) ([]RegistrationInfo, error) {
 	// Get all active registrations from database
@@ -189,6 +230,13 @@ func (r *Registrar) OnUnregister(callback func(deviceID int64)) {
 	r.onUnregister = callback
 }
 
+// OnChange sets a callback for when a device comes online or goes offline,
+// with the reason: RegistrationRegistered, RegistrationUnregistered or
+// RegistrationExpired
+func (r *Registrar) OnChange(callback func(deviceID int64, registered bool, reason string)) {
+	r.onChange = callback
+}
+
 // Touch updates the last_seen timestamp for a registration
 func (r *Registrar) Touch(ctx context.Context, deviceID int64) error {
 	// Update cache
@@ -227,15 +275,27 @@ func (r *Registrar) RefreshCache(ctx context.Context) error {
 	return nil
 }
 
-// CleanupExpired removes expired registrations from cache
+// CleanupExpired removes expired registrations from cache, reporting each
+// device as unregistered
 func (r *Registrar) CleanupExpired() {
 	r.mu.Lock()
-	defer r.mu.Unlock()
-
+	var expired []int64
 	now := time.Now()
 	for deviceID, reg := range r.cache {
 		if now.After(reg.ExpiresAt) {
 			delete(r.cache, deviceID)
+			expired = append(expired, deviceID)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, deviceID := range expired {
+		slog.Debug("Device registration expired", "device_id", deviceID)
+		if r.onUnregister != nil {
+			go r.onUnregister(deviceID)
+		}
+		if r.onChange != nil {
+			go r.onChange(deviceID, false, RegistrationExpired)
 		}
 	}
 }
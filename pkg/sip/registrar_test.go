@@ -2,6 +2,7 @@ package sip
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -434,6 +435,67 @@ func TestRegistrar_Callbacks(t *testing.T) {
 	}
 }
 
+func TestRegistrar_OnChange(t *testing.T) {
+	database := setupTestDB(t)
+	registrar := NewRegistrar(database)
+	ctx := context.Background()
+
+	changes := make(chan string, 10)
+	registrar.OnChange(func(deviceID int64, registered bool, reason string) {
+		changes <- fmt.Sprintf("%d %v %s", deviceID, registered, reason)
+	})
+
+	device := createTestDevice(t, database, "alice", "passwordhash")
+	reg := &models.Registration{
+		DeviceID:  device.ID,
+		Contact:   "sip:alice@192.168.1.100:5060",
+		ExpiresAt: time.Now().Add(1 * time.Hour),
+		Transport: "udp",
+	}
+
+	// Refreshing a registration is not a change
+	for i := 0; i < 2; i++ {
+		if err := registrar.Register(ctx, reg); err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+	}
+	if err := registrar.Unregister(ctx, device.ID); err != nil {
+		t.Fatalf("Unregister failed: %v", err)
+	}
+	// Unregistering a device that is not registered is not a change
+	if err := registrar.Unregister(ctx, device.ID); err != nil {
+		t.Fatalf("Unregister failed: %v", err)
+	}
+
+	reg.ExpiresAt = time.Now().Add(-time.Minute)
+	registrar.mu.Lock()
+	registrar.cache[device.ID] = reg
+	registrar.mu.Unlock()
+	registrar.CleanupExpired()
+
+	want := map[string]bool{
+		fmt.Sprintf("%d true registered", device.ID):    true,
+		fmt.Sprintf("%d false unregistered", device.ID): true,
+		fmt.Sprintf("%d false expired", device.ID):      true,
+	}
+	for len(want) > 0 {
+		select {
+		case change := <-changes:
+			if !want[change] {
+				t.Fatalf("Unexpected change %q", change)
+			}
+			delete(want, change)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timeout waiting for changes %v", want)
+		}
+	}
+	select {
+	case change := <-changes:
+		t.Errorf("Unexpected change %q", change)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
 func TestRegistrar_Touch(t *testing.T) {
 	database := setupTestDB(t)
 	registrar := NewRegistrar(database)
@@ -581,3 +643,34 @@ func TestRegistrar_ConcurrentAccess(t *testing.T) {
 		t.Errorf("Should have 5 registrations after concurrent ops, got %d", count)
 	}
 }
+
+func TestRegistrar_RecordsRegistrationTelemetry(t *testing.T) {
+	database := setupTestDB(t)
+	registrar := NewRegistrar(database)
+	ctx := context.Background()
+
+	device := createTestDevice(t, database, "alice", "passwordhash")
+	reg := &models.Registration{
+		DeviceID:  device.ID,
+		Contact:   "sip:alice@192.168.1.100:5060",
+		ExpiresAt: time.Now().Add(time.Hour),
+		UserAgent: "Yealink SIP-T46S 66.86.0.15",
+		Transport: "udp",
+	}
+	for i := 0; i < 2; i++ {
+		if err := registrar.Register(ctx, reg); err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+	}
+
+	samples, err := database.DeviceTelemetry.ListSince(ctx, device.ID, time.Now().Add(-time.Minute))
+	if err != nil || len(samples) != 2 {
+		t.Fatalf("Expected two samples, got %d, %v", len(samples), err)
+	}
+	if samples[0].RegisterIntervalSeconds != nil {
+		t.Error("Expected no interval for the first registration")
+	}
+	if samples[1].RegisterIntervalSeconds == nil || *samples[1].Firmware != reg.UserAgent {
+		t.Errorf("Expected an interval and the User-Agent firmware, got %+v", samples[1])
+	}
+}
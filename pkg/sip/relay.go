@@ -0,0 +1,663 @@
+// Package sip provides the RTP relay that anchors call media at GoSIP
+package sip
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/emiago/sipgo/sip"
+)
+
+// ErrNoMediaPorts is returned when every port in a media port range is
+// taken
+var ErrNoMediaPorts = errors.New("no free media ports")
+
+// TrunkMediaRelayHeader carries the media relay mode of a route on calls
+// delivered by Twilio
+const TrunkMediaRelayHeader = "X-Media-Relay"
+
+// TrunkMediaRelay returns the media relay mode requested for a trunk call,
+// or an empty string when it has none
+func TrunkMediaRelay(req *sip.Request) string {
+	h := req.GetHeader(TrunkMediaRelayHeader)
+	if h == nil {
+		return ""
+	}
+	mode := strings.ToLower(strings.TrimSpace(h.Value()))
+	if !config.ValidMediaRelayMode(mode) {
+		return ""
+	}
+	return mode
+}
+
+// portPool hands out media sockets from a port range, or on any free port
+// when the range is empty
+type portPool struct {
+	low, high int
+
+	mu   sync.Mutex
+	next int
+}
+
+// listen opens a socket on a free port
+func (p *portPool) listen() (*net.UDPConn, error) {
+	if p.low == 0 {
+		return net.ListenUDP("udp4", &net.UDPAddr{})
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := p.high - p.low + 1
+	for i := 0; i < n; i++ {
+		port := p.low + (p.next+i)%n
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: port})
+		if err == nil {
+			p.next = (p.next + i + 1) % n
+			return conn, nil
+		}
+	}
+	return nil, ErrNoMediaPorts
+}
+
+// listenPair opens sockets on an even port and the port after it, for RTP
+// and RTCP (RFC 3550)
+func (p *portPool) listenPair() (rtp, rtcp *net.UDPConn, err error) {
+	if p.low == 0 {
+		// Free ports come in no particular order, so try a few
+		for i := 0; i < 20; i++ {
+			if rtp, rtcp, err = listenPairAt(0); err == nil {
+				return rtp, rtcp, nil
+			}
+		}
+		return nil, nil, ErrNoMediaPorts
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	first := p.low + p.low%2
+	n := (p.high - first + 1) / 2
+	for i := 0; i < n; i++ {
+		port := first + 2*((p.next+i)%n)
+		if rtp, rtcp, err = listenPairAt(port); err == nil {
+			p.next = (p.next + i + 1) % n
+			return rtp, rtcp, nil
+		}
+	}
+	return nil, nil, ErrNoMediaPorts
+}
+
+// listenPairAt opens sockets on port and port+1. Port 0 picks a free port,
+// failing when it is odd.
+func listenPairAt(port int) (*net.UDPConn, *net.UDPConn, error) {
+	rtp, err := net.ListenUDP("udp4", &net.UDPAddr{Port: port})
+	if err != nil {
+		return nil, nil, err
+	}
+	port = rtp.LocalAddr().(*net.UDPAddr).Port
+	if port%2 != 0 {
+		rtp.Close()
+		return nil, nil, fmt.Errorf("odd RTP port %d", port)
+	}
+	rtcp, err := net.ListenUDP("udp4", &net.UDPAddr{Port: port + 1})
+	if err != nil {
+		rtp.Close()
+		return nil, nil, err
+	}
+	return rtp, rtcp, nil
+}
+
+// routeLocalIP returns the address GoSIP reaches host from, or nil when
+// host isn't an IP address or can't be reached
+func routeLocalIP(host string) net.IP {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil
+	}
+	// Connecting a UDP socket picks the route without sending anything
+	conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: ip, Port: 9})
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	if local := conn.LocalAddr().(*net.UDPAddr).IP; !local.IsUnspecified() {
+		return local
+	}
+	return nil
+}
+
+// MediaRelay anchors the media of calls between phones at GoSIP. Each
+// party sends RTP and RTCP to a pair of ports on GoSIP, which passes it
+// to the other party, so phones behind NAT that advertise addresses they
+// can't be reached on still hear each other: media goes back to wherever
+// a phone's packets come from (symmetric RTP).
+type MediaRelay struct {
+	mode       string
+	externalIP net.IP
+	ports      *portPool
+	timeout    time.Duration
+
+	mu    sync.Mutex
+	calls map[string]*RelayedCall // by Call-ID
+}
+
+// NewMediaRelay creates the relay. externalIP is given to parties outside
+// the LAN as the media address.
+func NewMediaRelay(cfg *config.MediaRelayConfig, externalIP string) (*MediaRelay, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	low, high, _ := cfg.PortRange()
+	return &MediaRelay{
+		mode:       cfg.Mode,
+		externalIP: net.ParseIP(externalIP).To4(),
+		ports:      &portPool{low: low, high: high},
+		timeout:    config.MediaRelayTimeout,
+		calls:      make(map[string]*RelayedCall),
+	}, nil
+}
+
+// Mode returns the relay mode of calls whose route doesn't choose one
+func (r *MediaRelay) Mode() string {
+	return r.mode
+}
+
+// Call returns the relayed call with a Call-ID, or nil
+func (r *MediaRelay) Call(callID string) *RelayedCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls[callID]
+}
+
+// Close ends the media of every relayed call
+func (r *MediaRelay) Close() {
+	r.mu.Lock()
+	calls := make([]*RelayedCall, 0, len(r.calls))
+	for _, c := range r.calls {
+		calls = append(calls, c)
+	}
+	r.mu.Unlock()
+
+	for _, c := range calls {
+		c.Close()
+	}
+}
+
+// mediaIP returns the address a party at host sends media to: the
+// external IP for parties on the internet, otherwise the address GoSIP
+// reaches them from
+func (r *MediaRelay) mediaIP(host string) net.IP {
+	return mediaAddress(host, r.externalIP)
+}
+
+// mediaAddress returns the address a party at host sends media to GoSIP
+// on, given GoSIP's external IP (which may be nil)
+func mediaAddress(host string, externalIP net.IP) net.IP {
+	ip := net.ParseIP(host)
+	if ip != nil && externalIP != nil && !ip.IsPrivate() && !ip.IsLoopback() {
+		return externalIP
+	}
+	if local := routeLocalIP(host); local != nil {
+		return local
+	}
+	if externalIP != nil {
+		return externalIP
+	}
+	return net.IPv4(127, 0, 0, 1)
+}
+
+// relayLeg is one party's side of a relayed call: the ports it sends to
+// and where its own media goes
+type relayLeg struct {
+	rtp  *net.UDPConn
+	rtcp *net.UDPConn
+	ip   net.IP // GoSIP's address in the SDP the party receives
+
+	// sdpAddr is the RTP address from the party's SDP. Its media goes to
+	// rtpAddr and rtcpAddr, which follow the first packets it sends.
+	sdpAddr     *net.UDPAddr
+	rtpAddr     *net.UDPAddr
+	rtcpAddr    *net.UDPAddr
+	rtpLatched  bool
+	rtcpLatched bool
+	rtcpMux     bool
+
+	packets uint64       // Received from the party
+	dtmf    dtmfDetector // The party's telephone-events
+}
+
+// port is the RTP port the party sends to
+func (l *relayLeg) port() int {
+	return l.rtp.LocalAddr().(*net.UDPAddr).Port
+}
+
+// close frees the leg's ports
+func (l *relayLeg) close() {
+	l.rtp.Close()
+	l.rtcp.Close()
+}
+
+// RelayedCall is a call whose media the relay carries. GoSIP records the
+// route of relayed calls, so re-INVITEs that move the media and the BYE
+// that ends the call pass through it.
+type RelayedCall struct {
+	CallID string
+
+	relay     *MediaRelay
+	fromTag   string // The caller's From tag, telling its requests apart
+	transport string // SIP transport requests go over without a route
+
+	caller *relayLeg
+	callee *relayLeg
+
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu         sync.Mutex
+	answered   bool
+	lastPacket time.Time
+	routes     map[string]contactRoute // Contacts of both parties, by routeKey
+	payloads   payloadNames            // Audio payload types of both parties
+	tap        mediaTap                // Given the call's RTP, e.g. to record it
+	mixer      mediaTap                // Mixes the call into a conference instead of passing media on
+	onDTMF     func(fromCaller bool, digit string, duration int)
+
+	// dtmfMu sends the digits of one request at a time
+	dtmfMu sync.Mutex
+
+	// The INVITE as relayed to the callee and the callee's answer, for
+	// requests GoSIP sends the parties itself, and the highest CSeq of
+	// the requests each party sent since
+	invite    *sip.Request
+	answer    *sip.Response
+	callerSeq uint32
+	calleeSeq uint32
+}
+
+// NewCall opens the relay ports of a call between parties at callerHost
+// and calleeHost
+func (r *MediaRelay) NewCall(callID, fromTag, callerHost, calleeHost string) (*RelayedCall, error) {
+	c := &RelayedCall{
+		CallID:   callID,
+		relay:    r,
+		fromTag:  fromTag,
+		caller:   &relayLeg{ip: r.mediaIP(callerHost)},
+		callee:   &relayLeg{ip: r.mediaIP(calleeHost)},
+		closed:   make(chan struct{}),
+		routes:   make(map[string]contactRoute),
+		payloads: make(payloadNames),
+	}
+
+	var err error
+	if c.caller.rtp, c.caller.rtcp, err = r.ports.listenPair(); err != nil {
+		return nil, err
+	}
+	if c.callee.rtp, c.callee.rtcp, err = r.ports.listenPair(); err != nil {
+		c.caller.close()
+		return nil, err
+	}
+	for _, leg := range []*relayLeg{c.caller, c.callee} {
+		go c.read(leg, leg.rtp, false)
+		go c.read(leg, leg.rtcp, true)
+	}
+
+	r.mu.Lock()
+	r.calls[callID] = c
+	r.mu.Unlock()
+	return c, nil
+}
+
+// SetRoute records where requests for a party's contact go: where its
+// requests and responses came from
+func (c *RelayedCall) SetRoute(contact, source, transport string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.routes[routeKey(contact)] = contactRoute{source: source, transport: transport}
+}
+
+// Route returns where requests for a contact in the call go
+func (c *RelayedCall) Route(contact string) (source, transport string, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	route, ok := c.routes[routeKey(contact)]
+	return route.source, route.transport, ok
+}
+
+// Translate points SDP from one party at the ports the other party sends
+// to, and notes where the sender's own media goes. Only the first audio
+// stream is relayed: other streams are declined.
+func (c *RelayedCall) Translate(sdp []byte, offer, fromCaller bool) ([]byte, error) {
+	audio := parseSDPAudio(sdp)
+	if audio == nil {
+		return nil, ErrNoAudio
+	}
+	from, to := c.caller, c.callee
+	if !fromCaller {
+		from, to = to, from
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.payloads.learn(sdp)
+
+	ip := net.ParseIP(audio.address)
+	if ip != nil && !ip.IsUnspecified() && audio.port > 0 {
+		addr := &net.UDPAddr{IP: ip, Port: audio.port}
+		// New media, e.g. after a transfer: follow it again
+		if from.sdpAddr == nil || !addrEqual(from.sdpAddr, addr) {
+			rtcpPort := audio.port + 1
+			if audio.rtcpPort > 0 {
+				rtcpPort = audio.rtcpPort
+			}
+			from.sdpAddr = addr
+			from.rtpAddr = addr
+			from.rtcpAddr = &net.UDPAddr{IP: ip, Port: rtcpPort}
+			from.rtpLatched = false
+			from.rtcpLatched = false
+		}
+	}
+
+	// RTCP shares the RTP port when the answer keeps rtcp-mux
+	from.rtcpMux = audio.rtcpMux
+	if !offer {
+		to.rtcpMux = audio.rtcpMux
+	}
+	return relaySDP(sdp, to.ip, to.port()), nil
+}
+
+// Answered ends the call from then on when both parties go quiet, in case
+// its BYE never comes
+func (c *RelayedCall) Answered() {
+	c.mu.Lock()
+	start := !c.answered
+	c.answered = true
+	c.lastPacket = time.Now()
+	c.mu.Unlock()
+
+	if start {
+		go c.watch()
+	}
+}
+
+// watch closes the call once no media has arrived for the relay timeout
+func (c *RelayedCall) watch() {
+	ticker := time.NewTicker(c.relay.timeout / 5)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.closed:
+			return
+		case now := <-ticker.C:
+			c.mu.Lock()
+			idle := now.Sub(c.lastPacket)
+			c.mu.Unlock()
+			if idle >= c.relay.timeout {
+				slog.Info("Relayed call media timed out", "call_id", c.CallID, "idle", idle.Round(time.Second))
+				c.Close()
+				return
+			}
+		}
+	}
+}
+
+// setTap hands the RTP of both parties to tap
+func (c *RelayedCall) setTap(tap mediaTap) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tap = tap
+	return true
+}
+
+// setMixer hands the audio of both parties to a conference, which sends
+// them its mix with sendMedia. Nil passes media between the parties again.
+func (c *RelayedCall) setMixer(mixer mediaTap) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mixer = mixer
+}
+
+// sendMedia sends an RTP packet to the caller or the callee
+func (c *RelayedCall) sendMedia(toCaller bool, packet []byte) {
+	to := c.callee
+	if toCaller {
+		to = c.caller
+	}
+	c.mu.Lock()
+	dest := to.rtpAddr
+	c.mu.Unlock()
+	if dest != nil {
+		to.rtp.WriteToUDP(packet, dest)
+	}
+}
+
+// setDialog keeps the INVITE relayed to the callee and its answer
+func (c *RelayedCall) setDialog(invite *sip.Request, answer *sip.Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invite, c.answer = invite, answer
+	if cseq := invite.CSeq(); cseq != nil {
+		c.callerSeq = cseq.SeqNo
+	}
+}
+
+// noteCSeq notes the CSeq of an in-dialog request a party sent
+func (c *RelayedCall) noteCSeq(fromCaller bool, seq uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if fromCaller && seq > c.callerSeq {
+		c.callerSeq = seq
+	} else if !fromCaller && seq > c.calleeSeq {
+		c.calleeSeq = seq
+	}
+}
+
+// byeRequest builds a BYE ending the dialog of the caller or the callee,
+// as if the other party had hung up, or returns nil before the call is
+// answered
+func (c *RelayedCall) byeRequest(toCaller bool) *sip.Request {
+	return c.inDialogRequest(sip.BYE, toCaller)
+}
+
+// inDialogRequest builds a request in the dialog of the caller or the
+// callee, as if the other party had sent it, or returns nil before the
+// call is answered. Its CSeq is the other party's last, which the SIP
+// client increments.
+func (c *RelayedCall) inDialogRequest(method sip.RequestMethod, toCaller bool) *sip.Request {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.invite == nil || c.answer == nil {
+		return nil
+	}
+
+	caller, callee := c.invite.From(), c.answer.To()
+	contact, seq := c.answer.Contact(), c.callerSeq
+	from := &sip.FromHeader{DisplayName: caller.DisplayName, Address: caller.Address, Params: caller.Params}
+	to := &sip.ToHeader{DisplayName: callee.DisplayName, Address: callee.Address, Params: callee.Params}
+	if toCaller {
+		contact, seq = c.invite.Contact(), c.calleeSeq
+		from = &sip.FromHeader{DisplayName: callee.DisplayName, Address: callee.Address, Params: callee.Params}
+		to = &sip.ToHeader{DisplayName: caller.DisplayName, Address: caller.Address, Params: caller.Params}
+	}
+	if contact == nil {
+		return nil
+	}
+
+	req := sip.NewRequest(method, *contact.Address.Clone())
+	req.AppendHeader(sip.HeaderClone(from))
+	req.AppendHeader(sip.HeaderClone(to))
+	req.AppendHeader(sip.HeaderClone(c.invite.CallID()))
+	req.AppendHeader(&sip.CSeqHeader{SeqNo: seq, MethodName: method})
+
+	route, ok := c.routes[routeKey(contact.Address.String())]
+	if ok {
+		req.SetDestination(route.source)
+		req.SetTransport(route.transport)
+	} else {
+		req.SetTransport(c.transport)
+	}
+	return req
+}
+
+// Close ends the call's media and frees its ports
+func (c *RelayedCall) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+
+		c.relay.mu.Lock()
+		if c.relay.calls[c.CallID] == c {
+			delete(c.relay.calls, c.CallID)
+		}
+		c.relay.mu.Unlock()
+
+		c.caller.close()
+		c.callee.close()
+
+		c.mu.Lock()
+		tap, mixer := c.tap, c.mixer
+		slog.Debug("Relayed call closed", "call_id", c.CallID, "caller_packets", c.caller.packets, "callee_packets", c.callee.packets)
+		c.mu.Unlock()
+
+		if tap != nil {
+			tap.ended()
+		}
+		if mixer != nil {
+			mixer.ended()
+		}
+	})
+}
+
+// read passes the packets a party sends to the other party. RTCP is sent
+// on the other party's RTCP port, or its RTP port when they share one.
+func (c *RelayedCall) read(from *relayLeg, conn *net.UDPConn, rtcpPort bool) {
+	to := c.callee
+	if from == c.callee {
+		to = c.caller
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		// RTP and RTCP are version 2 (RFC 3550)
+		if n < 4 || buf[0]&0xc0 != 0x80 {
+			continue
+		}
+		packet := buf[:n]
+		rtcp := rtcpPort || isRTCP(packet)
+
+		c.mu.Lock()
+		// Media goes back where the party's packets come from
+		if rtcp {
+			if !from.rtcpLatched {
+				from.rtcpAddr, from.rtcpLatched = addr, true
+			} else if !addrEqual(from.rtcpAddr, addr) {
+				c.mu.Unlock()
+				continue
+			}
+		} else {
+			if !from.rtpLatched {
+				from.rtpAddr, from.rtpLatched = addr, true
+			} else if !addrEqual(from.rtpAddr, addr) {
+				c.mu.Unlock()
+				continue
+			}
+		}
+		from.packets++
+		c.lastPacket = time.Now()
+
+		out, dest := to.rtp, to.rtpAddr
+		if rtcp && !to.rtcpMux {
+			out, dest = to.rtcp, to.rtcpAddr
+		}
+		tap, mixer, onDTMF, encoding := c.tap, c.mixer, c.onDTMF, ""
+		if (tap != nil || mixer != nil || onDTMF != nil) && !rtcp {
+			encoding = c.payloads.encoding(packet)
+		}
+		var digit string
+		var duration int
+		if onDTMF != nil && strings.EqualFold(encoding, telephoneEvent) {
+			digit, duration, _ = from.dtmf.detect(packet)
+		}
+		c.mu.Unlock()
+
+		// In a conference the parties hear the mix rather than each other
+		if dest != nil && mixer == nil {
+			out.WriteToUDP(packet, dest)
+		}
+		if encoding != "" && tap != nil {
+			tap.media(from == c.caller, encoding, packet)
+		}
+		if encoding != "" && mixer != nil {
+			mixer.media(from == c.caller, encoding, packet)
+		}
+		if digit != "" {
+			onDTMF(from == c.caller, digit, duration)
+		}
+	}
+}
+
+// relaySDP points the first audio stream of sdp at ip and port, with RTCP
+// on the port after it, and declines the other streams. ICE candidates,
+// which would lead the media around the relay, are dropped. A connection
+// address of 0.0.0.0, an old-style hold, is kept.
+func relaySDP(sdp []byte, ip net.IP, port int) []byte {
+	var out []string
+	section := "session" // session, audio or other
+	audioSeen := false
+
+	for _, line := range strings.Split(string(sdp), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "m=") {
+			fields := strings.Fields(line[2:])
+			section = "other"
+			if len(fields) >= 3 {
+				if fields[0] == "audio" && !audioSeen && fields[1] != "0" {
+					audioSeen = true
+					section = "audio"
+					fields[1] = strconv.Itoa(port)
+				} else {
+					fields[1] = "0"
+				}
+				line = "m=" + strings.Join(fields, " ")
+			}
+			out = append(out, line)
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "c=") && section != "other":
+			fields := strings.Fields(line[2:])
+			if len(fields) == 3 {
+				if addr := net.ParseIP(fields[2]); addr == nil || !addr.IsUnspecified() {
+					fields[2] = ip.String()
+				}
+				line = "c=" + strings.Join(fields, " ")
+			}
+		case strings.HasPrefix(line, "a=rtcp:") && section == "audio":
+			line = fmt.Sprintf("a=rtcp:%d IN IP4 %s", port+1, ip)
+		case strings.HasPrefix(line, "a=candidate:"), strings.HasPrefix(line, "a=remote-candidates:"),
+			line == "a=end-of-candidates", strings.HasPrefix(line, "a=ice-"):
+			continue
+		}
+		out = append(out, line)
+	}
+	return []byte(strings.Join(out, "\r\n") + "\r\n")
+}
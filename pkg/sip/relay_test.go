@@ -0,0 +1,380 @@
+package sip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+)
+
+// natPhoneOffer is an offer from a phone behind NAT, advertising its LAN
+// address, with video and an ICE candidate
+const natPhoneOffer = "v=0\r\n" +
+	"o=phone 100 1 IN IP4 192.168.1.20\r\n" +
+	"s=-\r\n" +
+	"c=IN IP4 192.168.1.20\r\n" +
+	"t=0 0\r\n" +
+	"m=audio 4000 RTP/AVP 9 0 101\r\n" +
+	"a=rtpmap:9 G722/8000\r\n" +
+	"a=rtpmap:0 PCMU/8000\r\n" +
+	"a=rtpmap:101 telephone-event/8000\r\n" +
+	"a=rtcp:4001 IN IP4 192.168.1.20\r\n" +
+	"a=candidate:1 1 udp 2130706431 192.168.1.20 4000 typ host\r\n" +
+	"a=sendrecv\r\n" +
+	"m=video 4002 RTP/AVP 96\r\n" +
+	"c=IN IP4 192.168.1.20\r\n" +
+	"a=rtpmap:96 H264/90000\r\n"
+
+func newTestRelay(t *testing.T, mode string) *MediaRelay {
+	t.Helper()
+	relay, err := NewMediaRelay(&config.MediaRelayConfig{Mode: mode}, "")
+	if err != nil {
+		t.Fatalf("NewMediaRelay failed: %v", err)
+	}
+	t.Cleanup(relay.Close)
+	return relay
+}
+
+func TestRelaySDP(t *testing.T) {
+	out := string(relaySDP([]byte(natPhoneOffer), net.IPv4(203, 0, 113, 10), 30000))
+
+	for _, want := range []string{
+		"o=phone 100 1 IN IP4 192.168.1.20\r\n",
+		"c=IN IP4 203.0.113.10\r\n",
+		"m=audio 30000 RTP/AVP 9 0 101\r\n",
+		"a=rtcp:30001 IN IP4 203.0.113.10\r\n",
+		"a=rtpmap:9 G722/8000\r\n",
+		"a=sendrecv\r\n",
+		"m=video 0 RTP/AVP 96\r\nc=IN IP4 192.168.1.20\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected relayed SDP to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "a=candidate") {
+		t.Errorf("Expected ICE candidates dropped, got:\n%s", out)
+	}
+
+	// Old-style hold keeps its null address
+	hold := strings.ReplaceAll(natPhoneOffer, "c=IN IP4 192.168.1.20", "c=IN IP4 0.0.0.0")
+	if out := string(relaySDP([]byte(hold), net.IPv4(203, 0, 113, 10), 30000)); !strings.Contains(out, "c=IN IP4 0.0.0.0\r\nt=0 0") {
+		t.Errorf("Expected the hold address kept, got:\n%s", out)
+	}
+}
+
+func TestTrunkMediaRelay(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"X-Media-Relay: always", "always"},
+		{"X-Media-Relay: NAT", "nat"},
+		{"X-Media-Relay: sometimes", ""},
+	}
+	for _, tt := range tests {
+		var req *sip.Request
+		if tt.header == "" {
+			req = parseTestInvite(t)
+		} else {
+			req = parseTestInvite(t, tt.header)
+		}
+		if got := TrunkMediaRelay(req); got != tt.want {
+			t.Errorf("TrunkMediaRelay(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestBehindNAT(t *testing.T) {
+	tests := []struct {
+		source     string
+		advertised []string
+		want       bool
+	}{
+		{"203.0.113.5", []string{"192.168.1.20"}, true},
+		{"192.168.1.20", []string{"192.168.1.20", "192.168.1.20"}, false},
+		{"192.168.1.20", []string{"0.0.0.0"}, false},
+		{"192.168.1.20", []string{"df7jal23ls0d.invalid"}, false},
+		{"", []string{"192.168.1.20"}, false},
+	}
+	for _, tt := range tests {
+		if got := behindNAT(tt.source, tt.advertised...); got != tt.want {
+			t.Errorf("behindNAT(%q, %v) = %v, want %v", tt.source, tt.advertised, got, tt.want)
+		}
+	}
+}
+
+func TestPortPool_ListenPair(t *testing.T) {
+	probe, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	low := probe.LocalAddr().(*net.UDPAddr).Port &^ 1
+	probe.Close()
+
+	pool := &portPool{low: low, high: low + 3}
+	var conns []*net.UDPConn
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for i := 0; i < 2; i++ {
+		rtp, rtcp, err := pool.listenPair()
+		if err != nil {
+			t.Skipf("Ports %d-%d not free: %v", low, low+3, err)
+		}
+		conns = append(conns, rtp, rtcp)
+		port := rtp.LocalAddr().(*net.UDPAddr).Port
+		if port%2 != 0 || rtcp.LocalAddr().(*net.UDPAddr).Port != port+1 || port < low || port > low+2 {
+			t.Errorf("Expected an even port in range with RTCP after it, got %d and %d", port, rtcp.LocalAddr().(*net.UDPAddr).Port)
+		}
+	}
+	if _, _, err := pool.listenPair(); !errors.Is(err, ErrNoMediaPorts) {
+		t.Errorf("Expected ErrNoMediaPorts, got %v", err)
+	}
+
+	rtp, rtcp, err := (&portPool{}).listenPair()
+	if err != nil {
+		t.Fatalf("listenPair failed: %v", err)
+	}
+	defer rtp.Close()
+	defer rtcp.Close()
+	if port := rtp.LocalAddr().(*net.UDPAddr).Port; port%2 != 0 || rtcp.LocalAddr().(*net.UDPAddr).Port != port+1 {
+		t.Errorf("Expected a free even port with RTCP after it, got %d", port)
+	}
+}
+
+// testPhone is a phone's media sockets
+type testPhone struct {
+	rtp  *net.UDPConn
+	rtcp *net.UDPConn
+}
+
+func newTestPhone(t *testing.T) *testPhone {
+	t.Helper()
+	p := &testPhone{}
+	for _, conn := range []**net.UDPConn{&p.rtp, &p.rtcp} {
+		c, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("ListenUDP failed: %v", err)
+		}
+		t.Cleanup(func() { c.Close() })
+		*conn = c
+	}
+	return p
+}
+
+// sdp describes the phone's media, advertising address rather than where
+// its sockets really are when it is behind NAT
+func (p *testPhone) sdp(address string) []byte {
+	port := p.rtp.LocalAddr().(*net.UDPAddr).Port
+	if address == "" {
+		address = "127.0.0.1"
+	}
+	return []byte(fmt.Sprintf("v=0\r\no=phone 1 1 IN IP4 %s\r\ns=-\r\nc=IN IP4 %s\r\nt=0 0\r\nm=audio %d RTP/AVP 0\r\na=rtpmap:0 PCMU/8000\r\na=rtcp:%d\r\n",
+		address, address, port, p.rtcp.LocalAddr().(*net.UDPAddr).Port))
+}
+
+// expect waits for a packet on conn
+func expect(t *testing.T, conn *net.UDPConn, want string) {
+	t.Helper()
+	buf := make([]byte, 1500)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("Expected %q, got %v", want, err)
+	}
+	if got := string(buf[12:n]); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+// relayedAddr is where a relayed SDP tells a phone to send media
+func relayedAddr(t *testing.T, sdp []byte) *net.UDPAddr {
+	t.Helper()
+	audio := parseSDPAudio(sdp)
+	if audio == nil {
+		t.Fatalf("No audio in relayed SDP:\n%s", sdp)
+	}
+	return &net.UDPAddr{IP: net.ParseIP(audio.address), Port: audio.port}
+}
+
+func rtpPacket(payloadType byte, payload string) []byte {
+	return append([]byte{0x80, payloadType, 0, 1, 0, 0, 0, 160, 0, 0, 0x12, 0x34}, payload...)
+}
+
+func TestRelayedCall_Media(t *testing.T) {
+	relay := newTestRelay(t, config.MediaRelayAlways)
+	call, err := relay.NewCall("call-1", "caller-tag", "127.0.0.1", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("NewCall failed: %v", err)
+	}
+	if relay.Call("call-1") != call {
+		t.Fatal("Expected the call registered")
+	}
+
+	caller, callee := newTestPhone(t), newTestPhone(t)
+
+	// The caller is behind NAT: its SDP has an address it can't be reached on
+	offer, err := call.Translate(caller.sdp("192.168.1.20"), true, true)
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	answer, err := call.Translate(callee.sdp(""), false, false)
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	toCallee := relayedAddr(t, answer) // Where the caller sends
+	toCaller := relayedAddr(t, offer)  // Where the callee sends
+	if toCallee.Port == toCaller.Port {
+		t.Fatalf("Expected separate ports for each party, got %d", toCallee.Port)
+	}
+	call.Answered()
+
+	// The callee's media reaches the caller once the caller has sent some
+	caller.rtp.WriteToUDP(rtpPacket(0, "hello callee"), toCallee)
+	expect(t, callee.rtp, "hello callee")
+	callee.rtp.WriteToUDP(rtpPacket(0, "hello caller"), toCaller)
+	expect(t, caller.rtp, "hello caller")
+
+	// RTCP goes on the ports after the RTP ones
+	rtcp := &net.UDPAddr{IP: toCallee.IP, Port: toCallee.Port + 1}
+	caller.rtcp.WriteToUDP(rtpPacket(200, "report"), rtcp)
+	expect(t, callee.rtcp, "report")
+
+	// Others can't take over a party's media
+	intruder := newTestPhone(t)
+	intruder.rtp.WriteToUDP(rtpPacket(0, "intruder"), toCallee)
+	caller.rtp.WriteToUDP(rtpPacket(0, "still the caller"), toCallee)
+	expect(t, callee.rtp, "still the caller")
+
+	call.Close()
+	if relay.Call("call-1") != nil {
+		t.Error("Expected the closed call to be gone")
+	}
+}
+
+func TestRelayedCall_RTCPMux(t *testing.T) {
+	relay := newTestRelay(t, config.MediaRelayAlways)
+	call, err := relay.NewCall("call-2", "caller-tag", "127.0.0.1", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("NewCall failed: %v", err)
+	}
+	defer call.Close()
+
+	caller, callee := newTestPhone(t), newTestPhone(t)
+	mux := func(sdp []byte) []byte { return append(sdp, "a=rtcp-mux\r\n"...) }
+	if _, err := call.Translate(mux(caller.sdp("")), true, true); err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	answer, err := call.Translate(mux(callee.sdp("")), false, false)
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+
+	caller.rtp.WriteToUDP(rtpPacket(200, "muxed report"), relayedAddr(t, answer))
+	expect(t, callee.rtp, "muxed report")
+}
+
+func TestRelayedCall_Timeout(t *testing.T) {
+	relay := newTestRelay(t, config.MediaRelayAlways)
+	relay.timeout = 50 * time.Millisecond
+	call, err := relay.NewCall("call-3", "caller-tag", "127.0.0.1", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("NewCall failed: %v", err)
+	}
+	call.Answered()
+
+	select {
+	case <-call.closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a silent call to be ended")
+	}
+	if relay.Call("call-3") != nil {
+		t.Error("Expected the timed out call to be gone")
+	}
+}
+
+func TestServer_RelayMedia(t *testing.T) {
+	database := setupTestDB(t)
+
+	newInvite := func(source string) (*sip.Request, *sip.Request) {
+		req := parseTestInvite(t, "Contact: <sip:desk@192.168.1.20:5060>")
+		req.SetBody([]byte(natPhoneOffer))
+		req.SetSource(source)
+		fwd, err := forwardRequest(req, "sip:kitchen@192.168.1.30:5060")
+		if err != nil {
+			t.Fatalf("forwardRequest failed: %v", err)
+		}
+		return req, fwd
+	}
+	reg := &models.Registration{DeviceID: 2, Contact: "sip:kitchen@192.168.1.30:5060", IPAddress: "192.168.1.30", Transport: "udp"}
+
+	newServer := func(mode string) *Server {
+		server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0", MediaRelay: &config.MediaRelayConfig{Mode: mode}}, database)
+		if err != nil {
+			t.Fatalf("NewServer failed: %v", err)
+		}
+		t.Cleanup(server.relay.Close)
+		return server
+	}
+
+	t.Run("nat mode with phones on the LAN", func(t *testing.T) {
+		server := newServer(config.MediaRelayNAT)
+		req, fwd := newInvite("192.168.1.20:5060")
+		if call := server.relayMedia(req, fwd, NewCallSession(req, CallDirectionOutbound), reg); call != nil {
+			t.Error("Expected media between LAN phones left direct")
+		}
+		if string(fwd.Body()) != natPhoneOffer {
+			t.Error("Expected the offer untouched")
+		}
+	})
+
+	t.Run("nat mode with a phone behind NAT", func(t *testing.T) {
+		server := newServer(config.MediaRelayNAT)
+		req, fwd := newInvite("203.0.113.5:41234")
+		session := NewCallSession(req, CallDirectionOutbound)
+		call := server.relayMedia(req, fwd, session, reg)
+		if call == nil {
+			t.Fatal("Expected the call relayed")
+		}
+		defer call.Close()
+
+		if !session.Relayed || server.anchoredCall(session.CallID) != call {
+			t.Error("Expected the relayed call found by Call-ID")
+		}
+		if !strings.Contains(string(fwd.Body()), fmt.Sprintf("m=audio %d RTP/AVP", call.callee.port())) {
+			t.Errorf("Expected the offer pointed at the relay, got:\n%s", fwd.Body())
+		}
+		if fwd.GetHeader("Record-Route") == nil {
+			t.Error("Expected GoSIP to record the route")
+		}
+		if source, _, ok := call.Route("sip:desk@192.168.1.20:5060"); !ok || source != "203.0.113.5:41234" {
+			t.Errorf("Expected the caller reached where it sent from, got %q %v", source, ok)
+		}
+	})
+
+	t.Run("route turns the relay on", func(t *testing.T) {
+		server := newServer(config.MediaRelayOff)
+		req, fwd := newInvite("192.168.1.20:5060")
+		session := NewCallSession(req, CallDirectionInbound)
+		if call := server.relayMedia(req, fwd, session, reg); call != nil {
+			t.Error("Expected no relay with the relay off")
+		}
+
+		req, fwd = newInvite("192.168.1.20:5060")
+		session.MediaRelay = config.MediaRelayAlways
+		call := server.relayMedia(req, fwd, session, reg)
+		if call == nil {
+			t.Fatal("Expected the route's mode to relay the call")
+		}
+		call.Close()
+	})
+}
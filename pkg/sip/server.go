@@ -2,16 +2,24 @@
 package sip
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/btafoya/gosip/internal/audio"
+	"github.com/btafoya/gosip/internal/codec"
 	"github.com/btafoya/gosip/internal/config"
 	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/diagnostics"
+	"github.com/btafoya/gosip/internal/events"
 	"github.com/emiago/sipgo"
-	"github.com/emiago/sipgo/sip"
 )
 
 // Config holds SIP server configuration
@@ -24,6 +32,16 @@ type Config struct {
 	TLS        *config.TLSConfig
 	SRTP       *config.SRTPConfig
 	ZRTP       *config.ZRTPConfig
+	CallLimits *config.CallLimitsConfig
+	Media      *config.MediaConfig
+	WebRTC     *config.WebRTCConfig
+	MediaRelay *config.MediaRelayConfig
+	ExternalIP string // Offered to browsers and phones outside the LAN as a media address
+	// RecordingsDir holds call recordings; empty turns recording off
+	RecordingsDir string
+	// VoicemailsDir holds voicemail GoSIP records itself; empty turns local
+	// voicemail off
+	VoicemailsDir string
 }
 
 // Server wraps sipgo server with GoSIP-specific functionality
@@ -45,12 +63,68 @@ type Server struct {
 	// ZRTP session management
 	zrtpMgr *ZRTPManager
 
+	// Media relay for calls with browsers (optional)
+	webrtc *WebRTCGateway
+
+	// Media relay for calls between phones (optional)
+	relay *MediaRelay
+
+	// Conferences of relayed calls (only with the media relay)
+	conferences *ConferenceManager
+
+	// Recorder of calls whose media GoSIP carries (optional)
+	recorder *RecordingManager
+
+	// Voicemail for calls not coming from Twilio (optional)
+	voicemail *VoicemailManager
+
+	// Registrations with SIP providers other than Twilio
+	trunks *TrunkManager
+
 	// Call control managers
 	sessions    *SessionManager
 	holdMgr     *HoldManager
 	transferMgr *TransferManager
 	mohMgr      *MOHManager
 	mwiMgr      *MWIManager
+	announcer   *AnnouncementPlayer
+
+	// Event subscriptions beyond message-summary, and the SUBSCRIBE flood guard
+	regEvents        *RegEventManager
+	subscribeLimiter *SubscribeLimiter
+
+	// Concurrent call caps enforced at INVITE time
+	limiter *CallLimiter
+
+	// Codecs offered to phones and on Twilio trunk legs, most preferred first
+	deviceCodecs []codec.Codec
+	trunkCodecs  []codec.Codec
+
+	// Jitter buffers for the RTP GoSIP relays
+	jitterMgr *JitterBufferManager
+
+	// Recent SIP messages of calls, for diagnostics
+	trace *SIPTrace
+
+	// Ends calls that reach their duration limit
+	durations *DurationEnforcer
+
+	// Retrieves calls left on hold too long, or sends them to voicemail
+	holdTimer      *HoldTimer
+	holdDiversions map[string]time.Time // Twilio call SIDs sent to voicemail, by when
+
+	// Event stream for call, registration and call limit events (optional)
+	events *events.Hub
+
+	// Told about ZRTP events after they are published (optional)
+	zrtpEvents ZRTPEventCallback
+
+	// Store for recovered panics (optional)
+	diagnostics *diagnostics.Store
+
+	// Check UDP requests must pass, and how many failed it (optional)
+	sourceFilter func(ip net.IP) bool
+	dropped      atomic.Uint64
 
 	mu          sync.RWMutex
 	running     bool
@@ -104,8 +178,28 @@ func NewServer(cfg Config, database *db.DB) (*Server, error) {
 		mohMgr:    mohMgr,
 		mwiMgr:    mwiMgr,
 		srtpMgr:   NewSRTPSessionManager(),
+		jitterMgr: NewJitterBufferManager(cfg.Media),
+		trace:     NewSIPTrace(config.SIPTraceMessages, config.SIPTraceCalls),
+		limiter:   NewCallLimiter(cfg.CallLimits),
+
+		regEvents:        NewRegEventManager(),
+		subscribeLimiter: NewSubscribeLimiter(config.SubscribeRateLimit, config.SubscribeRateWindow),
 	}
 
+	server.deviceCodecs, server.trunkCodecs = newCodecPreferences(cfg.Media)
+
+	sessions.SetObserver(server.publishCallState)
+	server.registrar.OnChange(server.publishRegistration)
+
+	server.announcer = NewAnnouncementPlayer(server.publishAnnouncement)
+	server.durations = NewDurationEnforcer(sessions,
+		time.Duration(server.limiter.Limits().CallDurationWarning)*time.Second,
+		server.warnCallDuration, server.endCallDuration)
+	server.holdTimer = NewHoldTimer(sessions,
+		time.Duration(server.limiter.Limits().MaxHoldTime)*time.Second,
+		server.holdTimedOut)
+	server.holdDiversions = make(map[string]time.Time)
+
 	// Validate TLS configuration
 	if cfg.TLS != nil && cfg.TLS.DisableUnencrypted && !cfg.TLS.Enabled {
 		return nil, fmt.Errorf("cannot disable unencrypted SIP without enabling TLS - set GOSIP_TLS_ENABLED=true")
@@ -143,6 +237,7 @@ func NewServer(cfg Config, database *db.DB) (*Server, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize ZRTP manager: %w", err)
 		}
+		zrtpMgr.SetEventCallback(server.handleZRTPEvent)
 		server.zrtpMgr = zrtpMgr
 		slog.Info("ZRTP end-to-end encryption enabled",
 			"mode", cfg.ZRTP.Mode,
@@ -150,15 +245,58 @@ func NewServer(cfg Config, database *db.DB) (*Server, error) {
 		)
 	}
 
+	// Initialize the WebRTC gateway if enabled
+	if cfg.WebRTC != nil && cfg.WebRTC.Enabled {
+		gw, err := NewWebRTCGateway(cfg.WebRTC, cfg.ExternalIP)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize WebRTC gateway: %w", err)
+		}
+		server.webrtc = gw
+		slog.Info("WebRTC gateway enabled",
+			"ports", cfg.WebRTC.Ports,
+			"addresses", len(gw.addresses),
+		)
+	}
+
+	// The media relay runs whenever it is configured: routes can turn it
+	// on for their calls
+	if cfg.MediaRelay != nil {
+		relay, err := NewMediaRelay(cfg.MediaRelay, cfg.ExternalIP)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize media relay: %w", err)
+		}
+		server.relay = relay
+		server.conferences = NewConferenceManager(server, relay)
+		slog.Info("Media relay ready", "mode", cfg.MediaRelay.Mode, "ports", cfg.MediaRelay.Ports)
+	}
+
+	// Only calls whose media GoSIP carries can be recorded
+	if cfg.RecordingsDir != "" {
+		server.recorder = NewRecordingManager(cfg.RecordingsDir, database, server.publishRecording)
+	}
+
+	if cfg.VoicemailsDir != "" {
+		server.voicemail = NewVoicemailManager(server, cfg.VoicemailsDir, filepath.Join(cfg.DataDir, config.PromptsDir))
+	}
+
+	server.trunks = NewTrunkManager(client, database.SIPTrunks, server.trunkContact)
+
 	// Initialize hold manager (needs server reference)
 	server.holdMgr = NewHoldManager(server, sessions, mohMgr)
 
 	// Initialize transfer manager (needs server reference)
 	server.transferMgr = NewTransferManager(server, sessions, server.holdMgr)
+	server.transferMgr.SetRecall(
+		time.Duration(server.limiter.Limits().TransferRecallTimeout)*time.Second,
+		server.transferRecalled)
 
 	// Set server reference on MWI manager for sending NOTIFY
 	mwiMgr.SetServer(server)
 
+	// Tell reg event subscribers about registration changes
+	server.registrar.OnRegister(func(deviceID int64) { server.notifyRegState(deviceID, false) })
+	server.registrar.OnUnregister(func(deviceID int64) { server.notifyRegState(deviceID, true) })
+
 	return server, nil
 }
 
@@ -177,14 +315,17 @@ func (s *Server) Start(ctx context.Context) error {
 	s.cancelFn = cancel
 
 	// Register handlers
-	s.srv.OnRegister(s.handleRegister)
-	s.srv.OnInvite(s.handleInvite)
-	s.srv.OnAck(s.handleAck)
-	s.srv.OnBye(s.handleBye)
-	s.srv.OnCancel(s.handleCancel)
-	s.srv.OnOptions(s.handleOptions)
-	s.srv.OnRefer(s.handleRefer)
-	s.srv.OnSubscribe(s.handleSubscribe)
+	s.srv.OnRegister(s.guard("REGISTER", s.handleRegister))
+	s.srv.OnInvite(s.guard("INVITE", s.handleInvite))
+	s.srv.OnAck(s.guard("ACK", s.handleAck))
+	s.srv.OnBye(s.guard("BYE", s.handleBye))
+	s.srv.OnCancel(s.guard("CANCEL", s.handleCancel))
+	s.srv.OnOptions(s.guard("OPTIONS", s.handleOptions))
+	s.srv.OnRefer(s.guard("REFER", s.handleRefer))
+	s.srv.OnNotify(s.guard("NOTIFY", s.handleNotify))
+	s.srv.OnSubscribe(s.guard("SUBSCRIBE", s.handleSubscribe))
+	s.srv.OnMessage(s.guard("MESSAGE", s.handleMessage))
+	s.srv.OnInfo(s.guard("INFO", s.handleInfo))
 
 	addr := fmt.Sprintf("0.0.0.0:%d", s.cfg.Port)
 
@@ -245,8 +386,19 @@ func (s *Server) Start(ctx context.Context) error {
 	// Start session cleanup goroutine
 	go s.cleanupTerminatedSessions(ctx)
 
-	// Start MWI subscription cleanup goroutine
-	go s.cleanupExpiredMWISubscriptions(ctx)
+	// Start subscription cleanup goroutine
+	go s.cleanupExpiredSubscriptions(ctx)
+
+	// Start call duration and hold time limit goroutine
+	go s.enforceCallLimits(ctx)
+
+	// Start device health telemetry goroutine
+	go s.collectDeviceTelemetry(ctx)
+
+	// Register with SIP trunks to other providers
+	if err := s.trunks.Start(ctx); err != nil {
+		slog.Error("Failed to start SIP trunk registrations", "error", err)
+	}
 
 	return nil
 }
@@ -260,6 +412,9 @@ func (s *Server) Stop() {
 		return
 	}
 
+	// Unregister from SIP trunks while the listeners still run
+	s.trunks.Close()
+
 	if s.cancelFn != nil {
 		s.cancelFn()
 	}
@@ -278,12 +433,33 @@ func (s *Server) Stop() {
 		}
 	}
 
+	// End relayed browser calls
+	if s.webrtc != nil {
+		s.webrtc.Close()
+	}
+	if s.conferences != nil {
+		s.conferences.Close()
+	}
+	// Store the messages of callers leaving voicemail
+	if s.voicemail != nil {
+		s.voicemail.Close()
+	}
+	if s.relay != nil {
+		s.relay.Close()
+	}
+	// Write out recordings the calls leave behind
+	if s.recorder != nil {
+		s.recorder.Close()
+	}
+
 	s.running = false
 	slog.Info("SIP server stopped")
 }
 
 // cleanupExpiredRegistrations periodically removes expired registrations
 func (s *Server) cleanupExpiredRegistrations(ctx context.Context) {
+	defer s.recoverPanic("registration cleanup")
+
 	ticker := time.NewTicker(60 * time.Second)
 	defer ticker.Stop()
 
@@ -344,6 +520,8 @@ func (s *Server) decrementCallCount() {
 
 // cleanupTerminatedSessions periodically removes terminated sessions
 func (s *Server) cleanupTerminatedSessions(ctx context.Context) {
+	defer s.recoverPanic("session cleanup")
+
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
 
@@ -357,10 +535,30 @@ func (s *Server) cleanupTerminatedSessions(ctx context.Context) {
 			if count > 0 {
 				slog.Debug("Cleaned up terminated sessions", "count", count)
 			}
+			if count := s.trace.Cleanup(config.SIPTraceRetention); count > 0 {
+				slog.Debug("Cleaned up SIP traces", "count", count)
+			}
 		}
 	}
 }
 
+// SetEventHub sets the event stream used to report rejected calls
+func (s *Server) SetEventHub(hub *events.Hub) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = hub
+}
+
+// GetCallLimiter returns the call limiter for external access
+func (s *Server) GetCallLimiter() *CallLimiter {
+	return s.limiter
+}
+
+// IsDeviceBusy reports whether a device is already on a call
+func (s *Server) IsDeviceBusy(deviceID int64) bool {
+	return s.sessions.IsDeviceBusy(deviceID)
+}
+
 // GetSessions returns the session manager for external access
 func (s *Server) GetSessions() *SessionManager {
 	return s.sessions
@@ -381,108 +579,273 @@ func (s *Server) GetMOHManager() *MOHManager {
 	return s.mohMgr
 }
 
-// GetMWIManager returns the MWI manager for external access
-func (s *Server) GetMWIManager() *MWIManager {
-	return s.mwiMgr
+// GetAnnouncer returns the in-call announcement player for external access
+func (s *Server) GetAnnouncer() *AnnouncementPlayer {
+	return s.announcer
 }
 
-// cleanupExpiredMWISubscriptions periodically removes expired MWI subscriptions
-func (s *Server) cleanupExpiredMWISubscriptions(ctx context.Context) {
-	ticker := time.NewTicker(60 * time.Second)
+// GetRecordingManager returns the call recorder, nil when recording is off
+func (s *Server) GetRecordingManager() *RecordingManager {
+	return s.recorder
+}
+
+// SetStorageCheck sets the check that refuses new recordings and
+// voicemail when the disk is low on free space
+func (s *Server) SetStorageCheck(low func(ctx context.Context) bool) {
+	if s.recorder != nil {
+		s.recorder.SetDiskCheck(low)
+	}
+	if s.voicemail != nil {
+		s.voicemail.SetDiskCheck(low)
+	}
+}
+
+// publishRecording reports recordings starting, pausing and stopping on
+// the event stream
+func (s *Server) publishRecording(status RecordingStatus) {
+	s.mu.RLock()
+	hub := s.events
+	s.mu.RUnlock()
+	hub.Publish(events.TypeCallRecording, status)
+}
+
+// publishAnnouncement reports announcement progress on the event stream
+func (s *Server) publishAnnouncement(a Announcement) {
+	s.mu.RLock()
+	hub := s.events
+	s.mu.RUnlock()
+	hub.Publish(events.TypeCallAnnouncement, a)
+}
+
+// enforceCallLimits periodically checks connected calls against their
+// duration limit and held calls against the hold time limit
+func (s *Server) enforceCallLimits(ctx context.Context) {
+	defer s.recoverPanic("call duration limits")
+
+	ticker := time.NewTicker(config.CallDurationCheckInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			if s.mwiMgr != nil {
-				s.mwiMgr.CleanupExpired()
-			}
+		case now := <-ticker.C:
+			s.durations.Check(now)
+			s.holdTimer.Check(now)
+			s.transferMgr.CheckTransfers(now)
 		}
 	}
 }
 
-// SendMWINotify sends an MWI NOTIFY message to a subscriber
-// This is called by MWIManager when state changes
-func (s *Server) SendMWINotify(ctx context.Context, sub *MWISubscription, body string) error {
-	if s.client == nil {
-		return fmt.Errorf("SIP client not initialized")
+// warnCallDuration plays the duration warning into a call about to reach its limit
+func (s *Server) warnCallDuration(session *CallSession) {
+	if _, err := s.announcer.Enqueue(session, config.CallDurationWarningPrompt, AnnounceBoth, s.promptAudio(config.CallDurationWarningPrompt)); err != nil {
+		slog.Warn("Failed to play call duration warning", "call_id", session.CallID, "error", err)
 	}
+	slog.Info("Call nearing duration limit", "call_id", session.CallID, "max_duration", session.MaxDuration)
+	s.publishDurationLimit(session, "warned")
+}
+
+// endCallDuration ends a call that reached its duration limit
+func (s *Server) endCallDuration(session *CallSession) {
+	// In a full implementation, a BYE is sent to both legs here
+	s.terminateSession(session)
+	slog.Info("Call ended at duration limit", "call_id", session.CallID, "max_duration", session.MaxDuration)
+	s.publishDurationLimit(session, "ended")
+}
+
+// promptAudio returns the audio of an uploaded prompt, or a tone when there
+// is none
+func (s *Server) promptAudio(name string) []byte {
+	if s.cfg.DataDir == "" {
+		return WarningTone()
+	}
+	path := filepath.Join(s.cfg.DataDir, config.PromptsDir, name+".wav")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return WarningTone()
+	}
+	if result := audio.ValidateWAV(bytes.NewReader(data), int64(len(data))); !result.Valid || len(data) <= 44 {
+		slog.Warn("Invalid prompt, playing a tone instead", "path", path)
+		return WarningTone()
+	}
+	return data[44:] // Skip WAV header
+}
+
+// holdTimedOut handles a call left on hold for the longest hold time. Trunk
+// calls from ring routes may go to voicemail; other calls are resumed and
+// the holder hears a recall tone.
+func (s *Server) holdTimedOut(session *CallSession) {
+	heldFor := 0
+	if heldAt := session.HeldTime(); heldAt != nil {
+		heldFor = int(time.Since(*heldAt).Seconds())
+	}
+
+	if s.limiter.Limits().HoldTimeoutAction == config.HoldTimeoutVoicemail && session.TrunkCallSID != "" {
+		s.mu.Lock()
+		now := time.Now()
+		for sid, at := range s.holdDiversions {
+			if now.Sub(at) > config.HoldDiversionTimeout {
+				delete(s.holdDiversions, sid)
+			}
+		}
+		s.holdDiversions[session.TrunkCallSID] = now
+		s.mu.Unlock()
 
-	// Calculate remaining subscription time
-	remaining := int(time.Until(sub.ExpiresAt).Seconds())
-	if remaining < 0 {
-		remaining = 0
+		// In a full implementation, a BYE is sent to the phone here. Twilio
+		// then asks the Dial action what to do with the caller.
+		s.terminateSession(session)
+		slog.Info("Held call sent to voicemail", "call_id", session.CallID, "held_for", heldFor)
+		s.publishHoldTimeout(session, config.HoldTimeoutVoicemail, heldFor)
+		return
 	}
 
-	// Build NOTIFY request per RFC 3265 (SIP Events) and RFC 3842 (MWI)
-	// Note: The actual destination is derived from the Contact header
-	notifyReq := sip.NewRequest(sip.NOTIFY, sip.Uri{})
+	go func() {
+		defer s.recoverPanic("hold retrieve")
 
-	// Add Contact header for routing
-	notifyReq.AppendHeader(sip.NewHeader("Contact", fmt.Sprintf("<%s>", sub.ContactURI)))
+		if err := s.retrieve(session, config.HoldRecallPrompt); err != nil {
+			slog.Warn("Failed to retrieve held call", "call_id", session.CallID, "error", err)
+			return
+		}
+		slog.Info("Held call retrieved", "call_id", session.CallID, "held_for", heldFor)
+		s.publishHoldTimeout(session, config.HoldTimeoutRetrieve, heldFor)
+	}()
+}
 
-	// Set the essential headers
-	notifyReq.AppendHeader(sip.NewHeader("Call-ID", sub.CallID))
-	notifyReq.AppendHeader(sip.NewHeader("From", fmt.Sprintf("<%s>;tag=%s", sub.FromURI, sub.FromTag)))
-	notifyReq.AppendHeader(sip.NewHeader("To", fmt.Sprintf("<%s>;tag=%s", sub.ToURI, sub.ToTag)))
-	notifyReq.AppendHeader(sip.NewHeader("CSeq", fmt.Sprintf("%d NOTIFY", sub.CSeq)))
+// transferRecalled gives a blind transfer the target didn't take back to
+// the transferor, who hears a recall tone
+func (s *Server) transferRecalled(session *CallSession, target, reason string) {
+	go func() {
+		defer s.recoverPanic("transfer recall")
 
-	// Event header per RFC 3265
-	notifyReq.AppendHeader(sip.NewHeader("Event", "message-summary"))
+		if err := s.retrieve(session, config.TransferRecallPrompt); err != nil {
+			slog.Warn("Failed to retrieve recalled transfer", "call_id", session.CallID, "error", err)
+		}
+		s.mu.RLock()
+		hub := s.events
+		s.mu.RUnlock()
+		hub.Publish(events.TypeCallTransferRecall, map[string]interface{}{
+			"call_id": session.CallID,
+			"target":  target,
+			"reason":  reason,
+			"from":    session.FromNumber,
+			"to":      session.ToNumber,
+		})
+	}()
+}
 
-	// Subscription-State header per RFC 3265
-	subscriptionState := "active"
-	if remaining <= 0 {
-		subscriptionState = "terminated;reason=timeout"
-	} else {
-		subscriptionState = fmt.Sprintf("active;expires=%d", remaining)
+// retrieve takes a call off hold, when it is held, and plays a prompt to
+// the phone's side of the call so the holder knows it is back
+func (s *Server) retrieve(session *CallSession, prompt string) error {
+	if state := session.GetState(); state == CallStateHolding || state == CallStateHeld {
+		ctx, cancel := context.WithTimeout(context.Background(), config.HoldRetrieveTimeout)
+		defer cancel()
+		if err := s.holdMgr.Resume(ctx, session); err != nil {
+			return err
+		}
 	}
-	notifyReq.AppendHeader(sip.NewHeader("Subscription-State", subscriptionState))
 
-	// Content-Type for MWI body per RFC 3842
-	notifyReq.AppendHeader(sip.NewHeader("Content-Type", "application/simple-message-summary"))
+	leg := AnnounceCallee
+	if session.Direction == CallDirectionOutbound {
+		leg = AnnounceCaller
+	}
+	if _, err := s.announcer.Enqueue(session, prompt, leg, s.promptAudio(prompt)); err != nil {
+		slog.Warn("Failed to play recall prompt", "call_id", session.CallID, "prompt", prompt, "error", err)
+	}
+	return nil
+}
 
-	// Set the MWI body
-	notifyReq.SetBody([]byte(body))
+// TakeHoldDiversion reports whether the call with a Twilio call SID was sent
+// to voicemail for being held too long, and forgets it
+func (s *Server) TakeHoldDiversion(callSID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.holdDiversions[callSID]
+	delete(s.holdDiversions, callSID)
+	return ok
+}
 
-	slog.Info("Sending MWI NOTIFY",
-		slog.String("aor", sub.AOR),
-		slog.String("contact", sub.ContactURI),
-		slog.String("call_id", sub.CallID),
-		slog.Uint64("cseq", uint64(sub.CSeq)),
-		slog.Int("expires", remaining),
-	)
+func (s *Server) publishHoldTimeout(session *CallSession, action string, heldFor int) {
+	s.mu.RLock()
+	hub := s.events
+	s.mu.RUnlock()
+	hub.Publish(events.TypeCallHoldTimeout, map[string]interface{}{
+		"call_id":  session.CallID,
+		"action":   action,
+		"held_for": heldFor,
+		"from":     session.FromNumber,
+		"to":       session.ToNumber,
+	})
+}
 
-	// Send the NOTIFY request
-	tx, err := s.client.TransactionRequest(ctx, notifyReq)
-	if err != nil {
-		return fmt.Errorf("failed to send MWI NOTIFY: %w", err)
-	}
-	defer tx.Terminate()
-
-	// Wait for response
-	select {
-	case res := <-tx.Responses():
-		if res.StatusCode >= 200 && res.StatusCode < 300 {
-			slog.Debug("MWI NOTIFY accepted",
-				slog.String("aor", sub.AOR),
-				slog.Int("status", int(res.StatusCode)),
-			)
-			return nil
+func (s *Server) publishDurationLimit(session *CallSession, action string) {
+	s.mu.RLock()
+	hub := s.events
+	s.mu.RUnlock()
+	hub.Publish(events.TypeCallDurationLimit, map[string]interface{}{
+		"call_id":      session.CallID,
+		"action":       action,
+		"max_duration": session.MaxDuration,
+		"from":         session.FromNumber,
+		"to":           session.ToNumber,
+	})
+}
+
+// GetMWIManager returns the MWI manager for external access
+func (s *Server) GetMWIManager() *MWIManager {
+	return s.mwiMgr
+}
+
+// cleanupExpiredSubscriptions periodically removes expired MWI and reg
+// subscriptions, and device registrations that were not refreshed
+func (s *Server) cleanupExpiredSubscriptions(ctx context.Context) {
+	defer s.recoverPanic("subscription cleanup")
+
+	ticker := time.NewTicker(60 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.mwiMgr != nil {
+				s.mwiMgr.CleanupExpired()
+			}
+			s.regEvents.CleanupExpired()
+			s.registrar.CleanupExpired()
 		}
-		slog.Warn("MWI NOTIFY rejected",
+	}
+}
+
+// SendMWINotify sends an MWI NOTIFY message to a subscriber
+// This is called by MWIManager when state changes
+func (s *Server) SendMWINotify(ctx context.Context, sub *MWISubscription, body string) error {
+	// NOTIFY per RFC 3265 (SIP Events) and RFC 3842 (MWI)
+	err := s.sendEventNotify(ctx, &eventNotify{
+		Event:       EventMessageSummary,
+		ContentType: "application/simple-message-summary",
+		Body:        body,
+		ContactURI:  sub.ContactURI,
+		CallID:      sub.CallID,
+		LocalURI:    sub.ToURI,
+		LocalTag:    sub.ToTag,
+		RemoteURI:   sub.FromURI,
+		RemoteTag:   sub.FromTag,
+		CSeq:        sub.CSeq,
+		ExpiresAt:   sub.ExpiresAt,
+		Reason:      endReason(sub.Expires),
+	})
+	if err != nil {
+		slog.Warn("MWI NOTIFY failed",
 			slog.String("aor", sub.AOR),
-			slog.Int("status", int(res.StatusCode)),
-			slog.String("reason", res.Reason),
+			slog.String("contact", sub.ContactURI),
+			slog.String("error", err.Error()),
 		)
-		return fmt.Errorf("NOTIFY rejected: %d %s", res.StatusCode, res.Reason)
-	case <-tx.Done():
-		return fmt.Errorf("NOTIFY transaction terminated without response")
-	case <-ctx.Done():
-		return fmt.Errorf("NOTIFY timeout: %w", ctx.Err())
+		return err
 	}
+	slog.Debug("MWI NOTIFY accepted", slog.String("aor", sub.AOR))
+	return nil
 }
 
 // GetCertManager returns the certificate manager for external access
@@ -636,9 +999,9 @@ func (s *Server) SetZRTPSASCallback(cb SASVerificationCallback) {
 
 // SetZRTPEventCallback sets the callback for ZRTP events
 func (s *Server) SetZRTPEventCallback(cb ZRTPEventCallback) {
-	if s.zrtpMgr != nil {
-		s.zrtpMgr.SetEventCallback(cb)
-	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.zrtpEvents = cb
 }
 
 // GetZRTPStats returns ZRTP statistics
@@ -70,10 +70,51 @@ type CallSession struct {
 	TransferredFrom  string `json:"transferred_from,omitempty"`
 	ConsultCallID    string `json:"consult_call_id,omitempty"` // For attended transfer
 
+	// Numbers the call was diverted through before reaching us, from
+	// History-Info or Diversion headers (original called number first)
+	DiversionChain []string `json:"diversion_chain,omitempty"`
+
+	// Ring class sent to the callee device in Alert-Info
+	AlertInfo string `json:"alert_info,omitempty"`
+
+	// Intercom calls are answered automatically by the callee device
+	Intercom bool `json:"intercom,omitempty"`
+
+	// Seconds the call may last once answered; 0 is unlimited
+	MaxDuration int `json:"max_duration,omitempty"`
+
+	// Twilio call SID of the caller, for trunk calls from ring routes
+	TrunkCallSID string `json:"trunk_call_sid,omitempty"`
+
+	// Media relay mode chosen by the call's route; empty uses the server's
+	MediaRelay string `json:"media_relay,omitempty"`
+
+	// Record asks for the call to be recorded once answered, which needs
+	// GoSIP to carry its media
+	Record bool `json:"record,omitempty"`
+
+	// Relayed is true when GoSIP carries the call's media
+	Relayed bool `json:"relayed,omitempty"`
+
+	// Audio codec the device answered with, e.g. "G722"
+	Codec string `json:"codec,omitempty"`
+
+	// ComfortNoise fills silence GoSIP sends the device with comfort noise;
+	// CNNegotiated is true when the device accepted CN payloads for it
+	ComfortNoise bool `json:"comfort_noise,omitempty"`
+	CNNegotiated bool `json:"cn_negotiated,omitempty"`
+
+	// Anonymous withholds the caller's number when the call leaves
+	// through the trunk
+	Anonymous bool `json:"anonymous,omitempty"`
+
 	// SIP transaction references (not serialized)
 	serverTx sip.ServerTransaction `json:"-"`
 	clientTx sip.ClientTransaction `json:"-"`
 	dialog   *Dialog               `json:"-"`
+
+	// observer is told about state changes; set by SessionManager.Add
+	observer func(*CallSession, CallState)
 }
 
 // Dialog holds SIP dialog state for mid-call requests
@@ -106,6 +147,9 @@ func NewCallSession(req *sip.Request, direction CallDirection) *CallSession {
 		ToNumber:    extractNumber(req.To().Address.String()),
 	}
 
+	session.DiversionChain = DiversionChain(req)
+	session.AlertInfo = RingClass(req)
+
 	// Extract SDP if present
 	if req.Body() != nil {
 		session.RemoteSDP = req.Body()
@@ -116,6 +160,21 @@ func NewCallSession(req *sip.Request, direction CallDirection) *CallSession {
 
 // SetState transitions the call to a new state with validation
 func (s *CallSession) SetState(newState CallState) error {
+	if err := s.setState(newState); err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	observer := s.observer
+	s.mu.RUnlock()
+	if observer != nil {
+		observer(s, newState)
+	}
+	return nil
+}
+
+// setState makes a state transition under the session lock
+func (s *CallSession) setState(newState CallState) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -205,6 +264,20 @@ func (s *CallSession) IsActive() bool {
 	return s.State != CallStateTerminated
 }
 
+// AnsweredTime returns when the call was answered, or nil while it rings
+func (s *CallSession) AnsweredTime() *time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.AnsweredAt
+}
+
+// HeldTime returns when the call was last put on hold
+func (s *CallSession) HeldTime() *time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.HeldAt
+}
+
 // Duration returns the call duration in seconds
 func (s *CallSession) Duration() int {
 	s.mu.RLock()
@@ -234,6 +307,10 @@ type SessionManager struct {
 	mu       sync.RWMutex
 	sessions map[string]*CallSession // keyed by CallID
 	byDevice map[int64][]*CallSession // sessions by device ID
+
+	// observer is told when ringing sessions are added and when sessions
+	// change state
+	observer func(*CallSession, CallState)
 }
 
 // NewSessionManager creates a new session manager
@@ -244,16 +321,31 @@ func NewSessionManager() *SessionManager {
 	}
 }
 
-// Add adds a new session to the manager
-func (m *SessionManager) Add(session *CallSession) {
+// SetObserver sets the function told when ringing sessions are added and
+// when sessions change state
+func (m *SessionManager) SetObserver(observer func(*CallSession, CallState)) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.observer = observer
+}
 
+// Add adds a new session to the manager
+func (m *SessionManager) Add(session *CallSession) {
+	m.mu.Lock()
+	observer := m.observer
 	m.sessions[session.CallID] = session
-
 	if session.DeviceID > 0 {
 		m.byDevice[session.DeviceID] = append(m.byDevice[session.DeviceID], session)
 	}
+	m.mu.Unlock()
+
+	session.mu.Lock()
+	session.observer = observer
+	state := session.State
+	session.mu.Unlock()
+	if observer != nil && state == CallStateRinging {
+		observer(session, state)
+	}
 
 	slog.Debug("Session added",
 		"call_id", session.CallID,
@@ -285,6 +377,17 @@ func (m *SessionManager) GetByDevice(deviceID int64) []*CallSession {
 	return active
 }
 
+// IsDeviceBusy reports whether a device has an answered call in progress.
+// Calls that are still ringing do not make a device busy.
+func (m *SessionManager) IsDeviceBusy(deviceID int64) bool {
+	for _, s := range m.GetByDevice(deviceID) {
+		if s.GetState() != CallStateRinging {
+			return true
+		}
+	}
+	return false
+}
+
 // Remove removes a session from the manager
 func (m *SessionManager) Remove(callID string) {
 	m.mu.Lock()
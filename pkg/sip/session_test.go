@@ -137,6 +137,37 @@ func TestSessionManager_AddAndGet(t *testing.T) {
 	}
 }
 
+func TestSessionManager_IsDeviceBusy(t *testing.T) {
+	mgr := NewSessionManager()
+
+	session := &CallSession{
+		CallID:    "call-123",
+		Direction: CallDirectionInbound,
+		State:     CallStateRinging,
+		DeviceID:  42,
+		CreatedAt: time.Now(),
+	}
+	mgr.Add(session)
+
+	// A ringing call does not make the device busy
+	if mgr.IsDeviceBusy(42) {
+		t.Error("expected ringing device not to be busy")
+	}
+
+	session.SetState(CallStateActive)
+	if !mgr.IsDeviceBusy(42) {
+		t.Error("expected device with active call to be busy")
+	}
+	if mgr.IsDeviceBusy(7) {
+		t.Error("expected device without calls not to be busy")
+	}
+
+	session.SetState(CallStateTerminated)
+	if mgr.IsDeviceBusy(42) {
+		t.Error("expected device with terminated call not to be busy")
+	}
+}
+
 func TestSessionManager_Remove(t *testing.T) {
 	mgr := NewSessionManager()
 
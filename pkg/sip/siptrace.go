@@ -0,0 +1,210 @@
+// Package sip provides per-dialog SIP message traces for GoSIP
+package sip
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// Trace directions
+const (
+	TraceIn  = "in"
+	TraceOut = "out"
+)
+
+// tracedMethods are the methods of requests, and of the responses to them,
+// that belong to a call's dialog. Registrations, keepalives and
+// subscriptions are left out.
+var tracedMethods = map[sip.RequestMethod]bool{
+	sip.INVITE: true,
+	sip.ACK:    true,
+	sip.BYE:    true,
+	sip.CANCEL: true,
+	sip.REFER:  true,
+	sip.NOTIFY: true,
+	sip.INFO:   true,
+	sip.UPDATE: true,
+	sip.PRACK:  true,
+}
+
+// SIPMessage summarizes a SIP message sent or received in a call's dialog
+type SIPMessage struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"` // "in" or "out"
+	StartLine string    `json:"start_line"`
+	Method    string    `json:"method"`           // The request method, or the CSeq method of a response
+	Status    int       `json:"status,omitempty"` // Responses only
+	CSeq      uint32    `json:"cseq"`
+	Remote    string    `json:"remote,omitempty"` // Where a message came from or went to
+	Transport string    `json:"transport,omitempty"`
+	SDP       bool      `json:"sdp"`
+}
+
+// dialogTrace is the recent SIP traffic of one call
+type dialogTrace struct {
+	messages  []SIPMessage
+	transport string // Transport of the first request received
+	offer     []byte // Latest SDP offer
+	answer    []byte // Latest SDP answer
+	updated   time.Time
+}
+
+// SIPTrace keeps the recent SIP messages of calls, including calls GoSIP
+// has already handed off to the phones, so a call can be diagnosed after
+// it connects
+type SIPTrace struct {
+	dialogs   map[string]*dialogTrace // keyed by call ID
+	perDialog int
+	maxCalls  int
+	mu        sync.RWMutex
+}
+
+// NewSIPTrace creates a SIPTrace keeping up to perDialog messages for each
+// of the maxCalls most recent calls
+func NewSIPTrace(perDialog, maxCalls int) *SIPTrace {
+	return &SIPTrace{
+		dialogs:   make(map[string]*dialogTrace),
+		perDialog: perDialog,
+		maxCalls:  maxCalls,
+	}
+}
+
+// Record adds a message to the trace of its call, if it belongs to one.
+// A nil SIPTrace records nothing.
+func (t *SIPTrace) Record(direction string, msg sip.Message) {
+	if t == nil || msg == nil || msg.CallID() == nil || msg.CSeq() == nil {
+		return
+	}
+	method := msg.CSeq().MethodName
+	if !tracedMethods[method] {
+		return
+	}
+
+	entry := SIPMessage{
+		Time:      time.Now(),
+		Direction: direction,
+		Method:    string(method),
+		CSeq:      msg.CSeq().SeqNo,
+		SDP:       isSDP(msg),
+	}
+	var isResponse bool
+	switch m := msg.(type) {
+	case *sip.Request:
+		entry.StartLine = m.StartLine()
+		entry.Transport = m.Transport()
+		entry.Remote = m.Source()
+		if direction == TraceOut {
+			entry.Remote = m.Destination()
+		}
+	case *sip.Response:
+		entry.StartLine = m.StartLine()
+		entry.Status = int(m.StatusCode)
+		entry.Transport = m.Transport()
+		entry.Remote = m.Source()
+		if direction == TraceOut {
+			entry.Remote = m.Destination()
+		}
+		isResponse = true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	callID := msg.CallID().Value()
+	d, ok := t.dialogs[callID]
+	if !ok {
+		t.evictOldest()
+		d = &dialogTrace{}
+		t.dialogs[callID] = d
+	}
+	d.updated = entry.Time
+	if d.transport == "" && direction == TraceIn && !isResponse {
+		d.transport = entry.Transport
+	}
+	if entry.SDP {
+		// Requests carry offers and responses answers. Late offers in
+		// 200 OK, answered in the ACK, are rare enough to read the same way.
+		if isResponse {
+			d.answer = msg.Body()
+		} else {
+			d.offer = msg.Body()
+		}
+	}
+	d.messages = append(d.messages, entry)
+	if len(d.messages) > t.perDialog {
+		d.messages = append(d.messages[:0:0], d.messages[len(d.messages)-t.perDialog:]...)
+	}
+}
+
+// dialog returns a copy of a call's trace
+func (t *SIPTrace) dialog(callID string) (dialogTrace, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	d, ok := t.dialogs[callID]
+	if !ok {
+		return dialogTrace{}, false
+	}
+	copied := *d
+	copied.messages = append([]SIPMessage(nil), d.messages...)
+	return copied, true
+}
+
+// Cleanup drops the traces of calls without traffic for longer than maxAge
+func (t *SIPTrace) Cleanup(maxAge time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := time.Now().Add(-maxAge)
+	count := 0
+	for callID, d := range t.dialogs {
+		if d.updated.Before(cutoff) {
+			delete(t.dialogs, callID)
+			count++
+		}
+	}
+	return count
+}
+
+// evictOldest makes room for another call by dropping the least recently
+// active one. The caller must hold the lock.
+func (t *SIPTrace) evictOldest() {
+	if len(t.dialogs) < t.maxCalls {
+		return
+	}
+	var oldestID string
+	var oldest time.Time
+	for callID, d := range t.dialogs {
+		if oldestID == "" || d.updated.Before(oldest) {
+			oldestID, oldest = callID, d.updated
+		}
+	}
+	delete(t.dialogs, oldestID)
+}
+
+// isSDP reports whether a message carries an SDP body
+func isSDP(msg sip.Message) bool {
+	if len(msg.Body()) == 0 {
+		return false
+	}
+	if ct := msg.GetHeaders("Content-Type"); len(ct) > 0 {
+		return strings.HasPrefix(strings.ToLower(ct[0].Value()), "application/sdp")
+	}
+	return bytes.HasPrefix(msg.Body(), []byte("v=0"))
+}
+
+// tracedTransaction records the responses sent on a server transaction
+type tracedTransaction struct {
+	sip.ServerTransaction
+	trace *SIPTrace
+}
+
+// Respond records and sends a response
+func (tx *tracedTransaction) Respond(res *sip.Response) error {
+	tx.trace.Record(TraceOut, res)
+	return tx.ServerTransaction.Respond(res)
+}
@@ -0,0 +1,82 @@
+package sip
+
+import (
+	"testing"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// sdpInvite returns a test INVITE carrying sdp
+func sdpInvite(t *testing.T, sdp string, extraHeaders ...string) *sip.Request {
+	t.Helper()
+	req := parseTestInvite(t, extraHeaders...)
+	req.AppendHeader(sip.NewHeader("Content-Type", "application/sdp"))
+	req.SetBody([]byte(sdp))
+	return req
+}
+
+func TestSIPTrace_Record(t *testing.T) {
+	trace := NewSIPTrace(3, 2)
+	invite := sdpInvite(t, yealinkOffer)
+	trace.Record(TraceIn, invite)
+
+	tx := &tracedTransaction{ServerTransaction: &respondRecorder{}, trace: trace}
+	tx.Respond(sip.NewResponseFromRequest(invite, sip.StatusRinging, "Ringing", nil))
+	ok := sip.NewResponseFromRequest(invite, sip.StatusOK, "OK", []byte("v=0\r\nm=audio 5000 RTP/AVP 9\r\n"))
+	ok.AppendHeader(sip.NewHeader("Content-Type", "application/sdp"))
+	tx.Respond(ok)
+
+	// Registrations aren't part of a call's dialog
+	register := parseTestInvite(t)
+	register.Method = sip.REGISTER
+	register.ReplaceHeader(&sip.CSeqHeader{SeqNo: 1, MethodName: sip.REGISTER})
+	trace.Record(TraceIn, register)
+
+	d, found := trace.dialog(invite.CallID().Value())
+	if !found || len(d.messages) != 3 {
+		t.Fatalf("Expected 3 traced messages, got %+v", d.messages)
+	}
+	if first := d.messages[0]; first.Direction != TraceIn || first.Method != "INVITE" || !first.SDP {
+		t.Errorf("Unexpected INVITE entry %+v", first)
+	}
+	if last := d.messages[2]; last.Direction != TraceOut || last.Status != 200 || last.StartLine != "SIP/2.0 200 OK" {
+		t.Errorf("Unexpected 200 OK entry %+v", last)
+	}
+	if d.transport != "UDP" || string(d.offer) != yealinkOffer || len(d.answer) == 0 {
+		t.Errorf("Unexpected dialog transport %q, offer %q, answer %q", d.transport, d.offer, d.answer)
+	}
+
+	// Only the latest messages are kept
+	bye := parseTestInvite(t)
+	bye.Method = sip.BYE
+	bye.ReplaceHeader(&sip.CSeqHeader{SeqNo: 314160, MethodName: sip.BYE})
+	trace.Record(TraceIn, bye)
+	d, _ = trace.dialog(invite.CallID().Value())
+	if len(d.messages) != 3 || d.messages[2].Method != "BYE" || d.messages[0].Status != 180 {
+		t.Errorf("Expected the 3 latest messages, got %+v", d.messages)
+	}
+}
+
+func TestSIPTrace_Eviction(t *testing.T) {
+	trace := NewSIPTrace(10, 2)
+	for _, id := range []string{"first", "second", "third"} {
+		req := parseTestInvite(t)
+		callID := sip.CallIDHeader(id)
+		req.ReplaceHeader(&callID)
+		trace.Record(TraceIn, req)
+	}
+	if _, ok := trace.dialog("first"); ok {
+		t.Error("Expected the oldest call to be evicted")
+	}
+	if _, ok := trace.dialog("third"); !ok {
+		t.Error("Expected the newest call to be kept")
+	}
+
+	if n := trace.Cleanup(0); n != 2 {
+		t.Errorf("Cleanup removed %d calls, want 2", n)
+	}
+
+	// A nil trace records nothing
+	var none *SIPTrace
+	none.Record(TraceIn, parseTestInvite(t))
+}
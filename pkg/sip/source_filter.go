@@ -0,0 +1,42 @@
+package sip
+
+import (
+	"log/slog"
+	"net"
+	"strings"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// SetSourceFilter sets the check UDP requests must pass, such as coming
+// from Twilio or the LAN. Requests that fail it are dropped unanswered, so
+// scanners don't learn the port is open. nil accepts every source.
+func (s *Server) SetSourceFilter(allow func(ip net.IP) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sourceFilter = allow
+}
+
+// DroppedRequests returns how many UDP requests the source filter dropped
+func (s *Server) DroppedRequests() uint64 {
+	return s.dropped.Load()
+}
+
+// acceptsSource reports whether a request passes the source filter. Only
+// UDP is filtered: TCP and TLS are protected by authentication and TLS.
+func (s *Server) acceptsSource(req *sip.Request) bool {
+	s.mu.RLock()
+	allow := s.sourceFilter
+	s.mu.RUnlock()
+	if allow == nil || !strings.EqualFold(req.Transport(), "UDP") {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(req.Source())
+	if err == nil && allow(net.ParseIP(host)) {
+		return true
+	}
+	s.dropped.Add(1)
+	slog.Debug("Dropped SIP request from outside the allowlist", "method", req.Method, "source", req.Source())
+	return false
+}
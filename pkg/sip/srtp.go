@@ -88,6 +88,11 @@ func getProtectionProfile(profile SRTPProfile) (srtp.ProtectionProfile, error) {
 	}
 }
 
+// Profile returns the SRTP protection profile of the context
+func (s *SRTPContext) Profile() SRTPProfile {
+	return s.profile
+}
+
 // EncryptRTP encrypts an RTP packet
 func (s *SRTPContext) EncryptRTP(dst, src []byte, header *RTPHeader) ([]byte, error) {
 	s.mu.RLock()
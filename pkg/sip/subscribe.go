@@ -0,0 +1,256 @@
+// Package sip provides shared SIP event subscription handling for GoSIP
+package sip
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/emiago/sipgo/sip"
+)
+
+// Event packages devices can subscribe to
+const (
+	EventMessageSummary = "message-summary" // RFC 3842 message waiting
+	EventReg            = "reg"             // RFC 3680 registration state
+)
+
+// SubscriptionInfo describes an event subscription for the API
+type SubscriptionInfo struct {
+	ID         string    `json:"id"`
+	Event      string    `json:"event"`
+	AOR        string    `json:"aor"`
+	Subscriber string    `json:"subscriber"`
+	ContactURI string    `json:"contact_uri"`
+	Expires    int       `json:"expires"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// SubscribeLimiter caps the SUBSCRIBE requests accepted from one address
+// within a window, so a misbehaving phone can't flood GoSIP with them
+type SubscribeLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	counts    map[string]*subscribeWindow
+	lastPrune time.Time
+}
+
+type subscribeWindow struct {
+	start time.Time
+	count int
+}
+
+// NewSubscribeLimiter creates a SubscribeLimiter allowing limit requests per
+// window from each address
+func NewSubscribeLimiter(limit int, window time.Duration) *SubscribeLimiter {
+	return &SubscribeLimiter{
+		limit:  limit,
+		window: window,
+		counts: make(map[string]*subscribeWindow),
+	}
+}
+
+// Allow counts a SUBSCRIBE from addr at now and reports whether it is
+// within the limit
+func (l *SubscribeLimiter) Allow(addr string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget addresses that have gone quiet
+	if now.Sub(l.lastPrune) >= l.window {
+		for a, w := range l.counts {
+			if now.Sub(w.start) >= l.window {
+				delete(l.counts, a)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	w := l.counts[addr]
+	if w == nil || now.Sub(w.start) >= l.window {
+		w = &subscribeWindow{start: now}
+		l.counts[addr] = w
+	}
+	w.count++
+	return w.count <= l.limit
+}
+
+// subscriptionExpires returns the duration a SUBSCRIBE asks for, capped at
+// config.SubscriptionExpires. tooBrief is true when it is shorter than
+// config.MinSubscriptionExpires without being an unsubscribe.
+func subscriptionExpires(req *sip.Request) (expires int, tooBrief bool) {
+	expires = config.SubscriptionExpires
+	if h := req.GetHeader("Expires"); h != nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(h.Value())); err == nil && n >= 0 {
+			expires = n
+		}
+	}
+	if expires > config.SubscriptionExpires {
+		expires = config.SubscriptionExpires
+	}
+	return expires, expires > 0 && expires < config.MinSubscriptionExpires
+}
+
+// subscriptionID identifies a subscription dialog by the subscriber's
+// Call-ID and From tag
+func subscriptionID(req *sip.Request) string {
+	return fmt.Sprintf("%s-%s", req.CallID().Value(), requestFromTag(req))
+}
+
+// requestFromTag returns the From tag of a request
+func requestFromTag(req *sip.Request) string {
+	if from := req.From(); from != nil && from.Params != nil {
+		tag, _ := from.Params.Get("tag")
+		return tag
+	}
+	return ""
+}
+
+// requestToTag returns the To tag of an in-dialog request, or an empty
+// string for a request that starts a dialog
+func requestToTag(req *sip.Request) string {
+	if to := req.To(); to != nil && to.Params != nil {
+		tag, _ := to.Params.Get("tag")
+		return tag
+	}
+	return ""
+}
+
+// subscriberContact returns where NOTIFY requests for a SUBSCRIBE go: its
+// Contact, or the address it came from
+func subscriberContact(req *sip.Request) string {
+	if contact := req.Contact(); contact != nil {
+		return contact.Address.String()
+	}
+	if via := req.Via(); via != nil {
+		return fmt.Sprintf("sip:%s:%d", via.Host, via.Port)
+	}
+	return ""
+}
+
+// endReason returns the Subscription-State reason for a subscription that
+// has ended: timeout, unless the subscriber ended it with Expires: 0
+func endReason(expires int) string {
+	if expires > 0 {
+		return "timeout"
+	}
+	return ""
+}
+
+// eventNotify is a NOTIFY sent within a subscription dialog. GoSIP is the
+// notifier, so From is the To of the SUBSCRIBE and To is its From.
+type eventNotify struct {
+	Event       string
+	ContentType string
+	Body        string
+	ContactURI  string // Subscriber's contact
+	CallID      string
+	LocalURI    string // To of the SUBSCRIBE
+	LocalTag    string
+	RemoteURI   string // From of the SUBSCRIBE
+	RemoteTag   string
+	CSeq        uint32
+	ExpiresAt   time.Time
+	Reason      string // Why the subscription ended, once ExpiresAt has passed
+}
+
+// sendEventNotify sends a NOTIFY for a subscription and waits for the
+// subscriber to accept it
+func (s *Server) sendEventNotify(ctx context.Context, n *eventNotify) error {
+	if s.client == nil {
+		return fmt.Errorf("SIP client not initialized")
+	}
+
+	var recipient sip.Uri
+	if err := sip.ParseUri(n.ContactURI, &recipient); err != nil {
+		return fmt.Errorf("invalid subscriber contact %q: %w", n.ContactURI, err)
+	}
+
+	remaining := int(time.Until(n.ExpiresAt).Seconds())
+	subscriptionState := "terminated"
+	if remaining > 0 {
+		subscriptionState = fmt.Sprintf("active;expires=%d", remaining)
+	} else if n.Reason != "" {
+		subscriptionState += ";reason=" + n.Reason
+	}
+
+	req := sip.NewRequest(sip.NOTIFY, recipient)
+	req.AppendHeader(sip.NewHeader("Call-ID", n.CallID))
+	req.AppendHeader(sip.NewHeader("From", fmt.Sprintf("<%s>;tag=%s", n.LocalURI, n.LocalTag)))
+	req.AppendHeader(sip.NewHeader("To", fmt.Sprintf("<%s>;tag=%s", n.RemoteURI, n.RemoteTag)))
+	req.AppendHeader(sip.NewHeader("CSeq", fmt.Sprintf("%d NOTIFY", n.CSeq)))
+	req.AppendHeader(sip.NewHeader("Event", n.Event))
+	req.AppendHeader(sip.NewHeader("Subscription-State", subscriptionState))
+	req.AppendHeader(sip.NewHeader("Content-Type", n.ContentType))
+	req.SetBody([]byte(n.Body))
+
+	slog.Debug("Sending NOTIFY",
+		slog.String("event", n.Event),
+		slog.String("contact", n.ContactURI),
+		slog.String("call_id", n.CallID),
+		slog.Uint64("cseq", uint64(n.CSeq)),
+		slog.Int("expires", remaining),
+	)
+
+	tx, err := s.client.TransactionRequest(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to send NOTIFY: %w", err)
+	}
+	defer tx.Terminate()
+
+	select {
+	case res := <-tx.Responses():
+		if res.IsSuccess() {
+			return nil
+		}
+		return fmt.Errorf("NOTIFY rejected: %d %s", res.StatusCode, res.Reason)
+	case <-tx.Done():
+		return fmt.Errorf("NOTIFY transaction terminated without response")
+	case <-ctx.Done():
+		return fmt.Errorf("NOTIFY timeout: %w", ctx.Err())
+	}
+}
+
+// ListSubscriptions returns every message-summary and reg subscription,
+// soonest to expire first
+func (s *Server) ListSubscriptions() []SubscriptionInfo {
+	list := []SubscriptionInfo{}
+	if s.mwiMgr != nil {
+		for _, sub := range s.mwiMgr.ListSubscriptions() {
+			list = append(list, SubscriptionInfo{
+				ID:         sub.ID,
+				Event:      EventMessageSummary,
+				AOR:        sub.AOR,
+				Subscriber: sub.FromURI,
+				ContactURI: sub.ContactURI,
+				Expires:    sub.Expires,
+				CreatedAt:  sub.CreatedAt,
+				ExpiresAt:  sub.ExpiresAt,
+			})
+		}
+	}
+	if s.regEvents != nil {
+		for _, sub := range s.regEvents.ListSubscriptions() {
+			list = append(list, SubscriptionInfo{
+				ID:         sub.ID,
+				Event:      EventReg,
+				AOR:        sub.AOR,
+				Subscriber: sub.FromURI,
+				ContactURI: sub.ContactURI,
+				Expires:    sub.Expires,
+				CreatedAt:  sub.CreatedAt,
+				ExpiresAt:  sub.ExpiresAt,
+			})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ExpiresAt.Before(list[j].ExpiresAt) })
+	return list
+}
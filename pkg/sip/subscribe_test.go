@@ -0,0 +1,222 @@
+package sip
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+)
+
+func parseTestSubscribe(t *testing.T, headers ...string) *sip.Request {
+	t.Helper()
+	req := parseTestInvite(t, headers...)
+	req.Method = sip.SUBSCRIBE
+	return req
+}
+
+// newSubscribeTestServer returns a server that can't send NOTIFY, so tests
+// only see the SUBSCRIBE responses
+func newSubscribeTestServer(t *testing.T) *Server {
+	t.Helper()
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0"}, setupTestDB(t))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	server.client = nil
+	return server
+}
+
+func subscribe(server *Server, req *sip.Request) *sip.Response {
+	tx := &respondRecorder{}
+	server.handleSubscribe(req, tx)
+	if len(tx.responses) != 1 {
+		return nil
+	}
+	return tx.responses[0]
+}
+
+func TestSubscribeLimiter_Allow(t *testing.T) {
+	limiter := NewSubscribeLimiter(2, time.Minute)
+	now := time.Now()
+
+	if !limiter.Allow("10.0.0.1", now) || !limiter.Allow("10.0.0.1", now) {
+		t.Fatal("Expected the first two requests to be allowed")
+	}
+	if limiter.Allow("10.0.0.1", now.Add(time.Second)) {
+		t.Error("Expected the third request in the window to be refused")
+	}
+	if !limiter.Allow("10.0.0.2", now) {
+		t.Error("Expected another address to have its own limit")
+	}
+	if !limiter.Allow("10.0.0.1", now.Add(time.Minute)) {
+		t.Error("Expected a new window to allow requests again")
+	}
+}
+
+func TestSubscriptionExpires(t *testing.T) {
+	tests := []struct {
+		header       string
+		wantExpires  int
+		wantTooBrief bool
+	}{
+		{"", config.SubscriptionExpires, false},
+		{"Expires: 600", 600, false},
+		{"Expires: 86400", config.SubscriptionExpires, false},
+		{"Expires: 30", 30, true},
+		{"Expires: 0", 0, false},
+		{"Expires: soon", config.SubscriptionExpires, false},
+	}
+	for _, tt := range tests {
+		var headers []string
+		if tt.header != "" {
+			headers = append(headers, tt.header)
+		}
+		expires, tooBrief := subscriptionExpires(parseTestSubscribe(t, headers...))
+		if expires != tt.wantExpires || tooBrief != tt.wantTooBrief {
+			t.Errorf("subscriptionExpires(%q) = %d/%v, want %d/%v", tt.header, expires, tooBrief, tt.wantExpires, tt.wantTooBrief)
+		}
+	}
+}
+
+func TestHandleSubscribe_MWIDialog(t *testing.T) {
+	server := newSubscribeTestServer(t)
+
+	res := subscribe(server, parseTestSubscribe(t, "Event: message-summary", "Contact: <sip:100@10.0.0.1:5060>", "Expires: 600"))
+	if res == nil || res.StatusCode != sip.StatusOK {
+		t.Fatalf("Expected 200 OK, got %v", res)
+	}
+	toTag, _ := res.To().Params.Get("tag")
+	if toTag == "" {
+		t.Fatal("Expected the response to set a To tag")
+	}
+
+	subs := server.mwiMgr.ListSubscriptions()
+	if len(subs) != 1 || subs[0].ToTag != toTag || subs[0].ContactURI != "sip:100@10.0.0.1:5060" {
+		t.Fatalf("Unexpected subscriptions %+v", subs)
+	}
+
+	// A refresh within the dialog keeps its To tag
+	refresh := parseTestSubscribe(t, "Event: message-summary", "Expires: 1200")
+	refresh.To().Params.Add("tag", toTag)
+	if res = subscribe(server, refresh); res == nil || res.StatusCode != sip.StatusOK {
+		t.Fatalf("Expected the refresh to be accepted, got %v", res)
+	}
+	if tag, _ := res.To().Params.Get("tag"); tag != toTag {
+		t.Errorf("Refresh To tag = %q, want %q", tag, toTag)
+	}
+	if sub := server.mwiMgr.GetSubscription(subs[0].ID); sub.Expires != 1200 {
+		t.Errorf("Expires = %d, want 1200", sub.Expires)
+	}
+
+	// A refresh for a dialog GoSIP doesn't know is refused
+	stranger := parseTestSubscribe(t, "Event: message-summary")
+	stranger.To().Params.Add("tag", "unknown")
+	if res = subscribe(server, stranger); res == nil || res.StatusCode != 481 {
+		t.Errorf("Expected 481 for an unknown dialog, got %v", res)
+	}
+
+	// Unsubscribing ends the subscription
+	unsubscribe := parseTestSubscribe(t, "Event: message-summary", "Expires: 0")
+	unsubscribe.To().Params.Add("tag", toTag)
+	if res = subscribe(server, unsubscribe); res == nil || res.StatusCode != sip.StatusOK {
+		t.Fatalf("Expected the unsubscribe to be accepted, got %v", res)
+	}
+	deadline := time.Now().Add(time.Second)
+	for server.mwiMgr.GetSubscriptionCount() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := server.mwiMgr.GetSubscriptionCount(); n != 0 {
+		t.Errorf("Expected no subscriptions after unsubscribing, got %d", n)
+	}
+}
+
+func TestHandleSubscribe_Rejections(t *testing.T) {
+	server := newSubscribeTestServer(t)
+
+	res := subscribe(server, parseTestSubscribe(t, "Event: message-summary", "Expires: 10"))
+	if res == nil || res.StatusCode != 423 {
+		t.Fatalf("Expected 423 for a brief subscription, got %v", res)
+	}
+	if h := res.GetHeader("Min-Expires"); h == nil || h.Value() != "60" {
+		t.Errorf("Expected Min-Expires: 60, got %v", h)
+	}
+
+	res = subscribe(server, parseTestSubscribe(t, "Event: presence"))
+	if res == nil || res.StatusCode != 489 {
+		t.Fatalf("Expected 489 for an unknown event, got %v", res)
+	}
+	if h := res.GetHeader("Allow-Events"); h == nil || !strings.Contains(h.Value(), "reg") {
+		t.Errorf("Expected Allow-Events to list reg, got %v", h)
+	}
+
+	// reg subscriptions need credentials
+	if res = subscribe(server, parseTestSubscribe(t, "Event: reg")); res == nil || res.StatusCode != sip.StatusUnauthorized {
+		t.Errorf("Expected 401 for an unauthenticated reg SUBSCRIBE, got %v", res)
+	}
+}
+
+func TestHandleSubscribe_RateLimit(t *testing.T) {
+	server := newSubscribeTestServer(t)
+	server.subscribeLimiter = NewSubscribeLimiter(1, time.Minute)
+
+	subscribe(server, parseTestSubscribe(t, "Event: message-summary"))
+	res := subscribe(server, parseTestSubscribe(t, "Event: message-summary"))
+	if res == nil || res.StatusCode != sip.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 over the rate limit, got %v", res)
+	}
+	if res.GetHeader("Retry-After") == nil {
+		t.Error("Expected a Retry-After header")
+	}
+}
+
+func TestRegEventManager_Add(t *testing.T) {
+	mgr := NewRegEventManager()
+	for i := 0; i < config.MaxSubscriptionsPerAOR; i++ {
+		if err := mgr.Add(&RegSubscription{ID: string(rune('a' + i)), TargetDeviceID: 1, Expires: 600}); err != nil {
+			t.Fatalf("Add %d failed: %v", i, err)
+		}
+	}
+	if err := mgr.Add(&RegSubscription{ID: "extra", TargetDeviceID: 1, Expires: 600}); err != ErrTooManySubscriptions {
+		t.Errorf("Expected ErrTooManySubscriptions, got %v", err)
+	}
+	if err := mgr.Add(&RegSubscription{ID: "other", TargetDeviceID: 2, Expires: 600}); err != nil {
+		t.Errorf("Expected another device to have its own cap, got %v", err)
+	}
+	if ids := mgr.ForDevice(2); len(ids) != 1 || ids[0] != "other" {
+		t.Errorf("ForDevice(2) = %v", ids)
+	}
+
+	// Each NOTIFY has the next CSeq and reginfo version
+	first := mgr.nextNotify("other")
+	second := mgr.nextNotify("other")
+	if first.CSeq != 1 || first.Version != 0 || second.CSeq != 2 || second.Version != 1 {
+		t.Errorf("Unexpected CSeq/version %d/%d then %d/%d", first.CSeq, first.Version, second.CSeq, second.Version)
+	}
+}
+
+func TestBuildRegInfo(t *testing.T) {
+	now := time.Now()
+	reg := &models.Registration{ID: 7, Contact: "sip:100@10.0.0.5:5060", ExpiresAt: now.Add(10 * time.Minute)}
+
+	body := BuildRegInfo("sip:100@gosip.local", 3, 2, reg, false, now)
+	for _, want := range []string{
+		`<reginfo xmlns="urn:ietf:params:xml:ns:reginfo" version="2" state="full">`,
+		`<registration aor="sip:100@gosip.local" id="reg-3" state="active">`,
+		`<contact id="contact-7" state="active" event="registered" expires="600">`,
+		`<uri>sip:100@10.0.0.5:5060</uri>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %s in\n%s", want, body)
+		}
+	}
+
+	if body := BuildRegInfo("sip:100@gosip.local", 3, 0, nil, false, now); !strings.Contains(body, `state="init"`) || strings.Contains(body, "<contact") {
+		t.Errorf("Expected an unregistered device to be init without contacts, got\n%s", body)
+	}
+	if body := BuildRegInfo("sip:100@gosip.local", 3, 1, nil, true, now); !strings.Contains(body, `id="reg-3" state="terminated"`) {
+		t.Errorf("Expected an unregistered device to be terminated, got\n%s", body)
+	}
+}
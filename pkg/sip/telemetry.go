@@ -0,0 +1,126 @@
+// Package sip provides device health telemetry for GoSIP
+package sip
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+)
+
+// maxConcurrentPings limits the OPTIONS pings in flight at once
+const maxConcurrentPings = 10
+
+// recordRegistration stores a telemetry sample for a registration: the time
+// since the device last registered, and the firmware phones report in their
+// User-Agent. Failures are logged, never fail the registration.
+func (r *Registrar) recordRegistration(ctx context.Context, reg *models.Registration) {
+	now := time.Now()
+	r.mu.Lock()
+	previous, seen := r.registeredAt[reg.DeviceID]
+	r.registeredAt[reg.DeviceID] = now
+	r.mu.Unlock()
+
+	sample := &models.DeviceTelemetry{DeviceID: reg.DeviceID, Source: db.TelemetrySourceRegister, CreatedAt: now}
+	if seen {
+		interval := int(now.Sub(previous).Round(time.Second) / time.Second)
+		sample.RegisterIntervalSeconds = &interval
+	}
+	if reg.UserAgent != "" {
+		firmware := reg.UserAgent
+		sample.Firmware = &firmware
+	}
+	if err := r.db.DeviceTelemetry.Record(ctx, sample); err != nil {
+		slog.Warn("Failed to record registration telemetry", "error", err, "device_id", reg.DeviceID)
+	}
+}
+
+// PingDevice sends an OPTIONS request to a registered device's contact and
+// returns the round trip time
+func (s *Server) PingDevice(ctx context.Context, reg *models.Registration) (time.Duration, error) {
+	if s.client == nil {
+		return 0, fmt.Errorf("SIP client not initialized")
+	}
+
+	var uri sip.Uri
+	if err := sip.ParseUri(strings.Trim(reg.Contact, "<>"), &uri); err != nil {
+		return 0, fmt.Errorf("invalid contact %q: %w", reg.Contact, err)
+	}
+
+	req := sip.NewRequest(sip.OPTIONS, uri)
+	req.AppendHeader(sip.NewHeader("From", fmt.Sprintf("<sip:gosip@%s>;tag=%s", s.client.GetHostname(), sip.GenerateTagN(16))))
+	req.AppendHeader(sip.NewHeader("To", fmt.Sprintf("<%s>", uri.String())))
+
+	start := time.Now()
+	if _, err := s.requestFinalResponse(ctx, req); err != nil {
+		return 0, err
+	}
+	// Any final response, even an error, shows the phone is alive
+	return time.Since(start), nil
+}
+
+// collectDeviceTelemetry periodically pings registered devices and prunes
+// old telemetry
+func (s *Server) collectDeviceTelemetry(ctx context.Context) {
+	defer s.recoverPanic("device telemetry")
+
+	ticker := time.NewTicker(config.DeviceTelemetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.pingRegisteredDevices(ctx)
+			if count, err := s.db.DeviceTelemetry.DeleteBefore(ctx, time.Now().Add(-config.DeviceTelemetryRetention)); err != nil {
+				slog.Error("Failed to prune device telemetry", "error", err)
+			} else if count > 0 {
+				slog.Debug("Pruned device telemetry", "count", count)
+			}
+		}
+	}
+}
+
+// pingRegisteredDevices pings each registered device and records the round
+// trip time, or a lost ping when the device doesn't answer
+func (s *Server) pingRegisteredDevices(ctx context.Context) {
+	regs, err := s.db.Registrations.ListActive(ctx)
+	if err != nil {
+		slog.Error("Failed to list registrations for telemetry", "error", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, maxConcurrentPings)
+	for _, reg := range regs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(reg *models.Registration) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			pingCtx, cancel := context.WithTimeout(ctx, config.DevicePingTimeout)
+			defer cancel()
+
+			sample := &models.DeviceTelemetry{DeviceID: reg.DeviceID, Source: db.TelemetrySourcePing}
+			if rtt, err := s.PingDevice(pingCtx, reg); err != nil {
+				slog.Debug("Device did not answer ping", "device_id", reg.DeviceID, "error", err)
+			} else {
+				ms := int(rtt.Milliseconds())
+				sample.RTTMs = &ms
+			}
+			if err := s.db.DeviceTelemetry.Record(ctx, sample); err != nil {
+				slog.Warn("Failed to record ping telemetry", "error", err, "device_id", reg.DeviceID)
+			}
+		}(reg)
+	}
+	wg.Wait()
+}
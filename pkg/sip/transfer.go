@@ -3,9 +3,11 @@ package sip
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/emiago/sipgo/sip"
@@ -24,6 +26,11 @@ type TransferManager struct {
 	server     *Server
 	sessions   *SessionManager
 	holdMgr    *HoldManager
+
+	mu            sync.Mutex
+	recallTimeout time.Duration
+	supervised    map[string]*supervisedTransfer // Blind transfers waiting for the target to answer, by call ID
+	onRecall      TransferRecallHandler
 }
 
 // NewTransferManager creates a new transfer manager
@@ -32,6 +39,7 @@ func NewTransferManager(server *Server, sessions *SessionManager, holdMgr *HoldM
 		server:     server,
 		sessions:   sessions,
 		holdMgr:    holdMgr,
+		supervised: make(map[string]*supervisedTransfer),
 	}
 }
 
@@ -93,11 +101,16 @@ func (t *TransferManager) handleBlindTransfer(session *CallSession, req *sip.Req
 
 	// Perform the transfer in background
 	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer t.server.recoverPanic("blind transfer")
+		ctx, cancel := context.WithTimeout(context.Background(), t.blindTransferTimeout())
 		defer cancel()
 
 		err := t.executeBlindTransfer(ctx, session, targetURI)
-		if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && t.recallEnabled() {
+			// The target didn't answer; the transferor gets the call back
+			t.sendNotify(session, req, "SIP/2.0 408 Request Timeout")
+			t.recall(session, targetURI, TransferRecallNoAnswer)
+		} else if err != nil {
 			slog.Error("Blind transfer failed", "error", err, "call_id", session.CallID)
 			t.sendNotify(session, req, "SIP/2.0 503 Service Unavailable")
 			// Revert to active state
@@ -146,6 +159,7 @@ func (t *TransferManager) handleAttendedTransfer(session *CallSession, req *sip.
 
 	// Perform attended transfer in background
 	go func() {
+		defer t.server.recoverPanic("attended transfer")
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
@@ -182,6 +196,7 @@ func (t *TransferManager) BlindTransfer(ctx context.Context, session *CallSessio
 	referReq := t.createReferRequest(session, targetURI)
 
 	// Send REFER
+	t.server.trace.Record(TraceOut, referReq)
 	tx, err := t.server.client.TransactionRequest(ctx, referReq)
 	if err != nil {
 		return fmt.Errorf("failed to send REFER: %w", err)
@@ -191,6 +206,7 @@ func (t *TransferManager) BlindTransfer(ctx context.Context, session *CallSessio
 	// Wait for response
 	select {
 	case res := <-tx.Responses():
+		t.server.trace.Record(TraceIn, res)
 		if res.StatusCode == sip.StatusAccepted || res.IsSuccess() {
 			if err := session.SetState(CallStateTransferring); err != nil {
 				return err
@@ -199,6 +215,8 @@ func (t *TransferManager) BlindTransfer(ctx context.Context, session *CallSessio
 			session.TransferTarget = targetURI
 			session.mu.Unlock()
 
+			t.supervise(session, targetURI)
+
 			slog.Info("Blind transfer initiated",
 				"call_id", session.CallID,
 				"target", targetNumber,
@@ -228,6 +246,7 @@ func (t *TransferManager) AttendedTransfer(ctx context.Context, originalSession
 	referReq := t.createReferWithReplacesRequest(originalSession, targetURI, replacesHeader)
 
 	// Send REFER
+	t.server.trace.Record(TraceOut, referReq)
 	tx, err := t.server.client.TransactionRequest(ctx, referReq)
 	if err != nil {
 		return fmt.Errorf("failed to send REFER: %w", err)
@@ -237,6 +256,7 @@ func (t *TransferManager) AttendedTransfer(ctx context.Context, originalSession
 	// Wait for response
 	select {
 	case res := <-tx.Responses():
+		t.server.trace.Record(TraceIn, res)
 		if res.StatusCode == sip.StatusAccepted || res.IsSuccess() {
 			if err := originalSession.SetState(CallStateTransferring); err != nil {
 				return err
@@ -408,6 +428,10 @@ func (t *TransferManager) createReferRequest(session *CallSession, targetURI str
 	req.AppendHeader(sip.NewHeader("Call-ID", session.CallID))
 	req.AppendHeader(sip.NewHeader("Refer-To", "<"+targetURI+">"))
 
+	// Let the transfer target see who the call was originally for
+	AddDiversion(req, session.LocalURI, DiversionDeflection)
+	AddHistoryInfo(req, session.LocalURI, targetURI, DiversionDeflection)
+
 	return req
 }
 
@@ -444,6 +468,7 @@ func (t *TransferManager) sendNotify(session *CallSession, originalReq *sip.Requ
 	notifyReq.AppendHeader(sip.NewHeader("Content-Type", "message/sipfrag;version=2.0"))
 	notifyReq.SetBody(body)
 
+	t.server.trace.Record(TraceOut, notifyReq)
 	tx, err := t.server.client.TransactionRequest(ctx, notifyReq)
 	if err != nil {
 		slog.Warn("Failed to send transfer NOTIFY", "error", err)
@@ -452,8 +477,8 @@ func (t *TransferManager) sendNotify(session *CallSession, originalReq *sip.Requ
 	defer tx.Terminate()
 
 	select {
-	case <-tx.Responses():
-		// Response received
+	case res := <-tx.Responses():
+		t.server.trace.Record(TraceIn, res)
 	case <-tx.Done():
 		// Transaction done
 	case <-ctx.Done():
@@ -0,0 +1,163 @@
+// Package sip provides blind transfer supervision and recall for GoSIP
+package sip
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// Reasons a blind transfer is recalled
+const (
+	TransferRecallNoAnswer = "no_answer" // The target didn't answer within the recall timeout
+	TransferRecallFailed   = "failed"    // The target rejected the call or couldn't be reached
+)
+
+// defaultBlindTransferTimeout limits blind transfers when recall is disabled
+const defaultBlindTransferTimeout = 30 * time.Second
+
+// TransferRecallHandler is told when a blind transfer is recalled to the
+// transferor. The session is back in the state it was in before the transfer.
+type TransferRecallHandler func(session *CallSession, target, reason string)
+
+// supervisedTransfer is a blind transfer waiting for the target to answer
+type supervisedTransfer struct {
+	target    string
+	startedAt time.Time
+}
+
+// SetRecall enables recalling blind transfers the target doesn't answer
+// within timeout. A timeout of 0 disables recall.
+func (t *TransferManager) SetRecall(timeout time.Duration, onRecall TransferRecallHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recallTimeout = timeout
+	t.onRecall = onRecall
+}
+
+func (t *TransferManager) recallEnabled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.recallTimeout > 0 && t.onRecall != nil
+}
+
+// blindTransferTimeout returns how long a blind transfer may take to reach
+// the target before it fails or is recalled
+func (t *TransferManager) blindTransferTimeout() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.recallTimeout > 0 && t.onRecall != nil {
+		return t.recallTimeout
+	}
+	return defaultBlindTransferTimeout
+}
+
+// supervise starts watching a blind transfer for the target to answer
+func (t *TransferManager) supervise(session *CallSession, target string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.recallTimeout <= 0 || t.onRecall == nil {
+		return
+	}
+	if t.supervised == nil {
+		t.supervised = make(map[string]*supervisedTransfer)
+	}
+	t.supervised[session.CallID] = &supervisedTransfer{target: target, startedAt: time.Now()}
+}
+
+// CheckTransfers recalls supervised blind transfers the target hasn't
+// answered by now
+func (t *TransferManager) CheckTransfers(now time.Time) {
+	t.mu.Lock()
+	var expired []*CallSession
+	var targets []string
+	for callID, st := range t.supervised {
+		session := t.sessions.Get(callID)
+		// Cancelled and ended transfers need no recall
+		if session == nil || session.GetState() != CallStateTransferring {
+			delete(t.supervised, callID)
+			continue
+		}
+		if now.Sub(st.startedAt) >= t.recallTimeout {
+			delete(t.supervised, callID)
+			expired = append(expired, session)
+			targets = append(targets, st.target)
+		}
+	}
+	t.mu.Unlock()
+
+	for i, session := range expired {
+		t.recall(session, targets[i], TransferRecallNoAnswer)
+	}
+}
+
+// HandleNotify processes a NOTIFY reporting the progress of a REFER GoSIP
+// sent. The message/sipfrag body holds the target's response: a final
+// success completes the transfer and a failure recalls it right away.
+func (t *TransferManager) HandleNotify(req *sip.Request, tx sip.ServerTransaction) {
+	t.sendResponse(tx, req, sip.StatusOK, "OK")
+
+	callID := req.CallID().Value()
+	code := sipFragStatus(req.Body())
+	if code < 200 {
+		return
+	}
+
+	t.mu.Lock()
+	st, ok := t.supervised[callID]
+	delete(t.supervised, callID)
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	if code < 300 {
+		// The transferee sends BYE for the original call
+		slog.Info("Blind transfer answered", "call_id", callID, "target", st.target)
+		return
+	}
+
+	if session := t.sessions.Get(callID); session != nil && session.GetState() == CallStateTransferring {
+		slog.Info("Blind transfer failed", "call_id", callID, "target", st.target, "status", code)
+		t.recall(session, st.target, TransferRecallFailed)
+	}
+}
+
+// sipFragStatus returns the status code in a message/sipfrag body such as
+// "SIP/2.0 180 Ringing", or 0 when it has none
+func sipFragStatus(body []byte) int {
+	line := strings.SplitN(string(body), "\n", 2)[0]
+	fields := strings.Fields(line)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "SIP/") {
+		return 0
+	}
+	code, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0
+	}
+	return code
+}
+
+// recall takes a blind transfer back from the target so the call returns
+// to the transferor
+func (t *TransferManager) recall(session *CallSession, target, reason string) {
+	// In a full implementation, the call to the target is cancelled here,
+	// before it reaches the target's voicemail
+	if err := t.CancelTransfer(context.Background(), session); err != nil {
+		slog.Warn("Failed to recall transfer", "call_id", session.CallID, "error", err)
+		return
+	}
+
+	t.mu.Lock()
+	onRecall := t.onRecall
+	t.mu.Unlock()
+
+	slog.Info("Blind transfer recalled", "call_id", session.CallID, "target", target, "reason", reason)
+	if onRecall != nil {
+		onRecall(session, target, reason)
+	}
+}
@@ -0,0 +1,155 @@
+package sip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// respondRecorder is a server transaction that keeps the responses sent on it
+type respondRecorder struct {
+	sip.ServerTransaction
+	responses []*sip.Response
+}
+
+func (r *respondRecorder) Respond(res *sip.Response) error {
+	r.responses = append(r.responses, res)
+	return nil
+}
+
+type recalledTransfer struct {
+	callID, target, reason string
+}
+
+func newRecallTestManager(timeout time.Duration) (*TransferManager, *SessionManager, *[]recalledTransfer) {
+	sessions := NewSessionManager()
+	mgr := NewTransferManager(nil, sessions, nil)
+	var recalled []recalledTransfer
+	mgr.SetRecall(timeout, func(s *CallSession, target, reason string) {
+		recalled = append(recalled, recalledTransfer{s.CallID, target, reason})
+	})
+	return mgr, sessions, &recalled
+}
+
+func TestSipFragStatus(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+	}{
+		{"SIP/2.0 100 Trying\r\n", 100},
+		{"SIP/2.0 200 OK", 200},
+		{"SIP/2.0 486 Busy Here\r\nContent-Length: 0\r\n", 486},
+		{"", 0},
+		{"not a status line", 0},
+		{"SIP/2.0 abc OK", 0},
+	}
+	for _, tt := range tests {
+		if got := sipFragStatus([]byte(tt.body)); got != tt.want {
+			t.Errorf("sipFragStatus(%q) = %d, want %d", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestTransferManager_CheckTransfers(t *testing.T) {
+	mgr, sessions, recalled := newRecallTestManager(20 * time.Second)
+
+	session := &CallSession{CallID: "xfer", State: CallStateTransferring, PreviousState: CallStateHolding, TransferTarget: "sip:200@gosip.local"}
+	sessions.Add(session)
+	mgr.supervise(session, "sip:200@gosip.local")
+	started := mgr.supervised["xfer"].startedAt
+
+	mgr.CheckTransfers(started.Add(19 * time.Second))
+	if len(*recalled) != 0 {
+		t.Fatalf("Expected no recall before the timeout, got %v", *recalled)
+	}
+
+	mgr.CheckTransfers(started.Add(20 * time.Second))
+	if len(*recalled) != 1 || (*recalled)[0] != (recalledTransfer{"xfer", "sip:200@gosip.local", TransferRecallNoAnswer}) {
+		t.Fatalf("Expected the transfer to be recalled, got %v", *recalled)
+	}
+	if session.GetState() != CallStateHolding || session.TransferTarget != "" {
+		t.Errorf("Expected the call back on hold without a target, got %s/%q", session.GetState(), session.TransferTarget)
+	}
+
+	// Each transfer is recalled once
+	mgr.CheckTransfers(started.Add(time.Minute))
+	if len(*recalled) != 1 {
+		t.Errorf("Expected a single recall, got %v", *recalled)
+	}
+}
+
+func TestTransferManager_CheckTransfers_Cancelled(t *testing.T) {
+	mgr, sessions, recalled := newRecallTestManager(20 * time.Second)
+
+	session := &CallSession{CallID: "xfer", State: CallStateTransferring, PreviousState: CallStateActive}
+	sessions.Add(session)
+	mgr.supervise(session, "sip:200@gosip.local")
+	started := mgr.supervised["xfer"].startedAt
+
+	if err := mgr.CancelTransfer(nil, session); err != nil {
+		t.Fatalf("CancelTransfer failed: %v", err)
+	}
+	mgr.CheckTransfers(started.Add(time.Minute))
+	if len(*recalled) != 0 || len(mgr.supervised) != 0 {
+		t.Errorf("Expected a cancelled transfer to be dropped, got %v", *recalled)
+	}
+}
+
+func TestTransferManager_RecallDisabled(t *testing.T) {
+	mgr, sessions, _ := newRecallTestManager(0)
+
+	session := &CallSession{CallID: "xfer", State: CallStateTransferring, PreviousState: CallStateActive}
+	sessions.Add(session)
+	mgr.supervise(session, "sip:200@gosip.local")
+	if len(mgr.supervised) != 0 {
+		t.Error("Expected no supervision with recall disabled")
+	}
+	if mgr.blindTransferTimeout() != defaultBlindTransferTimeout {
+		t.Errorf("blindTransferTimeout() = %v, want %v", mgr.blindTransferTimeout(), defaultBlindTransferTimeout)
+	}
+}
+
+func TestTransferManager_HandleNotify(t *testing.T) {
+	tests := []struct {
+		name         string
+		sipFrag      string
+		wantRecalled bool
+		wantWatching bool
+		wantState    CallState
+	}{
+		{"ringing keeps watching", "SIP/2.0 180 Ringing", false, true, CallStateTransferring},
+		{"answered completes", "SIP/2.0 200 OK", false, false, CallStateTransferring},
+		{"busy recalls", "SIP/2.0 486 Busy Here", true, false, CallStateActive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := parseTestInvite(t, "Event: refer")
+			req.Method = sip.NOTIFY
+			req.SetBody([]byte(tt.sipFrag))
+			callID := req.CallID().Value()
+
+			mgr, sessions, recalled := newRecallTestManager(20 * time.Second)
+			session := &CallSession{CallID: callID, State: CallStateTransferring, PreviousState: CallStateActive}
+			sessions.Add(session)
+			mgr.supervise(session, "sip:200@gosip.local")
+
+			tx := &respondRecorder{}
+			mgr.HandleNotify(req, tx)
+
+			if len(tx.responses) != 1 || tx.responses[0].StatusCode != sip.StatusOK {
+				t.Fatalf("Expected the NOTIFY to be accepted, got %v", tx.responses)
+			}
+			if got := len(*recalled) == 1; got != tt.wantRecalled {
+				t.Errorf("recalled = %v, want %v", got, tt.wantRecalled)
+			}
+			if _, got := mgr.supervised[callID]; got != tt.wantWatching {
+				t.Errorf("supervised = %v, want %v", got, tt.wantWatching)
+			}
+			if session.GetState() != tt.wantState {
+				t.Errorf("state = %s, want %s", session.GetState(), tt.wantState)
+			}
+		})
+	}
+}
@@ -0,0 +1,451 @@
+package sip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/db"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/retry"
+	"github.com/emiago/sipgo"
+	"github.com/emiago/sipgo/sip"
+)
+
+// Trunk registration states
+const (
+	TrunkStateRegistering    = "registering" // The first REGISTER hasn't been answered yet
+	TrunkStateRegistered     = "registered"
+	TrunkStateFailed         = "failed"          // The last attempt failed; another follows after a backoff unless the retry policy gave up
+	TrunkStateNotRegistering = "not_registering" // Disabled, or a trunk that authenticates by IP address
+)
+
+// TrunkStatus is where a trunk's registration stands
+type TrunkStatus struct {
+	State        string     `json:"state"`
+	LastCode     int        `json:"last_code,omitempty"`  // Status of the provider's last answer
+	LastError    string     `json:"last_error,omitempty"` // Why the last attempt failed
+	Failures     int        `json:"failures"`             // Attempts failed in a row
+	RegisteredAt *time.Time `json:"registered_at,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`   // When the provider drops the registration
+	NextAttempt  *time.Time `json:"next_attempt,omitempty"` // When the next REGISTER is sent
+}
+
+// TrunkRetryDelay returns how long to wait after failures failed
+// registrations in a row under the sip_trunk retry policy: by default
+// doubling from SIPTrunkRetryMin up to SIPTrunkRetryMax
+func TrunkRetryDelay(failures int) time.Duration {
+	return retry.For(config.RetryWorkerSIPTrunk).Delay(failures)
+}
+
+// TrunkRefreshDelay returns when to renew a registration granted for
+// expires seconds: after three quarters of it
+func TrunkRefreshDelay(expires int) time.Duration {
+	return time.Duration(expires) * time.Second * 3 / 4
+}
+
+// TrunkManager keeps GoSIP registered with the SIP trunks of providers
+// other than Twilio. Each trunk registers in its own goroutine, renewing
+// before the registration expires and backing off while it fails.
+type TrunkManager struct {
+	client  *sipgo.Client
+	trunks  *db.SIPTrunkRepository
+	contact func(trunk *models.SIPTrunk) sip.Uri // Address providers send calls to
+
+	mu   sync.Mutex
+	ctx  context.Context
+	regs map[int64]*trunkRegistration
+}
+
+// trunkRegistration is one trunk's registration loop
+type trunkRegistration struct {
+	trunk   *models.SIPTrunk
+	contact sip.Uri
+	callID  sip.CallIDHeader
+	cseq    uint32
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mu         sync.Mutex
+	status     TrunkStatus
+	registered bool
+}
+
+// NewTrunkManager creates a TrunkManager. contact returns the address
+// registered for a trunk.
+func NewTrunkManager(client *sipgo.Client, trunks *db.SIPTrunkRepository, contact func(trunk *models.SIPTrunk) sip.Uri) *TrunkManager {
+	return &TrunkManager{
+		client:  client,
+		trunks:  trunks,
+		contact: contact,
+		regs:    make(map[int64]*trunkRegistration),
+	}
+}
+
+// Start registers every enabled trunk. Registrations are renewed until
+// ctx ends or Close is called.
+func (m *TrunkManager) Start(ctx context.Context) error {
+	trunks, err := m.trunks.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.ctx = ctx
+	m.mu.Unlock()
+
+	for _, trunk := range trunks {
+		m.start(trunk)
+	}
+	return nil
+}
+
+// Reload applies a trunk's stored settings: its registration is ended and
+// started again, or only ended when the trunk was deleted, disabled or
+// doesn't register
+func (m *TrunkManager) Reload(ctx context.Context, id int64) error {
+	m.stop(id)
+
+	trunk, err := m.trunks.GetByID(ctx, id)
+	if errors.Is(err, db.ErrSIPTrunkNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.start(trunk)
+	return nil
+}
+
+// Status returns where a trunk's registration stands
+func (m *TrunkManager) Status(id int64) TrunkStatus {
+	m.mu.Lock()
+	reg, ok := m.regs[id]
+	m.mu.Unlock()
+	if !ok {
+		return TrunkStatus{State: TrunkStateNotRegistering}
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return reg.status
+}
+
+// Close ends every registration, unregistering from the providers
+func (m *TrunkManager) Close() {
+	m.mu.Lock()
+	ids := make([]int64, 0, len(m.regs))
+	for id := range m.regs {
+		ids = append(ids, id)
+	}
+	m.mu.Unlock()
+
+	for _, id := range ids {
+		m.stop(id)
+	}
+}
+
+// start begins registering a trunk, if it registers and the manager runs
+func (m *TrunkManager) start(trunk *models.SIPTrunk) {
+	if !trunk.Enabled || !trunk.Register {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ctx == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	reg := &trunkRegistration{
+		trunk:   trunk,
+		contact: m.contact(trunk),
+		callID:  sip.CallIDHeader(sip.GenerateTagN(16) + "@gosip"),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		status:  TrunkStatus{State: TrunkStateRegistering},
+	}
+	m.regs[trunk.ID] = reg
+	go m.run(ctx, reg)
+}
+
+// stop ends a trunk's registration loop and waits for it to unregister
+func (m *TrunkManager) stop(id int64) {
+	m.mu.Lock()
+	reg, ok := m.regs[id]
+	delete(m.regs, id)
+	m.mu.Unlock()
+
+	if ok {
+		reg.cancel()
+		<-reg.done
+	}
+}
+
+// run registers a trunk until ctx ends, then unregisters it
+func (m *TrunkManager) run(ctx context.Context, reg *trunkRegistration) {
+	defer close(reg.done)
+
+	expires := reg.trunk.Expires
+	if expires <= 0 {
+		expires = config.SIPTrunkDefaultExpires
+	}
+
+	for {
+		granted, code, err := m.register(ctx, reg, expires)
+		// A nil channel waits for the trunk to be reloaded
+		var next <-chan time.Time
+		if err != nil {
+			if wait, ok := reg.failed(code, err); ok {
+				next = time.After(wait)
+				slog.Warn("SIP trunk registration failed", "trunk", reg.trunk.Name, "host", reg.trunk.Host, "code", code, "error", err, "retry_in", wait)
+			} else {
+				slog.Error("SIP trunk registration failed, giving up", "trunk", reg.trunk.Name, "host", reg.trunk.Host, "code", code, "error", err)
+			}
+		} else {
+			next = time.After(reg.succeeded(code, granted))
+			slog.Debug("SIP trunk registered", "trunk", reg.trunk.Name, "expires", granted)
+		}
+
+		select {
+		case <-ctx.Done():
+			reg.mu.Lock()
+			registered := reg.registered
+			reg.mu.Unlock()
+			if registered {
+				unregisterCtx, cancel := context.WithTimeout(context.Background(), config.SIPTrunkRequestTimeout)
+				if _, _, err := m.register(unregisterCtx, reg, 0); err != nil {
+					slog.Warn("Failed to unregister SIP trunk", "trunk", reg.trunk.Name, "error", err)
+				}
+				cancel()
+			}
+			return
+		case <-next:
+		}
+	}
+}
+
+// register sends a REGISTER for expires seconds, answering the provider's
+// digest challenge, and returns the lifetime the provider granted
+func (m *TrunkManager) register(ctx context.Context, reg *trunkRegistration, expires int) (int, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.SIPTrunkRequestTimeout)
+	defer cancel()
+
+	res, err := m.sendRegister(ctx, reg, expires)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// The provider wants a longer registration: ask again for its minimum
+	if res.StatusCode == sip.StatusIntervalToBrief && expires > 0 {
+		if h := res.GetHeader("Min-Expires"); h != nil {
+			if min, err := strconv.Atoi(h.Value()); err == nil && min > expires {
+				expires = min
+				if res, err = m.sendRegister(ctx, reg, expires); err != nil {
+					return 0, 0, err
+				}
+			}
+		}
+	}
+
+	code := int(res.StatusCode)
+	if !res.IsSuccess() {
+		return 0, code, fmt.Errorf("provider answered %d %s", code, res.Reason)
+	}
+	return grantedExpires(res, reg.contact, expires), code, nil
+}
+
+// sendRegister sends one REGISTER, authenticating when challenged
+func (m *TrunkManager) sendRegister(ctx context.Context, reg *trunkRegistration, expires int) (*sip.Response, error) {
+	req := reg.request(expires)
+	tx, err := m.client.TransactionRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := trunkFinalResponse(ctx, tx)
+	tx.Terminate()
+	if err != nil {
+		return nil, err
+	}
+	reg.cseq = req.CSeq().SeqNo
+
+	if res.StatusCode != sip.StatusUnauthorized && res.StatusCode != sip.StatusProxyAuthRequired {
+		return res, nil
+	}
+	if reg.trunk.Password == "" {
+		return res, nil
+	}
+
+	username := reg.trunk.AuthUsername
+	if username == "" {
+		username = reg.trunk.Username
+	}
+	tx, err = m.client.DoDigestAuth(ctx, req, res, sipgo.DigestAuth{Username: username, Password: reg.trunk.Password})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Terminate()
+	res, err = trunkFinalResponse(ctx, tx)
+	reg.cseq = req.CSeq().SeqNo
+	return res, err
+}
+
+// request builds a REGISTER for the trunk. Every REGISTER of a trunk
+// shares its Call-ID and counts up its CSeq (RFC 3261 section 10.2).
+func (r *trunkRegistration) request(expires int) *sip.Request {
+	t := r.trunk
+	recipient := sip.Uri{Host: t.Host, Port: t.Port, UriParams: sip.NewParams(), Headers: sip.NewParams()}
+	switch t.Transport {
+	case "tcp":
+		recipient.UriParams.Add("transport", "tcp")
+	case "tls":
+		recipient.Encrypted = true
+		recipient.UriParams.Add("transport", "tcp")
+	}
+
+	domain := t.Domain
+	if domain == "" {
+		domain = t.Host
+	}
+	aor := sip.Uri{User: t.Username, Host: domain, UriParams: sip.NewParams(), Headers: sip.NewParams()}
+
+	req := sip.NewRequest(sip.REGISTER, recipient)
+	from := &sip.FromHeader{Address: aor, Params: sip.NewParams()}
+	from.Params.Add("tag", sip.GenerateTagN(16))
+	req.AppendHeader(from)
+	req.AppendHeader(&sip.ToHeader{Address: aor, Params: sip.NewParams()})
+	callID := r.callID
+	req.AppendHeader(&callID)
+	// TransactionRequest counts the CSeq up before sending
+	req.AppendHeader(&sip.CSeqHeader{SeqNo: r.cseq, MethodName: sip.REGISTER})
+	req.AppendHeader(&sip.ContactHeader{Address: r.contact, Params: sip.NewParams()})
+	req.AppendHeader(sip.NewHeader("Expires", strconv.Itoa(expires)))
+	return req
+}
+
+// succeeded records a registration granted for expires seconds and
+// returns when to renew it
+func (r *trunkRegistration) succeeded(code, expires int) time.Duration {
+	now := time.Now()
+	wait := TrunkRefreshDelay(expires)
+	expiresAt := now.Add(time.Duration(expires) * time.Second)
+	next := now.Add(wait)
+	retry.For(config.RetryWorkerSIPTrunk).Succeeded()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.registered = true
+	r.status = TrunkStatus{
+		State:        TrunkStateRegistered,
+		LastCode:     code,
+		RegisteredAt: &now,
+		ExpiresAt:    &expiresAt,
+		NextAttempt:  &next,
+	}
+	return wait
+}
+
+// failed records a failed attempt and returns when to try again, or false
+// when the retry policy has run out of attempts. A registration that
+// hasn't expired yet is still reported until it does, or until the policy
+// gives up.
+func (r *trunkRegistration) failed(code int, err error) (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	worker := retry.For(config.RetryWorkerSIPTrunk)
+	r.status.Failures++
+	r.status.LastCode = code
+	r.status.LastError = err.Error()
+	giveUp := worker.Exhausted(r.status.Failures)
+	worker.Failed(err, !giveUp)
+
+	var wait time.Duration
+	if giveUp {
+		r.status.NextAttempt = nil
+	} else {
+		wait = TrunkRetryDelay(r.status.Failures)
+		next := time.Now().Add(wait)
+		r.status.NextAttempt = &next
+	}
+	if giveUp || r.status.ExpiresAt == nil || time.Now().After(*r.status.ExpiresAt) {
+		r.status.State = TrunkStateFailed
+		r.status.RegisteredAt, r.status.ExpiresAt = nil, nil
+		r.registered = false
+	}
+	return wait, !giveUp
+}
+
+// grantedExpires returns the lifetime the provider granted our contact:
+// its expires parameter, then the Expires header, then what was asked for
+func grantedExpires(res *sip.Response, contact sip.Uri, requested int) int {
+	for _, h := range res.GetHeaders("Contact") {
+		c, ok := h.(*sip.ContactHeader)
+		if !ok || c.Address.Host != contact.Host || c.Address.Port != contact.Port {
+			continue
+		}
+		if v, ok := c.Params.Get("expires"); ok {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+	if h := res.GetHeader("Expires"); h != nil {
+		if n, err := strconv.Atoi(h.Value()); err == nil && n > 0 {
+			return n
+		}
+	}
+	return requested
+}
+
+// trunkFinalResponse waits for the final response of a client transaction
+func trunkFinalResponse(ctx context.Context, tx sip.ClientTransaction) (*sip.Response, error) {
+	for {
+		select {
+		case res := <-tx.Responses():
+			if res.IsProvisional() {
+				continue
+			}
+			return res, nil
+		case <-tx.Done():
+			if err := tx.Err(); err != nil {
+				return nil, err
+			}
+			return nil, errors.New("transaction terminated without response")
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no answer from provider: %w", ctx.Err())
+		}
+	}
+}
+
+// Trunks returns the manager of registrations with other SIP providers
+func (s *Server) Trunks() *TrunkManager {
+	return s.trunks
+}
+
+// trunkContact is the address registered with a trunk: the public address
+// when one is known, on the port of the trunk's transport
+func (s *Server) trunkContact(trunk *models.SIPTrunk) sip.Uri {
+	host := s.cfg.ExternalIP
+	if host == "" {
+		host = s.client.GetHostname()
+	}
+	contact := sip.Uri{User: trunk.Username, Host: host, Port: s.cfg.Port, UriParams: sip.NewParams(), Headers: sip.NewParams()}
+	switch trunk.Transport {
+	case "tcp":
+		contact.UriParams.Add("transport", "tcp")
+	case "tls":
+		if s.cfg.TLS != nil {
+			contact.Port = s.cfg.TLS.Port
+		}
+		contact.Encrypted = true
+		contact.UriParams.Add("transport", "tcp")
+	}
+	return contact
+}
@@ -0,0 +1,286 @@
+package sip
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"net"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/btafoya/gosip/internal/retry"
+	"github.com/emiago/sipgo"
+	"github.com/emiago/sipgo/sip"
+)
+
+func TestTrunkRetryDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, config.SIPTrunkRetryMin},
+		{2, 2 * config.SIPTrunkRetryMin},
+		{3, 4 * config.SIPTrunkRetryMin},
+		{50, config.SIPTrunkRetryMax},
+	}
+	for _, tt := range tests {
+		if got := TrunkRetryDelay(tt.failures); got != tt.want {
+			t.Errorf("TrunkRetryDelay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestTrunkRefreshDelay(t *testing.T) {
+	if got := TrunkRefreshDelay(3600); got != 45*time.Minute {
+		t.Errorf("TrunkRefreshDelay(3600) = %v, want 45m", got)
+	}
+}
+
+// fakeProvider is a registrar that challenges every REGISTER without
+// credentials and accepts those answering the challenge for password
+type fakeProvider struct {
+	addr      *net.UDPAddr
+	password  string
+	minExpire int
+	registers chan *sip.Request // Accepted REGISTERs
+}
+
+var digestParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+func startFakeProvider(t *testing.T, password string) *fakeProvider {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ua, err := sipgo.NewUA(sipgo.WithUserAgentHostname("127.0.0.1"))
+	if err != nil {
+		t.Fatalf("Failed to create provider UA: %v", err)
+	}
+	srv, err := sipgo.NewServer(ua)
+	if err != nil {
+		t.Fatalf("Failed to create provider server: %v", err)
+	}
+	p := &fakeProvider{addr: conn.LocalAddr().(*net.UDPAddr), password: password, registers: make(chan *sip.Request, 16)}
+
+	srv.OnRegister(func(req *sip.Request, tx sip.ServerTransaction) {
+		auth := req.GetHeader("Authorization")
+		if auth == nil || !p.validDigest(auth.Value()) {
+			res := sip.NewResponseFromRequest(req, sip.StatusUnauthorized, "Unauthorized", nil)
+			res.AppendHeader(sip.NewHeader("WWW-Authenticate", `Digest realm="provider", nonce="n0nce", algorithm=MD5`))
+			tx.Respond(res)
+			return
+		}
+		if expires, _ := strconv.Atoi(req.GetHeader("Expires").Value()); expires > 0 && expires < p.minExpire {
+			res := sip.NewResponseFromRequest(req, sip.StatusIntervalToBrief, "Interval Too Brief", nil)
+			res.AppendHeader(sip.NewHeader("Min-Expires", strconv.Itoa(p.minExpire)))
+			tx.Respond(res)
+			return
+		}
+		p.registers <- req
+		res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", nil)
+		if c := req.Contact(); c != nil && req.GetHeader("Expires").Value() != "0" {
+			contact := c.Clone()
+			contact.Params.Add("expires", "120")
+			res.AppendHeader(contact)
+		}
+		tx.Respond(res)
+	})
+
+	go srv.ServeUDP(conn)
+	t.Cleanup(func() {
+		ua.Close()
+		conn.Close()
+	})
+	return p
+}
+
+func (p *fakeProvider) validDigest(header string) bool {
+	params := map[string]string{}
+	for _, m := range digestParam.FindAllStringSubmatch(header, -1) {
+		params[m[1]] = m[2]
+	}
+	ha1 := md5Hex(params["username"] + ":provider:" + p.password)
+	ha2 := md5Hex("REGISTER:" + params["uri"])
+	return params["username"] == "pbx-auth" && params["response"] == md5Hex(ha1+":n0nce:"+ha2)
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func newTestTrunkManager(t *testing.T) (*TrunkManager, *models.SIPTrunk, *fakeProvider) {
+	t.Helper()
+
+	provider := startFakeProvider(t, "s3cret")
+	database := setupTestDB(t)
+	trunk := &models.SIPTrunk{
+		Name:         "Carrier",
+		Host:         provider.addr.IP.String(),
+		Port:         provider.addr.Port,
+		Transport:    "udp",
+		Domain:       "carrier.example.com",
+		Username:     "pbx",
+		AuthUsername: "pbx-auth",
+		Password:     "s3cret",
+		Expires:      3600,
+		Register:     true,
+		Enabled:      true,
+	}
+	if err := database.SIPTrunks.Create(context.Background(), trunk); err != nil {
+		t.Fatalf("Failed to create trunk: %v", err)
+	}
+
+	ua, err := sipgo.NewUA(sipgo.WithUserAgentHostname("127.0.0.1"))
+	if err != nil {
+		t.Fatalf("Failed to create UA: %v", err)
+	}
+	t.Cleanup(func() { ua.Close() })
+	client, err := sipgo.NewClient(ua, sipgo.WithClientHostname("127.0.0.1"))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	m := NewTrunkManager(client, database.SIPTrunks, func(trunk *models.SIPTrunk) sip.Uri {
+		return sip.Uri{User: trunk.Username, Host: "127.0.0.1", Port: 5060, UriParams: sip.NewParams(), Headers: sip.NewParams()}
+	})
+	return m, trunk, provider
+}
+
+func waitTrunkState(t *testing.T, m *TrunkManager, id int64, state string) TrunkStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := m.Status(id)
+		if status.State == state {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Trunk state = %q (%s), want %q", status.State, status.LastError, state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTrunkManager_Register(t *testing.T) {
+	m, trunk, provider := newTestTrunkManager(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := m.Start(ctx); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	status := waitTrunkState(t, m, trunk.ID, TrunkStateRegistered)
+	if status.LastCode != 200 || status.ExpiresAt == nil || time.Until(*status.ExpiresAt) > 121*time.Second {
+		t.Errorf("Expected the provider's 120 second registration, got %+v", status)
+	}
+
+	req := <-provider.registers
+	if to := req.To(); to == nil || to.Address.User != "pbx" || to.Address.Host != "carrier.example.com" {
+		t.Errorf("Expected To pbx@carrier.example.com, got %v", req.To())
+	}
+	if h := req.GetHeader("Expires"); h == nil || h.Value() != "3600" {
+		t.Errorf("Expected Expires 3600, got %v", h)
+	}
+
+	// Deleting the trunk unregisters it
+	m.trunks.Delete(ctx, trunk.ID)
+	if err := m.Reload(ctx, trunk.ID); err != nil {
+		t.Fatalf("Reload() error: %v", err)
+	}
+	select {
+	case req := <-provider.registers:
+		if h := req.GetHeader("Expires"); h == nil || h.Value() != "0" {
+			t.Errorf("Expected an unregister, got Expires %v", h)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Trunk was not unregistered")
+	}
+	if got := m.Status(trunk.ID).State; got != TrunkStateNotRegistering {
+		t.Errorf("Expected a deleted trunk not to register, got %s", got)
+	}
+}
+
+func TestTrunkManager_WrongPassword(t *testing.T) {
+	m, trunk, _ := newTestTrunkManager(t)
+	trunk.Password = "wrong"
+	if err := m.trunks.Update(context.Background(), trunk); err != nil {
+		t.Fatalf("Failed to update trunk: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := m.Start(ctx); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	status := waitTrunkState(t, m, trunk.ID, TrunkStateFailed)
+	if status.LastCode != 401 || status.Failures != 1 || status.NextAttempt == nil {
+		t.Errorf("Expected one 401 failure with a retry scheduled, got %+v", status)
+	}
+	m.Close()
+}
+
+func TestTrunkManager_IntervalTooBrief(t *testing.T) {
+	m, trunk, provider := newTestTrunkManager(t)
+	provider.minExpire = 300
+	trunk.Expires = 120
+	if err := m.trunks.Update(context.Background(), trunk); err != nil {
+		t.Fatalf("Failed to update trunk: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := m.Start(ctx); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	waitTrunkState(t, m, trunk.ID, TrunkStateRegistered)
+	req := <-provider.registers
+	if h := req.GetHeader("Expires"); h == nil || h.Value() != "300" {
+		t.Errorf("Expected the provider's Min-Expires, got %v", h)
+	}
+	m.Close()
+}
+
+func TestTrunkManager_SkipsTrunksNotRegistering(t *testing.T) {
+	m, trunk, _ := newTestTrunkManager(t)
+	trunk.Register = false
+	if err := m.trunks.Update(context.Background(), trunk); err != nil {
+		t.Fatalf("Failed to update trunk: %v", err)
+	}
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	if got := m.Status(trunk.ID).State; got != TrunkStateNotRegistering {
+		t.Errorf("Expected %s, got %s", TrunkStateNotRegistering, got)
+	}
+}
+
+func TestTrunkManager_GivesUpUnderRetryPolicy(t *testing.T) {
+	policy := config.DefaultRetryPolicies[config.RetryWorkerSIPTrunk]
+	policy.MaxAttempts = 1
+	retry.Configure(map[string]config.RetryPolicy{config.RetryWorkerSIPTrunk: policy})
+	defer retry.Configure(nil)
+
+	m, trunk, _ := newTestTrunkManager(t)
+	trunk.Password = "wrong"
+	if err := m.trunks.Update(context.Background(), trunk); err != nil {
+		t.Fatalf("Failed to update trunk: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := m.Start(ctx); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	status := waitTrunkState(t, m, trunk.ID, TrunkStateFailed)
+	if status.NextAttempt != nil {
+		t.Errorf("Expected no retry after the last attempt, got %+v", status)
+	}
+	m.Close()
+}
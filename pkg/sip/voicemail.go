@@ -0,0 +1,688 @@
+// Package sip provides local voicemail for GoSIP
+package sip
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/audio"
+	"github.com/btafoya/gosip/internal/codec"
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+)
+
+// ErrVoicemailNoAudio is returned for calls offering no audio GoSIP can
+// record
+var ErrVoicemailNoAudio = errors.New("the call offers no audio GoSIP can record")
+
+// voicemailFrame is how much audio each RTP packet sent to the caller holds
+const voicemailFrame = 20 * time.Millisecond
+
+// voicemailTrailer is how much of the silence after the caller last spoke
+// is kept at the end of a message
+const voicemailTrailer = time.Second
+
+// VoicemailHooks connect local voicemail to the routes and mailbox settings
+// kept outside the SIP server. Without Routed no call goes to voicemail;
+// without BoxFull every mailbox has room.
+type VoicemailHooks struct {
+	// Routed reports whether a call from callerID to a DID goes to voicemail
+	Routed func(ctx context.Context, did *models.DID, callerID string) bool
+	// BoxFull reports whether a DID's mailbox takes no new messages
+	BoxFull func(ctx context.Context, did *models.DID) bool
+	// Saved is told about each message once it is stored
+	Saved func(vm *models.Voicemail)
+}
+
+// VoicemailURL is the API path a local voicemail's audio is served from
+func VoicemailURL(id int64) string {
+	return "/api/voicemails/" + strconv.FormatInt(id, 10) + "/audio"
+}
+
+// VoicemailFile is the name of a local voicemail's audio file in the
+// voicemails directory
+func VoicemailFile(id int64) string {
+	return strconv.FormatInt(id, 10) + ".wav"
+}
+
+// GreetingURL is the API path a greeting uploaded to GoSIP is served from
+func GreetingURL(didID int64, greetingType string) string {
+	return fmt.Sprintf("/api/voicemail-boxes/%d/greetings/%s/audio", didID, greetingType)
+}
+
+// GreetingFile is the file of an uploaded greeting, relative to the
+// prompts directory
+func GreetingFile(didID int64, greetingType string) string {
+	return filepath.Join(config.GreetingsDir, fmt.Sprintf("%d-%s.wav", didID, greetingType))
+}
+
+// VoicemailManager answers calls routed to voicemail without Twilio. The
+// caller hears the mailbox's greeting and a beep, then what they say is
+// recorded until they hang up, stop speaking or reach the longest message.
+// Messages are stored as 16 kHz mono WAV files.
+type VoicemailManager struct {
+	dir        string // Messages
+	prompts    string // Prompts and uploaded greetings
+	server     *Server
+	ports      *portPool
+	externalIP net.IP
+
+	mu      sync.Mutex
+	hooks   VoicemailHooks
+	diskLow func(ctx context.Context) bool
+	calls   map[string]*voicemailCall
+
+	// finishing counts messages being written out
+	finishing sync.WaitGroup
+}
+
+// NewVoicemailManager creates a VoicemailManager storing messages in dir.
+// Greetings are read from the prompts directory.
+func NewVoicemailManager(server *Server, dir, prompts string) *VoicemailManager {
+	ports := &portPool{}
+	if server.relay != nil {
+		ports = server.relay.ports
+	}
+	return &VoicemailManager{
+		dir:        dir,
+		prompts:    prompts,
+		server:     server,
+		ports:      ports,
+		externalIP: net.ParseIP(server.cfg.ExternalIP).To4(),
+		calls:      make(map[string]*voicemailCall),
+	}
+}
+
+// SetHooks sets the hooks that route calls to voicemail and handle new
+// messages
+func (m *VoicemailManager) SetHooks(hooks VoicemailHooks) {
+	m.mu.Lock()
+	m.hooks = hooks
+	m.mu.Unlock()
+}
+
+// SetDiskCheck sets the check that turns callers away when the disk is
+// low on free space
+func (m *VoicemailManager) SetDiskCheck(low func(ctx context.Context) bool) {
+	m.mu.Lock()
+	m.diskLow = low
+	m.mu.Unlock()
+}
+
+// Routed reports whether a call from callerID to a DID goes to voicemail
+func (m *VoicemailManager) Routed(ctx context.Context, did *models.DID, callerID string) bool {
+	m.mu.Lock()
+	routed := m.hooks.Routed
+	m.mu.Unlock()
+	return routed != nil && routed(ctx, did, callerID)
+}
+
+// Active returns how many callers are leaving messages
+func (m *VoicemailManager) Active() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.calls)
+}
+
+// Wait blocks until ended messages have been written out
+func (m *VoicemailManager) Wait() {
+	m.finishing.Wait()
+}
+
+// Close stops recording every message and waits for them to be written
+// out. Callers aren't sent a BYE.
+func (m *VoicemailManager) Close() {
+	m.mu.Lock()
+	calls := make([]*voicemailCall, 0, len(m.calls))
+	for _, c := range m.calls {
+		calls = append(calls, c)
+	}
+	m.mu.Unlock()
+
+	for _, c := range calls {
+		c.end()
+	}
+	m.Wait()
+}
+
+// voicemailCall is a caller leaving a message
+type voicemailCall struct {
+	callID string
+	m      *VoicemailManager
+	did    *models.DID
+	from   string
+	invite *sip.Request
+	answer *sip.Response
+	rtp    *net.UDPConn
+	rtcp   *net.UDPConn
+	done   chan struct{}
+	once   sync.Once
+
+	mu       sync.Mutex
+	dest     *net.UDPAddr // Where its audio goes: its SDP address, then where its RTP comes from
+	latched  bool
+	payloads payloadNames
+	decoders legDecoders
+	sender   rtpSender
+	leg      *recordingLeg // Nil until the beep has played
+	started  time.Time     // When recording started
+	heard    time.Time     // When the caller was last heard speaking
+	failed   error         // Writing the message failed
+}
+
+// Answer answers a call for a DID's mailbox. It returns once the call is
+// answered; the greeting and the recording carry on in the background.
+func (m *VoicemailManager) Answer(ctx context.Context, req *sip.Request, tx sip.ServerTransaction, session *CallSession, did *models.DID) error {
+	offer := req.Body()
+	sdp := parseSDPAudio(offer)
+	if sdp == nil {
+		return ErrVoicemailNoAudio
+	}
+	payloads := make(payloadNames)
+	payloads.learn(offer)
+
+	// Answer with the caller's first codec GoSIP can decode, on the
+	// caller's payload type, and its DTMF events
+	var answerCodec *codec.Codec
+	var telephoneEvent uint8
+	for _, format := range sdp.formats {
+		pt := parsePayloadType(format)
+		name := payloads[pt]
+		if strings.EqualFold(name, "telephone-event") {
+			if telephoneEvent == 0 {
+				telephoneEvent = pt
+			}
+			continue
+		}
+		if c, ok := codec.Lookup(name); ok && codec.Available(c) && answerCodec == nil {
+			c.PayloadType = pt
+			answerCodec = &c
+		}
+	}
+	if answerCodec == nil {
+		return ErrVoicemailNoAudio
+	}
+
+	m.mu.Lock()
+	boxFull, diskLow := m.hooks.BoxFull, m.diskLow
+	m.mu.Unlock()
+	full := (boxFull != nil && boxFull(ctx, did)) || (diskLow != nil && diskLow(ctx))
+
+	// Callers to a full mailbox are told so and hung up on
+	var playback []int16
+	if full {
+		playback = loadVoicemailAudio(filepath.Join(m.prompts, config.VoicemailFullPrompt+".wav"))
+	} else {
+		playback = append(m.greeting(ctx, did), voicemailBeep()...)
+	}
+
+	rtpConn, rtcpConn, err := m.ports.listenPair()
+	if err != nil {
+		return err
+	}
+	host, _, _ := net.SplitHostPort(req.Source())
+	ip := mediaAddress(host, m.externalIP)
+	body := mediaSDP("sendrecv", []codec.Codec{*answerCodec}, telephoneEvent, ip, rtpConn.LocalAddr().(*net.UDPAddr).Port)
+
+	res := sip.NewResponseFromRequest(req, sip.StatusOK, "OK", body)
+	res.AppendHeader(&sip.ContactHeader{
+		Address: sip.Uri{User: "voicemail", Host: ip.String(), Port: m.server.cfg.Port, UriParams: sip.NewParams(), Headers: sip.NewParams()},
+		Params:  sip.NewParams(),
+	})
+	res.AppendHeader(sip.NewHeader("Content-Type", "application/sdp"))
+	m.server.trace.Record(TraceOut, res)
+	if err := tx.Respond(res); err != nil {
+		rtpConn.Close()
+		rtcpConn.Close()
+		return fmt.Errorf("failed to answer: %w", err)
+	}
+
+	c := &voicemailCall{
+		callID:   session.CallID,
+		m:        m,
+		did:      did,
+		from:     session.FromNumber,
+		invite:   req,
+		answer:   res,
+		rtp:      rtpConn,
+		rtcp:     rtcpConn,
+		done:     make(chan struct{}),
+		payloads: payloads,
+		decoders: make(legDecoders),
+		sender:   newRTPSender(),
+	}
+	c.sender.setEncoding(answerCodec.Name, answerCodec.PayloadType)
+	if addr := net.ParseIP(sdp.address); addr != nil && sdp.port > 0 {
+		c.dest = &net.UDPAddr{IP: addr, Port: sdp.port}
+	}
+
+	m.mu.Lock()
+	m.calls[c.callID] = c
+	m.mu.Unlock()
+
+	session.Codec = answerCodec.Name
+	if err := session.SetState(CallStateActive); err != nil {
+		slog.Warn("Failed to set active state", "error", err, "call_id", c.callID)
+	}
+	slog.Info("Call answered by voicemail", "call_id", c.callID, "did_id", did.ID, "from", c.from, "codec", answerCodec.Name, "mailbox_full", full)
+
+	go c.read()
+	go c.run(playback, !full)
+	return nil
+}
+
+// greeting returns what callers to a mailbox hear before the beep: its
+// active greeting when it was uploaded to GoSIP, otherwise the voicemail
+// greeting prompt. Mailboxes with neither go straight to the beep.
+func (m *VoicemailManager) greeting(ctx context.Context, did *models.DID) []int16 {
+	if g, err := m.server.db.Greetings.GetActive(ctx, did.ID); err == nil && g.AudioURL == GreetingURL(did.ID, g.GreetingType) {
+		if pcm := loadVoicemailAudio(filepath.Join(m.prompts, GreetingFile(did.ID, g.GreetingType))); pcm != nil {
+			return pcm
+		}
+	}
+	return loadVoicemailAudio(filepath.Join(m.prompts, config.VoicemailGreetingPrompt+".wav"))
+}
+
+// loadVoicemailAudio reads a WAV file as 16 kHz audio. It returns nil when
+// the file is missing or isn't audio GoSIP can play.
+func loadVoicemailAudio(path string) []int16 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("Failed to read voicemail prompt", "path", path, "error", err)
+		}
+		return nil
+	}
+	pcm, rate, err := audio.DecodeWAV(data)
+	if err != nil {
+		slog.Warn("Invalid voicemail prompt", "path", path, "error", err)
+		return nil
+	}
+	return codec.NewResampler(rate, recordingRate).Resample(pcm)
+}
+
+// voicemailBeep returns the 1 kHz tone played before recording starts
+func voicemailBeep() []int16 {
+	const volume = 8000
+	beep := make([]int16, int(config.VoicemailBeepLength*recordingRate/time.Second))
+	for n := range beep {
+		beep[n] = int16(volume * math.Sin(2*math.Pi*1000*float64(n)/recordingRate))
+	}
+	return beep
+}
+
+// run plays the caller what's in playback, then records the message or,
+// when record is false, hangs up. Silence is sent while recording, so
+// NAT bindings stay open and phones don't give up on the call.
+func (c *voicemailCall) run(playback []int16, record bool) {
+	frame := int(voicemailFrame * recordingRate / time.Second)
+	ticker := time.NewTicker(voicemailFrame)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		pcm := make([]int16, frame)
+		if len(playback) > 0 {
+			n := copy(pcm, playback)
+			playback = playback[n:]
+			if len(playback) == 0 {
+				if !record {
+					c.send(pcm)
+					c.hangUp("mailbox full")
+					return
+				}
+				if err := c.startRecording(); err != nil {
+					slog.Error("Failed to record voicemail", "error", err, "call_id", c.callID)
+					c.hangUp("recording failed")
+					return
+				}
+			}
+		} else if !record {
+			c.hangUp("mailbox full")
+			return
+		}
+		c.send(pcm)
+
+		if reason := c.expired(time.Now()); reason != "" {
+			c.hangUp(reason)
+			return
+		}
+	}
+}
+
+// startRecording creates the file the caller's audio is written to
+func (c *voicemailCall) startRecording() error {
+	if err := os.MkdirAll(c.m.dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create voicemails directory: %w", err)
+	}
+	var id [4]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return err
+	}
+	leg, err := newRecordingLeg(filepath.Join(c.m.dir, "incoming-"+hex.EncodeToString(id[:])+".pcm"))
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.leg, c.started, c.heard = leg, now, now
+	return nil
+}
+
+// expired returns why the message should end, or "" while it goes on
+func (c *voicemailCall) expired(now time.Time) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.leg == nil:
+		return ""
+	case c.failed != nil:
+		return "recording failed"
+	case now.Sub(c.started) >= config.VoicemailMaxLength:
+		return "longest message reached"
+	case now.Sub(c.heard) >= config.VoicemailSilenceTimeout:
+		return "silence"
+	}
+	return ""
+}
+
+// send sends the caller a frame of audio
+func (c *voicemailCall) send(pcm []int16) {
+	c.mu.Lock()
+	dest := c.dest
+	var packet []byte
+	var err error
+	if c.sender.encoder != nil && dest != nil {
+		packet, err = c.sender.packet(pcm)
+	}
+	c.mu.Unlock()
+	if err != nil {
+		slog.Debug("Failed to encode voicemail audio", "error", err, "call_id", c.callID)
+		return
+	}
+	if packet != nil {
+		c.rtp.WriteToUDP(packet, dest)
+	}
+}
+
+// read records the audio the caller sends, following where its packets
+// come from like the relay does
+func (c *voicemailCall) read() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := c.rtp.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if n < 12 || buf[0]&0xc0 != 0x80 || isRTCP(buf[:n]) {
+			continue
+		}
+
+		c.mu.Lock()
+		if !c.latched {
+			c.dest, c.latched = addr, true
+		}
+		if addrEqual(c.dest, addr) {
+			c.record(buf[:n])
+		}
+		c.mu.Unlock()
+	}
+}
+
+// record writes an RTP packet's audio to the message, placed by when it
+// arrived. Packets before the beep are dropped. c.mu must be held.
+func (c *voicemailCall) record(packet []byte) {
+	if c.leg == nil || c.failed != nil {
+		return
+	}
+	pcm := c.decoders.decode(c.payloads.encoding(packet), packet)
+	if len(pcm) == 0 {
+		return
+	}
+	if codec.NoiseLevel(pcm) < config.VoicemailSilenceLevel {
+		c.heard = time.Now()
+	}
+	at := int64(time.Since(c.started)*recordingRate/time.Second) - int64(len(pcm))
+	if err := c.leg.write(at, pcm); err != nil {
+		slog.Error("Failed to write voicemail", "error", err, "call_id", c.callID)
+		c.failed = err
+	}
+}
+
+// end stops the call's media and starts writing out its message. It
+// reports whether the call was still going.
+func (c *voicemailCall) end() bool {
+	ended := false
+	c.once.Do(func() {
+		ended = true
+		close(c.done)
+		c.rtp.Close()
+		c.rtcp.Close()
+
+		c.m.mu.Lock()
+		if c.m.calls[c.callID] == c {
+			delete(c.m.calls, c.callID)
+		}
+		c.m.mu.Unlock()
+
+		c.mu.Lock()
+		leg, failed := c.leg, c.failed
+		// Silence after the caller last spoke is left out
+		length := time.Since(c.started)
+		if spoke := c.heard.Sub(c.started) + voicemailTrailer; spoke < length {
+			length = spoke
+		}
+		c.leg = nil
+		c.mu.Unlock()
+
+		if leg != nil {
+			c.m.finishing.Add(1)
+			go c.m.finish(c, leg, length, failed)
+		}
+	})
+	return ended
+}
+
+// hangUp ends the call from GoSIP's side: the caller is sent a BYE
+func (c *voicemailCall) hangUp(reason string) {
+	if !c.end() {
+		return
+	}
+	slog.Info("Voicemail hung up", "call_id", c.callID, "reason", reason)
+
+	s := c.m.server
+	if bye := c.byeRequest(); bye != nil && s.client != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), config.CallSetupTimeout)
+		defer cancel()
+		s.trace.Record(TraceOut, bye)
+		if res, err := s.requestFinalResponse(ctx, bye); err != nil {
+			slog.Warn("Failed to hang up voicemail call", "error", err, "call_id", c.callID)
+		} else {
+			s.trace.Record(TraceIn, res)
+		}
+	}
+	if session := s.sessions.Get(c.callID); session != nil {
+		s.terminateSession(session)
+	}
+}
+
+// byeRequest builds the BYE ending the caller's dialog, sent where the
+// caller's requests come from
+func (c *voicemailCall) byeRequest() *sip.Request {
+	contact := c.invite.Contact()
+	if contact == nil {
+		return nil
+	}
+	caller, callee := c.invite.From(), c.answer.To()
+
+	bye := sip.NewRequest(sip.BYE, *contact.Address.Clone())
+	bye.AppendHeader(sip.HeaderClone(&sip.FromHeader{DisplayName: callee.DisplayName, Address: callee.Address, Params: callee.Params}))
+	bye.AppendHeader(sip.HeaderClone(&sip.ToHeader{DisplayName: caller.DisplayName, Address: caller.Address, Params: caller.Params}))
+	bye.AppendHeader(sip.HeaderClone(c.invite.CallID()))
+	bye.AppendHeader(&sip.CSeqHeader{SeqNo: 1, MethodName: sip.BYE})
+	bye.SetDestination(c.invite.Source())
+	bye.SetTransport(c.invite.Transport())
+	return bye
+}
+
+// hungUp stops recording the message of a caller who hung up
+func (m *VoicemailManager) hungUp(callID string) {
+	m.mu.Lock()
+	c := m.calls[callID]
+	m.mu.Unlock()
+	if c != nil {
+		c.end()
+	}
+}
+
+// finish stores a message: its audio as a WAV file and a voicemail for the
+// mailbox. Messages shorter than the shortest allowed are dropped.
+func (m *VoicemailManager) finish(c *voicemailCall, leg *recordingLeg, length time.Duration, failed error) {
+	defer m.finishing.Done()
+	defer os.Remove(leg.path)
+
+	err := failed
+	if cerr := leg.close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		slog.Error("Failed to write voicemail", "error", err, "call_id", c.callID)
+		return
+	}
+	if length < config.VoicemailMinLength {
+		slog.Info("Voicemail too short, discarded", "call_id", c.callID, "length", length.Round(time.Millisecond))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.CallSetupTimeout)
+	defer cancel()
+	frames := int64(length * recordingRate / time.Second)
+	vm := &models.Voicemail{
+		UserID:     &c.did.ID,
+		FromNumber: c.from,
+		Duration:   int(length.Seconds() + 0.5),
+		SizeBytes:  audio.WAVHeaderSize + frames*2,
+		CreatedAt:  time.Now(),
+	}
+	if err := m.server.db.Voicemails.Create(ctx, vm); err != nil {
+		slog.Error("Failed to save voicemail", "error", err, "call_id", c.callID)
+		return
+	}
+
+	path := filepath.Join(m.dir, VoicemailFile(vm.ID))
+	checksum, err := writeVoicemail(path, leg, frames)
+	if err == nil {
+		err = m.server.db.Voicemails.SetChecksum(ctx, vm.ID, checksum)
+	}
+	if err != nil {
+		slog.Error("Failed to write voicemail", "error", err, "call_id", c.callID, "voicemail_id", vm.ID)
+		os.Remove(path)
+		m.server.db.Voicemails.Delete(ctx, vm.ID)
+		return
+	}
+	vm.AudioURL = VoicemailURL(vm.ID)
+	if err := m.server.db.Voicemails.Update(ctx, vm); err != nil {
+		slog.Error("Failed to save voicemail", "error", err, "voicemail_id", vm.ID)
+		return
+	}
+	slog.Info("Voicemail saved", "call_id", c.callID, "voicemail_id", vm.ID, "did_id", c.did.ID, "duration", vm.Duration)
+
+	m.mu.Lock()
+	saved := m.hooks.Saved
+	m.mu.Unlock()
+	if saved != nil {
+		saved(vm)
+	}
+}
+
+// writeVoicemail writes a mono WAV file of a leg's audio, cut or padded
+// with silence to frames samples, and returns the file's checksum
+func writeVoicemail(path string, leg *recordingLeg, frames int64) (string, error) {
+	in, err := os.Open(leg.path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sum := sha256.New()
+	w := bufio.NewWriter(io.MultiWriter(f, sum))
+	if err := audio.WriteWAVHeader(w, audio.ChannelsMono, recordingRate, uint32(frames*2)); err != nil {
+		return "", err
+	}
+	n, err := io.Copy(w, io.LimitReader(in, frames*2))
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(make([]byte, frames*2-n)); err != nil {
+		return "", err
+	}
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// answerVoicemail answers a trunk call routed to voicemail, reporting
+// whether it did. Calls from Twilio are left to it: Twilio records their
+// voicemail itself.
+func (s *Server) answerVoicemail(ctx context.Context, req *sip.Request, tx sip.ServerTransaction, session *CallSession) bool {
+	if s.voicemail == nil || session.TrunkCallSID != "" {
+		return false
+	}
+	did, err := s.db.DIDs.GetByNumber(ctx, session.ToNumber)
+	if err != nil || !s.voicemail.Routed(ctx, did, session.FromNumber) {
+		return false
+	}
+	if err := s.voicemail.Answer(ctx, req, tx, session, did); err != nil {
+		slog.Warn("Cannot answer call for voicemail", "error", err, "call_id", session.CallID)
+		return false
+	}
+	return true
+}
+
+// GetVoicemailManager returns the local voicemail, or nil when it is off
+func (s *Server) GetVoicemailManager() *VoicemailManager {
+	return s.voicemail
+}
+
+// SetVoicemailHooks sets the hooks that route calls to local voicemail and
+// handle new messages
+func (s *Server) SetVoicemailHooks(hooks VoicemailHooks) {
+	if s.voicemail != nil {
+		s.voicemail.SetHooks(hooks)
+	}
+}
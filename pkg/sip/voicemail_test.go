@@ -0,0 +1,147 @@
+package sip
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/audio"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+)
+
+// newVoicemailTestServer is a server with local voicemail taking every call,
+// and the mailbox of a DID callers leave messages in
+func newVoicemailTestServer(t *testing.T) (*Server, *models.DID, chan *models.Voicemail) {
+	t.Helper()
+	database := setupTestDB(t)
+	ctx := context.Background()
+	// Voicemail rows reference the mailbox's DID through their user ID
+	if err := database.Users.Create(ctx, &models.User{Email: "owner@example.com", PasswordHash: "x", Role: "admin"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	did := &models.DID{Number: "+15551234567", VoiceEnabled: true}
+	if err := database.DIDs.Create(ctx, did); err != nil {
+		t.Fatalf("Failed to create DID: %v", err)
+	}
+
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0", DataDir: t.TempDir(), VoicemailsDir: t.TempDir()}, database)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	server.client = nil // Nothing to send BYEs to
+	saved := make(chan *models.Voicemail, 1)
+	server.SetVoicemailHooks(VoicemailHooks{
+		Routed: func(ctx context.Context, did *models.DID, callerID string) bool { return true },
+		Saved:  func(vm *models.Voicemail) { saved <- vm },
+	})
+	t.Cleanup(server.voicemail.Close)
+	return server, did, saved
+}
+
+// voicemailInvite is a plain trunk call to the test DID offering sdp
+func voicemailInvite(t *testing.T, sdp []byte) *sip.Request {
+	t.Helper()
+	invite := parseTestInvite(t, "Contact: <sip:+15559876543@127.0.0.1:5070>")
+	invite.SetBody(sdp)
+	invite.AppendHeader(sip.NewHeader("Content-Type", "application/sdp"))
+	invite.SetSource("127.0.0.1:5070")
+	return invite
+}
+
+func TestVoicemail_Record(t *testing.T) {
+	server, did, saved := newVoicemailTestServer(t)
+	phone := newTestPhone(t)
+	invite := voicemailInvite(t, phone.sdp(""))
+	session := NewCallSession(invite, CallDirectionInbound)
+	server.sessions.Add(session)
+
+	tx := &respondRecorder{}
+	if !server.answerVoicemail(context.Background(), invite, tx, session) {
+		t.Fatal("Expected the call answered by voicemail")
+	}
+	if len(tx.responses) != 1 || tx.responses[0].StatusCode != sip.StatusOK {
+		t.Fatalf("Expected a 200 OK, got %+v", tx.responses)
+	}
+	answer := parseSDPAudio(tx.responses[0].Body())
+	if answer == nil || answer.port == 0 || answer.address == "0.0.0.0" {
+		t.Fatalf("Expected a media address in the answer, got:\n%s", tx.responses[0].Body())
+	}
+	if session.GetState() != CallStateActive {
+		t.Errorf("Expected the call active, got %s", session.GetState())
+	}
+
+	// The caller hears the beep in its own codec
+	buf := make([]byte, 1500)
+	phone.rtp.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, _, err := phone.rtp.ReadFromUDP(buf); err != nil || n <= 12 || buf[1]&0x7f != 0 {
+		t.Fatalf("Expected PCMU from voicemail, got %v", err)
+	}
+
+	// The caller speaks past the shortest message, then hangs up
+	to := relayedAddr(t, tx.responses[0].Body())
+	loud := string(bytes.Repeat([]byte{0x80}, 160))
+	for start := time.Now(); time.Since(start) < 4*time.Second; time.Sleep(20 * time.Millisecond) {
+		phone.rtp.WriteToUDP(rtpPacket(0, loud), to)
+	}
+	server.terminateSession(session)
+
+	var vm *models.Voicemail
+	select {
+	case vm = <-saved:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the voicemail saved")
+	}
+	if vm.UserID == nil || *vm.UserID != did.ID || vm.FromNumber != "+15559876543" || vm.Duration < 3 {
+		t.Errorf("Expected a message of over 3s for the DID, got %+v", vm)
+	}
+	if vm.AudioURL != VoicemailURL(vm.ID) {
+		t.Errorf("Expected the audio served by GoSIP, got %q", vm.AudioURL)
+	}
+	data, err := os.ReadFile(filepath.Join(server.cfg.VoicemailsDir, VoicemailFile(vm.ID)))
+	if err != nil {
+		t.Fatalf("Expected the message's audio stored: %v", err)
+	}
+	if int64(len(data)) != vm.SizeBytes {
+		t.Errorf("Expected %d bytes, got %d", vm.SizeBytes, len(data))
+	}
+	if checksum, _ := server.db.Voicemails.Checksum(context.Background(), vm.ID); checksum != fmt.Sprintf("%x", sha256.Sum256(data)) {
+		t.Errorf("Expected the file's checksum stored, got %q", checksum)
+	}
+	if pcm, rate, err := audio.DecodeWAV(data); err != nil || rate != recordingRate || len(pcm) == 0 {
+		t.Errorf("Expected a 16 kHz WAV file, got %d Hz: %v", rate, err)
+	}
+	if stored, err := server.db.Voicemails.GetByID(context.Background(), vm.ID); err != nil || stored.AudioURL != vm.AudioURL {
+		t.Errorf("Expected the voicemail stored, got %v", err)
+	}
+	if server.voicemail.Active() != 0 {
+		t.Error("Expected no callers left leaving messages")
+	}
+}
+
+func TestVoicemail_NoAudio(t *testing.T) {
+	server, did, _ := newVoicemailTestServer(t)
+	sdp := []byte("v=0\r\no=phone 1 1 IN IP4 127.0.0.1\r\ns=-\r\nc=IN IP4 127.0.0.1\r\nt=0 0\r\nm=audio 4000 RTP/AVP 99\r\na=rtpmap:99 X-UNKNOWN/8000\r\n")
+	invite := voicemailInvite(t, sdp)
+	session := NewCallSession(invite, CallDirectionInbound)
+
+	tx := &respondRecorder{}
+	if err := server.voicemail.Answer(context.Background(), invite, tx, session, did); !errors.Is(err, ErrVoicemailNoAudio) {
+		t.Errorf("Expected ErrVoicemailNoAudio, got %v", err)
+	}
+	if server.answerVoicemail(context.Background(), invite, tx, session) || len(tx.responses) != 0 {
+		t.Error("Expected the call left unanswered")
+	}
+
+	// Twilio records its own calls' voicemail
+	session.TrunkCallSID = "CA123"
+	if server.answerVoicemail(context.Background(), voicemailInvite(t, newTestPhone(t).sdp("")), tx, session) {
+		t.Error("Expected Twilio calls left to Twilio")
+	}
+}
@@ -0,0 +1,44 @@
+package sip
+
+import (
+	"context"
+	"time"
+
+	"github.com/btafoya/gosip/internal/models"
+)
+
+// Browser phones are devices registered over WebSocket Secure from the web
+// UI. They authenticate with short-lived passwords rather than the device's
+// own, so no password is ever stored in the browser.
+
+// AddWebCredential lets a browser phone register as a device with the
+// password whose HA1 is given, until expires
+func (s *Server) AddWebCredential(username, ha1 string, expires time.Time) {
+	s.auth.AddWebCredential(username, ha1, expires)
+}
+
+// SignOutWebPhone stops a browser phone's passwords working and drops its
+// registration, so it no longer rings
+func (s *Server) SignOutWebPhone(ctx context.Context, device *models.Device) error {
+	s.auth.RevokeWebCredentials(device.Username)
+	if reg, err := s.registrar.GetRegistration(ctx, device.ID); err == nil && s.webrtc != nil {
+		s.webrtc.RemoveRoute(reg.Contact)
+	}
+	return s.registrar.Unregister(ctx, device.ID)
+}
+
+// WebPhonePort returns the WebSocket Secure port browser phones register
+// on, or 0 when GoSIP doesn't listen for them. Browsers only open secure
+// WebSockets from HTTPS pages, so plain WebSocket isn't offered.
+func (s *Server) WebPhonePort() int {
+	if !s.IsTLSEnabled() || s.cfg.TLS.WSSPort <= 0 {
+		return 0
+	}
+	return s.cfg.TLS.WSSPort
+}
+
+// WebRTCEnabled reports whether the gateway that carries the media of
+// calls between browsers and phones runs
+func (s *Server) WebRTCEnabled() bool {
+	return s.webrtc != nil
+}
@@ -0,0 +1,441 @@
+// Package sip provides the WebRTC gateway for GoSIP
+package sip
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/pion/dtls/v2/pkg/crypto/fingerprint"
+	"github.com/pion/dtls/v2/pkg/crypto/selfsign"
+)
+
+var (
+	// ErrNotWebRTC is returned for SDP without the ICE credentials and DTLS
+	// fingerprint browsers always send
+	ErrNotWebRTC = errors.New("not a WebRTC session description")
+	// ErrNoAudio is returned for SDP without an audio stream
+	ErrNoAudio = errors.New("no audio stream in session description")
+)
+
+// isWebSocket reports whether a SIP transport is WebSocket, which only
+// browsers use
+func isWebSocket(transport string) bool {
+	return strings.EqualFold(transport, "ws") || strings.EqualFold(transport, "wss")
+}
+
+// IsWebRTCSDP reports whether an SDP body comes from a browser: its audio
+// is DTLS-SRTP (RFC 5764) rather than plain or SDES-keyed RTP
+func IsWebRTCSDP(sdp []byte) bool {
+	audio := parseSDPAudio(sdp)
+	return audio != nil && strings.HasPrefix(audio.proto, "UDP/TLS/RTP/SAVP")
+}
+
+// contactRoute is how a party's requests reach GoSIP, so requests for its
+// contact can be sent back the same way. Browsers put an unresolvable
+// .invalid host in their contact (RFC 7118), and phones behind NAT an
+// address that can't be reached.
+type contactRoute struct {
+	source    string
+	transport string
+	expires   time.Time
+}
+
+// WebRTCGateway lets browsers registered over WebSocket call phones.
+// Browsers only send media over DTLS-SRTP after ICE, which phones don't
+// speak, so GoSIP relays the media of calls between the two: ICE-lite and
+// DTLS-SRTP toward the browser and plain RTP toward the phone, with each
+// side's SDP translated for the other.
+type WebRTCGateway struct {
+	cert        tls.Certificate
+	fingerprint string // SHA-256 of cert, as in a=fingerprint
+
+	// addresses are the host candidates offered to browsers: the external
+	// IP first, then the interface addresses
+	addresses []net.IP
+
+	ports *portPool
+
+	mu      sync.Mutex
+	routes  map[string]contactRoute  // by contact URI
+	bridges map[string]*WebRTCBridge // by Call-ID
+}
+
+// NewWebRTCGateway creates the gateway with a fresh DTLS certificate and
+// gathers the addresses browsers are told to send media to
+func NewWebRTCGateway(cfg *config.WebRTCConfig, externalIP string) (*WebRTCGateway, error) {
+	low, high, err := cfg.PortRange()
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := selfsign.GenerateSelfSigned()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DTLS certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DTLS certificate: %w", err)
+	}
+	fp, err := fingerprint.Fingerprint(leaf, crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fingerprint DTLS certificate: %w", err)
+	}
+
+	return &WebRTCGateway{
+		cert:        cert,
+		fingerprint: strings.ToUpper(fp),
+		addresses:   gatherAddresses(externalIP),
+		ports:       &portPool{low: low, high: high},
+		routes:      make(map[string]contactRoute),
+		bridges:     make(map[string]*WebRTCBridge),
+	}, nil
+}
+
+// gatherAddresses returns the IPv4 addresses of the host's interfaces,
+// after externalIP when it is set
+func gatherAddresses(externalIP string) []net.IP {
+	var addresses []net.IP
+	seen := make(map[string]bool)
+	add := func(ip net.IP) {
+		if ip4 := ip.To4(); ip4 != nil && !ip4.IsLoopback() && !ip4.IsUnspecified() && !seen[ip4.String()] {
+			seen[ip4.String()] = true
+			addresses = append(addresses, ip4)
+		}
+	}
+
+	add(net.ParseIP(externalIP))
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+				add(ipNet.IP)
+			}
+		}
+	}
+	return addresses
+}
+
+// localIPFor returns the address GoSIP reaches host from: the one phones
+// on the LAN should send media and in-dialog requests to
+func (g *WebRTCGateway) localIPFor(host string) net.IP {
+	if local := routeLocalIP(host); local != nil {
+		return local
+	}
+	if len(g.addresses) > 0 {
+		return g.addresses[0]
+	}
+	return net.IPv4(127, 0, 0, 1)
+}
+
+// SetRoute records the WebSocket connection a browser's contact is
+// reached over until expires
+func (g *WebRTCGateway) SetRoute(contact, source, transport string, expires time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	for c, route := range g.routes {
+		if now.After(route.expires) {
+			delete(g.routes, c)
+		}
+	}
+	g.routes[routeKey(contact)] = contactRoute{source: source, transport: transport, expires: expires}
+}
+
+// RemoveRoute forgets a browser's contact
+func (g *WebRTCGateway) RemoveRoute(contact string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.routes, routeKey(contact))
+}
+
+// Route returns the WebSocket connection a browser's contact is reached
+// over
+func (g *WebRTCGateway) Route(contact string) (source, transport string, ok bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	route, ok := g.routes[routeKey(contact)]
+	if !ok || time.Now().After(route.expires) {
+		return "", "", false
+	}
+	return route.source, route.transport, true
+}
+
+// routeKey reduces a contact URI to its user and host, which browsers
+// keep for the life of the page while the parameters vary
+func routeKey(contact string) string {
+	contact = strings.TrimPrefix(strings.TrimPrefix(strings.Trim(contact, "<>"), "sips:"), "sip:")
+	contact, _, _ = strings.Cut(contact, ";")
+	return strings.ToLower(contact)
+}
+
+// Bridge returns the bridge of a call with a browser leg, or nil
+func (g *WebRTCGateway) Bridge(callID string) *WebRTCBridge {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.bridges[callID]
+}
+
+// Close ends every bridged call's media
+func (g *WebRTCGateway) Close() {
+	g.mu.Lock()
+	bridges := make([]*WebRTCBridge, 0, len(g.bridges))
+	for _, b := range g.bridges {
+		bridges = append(bridges, b)
+	}
+	g.mu.Unlock()
+
+	for _, b := range bridges {
+		b.Close()
+	}
+}
+
+// sdpAudio is the audio stream of an SDP body, with what the gateway
+// needs from the rest of it
+type sdpAudio struct {
+	address   string // Connection address of the stream
+	port      int
+	proto     string
+	formats   []string // Payload types, most preferred first
+	attrs     []string // rtpmap, fmtp and ptime attributes of the formats
+	direction string   // sendrecv, sendonly, recvonly or inactive; empty when not given
+
+	// ICE and DTLS parameters of browsers, from the session or the stream
+	iceUfrag    string
+	icePwd      string
+	fingerprint string // Hash function and value, e.g. "sha-256 AB:CD:..."
+	setup       string
+
+	mid      string
+	rejected []sdpStream // Other streams, which an answer has to decline
+
+	rtcpPort int  // From a=rtcp (RFC 3605); 0 when RTCP is on the next port
+	rtcpMux  bool // RTCP shares the RTP port (RFC 5761)
+}
+
+// sdpStream is a declined non-audio stream
+type sdpStream struct {
+	media  string
+	proto  string
+	format string
+	mid    string
+}
+
+// parseSDPAudio reads the first audio stream of an SDP body. It returns
+// nil when there is none.
+func parseSDPAudio(sdp []byte) *sdpAudio {
+	var audio *sdpAudio
+	var sessionAddr, ufrag, pwd, fp, setup string
+	var other *sdpStream
+	var others []sdpStream
+	inAudio := false
+
+	for _, line := range strings.Split(string(sdp), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "m=") {
+			if other != nil {
+				others = append(others, *other)
+				other = nil
+			}
+			fields := strings.Fields(line[2:])
+			inAudio = false
+			if len(fields) < 3 {
+				continue
+			}
+			if fields[0] == "audio" && audio == nil {
+				port, _ := strconv.Atoi(fields[1])
+				audio = &sdpAudio{address: sessionAddr, port: port, proto: fields[2], formats: fields[3:]}
+				inAudio = true
+				continue
+			}
+			other = &sdpStream{media: fields[0], proto: fields[2]}
+			if len(fields) > 3 {
+				other.format = fields[3]
+			}
+			continue
+		}
+
+		value := ""
+		switch {
+		case strings.HasPrefix(line, "c="):
+			fields := strings.Fields(line[2:])
+			if len(fields) == 3 {
+				switch {
+				case inAudio:
+					audio.address = fields[2]
+				case audio == nil && other == nil:
+					sessionAddr = fields[2]
+				}
+			}
+			continue
+		case strings.HasPrefix(line, "a="):
+			value = line[2:]
+		default:
+			continue
+		}
+
+		name, arg, _ := strings.Cut(value, ":")
+		switch {
+		case other != nil:
+			if name == "mid" {
+				other.mid = arg
+			}
+		case name == "ice-ufrag":
+			if inAudio {
+				audio.iceUfrag = arg
+			} else {
+				ufrag = arg
+			}
+		case name == "ice-pwd":
+			if inAudio {
+				audio.icePwd = arg
+			} else {
+				pwd = arg
+			}
+		case name == "fingerprint":
+			if inAudio {
+				audio.fingerprint = arg
+			} else {
+				fp = arg
+			}
+		case name == "setup":
+			if inAudio {
+				audio.setup = arg
+			} else {
+				setup = arg
+			}
+		case !inAudio:
+		case name == "mid":
+			audio.mid = arg
+		case name == "rtpmap", name == "fmtp", name == "ptime", name == "maxptime":
+			audio.attrs = append(audio.attrs, value)
+		case name == "sendrecv", name == "sendonly", name == "recvonly", name == "inactive":
+			audio.direction = name
+		case name == "rtcp":
+			port, _, _ := strings.Cut(arg, " ")
+			audio.rtcpPort, _ = strconv.Atoi(port)
+		case name == "rtcp-mux":
+			audio.rtcpMux = true
+		}
+	}
+	if other != nil {
+		others = append(others, *other)
+	}
+	if audio == nil {
+		return nil
+	}
+
+	// Stream attributes win over session ones
+	if audio.iceUfrag == "" {
+		audio.iceUfrag = ufrag
+	}
+	if audio.icePwd == "" {
+		audio.icePwd = pwd
+	}
+	if audio.fingerprint == "" {
+		audio.fingerprint = fp
+	}
+	if audio.setup == "" {
+		audio.setup = setup
+	}
+	audio.rejected = others
+	return audio
+}
+
+// formatAttrs returns the attributes of the formats a stream keeps
+func (a *sdpAudio) formatAttrs(formats []string) []string {
+	keep := make(map[string]bool, len(formats))
+	for _, pt := range formats {
+		keep[pt] = true
+	}
+	var attrs []string
+	for _, attr := range a.attrs {
+		name, arg, _ := strings.Cut(attr, ":")
+		pt, _, _ := strings.Cut(arg, " ")
+		if name == "ptime" || name == "maxptime" || keep[pt] {
+			attrs = append(attrs, attr)
+		}
+	}
+	return attrs
+}
+
+// phoneSDP describes the phone side of a bridge: the browser's audio
+// formats as plain RTP on the bridge's phone socket
+func phoneSDP(audio *sdpAudio, sessionID, version uint64, ip net.IP, port int) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "v=0\r\no=gosip %d %d IN IP4 %s\r\ns=GoSIP\r\nc=IN IP4 %s\r\nt=0 0\r\n", sessionID, version, ip, ip)
+	fmt.Fprintf(&b, "m=audio %d RTP/AVP %s\r\n", port, strings.Join(audio.formats, " "))
+	for _, attr := range audio.formatAttrs(audio.formats) {
+		b.WriteString("a=" + attr + "\r\n")
+	}
+	if audio.direction != "" {
+		b.WriteString("a=" + audio.direction + "\r\n")
+	}
+	return []byte(b.String())
+}
+
+// browserSDPParams is the browser side of a bridge
+type browserSDPParams struct {
+	sessionID   uint64
+	version     uint64
+	addresses   []net.IP
+	port        int
+	iceUfrag    string
+	icePwd      string
+	fingerprint string
+	setup       string
+	mid         string
+	rejected    []sdpStream // Only in answers
+}
+
+// browserSDP describes the browser side of a bridge: the phone's audio
+// formats as DTLS-SRTP with RTCP multiplexing, reached through an ICE-lite
+// agent (RFC 8445) on the bridge's browser socket
+func browserSDP(audio *sdpAudio, p browserSDPParams) []byte {
+	ip := p.addresses[0]
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "v=0\r\no=gosip %d %d IN IP4 %s\r\ns=GoSIP\r\nt=0 0\r\n", p.sessionID, p.version, ip)
+	b.WriteString("a=ice-lite\r\n")
+	fmt.Fprintf(&b, "a=group:BUNDLE %s\r\n", p.mid)
+	fmt.Fprintf(&b, "m=audio %d UDP/TLS/RTP/SAVPF %s\r\n", p.port, strings.Join(audio.formats, " "))
+	fmt.Fprintf(&b, "c=IN IP4 %s\r\n", ip)
+	fmt.Fprintf(&b, "a=rtcp:%d IN IP4 %s\r\n", p.port, ip)
+	fmt.Fprintf(&b, "a=ice-ufrag:%s\r\na=ice-pwd:%s\r\n", p.iceUfrag, p.icePwd)
+	fmt.Fprintf(&b, "a=fingerprint:sha-256 %s\r\n", p.fingerprint)
+	fmt.Fprintf(&b, "a=setup:%s\r\n", p.setup)
+	fmt.Fprintf(&b, "a=mid:%s\r\n", p.mid)
+	if audio.direction != "" {
+		b.WriteString("a=" + audio.direction + "\r\n")
+	} else {
+		b.WriteString("a=sendrecv\r\n")
+	}
+	b.WriteString("a=rtcp-mux\r\n")
+	for _, attr := range audio.formatAttrs(audio.formats) {
+		b.WriteString("a=" + attr + "\r\n")
+	}
+	for i, addr := range p.addresses {
+		// Host candidates only, in order of preference (RFC 8445 section 5.1.2)
+		priority := 126<<24 | (65535-i)<<8 | 255
+		fmt.Fprintf(&b, "a=candidate:%d 1 udp %d %s %d typ host\r\n", i+1, priority, addr, p.port)
+	}
+	b.WriteString("a=end-of-candidates\r\n")
+
+	for _, s := range p.rejected {
+		fmt.Fprintf(&b, "m=%s 0 %s %s\r\nc=IN IP4 0.0.0.0\r\n", s.media, s.proto, s.format)
+		if s.mid != "" {
+			fmt.Fprintf(&b, "a=mid:%s\r\n", s.mid)
+		}
+		b.WriteString("a=inactive\r\n")
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,664 @@
+// Package sip provides the media bridge between browsers and phones
+package sip
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/pion/dtls/v2"
+	"github.com/pion/dtls/v2/pkg/crypto/fingerprint"
+	"github.com/pion/srtp/v2"
+	"github.com/pion/stun"
+)
+
+// iceChars are the characters of ICE credentials (RFC 8839 ice-char)
+const iceChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// WebRTCBridge carries a call between a browser and a phone, or between
+// two browsers. Calls with a phone leg relay the media: the browser
+// socket answers ICE connectivity checks as an ICE-lite agent, runs the
+// DTLS handshake that keys SRTP and carries the SRTP, all demultiplexed
+// by their first byte (RFC 7983), while the phone socket carries the same
+// audio as plain RTP. RTCP stays on each leg. Calls between browsers only
+// route signalling: their media goes directly between them.
+type WebRTCBridge struct {
+	CallID string
+
+	gw    *WebRTCGateway
+	relay bool
+
+	// localIP is the address the phone reaches GoSIP on
+	localIP net.IP
+	// phoneTransport is the SIP transport requests for the phone go over
+	phoneTransport string
+	// fromTag is the caller's From tag
+	fromTag string
+
+	browser *net.UDPConn // ICE, DTLS and SRTP with the browser
+	phone   *net.UDPConn // RTP with the phone
+
+	iceUfrag  string
+	icePwd    string
+	sessionID uint64
+
+	dtlsPackets chan []byte
+	closed      chan struct{}
+	closeOnce   sync.Once
+
+	mu             sync.Mutex
+	version        uint64 // SDP version, bumped on each re-INVITE
+	mid            string
+	rejected       []sdpStream // The browser's video and data streams, which answers decline
+	roleKnown      bool
+	dtlsClient     bool   // GoSIP starts the DTLS handshake
+	remoteFP       string // The browser's certificate fingerprint
+	browserAddr    *net.UDPAddr
+	phoneAddr      *net.UDPAddr
+	answered       bool
+	dtlsConn       *dtls.Conn
+	encrypt        *srtp.Context // Phone to browser
+	decrypt        *srtp.Context // Browser to phone
+	handshakeStart bool
+	browserCaller  bool         // The browser placed the call
+	payloads       payloadNames // Audio payload types of both parties
+	tap            mediaTap     // Given the call's RTP, e.g. to record it
+
+	// Contacts of the browsers in the call, which the registrations don't
+	// always cover
+	routes map[string]contactRoute
+}
+
+// NewBridge creates the bridge of a call with a browser leg. relay opens
+// the media sockets for a call with a phone, reached at phoneHost.
+func (g *WebRTCGateway) NewBridge(callID string, relay bool, phoneHost string) (*WebRTCBridge, error) {
+	b := &WebRTCBridge{
+		CallID:      callID,
+		gw:          g,
+		relay:       relay,
+		localIP:     g.localIPFor(phoneHost),
+		dtlsPackets: make(chan []byte, 64),
+		closed:      make(chan struct{}),
+		routes:      make(map[string]contactRoute),
+		payloads:    make(payloadNames),
+	}
+
+	if relay {
+		var err error
+		if b.iceUfrag, err = randomICEString(8); err != nil {
+			return nil, err
+		}
+		if b.icePwd, err = randomICEString(24); err != nil {
+			return nil, err
+		}
+		var id [8]byte
+		if _, err := rand.Read(id[:]); err != nil {
+			return nil, err
+		}
+		b.sessionID = binary.BigEndian.Uint64(id[:]) >> 1
+
+		if b.browser, err = g.ports.listen(); err != nil {
+			return nil, err
+		}
+		if b.phone, err = g.ports.listen(); err != nil {
+			b.browser.Close()
+			return nil, err
+		}
+		go b.readBrowser()
+		go b.readPhone()
+	}
+
+	g.mu.Lock()
+	g.bridges[callID] = b
+	g.mu.Unlock()
+	return b, nil
+}
+
+// randomICEString returns n random ICE characters
+func randomICEString(n int) (string, error) {
+	max := big.NewInt(int64(len(iceChars)))
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		c, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(iceChars[c.Int64()])
+	}
+	return b.String(), nil
+}
+
+// Relays reports whether the bridge carries the call's media
+func (b *WebRTCBridge) Relays() bool {
+	return b.relay
+}
+
+// LocalIP is the address phones reach GoSIP on for this call
+func (b *WebRTCBridge) LocalIP() net.IP {
+	return b.localIP
+}
+
+// SetRoute records the WebSocket connection a browser in the call is
+// reached over
+func (b *WebRTCBridge) SetRoute(contact, source, transport string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.routes[routeKey(contact)] = contactRoute{source: source, transport: transport}
+}
+
+// Route returns the WebSocket connection a contact in the call is reached
+// over, from the call or from the browser's registration
+func (b *WebRTCBridge) Route(contact string) (source, transport string, ok bool) {
+	b.mu.Lock()
+	route, ok := b.routes[routeKey(contact)]
+	b.mu.Unlock()
+	if ok {
+		return route.source, route.transport, true
+	}
+	return b.gw.Route(contact)
+}
+
+// Translate converts SDP from either side of the call for the other
+func (b *WebRTCBridge) Translate(sdp []byte, offer bool) ([]byte, error) {
+	if IsWebRTCSDP(sdp) {
+		return b.ToPhone(sdp)
+	}
+	return b.ToBrowser(sdp, offer)
+}
+
+// dialog, defaultTransport and translate make the bridge an anchoredCall
+func (b *WebRTCBridge) dialog() (string, string) { return b.CallID, b.fromTag }
+func (b *WebRTCBridge) defaultTransport() string { return b.phoneTransport }
+func (b *WebRTCBridge) translate(sdp []byte, offer, _ bool) ([]byte, error) {
+	if !b.relay {
+		return sdp, nil
+	}
+	return b.Translate(sdp, offer)
+}
+
+// ToPhone translates the browser's SDP for the phone, keeping the
+// browser's DTLS parameters for the handshake
+func (b *WebRTCBridge) ToPhone(sdp []byte) ([]byte, error) {
+	audio := parseSDPAudio(sdp)
+	if audio == nil {
+		return nil, ErrNoAudio
+	}
+	if audio.iceUfrag == "" || audio.fingerprint == "" {
+		return nil, ErrNotWebRTC
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remoteFP = audio.fingerprint
+	b.rejected = audio.rejected
+	b.payloads.learn(sdp)
+	if b.mid == "" {
+		b.mid = audio.mid
+	}
+	if !b.roleKnown {
+		// The browser offers actpass or answers active, so GoSIP is the
+		// DTLS server unless the browser insists on being one
+		b.dtlsClient = audio.setup == "passive"
+		b.roleKnown = true
+	}
+	return phoneSDP(audio, b.sessionID, b.version, b.localIP, b.phone.LocalAddr().(*net.UDPAddr).Port), nil
+}
+
+// ToBrowser translates the phone's SDP for the browser. The phone's
+// connection address is where its media goes until it sends some.
+// offer declines the browser's other streams when false.
+func (b *WebRTCBridge) ToBrowser(sdp []byte, offer bool) ([]byte, error) {
+	audio := parseSDPAudio(sdp)
+	if audio == nil {
+		return nil, ErrNoAudio
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ip := net.ParseIP(audio.address); ip != nil && !ip.IsUnspecified() && audio.port > 0 {
+		b.phoneAddr = &net.UDPAddr{IP: ip, Port: audio.port}
+	}
+	b.payloads.learn(sdp)
+
+	setup := "actpass"
+	switch {
+	case !b.roleKnown:
+	case b.dtlsClient:
+		setup = "active"
+	default:
+		setup = "passive"
+	}
+	if b.mid == "" {
+		b.mid = "0"
+	}
+
+	addresses := b.gw.addresses
+	if len(addresses) == 0 {
+		addresses = []net.IP{b.localIP}
+	}
+	params := browserSDPParams{
+		sessionID:   b.sessionID,
+		version:     b.version,
+		addresses:   addresses,
+		port:        b.browser.LocalAddr().(*net.UDPAddr).Port,
+		iceUfrag:    b.iceUfrag,
+		icePwd:      b.icePwd,
+		fingerprint: b.gw.fingerprint,
+		setup:       setup,
+		mid:         b.mid,
+	}
+	if !offer {
+		params.rejected = b.rejected
+	}
+	return browserSDP(audio, params), nil
+}
+
+// Renegotiate bumps the SDP version for a re-INVITE
+func (b *WebRTCBridge) Renegotiate() {
+	b.mu.Lock()
+	b.version++
+	b.mu.Unlock()
+}
+
+// Answered starts the DTLS handshake once the call is answered, and from
+// then on ends the bridge when the browser goes quiet
+func (b *WebRTCBridge) Answered() {
+	if !b.relay {
+		return
+	}
+
+	b.mu.Lock()
+	b.answered = true
+	start := !b.handshakeStart && b.roleKnown
+	b.handshakeStart = true
+	b.mu.Unlock()
+
+	b.browser.SetReadDeadline(time.Now().Add(config.WebRTCMediaTimeout))
+	if start {
+		go b.handshake()
+	}
+}
+
+// setTap hands the audio of both parties to tap. Only bridges that relay
+// the media have any.
+func (b *WebRTCBridge) setTap(tap mediaTap) bool {
+	if !b.relay {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tap = tap
+	return true
+}
+
+// Close ends the bridge and frees its sockets
+func (b *WebRTCBridge) Close() {
+	b.closeOnce.Do(func() {
+		close(b.closed)
+
+		b.gw.mu.Lock()
+		if b.gw.bridges[b.CallID] == b {
+			delete(b.gw.bridges, b.CallID)
+		}
+		b.gw.mu.Unlock()
+
+		if !b.relay {
+			return
+		}
+		b.mu.Lock()
+		conn, tap := b.dtlsConn, b.tap
+		b.mu.Unlock()
+		if conn != nil {
+			conn.Close()
+		}
+		b.browser.Close()
+		b.phone.Close()
+		if tap != nil {
+			tap.ended()
+		}
+		slog.Debug("WebRTC bridge closed", "call_id", b.CallID)
+	})
+}
+
+// readBrowser demultiplexes the browser socket
+func (b *WebRTCBridge) readBrowser() {
+	defer b.Close()
+
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := b.browser.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				slog.Info("WebRTC media timed out", "call_id", b.CallID)
+				return
+			}
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+
+		b.mu.Lock()
+		if b.answered {
+			b.browser.SetReadDeadline(time.Now().Add(config.WebRTCMediaTimeout))
+		}
+		from := b.browserAddr
+		b.mu.Unlock()
+
+		packet := buf[:n]
+		switch {
+		case packet[0] < 4:
+			b.handleSTUN(packet, addr)
+		case packet[0] >= 20 && packet[0] < 64:
+			if from == nil || !addrEqual(from, addr) {
+				continue
+			}
+			select {
+			case b.dtlsPackets <- append([]byte(nil), packet...):
+			default:
+			}
+		case packet[0] >= 128 && packet[0] < 192:
+			if from != nil && addrEqual(from, addr) && !isRTCP(packet) {
+				b.relayToPhone(packet)
+			}
+		}
+	}
+}
+
+// readPhone relays the phone's RTP to the browser
+func (b *WebRTCBridge) readPhone() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := b.phone.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		packet := buf[:n]
+		if n < 12 || packet[0] < 128 || packet[0] >= 192 || isRTCP(packet) {
+			continue
+		}
+
+		b.mu.Lock()
+		// Symmetric RTP: answer phones behind NAT where they send from
+		b.phoneAddr = addr
+		enc, to := b.encrypt, b.browserAddr
+		tap, encoding, fromCaller := b.tap, "", !b.browserCaller
+		if tap != nil {
+			encoding = b.payloads.encoding(packet)
+		}
+		b.mu.Unlock()
+		if encoding != "" {
+			tap.media(fromCaller, encoding, packet)
+		}
+		if enc == nil || to == nil {
+			continue
+		}
+
+		out, err := enc.EncryptRTP(nil, packet, nil)
+		if err != nil {
+			continue
+		}
+		b.browser.WriteToUDP(out, to)
+	}
+}
+
+// relayToPhone decrypts the browser's SRTP and sends it to the phone
+func (b *WebRTCBridge) relayToPhone(packet []byte) {
+	b.mu.Lock()
+	dec, to, tap, fromCaller := b.decrypt, b.phoneAddr, b.tap, b.browserCaller
+	b.mu.Unlock()
+	if dec == nil || to == nil {
+		return
+	}
+
+	out, err := dec.DecryptRTP(nil, packet, nil)
+	if err != nil {
+		return
+	}
+	b.phone.WriteToUDP(out, to)
+	if tap != nil {
+		if encoding := b.encoding(out); encoding != "" {
+			tap.media(fromCaller, encoding, out)
+		}
+	}
+}
+
+// encoding returns the encoding name of an RTP packet's payload type
+func (b *WebRTCBridge) encoding(packet []byte) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.payloads.encoding(packet)
+}
+
+// isRTCP reports whether a packet on a multiplexed stream is RTCP: its
+// packet type is in the range RTP payload types avoid (RFC 5761)
+func isRTCP(packet []byte) bool {
+	return len(packet) > 1 && packet[1] >= 192 && packet[1] <= 223
+}
+
+// addrEqual compares two UDP addresses
+func addrEqual(a, b *net.UDPAddr) bool {
+	return a.Port == b.Port && a.IP.Equal(b.IP)
+}
+
+// handleSTUN answers the browser's ICE connectivity checks. An ICE-lite
+// agent never sends checks of its own: it answers those carrying its
+// credentials and sends media to the address the browser nominates.
+func (b *WebRTCBridge) handleSTUN(packet []byte, addr *net.UDPAddr) {
+	msg := &stun.Message{Raw: append([]byte(nil), packet...)}
+	if err := msg.Decode(); err != nil || msg.Type != stun.BindingRequest {
+		return
+	}
+
+	var user stun.Username
+	if err := user.GetFrom(msg); err != nil || !strings.HasPrefix(user.String(), b.iceUfrag+":") {
+		return
+	}
+	integrity := stun.NewShortTermIntegrity(b.icePwd)
+	if err := integrity.Check(msg); err != nil {
+		return
+	}
+
+	res, err := stun.Build(msg, stun.BindingSuccess,
+		&stun.XORMappedAddress{IP: addr.IP, Port: addr.Port},
+		integrity, stun.Fingerprint)
+	if err != nil {
+		return
+	}
+	b.browser.WriteToUDP(res.Raw, addr)
+
+	b.mu.Lock()
+	if b.browserAddr == nil || msg.Contains(stun.AttrUseCandidate) {
+		if b.browserAddr == nil || !addrEqual(b.browserAddr, addr) {
+			slog.Debug("WebRTC browser address", "call_id", b.CallID, "addr", addr.String())
+		}
+		b.browserAddr = addr
+	}
+	b.mu.Unlock()
+}
+
+// handshake runs DTLS with the browser and keys SRTP from it (RFC 5764)
+func (b *WebRTCBridge) handshake() {
+	ctx, cancel := context.WithTimeout(context.Background(), config.WebRTCHandshakeTimeout)
+	defer cancel()
+
+	b.mu.Lock()
+	client := b.dtlsClient
+	b.mu.Unlock()
+
+	cfg := &dtls.Config{
+		Certificates: []tls.Certificate{b.gw.cert},
+		SRTPProtectionProfiles: []dtls.SRTPProtectionProfile{
+			dtls.SRTP_AEAD_AES_128_GCM,
+			dtls.SRTP_AES128_CM_HMAC_SHA1_80,
+		},
+		// The certificates are self-signed: the fingerprint in the SDP,
+		// which came over the authenticated signalling, vouches for them
+		InsecureSkipVerify:    true,
+		ClientAuth:            dtls.RequireAnyClientCert,
+		VerifyPeerCertificate: b.verifyFingerprint,
+	}
+
+	transport := &dtlsTransport{b: b}
+	var conn *dtls.Conn
+	var err error
+	if client {
+		conn, err = dtls.ClientWithContext(ctx, transport, cfg)
+	} else {
+		conn, err = dtls.ServerWithContext(ctx, transport, cfg)
+	}
+	if err != nil {
+		select {
+		case <-b.closed:
+		default:
+			slog.Warn("WebRTC DTLS handshake failed", "error", err, "call_id", b.CallID)
+			b.Close()
+		}
+		return
+	}
+
+	encrypt, decrypt, err := srtpContexts(conn, client)
+	if err != nil {
+		slog.Warn("Failed to key SRTP from DTLS", "error", err, "call_id", b.CallID)
+		conn.Close()
+		b.Close()
+		return
+	}
+
+	b.mu.Lock()
+	b.dtlsConn, b.encrypt, b.decrypt = conn, encrypt, decrypt
+	b.mu.Unlock()
+
+	select {
+	case <-b.closed:
+		conn.Close()
+	default:
+		slog.Info("WebRTC media connected", "call_id", b.CallID)
+	}
+}
+
+// srtpContexts derives the SRTP contexts for each direction from a
+// completed DTLS handshake
+func srtpContexts(conn *dtls.Conn, client bool) (encrypt, decrypt *srtp.Context, err error) {
+	selected, ok := conn.SelectedSRTPProtectionProfile()
+	if !ok {
+		return nil, nil, fmt.Errorf("no SRTP protection profile negotiated")
+	}
+	cfg := &srtp.Config{}
+	switch selected {
+	case dtls.SRTP_AEAD_AES_128_GCM:
+		cfg.Profile = srtp.ProtectionProfileAeadAes128Gcm
+	case dtls.SRTP_AES128_CM_HMAC_SHA1_80:
+		cfg.Profile = srtp.ProtectionProfileAes128CmHmacSha1_80
+	default:
+		return nil, nil, fmt.Errorf("unsupported SRTP protection profile %#x", selected)
+	}
+
+	state := conn.ConnectionState()
+	if err := cfg.ExtractSessionKeysFromDTLS(&state, client); err != nil {
+		return nil, nil, err
+	}
+	encrypt, err = srtp.CreateContext(cfg.Keys.LocalMasterKey, cfg.Keys.LocalMasterSalt, cfg.Profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	decrypt, err = srtp.CreateContext(cfg.Keys.RemoteMasterKey, cfg.Keys.RemoteMasterSalt, cfg.Profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encrypt, decrypt, nil
+}
+
+// verifyFingerprint checks the browser's certificate against the
+// fingerprint in its SDP
+func (b *WebRTCBridge) verifyFingerprint(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errors.New("browser sent no certificate")
+	}
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	remote := b.remoteFP
+	b.mu.Unlock()
+
+	algorithm, value, _ := strings.Cut(remote, " ")
+	hash, err := fingerprint.HashFromString(algorithm)
+	if err != nil {
+		return err
+	}
+	actual, err := fingerprint.Fingerprint(cert, hash)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actual, strings.TrimSpace(value)) {
+		return errors.New("browser certificate does not match its fingerprint")
+	}
+	return nil
+}
+
+// dtlsTransport is the DTLS records of a bridge's browser socket as a
+// net.Conn for the DTLS library
+type dtlsTransport struct {
+	b *WebRTCBridge
+}
+
+func (t *dtlsTransport) Read(p []byte) (int, error) {
+	select {
+	case packet := <-t.b.dtlsPackets:
+		return copy(p, packet), nil
+	case <-t.b.closed:
+		return 0, net.ErrClosed
+	}
+}
+
+// Write sends to the address ICE settled on. Records sent before then
+// are dropped and the DTLS retransmission timer sends them again.
+func (t *dtlsTransport) Write(p []byte) (int, error) {
+	t.b.mu.Lock()
+	to := t.b.browserAddr
+	t.b.mu.Unlock()
+	if to == nil {
+		return len(p), nil
+	}
+	return t.b.browser.WriteToUDP(p, to)
+}
+
+func (t *dtlsTransport) Close() error { return nil }
+
+func (t *dtlsTransport) LocalAddr() net.Addr { return t.b.browser.LocalAddr() }
+
+func (t *dtlsTransport) RemoteAddr() net.Addr {
+	t.b.mu.Lock()
+	defer t.b.mu.Unlock()
+	if t.b.browserAddr == nil {
+		return &net.UDPAddr{}
+	}
+	return t.b.browserAddr
+}
+
+func (t *dtlsTransport) SetDeadline(time.Time) error      { return nil }
+func (t *dtlsTransport) SetReadDeadline(time.Time) error  { return nil }
+func (t *dtlsTransport) SetWriteDeadline(time.Time) error { return nil }
@@ -0,0 +1,619 @@
+package sip
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btafoya/gosip/internal/config"
+	"github.com/btafoya/gosip/internal/models"
+	"github.com/emiago/sipgo/sip"
+	"github.com/pion/dtls/v2"
+	"github.com/pion/dtls/v2/pkg/crypto/fingerprint"
+	"github.com/pion/dtls/v2/pkg/crypto/selfsign"
+	"github.com/pion/rtp"
+	"github.com/pion/stun"
+)
+
+// chromeOffer is an audio and video offer as Chrome sends it
+func chromeOffer(fp string) []byte {
+	return []byte(strings.ReplaceAll(`v=0
+o=- 4611731400430051336 2 IN IP4 127.0.0.1
+s=-
+t=0 0
+a=group:BUNDLE 0 1
+a=extmap-allow-mixed
+a=msid-semantic: WMS
+m=audio 9 UDP/TLS/RTP/SAVPF 111 63 9 0 8 13 110 126
+c=IN IP4 0.0.0.0
+a=rtcp:9 IN IP4 0.0.0.0
+a=candidate:1 1 udp 2122260223 127.0.0.1 54321 typ host
+a=ice-ufrag:Bx9q
+a=ice-pwd:Jq7Lr5mYf0kPz3VwGtHn8sXe
+a=ice-options:trickle
+a=fingerprint:sha-256 `+fp+`
+a=setup:actpass
+a=mid:0
+a=extmap:1 urn:ietf:params:rtp-hdrext:ssrc-audio-level
+a=sendrecv
+a=msid:- 5f0c
+a=rtcp-mux
+a=rtpmap:111 opus/48000/2
+a=rtcp-fb:111 transport-cc
+a=fmtp:111 minptime=10;useinbandfec=1
+a=rtpmap:63 red/48000/2
+a=fmtp:63 111/111
+a=rtpmap:9 G722/8000
+a=rtpmap:0 PCMU/8000
+a=rtpmap:8 PCMA/8000
+a=rtpmap:13 CN/8000
+a=rtpmap:110 telephone-event/48000
+a=rtpmap:126 telephone-event/8000
+a=ssrc:1234 cname:abc
+m=video 9 UDP/TLS/RTP/SAVPF 96 97
+c=IN IP4 0.0.0.0
+a=mid:1
+a=rtpmap:96 VP8/90000
+`, "\n", "\r\n"))
+}
+
+const testFingerprint = "AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89"
+
+// phoneAnswer is a phone's answer choosing PCMU
+func phoneAnswer(port int) []byte {
+	return []byte(fmt.Sprintf("v=0\r\no=phone 1 1 IN IP4 127.0.0.1\r\ns=-\r\nc=IN IP4 127.0.0.1\r\nt=0 0\r\nm=audio %d RTP/AVP 0 126\r\na=rtpmap:0 PCMU/8000\r\na=rtpmap:126 telephone-event/8000\r\na=ptime:20\r\na=sendrecv\r\n", port))
+}
+
+func newTestGateway(t *testing.T) *WebRTCGateway {
+	t.Helper()
+	gw, err := NewWebRTCGateway(&config.WebRTCConfig{Enabled: true}, "203.0.113.10")
+	if err != nil {
+		t.Fatalf("NewWebRTCGateway failed: %v", err)
+	}
+	t.Cleanup(gw.Close)
+	return gw
+}
+
+func TestIsWebRTCSDP(t *testing.T) {
+	if !IsWebRTCSDP(chromeOffer(testFingerprint)) {
+		t.Error("Expected Chrome's offer to be WebRTC")
+	}
+	if IsWebRTCSDP(phoneAnswer(4000)) {
+		t.Error("Expected a phone's SDP not to be WebRTC")
+	}
+	if IsWebRTCSDP(nil) {
+		t.Error("Expected no SDP not to be WebRTC")
+	}
+}
+
+func TestParseSDPAudio(t *testing.T) {
+	audio := parseSDPAudio(chromeOffer(testFingerprint))
+	if audio == nil {
+		t.Fatal("Expected an audio stream")
+	}
+	if audio.port != 9 || audio.proto != "UDP/TLS/RTP/SAVPF" || audio.address != "0.0.0.0" {
+		t.Errorf("Unexpected stream %d %s %s", audio.port, audio.proto, audio.address)
+	}
+	if got := strings.Join(audio.formats, " "); got != "111 63 9 0 8 13 110 126" {
+		t.Errorf("Unexpected formats %q", got)
+	}
+	if audio.iceUfrag != "Bx9q" || audio.icePwd != "Jq7Lr5mYf0kPz3VwGtHn8sXe" || audio.fingerprint != "sha-256 "+testFingerprint {
+		t.Errorf("Unexpected ICE and DTLS parameters %+v", audio)
+	}
+	if audio.setup != "actpass" || audio.mid != "0" || audio.direction != "sendrecv" {
+		t.Errorf("Unexpected setup %q, mid %q or direction %q", audio.setup, audio.mid, audio.direction)
+	}
+	for _, attr := range audio.attrs {
+		if strings.HasPrefix(attr, "rtcp-fb") || strings.HasPrefix(attr, "ssrc") {
+			t.Errorf("Expected only format attributes, got %q", attr)
+		}
+	}
+	if len(audio.rejected) != 1 || audio.rejected[0] != (sdpStream{media: "video", proto: "UDP/TLS/RTP/SAVPF", format: "96", mid: "1"}) {
+		t.Errorf("Unexpected other streams %+v", audio.rejected)
+	}
+
+	if parseSDPAudio([]byte("v=0\r\nm=video 4000 RTP/AVP 96\r\n")) != nil {
+		t.Error("Expected no audio stream")
+	}
+}
+
+func TestWebRTCBridge_TranslateBrowserOffer(t *testing.T) {
+	gw := newTestGateway(t)
+	bridge, err := gw.NewBridge("call-1", true, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("NewBridge failed: %v", err)
+	}
+
+	offer, err := bridge.Translate(chromeOffer(testFingerprint), true)
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	phonePort := bridge.phone.LocalAddr().(*net.UDPAddr).Port
+	for _, want := range []string{
+		"c=IN IP4 127.0.0.1\r\n",
+		fmt.Sprintf("m=audio %d RTP/AVP 111 63 9 0 8 13 110 126\r\n", phonePort),
+		"a=rtpmap:0 PCMU/8000\r\n",
+		"a=fmtp:111 minptime=10;useinbandfec=1\r\n",
+		"a=sendrecv\r\n",
+	} {
+		if !strings.Contains(string(offer), want) {
+			t.Errorf("Expected phone offer to contain %q, got:\n%s", want, offer)
+		}
+	}
+	for _, unwanted := range []string{"ice-", "fingerprint", "candidate", "rtcp-fb", "ssrc", "m=video"} {
+		if strings.Contains(string(offer), unwanted) {
+			t.Errorf("Expected phone offer without %q, got:\n%s", unwanted, offer)
+		}
+	}
+
+	answer, err := bridge.Translate(phoneAnswer(4000), false)
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	browserPort := bridge.browser.LocalAddr().(*net.UDPAddr).Port
+	for _, want := range []string{
+		"a=ice-lite\r\n",
+		"a=group:BUNDLE 0\r\n",
+		fmt.Sprintf("m=audio %d UDP/TLS/RTP/SAVPF 0 126\r\n", browserPort),
+		"c=IN IP4 203.0.113.10\r\n",
+		"a=ice-ufrag:" + bridge.iceUfrag + "\r\n",
+		"a=fingerprint:sha-256 " + gw.fingerprint + "\r\n",
+		"a=setup:passive\r\n",
+		"a=mid:0\r\n",
+		"a=rtcp-mux\r\n",
+		"a=ptime:20\r\n",
+		fmt.Sprintf("a=candidate:1 1 udp 2130706431 203.0.113.10 %d typ host\r\n", browserPort),
+		"a=end-of-candidates\r\n",
+		"m=video 0 UDP/TLS/RTP/SAVPF 96\r\nc=IN IP4 0.0.0.0\r\na=mid:1\r\na=inactive\r\n",
+	} {
+		if !strings.Contains(string(answer), want) {
+			t.Errorf("Expected browser answer to contain %q, got:\n%s", want, answer)
+		}
+	}
+	if bridge.phoneAddr == nil || bridge.phoneAddr.Port != 4000 {
+		t.Errorf("Expected media for the phone sent to its SDP address, got %v", bridge.phoneAddr)
+	}
+	if bridge.dtlsClient {
+		t.Error("Expected GoSIP to be the DTLS server when the browser offers actpass")
+	}
+}
+
+func TestWebRTCBridge_TranslatePhoneOffer(t *testing.T) {
+	gw := newTestGateway(t)
+	bridge, err := gw.NewBridge("call-2", true, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("NewBridge failed: %v", err)
+	}
+
+	offer, err := bridge.Translate(phoneAnswer(4000), true)
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if !strings.Contains(string(offer), "a=setup:actpass\r\n") || !strings.Contains(string(offer), "a=mid:0\r\n") {
+		t.Errorf("Expected an actpass offer with mid 0, got:\n%s", offer)
+	}
+
+	// The browser answers, choosing to be the DTLS server
+	answer := strings.Replace(string(chromeOffer(testFingerprint)), "a=setup:actpass", "a=setup:passive", 1)
+	if _, err := bridge.Translate([]byte(answer), false); err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if !bridge.dtlsClient {
+		t.Error("Expected GoSIP to be the DTLS client when the browser is passive")
+	}
+
+	// Re-INVITEs keep the roles
+	bridge.Renegotiate()
+	reoffer, err := bridge.Translate(phoneAnswer(4000), true)
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	if !strings.Contains(string(reoffer), "a=setup:active\r\n") || !strings.Contains(string(reoffer), fmt.Sprintf("o=gosip %d 1 ", bridge.sessionID)) {
+		t.Errorf("Expected a re-offer keeping GoSIP active with a new version, got:\n%s", reoffer)
+	}
+
+	if _, err := bridge.ToPhone(phoneAnswer(4000)); !errors.Is(err, ErrNotWebRTC) {
+		t.Errorf("Expected ErrNotWebRTC, got %v", err)
+	}
+	if _, err := bridge.Translate([]byte("v=0\r\n"), true); !errors.Is(err, ErrNoAudio) {
+		t.Errorf("Expected ErrNoAudio, got %v", err)
+	}
+}
+
+func TestWebRTCGateway_Routes(t *testing.T) {
+	gw := newTestGateway(t)
+
+	gw.SetRoute("<sip:k3v1@df7jal23ls0d.invalid;transport=ws>", "198.51.100.7:50123", "WSS", time.Now().Add(time.Hour))
+	gw.SetRoute("sip:old@x.invalid;transport=ws", "198.51.100.8:50124", "WSS", time.Now().Add(-time.Second))
+
+	source, transport, ok := gw.Route("sip:K3V1@df7jal23ls0d.invalid;transport=ws;ob")
+	if !ok || source != "198.51.100.7:50123" || transport != "WSS" {
+		t.Errorf("Route = %q %q %v", source, transport, ok)
+	}
+	if _, _, ok := gw.Route("sip:old@x.invalid"); ok {
+		t.Error("Expected expired route to be gone")
+	}
+
+	gw.RemoveRoute("sip:k3v1@df7jal23ls0d.invalid")
+	if _, _, ok := gw.Route("sip:k3v1@df7jal23ls0d.invalid"); ok {
+		t.Error("Expected removed route to be gone")
+	}
+
+	bridge, err := gw.NewBridge("call-3", false, "")
+	if err != nil {
+		t.Fatalf("NewBridge failed: %v", err)
+	}
+	bridge.SetRoute("sip:caller@a.invalid;transport=ws", "198.51.100.9:50125", "WS")
+	if source, _, ok := bridge.Route("sip:caller@a.invalid"); !ok || source != "198.51.100.9:50125" {
+		t.Errorf("Expected the call's route, got %q %v", source, ok)
+	}
+	if gw.Bridge("call-3") != bridge {
+		t.Error("Expected the bridge to be registered")
+	}
+	bridge.Close()
+	if gw.Bridge("call-3") != nil {
+		t.Error("Expected the closed bridge to be gone")
+	}
+}
+
+func TestWebRTCGateway_PortRange(t *testing.T) {
+	probe, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	low := probe.LocalAddr().(*net.UDPAddr).Port
+	probe.Close()
+
+	gw, err := NewWebRTCGateway(&config.WebRTCConfig{Enabled: true, Ports: fmt.Sprintf("%d-%d", low, low+1)}, "")
+	if err != nil {
+		t.Fatalf("NewWebRTCGateway failed: %v", err)
+	}
+	defer gw.Close()
+
+	bridge, err := gw.NewBridge("call-4", true, "127.0.0.1")
+	if err != nil {
+		t.Skipf("Ports %d-%d not free: %v", low, low+1, err)
+	}
+	for _, conn := range []*net.UDPConn{bridge.browser, bridge.phone} {
+		if port := conn.LocalAddr().(*net.UDPAddr).Port; port < low || port > low+1 {
+			t.Errorf("Expected a port in %d-%d, got %d", low, low+1, port)
+		}
+	}
+	if _, err := gw.NewBridge("call-5", true, "127.0.0.1"); !errors.Is(err, ErrNoMediaPorts) {
+		t.Errorf("Expected ErrNoMediaPorts, got %v", err)
+	}
+}
+
+func TestWebRTCBridge_VerifyFingerprint(t *testing.T) {
+	gw := newTestGateway(t)
+	bridge, err := gw.NewBridge("call-6", true, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("NewBridge failed: %v", err)
+	}
+
+	cert, fp := testBrowserCertificate(t)
+	if _, err := bridge.ToPhone(chromeOffer(fp)); err != nil {
+		t.Fatalf("ToPhone failed: %v", err)
+	}
+	if err := bridge.verifyFingerprint(cert.Certificate, nil); err != nil {
+		t.Errorf("Expected the browser's certificate to match, got %v", err)
+	}
+
+	if _, err := bridge.ToPhone(chromeOffer(testFingerprint)); err != nil {
+		t.Fatalf("ToPhone failed: %v", err)
+	}
+	if err := bridge.verifyFingerprint(cert.Certificate, nil); err == nil {
+		t.Error("Expected a certificate not matching the fingerprint to be refused")
+	}
+}
+
+func testBrowserCertificate(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+	cert, err := selfsign.GenerateSelfSigned()
+	if err != nil {
+		t.Fatalf("GenerateSelfSigned failed: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate failed: %v", err)
+	}
+	fp, err := fingerprint.Fingerprint(leaf, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Fingerprint failed: %v", err)
+	}
+	return cert, strings.ToUpper(fp)
+}
+
+// testBrowser plays the browser's side of the media: STUN, DTLS and SRTP
+// on one socket
+type testBrowser struct {
+	conn   *net.UDPConn
+	bridge *net.UDPAddr
+	stun   chan []byte
+	dtls   chan []byte
+	rtp    chan []byte
+}
+
+func newTestBrowser(t *testing.T, bridgePort int) *testBrowser {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	b := &testBrowser{
+		conn:   conn,
+		bridge: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: bridgePort},
+		stun:   make(chan []byte, 16),
+		dtls:   make(chan []byte, 64),
+		rtp:    make(chan []byte, 64),
+	}
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			packet := append([]byte(nil), buf[:n]...)
+			switch {
+			case packet[0] < 4:
+				b.stun <- packet
+			case packet[0] < 64:
+				b.dtls <- packet
+			default:
+				b.rtp <- packet
+			}
+		}
+	}()
+	return b
+}
+
+func (b *testBrowser) Read(p []byte) (int, error) {
+	select {
+	case packet := <-b.dtls:
+		return copy(p, packet), nil
+	case <-time.After(5 * time.Second):
+		return 0, errors.New("timeout")
+	}
+}
+func (b *testBrowser) Write(p []byte) (int, error)        { return b.conn.WriteToUDP(p, b.bridge) }
+func (b *testBrowser) Close() error                       { return nil }
+func (b *testBrowser) LocalAddr() net.Addr                { return b.conn.LocalAddr() }
+func (b *testBrowser) RemoteAddr() net.Addr               { return b.bridge }
+func (b *testBrowser) SetDeadline(t time.Time) error      { return nil }
+func (b *testBrowser) SetReadDeadline(t time.Time) error  { return nil }
+func (b *testBrowser) SetWriteDeadline(t time.Time) error { return nil }
+
+func TestWebRTCBridge_Media(t *testing.T) {
+	gw := newTestGateway(t)
+	bridge, err := gw.NewBridge("call-7", true, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("NewBridge failed: %v", err)
+	}
+
+	phone, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer phone.Close()
+
+	cert, fp := testBrowserCertificate(t)
+	offer, err := bridge.Translate(chromeOffer(fp), true)
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	phoneSide := parseSDPAudio(offer)
+	answer, err := bridge.Translate(phoneAnswer(phone.LocalAddr().(*net.UDPAddr).Port), false)
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+	browserSide := parseSDPAudio(answer)
+	bridge.Answered()
+
+	browser := newTestBrowser(t, browserSide.port)
+
+	// ICE: the browser nominates the only candidate pair
+	check, err := stun.Build(stun.TransactionID, stun.BindingRequest,
+		stun.NewUsername(browserSide.iceUfrag+":Bx9q"),
+		&stun.RawAttribute{Type: stun.AttrUseCandidate},
+		stun.NewShortTermIntegrity(browserSide.icePwd), stun.Fingerprint)
+	if err != nil {
+		t.Fatalf("Failed to build connectivity check: %v", err)
+	}
+	if _, err := browser.Write(check.Raw); err != nil {
+		t.Fatalf("Failed to send connectivity check: %v", err)
+	}
+	select {
+	case raw := <-browser.stun:
+		res := &stun.Message{Raw: raw}
+		if err := res.Decode(); err != nil || res.Type != stun.BindingSuccess {
+			t.Fatalf("Expected a binding success, got %v %v", res.Type, err)
+		}
+		if err := stun.NewShortTermIntegrity(browserSide.icePwd).Check(res); err != nil {
+			t.Errorf("Expected the response signed with GoSIP's password: %v", err)
+		}
+		var mapped stun.XORMappedAddress
+		if err := mapped.GetFrom(res); err != nil || mapped.Port != browser.conn.LocalAddr().(*net.UDPAddr).Port {
+			t.Errorf("Expected the browser's address mapped, got %v %v", mapped, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No answer to the connectivity check")
+	}
+
+	// DTLS: the browser offered actpass, so it is the client
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := dtls.ClientWithContext(ctx, browser, &dtls.Config{
+		Certificates:           []tls.Certificate{cert},
+		SRTPProtectionProfiles: []dtls.SRTPProtectionProfile{dtls.SRTP_AES128_CM_HMAC_SHA1_80},
+		InsecureSkipVerify:     true,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			leaf, err := x509.ParseCertificate(raw[0])
+			if err != nil {
+				return err
+			}
+			got, _ := fingerprint.Fingerprint(leaf, crypto.SHA256)
+			if !strings.EqualFold(got, gw.fingerprint) {
+				return errors.New("GoSIP's certificate does not match its SDP")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("DTLS handshake failed: %v", err)
+	}
+	defer conn.Close()
+	encrypt, decrypt, err := srtpContexts(conn, true)
+	if err != nil {
+		t.Fatalf("srtpContexts failed: %v", err)
+	}
+
+	// Browser to phone: GoSIP may still be finishing its side of the
+	// handshake, so keep sending until a packet arrives
+	packet := func(seq uint16, payload string) []byte {
+		raw, _ := (&rtp.Packet{Header: rtp.Header{Version: 2, PayloadType: 0, SequenceNumber: seq, Timestamp: uint32(seq) * 160, SSRC: 0x1234}, Payload: []byte(payload)}).Marshal()
+		return raw
+	}
+	received := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 1500)
+		phone.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := phone.ReadFromUDP(buf)
+		if err == nil {
+			received <- append([]byte(nil), buf[:n]...)
+		}
+		close(received)
+	}()
+	var plain []byte
+	for seq := uint16(1); plain == nil && seq < 100; seq++ {
+		srtpPacket, err := encrypt.EncryptRTP(nil, packet(seq, "hello phone"), nil)
+		if err != nil {
+			t.Fatalf("EncryptRTP failed: %v", err)
+		}
+		browser.Write(srtpPacket)
+		select {
+		case plain = <-received:
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	var got rtp.Packet
+	if plain == nil || got.Unmarshal(plain) != nil || string(got.Payload) != "hello phone" {
+		t.Fatalf("Expected the phone to get plain RTP, got %x", plain)
+	}
+
+	// Phone to browser
+	phoneAddr := &net.UDPAddr{IP: net.ParseIP(phoneSide.address), Port: phoneSide.port}
+	if _, err := phone.WriteToUDP(packet(500, "hello browser"), phoneAddr); err != nil {
+		t.Fatalf("Failed to send RTP: %v", err)
+	}
+	select {
+	case srtpPacket := <-browser.rtp:
+		out, err := decrypt.DecryptRTP(nil, srtpPacket, nil)
+		if err != nil || got.Unmarshal(out) != nil || string(got.Payload) != "hello browser" {
+			t.Errorf("Expected the browser to get SRTP of the phone's audio, got %x %v", out, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No media reached the browser")
+	}
+}
+
+func TestServer_BridgeWebRTC(t *testing.T) {
+	database := setupTestDB(t)
+
+	newInvite := func(transport string) *sip.Request {
+		req := parseTestInvite(t, "Contact: <sip:caller@a1b2.invalid;transport=ws>")
+		req.SetBody(chromeOffer(testFingerprint))
+		req.SetTransport(transport)
+		req.SetSource("198.51.100.7:50123")
+		return req
+	}
+	phone := &models.Registration{DeviceID: 2, Contact: "sip:desk@127.0.0.1:5062", Transport: "udp"}
+	browser := &models.Registration{DeviceID: 3, Contact: "sip:k3v1@df7jal23ls0d.invalid;transport=ws", Transport: "wss"}
+
+	t.Run("gateway disabled", func(t *testing.T) {
+		server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0"}, database)
+		if err != nil {
+			t.Fatalf("NewServer failed: %v", err)
+		}
+		req := newInvite("WSS")
+		fwd, _ := forwardRequest(req, phone.Contact)
+		if _, status, _ := server.bridgeWebRTC(req, fwd, phone); status != sip.StatusNotAcceptableHere {
+			t.Errorf("Expected 488 for a browser calling a phone, got %d", status)
+		}
+		req = parseTestInvite(t)
+		fwd, _ = forwardRequest(req, phone.Contact)
+		if bridge, status, _ := server.bridgeWebRTC(req, fwd, phone); bridge != nil || status != 0 {
+			t.Errorf("Expected calls between phones left alone, got %v %d", bridge, status)
+		}
+	})
+
+	server, err := NewServer(Config{Port: 5060, UserAgent: "GoSIP-Test/1.0", WebRTC: &config.WebRTCConfig{Enabled: true}}, database)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	defer server.webrtc.Close()
+
+	t.Run("browser calls phone", func(t *testing.T) {
+		req := newInvite("WSS")
+		fwd, _ := forwardRequest(req, phone.Contact)
+		bridge, status, _ := server.bridgeWebRTC(req, fwd, phone)
+		if status != 0 || bridge == nil || !bridge.Relays() {
+			t.Fatalf("Expected a relaying bridge, got %v %d", bridge, status)
+		}
+		defer bridge.Close()
+
+		if fwd.Transport() != "UDP" {
+			t.Errorf("Expected the phone reached over UDP, got %s", fwd.Transport())
+		}
+		rr := fwd.GetHeader("Record-Route")
+		if rr == nil || !strings.Contains(rr.Value(), "127.0.0.1:5060") || !strings.Contains(rr.Value(), "lr") {
+			t.Errorf("Expected GoSIP to record the route, got %v", rr)
+		}
+		if IsWebRTCSDP(fwd.Body()) || !strings.Contains(string(fwd.Body()), "RTP/AVP") {
+			t.Errorf("Expected the offer translated for the phone, got:\n%s", fwd.Body())
+		}
+		if source, _, ok := bridge.Route("sip:caller@a1b2.invalid"); !ok || source != "198.51.100.7:50123" {
+			t.Errorf("Expected the caller's WebSocket recorded, got %q %v", source, ok)
+		}
+		if server.webrtcBridge(req.CallID().Value()) != bridge {
+			t.Error("Expected the bridge found by Call-ID")
+		}
+	})
+
+	t.Run("phone calls unregistered browser", func(t *testing.T) {
+		req := parseTestInvite(t)
+		req.SetBody(phoneAnswer(4000))
+		fwd, _ := forwardRequest(req, browser.Contact)
+		if _, status, _ := server.bridgeWebRTC(req, fwd, browser); status != sip.StatusTemporarilyUnavailable {
+			t.Errorf("Expected 480 without a WebSocket route, got %d", status)
+		}
+	})
+
+	t.Run("phone calls browser", func(t *testing.T) {
+		server.webrtc.SetRoute(browser.Contact, "198.51.100.8:50124", "WSS", time.Now().Add(time.Hour))
+		req := parseTestInvite(t)
+		req.SetBody(phoneAnswer(4000))
+		fwd, _ := forwardRequest(req, browser.Contact)
+		bridge, status, _ := server.bridgeWebRTC(req, fwd, browser)
+		if status != 0 || bridge == nil {
+			t.Fatalf("Expected a bridge, got %d", status)
+		}
+		defer bridge.Close()
+
+		if fwd.Destination() != "198.51.100.8:50124" || fwd.Transport() != "WSS" {
+			t.Errorf("Expected the INVITE sent down the browser's WebSocket, got %s %s", fwd.Destination(), fwd.Transport())
+		}
+		if !IsWebRTCSDP(fwd.Body()) || !strings.Contains(string(fwd.Body()), "a=setup:actpass") {
+			t.Errorf("Expected a WebRTC offer for the browser, got:\n%s", fwd.Body())
+		}
+	})
+}